@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// CircuitBreakerConfig aborts a campaign whose recent files fail too
+// often, which usually means the environment rather than the corpus is
+// broken
+type CircuitBreakerConfig struct {
+	// FailureRate trips the breaker when more than this share, from 0 to
+	// 1, of the last Window results failed
+	FailureRate float64 `yaml:"failure_rate"`
+	// Window is how many of the latest results the rate is taken over
+	// (default 20)
+	Window int `yaml:"window"`
+}
+
+// campaignBreaker decides when to abort a campaign. Results of quarantined
+// modules do not count.
+type campaignBreaker struct {
+	maxFailures int
+	breaker     CircuitBreakerConfig
+	failures    int
+	// recent holds whether each of the latest results failed
+	recent []bool
+	next   int
+	full   bool
+}
+
+// newCampaignBreaker checks the limits, returning nil without any
+func newCampaignBreaker(maxFailures int, breaker CircuitBreakerConfig) (*campaignBreaker, error) {
+	if maxFailures < 0 {
+		return nil, errors.New("max_failures must not be negative")
+	}
+	if breaker.FailureRate < 0 || breaker.FailureRate > 1 {
+		return nil, errors.New("circuit_breaker: failure_rate must be between 0 and 1")
+	}
+	if breaker.Window < 0 {
+		return nil, errors.New("circuit_breaker: window must not be negative")
+	}
+	if maxFailures == 0 && breaker.FailureRate == 0 {
+		return nil, nil
+	}
+	if breaker.Window == 0 {
+		breaker.Window = 20
+	}
+	return &campaignBreaker{maxFailures: maxFailures, breaker: breaker, recent: make([]bool, breaker.Window)}, nil
+}
+
+// record counts a result, returning why the campaign is aborted, if it is
+func (b *campaignBreaker) record(result ExecutionResult) string {
+	if b == nil || result.Skipped || result.Quarantined {
+		return ""
+	}
+	failed := !result.Success
+	if failed {
+		b.failures++
+	}
+	if b.maxFailures > 0 && b.failures >= b.maxFailures {
+		return fmt.Sprintf("%d failures reached the limit of %d", b.failures, b.maxFailures)
+	}
+	if b.breaker.FailureRate == 0 {
+		return ""
+	}
+
+	b.recent[b.next] = failed
+	b.next = (b.next + 1) % len(b.recent)
+	b.full = b.full || b.next == 0
+	if !b.full {
+		return ""
+	}
+	recent := 0
+	for _, failed := range b.recent {
+		if failed {
+			recent++
+		}
+	}
+	if rate := float64(recent) / float64(len(b.recent)); rate > b.breaker.FailureRate {
+		return fmt.Sprintf("circuit breaker tripped: %d of the last %d results failed, above the %g failure rate", recent, len(b.recent), b.breaker.FailureRate)
+	}
+	return ""
+}
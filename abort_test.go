@@ -0,0 +1,75 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// -----------------------------------------------------------------------------
+// TEST: Early Abort
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// A missing library or a full disk fails every file of a campaign, which
+// then spends hours producing a report of nothing but that. Stopping once
+// failures pile up, or once nearly every recent file fails, frees the
+// machine sooner. The partial report must still say why it stopped and
+// which files were never run.
+// -----------------------------------------------------------------------------
+
+// failingCorpus writes files named 00.wasm, 01.wasm, ..., of which the
+// runtime fails those named in fail
+func failingCorpus(t *testing.T, files int, fail func(i int) bool) (string, WasmRuntime) {
+	dir := t.TempDir()
+	for i := 0; i < files; i++ {
+		name := fmt.Sprintf("%02d.wasm", i)
+		if fail(i) {
+			name = fmt.Sprintf("%02d_fail.wasm", i)
+		}
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte{0}, 0o644))
+	}
+	return dir, &MockWasmRuntime{LoadModuleFunc: func(filePath string) (WasmModule, error) {
+		if strings.Contains(filePath, "_fail") {
+			return nil, errors.New("broken")
+		}
+		return &MockWasmModule{}, nil
+	}}
+}
+
+func TestAbort_MaxFailures(t *testing.T) {
+	dir, runtime := failingCorpus(t, 6, func(i int) bool { return i%2 == 1 })
+	report, err := runFuzzerWithMatrix(dir, []environmentRuntime{{Runtime: runtime}}, RunOptions{MaxFailures: 2})
+	require.NoError(t, err)
+
+	assert.Equal(t, "2 failures reached the limit of 2", report.Aborted)
+	assert.Equal(t, 2, report.Passed)
+	assert.Equal(t, 2, report.Failed)
+	assert.Equal(t, 2, report.SkipCounts[SkipAborted])
+	assert.Equal(t, SkipAborted, report.Results[5].SkipReason)
+	assert.Empty(t, validateReport(report), "a partial report is still consistent")
+}
+
+func TestAbort_CircuitBreaker(t *testing.T) {
+	// Scattered failures never trip the breaker, a broken run does
+	dir, runtime := failingCorpus(t, 10, func(i int) bool { return i == 1 || i >= 6 })
+	opts := RunOptions{CircuitBreaker: CircuitBreakerConfig{FailureRate: 0.5, Window: 4}}
+	report, err := runFuzzerWithMatrix(dir, []environmentRuntime{{Runtime: runtime}}, opts)
+	require.NoError(t, err)
+
+	assert.Equal(t, "circuit breaker tripped: 3 of the last 4 results failed, above the 0.5 failure rate", report.Aborted)
+	assert.Equal(t, 9, report.Passed+report.Failed)
+	assert.Equal(t, 1, report.SkipCounts[SkipAborted])
+
+	_, err = runFuzzerWithMatrix(dir, nil, RunOptions{CircuitBreaker: CircuitBreakerConfig{FailureRate: 2}})
+	assert.EqualError(t, err, "circuit_breaker: failure_rate must be between 0 and 1")
+}
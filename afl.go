@@ -0,0 +1,372 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+// AFL++ forkserver file descriptors and defaults
+const (
+	aflControlFD      = 198
+	aflStatusFD       = 199
+	aflDefaultMapSize = 1 << 16
+)
+
+// Worker pipe file descriptors (ExtraFiles start at fd 3)
+const (
+	aflWorkerRequestFD  = 3
+	aflWorkerResponseFD = 4
+)
+
+// aflExecutor runs one input and reports the pid that ran it and the
+// waitpid-style status AFL interprets (0 for a normal exit)
+type aflExecutor interface {
+	Run(input []byte) (pid int, status uint32, feedback aflFeedback, err error)
+}
+
+// aflFeedback is what one execution reports back to AFL
+type aflFeedback struct {
+	// Signature is the reached stage and classified error
+	Signature string
+	// Edges are the hit edge map entries of an instrumented module
+	Edges []aflEdge
+}
+
+// aflEdge is one hit entry of the module's edge map
+type aflEdge struct {
+	Index uint32
+	Hits  byte
+}
+
+// coverageMap is the AFL shared-memory bitmap
+type coverageMap []byte
+
+// record replaces the map contents with one execution's feedback. The
+// behavior signature occupies one entry so inputs that reach the same edges
+// but fail differently are still told apart; modules that could not be
+// instrumented are distinguished by their signature alone.
+func (m coverageMap) record(feedback aflFeedback) {
+	if len(m) == 0 {
+		return
+	}
+	for i := range m {
+		m[i] = 0
+	}
+	h := fnv.New32a()
+	h.Write([]byte(feedback.Signature))
+	m[h.Sum32()%uint32(len(m))]++
+
+	for _, edge := range feedback.Edges {
+		i := edge.Index % uint32(len(m))
+		if sum := int(m[i]) + int(edge.Hits); sum > 0xff {
+			m[i] = 0xff
+		} else {
+			m[i] = byte(sum)
+		}
+	}
+}
+
+// runAFLForkserver speaks the AFL++ forkserver protocol on the given
+// control and status pipes. It returns nil when AFL closes the control pipe.
+func runAFLForkserver(control io.Reader, status io.Writer, executor aflExecutor, readInput func() ([]byte, error), coverage coverageMap) error {
+	var word [4]byte
+
+	// Handshake: a 4-byte hello tells AFL the forkserver is up
+	if _, err := status.Write(word[:]); err != nil {
+		return fmt.Errorf("forkserver handshake failed: %w", err)
+	}
+
+	for {
+		// AFL writes a 4-byte word (whether it killed the last child) per run
+		if _, err := io.ReadFull(control, word[:]); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return nil
+			}
+			return fmt.Errorf("forkserver control read failed: %w", err)
+		}
+
+		input, err := readInput()
+		if err != nil {
+			return fmt.Errorf("failed to read input: %w", err)
+		}
+
+		pid, runStatus, feedback, err := executor.Run(input)
+		if err != nil {
+			return err
+		}
+
+		binary.LittleEndian.PutUint32(word[:], uint32(pid))
+		if _, err := status.Write(word[:]); err != nil {
+			return fmt.Errorf("forkserver status write failed: %w", err)
+		}
+
+		if runStatus == 0 {
+			coverage.record(feedback)
+		}
+
+		binary.LittleEndian.PutUint32(word[:], runStatus)
+		if _, err := status.Write(word[:]); err != nil {
+			return fmt.Errorf("forkserver status write failed: %w", err)
+		}
+	}
+}
+
+// aflSignature summarizes a result as the behavior AFL should distinguish
+func aflSignature(result ExecutionResult) string {
+	return string(result.FailureStage) + "|" + result.ErrorMessage
+}
+
+// isHostPanic reports whether the result comes from a recovered host panic
+func isHostPanic(result ExecutionResult) bool {
+	return len(result.ErrorMessage) >= len("panic recovered") && result.ErrorMessage[:len("panic recovered")] == "panic recovered"
+}
+
+// serveAFLWorker runs length-prefixed inputs from requests and writes a
+// length-prefixed signature followed by the length-prefixed hit edges
+// (4-byte index, 1-byte count each) for every input. On a host panic it
+// calls crash, which must terminate the process so AFL sees a signal.
+func serveAFLWorker(requests io.Reader, responses io.Writer, runtime WasmRuntime, opts RunOptions, crash func()) error {
+	var length [4]byte
+	for {
+		if _, err := io.ReadFull(requests, length[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		input := make([]byte, binary.LittleEndian.Uint32(length[:]))
+		if _, err := io.ReadFull(requests, input); err != nil {
+			return err
+		}
+
+		buffered := &bufferRuntime{runtime: runtime, data: wrapModuleBytes(input)}
+		result := processWasmFileWithOptions("afl-input.wasm", buffered, opts)
+		if isHostPanic(result) {
+			crash()
+			return errors.New(result.ErrorMessage)
+		}
+
+		signature := aflSignature(result)
+		response := binary.LittleEndian.AppendUint32(nil, uint32(len(signature)))
+		response = append(response, signature...)
+
+		var edges []byte
+		if result.Coverage != nil {
+			for i, hits := range result.Coverage.hits {
+				if hits != 0 {
+					edges = append(binary.LittleEndian.AppendUint32(edges, uint32(i)), hits)
+				}
+			}
+		}
+		response = binary.LittleEndian.AppendUint32(response, uint32(len(edges)))
+		if _, err := responses.Write(append(response, edges...)); err != nil {
+			return err
+		}
+	}
+}
+
+// workerExecutor runs inputs in a persistent worker subprocess. AFL kills
+// the reported pid on timeout, so the worker, never the forkserver itself,
+// is what gets killed; a dead worker is reaped and replaced on the next run.
+type workerExecutor struct {
+	args      []string
+	cmd       *exec.Cmd
+	requests  *os.File
+	responses *os.File
+}
+
+// start launches a fresh worker process
+func (w *workerExecutor) start() error {
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	reqRead, reqWrite, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	respRead, respWrite, err := os.Pipe()
+	if err != nil {
+		reqRead.Close()
+		reqWrite.Close()
+		return err
+	}
+
+	cmd := exec.Command(self, append([]string{"afl-worker"}, w.args...)...)
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = []*os.File{reqRead, respWrite}
+	if err := cmd.Start(); err != nil {
+		reqRead.Close()
+		reqWrite.Close()
+		respRead.Close()
+		respWrite.Close()
+		return err
+	}
+	reqRead.Close()
+	respWrite.Close()
+
+	w.cmd, w.requests, w.responses = cmd, reqWrite, respRead
+	return nil
+}
+
+// reap waits for a dead worker and returns its raw wait status
+func (w *workerExecutor) reap() uint32 {
+	w.requests.Close()
+	w.responses.Close()
+	w.cmd.Wait()
+
+	status := rawWaitStatus(w.cmd.ProcessState)
+	w.cmd = nil
+	return status
+}
+
+// Run implements aflExecutor
+func (w *workerExecutor) Run(input []byte) (int, uint32, aflFeedback, error) {
+	if w.cmd == nil {
+		if err := w.start(); err != nil {
+			return 0, 0, aflFeedback{}, fmt.Errorf("failed to start worker: %w", err)
+		}
+	}
+	pid := w.cmd.Process.Pid
+
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(input)))
+	if _, err := w.requests.Write(append(length[:], input...)); err != nil {
+		return pid, w.reap(), aflFeedback{}, nil
+	}
+
+	signature, err := readAFLFrame(w.responses)
+	if err != nil {
+		return pid, w.reap(), aflFeedback{}, nil
+	}
+	edges, err := readAFLFrame(w.responses)
+	if err != nil {
+		return pid, w.reap(), aflFeedback{}, nil
+	}
+
+	feedback := aflFeedback{Signature: string(signature)}
+	for ; len(edges) >= 5; edges = edges[5:] {
+		feedback.Edges = append(feedback.Edges, aflEdge{Index: binary.LittleEndian.Uint32(edges), Hits: edges[4]})
+	}
+	return pid, 0, feedback, nil
+}
+
+// readAFLFrame reads one length-prefixed worker response
+func readAFLFrame(r io.Reader) ([]byte, error) {
+	var length [4]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return nil, err
+	}
+	payload := make([]byte, binary.LittleEndian.Uint32(length[:]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// Close stops the worker
+func (w *workerExecutor) Close() {
+	if w.cmd != nil {
+		w.reap()
+	}
+}
+
+// aflFlags parses the flags shared by the afl and afl-worker subcommands
+func aflFlags(name string, args []string) (configPath string, rest []string, err error) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	flags.StringVar(&configPath, "config", "", "YAML campaign config")
+	if err := flags.Parse(args); err != nil {
+		return "", nil, err
+	}
+	return configPath, flags.Args(), nil
+}
+
+// runAFLCommand runs the AFL++ forkserver. AFL provides inputs either as a
+// file path argument (@@) or on stdin.
+func runAFLCommand(args []string) int {
+	configPath, rest, err := aflFlags("afl", args)
+	if err != nil || len(rest) > 1 {
+		emitError(map[string]string{"error": "usage: wasm-fuzzer afl [--config file.yaml] [input-file]"})
+		return 1
+	}
+
+	readInput := func() ([]byte, error) { return io.ReadAll(os.Stdin) }
+	if len(rest) == 1 {
+		readInput = func() ([]byte, error) { return os.ReadFile(rest[0]) }
+	}
+
+	var workerArgs []string
+	if configPath != "" {
+		workerArgs = []string{"--config", configPath}
+	}
+	executor := &workerExecutor{args: workerArgs}
+	defer executor.Close()
+
+	coverage, err := attachAFLCoverage()
+	if err != nil {
+		emitError(map[string]string{
+			"error":   "failed to attach AFL shared memory",
+			"details": err.Error(),
+		})
+		return 1
+	}
+
+	control := os.NewFile(aflControlFD, "afl-control")
+	status := os.NewFile(aflStatusFD, "afl-status")
+	if err := runAFLForkserver(control, status, executor, readInput, coverage); err != nil {
+		emitError(map[string]string{
+			"error":   "forkserver failed",
+			"details": err.Error(),
+		})
+		return 1
+	}
+	return 0
+}
+
+// runAFLWorker is the hidden subcommand the forkserver launches as its worker
+func runAFLWorker(args []string) int {
+	configPath, _, err := aflFlags("afl-worker", args)
+	if err != nil {
+		return 1
+	}
+
+	config, err := resolveConfig(configPath)
+	if err != nil {
+		emitError(map[string]string{"error": "config load failed", "details": err.Error()})
+		return 1
+	}
+
+	// Edge coverage is always collected; modules that cannot be
+	// instrumented fall back to signature feedback
+	runtime, err := newRuntime(coverageEnvironment(Environment{}))
+	if err != nil {
+		emitError(map[string]string{"error": "failed to create runtime", "details": err.Error()})
+		return 1
+	}
+
+	requests := os.NewFile(aflWorkerRequestFD, "afl-requests")
+	responses := os.NewFile(aflWorkerResponseFD, "afl-responses")
+	opts := config.runOptions()
+	opts.Coverage.Enabled = true
+	if err := serveAFLWorker(requests, responses, runtime, opts, crashWithAbort); err != nil {
+		return 1
+	}
+	return 0
+}
+
+// aflMapSize returns the coverage map size AFL allocated
+func aflMapSize() int {
+	if size, err := strconv.Atoi(os.Getenv("AFL_MAP_SIZE")); err == nil && size > 0 {
+		return size
+	}
+	return aflDefaultMapSize
+}
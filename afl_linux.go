@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"unsafe"
+)
+
+// attachAFLCoverage attaches the System V shared memory segment AFL
+// advertises in __AFL_SHM_ID. Without it, a nil map is returned and
+// coverage feedback is skipped.
+func attachAFLCoverage() (coverageMap, error) {
+	value := os.Getenv("__AFL_SHM_ID")
+	if value == "" {
+		return nil, nil
+	}
+	id, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid __AFL_SHM_ID %q", value)
+	}
+
+	addr, _, errno := syscall.Syscall(syscall.SYS_SHMAT, uintptr(id), 0, 0)
+	if errno != 0 {
+		return nil, fmt.Errorf("shmat failed: %w", errno)
+	}
+	// Convert without a uintptr-to-pointer cast; the segment is never detached
+	ptr := *(*unsafe.Pointer)(unsafe.Pointer(&addr))
+	return coverageMap(unsafe.Slice((*byte)(ptr), aflMapSize())), nil
+}
+
+// crashWithAbort terminates the process with SIGABRT so AFL records a crash
+func crashWithAbort() {
+	signal.Reset(syscall.SIGABRT)
+	syscall.Kill(os.Getpid(), syscall.SIGABRT)
+	os.Exit(134)
+}
+
+// rawWaitStatus returns the waitpid status word AFL expects
+func rawWaitStatus(state *os.ProcessState) uint32 {
+	if ws, ok := state.Sys().(syscall.WaitStatus); ok {
+		return uint32(ws)
+	}
+	return 0
+}
@@ -0,0 +1,27 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// attachAFLCoverage is only supported on Linux
+func attachAFLCoverage() (coverageMap, error) {
+	if os.Getenv("__AFL_SHM_ID") == "" {
+		return nil, nil
+	}
+	return nil, errors.New("AFL shared memory is only supported on Linux")
+}
+
+// crashWithAbort exits with the conventional SIGABRT exit code
+func crashWithAbort() {
+	os.Exit(134)
+}
+
+// rawWaitStatus encodes the exit code the way waitpid would
+func rawWaitStatus(state *os.ProcessState) uint32 {
+	return uint32(state.ExitCode()&0xff) << 8
+}
@@ -0,0 +1,164 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAFLExecutor returns canned results and records the inputs it ran
+type fakeAFLExecutor struct {
+	inputs [][]byte
+	status uint32
+}
+
+func (f *fakeAFLExecutor) Run(input []byte) (int, uint32, aflFeedback, error) {
+	f.inputs = append(f.inputs, input)
+	return 4242, f.status, aflFeedback{Signature: "execute|boom"}, nil
+}
+
+// aflFrame length-prefixes a payload the way the worker protocol does
+func aflFrame(payload []byte) []byte {
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(payload)))
+	return append(length[:], payload...)
+}
+
+// readAFLFrames splits a worker response stream into payloads
+func readAFLFrames(t *testing.T, stream []byte) []string {
+	var frames []string
+	reader := bytes.NewReader(stream)
+	for reader.Len() > 0 {
+		var length [4]byte
+		_, err := io.ReadFull(reader, length[:])
+		require.NoError(t, err)
+		payload := make([]byte, binary.LittleEndian.Uint32(length[:]))
+		_, err = io.ReadFull(reader, payload)
+		require.NoError(t, err)
+		frames = append(frames, string(payload))
+	}
+	return frames
+}
+
+// -----------------------------------------------------------------------------
+// TEST: AFL++ Forkserver Protocol
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// AFL++ aborts the campaign if a single word of the handshake or per-run
+// exchange is missing or out of order. The forkserver must greet, answer
+// every control word with a pid and a status, and exit cleanly when AFL
+// closes the pipe.
+// -----------------------------------------------------------------------------
+
+func TestAFL_ForkserverProtocol(t *testing.T) {
+	control := bytes.NewReader(make([]byte, 8)) // two runs
+	var status bytes.Buffer
+	executor := &fakeAFLExecutor{}
+	readInput := func() ([]byte, error) { return []byte{0xAA}, nil }
+
+	require.NoError(t, runAFLForkserver(control, &status, executor, readInput, nil))
+
+	words := status.Bytes()
+	require.Len(t, words, 4*5, "hello plus pid/status for each run")
+	assert.Equal(t, uint32(0), binary.LittleEndian.Uint32(words[0:4]), "hello")
+	for run := 0; run < 2; run++ {
+		offset := 4 + run*8
+		assert.Equal(t, uint32(4242), binary.LittleEndian.Uint32(words[offset:offset+4]), "pid")
+		assert.Equal(t, uint32(0), binary.LittleEndian.Uint32(words[offset+4:offset+8]), "status")
+	}
+	assert.Len(t, executor.inputs, 2)
+}
+
+func TestAFL_ForkserverReportsCrashStatus(t *testing.T) {
+	var status bytes.Buffer
+	executor := &fakeAFLExecutor{status: 6} // killed by SIGABRT
+	coverage := make(coverageMap, 64)
+	readInput := func() ([]byte, error) { return nil, nil }
+
+	require.NoError(t, runAFLForkserver(bytes.NewReader(make([]byte, 4)), &status, executor, readInput, coverage))
+
+	words := status.Bytes()
+	assert.Equal(t, uint32(6), binary.LittleEndian.Uint32(words[8:12]))
+	assert.Equal(t, make(coverageMap, 64), coverage, "crashed runs should not record coverage")
+}
+
+func TestAFL_CoverageDistinguishesSignatures(t *testing.T) {
+	first := make(coverageMap, 1<<16)
+	first.record(aflFeedback{Signature: "execute|trap"})
+	second := make(coverageMap, 1<<16)
+	second.record(aflFeedback{Signature: "load|malformed"})
+
+	assert.NotEqual(t, first, second)
+
+	again := make(coverageMap, 1<<16)
+	again.record(aflFeedback{Signature: "execute|trap"})
+	again.record(aflFeedback{Signature: "execute|trap"})
+	assert.Equal(t, first, again, "the map is reset for every run")
+
+	assert.NotPanics(t, func() { coverageMap(nil).record(aflFeedback{Signature: "x"}) })
+}
+
+func TestAFL_CoverageRecordsEdges(t *testing.T) {
+	m := make(coverageMap, 1<<16)
+	m.record(aflFeedback{Signature: "none|", Edges: []aflEdge{{Index: 7, Hits: 3}, {Index: 1<<16 + 9, Hits: 1}}})
+
+	assert.Equal(t, byte(3), m[7])
+	assert.Equal(t, byte(1), m[9], "indices wrap to the map size")
+}
+
+// -----------------------------------------------------------------------------
+// TEST: AFL++ Persistent Worker
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// The worker runs every input in the same process. Module failures must
+// come back as signatures so AFL keeps going, while a host panic must kill
+// the worker so AFL records it as a crash.
+// -----------------------------------------------------------------------------
+
+func TestAFL_WorkerReturnsSignatures(t *testing.T) {
+	runtime := &MockWasmRuntime{
+		LoadModuleFunc: func(filePath string) (WasmModule, error) {
+			return nil, &RuntimeError{Stage: StageValidate, Message: "type mismatch"}
+		},
+	}
+	requests := bytes.NewReader(append(aflFrame([]byte{0x01}), aflFrame(nil)...))
+	var responses bytes.Buffer
+
+	require.NoError(t, serveAFLWorker(requests, &responses, runtime, RunOptions{}, func() {
+		t.Fatal("module failures should not crash the worker")
+	}))
+
+	frames := readAFLFrames(t, responses.Bytes())
+	require.Len(t, frames, 4, "a signature and an edge frame per input")
+	assert.Equal(t, "validate|type mismatch", frames[0])
+	assert.Empty(t, frames[1], "uninstrumented runs report no edges")
+}
+
+func TestAFL_WorkerCrashesOnHostPanic(t *testing.T) {
+	runtime := &MockWasmRuntime{
+		LoadModuleFunc: func(filePath string) (WasmModule, error) {
+			return &MockWasmModule{
+				ExecuteFunc: func(funcName string, args ...interface{}) ([]interface{}, error) {
+					panic("CGO boundary violation")
+				},
+			}, nil
+		},
+	}
+	crashed := false
+	var responses bytes.Buffer
+
+	err := serveAFLWorker(bytes.NewReader(aflFrame(nil)), &responses, runtime, RunOptions{}, func() { crashed = true })
+
+	assert.Error(t, err)
+	assert.True(t, crashed)
+	assert.Empty(t, responses.Bytes(), "no signature is sent for a crash")
+}
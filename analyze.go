@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// analyzeExampleLimit caps the example messages and files of a cluster
+const analyzeExampleLimit = 3
+
+// FailureAnalysis groups the failures of a report by error message, for
+// triage when many distinct but related messages appear
+type FailureAnalysis struct {
+	Failures         int              `json:"failures"`
+	DistinctMessages int              `json:"distinct_messages"`
+	Clusters         []MessageCluster `json:"clusters"`
+}
+
+// MessageCluster is a group of similar error messages. Its label keeps the
+// words every message shares, with "*" where they differ.
+type MessageCluster struct {
+	Label    string               `json:"label"`
+	Failures int                  `json:"failures"`
+	Messages int                  `json:"messages"`
+	Stages   map[FailureStage]int `json:"stages"`
+	// Examples are the most frequent messages, and Files some of the files
+	// that failed with them
+	Examples []string `json:"examples"`
+	Files    []string `json:"files"`
+}
+
+// messageTokens splits a message into lowercase words, with every word
+// holding a digit, such as an offset or an index, standing for any number
+func messageTokens(message string) []string {
+	words := strings.FieldsFunc(strings.ToLower(normalizeMessage(message)), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+	for i, word := range words {
+		if strings.IndexFunc(word, unicode.IsDigit) >= 0 {
+			words[i] = "<n>"
+		}
+	}
+	return words
+}
+
+// tokenSimilarity is the Jaccard similarity of two sets of words
+func tokenSimilarity(a, b map[string]bool) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	}
+	shared := 0
+	for word := range a {
+		if b[word] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+// analyzeFailures clusters the error messages of a report's failures. The
+// most frequent messages seed the clusters, and every other message joins
+// the most similar one when it is at least threshold similar.
+func analyzeFailures(report FuzzingReport, threshold float64) FailureAnalysis {
+	type message struct {
+		text   string
+		count  int
+		stages map[FailureStage]int
+		files  []string
+	}
+	messages := make(map[string]*message)
+	var analysis FailureAnalysis
+	for _, result := range report.Results {
+		if result.Success || result.Skipped {
+			continue
+		}
+		analysis.Failures++
+		m := messages[result.ErrorMessage]
+		if m == nil {
+			m = &message{text: result.ErrorMessage, stages: make(map[FailureStage]int)}
+			messages[result.ErrorMessage] = m
+		}
+		m.count++
+		m.stages[result.FailureStage]++
+		if len(m.files) < analyzeExampleLimit {
+			m.files = append(m.files, result.FilePath)
+		}
+	}
+	analysis.DistinctMessages = len(messages)
+
+	ordered := make([]*message, 0, len(messages))
+	for _, m := range messages {
+		ordered = append(ordered, m)
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		if ordered[i].count != ordered[j].count {
+			return ordered[i].count > ordered[j].count
+		}
+		return ordered[i].text < ordered[j].text
+	})
+
+	type cluster struct {
+		seed    []string
+		words   map[string]bool
+		shared  map[string]bool
+		members []*message
+	}
+	var clusters []*cluster
+	for _, m := range ordered {
+		tokens := messageTokens(m.text)
+		words := make(map[string]bool, len(tokens))
+		for _, token := range tokens {
+			words[token] = true
+		}
+		var best *cluster
+		bestSimilarity := threshold
+		for _, c := range clusters {
+			if similarity := tokenSimilarity(words, c.words); similarity >= bestSimilarity {
+				best, bestSimilarity = c, similarity
+			}
+		}
+		if best == nil {
+			shared := make(map[string]bool, len(words))
+			for word := range words {
+				shared[word] = true
+			}
+			clusters = append(clusters, &cluster{seed: tokens, words: words, shared: shared, members: []*message{m}})
+			continue
+		}
+		for word := range best.shared {
+			if !words[word] {
+				delete(best.shared, word)
+			}
+		}
+		best.members = append(best.members, m)
+	}
+
+	analysis.Clusters = make([]MessageCluster, 0, len(clusters))
+	for _, c := range clusters {
+		summary := MessageCluster{Label: clusterLabel(c.seed, c.shared), Messages: len(c.members), Stages: make(map[FailureStage]int)}
+		for _, m := range c.members {
+			summary.Failures += m.count
+			for stage, n := range m.stages {
+				summary.Stages[stage] += n
+			}
+			if len(summary.Examples) < analyzeExampleLimit {
+				summary.Examples = append(summary.Examples, m.text)
+			}
+			for _, file := range m.files {
+				if len(summary.Files) < analyzeExampleLimit {
+					summary.Files = append(summary.Files, file)
+				}
+			}
+		}
+		analysis.Clusters = append(analysis.Clusters, summary)
+	}
+	sort.SliceStable(analysis.Clusters, func(i, j int) bool {
+		return analysis.Clusters[i].Failures > analysis.Clusters[j].Failures
+	})
+	return analysis
+}
+
+// clusterLabel writes the seed message's words, replacing each run of words
+// not shared by every message of the cluster with "*"
+func clusterLabel(seed []string, shared map[string]bool) string {
+	var label []string
+	for _, word := range seed {
+		if !shared[word] {
+			word = "*"
+		}
+		if word == "*" && len(label) > 0 && label[len(label)-1] == "*" {
+			continue
+		}
+		label = append(label, word)
+	}
+	if len(label) == 0 {
+		return "(no message)"
+	}
+	return strings.Join(label, " ")
+}
+
+// runAnalyzeCommand clusters the error messages of a report
+func runAnalyzeCommand(args []string) int {
+	flags := flag.NewFlagSet("analyze", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	threshold := flags.Float64("threshold", 0.6, "similarity, from 0 to 1, a message needs to join a cluster")
+
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		emitError(map[string]string{
+			"error": "usage: wasm-fuzzer analyze [-threshold 0.6] <report.json>",
+		})
+		return 1
+	}
+	if *threshold < 0 || *threshold > 1 {
+		emitError(map[string]string{
+			"error":   "invalid threshold",
+			"details": fmt.Sprintf("%g is not between 0 and 1", *threshold),
+		})
+		return 1
+	}
+
+	report, err := loadReport(flags.Arg(0))
+	if err != nil {
+		emitError(map[string]string{
+			"error":   "report load failed",
+			"path":    flags.Arg(0),
+			"details": err.Error(),
+		})
+		return 1
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(analyzeFailures(report, *threshold)); err != nil {
+		emitError(map[string]string{
+			"error":   "failed to encode JSON output",
+			"details": err.Error(),
+		})
+		return 1
+	}
+	return 0
+}
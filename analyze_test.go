@@ -0,0 +1,67 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// -----------------------------------------------------------------------------
+// TEST: Failure Analysis
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// A campaign over a large corpus reports thousands of error messages that
+// differ only in an offset, an index or a function name. Grouped by the
+// words they share, they reduce to the handful of distinct problems that
+// need triage.
+// -----------------------------------------------------------------------------
+
+func TestAnalyze_ClustersSimilarMessages(t *testing.T) {
+	failed := func(file string, stage FailureStage, message string) ExecutionResult {
+		return ExecutionResult{FilePath: file, FailureStage: stage, ErrorMessage: message}
+	}
+	report := FuzzingReport{Results: []ExecutionResult{
+		failed("a.wasm", StageExecute, "out of bounds memory access at offset 0x10"),
+		failed("b.wasm", StageExecute, "out of bounds memory access at offset 0x2000"),
+		failed("c.wasm", StageExecute, "out of bounds memory access at offset 0x10"),
+		failed("d.wasm", StageInstantiate, "unknown import: env.abort"),
+		failed("e.wasm", StageInstantiate, "unknown import: env.emscripten_memcpy"),
+		failed("f.wasm", StageLoad, "magic header not detected"),
+		{FilePath: "g.wasm", Success: true},
+		{FilePath: "h.wasm", Skipped: true},
+	}}
+
+	analysis := analyzeFailures(report, 0.6)
+	assert.Equal(t, 6, analysis.Failures)
+	assert.Equal(t, 5, analysis.DistinctMessages)
+	require.Len(t, analysis.Clusters, 3)
+
+	memory := analysis.Clusters[0]
+	assert.Equal(t, "out of bounds memory access at offset <n>", memory.Label)
+	assert.Equal(t, 3, memory.Failures)
+	assert.Equal(t, 2, memory.Messages)
+	assert.Equal(t, map[FailureStage]int{StageExecute: 3}, memory.Stages)
+	assert.Equal(t, "out of bounds memory access at offset 0x10", memory.Examples[0], "the most frequent message comes first")
+	assert.Equal(t, []string{"a.wasm", "c.wasm", "b.wasm"}, memory.Files)
+
+	imports := analysis.Clusters[1]
+	assert.Equal(t, "unknown import env *", imports.Label)
+	assert.Equal(t, 2, imports.Failures)
+	assert.Equal(t, "magic header not detected", analysis.Clusters[2].Label)
+}
+
+func TestAnalyze_ThresholdSplitsClusters(t *testing.T) {
+	report := FuzzingReport{Results: []ExecutionResult{
+		{FailureStage: StageExecute, ErrorMessage: "integer divide by zero"},
+		{FailureStage: StageExecute, ErrorMessage: "integer overflow"},
+	}}
+	assert.Len(t, analyzeFailures(report, 0.6).Clusters, 2)
+	merged := analyzeFailures(report, 0.2).Clusters
+	require.Len(t, merged, 1)
+	assert.Equal(t, "integer *", merged[0].Label)
+}
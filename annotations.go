@@ -0,0 +1,270 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/mrhapile/WASM-Injection-Framework/internal/wasmbin"
+)
+
+// ArgAnnotations declares the domains of the i32 arguments of a module's
+// functions, so argument fuzzing generates inputs the functions can make
+// sense of. It maps function names to one constraint per argument, in
+// order; an empty constraint leaves its argument free.
+type ArgAnnotations map[string][]ArgConstraint
+
+// ArgConstraint is the domain of one argument. Constraints combine: a
+// range and an alignment make aligned values within the range.
+type ArgConstraint struct {
+	// Range bounds the argument, both ends included, as [min, max]
+	Range []int64 `yaml:"range"`
+	// Values lists every value the argument takes
+	Values []int32 `yaml:"values"`
+	// Align makes the argument a multiple of it
+	Align int64 `yaml:"align"`
+	// Pointer makes the argument an address within a data segment
+	Pointer *PointerConstraint `yaml:"pointer"`
+	// LengthOf makes the argument a length that fits in what remains of
+	// the segment after the address in the pointer argument at this index
+	LengthOf *int `yaml:"length_of"`
+}
+
+// PointerConstraint places a pointer argument within an active data
+// segment, by its index
+type PointerConstraint struct {
+	Segment uint32 `yaml:"segment"`
+}
+
+// argDomain is a constraint resolved against a module: the values an
+// argument takes, or the bounds and alignment of a range
+type argDomain struct {
+	values   []int32
+	min, max int64
+	align    int64
+	// lengthOf is the pointer argument a length fits after, or -1
+	lengthOf int
+}
+
+// loadAnnotations resolves the annotations of the entry, from the
+// configured file or a .args.yaml file next to the module. Modules without
+// annotations, or whose entry has none, keep their arguments free.
+func (c *InvocationConfig) loadAnnotations(filePath string) error {
+	path := c.Annotations
+	if path == "" {
+		path = strings.TrimSuffix(filePath, filepath.Ext(filePath)) + ".args.yaml"
+		if _, err := os.Stat(path); err != nil {
+			return nil
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return &RuntimeError{Stage: StageSignature, Message: fmt.Sprintf("annotations: %v", err)}
+	}
+	var annotations ArgAnnotations
+	if err := yaml.Unmarshal(data, &annotations); err != nil {
+		return &RuntimeError{Stage: StageSignature, Message: fmt.Sprintf("annotations: %s: %v", path, err)}
+	}
+	if err := checkConfigKeys(data, reflect.TypeOf(annotations)); err != nil {
+		return &RuntimeError{Stage: StageSignature, Message: fmt.Sprintf("annotations: %s: %v", path, err)}
+	}
+	constraints, ok := annotations[c.Entry]
+	if !ok {
+		return nil
+	}
+	module, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	if c.domains, err = resolveConstraints(module, c.Entry, constraints); err != nil {
+		return &RuntimeError{Stage: StageSignature, Message: fmt.Sprintf("annotations: %s: %s: %v", path, c.Entry, err)}
+	}
+	return nil
+}
+
+// resolveConstraints checks a function's constraints against its
+// signature and finds the data segments pointers go into
+func resolveConstraints(module []byte, function string, constraints []ArgConstraint) ([]argDomain, error) {
+	binary, err := parseWasmBinary(module)
+	if err != nil {
+		return nil, err
+	}
+	signature, ok := exportSignatures(module)[function]
+	if !ok {
+		return nil, fmt.Errorf("module does not export it")
+	}
+	if len(constraints) > len(signature.Params) {
+		return nil, fmt.Errorf("%d arguments annotated, but it takes %d", len(constraints), len(signature.Params))
+	}
+	var segments []dataPlacement
+	domains := make([]argDomain, len(constraints))
+	for i, constraint := range constraints {
+		if !reflect.DeepEqual(constraint, ArgConstraint{}) && signature.Params[i] != "i32" {
+			return nil, fmt.Errorf("argument %d is %s; only i32 arguments can be annotated", i, signature.Params[i])
+		}
+		domain := argDomain{min: math.MinInt32, max: math.MaxInt32, align: 1, lengthOf: -1, values: constraint.Values}
+		if constraint.Range != nil {
+			if len(constraint.Range) != 2 || constraint.Range[0] > constraint.Range[1] {
+				return nil, fmt.Errorf("argument %d: range must be [min, max]", i)
+			}
+			domain.min, domain.max = max(domain.min, constraint.Range[0]), min(domain.max, constraint.Range[1])
+		}
+		if constraint.Pointer != nil {
+			if segments == nil {
+				if segments, err = binary.dataPlacements(); err != nil {
+					return nil, err
+				}
+			}
+			index := constraint.Pointer.Segment
+			if int(index) >= len(segments) || !segments[index].active {
+				return nil, fmt.Errorf("argument %d: no active data segment %d with a constant offset", i, index)
+			}
+			segment := segments[index]
+			domain.min, domain.max = max(domain.min, segment.offset), min(domain.max, segment.offset+segment.size-1)
+		}
+		if constraint.Align < 0 {
+			return nil, fmt.Errorf("argument %d: align must be positive", i)
+		} else if constraint.Align > 0 {
+			domain.align = constraint.Align
+		}
+		if domain.min > domain.max {
+			return nil, fmt.Errorf("argument %d: its constraints leave no value", i)
+		}
+		if constraint.LengthOf != nil {
+			domain.lengthOf = *constraint.LengthOf
+		}
+		domains[i] = domain
+	}
+	for i, domain := range domains {
+		if p := domain.lengthOf; p >= 0 && (p >= len(constraints) || constraints[p].Pointer == nil) {
+			return nil, fmt.Errorf("argument %d: length_of %d is not a pointer argument", i, p)
+		}
+	}
+	return domains, nil
+}
+
+// dataPlacement is where a data segment is written at instantiation
+type dataPlacement struct {
+	// active is false for passive segments and for those whose offset is
+	// not a constant
+	active       bool
+	offset, size int64
+}
+
+// dataPlacements returns where every data segment is written
+func (m *wasmBinary) dataPlacements() ([]dataPlacement, error) {
+	section := m.section(sectionData)
+	if section == nil {
+		return nil, nil
+	}
+	r := &wasmbin.Reader{Data: section.Payload}
+	n, err := r.U32()
+	if err != nil {
+		return nil, err
+	}
+	placements := make([]dataPlacement, 0, r.Capacity(n))
+	for i := uint32(0); i < n; i++ {
+		flags, err := r.U32()
+		if err != nil {
+			return nil, err
+		}
+		if flags == 2 {
+			if _, err := r.U32(); err != nil {
+				return nil, err
+			}
+		}
+		var placement dataPlacement
+		if flags == 0 || flags == 2 {
+			// Only a lone constant gives an offset known ahead of time
+			first, err := r.Instruction()
+			if err != nil {
+				return nil, fmt.Errorf("data segment %d: %w", i, err)
+			}
+			if first.Opcode != opEnd {
+				second, err := r.Instruction()
+				if err != nil {
+					return nil, fmt.Errorf("data segment %d: %w", i, err)
+				}
+				placement.active = second.Opcode == opEnd && (first.Opcode == opI32Const || first.Opcode == opI64Const)
+				placement.offset = first.Const
+				if second.Opcode != opEnd {
+					if err := r.SkipConstExpr(); err != nil {
+						return nil, fmt.Errorf("data segment %d: %w", i, err)
+					}
+				}
+			}
+		} else if flags != 1 {
+			return nil, fmt.Errorf("data segment %d: unknown flags %d", i, flags)
+		}
+		size, err := r.U32()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := r.Bytes(int(size)); err != nil {
+			return nil, fmt.Errorf("data segment %d: %w", i, err)
+		}
+		placement.size = int64(size)
+		placement.active = placement.active && size > 0
+		placements = append(placements, placement)
+	}
+	return placements, nil
+}
+
+// constrain maps every annotated argument of an input into its domain.
+// Values outside it wrap around, so mutations keep varying the argument
+// instead of piling up at a bound.
+func constrain(input []int32, domains []argDomain) {
+	for i, domain := range domains {
+		if i < len(input) && domain.lengthOf < 0 {
+			input[i] = domain.fit(input[i], domain.min, domain.max)
+		}
+	}
+	// Lengths fit after the pointers they follow are placed
+	for i, domain := range domains {
+		if i < len(input) && domain.lengthOf >= 0 {
+			end := domains[domain.lengthOf].max + 1
+			input[i] = domain.fit(input[i], 0, min(domain.max, end-int64(input[domain.lengthOf])))
+		}
+	}
+}
+
+// fit maps a value into the domain, between lo and hi. A length with no
+// room left after its pointer is the domain's lowest.
+func (d argDomain) fit(v int32, lo, hi int64) int32 {
+	if len(d.values) > 0 {
+		return d.values[floorMod(int64(v), int64(len(d.values)))]
+	}
+	lo = max(lo, d.min)
+	if hi < lo {
+		return int32(lo)
+	}
+	x := int64(v)
+	if x < lo || x > hi {
+		x = lo + floorMod(x-lo, hi-lo+1)
+	}
+	if d.align > 1 {
+		x -= floorMod(x, d.align)
+		if x < lo {
+			x += d.align
+		}
+		if x > hi {
+			x = lo
+		}
+	}
+	return int32(x)
+}
+
+// floorMod returns x modulo n, from 0 to n-1
+func floorMod(x, n int64) int64 {
+	m := x % n
+	if m < 0 {
+		m += n
+	}
+	return m
+}
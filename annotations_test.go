@@ -0,0 +1,191 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mrhapile/WASM-Injection-Framework/internal/wasmbin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// annotatedBinary exports copy(i32, i32, i32) -> i32 and
+// wide(i32, i64) -> i32, with four data segments: 4 bytes at 1024, a passive one, 16 bytes at 2048 in memory 0,
+// and one placed at a global's offset
+func annotatedBinary() []byte {
+	module := &wasmBinary{}
+	add := func(id byte, payload ...byte) {
+		module.Sections = append(module.Sections, wasmSection{ID: id, Payload: payload})
+	}
+
+	add(sectionType, 0x02, 0x60, 0x03, 0x7f, 0x7f, 0x7f, 0x01, 0x7f, 0x60, 0x02, 0x7f, 0x7e, 0x01, 0x7f)
+	add(sectionFunction, 0x02, 0x00, 0x01)
+	add(sectionMemory, 0x01, 0x00, 0x01)
+	exports := append(wasmbin.AppendName([]byte{0x02}, "copy"), externFunc, 0x00)
+	add(sectionExport, append(wasmbin.AppendName(exports, "wide"), externFunc, 0x01)...)
+	add(sectionCode, 0x02, 0x04, 0x00, opLocalGet, 0x00, opEnd, 0x04, 0x00, opLocalGet, 0x00, opEnd)
+
+	data := []byte{0x04}
+	data = append(wasmbin.AppendS32(append(data, 0x00, opI32Const), 1024), opEnd, 0x04, 1, 2, 3, 4)
+	data = append(data, 0x01, 0x02, 5, 6)
+	data = append(wasmbin.AppendS32(append(data, 0x02, 0x00, opI32Const), 2048), opEnd, 0x10)
+	data = append(data, make([]byte, 16)...)
+	data = append(data, 0x00, opGlobalGet, 0x00, opEnd, 0x01, 7)
+	add(sectionData, data...)
+	return module.encode()
+}
+
+func intPtr(v int) *int { return &v }
+
+// -----------------------------------------------------------------------------
+// TEST: Argument Annotations
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Random scalars rarely make a valid pointer, length or mode, so most
+// fuzzed inputs are rejected before reaching interesting code. Declaring
+// the domain of each argument keeps generated inputs meaningful.
+// -----------------------------------------------------------------------------
+
+func TestAnnotations_DataPlacements(t *testing.T) {
+	module, err := parseWasmBinary(annotatedBinary())
+	require.NoError(t, err)
+	placements, err := module.dataPlacements()
+	require.NoError(t, err)
+
+	assert.Equal(t, []dataPlacement{
+		{active: true, offset: 1024, size: 4},
+		{size: 2},
+		{active: true, offset: 2048, size: 16},
+		{size: 1},
+	}, placements)
+}
+
+func TestAnnotations_OversizedSegmentCountFailsTheModule(t *testing.T) {
+	// A data section claiming 2^32-1 segments in 5 bytes
+	module := &wasmBinary{Sections: []wasmSection{{ID: sectionData, Payload: []byte{0xff, 0xff, 0xff, 0xff, 0x0f}}}}
+	_, err := module.dataPlacements()
+	assert.ErrorIs(t, err, wasmbin.ErrTruncated)
+}
+
+func TestAnnotations_ResolvesConstraints(t *testing.T) {
+	domains, err := resolveConstraints(annotatedBinary(), "copy", []ArgConstraint{
+		{Pointer: &PointerConstraint{Segment: 2}, Align: 4},
+		{LengthOf: intPtr(0)},
+		{Range: []int64{-8, 1 << 40}},
+	})
+	require.NoError(t, err)
+
+	require.Len(t, domains, 3)
+	assert.Equal(t, argDomain{min: 2048, max: 2063, align: 4, lengthOf: -1}, domains[0])
+	assert.Equal(t, 0, domains[1].lengthOf)
+	assert.Equal(t, int64(-8), domains[2].min)
+	assert.Equal(t, int64(1<<31-1), domains[2].max, "ranges are clamped to i32")
+}
+
+func TestAnnotations_RejectsInvalidConstraints(t *testing.T) {
+	cases := map[string][]ArgConstraint{
+		"arguments annotated":    make([]ArgConstraint, 4),
+		"range must be":          {{Range: []int64{5, 1}}},
+		"data segment 1":         {{Pointer: &PointerConstraint{Segment: 1}}},
+		"data segment 3":         {{Pointer: &PointerConstraint{Segment: 3}}},
+		"data segment 9":         {{Pointer: &PointerConstraint{Segment: 9}}},
+		"align must be":          {{Align: -4}},
+		"leave no value":         {{Pointer: &PointerConstraint{Segment: 0}, Range: []int64{0, 10}}},
+		"not a pointer":          {{}, {LengthOf: intPtr(0)}},
+		"length_of 7":            {{LengthOf: intPtr(7)}},
+		"module does not export": nil,
+	}
+	for message, constraints := range cases {
+		function := "copy"
+		if constraints == nil {
+			function = "missing"
+		}
+		_, err := resolveConstraints(annotatedBinary(), function, constraints)
+		assert.ErrorContains(t, err, message)
+	}
+
+	_, err := resolveConstraints(annotatedBinary(), "wide", []ArgConstraint{{}, {Range: []int64{0, 1}}})
+	assert.ErrorContains(t, err, "argument 1 is i64")
+	_, err = resolveConstraints(annotatedBinary(), "wide", []ArgConstraint{{Range: []int64{0, 1}}, {}})
+	assert.NoError(t, err, "unannotated arguments may be of any type")
+}
+
+func TestAnnotations_ConstrainWrapsIntoDomains(t *testing.T) {
+	domains := []argDomain{
+		{min: 2048, max: 2063, align: 4, lengthOf: -1},
+		{min: 0, max: 1<<31 - 1, align: 1, lengthOf: 0},
+		{values: []int32{3, 5, 9}, lengthOf: -1},
+		{min: 10, max: 19, align: 1, lengthOf: -1},
+	}
+
+	input := []int32{2063, 1000, -1, 25}
+	constrain(input, domains)
+	assert.Equal(t, []int32{2060, 0, 9, 15}, input)
+
+	input = []int32{-7, -7, 4, 10}
+	constrain(input, domains)
+	assert.Equal(t, []int32{2056, 2, 5, 10}, input)
+
+	// Unannotated trailing arguments are left alone
+	input = []int32{2048, 16, 0, 12, 99}
+	constrain(input, domains)
+	assert.Equal(t, []int32{2048, 16, 3, 12, 99}, input)
+}
+
+func TestAnnotations_FuzzedArgumentsStayInDomains(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "copy.wasm")
+	require.NoError(t, os.WriteFile(path, annotatedBinary(), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "copy.args.yaml"), []byte(`
+copy:
+  - pointer: {segment: 2}
+  - length_of: 0
+  - values: [1, 2]
+`), 0o644))
+
+	var calls [][]interface{}
+	runtime := &MockWasmRuntime{
+		LoadModuleFunc: func(filePath string) (WasmModule, error) {
+			return &MockWasmModule{ExecuteFunc: func(funcName string, args ...interface{}) ([]interface{}, error) {
+				calls = append(calls, args)
+				return []interface{}{int32(0)}, nil
+			}}, nil
+		},
+	}
+	result := processWasmFileWithOptions(path, runtime, RunOptions{
+		Invocation: InvocationConfig{Entry: "copy", Inputs: []InvocationInput{i32Input(0, 0, 0)}},
+		ArgFuzz:    ArgFuzzConfig{Iterations: 100, Seed: 3},
+	})
+	require.True(t, result.Success, result.ErrorMessage)
+
+	require.Greater(t, len(calls), 50)
+	for _, args := range calls[1:] {
+		ptr, length, mode := args[0].(int32), args[1].(int32), args[2].(int32)
+		assert.GreaterOrEqual(t, ptr, int32(2048))
+		assert.LessOrEqual(t, ptr+length, int32(2064), "the length fits after the pointer")
+		assert.GreaterOrEqual(t, length, int32(0))
+		assert.Contains(t, []int32{1, 2}, mode)
+	}
+}
+
+func TestAnnotations_InvalidFileFailsTheRun(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "copy.wasm")
+	annotations := filepath.Join(dir, "domains.yaml")
+	require.NoError(t, os.WriteFile(path, annotatedBinary(), 0o644))
+	require.NoError(t, os.WriteFile(annotations, []byte("copy:\n  - ranges: [0, 1]\n"), 0o644))
+
+	result := processWasmFileWithOptions(path, &MockWasmRuntime{}, RunOptions{
+		Invocation: InvocationConfig{Entry: "copy", Annotations: annotations},
+		ArgFuzz:    ArgFuzzConfig{Iterations: 10},
+	})
+	assert.False(t, result.Success)
+	assert.Equal(t, StageSignature, result.FailureStage)
+	assert.Contains(t, result.ErrorMessage, "annotations:")
+	assert.Contains(t, result.ErrorMessage, "ranges")
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"time"
+)
+
+// maxArgCorpus caps the number of inputs kept for further mutation
+const maxArgCorpus = 256
+
+// maxUniqueFailures caps the distinct failures recorded per file
+const maxUniqueFailures = 32
+
+// interestingI32 are boundary values that commonly trigger edge cases
+var interestingI32 = []int32{0, 1, -1, 2, 7, 8, 16, 32, 64, 100, 127, -128, 255, 256, 1024, 4096, 32767, -32768, 65535, 65536, math.MaxInt32, math.MinInt32}
+
+// ArgFuzzConfig enables argument-fuzzing mode, where the entry function is
+// invoked repeatedly with mutated arguments
+type ArgFuzzConfig struct {
+	// Iterations is the number of mutated inputs per file; 0 disables fuzzing
+	Iterations int `yaml:"iterations"`
+	// Seed makes the mutation sequence reproducible
+	Seed int64 `yaml:"seed"`
+	// Reload loads a fresh module for every input instead of keeping one
+	// instance hot and restoring it from a snapshot
+	Reload bool `yaml:"reload"`
+	// Payload mutates buffer inputs as json or protobuf documents instead
+	// of mutating i32 arguments
+	Payload string `yaml:"payload"`
+	// Concolic solves the comparisons i32 arguments are stuck on, when
+	// coverage is enabled
+	Concolic ConcolicConfig `yaml:"concolic"`
+	// Sync shares the inputs kept with the other fuzzers of a fleet
+	Sync CorpusSyncConfig `yaml:"sync"`
+}
+
+// ArgFuzzSummary records the outcome of argument fuzzing for one file
+type ArgFuzzSummary struct {
+	Iterations     int              `json:"iterations"`
+	Seed           int64            `json:"seed"`
+	Persistent     bool             `json:"persistent"`
+	Payload        string           `json:"payload,omitempty"`
+	ExecsPerSec    float64          `json:"execs_per_sec"`
+	Failures       int              `json:"failures"`
+	DictionarySize int              `json:"dictionary_size"`
+	UniqueFailures []ArgFuzzFailure `json:"unique_failures,omitempty"`
+	// Concolic reports the inputs solved from comparisons, when enabled
+	Concolic *ConcolicSummary `json:"concolic,omitempty"`
+	// Sync counts the inputs shared with other fuzzers, when enabled
+	Sync *CorpusSyncSummary `json:"sync,omitempty"`
+}
+
+// ArgFuzzFailure is a distinct failure found by argument fuzzing, with the
+// first input that triggered it
+type ArgFuzzFailure struct {
+	Args         []WasmValue `json:"args"`
+	ErrorMessage string      `json:"error_message"`
+	Count        int         `json:"count"`
+	// Correlation shows which input bits the failure depends on
+	Correlation *TrapCorrelation `json:"correlation,omitempty"`
+}
+
+// argumentSource produces the inputs of argument fuzzing and learns from
+// their outcomes
+type argumentSource interface {
+	// useDictionary mixes constants extracted from the module into
+	// mutation and returns how many are used
+	useDictionary(dict *moduleDictionary) int
+	// next returns the arguments of the next call
+	next() []interface{}
+	// keep adds an input that produced a new outcome to the corpus
+	keep(input []interface{})
+	// favor marks an input that got closer to a directed fuzzing target
+	favor(input []interface{})
+}
+
+// argMutator derives new i32 argument vectors from a growing corpus using
+// a seeded PRNG, so the same seed always produces the same input sequence
+type argMutator struct {
+	rng    *rand.Rand
+	corpus [][]int32
+	// favored is the input closest to a directed fuzzing target
+	favored []int32
+	// dictionary holds magic values extracted from the module
+	dictionary []int32
+	// domains keep annotated arguments within their declared domains
+	domains []argDomain
+}
+
+func newArgMutator(seed int64, seeds [][]int32) *argMutator {
+	return &argMutator{
+		rng:    rand.New(rand.NewSource(seed)),
+		corpus: append([][]int32(nil), seeds...),
+	}
+}
+
+// next returns the next mutated input, with one argument mutated
+func (m *argMutator) next() []int32 {
+	// Half of the inputs derive from the input closest to a target
+	var base []int32
+	if m.favored != nil && m.rng.Intn(2) == 0 {
+		base = m.favored
+	} else {
+		base = m.corpus[m.rng.Intn(len(m.corpus))]
+	}
+
+	input := append([]int32(nil), base...)
+	switch len(input) {
+	case 0:
+		return input
+	case 1:
+		input[0] = m.mutate(input[0])
+	default:
+		i := m.rng.Intn(len(input))
+		input[i] = m.mutate(input[i])
+	}
+	constrain(input, m.domains)
+	return input
+}
+
+// mutate derives a new value from one argument
+func (m *argMutator) mutate(base int32) int32 {
+	switch m.rng.Intn(5) {
+	case 0:
+		// Flip a single bit
+		return base ^ (1 << uint(m.rng.Intn(32)))
+	case 1:
+		// Small arithmetic delta
+		return base + int32(m.rng.Intn(33)-16)
+	case 2:
+		// Magic value from the module, or a boundary value
+		if len(m.dictionary) > 0 && m.rng.Intn(2) == 0 {
+			return m.dictionary[m.rng.Intn(len(m.dictionary))]
+		}
+		return interestingI32[m.rng.Intn(len(interestingI32))]
+	case 3:
+		// Negate
+		return -base
+	default:
+		// Uniformly random value
+		return int32(m.rng.Uint32())
+	}
+}
+
+// keep adds an input that produced a new outcome to the corpus
+func (m *argMutator) keep(input []int32) {
+	if len(m.corpus) < maxArgCorpus {
+		m.corpus = append(m.corpus, input)
+	}
+}
+
+// favor marks an input that got closer to a directed fuzzing target, so
+// mutation concentrates around it
+func (m *argMutator) favor(input []int32) {
+	m.favored = input
+	m.keep(input)
+}
+
+// i32Source adapts an argMutator to argumentSource
+type i32Source struct {
+	*argMutator
+}
+
+func (s i32Source) useDictionary(dict *moduleDictionary) int {
+	s.dictionary = dict.argumentValues()
+	return len(s.dictionary)
+}
+
+func (s i32Source) next() []interface{} {
+	return i32Values(s.argMutator.next())
+}
+
+func (s i32Source) keep(input []interface{}) {
+	s.argMutator.keep(int32Vector(input))
+}
+
+func (s i32Source) favor(input []interface{}) {
+	s.argMutator.favor(int32Vector(input))
+}
+
+// fuzzArguments invokes the entry function with mutated i32 arguments;
+// see fuzzWithSource
+func fuzzArguments(result *ExecutionResult, module *WasmModule, filePath string, runtime WasmRuntime, plan InvocationConfig, seeds [][]int32, config ArgFuzzConfig, coverage *coverageTracker) {
+	mutator := newArgMutator(config.Seed, seeds)
+	mutator.domains = plan.domains
+	fuzzWithSource(result, module, filePath, runtime, plan, i32Source{mutator}, config, coverage)
+}
+
+// fuzzWithSource invokes the entry function with mutated inputs and records
+// a summary on the result. *module is updated whenever the module is
+// reloaded, so the caller always closes the current instance. With a
+// coverage tracker, inputs reaching new edges are kept for mutation too, and
+// inputs getting closer to a directed target are favored. Constants the
+// module compares against are mixed into the boundary values. Each distinct
+// failure found with i32 arguments is then correlated with the bits of its
+// triggering input. With concolic solving, inputs solved from the
+// comparisons logged while coverage stalls run ahead of mutated ones. With
+// a sync, the inputs kept are exchanged with other fuzzers as it goes.
+func fuzzWithSource(result *ExecutionResult, module *WasmModule, filePath string, runtime WasmRuntime, plan InvocationConfig, source argumentSource, config ArgFuzzConfig, coverage *coverageTracker) {
+	summary := &ArgFuzzSummary{
+		Iterations: config.Iterations,
+		Seed:       config.Seed,
+		Persistent: !config.Reload,
+		Payload:    config.Payload,
+	}
+	result.ArgFuzz = summary
+	result.Success = true
+
+	// A hot module is reset from the post-setup snapshot between inputs
+	var snapshot *ModuleSnapshot
+	if stateful, ok := (*module).(StatefulModule); ok && !config.Reload {
+		var err error
+		snapshot, err = stateful.Snapshot()
+		if err != nil {
+			result.Success = false
+			result.FailureStage = StageExecute
+			result.ErrorMessage = fmt.Sprintf("snapshot failed: %v", err)
+			return
+		}
+	}
+
+	// Modules the decoder cannot read are fuzzed without a dictionary
+	if data, err := os.ReadFile(filePath); err == nil {
+		if dict, err := extractDictionary(data); err == nil {
+			summary.DictionarySize = source.useDictionary(dict)
+		}
+	}
+	failures := make(map[string]*ArgFuzzFailure)
+	inputs := make(map[string][]interface{})
+	var order []string
+	concolic := newConcolicSolver(config.Concolic, coverage)
+	defer func() { summary.Concolic = concolic.report() }()
+	sync := startCorpusSync(config, plan.Entry, filePath, summary)
+	source = sync.wrap(source)
+	defer sync.finish()
+
+	start := time.Now()
+	for i := 0; i < config.Iterations; i++ {
+		if i > 0 {
+			var err error
+			*module, err = resetModule(*module, snapshot, filePath, runtime, plan)
+			if err != nil {
+				result.Success = false
+				result.FailureStage, result.ErrorMessage = classifyError(err, StageExecute, "restore failed")
+				result.FailureSubStage = failureSubStage(err)
+				return
+			}
+		}
+
+		args := concolic.next()
+		if args == nil {
+			args = source.next()
+		}
+		sync.tick(args)
+		_, err := plan.call(*module, args)
+		newEdges, closer := coverage.collect(*module)
+		concolic.observe(args, newEdges)
+		if closer {
+			source.favor(args)
+		}
+		if err == nil {
+			if newEdges {
+				source.keep(args)
+			}
+			continue
+		}
+
+		summary.Failures++
+		_, message := classifyError(err, StageExecute, "execution failed")
+		if failure, seen := failures[message]; seen {
+			failure.Count++
+			continue
+		}
+
+		source.keep(args)
+		if len(order) < maxUniqueFailures {
+			failures[message] = &ArgFuzzFailure{
+				Args:         encodeValues(args),
+				ErrorMessage: message,
+				Count:        1,
+			}
+			inputs[message] = args
+			order = append(order, message)
+		}
+	}
+
+	if elapsed := time.Since(start).Seconds(); elapsed > 0 {
+		summary.ExecsPerSec = float64(config.Iterations) / elapsed
+	}
+
+	// Bisect each distinct i32 failure, starting every run from the
+	// post-setup state
+	run := func(args []int32) (string, error) {
+		var err error
+		if *module, err = resetModule(*module, snapshot, filePath, runtime, plan); err != nil {
+			return "", err
+		}
+		_, err = (*module).Execute(plan.Entry, i32Values(args)...)
+		coverage.collect(*module)
+		if err == nil {
+			return "", nil
+		}
+		_, message := classifyError(err, StageExecute, "execution failed")
+		return message, nil
+	}
+	var restoreErr error
+	for _, message := range order {
+		if vector := int32Vector(inputs[message]); restoreErr == nil && vector != nil {
+			failures[message].Correlation, restoreErr = correlateFailure(vector, message, run)
+		}
+		summary.UniqueFailures = append(summary.UniqueFailures, *failures[message])
+	}
+	if restoreErr != nil {
+		result.Success = false
+		result.FailureStage, result.ErrorMessage = classifyError(restoreErr, StageExecute, "restore failed")
+		result.FailureSubStage = failureSubStage(restoreErr)
+		return
+	}
+	if len(summary.UniqueFailures) > 0 {
+		first := summary.UniqueFailures[0]
+		result.Success = false
+		result.FailureStage = StageExecute
+		result.ErrorMessage = fmt.Sprintf("input %s: %s", describeArgs(first.Args), first.ErrorMessage)
+	}
+}
+
+// int32Vector returns arguments as an i32 vector, or nil if any argument
+// is not an i32
+func int32Vector(args []interface{}) []int32 {
+	vector := make([]int32, len(args))
+	for i, arg := range args {
+		n, ok := arg.(int32)
+		if !ok {
+			return nil
+		}
+		vector[i] = n
+	}
+	return vector
+}
+
+// i32Values converts an argument vector for Execute
+func i32Values(args []int32) []interface{} {
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = arg
+	}
+	return values
+}
@@ -0,0 +1,140 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// divisionModule traps on zero and on negative inputs with distinct messages
+func divisionModule() *counterModule {
+	m := newCounterModule()
+	m.ExecuteFunc = func(funcName string, args ...interface{}) ([]interface{}, error) {
+		input := args[0].(int32)
+		switch {
+		case input == 0:
+			return nil, errors.New("integer divide by zero")
+		case input < 0:
+			return nil, errors.New("out of bounds memory access")
+		}
+		m.counter++
+		return []interface{}{100 / input}, nil
+	}
+	return m
+}
+
+// correlationRuns counts the re-runs spent correlating failures with inputs
+func correlationRuns(summary *ArgFuzzSummary) int {
+	runs := 0
+	for _, failure := range summary.UniqueFailures {
+		if failure.Correlation != nil {
+			runs += failure.Correlation.Executions
+		}
+	}
+	return runs
+}
+
+// -----------------------------------------------------------------------------
+// TEST: Persistent Argument Fuzzing
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Reloading a module for every input dominates the cost of argument
+// fuzzing. Keeping one instance hot is only sound if its state is reset
+// from the snapshot between inputs, and it must find the same failures.
+// -----------------------------------------------------------------------------
+
+func TestArgFuzz_PersistentKeepsModuleHot(t *testing.T) {
+	module := &statefulCounterModule{counterModule: divisionModule()}
+	loads := 0
+	mockRuntime := &MockWasmRuntime{
+		LoadModuleFunc: func(filePath string) (WasmModule, error) {
+			loads++
+			return module, nil
+		},
+	}
+
+	opts := RunOptions{ArgFuzz: ArgFuzzConfig{Iterations: 500, Seed: 7}}
+	result := processWasmFileWithOptions("/test/div.wasm", mockRuntime, opts)
+
+	require.NotNil(t, result.ArgFuzz)
+	assert.Equal(t, 1, loads, "persistent mode should load the module once")
+	assert.Equal(t, 499+correlationRuns(result.ArgFuzz), module.restores, "state should be restored before every input after the first")
+	assert.True(t, result.ArgFuzz.Persistent)
+	assert.Equal(t, 500, result.ArgFuzz.Iterations)
+	assert.True(t, module.CloseCalled)
+}
+
+func TestArgFuzz_ReloadModeLoadsPerInput(t *testing.T) {
+	loads := 0
+	mockRuntime := &MockWasmRuntime{
+		LoadModuleFunc: func(filePath string) (WasmModule, error) {
+			loads++
+			return &statefulCounterModule{counterModule: divisionModule()}, nil
+		},
+	}
+
+	opts := RunOptions{ArgFuzz: ArgFuzzConfig{Iterations: 50, Seed: 7, Reload: true}}
+	result := processWasmFileWithOptions("/test/div.wasm", mockRuntime, opts)
+
+	assert.Equal(t, 50+correlationRuns(result.ArgFuzz), loads)
+	assert.False(t, result.ArgFuzz.Persistent)
+}
+
+func TestArgFuzz_FindsAndDeduplicatesFailures(t *testing.T) {
+	mockRuntime := &MockWasmRuntime{
+		LoadModuleFunc: func(filePath string) (WasmModule, error) {
+			return &statefulCounterModule{counterModule: divisionModule()}, nil
+		},
+	}
+
+	opts := RunOptions{ArgFuzz: ArgFuzzConfig{Iterations: 2000, Seed: 1}}
+	result := processWasmFileWithOptions("/test/div.wasm", mockRuntime, opts)
+
+	assert.False(t, result.Success)
+	assert.Equal(t, StageExecute, result.FailureStage)
+
+	messages := make(map[string]int)
+	total := 0
+	for _, failure := range result.ArgFuzz.UniqueFailures {
+		messages[failure.ErrorMessage] = failure.Count
+		total += failure.Count
+	}
+	assert.Len(t, messages, 2, "each distinct failure should be reported once")
+	assert.Contains(t, messages, "execution failed: integer divide by zero")
+	assert.Contains(t, messages, "execution failed: out of bounds memory access")
+	assert.Equal(t, result.ArgFuzz.Failures, total, "counts should cover every failing input")
+}
+
+func TestArgFuzz_Deterministic(t *testing.T) {
+	run := func() *ArgFuzzSummary {
+		mockRuntime := &MockWasmRuntime{
+			LoadModuleFunc: func(filePath string) (WasmModule, error) {
+				return &statefulCounterModule{counterModule: divisionModule()}, nil
+			},
+		}
+		opts := RunOptions{ArgFuzz: ArgFuzzConfig{Iterations: 300, Seed: 42}}
+		return processWasmFileWithOptions("/test/div.wasm", mockRuntime, opts).ArgFuzz
+	}
+
+	first, second := run(), run()
+
+	assert.Equal(t, first.Failures, second.Failures)
+	assert.Equal(t, first.UniqueFailures, second.UniqueFailures, "same seed must reproduce the same inputs")
+}
+
+func TestArgFuzz_MutatorSeededFromInputs(t *testing.T) {
+	mutator := newArgMutator(3, [][]int32{{1000}})
+
+	seen := make(map[int32]bool)
+	for i := 0; i < 200; i++ {
+		seen[mutator.next()[0]] = true
+	}
+
+	assert.Greater(t, len(seen), 50, "mutator should explore many distinct values")
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// artifactFile is a file a report or artifact is written to
+type artifactFile interface {
+	io.Writer
+	Sync() error
+}
+
+// wrapArtifact wraps the files reports and artifacts are written to.
+// Tests replace it to fail writes as a full disk does, or to slow down
+// syncs.
+var wrapArtifact = func(file *os.File) artifactFile { return file }
+
+// writeArtifact writes an artifact like os.WriteFile, removing the file
+// when it could not be written whole
+func writeArtifact(name string, data []byte, perm os.FileMode) error {
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	_, err = wrapArtifact(file).Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(name)
+	}
+	return err
+}
+
+// replaceFile writes a file through write to a temporary file renamed over
+// path once complete, so an earlier file at path stays intact until then,
+// even when the fuzzer dies writing it
+func replaceFile(path string, perm os.FileMode, write func(w io.Writer) error) (err error) {
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			file.Close()
+			os.Remove(file.Name())
+		}
+	}()
+
+	out := wrapArtifact(file)
+	if err := write(out); err != nil {
+		return err
+	}
+	if err := file.Chmod(perm); err != nil {
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// summaryFields are the fields of each failure a report summary keeps
+var summaryFields = []string{"environment", "failure_stage", "error_message"}
+
+// reportSummary slims a report to its totals and counts, and the stage
+// and error of each failure. It is what is left to write to stdout when
+// the report file cannot be written.
+func reportSummary(report FuzzingReport) FuzzingReport {
+	summary := FuzzingReport{
+		SchemaVersion:  report.SchemaVersion,
+		TotalFiles:     report.TotalFiles,
+		Passed:         report.Passed,
+		Failed:         report.Failed,
+		Skipped:        report.Skipped,
+		Results:        report.Results,
+		FailureCounts:  report.FailureCounts,
+		SkipCounts:     report.SkipCounts,
+		SeverityCounts: report.SeverityCounts,
+		Shard:          report.Shard,
+		Aborted:        report.Aborted,
+	}
+	filter := &ResultFilter{OnlyFailures: true, Fields: summaryFields}
+	return filter.apply(summary)
+}
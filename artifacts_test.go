@@ -0,0 +1,146 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// faultyArtifact is an artifact file on a disk that fills up after room
+// more bytes, and whose syncs take syncDelay
+type faultyArtifact struct {
+	file      artifactFile
+	room      *int
+	syncDelay time.Duration
+}
+
+func (f faultyArtifact) Write(p []byte) (int, error) {
+	if len(p) > *f.room {
+		n, _ := f.file.Write(p[:*f.room])
+		*f.room = 0
+		return n, &os.PathError{Op: "write", Path: "artifact", Err: syscall.ENOSPC}
+	}
+	*f.room -= len(p)
+	return f.file.Write(p)
+}
+
+func (f faultyArtifact) Sync() error {
+	time.Sleep(f.syncDelay)
+	return f.file.Sync()
+}
+
+// injectDiskFaults makes artifact writes fail once room bytes are written
+// and syncs take syncDelay, until the test ends
+func injectDiskFaults(t *testing.T, room int, syncDelay time.Duration) {
+	original := wrapArtifact
+	wrapArtifact = func(file *os.File) artifactFile {
+		return faultyArtifact{file: original(file), room: &room, syncDelay: syncDelay}
+	}
+	t.Cleanup(func() { wrapArtifact = original })
+}
+
+// captureStdout returns what fn writes to stdout
+func captureStdout(t *testing.T, fn func()) []byte {
+	stdout := os.Stdout
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	os.Stdout = w
+	fn()
+	os.Stdout = stdout
+	require.NoError(t, w.Close())
+	out, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return out
+}
+
+// captureStderr returns what fn writes to stderr
+func captureStderr(t *testing.T, fn func()) []byte {
+	stderr := os.Stderr
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	os.Stderr = w
+	fn()
+	os.Stderr = stderr
+	require.NoError(t, w.Close())
+	out, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return out
+}
+
+// -----------------------------------------------------------------------------
+// TEST: Artifact Write Faults
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// A campaign of hours must not lose its results to a full disk or a slow
+// one. Reports and artifacts that cannot be written must never be left
+// half written, and the outcome of the campaign must still get out.
+// -----------------------------------------------------------------------------
+
+func TestArtifacts_FullDiskFallsBackToASummary(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "report.json")
+	require.NoError(t, writeReportFile(path, FuzzingReport{SchemaVersion: SchemaVersion}))
+	previous, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	injectDiskFaults(t, 64, 0)
+	var writeErr error
+	out := captureStdout(t, func() { writeErr = writeReport(path, filterTestReport()) })
+	assert.True(t, errors.Is(writeErr, syscall.ENOSPC))
+
+	kept, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, previous, kept, "the previous report is not overwritten")
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "the partial report is removed")
+
+	var summary FuzzingReport
+	require.NoError(t, json.Unmarshal(out, &summary))
+	assert.Equal(t, 3, summary.TotalFiles)
+	assert.Equal(t, 2, summary.Failed)
+	require.Len(t, summary.Results, 2, "only the failures are summarized")
+	assert.Equal(t, "bad.wasm", summary.Results[0].FilePath)
+	assert.Equal(t, "magic header not detected", summary.Results[0].ErrorMessage)
+	assert.Empty(t, summary.Results[0].ErrorCode)
+}
+
+func TestArtifacts_SlowSyncsStillComplete(t *testing.T) {
+	injectDiskFaults(t, 1<<20, 50*time.Millisecond)
+	path := filepath.Join(t.TempDir(), "report.json")
+	start := time.Now()
+	require.NoError(t, writeReport(path, filterTestReport()))
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond, "the report is synced")
+
+	loaded, err := loadReport(path)
+	require.NoError(t, err)
+	assert.Len(t, loaded.Results, 3)
+}
+
+func TestArtifacts_FullDiskStopsTheCache(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := newResultCache(RunOptions{Cache: CacheConfig{Dir: dir}})
+	require.NoError(t, err)
+	injectDiskFaults(t, 16, 0)
+
+	result := ExecutionResult{SchemaVersion: SchemaVersion, FilePath: "a.wasm", Success: true}
+	cache.store("first", result)
+	cache.store("second", result)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries, "no partial result is left to be reused")
+	assert.Contains(t, cache.summarize().WriteError, "no space left on device")
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	goruntime "runtime"
+	"sort"
+	"time"
+)
+
+// performanceGovernor is the frequency governor that keeps a CPU at its
+// highest frequency, which stable latencies need
+const performanceGovernor = "performance"
+
+// BenchReport is the JSON written by the bench subcommand
+type BenchReport struct {
+	// Warmup iterations of each module are reported apart from the
+	// Iterations measuring its steady state
+	Warmup     int `json:"warmup"`
+	Iterations int `json:"iterations"`
+	// CPU is the CPU the benchmark was pinned to, when it was
+	CPU     *BenchCPU     `json:"cpu,omitempty"`
+	Modules []ModuleBench `json:"modules"`
+}
+
+// BenchCPU describes the CPU a benchmark ran pinned to
+type BenchCPU struct {
+	Pinned int `json:"pinned"`
+	// Governor is the CPU's frequency governor, empty when unknown
+	Governor string `json:"governor,omitempty"`
+}
+
+// ModuleBench is the latency of a module through the whole pipeline. The
+// first runs fill the runtime's caches, so they are reported apart: ColdNs
+// is the first run and WarmupNs every warmup run in order. The other
+// latencies are of the steady state.
+type ModuleBench struct {
+	FilePath string `json:"file_path"`
+	// Success and FailureStage are the outcome of the last iteration
+	Success      bool         `json:"success"`
+	FailureStage FailureStage `json:"failure_stage"`
+	ColdNs       int64        `json:"cold_ns"`
+	WarmupNs     []int64      `json:"warmup_ns,omitempty"`
+	MinNs        int64        `json:"min_ns"`
+	MedianNs     int64        `json:"median_ns"`
+	P95Ns        int64        `json:"p95_ns"`
+	MaxNs        int64        `json:"max_ns"`
+}
+
+// latencyPercentile returns the latency below which pct percent of the
+// sorted latencies fall
+func latencyPercentile(sorted []time.Duration, pct int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := (len(sorted)*pct+99)/100 - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
+
+// benchModule runs a file warmup times, then iterations times, and
+// summarizes its latency
+func benchModule(filePath string, runtime WasmRuntime, opts RunOptions, warmup, iterations int) ModuleBench {
+	latencies := make([]time.Duration, warmup+iterations)
+	var result ExecutionResult
+	for i := range latencies {
+		started := time.Now()
+		result = processWasmFileWithOptions(filePath, runtime, opts)
+		latencies[i] = time.Since(started)
+	}
+
+	bench := ModuleBench{
+		FilePath:     filePath,
+		Success:      result.Success,
+		FailureStage: result.FailureStage,
+		ColdNs:       int64(latencies[0]),
+	}
+	for _, latency := range latencies[:warmup] {
+		bench.WarmupNs = append(bench.WarmupNs, int64(latency))
+	}
+	latencies = latencies[warmup:]
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	bench.MinNs = int64(latencies[0])
+	bench.MedianNs = int64(latencyPercentile(latencies, 50))
+	bench.P95Ns = int64(latencyPercentile(latencies, 95))
+	bench.MaxNs = int64(latencies[len(latencies)-1])
+	return bench
+}
+
+// runBench benchmarks every file in turn
+func runBench(files []string, runtime WasmRuntime, opts RunOptions, warmup, iterations int) BenchReport {
+	report := BenchReport{Warmup: warmup, Iterations: iterations, Modules: make([]ModuleBench, 0, len(files))}
+	for _, filePath := range files {
+		report.Modules = append(report.Modules, benchModule(filePath, runtime, opts, warmup, iterations))
+	}
+	return report
+}
+
+// checkGovernors reports CPUs whose governor is not the performance one.
+// CPUs whose governor is unknown, as in most VMs, are not reported.
+func checkGovernors(cpus []int) error {
+	for _, cpu := range cpus {
+		if governor := cpuGovernor(cpu); governor != "" && governor != performanceGovernor {
+			return fmt.Errorf("cpu %d uses the %s governor, not %s", cpu, governor, performanceGovernor)
+		}
+	}
+	return nil
+}
+
+// runBenchCommand measures the latency of every module of a corpus. Pinned
+// to a CPU using the performance governor, the numbers are stable enough
+// to gate on.
+func runBenchCommand(args []string) int {
+	flags := flag.NewFlagSet("bench", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	configPath := flags.String("config", "", "YAML campaign config")
+	warmup := flags.Int("warmup", 1, "runs of each module reported apart before its iterations")
+	iterations := flags.Int("iterations", 10, "runs of each module measuring its steady state")
+	pinCPU := flags.Int("pin-cpu", -1, "CPU to pin the benchmark to")
+	checkGovernor := flags.Bool("check-governor", false, "fail unless the CPUs use the performance governor")
+
+	usage := "usage: wasm-fuzzer bench [--config file.yaml] [--warmup n] [--iterations n] [--pin-cpu n] [--check-governor] <directory>"
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 || *warmup < 0 || *iterations < 1 {
+		emitError(map[string]string{"error": usage})
+		return 1
+	}
+	files, err := collectWasmFiles(flags.Arg(0))
+	if err != nil {
+		emitError(map[string]string{
+			"error":   "directory access failed",
+			"details": err.Error(),
+		})
+		return 1
+	}
+	config, err := resolveConfig(*configPath)
+	if err != nil {
+		emitError(map[string]string{
+			"error":   "config load failed",
+			"details": err.Error(),
+		})
+		return 1
+	}
+
+	// The benchmark runs on this goroutine, so pinning its thread pins
+	// every runtime call
+	var cpu *BenchCPU
+	if *pinCPU >= 0 {
+		goruntime.LockOSThread()
+		defer goruntime.UnlockOSThread()
+		if err := pinThread(*pinCPU); err != nil {
+			emitError(map[string]string{
+				"error":   "failed to pin CPU",
+				"details": err.Error(),
+			})
+			return 1
+		}
+		cpu = &BenchCPU{Pinned: *pinCPU, Governor: cpuGovernor(*pinCPU)}
+	}
+	if *checkGovernor {
+		cpus := onlineCPUs()
+		if cpu != nil {
+			cpus = []int{cpu.Pinned}
+		}
+		if err := checkGovernors(cpus); err != nil {
+			emitError(map[string]string{
+				"error":   "unstable CPU frequency",
+				"details": err.Error(),
+			})
+			return 1
+		}
+	}
+
+	// Modules run in the first environment of the matrix
+	envs, err := buildEnvironmentRuntimes(config)
+	if err != nil {
+		emitError(map[string]string{
+			"error":   "invalid environment matrix",
+			"details": err.Error(),
+		})
+		return 1
+	}
+	defer closeRuntimes(envs)
+
+	report := runBench(files, envs[0].Runtime, config.runOptions(), *warmup, *iterations)
+	report.CPU = cpu
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		emitError(map[string]string{
+			"error":   "failed to encode JSON output",
+			"details": err.Error(),
+		})
+		return 1
+	}
+	return 0
+}
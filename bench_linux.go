@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// cpuSysfs is where the kernel describes the CPUs
+var cpuSysfs = "/sys/devices/system/cpu"
+
+// maxPinnedCPU bounds the CPUs the affinity mask can name
+const maxPinnedCPU = 1024
+
+// pinThread restricts the calling thread to one CPU. The goroutine must
+// be locked to its thread.
+func pinThread(cpu int) error {
+	if cpu < 0 || cpu >= maxPinnedCPU {
+		return fmt.Errorf("cpu %d out of range", cpu)
+	}
+	var mask [maxPinnedCPU / 64]uint64
+	mask[cpu/64] = 1 << (cpu % 64)
+	_, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_SETAFFINITY, 0, unsafe.Sizeof(mask), uintptr(unsafe.Pointer(&mask)))
+	if errno != 0 {
+		return fmt.Errorf("cpu %d: %w", cpu, errno)
+	}
+	return nil
+}
+
+// cpuGovernor returns the frequency governor of a CPU, or "" when the CPU
+// has no frequency scaling
+func cpuGovernor(cpu int) string {
+	data, err := os.ReadFile(filepath.Join(cpuSysfs, fmt.Sprintf("cpu%d", cpu), "cpufreq", "scaling_governor"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// onlineCPUs lists the CPUs the kernel describes
+func onlineCPUs() []int {
+	matches, _ := filepath.Glob(filepath.Join(cpuSysfs, "cpu[0-9]*"))
+	var cpus []int
+	for _, match := range matches {
+		if cpu, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(match), "cpu")); err == nil {
+			cpus = append(cpus, cpu)
+		}
+	}
+	sort.Ints(cpus)
+	return cpus
+}
@@ -0,0 +1,50 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	goruntime "runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBench_ChecksGovernors(t *testing.T) {
+	root := t.TempDir()
+	original := cpuSysfs
+	cpuSysfs = root
+	t.Cleanup(func() { cpuSysfs = original })
+	for cpu, governor := range map[string]string{"cpu0": "performance", "cpu1": "powersave", "cpu2": ""} {
+		dir := filepath.Join(root, cpu, "cpufreq")
+		require.NoError(t, os.MkdirAll(dir, 0o755))
+		if governor != "" {
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "scaling_governor"), []byte(governor+"\n"), 0o644))
+		}
+	}
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "cpufreq"), 0o755))
+
+	assert.Equal(t, []int{0, 1, 2}, onlineCPUs())
+	assert.Equal(t, "performance", cpuGovernor(0))
+	assert.Equal(t, "", cpuGovernor(2), "no frequency scaling")
+	assert.NoError(t, checkGovernors([]int{0, 2}))
+	assert.EqualError(t, checkGovernors(onlineCPUs()), "cpu 1 uses the powersave governor, not performance")
+}
+
+func TestBench_PinsThread(t *testing.T) {
+	assert.Error(t, pinThread(-1))
+	assert.Error(t, pinThread(maxPinnedCPU))
+
+	// A thread locked when its goroutine exits is discarded with its pinning
+	done := make(chan error)
+	go func() {
+		goruntime.LockOSThread()
+		done <- pinThread(0)
+	}()
+	if err := <-done; err != nil {
+		t.Skipf("cpu 0 is not available: %v", err)
+	}
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "errors"
+
+// pinThread is only supported on Linux
+func pinThread(cpu int) error {
+	return errors.New("CPU pinning is only supported on Linux")
+}
+
+// cpuGovernor is unknown outside Linux
+func cpuGovernor(cpu int) string {
+	return ""
+}
+
+// onlineCPUs lists no CPUs outside Linux, whose governors are unknown
+func onlineCPUs() []int {
+	return nil
+}
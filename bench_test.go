@@ -0,0 +1,105 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// -----------------------------------------------------------------------------
+// TEST: Benchmarks
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Per-module latencies are only usable as regression gates when they are
+// stable. A benchmark must run every module the same number of times, and
+// refuse to run on a CPU whose frequency changes under it.
+// -----------------------------------------------------------------------------
+
+func TestBench_SummarizesLatencies(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.wasm", "b.wasm"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(name), 0o644))
+	}
+	files, err := collectWasmFiles(dir)
+	require.NoError(t, err)
+
+	loads := map[string]int{}
+	runtime := &MockWasmRuntime{LoadModuleFunc: func(filePath string) (WasmModule, error) {
+		loads[filepath.Base(filePath)]++
+		if filepath.Base(filePath) == "b.wasm" {
+			return nil, &RuntimeError{Stage: StageValidate, Message: "bad module"}
+		}
+		return &MockWasmModule{}, nil
+	}}
+	report := runBench(files, runtime, RunOptions{}, 0, 5)
+
+	assert.Equal(t, 5, report.Iterations)
+	assert.Equal(t, map[string]int{"a.wasm": 5, "b.wasm": 5}, loads)
+	require.Len(t, report.Modules, 2)
+	assert.True(t, report.Modules[0].Success)
+	assert.Equal(t, StageValidate, report.Modules[1].FailureStage)
+	for _, module := range report.Modules {
+		assert.LessOrEqual(t, module.MinNs, module.MedianNs)
+		assert.LessOrEqual(t, module.MedianNs, module.P95Ns)
+		assert.LessOrEqual(t, module.P95Ns, module.MaxNs)
+	}
+}
+
+func TestBench_ReportsWarmupApart(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.wasm"), []byte("a"), 0o644))
+	files, err := collectWasmFiles(dir)
+	require.NoError(t, err)
+
+	// The first run is far slower, as loading a module the first time is
+	loads := 0
+	runtime := &MockWasmRuntime{LoadModuleFunc: func(string) (WasmModule, error) {
+		loads++
+		if loads == 1 {
+			time.Sleep(20 * time.Millisecond)
+		}
+		return &MockWasmModule{}, nil
+	}}
+	report := runBench(files, runtime, RunOptions{}, 2, 3)
+
+	assert.Equal(t, 2, report.Warmup)
+	assert.Equal(t, 5, loads)
+	module := report.Modules[0]
+	require.Len(t, module.WarmupNs, 2)
+	assert.Equal(t, module.ColdNs, module.WarmupNs[0])
+	assert.GreaterOrEqual(t, module.ColdNs, int64(20*time.Millisecond))
+	assert.Less(t, module.MaxNs, int64(20*time.Millisecond), "the cold run is not part of the steady state")
+
+	// Without warmup, the cold run is still reported, and part of the
+	// steady state
+	loads = 0
+	module = runBench(files, runtime, RunOptions{}, 0, 3).Modules[0]
+	assert.Empty(t, module.WarmupNs)
+	assert.Equal(t, module.ColdNs, module.MaxNs)
+}
+
+func TestBench_LatencyPercentile(t *testing.T) {
+	latencies := make([]time.Duration, 20)
+	for i := range latencies {
+		latencies[i] = time.Duration(i + 1)
+	}
+	assert.Equal(t, time.Duration(10), latencyPercentile(latencies, 50))
+	assert.Equal(t, time.Duration(19), latencyPercentile(latencies, 95))
+	assert.Equal(t, time.Duration(1), latencyPercentile(latencies[:1], 95))
+	assert.Zero(t, latencyPercentile(nil, 50))
+}
+
+func TestBench_RejectsBadArguments(t *testing.T) {
+	assert.Equal(t, 1, runBenchCommand(nil))
+	assert.Equal(t, 1, runBenchCommand([]string{"--iterations", "0", t.TempDir()}))
+	assert.Equal(t, 1, runBenchCommand([]string{"--warmup", "-1", t.TempDir()}))
+	assert.Equal(t, 1, runBenchCommand([]string{filepath.Join(t.TempDir(), "missing")}))
+}
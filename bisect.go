@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// BisectStep is the outcome of the module under one runtime version
+type BisectStep struct {
+	Version string `json:"version"`
+	Library string `json:"library"`
+	// Bad is set when the module fails as it does under the newest version
+	Bad bool `json:"bad"`
+	// Signature identifies how the module failed, empty when it passed
+	Signature string `json:"signature,omitempty"`
+}
+
+// BisectReport is the result of a bisection: the version that introduced
+// the failure, and the steps taken to find it
+type BisectReport struct {
+	FilePath string `json:"file_path"`
+	// Signature is how the module fails under the newest version
+	Signature string `json:"signature"`
+	// LastGood and FirstBad are adjacent versions; the failure came in
+	// with FirstBad
+	LastGood string       `json:"last_good"`
+	FirstBad string       `json:"first_bad"`
+	Steps    []BisectStep `json:"steps"`
+}
+
+// runWithLibrary runs a file in a child process that loads libwasmedge
+// from library, passing args to the run subcommand
+var runWithLibrary = func(library string, args []string) (ExecutionResult, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return ExecutionResult{}, err
+	}
+	cmd := exec.Command(self, append([]string{"run"}, args...)...)
+	cmd.Env = append(os.Environ(), libraryPathEnv(library))
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	runErr := cmd.Run()
+
+	var result ExecutionResult
+	if err := json.Unmarshal(stdout.Bytes(), &result); err == nil {
+		return result, nil
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(runErr, &exitErr) {
+		return result, runErr
+	}
+	// The child died before writing its result, which may be the failure
+	exit := exitErr.ProcessState.String()
+	result.ErrorMessage = "run died: " + exit
+	result.Crash = parseCrash(exit, stderr.String())
+	if result.Crash == nil {
+		return result, fmt.Errorf("run failed: %s: %s", exit, strings.TrimSpace(stderr.String()))
+	}
+	return result, nil
+}
+
+// outcomeSignature identifies how a result failed, or is empty when it
+// passed. Crashes compare by bucket, other failures by classification.
+func outcomeSignature(result ExecutionResult) string {
+	switch {
+	case result.Crash != nil:
+		return result.Crash.signature()
+	case result.Success:
+		return ""
+	case result.Classification != nil:
+		return result.Classification.Signature
+	}
+	return string(result.FailureStage) + ":" + result.ErrorMessage
+}
+
+// bisectLibrary is a runtime version to bisect
+type bisectLibrary struct {
+	version, dir string
+}
+
+// bisectVersions lists the library directories to bisect, oldest first.
+// A single directory holds the versions as subdirectories named by
+// version, such as 0.13.4.
+func bisectVersions(dirs []string) ([]bisectLibrary, error) {
+	var libraries []bisectLibrary
+	if len(dirs) == 1 {
+		entries, err := os.ReadDir(dirs[0])
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				libraries = append(libraries, bisectLibrary{version: entry.Name(), dir: filepath.Join(dirs[0], entry.Name())})
+			}
+		}
+		sort.SliceStable(libraries, func(i, j int) bool { return compareVersions(libraries[i].version, libraries[j].version) < 0 })
+	} else {
+		for _, dir := range dirs {
+			libraries = append(libraries, bisectLibrary{version: filepath.Base(dir), dir: dir})
+		}
+	}
+	if len(libraries) < 2 {
+		return nil, fmt.Errorf("need at least two versions, found %d", len(libraries))
+	}
+	return libraries, nil
+}
+
+// compareVersions orders version names: release parts numerically, so
+// 0.9.1 comes before 0.13.0, then a pre-release before its release, and
+// pre-releases with their numbers compared numerically, so 0.13.0-rc2
+// comes before 0.13.0-rc10
+func compareVersions(a, b string) int {
+	releaseA, preA, _ := strings.Cut(strings.TrimPrefix(a, "v"), "-")
+	releaseB, preB, _ := strings.Cut(strings.TrimPrefix(b, "v"), "-")
+	if c := compareNatural(strings.Split(releaseA, "."), strings.Split(releaseB, ".")); c != 0 {
+		return c
+	}
+	switch {
+	case preA == preB:
+		return 0
+	case preA == "":
+		return 1
+	case preB == "":
+		return -1
+	}
+	return compareNatural(numberRuns.FindAllString(preA, -1), numberRuns.FindAllString(preB, -1))
+}
+
+// numberRuns splits a name into runs of digits and of other characters
+var numberRuns = regexp.MustCompile(`\d+|\D+`)
+
+// compareNatural orders two lists of parts, numerically where both parts
+// are numbers
+func compareNatural(a, b []string) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		na, errA := strconv.Atoi(a[i])
+		nb, errB := strconv.Atoi(b[i])
+		if errA == nil && errB == nil {
+			if na != nb {
+				return na - nb
+			}
+		} else if c := strings.Compare(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+	return len(a) - len(b)
+}
+
+// bisect finds the oldest version under which the module fails the way it
+// does under the newest one, assuming every version after that fails too
+func bisect(filePath string, libraries []bisectLibrary, runArgs []string) (BisectReport, error) {
+	report := BisectReport{FilePath: filePath}
+	args := append(append([]string(nil), runArgs...), filePath)
+	step := func(i int) (BisectStep, error) {
+		result, err := runWithLibrary(libraries[i].dir, args)
+		if err != nil {
+			return BisectStep{}, fmt.Errorf("version %s: %v", libraries[i].version, err)
+		}
+		s := BisectStep{Version: libraries[i].version, Library: libraries[i].dir, Signature: outcomeSignature(result)}
+		s.Bad = s.Signature != "" && s.Signature == report.Signature
+		report.Steps = append(report.Steps, s)
+		return s, nil
+	}
+
+	newest := len(libraries) - 1
+	result, err := runWithLibrary(libraries[newest].dir, args)
+	if err != nil {
+		return report, fmt.Errorf("version %s: %v", libraries[newest].version, err)
+	}
+	if report.Signature = outcomeSignature(result); report.Signature == "" {
+		return report, fmt.Errorf("the module passes under the newest version, %s", libraries[newest].version)
+	}
+	report.Steps = append(report.Steps, BisectStep{Version: libraries[newest].version, Library: libraries[newest].dir, Bad: true, Signature: report.Signature})
+	if oldest, err := step(0); err != nil {
+		return report, err
+	} else if oldest.Bad {
+		return report, fmt.Errorf("the module already fails under the oldest version, %s", oldest.Version)
+	}
+
+	good, bad := 0, newest
+	for bad-good > 1 {
+		mid := (good + bad) / 2
+		s, err := step(mid)
+		if err != nil {
+			return report, err
+		}
+		if s.Bad {
+			bad = mid
+		} else {
+			good = mid
+		}
+	}
+	report.LastGood, report.FirstBad = libraries[good].version, libraries[bad].version
+	return report, nil
+}
+
+// runBisectCommand bisects runtime versions for the one that introduced a
+// module's failure, writing the bisection as JSON
+func runBisectCommand(args []string) int {
+	flags := flag.NewFlagSet("bisect", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	configPath := flags.String("config", "", "YAML campaign config")
+
+	if err := flags.Parse(args); err != nil || flags.NArg() < 2 {
+		emitError(map[string]string{
+			"error": "usage: wasm-fuzzer bisect [--config file.yaml] <file.wasm> <versions-dir> | <library-dir>...",
+		})
+		return 1
+	}
+	filePath := flags.Arg(0)
+	if _, err := os.Stat(filePath); err != nil {
+		emitError(map[string]string{
+			"error":   "module access failed",
+			"details": err.Error(),
+		})
+		return 1
+	}
+	libraries, err := bisectVersions(flags.Args()[1:])
+	if err != nil {
+		emitError(map[string]string{
+			"error":   "invalid versions",
+			"details": err.Error(),
+		})
+		return 1
+	}
+
+	var runArgs []string
+	if *configPath != "" {
+		runArgs = []string{"--config", *configPath}
+	}
+	report, err := bisect(filePath, libraries, runArgs)
+	if err != nil {
+		emitError(map[string]string{
+			"error":   "bisection failed",
+			"details": err.Error(),
+		})
+		return 1
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(report)
+	return 0
+}
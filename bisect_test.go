@@ -0,0 +1,106 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeLibraries makes each library directory behave as outcome says, and
+// records the directories run
+func fakeLibraries(t *testing.T, outcome map[string]ExecutionResult) *[]string {
+	var ran []string
+	original := runWithLibrary
+	runWithLibrary = func(library string, args []string) (ExecutionResult, error) {
+		ran = append(ran, library)
+		assert.Equal(t, "crash.wasm", args[len(args)-1])
+		return outcome[filepath.Base(library)], nil
+	}
+	t.Cleanup(func() { runWithLibrary = original })
+	return &ran
+}
+
+// trapAt is a failure with the default classification of a trap
+func trapAt(trap string) ExecutionResult {
+	return ExecutionResult{FailureStage: StageExecute, ErrorMessage: trap, Classification: &Classification{Signature: "execute:" + trap}}
+}
+
+func bisectLibraries(versions ...string) []bisectLibrary {
+	libraries := make([]bisectLibrary, len(versions))
+	for i, version := range versions {
+		libraries[i] = bisectLibrary{version: version, dir: filepath.Join("libs", version)}
+	}
+	return libraries
+}
+
+// -----------------------------------------------------------------------------
+// TEST: Version Bisection
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// The fastest way to a runtime fix is the release that broke it. Trying
+// every release by hand is slow, so the fuzzer has to binary-search them,
+// and only count a version as bad when the module fails there the way it
+// does now: an older, different failure is a different bug.
+// -----------------------------------------------------------------------------
+
+func TestBisect_FindsFirstBadVersion(t *testing.T) {
+	crash := ExecutionResult{Crash: &CrashInfo{Signal: "SIGSEGV", Frame: "runLoadOp", AddressClass: "null"}}
+	outcome := map[string]ExecutionResult{
+		"0.11.0": {Success: true},
+		"0.11.1": trapAt("unreachable"),
+		"0.11.2": {Success: true},
+		"0.12.0": {Success: true},
+		"0.12.1": crash,
+		"0.13.0": crash,
+		"0.13.4": crash,
+	}
+	ran := fakeLibraries(t, outcome)
+
+	report, err := bisect("crash.wasm", bisectLibraries("0.11.0", "0.11.1", "0.11.2", "0.12.0", "0.12.1", "0.13.0", "0.13.4"), nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, "crash:SIGSEGV:runLoadOp:null", report.Signature)
+	assert.Equal(t, "0.12.0", report.LastGood)
+	assert.Equal(t, "0.12.1", report.FirstBad)
+	assert.Len(t, *ran, len(report.Steps))
+	assert.LessOrEqual(t, len(*ran), 5, "versions are binary-searched")
+	for _, step := range report.Steps {
+		assert.Equal(t, step.Signature == report.Signature, step.Bad, step.Version)
+	}
+}
+
+func TestBisect_RejectsUnbracketedRange(t *testing.T) {
+	fakeLibraries(t, map[string]ExecutionResult{"a": trapAt("unreachable"), "b": trapAt("unreachable")})
+	_, err := bisect("crash.wasm", bisectLibraries("a", "b"), nil)
+	assert.EqualError(t, err, "the module already fails under the oldest version, a")
+
+	fakeLibraries(t, map[string]ExecutionResult{"a": trapAt("unreachable"), "b": {Success: true}})
+	_, err = bisect("crash.wasm", bisectLibraries("a", "b"), nil)
+	assert.EqualError(t, err, "the module passes under the newest version, b")
+}
+
+func TestBisectVersions_SortsSubdirectories(t *testing.T) {
+	dir := t.TempDir()
+	for _, version := range []string{"0.13.0", "0.9.1", "0.13.0-rc2", "0.13.0-rc10", "0.10.0"} {
+		require.NoError(t, os.Mkdir(filepath.Join(dir, version), 0o755))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README"), nil, 0o644))
+
+	libraries, err := bisectVersions([]string{dir})
+	require.NoError(t, err)
+	var versions []string
+	for _, library := range libraries {
+		versions = append(versions, library.version)
+	}
+	assert.Equal(t, []string{"0.9.1", "0.10.0", "0.13.0-rc2", "0.13.0-rc10", "0.13.0"}, versions)
+
+	_, err = bisectVersions([]string{filepath.Join(dir, "0.9.1")})
+	assert.EqualError(t, err, "need at least two versions, found 0")
+}
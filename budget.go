@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// BudgetSummary reports how much of the corpus a time-boxed campaign ran
+type BudgetSummary struct {
+	MaxDuration string `json:"max_duration"`
+	Elapsed     string `json:"elapsed"`
+	// Files counts the files the campaign selected, and Ran those it ran
+	// within the budget
+	Files int `json:"files"`
+	Ran   int `json:"ran"`
+	// Coverage is the share of the files run, from 0 to 1
+	Coverage float64 `json:"coverage"`
+	// Exhausted is set when the budget ran out before every file ran
+	Exhausted bool `json:"exhausted"`
+}
+
+// campaignBudget time-boxes a campaign, nil when it runs every file
+type campaignBudget struct {
+	max     time.Duration
+	started time.Time
+	files   map[string]bool
+	ran     map[string]bool
+}
+
+// newCampaignBudget starts the budget of a campaign, returning nil without
+// a maximum duration
+func newCampaignBudget(max time.Duration) (*campaignBudget, error) {
+	if max < 0 {
+		return nil, errors.New("max_duration must not be negative")
+	}
+	if max == 0 {
+		return nil, nil
+	}
+	return &campaignBudget{max: max, started: time.Now(), files: make(map[string]bool), ran: make(map[string]bool)}, nil
+}
+
+// schedule orders the jobs of the campaign, see scheduleJobs
+func (b *campaignBudget) schedule(jobs []campaignJob, history *campaignHistory) []campaignJob {
+	if b == nil {
+		return jobs
+	}
+	for _, job := range jobs {
+		b.files[job.FilePath] = true
+	}
+	return scheduleJobs(jobs, history)
+}
+
+// spent reports whether the budget is used up, before a job runs
+func (b *campaignBudget) spent(job campaignJob) bool {
+	if b == nil {
+		return false
+	}
+	if time.Since(b.started) >= b.max {
+		return true
+	}
+	b.ran[job.FilePath] = true
+	return false
+}
+
+// summarize reports the share of the corpus run within the budget
+func (b *campaignBudget) summarize() *BudgetSummary {
+	if b == nil {
+		return nil
+	}
+	summary := &BudgetSummary{
+		MaxDuration: b.max.String(),
+		Elapsed:     time.Since(b.started).Round(time.Millisecond).String(),
+		Files:       len(b.files),
+		Ran:         len(b.ran),
+	}
+	summary.measure()
+	return summary
+}
+
+// measure works out the coverage from the files run
+func (s *BudgetSummary) measure() {
+	s.Coverage = 1
+	if s.Files > 0 {
+		s.Coverage = float64(s.Ran) / float64(s.Files)
+	}
+	s.Exhausted = s.Ran < s.Files
+}
+
+// scheduleJobs orders the jobs of a time-boxed campaign so the files most
+// likely to catch a regression run before the budget runs out. Files
+// reused from the cache cost nothing, so they come first. Then come the
+// files changed since they last ran, then those whose module no campaign
+// ran yet, then the others, the likeliest to fail first and then the least
+// recently run. A file's jobs stay together, and otherwise the order is
+// kept.
+func scheduleJobs(jobs []campaignJob, history *campaignHistory) []campaignJob {
+	type rank struct {
+		tier       int
+		likelihood float64
+		lastRun    time.Time
+	}
+	ranks := make(map[string]rank)
+	for _, job := range jobs {
+		if _, ok := ranks[job.FilePath]; ok {
+			continue
+		}
+		entry, seen := history.lookup(job.FilePath)
+		switch {
+		case job.Unchanged:
+			ranks[job.FilePath] = rank{tier: 0}
+		case history.changed(job.FilePath):
+			ranks[job.FilePath] = rank{tier: 1}
+		case !seen:
+			ranks[job.FilePath] = rank{tier: 2}
+		default:
+			ranks[job.FilePath] = rank{tier: 3, likelihood: entry.failureLikelihood(), lastRun: entry.LastRun}
+		}
+	}
+	scheduled := append([]campaignJob(nil), jobs...)
+	sort.SliceStable(scheduled, func(i, j int) bool {
+		a, b := ranks[scheduled[i].FilePath], ranks[scheduled[j].FilePath]
+		if a.tier != b.tier {
+			return a.tier < b.tier
+		}
+		if a.likelihood != b.likelihood {
+			return a.likelihood > b.likelihood
+		}
+		return a.lastRun.Before(b.lastRun)
+	})
+	return scheduled
+}
@@ -0,0 +1,204 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeHistory keeps a history of the given files, keyed by their content
+func writeHistory(t *testing.T, path string, modules map[string]ModuleHistory) {
+	file := historyFile{Modules: make(map[string]*ModuleHistory)}
+	for filePath, entry := range modules {
+		data, err := os.ReadFile(filePath)
+		require.NoError(t, err)
+		sum := sha256.Sum256(data)
+		entry := entry
+		entry.FilePath = filePath
+		file.Modules[hex.EncodeToString(sum[:])] = &entry
+	}
+	data, err := json.Marshal(file)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+}
+
+// -----------------------------------------------------------------------------
+// TEST: Time-Boxed Campaigns
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// A nightly slot is a few hours, whatever the size of the corpus. What
+// fits in it must be the files most likely to find something, and the
+// report must say how much of the corpus it covered.
+// -----------------------------------------------------------------------------
+
+func TestBudget_SchedulesLikelyFailuresFirst(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{"recent.wasm", "old.wasm", "flaky.wasm", "failing.wasm", "new.wasm", "edited.wasm", "unchanged.wasm"}
+	paths := make(map[string]string)
+	for _, name := range names {
+		paths[name] = filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(paths[name], []byte(name), 0o644))
+	}
+	historyPath := filepath.Join(dir, "history.json")
+	now := time.Now().UTC()
+	writeHistory(t, historyPath, map[string]ModuleHistory{
+		paths["old.wasm"]:     {Runs: 3, LastRun: now.Add(-72 * time.Hour)},
+		paths["flaky.wasm"]:   {Runs: 5, Failures: 2, Flips: 4, FailureRate: 0.3125, LastRun: now.Add(-time.Hour)},
+		paths["failing.wasm"]: {Runs: 3, Failures: 2, FailureRate: 0.75, LastFailed: true, LastRun: now.Add(-time.Hour)},
+		paths["recent.wasm"]:  {Runs: 3, LastRun: now.Add(-time.Hour)},
+		paths["edited.wasm"]:  {Runs: 3, LastRun: now.Add(-time.Hour)},
+	})
+	require.NoError(t, os.WriteFile(paths["edited.wasm"], []byte("edited since"), 0o644))
+	history, err := loadHistory(historyPath)
+	require.NoError(t, err)
+
+	var jobs []campaignJob
+	for i, name := range names {
+		for env := 0; env < 2; env++ {
+			jobs = append(jobs, campaignJob{FilePath: paths[name], Env: env, Index: 2*i + env, Unchanged: name == "unchanged.wasm"})
+		}
+	}
+
+	var order []string
+	for _, job := range scheduleJobs(jobs, history) {
+		order = append(order, filepath.Base(job.FilePath))
+	}
+	assert.Equal(t, []string{
+		"unchanged.wasm", "unchanged.wasm",
+		"edited.wasm", "edited.wasm",
+		"new.wasm", "new.wasm",
+		"flaky.wasm", "flaky.wasm",
+		"failing.wasm", "failing.wasm",
+		"old.wasm", "old.wasm",
+		"recent.wasm", "recent.wasm",
+	}, order)
+
+	var kept []string
+	for _, job := range scheduleJobs(jobs[:4], nil) {
+		kept = append(kept, filepath.Base(job.FilePath))
+	}
+	assert.Equal(t, []string{"recent.wasm", "recent.wasm", "old.wasm", "old.wasm"}, kept, "without a history the order is kept")
+}
+
+func TestBudget_StopsRunningWhenTimeRunsOut(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.wasm", "b.wasm", "c.wasm"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(name), 0o644))
+	}
+	historyPath := filepath.Join(t.TempDir(), "history.json")
+	writeHistory(t, historyPath, map[string]ModuleHistory{
+		filepath.Join(dir, "a.wasm"): {Runs: 1, LastRun: time.Now().Add(-time.Hour)},
+		filepath.Join(dir, "b.wasm"): {Runs: 1, Failures: 1, FailureRate: 1, LastRun: time.Now().Add(-time.Hour), LastFailed: true},
+		filepath.Join(dir, "c.wasm"): {Runs: 1, LastRun: time.Now().Add(-time.Hour)},
+	})
+	runtime := &MockWasmRuntime{LoadModuleFunc: func(filePath string) (WasmModule, error) {
+		time.Sleep(50 * time.Millisecond)
+		return nil, &RuntimeError{Stage: StageLoad, Message: "truncated"}
+	}}
+
+	report, err := runFuzzerWithMatrix(dir, []environmentRuntime{{Runtime: runtime}}, RunOptions{MaxDuration: 20 * time.Millisecond, History: historyPath})
+	require.NoError(t, err)
+
+	require.NotNil(t, report.Budget)
+	assert.Equal(t, "20ms", report.Budget.MaxDuration)
+	assert.Equal(t, 3, report.Budget.Files)
+	assert.Equal(t, 1, report.Budget.Ran)
+	assert.InDelta(t, 1.0/3, report.Budget.Coverage, 1e-9)
+	assert.True(t, report.Budget.Exhausted)
+	assert.Equal(t, 2, report.SkipCounts[SkipOverBudget])
+	assert.False(t, report.Results[1].Skipped, "the file that failed last ran first")
+	assert.Equal(t, "max duration of 20ms reached", report.Results[0].SkipDetails)
+
+	history, err := loadHistory(historyPath)
+	require.NoError(t, err)
+	failed, ok := history.lookup(filepath.Join(dir, "b.wasm"))
+	require.True(t, ok)
+	assert.Equal(t, 2, failed.Runs)
+	assert.Equal(t, 2, failed.Failures)
+	unrun, _ := history.lookup(filepath.Join(dir, "a.wasm"))
+	assert.Equal(t, 1, unrun.Runs, "files left unrun are not recorded")
+
+	_, err = runFuzzerWithMatrix(dir, []environmentRuntime{{Runtime: runtime}}, RunOptions{MaxDuration: -time.Second})
+	assert.EqualError(t, err, "max_duration must not be negative")
+}
+
+func TestHistory_RecordsEachCampaignOnce(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.wasm")
+	require.NoError(t, os.WriteFile(path, []byte("a"), 0o644))
+	historyPath := filepath.Join(dir, "history.json")
+
+	history, err := loadHistory(historyPath)
+	require.NoError(t, err)
+	history.record(ExecutionResult{FilePath: path, Success: true}, 0)
+	history.record(ExecutionResult{FilePath: path, FailureStage: StageExecute, Environment: "aot"}, 0)
+	history.record(ExecutionResult{FilePath: path, FailureStage: StageExecute, Environment: "jit"}, 0)
+	history.record(ExecutionResult{FilePath: path, Cached: true, Success: true}, 0)
+	require.NoError(t, history.save())
+
+	history, err = loadHistory(historyPath)
+	require.NoError(t, err)
+	entry, ok := history.lookup(path)
+	require.True(t, ok)
+	assert.Equal(t, 1, entry.Runs)
+	assert.Equal(t, 1, entry.Failures)
+	assert.True(t, entry.LastFailed)
+
+	assert.Equal(t, 1.0, entry.FailureRate)
+
+	for _, failed := range []bool{false, false, true} {
+		history.record(ExecutionResult{FilePath: path, Success: !failed}, 0)
+		require.NoError(t, history.save())
+		history, err = loadHistory(historyPath)
+		require.NoError(t, err)
+	}
+	entry, _ = history.lookup(path)
+	assert.Equal(t, 4, entry.Runs)
+	assert.Equal(t, 2, entry.Failures)
+	assert.True(t, entry.LastFailed)
+	assert.Equal(t, 2, entry.Flips)
+	assert.Equal(t, 0.625, entry.FailureRate, "recent campaigns weigh the most")
+	assert.InDelta(t, 2.0/3, entry.failureLikelihood(), 1e-9, "modules flipping outcome are likely to fail")
+
+	require.NoError(t, os.WriteFile(historyPath, []byte("{"), 0o644))
+	_, err = loadHistory(historyPath)
+	assert.Error(t, err)
+}
+
+func TestHistory_FullDiskKeepsThePreviousHistory(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.wasm")
+	require.NoError(t, os.WriteFile(path, []byte("a"), 0o644))
+	historyPath := filepath.Join(dir, "history.json")
+	history, err := loadHistory(historyPath)
+	require.NoError(t, err)
+	history.record(ExecutionResult{FilePath: path, Success: true}, 0)
+	require.NoError(t, history.save())
+	previous, err := os.ReadFile(historyPath)
+	require.NoError(t, err)
+
+	injectDiskFaults(t, 16, 0)
+	history.record(ExecutionResult{FilePath: path, FailureStage: StageExecute}, 0)
+	err = history.save()
+	assert.True(t, errors.Is(err, syscall.ENOSPC))
+
+	kept, err := os.ReadFile(historyPath)
+	require.NoError(t, err)
+	assert.Equal(t, previous, kept, "a history half written never replaces the previous one")
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2, "the partial history is removed")
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// Calling conventions for buffer arguments
+const (
+	// ConventionPtrLen passes a buffer as an (i32 pointer, i32 length) pair
+	ConventionPtrLen = "ptr-len"
+	// ConventionNulTerminated passes a single i32 pointer to the bytes
+	// followed by a NUL, as C strings are
+	ConventionNulTerminated = "nul-terminated"
+	// ConventionCanonicalABI lowers string and list<u8> parameters as the
+	// component model does: (pointer, length) allocated with cabi_realloc,
+	// strings validated as UTF-8, and cabi_post_<entry> called afterwards
+	ConventionCanonicalABI = "canonical-abi"
+)
+
+// maxFlatParams is the canonical ABI's limit on flattened parameters; beyond
+// it parameters are passed through memory, which is not supported
+const maxFlatParams = 16
+
+// bufferArg is a buffer argument awaiting lowering into guest memory. It is
+// written afresh for every call, since a reset discards earlier writes.
+type bufferArg struct {
+	// source is the input value as configured, reported in results
+	source WasmValue
+	data   []byte
+}
+
+// isBufferType reports whether an input value type is passed in memory
+func isBufferType(valType string) bool {
+	return valType == "string" || valType == "bytes" || valType == "file"
+}
+
+// decodeBuffer reads the payload of a string, bytes or file input value.
+// Bytes are hex digits; files are read when the inputs are bound.
+func decodeBuffer(value WasmValue) (bufferArg, error) {
+	arg := bufferArg{source: value}
+	switch value.Type {
+	case "bytes":
+		data, err := hex.DecodeString(strings.TrimPrefix(value.Value, "0x"))
+		if err != nil {
+			return arg, fmt.Errorf("invalid bytes value %q: expected hex digits", value.Value)
+		}
+		arg.data = data
+	case "file":
+		data, err := os.ReadFile(value.Value)
+		if err != nil {
+			return arg, fmt.Errorf("reading payload: %w", err)
+		}
+		arg.data = data
+	default:
+		arg.data = []byte(value.Value)
+	}
+	return arg, nil
+}
+
+// withDefaults fills in the calling convention
+func (c MemoryConfig) withDefaults() MemoryConfig {
+	if c.Convention == "" {
+		c.Convention = ConventionPtrLen
+	}
+	// The canonical ABI allocates through cabi_realloc only
+	if c.Convention == ConventionCanonicalABI && c.Allocator == "" {
+		c.Allocator = AllocatorCanonicalABI
+	}
+	return c
+}
+
+// validate checks the convention and its allocator
+func (c MemoryConfig) validate() error {
+	switch c.Convention {
+	case ConventionPtrLen, ConventionNulTerminated:
+	case ConventionCanonicalABI:
+		if c.Allocator != AllocatorCanonicalABI {
+			return fmt.Errorf("the canonical-abi convention requires the canonical-abi allocator, not %q", c.Allocator)
+		}
+	default:
+		return fmt.Errorf("unknown buffer convention %q", c.Convention)
+	}
+	return nil
+}
+
+// params is the number of i32 parameters one buffer is lowered to
+func (c MemoryConfig) params() int {
+	if c.Convention == ConventionNulTerminated {
+		return 1
+	}
+	return 2
+}
+
+// checkBuffer rejects payloads the convention cannot represent
+func (c MemoryConfig) checkBuffer(arg bufferArg) error {
+	if c.Convention == ConventionCanonicalABI && arg.source.Type == "string" && !utf8.Valid(arg.data) {
+		return fmt.Errorf("string is not valid UTF-8; use a bytes value for list<u8> parameters")
+	}
+	return nil
+}
+
+// bufferAllocation is a buffer written into guest memory for one call
+type bufferAllocation struct {
+	ptr, size uint32
+}
+
+// lowerArguments writes every buffer argument into guest memory and
+// replaces it with the parameters of the configured convention
+func (c MemoryConfig) lowerArguments(memory *guestMemory, args []interface{}) ([]interface{}, []bufferAllocation, error) {
+	var lowered []interface{}
+	var allocations []bufferAllocation
+	for i, arg := range args {
+		buffer, ok := arg.(bufferArg)
+		if !ok {
+			lowered = append(lowered, arg)
+			continue
+		}
+
+		data := buffer.data
+		if c.Convention == ConventionNulTerminated {
+			data = append(append([]byte(nil), data...), 0)
+		}
+		ptr, err := memory.WriteBytes(data, 1)
+		if err != nil {
+			return nil, nil, fmt.Errorf("buffer argument %d: %w", i, err)
+		}
+		allocations = append(allocations, bufferAllocation{ptr: ptr, size: uint32(len(data))})
+
+		lowered = append(lowered, int32(ptr))
+		if c.params() == 2 {
+			lowered = append(lowered, int32(len(buffer.data)))
+		}
+	}
+	return lowered, allocations, nil
+}
+
+// call runs the entry function with the given arguments, lowering buffer
+// arguments into guest memory first. Arguments without buffers are passed
+// straight through.
+func (c InvocationConfig) call(module WasmModule, args []interface{}) ([]interface{}, error) {
+	switch c.ABI {
+	case ABIExtism:
+		return c.callExtism(module, args)
+	case ABIProxyWasm:
+		return c.callProxyWasm(module, args)
+	}
+	if c.contract != nil {
+		return c.callContract(module, args)
+	}
+	if c.callsGoFunction(module) {
+		return c.golang.kernel.call(c.Entry, args)
+	}
+	if c.function != nil {
+		return c.callWIT(module, args)
+	}
+	if !hasBuffers(args) {
+		return module.Execute(c.Entry, args...)
+	}
+
+	buffers := c.Buffers.withDefaults()
+	memory, err := newGuestMemory(module, buffers)
+	if err != nil {
+		return nil, err
+	}
+	lowered, allocations, err := buffers.lowerArguments(memory, args)
+	if err != nil {
+		return nil, err
+	}
+	returns, err := module.Execute(c.Entry, lowered...)
+	if err != nil {
+		return nil, err
+	}
+	if buffers.Convention == ConventionCanonicalABI {
+		if err := postReturn(module, c.Entry, returns); err != nil {
+			return nil, err
+		}
+	}
+
+	// Buffers are freed after successful calls only, since a trapped
+	// guest's heap cannot be trusted
+	if buffers.Free {
+		for _, allocation := range allocations {
+			if err := memory.Free(allocation.ptr, allocation.size, 1); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return returns, nil
+}
+
+// callWIT lowers WIT-typed arguments with the canonical ABI and runs the
+// entry, then lets the guest clean up after its results
+func (c InvocationConfig) callWIT(module WasmModule, args []interface{}) ([]interface{}, error) {
+	values := make([]witArg, len(args))
+	for i, arg := range args {
+		values[i] = arg.(witArg)
+	}
+
+	lowering := &canonicalLowering{}
+	if witNeedsMemory(c.function) {
+		memory, err := newGuestMemory(module, c.witMemory())
+		if err != nil {
+			return nil, err
+		}
+		lowering.memory = memory
+	}
+	lowered, err := lowering.lowerParams(c.function, values)
+	if err != nil {
+		return nil, err
+	}
+	returns, err := module.Execute(c.Entry, lowered...)
+	if err != nil {
+		return nil, err
+	}
+	if err := postReturn(module, c.Entry, returns); err != nil {
+		return nil, err
+	}
+	return returns, nil
+}
+
+// postReturn calls the canonical ABI's cabi_post_<entry> export, which lets
+// the guest free memory backing its results, when the module exports one
+func postReturn(module WasmModule, entry string, returns []interface{}) error {
+	typed, ok := module.(SignatureModule)
+	if !ok {
+		return nil
+	}
+	name := "cabi_post_" + entry
+	if _, found := typed.Signature(name); !found {
+		return nil
+	}
+	_, err := module.Execute(name, returns...)
+	return err
+}
+
+// hasBuffers reports whether any argument must be lowered into memory
+func hasBuffers(args []interface{}) bool {
+	for _, arg := range args {
+		if _, ok := arg.(bufferArg); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,253 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+// bufferModule is a heap module whose "process" export has the given
+// parameters and returns the sum of its arguments
+func bufferModule(params []string, allocator map[string]FuncSignature) *heapMockModule {
+	signatures := map[string]FuncSignature{"process": {Params: params, Results: []string{"i32"}}}
+	for name, sig := range allocator {
+		signatures[name] = sig
+	}
+	module := newHeapMockModule(signatures)
+	allocate := module.ExecuteFunc
+	module.ExecuteFunc = func(funcName string, args ...interface{}) ([]interface{}, error) {
+		if funcName != "process" {
+			return allocate(funcName, args...)
+		}
+		module.names = append(module.names, funcName)
+		var sum int32
+		for _, arg := range args {
+			sum += arg.(int32)
+		}
+		return []interface{}{sum}, nil
+	}
+	return module
+}
+
+var (
+	mallocExports = map[string]FuncSignature{
+		"malloc": {Params: []string{"i32"}, Results: []string{"i32"}},
+		"free":   {Params: []string{"i32"}, Results: []string{}},
+	}
+	cabiExports = map[string]FuncSignature{
+		"cabi_realloc":      {Params: []string{"i32", "i32", "i32", "i32"}, Results: []string{"i32"}},
+		"cabi_post_process": {Params: []string{"i32"}, Results: []string{}},
+	}
+)
+
+// runBuffers processes a file backed by the given module
+func runBuffers(module WasmModule, plan InvocationConfig) ExecutionResult {
+	mockRuntime := &MockWasmRuntime{
+		LoadModuleFunc: func(filePath string) (WasmModule, error) { return module, nil },
+	}
+	return processWasmFileWithOptions("/test/buffers.wasm", mockRuntime, RunOptions{Invocation: plan})
+}
+
+// -----------------------------------------------------------------------------
+// TEST: Buffer Argument Conventions
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Parsers, decoders and validators take their input as bytes in linear
+// memory. Fuzzing them needs real payloads written into the guest and passed
+// the way its toolchain expects; a payload passed with the wrong convention
+// is misread by the guest and its failures say nothing about the module.
+// -----------------------------------------------------------------------------
+
+func TestBuffers_ParsesConfig(t *testing.T) {
+	var config InvocationConfig
+	err := yaml.Unmarshal([]byte(`
+buffers:
+  convention: nul-terminated
+  allocator: malloc
+  free: true
+inputs:
+  - [{type: string, value: "GET /"}, 3]
+  - {type: bytes, value: "00ff"}
+`), &config)
+	require.NoError(t, err)
+
+	assert.Equal(t, MemoryConfig{Convention: ConventionNulTerminated, Allocator: AllocatorMalloc, Free: true}, config.Buffers)
+	assert.Equal(t, InvocationInput{{Type: "string", Value: "GET /"}, {Value: "3"}}, config.Inputs[0])
+	assert.Equal(t, InvocationInput{{Type: "bytes", Value: "00ff"}}, config.Inputs[1])
+}
+
+func TestBuffers_PtrLenWritesPayload(t *testing.T) {
+	module := bufferModule([]string{"i32", "i32"}, mallocExports)
+	plan := InvocationConfig{Inputs: []InvocationInput{{{Type: "string", Value: "hello"}}}}
+
+	result := runBuffers(module, plan)
+
+	require.True(t, result.Success, result.ErrorMessage)
+	assert.Equal(t, []string{"malloc", "process"}, module.names)
+	assert.Equal(t, []interface{}{int32(1024), int32(5)}, module.calls[1])
+	assert.Equal(t, "hello", string(module.memory[1024:1029]))
+	assert.Equal(t, []WasmValue{{Type: "i32", Value: "1029"}}, result.TypedReturnValues)
+}
+
+func TestBuffers_NulTerminatedAppendsNul(t *testing.T) {
+	module := bufferModule([]string{"i32", "i32"}, mallocExports)
+	plan := InvocationConfig{
+		Buffers: MemoryConfig{Convention: ConventionNulTerminated},
+		Inputs:  []InvocationInput{{{Type: "bytes", Value: "0x41ff"}, {Value: "7"}}},
+	}
+
+	result := runBuffers(module, plan)
+
+	require.True(t, result.Success, result.ErrorMessage)
+	assert.Equal(t, []interface{}{int32(3)}, module.calls[0], "the NUL is allocated too")
+	assert.Equal(t, []interface{}{int32(1024), int32(7)}, module.calls[1])
+	assert.Equal(t, []byte{0x41, 0xff, 0}, module.memory[1024:1027])
+}
+
+func TestBuffers_EveryCallWritesAfresh(t *testing.T) {
+	module := bufferModule([]string{"i32", "i32"}, mallocExports)
+	plan := InvocationConfig{
+		Inputs: []InvocationInput{{{Type: "string", Value: "ab"}}, {{Type: "string", Value: "cd"}}},
+	}
+
+	result := runBuffers(module, plan)
+
+	require.True(t, result.Success, result.ErrorMessage)
+	require.Len(t, result.Invocations, 2)
+	assert.Equal(t, []WasmValue{{Type: "string", Value: "ab"}}, result.Invocations[0].Args, "inputs are reported as configured")
+	assert.Equal(t, "abcd", string(module.memory[1024:1028]))
+}
+
+func TestBuffers_FileInput(t *testing.T) {
+	payload := filepath.Join(t.TempDir(), "seed.bin")
+	require.NoError(t, os.WriteFile(payload, []byte{1, 2, 3}, 0644))
+	module := bufferModule([]string{"i32", "i32"}, mallocExports)
+
+	result := runBuffers(module, InvocationConfig{Inputs: []InvocationInput{{{Type: "file", Value: payload}}}})
+
+	require.True(t, result.Success, result.ErrorMessage)
+	assert.Equal(t, []byte{1, 2, 3}, module.memory[1024:1027])
+
+	result = runBuffers(module, InvocationConfig{Inputs: []InvocationInput{{{Type: "file", Value: payload + ".missing"}}}})
+	assert.Equal(t, StageSignature, result.FailureStage)
+	assert.Contains(t, result.ErrorMessage, "argument 0: reading payload")
+}
+
+func TestBuffers_FreeAfterSuccessfulCall(t *testing.T) {
+	module := bufferModule([]string{"i32", "i32"}, mallocExports)
+	plan := InvocationConfig{
+		Buffers: MemoryConfig{Free: true},
+		Inputs:  []InvocationInput{{{Type: "string", Value: "x"}}},
+	}
+
+	result := runBuffers(module, plan)
+
+	require.True(t, result.Success, result.ErrorMessage)
+	assert.Equal(t, []string{"malloc", "process", "free"}, module.names)
+}
+
+func TestBuffers_CanonicalABI(t *testing.T) {
+	module := bufferModule([]string{"i32", "i32"}, cabiExports)
+	plan := InvocationConfig{
+		Buffers: MemoryConfig{Convention: ConventionCanonicalABI, Free: true},
+		Inputs:  []InvocationInput{{{Type: "string", Value: "héllo"}}},
+	}
+
+	result := runBuffers(module, plan)
+
+	require.True(t, result.Success, result.ErrorMessage)
+	assert.Equal(t, []string{"cabi_realloc", "process", "cabi_post_process"}, module.names)
+	assert.Equal(t, []interface{}{int32(0), int32(0), int32(1), int32(6)}, module.calls[0])
+	assert.Equal(t, []interface{}{int32(1030)}, module.calls[2], "post-return receives the results")
+}
+
+func TestBuffers_CanonicalABIRejectsInvalidUTF8(t *testing.T) {
+	module := bufferModule([]string{"i32", "i32"}, cabiExports)
+	plan := InvocationConfig{
+		Buffers: MemoryConfig{Convention: ConventionCanonicalABI},
+		Inputs:  []InvocationInput{{{Type: "string", Value: "\xff"}}},
+	}
+
+	result := runBuffers(module, plan)
+
+	assert.Equal(t, StageSignature, result.FailureStage)
+	assert.Contains(t, result.ErrorMessage, "string is not valid UTF-8")
+
+	plan.Inputs = []InvocationInput{{{Type: "bytes", Value: "ff"}}}
+	result = runBuffers(module, plan)
+	assert.True(t, result.Success, "list<u8> takes any bytes")
+}
+
+func TestBuffers_SignatureMismatch(t *testing.T) {
+	input := []InvocationInput{{{Type: "string", Value: "x"}}}
+
+	result := runBuffers(bufferModule([]string{"i32"}, mallocExports), InvocationConfig{Inputs: input})
+	assert.Equal(t, StageSignature, result.FailureStage)
+	assert.Contains(t, result.ErrorMessage, "input 0: 1 arguments given, lowered to 2 parameters, 1 expected")
+
+	result = runBuffers(bufferModule([]string{"i32", "i64"}, mallocExports), InvocationConfig{Inputs: input})
+	assert.Contains(t, result.ErrorMessage, "argument 0: string value given for i64 parameter")
+}
+
+func TestBuffers_ConfigurationErrors(t *testing.T) {
+	input := []InvocationInput{{{Type: "string", Value: "x"}}}
+	tests := []struct {
+		name    string
+		module  WasmModule
+		buffers MemoryConfig
+		message string
+	}{
+		{"no memory access", &MockWasmModule{}, MemoryConfig{}, "buffer inputs: runtime does not support memory access"},
+		{"no allocator", bufferModule([]string{"i32", "i32"}, nil), MemoryConfig{}, "buffer inputs: no allocator export found (cabi_realloc, __wbindgen_malloc or malloc)"},
+		{"unknown convention", bufferModule([]string{"i32", "i32"}, mallocExports), MemoryConfig{Convention: "utf16"}, `buffer inputs: unknown buffer convention "utf16"`},
+		{"canonical ABI with malloc", bufferModule([]string{"i32", "i32"}, mallocExports), MemoryConfig{Convention: ConventionCanonicalABI, Allocator: AllocatorMalloc}, `buffer inputs: the canonical-abi convention requires the canonical-abi allocator, not "malloc"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := runBuffers(tt.module, InvocationConfig{Buffers: tt.buffers, Inputs: input})
+			assert.Equal(t, StageSignature, result.FailureStage)
+			assert.Equal(t, tt.message, result.ErrorMessage)
+		})
+	}
+}
+
+func TestBuffers_AllocatorTrapIsExecutionFailure(t *testing.T) {
+	module := bufferModule([]string{"i32", "i32"}, mallocExports)
+	process := module.ExecuteFunc
+	module.ExecuteFunc = func(funcName string, args ...interface{}) ([]interface{}, error) {
+		if funcName == "malloc" {
+			return nil, &RuntimeError{Stage: StageExecute, Message: "execution failed: out of bounds memory access"}
+		}
+		return process(funcName, args...)
+	}
+
+	result := runBuffers(module, InvocationConfig{Inputs: []InvocationInput{{{Type: "string", Value: "x"}}}})
+
+	assert.Equal(t, StageExecute, result.FailureStage)
+	assert.Equal(t, "execution failed: buffer argument 0: allocator 'malloc' failed: execution failed: out of bounds memory access", result.ErrorMessage)
+}
+
+func TestBuffers_ArgFuzzRejectsBuffers(t *testing.T) {
+	module := bufferModule([]string{"i32", "i32"}, mallocExports)
+	mockRuntime := &MockWasmRuntime{
+		LoadModuleFunc: func(filePath string) (WasmModule, error) { return module, nil },
+	}
+	opts := RunOptions{
+		Invocation: InvocationConfig{Inputs: []InvocationInput{{{Type: "string", Value: "x"}}}},
+		ArgFuzz:    ArgFuzzConfig{Iterations: 10},
+	}
+
+	result := processWasmFileWithOptions("/test/buffers.wasm", mockRuntime, opts)
+
+	assert.Equal(t, StageSignature, result.FailureStage)
+	assert.Contains(t, result.ErrorMessage, "argument fuzzing supports i32 parameters only, argument 0 is string")
+}
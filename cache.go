@@ -0,0 +1,252 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"sync"
+)
+
+// CacheConfig keeps the results of files across campaigns, so that a file
+// whose module, config and environment did not change is not run again
+type CacheConfig struct {
+	// Dir holds one result per module, config and environment. It is
+	// created when missing.
+	Dir string `yaml:"dir"`
+	// Refresh runs every file again and replaces the results kept, as
+	// --no-cache does
+	Refresh bool `yaml:"refresh"`
+}
+
+// CacheSummary counts the results reused from the cache and the files run
+// because it held no result for them
+type CacheSummary struct {
+	Hits   int `json:"hits"`
+	Misses int `json:"misses"`
+	// WriteError stopped the campaign keeping results, as on a full disk
+	WriteError string `json:"write_error,omitempty"`
+}
+
+// resultCache is the cache of a campaign, nil when none is kept
+type resultCache struct {
+	config CacheConfig
+	// options is the hash of the options results depend on
+	options string
+	// redactor scrubs results before they are kept, as the cache is not
+	// private to the user
+	redactor *redactor
+	summary  CacheSummary
+}
+
+// newResultCache opens the cache of a campaign run with opts
+func newResultCache(opts RunOptions) (*resultCache, error) {
+	if opts.Cache.Dir == "" {
+		return nil, nil
+	}
+	if err := os.MkdirAll(opts.Cache.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cache: %w", err)
+	}
+	options, err := cacheOptionsHash(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash options for the cache: %w", err)
+	}
+	// The originals store already keeps each result whole
+	redaction := opts.Redaction
+	redaction.Originals = ""
+	redactor, err := newRedactor(redaction)
+	if err != nil {
+		return nil, err
+	}
+	return &resultCache{config: opts.Cache, options: options, redactor: redactor}, nil
+}
+
+// cacheOptionsHash hashes the options a file's result depends on, with
+// the contents of the files they name and the builds of the fuzzer and
+// the runtime. Those acting on the campaign as a whole, or on results once
+// they are run, are left out so changing them keeps the cache, and so are
+// the corpus settings, which only select the files run.
+func cacheOptionsHash(opts RunOptions) (string, error) {
+	files := make(map[string]string)
+	for _, path := range referencedFiles(opts) {
+		files[path] = fileHash(path)
+	}
+	isolated := opts.WorkerArgs != nil
+	opts.WorkerArgs, opts.CampaignArgs = nil, nil
+	opts.Cache = CacheConfig{}
+	opts.Corpus = CorpusConfig{}
+	opts.Quarantine = QuarantineConfig{}
+	opts.MaxFailures, opts.CircuitBreaker = 0, CircuitBreakerConfig{}
+	opts.MaxDuration, opts.History = 0, ""
+	opts.Restart, opts.Heartbeat = RestartConfig{}, HeartbeatConfig{}
+	data, err := json.Marshal(struct {
+		SchemaVersion int
+		Fuzzer        string
+		Runtime       string
+		Isolated      bool
+		Options       RunOptions
+		Files         map[string]string
+	}{SchemaVersion, fuzzerBuild(), runtimeVersion(), isolated, opts, files})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// referencedFiles lists the files the options name whose contents every
+// result depends on: the WIT and annotations files, and payload files
+func referencedFiles(opts RunOptions) []string {
+	var files []string
+	for _, path := range []string{opts.Invocation.WIT, opts.Invocation.Annotations} {
+		if path != "" {
+			files = append(files, path)
+		}
+	}
+	for _, input := range opts.Invocation.Inputs {
+		for _, value := range input {
+			if value.Type == "file" {
+				files = append(files, value.Value)
+			}
+		}
+	}
+	return files
+}
+
+// sidecarFiles lists the files next to a module that are read when the
+// options name none: its WIT and annotations files
+func sidecarFiles(filePath string) []string {
+	base := strings.TrimSuffix(filePath, filepath.Ext(filePath))
+	return []string{base + ".wit", base + ".args.yaml"}
+}
+
+// fuzzerBuild identifies the build of the fuzzer: its version and commit
+// when it was built from a clean checkout, and otherwise the hash of its
+// executable, which any change to the code changes
+var fuzzerBuild = sync.OnceValue(func() string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		settings := make(map[string]string)
+		for _, setting := range info.Settings {
+			settings[setting.Key] = setting.Value
+		}
+		if revision := settings["vcs.revision"]; revision != "" && settings["vcs.modified"] == "false" {
+			return info.Main.Version + " " + revision
+		}
+	}
+	if self, err := os.Executable(); err == nil {
+		return fileHash(self)
+	}
+	return ""
+})
+
+// key names the cached result of a file run under an environment with the
+// given chaos profile, or is "" when the file cannot be read
+func (c *resultCache) key(filePath string, env Environment, chaos *ChaosProfile) string {
+	module := fileHash(filePath)
+	if module == "" {
+		return ""
+	}
+	var sidecars []string
+	for _, path := range sidecarFiles(filePath) {
+		sidecars = append(sidecars, fileHash(path))
+	}
+	data, err := json.Marshal(struct {
+		Module      string
+		Sidecars    []string
+		Options     string
+		Environment Environment
+		Chaos       *ChaosProfile
+	}{module, sidecars, c.options, env, chaos})
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// load returns the cached result of a key, for the file now at filePath,
+// which may have been renamed since
+func (c *resultCache) load(key, filePath string) (ExecutionResult, bool) {
+	if c == nil || key == "" || c.config.Refresh {
+		return ExecutionResult{}, false
+	}
+	data, err := os.ReadFile(filepath.Join(c.config.Dir, key+".json"))
+	if err != nil {
+		return ExecutionResult{}, false
+	}
+	var result ExecutionResult
+	if err := json.Unmarshal(data, &result); err != nil || result.SchemaVersion != SchemaVersion {
+		return ExecutionResult{}, false
+	}
+	result.FilePath, result.FileName = filePath, filepath.Base(filePath)
+	result.Cached = true
+	return result, true
+}
+
+// store keeps the result of a file run, redacted. Skipped results are not
+// kept, as they were not run. A cache that cannot be written only costs a
+// rerun, so the campaign is warned once and stops writing to it, rather
+// than failing.
+func (c *resultCache) store(key string, result ExecutionResult) {
+	if c == nil || key == "" || result.Skipped || c.summary.WriteError != "" {
+		return
+	}
+	var data []byte
+	err := c.redactor.redact(&result)
+	if err == nil {
+		data, err = json.Marshal(result)
+	}
+	if err == nil {
+		err = writeArtifact(filepath.Join(c.config.Dir, key+".json"), data, 0o644)
+	}
+	if err != nil {
+		c.summary.WriteError = err.Error()
+		emitError(map[string]string{
+			"warning": "failed to write cache, results are no longer kept",
+			"file":    result.FilePath,
+			"details": err.Error(),
+		})
+	}
+}
+
+// reuse returns the cached result of a job, without running it when there
+// is none
+func (c *resultCache) reuse(filePath string, env Environment, chaos *ChaosProfile) (ExecutionResult, bool) {
+	if c == nil {
+		return ExecutionResult{}, false
+	}
+	result, ok := c.load(c.key(filePath, env, chaos), filePath)
+	if ok {
+		c.summary.Hits++
+	}
+	return result, ok
+}
+
+// run returns the cached result of a job, or runs it and keeps its result
+func (c *resultCache) run(filePath string, env Environment, chaos *ChaosProfile, run func() ExecutionResult) ExecutionResult {
+	if c == nil {
+		return run()
+	}
+	key := c.key(filePath, env, chaos)
+	if result, ok := c.load(key, filePath); ok {
+		c.summary.Hits++
+		return result
+	}
+	c.summary.Misses++
+	result := run()
+	c.store(key, result)
+	return result
+}
+
+// summarize reports the cache's hits and misses, nil when none is kept
+func (c *resultCache) summarize() *CacheSummary {
+	if c == nil {
+		return nil
+	}
+	summary := c.summary
+	return &summary
+}
@@ -0,0 +1,194 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// -----------------------------------------------------------------------------
+// TEST: Result Cache
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Nightly campaigns mostly run modules that did not change under a config
+// that did not change. Reusing their results saves the work, but only if a
+// change to the module, the config or the environment is never answered
+// from the cache.
+// -----------------------------------------------------------------------------
+
+func TestCache_ReusesUnchangedResults(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.wasm"), []byte("a"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.wasm"), []byte("b"), 0o644))
+	loads := map[string]int{}
+	runtime := &MockWasmRuntime{LoadModuleFunc: func(filePath string) (WasmModule, error) {
+		loads[filepath.Base(filePath)]++
+		if filepath.Base(filePath) == "b.wasm" {
+			return nil, errors.New("invalid magic")
+		}
+		return &MockWasmModule{}, nil
+	}}
+	envs := []environmentRuntime{{Runtime: runtime}}
+	opts := RunOptions{Cache: CacheConfig{Dir: filepath.Join(t.TempDir(), "cache")}}
+
+	first, err := runFuzzerWithMatrix(dir, envs, opts)
+	require.NoError(t, err)
+	assert.Equal(t, &CacheSummary{Misses: 2}, first.Cache)
+
+	second, err := runFuzzerWithMatrix(dir, envs, opts)
+	require.NoError(t, err)
+	assert.Equal(t, &CacheSummary{Hits: 2}, second.Cache)
+	assert.Equal(t, map[string]int{"a.wasm": 1, "b.wasm": 1}, loads)
+	for i := range second.Results {
+		assert.True(t, second.Results[i].Cached)
+		second.Results[i].Cached = false
+	}
+	// Results come back from the cache as they would from a worker, in
+	// their JSON form
+	want, err := json.Marshal(first.Results)
+	require.NoError(t, err)
+	got, err := json.Marshal(second.Results)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(want), string(got))
+	assert.Equal(t, 1, second.Failed)
+
+	// A changed module runs again
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.wasm"), []byte("a2"), 0o644))
+	report, err := runFuzzerWithMatrix(dir, envs, opts)
+	require.NoError(t, err)
+	assert.Equal(t, &CacheSummary{Hits: 1, Misses: 1}, report.Cache)
+
+	// So does every module under a changed config
+	changed := opts
+	changed.Invocation.Entry = "run"
+	report, err = runFuzzerWithMatrix(dir, envs, changed)
+	require.NoError(t, err)
+	assert.Equal(t, &CacheSummary{Misses: 2}, report.Cache)
+
+	// And under another environment
+	report, err = runFuzzerWithMatrix(dir, []environmentRuntime{{Environment: Environment{Name: "simd", Proposals: []string{"simd"}}, Runtime: runtime}}, opts)
+	require.NoError(t, err)
+	assert.Equal(t, &CacheSummary{Misses: 2}, report.Cache)
+
+	// Options acting on the campaign as a whole keep the cache
+	unchanged := opts
+	unchanged.MaxFailures = 10
+	report, err = runFuzzerWithMatrix(dir, envs, unchanged)
+	require.NoError(t, err)
+	assert.Equal(t, &CacheSummary{Hits: 2}, report.Cache)
+}
+
+func TestCache_KeepsRedactedResults(t *testing.T) {
+	t.Setenv("WF_CACHE_TOKEN", "s3cr3t-token")
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.wasm"), []byte("a"), 0o644))
+	runtime := &MockWasmRuntime{LoadModuleFunc: func(string) (WasmModule, error) {
+		return nil, errors.New("auth failed with s3cr3t-token")
+	}}
+	cacheDir := filepath.Join(t.TempDir(), "cache")
+	opts := RunOptions{
+		Cache:     CacheConfig{Dir: cacheDir},
+		Redaction: RedactionConfig{Env: []string{"WF_CACHE_TOKEN"}, Originals: filepath.Join(t.TempDir(), "originals")},
+	}
+
+	report, err := runFuzzerWithMatrix(dir, []environmentRuntime{{Runtime: runtime}}, opts)
+	require.NoError(t, err)
+	assert.Equal(t, "load failed: auth failed with $WF_CACHE_TOKEN", report.Results[0].ErrorMessage)
+
+	entries, err := os.ReadDir(cacheDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	data, err := os.ReadFile(filepath.Join(cacheDir, entries[0].Name()))
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "s3cr3t-token")
+	assert.Contains(t, string(data), "$WF_CACHE_TOKEN")
+
+	report, err = runFuzzerWithMatrix(dir, []environmentRuntime{{Runtime: runtime}}, opts)
+	require.NoError(t, err)
+	assert.Equal(t, &CacheSummary{Hits: 1}, report.Cache)
+	assert.NotContains(t, report.Results[0].ErrorMessage, "s3cr3t-token")
+}
+
+func TestCache_RefreshRunsEveryFile(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.wasm"), []byte("a"), 0o644))
+	loads := 0
+	runtime := &MockWasmRuntime{LoadModuleFunc: func(string) (WasmModule, error) {
+		loads++
+		return &MockWasmModule{}, nil
+	}}
+	envs := []environmentRuntime{{Runtime: runtime}}
+	opts := RunOptions{Cache: CacheConfig{Dir: t.TempDir()}}
+
+	_, err := runFuzzerWithMatrix(dir, envs, opts)
+	require.NoError(t, err)
+	opts.Cache.Refresh = true
+	report, err := runFuzzerWithMatrix(dir, envs, opts)
+	require.NoError(t, err)
+	assert.Equal(t, 2, loads)
+	assert.Equal(t, &CacheSummary{Misses: 1}, report.Cache)
+	assert.False(t, report.Results[0].Cached)
+
+	// Without a cache directory, nothing is cached or reported
+	report, err = runFuzzerWithRuntime(dir, runtime)
+	require.NoError(t, err)
+	assert.Nil(t, report.Cache)
+}
+
+func TestCache_NoCacheFlag(t *testing.T) {
+	command, ok := parseFuzzCommand([]string{"--no-cache", t.TempDir()})
+	require.True(t, ok)
+	config := Config{Cache: CacheConfig{Dir: "cache"}}
+	command.apply(&config)
+	assert.True(t, config.Cache.Refresh)
+	assert.Equal(t, "cache", config.runOptions().Cache.Dir)
+}
+
+func TestCache_KeysOnBuildsAndReferencedFiles(t *testing.T) {
+	dir := t.TempDir()
+	module := filepath.Join(dir, "a.wasm")
+	require.NoError(t, os.WriteFile(module, []byte("a"), 0o644))
+	inputs := t.TempDir()
+	payload := filepath.Join(inputs, "payload.bin")
+	require.NoError(t, os.WriteFile(payload, []byte("one"), 0o644))
+	annotations := filepath.Join(inputs, "args.yaml")
+	require.NoError(t, os.WriteFile(annotations, []byte("{}\n"), 0o644))
+	runtime := &MockWasmRuntime{}
+	envs := []environmentRuntime{{Runtime: runtime}}
+	opts := RunOptions{Cache: CacheConfig{Dir: filepath.Join(t.TempDir(), "cache")}}
+	opts.Invocation.Annotations = annotations
+	opts.Invocation.Inputs = []InvocationInput{{{Type: "file", Value: payload}}}
+	run := func() *CacheSummary {
+		report, err := runFuzzerWithMatrix(dir, envs, opts)
+		require.NoError(t, err)
+		return report.Cache
+	}
+	miss := &CacheSummary{Misses: 1}
+
+	assert.Equal(t, miss, run())
+	assert.Equal(t, &CacheSummary{Hits: 1}, run())
+
+	require.NoError(t, os.WriteFile(payload, []byte("two"), 0o644))
+	assert.Equal(t, miss, run(), "an edited payload file runs the module again")
+	require.NoError(t, os.WriteFile(annotations, []byte("process: {}\n"), 0o644))
+	assert.Equal(t, miss, run(), "so do edited annotations")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.wit"), []byte("package a:b;\n"), 0o644))
+	assert.Equal(t, miss, run(), "and a new WIT file next to the module")
+
+	originalRuntime, originalBuild := runtimeVersion, fuzzerBuild
+	t.Cleanup(func() { runtimeVersion, fuzzerBuild = originalRuntime, originalBuild })
+	runtimeVersion = func() string { return "0.14.0" }
+	assert.Equal(t, miss, run(), "results of another runtime are not reused")
+	fuzzerBuild = func() string { return "v2.0.0 abc123" }
+	assert.Equal(t, miss, run(), "nor those of another build of the fuzzer")
+	assert.Equal(t, &CacheSummary{Hits: 1}, run())
+}
@@ -0,0 +1,504 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// maxFlatResults is the canonical ABI's limit on flattened results; larger
+// results are stored in memory and returned as a pointer
+const maxFlatResults = 1
+
+// witDiscriminantSize is the byte size of a variant's case index
+func witDiscriminantSize(cases int) uint32 {
+	switch {
+	case cases <= 1<<8:
+		return 1
+	case cases <= 1<<16:
+		return 2
+	}
+	return 4
+}
+
+// witFlagsSize is the byte size of a flags value
+func witFlagsSize(flags int) uint32 {
+	switch {
+	case flags == 0:
+		return 0
+	case flags <= 8:
+		return 1
+	case flags <= 16:
+		return 2
+	}
+	return 4 * uint32((flags+31)/32)
+}
+
+// alignTo rounds offset up to a multiple of align
+func alignTo(offset, align uint32) uint32 {
+	return (offset + align - 1) / align * align
+}
+
+// witAlign is the alignment of a type stored in linear memory
+func witAlign(t *witType) uint32 {
+	switch t.Kind {
+	case witBool, witS8, witU8:
+		return 1
+	case witS16, witU16:
+		return 2
+	case witS32, witU32, witF32, witChar, witString, witList:
+		return 4
+	case witS64, witU64, witF64:
+		return 8
+	case witRecord, witTuple:
+		align := uint32(1)
+		for _, field := range t.Fields {
+			if a := witAlign(field.Type); a > align {
+				align = a
+			}
+		}
+		return align
+	case witFlags:
+		if size := witFlagsSize(len(t.Flags)); size > 0 && size < 4 {
+			return size
+		}
+		return 4
+	}
+	// Variant-like types
+	align := witDiscriminantSize(len(t.Cases))
+	if a := witMaxCaseAlign(t); a > align {
+		align = a
+	}
+	return align
+}
+
+// witMaxCaseAlign is the largest alignment of a variant's payloads
+func witMaxCaseAlign(t *witType) uint32 {
+	align := uint32(1)
+	for _, c := range t.Cases {
+		if c.Type != nil {
+			if a := witAlign(c.Type); a > align {
+				align = a
+			}
+		}
+	}
+	return align
+}
+
+// witSize is the byte size of a type stored in linear memory
+func witSize(t *witType) uint32 {
+	switch t.Kind {
+	case witBool, witS8, witU8:
+		return 1
+	case witS16, witU16:
+		return 2
+	case witS32, witU32, witF32, witChar:
+		return 4
+	case witS64, witU64, witF64, witString, witList:
+		return 8
+	case witRecord, witTuple:
+		var size uint32
+		for _, field := range t.Fields {
+			size = alignTo(size, witAlign(field.Type)) + witSize(field.Type)
+		}
+		return alignTo(size, witAlign(t))
+	case witFlags:
+		return witFlagsSize(len(t.Flags))
+	}
+	size := alignTo(witDiscriminantSize(len(t.Cases)), witMaxCaseAlign(t))
+	var payload uint32
+	for _, c := range t.Cases {
+		if c.Type != nil && witSize(c.Type) > payload {
+			payload = witSize(c.Type)
+		}
+	}
+	return alignTo(size+payload, witAlign(t))
+}
+
+// witFlat is the core parameter types a value is flattened to
+func witFlat(t *witType) []string {
+	switch t.Kind {
+	case witBool, witS8, witU8, witS16, witU16, witS32, witU32, witChar:
+		return []string{"i32"}
+	case witS64, witU64:
+		return []string{"i64"}
+	case witF32:
+		return []string{"f32"}
+	case witF64:
+		return []string{"f64"}
+	case witString, witList:
+		return []string{"i32", "i32"}
+	case witRecord, witTuple:
+		flat := []string{}
+		for _, field := range t.Fields {
+			flat = append(flat, witFlat(field.Type)...)
+		}
+		return flat
+	case witFlags:
+		flat := []string{}
+		for i := 0; i < (len(t.Flags)+31)/32; i++ {
+			flat = append(flat, "i32")
+		}
+		return flat
+	}
+
+	// A variant's payload slots are shared by its cases, widening where
+	// their types differ
+	var payload []string
+	for _, c := range t.Cases {
+		if c.Type == nil {
+			continue
+		}
+		for i, flat := range witFlat(c.Type) {
+			if i < len(payload) {
+				payload[i] = joinFlat(payload[i], flat)
+			} else {
+				payload = append(payload, flat)
+			}
+		}
+	}
+	return append([]string{"i32"}, payload...)
+}
+
+// joinFlat is the narrowest core type able to hold both types' bits
+func joinFlat(a, b string) string {
+	if a == b {
+		return a
+	}
+	if (a == "i32" && b == "f32") || (a == "f32" && b == "i32") {
+		return "i32"
+	}
+	return "i64"
+}
+
+// witFunctionFlat returns the core signature a WIT function is lowered to
+func witFunctionFlat(fn *witFunction) FuncSignature {
+	signature := FuncSignature{Params: []string{}, Results: []string{}}
+	for _, param := range fn.Params {
+		signature.Params = append(signature.Params, witFlat(param.Type)...)
+	}
+	if len(signature.Params) > maxFlatParams {
+		signature.Params = []string{"i32"}
+	}
+	for _, result := range fn.Results {
+		signature.Results = append(signature.Results, witFlat(result)...)
+	}
+	if len(signature.Results) > maxFlatResults {
+		signature.Results = []string{"i32"}
+	}
+	return signature
+}
+
+// witNeedsMemory reports whether lowering a function's parameters writes
+// to guest memory
+func witNeedsMemory(fn *witFunction) bool {
+	var flat int
+	for _, param := range fn.Params {
+		if witHasPointers(param.Type) {
+			return true
+		}
+		flat += len(witFlat(param.Type))
+	}
+	return flat > maxFlatParams
+}
+
+// witHasPointers reports whether a type contains strings or lists
+func witHasPointers(t *witType) bool {
+	switch t.Kind {
+	case witString, witList:
+		return true
+	}
+	for _, field := range t.Fields {
+		if witHasPointers(field.Type) {
+			return true
+		}
+	}
+	for _, c := range t.Cases {
+		if c.Type != nil && witHasPointers(c.Type) {
+			return true
+		}
+	}
+	return false
+}
+
+// canonicalLowering writes WIT values into guest memory as the component
+// model's canonical ABI lays them out, allocating with cabi_realloc
+type canonicalLowering struct {
+	memory *guestMemory
+}
+
+// lowerParams converts a function's arguments into core call arguments.
+// Beyond maxFlatParams the arguments are stored as a tuple in memory and
+// passed by pointer.
+func (l *canonicalLowering) lowerParams(fn *witFunction, args []witArg) ([]interface{}, error) {
+	var flat []interface{}
+	var flatTypes int
+	for _, arg := range args {
+		flatTypes += len(witFlat(arg.Type))
+	}
+	if flatTypes <= maxFlatParams {
+		for i, arg := range args {
+			values, err := l.lowerFlat(arg.Type, arg.Value)
+			if err != nil {
+				return nil, fmt.Errorf("argument %d (%s): %w", i, fn.Params[i].Name, err)
+			}
+			flat = append(flat, values...)
+		}
+		return flat, nil
+	}
+
+	tuple := &witType{Kind: witTuple}
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		tuple.Fields = append(tuple.Fields, witField{Name: fn.Params[i].Name, Type: arg.Type})
+		values[i] = arg.Value
+	}
+	ptr, err := l.storeNew(tuple, values)
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{int32(ptr)}, nil
+}
+
+// lowerFlat converts a value into its flattened core values
+func (l *canonicalLowering) lowerFlat(t *witType, v interface{}) ([]interface{}, error) {
+	switch t.Kind {
+	case witBool:
+		if v.(bool) {
+			return []interface{}{int32(1)}, nil
+		}
+		return []interface{}{int32(0)}, nil
+	case witS8, witS16, witS32:
+		return []interface{}{int32(v.(int64))}, nil
+	case witU8, witU16, witU32:
+		return []interface{}{int32(uint32(v.(uint64)))}, nil
+	case witS64:
+		return []interface{}{v.(int64)}, nil
+	case witU64:
+		return []interface{}{int64(v.(uint64))}, nil
+	case witF32, witF64:
+		return []interface{}{v}, nil
+	case witChar:
+		return []interface{}{int32(v.(rune))}, nil
+	case witString, witList:
+		ptr, length, err := l.storeBuffer(t, v)
+		if err != nil {
+			return nil, err
+		}
+		return []interface{}{int32(ptr), int32(length)}, nil
+	case witRecord, witTuple:
+		var flat []interface{}
+		for i, field := range t.Fields {
+			values, err := l.lowerFlat(field.Type, v.([]interface{})[i])
+			if err != nil {
+				return nil, err
+			}
+			flat = append(flat, values...)
+		}
+		return flat, nil
+	case witFlags:
+		var flat []interface{}
+		for i, b := range packFlags(v.([]bool)) {
+			if i%4 == 0 {
+				flat = append(flat, int32(0))
+			}
+			flat[len(flat)-1] = flat[len(flat)-1].(int32) | int32(b)<<(8*uint(i%4))
+		}
+		return flat, nil
+	case witResource:
+		return nil, fmt.Errorf("resource values are not supported")
+	}
+
+	// Variant-like: the case index, then the payload widened to the shared
+	// slot types and zero-padded
+	value := v.(witCaseValue)
+	slots := witFlat(t)[1:]
+	flat := []interface{}{int32(value.Case)}
+	var payload []interface{}
+	var payloadTypes []string
+	if c := t.Cases[value.Case]; c.Type != nil {
+		var err error
+		if payload, err = l.lowerFlat(c.Type, value.Payload); err != nil {
+			return nil, err
+		}
+		payloadTypes = witFlat(c.Type)
+	}
+	for i, slot := range slots {
+		if i < len(payload) {
+			flat = append(flat, widenFlat(payload[i], payloadTypes[i], slot))
+		} else {
+			flat = append(flat, zeroFlat(slot))
+		}
+	}
+	return flat, nil
+}
+
+// widenFlat reinterprets a core value as a wider shared slot type
+func widenFlat(v interface{}, from, to string) interface{} {
+	if from == to {
+		return v
+	}
+	switch from + "->" + to {
+	case "f32->i32":
+		return int32(math.Float32bits(v.(float32)))
+	case "i32->i64":
+		return int64(uint32(v.(int32)))
+	case "f32->i64":
+		return int64(math.Float32bits(v.(float32)))
+	case "f64->i64":
+		return int64(math.Float64bits(v.(float64)))
+	}
+	return v
+}
+
+// zeroFlat is the zero value of a core type
+func zeroFlat(valType string) interface{} {
+	switch valType {
+	case "i64":
+		return int64(0)
+	case "f32":
+		return float32(0)
+	case "f64":
+		return float64(0)
+	}
+	return int32(0)
+}
+
+// packFlags packs flags into bytes, least significant bit first
+func packFlags(flags []bool) []byte {
+	packed := make([]byte, (len(flags)+7)/8)
+	for i, on := range flags {
+		if on {
+			packed[i/8] |= 1 << uint(i%8)
+		}
+	}
+	return packed
+}
+
+// storeBuffer writes a string or list into newly allocated memory and
+// returns its address and length in code units or elements
+func (l *canonicalLowering) storeBuffer(t *witType, v interface{}) (uint32, uint32, error) {
+	if t.Kind == witString {
+		s := v.(string)
+		ptr, err := l.alloc(uint32(len(s)), 1)
+		if err != nil {
+			return 0, 0, err
+		}
+		return ptr, uint32(len(s)), l.memory.Write(ptr, []byte(s))
+	}
+
+	elems := v.([]interface{})
+	size := witSize(t.Elem)
+	buf := make([]byte, size*uint32(len(elems)))
+	for i, elem := range elems {
+		if err := l.store(buf[uint32(i)*size:], t.Elem, elem); err != nil {
+			return 0, 0, err
+		}
+	}
+	ptr, err := l.alloc(uint32(len(buf)), witAlign(t.Elem))
+	if err != nil {
+		return 0, 0, err
+	}
+	return ptr, uint32(len(elems)), l.memory.Write(ptr, buf)
+}
+
+// storeNew writes a value into newly allocated memory
+func (l *canonicalLowering) storeNew(t *witType, v interface{}) (uint32, error) {
+	buf := make([]byte, witSize(t))
+	if err := l.store(buf, t, v); err != nil {
+		return 0, err
+	}
+	ptr, err := l.alloc(uint32(len(buf)), witAlign(t))
+	if err != nil {
+		return 0, err
+	}
+	return ptr, l.memory.Write(ptr, buf)
+}
+
+func (l *canonicalLowering) alloc(size, align uint32) (uint32, error) {
+	ptr, err := l.memory.Alloc(size, align)
+	if err == nil && ptr%align != 0 {
+		return 0, fmt.Errorf("cabi_realloc returned 0x%x, which is not %d-byte aligned", ptr, align)
+	}
+	return ptr, err
+}
+
+// store encodes a value into buf, which holds at least witSize(t) bytes.
+// Strings and lists inside it are allocated separately and referenced.
+func (l *canonicalLowering) store(buf []byte, t *witType, v interface{}) error {
+	le := binary.LittleEndian
+	switch t.Kind {
+	case witBool:
+		if v.(bool) {
+			buf[0] = 1
+		}
+	case witS8:
+		buf[0] = byte(v.(int64))
+	case witU8:
+		buf[0] = byte(v.(uint64))
+	case witS16:
+		le.PutUint16(buf, uint16(v.(int64)))
+	case witU16:
+		le.PutUint16(buf, uint16(v.(uint64)))
+	case witS32:
+		le.PutUint32(buf, uint32(v.(int64)))
+	case witU32:
+		le.PutUint32(buf, uint32(v.(uint64)))
+	case witS64:
+		le.PutUint64(buf, uint64(v.(int64)))
+	case witU64:
+		le.PutUint64(buf, v.(uint64))
+	case witF32:
+		le.PutUint32(buf, math.Float32bits(v.(float32)))
+	case witF64:
+		le.PutUint64(buf, math.Float64bits(v.(float64)))
+	case witChar:
+		le.PutUint32(buf, uint32(v.(rune)))
+	case witString, witList:
+		ptr, length, err := l.storeBuffer(t, v)
+		if err != nil {
+			return err
+		}
+		le.PutUint32(buf, ptr)
+		le.PutUint32(buf[4:], length)
+	case witRecord, witTuple:
+		var offset uint32
+		for i, field := range t.Fields {
+			offset = alignTo(offset, witAlign(field.Type))
+			if err := l.store(buf[offset:], field.Type, v.([]interface{})[i]); err != nil {
+				return err
+			}
+			offset += witSize(field.Type)
+		}
+	case witFlags:
+		copy(buf, packFlags(v.([]bool)))
+	case witResource:
+		return fmt.Errorf("resource values are not supported")
+	default:
+		value := v.(witCaseValue)
+		discriminant := witDiscriminantSize(len(t.Cases))
+		switch discriminant {
+		case 1:
+			buf[0] = byte(value.Case)
+		case 2:
+			le.PutUint16(buf, uint16(value.Case))
+		default:
+			le.PutUint32(buf, uint32(value.Case))
+		}
+		if c := t.Cases[value.Case]; c.Type != nil {
+			return l.store(buf[alignTo(discriminant, witMaxCaseAlign(t)):], c.Type, value.Payload)
+		}
+	}
+	return nil
+}
+
+// checkWITSignature verifies that the core export matches the lowering of
+// its WIT declaration, so values are not passed to a mismatched function
+func checkWITSignature(fn *witFunction, entry string, core FuncSignature) error {
+	flat := witFunctionFlat(fn)
+	if strings.Join(flat.Params, ",") == strings.Join(core.Params, ",") && strings.Join(flat.Results, ",") == strings.Join(core.Results, ",") {
+		return nil
+	}
+	return fmt.Errorf("WIT type %s lowers to %s, but '%s' has signature %s", fn, flat, entry, core)
+}
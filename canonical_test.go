@@ -0,0 +1,137 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// witParam parses the type of a single-parameter WIT function
+func witParam(t *testing.T, decls, typ string) *witType {
+	doc, err := parseWIT("interface i { " + decls + " f: func(x: " + typ + "); }")
+	require.NoError(t, err)
+	fn, err := doc.function("f")
+	require.NoError(t, err)
+	return fn.Params[0].Type
+}
+
+// -----------------------------------------------------------------------------
+// TEST: Canonical ABI Lowering
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// The guest's generated bindings read arguments exactly as the canonical ABI
+// lays them out. An off-by-one alignment or a wrongly widened variant slot
+// makes the guest decode garbage, and every failure found that way is a
+// harness bug rather than a module bug.
+// -----------------------------------------------------------------------------
+
+func TestCanonical_LayoutAndFlattening(t *testing.T) {
+	tests := []struct {
+		decls, typ  string
+		size, align uint32
+		flat        []string
+	}{
+		{"", "bool", 1, 1, []string{"i32"}},
+		{"", "u64", 8, 8, []string{"i64"}},
+		{"", "string", 8, 4, []string{"i32", "i32"}},
+		{"record r { a: u8, b: u32 }", "r", 8, 4, []string{"i32", "i32"}},
+		{"", "tuple<u8, u64, u8>", 24, 8, []string{"i32", "i64", "i32"}},
+		{"", "option<u64>", 16, 8, []string{"i32", "i64"}},
+		{"", "result<u32, f32>", 8, 4, []string{"i32", "i32"}},
+		{"variant v { a(u32), b(f64), c }", "v", 16, 8, []string{"i32", "i64"}},
+		{"variant v { a(f32), b(f32) }", "v", 8, 4, []string{"i32", "f32"}},
+		{"enum e { a, b, c }", "e", 1, 1, []string{"i32"}},
+		{"flags f { a, b, c, d, e, f, g, h, i, j }", "f", 2, 2, []string{"i32"}},
+		{"record p { x: u16, y: string }", "list<p>", 8, 4, []string{"i32", "i32"}},
+	}
+
+	for _, tt := range tests {
+		typ := witParam(t, tt.decls, tt.typ)
+		assert.Equal(t, tt.size, witSize(typ), tt.typ)
+		assert.Equal(t, tt.align, witAlign(typ), tt.typ)
+		assert.Equal(t, tt.flat, witFlat(typ), tt.typ)
+	}
+
+	elem := witParam(t, "record p { x: u16, y: string }", "p")
+	assert.Equal(t, uint32(12), witSize(elem), "the string is aligned after the u16")
+}
+
+func TestCanonical_LowersVariantsIntoSharedSlots(t *testing.T) {
+	l := &canonicalLowering{}
+
+	result := witParam(t, "", "result<u32, f32>")
+	flat, err := l.lowerFlat(result, witCaseValue{Case: 1, Payload: float32(1.5)})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{int32(1), int32(math.Float32bits(1.5))}, flat, "f32 payloads are reinterpreted in an i32 slot")
+
+	variant := witParam(t, "variant v { a(u32), b(f64), c }", "v")
+	flat, err = l.lowerFlat(variant, witCaseValue{Case: 0, Payload: uint64(0xffffffff)})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{int32(0), int64(0xffffffff)}, flat, "i32 payloads are zero-extended into i64 slots")
+
+	flat, err = l.lowerFlat(variant, witCaseValue{Case: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{int32(2), int64(0)}, flat, "unused slots are zero")
+
+	flags := witParam(t, "flags f { a, b, c, d, e, f, g, h, i, j }", "f")
+	flat, err = l.lowerFlat(flags, []bool{true, false, false, false, false, false, false, false, false, true})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{int32(0x201)}, flat)
+
+	signed := witParam(t, "", "s8")
+	flat, err = l.lowerFlat(signed, int64(-1))
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{int32(-1)}, flat)
+}
+
+func TestCanonical_StoresNestedValues(t *testing.T) {
+	module := witMemoryModule(nil)
+	memory, err := newGuestMemory(module, MemoryConfig{Allocator: AllocatorCanonicalABI})
+	require.NoError(t, err)
+	l := &canonicalLowering{memory: memory}
+
+	typ := witParam(t, "record p { x: u16, y: string }", "list<option<p>>")
+	value := []interface{}{
+		witCaseValue{Case: 1, Payload: []interface{}{uint64(7), "hi"}},
+		witCaseValue{Case: 0},
+	}
+	flat, err := l.lowerFlat(typ, value)
+	require.NoError(t, err)
+
+	// The strings are stored while encoding the list, so they come first
+	assert.Equal(t, []interface{}{int32(1028), int32(2)}, flat)
+	assert.Equal(t, "hi", string(module.memory[1024:1026]))
+	assert.Equal(t, []byte{
+		1, 0, 0, 0, 7, 0, 0, 0, 0x00, 0x04, 0, 0, 2, 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	}, module.memory[1028:1060])
+}
+
+func TestCanonical_SpillsManyParamsToMemory(t *testing.T) {
+	module := witMemoryModule(nil)
+	memory, err := newGuestMemory(module, MemoryConfig{Allocator: AllocatorCanonicalABI})
+	require.NoError(t, err)
+	l := &canonicalLowering{memory: memory}
+
+	fn := &witFunction{Name: "wide"}
+	var args []witArg
+	for i := 0; i < 17; i++ {
+		fn.Params = append(fn.Params, witField{Name: "p", Type: &witType{Kind: witU32}})
+		args = append(args, witArg{Type: fn.Params[i].Type, Value: uint64(i)})
+	}
+	assert.Equal(t, FuncSignature{Params: []string{"i32"}, Results: []string{}}, witFunctionFlat(fn))
+	assert.True(t, witNeedsMemory(fn))
+
+	flat, err := l.lowerParams(fn, args)
+	require.NoError(t, err)
+
+	assert.Equal(t, []interface{}{int32(1024)}, flat)
+	assert.Equal(t, []interface{}{int32(0), int32(0), int32(4), int32(68)}, module.calls[0])
+	assert.Equal(t, []byte{16, 0, 0, 0}, module.memory[1024+64:1024+68])
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// Chaos faults make a host call fail in one of two ways
+const (
+	// ChaosTrap traps the calling module
+	ChaosTrap = "trap"
+	// ChaosDrop returns zeros without calling the host function
+	ChaosDrop = "drop"
+)
+
+// ChaosConfig varies how often host calls fail over the campaign, so a
+// run starts with a clean baseline and ramps up to heavy fault rates
+type ChaosConfig struct {
+	// Seed makes the faults of every file reproducible
+	Seed int64 `yaml:"seed"`
+	// Imports limits faults to the imports matching "module.name" or
+	// "module.*"; every imported function is faulted by default
+	Imports []string `yaml:"imports"`
+	// Fault is trap, the default, or drop
+	Fault string `yaml:"fault"`
+	// Phases split the campaign's files in order
+	Phases []ChaosPhase `yaml:"phases"`
+}
+
+// ChaosPhase is a run of files faulted at one rate, or at a rate ramping
+// from the first file of the phase to the last
+type ChaosPhase struct {
+	Name string `yaml:"name"`
+	// Share weighs the phase's part of the campaign against the other
+	// phases'; phases without one weigh 1
+	Share float64 `yaml:"share"`
+	// Rate is the probability, from 0 to 1, that a host call fails
+	Rate float64 `yaml:"rate"`
+	// RampTo is the rate the phase's last file is faulted at
+	RampTo *float64 `yaml:"ramp_to"`
+}
+
+// ChaosProfile is the chaos a file was run under
+type ChaosProfile struct {
+	Phase string  `json:"phase"`
+	Rate  float64 `json:"rate"`
+	// Seed reproduces the file's faults
+	Seed int64 `json:"seed"`
+	// Calls counts the host calls open to faults, and Faults those that
+	// failed
+	Calls  int `json:"calls"`
+	Faults int `json:"faults"`
+}
+
+// check rejects schedules that cannot be followed
+func (c ChaosConfig) check() error {
+	if c.Fault != "" && c.Fault != ChaosTrap && c.Fault != ChaosDrop {
+		return fmt.Errorf("chaos: unknown fault %q, expected trap or drop", c.Fault)
+	}
+	for i, phase := range c.Phases {
+		if phase.Share < 0 {
+			return fmt.Errorf("chaos phase %d: share must not be negative", i)
+		}
+		if phase.Rate < 0 || phase.Rate > 1 {
+			return fmt.Errorf("chaos phase %d: rate must be between 0 and 1", i)
+		}
+		if phase.RampTo != nil && (*phase.RampTo < 0 || *phase.RampTo > 1) {
+			return fmt.Errorf("chaos phase %d: ramp_to must be between 0 and 1", i)
+		}
+	}
+	return nil
+}
+
+func (p ChaosPhase) share() float64 {
+	if p.Share == 0 {
+		return 1
+	}
+	return p.Share
+}
+
+// profile returns the chaos the campaign's file at position file, out of
+// files, runs under, or nil without a schedule
+func (c ChaosConfig) profile(file, files int) *ChaosProfile {
+	if len(c.Phases) == 0 {
+		return nil
+	}
+	var total float64
+	for _, phase := range c.Phases {
+		total += phase.share()
+	}
+
+	first, weight := 0, 0.0
+	for i, phase := range c.Phases {
+		weight += phase.share()
+		end := int(math.Round(weight / total * float64(files)))
+		if i == len(c.Phases)-1 {
+			end = files
+		}
+		if file >= end {
+			first = end
+			continue
+		}
+
+		name := phase.Name
+		if name == "" {
+			name = fmt.Sprintf("phase %d", i)
+		}
+		rate := phase.Rate
+		if last := end - 1; phase.RampTo != nil && last > first {
+			rate += (*phase.RampTo - phase.Rate) * float64(file-first) / float64(last-first)
+		}
+		return &ChaosProfile{Phase: name, Rate: rate, Seed: c.Seed + int64(file)}
+	}
+	return nil
+}
+
+// chaosFaults fails the host calls of one file at its profile's rate.
+// Faults carry on from where they were when the module is reloaded
+// between inputs.
+type chaosFaults struct {
+	config  ChaosConfig
+	profile *ChaosProfile
+	rng     *rand.Rand
+}
+
+func newChaosFaults(config ChaosConfig, profile *ChaosProfile) *chaosFaults {
+	return &chaosFaults{config: config, profile: profile, rng: rand.New(rand.NewSource(profile.Seed))}
+}
+
+// faulted reports whether the schedule's faults reach an import
+func (f *chaosFaults) faulted(fn HostFunction) bool {
+	if len(f.config.Imports) == 0 {
+		return true
+	}
+	for _, pattern := range f.config.Imports {
+		if importMatches(pattern, fn) {
+			return true
+		}
+	}
+	return false
+}
+
+// wrap puts the faults in front of host functions
+func (f *chaosFaults) wrap(host []HostFunction) ([]HostFunction, error) {
+	wrapped := make([]HostFunction, len(host))
+	for i, fn := range host {
+		wrapped[i] = fn
+		if f.faulted(fn) {
+			wrapped[i].Call = f.call(fn)
+		}
+	}
+	return wrapped, nil
+}
+
+// call returns the call of a host function open to faults
+func (f *chaosFaults) call(fn HostFunction) func(args []interface{}) ([]interface{}, error) {
+	return func(args []interface{}) ([]interface{}, error) {
+		f.profile.Calls++
+		if f.rng.Float64() >= f.profile.Rate {
+			return fn.Call(args)
+		}
+		f.profile.Faults++
+		if f.config.Fault == ChaosDrop {
+			return zeroResults(fn.Signature)
+		}
+		return nil, fmt.Errorf("chaos fault in %s.%s (%s, rate %.2f)", fn.Module, fn.Name, f.profile.Phase, f.profile.Rate)
+	}
+}
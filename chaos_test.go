@@ -0,0 +1,115 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// -----------------------------------------------------------------------------
+// TEST: Chaos Schedule
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Whether a module copes with failing host calls depends on how often
+// they fail. Running the start of a campaign clean and ramping faults up
+// afterwards separates the failures a module has anyway from those the
+// faults cause, as long as every result says what it ran under.
+// -----------------------------------------------------------------------------
+
+func TestChaos_ProfilesFollowSchedule(t *testing.T) {
+	half := 0.5
+	config := ChaosConfig{Seed: 10, Phases: []ChaosPhase{
+		{Name: "baseline"},
+		{Name: "ramp", Rate: 0.1, RampTo: &half, Share: 3},
+	}}
+
+	var phases []string
+	var rates []float64
+	for file := 0; file < 8; file++ {
+		profile := config.profile(file, 8)
+		require.NotNil(t, profile)
+		phases = append(phases, profile.Phase)
+		rates = append(rates, profile.Rate)
+		assert.Equal(t, int64(10+file), profile.Seed)
+	}
+	assert.Equal(t, []string{"baseline", "baseline", "ramp", "ramp", "ramp", "ramp", "ramp", "ramp"}, phases)
+	assert.InDeltaSlice(t, []float64{0, 0, 0.1, 0.18, 0.26, 0.34, 0.42, 0.5}, rates, 1e-9)
+
+	assert.Nil(t, ChaosConfig{}.profile(0, 8), "no schedule, no chaos")
+	assert.Equal(t, "phase 0", ChaosConfig{Phases: []ChaosPhase{{}}}.profile(0, 1).Phase)
+}
+
+func TestChaos_FaultsHostCalls(t *testing.T) {
+	calls := 0
+	host := []HostFunction{
+		{Module: "env", Name: "log", Signature: funcSig("", "i32"), Call: func([]interface{}) ([]interface{}, error) {
+			calls++
+			return []interface{}{int32(7)}, nil
+		}},
+		{Module: "wasi_snapshot_preview1", Name: "proc_exit", Signature: funcSig("i32", "")},
+	}
+
+	profile := &ChaosProfile{Phase: "storm", Rate: 1}
+	wrapped, err := newChaosFaults(ChaosConfig{Imports: []string{"env.*"}}, profile).wrap(host)
+	require.NoError(t, err)
+	_, err = wrapped[0].Call(nil)
+	assert.EqualError(t, err, "chaos fault in env.log (storm, rate 1.00)")
+	assert.Nil(t, wrapped[1].Call, "imports outside the schedule are linked as they are")
+
+	wrapped, err = newChaosFaults(ChaosConfig{Fault: ChaosDrop}, profile).wrap(host)
+	require.NoError(t, err)
+	results, err := wrapped[0].Call(nil)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{int32(0)}, results)
+	assert.Equal(t, 0, calls, "faulted calls never reach the host")
+
+	calm := &ChaosProfile{Phase: "baseline"}
+	wrapped, err = newChaosFaults(ChaosConfig{}, calm).wrap(host)
+	require.NoError(t, err)
+	results, err = wrapped[0].Call(nil)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{int32(7)}, results)
+	assert.Equal(t, 1, calls)
+
+	assert.Equal(t, 2, profile.Calls)
+	assert.Equal(t, 2, profile.Faults)
+	assert.Equal(t, ChaosProfile{Phase: "baseline", Calls: 1}, *calm)
+}
+
+func TestChaos_AnnotatesResults(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.wasm", "b.wasm"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte{0}, 0o644))
+	}
+	opts := RunOptions{Chaos: ChaosConfig{Phases: []ChaosPhase{{Name: "baseline"}, {Name: "storm", Rate: 0.5}}}}
+	envs := []environmentRuntime{{Runtime: &MockWasmRuntime{}}, {Runtime: &MockWasmRuntime{}}}
+	report, err := runFuzzerWithMatrix(dir, envs, opts)
+	require.NoError(t, err)
+
+	var phases []string
+	for _, result := range report.Results {
+		require.NotNil(t, result.Chaos)
+		phases = append(phases, result.Chaos.Phase)
+	}
+	assert.Equal(t, []string{"baseline", "baseline", "storm", "storm"}, phases, "every environment runs a file under the same chaos")
+}
+
+func TestChaos_RejectsBadSchedule(t *testing.T) {
+	tooHigh := 1.5
+	for config, message := range map[*ChaosConfig]string{
+		{Fault: "explode"}:                             `chaos: unknown fault "explode", expected trap or drop`,
+		{Phases: []ChaosPhase{{Rate: -0.1}}}:           "chaos phase 0: rate must be between 0 and 1",
+		{Phases: []ChaosPhase{{}, {RampTo: &tooHigh}}}: "chaos phase 1: ramp_to must be between 0 and 1",
+		{Phases: []ChaosPhase{{Share: -1}}}:            "chaos phase 0: share must not be negative",
+	} {
+		_, err := runFuzzerWithMatrix(t.TempDir(), nil, RunOptions{Chaos: *config})
+		assert.EqualError(t, err, message)
+	}
+}
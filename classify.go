@@ -0,0 +1,286 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Severity ranks how urgently a failure needs triage
+type Severity string
+
+const (
+	SeverityInfo     Severity = "info"
+	SeverityLow      Severity = "low"
+	SeverityMedium   Severity = "medium"
+	SeverityHigh     Severity = "high"
+	SeverityCritical Severity = "critical"
+	// SeveritySecurity marks failures the security heuristics suspect of
+	// being runtime bugs an attacker's module could exploit. Only the
+	// heuristics assign it.
+	SeveritySecurity Severity = "security"
+)
+
+// knownSeverities are the severities classifications may have
+var knownSeverities = map[Severity]bool{
+	SeverityInfo: true, SeverityLow: true, SeverityMedium: true, SeverityHigh: true, SeverityCritical: true,
+}
+
+// FailureInfo is what classifiers see of a failed file
+type FailureInfo struct {
+	FilePath string
+	Stage    FailureStage
+	SubStage string
+	Message  string
+	// Trap is the kind of WASM trap the message reports, such as
+	// "unreachable", or empty when the failure is not a trap
+	Trap string
+	// Crash describes the crash of an isolated worker, if it crashed
+	Crash *CrashInfo
+}
+
+// Classification buckets a failure for triage. Failures with the same
+// signature are taken to be the same bug.
+type Classification struct {
+	Signature string   `json:"signature"`
+	Severity  Severity `json:"severity"`
+	// Classifier names the classifier that bucketed the failure
+	Classifier string `json:"classifier"`
+	// SecurityReason says why the security heuristics elevated the
+	// failure, whatever its classifier ranked it
+	SecurityReason string `json:"security_reason,omitempty"`
+}
+
+// Classifier maps failures to classifications. Classify returns false for
+// failures it has no opinion on, which the next classifier then sees.
+type Classifier interface {
+	Name() string
+	Classify(failure FailureInfo) (Classification, bool)
+}
+
+// registeredClassifiers are consulted after the configured rules and
+// before the default classifier
+var registeredClassifiers []Classifier
+
+// RegisterClassifier adds a classifier to every campaign, so a build can
+// encode its own triage taxonomy. Classifiers registered first are
+// consulted first.
+func RegisterClassifier(c Classifier) {
+	registeredClassifiers = append(registeredClassifiers, c)
+}
+
+// trapSeverities are the traps WASM runtimes report, with how serious
+// each is and their error code. Memory and table violations are the
+// likeliest to be exploitable in a native build of the same code.
+var trapSeverities = []struct {
+	trap     string
+	severity Severity
+	code     ErrorCode
+}{
+	{"out of bounds memory access", SeverityHigh, ErrExecTrapOOB},
+	{"out of bounds table access", SeverityHigh, ErrExecTrapTableOOB},
+	{"indirect call type mismatch", SeverityHigh, ErrExecTrapIndirectCall},
+	{"undefined element", SeverityHigh, ErrExecTrapUndefinedElement},
+	{"uninitialized element", SeverityHigh, ErrExecTrapUninitializedElement},
+	{"call stack exhausted", SeverityMedium, ErrExecStackExhausted},
+	{"integer divide by zero", SeverityMedium, ErrExecTrapDivideByZero},
+	{"integer overflow", SeverityMedium, ErrExecTrapIntegerOverflow},
+	{"invalid conversion to integer", SeverityMedium, ErrExecTrapConversion},
+	{"unreachable", SeverityMedium, ErrExecTrapUnreachable},
+}
+
+// parseTrap returns the trap a failure message reports, if any, in any
+// of the wordings runtime versions have used for it
+func parseTrap(message string) string {
+	lower := strings.ToLower(normalizeMessage(message))
+	for _, known := range trapSeverities {
+		if strings.Contains(lower, known.trap) {
+			return known.trap
+		}
+	}
+	return ""
+}
+
+// volatilePattern matches the parts of a message that change between runs
+// of the same bug: numbers and addresses
+var volatilePattern = regexp.MustCompile(`0x[0-9a-fA-F]+|\d+`)
+
+// maxSignatureMessage caps the message part of default signatures
+const maxSignatureMessage = 120
+
+// defaultClassifier buckets failures by stage and trap, or by their
+// message with numbers masked, and ranks host crashes and hangs above
+// module traps, and those above inputs the runtime rejects
+type defaultClassifier struct{}
+
+func (defaultClassifier) Name() string { return "default" }
+
+func (defaultClassifier) Classify(failure FailureInfo) (Classification, bool) {
+	stage := string(failure.Stage)
+	if failure.SubStage != "" {
+		stage += "/" + failure.SubStage
+	}
+	detail := failure.Trap
+	if detail == "" {
+		detail = volatilePattern.ReplaceAllString(normalizeMessage(failure.Message), "N")
+		if len(detail) > maxSignatureMessage {
+			detail = strings.ToValidUTF8(detail[:maxSignatureMessage], "")
+		}
+	}
+	classification := Classification{Signature: stage + ":" + detail, Classifier: "default"}
+	if failure.Crash != nil {
+		// Crashes are bucketed by how they crashed, wherever they did
+		classification.Signature = failure.Crash.signature()
+	}
+
+	switch {
+	case isHostPanic(ExecutionResult{ErrorMessage: failure.Message}), strings.HasPrefix(failure.Message, "worker died"):
+		classification.Severity = SeverityCritical
+	case failure.SubStage == SubStageHang:
+		classification.Severity = SeverityHigh
+	case failure.Trap != "":
+		for _, known := range trapSeverities {
+			if known.trap == failure.Trap {
+				classification.Severity = known.severity
+			}
+		}
+	case failure.Stage == StageExecute:
+		classification.Severity = SeverityMedium
+	case failure.Stage == StageInstantiate:
+		classification.Severity = SeverityLow
+	default:
+		// Modules the runtime rejects are what a fuzzer expects to find
+		classification.Severity = SeverityInfo
+	}
+	return classification, true
+}
+
+// ClassifierRule is a classifier declared in the campaign config. It
+// matches failures whose message matches Match, in Stage when one is set.
+type ClassifierRule struct {
+	Name      string       `yaml:"name"`
+	Stage     FailureStage `yaml:"stage"`
+	Match     string       `yaml:"match"`
+	Signature string       `yaml:"signature"`
+	Severity  Severity     `yaml:"severity"`
+}
+
+// ruleClassifier is a compiled ClassifierRule
+type ruleClassifier struct {
+	rule  ClassifierRule
+	match *regexp.Regexp
+}
+
+func (c *ruleClassifier) Name() string { return c.rule.Name }
+
+func (c *ruleClassifier) Classify(failure FailureInfo) (Classification, bool) {
+	if c.rule.Stage != "" && c.rule.Stage != failure.Stage {
+		return Classification{}, false
+	}
+	if !c.match.MatchString(failure.Message) {
+		return Classification{}, false
+	}
+	return Classification{Signature: c.rule.Signature, Severity: c.rule.Severity, Classifier: c.rule.Name}, true
+}
+
+// classifierChain consults the configured rules, then the registered
+// classifiers, then the default classifier
+type classifierChain []Classifier
+
+// newClassifierChain compiles the configured rules
+func newClassifierChain(rules []ClassifierRule) (classifierChain, error) {
+	var chain classifierChain
+	for i, rule := range rules {
+		if rule.Name == "" || rule.Signature == "" {
+			return nil, fmt.Errorf("classifier %d: name and signature are required", i)
+		}
+		if !knownSeverities[rule.Severity] {
+			return nil, fmt.Errorf("classifier %q: unknown severity %q", rule.Name, rule.Severity)
+		}
+		match, err := regexp.Compile(rule.Match)
+		if err != nil {
+			return nil, fmt.Errorf("classifier %q: %v", rule.Name, err)
+		}
+		chain = append(chain, &ruleClassifier{rule: rule, match: match})
+	}
+	chain = append(chain, registeredClassifiers...)
+	return append(chain, defaultClassifier{}), nil
+}
+
+// classify buckets a failed result. Passing and skipped files have no
+// classification.
+func (chain classifierChain) classify(result ExecutionResult) *Classification {
+	if result.Success || result.Skipped {
+		return nil
+	}
+	failure := FailureInfo{
+		FilePath: result.FilePath,
+		Stage:    result.FailureStage,
+		SubStage: result.FailureSubStage,
+		Message:  result.ErrorMessage,
+		Trap:     parseTrap(result.ErrorMessage),
+		Crash:    result.Crash,
+	}
+	for _, classifier := range chain {
+		if classification, ok := classifier.Classify(failure); ok {
+			if classification.Classifier == "" {
+				classification.Classifier = classifier.Name()
+			}
+			if reason := securityReason(failure); reason != "" {
+				classification.Severity, classification.SecurityReason = SeveritySecurity, reason
+			}
+			return &classification
+		}
+	}
+	return nil
+}
+
+// countSeverity tallies a failed result's severity in the report
+func countSeverity(report *FuzzingReport, classification *Classification) {
+	if classification == nil {
+		return
+	}
+	if report.SeverityCounts == nil {
+		report.SeverityCounts = make(map[Severity]int)
+	}
+	report.SeverityCounts[classification.Severity]++
+}
+
+// sanitizerMarkers start the reports of the sanitizers a runtime may be
+// built with
+var sanitizerMarkers = []string{
+	"AddressSanitizer",
+	"UndefinedBehaviorSanitizer",
+	"MemorySanitizer",
+	"ThreadSanitizer",
+	"LeakSanitizer",
+}
+
+// crashSignals are the signals of a runtime touching memory it does not
+// own, which a module should never be able to cause
+var crashSignals = []string{"segmentation fault", "bus error"}
+
+// securityReason returns why a failure points at a bug in the runtime or
+// harness rather than the module, or empty when nothing does. Traps are
+// the sandbox doing its job; a host that panics, crashes on a bad access
+// or trips a sanitizer is not.
+func securityReason(failure FailureInfo) string {
+	for _, marker := range sanitizerMarkers {
+		if strings.Contains(failure.Message, marker) {
+			return marker + " report"
+		}
+	}
+	if isHostPanic(ExecutionResult{ErrorMessage: failure.Message}) {
+		return "host panic"
+	}
+	if strings.HasPrefix(failure.Message, "worker died") {
+		for _, signal := range crashSignals {
+			// The worker's exit, or the fault Go or a sanitizer ended in
+			// an abort
+			if strings.Contains(failure.Message, "signal: "+signal) || failure.Crash != nil && failure.Crash.Signal == exitSignals[signal] {
+				return "runtime " + signal + " in the " + string(failure.Stage) + " stage"
+			}
+		}
+	}
+	return ""
+}
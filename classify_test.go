@@ -0,0 +1,158 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// prefixClassifier claims failures whose message has a prefix
+type prefixClassifier struct {
+	prefix string
+}
+
+func (c prefixClassifier) Name() string { return "prefix" }
+
+func (c prefixClassifier) Classify(failure FailureInfo) (Classification, bool) {
+	if !strings.HasPrefix(failure.Message, c.prefix) {
+		return Classification{}, false
+	}
+	return Classification{Signature: "prefixed", Severity: SeverityLow}, true
+}
+
+// -----------------------------------------------------------------------------
+// TEST: Failure Classifiers
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// A campaign finds the same bug thousands of times, with addresses and
+// sizes that differ on every run. Triage needs each failure bucketed and
+// ranked, and every organization ranks by its own taxonomy; encoding it
+// must not mean forking the fuzzer.
+// -----------------------------------------------------------------------------
+
+func TestClassify_Default(t *testing.T) {
+	chain, err := newClassifierChain(nil)
+	require.NoError(t, err)
+	classify := func(stage FailureStage, subStage, message string) Classification {
+		c := chain.classify(ExecutionResult{FailureStage: stage, FailureSubStage: subStage, ErrorMessage: message})
+		require.NotNil(t, c)
+		return *c
+	}
+
+	oob := classify(StageExecute, "", "execution failed: out of bounds memory access at 0x1f00")
+	assert.Equal(t, Classification{Signature: "execute:out of bounds memory access", Severity: SeverityHigh, Classifier: "default"}, oob)
+	assert.Equal(t, oob, classify(StageExecute, "", "execution failed: out of bounds memory access at 0x2a"), "addresses do not split buckets")
+
+	assert.Equal(t, SeverityMedium, classify(StageExecute, "", "execution failed: unreachable").Severity)
+	assert.Equal(t, SeverityCritical, classify(StageLoad, "", "worker died in the load stage: exit status 2").Severity)
+
+	hang := classify(StageInstantiate, SubStageHang, "no progress for 30s in the instantiate stage, worker killed")
+	assert.Equal(t, "instantiate/hang:no progress for Ns in the instantiate stage, worker killed", hang.Signature)
+	assert.Equal(t, SeverityHigh, hang.Severity)
+
+	assert.Equal(t, SeverityLow, classify(StageInstantiate, "", "unknown import env.f").Severity)
+	assert.Equal(t, SeverityInfo, classify(StageValidate, "", "validation failed: type mismatch").Severity)
+
+	assert.Nil(t, chain.classify(ExecutionResult{Success: true}))
+	assert.Nil(t, chain.classify(ExecutionResult{Skipped: true}))
+}
+
+func TestClassify_RulesAndRegistered(t *testing.T) {
+	original := registeredClassifiers
+	t.Cleanup(func() { registeredClassifiers = original })
+	RegisterClassifier(prefixClassifier{prefix: "setup"})
+
+	chain, err := newClassifierChain([]ClassifierRule{
+		{Name: "oom", Stage: StageExecute, Match: `memory allocation of \d+ bytes failed`, Signature: "oom", Severity: SeverityLow},
+	})
+	require.NoError(t, err)
+
+	oom := chain.classify(ExecutionResult{FailureStage: StageExecute, ErrorMessage: "memory allocation of 65536 bytes failed"})
+	assert.Equal(t, &Classification{Signature: "oom", Severity: SeverityLow, Classifier: "oom"}, oom)
+	other := chain.classify(ExecutionResult{FailureStage: StageInstantiate, ErrorMessage: "memory allocation of 65536 bytes failed"})
+	assert.Equal(t, "default", other.Classifier, "rules only match their stage")
+
+	setup := chain.classify(ExecutionResult{FailureStage: StageExecute, ErrorMessage: "setup 'init' failed: unreachable"})
+	assert.Equal(t, &Classification{Signature: "prefixed", Severity: SeverityLow, Classifier: "prefix"}, setup)
+
+	_, err = newClassifierChain([]ClassifierRule{{Name: "x", Match: "(", Signature: "x", Severity: SeverityLow}})
+	assert.Error(t, err)
+	_, err = newClassifierChain([]ClassifierRule{{Name: "x", Signature: "x", Severity: "urgent"}})
+	assert.EqualError(t, err, `classifier "x": unknown severity "urgent"`)
+}
+
+func TestClassify_AppliedToCampaign(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.wasm"), []byte{0}, 0o644))
+	runtime := &MockWasmRuntime{LoadModuleFunc: func(filePath string) (WasmModule, error) {
+		return nil, &RuntimeError{Stage: StageLoad, Message: "cannot read " + filePath}
+	}}
+
+	report, err := runFuzzerWithMatrix(dir, []environmentRuntime{{Runtime: runtime}}, RunOptions{
+		Redaction:   RedactionConfig{Paths: true},
+		Classifiers: []ClassifierRule{{Name: "unreadable", Match: "^cannot read /", Signature: "read " + dir, Severity: SeverityInfo}},
+	})
+	require.NoError(t, err)
+	require.Len(t, report.Results, 1)
+	classification := report.Results[0].Classification
+	require.NotNil(t, classification, "rules see the message before redaction")
+	assert.Equal(t, "unreadable", classification.Classifier)
+	assert.Equal(t, "read <path>/"+filepath.Base(dir), classification.Signature, "signatures are redacted too")
+}
+
+func TestClassify_SecurityHeuristics(t *testing.T) {
+	chain, err := newClassifierChain([]ClassifierRule{{Name: "everything", Match: "", Signature: "benign", Severity: SeverityInfo}})
+	require.NoError(t, err)
+	classify := func(stage FailureStage, message string) Classification {
+		c := chain.classify(ExecutionResult{FailureStage: stage, ErrorMessage: message})
+		require.NotNil(t, c)
+		return *c
+	}
+
+	panicked := classify(StageExecute, "panic recovered: index out of range")
+	assert.Equal(t, SeveritySecurity, panicked.Severity, "heuristics override every classifier")
+	assert.Equal(t, "host panic", panicked.SecurityReason)
+	assert.Equal(t, "benign", panicked.Signature, "the bucket is kept")
+
+	crashed := classify(StageExecute, "worker died in the execute stage: signal: segmentation fault (core dumped)")
+	assert.Equal(t, "runtime segmentation fault in the execute stage", crashed.SecurityReason)
+	sanitized := classify(StageInstantiate, "==12==ERROR: AddressSanitizer: heap-buffer-overflow on address 0x6020")
+	assert.Equal(t, "AddressSanitizer report", sanitized.SecurityReason)
+
+	for _, message := range []string{
+		"execution failed: out of bounds memory access",
+		"worker died in the execute stage: signal: killed",
+		"execution failed: host function 'read' failed: 8-byte access at 0x10000 is out of bounds",
+	} {
+		assert.Equal(t, SeverityInfo, classify(StageExecute, message).Severity, message)
+	}
+}
+
+func TestClassify_SeverityCounts(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.wasm", "b.wasm", "c.wasm"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte{0}, 0o644))
+	}
+	runtime := &MockWasmRuntime{LoadModuleFunc: func(filePath string) (WasmModule, error) {
+		if strings.HasSuffix(filePath, "c.wasm") {
+			return &MockWasmModule{}, nil
+		}
+		panic("nil pointer dereference")
+	}}
+
+	report, err := runFuzzerWithMatrix(dir, []environmentRuntime{{Runtime: runtime}}, RunOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, map[Severity]int{SeveritySecurity: 2}, report.SeverityCounts)
+	assert.Empty(t, validateReport(report))
+
+	report.SeverityCounts = nil
+	assert.Contains(t, validateReport(report), "severity_counts[security] is 0 but 2 failed results have that severity")
+}
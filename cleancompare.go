@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// InjectionEffect compares a file's run with injections to its clean run.
+// A failure in both is the module's own; the differences are the effect of
+// the injections.
+type InjectionEffect struct {
+	// CleanStage and CleanError are the outcome of the clean run
+	CleanStage FailureStage `json:"clean_failure_stage"`
+	CleanError string       `json:"clean_error,omitempty"`
+	// Differences describe how the injected run behaved differently
+	Differences []string `json:"differences,omitempty"`
+}
+
+// InjectionDifference lists a file that behaved differently with
+// injections than without
+type InjectionDifference struct {
+	FilePath    string   `json:"file_path"`
+	Environment string   `json:"environment,omitempty"`
+	Differences []string `json:"differences"`
+}
+
+// injects reports whether anything is injected into the files run
+func (o RunOptions) injects() bool {
+	return len(o.DataSegments) > 0 || o.Tamper.enabled() || len(o.Chaos.Phases) > 0 ||
+		len(o.Invocation.Proxies) > 0 || o.Invocation.Log.Fault != "" || o.MemoryPressure.enabled() ||
+		(len(o.Intercept.Functions) > 0 && o.Intercept.TrapOn > 0)
+}
+
+// clean returns the options without injections, for the clean run of a
+// comparison
+func (o RunOptions) clean() RunOptions {
+	o.DataSegments, o.Tamper = nil, TamperConfig{}
+	o.Chaos, o.chaos = ChaosConfig{}, nil
+	o.Invocation.Proxies, o.Invocation.Log = nil, LogConfig{}
+	o.MemoryPressure = MemoryPressureConfig{}
+	o.Intercept = InterceptConfig{}
+	return o
+}
+
+// compareClean describes how the injected run of a file differs from its
+// clean run: traps that are new or gone, failures in another stage or with
+// another error, and changed return values, compared by floats
+func compareClean(clean, injected ExecutionResult, floats FloatComparison) *InjectionEffect {
+	effect := &InjectionEffect{CleanStage: clean.FailureStage, CleanError: clean.ErrorMessage}
+	switch {
+	case clean.Success && !injected.Success:
+		effect.Differences = append(effect.Differences, fmt.Sprintf("new %s failure: %s", injected.FailureStage, injected.ErrorMessage))
+	case !clean.Success && injected.Success:
+		effect.Differences = append(effect.Differences, fmt.Sprintf("%s failure gone: %s", clean.FailureStage, clean.ErrorMessage))
+	case !clean.Success && clean.FailureStage != injected.FailureStage:
+		effect.Differences = append(effect.Differences, fmt.Sprintf("failure moved from %s to %s: %s", clean.FailureStage, injected.FailureStage, injected.ErrorMessage))
+	case !clean.Success && clean.ErrorMessage != injected.ErrorMessage:
+		effect.Differences = append(effect.Differences, fmt.Sprintf("%s error changed from %q to %q", clean.FailureStage, clean.ErrorMessage, injected.ErrorMessage))
+	case clean.Success && !floats.equal(clean.TypedReturnValues, injected.TypedReturnValues):
+		effect.Differences = append(effect.Differences, fmt.Sprintf("return values changed from %s to %s", formatValues(clean.TypedReturnValues), formatValues(injected.TypedReturnValues)))
+	}
+
+	// Inputs run in order, so the calls of both runs pair up
+	for i := 0; i < len(clean.Invocations) && i < len(injected.Invocations); i++ {
+		before, after := clean.Invocations[i], injected.Invocations[i]
+		switch {
+		case before.Success && !after.Success:
+			effect.Differences = append(effect.Differences, fmt.Sprintf("invocation %d: new trap: %s", i, after.ErrorMessage))
+		case !before.Success && after.Success:
+			effect.Differences = append(effect.Differences, fmt.Sprintf("invocation %d: trap gone: %s", i, before.ErrorMessage))
+		case before.Success && !floats.equal(before.TypedReturnValues, after.TypedReturnValues):
+			effect.Differences = append(effect.Differences, fmt.Sprintf("invocation %d: return values changed from %s to %s", i, formatValues(before.TypedReturnValues), formatValues(after.TypedReturnValues)))
+		}
+	}
+	return effect
+}
+
+// formatValues writes values as "[i32 7, f64 0.5]"
+func formatValues(values []WasmValue) string {
+	parts := make([]string, len(values))
+	for i, value := range values {
+		parts[i] = value.Type + " " + value.Value
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
@@ -0,0 +1,73 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// -----------------------------------------------------------------------------
+// TEST: Clean Comparison
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// A module that traps with faults injected may trap without them too.
+// Only by running each file clean as well can the failures the injections
+// caused be told apart from bugs the module had all along, which would
+// otherwise drown them out.
+// -----------------------------------------------------------------------------
+
+func TestCompareClean_ReportsOnlyDifferences(t *testing.T) {
+	passed := ExecutionResult{Success: true, FailureStage: StageNone, TypedReturnValues: []WasmValue{{Type: "i32", Value: "1"}}}
+	trapped := ExecutionResult{FailureStage: StageExecute, ErrorMessage: "unreachable"}
+
+	assert.Empty(t, compareClean(passed, passed, FloatComparison{}).Differences)
+	assert.Empty(t, compareClean(trapped, trapped, FloatComparison{}).Differences, "a trap in both runs is the module's own")
+	assert.Equal(t, []string{"new execute failure: unreachable"}, compareClean(passed, trapped, FloatComparison{}).Differences)
+	assert.Equal(t, []string{"execute failure gone: unreachable"}, compareClean(trapped, passed, FloatComparison{}).Differences)
+
+	changed := passed
+	changed.TypedReturnValues = []WasmValue{{Type: "i32", Value: "2"}}
+	assert.Equal(t, []string{"return values changed from [i32 1] to [i32 2]"}, compareClean(passed, changed, FloatComparison{}).Differences)
+
+	clean := ExecutionResult{Success: true, Invocations: []InvocationResult{{Success: true}, {Success: true}}}
+	injected := ExecutionResult{Success: true, Invocations: []InvocationResult{{Success: true}, {ErrorMessage: "out of bounds"}}}
+	effect := compareClean(clean, injected, FloatComparison{})
+	assert.Equal(t, []string{"invocation 1: new trap: out of bounds"}, effect.Differences)
+}
+
+func TestCompareClean_RunsEachFileTwice(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "log.wasm"), logBinary(logSignature), 0o644))
+	runtime := &emscriptenMockRuntime{module: newContractModule(map[string]FuncSignature{"run": funcSig("", "i32")}, map[string]contractExport{
+		"run": func(m *contractModule, args []interface{}) ([]interface{}, error) {
+			if _, err := m.log("hello"); err != nil {
+				return nil, err
+			}
+			return []interface{}{int32(0)}, nil
+		},
+	})}
+
+	invocation := InvocationConfig{Entry: "run", Inputs: []InvocationInput{{}}, Log: LogConfig{Fault: "fail"}}
+	opts := RunOptions{Invocation: invocation, CompareClean: true}
+	report, err := runFuzzerWithMatrix(dir, []environmentRuntime{{Runtime: runtime}}, opts)
+	require.NoError(t, err)
+
+	require.Len(t, report.Results, 1)
+	result := report.Results[0]
+	assert.False(t, result.Success)
+	require.NotNil(t, result.Injection)
+	assert.Equal(t, StageNone, result.Injection.CleanStage, "the module passes without the log fault")
+	require.Len(t, report.InjectionDifferences, 1)
+	assert.Equal(t, result.FilePath, report.InjectionDifferences[0].FilePath)
+	assert.Equal(t, result.Injection.Differences, report.InjectionDifferences[0].Differences)
+
+	_, err = runFuzzerWithMatrix(dir, []environmentRuntime{{Runtime: runtime}}, RunOptions{CompareClean: true})
+	assert.EqualError(t, err, "compare_clean needs something injected to compare against")
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// CminReport is the JSON written by the cmin subcommand
+type CminReport struct {
+	TotalFiles int         `json:"total_files"`
+	KeptFiles  int         `json:"kept_files"`
+	Behaviors  int         `json:"behaviors"`
+	Kept       []CminEntry `json:"kept"`
+}
+
+// CminEntry is a file selected for the minimized corpus, with the
+// behaviors it was kept for
+type CminEntry struct {
+	FilePath  string   `json:"file_path"`
+	Size      int64    `json:"size"`
+	Behaviors []string `json:"behaviors"`
+}
+
+// behaviorFeatures returns the behavior signatures observed for one result.
+// Features are scoped to the environment so a file that only diverges under
+// one matrix configuration is still kept.
+func behaviorFeatures(result ExecutionResult) []string {
+	prefix := ""
+	if result.Environment != "" {
+		prefix = result.Environment + "/"
+	}
+
+	if result.Skipped {
+		return []string{prefix + "skipped|" + string(result.SkipReason)}
+	}
+	features := []string{prefix + aflSignature(result)}
+	for i, inv := range result.Invocations {
+		outcome := "ok"
+		if !inv.Success {
+			outcome = inv.ErrorMessage
+		}
+		features = append(features, fmt.Sprintf("%sinvoke[%d]|%s", prefix, i, outcome))
+	}
+	if result.ArgFuzz != nil {
+		for _, failure := range result.ArgFuzz.UniqueFailures {
+			features = append(features, prefix+"argfuzz|"+failure.ErrorMessage)
+		}
+	}
+	if result.Coverage != nil {
+		for i, hits := range result.Coverage.hits {
+			if hits != 0 {
+				features = append(features, fmt.Sprintf("%sedge[%d]", prefix, i))
+			}
+		}
+	}
+	return features
+}
+
+// minimizeCorpus greedily selects the files that cover every observed
+// behavior. Each round keeps the file adding the most uncovered behaviors,
+// preferring smaller files and then path order so the selection is stable.
+func minimizeCorpus(results []ExecutionResult, sizes map[string]int64) CminReport {
+	features := make(map[string]map[string]bool)
+	for _, result := range results {
+		if features[result.FilePath] == nil {
+			features[result.FilePath] = make(map[string]bool)
+		}
+		for _, feature := range behaviorFeatures(result) {
+			features[result.FilePath][feature] = true
+		}
+	}
+
+	paths := make([]string, 0, len(features))
+	for path := range features {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	covered := make(map[string]bool)
+	report := CminReport{TotalFiles: len(paths), Kept: []CminEntry{}}
+	for {
+		best, bestNew := "", []string(nil)
+		for _, path := range paths {
+			var fresh []string
+			for feature := range features[path] {
+				if !covered[feature] {
+					fresh = append(fresh, feature)
+				}
+			}
+			if len(fresh) == 0 {
+				continue
+			}
+			if len(fresh) > len(bestNew) || (len(fresh) == len(bestNew) && sizes[path] < sizes[best]) {
+				best, bestNew = path, fresh
+			}
+		}
+		if best == "" {
+			break
+		}
+
+		sort.Strings(bestNew)
+		for _, feature := range bestNew {
+			covered[feature] = true
+		}
+		report.Kept = append(report.Kept, CminEntry{FilePath: best, Size: sizes[best], Behaviors: bestNew})
+	}
+
+	report.KeptFiles = len(report.Kept)
+	report.Behaviors = len(covered)
+	return report
+}
+
+// copyFile copies src to dst, creating or truncating dst
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// runCminCommand distills a corpus to the smallest subset that preserves
+// every unique behavior, optionally copying it to an output directory
+func runCminCommand(args []string) int {
+	flags := flag.NewFlagSet("cmin", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	configPath := flags.String("config", "", "YAML campaign config")
+	outputDir := flags.String("output", "", "directory to copy the minimized corpus into")
+
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		emitError(map[string]string{
+			"error": "usage: wasm-fuzzer cmin [--config file.yaml] [--output dir] <directory>",
+		})
+		return 1
+	}
+	dirPath := flags.Arg(0)
+
+	config, envs, ok := prepareCampaign(dirPath, *configPath)
+	if !ok {
+		return 1
+	}
+	defer closeRuntimes(envs)
+
+	report, err := runFuzzerWithMatrix(dirPath, envs, config.runOptions())
+	if err != nil {
+		emitError(map[string]string{
+			"error":   "fuzzer execution failed",
+			"details": err.Error(),
+		})
+		return 1
+	}
+
+	sizes := make(map[string]int64)
+	for _, result := range report.Results {
+		if info, err := os.Stat(result.FilePath); err == nil {
+			sizes[result.FilePath] = info.Size()
+		}
+	}
+	minimized := minimizeCorpus(report.Results, sizes)
+
+	if *outputDir != "" {
+		if err := os.MkdirAll(*outputDir, 0o755); err != nil {
+			emitError(map[string]string{
+				"error":   "failed to create output directory",
+				"details": err.Error(),
+			})
+			return 1
+		}
+		for _, entry := range minimized.Kept {
+			if err := copyFile(entry.FilePath, filepath.Join(*outputDir, filepath.Base(entry.FilePath))); err != nil {
+				emitError(map[string]string{
+					"error":   "failed to copy corpus file",
+					"details": err.Error(),
+				})
+				return 1
+			}
+		}
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(minimized); err != nil {
+		emitError(map[string]string{
+			"error":   "failed to encode JSON output",
+			"details": err.Error(),
+		})
+		return 1
+	}
+	return 0
+}
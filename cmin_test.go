@@ -0,0 +1,83 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// cminPaths returns the kept file paths in selection order
+func cminPaths(report CminReport) []string {
+	paths := make([]string, len(report.Kept))
+	for i, entry := range report.Kept {
+		paths[i] = entry.FilePath
+	}
+	return paths
+}
+
+// -----------------------------------------------------------------------------
+// TEST: Corpus Minimization
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Nightly runs only get faster if redundant files are dropped, and they only
+// stay useful if no behavior is lost. Every observed signature must survive
+// minimization, and the selection must be stable between runs.
+// -----------------------------------------------------------------------------
+
+func TestCmin_KeepsOneFilePerBehavior(t *testing.T) {
+	results := []ExecutionResult{
+		{FilePath: "a.wasm", Success: true, FailureStage: StageNone},
+		{FilePath: "b.wasm", Success: true, FailureStage: StageNone},
+		{FilePath: "c.wasm", FailureStage: StageLoad, ErrorMessage: "malformed"},
+	}
+	sizes := map[string]int64{"a.wasm": 100, "b.wasm": 10, "c.wasm": 50}
+
+	report := minimizeCorpus(results, sizes)
+
+	assert.Equal(t, 3, report.TotalFiles)
+	assert.Equal(t, 2, report.KeptFiles)
+	assert.Equal(t, 2, report.Behaviors)
+	assert.ElementsMatch(t, []string{"b.wasm", "c.wasm"}, cminPaths(report), "the smaller of two equivalent files is kept")
+}
+
+func TestCmin_PrefersFilesCoveringMoreBehaviors(t *testing.T) {
+	results := []ExecutionResult{
+		{FilePath: "narrow.wasm", FailureStage: StageExecute, ErrorMessage: "trap",
+			Invocations: []InvocationResult{{Success: true}}},
+		{FilePath: "wide.wasm", FailureStage: StageExecute, ErrorMessage: "trap",
+			Invocations: []InvocationResult{{Success: true}, {ErrorMessage: "unreachable"}}},
+	}
+
+	report := minimizeCorpus(results, map[string]int64{"narrow.wasm": 1, "wide.wasm": 1000})
+
+	assert.Equal(t, []string{"wide.wasm"}, cminPaths(report))
+	assert.Equal(t, 3, report.Behaviors)
+}
+
+func TestCmin_ScopesBehaviorsByEnvironment(t *testing.T) {
+	results := []ExecutionResult{
+		{FilePath: "a.wasm", Environment: "interp", Success: true},
+		{FilePath: "a.wasm", Environment: "aot", Success: true},
+		{FilePath: "b.wasm", Environment: "interp", Success: true},
+		{FilePath: "b.wasm", Environment: "aot", FailureStage: StageExecute, ErrorMessage: "divergent"},
+	}
+
+	report := minimizeCorpus(results, map[string]int64{"a.wasm": 1, "b.wasm": 2})
+
+	require.ElementsMatch(t, []string{"a.wasm", "b.wasm"}, cminPaths(report), "a divergence under one environment is a distinct behavior")
+	assert.Equal(t, 3, report.Behaviors)
+}
+
+func TestCmin_IncludesArgFuzzFailures(t *testing.T) {
+	features := behaviorFeatures(ExecutionResult{
+		Success: true,
+		ArgFuzz: &ArgFuzzSummary{UniqueFailures: []ArgFuzzFailure{{ErrorMessage: "divide by zero"}}},
+	})
+
+	assert.Contains(t, features, "argfuzz|divide by zero")
+}
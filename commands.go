@@ -0,0 +1,548 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// usage is the top-level usage string reported on argument errors
+const usage = "usage: wasm-fuzzer <command> [arguments] | [campaign flags] <directory> (see wasm-fuzzer help)"
+
+// fuzzUsage is the usage of a fuzzing campaign
+const fuzzUsage = "usage: wasm-fuzzer [fuzz] [--config file.yaml] [--include glob] [--exclude glob] [--max-file-size size] [--denylist file] [--skip-duplicates] [--stop-after stage] [--track-memory] [--debug-resources] [--hang-timeout duration] [--isolate] [--max-failures n] [--max-duration duration] [--heartbeat-file file] [--heartbeat-addr addr] [--determinism n] [--no-cache] [--dry-run] [--print-config] [--only-failures] [--only-stage stage] [--fields name,...] [-o|--output report.json[.gz|.zst]] [--shuffle] [--sample n|pct%] [--seed n] [--shard-index i --shard-count n] [--changed-since ref] [--emit-graph dot [--graph-output file.dot]] <directory>"
+
+// command is a subcommand of wasm-fuzzer
+type command struct {
+	name string
+	// aliases are other names the command answers to
+	aliases []string
+	// args and summary describe the command in help
+	args    string
+	summary string
+	// run receives the remaining arguments and returns an exit code
+	run func(args []string) int
+	// internal commands are run by wasm-fuzzer itself, and not listed
+	internal bool
+}
+
+// commands lists the subcommands in the order help lists them. It is set
+// in init, as the help command lists it.
+var commands []command
+
+func init() {
+	commands = []command{
+		{name: "fuzz", args: "[campaign flags] <directory>", summary: "run a fuzzing campaign over a corpus; the default command", run: runFuzzCommand},
+		{name: "run", args: "[--config file.yaml] [--verbose] <file.wasm>", summary: "run a single file through the pipeline", run: runFileCommand},
+		{name: "serve", args: "[--config file.yaml] [--addr localhost:8080] [--max-size bytes]", summary: "run the modules posted over HTTP through the pipeline", run: runServeCommand},
+		{name: "repl", args: "[--config file.yaml] <file.wasm>", summary: "call a module's exports interactively", run: runREPLCommand},
+		{name: "sweep", args: "[--config file.yaml] [--workers n] [corpus flags] <directory>", summary: "load and validate a corpus on many workers", run: runSweepCommand},
+		{name: "minimize", aliases: []string{"cmin"}, args: "[--config file.yaml] [--output dir] <directory>", summary: "keep the smallest files covering the corpus's behavior", run: runCminCommand},
+		{name: "generate", args: "[--count n] [--seed n] [--output dir]", summary: "write random modules that validate, to seed a corpus", run: runGenerateCommand},
+		{name: "dict", args: "[--output file.dict] <directory>", summary: "extract a fuzzing dictionary from a corpus", run: runDictCommand},
+		{name: "stats", args: "<directory>", summary: "summarize the modules of a corpus", run: runStatsCommand},
+		{name: "inspect", args: "<file.wasm>", summary: "describe a module's imports, exports and features without running it", run: runInspectCommand},
+		{name: "sbom", args: "<directory>", summary: "inventory the toolchains and host APIs a corpus depends on", run: runSBOMCommand},
+		{name: "merge", aliases: []string{"merge-reports"}, args: "[-o|--output report.json[.gz|.zst]] <shard-report.json>...", summary: "merge the reports of a sharded campaign", run: runMergeCommand},
+		{name: "validate-report", args: "<report.json>", summary: "check a report against the report schema", run: runValidateReport},
+		{name: "diff", args: "<before.json> <after.json>", summary: "compare the outcome of every file between two reports", run: runDiffCommand},
+		{name: "analyze", args: "[-threshold 0.6] <report.json>", summary: "cluster the failure messages of a report", run: runAnalyzeCommand},
+		{name: "trends", args: "[--config file.yaml] [--history file.json] [--last n] [--slowdown 1.5]", summary: "follow pass rates, failures and timings across the campaigns of a history", run: runTrendsCommand},
+		{name: "bench", args: "[--config file.yaml] [--warmup n] [--iterations n] [--pin-cpu n] [--check-governor] <directory>", summary: "measure the latency of every module of a corpus", run: runBenchCommand},
+		{name: "bisect", args: "[--config file.yaml] <file.wasm> <versions-dir> | <library-dir>...", summary: "find the runtime version a file's outcome changed in", run: runBisectCommand},
+		{name: "permute", args: "[--config file.yaml] [--memory-limits pages,...] <file.wasm>", summary: "find the runtime options a file's outcome depends on", run: runPermuteCommand},
+		{name: "equiv", args: "[--config file.yaml] <left-directory> <right-directory>", summary: "report the outputs of two equivalent corpora that diverge", run: runEquivCommand},
+		{name: "scaffold", args: "[--output file_test.go] [--package name] <file.wasm>", summary: "generate a Go test calling a module's exports", run: runScaffoldCommand},
+		{name: "selftest", summary: "run an embedded corpus to check the installation", run: runSelftestCommand},
+		{name: "afl", args: "[--config file.yaml] [input-file]", summary: "run as an AFL++ target", run: runAFLCommand},
+		{name: "k8s-gen", args: "--corpus-claim name --artifacts-claim name [--config file.yaml] [--image image] [--name name] [--shards n] [--schedule cron] [--cpu n] [--memory size] [--retries n] [-o|--output file.yaml]", summary: "write Kubernetes manifests running a campaign as a sharded Job", run: runK8sGenCommand},
+		{name: "completion", args: "<bash|zsh|fish>", summary: "write the completion script of a shell", run: runCompletionCommand},
+		{name: "man", summary: "write the man page in roff", run: runManCommand},
+		{name: "help", aliases: []string{"-h", "--help"}, args: "[command]", summary: "describe the commands", run: runHelpCommand},
+		{name: "afl-worker", run: runAFLWorker, internal: true},
+		{name: "campaign-worker", run: runCampaignWorker, internal: true},
+		{name: "large-module-worker", run: runLargeModuleWorker, internal: true},
+	}
+}
+
+// findCommand returns the command answering to a name
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+		for _, alias := range cmd.aliases {
+			if alias == name {
+				return cmd, true
+			}
+		}
+	}
+	return command{}, false
+}
+
+// runHelpCommand lists the commands, or describes one
+func runHelpCommand(args []string) int {
+	if len(args) > 1 {
+		emitError(map[string]string{"error": "usage: wasm-fuzzer help [command]"})
+		return 1
+	}
+	if len(args) == 1 {
+		cmd, ok := findCommand(args[0])
+		if !ok || cmd.internal {
+			emitError(map[string]string{"error": "unknown command", "command": args[0]})
+			return 1
+		}
+		if cmd.name == "fuzz" {
+			fmt.Println(fuzzUsage)
+		} else {
+			fmt.Printf("usage: wasm-fuzzer %s %s\n", cmd.name, cmd.args)
+		}
+		fmt.Printf("\n%s\n", cmd.summary)
+		if len(cmd.aliases) > 0 {
+			fmt.Printf("\nAlso called: %s\n", strings.Join(cmd.aliases, ", "))
+		}
+		return 0
+	}
+
+	fmt.Println(usage)
+	fmt.Println("\nCommands:")
+	for _, cmd := range commands {
+		if !cmd.internal {
+			fmt.Printf("  %-16s %s\n", cmd.name, cmd.summary)
+		}
+	}
+	return 0
+}
+
+// emitError writes a structured error to stderr, with the code of the
+// error when it has none
+func emitError(fields map[string]string) {
+	if message, ok := fields["error"]; ok && fields["code"] == "" {
+		fields["code"] = string(commandErrorCode(message))
+	}
+	json.NewEncoder(os.Stderr).Encode(fields)
+}
+
+// fuzzCommand is the parsed command line of a fuzzing campaign
+type fuzzCommand struct {
+	dirPath     string
+	configPath  string
+	graphFormat string
+	graphPath   string
+	// dryRun prints what the campaign would run instead of running it
+	dryRun bool
+	// printConfig prints the resolved config instead of running
+	printConfig bool
+	// filter slims the results written, nil when they are all written
+	filter *ResultFilter
+	// outputPath is the file the report is written to, stdout when empty
+	outputPath string
+	// apply applies the flags overriding the config
+	apply func(config *Config)
+}
+
+// parseFuzzCommand parses the command line of a fuzzing campaign. Campaign
+// workers parse the same one.
+func parseFuzzCommand(args []string) (fuzzCommand, bool) {
+	flags := flag.NewFlagSet("wasm-fuzzer", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	build := addFuzzFlags(flags)
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		return fuzzCommand{}, false
+	}
+	return build(flags.Arg(0)), true
+}
+
+// addFuzzFlags registers the flags of a fuzzing campaign. The returned
+// function builds the command once they are parsed.
+func addFuzzFlags(flags *flag.FlagSet) func(dirPath string) fuzzCommand {
+	configPath := flags.String("config", "", "YAML campaign config")
+	graphFormat := flags.String("emit-graph", "", "write the corpus import graph in this format (dot)")
+	graphPath := flags.String("graph-output", "corpus.dot", "file to write the import graph to")
+	stopAfter := flags.String("stop-after", "", "end the pipeline after this stage (load, validate or instantiate)")
+	trackMemory := flags.Bool("track-memory", false, "warn when memory grows steadily over the campaign")
+	debugResources := flags.Bool("debug-resources", false, "report runtime objects each file leaks")
+	hangTimeout := flags.Duration("hang-timeout", 0, "report files making no progress for this long, such as 30s")
+	isolate := flags.Bool("isolate", false, "run files in worker subprocesses, abandoning files that hang")
+	maxFailures := flags.Int("max-failures", 0, "abort the campaign after this many failures")
+	maxDuration := flags.Duration("max-duration", 0, "run as many files as fit in this long, such as 2h")
+	heartbeatFile := flags.String("heartbeat-file", "", "rewrite this file as the campaign makes progress, for liveness probes")
+	heartbeatAddr := flags.String("heartbeat-addr", "", "serve the campaign's liveness at /healthz on this address, such as :8081")
+	determinism := flags.Int("determinism", 0, "run every file this many times, reporting the files whose runs differ")
+	noCache := flags.Bool("no-cache", false, "run every file again instead of reusing cached results")
+	dryRun := flags.Bool("dry-run", false, "print what the campaign would run without running it")
+	printConfig := flags.Bool("print-config", false, "print the config resolved from the file, environment and flags")
+	outputPath := flags.String("output", "", "write the report to this file, compressed when it ends in .gz or .zst")
+	flags.StringVar(outputPath, "o", "", "shorthand for --output")
+	onlyFailures := flags.Bool("only-failures", false, "write only the failed results")
+	onlyStage := flags.String("only-stage", "", "write only the results that failed in this stage")
+	fields := flags.String("fields", "", "write only these comma-separated fields of each result")
+	applyCorpusFlags := addCorpusFlags(flags)
+
+	return func(dirPath string) fuzzCommand {
+		var filter *ResultFilter
+		if *onlyFailures || *onlyStage != "" || *fields != "" {
+			filter = &ResultFilter{OnlyFailures: *onlyFailures, OnlyStage: FailureStage(*onlyStage)}
+			if *fields != "" {
+				filter.Fields = strings.Split(*fields, ",")
+			}
+		}
+		return fuzzCommand{
+			dirPath:     dirPath,
+			configPath:  *configPath,
+			graphFormat: *graphFormat,
+			graphPath:   *graphPath,
+			dryRun:      *dryRun,
+			printConfig: *printConfig,
+			filter:      filter,
+			outputPath:  *outputPath,
+			apply: func(config *Config) {
+				applyCorpusFlags(config)
+				if *stopAfter != "" {
+					config.StopAfter = FailureStage(*stopAfter)
+				}
+				if *trackMemory {
+					config.TrackMemory = true
+				}
+				if *debugResources {
+					config.DebugResources = true
+				}
+				if *hangTimeout > 0 {
+					config.HangTimeout = *hangTimeout
+				}
+				if *isolate {
+					config.Isolate = true
+				}
+				if *maxFailures > 0 {
+					config.MaxFailures = *maxFailures
+				}
+				if *maxDuration > 0 {
+					config.MaxDuration = *maxDuration
+				}
+				if *heartbeatFile != "" {
+					config.Heartbeat.File = *heartbeatFile
+				}
+				if *heartbeatAddr != "" {
+					config.Heartbeat.Addr = *heartbeatAddr
+				}
+				if *determinism > 0 {
+					config.Determinism = *determinism
+				}
+				if *noCache {
+					config.Cache.Refresh = true
+				}
+			},
+		}
+	}
+}
+
+// runFuzzCommand runs a fuzzing campaign over a corpus directory
+func runFuzzCommand(args []string) int {
+	command, ok := parseFuzzCommand(args)
+	if !ok {
+		emitError(map[string]string{"error": fuzzUsage})
+		return 1
+	}
+	dirPath := command.dirPath
+	if command.dryRun {
+		return runDryRun(command)
+	}
+	if command.printConfig {
+		return runPrintConfig(command)
+	}
+	if err := command.filter.check(); err != nil {
+		emitError(map[string]string{
+			"error":   "invalid result filter",
+			"details": err.Error(),
+		})
+		return 1
+	}
+
+	config, envs, ok := prepareCampaign(dirPath, command.configPath)
+	if !ok {
+		return 1
+	}
+	defer closeRuntimes(envs)
+	command.apply(&config)
+
+	// The graph only needs the binaries, so it is written before the run
+	if command.graphFormat != "" {
+		files, err := collectWasmFiles(dirPath)
+		if err == nil {
+			err = emitGraph(command.graphFormat, command.graphPath, files)
+		}
+		if err != nil {
+			emitError(map[string]string{
+				"error":   "failed to write import graph",
+				"details": err.Error(),
+			})
+			return 1
+		}
+	}
+
+	// Export traces when an OTLP endpoint is configured
+	tracer = newTracerFromEnv()
+	defer tracer.Shutdown()
+
+	// Isolated workers run the same command line. Sanitizer reports only
+	// reach a worker's stderr, so a sanitized runtime implies isolation,
+	// as does memory pressure, which may kill the process under it.
+	opts := config.runOptions()
+	if config.Isolate || config.Sanitizer.enabled() || config.MemoryPressure.enabled() {
+		opts.WorkerArgs = args
+	}
+	opts.CampaignArgs = args
+
+	// Run the fuzzer
+	report, err := runFuzzerWithMatrix(dirPath, envs, opts)
+	if err != nil {
+		emitError(map[string]string{
+			"error":   "fuzzer execution failed",
+			"details": err.Error(),
+		})
+		return 1
+	}
+
+	report.Config = config.resolved()
+	// Teams get every result of their files, whatever the filter keeps
+	routeToOwners(config.Ownership, report)
+	report = command.filter.apply(report)
+
+	// Output results as JSON
+	if err := writeReport(command.outputPath, report); err != nil {
+		emitError(map[string]string{
+			"error":   "failed to write report",
+			"details": err.Error(),
+		})
+		return 1
+	}
+	// An aborted campaign's report is partial
+	if report.Aborted != "" {
+		return 1
+	}
+	// Unmet expectations fail the campaign like a failing test suite
+	if report.Expectations != nil && len(report.Expectations.Failures) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// runPrintConfig prints the config a campaign would run with, as YAML that
+// can be given back to --config
+func runPrintConfig(command fuzzCommand) int {
+	config, ok := loadCampaignConfig(command.dirPath, command.configPath)
+	if !ok {
+		return 1
+	}
+	command.apply(&config)
+
+	encoder := yaml.NewEncoder(os.Stdout)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(config); err != nil {
+		emitError(map[string]string{
+			"error":   "failed to encode config",
+			"details": err.Error(),
+		})
+		return 1
+	}
+	return 0
+}
+
+// addCorpusFlags registers the flags selecting corpus files. The returned
+// function applies them to a config: they add to its patterns and
+// override its other corpus settings.
+func addCorpusFlags(flags *flag.FlagSet) func(config *Config) {
+	skipDuplicates := flags.Bool("skip-duplicates", false, "skip files with the same content as an earlier file")
+	var include, exclude patternList
+	flags.Var(&include, "include", "only run files whose name matches this glob (repeatable)")
+	flags.Var(&exclude, "exclude", "skip files whose name matches this glob (repeatable)")
+	var maxFileSize ByteSize
+	flags.Var(&maxFileSize, "max-file-size", "skip files larger than this size, such as 10MiB")
+	denylist := flags.String("denylist", "", "file of SHA-256 hashes of files to skip")
+	shuffle := flags.Bool("shuffle", false, "run the files in a random order")
+	sample := flags.String("sample", "", "only run a random subset of the files, such as 500 or 10%")
+	seed := flags.Int64("seed", 0, "seed for --shuffle and --sample")
+	shardIndex := flags.Int("shard-index", 0, "run this shard of the corpus, from 0")
+	shardCount := flags.Int("shard-count", 0, "split the corpus into this many shards")
+	changedSince := flags.String("changed-since", "", "only run the files changed since this git ref, reusing cached results for the rest")
+
+	return func(config *Config) {
+		config.Corpus.Include = append(config.Corpus.Include, include...)
+		config.Corpus.Exclude = append(config.Corpus.Exclude, exclude...)
+		if maxFileSize > 0 {
+			config.Corpus.MaxFileSize = maxFileSize
+		}
+		if *denylist != "" {
+			config.Corpus.Denylist = *denylist
+		}
+		if *skipDuplicates {
+			config.Corpus.SkipDuplicates = true
+		}
+		if *shuffle {
+			config.Corpus.Shuffle = true
+		}
+		if *sample != "" {
+			config.Corpus.Sample = *sample
+		}
+		if *changedSince != "" {
+			config.Corpus.ChangedSince = *changedSince
+		}
+		flags.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "seed":
+				config.Corpus.Seed = *seed
+			case "shard-index":
+				config.Corpus.ShardIndex = *shardIndex
+			case "shard-count":
+				config.Corpus.ShardCount = *shardCount
+			}
+		})
+	}
+}
+
+// prepareCampaign checks the corpus directory, loads the optional config and
+// builds the matrix runtimes. Failures are reported on stderr.
+func prepareCampaign(dirPath, configPath string) (Config, []environmentRuntime, bool) {
+	config, ok := loadCampaignConfig(dirPath, configPath)
+	if !ok {
+		return Config{}, nil, false
+	}
+	envs, err := buildEnvironmentRuntimes(config)
+	if err != nil {
+		emitError(map[string]string{
+			"error":   "invalid environment matrix",
+			"details": err.Error(),
+		})
+		return Config{}, nil, false
+	}
+	return config, envs, true
+}
+
+// loadCampaignConfig checks the corpus location and loads the optional
+// config. Failures are reported on stderr.
+func loadCampaignConfig(dirPath, configPath string) (Config, bool) {
+	source, err := openCorpusSource(dirPath)
+	if err != nil {
+		emitError(map[string]string{
+			"error":   "invalid corpus source",
+			"details": err.Error(),
+		})
+		return Config{}, false
+	}
+
+	// Verify a local directory exists; corpora kept elsewhere are checked
+	// when fetched
+	if _, local := source.(localCorpus); local {
+		info, err := os.Stat(dirPath)
+		if err != nil {
+			emitError(map[string]string{
+				"error":   "directory access failed",
+				"details": err.Error(),
+			})
+			return Config{}, false
+		}
+
+		if !info.IsDir() {
+			emitError(map[string]string{
+				"error": "path is not a directory",
+				"path":  dirPath,
+			})
+			return Config{}, false
+		}
+	}
+
+	config, err := resolveConfig(configPath)
+	if err != nil {
+		emitError(map[string]string{
+			"error":   "config load failed",
+			"details": err.Error(),
+		})
+		return Config{}, false
+	}
+	return config, true
+}
+
+// campaignEnvironments expands the matrix into the environments files run
+// under
+func campaignEnvironments(config Config) ([]Environment, error) {
+	envs, err := config.Matrix.Environments()
+	if err != nil {
+		return nil, err
+	}
+	if config.Coverage.Enabled {
+		for i := range envs {
+			envs[i] = coverageEnvironment(envs[i])
+		}
+	}
+	return envs, nil
+}
+
+// buildEnvironmentRuntimes creates a runtime for every matrix environment
+func buildEnvironmentRuntimes(config Config) ([]environmentRuntime, error) {
+	envs, err := campaignEnvironments(config)
+	if err != nil {
+		return nil, err
+	}
+
+	runtimes := make([]environmentRuntime, 0, len(envs))
+	for _, env := range envs {
+		runtime, err := newRuntime(env)
+		if err != nil {
+			return nil, err
+		}
+		runtimes = append(runtimes, environmentRuntime{Environment: env, Runtime: runtime})
+	}
+	return runtimes, nil
+}
+
+// validationOutput is the JSON written by the validate-report subcommand
+type validationOutput struct {
+	Valid                 bool     `json:"valid"`
+	OriginalSchemaVersion int      `json:"original_schema_version"`
+	SchemaVersion         int      `json:"schema_version"`
+	Errors                []string `json:"errors,omitempty"`
+}
+
+// runValidateReport checks a report file against the current schema,
+// migrating older reports first
+func runValidateReport(args []string) int {
+	if len(args) != 1 {
+		emitError(map[string]string{
+			"error": "usage: wasm-fuzzer validate-report <report.json>",
+		})
+		return 1
+	}
+
+	data, err := readReportFile(args[0])
+	if err != nil {
+		emitError(map[string]string{
+			"error":   "report access failed",
+			"details": err.Error(),
+		})
+		return 1
+	}
+
+	output := validationOutput{SchemaVersion: SchemaVersion}
+	report, original, err := decodeReport(data)
+	output.OriginalSchemaVersion = original
+	if err != nil {
+		output.Errors = []string{err.Error()}
+	} else {
+		output.Errors = validateReport(report)
+	}
+	output.Valid = len(output.Errors) == 0
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(output)
+
+	if !output.Valid {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,46 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// -----------------------------------------------------------------------------
+// TEST: Command Table
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Every command is found through the one table help lists. A name or
+// alias given twice would silently shadow a command, and scripts written
+// against the old names must keep working.
+// -----------------------------------------------------------------------------
+
+func TestCommands_NamesAreUnique(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, cmd := range commands {
+		for _, name := range append([]string{cmd.name}, cmd.aliases...) {
+			assert.False(t, seen[name], "%s is given twice", name)
+			seen[name] = true
+		}
+		require.NotNil(t, cmd.run, cmd.name)
+		if !cmd.internal {
+			assert.NotEmpty(t, cmd.summary, cmd.name)
+		}
+	}
+}
+
+func TestCommands_FindsAliases(t *testing.T) {
+	for alias, name := range map[string]string{"cmin": "minimize", "merge-reports": "merge", "--help": "help", "fuzz": "fuzz"} {
+		cmd, ok := findCommand(alias)
+		require.True(t, ok, alias)
+		assert.Equal(t, name, cmd.name)
+	}
+
+	_, ok := findCommand("./corpus")
+	assert.False(t, ok)
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// argsFlag matches the flags in a command's arguments, such as
+// "[--config file.yaml]" or "[-o|--output file]"
+var argsFlag = regexp.MustCompile(`[\[|](--?[a-z][a-z-]*)`)
+
+// fuzzFlags returns the flag set of a fuzzing campaign
+func fuzzFlags() *flag.FlagSet {
+	flags := flag.NewFlagSet("wasm-fuzzer", flag.ContinueOnError)
+	addFuzzFlags(flags)
+	return flags
+}
+
+// flagSpelling spells a flag the way its documentation does: one dash for
+// single letters, two for names
+func flagSpelling(name string) string {
+	if len(name) == 1 {
+		return "-" + name
+	}
+	return "--" + name
+}
+
+// commandFlags returns the flags a command takes, as written on the
+// command line
+func commandFlags(cmd command) []string {
+	var names []string
+	if cmd.name == "fuzz" {
+		fuzzFlags().VisitAll(func(f *flag.Flag) {
+			names = append(names, flagSpelling(f.Name))
+		})
+		return names
+	}
+	for _, match := range argsFlag.FindAllStringSubmatch(cmd.args, -1) {
+		names = append(names, match[1])
+	}
+	if strings.Contains(cmd.args, "[corpus flags]") {
+		flags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+		addCorpusFlags(flags)
+		flags.VisitAll(func(f *flag.Flag) {
+			names = append(names, flagSpelling(f.Name))
+		})
+	}
+	return names
+}
+
+// listedCommands returns the commands help lists
+func listedCommands() []command {
+	var listed []command
+	for _, cmd := range commands {
+		if !cmd.internal {
+			listed = append(listed, cmd)
+		}
+	}
+	return listed
+}
+
+// commandNames returns the names a command completes to, leaving out
+// aliases such as --help that look like flags
+func commandNames(cmd command) []string {
+	names := []string{cmd.name}
+	for _, alias := range cmd.aliases {
+		if !strings.HasPrefix(alias, "-") {
+			names = append(names, alias)
+		}
+	}
+	return names
+}
+
+// writeBashCompletion writes a bash completion script. The first word
+// completes to a command, a campaign flag or a directory.
+func writeBashCompletion(w io.Writer) {
+	var names []string
+	for _, cmd := range listedCommands() {
+		names = append(names, commandNames(cmd)...)
+	}
+	fuzz, _ := findCommand("fuzz")
+
+	fmt.Fprintln(w, "# bash completion for wasm-fuzzer")
+	fmt.Fprintln(w, "_wasm_fuzzer() {")
+	fmt.Fprintln(w, `	local cur="${COMP_WORDS[COMP_CWORD]}" words`)
+	fmt.Fprintln(w, `	if [ "$COMP_CWORD" -eq 1 ] && [[ "$cur" != -* ]]; then`)
+	fmt.Fprintf(w, "\t\tCOMPREPLY=($(compgen -W %q -- \"$cur\") $(compgen -d -- \"$cur\"))\n", strings.Join(names, " "))
+	fmt.Fprintln(w, "\t\treturn")
+	fmt.Fprintln(w, "\tfi")
+	fmt.Fprintln(w, `	case "${COMP_WORDS[1]}" in`)
+	for _, cmd := range listedCommands() {
+		if cmd.name == "fuzz" {
+			continue
+		}
+		fmt.Fprintf(w, "\t%s) words=%q ;;\n", strings.Join(commandNames(cmd), "|"), strings.Join(commandFlags(cmd), " "))
+	}
+	fmt.Fprintf(w, "\t*) words=%q ;;\n", strings.Join(commandFlags(fuzz), " "))
+	fmt.Fprintln(w, "\tesac")
+	fmt.Fprintln(w, `	if [[ "$cur" == -* ]]; then`)
+	fmt.Fprintln(w, `		COMPREPLY=($(compgen -W "$words" -- "$cur"))`)
+	fmt.Fprintln(w, "\telse")
+	fmt.Fprintln(w, `		COMPREPLY=($(compgen -f -- "$cur"))`)
+	fmt.Fprintln(w, "\tfi")
+	fmt.Fprintln(w, "}")
+	fmt.Fprintln(w, "complete -o filenames -F _wasm_fuzzer wasm-fuzzer")
+}
+
+// writeZshCompletion writes a zsh completion script
+func writeZshCompletion(w io.Writer) {
+	fuzz, _ := findCommand("fuzz")
+
+	fmt.Fprintln(w, "#compdef wasm-fuzzer")
+	fmt.Fprintln(w, "_wasm_fuzzer() {")
+	fmt.Fprintln(w, "\tlocal -a commands flags")
+	fmt.Fprintln(w, "\tcommands=(")
+	for _, cmd := range listedCommands() {
+		for _, name := range commandNames(cmd) {
+			fmt.Fprintf(w, "\t\t%s\n", shellQuote(name+":"+cmd.summary))
+		}
+	}
+	fmt.Fprintln(w, "\t)")
+	fmt.Fprintln(w, `	if (( CURRENT == 2 )) && [[ $PREFIX != -* ]]; then`)
+	fmt.Fprintln(w, "\t\t_describe command commands")
+	fmt.Fprintln(w, "\t\t_files -/")
+	fmt.Fprintln(w, "\t\treturn")
+	fmt.Fprintln(w, "\tfi")
+	fmt.Fprintln(w, "\tcase $words[2] in")
+	for _, cmd := range listedCommands() {
+		if cmd.name == "fuzz" {
+			continue
+		}
+		fmt.Fprintf(w, "\t%s) flags=(%s) ;;\n", strings.Join(commandNames(cmd), "|"), strings.Join(commandFlags(cmd), " "))
+	}
+	fmt.Fprintf(w, "\t*) flags=(%s) ;;\n", strings.Join(commandFlags(fuzz), " "))
+	fmt.Fprintln(w, "\tesac")
+	fmt.Fprintln(w, `	if [[ $PREFIX == -* ]]; then`)
+	fmt.Fprintln(w, "\t\tcompadd -- $flags")
+	fmt.Fprintln(w, "\telse")
+	fmt.Fprintln(w, "\t\t_files")
+	fmt.Fprintln(w, "\tfi")
+	fmt.Fprintln(w, "}")
+	fmt.Fprintln(w, `_wasm_fuzzer "$@"`)
+}
+
+// shellQuote quotes a word for zsh and fish
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// writeFishCompletion writes a fish completion script. Campaign flags
+// complete before a command is given, as they come first.
+func writeFishCompletion(w io.Writer) {
+	fmt.Fprintln(w, "# fish completion for wasm-fuzzer")
+	for _, cmd := range listedCommands() {
+		for _, name := range commandNames(cmd) {
+			fmt.Fprintf(w, "complete -c wasm-fuzzer -n __fish_use_subcommand -f -a %s -d %s\n", name, shellQuote(cmd.summary))
+		}
+	}
+	fuzzFlags().VisitAll(func(f *flag.Flag) {
+		option := "-l " + f.Name
+		if len(f.Name) == 1 {
+			option = "-s " + f.Name
+		}
+		fmt.Fprintf(w, "complete -c wasm-fuzzer -n __fish_use_subcommand %s -d %s\n", option, shellQuote(f.Usage))
+	})
+	for _, cmd := range listedCommands() {
+		if cmd.name == "fuzz" {
+			continue
+		}
+		condition := "__fish_seen_subcommand_from " + strings.Join(commandNames(cmd), " ")
+		for _, name := range commandFlags(cmd) {
+			option := "-l " + strings.TrimPrefix(name, "--")
+			switch {
+			case len(name) == 2:
+				option = "-s " + name[1:]
+			case !strings.HasPrefix(name, "--"):
+				option = "-o " + strings.TrimPrefix(name, "-")
+			}
+			fmt.Fprintf(w, "complete -c wasm-fuzzer -n %s %s\n", shellQuote(condition), option)
+		}
+	}
+}
+
+// writeManPage writes the wasm-fuzzer(1) man page in roff
+func writeManPage(w io.Writer) {
+	fmt.Fprintln(w, `.TH WASM\-FUZZER 1`)
+	fmt.Fprintln(w, ".SH NAME")
+	fmt.Fprintln(w, `wasm\-fuzzer \- fuzz WebAssembly runtimes with injected faults`)
+	fmt.Fprintln(w, ".SH SYNOPSIS")
+	fmt.Fprintln(w, `.B wasm\-fuzzer`)
+	fmt.Fprintln(w, `[\fIcampaign flags\fR] \fIdirectory\fR`)
+	fmt.Fprintln(w, ".br")
+	fmt.Fprintln(w, `.B wasm\-fuzzer`)
+	fmt.Fprintln(w, `\fIcommand\fR [\fIarguments\fR]`)
+	fmt.Fprintln(w, ".SH DESCRIPTION")
+	fmt.Fprintln(w, "Runs every WebAssembly file of a corpus through loading, validation,")
+	fmt.Fprintln(w, "instantiation and execution, and writes a JSON report of the stage each")
+	fmt.Fprintln(w, "file failed at. A campaign is the default command.")
+
+	fmt.Fprintln(w, ".SH COMMANDS")
+	for _, cmd := range listedCommands() {
+		fmt.Fprintln(w, ".TP")
+		fmt.Fprintf(w, ".B %s\n", roffEscape(cmd.name))
+		if cmd.args != "" {
+			fmt.Fprintln(w, roffEscape(cmd.args))
+			fmt.Fprintln(w, ".br")
+		}
+		summary := cmd.summary
+		if len(cmd.aliases) > 0 {
+			summary += "; also called " + strings.Join(cmd.aliases, ", ")
+		}
+		fmt.Fprintln(w, roffEscape(strings.ToUpper(summary[:1])+summary[1:]+"."))
+	}
+
+	fmt.Fprintln(w, ".SH CAMPAIGN FLAGS")
+	fuzzFlags().VisitAll(func(f *flag.Flag) {
+		value, usage := flag.UnquoteUsage(f)
+		fmt.Fprintln(w, ".TP")
+		if value != "" {
+			fmt.Fprintf(w, ".BI %s \" %s\"\n", roffEscape(flagSpelling(f.Name)), roffEscape(value))
+		} else {
+			fmt.Fprintf(w, ".B %s\n", roffEscape(flagSpelling(f.Name)))
+		}
+		fmt.Fprintln(w, roffEscape(strings.ToUpper(usage[:1])+usage[1:]+"."))
+	})
+
+	fmt.Fprintln(w, ".SH ENVIRONMENT")
+	fmt.Fprintln(w, ".TP")
+	fmt.Fprintf(w, ".B %s*\n", roffEscape(envPrefix))
+	fmt.Fprintln(w, "Set the config key the rest of the name spells, with nested keys joined by")
+	fmt.Fprintf(w, "a double underscore, such as %s. Values are read as YAML.\n", roffEscape(envPrefix+"CORPUS__MAX_FILE_SIZE"))
+	fmt.Fprintln(w, ".TP")
+	fmt.Fprintln(w, ".B OTEL_EXPORTER_OTLP_ENDPOINT")
+	fmt.Fprintln(w, "Export a trace of the campaign to this OTLP endpoint.")
+}
+
+// roffEscape escapes text for roff
+func roffEscape(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\e`)
+	s = strings.ReplaceAll(s, "-", `\-`)
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		s = `\&` + s
+	}
+	return s
+}
+
+// runCompletionCommand writes the completion script of a shell
+func runCompletionCommand(args []string) int {
+	writers := map[string]func(io.Writer){
+		"bash": writeBashCompletion,
+		"zsh":  writeZshCompletion,
+		"fish": writeFishCompletion,
+	}
+	if len(args) != 1 || writers[args[0]] == nil {
+		emitError(map[string]string{"error": "usage: wasm-fuzzer completion <bash|zsh|fish>"})
+		return 1
+	}
+	writers[args[0]](os.Stdout)
+	return 0
+}
+
+// runManCommand writes the man page
+func runManCommand(args []string) int {
+	if len(args) != 0 {
+		emitError(map[string]string{"error": "usage: wasm-fuzzer man"})
+		return 1
+	}
+	writeManPage(os.Stdout)
+	return 0
+}
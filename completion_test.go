@@ -0,0 +1,59 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// -----------------------------------------------------------------------------
+// TEST: Completions and Man Page
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// The completion scripts and the man page are generated from the command
+// table and the campaign's flag set, so a new command or flag shows up in
+// them without anyone editing them. They must list what is really there
+// and leave out the internal worker commands.
+// -----------------------------------------------------------------------------
+
+func TestCompletion_ListsCommandsAndFlags(t *testing.T) {
+	run, _ := findCommand("run")
+	assert.Equal(t, []string{"--config", "--verbose"}, commandFlags(run))
+	analyze, _ := findCommand("analyze")
+	assert.Equal(t, []string{"-threshold"}, commandFlags(analyze))
+	sweep, _ := findCommand("sweep")
+	assert.Contains(t, commandFlags(sweep), "--shard-count")
+	fuzz, _ := findCommand("fuzz")
+	assert.Contains(t, commandFlags(fuzz), "--print-config")
+
+	for shell, write := range map[string]func(io.Writer){
+		"bash": writeBashCompletion,
+		"zsh":  writeZshCompletion,
+		"fish": writeFishCompletion,
+	} {
+		var out bytes.Buffer
+		write(&out)
+		assert.Contains(t, out.String(), "minimize", shell)
+		assert.Contains(t, out.String(), "merge-reports", shell)
+		assert.Contains(t, out.String(), "max-failures", shell)
+		assert.NotContains(t, out.String(), "campaign-worker", shell)
+	}
+}
+
+func TestCompletion_ManPageEscapesRoff(t *testing.T) {
+	var out bytes.Buffer
+	writeManPage(&out)
+	page := out.String()
+
+	assert.Contains(t, page, ".TH WASM\\-FUZZER 1\n")
+	assert.Contains(t, page, ".BI \\-\\-hang\\-timeout \" duration\"\n")
+	assert.Contains(t, page, "Keep the smallest files covering the corpus's behavior; also called cmin.\n")
+	assert.NotContains(t, page, "afl-worker")
+	assert.Equal(t, `\&.hidden`, roffEscape(".hidden"))
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// gzipMagic and zstdMagic start gzip and zstd streams. Compressed reports
+// are recognized by them when read, whatever their file is called.
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// readReportFile reads a report file, decompressing it when it is gzip or
+// zstd compressed
+func readReportFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case bytes.HasPrefix(data, gzipMagic):
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress report: %w", err)
+		}
+		if data, err = io.ReadAll(reader); err != nil {
+			return nil, fmt.Errorf("failed to decompress report: %w", err)
+		}
+	case bytes.HasPrefix(data, zstdMagic):
+		if data, err = decompressZstd(data); err != nil {
+			return nil, fmt.Errorf("failed to decompress report: %w", err)
+		}
+	}
+	return data, nil
+}
+
+// writeReportFile writes a report to a file, compressed with gzip when
+// its name ends in .gz and with zstd when it ends in .zst. The report
+// replaces the file only once complete, so readers never see a truncated
+// report, even when the fuzzer dies writing it.
+func writeReportFile(path string, report FuzzingReport) error {
+	return replaceFile(path, 0o644, func(w io.Writer) error {
+		return writeCompressed(w, path, func(w io.Writer) error {
+			return encodeReport(w, report)
+		})
+	})
+}
+
+// writeCompressed writes what encode produces to w, compressed as the
+// extension of name selects
+func writeCompressed(w io.Writer, name string, encode func(w io.Writer) error) error {
+	switch {
+	case strings.HasSuffix(name, ".gz"):
+		compressor := gzip.NewWriter(w)
+		if err := encode(compressor); err != nil {
+			return err
+		}
+		return compressor.Close()
+	case strings.HasSuffix(name, ".zst"):
+		compressor, err := zstd.NewWriter(w)
+		if err != nil {
+			return err
+		}
+		if err := encode(compressor); err != nil {
+			compressor.Close()
+			return err
+		}
+		return compressor.Close()
+	}
+	return encode(w)
+}
+
+// decompressZstd decompresses a zstd stream
+func decompressZstd(data []byte) ([]byte, error) {
+	decoder, err := zstd.NewReader(nil)
+	if err != nil {
+		return nil, err
+	}
+	defer decoder.Close()
+	return decoder.DecodeAll(data, nil)
+}
+
+// writeReport writes a report to a file when one is given, and to stdout
+// otherwise. When the file cannot be written, as on a full disk, the
+// report's summary is written to stdout instead and the error returned.
+func writeReport(path string, report FuzzingReport) error {
+	if path == "" {
+		return outputJSON(report)
+	}
+	err := writeReportFile(path, report)
+	if err != nil {
+		outputJSON(reportSummary(report))
+	}
+	return err
+}
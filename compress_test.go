@@ -0,0 +1,116 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// -----------------------------------------------------------------------------
+// TEST: Compressed Reports
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Reports of full campaigns reach gigabytes and compress well. Writing
+// them compressed must not cost anything downstream: every command
+// reading reports must take compressed ones as they are.
+// -----------------------------------------------------------------------------
+
+func TestCompressedReports_RoundTrip(t *testing.T) {
+	names := []string{"report.json", "report.json.gz", "report.json.zst"}
+	report := filterTestReport()
+
+	for _, name := range names {
+		path := filepath.Join(t.TempDir(), name)
+		require.NoError(t, writeReportFile(path, report), name)
+
+		loaded, err := loadReport(path)
+		require.NoError(t, err, name)
+		assert.Equal(t, report.Results, loaded.Results, name)
+		assert.Empty(t, validateReport(loaded), name)
+	}
+}
+
+func TestCompressedReports_NeedNoTool(t *testing.T) {
+	// No zstd tool can be found
+	t.Setenv("PATH", "")
+	path := filepath.Join(t.TempDir(), "report.json.zst")
+	require.NoError(t, writeReportFile(path, filterTestReport()))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(data, zstdMagic))
+
+	_, err = loadReport(path)
+	assert.NoError(t, err)
+}
+
+func TestCompressedReports_AreSmaller(t *testing.T) {
+	report := filterTestReport()
+	for i := 0; i < 100; i++ {
+		report.Results = append(report.Results, report.Results[0])
+	}
+	dir := t.TempDir()
+	require.NoError(t, writeReportFile(filepath.Join(dir, "report.json"), report))
+	require.NoError(t, writeReportFile(filepath.Join(dir, "report.json.gz"), report))
+
+	plain, err := os.Stat(filepath.Join(dir, "report.json"))
+	require.NoError(t, err)
+	compressed, err := os.Stat(filepath.Join(dir, "report.json.gz"))
+	require.NoError(t, err)
+	assert.Less(t, compressed.Size()*5, plain.Size())
+}
+
+func TestCompressedReports_MergeShards(t *testing.T) {
+	dir := t.TempDir()
+	paths := []string{filepath.Join(dir, "0.json.gz"), filepath.Join(dir, "1.json")}
+	for i, path := range paths {
+		shard := filterTestReport()
+		shard.Shard = &ShardInfo{Index: i, Count: 2}
+		require.NoError(t, writeReportFile(path, shard))
+	}
+
+	merged := filepath.Join(dir, "merged.json.gz")
+	require.Equal(t, 0, runMergeCommand(append([]string{"--output", merged}, paths...)))
+	report, err := loadReport(merged)
+	require.NoError(t, err)
+	assert.Equal(t, 6, report.TotalFiles)
+}
+
+// -----------------------------------------------------------------------------
+// TEST: Atomic Report Writes
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// A fuzzer killed while writing its report must not leave a truncated
+// JSON file behind for CI to choke on. The report appears complete or not
+// at all, and an earlier report stays intact until then.
+// -----------------------------------------------------------------------------
+
+func TestAtomicReports_ReplaceOnlyWhenComplete(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "report.json")
+	require.NoError(t, os.WriteFile(path, []byte("previous"), 0o644))
+
+	// A report that cannot be encoded leaves the previous one in place
+	broken := filterTestReport()
+	broken.Config = map[string]interface{}{"bad": func() {}}
+	assert.Error(t, writeReportFile(path, broken))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "previous", string(data))
+
+	require.NoError(t, writeReportFile(path, filterTestReport()))
+	_, err = loadReport(path)
+	assert.NoError(t, err)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "temporary files are cleaned up")
+}
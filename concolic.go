@@ -0,0 +1,346 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/mrhapile/WASM-Injection-Framework/internal/wasmbin"
+)
+
+// Comparison log layout in the coverage memory, after the directed
+// feedback page: one slot per comparison site holding both operands of
+// its last execution, as i64s, then a flag set when it ran
+const (
+	comparisonLogPages = 4
+	comparisonSlotSize = 24
+	maxComparisonSites = comparisonLogPages * wasmPageSize / comparisonSlotSize
+)
+
+// Concolic solving defaults
+const (
+	defaultConcolicStall = 64
+	// maxConcolicCandidates caps the inputs solved in one round
+	maxConcolicCandidates = 64
+)
+
+// ConcolicConfig solves the comparisons argument fuzzing is stuck on. When
+// coverage stalls, the comparisons an input runs are observed while each
+// of its arguments is nudged, and those whose operands follow an argument
+// are solved for the argument values making them equal, or off by one.
+type ConcolicConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Stall is how many inputs in a row may reach no new edge before
+	// comparisons are solved, 64 when unset
+	Stall int `yaml:"stall"`
+}
+
+// ConcolicSummary reports what solving comparisons brought
+type ConcolicSummary struct {
+	// Rounds counts the times coverage stalled and comparisons were
+	// solved
+	Rounds int `json:"rounds"`
+	// Candidates counts the inputs solved, and NewEdges those that
+	// reached a new edge
+	Candidates int `json:"candidates"`
+	NewEdges   int `json:"new_edges"`
+}
+
+// comparisonOperands are the operands of one execution of a comparison
+type comparisonOperands struct {
+	a, b int64
+}
+
+// comparisonLog instruments the integer comparisons of every body to log
+// their operands
+type comparisonLog struct {
+	layout *coverageLayout
+	params []uint32
+}
+
+// hooks returns the probes to insert ahead of a body's instructions,
+// after those of next. Bodies with comparisons get scratch locals for the
+// operands.
+func (l *comparisonLog) hooks(body *wasmFunctionBody, index int, memoryIndex uint32, next func(wasmbin.Instruction) []byte) (func(wasmbin.Instruction) []byte, error) {
+	if index >= len(l.params) {
+		return nil, fmt.Errorf("function body %d has no declaration", index)
+	}
+	locals, declared := uint32(0), false
+	return func(instr wasmbin.Instruction) []byte {
+		var out []byte
+		if next != nil {
+			out = next(instr)
+		}
+		if !isGuardComparison(instr.Opcode) || len(l.layout.wide) >= maxComparisonSites {
+			return out
+		}
+		if !declared {
+			count, err := body.localCount()
+			if err != nil {
+				return out
+			}
+			// Two i32 scratch locals followed by two i64 ones
+			if body.addLocals(0x7f, 2) != nil || body.addLocals(0x7e, 2) != nil {
+				return out
+			}
+			locals, declared = l.params[index]+count, true
+		}
+		site := len(l.layout.wide)
+		wide := instr.Opcode >= opI64Eqz
+		l.layout.wide = append(l.layout.wide, wide)
+		address := uint32(2*coverageMapSize + site*comparisonSlotSize)
+		return append(out, comparisonLogProbe(instr.Opcode, address, locals, memoryIndex)...)
+	}, nil
+}
+
+// comparisonLogProbe stores a comparison's operands left on the stack into
+// its slot, i32s sign-extended and the missing operand of eqz as zero,
+// flags the slot, then pushes the operands back. locals is the first of
+// two i32 and two i64 scratch locals.
+func comparisonLogProbe(op byte, address, locals, memoryIndex uint32) []byte {
+	a, b := locals, locals+1
+	wide := op >= opI64Eqz
+	if wide {
+		a, b = locals+2, locals+3
+	}
+	unary := op == opI32Eqz || op == opI64Eqz
+
+	local := func(out []byte, op byte, index uint32) []byte {
+		return wasmbin.AppendU32(append(out, op), index)
+	}
+	store := func(out []byte, offset uint32, operand uint32, present bool) []byte {
+		out = wasmbin.AppendS32(append(out, opI32Const), int32(address+offset))
+		if !present {
+			out = append(out, opI64Const, 0x00)
+		} else {
+			out = local(out, opLocalGet, operand)
+			if !wide {
+				out = append(out, opI64ExtendS)
+			}
+		}
+		return coverageMemArg(append(out, opI64Store), memoryIndex)
+	}
+
+	var out []byte
+	if !unary {
+		out = local(out, opLocalSet, b)
+	}
+	out = local(out, opLocalSet, a)
+	out = store(out, 0, a, true)
+	out = store(out, 8, b, !unary)
+	out = wasmbin.AppendS32(append(out, opI32Const), int32(address+16))
+	out = append(out, opI32Const, 0x01)
+	out = coverageMemArg(append(out, opI32Store), memoryIndex)
+
+	// Restore the operands for the original comparison
+	out = local(out, opLocalGet, a)
+	if !unary {
+		out = local(out, opLocalGet, b)
+	}
+	return out
+}
+
+// readComparisons keeps the operands of the comparisons one execution ran
+func (t *coverageTracker) readComparisons(region []byte) {
+	t.comparisons = make(map[int]comparisonOperands)
+	for site := range t.layout.wide {
+		slot := site * comparisonSlotSize
+		if slot+comparisonSlotSize > len(region) || region[slot+16] == 0 {
+			continue
+		}
+		t.comparisons[site] = comparisonOperands{
+			a: int64(binary.LittleEndian.Uint64(region[slot:])),
+			b: int64(binary.LittleEndian.Uint64(region[slot+8:])),
+		}
+	}
+}
+
+// What the input a concolicSolver handed out is for
+const (
+	concolicNone = iota
+	concolicProbe
+	concolicCandidate
+)
+
+// concolicSolver feeds argument fuzzing the inputs solved from logged
+// comparisons once coverage stalls. A nil solver feeds none.
+type concolicSolver struct {
+	stall    int
+	coverage *coverageTracker
+	summary  ConcolicSummary
+
+	// idle counts the inputs in a row that reached no new edge, and base
+	// is the last input that did, or the first probed when none did
+	idle int
+	base []int32
+	// probes are the base and its nudged copies queued to be observed,
+	// and observed the comparisons each ran
+	probes   [][]int32
+	observed []map[int]comparisonOperands
+	// queue holds the inputs to run next, and current what the input
+	// last handed out is for
+	queue   [][]int32
+	kinds   []int
+	current int
+	// tried are the candidates queued so far, and probed the bases
+	tried  map[string]bool
+	probed map[string]bool
+}
+
+// newConcolicSolver returns the solver of a file, or nil when solving is
+// disabled or the module does not log its comparisons
+func newConcolicSolver(config ConcolicConfig, coverage *coverageTracker) *concolicSolver {
+	if !config.Enabled || coverage == nil || coverage.layout == nil || !coverage.layout.logsComparisons {
+		return nil
+	}
+	stall := config.Stall
+	if stall <= 0 {
+		stall = defaultConcolicStall
+	}
+	return &concolicSolver{stall: stall, coverage: coverage, tried: make(map[string]bool), probed: make(map[string]bool)}
+}
+
+// next returns the next queued input, or nil when none is
+func (s *concolicSolver) next() []interface{} {
+	if s == nil || len(s.queue) == 0 {
+		return nil
+	}
+	input := s.queue[0]
+	s.current = s.kinds[0]
+	s.queue, s.kinds = s.queue[1:], s.kinds[1:]
+	return i32Values(input)
+}
+
+// observe learns from the outcome of an input, with the comparisons it
+// ran in the coverage tracker. Inputs that are not i32 vectors are not
+// solved for.
+func (s *concolicSolver) observe(args []interface{}, newEdges bool) {
+	if s == nil {
+		return
+	}
+	kind := s.current
+	s.current = concolicNone
+	input := int32Vector(args)
+	if input == nil {
+		return
+	}
+
+	switch kind {
+	case concolicProbe:
+		s.observed = append(s.observed, s.coverage.comparisons)
+		if len(s.observed) == len(s.probes) {
+			s.solve()
+		}
+	case concolicCandidate:
+		if newEdges {
+			s.summary.NewEdges++
+		}
+	}
+	if newEdges {
+		s.idle, s.base = 0, input
+		return
+	}
+	s.idle++
+	if s.idle < s.stall || len(s.queue) > 0 || len(input) == 0 {
+		return
+	}
+
+	// Coverage stalled: observe the base, then the base with each
+	// argument nudged by one. A base is only probed once, as its
+	// comparisons do not change.
+	if s.base == nil {
+		s.base = input
+	}
+	base := s.base
+	s.idle = 0
+	if s.probed[fmt.Sprint(base)] {
+		return
+	}
+	s.probed[fmt.Sprint(base)] = true
+	s.summary.Rounds++
+	s.probes, s.observed = [][]int32{base}, nil
+	for i := range base {
+		nudged := append([]int32(nil), base...)
+		nudged[i]++
+		s.probes = append(s.probes, nudged)
+	}
+	for _, probe := range s.probes {
+		s.enqueue(probe, concolicProbe)
+	}
+}
+
+func (s *concolicSolver) enqueue(input []int32, kind int) {
+	s.queue = append(s.queue, input)
+	s.kinds = append(s.kinds, kind)
+}
+
+// solve queues candidates for the comparisons whose operand moved with a
+// nudged argument while the other stayed. Such an operand is taken to be
+// linear in the argument, which is then solved to make it equal to the
+// other operand, or off by one either way.
+func (s *concolicSolver) solve() {
+	base, observed := s.probes[0], s.observed[0]
+	sites := make([]int, 0, len(observed))
+	for site := range observed {
+		sites = append(sites, site)
+	}
+	sort.Ints(sites)
+
+	candidates := 0
+	for arg := range base {
+		nudged := s.observed[arg+1]
+		for _, site := range sites {
+			wide := s.coverage.layout.wide[site]
+			after, ok := nudged[site]
+			if !ok {
+				continue
+			}
+			operands := observed[site]
+			da := operandDelta(after.a, operands.a, wide)
+			db := operandDelta(after.b, operands.b, wide)
+			var moving, fixed, slope int64
+			switch {
+			case da != 0 && db == 0:
+				moving, fixed, slope = operands.a, operands.b, da
+			case db != 0 && da == 0:
+				moving, fixed, slope = operands.b, operands.a, db
+			default:
+				continue
+			}
+			for _, goal := range []int64{fixed, fixed + 1, fixed - 1} {
+				delta := operandDelta(goal, moving, wide)
+				if delta%slope != 0 || candidates >= maxConcolicCandidates {
+					continue
+				}
+				candidate := append([]int32(nil), base...)
+				candidate[arg] = int32(int64(base[arg]) + delta/slope)
+				key := fmt.Sprint(candidate)
+				if s.tried[key] {
+					continue
+				}
+				s.tried[key] = true
+				s.enqueue(candidate, concolicCandidate)
+				candidates++
+			}
+		}
+	}
+	s.summary.Candidates += candidates
+	s.probes, s.observed = nil, nil
+}
+
+// operandDelta returns x - y in the width of the comparison
+func operandDelta(x, y int64, wide bool) int64 {
+	if wide {
+		return x - y
+	}
+	return int64(int32(x - y))
+}
+
+// report returns the solver's summary, nil without a solver
+func (s *concolicSolver) report() *ConcolicSummary {
+	if s == nil {
+		return nil
+	}
+	summary := s.summary
+	return &summary
+}
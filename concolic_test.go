@@ -0,0 +1,181 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mrhapile/WASM-Injection-Framework/internal/wasmbin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// concolicMagic is what twice the argument plus 10 must equal to reach the
+// mock module's branch. It is not in the module, so the dictionary cannot
+// guess it.
+const concolicMagic = 0x7a5e
+
+// concolicMockModule stands in for an instrumented module whose only
+// comparison is arg*2+10 == concolicMagic, logging it as comparison 0
+type concolicMockModule struct {
+	MockWasmModule
+	arg int32
+	ran bool
+}
+
+func (m *concolicMockModule) Execute(funcName string, args ...interface{}) ([]interface{}, error) {
+	m.arg, m.ran = args[0].(int32), true
+	return []interface{}{int32(0)}, nil
+}
+
+func (m *concolicMockModule) TakeCoverage() ([]byte, error) {
+	trace := make([]byte, (2+comparisonLogPages)*coverageMapSize)
+	if !m.ran {
+		return trace, nil
+	}
+	m.ran = false
+	a := m.arg*2 + 10
+	trace[1] = 1
+	if a == concolicMagic {
+		trace[2] = 1
+	}
+	slot := trace[2*coverageMapSize:]
+	binary.LittleEndian.PutUint64(slot, uint64(int64(a)))
+	binary.LittleEndian.PutUint64(slot[8:], concolicMagic)
+	slot[16] = 1
+	return trace, nil
+}
+
+// -----------------------------------------------------------------------------
+// TEST: Concolic Argument Solving
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Random mutation rarely guesses the exact value a comparison wants, so
+// coverage stalls in front of it. Logging the operands of comparisons
+// lets the fuzzer see how they follow the arguments and solve for the
+// value reaching the other branch.
+// -----------------------------------------------------------------------------
+
+func TestConcolic_LogsComparisons(t *testing.T) {
+	instrumented, layout, err := instrumentEdges(buildTestModule(magicBody, false), nil, true)
+	require.NoError(t, err)
+
+	require.NotNil(t, layout)
+	assert.True(t, layout.logsComparisons)
+	assert.Equal(t, []bool{false}, layout.wide, "one i32 comparison")
+	assert.Empty(t, layout.targets)
+
+	module, err := parseWasmBinary(instrumented)
+	require.NoError(t, err)
+	bodies, err := parseCodeSection(module.section(sectionCode).Payload)
+	require.NoError(t, err)
+	locals, err := bodies[0].localCount()
+	require.NoError(t, err)
+	assert.Equal(t, uint32(4), locals)
+	_, err = wasmbin.DecodeInstructions(bodies[0].Code)
+	assert.NoError(t, err)
+}
+
+func TestConcolic_BodiesWithoutDeclarationsFailInstrumentation(t *testing.T) {
+	module, err := parseWasmBinary(buildTestModule(magicBody, false))
+	require.NoError(t, err)
+	var sections []wasmSection
+	for _, section := range module.Sections {
+		if section.ID != sectionFunction {
+			sections = append(sections, section)
+		}
+	}
+	module.Sections = sections
+
+	_, _, err = instrumentEdges(module.encode(), nil, true)
+	assert.EqualError(t, err, "function body 0 has no declaration")
+}
+
+func TestConcolic_ProbeRestoresOperands(t *testing.T) {
+	// i64.lt_s; locals start at 1, after the single parameter
+	instructions, err := wasmbin.DecodeInstructions(comparisonLogProbe(0x53, 2*coverageMapSize, 1, 0))
+	require.NoError(t, err)
+	first, last := instructions[:2], instructions[len(instructions)-2:]
+
+	assert.Equal(t, []byte{opLocalSet, opLocalSet}, []byte{first[0].Opcode, first[1].Opcode})
+	assert.Equal(t, []uint32{4, 3}, []uint32{first[0].Index, first[1].Index}, "i64 operands use the i64 locals")
+	assert.Equal(t, []byte{opLocalGet, opLocalGet}, []byte{last[0].Opcode, last[1].Opcode})
+	assert.Equal(t, []uint32{3, 4}, []uint32{last[0].Index, last[1].Index})
+}
+
+func TestConcolic_SolvesLinearComparisons(t *testing.T) {
+	tracker := newCoverageTracker()
+	tracker.setLayout(&coverageLayout{logsComparisons: true, wide: []bool{false}})
+	solver := newConcolicSolver(ConcolicConfig{Enabled: true, Stall: 2}, tracker)
+	require.NotNil(t, solver)
+
+	var reached []int32
+	for i := 0; i < 16 && reached == nil; i++ {
+		args := solver.next()
+		if args == nil {
+			args = i32Values([]int32{5})
+		}
+		a := args[0].(int32)*2 + 10
+		tracker.comparisons = map[int]comparisonOperands{0: {a: int64(a), b: concolicMagic}}
+		hit := a == concolicMagic
+		solver.observe(args, i == 0 || hit)
+		if hit {
+			reached = int32Vector(args)
+		}
+	}
+
+	assert.Equal(t, []int32{(concolicMagic - 10) / 2}, reached)
+	summary := solver.report()
+	assert.Equal(t, 1, summary.Rounds)
+	assert.Equal(t, 1, summary.NewEdges)
+}
+
+func TestConcolic_IgnoresUnrelatedComparisons(t *testing.T) {
+	tracker := newCoverageTracker()
+	tracker.setLayout(&coverageLayout{logsComparisons: true, wide: []bool{true}})
+	solver := newConcolicSolver(ConcolicConfig{Enabled: true, Stall: 1}, tracker)
+
+	tracker.comparisons = map[int]comparisonOperands{0: {a: 3, b: 9}}
+	solver.observe(i32Values([]int32{1, 2}), false)
+	for i := 0; i < 3; i++ {
+		args := solver.next()
+		require.NotNil(t, args, "the base and both nudged inputs are probed")
+		solver.observe(args, false)
+	}
+	summary := solver.report()
+	assert.Equal(t, 1, summary.Rounds)
+	assert.Zero(t, summary.Candidates, "operands that do not follow an argument are not solved")
+}
+
+func TestConcolic_DisabledWithoutComparisonLog(t *testing.T) {
+	tracker := newCoverageTracker()
+	assert.Nil(t, newConcolicSolver(ConcolicConfig{Enabled: true}, tracker))
+	assert.Nil(t, newConcolicSolver(ConcolicConfig{Enabled: true}, nil))
+	assert.Nil(t, (*concolicSolver)(nil).report())
+}
+
+func TestConcolic_ArgFuzzingReachesSolvedBranch(t *testing.T) {
+	module := &concolicMockModule{}
+	runtime := &MockWasmRuntime{
+		LoadModuleFunc: func(filePath string) (WasmModule, error) { return module, nil },
+	}
+	path := filepath.Join(t.TempDir(), "magic.wasm")
+	require.NoError(t, os.WriteFile(path, buildTestModule(magicBody, false), 0o644))
+
+	result := processWasmFileWithOptions(path, runtime, RunOptions{
+		Invocation: InvocationConfig{Entry: "process"},
+		Coverage:   CoverageConfig{Enabled: true},
+		ArgFuzz:    ArgFuzzConfig{Iterations: 200, Seed: 1, Concolic: ConcolicConfig{Enabled: true, Stall: 16}},
+	})
+
+	require.NotNil(t, result.ArgFuzz)
+	require.NotNil(t, result.ArgFuzz.Concolic)
+	assert.NotZero(t, result.ArgFuzz.Concolic.Rounds)
+	assert.NotZero(t, result.ArgFuzz.Concolic.NewEdges, "the solved input reaches the branch")
+	assert.Equal(t, 2, result.Coverage.Edges)
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the campaign configuration loaded from a YAML file
+type Config struct {
+	Matrix     MatrixConfig     `yaml:"matrix"`
+	Invocation InvocationConfig `yaml:"invocation"`
+	ArgFuzz    ArgFuzzConfig    `yaml:"arg_fuzz"`
+	Coverage   CoverageConfig   `yaml:"coverage"`
+	Corpus     CorpusConfig     `yaml:"corpus"`
+	StopAfter  FailureStage     `yaml:"stop_after"`
+	// TrackMemory warns when memory grows steadily over the campaign
+	TrackMemory bool `yaml:"track_memory"`
+	// DebugResources reports runtime objects leaked by each file
+	DebugResources bool `yaml:"debug_resources"`
+	// HangTimeout is how long a file may make no progress, such as "30s"
+	HangTimeout time.Duration `yaml:"hang_timeout"`
+	// Isolate runs files in worker subprocesses
+	Isolate bool `yaml:"isolate"`
+	// LargeModules isolates modules above a size with stricter limits
+	LargeModules LargeModuleConfig `yaml:"large_modules"`
+	// Restart backs off restarting isolated workers that keep dying
+	Restart RestartConfig `yaml:"restart"`
+	// Sanitizer runs isolated workers against a sanitized runtime library
+	Sanitizer SanitizerConfig `yaml:"sanitizer"`
+	// Crashes keeps bundles of the hard crashes of isolated workers
+	Crashes CrashConfig `yaml:"crashes"`
+	// MemoryPressure starves workers of memory during some stages
+	MemoryPressure MemoryPressureConfig `yaml:"memory_pressure"`
+	// Redaction caps and scrubs error messages before results are written
+	Redaction RedactionConfig `yaml:"redaction"`
+	// Classifiers are triage rules consulted before the default classifier
+	Classifiers []ClassifierRule `yaml:"classifiers"`
+	// DataSegments plants bytes in every module's memory at instantiation
+	DataSegments []DataSegmentConfig `yaml:"data_segments"`
+	// Tamper overrides the initial values of globals and table slots
+	Tamper TamperConfig `yaml:"tamper"`
+	// Chaos ramps host call faults up over the campaign
+	Chaos ChaosConfig `yaml:"chaos"`
+	// CompareClean also runs every file without injections, reporting
+	// only how the runs differ
+	CompareClean bool `yaml:"compare_clean"`
+	// Quarantine sets apart modules whose outcome is not reproducible
+	Quarantine QuarantineConfig `yaml:"quarantine"`
+	// Cache reuses the results of unchanged files across campaigns
+	Cache CacheConfig `yaml:"cache"`
+	// Taint tracks host-written data to sensitive sinks (experimental)
+	Taint TaintConfig `yaml:"taint"`
+	// Intercept routes the calls modules make to chosen functions of their
+	// own through a hook, which can make them trap
+	Intercept InterceptConfig `yaml:"intercept"`
+	// Sequence fuzzes orderings of export calls, such as open, write, close
+	Sequence SequenceConfig `yaml:"sequence"`
+	// Properties are claims about exports checked with shrinking
+	Properties []PropertyConfig `yaml:"properties"`
+	// Determinism runs every file this many times, reporting the files
+	// whose runs differ
+	Determinism int `yaml:"determinism"`
+	// FloatComparison tolerates NaN payloads or rounding when runs are
+	// compared
+	FloatComparison FloatComparison `yaml:"float_comparison"`
+	// MaxFailures and CircuitBreaker abort campaigns failing too much
+	MaxFailures    int                  `yaml:"max_failures"`
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuit_breaker"`
+	// MaxDuration time-boxes the campaign, running first the files the
+	// History file says are most likely to fail
+	MaxDuration time.Duration `yaml:"max_duration"`
+	History     string        `yaml:"history"`
+	// Heartbeat reports progress to orchestrators restarting wedged
+	// campaigns
+	Heartbeat HeartbeatConfig `yaml:"heartbeat"`
+	// Ownership writes a report per team owning files, and notifies them
+	Ownership OwnershipConfig `yaml:"ownership"`
+}
+
+// runOptions returns the pipeline settings the config selects
+func (c Config) runOptions() RunOptions {
+	return RunOptions{Invocation: c.Invocation, ArgFuzz: c.ArgFuzz, Coverage: c.Coverage, Corpus: c.Corpus, StopAfter: c.StopAfter, TrackMemory: c.TrackMemory, DebugResources: c.DebugResources, HangTimeout: c.HangTimeout, LargeModules: c.LargeModules, Restart: c.Restart, Sanitizer: c.Sanitizer, Crashes: c.Crashes, MemoryPressure: c.MemoryPressure, Redaction: c.Redaction, Classifiers: c.Classifiers, DataSegments: c.DataSegments, Tamper: c.Tamper, Chaos: c.Chaos, CompareClean: c.CompareClean, Quarantine: c.Quarantine, Cache: c.Cache, Taint: c.Taint, Intercept: c.Intercept, Sequence: c.Sequence, Properties: c.Properties, Determinism: c.Determinism, FloatComparison: c.FloatComparison, MaxFailures: c.MaxFailures, CircuitBreaker: c.CircuitBreaker, MaxDuration: c.MaxDuration, History: c.History, Heartbeat: c.Heartbeat, Ownership: c.Ownership, Hooks: campaignHooks()}
+}
+
+// envPrefix starts the names of the environment variables setting config
+// keys. Nested keys are joined by a double underscore, so
+// WASM_FUZZER_CORPUS__MAX_FILE_SIZE sets corpus.max_file_size.
+const envPrefix = "WASM_FUZZER_"
+
+// resolveConfig layers the config file, when given, and the environment
+// variables setting config keys over the defaults. Flags are applied last
+// by each command.
+func resolveConfig(path string) (Config, error) {
+	var config Config
+	if path != "" {
+		var err error
+		if config, err = loadConfig(path); err != nil {
+			return config, err
+		}
+	}
+	if err := applyEnvConfig(&config, os.Environ()); err != nil {
+		return config, err
+	}
+	return config, nil
+}
+
+// applyEnvConfig sets the config keys named by environment variables. Each
+// value is parsed as YAML, so lists such as "[simd, threads]" can be set.
+func applyEnvConfig(config *Config, environ []string) error {
+	environ = append([]string(nil), environ...)
+	sort.Strings(environ)
+	for _, entry := range environ {
+		name, value, _ := strings.Cut(entry, "=")
+		if !strings.HasPrefix(name, envPrefix) {
+			continue
+		}
+		path := strings.Split(strings.ToLower(strings.TrimPrefix(name, envPrefix)), "__")
+		if closest, ok := checkConfigPath(reflect.TypeOf(*config), path); !ok {
+			if closest != nil {
+				return fmt.Errorf("unknown environment variable %s, did you mean %s?", name, envPrefix+strings.ToUpper(strings.Join(closest, "__")))
+			}
+			return fmt.Errorf("unknown environment variable %s", name)
+		}
+
+		var override interface{}
+		if err := yaml.Unmarshal([]byte(value), &override); err != nil {
+			return fmt.Errorf("invalid value of %s: %w", name, err)
+		}
+		for i := len(path) - 1; i >= 0; i-- {
+			override = map[string]interface{}{path[i]: override}
+		}
+		data, err := yaml.Marshal(override)
+		if err == nil {
+			err = yaml.Unmarshal(data, config)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid value of %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// resolved returns the config as a generic map, which reports embed to
+// record what a campaign ran with
+func (c Config) resolved() map[string]interface{} {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return nil
+	}
+	var resolved map[string]interface{}
+	if err := yaml.Unmarshal(data, &resolved); err != nil {
+		return nil
+	}
+	return resolved
+}
+
+// loadConfig reads and parses a YAML campaign config
+func loadConfig(path string) (Config, error) {
+	var config Config
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("failed to read config: %w", err)
+	}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("failed to parse config: %w", err)
+	}
+	if err := checkConfigKeys(data, reflect.TypeOf(config)); err != nil {
+		return config, fmt.Errorf("invalid config: %w", err)
+	}
+	return config, nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// yamlUnmarshaler is implemented by config types decoding themselves,
+// whose keys are theirs to check
+var yamlUnmarshaler = reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()
+
+// checkConfigKeys reports every key of a YAML document that no field of
+// the type it decodes into takes. yaml.v3 silently drops such keys, so a
+// misspelled setting would otherwise quietly keep its default.
+func checkConfigKeys(data []byte, t reflect.Type) error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	var problems []string
+	for _, node := range doc.Content {
+		problems = append(problems, unknownKeys(node, t, "")...)
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(problems, "; "))
+}
+
+// unknownKeys walks a node along the type it decodes into
+func unknownKeys(node *yaml.Node, t reflect.Type, path string) []string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if reflect.PointerTo(t).Implements(yamlUnmarshaler) {
+		return nil
+	}
+
+	var problems []string
+	switch {
+	case t.Kind() == reflect.Struct && node.Kind == yaml.MappingNode:
+		fields := yamlFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			field, ok := fields[key.Value]
+			if !ok {
+				problems = append(problems, unknownKeyProblem(key, path, fields))
+				continue
+			}
+			problems = append(problems, unknownKeys(value, field, path+key.Value+".")...)
+		}
+	case (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && node.Kind == yaml.SequenceNode:
+		for i, item := range node.Content {
+			problems = append(problems, unknownKeys(item, t.Elem(), fmt.Sprintf("%s%d.", path, i))...)
+		}
+	case t.Kind() == reflect.Map && node.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			problems = append(problems, unknownKeys(node.Content[i+1], t.Elem(), path+node.Content[i].Value+".")...)
+		}
+	}
+	return problems
+}
+
+// yamlFields maps the keys of a struct to the types of their fields, the
+// way yaml.v3 names them
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
+
+// unknownKeyProblem describes an unknown key, suggesting the closest known
+// one when it looks like a typo of it
+func unknownKeyProblem(key *yaml.Node, path string, fields map[string]reflect.Type) string {
+	problem := fmt.Sprintf("unknown key '%s%s' at line %d", path, key.Value, key.Line)
+	if closest := closestKey(key.Value, fields); closest != "" {
+		problem += fmt.Sprintf(", did you mean '%s'?", closest)
+	}
+	return problem
+}
+
+// closestKey returns the known key an unknown one looks like a typo of,
+// or "" when none is close enough
+func closestKey(key string, fields map[string]reflect.Type) string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	best, bestDistance := "", max(2, len(key)/4)
+	for _, name := range names {
+		if d := editDistance(key, name); d <= bestDistance && (best == "" || d < editDistance(key, best)) {
+			best = name
+		}
+	}
+	return best
+}
+
+// checkConfigPath checks that a path of keys leads somewhere in the type
+// it decodes into, returning the path most likely meant when it does not
+func checkConfigPath(t reflect.Type, path []string) ([]string, bool) {
+	for i, key := range path {
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		switch {
+		case t.Kind() == reflect.Map:
+			t = t.Elem()
+		case t.Kind() == reflect.Struct && !reflect.PointerTo(t).Implements(yamlUnmarshaler):
+			fields := yamlFields(t)
+			field, ok := fields[key]
+			if !ok {
+				closest := closestKey(key, fields)
+				if closest == "" {
+					return nil, false
+				}
+				return append(append(append([]string(nil), path[:i]...), closest), path[i+1:]...), false
+			}
+			t = field
+		default:
+			return nil, false
+		}
+	}
+	return nil, true
+}
+
+// editDistance is the Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
@@ -0,0 +1,152 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+// -----------------------------------------------------------------------------
+// TEST: Config Keys
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// A misspelled key is dropped by the YAML decoder, so the setting keeps its
+// default and the campaign runs as if it had never been made. Every key
+// must be one the config takes, and a typo should point at the key meant.
+// -----------------------------------------------------------------------------
+
+func TestConfigKeys_ReportsTyposWithLineAndSuggestion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "campaign.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+invocation:
+  entyr: run
+  inputs:
+    - [1, 2]
+chaos:
+  phases:
+    - name: ramp
+      rmap_to: 0.5
+stop_afer: validate
+colour: blue
+`), 0o644))
+
+	_, err := loadConfig(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown key 'invocation.entyr' at line 3, did you mean 'entry'?")
+	assert.Contains(t, err.Error(), "unknown key 'chaos.phases.0.rmap_to' at line 9, did you mean 'ramp_to'?")
+	assert.Contains(t, err.Error(), "unknown key 'stop_afer' at line 10, did you mean 'stop_after'?")
+	assert.Contains(t, err.Error(), "unknown key 'colour' at line 11")
+	assert.NotContains(t, err.Error(), "'colour' at line 11, did you mean")
+}
+
+func TestConfigKeys_AcceptsKnownKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "campaign.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+matrix:
+  proposals: [[simd]]
+invocation:
+  entry: run
+  inputs:
+    - [{type: i32, value: 1}]
+corpus:
+  max_file_size: 1MiB
+hang_timeout: 30s
+circuit_breaker:
+  failure_rate: 0.5
+`), 0o644))
+
+	_, err := loadConfig(path)
+	assert.NoError(t, err)
+}
+
+func TestConfigKeys_EditDistance(t *testing.T) {
+	assert.Equal(t, 0, editDistance("timeout", "timeout"))
+	assert.Equal(t, 1, editDistance("timout", "timeout"))
+	assert.Equal(t, 2, editDistance("entyr", "entry"))
+	assert.Equal(t, 3, editDistance("", "abc"))
+}
+
+// -----------------------------------------------------------------------------
+// TEST: Config Layering
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// CI jobs tweak a shared config through the environment rather than
+// copies of the file. Environment variables must override the file
+// without clearing the keys they leave alone, and the resolved config must
+// read back as the same config, or a report cannot be reproduced from it.
+// -----------------------------------------------------------------------------
+
+func TestConfigLayering_EnvironmentOverridesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "campaign.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+invocation:
+  entry: run
+  inputs: [[1, 2]]
+corpus:
+  max_file_size: 1MiB
+  seed: 3
+`), 0o644))
+	config, err := loadConfig(path)
+	require.NoError(t, err)
+
+	require.NoError(t, applyEnvConfig(&config, []string{
+		"HOME=/root",
+		"WASM_FUZZER_CORPUS__SEED=9",
+		"WASM_FUZZER_MATRIX__PROPOSALS=[[simd, threads]]",
+		"WASM_FUZZER_HANG_TIMEOUT=30s",
+	}))
+	assert.Equal(t, "run", config.Invocation.Entry)
+	assert.Equal(t, ByteSize(1<<20), config.Corpus.MaxFileSize)
+	assert.Equal(t, int64(9), config.Corpus.Seed)
+	assert.Equal(t, [][]string{{"simd", "threads"}}, config.Matrix.Proposals)
+	assert.Equal(t, 30*time.Second, config.HangTimeout)
+}
+
+func TestConfigLayering_RejectsUnknownVariables(t *testing.T) {
+	var config Config
+	err := applyEnvConfig(&config, []string{"WASM_FUZZER_CORPUS__SEDE=1"})
+	assert.EqualError(t, err, "unknown environment variable WASM_FUZZER_CORPUS__SEDE, did you mean WASM_FUZZER_CORPUS__SEED?")
+
+	err = applyEnvConfig(&config, []string{"WASM_FUZZER_STOP_AFTER__STAGE=load"})
+	assert.EqualError(t, err, "unknown environment variable WASM_FUZZER_STOP_AFTER__STAGE")
+}
+
+func TestConfigLayering_ResolvedConfigReadsBack(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "campaign.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+invocation:
+  entry: run
+  inputs:
+    - [1, {type: i64, value: "5"}]
+    - [[1, 2]]
+corpus:
+  max_file_size: 1MiB
+hang_timeout: 30s
+`), 0o644))
+	config, err := loadConfig(path)
+	require.NoError(t, err)
+
+	data, err := yaml.Marshal(config)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+	reloaded, err := loadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, config.Invocation.Inputs, reloaded.Invocation.Inputs)
+	again, err := yaml.Marshal(reloaded)
+	require.NoError(t, err)
+	assert.Equal(t, string(data), string(again))
+
+	resolved := config.resolved()
+	assert.Equal(t, "30s", resolved["hang_timeout"])
+	assert.Equal(t, "run", resolved["invocation"].(map[string]interface{})["entry"])
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// defaultContractMessage is the message sent to contracts without inputs
+const defaultContractMessage = "{}"
+
+// ContractConfig configures the chain smart contracts run against
+type ContractConfig struct {
+	// Address is the contract's own address or account ID, and Sender the
+	// account calling it; each platform has defaults that pass its checks
+	Address string `yaml:"address"`
+	Sender  string `yaml:"sender"`
+	// Funds are the tokens attached to every call: CosmWasm coins such as
+	// "100uatom,5ujuno", or a NEAR deposit in yoctoNEAR
+	Funds string `yaml:"funds"`
+	// InitEntry and Init are the initializer called once the contract is
+	// loaded and its message
+	InitEntry string `yaml:"init_entry"`
+	Init      string `yaml:"init"`
+	// Storage is the contract's storage before initialization
+	Storage map[string]string `yaml:"storage"`
+	// FailOnError reports calls the contract rejects as failures; by
+	// default only traps and panics are failures
+	FailOnError bool `yaml:"fail_on_error"`
+}
+
+// contractPlatform is a smart-contract platform whose host the fuzzer
+// provides. Platforms are registered in contractPlatforms by ABI name.
+type contractPlatform interface {
+	// validate checks an entry point, whose signature is nil when the
+	// runtime does not report it
+	validate(entry string, signature *FuncSignature) error
+	// newKernel creates the host of one contract instance, failing when
+	// the configuration is invalid
+	newKernel(config ContractConfig, storage *contractStorage) (contractKernel, error)
+}
+
+// contractKernel is the host of one contract instance
+type contractKernel interface {
+	// link resolves the contract's imports to host functions
+	link(imports []wasmFuncImport) ([]HostFunction, error)
+	// instantiate checks the contract's exports and runs its initializer
+	instantiate(module WasmModule, memory MemoryModule) error
+	// call runs an entry point with a message. Calls the contract rejects
+	// return a contractError.
+	call(module WasmModule, entry string, msg []byte) error
+}
+
+// contractPlatforms are the smart-contract ABIs by name
+var contractPlatforms = map[string]contractPlatform{
+	ABICosmWasm: cosmWasmPlatform{},
+	ABINear:     nearPlatform{},
+}
+
+// contractError is a call the contract rejected, which reverts its
+// storage writes like a failed transaction
+type contractError struct {
+	message string
+}
+
+func (e *contractError) Error() string {
+	return e.message
+}
+
+// contractStorage is a contract's key-value storage
+type contractStorage struct {
+	data map[string][]byte
+	// baseline holds the storage as it was after initialization
+	baseline map[string][]byte
+}
+
+func newContractStorage(initial map[string]string) *contractStorage {
+	s := &contractStorage{data: make(map[string][]byte, len(initial))}
+	for key, value := range initial {
+		s.data[key] = []byte(value)
+	}
+	return s
+}
+
+func (s *contractStorage) get(key []byte) ([]byte, bool) {
+	value, ok := s.data[string(key)]
+	return value, ok
+}
+
+func (s *contractStorage) set(key, value []byte) {
+	s.data[string(key)] = append([]byte(nil), value...)
+}
+
+func (s *contractStorage) remove(key []byte) {
+	delete(s.data, string(key))
+}
+
+// keys returns the keys in [start, end) in order, where a nil bound is
+// unbounded
+func (s *contractStorage) keys(start, end []byte, descending bool) []string {
+	var keys []string
+	for key := range s.data {
+		if (start == nil || key >= string(start)) && (end == nil || key < string(end)) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	if descending {
+		for i, j := 0, len(keys)-1; i < j; i, j = i+1, j-1 {
+			keys[i], keys[j] = keys[j], keys[i]
+		}
+	}
+	return keys
+}
+
+// size is the bytes the storage holds
+func (s *contractStorage) size() uint64 {
+	var n uint64
+	for key, value := range s.data {
+		n += uint64(len(key) + len(value))
+	}
+	return n
+}
+
+// contractHost tracks the kernel and storage of the contract instance
+// currently loaded
+type contractHost struct {
+	platform contractPlatform
+	config   ContractConfig
+	kernel   contractKernel
+	storage  *contractStorage
+}
+
+// rewind restores the storage as it was after initialization, which a
+// module snapshot cannot capture since it lives in the host
+func (h *contractHost) rewind() {
+	if h != nil && h.storage != nil && h.storage.baseline != nil {
+		h.storage.data = copyVars(h.storage.baseline)
+	}
+}
+
+// call runs an entry point with a message, reverting the storage when the
+// call fails. It returns 0 when the contract accepts the call and 1 when it
+// rejects it.
+func (h *contractHost) call(module WasmModule, entry string, msg []byte) ([]interface{}, error) {
+	saved := copyVars(h.storage.data)
+	err := h.kernel.call(module, entry, msg)
+	if err == nil {
+		return []interface{}{int32(0)}, nil
+	}
+	h.storage.data = saved
+
+	var rejected *contractError
+	if !errors.As(err, &rejected) {
+		return nil, err
+	}
+	if h.config.FailOnError {
+		return nil, &RuntimeError{Stage: StageExecute, Message: fmt.Sprintf("contract returned an error: %s", rejected.message)}
+	}
+	return []interface{}{int32(1)}, nil
+}
+
+// contractRuntime loads contracts with a fresh kernel linked to their
+// imports and initializes them. The wrapped runtime must implement
+// HostLoader.
+type contractRuntime struct {
+	runtime WasmRuntime
+	abi     string
+	host    *contractHost
+}
+
+// LoadModule implements WasmRuntime.LoadModule
+func (r *contractRuntime) LoadModule(filePath string) (WasmModule, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, &RuntimeError{Stage: StageLoad, Message: fmt.Sprintf("load failed: %v", err)}
+	}
+	return r.load(filePath, nil, data)
+}
+
+// LoadModuleBytes implements BufferLoader.LoadModuleBytes
+func (r *contractRuntime) LoadModuleBytes(name string, data []byte) (WasmModule, error) {
+	return r.load(name, data, data)
+}
+
+// load links a new kernel to the imports found in data and initializes
+// the contract on fresh storage
+func (r *contractRuntime) load(filePath string, source, data []byte) (WasmModule, error) {
+	loader, ok := r.runtime.(HostLoader)
+	if !ok {
+		return nil, &RuntimeError{Stage: StageInstantiate, Message: fmt.Sprintf("%s: runtime cannot provide host functions", r.abi)}
+	}
+
+	storage := newContractStorage(r.host.config.Storage)
+	kernel, err := r.host.platform.newKernel(r.host.config, storage)
+	if err != nil {
+		return nil, &RuntimeError{Stage: StageSignature, Message: fmt.Sprintf("%s: %v", r.abi, err)}
+	}
+	host, err := kernel.link(moduleImports(data))
+	if err != nil {
+		return nil, &RuntimeError{Stage: StageInstantiate, Message: fmt.Sprintf("%s: %v", r.abi, err)}
+	}
+	module, err := loader.LoadModuleWithHost(filePath, source, host)
+	if err != nil {
+		return nil, err
+	}
+
+	memory, ok := module.(MemoryModule)
+	if !ok {
+		module.Close()
+		return nil, &RuntimeError{Stage: StageInstantiate, Message: fmt.Sprintf("%s: runtime does not support memory access", r.abi)}
+	}
+	if err := kernel.instantiate(module, memory); err != nil {
+		module.Close()
+		var rejected *contractError
+		if errors.As(err, &rejected) {
+			return nil, &RuntimeError{Stage: StageExecute, Message: fmt.Sprintf("%s: initialization failed: %s", r.abi, rejected.message)}
+		}
+		return nil, err
+	}
+	storage.baseline = copyVars(storage.data)
+	r.host.kernel, r.host.storage = kernel, storage
+	return module, nil
+}
+
+// unsupportedFunction links an import to a function that traps, for host
+// functions the fuzzer cannot provide faithfully
+func unsupportedFunction(imp wasmFuncImport) HostFunction {
+	return HostFunction{
+		Module:    imp.Module,
+		Name:      imp.Name,
+		Signature: imp.Signature,
+		Call: func(args []interface{}) ([]interface{}, error) {
+			return nil, fmt.Errorf("%s is not supported by the fuzzer", imp.Name)
+		},
+		Stub: "traps",
+	}
+}
+
+// contractArguments binds every input to the message of a contract call
+func (c InvocationConfig) contractArguments(platform contractPlatform, signature *FuncSignature) ([][]interface{}, error) {
+	if err := platform.validate(c.Entry, signature); err != nil {
+		return nil, &RuntimeError{Stage: StageSignature, Message: fmt.Sprintf("%s: %v", c.ABI, err)}
+	}
+	calls := make([][]interface{}, len(c.Inputs))
+	for i, input := range c.Inputs {
+		arg, err := pluginInput(input, "smart contracts")
+		if err != nil {
+			return nil, &RuntimeError{Stage: StageSignature, Message: fmt.Sprintf("input %d: %v", i, err)}
+		}
+		calls[i] = []interface{}{arg}
+	}
+	return calls, nil
+}
+
+// callContract runs the entry point on one message
+func (c InvocationConfig) callContract(module WasmModule, args []interface{}) ([]interface{}, error) {
+	return c.contract.call(module, c.Entry, args[0].(bufferArg).data)
+}
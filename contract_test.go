@@ -0,0 +1,246 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// contractBinary imports the named host functions from module
+func contractBinary(module string, functions map[string]nativeFunction, names ...string) []byte {
+	var imports []wasmFuncImport
+	for _, name := range names {
+		imports = append(imports, wasmFuncImport{Module: module, Name: name, Signature: functions[name].signature})
+	}
+	return pluginBinary(imports...)
+}
+
+// contractExport is an export of a mock contract
+type contractExport func(m *contractModule, args []interface{}) ([]interface{}, error)
+
+// contractModule is a mock contract whose exports are Go functions calling
+// the host functions it was linked to
+type contractModule struct {
+	*heapMockModule
+	host    map[string]HostFunction
+	exports map[string]contractExport
+}
+
+func newContractModule(signatures map[string]FuncSignature, exports map[string]contractExport) *contractModule {
+	m := &contractModule{heapMockModule: newHeapMockModule(signatures), host: map[string]HostFunction{}, exports: exports}
+	heap := m.ExecuteFunc
+	m.ExecuteFunc = func(funcName string, args ...interface{}) ([]interface{}, error) {
+		if export, ok := m.exports[funcName]; ok {
+			return export(m, args)
+		}
+		return heap(funcName, args...)
+	}
+	return m
+}
+
+// call invokes a host function, returning its first result
+func (m *contractModule) call(name string, args ...interface{}) (int64, error) {
+	fn, ok := m.host[name]
+	if !ok {
+		return 0, errors.New("unknown import " + name)
+	}
+	results, err := fn.Call(args)
+	if err != nil {
+		// Mirrors how WasmEdgeModule reports host function traps
+		return 0, &RuntimeError{Stage: StageExecute, Message: "execution failed: host function '" + name + "' failed: " + err.Error()}
+	}
+	if len(results) == 0 {
+		return 0, nil
+	}
+	if v, ok := results[0].(int32); ok {
+		return int64(uint32(v)), nil
+	}
+	return results[0].(int64), nil
+}
+
+// put copies data into the contract's memory
+func (m *contractModule) put(data string) int32 {
+	ptr := m.bump(int32(len(data)), 1)[0].(int32)
+	copy(m.memory[ptr:], data)
+	return ptr
+}
+
+// statefulContractModule snapshots a contract's memory
+type statefulContractModule struct {
+	*contractModule
+}
+
+func (m *statefulContractModule) Snapshot() (*ModuleSnapshot, error) {
+	return &ModuleSnapshot{Memories: map[string][]byte{defaultMemoryExport: append([]byte(nil), m.memory...)}}, nil
+}
+
+func (m *statefulContractModule) Restore(snapshot *ModuleSnapshot) error {
+	copy(m.memory, snapshot.Memories[defaultMemoryExport])
+	return nil
+}
+
+// contractMockRuntime links a new contract to the host functions it is
+// given
+type contractMockRuntime struct {
+	newContract func() *contractModule
+	stateful    bool
+}
+
+func (r *contractMockRuntime) LoadModule(filePath string) (WasmModule, error) {
+	return nil, errors.New("imports cannot be satisfied")
+}
+
+func (r *contractMockRuntime) LoadModuleWithHost(filePath string, data []byte, host []HostFunction) (WasmModule, error) {
+	m := r.newContract()
+	for _, fn := range host {
+		m.host[fn.Name] = fn
+	}
+	if r.stateful {
+		return &statefulContractModule{m}, nil
+	}
+	return m, nil
+}
+
+// runContract writes a contract binary to disk and runs it
+func runContract(t *testing.T, binary []byte, runtime WasmRuntime, plan InvocationConfig) ExecutionResult {
+	path := filepath.Join(t.TempDir(), "contract.wasm")
+	require.NoError(t, os.WriteFile(path, binary, 0o644))
+	return processWasmFileWithOptions(path, runtime, RunOptions{Invocation: plan})
+}
+
+// messages builds one string input per contract message
+func messages(msgs ...string) []InvocationInput {
+	inputs := make([]InvocationInput, len(msgs))
+	for i, msg := range msgs {
+		inputs[i] = InvocationInput{{Type: "string", Value: msg}}
+	}
+	return inputs
+}
+
+// counterContract is a NEAR contract whose "add" method adds its input's
+// length to a stored counter and records the total, then panics on inputs
+// containing "fail"
+func counterContract(totals *[]int) func() *contractModule {
+	return func() *contractModule {
+		signatures := map[string]FuncSignature{"add": funcSig("", "")}
+		return newContractModule(signatures, map[string]contractExport{
+			"add": func(m *contractModule, args []interface{}) ([]interface{}, error) {
+				input, err := m.nearInput()
+				if err != nil {
+					return nil, err
+				}
+				stored, err := m.nearRead("count")
+				if err != nil {
+					return nil, err
+				}
+				total := len(stored) + len(input)
+				*totals = append(*totals, total)
+				if err := m.nearWrite("count", strings.Repeat("+", total)); err != nil {
+					return nil, err
+				}
+				if strings.Contains(string(input), "fail") {
+					msg := m.put("input rejected")
+					_, err := m.call("panic_utf8", int64(14), int64(msg))
+					return nil, err
+				}
+				return nil, nil
+			},
+		})
+	}
+}
+
+var counterImports = []string{"input", "register_len", "read_register", "storage_read", "storage_write", "panic_utf8"}
+
+// -----------------------------------------------------------------------------
+// TEST: Smart Contract Harnesses
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Smart contracts only run inside their chain's host, which provides
+// storage, the calling account and the message through imports. Their
+// state lives in that host, and a failed transaction leaves it untouched,
+// so the fuzzer must keep and revert the storage the way the chain does
+// or it reports states no chain can reach.
+// -----------------------------------------------------------------------------
+
+func TestContract_StorageRanges(t *testing.T) {
+	s := newContractStorage(map[string]string{"a": "1", "b": "2", "c": "3"})
+	assert.Equal(t, []string{"a", "b", "c"}, s.keys(nil, nil, false))
+	assert.Equal(t, []string{"b"}, s.keys([]byte("b"), []byte("c"), false), "the end is exclusive")
+	assert.Equal(t, []string{"c", "b"}, s.keys([]byte("b"), nil, true))
+	assert.Equal(t, uint64(6), s.size())
+
+	s.set([]byte("d"), []byte("4"))
+	s.remove([]byte("a"))
+	value, ok := s.get([]byte("d"))
+	assert.True(t, ok)
+	assert.Equal(t, "4", string(value))
+	_, ok = s.get([]byte("a"))
+	assert.False(t, ok)
+}
+
+func TestContract_FailedCallsRevertStorage(t *testing.T) {
+	var totals []int
+	runtime := &contractMockRuntime{newContract: counterContract(&totals)}
+	binary := contractBinary(nearModule, (&nearKernel{}).functions(), counterImports...)
+	plan := InvocationConfig{ABI: ABINear, Entry: "add", Inputs: messages("ab", "fail", "c")}
+
+	result := runContract(t, binary, runtime, plan)
+
+	require.Len(t, result.Invocations, 3)
+	assert.True(t, result.Invocations[0].Success)
+	assert.Equal(t, "execution failed: host function 'panic_utf8' failed: smart contract panicked: input rejected", result.Invocations[1].ErrorMessage)
+	assert.Equal(t, []int{2, 6, 3}, totals, "the failed call's write is reverted")
+}
+
+func TestContract_SnapshotRewindsStorage(t *testing.T) {
+	var totals []int
+	runtime := &contractMockRuntime{newContract: counterContract(&totals)}
+	binary := contractBinary(nearModule, (&nearKernel{}).functions(), counterImports...)
+	plan := InvocationConfig{
+		ABI: ABINear, Entry: "add", Inputs: messages("a", "a", "a"),
+		Contract: ContractConfig{Storage: map[string]string{"count": "++"}},
+	}
+
+	result := runContract(t, binary, runtime, plan)
+	require.True(t, result.Success, result.ErrorMessage)
+	assert.Equal(t, []int{3, 4, 5}, totals, "storage persists across calls")
+	assert.Equal(t, []interface{}{int32(0), int32(0), int32(0)}, invocationReturns(result))
+
+	totals = nil
+	runtime.stateful = true
+	plan.Snapshot = true
+	runContract(t, binary, runtime, plan)
+	assert.Equal(t, []int{3, 3, 3}, totals)
+}
+
+func TestContract_RuntimeErrors(t *testing.T) {
+	binary := contractBinary(nearModule, (&nearKernel{}).functions(), counterImports...)
+	plan := InvocationConfig{ABI: ABINear, Entry: "add"}
+
+	mockRuntime := &MockWasmRuntime{LoadModuleFunc: func(filePath string) (WasmModule, error) { return &MockWasmModule{}, nil }}
+	result := runContract(t, binary, mockRuntime, plan)
+	assert.Equal(t, StageInstantiate, result.FailureStage)
+	assert.Equal(t, "near: runtime cannot provide host functions", result.ErrorMessage)
+
+	plan.Inputs = messages("a", "b")
+	plan.Contract.Sender = "Alice"
+	var totals []int
+	result = runContract(t, binary, &contractMockRuntime{newContract: counterContract(&totals)}, plan)
+	assert.Equal(t, StageSignature, result.FailureStage)
+	assert.Equal(t, `near: account ID "Alice" is invalid`, result.ErrorMessage)
+
+	plan.Contract.Sender = ""
+	plan.Inputs = []InvocationInput{i32Input(1)}
+	result = runContract(t, binary, &contractMockRuntime{newContract: counterContract(&totals)}, plan)
+	assert.Equal(t, StageSignature, result.FailureStage)
+	assert.Equal(t, "input 0: smart contracts take string, bytes or file input, not i32", result.ErrorMessage)
+}
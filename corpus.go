@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CorpusConfig selects which corpus files a campaign runs. Files left
+// out are reported as skipped so totals still cover the whole corpus.
+type CorpusConfig struct {
+	// Include and Exclude are glob patterns matched against file names.
+	// With Include set, only matching files run; Exclude wins over it.
+	Include []string `yaml:"include"`
+	Exclude []string `yaml:"exclude"`
+	// MaxFileSize skips files larger than this many bytes, when set
+	MaxFileSize ByteSize `yaml:"max_file_size"`
+	// Denylist names a file of SHA-256 hashes of files to skip
+	Denylist string `yaml:"denylist"`
+	// SkipDuplicates skips files with the same content as an earlier file
+	SkipDuplicates bool `yaml:"skip_duplicates"`
+	// Shuffle runs the files in a random order, and Sample only runs a
+	// random subset of them, given as a count such as "500" or a
+	// percentage such as "10%". Both are drawn from Seed, so a seed always
+	// selects the same files in the same order.
+	Shuffle bool   `yaml:"shuffle"`
+	Sample  string `yaml:"sample"`
+	Seed    int64  `yaml:"seed"`
+	// ShardIndex and ShardCount run one of ShardCount disjoint parts of the
+	// corpus, so a campaign can be split across jobs
+	ShardIndex int `yaml:"shard_index"`
+	ShardCount int `yaml:"shard_count"`
+	// ChangedSince only runs the files git reports added or modified since
+	// this ref. The others are reported from the cache when it holds them.
+	ChangedSince string `yaml:"changed_since"`
+}
+
+// CorpusSelection records how the files of a campaign were ordered and
+// sampled, to reproduce the run
+type CorpusSelection struct {
+	Shuffle bool   `json:"shuffle"`
+	Sample  string `json:"sample,omitempty"`
+	Seed    int64  `json:"seed"`
+}
+
+// selection returns the ordering and sampling of the config, or nil when
+// the corpus runs in directory order
+func (c CorpusConfig) selection() *CorpusSelection {
+	if !c.Shuffle && c.Sample == "" {
+		return nil
+	}
+	return &CorpusSelection{Shuffle: c.Shuffle, Sample: c.Sample, Seed: c.Seed}
+}
+
+// sampleSize returns how many of n files a sample such as "500" or "10%"
+// selects. Percentages are rounded up, so a non-empty sample of a corpus
+// is never empty.
+func sampleSize(sample string, n int) (int, error) {
+	text := strings.TrimSpace(sample)
+	if percent, ok := strings.CutSuffix(text, "%"); ok {
+		p, err := strconv.ParseFloat(strings.TrimSpace(percent), 64)
+		if err != nil || p < 0 || p > 100 {
+			return 0, fmt.Errorf("invalid sample %q", sample)
+		}
+		return int(math.Ceil(p / 100 * float64(n))), nil
+	}
+	count, err := strconv.Atoi(text)
+	if err != nil || count < 0 {
+		return 0, fmt.Errorf("invalid sample %q", sample)
+	}
+	return min(count, n), nil
+}
+
+// arrangeCorpus puts the files in run order and draws the sample. It
+// returns the files left out of the sample, which are still reported.
+func arrangeCorpus(files []string, config CorpusConfig) ([]string, map[string]bool, error) {
+	if config.selection() == nil {
+		return files, nil, nil
+	}
+	rng := rand.New(rand.NewSource(config.Seed))
+	arranged := append([]string(nil), files...)
+
+	var unsampled map[string]bool
+	if config.Sample != "" {
+		size, err := sampleSize(config.Sample, len(files))
+		if err != nil {
+			return nil, nil, err
+		}
+		unsampled = make(map[string]bool)
+		for _, i := range rng.Perm(len(files))[size:] {
+			unsampled[files[i]] = true
+		}
+	}
+	if config.Shuffle {
+		rng.Shuffle(len(arranged), func(i, j int) {
+			arranged[i], arranged[j] = arranged[j], arranged[i]
+		})
+	}
+	return arranged, unsampled, nil
+}
+
+// ByteSize is a size in bytes, written as a plain number or with a binary
+// unit such as 512KiB or 10MiB
+type ByteSize int64
+
+// byteUnits are the accepted size suffixes, longest first
+var byteUnits = []struct {
+	suffix string
+	scale  int64
+}{
+	{"GiB", 1 << 30},
+	{"MiB", 1 << 20},
+	{"KiB", 1 << 10},
+	{"B", 1},
+}
+
+// parseByteSize parses a size such as "4096", "512KiB" or "10MiB"
+func parseByteSize(s string) (ByteSize, error) {
+	text, scale := strings.TrimSpace(s), int64(1)
+	for _, unit := range byteUnits {
+		if strings.HasSuffix(text, unit.suffix) {
+			text, scale = strings.TrimSpace(strings.TrimSuffix(text, unit.suffix)), unit.scale
+			break
+		}
+	}
+	n, err := strconv.ParseInt(text, 10, 64)
+	if err != nil || n < 0 || n > (1<<63-1)/scale {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return ByteSize(n * scale), nil
+}
+
+// String formats the size for flag defaults
+func (b ByteSize) String() string {
+	return formatBytes(int64(b))
+}
+
+// Set parses a --max-file-size flag
+func (b *ByteSize) Set(s string) error {
+	size, err := parseByteSize(s)
+	if err != nil {
+		return err
+	}
+	*b = size
+	return nil
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler, accepting max_file_size as
+// a number or a size with a unit
+func (b *ByteSize) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.ScalarNode {
+		return fmt.Errorf("line %d: max_file_size must be a size", node.Line)
+	}
+	return b.Set(node.Value)
+}
+
+// patternList is a repeatable flag collecting glob patterns
+type patternList []string
+
+func (p *patternList) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *patternList) Set(pattern string) error {
+	*p = append(*p, pattern)
+	return nil
+}
+
+// corpusFilter decides, file by file, which files a campaign skips
+type corpusFilter struct {
+	config CorpusConfig
+	// denied holds the hex SHA-256 hashes of the denylist
+	denied map[string]bool
+	// seen maps the content hashes of files run so far to their paths
+	seen map[[sha256.Size]byte]string
+}
+
+// newCorpusFilter checks the patterns of config and reads its denylist
+func newCorpusFilter(config CorpusConfig) (*corpusFilter, error) {
+	for _, pattern := range append(append([]string(nil), config.Include...), config.Exclude...) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	filter := &corpusFilter{config: config, seen: make(map[[sha256.Size]byte]string)}
+	if config.Denylist != "" {
+		denied, err := readDenylist(config.Denylist)
+		if err != nil {
+			return nil, err
+		}
+		filter.denied = denied
+	}
+	return filter, nil
+}
+
+// readDenylist reads one SHA-256 hash per line. Anything after the hash is
+// ignored, so sha256sum output can be used as is, and lines starting with
+// # are comments.
+func readDenylist(path string) (map[string]bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read denylist: %w", err)
+	}
+	defer file.Close()
+
+	denied := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		hash := strings.ToLower(fields[0])
+		if decoded, err := hex.DecodeString(hash); err != nil || len(decoded) != sha256.Size {
+			return nil, fmt.Errorf("denylist line %d: %q is not a SHA-256 hash", line, fields[0])
+		}
+		denied[hash] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read denylist: %w", err)
+	}
+	return denied, nil
+}
+
+// skip returns why a file is skipped, or "" to run it. Files that cannot
+// be read are run, and fail at the load stage.
+func (f *corpusFilter) skip(filePath string) (SkipReason, string) {
+	name := filepath.Base(filePath)
+	if len(f.config.Include) > 0 && matchAny(f.config.Include, name) == "" {
+		return SkipFiltered, "matches no include pattern"
+	}
+	if pattern := matchAny(f.config.Exclude, name); pattern != "" {
+		return SkipFiltered, fmt.Sprintf("excluded by %q", pattern)
+	}
+	if f.config.MaxFileSize > 0 {
+		if info, err := os.Stat(filePath); err == nil && info.Size() > int64(f.config.MaxFileSize) {
+			return SkipOverSizeLimit, fmt.Sprintf("%d bytes exceeds the %d byte limit", info.Size(), f.config.MaxFileSize)
+		}
+	}
+	if f.denied == nil && !f.config.SkipDuplicates {
+		return "", ""
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", ""
+	}
+	sum := sha256.Sum256(data)
+	if f.denied[hex.EncodeToString(sum[:])] {
+		return SkipFiltered, "hash on denylist"
+	}
+	if f.config.SkipDuplicates {
+		if first, ok := f.seen[sum]; ok {
+			return SkipDuplicate, "same content as " + filepath.Base(first)
+		}
+		f.seen[sum] = filePath
+	}
+	return "", ""
+}
+
+// matchAny returns the first pattern matching name, or ""
+func matchAny(patterns []string, name string) string {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return pattern
+		}
+	}
+	return ""
+}
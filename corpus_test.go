@@ -0,0 +1,164 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// -----------------------------------------------------------------------------
+// TEST: Corpus Selection
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Files a campaign leaves out must still appear in the report, with the
+// reason why, or pass and fail rates silently change meaning whenever a
+// filter is applied.
+// -----------------------------------------------------------------------------
+
+func TestCorpus_SkipsDuplicates(t *testing.T) {
+	dir := t.TempDir()
+	module := buildTestModule([]byte{0x20, 0x00, 0x0b}, true)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.wasm"), module, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.wasm"), module, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "c.wasm"), []byte("other"), 0o644))
+
+	var loaded []string
+	runtime := &MockWasmRuntime{LoadModuleFunc: func(filePath string) (WasmModule, error) {
+		loaded = append(loaded, filepath.Base(filePath))
+		return &MockWasmModule{}, nil
+	}}
+	opts := RunOptions{Corpus: CorpusConfig{SkipDuplicates: true}}
+	report, err := runFuzzerWithMatrix(dir, []environmentRuntime{{Runtime: runtime}}, opts)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"a.wasm", "c.wasm"}, loaded)
+	assert.Equal(t, 3, report.TotalFiles)
+	assert.Equal(t, 2, report.Passed)
+	assert.Equal(t, 1, report.Skipped)
+	assert.Equal(t, 1, report.SkipCounts[SkipDuplicate])
+	assert.Equal(t, SkipDuplicate, report.Results[1].SkipReason)
+	assert.Equal(t, "same content as a.wasm", report.Results[1].SkipDetails)
+	assert.Empty(t, validateReport(report))
+
+	report, err = runFuzzerWithRuntime(dir, runtime)
+	require.NoError(t, err)
+	assert.Zero(t, report.Skipped, "duplicates run unless skipping is enabled")
+}
+
+func TestCorpus_FiltersByPatternSizeAndHash(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"keep.wasm":      []byte("keep"),
+		"big.wasm":       make([]byte, 2048),
+		"known-bad.wasm": []byte("crash"),
+		"slow_1.wasm":    []byte("slow"),
+		"other.wasm":     []byte("other"),
+	}
+	for name, data := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0o644))
+	}
+	sum := sha256.Sum256(files["known-bad.wasm"])
+	denylist := filepath.Join(t.TempDir(), "denylist.txt")
+	require.NoError(t, os.WriteFile(denylist, []byte("# crashes the runtime\n"+hex.EncodeToString(sum[:])+"  known-bad.wasm\n"), 0o644))
+
+	opts := RunOptions{Corpus: CorpusConfig{
+		Include:     []string{"*.wasm"},
+		Exclude:     []string{"slow_*", "other.*"},
+		MaxFileSize: 1024,
+		Denylist:    denylist,
+	}}
+	report, err := runFuzzerWithMatrix(dir, []environmentRuntime{{Runtime: &MockWasmRuntime{}}}, opts)
+	require.NoError(t, err)
+
+	reasons := make(map[string]string)
+	for _, result := range report.Results {
+		reasons[result.FileName] = string(result.SkipReason) + ": " + result.SkipDetails
+	}
+	assert.Equal(t, map[string]string{
+		"keep.wasm":      ": ",
+		"big.wasm":       "over_size_limit: 2048 bytes exceeds the 1024 byte limit",
+		"known-bad.wasm": "filtered: hash on denylist",
+		"slow_1.wasm":    `filtered: excluded by "slow_*"`,
+		"other.wasm":     `filtered: excluded by "other.*"`,
+	}, reasons)
+	assert.Equal(t, 1, report.Passed)
+	assert.Equal(t, 3, report.SkipCounts[SkipFiltered])
+	assert.Equal(t, 1, report.SkipCounts[SkipOverSizeLimit])
+	assert.Empty(t, validateReport(report))
+}
+
+func TestCorpus_RejectsBadSelection(t *testing.T) {
+	_, err := newCorpusFilter(CorpusConfig{Exclude: []string{"[a-"}})
+	assert.ErrorContains(t, err, `invalid pattern "[a-"`)
+
+	denylist := filepath.Join(t.TempDir(), "denylist.txt")
+	require.NoError(t, os.WriteFile(denylist, []byte("abc123\n"), 0o644))
+	_, err = newCorpusFilter(CorpusConfig{Denylist: denylist})
+	assert.EqualError(t, err, `denylist line 1: "abc123" is not a SHA-256 hash`)
+
+	for text, want := range map[string]ByteSize{"4096": 4096, "512KiB": 512 << 10, "10 MiB": 10 << 20, "1GiB": 1 << 30} {
+		size, err := parseByteSize(text)
+		require.NoError(t, err, text)
+		assert.Equal(t, want, size, text)
+	}
+	_, err = parseByteSize("10MB")
+	assert.EqualError(t, err, `invalid size "10MB"`)
+}
+
+func TestCorpus_ShufflesAndSamplesReproducibly(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 20; i++ {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, fmt.Sprintf("%02d.wasm", i)), []byte{byte(i)}, 0o644))
+	}
+	run := func(seed int64) (order, ran []string, report FuzzingReport) {
+		opts := RunOptions{Corpus: CorpusConfig{Shuffle: true, Sample: "25%", Seed: seed}}
+		report, err := runFuzzerWithMatrix(dir, []environmentRuntime{{Runtime: &MockWasmRuntime{}}}, opts)
+		require.NoError(t, err)
+		for _, result := range report.Results {
+			order = append(order, result.FileName)
+			if !result.Skipped {
+				ran = append(ran, result.FileName)
+			}
+		}
+		return order, ran, report
+	}
+
+	order, ran, report := run(7)
+	assert.Len(t, order, 20, "files left out of the sample are still reported")
+	assert.Len(t, ran, 5)
+	assert.Equal(t, 15, report.SkipCounts[SkipFiltered])
+	assert.Equal(t, &CorpusSelection{Shuffle: true, Sample: "25%", Seed: 7}, report.Selection)
+	assert.Empty(t, validateReport(report))
+
+	again, ranAgain, _ := run(7)
+	assert.Equal(t, order, again, "a seed always gives the same order")
+	assert.Equal(t, ran, ranAgain, "a seed always gives the same sample")
+	_, other, _ := run(8)
+	assert.NotEqual(t, ran, other)
+
+	report, err := runFuzzerWithRuntime(dir, &MockWasmRuntime{})
+	require.NoError(t, err)
+	assert.Nil(t, report.Selection, "directory order is not recorded")
+}
+
+func TestCorpus_SampleSize(t *testing.T) {
+	for sample, want := range map[string]int{"10%": 2, "100%": 11, "0%": 0, "3": 3, "50": 11} {
+		size, err := sampleSize(sample, 11)
+		require.NoError(t, err, sample)
+		assert.Equal(t, want, size, sample)
+	}
+	for _, sample := range []string{"150%", "-1", "ten"} {
+		_, err := sampleSize(sample, 11)
+		assert.EqualError(t, err, fmt.Sprintf("invalid sample %q", sample))
+	}
+}
@@ -0,0 +1,602 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CorpusSource lists and opens the files of a corpus, wherever it is kept.
+// Names are relative to the corpus's root; like a local directory, a
+// corpus only has the files directly at its root, so names with a slash
+// are left out.
+type CorpusSource interface {
+	// List returns the names of the corpus's files
+	List() ([]string, error)
+	// Open opens a file of the corpus by name
+	Open(name string) (io.ReadCloser, error)
+}
+
+// localCorpus is a CorpusSource already on disk, whose files are used
+// where they are instead of being fetched
+type localCorpus interface {
+	Dir() string
+}
+
+// registeredCorpusSources opens the corpora at locations with a URL scheme
+var registeredCorpusSources = make(map[string]func(location string) (CorpusSource, error))
+
+// RegisterCorpusSource has corpus locations with a URL scheme, such as
+// s3://bucket/prefix, opened by open, so a build can fetch corpora from
+// its own stores
+func RegisterCorpusSource(scheme string, open func(location string) (CorpusSource, error)) {
+	registeredCorpusSources[scheme] = open
+}
+
+func init() {
+	RegisterCorpusSource("http", openHTTPIndex)
+	RegisterCorpusSource("https", openHTTPIndex)
+	RegisterCorpusSource("s3", openObjectStore)
+}
+
+// openCorpusSource opens the corpus at a location: a URL of a registered
+// scheme, a tar or zip archive, or else a directory. Opening does no I/O;
+// sources read on List.
+func openCorpusSource(location string) (CorpusSource, error) {
+	if scheme, _, ok := strings.Cut(location, "://"); ok {
+		open := registeredCorpusSources[scheme]
+		if open == nil {
+			return nil, fmt.Errorf("no corpus source for %s:// locations", scheme)
+		}
+		return open(location)
+	}
+	if archiveFormat(location) != "" {
+		return &archiveSource{path: location}, nil
+	}
+	return dirSource(location), nil
+}
+
+// dirSource is a corpus directory on disk
+type dirSource string
+
+func (d dirSource) Dir() string { return string(d) }
+
+func (d dirSource) List() ([]string, error) {
+	entries, err := os.ReadDir(string(d))
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+func (d dirSource) Open(name string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(string(d), name))
+}
+
+// corpusCacheDir is where corpora kept elsewhere are fetched to, a
+// directory per location
+var corpusCacheDir = func() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "wasm-fuzzer", "corpus")
+}
+
+// fetchedCorpus is a corpus fetched to disk, with the names its source
+// listed
+type fetchedCorpus struct {
+	dir   string
+	names []string
+}
+
+// fetchedCorpora holds the corpora this process fetched, so each is
+// fetched once
+var (
+	fetchedMu      sync.Mutex
+	fetchedCorpora = make(map[string]fetchedCorpus)
+)
+
+// fetchCorpus returns the directory and file names of the corpus at a
+// location. A corpus kept elsewhere than on disk is fetched to a
+// directory of the corpus cache, afresh once per process. Files are
+// renamed into place once complete, so shards fetching the same corpus
+// side by side never read half a file.
+func fetchCorpus(location string) (fetchedCorpus, error) {
+	source, err := openCorpusSource(location)
+	if err != nil {
+		return fetchedCorpus{}, err
+	}
+	if local, ok := source.(localCorpus); ok {
+		names, err := source.List()
+		return fetchedCorpus{dir: local.Dir(), names: names}, err
+	}
+
+	fetchedMu.Lock()
+	defer fetchedMu.Unlock()
+	if fetched, ok := fetchedCorpora[location]; ok {
+		return fetched, nil
+	}
+	names, err := source.List()
+	if err != nil {
+		return fetchedCorpus{}, fmt.Errorf("failed to list corpus: %w", err)
+	}
+	sum := sha256.Sum256([]byte(location))
+	fetched := fetchedCorpus{dir: filepath.Join(corpusCacheDir(), hex.EncodeToString(sum[:8]))}
+	if err := os.MkdirAll(fetched.dir, 0o755); err != nil {
+		return fetchedCorpus{}, err
+	}
+	for _, name := range names {
+		if strings.ContainsAny(name, `/\`) || name == "" || name == "." || name == ".." {
+			continue
+		}
+		if err := fetchFile(source, name, filepath.Join(fetched.dir, name)); err != nil {
+			return fetchedCorpus{}, fmt.Errorf("failed to fetch %s: %w", name, err)
+		}
+		fetched.names = append(fetched.names, name)
+	}
+	fetchedCorpora[location] = fetched
+	return fetched, nil
+}
+
+func fetchFile(source CorpusSource, name, target string) error {
+	in, err := source.Open(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.CreateTemp(filepath.Dir(target), "."+name+".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(out.Name())
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(out.Name())
+		return err
+	}
+	return os.Rename(out.Name(), target)
+}
+
+// corpusDir returns the directory holding the corpus at a location,
+// fetching it when it is kept elsewhere
+func corpusDir(location string) (string, error) {
+	source, err := openCorpusSource(location)
+	if err != nil {
+		return "", err
+	}
+	if local, ok := source.(localCorpus); ok {
+		return local.Dir(), nil
+	}
+	fetched, err := fetchCorpus(location)
+	return fetched.dir, err
+}
+
+// archiveFormat returns the format of an archive by its extension, or ""
+// for any other file
+func archiveFormat(location string) string {
+	lower := strings.ToLower(location)
+	for _, format := range []string{".tar.gz", ".tgz", ".tar.zst", ".tar", ".zip"} {
+		if strings.HasSuffix(lower, format) {
+			return format
+		}
+	}
+	return ""
+}
+
+// archiveSource is a corpus packed in a tar or zip archive. The archive
+// is read into memory when listed. A single directory holding everything
+// in the archive, as when a directory was packed, is its root.
+type archiveSource struct {
+	path  string
+	files map[string][]byte
+}
+
+func (a *archiveSource) List() ([]string, error) {
+	data, err := os.ReadFile(a.path)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string][]byte)
+	switch archiveFormat(a.path) {
+	case ".zip":
+		err = readZip(data, files)
+	case ".tar.gz", ".tgz":
+		var reader *gzip.Reader
+		if reader, err = gzip.NewReader(bytes.NewReader(data)); err == nil {
+			err = readTar(reader, files)
+		}
+	case ".tar.zst":
+		if data, err = decompressZstd(data); err == nil {
+			err = readTar(bytes.NewReader(data), files)
+		}
+	default:
+		err = readTar(bytes.NewReader(data), files)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+	a.files = stripArchiveRoot(files)
+	names := make([]string, 0, len(a.files))
+	for name := range a.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (a *archiveSource) Open(name string) (io.ReadCloser, error) {
+	data, ok := a.files[name]
+	if !ok {
+		return nil, fmt.Errorf("%s is not in %s", name, a.path)
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func readTar(r io.Reader, files map[string][]byte) error {
+	reader := tar.NewReader(r)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			return err
+		}
+		files[path.Clean(header.Name)] = data
+	}
+}
+
+func readZip(data []byte, files map[string][]byte) error {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return err
+	}
+	for _, file := range reader.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		in, err := file.Open()
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(in)
+		in.Close()
+		if err != nil {
+			return err
+		}
+		files[path.Clean(file.Name)] = data
+	}
+	return nil
+}
+
+// stripArchiveRoot drops the directory every file of an archive is in,
+// when there is one
+func stripArchiveRoot(files map[string][]byte) map[string][]byte {
+	var root string
+	for name := range files {
+		dir, _, ok := strings.Cut(strings.TrimPrefix(name, "./"), "/")
+		if !ok || (root != "" && dir != root) {
+			return files
+		}
+		root = dir
+	}
+	stripped := make(map[string][]byte, len(files))
+	for name, data := range files {
+		stripped[strings.TrimPrefix(strings.TrimPrefix(name, "./"), root+"/")] = data
+	}
+	return stripped
+}
+
+// corpusClient fetches corpora over HTTP
+var corpusClient = &http.Client{Timeout: 10 * time.Minute}
+
+// httpGet fetches a URL, failing on any status but 200
+func httpGet(request *http.Request) (io.ReadCloser, error) {
+	resp, err := corpusClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s: %s", request.URL.Redacted(), resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// httpIndex is a corpus served over HTTP, listed by an index: a file name
+// per line, relative to the index's URL, or sha256sum output, whose hashes
+// the files fetched are checked against. Lines starting with # are
+// comments.
+type httpIndex struct {
+	index  *url.URL
+	hashes map[string]string
+}
+
+func openHTTPIndex(location string) (CorpusSource, error) {
+	index, err := url.Parse(location)
+	if err != nil {
+		return nil, err
+	}
+	return &httpIndex{index: index}, nil
+}
+
+func (h *httpIndex) List() ([]string, error) {
+	request, err := http.NewRequest(http.MethodGet, h.index.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	body, err := httpGet(request)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	h.hashes = make(map[string]string)
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name := line
+		if sum, rest, ok := strings.Cut(line, " "); ok && isSHA256(sum) {
+			name = strings.TrimPrefix(strings.TrimLeft(rest, " "), "*")
+			h.hashes[name] = strings.ToLower(sum)
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func (h *httpIndex) Open(name string) (io.ReadCloser, error) {
+	file, err := h.index.Parse(url.PathEscape(name))
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequest(http.MethodGet, file.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	body, err := httpGet(request)
+	if err != nil {
+		return nil, err
+	}
+	if want := h.hashes[name]; want != "" {
+		return &checkedReader{ReadCloser: body, hash: sha256.New(), want: want}, nil
+	}
+	return body, nil
+}
+
+// isSHA256 reports whether s is a SHA-256 in hex
+func isSHA256(s string) bool {
+	decoded, err := hex.DecodeString(s)
+	return err == nil && len(decoded) == sha256.Size
+}
+
+// checkedReader fails at the end of a file whose SHA-256 is not the one
+// wanted
+type checkedReader struct {
+	io.ReadCloser
+	hash hash.Hash
+	want string
+}
+
+func (c *checkedReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.hash.Write(p[:n])
+	if err == io.EOF {
+		if got := hex.EncodeToString(c.hash.Sum(nil)); got != c.want {
+			return n, fmt.Errorf("sha256 is %s, the index says %s", got, c.want)
+		}
+	}
+	return n, err
+}
+
+// objectStore is a corpus under a prefix of an S3 bucket, or of any store
+// with the S3 API, such as MinIO or R2, at AWS_ENDPOINT_URL. Requests are
+// signed when AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are set, and
+// anonymous otherwise.
+type objectStore struct {
+	base   *url.URL
+	prefix string
+	region string
+}
+
+func openObjectStore(location string) (CorpusSource, error) {
+	bucket, prefix, _ := strings.Cut(strings.TrimPrefix(location, "s3://"), "/")
+	if bucket == "" {
+		return nil, fmt.Errorf("%s names no bucket", location)
+	}
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+	endpoint := os.Getenv("AWS_ENDPOINT_URL_S3")
+	if endpoint == "" {
+		endpoint = os.Getenv("AWS_ENDPOINT_URL")
+	}
+	// Custom endpoints are addressed by path, as they often lack the DNS
+	// for virtual hosts
+	raw := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/", bucket, region)
+	if endpoint != "" {
+		raw = strings.TrimSuffix(endpoint, "/") + "/" + bucket + "/"
+	}
+	base, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	return &objectStore{base: base, prefix: prefix, region: region}, nil
+}
+
+// listBucketResult is the part of a ListObjectsV2 response listed
+type listBucketResult struct {
+	Contents []struct {
+		Key string
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+func (s *objectStore) List() ([]string, error) {
+	var names []string
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {s.prefix}, "delimiter": {"/"}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		list := *s.base
+		list.RawQuery = query.Encode()
+		body, err := s.get(&list)
+		if err != nil {
+			return nil, err
+		}
+		var result listBucketResult
+		err = xml.NewDecoder(body).Decode(&result)
+		body.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range result.Contents {
+			names = append(names, strings.TrimPrefix(object.Key, s.prefix))
+		}
+		if !result.IsTruncated {
+			return names, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+func (s *objectStore) Open(name string) (io.ReadCloser, error) {
+	object, err := s.base.Parse(escapeKey(s.prefix + name))
+	if err != nil {
+		return nil, err
+	}
+	return s.get(object)
+}
+
+func (s *objectStore) get(u *url.URL) (io.ReadCloser, error) {
+	request, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if id, secret := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"); id != "" && secret != "" {
+		signS3(request, s.region, id, secret, os.Getenv("AWS_SESSION_TOKEN"), time.Now())
+	}
+	return httpGet(request)
+}
+
+// escapeKey escapes each segment of an object key
+func escapeKey(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// emptySHA256 is the hash of the empty payload of a GET
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// signS3 signs a GET with AWS Signature Version 4
+func signS3(request *http.Request, region, id, secret, token string, now time.Time) {
+	stamp := now.UTC().Format("20060102T150405Z")
+	date := stamp[:8]
+	request.Header.Set("x-amz-date", stamp)
+	request.Header.Set("x-amz-content-sha256", emptySHA256)
+	headers := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	if token != "" {
+		request.Header.Set("x-amz-security-token", token)
+		headers = append(headers, "x-amz-security-token")
+	}
+	var canonicalHeaders strings.Builder
+	for _, name := range headers {
+		value := request.Header.Get(name)
+		if name == "host" {
+			value = request.URL.Host
+		}
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+
+	query := request.URL.Query()
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var pairs []string
+	for _, key := range keys {
+		for _, value := range query[key] {
+			pairs = append(pairs, awsEscape(key)+"="+awsEscape(value))
+		}
+	}
+	uri := request.URL.EscapedPath()
+	if uri == "" {
+		uri = "/"
+	}
+	signedHeaders := strings.Join(headers, ";")
+	canonical := strings.Join([]string{request.Method, uri, strings.Join(pairs, "&"), canonicalHeaders.String(), signedHeaders, emptySHA256}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	digest := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + stamp + "\n" + scope + "\n" + hex.EncodeToString(digest[:])
+	key := []byte("AWS4" + secret)
+	for _, part := range []string{date, region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+	request.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", id, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// awsEscape escapes a query key or value as Signature Version 4 wants
+func awsEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// CorpusSyncConfig shares the inputs argument fuzzing keeps with the other
+// fuzzers of a fleet, through a directory they all see, as AFL's sync
+// directory does
+type CorpusSyncConfig struct {
+	// Dir is shared by every fuzzer of the fleet, such as a network volume
+	Dir string `yaml:"dir"`
+	// Name identifies the fuzzer in Dir (default: its host name and
+	// process ID)
+	Name string `yaml:"name"`
+	// Interval is how often inputs are exchanged while a file is fuzzed
+	// (default 10s)
+	Interval time.Duration `yaml:"interval"`
+}
+
+// check rejects names that are no directory of their own
+func (c CorpusSyncConfig) check() error {
+	if c.Interval < 0 {
+		return errors.New("arg_fuzz: sync interval must not be negative")
+	}
+	if strings.ContainsAny(c.Name, `/\`) || strings.HasPrefix(c.Name, ".") {
+		return fmt.Errorf("arg_fuzz: invalid sync name %q", c.Name)
+	}
+	return nil
+}
+
+// CorpusSyncSummary counts the inputs exchanged while a file was fuzzed
+type CorpusSyncSummary struct {
+	Exported int `json:"exported"`
+	Imported int `json:"imported"`
+	// Error stopped the sync, after which the file was fuzzed alone
+	Error string `json:"error,omitempty"`
+}
+
+// corpusSync exchanges the inputs kept for one module, nil when there is
+// no sync
+type corpusSync struct {
+	interval time.Duration
+	// dir holds a directory of inputs per fuzzer, own being this one's
+	dir     string
+	own     string
+	summary *CorpusSyncSummary
+	source  argumentSource
+	// types are the value types of the module's inputs; inputs of other
+	// types, as from fuzzers configured differently, are ignored
+	types   []string
+	pending [][]WasmValue
+	seen    map[string]bool
+	next    int
+	last    time.Time
+}
+
+// startCorpusSync joins the sync of a file's module. Fuzzers share the
+// inputs of a module fuzzed through the same entry and payload format.
+func startCorpusSync(config ArgFuzzConfig, entry, filePath string, summary *ArgFuzzSummary) *corpusSync {
+	if config.Sync.Dir == "" {
+		return nil
+	}
+	module := fileHash(filePath)
+	if module == "" {
+		return nil
+	}
+	sum := sha256.Sum256([]byte(module + "\x00" + entry + "\x00" + config.Payload))
+	name := config.Sync.Name
+	if name == "" {
+		host, _ := os.Hostname()
+		name = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	interval := config.Sync.Interval
+	if interval == 0 {
+		interval = 10 * time.Second
+	}
+	s := &corpusSync{
+		interval: interval,
+		dir:      filepath.Join(config.Sync.Dir, hex.EncodeToString(sum[:16])),
+		summary:  &CorpusSyncSummary{},
+		seen:     make(map[string]bool),
+	}
+	s.own = filepath.Join(s.dir, name)
+	summary.Sync = s.summary
+	if err := os.MkdirAll(s.own, 0o755); err != nil {
+		s.fail(err)
+		return s
+	}
+	// A fuzzer restarted under its name carries on numbering its inputs
+	if entries, err := os.ReadDir(s.own); err == nil {
+		s.next = len(entries)
+	}
+	return s
+}
+
+// wrap shares the inputs source keeps
+func (s *corpusSync) wrap(source argumentSource) argumentSource {
+	if s == nil {
+		return source
+	}
+	s.source = source
+	return syncedSource{source, s}
+}
+
+// syncedSource is an argumentSource sharing the inputs it keeps
+type syncedSource struct {
+	argumentSource
+	sync *corpusSync
+}
+
+func (s syncedSource) keep(input []interface{}) {
+	s.argumentSource.keep(input)
+	s.sync.share(input)
+}
+
+func (s syncedSource) favor(input []interface{}) {
+	s.argumentSource.favor(input)
+	s.sync.share(input)
+}
+
+// share queues a kept input for the other fuzzers
+func (s *corpusSync) share(input []interface{}) {
+	if s.stopped() {
+		return
+	}
+	// Files may not exist on other hosts
+	for _, arg := range input {
+		switch arg := arg.(type) {
+		case int32, int64, float32, float64:
+		case bufferArg:
+			if arg.source.Type == "file" {
+				return
+			}
+		default:
+			return
+		}
+	}
+	s.pending = append(s.pending, encodeValues(input))
+}
+
+// tick exchanges inputs once the interval has passed since the last
+// exchange, and first before the first input runs. args is the input
+// about to run, whose types any input imported must have.
+func (s *corpusSync) tick(args []interface{}) {
+	if s.stopped() {
+		return
+	}
+	if s.types == nil {
+		for _, value := range encodeValues(args) {
+			s.types = append(s.types, value.Type)
+		}
+	}
+	if !s.last.IsZero() && time.Since(s.last) < s.interval {
+		return
+	}
+	s.last = time.Now()
+	if err := s.export(); err != nil {
+		s.fail(err)
+		return
+	}
+	if err := s.importInputs(); err != nil {
+		s.fail(err)
+	}
+}
+
+// finish exports the inputs kept since the last exchange
+func (s *corpusSync) finish() {
+	if s.stopped() {
+		return
+	}
+	if err := s.export(); err != nil {
+		s.fail(err)
+	}
+}
+
+func (s *corpusSync) stopped() bool {
+	return s == nil || s.summary.Error != ""
+}
+
+func (s *corpusSync) fail(err error) {
+	s.summary.Error = err.Error()
+}
+
+// export writes each pending input to a file of its own. Files are renamed
+// into place once complete, so other fuzzers never read half an input.
+func (s *corpusSync) export() error {
+	for _, input := range s.pending {
+		data, err := json.Marshal(input)
+		if err != nil {
+			return err
+		}
+		name := filepath.Join(s.own, fmt.Sprintf("%06d.json", s.next))
+		temp := filepath.Join(s.own, fmt.Sprintf(".%06d.tmp", s.next))
+		if err := os.WriteFile(temp, data, 0o644); err != nil {
+			return err
+		}
+		if err := os.Rename(temp, name); err != nil {
+			return err
+		}
+		s.next++
+		s.summary.Exported++
+	}
+	s.pending = nil
+	return nil
+}
+
+// importInputs keeps the inputs the other fuzzers shared since the last
+// exchange
+func (s *corpusSync) importInputs() error {
+	fuzzers, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, fuzzer := range fuzzers {
+		dir := filepath.Join(s.dir, fuzzer.Name())
+		if !fuzzer.IsDir() || dir == s.own {
+			continue
+		}
+		files, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			path := filepath.Join(dir, file.Name())
+			if s.seen[path] || strings.HasPrefix(file.Name(), ".") {
+				continue
+			}
+			s.seen[path] = true
+			if input, ok := s.read(path); ok {
+				s.source.keep(input)
+				s.summary.Imported++
+			}
+		}
+	}
+	return nil
+}
+
+// read decodes an input shared by another fuzzer, if it has the types of
+// this one's inputs
+func (s *corpusSync) read(path string) ([]interface{}, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	var encoded []WasmValue
+	if err := json.Unmarshal(data, &encoded); err != nil || len(encoded) != len(s.types) {
+		return nil, false
+	}
+	input := make([]interface{}, len(encoded))
+	for i, value := range encoded {
+		if value.Type != s.types[i] {
+			return nil, false
+		}
+		if input[i], err = decodeSyncValue(value); err != nil {
+			return nil, false
+		}
+	}
+	return input, true
+}
+
+// decodeSyncValue decodes an argument of a shared input. Only scalars and
+// buffers are shared, not WIT values.
+func decodeSyncValue(value WasmValue) (interface{}, error) {
+	switch value.Type {
+	case "i32", "i64", "f32", "f64":
+		return decodeValue(value)
+	case "string", "bytes":
+		return decodeBuffer(value)
+	default:
+		return nil, fmt.Errorf("%s inputs are not shared", value.Type)
+	}
+}
@@ -0,0 +1,101 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingSource is an argumentSource recording the inputs kept
+type recordingSource struct {
+	kept [][]interface{}
+}
+
+func (s *recordingSource) useDictionary(*moduleDictionary) int { return 0 }
+func (s *recordingSource) next() []interface{}                 { return nil }
+func (s *recordingSource) keep(input []interface{})            { s.kept = append(s.kept, input) }
+func (s *recordingSource) favor(input []interface{})           { s.keep(input) }
+
+// -----------------------------------------------------------------------------
+// TEST: Corpus Sync
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// A fleet of fuzzers finds more when each builds on what the others found
+// instead of rediscovering it. Inputs must reach every fuzzer whole, and
+// inputs a fuzzer cannot run must never reach it.
+// -----------------------------------------------------------------------------
+
+func TestCorpusSync_SharesKeptInputsAcrossTheFleet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "div.wasm")
+	require.NoError(t, os.WriteFile(path, []byte("div"), 0o644))
+	runtime := &MockWasmRuntime{LoadModuleFunc: func(string) (WasmModule, error) {
+		return &statefulCounterModule{counterModule: divisionModule()}, nil
+	}}
+	syncDir := t.TempDir()
+	run := func(name string, seed int64) *ArgFuzzSummary {
+		result := processWasmFileWithOptions(path, runtime, RunOptions{ArgFuzz: ArgFuzzConfig{
+			Iterations: 500,
+			Seed:       seed,
+			Sync:       CorpusSyncConfig{Dir: syncDir, Name: name},
+		}})
+		require.NotNil(t, result.ArgFuzz)
+		require.NotNil(t, result.ArgFuzz.Sync)
+		return result.ArgFuzz
+	}
+
+	first := run("first", 1)
+	assert.Empty(t, first.Sync.Error)
+	assert.Equal(t, 2, first.Sync.Exported, "the first input of each failure is shared")
+	assert.Zero(t, first.Sync.Imported)
+
+	second := run("second", 2)
+	assert.Equal(t, 2, second.Sync.Imported)
+	assert.Equal(t, 2, second.Sync.Exported)
+
+	third := run("first", 3)
+	assert.Equal(t, 2, third.Sync.Imported, "a fuzzer does not import its own inputs")
+	files, err := filepath.Glob(filepath.Join(syncDir, "*", "first", "*.json"))
+	require.NoError(t, err)
+	assert.Len(t, files, 4, "a restarted fuzzer carries on numbering its inputs")
+
+	result := processWasmFileWithOptions(path, runtime, RunOptions{ArgFuzz: ArgFuzzConfig{Iterations: 10}})
+	assert.Nil(t, result.ArgFuzz.Sync)
+}
+
+func TestCorpusSync_OnlyImportsInputsOfTheSameTypes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mod.wasm")
+	require.NoError(t, os.WriteFile(path, []byte("mod"), 0o644))
+	config := ArgFuzzConfig{Sync: CorpusSyncConfig{Dir: t.TempDir(), Name: "exporter", Interval: 1}}
+
+	exporter := startCorpusSync(config, "run", path, &ArgFuzzSummary{})
+	exporterSource := exporter.wrap(&recordingSource{})
+	exporterSource.keep([]interface{}{int32(7), int64(1) << 40})
+	exporterSource.keep([]interface{}{int32(8)})
+	exporterSource.favor([]interface{}{witArg{Type: &witType{Kind: witString}, Value: "x"}})
+	exporter.finish()
+	assert.Equal(t, 2, exporter.summary.Exported, "WIT inputs are not shared")
+
+	config.Sync.Name = "importer"
+	importer := startCorpusSync(config, "run", path, &ArgFuzzSummary{})
+	source := &recordingSource{}
+	importer.wrap(source)
+	importer.tick([]interface{}{int32(0), int64(0)})
+	assert.Equal(t, [][]interface{}{{int32(7), int64(1) << 40}}, source.kept)
+	assert.Empty(t, importer.pending, "imported inputs are not shared again")
+
+	other := startCorpusSync(config, "other_entry", path, &ArgFuzzSummary{})
+	otherSource := &recordingSource{}
+	other.wrap(otherSource)
+	other.tick([]interface{}{int32(0), int64(0)})
+	assert.Empty(t, otherSource.kept, "inputs of another entry are not shared")
+
+	assert.EqualError(t, CorpusSyncConfig{Name: "../x"}.check(), `arg_fuzz: invalid sync name "../x"`)
+	assert.EqualError(t, CorpusSyncConfig{Interval: -1}.check(), "arg_fuzz: sync interval must not be negative")
+}
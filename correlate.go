@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TrapCorrelation records which parts of a failing input the failure
+// depends on, found by re-running the input with systematically varied
+// arguments
+type TrapCorrelation struct {
+	// MinimalArgs is the triggering input with as many bits cleared as
+	// possible while still failing the same way
+	MinimalArgs []WasmValue `json:"minimal_args"`
+	// Arguments lists the arguments whose bits change the outcome
+	Arguments []ArgumentBits `json:"arguments,omitempty"`
+	// Executions is the number of re-runs the analysis took
+	Executions int `json:"executions"`
+}
+
+// ArgumentBits names the bits of one argument that a failure depends on
+type ArgumentBits struct {
+	Index int `json:"index"`
+	// Bits lists bit ranges, least significant first, e.g. "0-3,31"
+	Bits string `json:"bits"`
+}
+
+// failureRunner executes the entry function with the given arguments from
+// a fresh module state and returns the classified failure message, empty
+// on success. An error means the module could not be reset.
+type failureRunner func(args []int32) (string, error)
+
+// correlateFailure bisects a failing input bit by bit. Flipping each bit of
+// each argument shows which bits the failure depends on; clearing bits from
+// the most significant down, keeping every clear that preserves the
+// failure, yields a minimal triggering input.
+func correlateFailure(args []int32, message string, run failureRunner) (*TrapCorrelation, error) {
+	correlation := &TrapCorrelation{}
+	same := func(candidate []int32) (bool, error) {
+		correlation.Executions++
+		got, err := run(candidate)
+		return got == message, err
+	}
+
+	for i := range args {
+		var relevant uint32
+		for bit := 0; bit < 32; bit++ {
+			candidate := append([]int32(nil), args...)
+			candidate[i] ^= 1 << uint(bit)
+			unchanged, err := same(candidate)
+			if err != nil {
+				return nil, err
+			}
+			if !unchanged {
+				relevant |= 1 << uint(bit)
+			}
+		}
+		if relevant != 0 {
+			correlation.Arguments = append(correlation.Arguments, ArgumentBits{Index: i, Bits: formatBitRanges(relevant)})
+		}
+	}
+
+	minimal := append([]int32(nil), args...)
+	for i := range minimal {
+		for bit := 31; bit >= 0 && minimal[i] != 0; bit-- {
+			mask := int32(1) << uint(bit)
+			if minimal[i]&mask == 0 {
+				continue
+			}
+			candidate := append([]int32(nil), minimal...)
+			candidate[i] &^= mask
+			unchanged, err := same(candidate)
+			if err != nil {
+				return nil, err
+			}
+			if unchanged {
+				minimal = candidate
+			}
+		}
+	}
+
+	correlation.MinimalArgs = encodeValues(i32Values(minimal))
+	return correlation, nil
+}
+
+// formatBitRanges renders the set bits of a mask as compact ranges
+func formatBitRanges(mask uint32) string {
+	var ranges []string
+	for bit := 0; bit < 32; bit++ {
+		if mask&(1<<uint(bit)) == 0 {
+			continue
+		}
+		end := bit
+		for end+1 < 32 && mask&(1<<uint(end+1)) != 0 {
+			end++
+		}
+		if end == bit {
+			ranges = append(ranges, fmt.Sprint(bit))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%d-%d", bit, end))
+		}
+		bit = end
+	}
+	return strings.Join(ranges, ",")
+}
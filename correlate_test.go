@@ -0,0 +1,105 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// predicateRunner fails with message whenever the predicate holds
+func predicateRunner(message string, fails func(int32) bool) failureRunner {
+	return func(args []int32) (string, error) {
+		if fails(args[0]) {
+			return message, nil
+		}
+		return "", nil
+	}
+}
+
+// -----------------------------------------------------------------------------
+// TEST: Trap Correlation
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// A random failing input says little about why it fails. Knowing which bits
+// matter, and having the smallest input that still fails the same way,
+// turns a fuzzer finding into something a developer can reason about.
+// -----------------------------------------------------------------------------
+
+func TestCorrelate_FindsRelevantBitsAndMinimalInput(t *testing.T) {
+	// Fails when the low byte is 0x2a, whatever the rest
+	run := predicateRunner("bad tag", func(v int32) bool { return v&0xff == 0x2a })
+
+	correlation, err := correlateFailure([]int32{0x7fff002a}, "bad tag", run)
+	require.NoError(t, err)
+
+	assert.Equal(t, []ArgumentBits{{Index: 0, Bits: "0-7"}}, correlation.Arguments)
+	assert.Equal(t, []WasmValue{{Type: "i32", Value: "42"}}, correlation.MinimalArgs)
+	assert.Equal(t, 32+18, correlation.Executions, "one flip per bit, one clear per set bit")
+}
+
+func TestCorrelate_SignBitOnly(t *testing.T) {
+	run := predicateRunner("out of bounds memory access", func(v int32) bool { return v < 0 })
+
+	correlation, err := correlateFailure([]int32{-12345}, "out of bounds memory access", run)
+	require.NoError(t, err)
+
+	assert.Equal(t, []ArgumentBits{{Index: 0, Bits: "31"}}, correlation.Arguments)
+	assert.Equal(t, []WasmValue{encodeValue(int32(math.MinInt32))}, correlation.MinimalArgs)
+}
+
+func TestCorrelate_DifferentFailureIsNotTheSame(t *testing.T) {
+	// Clearing the high bit still fails, but with another message
+	run := func(args []int32) (string, error) {
+		switch {
+		case args[0] == 0:
+			return "integer divide by zero", nil
+		case args[0] < 0:
+			return "out of bounds memory access", nil
+		}
+		return "", nil
+	}
+
+	correlation, err := correlateFailure([]int32{0}, "integer divide by zero", run)
+	require.NoError(t, err)
+
+	assert.Equal(t, []ArgumentBits{{Index: 0, Bits: "0-31"}}, correlation.Arguments)
+	assert.Equal(t, []WasmValue{{Type: "i32", Value: "0"}}, correlation.MinimalArgs)
+}
+
+func TestCorrelate_StopsWhenResetFails(t *testing.T) {
+	run := func(args []int32) (string, error) { return "", errors.New("snapshot lost") }
+
+	_, err := correlateFailure([]int32{1}, "trap", run)
+	assert.EqualError(t, err, "snapshot lost")
+}
+
+func TestCorrelate_FormatsBitRanges(t *testing.T) {
+	assert.Equal(t, "", formatBitRanges(0))
+	assert.Equal(t, "0-3,5,30-31", formatBitRanges(0xc000002f))
+	assert.Equal(t, "0-31", formatBitRanges(math.MaxUint32))
+}
+
+func TestCorrelate_ArgFuzzRecordsCorrelation(t *testing.T) {
+	mockRuntime := &MockWasmRuntime{
+		LoadModuleFunc: func(filePath string) (WasmModule, error) {
+			return &statefulCounterModule{counterModule: divisionModule()}, nil
+		},
+	}
+
+	opts := RunOptions{ArgFuzz: ArgFuzzConfig{Iterations: 300, Seed: 7}}
+	result := processWasmFileWithOptions("/test/div.wasm", mockRuntime, opts)
+
+	require.NotNil(t, result.ArgFuzz)
+	require.NotEmpty(t, result.ArgFuzz.UniqueFailures)
+	for _, failure := range result.ArgFuzz.UniqueFailures {
+		require.NotNil(t, failure.Correlation, failure.ErrorMessage)
+		assert.NotEmpty(t, failure.Correlation.Arguments)
+	}
+}
@@ -0,0 +1,638 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ABICosmWasm calls entries as CosmWasm contract entry points
+const ABICosmWasm = "cosmwasm"
+
+// cosmWasmModule is the import module of the CosmWasm host functions
+const cosmWasmModule = "env"
+
+// cosmWasmInterfaceVersion is the export marking contracts built for the
+// CosmWasm 1.x host, the only interface the fuzzer provides
+const cosmWasmInterfaceVersion = "interface_version_8"
+
+// cosmWasmEntries are the contract entry points, and whether they receive
+// the message info after the environment
+var cosmWasmEntries = map[string]bool{
+	"instantiate": true,
+	"execute":     true,
+	"query":       false,
+	"migrate":     false,
+	"sudo":        false,
+	"reply":       false,
+}
+
+// Limits the CosmWasm VM places on values passed to host functions
+const (
+	cosmWasmMaxKey     = 64 << 10
+	cosmWasmMaxValue   = 128 << 10
+	cosmWasmMaxAddress = 256
+	cosmWasmMaxMessage = 2 << 20
+)
+
+// Results of the CosmWasm signature verification functions
+const (
+	cosmWasmValid              = 0
+	cosmWasmInvalid            = 1
+	cosmWasmInvalidHash        = 3
+	cosmWasmInvalidSignature   = 4
+	cosmWasmInvalidPubkey      = 5
+	cosmWasmBatchError         = 7
+	cosmWasmGenericCryptoError = 10
+)
+
+// cosmWasmChainID and cosmWasmHeight describe the block every call is in
+const (
+	cosmWasmChainID = "cosmos-testnet-14002"
+	cosmWasmHeight  = 12345
+)
+
+// cosmWasmCoin is a token amount attached to a call
+type cosmWasmCoin struct {
+	Denom  string `json:"denom"`
+	Amount string `json:"amount"`
+}
+
+var cosmWasmCoinPattern = regexp.MustCompile(`^([0-9]+)([a-zA-Z][a-zA-Z0-9/:._-]{2,127})$`)
+
+// parseCoins parses a comma-separated list of coins such as "100uatom"
+func parseCoins(funds string) ([]cosmWasmCoin, error) {
+	coins := []cosmWasmCoin{}
+	if funds == "" {
+		return coins, nil
+	}
+	for _, coin := range strings.Split(funds, ",") {
+		match := cosmWasmCoinPattern.FindStringSubmatch(strings.TrimSpace(coin))
+		if match == nil {
+			return nil, fmt.Errorf("funds: %q is not AMOUNTDENOM", coin)
+		}
+		coins = append(coins, cosmWasmCoin{Denom: match[2], Amount: match[1]})
+	}
+	return coins, nil
+}
+
+// cosmWasmAddressError reports why an address is not valid. Addresses are
+// checked as the VM's mock API does, without bech32 decoding: they must be
+// lowercase letters and digits, and their canonical form is their bytes.
+func cosmWasmAddressError(address string) string {
+	switch {
+	case len(address) < 3:
+		return "Invalid input: human address too short"
+	case len(address) > cosmWasmMaxAddress:
+		return "Invalid input: human address too long"
+	case strings.ToLower(address) != address:
+		return "Invalid input: address not normalized"
+	case strings.Trim(address, "abcdefghijklmnopqrstuvwxyz0123456789") != "":
+		return "Invalid input: address contains invalid characters"
+	}
+	return ""
+}
+
+// cosmWasmPlatform hosts CosmWasm contracts
+type cosmWasmPlatform struct{}
+
+// validate implements contractPlatform.validate
+func (cosmWasmPlatform) validate(entry string, signature *FuncSignature) error {
+	withInfo, ok := cosmWasmEntries[entry]
+	if !ok {
+		return fmt.Errorf("'%s' is not a contract entry point", entry)
+	}
+	params := "i32 i32"
+	if withInfo {
+		params = "i32 i32 i32"
+	}
+	if want := funcSig(params, "i32"); signature != nil && signature.String() != want.String() {
+		return fmt.Errorf("entry point '%s' must have signature %s, not %s", entry, want, signature)
+	}
+	return nil
+}
+
+// newKernel implements contractPlatform.newKernel
+func (cosmWasmPlatform) newKernel(config ContractConfig, storage *contractStorage) (contractKernel, error) {
+	k := &cosmWasmKernel{
+		config:  config,
+		storage: storage,
+		memory:  &hostMemory{},
+	}
+	if k.config.Address == "" {
+		k.config.Address = "cosmos2contract"
+	}
+	if k.config.Sender == "" {
+		k.config.Sender = "sender"
+	}
+	if k.config.InitEntry == "" {
+		k.config.InitEntry = "instantiate"
+	}
+	if k.config.Init == "" {
+		k.config.Init = defaultContractMessage
+	}
+	for _, address := range []string{k.config.Address, k.config.Sender} {
+		if message := cosmWasmAddressError(address); message != "" {
+			return nil, fmt.Errorf("address %q: %s", address, message)
+		}
+	}
+	if _, ok := cosmWasmEntries[k.config.InitEntry]; !ok {
+		return nil, fmt.Errorf("init_entry: '%s' is not a contract entry point", k.config.InitEntry)
+	}
+
+	coins, err := parseCoins(config.Funds)
+	if err != nil {
+		return nil, err
+	}
+	env, _ := json.Marshal(map[string]interface{}{
+		"block": map[string]interface{}{
+			"height":   cosmWasmHeight,
+			"time":     fmt.Sprint(uint64(wasiClock)),
+			"chain_id": cosmWasmChainID,
+		},
+		"transaction": map[string]interface{}{"index": 0},
+		"contract":    map[string]interface{}{"address": k.config.Address},
+	})
+	info, _ := json.Marshal(map[string]interface{}{"sender": k.config.Sender, "funds": coins})
+	k.env, k.info = env, info
+	return k, nil
+}
+
+// cosmWasmKernel implements the CosmWasm host functions for one contract
+// instance. Data crosses the boundary in regions, which describe a buffer
+// in contract memory; regions returned to the contract are allocated with
+// its allocate export.
+type cosmWasmKernel struct {
+	config  ContractConfig
+	storage *contractStorage
+	memory  *hostMemory
+	module  WasmModule
+
+	// env and info are the JSON environment and message info of every call
+	env, info []byte
+	// readonly is set during queries, which cannot write storage
+	readonly  bool
+	iterators []*cosmWasmIterator
+}
+
+// cosmWasmIterator is a storage range opened with db_scan. Like the VM,
+// it iterates over the range as it was when opened.
+type cosmWasmIterator struct {
+	keys   []string
+	values [][]byte
+}
+
+// next returns the next key and value, or false at the end of the range
+func (it *cosmWasmIterator) next() (string, []byte, bool) {
+	if len(it.keys) == 0 {
+		return "", nil, false
+	}
+	key, value := it.keys[0], it.values[0]
+	it.keys, it.values = it.keys[1:], it.values[1:]
+	return key, value, true
+}
+
+// region reads the region at ptr: the offset, capacity and length of a
+// buffer in contract memory
+func (k *cosmWasmKernel) region(ptr uint64) (offset, capacity, length uint32, err error) {
+	if ptr == 0 {
+		return 0, 0, 0, errors.New("region pointer is null")
+	}
+	data, err := k.memory.read(ptr, 12)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	offset = binary.LittleEndian.Uint32(data)
+	capacity = binary.LittleEndian.Uint32(data[4:])
+	length = binary.LittleEndian.Uint32(data[8:])
+	if length > capacity {
+		return 0, 0, 0, fmt.Errorf("region at 0x%x has length %d beyond its capacity %d", ptr, length, capacity)
+	}
+	return offset, capacity, length, nil
+}
+
+// read returns the contents of the region at ptr, which may be at most
+// limit bytes long
+func (k *cosmWasmKernel) read(ptr uint64, limit int) ([]byte, error) {
+	offset, _, length, err := k.region(ptr)
+	if err != nil {
+		return nil, err
+	}
+	if length > uint32(limit) {
+		return nil, fmt.Errorf("region length %d exceeds the limit of %d bytes", length, limit)
+	}
+	return k.memory.read(uint64(offset), uint64(length))
+}
+
+// write stores data in the region at ptr, which must have the capacity
+func (k *cosmWasmKernel) write(ptr uint64, data []byte) error {
+	offset, capacity, _, err := k.region(ptr)
+	if err != nil {
+		return err
+	}
+	if uint64(len(data)) > uint64(capacity) {
+		return fmt.Errorf("region at 0x%x has capacity %d, %d bytes needed", ptr, capacity, len(data))
+	}
+	if err := k.memory.write(uint64(offset), data); err != nil {
+		return err
+	}
+	return k.memory.writeU32(ptr+8, uint32(len(data)))
+}
+
+// allocate copies data into a new region allocated by the contract
+func (k *cosmWasmKernel) allocate(data []byte) (uint64, error) {
+	returns, err := k.module.Execute("allocate", int32(len(data)))
+	if err != nil {
+		_, message := classifyError(err, StageExecute, "execution failed")
+		return 0, fmt.Errorf("allocate failed: %s", message)
+	}
+	if len(returns) != 1 {
+		return 0, fmt.Errorf("allocate returned %d values", len(returns))
+	}
+	ptr, _ := returns[0].(int32)
+	if ptr == 0 {
+		return 0, fmt.Errorf("allocate could not allocate %d bytes", len(data))
+	}
+	if err := k.write(uint64(uint32(ptr)), data); err != nil {
+		return 0, fmt.Errorf("allocate: %v", err)
+	}
+	return uint64(uint32(ptr)), nil
+}
+
+// bound reads an optional range bound, where a null pointer is unbounded
+func (k *cosmWasmKernel) bound(ptr uint64) ([]byte, error) {
+	if ptr == 0 {
+		return nil, nil
+	}
+	data, err := k.read(ptr, cosmWasmMaxKey)
+	if data == nil && err == nil {
+		data = []byte{}
+	}
+	return data, err
+}
+
+// encodeSections joins byte strings as the VM does, each followed by its
+// big-endian length
+func encodeSections(sections ...[]byte) []byte {
+	var out []byte
+	for _, section := range sections {
+		out = append(out, section...)
+		out = binary.BigEndian.AppendUint32(out, uint32(len(section)))
+	}
+	return out
+}
+
+// decodeSections splits data joined by encodeSections
+func decodeSections(data []byte) ([][]byte, error) {
+	var sections [][]byte
+	for len(data) > 0 {
+		if len(data) < 4 {
+			return nil, errors.New("section length is truncated")
+		}
+		n := uint64(binary.BigEndian.Uint32(data[len(data)-4:]))
+		if n > uint64(len(data)-4) {
+			return nil, fmt.Errorf("section of %d bytes exceeds the data", n)
+		}
+		end := len(data) - 4
+		sections = append([][]byte{data[end-int(n) : end]}, sections...)
+		data = data[:end-int(n)]
+	}
+	return sections, nil
+}
+
+// verifyEd25519 checks one signature, returning a verification result
+func verifyEd25519(msg, sig, pubkey []byte) uint32 {
+	switch {
+	case len(sig) != ed25519.SignatureSize:
+		return cosmWasmInvalidSignature
+	case len(pubkey) != ed25519.PublicKeySize:
+		return cosmWasmInvalidPubkey
+	case ed25519.Verify(pubkey, msg, sig):
+		return cosmWasmValid
+	}
+	return cosmWasmInvalid
+}
+
+// batchEd25519 checks signatures in a batch, where a single message or
+// public key applies to every signature
+func batchEd25519(msgs, sigs, pubkeys [][]byte) uint32 {
+	n := len(sigs)
+	switch {
+	case len(msgs) == 1 && len(pubkeys) == n:
+		for len(msgs) < n {
+			msgs = append(msgs, msgs[0])
+		}
+	case len(pubkeys) == 1 && len(msgs) == n:
+		for len(pubkeys) < n {
+			pubkeys = append(pubkeys, pubkeys[0])
+		}
+	case len(msgs) != n || len(pubkeys) != n:
+		return cosmWasmBatchError
+	}
+	for i := range sigs {
+		if result := verifyEd25519(msgs[i], sigs[i], pubkeys[i]); result != cosmWasmValid {
+			return result
+		}
+	}
+	return cosmWasmValid
+}
+
+// functions returns the CosmWasm host functions by name
+func (k *cosmWasmKernel) functions() map[string]nativeFunction {
+	i32 := func(v uint64, err error) ([]interface{}, error) {
+		return []interface{}{int32(v)}, err
+	}
+	writable := func(name string) error {
+		if k.readonly {
+			return fmt.Errorf("%s is not allowed in queries", name)
+		}
+		return nil
+	}
+	// addressError returns 0 for valid addresses, else a region holding
+	// the reason
+	addressError := func(address string) (uint64, error) {
+		if message := cosmWasmAddressError(address); message != "" {
+			return k.allocate([]byte(message))
+		}
+		return 0, nil
+	}
+	// next advances an iterator, returning a region made from the entry
+	// or 0 at the end of the range
+	next := func(encode func(key string, value []byte) []byte) func(args []uint64) ([]interface{}, error) {
+		return func(args []uint64) ([]interface{}, error) {
+			if args[0] == 0 || args[0] > uint64(len(k.iterators)) {
+				return nil, fmt.Errorf("iterator %d does not exist", args[0])
+			}
+			key, value, ok := k.iterators[args[0]-1].next()
+			if !ok {
+				return i32(0, nil)
+			}
+			return i32(k.allocate(encode(key, value)))
+		}
+	}
+	verify := func(args []uint64) ([]interface{}, error) {
+		var inputs [3][]byte
+		for i := range inputs {
+			var err error
+			if inputs[i], err = k.read(args[i], cosmWasmMaxMessage); err != nil {
+				return nil, err
+			}
+		}
+		return i32(uint64(verifyEd25519(inputs[0], inputs[1], inputs[2])), nil)
+	}
+
+	return map[string]nativeFunction{
+		"db_read": {funcSig("i32", "i32"), func(args []uint64) ([]interface{}, error) {
+			key, err := k.read(args[0], cosmWasmMaxKey)
+			if err != nil {
+				return nil, err
+			}
+			value, ok := k.storage.get(key)
+			if !ok {
+				return i32(0, nil)
+			}
+			return i32(k.allocate(value))
+		}},
+		"db_write": {funcSig("i32 i32", ""), func(args []uint64) ([]interface{}, error) {
+			if err := writable("db_write"); err != nil {
+				return nil, err
+			}
+			key, err := k.read(args[0], cosmWasmMaxKey)
+			if err != nil {
+				return nil, err
+			}
+			value, err := k.read(args[1], cosmWasmMaxValue)
+			if err != nil {
+				return nil, err
+			}
+			k.storage.set(key, value)
+			return nil, nil
+		}},
+		"db_remove": {funcSig("i32", ""), func(args []uint64) ([]interface{}, error) {
+			if err := writable("db_remove"); err != nil {
+				return nil, err
+			}
+			key, err := k.read(args[0], cosmWasmMaxKey)
+			if err != nil {
+				return nil, err
+			}
+			k.storage.remove(key)
+			return nil, nil
+		}},
+		"db_scan": {funcSig("i32 i32 i32", "i32"), func(args []uint64) ([]interface{}, error) {
+			start, err := k.bound(args[0])
+			if err != nil {
+				return nil, err
+			}
+			end, err := k.bound(args[1])
+			if err != nil {
+				return nil, err
+			}
+			if args[2] != 1 && args[2] != 2 {
+				return nil, fmt.Errorf("invalid iteration order %d", int32(args[2]))
+			}
+			it := &cosmWasmIterator{keys: k.storage.keys(start, end, args[2] == 2)}
+			for _, key := range it.keys {
+				it.values = append(it.values, k.storage.data[key])
+			}
+			k.iterators = append(k.iterators, it)
+			return i32(uint64(len(k.iterators)), nil)
+		}},
+		"db_next": {funcSig("i32", "i32"), func(args []uint64) ([]interface{}, error) {
+			if args[0] == 0 || args[0] > uint64(len(k.iterators)) {
+				return nil, fmt.Errorf("iterator %d does not exist", args[0])
+			}
+			// The end of the range is an entry with an empty key
+			key, value, _ := k.iterators[args[0]-1].next()
+			return i32(k.allocate(encodeSections([]byte(key), value)))
+		}},
+		"db_next_key": {funcSig("i32", "i32"), next(func(key string, _ []byte) []byte {
+			return []byte(key)
+		})},
+		"db_next_value": {funcSig("i32", "i32"), next(func(_ string, value []byte) []byte {
+			return value
+		})},
+		"addr_validate": {funcSig("i32", "i32"), func(args []uint64) ([]interface{}, error) {
+			address, err := k.read(args[0], cosmWasmMaxAddress)
+			if err != nil {
+				return nil, err
+			}
+			return i32(addressError(string(address)))
+		}},
+		"addr_canonicalize": {funcSig("i32 i32", "i32"), func(args []uint64) ([]interface{}, error) {
+			address, err := k.read(args[0], cosmWasmMaxAddress)
+			if err != nil {
+				return nil, err
+			}
+			if ptr, err := addressError(string(address)); ptr != 0 || err != nil {
+				return i32(ptr, err)
+			}
+			return i32(0, k.write(args[1], address))
+		}},
+		"addr_humanize": {funcSig("i32 i32", "i32"), func(args []uint64) ([]interface{}, error) {
+			canonical, err := k.read(args[0], cosmWasmMaxAddress)
+			if err != nil {
+				return nil, err
+			}
+			if ptr, err := addressError(string(canonical)); ptr != 0 || err != nil {
+				return i32(ptr, err)
+			}
+			return i32(0, k.write(args[1], canonical))
+		}},
+		"secp256k1_verify": {funcSig("i32 i32 i32", "i32"), func(args []uint64) ([]interface{}, error) {
+			var inputs [3][]byte
+			for i := range inputs {
+				var err error
+				if inputs[i], err = k.read(args[i], cosmWasmMaxMessage); err != nil {
+					return nil, err
+				}
+			}
+			switch {
+			case len(inputs[0]) != 32:
+				return i32(cosmWasmInvalidHash, nil)
+			case len(inputs[1]) != 64:
+				return i32(cosmWasmInvalidSignature, nil)
+			case len(inputs[2]) != 33 && len(inputs[2]) != 65:
+				return i32(cosmWasmInvalidPubkey, nil)
+			}
+			// secp256k1 is not in the standard library, so no signature
+			// verifies
+			return i32(cosmWasmInvalid, nil)
+		}},
+		"secp256k1_recover_pubkey": {funcSig("i32 i32 i32", "i64"), func(args []uint64) ([]interface{}, error) {
+			// The error code is returned in the upper half
+			return []interface{}{int64(cosmWasmGenericCryptoError) << 32}, nil
+		}},
+		"ed25519_verify": {funcSig("i32 i32 i32", "i32"), verify},
+		"ed25519_batch_verify": {funcSig("i32 i32 i32", "i32"), func(args []uint64) ([]interface{}, error) {
+			var batches [3][][]byte
+			for i := range batches {
+				data, err := k.read(args[i], cosmWasmMaxMessage)
+				if err != nil {
+					return nil, err
+				}
+				if batches[i], err = decodeSections(data); err != nil {
+					return nil, err
+				}
+			}
+			return i32(uint64(batchEd25519(batches[0], batches[1], batches[2])), nil)
+		}},
+		"debug": {funcSig("i32", ""), func(args []uint64) ([]interface{}, error) {
+			return nil, nil
+		}},
+		"query_chain": {funcSig("i32", "i32"), func(args []uint64) ([]interface{}, error) {
+			request, err := k.read(args[0], cosmWasmMaxMessage)
+			if err != nil {
+				return nil, err
+			}
+			// There is no chain to query, so every request kind is
+			// unsupported
+			kind := "unknown"
+			var fields map[string]json.RawMessage
+			if json.Unmarshal(request, &fields) == nil && len(fields) == 1 {
+				for name := range fields {
+					kind = name
+				}
+			}
+			result, _ := json.Marshal(map[string]interface{}{
+				"error": map[string]interface{}{"unsupported_request": map[string]string{"kind": kind}},
+			})
+			return i32(k.allocate(result))
+		}},
+		"abort": {funcSig("i32", ""), func(args []uint64) ([]interface{}, error) {
+			message, err := k.read(args[0], cosmWasmMaxMessage)
+			if err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("contract aborted: %s", message)
+		}},
+	}
+}
+
+// link resolves a contract's imports to the host functions. Host
+// functions of newer CosmWasm versions trap when called.
+func (k *cosmWasmKernel) link(imports []wasmFuncImport) ([]HostFunction, error) {
+	functions := k.functions()
+	var host []HostFunction
+	for _, imp := range imports {
+		if imp.Module != cosmWasmModule {
+			continue
+		}
+		fn, ok := functions[imp.Name]
+		if !ok {
+			host = append(host, unsupportedFunction(imp))
+			continue
+		}
+		bound, err := fn.bind(imp)
+		if err != nil {
+			return nil, err
+		}
+		host = append(host, bound)
+	}
+	return host, nil
+}
+
+// instantiate implements contractKernel.instantiate
+func (k *cosmWasmKernel) instantiate(module WasmModule, memory MemoryModule) error {
+	if typed, ok := module.(SignatureModule); ok {
+		for _, export := range []string{cosmWasmInterfaceVersion, "allocate", "deallocate"} {
+			if _, found := typed.Signature(export); !found {
+				return &RuntimeError{Stage: StageSignature, Message: fmt.Sprintf("cosmwasm: module does not export %s", export)}
+			}
+		}
+	}
+	k.module, k.memory.module = module, memory
+	return k.call(module, k.config.InitEntry, []byte(k.config.Init))
+}
+
+// call implements contractKernel.call
+func (k *cosmWasmKernel) call(module WasmModule, entry string, msg []byte) error {
+	k.readonly, k.iterators = entry == "query", nil
+	defer func() { k.readonly, k.iterators = false, nil }()
+
+	inputs := [][]byte{k.env, msg}
+	if cosmWasmEntries[entry] {
+		inputs = [][]byte{k.env, k.info, msg}
+	}
+	args := make([]interface{}, len(inputs))
+	for i, input := range inputs {
+		ptr, err := k.allocate(input)
+		if err != nil {
+			return &RuntimeError{Stage: StageExecute, Message: fmt.Sprintf("cosmwasm: %v", err)}
+		}
+		args[i] = int32(ptr)
+	}
+
+	returns, err := module.Execute(entry, args...)
+	if err != nil {
+		return err
+	}
+	var result []byte
+	if len(returns) == 1 {
+		if ptr, ok := returns[0].(int32); ok {
+			result, err = k.read(uint64(uint32(ptr)), cosmWasmMaxMessage)
+			if err == nil {
+				_, err = module.Execute("deallocate", ptr)
+			}
+		}
+	}
+	if err != nil {
+		return &RuntimeError{Stage: StageExecute, Message: fmt.Sprintf("cosmwasm: %s result: %v", entry, err)}
+	}
+
+	var parsed struct {
+		Ok    json.RawMessage `json:"ok"`
+		Error *string         `json:"error"`
+	}
+	if err := json.Unmarshal(result, &parsed); err != nil || (parsed.Ok == nil && parsed.Error == nil) {
+		return &RuntimeError{Stage: StageExecute, Message: fmt.Sprintf("cosmwasm: %s returned %q, which is not a contract result", entry, result)}
+	}
+	if parsed.Error != nil {
+		return &contractError{message: *parsed.Error}
+	}
+	return nil
+}
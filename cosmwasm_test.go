@@ -0,0 +1,388 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// cosmWasmFunctions are the CosmWasm host functions, for their signatures
+var cosmWasmFunctions = (&cosmWasmKernel{}).functions()
+
+// cosmWasmExports are the exports every test contract has
+var cosmWasmExports = map[string]FuncSignature{
+	cosmWasmInterfaceVersion: funcSig("", ""),
+	"allocate":               funcSig("i32", "i32"),
+	"deallocate":             funcSig("i32", ""),
+	"instantiate":            funcSig("i32 i32 i32", "i32"),
+	"execute":                funcSig("i32 i32 i32", "i32"),
+	"query":                  funcSig("i32 i32", "i32"),
+}
+
+// newCosmWasmContract builds a mock contract with the given entry points,
+// which receive the contents of their argument regions and return the
+// JSON result
+func newCosmWasmContract(entries map[string]func(m *contractModule, inputs [][]byte) (string, error)) *contractModule {
+	exports := map[string]contractExport{
+		"allocate": func(m *contractModule, args []interface{}) ([]interface{}, error) {
+			return []interface{}{m.region(args[0].(int32))}, nil
+		},
+		"deallocate": func(m *contractModule, args []interface{}) ([]interface{}, error) {
+			return nil, nil
+		},
+	}
+	for name, entry := range entries {
+		entry := entry
+		exports[name] = func(m *contractModule, args []interface{}) ([]interface{}, error) {
+			inputs := make([][]byte, len(args))
+			for i, arg := range args {
+				inputs[i] = m.regionData(arg.(int32))
+			}
+			result, err := entry(m, inputs)
+			if err != nil {
+				return nil, err
+			}
+			return []interface{}{m.regionOf(result)}, nil
+		}
+	}
+	signatures := map[string]FuncSignature{}
+	for name, sig := range cosmWasmExports {
+		signatures[name] = sig
+	}
+	return newContractModule(signatures, exports)
+}
+
+// region allocates an empty region with the given capacity
+func (m *contractModule) region(capacity int32) int32 {
+	data := m.bump(capacity, 1)[0].(int32)
+	ptr := m.bump(12, 4)[0].(int32)
+	binary.LittleEndian.PutUint32(m.memory[ptr:], uint32(data))
+	binary.LittleEndian.PutUint32(m.memory[ptr+4:], uint32(capacity))
+	binary.LittleEndian.PutUint32(m.memory[ptr+8:], 0)
+	return ptr
+}
+
+// regionOf allocates a region holding data
+func (m *contractModule) regionOf(data string) int32 {
+	ptr := m.region(int32(len(data)))
+	copy(m.memory[binary.LittleEndian.Uint32(m.memory[ptr:]):], data)
+	binary.LittleEndian.PutUint32(m.memory[ptr+8:], uint32(len(data)))
+	return ptr
+}
+
+// regionData reads the contents of a region
+func (m *contractModule) regionData(ptr int32) []byte {
+	offset := binary.LittleEndian.Uint32(m.memory[ptr:])
+	length := binary.LittleEndian.Uint32(m.memory[ptr+8:])
+	return append([]byte(nil), m.memory[offset:offset+length]...)
+}
+
+// cosmWasmCall invokes a host function with region arguments made from
+// data, returning its result
+func (m *contractModule) cosmWasmCall(name string, data ...string) (int64, error) {
+	args := make([]interface{}, len(data))
+	for i, d := range data {
+		args[i] = m.regionOf(d)
+	}
+	return m.call(name, args...)
+}
+
+// newCosmWasmKernel links a kernel to a mock contract using every host
+// function
+func newCosmWasmKernel(t *testing.T, storage map[string]string) (*cosmWasmKernel, *contractModule) {
+	kernel, err := cosmWasmPlatform{}.newKernel(ContractConfig{}, newContractStorage(storage))
+	require.NoError(t, err)
+	k := kernel.(*cosmWasmKernel)
+	m := newCosmWasmContract(nil)
+	host, err := k.link(moduleImports(contractBinary(cosmWasmModule, cosmWasmFunctions, "db_read", "db_write", "db_scan",
+		"db_next", "db_next_key", "db_next_value", "addr_validate", "addr_canonicalize", "addr_humanize",
+		"ed25519_verify", "ed25519_batch_verify", "secp256k1_verify", "query_chain", "abort")))
+	require.NoError(t, err)
+	for _, fn := range host {
+		m.host[fn.Name] = fn
+	}
+	k.module, k.memory.module = m, m
+	return k, m
+}
+
+// storeContract is a contract whose instantiate stores its environment
+// and info, whose execute handles set, fail and crash messages, and whose
+// query reads a key
+func storeContract() *contractModule {
+	return newCosmWasmContract(map[string]func(m *contractModule, inputs [][]byte) (string, error){
+		"instantiate": func(m *contractModule, inputs [][]byte) (string, error) {
+			if _, err := m.cosmWasmCall("db_write", "env", string(inputs[0])); err != nil {
+				return "", err
+			}
+			if _, err := m.cosmWasmCall("db_write", "info", string(inputs[1])); err != nil {
+				return "", err
+			}
+			return `{"ok":{"messages":[],"attributes":[],"events":[],"data":null}}`, nil
+		},
+		"execute": func(m *contractModule, inputs [][]byte) (string, error) {
+			var msg struct {
+				Set   *struct{ Key, Value string }
+				Fail  *struct{}
+				Crash *struct{}
+			}
+			if err := json.Unmarshal(inputs[2], &msg); err != nil {
+				return `{"error":"Error parsing into type ExecuteMsg"}`, nil
+			}
+			switch {
+			case msg.Set != nil:
+				_, err := m.cosmWasmCall("db_write", msg.Set.Key, msg.Set.Value)
+				return `{"ok":{"messages":[],"attributes":[],"events":[],"data":null}}`, err
+			case msg.Fail != nil:
+				if _, err := m.cosmWasmCall("db_write", "env", "overwritten"); err != nil {
+					return "", err
+				}
+				return `{"error":"Unauthorized"}`, nil
+			default:
+				_, err := m.cosmWasmCall("abort", "panicked at 'attempt to subtract with overflow'")
+				return "", err
+			}
+		},
+		"query": func(m *contractModule, inputs [][]byte) (string, error) {
+			ptr, err := m.cosmWasmCall("db_read", string(inputs[1]))
+			if err != nil {
+				return "", err
+			}
+			if string(inputs[1]) == "write" {
+				_, err := m.cosmWasmCall("db_write", "k", "v")
+				return "", err
+			}
+			value, _ := json.Marshal(m.regionData(int32(ptr)))
+			return `{"ok":` + string(value) + `}`, nil
+		},
+	})
+}
+
+// -----------------------------------------------------------------------------
+// TEST: CosmWasm Contracts
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// CosmWasm contracts receive JSON messages in regions and answer with a
+// JSON result, where an error is an ordinary rejection and only an abort is
+// a crash. Fuzzing them needs the VM's calling convention and host
+// functions, and must tell rejections from crashes.
+// -----------------------------------------------------------------------------
+
+func TestCosmWasm_RunsEntryPoints(t *testing.T) {
+	var contract *contractModule
+	runtime := &contractMockRuntime{newContract: func() *contractModule {
+		contract = storeContract()
+		return contract
+	}}
+	binary := contractBinary(cosmWasmModule, cosmWasmFunctions, "db_read", "db_write", "abort")
+	plan := InvocationConfig{
+		ABI:      ABICosmWasm,
+		Inputs:   messages(`{"set":{"key":"a","value":"1"}}`, `{"fail":{}}`, `not json`),
+		Contract: ContractConfig{Funds: "100uatom,5ujuno"},
+	}
+
+	result := runContract(t, binary, runtime, plan)
+
+	require.True(t, result.Success, result.ErrorMessage)
+	assert.Equal(t, []interface{}{int32(0), int32(1), int32(1)}, invocationReturns(result), "rejections are not failures")
+	assert.Equal(t, "execute", plan.withDefaults().Entry)
+
+	plan.Entry, plan.Inputs = "query", messages("a", "env", "info")
+	var queried []string
+	runtime.newContract = func() *contractModule {
+		m := storeContract()
+		query := m.exports["query"]
+		m.exports["query"] = func(m *contractModule, args []interface{}) ([]interface{}, error) {
+			results, err := query(m, args)
+			if err == nil {
+				var value struct{ Ok []byte }
+				_ = json.Unmarshal(m.regionData(results[0].(int32)), &value)
+				queried = append(queried, string(value.Ok))
+			}
+			return results, err
+		}
+		return m
+	}
+	result = runContract(t, binary, runtime, plan)
+	require.True(t, result.Success, result.ErrorMessage)
+	assert.Equal(t, []string{
+		"",
+		`{"block":{"chain_id":"cosmos-testnet-14002","height":12345,"time":"1700000000000000000"},"contract":{"address":"cosmos2contract"},"transaction":{"index":0}}`,
+		`{"funds":[{"denom":"uatom","amount":"100"},{"denom":"ujuno","amount":"5"}],"sender":"sender"}`,
+	}, queried, "storage holds what instantiate wrote, and the failed call's write is reverted")
+}
+
+func TestCosmWasm_FailuresAndCrashes(t *testing.T) {
+	runtime := &contractMockRuntime{newContract: storeContract}
+	binary := contractBinary(cosmWasmModule, cosmWasmFunctions, "db_read", "db_write", "abort")
+
+	result := runContract(t, binary, runtime, InvocationConfig{ABI: ABICosmWasm, Inputs: messages(`{"crash":{}}`)})
+	assert.Equal(t, StageExecute, result.FailureStage)
+	assert.Equal(t, "execution failed: host function 'abort' failed: contract aborted: panicked at 'attempt to subtract with overflow'", result.ErrorMessage)
+
+	plan := InvocationConfig{ABI: ABICosmWasm, Inputs: messages(`{"fail":{}}`), Contract: ContractConfig{FailOnError: true}}
+	result = runContract(t, binary, runtime, plan)
+	assert.Equal(t, StageExecute, result.FailureStage)
+	assert.Equal(t, "contract returned an error: Unauthorized", result.ErrorMessage)
+
+	plan = InvocationConfig{ABI: ABICosmWasm, Entry: "query", Inputs: messages("write")}
+	result = runContract(t, binary, runtime, plan)
+	assert.Equal(t, StageExecute, result.FailureStage)
+	assert.Equal(t, "execution failed: host function 'db_write' failed: db_write is not allowed in queries", result.ErrorMessage)
+}
+
+func TestCosmWasm_StorageIteration(t *testing.T) {
+	k, m := newCosmWasmKernel(t, map[string]string{"a": "1", "b": "2", "c": "3"})
+
+	next := func(id int64) string {
+		ptr, err := m.call("db_next", id)
+		require.NoError(t, err)
+		sections, err := decodeSections(m.regionData(int32(ptr)))
+		require.NoError(t, err)
+		return string(sections[0]) + "=" + string(sections[1])
+	}
+	ascending, err := m.call("db_scan", m.regionOf("b"), int32(0), int32(1))
+	require.NoError(t, err)
+	descending, err := m.call("db_scan", int32(0), m.regionOf("c"), int32(2))
+	require.NoError(t, err)
+	k.storage.set([]byte("d"), []byte("4"))
+
+	assert.Equal(t, []string{"b=2", "c=3", "="}, []string{next(ascending), next(ascending), next(ascending)},
+		"iterators see the range as it was when opened, and end with an empty key")
+	key, err := m.call("db_next_key", descending)
+	require.NoError(t, err)
+	assert.Equal(t, "b", string(m.regionData(int32(key))))
+	value, err := m.call("db_next_value", descending)
+	require.NoError(t, err)
+	assert.Equal(t, "1", string(m.regionData(int32(value))))
+	end, err := m.call("db_next_key", descending)
+	require.NoError(t, err)
+	assert.Zero(t, end)
+
+	_, err = m.call("db_next", int32(9))
+	assert.EqualError(t, err, "execute: execution failed: host function 'db_next' failed: iterator 9 does not exist")
+	_, err = m.call("db_scan", int32(0), int32(0), int32(3))
+	assert.EqualError(t, err, "execute: execution failed: host function 'db_scan' failed: invalid iteration order 3")
+
+	assert.Equal(t, [][]byte{[]byte("ab"), {}, []byte("c")}, mustDecodeSections(t, encodeSections([]byte("ab"), nil, []byte("c"))))
+	_, err = decodeSections([]byte{1, 0, 0, 0, 9})
+	assert.EqualError(t, err, "section of 9 bytes exceeds the data")
+}
+
+func mustDecodeSections(t *testing.T, data []byte) [][]byte {
+	sections, err := decodeSections(data)
+	require.NoError(t, err)
+	return sections
+}
+
+func TestCosmWasm_APIFunctions(t *testing.T) {
+	_, m := newCosmWasmKernel(t, nil)
+
+	valid, err := m.cosmWasmCall("addr_validate", "cosmos1abc")
+	require.NoError(t, err)
+	assert.Zero(t, valid)
+	invalid, err := m.cosmWasmCall("addr_validate", "Cosmos1abc")
+	require.NoError(t, err)
+	assert.Equal(t, "Invalid input: address not normalized", string(m.regionData(int32(invalid))))
+
+	canonical := m.region(64)
+	_, err = m.call("addr_canonicalize", m.regionOf("cosmos1abc"), canonical)
+	require.NoError(t, err)
+	human := m.region(64)
+	_, err = m.call("addr_humanize", canonical, human)
+	require.NoError(t, err)
+	assert.Equal(t, "cosmos1abc", string(m.regionData(human)))
+	_, err = m.call("addr_canonicalize", m.regionOf("cosmos1abc"), m.region(2))
+	assert.Contains(t, err.Error(), "has capacity 2, 10 bytes needed")
+
+	public, private, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	sig := string(ed25519.Sign(private, []byte("msg")))
+	for msg, want := range map[string]int64{"msg": cosmWasmValid, "other": cosmWasmInvalid} {
+		result, err := m.cosmWasmCall("ed25519_verify", msg, sig, string(public))
+		require.NoError(t, err)
+		assert.Equal(t, want, result, msg)
+	}
+	result, err := m.cosmWasmCall("ed25519_verify", "msg", "short", string(public))
+	require.NoError(t, err)
+	assert.Equal(t, int64(cosmWasmInvalidSignature), result)
+
+	batch := func(msgs, sigs, pubkeys [][]byte) int64 {
+		result, err := m.cosmWasmCall("ed25519_batch_verify", string(encodeSections(msgs...)), string(encodeSections(sigs...)), string(encodeSections(pubkeys...)))
+		require.NoError(t, err)
+		return result
+	}
+	one := [][]byte{[]byte(sig)}
+	assert.Equal(t, int64(cosmWasmValid), batch([][]byte{[]byte("msg")}, append(one, one...), [][]byte{public, public}), "one message applies to every signature")
+	assert.Equal(t, int64(cosmWasmBatchError), batch([][]byte{[]byte("msg"), []byte("msg")}, one, [][]byte{public, public}))
+
+	result, err = m.cosmWasmCall("secp256k1_verify", string(make([]byte, 32)), string(make([]byte, 64)), string(make([]byte, 33)))
+	require.NoError(t, err)
+	assert.Equal(t, int64(cosmWasmInvalid), result, "secp256k1 signatures never verify")
+
+	response, err := m.cosmWasmCall("query_chain", `{"bank":{"balance":{"address":"a","denom":"uatom"}}}`)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"error":{"unsupported_request":{"kind":"bank"}}}`, string(m.regionData(int32(response))))
+
+	_, err = m.call("db_read", int32(0))
+	assert.EqualError(t, err, "execute: execution failed: host function 'db_read' failed: region pointer is null")
+	large := m.region(0)
+	binary.LittleEndian.PutUint32(m.memory[large+4:], cosmWasmMaxKey+1)
+	binary.LittleEndian.PutUint32(m.memory[large+8:], cosmWasmMaxKey+1)
+	_, err = m.call("db_read", large)
+	assert.EqualError(t, err, "execute: execution failed: host function 'db_read' failed: region length 65537 exceeds the limit of 65536 bytes")
+}
+
+func TestCosmWasm_ConfigErrors(t *testing.T) {
+	platform := cosmWasmPlatform{}
+	assert.EqualError(t, platform.validate("process", nil), "'process' is not a contract entry point")
+	signature := funcSig("i32 i32", "i32")
+	assert.EqualError(t, platform.validate("execute", &signature), "entry point 'execute' must have signature (i32, i32, i32) -> (i32), not (i32, i32) -> (i32)")
+	assert.NoError(t, platform.validate("query", &signature))
+
+	for config, message := range map[*ContractConfig]string{
+		{Funds: "uatom"}:      `funds: "uatom" is not AMOUNTDENOM`,
+		{Sender: "Alice"}:     `address "Alice": Invalid input: address not normalized`,
+		{InitEntry: "setup"}:  "init_entry: 'setup' is not a contract entry point",
+		{Address: "a"}:        `address "a": Invalid input: human address too short`,
+		{Sender: "alice-bob"}: `address "alice-bob": Invalid input: address contains invalid characters`,
+	} {
+		_, err := platform.newKernel(*config, newContractStorage(nil))
+		assert.EqualError(t, err, message)
+	}
+
+	binary := contractBinary(cosmWasmModule, cosmWasmFunctions, "db_read", "db_write", "abort")
+	tests := []struct {
+		contract func() *contractModule
+		plan     InvocationConfig
+		stage    FailureStage
+		message  string
+	}{
+		{storeContract, InvocationConfig{Contract: ContractConfig{Init: "not json", InitEntry: "execute"}}, StageExecute,
+			"cosmwasm: initialization failed: Error parsing into type ExecuteMsg"},
+		{func() *contractModule {
+			m := storeContract()
+			delete(m.signatures, cosmWasmInterfaceVersion)
+			return m
+		}, InvocationConfig{}, StageSignature, "cosmwasm: module does not export interface_version_8"},
+		{func() *contractModule {
+			return newCosmWasmContract(map[string]func(m *contractModule, inputs [][]byte) (string, error){
+				"instantiate": func(m *contractModule, inputs [][]byte) (string, error) { return `{"result":1}`, nil },
+			})
+		}, InvocationConfig{}, StageExecute, `cosmwasm: instantiate returned "{\"result\":1}", which is not a contract result`},
+		{storeContract, InvocationConfig{Entry: "process"}, StageSignature, "cosmwasm: 'process' is not a contract entry point"},
+	}
+	for _, tt := range tests {
+		tt.plan.ABI = ABICosmWasm
+		result := runContract(t, binary, &contractMockRuntime{newContract: tt.contract}, tt.plan)
+		assert.Equal(t, tt.stage, result.FailureStage, tt.message)
+		assert.Equal(t, tt.message, result.ErrorMessage)
+	}
+}
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"errors"
+	"hash/fnv"
+	"os"
+
+	"github.com/mrhapile/WASM-Injection-Framework/internal/wasmbin"
+)
+
+// Edge map layout written by instrumented modules
+const (
+	coverageMapSize      = wasmPageSize
+	coverageMemoryExport = "__wasm_fuzzer_coverage"
+	coveragePrevExport   = "__wasm_fuzzer_coverage_prev"
+)
+
+// CoverageConfig enables edge coverage instrumentation
+type CoverageConfig struct {
+	// Enabled rewrites every module to record edge hits before loading it
+	Enabled bool `yaml:"enabled"`
+	// Targets are code locations the mutator steers inputs toward
+	Targets []CoverageTarget `yaml:"targets"`
+}
+
+// CoverageSummary records the edge coverage observed for one file
+type CoverageSummary struct {
+	// Edges is the number of distinct edge map entries hit
+	Edges int `json:"edges"`
+	// Error explains why the module ran without instrumentation
+	Error string `json:"error,omitempty"`
+	// Targets reports the configured targets found in this module
+	Targets []TargetCoverage `json:"targets,omitempty"`
+
+	// hits are the saturated hit counts per map entry
+	hits []byte
+}
+
+// CoverageModule is implemented by modules that can read back the edge map
+// written by instrumented code
+type CoverageModule interface {
+	WasmModule
+	// TakeCoverage returns the hit counts recorded since the last call and
+	// clears them. It returns nil for modules that are not instrumented.
+	TakeCoverage() ([]byte, error)
+}
+
+// coverageEnvironment enables the proposals instrumented modules need. The
+// edge map is an extra memory, so modules that already have one rely on
+// multi-memory support.
+func coverageEnvironment(env Environment) Environment {
+	for _, proposal := range env.Proposals {
+		if proposal == "multi-memories" {
+			return env
+		}
+	}
+	env.Proposals = append(append([]string(nil), env.Proposals...), "multi-memories")
+	return env
+}
+
+// coverageRuntime instruments each module before handing it to the
+// wrapped runtime. Modules that cannot be instrumented are loaded as-is so
+// the runtime still reports their real load or validation error.
+type coverageRuntime struct {
+	runtime WasmRuntime
+	targets []CoverageTarget
+	// comparisons also logs the operands of comparisons, for concolic
+	// argument fuzzing
+	comparisons bool
+	tracker     *coverageTracker
+
+	path string
+	data []byte
+	err  error
+}
+
+func newCoverageRuntime(runtime WasmRuntime, targets []CoverageTarget, comparisons bool) *coverageRuntime {
+	return &coverageRuntime{runtime: runtime, targets: targets, comparisons: comparisons, tracker: newCoverageTracker()}
+}
+
+// LoadModule implements WasmRuntime.LoadModule
+func (r *coverageRuntime) LoadModule(filePath string) (WasmModule, error) {
+	// Modules are reloaded between inputs, so instrument each file once
+	if filePath != r.path {
+		r.path, r.data, r.err = filePath, nil, nil
+		data, err := os.ReadFile(filePath)
+		if err == nil {
+			var layout *coverageLayout
+			r.data, layout, r.err = instrumentEdges(data, r.targets, r.comparisons)
+			r.tracker.setLayout(layout)
+		}
+	}
+	if r.data == nil {
+		return r.runtime.LoadModule(filePath)
+	}
+	return (&bufferRuntime{runtime: r.runtime, data: r.data}).LoadModule(filePath)
+}
+
+// summary reports the coverage collected for the current file
+func (r *coverageRuntime) summary() *CoverageSummary {
+	tracker := r.tracker
+	summary := &CoverageSummary{Edges: tracker.edges, Targets: tracker.targetCoverage(), hits: tracker.hits}
+	if r.err != nil {
+		summary.Error = "instrumentation failed: " + r.err.Error()
+	}
+	return summary
+}
+
+// coverageTracker accumulates the edge map across all executions of a file.
+// A nil tracker collects nothing.
+type coverageTracker struct {
+	hits   []byte
+	virgin []byte
+	edges  int
+
+	// Directed feedback, when the module was instrumented with targets
+	layout   *coverageLayout
+	reached  []bool
+	distance []int
+	// comparisons are the operands of the comparisons the last execution
+	// ran, by site, when they are logged
+	comparisons map[int]comparisonOperands
+}
+
+func newCoverageTracker() *coverageTracker {
+	return &coverageTracker{
+		hits:   make([]byte, coverageMapSize),
+		virgin: make([]byte, coverageMapSize),
+	}
+}
+
+// collect drains the module's coverage memory. newEdges reports a new edge
+// or a new hit-count bucket of a known edge; closer reports that a target
+// was reached for the first time or a guard comparison got closer to it.
+func (t *coverageTracker) collect(module WasmModule) (newEdges, closer bool) {
+	if t == nil {
+		return false, false
+	}
+	source, ok := module.(CoverageModule)
+	if !ok {
+		return false, false
+	}
+	trace, err := source.TakeCoverage()
+	if err != nil || trace == nil {
+		return false, false
+	}
+	if len(trace) > coverageMapSize {
+		directed := trace[coverageMapSize:]
+		if t.layout != nil && t.layout.logsComparisons && len(directed) > coverageMapSize {
+			t.readComparisons(directed[coverageMapSize:])
+			directed = directed[:coverageMapSize]
+		}
+		closer = t.mergeDirected(directed)
+		trace = trace[:coverageMapSize]
+	}
+	return t.merge(trace), closer
+}
+
+// merge adds one execution's hit counts
+func (t *coverageTracker) merge(trace []byte) bool {
+	fresh := false
+	for i, n := range trace {
+		if n == 0 || i >= len(t.hits) {
+			continue
+		}
+		if t.virgin[i] == 0 {
+			t.edges++
+		}
+		if bucket := hitBucket(n); t.virgin[i]&bucket == 0 {
+			t.virgin[i] |= bucket
+			fresh = true
+		}
+		if sum := int(t.hits[i]) + int(n); sum > 0xff {
+			t.hits[i] = 0xff
+		} else {
+			t.hits[i] = byte(sum)
+		}
+	}
+	return fresh
+}
+
+// hitBucket classifies a hit count into AFL's power-of-two buckets, so
+// loop iteration counts only matter when they change in magnitude
+func hitBucket(n byte) byte {
+	switch {
+	case n <= 2:
+		return n
+	case n == 3:
+		return 4
+	case n < 8:
+		return 8
+	case n < 16:
+		return 16
+	case n < 32:
+		return 32
+	case n < 128:
+		return 64
+	}
+	return 128
+}
+
+// instrumentEdges rewrites a module to count edge hits AFL-style: every
+// basic block gets a fixed random ID, and entering a block increments the
+// map entry for the previous block's ID (shifted) XORed with its own. The map
+// is a new memory exported as coverageMemoryExport, and the previous block
+// ID is a new mutable global exported as coveragePrevExport. With targets,
+// a second page of the memory carries directed feedback described by the
+// returned layout. With comparisons, pages after it log the operands of
+// every integer comparison.
+func instrumentEdges(data []byte, targets []CoverageTarget, comparisons bool) ([]byte, *coverageLayout, error) {
+	module, err := parseWasmBinary(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	imports, err := module.importCounts()
+	if err != nil {
+		return nil, nil, err
+	}
+	memories, err := module.vectorCount(sectionMemory)
+	if err != nil {
+		return nil, nil, err
+	}
+	globals, err := module.vectorCount(sectionGlobal)
+	if err != nil {
+		return nil, nil, err
+	}
+	memoryIndex := imports[externMemory] + memories
+	globalIndex := imports[externGlobal] + globals
+
+	code := module.section(sectionCode)
+	if code == nil {
+		return nil, nil, errors.New("module has no function bodies")
+	}
+	bodies, err := parseCodeSection(code.Payload)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var plan *directedPlan
+	if len(targets) > 0 {
+		if plan, err = planDirected(module, code.Offset, bodies, imports[externFunc], targets); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var cmplog *comparisonLog
+	if comparisons {
+		params, err := module.paramCounts()
+		if err != nil {
+			return nil, nil, err
+		}
+		cmplog = &comparisonLog{layout: plan.feedbackLayout(), params: params}
+		if cmplog.layout == nil {
+			cmplog.layout = &coverageLayout{}
+		}
+		cmplog.layout.logsComparisons = true
+	}
+
+	for i := range bodies {
+		var before func(wasmbin.Instruction) []byte
+		if plan != nil {
+			if before, err = plan.hooks(&bodies[i], i, memoryIndex); err != nil {
+				return nil, nil, err
+			}
+		}
+		if cmplog != nil {
+			if before, err = cmplog.hooks(&bodies[i], i, memoryIndex, before); err != nil {
+				return nil, nil, err
+			}
+		}
+		bodies[i].Code, err = instrumentBody(bodies[i].Code, func(offset int) []byte {
+			return edgeProbe(blockID(i, offset), memoryIndex, globalIndex)
+		}, before)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	code.Payload = encodeCodeSection(bodies)
+
+	// Fixed size so the map never moves
+	pages := byte(1)
+	if plan != nil {
+		pages = 2
+	}
+	if cmplog != nil {
+		pages = 2 + comparisonLogPages
+	}
+	if _, err := module.ensureSection(sectionMemory).appendVectorEntry([]byte{0x01, pages, pages}); err != nil {
+		return nil, nil, err
+	}
+	// Mutable i32 initialized to 0
+	if _, err := module.ensureSection(sectionGlobal).appendVectorEntry([]byte{0x7f, 0x01, opI32Const, 0x00, opEnd}); err != nil {
+		return nil, nil, err
+	}
+
+	exports := module.ensureSection(sectionExport)
+	memoryExport := append(wasmbin.AppendName(nil, coverageMemoryExport), externMemory)
+	if _, err := exports.appendVectorEntry(wasmbin.AppendU32(memoryExport, memoryIndex)); err != nil {
+		return nil, nil, err
+	}
+	prevExport := append(wasmbin.AppendName(nil, coveragePrevExport), externGlobal)
+	if _, err := exports.appendVectorEntry(wasmbin.AppendU32(prevExport, globalIndex)); err != nil {
+		return nil, nil, err
+	}
+
+	if cmplog != nil {
+		return module.encode(), cmplog.layout, nil
+	}
+	return module.encode(), plan.feedbackLayout(), nil
+}
+
+// instrumentBody inserts a probe at function entry and at the start of
+// every basic block: loop headers, both arms of an if, the code after a
+// block ends, the fall-through of conditional branches, and exception
+// handlers. probe receives the offset of the instruction that starts the
+// block, which keeps block IDs stable for the same module. before, when
+// set, returns code to insert ahead of an instruction.
+func instrumentBody(code []byte, probe func(offset int) []byte, before func(wasmbin.Instruction) []byte) ([]byte, error) {
+	instructions, err := wasmbin.DecodeInstructions(code)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, len(code)*2)
+	out = append(out, probe(0)...)
+	depth := 0
+	for _, instr := range instructions {
+		if before != nil {
+			out = append(out, before(instr)...)
+		}
+		out = append(out, code[instr.Start:instr.End]...)
+
+		switch instr.Opcode {
+		case opBlock, opTry, opTryTable:
+			depth++
+			continue
+		case opLoop, opIf:
+			depth++
+		case opEnd, opDelegate:
+			if depth == 0 {
+				// The function's final end
+				continue
+			}
+			depth--
+		case opElse, opCatch, opCatchAll, opBrIf, opBrOnNull, opBrOnNonNull:
+		default:
+			continue
+		}
+		out = append(out, probe(instr.End)...)
+	}
+	return out, nil
+}
+
+// blockID derives a stable map index for a block
+func blockID(function, offset int) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte{byte(function), byte(function >> 8), byte(function >> 16), byte(function >> 24)})
+	h.Write([]byte{byte(offset), byte(offset >> 8), byte(offset >> 16), byte(offset >> 24)})
+	return h.Sum32() % coverageMapSize
+}
+
+// edgeProbe encodes: map[id ^ prev]++; prev = id >> 1
+func edgeProbe(id, memoryIndex, globalIndex uint32) []byte {
+	index := func(b []byte) []byte {
+		b = wasmbin.AppendS32(append(b, opI32Const), int32(id))
+		b = wasmbin.AppendU32(append(b, opGlobalGet), globalIndex)
+		return append(b, opI32Xor)
+	}
+
+	probe := index(index(nil))
+	probe = coverageMemArg(append(probe, opI32Load8U), memoryIndex)
+	probe = append(probe, opI32Const, 0x01, opI32Add)
+	probe = coverageMemArg(append(probe, opI32Store8), memoryIndex)
+	probe = wasmbin.AppendS32(append(probe, opI32Const), int32(id>>1))
+	return wasmbin.AppendU32(append(probe, opGlobalSet), globalIndex)
+}
+
+// coverageMemArg appends a byte-aligned, zero-offset memory argument for
+// the coverage memory. Memory 0 uses the plain encoding; others need
+// multi-memory.
+func coverageMemArg(b []byte, memoryIndex uint32) []byte {
+	if memoryIndex == 0 {
+		return append(b, 0x00, 0x00)
+	}
+	return append(wasmbin.AppendU32(append(b, 0x40), memoryIndex), 0x00)
+}
@@ -0,0 +1,254 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mrhapile/WASM-Injection-Framework/internal/wasmbin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// loopIfBody counts its argument down to zero in a loop, then branches on it:
+//
+//	loop
+//	  local.get 0  i32.const 1  i32.sub  local.tee 0  br_if 0
+//	end
+//	local.get 0
+//	if (result i32) i32.const 1 else i32.const 2 end
+var loopIfBody = []byte{
+	0x03, 0x40,
+	0x20, 0x00, 0x41, 0x01, 0x6b, 0x22, 0x00, 0x0d, 0x00,
+	0x0b,
+	0x20, 0x00,
+	0x04, 0x7f, 0x41, 0x01, 0x05, 0x41, 0x02, 0x0b,
+	0x0b,
+}
+
+// buildTestModule assembles a module exporting "process" (i32) -> i32 with
+// the given body, optionally defining a memory of its own
+func buildTestModule(code []byte, withMemory bool) []byte {
+	module := &wasmBinary{}
+	add := func(id byte, payload ...byte) {
+		module.Sections = append(module.Sections, wasmSection{ID: id, Payload: payload})
+	}
+
+	add(sectionType, 0x01, 0x60, 0x01, 0x7f, 0x01, 0x7f)
+	add(sectionFunction, 0x01, 0x00)
+	if withMemory {
+		add(sectionMemory, 0x01, 0x00, 0x01)
+	}
+	add(sectionExport, append(wasmbin.AppendName([]byte{0x01}, "process"), externFunc, 0x00)...)
+
+	body := append([]byte{0x00}, code...)
+	add(sectionCode, append(wasmbin.AppendU32([]byte{0x01}, uint32(len(body))), body...)...)
+	return module.encode()
+}
+
+// countProbes counts the probes in an instrumented module's first body
+func countProbes(t *testing.T, data []byte, globalIndex uint32) int {
+	module, err := parseWasmBinary(data)
+	require.NoError(t, err)
+	bodies, err := parseCodeSection(module.section(sectionCode).Payload)
+	require.NoError(t, err)
+	instructions, err := wasmbin.DecodeInstructions(bodies[0].Code)
+	require.NoError(t, err)
+
+	probes := 0
+	for _, instr := range instructions {
+		if instr.Opcode == opGlobalSet && instr.Index == globalIndex {
+			probes++
+		}
+	}
+	return probes
+}
+
+// coverageMockModule returns canned edge maps from TakeCoverage
+type coverageMockModule struct {
+	MockWasmModule
+	traces [][]byte
+}
+
+func (m *coverageMockModule) TakeCoverage() ([]byte, error) {
+	if len(m.traces) == 0 {
+		return make([]byte, coverageMapSize), nil
+	}
+	trace := m.traces[0]
+	m.traces = m.traces[1:]
+	return trace, nil
+}
+
+// edgeTrace builds an edge map with the given entries hit
+func edgeTrace(hits map[int]byte) []byte {
+	trace := make([]byte, coverageMapSize)
+	for i, n := range hits {
+		trace[i] = n
+	}
+	return trace
+}
+
+// -----------------------------------------------------------------------------
+// TEST: Edge Coverage Instrumentation
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// The rewritten module must stay valid and behave identically apart from
+// the probes, or coverage runs would report failures the original module
+// never had. Probes must sit at every basic block start and nowhere else,
+// and their IDs must be stable so coverage is comparable between runs.
+// -----------------------------------------------------------------------------
+
+func TestCoverage_ProbesEveryBasicBlock(t *testing.T) {
+	instrumented, _, err := instrumentEdges(buildTestModule(loopIfBody, false), nil, false)
+	require.NoError(t, err)
+
+	// entry, loop header, br_if fall-through, after loop, then, else, after if
+	assert.Equal(t, 7, countProbes(t, instrumented, 0))
+
+	module, err := parseWasmBinary(instrumented)
+	require.NoError(t, err)
+	exports := module.section(sectionExport).Payload
+	assert.True(t, bytes.Contains(exports, []byte(coverageMemoryExport)))
+	assert.True(t, bytes.Contains(exports, []byte(coveragePrevExport)))
+	count, err := module.vectorCount(sectionMemory)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1), count, "a memory section is added for the map")
+}
+
+func TestCoverage_PreservesSectionOrder(t *testing.T) {
+	instrumented, _, err := instrumentEdges(buildTestModule(loopIfBody, false), nil, false)
+	require.NoError(t, err)
+
+	module, err := parseWasmBinary(instrumented)
+	require.NoError(t, err)
+	last := 0
+	for _, section := range module.Sections {
+		order := sectionOrder[section.ID]
+		assert.Greater(t, order, last, "section %d out of order", section.ID)
+		last = order
+	}
+}
+
+func TestCoverage_UsesDedicatedMemory(t *testing.T) {
+	instrumented, _, err := instrumentEdges(buildTestModule(loopIfBody, true), nil, false)
+	require.NoError(t, err)
+
+	// The module's own memory stays index 0; the map is memory 1
+	probe := edgeProbe(blockID(0, 0), 1, 0)
+	assert.True(t, bytes.Contains(instrumented, probe))
+	assert.True(t, bytes.Contains(probe, []byte{opI32Load8U, 0x40, 0x01, 0x00}), "multi-memory memarg")
+}
+
+func TestCoverage_BlockIDsAreStable(t *testing.T) {
+	first, _, err := instrumentEdges(buildTestModule(loopIfBody, false), nil, false)
+	require.NoError(t, err)
+	second, _, err := instrumentEdges(buildTestModule(loopIfBody, false), nil, false)
+	require.NoError(t, err)
+
+	assert.Equal(t, first, second)
+}
+
+func TestCoverage_InstrumentsCorpus(t *testing.T) {
+	files, err := filepath.Glob("corpus/*.wasm")
+	require.NoError(t, err)
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		require.NoError(t, err)
+		instrumented, _, err := instrumentEdges(data, nil, false)
+		if err != nil {
+			continue
+		}
+		_, err = parseWasmBinary(instrumented)
+		assert.NoError(t, err, file)
+	}
+}
+
+func TestCoverage_RejectsUnsupportedOpcodes(t *testing.T) {
+	// 0xfb prefixes GC instructions, which are not decoded
+	_, _, err := instrumentEdges(buildTestModule([]byte{0xfb, 0x00, 0x0b}, false), nil, false)
+	assert.ErrorContains(t, err, "unsupported opcode 0xfb")
+}
+
+func TestCoverage_OversizedBodyCountFailsTheModule(t *testing.T) {
+	// A code section claiming 2^32-1 bodies in 5 bytes
+	_, err := parseCodeSection([]byte{0xff, 0xff, 0xff, 0xff, 0x0f})
+	assert.ErrorIs(t, err, wasmbin.ErrTruncated)
+}
+
+// -----------------------------------------------------------------------------
+// TEST: Coverage Feedback
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Coverage is only useful as feedback if repeated executions of the same
+// path are not reported as progress, while new edges and significant
+// changes in loop counts are.
+// -----------------------------------------------------------------------------
+
+func TestCoverage_TrackerReportsNewEdgesAndBuckets(t *testing.T) {
+	tracker := newCoverageTracker()
+
+	assert.True(t, tracker.merge(edgeTrace(map[int]byte{10: 1, 20: 1})))
+	assert.False(t, tracker.merge(edgeTrace(map[int]byte{10: 1})), "same path again")
+	assert.True(t, tracker.merge(edgeTrace(map[int]byte{10: 9})), "loop count changed bucket")
+	assert.False(t, tracker.merge(edgeTrace(map[int]byte{10: 12})), "same bucket")
+	assert.Equal(t, 2, tracker.edges)
+}
+
+func TestCoverage_NilTrackerCollectsNothing(t *testing.T) {
+	var tracker *coverageTracker
+	newEdges, closer := tracker.collect(&coverageMockModule{})
+	assert.False(t, newEdges)
+	assert.False(t, closer)
+}
+
+func TestCoverage_PipelineReportsEdges(t *testing.T) {
+	module := &coverageMockModule{traces: [][]byte{
+		edgeTrace(nil), // after load
+		edgeTrace(map[int]byte{1: 1, 2: 1}),
+		edgeTrace(map[int]byte{2: 1, 3: 1}),
+	}}
+	runtime := &MockWasmRuntime{
+		LoadModuleFunc: func(filePath string) (WasmModule, error) { return module, nil },
+	}
+	path := filepath.Join(t.TempDir(), "loop.wasm")
+	require.NoError(t, os.WriteFile(path, buildTestModule(loopIfBody, false), 0o644))
+
+	opts := RunOptions{Invocation: InvocationConfig{Inputs: i32Inputs(1, 2)}, Coverage: CoverageConfig{Enabled: true}}
+	result := processWasmFileWithOptions(path, runtime, opts)
+
+	require.NotNil(t, result.Coverage)
+	assert.Equal(t, 3, result.Coverage.Edges)
+	assert.Empty(t, result.Coverage.Error)
+}
+
+func TestCoverage_UninstrumentableModulesStillRun(t *testing.T) {
+	var loaded string
+	runtime := &MockWasmRuntime{
+		LoadModuleFunc: func(filePath string) (WasmModule, error) {
+			loaded = filePath
+			return &MockWasmModule{}, nil
+		},
+	}
+	path := filepath.Join(t.TempDir(), "gc.wasm")
+	require.NoError(t, os.WriteFile(path, buildTestModule([]byte{0xfb, 0x00, 0x0b}, false), 0o644))
+
+	result := processWasmFileWithOptions(path, runtime, RunOptions{Coverage: CoverageConfig{Enabled: true}})
+
+	assert.True(t, result.Success)
+	assert.Equal(t, path, loaded, "the original file is loaded")
+	require.NotNil(t, result.Coverage)
+	assert.Contains(t, result.Coverage.Error, "instrumentation failed")
+}
+
+func TestCoverage_EnablesMultiMemory(t *testing.T) {
+	env := coverageEnvironment(Environment{Proposals: []string{"simd"}})
+	assert.Equal(t, []string{"simd", "multi-memories"}, env.Proposals)
+	assert.Equal(t, env, coverageEnvironment(env), "already enabled")
+}
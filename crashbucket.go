@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// crashBucketExamples is how many files each crash bucket names
+const crashBucketExamples = 5
+
+// coreBacktraceTimeout bounds the debugger's run on a core dump
+const coreBacktraceTimeout = 30 * time.Second
+
+// CrashInfo describes how an isolated worker crashed on a file
+type CrashInfo struct {
+	// Signal is the signal that killed the worker, such as SIGSEGV. Go
+	// reports the original signal of a fault it turned into an abort.
+	Signal string `json:"signal"`
+	// Frame is the innermost function on the crashing stack that is not
+	// signal or sanitizer machinery, when a stack was found
+	Frame string `json:"frame,omitempty"`
+	// Address is the faulting address, when one was reported
+	Address string `json:"address,omitempty"`
+	// AddressClass normalizes the address: null, mapped or non-canonical
+	AddressClass string `json:"address_class,omitempty"`
+}
+
+// signature buckets the crash: crashes with the same signal, frame and
+// kind of address are taken to be the same bug
+func (c *CrashInfo) signature() string {
+	frame, class := c.Frame, c.AddressClass
+	if frame == "" {
+		frame = "unknown"
+	}
+	if class == "" {
+		class = "unknown"
+	}
+	return "crash:" + c.Signal + ":" + frame + ":" + class
+}
+
+// CrashBucket counts the crashes of a campaign with the same signature
+type CrashBucket struct {
+	Signature    string `json:"signature"`
+	Signal       string `json:"signal"`
+	Frame        string `json:"frame,omitempty"`
+	AddressClass string `json:"address_class,omitempty"`
+	Count        int    `json:"count"`
+	// Files names the first few files that crashed this way
+	Files []string `json:"files"`
+}
+
+// exitSignals maps how Go describes the signals of a worker's exit to
+// their names
+var exitSignals = map[string]string{
+	"segmentation fault":       "SIGSEGV",
+	"bus error":                "SIGBUS",
+	"aborted":                  "SIGABRT",
+	"illegal instruction":      "SIGILL",
+	"floating point exception": "SIGFPE",
+	"trace/breakpoint trap":    "SIGTRAP",
+	"bad system call":          "SIGSYS",
+}
+
+var (
+	// goSignalPattern matches Go's report of the signal it crashed on:
+	// "SIGSEGV: segmentation violation" or "[signal SIGSEGV: ..."
+	goSignalPattern = regexp.MustCompile(`\b(SIG[A-Z]+): `)
+	// sanitizerSignalPattern matches a sanitizer's report of a fault,
+	// such as "AddressSanitizer: SEGV on unknown address"
+	sanitizerSignalPattern = regexp.MustCompile(`Sanitizer: (SEGV|BUS|FPE|ILL) on `)
+	// faultAddressPattern matches the faulting address in Go's report,
+	// "addr=0x0", or a sanitizer's, "on unknown address 0x000000000000"
+	faultAddressPattern = regexp.MustCompile(`(?:\baddr=|\baddress )(0x[0-9a-fA-F]+)`)
+	// nativeFramePattern matches the frames of sanitizer and debugger
+	// backtraces: "#0 0x7f00 in func file" or "#0  func (args) at file"
+	nativeFramePattern = regexp.MustCompile(`(?m)^\s*#\d+\s+(?:0x[0-9a-fA-F]+ in )?([^\s(]+)`)
+	// goFramePattern matches the frames of a Go traceback, such as
+	// "github.com/x/wasmedge.(*VM).Execute(0xc000010000, ...)"
+	goFramePattern = regexp.MustCompile(`(?m)^(\S+)\((?:0x[0-9a-fA-F]|\.\.\.|\)|\{)`)
+)
+
+// uninformativeFrames prefix the frames of signal delivery, aborts and
+// sanitizer machinery, which every crash of a kind shares
+var uninformativeFrames = []string{"runtime.", "__", "raise", "abort", "gsignal", "pthread_kill", "_Unwind", "??"}
+
+// coreBacktrace returns the backtrace of the fuzzer's core dump core, or
+// empty when it cannot be had
+var coreBacktrace = gdbBacktrace
+
+// parseCrash describes a worker crash from how it exited and what it
+// wrote to stderr. It returns nil when the worker did not die of a signal.
+func parseCrash(exit, stderr string) *CrashInfo {
+	if !crashSignal(exit) {
+		return nil
+	}
+	description := strings.TrimSuffix(strings.TrimPrefix(exit, "signal: "), " (core dumped)")
+	crash := &CrashInfo{Signal: exitSignals[description]}
+	if crash.Signal == "" {
+		crash.Signal = description
+	}
+	// An abort may be how Go or a sanitizer ended a fault
+	if match := goSignalPattern.FindStringSubmatch(stderr); match != nil {
+		crash.Signal = match[1]
+	} else if match := sanitizerSignalPattern.FindStringSubmatch(stderr); match != nil {
+		crash.Signal = "SIG" + match[1]
+	}
+	if match := faultAddressPattern.FindStringSubmatch(stderr); match != nil {
+		if address, err := strconv.ParseUint(match[1], 0, 64); err == nil {
+			crash.Address = match[1]
+			crash.AddressClass = classifyAddress(address)
+		}
+	}
+	crash.Frame = topFrame(stderr)
+	return crash
+}
+
+// classifyAddress normalizes a faulting address, which varies between
+// runs with the layout of memory, into its kind: an access near null, to
+// the canonical user address space, or beyond it
+func classifyAddress(address uint64) string {
+	switch {
+	case address < 0x10000:
+		return "null"
+	case address >= 1<<47:
+		return "non-canonical"
+	default:
+		return "mapped"
+	}
+}
+
+// topFrame returns the innermost informative frame of the native
+// backtrace in text, or of its Go traceback when there is none
+func topFrame(text string) string {
+	for _, match := range nativeFramePattern.FindAllStringSubmatch(text, -1) {
+		if frame := match[1]; informativeFrame(frame) {
+			return frame
+		}
+	}
+	if i := strings.Index(text, "\ngoroutine "); i >= 0 {
+		for _, match := range goFramePattern.FindAllStringSubmatch(text[i:], -1) {
+			// Package paths vary with where the fuzzer was built
+			frame := match[1][strings.LastIndex(match[1], "/")+1:]
+			if informativeFrame(frame) {
+				return frame
+			}
+		}
+	}
+	return ""
+}
+
+// informativeFrame reports whether a frame tells crashes apart
+func informativeFrame(frame string) bool {
+	for _, prefix := range uninformativeFrames {
+		if strings.HasPrefix(frame, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// gdbBacktrace has gdb, when installed, print the backtrace of a core
+// dump of the fuzzer's workers
+func gdbBacktrace(core string) string {
+	gdb, err := exec.LookPath("gdb")
+	if err != nil {
+		return ""
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return ""
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), coreBacktraceTimeout)
+	defer cancel()
+	out, _ := exec.CommandContext(ctx, gdb, "-batch", "-nx", "-ex", "bt", self, core).Output()
+	return string(out)
+}
+
+// locateCrash fills in the frame of a crash from the core dump in its
+// bundle, when its stderr held no stack
+func locateCrash(crash *CrashInfo, bundle string) {
+	if crash == nil || crash.Frame != "" || bundle == "" {
+		return
+	}
+	core := filepath.Join(bundle, "core")
+	if _, err := os.Stat(core); err == nil {
+		crash.Frame = topFrame(coreBacktrace(core))
+	}
+}
+
+// bucketCrashes groups the crashed results of a report by signature,
+// largest bucket first
+func bucketCrashes(results []ExecutionResult) []CrashBucket {
+	index := make(map[string]int)
+	var buckets []CrashBucket
+	for _, result := range results {
+		if result.Crash == nil {
+			continue
+		}
+		signature := result.Crash.signature()
+		i, ok := index[signature]
+		if !ok {
+			i = len(buckets)
+			index[signature] = i
+			buckets = append(buckets, CrashBucket{
+				Signature:    signature,
+				Signal:       result.Crash.Signal,
+				Frame:        result.Crash.Frame,
+				AddressClass: result.Crash.AddressClass,
+			})
+		}
+		buckets[i].Count++
+		if len(buckets[i].Files) < crashBucketExamples {
+			buckets[i].Files = append(buckets[i].Files, result.FilePath)
+		}
+	}
+	sort.SliceStable(buckets, func(i, j int) bool { return buckets[i].Count > buckets[j].Count })
+	return buckets
+}
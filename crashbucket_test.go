@@ -0,0 +1,161 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// goFault is what a worker run with GOTRACEBACK=crash writes when the
+// runtime faults under a cgo call
+const goFault = `SIGSEGV: segmentation violation
+PC=0x7f3a2c1b4d10 m=0 sigcode=1 addr=0x8
+signal arrived during cgo execution
+
+goroutine 1 [syscall]:
+runtime.cgocall(0x5c2d40, 0xc00006fa28)
+	/usr/local/go/src/runtime/cgocall.go:157 +0x4b fp=0xc00006fa00
+github.com/second-state/WasmEdge-go/wasmedge._Cfunc_WasmEdge_VMExecute(0x1d2e4f0, {0x1d2e6a0, 0x7}, 0x0, 0x0, 0x0, 0x0)
+	_cgo_gotypes.go:4401 +0x4f
+github.com/second-state/WasmEdge-go/wasmedge.(*VM).Execute(0xc000010000, {0x5d1e3a, 0x7}, {0x0, 0x0, 0x0})
+	/root/go/pkg/mod/github.com/second-state/WasmEdge-go@v0.13.4/wasmedge/vm.go:247 +0x1c5
+`
+
+// -----------------------------------------------------------------------------
+// TEST: Crash Bucketing
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// A runtime bug a mutator hits once it hits thousands of times, each with
+// its own addresses. Counting crashes by signal, crashing frame and kind
+// of faulting address turns thousands of SIGSEGVs into the few bugs
+// behind them.
+// -----------------------------------------------------------------------------
+
+func TestParseCrash_GoFault(t *testing.T) {
+	crash := parseCrash("signal: aborted (core dumped)", goFault)
+
+	require.NotNil(t, crash)
+	assert.Equal(t, "SIGSEGV", crash.Signal, "the fault Go turned into an abort")
+	assert.Equal(t, "wasmedge._Cfunc_WasmEdge_VMExecute", crash.Frame)
+	assert.Equal(t, "0x8", crash.Address)
+	assert.Equal(t, "null", crash.AddressClass)
+	assert.Equal(t, "crash:SIGSEGV:wasmedge._Cfunc_WasmEdge_VMExecute:null", crash.signature())
+}
+
+func TestParseCrash_SanitizerFault(t *testing.T) {
+	stderr := "==7==ERROR: AddressSanitizer: SEGV on unknown address 0x7f1200345678 (pc 0x7f00 bp 0x7ff0 sp 0x7fe0 T0)\n" +
+		"    #0 0x7f00 in __interceptor_memcpy\n" +
+		"    #1 0x7f01 in WasmEdge::Executor::runMemoryCopyOp lib/executor/engine/memory.cpp:140\n"
+	crash := parseCrash("signal: aborted", stderr)
+
+	require.NotNil(t, crash)
+	assert.Equal(t, "SIGSEGV", crash.Signal)
+	assert.Equal(t, "WasmEdge::Executor::runMemoryCopyOp", crash.Frame, "interceptors are skipped")
+	assert.Equal(t, "mapped", crash.AddressClass)
+}
+
+func TestParseCrash_SignalOnly(t *testing.T) {
+	crash := parseCrash("signal: bus error", "")
+	require.NotNil(t, crash)
+	assert.Equal(t, "crash:SIGBUS:unknown:unknown", crash.signature())
+
+	assert.Nil(t, parseCrash("signal: killed", goFault), "a hang is not a crash")
+	assert.Nil(t, parseCrash("exit status 1", ""))
+}
+
+func TestClassifyAddress(t *testing.T) {
+	assert.Equal(t, "null", classifyAddress(0))
+	assert.Equal(t, "null", classifyAddress(0xfff8))
+	assert.Equal(t, "mapped", classifyAddress(0x602000000018))
+	assert.Equal(t, "non-canonical", classifyAddress(0xdead000000000000))
+}
+
+func TestLocateCrash_FromCoreDump(t *testing.T) {
+	bundle := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(bundle, "core"), []byte("core"), 0o600))
+	original := coreBacktrace
+	coreBacktrace = func(core string) string {
+		assert.Equal(t, filepath.Join(bundle, "core"), core)
+		return "#0  0x00007f00 in raise () from /lib/libc.so.6\n" +
+			"#1  WasmEdge::Executor::Executor::execute (this=0x1) at executor.cpp:52\n"
+	}
+	defer func() { coreBacktrace = original }()
+
+	crash := &CrashInfo{Signal: "SIGSEGV"}
+	locateCrash(crash, bundle)
+	assert.Equal(t, "WasmEdge::Executor::Executor::execute", crash.Frame)
+}
+
+func TestBucketCrashes_CollapsesAddresses(t *testing.T) {
+	var results []ExecutionResult
+	for i := 0; i < 50; i++ {
+		stderr := fmt.Sprintf("SIGSEGV: segmentation violation\nPC=0x7f00 m=0 sigcode=1 addr=0x%x\n\ngoroutine 1 [syscall]:\n%s", 8*i, goFault[len("SIGSEGV"):])
+		results = append(results, ExecutionResult{FilePath: fmt.Sprintf("null_%d.wasm", i), Crash: parseCrash("signal: aborted", stderr)})
+	}
+	results = append(results,
+		ExecutionResult{FilePath: "bus.wasm", Crash: parseCrash("signal: bus error", "")},
+		ExecutionResult{FilePath: "trap.wasm"},
+	)
+
+	buckets := bucketCrashes(results)
+
+	require.Len(t, buckets, 2)
+	assert.Equal(t, "crash:SIGSEGV:wasmedge._Cfunc_WasmEdge_VMExecute:null", buckets[0].Signature)
+	assert.Equal(t, 50, buckets[0].Count)
+	assert.Len(t, buckets[0].Files, crashBucketExamples)
+	assert.Equal(t, "crash:SIGBUS:unknown:unknown", buckets[1].Signature)
+	assert.Equal(t, []string{"bus.wasm"}, buckets[1].Files)
+}
+
+func TestIsolate_BucketsWorkerCrashes(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.wasm", "b.wasm"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte{0}, 0o644))
+	}
+	runtime := &MockWasmRuntime{}
+	fakeWorkers(t, runtime)
+	startFake := startWorker
+	startWorker = func(args, env []string) (*workerProcess, error) {
+		process, err := startFake(args, env)
+		process.stderr = &workerStderr{}
+		kill := process.kill
+		process.requests = writerFunc(func(p []byte) (int, error) {
+			process.stderr.Write([]byte(goFault))
+			kill()
+			return len(p), nil
+		})
+		process.wait = func() string { return "signal: aborted (core dumped)" }
+		return process, err
+	}
+
+	report, err := runFuzzerWithMatrix(dir, []environmentRuntime{{Runtime: runtime}}, RunOptions{WorkerArgs: []string{dir}})
+	require.NoError(t, err)
+
+	require.Len(t, report.Results, 2)
+	signature := "crash:SIGSEGV:wasmedge._Cfunc_WasmEdge_VMExecute:null"
+	for _, result := range report.Results {
+		require.NotNil(t, result.Crash)
+		require.NotNil(t, result.Classification)
+		assert.Equal(t, signature, result.Classification.Signature)
+	}
+	require.Len(t, report.CrashBuckets, 1)
+	assert.Equal(t, 2, report.CrashBuckets[0].Count)
+	assert.Empty(t, validateReport(report))
+}
+
+func TestSecurityReason_FaultBehindAbort(t *testing.T) {
+	failure := FailureInfo{
+		Stage:   StageExecute,
+		Message: "worker died in the execute stage: signal: aborted (core dumped)",
+		Crash:   parseCrash("signal: aborted (core dumped)", goFault),
+	}
+	assert.Equal(t, "runtime segmentation fault in the execute stage", securityReason(failure))
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CrashConfig keeps what runtime maintainers need of the hard crashes of
+// isolated workers: a bundle per crash holding the module and the
+// worker's core dump
+type CrashConfig struct {
+	// Dir holds the crash bundles
+	Dir string `yaml:"dir"`
+	// Budget caps the disk space of Dir, such as 2GiB. Core dumps that do
+	// not fit are dropped, and modules too once those do not fit either.
+	Budget ByteSize `yaml:"budget"`
+}
+
+// enabled reports whether crashes are kept
+func (c CrashConfig) enabled() bool {
+	return c.Dir != ""
+}
+
+// findCoreDump returns the core dump a crashed worker left, written no
+// earlier than since, or empty with why there is none
+var findCoreDump = coreDumpPath
+
+// crashStore writes crash bundles within the budget. A nil crashStore
+// keeps nothing.
+type crashStore struct {
+	config CrashConfig
+	// used is the size of Dir, counted on the first crash
+	used    int64
+	counted bool
+}
+
+// newCrashStore returns a store for the config, or nil when crashes are
+// not kept. Workers are allowed to dump core, which is usually disabled.
+func newCrashStore(config CrashConfig) *crashStore {
+	if !config.enabled() {
+		return nil
+	}
+	if err := enableCoreDumps(); err != nil {
+		emitError(map[string]string{
+			"warning": "core dumps unavailable",
+			"details": err.Error(),
+		})
+	}
+	return &crashStore{config: config}
+}
+
+// crashSignal reports whether a worker's exit is a crash worth keeping:
+// death by any signal but the kill a hang or an OOM killer sends
+func crashSignal(exit string) bool {
+	return strings.HasPrefix(exit, "signal: ") && exit != "signal: killed"
+}
+
+// keep bundles the module that crashed worker pid, started at started,
+// with its core dump. It returns the bundle's directory, or empty when
+// nothing fit the budget.
+func (s *crashStore) keep(filePath string, pid int, started time.Time, exit string) string {
+	if s == nil {
+		return ""
+	}
+	bundle, err := s.write(filePath, pid, started, exit)
+	if err != nil {
+		emitError(map[string]string{
+			"warning": "failed to keep crash",
+			"file":    filePath,
+			"details": err.Error(),
+		})
+	}
+	return bundle
+}
+
+func (s *crashStore) write(filePath string, pid int, started time.Time, exit string) (string, error) {
+	core, coreNote := findCoreDump(pid, started)
+	var coreSize int64
+	if core != "" {
+		if info, err := os.Stat(core); err == nil {
+			coreSize = info.Size()
+		} else {
+			core, coreNote = "", err.Error()
+		}
+	}
+	// The core belongs to the store once found, kept or not
+	dropCore := func(reason string) {
+		os.Remove(core)
+		core, coreNote = "", fmt.Sprintf("core dump of %d bytes dropped: %s", coreSize, reason)
+	}
+
+	if err := os.MkdirAll(s.config.Dir, 0o755); err != nil {
+		dropCore("crash directory unavailable")
+		return "", err
+	}
+	if !s.counted {
+		s.used, s.counted = directorySize(s.config.Dir), true
+	}
+	module, err := os.ReadFile(filePath)
+	if err != nil {
+		dropCore("module unreadable")
+		return "", err
+	}
+	info := []byte(fmt.Sprintf("file: %s\nworker: %d\nexit: %s\n", filePath, pid, exit))
+	size := int64(len(module) + len(info))
+	budget := int64(s.config.Budget)
+	if budget > 0 && s.used+size > budget {
+		if core != "" {
+			dropCore("over the crash budget")
+		}
+		return "", fmt.Errorf("module of %d bytes is over the crash budget of %s", len(module), s.config.Budget)
+	}
+	if core != "" && budget > 0 && s.used+size+coreSize > budget {
+		dropCore("over the crash budget")
+	}
+
+	bundle := filepath.Join(s.config.Dir, strings.TrimSuffix(filepath.Base(filePath), ".wasm")+"-"+strconv.Itoa(pid))
+	if err := os.MkdirAll(bundle, 0o755); err != nil {
+		if core != "" {
+			dropCore("bundle unavailable")
+		}
+		return "", err
+	}
+	if err := writeArtifact(filepath.Join(bundle, filepath.Base(filePath)), module, 0o644); err != nil {
+		return "", err
+	}
+	s.used += size
+	if core != "" {
+		if err := moveFile(core, filepath.Join(bundle, "core")); err != nil {
+			dropCore(err.Error())
+		} else {
+			s.used += coreSize
+			coreNote = fmt.Sprintf("core (%d bytes)", coreSize)
+		}
+	}
+	info = append(info, "core dump: "+coreNote+"\n"...)
+	return bundle, writeArtifact(filepath.Join(bundle, "crash.txt"), info, 0o644)
+}
+
+// directorySize sums the sizes of the files under dir
+func directorySize(dir string) int64 {
+	var size int64
+	filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err == nil && entry.Type().IsRegular() {
+			if info, err := entry.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
+
+// moveFile renames a file, copying it when it is on another filesystem
+func moveFile(from, to string) error {
+	if os.Rename(from, to) == nil {
+		return nil
+	}
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.Create(to)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		os.Remove(to)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	return os.Remove(from)
+}
+
+// expandCorePattern turns a core_pattern into a glob matching the core
+// dumps of process pid. Specifiers other than the pid match anything;
+// usesPID appends the pid as core_uses_pid does.
+func expandCorePattern(pattern string, pid int, usesPID bool) string {
+	var glob strings.Builder
+	hasPID := false
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '%' || i+1 == len(pattern) {
+			glob.WriteByte(pattern[i])
+			continue
+		}
+		i++
+		switch pattern[i] {
+		case '%':
+			glob.WriteByte('%')
+		case 'p', 'P':
+			glob.WriteString(strconv.Itoa(pid))
+			hasPID = true
+		default:
+			glob.WriteByte('*')
+		}
+	}
+	if usesPID && !hasPID {
+		glob.WriteString("." + strconv.Itoa(pid))
+	}
+	return glob.String()
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// enableCoreDumps raises the soft core size limit to the hard one, which
+// workers inherit
+func enableCoreDumps() error {
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_CORE, &limit); err != nil {
+		return err
+	}
+	if limit.Max == 0 {
+		return fmt.Errorf("the hard core size limit is 0")
+	}
+	limit.Cur = limit.Max
+	return syscall.Setrlimit(syscall.RLIMIT_CORE, &limit)
+}
+
+// coreDumpPath finds the core dump of process pid where the kernel's
+// core_pattern puts it. Relative patterns are relative to the worker's
+// directory, which is the fuzzer's.
+func coreDumpPath(pid int, since time.Time) (string, string) {
+	data, err := os.ReadFile("/proc/sys/kernel/core_pattern")
+	if err != nil {
+		return "", err.Error()
+	}
+	pattern := strings.TrimSpace(string(data))
+	if strings.HasPrefix(pattern, "|") {
+		handler := strings.Fields(pattern[1:])
+		return "", fmt.Sprintf("core dumps are piped to %s; collect them there", handler[0])
+	}
+	usesPID, _ := os.ReadFile("/proc/sys/kernel/core_uses_pid")
+	matches, _ := filepath.Glob(expandCorePattern(pattern, pid, strings.TrimSpace(string(usesPID)) == "1"))
+
+	newest, newestTime := "", since
+	for _, match := range matches {
+		if info, err := os.Stat(match); err == nil && info.Mode().IsRegular() && !info.ModTime().Before(newestTime) {
+			newest, newestTime = match, info.ModTime()
+		}
+	}
+	if newest == "" {
+		return "", "none found matching core_pattern " + pattern
+	}
+	return newest, ""
+}
@@ -0,0 +1,131 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeCoreDump makes workers leave a core dump of size bytes in dir
+func fakeCoreDump(t *testing.T, dir string, size int) string {
+	core := filepath.Join(dir, "core.77")
+	require.NoError(t, os.WriteFile(core, make([]byte, size), 0o600))
+	original := findCoreDump
+	findCoreDump = func(pid int, since time.Time) (string, string) {
+		if _, err := os.Stat(core); err != nil || pid != 77 {
+			return "", "none found"
+		}
+		return core, ""
+	}
+	t.Cleanup(func() { findCoreDump = original })
+	return core
+}
+
+// -----------------------------------------------------------------------------
+// TEST: Crash Bundles
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// A runtime that segfaults on a module is the most valuable thing a
+// campaign finds, and the least reproducible from a report line alone.
+// Its maintainers need the module and the core dump side by side, but
+// cores run to gigabytes, so a long campaign must not fill the disk.
+// -----------------------------------------------------------------------------
+
+func TestIsolate_KeepsCrashBundle(t *testing.T) {
+	dir := t.TempDir()
+	modulePath := filepath.Join(dir, "segv.wasm")
+	require.NoError(t, os.WriteFile(modulePath, []byte("\x00asm"), 0o644))
+	core := fakeCoreDump(t, t.TempDir(), 1024)
+	runtime := &MockWasmRuntime{}
+	fakeWorkers(t, runtime)
+	startFake := startWorker
+	startWorker = func(args, env []string) (*workerProcess, error) {
+		assert.Contains(t, env, "GOTRACEBACK=crash", "Go faults must dump core")
+		process, err := startFake(args, env)
+		process.pid = 77
+		kill := process.kill
+		process.requests = writerFunc(func(p []byte) (int, error) {
+			kill()
+			return len(p), nil
+		})
+		process.wait = func() string { return "signal: segmentation fault (core dumped)" }
+		return process, err
+	}
+
+	crashes := filepath.Join(t.TempDir(), "crashes")
+	opts := RunOptions{WorkerArgs: []string{dir}, Crashes: CrashConfig{Dir: crashes}}
+	report, err := runFuzzerWithMatrix(dir, []environmentRuntime{{Runtime: runtime}}, opts)
+	require.NoError(t, err)
+
+	require.Len(t, report.Results, 1)
+	result := report.Results[0]
+	assert.Equal(t, "worker died in the load stage: signal: segmentation fault (core dumped)", result.ErrorMessage)
+	assert.Equal(t, filepath.Join(crashes, "segv-77"), result.CrashBundle)
+
+	module, err := os.ReadFile(filepath.Join(result.CrashBundle, "segv.wasm"))
+	require.NoError(t, err)
+	assert.Equal(t, "\x00asm", string(module))
+	info, err := os.Stat(filepath.Join(result.CrashBundle, "core"))
+	require.NoError(t, err)
+	assert.EqualValues(t, 1024, info.Size())
+	assert.NoFileExists(t, core, "the core is moved into the bundle")
+	notes, err := os.ReadFile(filepath.Join(result.CrashBundle, "crash.txt"))
+	require.NoError(t, err)
+	assert.Contains(t, string(notes), "exit: signal: segmentation fault (core dumped)\n")
+	assert.Contains(t, string(notes), "core dump: core (1024 bytes)\n")
+}
+
+func TestCrashStore_DropsCoreOverBudget(t *testing.T) {
+	modulePath := filepath.Join(t.TempDir(), "big.wasm")
+	require.NoError(t, os.WriteFile(modulePath, []byte("\x00asm"), 0o644))
+	core := fakeCoreDump(t, t.TempDir(), 4096)
+	crashes := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(crashes, "earlier"), make([]byte, 512), 0o644))
+
+	store := &crashStore{config: CrashConfig{Dir: crashes, Budget: 1024}}
+	bundle := store.keep(modulePath, 77, time.Time{}, "signal: aborted (core dumped)")
+
+	require.NotEmpty(t, bundle, "the module still fits")
+	assert.FileExists(t, filepath.Join(bundle, "big.wasm"))
+	assert.NoFileExists(t, filepath.Join(bundle, "core"))
+	assert.NoFileExists(t, core, "a dropped core does not stay on disk")
+	notes, err := os.ReadFile(filepath.Join(bundle, "crash.txt"))
+	require.NoError(t, err)
+	assert.Contains(t, string(notes), "core dump: core dump of 4096 bytes dropped: over the crash budget\n")
+}
+
+func TestCrashStore_KeepsNothingOverBudget(t *testing.T) {
+	modulePath := filepath.Join(t.TempDir(), "big.wasm")
+	require.NoError(t, os.WriteFile(modulePath, make([]byte, 2048), 0o644))
+	crashes := t.TempDir()
+
+	store := &crashStore{config: CrashConfig{Dir: crashes, Budget: 1024}}
+	assert.Empty(t, store.keep(modulePath, 78, time.Time{}, "signal: segmentation fault"))
+	entries, err := os.ReadDir(crashes)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	assert.Empty(t, (*crashStore)(nil).keep(modulePath, 78, time.Time{}, "signal: segmentation fault"))
+}
+
+func TestCrashSignal(t *testing.T) {
+	assert.True(t, crashSignal("signal: segmentation fault (core dumped)"))
+	assert.True(t, crashSignal("signal: aborted"))
+	assert.False(t, crashSignal("signal: killed"), "hangs and the OOM killer leave no core")
+	assert.False(t, crashSignal("exit status 2"))
+}
+
+func TestExpandCorePattern(t *testing.T) {
+	assert.Equal(t, "core", expandCorePattern("core", 42, false))
+	assert.Equal(t, "core.42", expandCorePattern("core", 42, true))
+	assert.Equal(t, "/var/crash/core.*.42.*", expandCorePattern("/var/crash/core.%e.%p.%t", 42, true))
+	assert.Equal(t, "core-100%-42", expandCorePattern("core-100%%-%P", 42, false))
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/mrhapile/WASM-Injection-Framework/internal/wasmbin"
+)
+
+// SubStageDataSegments refines the load stage for modules the configured
+// data segments could not be planted in
+const SubStageDataSegments = "data_segments"
+
+// DataSegmentConfig plants bytes in a module's memory at instantiation,
+// either by replacing the contents of one of its data segments or by
+// adding an active segment of its own
+type DataSegmentConfig struct {
+	// Segment is the index of the data segment whose contents are
+	// replaced, keeping where it is written. Without it a segment is added.
+	Segment *uint32 `yaml:"segment"`
+	// Memory and Offset place an added segment. Added segments come after
+	// the module's own, so they overwrite what those write.
+	Memory uint32 `yaml:"memory"`
+	Offset uint64 `yaml:"offset"`
+	// Data is a string, bytes or file value
+	Data WasmValue `yaml:"data"`
+}
+
+// checkDataSegments rejects data segments whose contents cannot be read
+func checkDataSegments(segments []DataSegmentConfig) error {
+	for i, segment := range segments {
+		if segment.Data.Type != "" && !isBufferType(segment.Data.Type) {
+			return fmt.Errorf("data segment %d: data must be a string, bytes or file value, not %s", i, segment.Data.Type)
+		}
+		if _, err := decodeBuffer(segment.Data); err != nil {
+			return fmt.Errorf("data segment %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// injectDataSegments replaces or adds the configured data segments
+func injectDataSegments(data []byte, segments []DataSegmentConfig) ([]byte, error) {
+	module, err := parseWasmBinary(data)
+	if err != nil {
+		return nil, err
+	}
+	memories, err := module.memory64()
+	if err != nil {
+		return nil, err
+	}
+
+	for i, segment := range segments {
+		init, err := decodeBuffer(segment.Data)
+		if err != nil {
+			return nil, fmt.Errorf("data segment %d: %w", i, err)
+		}
+		if segment.Segment != nil {
+			err = module.replaceDataSegment(*segment.Segment, init.data)
+		} else {
+			err = module.addDataSegment(memories, segment.Memory, segment.Offset, init.data)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("data segment %d: %w", i, err)
+		}
+	}
+	return module.encode(), nil
+}
+
+// memory64 reports, for each memory of the module in index order, whether
+// it is addressed with 64-bit offsets
+func (m *wasmBinary) memory64() ([]bool, error) {
+	var memories []bool
+	if section := m.section(sectionImport); section != nil {
+		r := &wasmbin.Reader{Data: section.Payload}
+		n, err := r.U32()
+		if err != nil {
+			return nil, err
+		}
+		for i := uint32(0); i < n; i++ {
+			if _, err := r.Name(); err != nil {
+				return nil, err
+			}
+			if _, err := r.Name(); err != nil {
+				return nil, err
+			}
+			kind, err := r.Byte()
+			if err != nil {
+				return nil, err
+			}
+			if kind == externMemory && !r.Done() {
+				memories = append(memories, r.Data[r.Pos]&0x04 != 0)
+			}
+			if err := r.SkipImportDesc(kind); err != nil {
+				return nil, fmt.Errorf("import %d: %w", i, err)
+			}
+		}
+	}
+
+	if section := m.section(sectionMemory); section != nil {
+		r := &wasmbin.Reader{Data: section.Payload}
+		n, err := r.U32()
+		if err != nil {
+			return nil, err
+		}
+		for i := uint32(0); i < n && !r.Done(); i++ {
+			memories = append(memories, r.Data[r.Pos]&0x04 != 0)
+			if err := r.SkipLimits(); err != nil {
+				return nil, fmt.Errorf("memory %d: %w", i, err)
+			}
+		}
+	}
+	return memories, nil
+}
+
+// addDataSegment appends an active segment writing init at offset of a
+// memory, counting it in the data count section when there is one
+func (m *wasmBinary) addDataSegment(memories []bool, memory uint32, offset uint64, init []byte) error {
+	if int(memory) >= len(memories) {
+		return fmt.Errorf("module has no memory %d", memory)
+	}
+
+	var entry []byte
+	if memory == 0 {
+		entry = []byte{0x00}
+	} else {
+		entry = wasmbin.AppendU32([]byte{0x02}, memory)
+	}
+	if memories[memory] {
+		entry = wasmbin.AppendS64(append(entry, opI64Const), int64(offset))
+	} else {
+		if offset > math.MaxUint32 {
+			return fmt.Errorf("offset %d is beyond a 32-bit memory", offset)
+		}
+		entry = wasmbin.AppendS32(append(entry, opI32Const), int32(uint32(offset)))
+	}
+	entry = append(wasmbin.AppendU32(append(entry, opEnd), uint32(len(init))), init...)
+
+	if _, err := m.ensureSection(sectionData).appendVectorEntry(entry); err != nil {
+		return err
+	}
+	if count := m.section(sectionDataCount); count != nil {
+		n, err := (&wasmbin.Reader{Data: count.Payload}).U32()
+		if err != nil {
+			return err
+		}
+		count.Payload = wasmbin.AppendU32(nil, n+1)
+	}
+	return nil
+}
+
+// replaceDataSegment replaces the contents of a data segment, keeping its
+// mode, memory and offset
+func (m *wasmBinary) replaceDataSegment(index uint32, init []byte) error {
+	section := m.section(sectionData)
+	if section == nil {
+		return errors.New("module has no data segments")
+	}
+
+	r := &wasmbin.Reader{Data: section.Payload}
+	n, err := r.U32()
+	if err != nil {
+		return err
+	}
+	if index >= n {
+		return fmt.Errorf("module has %d data segments, not %d", n, index+1)
+	}
+	for i := uint32(0); i <= index; i++ {
+		flags, err := r.U32()
+		if err != nil {
+			return err
+		}
+		// Active segments name a memory (flag 2) and an offset expression
+		if flags == 2 {
+			if _, err := r.U32(); err != nil {
+				return err
+			}
+		}
+		if flags == 0 || flags == 2 {
+			if err := r.SkipConstExpr(); err != nil {
+				return fmt.Errorf("module data segment %d: %w", i, err)
+			}
+		} else if flags != 1 {
+			return fmt.Errorf("module data segment %d: unknown flags %d", i, flags)
+		}
+
+		start := r.Pos
+		size, err := r.U32()
+		if err != nil {
+			return err
+		}
+		if _, err := r.Bytes(int(size)); err != nil {
+			return fmt.Errorf("module data segment %d: %w", i, err)
+		}
+		if i == index {
+			payload := append([]byte(nil), section.Payload[:start]...)
+			payload = append(wasmbin.AppendU32(payload, uint32(len(init))), init...)
+			section.Payload = append(payload, section.Payload[r.Pos:]...)
+		}
+	}
+	return nil
+}
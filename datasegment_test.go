@@ -0,0 +1,122 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mrhapile/WASM-Injection-Framework/internal/wasmbin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// -----------------------------------------------------------------------------
+// TEST: Data Segment Injection
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Keys, format strings and lookup tables a module embeds are trusted by
+// the code reading them. Planting crafted bytes where that data lands at
+// instantiation shows how a module copes when its own data is hostile,
+// without recompiling it.
+// -----------------------------------------------------------------------------
+
+func uint32Ptr(v uint32) *uint32 { return &v }
+
+func TestInjectDataSegments_ReplacesAndAdds(t *testing.T) {
+	data := withDataSegment(t, buildTestModule(loopIfBody, true), []byte("original"))
+
+	injected, err := injectDataSegments(data, []DataSegmentConfig{
+		{Segment: uint32Ptr(0), Data: WasmValue{Value: "%n%n%n"}},
+		{Offset: 4096, Data: WasmValue{Type: "bytes", Value: "deadbeef"}},
+	})
+	require.NoError(t, err)
+
+	module, err := parseWasmBinary(injected)
+	require.NoError(t, err)
+	segments, err := module.dataSegments()
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("%n%n%n"), {0xde, 0xad, 0xbe, 0xef}}, segments)
+	added := module.section(sectionData).Payload
+	assert.Equal(t, []byte{0x00, opI32Const, 0x80, 0x20, opEnd, 0x04}, added[len(added)-10:len(added)-4],
+		"the added segment is active in memory 0 at the offset")
+}
+
+func TestInjectDataSegments_CountsAddedSegments(t *testing.T) {
+	module, err := parseWasmBinary(buildTestModule(loopIfBody, true))
+	require.NoError(t, err)
+	module.ensureSection(sectionDataCount)
+
+	injected, err := injectDataSegments(module.encode(), []DataSegmentConfig{{Data: WasmValue{Value: "key"}}})
+	require.NoError(t, err)
+	module, err = parseWasmBinary(injected)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x01}, module.section(sectionDataCount).Payload)
+}
+
+func TestInjectDataSegments_UsesMemoryIndexType(t *testing.T) {
+	module, err := parseWasmBinary(buildTestModule(loopIfBody, false))
+	require.NoError(t, err)
+	// A memory64 memory with one page
+	module.ensureSection(sectionMemory).Payload = []byte{0x01, 0x04, 0x01}
+
+	injected, err := injectDataSegments(module.encode(), []DataSegmentConfig{{Offset: 1 << 33, Data: WasmValue{Value: "x"}}})
+	require.NoError(t, err)
+	module, err = parseWasmBinary(injected)
+	require.NoError(t, err)
+	assert.Equal(t, append(wasmbin.AppendS64([]byte{0x01, 0x00, opI64Const}, 1<<33), opEnd, 0x01, 'x'), module.section(sectionData).Payload)
+}
+
+func TestInjectDataSegments_RejectsMissingTargets(t *testing.T) {
+	data := buildTestModule(loopIfBody, false)
+
+	_, err := injectDataSegments(data, []DataSegmentConfig{{Data: WasmValue{Value: "x"}}})
+	assert.EqualError(t, err, "data segment 0: module has no memory 0")
+	_, err = injectDataSegments(data, []DataSegmentConfig{{Segment: uint32Ptr(0), Data: WasmValue{Value: "x"}}})
+	assert.EqualError(t, err, "data segment 0: module has no data segments")
+
+	data = withDataSegment(t, buildTestModule(loopIfBody, true), []byte("a"))
+	_, err = injectDataSegments(data, []DataSegmentConfig{{Segment: uint32Ptr(1), Data: WasmValue{Value: "x"}}})
+	assert.EqualError(t, err, "data segment 0: module has 1 data segments, not 2")
+	_, err = injectDataSegments(data, []DataSegmentConfig{{Offset: 1 << 32, Data: WasmValue{Value: "x"}}})
+	assert.EqualError(t, err, "data segment 0: offset 4294967296 is beyond a 32-bit memory")
+}
+
+func TestCheckDataSegments_RejectsNonBufferData(t *testing.T) {
+	assert.NoError(t, checkDataSegments([]DataSegmentConfig{{Data: WasmValue{Value: "key"}}}))
+	assert.EqualError(t, checkDataSegments([]DataSegmentConfig{{Data: WasmValue{Type: "i32", Value: "1"}}}),
+		"data segment 0: data must be a string, bytes or file value, not i32")
+	assert.EqualError(t, checkDataSegments([]DataSegmentConfig{{Data: WasmValue{Type: "bytes", Value: "zz"}}}),
+		`data segment 0: invalid bytes value "zz": expected hex digits`)
+}
+
+func TestProcessWasmFile_RunsModuleWithPlantedData(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "keys.wasm")
+	require.NoError(t, os.WriteFile(filePath, withDataSegment(t, buildTestModule(loopIfBody, true), []byte("secret")), 0o644))
+
+	var loaded [][]byte
+	runtime := &MockWasmRuntime{LoadModuleFunc: func(path string) (WasmModule, error) {
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		module, err := parseWasmBinary(data)
+		require.NoError(t, err)
+		loaded, err = module.dataSegments()
+		require.NoError(t, err)
+		return &MockWasmModule{}, nil
+	}}
+	opts := RunOptions{DataSegments: []DataSegmentConfig{{Segment: uint32Ptr(0), Data: WasmValue{Value: "planted"}}}}
+
+	result := processWasmFileWithOptions(filePath, runtime, opts)
+	assert.True(t, result.Success, result.ErrorMessage)
+	assert.Equal(t, filePath, result.FilePath, "results name the original file")
+	assert.Equal(t, [][]byte{[]byte("planted")}, loaded)
+
+	opts.DataSegments[0].Segment = uint32Ptr(3)
+	result = processWasmFileWithOptions(filePath, runtime, opts)
+	assert.Equal(t, StageLoad, result.FailureStage)
+	assert.Equal(t, SubStageDataSegments, result.FailureSubStage)
+	assert.Equal(t, "data segment injection failed: data segment 0: module has 1 data segments, not 4", result.ErrorMessage)
+}
@@ -0,0 +1,25 @@
+package main
+
+import "fmt"
+
+// NondeterministicModule lists a file whose repeated runs behaved
+// differently, which often points at uninitialized memory or at a
+// dependence on the host's clock
+type NondeterministicModule struct {
+	FilePath    string   `json:"file_path"`
+	Environment string   `json:"environment,omitempty"`
+	Differences []string `json:"differences"`
+}
+
+// checkDeterminism runs a file until it ran runs times, recording how the
+// return values, traps and output of each rerun differ from the first run
+func checkDeterminism(result *ExecutionResult, runs int, floats FloatComparison, rerun func() ExecutionResult) {
+	if result.Skipped {
+		return
+	}
+	for i := 1; i < runs; i++ {
+		for _, difference := range compareOutputs(*result, rerun(), floats) {
+			result.Nondeterminism = append(result.Nondeterminism, fmt.Sprintf("run %d: %s", i+1, difference))
+		}
+	}
+}
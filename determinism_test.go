@@ -0,0 +1,72 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// -----------------------------------------------------------------------------
+// TEST: Determinism Checks
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// A module returning other values from one run to the next usually reads
+// uninitialized memory or the host's clock. Such bugs pass any single run,
+// so only comparing repeated runs of every file brings them out.
+// -----------------------------------------------------------------------------
+
+func TestDeterminism_ReportsFilesWhoseRunsDiffer(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "clock.wasm"), []byte("clock"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "pure.wasm"), []byte("pure"), 0o644))
+	ticks, runs := int32(0), 0
+	runtime := &MockWasmRuntime{LoadModuleFunc: func(filePath string) (WasmModule, error) {
+		runs++
+		clock := strings.Contains(filePath, "clock")
+		return &MockWasmModule{ExecuteFunc: func(string, ...interface{}) ([]interface{}, error) {
+			if clock {
+				ticks++
+				return []interface{}{ticks}, nil
+			}
+			return []interface{}{int32(7)}, nil
+		}}, nil
+	}}
+
+	report, err := runFuzzerWithMatrix(dir, []environmentRuntime{{Runtime: runtime}}, RunOptions{Determinism: 3})
+	require.NoError(t, err)
+	assert.Equal(t, 6, runs, "every file runs three times")
+	assert.Equal(t, []string{
+		"run 2: returned [i32 1], but [i32 2]",
+		"run 3: returned [i32 1], but [i32 3]",
+	}, report.Results[0].Nondeterminism)
+	assert.True(t, report.Results[0].Success, "nondeterminism is reported apart from failures")
+	assert.Empty(t, report.Results[1].Nondeterminism)
+	assert.Equal(t, []NondeterministicModule{{
+		FilePath:    report.Results[0].FilePath,
+		Differences: report.Results[0].Nondeterminism,
+	}}, report.Nondeterministic)
+}
+
+func TestDeterminism_SingleRunsAndSkipsAreNotCompared(t *testing.T) {
+	result := ExecutionResult{Success: true}
+	reruns := 0
+	rerun := func() ExecutionResult {
+		reruns++
+		return ExecutionResult{ErrorMessage: "trap"}
+	}
+	checkDeterminism(&result, 1, FloatComparison{}, rerun)
+	checkDeterminism(&ExecutionResult{Skipped: true}, 5, FloatComparison{}, rerun)
+	assert.Zero(t, reruns)
+	assert.Empty(t, result.Nondeterminism)
+
+	_, err := runFuzzerWithMatrix(t.TempDir(), nil, RunOptions{Determinism: -1})
+	assert.EqualError(t, err, "determinism must not be negative")
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/mrhapile/WASM-Injection-Framework/internal/wasmbin"
+)
+
+// Dictionary limits. AFL++ rejects tokens longer than 128 bytes.
+const (
+	maxDictionaryEntries = 256
+	minDictionaryString  = 4
+	maxDictionaryString  = 128
+)
+
+// moduleDictionary holds the magic values of a module: constants its code
+// compares against and strings from its data segments
+type moduleDictionary struct {
+	// I32 and I64 are constant operands of integer comparisons
+	I32 []int32
+	I64 []int64
+	// Strings are printable runs found in data segments
+	Strings []string
+}
+
+// extractDictionary collects a module's magic values. Constants count when
+// they are an operand of an integer comparison, either directly before it or
+// ahead of a local or global read of the other operand.
+func extractDictionary(data []byte) (*moduleDictionary, error) {
+	module, err := parseWasmBinary(data)
+	if err != nil {
+		return nil, err
+	}
+
+	dict := &moduleDictionary{}
+	seen32 := make(map[int32]bool)
+	seen64 := make(map[int64]bool)
+	if code := module.section(sectionCode); code != nil {
+		bodies, err := parseCodeSection(code.Payload)
+		if err != nil {
+			return nil, err
+		}
+		for i, body := range bodies {
+			instructions, err := wasmbin.DecodeInstructions(body.Code)
+			if err != nil {
+				return nil, fmt.Errorf("function body %d: %w", i, err)
+			}
+			for j, instr := range instructions {
+				if !isGuardComparison(instr.Opcode) || instr.Opcode == opI32Eqz || instr.Opcode == opI64Eqz {
+					continue
+				}
+				operand, ok := comparisonConstant(instructions[:j])
+				if !ok {
+					continue
+				}
+				if instr.Opcode < opI64Eqz {
+					if v := int32(operand.Const); !seen32[v] {
+						seen32[v] = true
+						dict.I32 = append(dict.I32, v)
+					}
+				} else if !seen64[operand.Const] {
+					seen64[operand.Const] = true
+					dict.I64 = append(dict.I64, operand.Const)
+				}
+			}
+		}
+	}
+
+	segments, err := module.dataSegments()
+	if err != nil {
+		return nil, err
+	}
+	seenString := make(map[string]bool)
+	for _, segment := range segments {
+		for _, s := range printableRuns(segment) {
+			if !seenString[s] {
+				seenString[s] = true
+				dict.Strings = append(dict.Strings, s)
+			}
+		}
+	}
+	return dict, nil
+}
+
+// comparisonConstant finds the constant operand of a comparison following
+// the given instructions
+func comparisonConstant(preceding []wasmbin.Instruction) (wasmbin.Instruction, bool) {
+	isConst := func(instr wasmbin.Instruction) bool {
+		return instr.Opcode == opI32Const || instr.Opcode == opI64Const
+	}
+	isRead := func(instr wasmbin.Instruction) bool {
+		return instr.Opcode == opLocalGet || instr.Opcode == opGlobalGet
+	}
+
+	n := len(preceding)
+	switch {
+	case n >= 1 && isConst(preceding[n-1]):
+		return preceding[n-1], true
+	case n >= 2 && isRead(preceding[n-1]) && isConst(preceding[n-2]):
+		return preceding[n-2], true
+	}
+	return wasmbin.Instruction{}, false
+}
+
+// printableRuns returns the runs of printable ASCII in data, like strings(1)
+func printableRuns(data []byte) []string {
+	var runs []string
+	start := -1
+	for i := 0; i <= len(data); i++ {
+		if i < len(data) && data[i] >= 0x20 && data[i] < 0x7f {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 && i-start >= minDictionaryString {
+			end := i
+			if end-start > maxDictionaryString {
+				end = start + maxDictionaryString
+			}
+			runs = append(runs, string(data[start:end]))
+		}
+		start = -1
+	}
+	return runs
+}
+
+// argumentValues returns the i32 argument candidates: every i32 constant,
+// and i64 constants that fit in 32 bits
+func (d *moduleDictionary) argumentValues() []int32 {
+	values := append([]int32(nil), d.I32...)
+	seen := make(map[int32]bool)
+	for _, v := range values {
+		seen[v] = true
+	}
+	for _, v := range d.I64 {
+		if v < -1<<31 || v > 1<<32-1 {
+			continue
+		}
+		if v32 := int32(v); !seen[v32] {
+			seen[v32] = true
+			values = append(values, v32)
+		}
+	}
+	if len(values) > maxDictionaryEntries {
+		values = values[:maxDictionaryEntries]
+	}
+	return values
+}
+
+// tokens returns the dictionary as byte strings for mutators of module
+// bytes: data strings verbatim, and constants in their encoded
+// instruction form, since that is how they appear in a module
+func (d *moduleDictionary) tokens() []string {
+	var tokens []string
+	for _, v := range d.I32 {
+		tokens = append(tokens, string(wasmbin.AppendS32([]byte{opI32Const}, v)))
+	}
+	for _, v := range d.I64 {
+		tokens = append(tokens, string(wasmbin.AppendS64([]byte{opI64Const}, v)))
+	}
+	return append(tokens, d.Strings...)
+}
+
+// writeAFLDictionary writes tokens in the AFL++/libFuzzer dictionary format
+func writeAFLDictionary(w io.Writer, tokens []string) error {
+	for i, token := range tokens {
+		var quoted strings.Builder
+		for j := 0; j < len(token); j++ {
+			switch c := token[j]; {
+			case c == '"' || c == '\\':
+				quoted.WriteByte('\\')
+				quoted.WriteByte(c)
+			case c >= 0x20 && c < 0x7f:
+				quoted.WriteByte(c)
+			default:
+				fmt.Fprintf(&quoted, "\\x%02x", c)
+			}
+		}
+		if _, err := fmt.Fprintf(w, "token_%d=\"%s\"\n", i, quoted.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runDictCommand extracts a fuzzing dictionary from every module in a
+// corpus, for byte-level fuzzers such as AFL++ (-x) and libFuzzer (-dict)
+func runDictCommand(args []string) int {
+	flags := flag.NewFlagSet("dict", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	outputPath := flags.String("output", "", "file to write the dictionary to (default stdout)")
+
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		emitError(map[string]string{
+			"error": "usage: wasm-fuzzer dict [--output file.dict] <directory>",
+		})
+		return 1
+	}
+
+	files, err := collectWasmFiles(flags.Arg(0))
+	if err != nil {
+		emitError(map[string]string{
+			"error":   "directory access failed",
+			"details": err.Error(),
+		})
+		return 1
+	}
+
+	// Modules the decoder cannot read contribute no tokens
+	seen := make(map[string]bool)
+	var tokens []string
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		dict, err := extractDictionary(data)
+		if err != nil {
+			continue
+		}
+		for _, token := range dict.tokens() {
+			if !seen[token] {
+				seen[token] = true
+				tokens = append(tokens, token)
+			}
+		}
+	}
+	sort.Strings(tokens)
+
+	if *outputPath == "" {
+		err = writeAFLDictionary(os.Stdout, tokens)
+	} else {
+		var file *os.File
+		if file, err = os.Create(*outputPath); err == nil {
+			err = writeAFLDictionary(file, tokens)
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+		}
+	}
+	if err != nil {
+		emitError(map[string]string{
+			"error":   "failed to write dictionary",
+			"details": err.Error(),
+		})
+		return 1
+	}
+	return 0
+}
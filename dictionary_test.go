@@ -0,0 +1,111 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mrhapile/WASM-Injection-Framework/internal/wasmbin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// magicCompareBody compares its argument against constants in both operand
+// orders, and returns a constant that is not compared against:
+//
+//	i32.const 7  local.get 0  i32.lt_s  drop
+//	local.get 0  i32.const 0x1234  i32.eq  drop
+//	i32.const 99
+var magicCompareBody = []byte{
+	0x41, 0x07, 0x20, 0x00, 0x48, 0x1a,
+	0x20, 0x00, 0x41, 0xb4, 0x24, 0x46, 0x1a,
+	0x41, 0xe3, 0x00,
+	0x0b,
+}
+
+// withDataSegment appends an active data segment to a test module
+func withDataSegment(t *testing.T, data []byte, init []byte) []byte {
+	module, err := parseWasmBinary(data)
+	require.NoError(t, err)
+	payload := append([]byte{0x01, 0x00, opI32Const, 0x00, opEnd}, wasmbin.AppendU32(nil, uint32(len(init)))...)
+	module.Sections = append(module.Sections, wasmSection{ID: sectionData, Payload: append(payload, init...)})
+	return module.encode()
+}
+
+// -----------------------------------------------------------------------------
+// TEST: Dictionary Extraction
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Magic values a module checks for are nearly impossible to hit by random
+// mutation. Lifting them out of comparisons and data segments lets both the
+// argument mutator and byte-level fuzzers try them directly.
+// -----------------------------------------------------------------------------
+
+func TestDictionary_ExtractsComparisonOperands(t *testing.T) {
+	dict, err := extractDictionary(buildTestModule(magicCompareBody, false))
+	require.NoError(t, err)
+
+	assert.Equal(t, []int32{7, 0x1234}, dict.I32, "constants outside comparisons are ignored")
+	assert.Empty(t, dict.I64)
+}
+
+func TestDictionary_ExtractsDataStrings(t *testing.T) {
+	data := withDataSegment(t, buildTestModule(magicCompareBody, true), []byte("\x00\x01MAGIC\x00ab\x00\xffHDR1"))
+
+	dict, err := extractDictionary(data)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"MAGIC", "HDR1"}, dict.Strings, "runs shorter than four bytes are dropped")
+}
+
+func TestDictionary_OversizedSegmentCountFailsTheModule(t *testing.T) {
+	// A data section claiming 2^32-1 segments in 5 bytes
+	module := &wasmBinary{Sections: []wasmSection{{ID: sectionData, Payload: []byte{0xff, 0xff, 0xff, 0xff, 0x0f}}}}
+	_, err := module.dataSegments()
+	assert.ErrorIs(t, err, wasmbin.ErrTruncated)
+}
+
+func TestDictionary_ArgumentValuesFitI32(t *testing.T) {
+	dict := &moduleDictionary{I32: []int32{5}, I64: []int64{5, 0xffffffff, 1 << 40, -2}}
+
+	assert.Equal(t, []int32{5, -1, -2}, dict.argumentValues())
+}
+
+func TestDictionary_WritesAFLFormat(t *testing.T) {
+	dict := &moduleDictionary{I32: []int32{0x1234}, Strings: []string{`say "hi"\`}}
+
+	var out bytes.Buffer
+	require.NoError(t, writeAFLDictionary(&out, dict.tokens()))
+
+	assert.Equal(t, "token_0=\"A\\xb4$\"\ntoken_1=\"say \\\"hi\\\"\\\\\"\n", out.String())
+}
+
+func TestDictionary_ArgFuzzTriesMagicValues(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "magic.wasm")
+	require.NoError(t, os.WriteFile(path, buildTestModule(magicCompareBody, false), 0o644))
+
+	mockRuntime := &MockWasmRuntime{
+		LoadModuleFunc: func(filePath string) (WasmModule, error) {
+			return &MockWasmModule{ExecuteFunc: func(funcName string, args ...interface{}) ([]interface{}, error) {
+				if args[0].(int32) == 0x1234 {
+					return nil, errors.New("unreachable")
+				}
+				return []interface{}{int32(0)}, nil
+			}}, nil
+		},
+	}
+
+	opts := RunOptions{ArgFuzz: ArgFuzzConfig{Iterations: 200, Seed: 1}}
+	result := processWasmFileWithOptions(path, mockRuntime, opts)
+
+	require.NotNil(t, result.ArgFuzz)
+	assert.Equal(t, 2, result.ArgFuzz.DictionarySize)
+	require.Len(t, result.ArgFuzz.UniqueFailures, 1)
+	assert.Equal(t, "4660", result.ArgFuzz.UniqueFailures[0].Args[0].Value)
+}
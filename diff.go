@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+	"sort"
+)
+
+// ReportDiff compares the outcome of every file between two reports of a
+// corpus, such as before and after a runtime upgrade
+type ReportDiff struct {
+	// NewFailures passed before and fail now; Fixed failed before and
+	// pass now
+	NewFailures []OutcomeChange `json:"new_failures,omitempty"`
+	Fixed       []OutcomeChange `json:"fixed,omitempty"`
+	// Changed failed in both, in another stage or with another error
+	Changed []OutcomeChange `json:"changed,omitempty"`
+	// Added and Removed were run in only one of the reports
+	Added   []DiffedFile `json:"added,omitempty"`
+	Removed []DiffedFile `json:"removed,omitempty"`
+	// Unchanged counts the files with the same outcome in both
+	Unchanged int `json:"unchanged"`
+}
+
+// OutcomeChange is a file whose outcome differs between two reports
+type OutcomeChange struct {
+	FilePath    string  `json:"file_path"`
+	Environment string  `json:"environment,omitempty"`
+	Before      Outcome `json:"before"`
+	After       Outcome `json:"after"`
+}
+
+// DiffedFile is a file run in only one of two reports
+type DiffedFile struct {
+	FilePath    string `json:"file_path"`
+	Environment string `json:"environment,omitempty"`
+}
+
+// Outcome is how a file fared in one report
+type Outcome struct {
+	Success      bool         `json:"success"`
+	FailureStage FailureStage `json:"failure_stage"`
+	ErrorMessage string       `json:"error_message,omitempty"`
+}
+
+func (f DiffedFile) less(other DiffedFile) bool {
+	if f.FilePath != other.FilePath {
+		return f.FilePath < other.FilePath
+	}
+	return f.Environment < other.Environment
+}
+
+// ranResults indexes the results of the files a report ran, skipping the
+// others
+func ranResults(report FuzzingReport) map[DiffedFile]ExecutionResult {
+	results := make(map[DiffedFile]ExecutionResult, len(report.Results))
+	for _, result := range report.Results {
+		if !result.Skipped {
+			results[DiffedFile{result.FilePath, result.Environment}] = result
+		}
+	}
+	return results
+}
+
+// diffReports compares the outcome of every file run in both reports
+func diffReports(before, after FuzzingReport) ReportDiff {
+	var diff ReportDiff
+	beforeResults, afterResults := ranResults(before), ranResults(after)
+	for key, old := range beforeResults {
+		result, ok := afterResults[key]
+		if !ok {
+			diff.Removed = append(diff.Removed, key)
+			continue
+		}
+		change := OutcomeChange{
+			FilePath:    key.FilePath,
+			Environment: key.Environment,
+			Before:      Outcome{old.Success, old.FailureStage, old.ErrorMessage},
+			After:       Outcome{result.Success, result.FailureStage, result.ErrorMessage},
+		}
+		switch {
+		case change.Before == change.After:
+			diff.Unchanged++
+		case old.Success:
+			diff.NewFailures = append(diff.NewFailures, change)
+		case result.Success:
+			diff.Fixed = append(diff.Fixed, change)
+		default:
+			diff.Changed = append(diff.Changed, change)
+		}
+	}
+	for key := range afterResults {
+		if _, ok := beforeResults[key]; !ok {
+			diff.Added = append(diff.Added, key)
+		}
+	}
+
+	for _, changes := range [][]OutcomeChange{diff.NewFailures, diff.Fixed, diff.Changed} {
+		sort.Slice(changes, func(i, j int) bool {
+			return DiffedFile{changes[i].FilePath, changes[i].Environment}.less(DiffedFile{changes[j].FilePath, changes[j].Environment})
+		})
+	}
+	for _, files := range [][]DiffedFile{diff.Added, diff.Removed} {
+		sort.Slice(files, func(i, j int) bool { return files[i].less(files[j]) })
+	}
+	return diff
+}
+
+// runDiffCommand compares two reports. It exits with status 1 when files
+// fail that passed before, so CI can gate on them.
+func runDiffCommand(args []string) int {
+	flags := flag.NewFlagSet("diff", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+
+	if err := flags.Parse(args); err != nil || flags.NArg() != 2 {
+		emitError(map[string]string{
+			"error": "usage: wasm-fuzzer diff <before.json> <after.json>",
+		})
+		return 1
+	}
+
+	reports := make([]FuzzingReport, 2)
+	for i, path := range flags.Args() {
+		report, err := loadReport(path)
+		if err != nil {
+			emitError(map[string]string{
+				"error":   "failed to load report",
+				"path":    path,
+				"details": err.Error(),
+			})
+			return 1
+		}
+		reports[i] = report
+	}
+
+	diff := diffReports(reports[0], reports[1])
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(diff); err != nil {
+		emitError(map[string]string{
+			"error":   "failed to encode JSON output",
+			"details": err.Error(),
+		})
+		return 1
+	}
+	if len(diff.NewFailures) > 0 {
+		return 1
+	}
+	return 0
+}
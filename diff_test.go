@@ -0,0 +1,108 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// -----------------------------------------------------------------------------
+// TEST: Report Diff
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// After a runtime upgrade, the totals of two reports can match while files
+// swapped places between passing and failing. Only a file-by-file
+// comparison shows the regressions, and CI needs to fail on them.
+// -----------------------------------------------------------------------------
+
+func diffFixture() (FuzzingReport, FuzzingReport) {
+	pass := func(path string) ExecutionResult {
+		return ExecutionResult{FilePath: path, Success: true, FailureStage: StageNone}
+	}
+	fail := func(path string, stage FailureStage, message string) ExecutionResult {
+		return ExecutionResult{FilePath: path, FailureStage: stage, ErrorMessage: message}
+	}
+	before := FuzzingReport{SchemaVersion: SchemaVersion, Results: []ExecutionResult{
+		pass("a.wasm"),
+		pass("b.wasm"),
+		fail("c.wasm", StageExecute, "unreachable"),
+		fail("d.wasm", StageLoad, "bad magic"),
+		pass("gone.wasm"),
+		{FilePath: "skipped.wasm", Skipped: true, SkipReason: SkipFiltered},
+	}}
+	after := FuzzingReport{SchemaVersion: SchemaVersion, Results: []ExecutionResult{
+		pass("a.wasm"),
+		fail("b.wasm", StageInstantiate, "unknown import"),
+		pass("c.wasm"),
+		fail("d.wasm", StageValidate, "type mismatch"),
+		pass("new.wasm"),
+		pass("skipped.wasm"),
+	}}
+	return before, after
+}
+
+func TestDiff_ComparesEveryFile(t *testing.T) {
+	diff := diffReports(diffFixture())
+	require.Len(t, diff.NewFailures, 1)
+	assert.Equal(t, OutcomeChange{
+		FilePath: "b.wasm",
+		Before:   Outcome{Success: true, FailureStage: StageNone},
+		After:    Outcome{FailureStage: StageInstantiate, ErrorMessage: "unknown import"},
+	}, diff.NewFailures[0])
+	require.Len(t, diff.Fixed, 1)
+	assert.Equal(t, "c.wasm", diff.Fixed[0].FilePath)
+	require.Len(t, diff.Changed, 1)
+	assert.Equal(t, StageValidate, diff.Changed[0].After.FailureStage)
+	assert.Equal(t, []DiffedFile{{FilePath: "new.wasm"}, {FilePath: "skipped.wasm"}}, diff.Added, "a file skipped before was not run")
+	assert.Equal(t, []DiffedFile{{FilePath: "gone.wasm"}}, diff.Removed)
+	assert.Equal(t, 1, diff.Unchanged)
+}
+
+func TestDiff_KeepsEnvironmentsApart(t *testing.T) {
+	before := FuzzingReport{Results: []ExecutionResult{
+		{FilePath: "a.wasm", Environment: "mvp", Success: true},
+		{FilePath: "a.wasm", Environment: "simd", Success: true},
+	}}
+	after := FuzzingReport{Results: []ExecutionResult{
+		{FilePath: "a.wasm", Environment: "mvp", Success: true},
+		{FilePath: "a.wasm", Environment: "simd", FailureStage: StageExecute},
+	}}
+	diff := diffReports(before, after)
+	require.Len(t, diff.NewFailures, 1)
+	assert.Equal(t, "simd", diff.NewFailures[0].Environment)
+	assert.Equal(t, 1, diff.Unchanged)
+}
+
+func TestDiff_FailsOnNewFailures(t *testing.T) {
+	dir := t.TempDir()
+	before, after := diffFixture()
+	write := func(name string, report FuzzingReport) string {
+		data, err := json.Marshal(report)
+		require.NoError(t, err)
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, data, 0o644))
+		return path
+	}
+	beforePath, afterPath := write("before.json", before), write("after.json", after)
+
+	var code int
+	out := captureStdout(t, func() { code = runDiffCommand([]string{beforePath, afterPath}) })
+	assert.Equal(t, 1, code)
+	var diff ReportDiff
+	require.NoError(t, json.Unmarshal(out, &diff))
+	assert.Len(t, diff.NewFailures, 1)
+
+	captureStdout(t, func() { code = runDiffCommand([]string{afterPath, afterPath}) })
+	assert.Equal(t, 0, code, "a report has no regressions against itself")
+
+	assert.Equal(t, 1, runDiffCommand([]string{beforePath}))
+	assert.Equal(t, 1, runDiffCommand([]string{beforePath, filepath.Join(dir, "missing.json")}))
+}
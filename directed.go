@@ -0,0 +1,379 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/mrhapile/WASM-Injection-Framework/internal/wasmbin"
+)
+
+// Directed feedback layout in the second page of the coverage memory:
+// one reached flag per target, then one distance slot per guard comparison
+const (
+	maxCoverageTargets = 256
+	maxGuardSites      = wasmPageSize - maxCoverageTargets
+)
+
+// CoverageTarget is a code location directed fuzzing steers toward. A
+// function alone targets its entry; an offset targets the instruction at
+// that byte offset of the module, as printed by disassemblers.
+type CoverageTarget struct {
+	// Function is an export name or a function index
+	Function string `yaml:"function"`
+	// Offset is the instruction's byte offset in the module file
+	Offset int `yaml:"offset"`
+}
+
+// TargetCoverage reports the progress toward one target
+type TargetCoverage struct {
+	Function string `json:"function,omitempty"`
+	Offset   int    `json:"offset,omitempty"`
+	Reached  bool   `json:"reached"`
+	// Distance is the smallest number of differing bits seen between the
+	// operands of a comparison guarding the target. It is absent when no
+	// guard was executed.
+	Distance *int `json:"distance,omitempty"`
+}
+
+// coverageLayout maps the directed feedback region back to targets
+type coverageLayout struct {
+	// targets are the configured targets found in the module
+	targets []CoverageTarget
+	// guards lists, per comparison site, the targets it guards
+	guards [][]int
+	// logsComparisons is set when pages after the directed feedback log
+	// comparison operands, and wide says, per logged site, whether it
+	// compares i64s
+	logsComparisons bool
+	wide            []bool
+}
+
+// directedGuard makes the comparisons of a function before cutoff guards
+// of a target
+type directedGuard struct {
+	target int
+	cutoff int
+}
+
+// directedPlan records where directed probes go in each function body
+type directedPlan struct {
+	layout *coverageLayout
+	// probes maps a body index and instruction offset to reached targets
+	probes map[int]map[int][]int
+	// guards lists the targets each body's comparisons guard
+	guards map[int][]directedGuard
+	params []uint32
+}
+
+// planDirected resolves targets and finds the comparisons guarding them:
+// those before the target in its own function, and every comparison in the
+// functions that can reach it through direct calls. Targets not present in
+// the module are ignored, since one campaign config covers many modules.
+func planDirected(module *wasmBinary, codeOffset int, bodies []wasmFunctionBody, importedFuncs uint32, targets []CoverageTarget) (*directedPlan, error) {
+	if len(targets) > maxCoverageTargets {
+		return nil, fmt.Errorf("at most %d coverage targets are supported", maxCoverageTargets)
+	}
+
+	exports, err := module.functionExports()
+	if err != nil {
+		return nil, err
+	}
+	params, err := module.paramCounts()
+	if err != nil {
+		return nil, err
+	}
+	if len(params) != len(bodies) {
+		return nil, fmt.Errorf("%d function declarations but %d bodies", len(params), len(bodies))
+	}
+
+	// Decode every body once for target resolution and the call graph
+	callers := make(map[int]map[int]bool)
+	instructions := make([][]wasmbin.Instruction, len(bodies))
+	for i, body := range bodies {
+		if instructions[i], err = wasmbin.DecodeInstructions(body.Code); err != nil {
+			return nil, fmt.Errorf("function %d: %w", importedFuncs+uint32(i), err)
+		}
+		for _, instr := range instructions[i] {
+			// call and return_call
+			if (instr.Opcode != opCall && instr.Opcode != 0x12) || instr.Index < importedFuncs {
+				continue
+			}
+			callee := int(instr.Index - importedFuncs)
+			if callers[callee] == nil {
+				callers[callee] = make(map[int]bool)
+			}
+			callers[callee][i] = true
+		}
+	}
+
+	plan := &directedPlan{
+		layout: &coverageLayout{},
+		probes: make(map[int]map[int][]int),
+		guards: make(map[int][]directedGuard),
+		params: params,
+	}
+	for _, target := range targets {
+		body, start, found, err := resolveTarget(target, exports, codeOffset, bodies, instructions, importedFuncs)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			continue
+		}
+
+		index := len(plan.layout.targets)
+		plan.layout.targets = append(plan.layout.targets, target)
+		if plan.probes[body] == nil {
+			plan.probes[body] = make(map[int][]int)
+		}
+		plan.probes[body][start] = append(plan.probes[body][start], index)
+		if start > 0 {
+			plan.guards[body] = append(plan.guards[body], directedGuard{target: index, cutoff: start})
+		}
+
+		// Every function that can call into the target guards it entirely
+		seen := map[int]bool{body: true}
+		queue := []int{body}
+		for len(queue) > 0 {
+			callee := queue[0]
+			queue = queue[1:]
+			for caller := range callers[callee] {
+				if seen[caller] {
+					continue
+				}
+				seen[caller] = true
+				queue = append(queue, caller)
+				plan.guards[caller] = append(plan.guards[caller], directedGuard{target: index, cutoff: len(bodies[caller].Code)})
+			}
+		}
+	}
+	return plan, nil
+}
+
+// resolveTarget finds the body index and instruction offset of a target
+func resolveTarget(target CoverageTarget, exports map[string]uint32, codeOffset int, bodies []wasmFunctionBody, instructions [][]wasmbin.Instruction, importedFuncs uint32) (body, start int, found bool, err error) {
+	body = -1
+	if target.Function != "" {
+		index, ok := exports[target.Function]
+		if !ok {
+			parsed, parseErr := strconv.ParseUint(target.Function, 10, 32)
+			if parseErr != nil {
+				return 0, 0, false, nil
+			}
+			index = uint32(parsed)
+		}
+		if index < importedFuncs || int(index-importedFuncs) >= len(bodies) {
+			return 0, 0, false, nil
+		}
+		body = int(index - importedFuncs)
+	}
+	if target.Offset == 0 {
+		return body, 0, body >= 0, nil
+	}
+
+	for i, b := range bodies {
+		relative := target.Offset - codeOffset - b.CodeOffset
+		if relative < 0 || relative >= len(b.Code) {
+			continue
+		}
+		if body >= 0 && body != i {
+			return 0, 0, false, fmt.Errorf("offset 0x%x is not in function %q", target.Offset, target.Function)
+		}
+		for _, instr := range instructions[i] {
+			if instr.Start == relative {
+				return i, relative, true, nil
+			}
+		}
+		return 0, 0, false, fmt.Errorf("offset 0x%x is not an instruction boundary", target.Offset)
+	}
+	return 0, 0, false, nil
+}
+
+// feedbackLayout returns the feedback layout, or nil without targets
+func (p *directedPlan) feedbackLayout() *coverageLayout {
+	if p == nil {
+		return nil
+	}
+	return p.layout
+}
+
+// hooks returns the probes to insert ahead of a body's instructions: a
+// reached flag at each target and a distance probe at each guard
+// comparison. Bodies with guards get scratch locals for the operands.
+func (p *directedPlan) hooks(body *wasmFunctionBody, index int, memoryIndex uint32) (func(wasmbin.Instruction) []byte, error) {
+	probes := p.probes[index]
+	guards := p.guards[index]
+	if len(probes) == 0 && len(guards) == 0 {
+		return nil, nil
+	}
+
+	var locals uint32
+	if len(guards) > 0 {
+		declared, err := body.localCount()
+		if err != nil {
+			return nil, err
+		}
+		locals = p.params[index] + declared
+		// Three i32 scratch locals followed by two i64 ones
+		if err := body.addLocals(0x7f, 3); err != nil {
+			return nil, err
+		}
+		if err := body.addLocals(0x7e, 2); err != nil {
+			return nil, err
+		}
+	}
+
+	return func(instr wasmbin.Instruction) []byte {
+		var out []byte
+		for _, target := range probes[instr.Start] {
+			out = wasmbin.AppendS32(append(out, opI32Const), int32(coverageMapSize+target))
+			out = append(out, opI32Const, 0x01)
+			out = coverageMemArg(append(out, opI32Store8), memoryIndex)
+		}
+
+		if !isGuardComparison(instr.Opcode) || len(p.layout.guards) >= maxGuardSites {
+			return out
+		}
+		var owners []int
+		for _, guard := range guards {
+			if instr.Start < guard.cutoff {
+				owners = append(owners, guard.target)
+			}
+		}
+		if len(owners) == 0 {
+			return out
+		}
+
+		site := len(p.layout.guards)
+		p.layout.guards = append(p.layout.guards, owners)
+		address := uint32(coverageMapSize + maxCoverageTargets + site)
+		return append(out, comparisonProbe(instr.Opcode, address, locals, memoryIndex)...)
+	}, nil
+}
+
+// isGuardComparison reports whether an opcode is an integer comparison
+func isGuardComparison(op byte) bool {
+	return op >= opI32Eqz && op <= opI32GeU || op >= opI64Eqz && op <= opI64GeU
+}
+
+// comparisonProbe records how close a comparison's operands are. Operating
+// on the operands left on the stack, it stores 255 minus the number of
+// differing bits (the distance to zero for eqz) into the site's slot if that
+// beats the slot's current value, then pushes the operands back. Zero means
+// the comparison never ran. locals is the first of three i32 and two i64
+// scratch locals.
+func comparisonProbe(op byte, address, locals, memoryIndex uint32) []byte {
+	a, b, d := locals, locals+1, locals+2
+	xor, popcnt := byte(opI32Xor), byte(opI32Popcnt)
+	wide := op >= opI64Eqz
+	if wide {
+		a, b = locals+3, locals+4
+		xor, popcnt = opI64Xor, opI64Popcnt
+	}
+	unary := op == opI32Eqz || op == opI64Eqz
+
+	local := func(out []byte, op byte, index uint32) []byte {
+		return wasmbin.AppendU32(append(out, op), index)
+	}
+	load := func(out []byte) []byte {
+		out = wasmbin.AppendS32(append(out, opI32Const), int32(address))
+		return coverageMemArg(append(out, opI32Load8U), memoryIndex)
+	}
+
+	var out []byte
+	if !unary {
+		out = local(out, opLocalSet, b)
+	}
+	out = local(out, opLocalSet, a)
+
+	// d = 255 - popcnt(a ^ b)
+	out = append(out, opI32Const)
+	out = wasmbin.AppendS32(out, 255)
+	out = local(out, opLocalGet, a)
+	if !unary {
+		out = local(out, opLocalGet, b)
+		out = append(out, xor)
+	}
+	out = append(out, popcnt)
+	if wide {
+		out = append(out, opI32WrapI64)
+	}
+	out = append(out, opI32Sub)
+	out = local(out, opLocalSet, d)
+
+	// slot = d > slot ? d : slot
+	out = wasmbin.AppendS32(append(out, opI32Const), int32(address))
+	out = local(out, opLocalGet, d)
+	out = load(out)
+	out = local(out, opLocalGet, d)
+	out = load(out)
+	out = append(out, opI32GtU, opSelect)
+	out = coverageMemArg(append(out, opI32Store8), memoryIndex)
+
+	// Restore the operands for the original comparison
+	out = local(out, opLocalGet, a)
+	if !unary {
+		out = local(out, opLocalGet, b)
+	}
+	return out
+}
+
+// setLayout resets the directed feedback state for a newly instrumented module
+func (t *coverageTracker) setLayout(layout *coverageLayout) {
+	t.layout = layout
+	t.reached, t.distance, t.comparisons = nil, nil, nil
+	if layout == nil {
+		return
+	}
+	t.reached = make([]bool, len(layout.targets))
+	t.distance = make([]int, len(layout.targets))
+	for i := range t.distance {
+		t.distance[i] = -1
+	}
+}
+
+// mergeDirected adds one execution's directed feedback region and reports
+// whether any target was newly reached or got closer
+func (t *coverageTracker) mergeDirected(region []byte) bool {
+	if t.layout == nil {
+		return false
+	}
+
+	closer := false
+	for i := range t.layout.targets {
+		if i < len(region) && region[i] != 0 && !t.reached[i] {
+			t.reached[i] = true
+			closer = true
+		}
+	}
+	for site, owners := range t.layout.guards {
+		slot := maxCoverageTargets + site
+		if slot >= len(region) || region[slot] == 0 {
+			continue
+		}
+		distance := 0xff - int(region[slot])
+		for _, target := range owners {
+			if t.distance[target] < 0 || distance < t.distance[target] {
+				t.distance[target] = distance
+				closer = true
+			}
+		}
+	}
+	return closer
+}
+
+// targetCoverage reports the progress toward each target found in the module
+func (t *coverageTracker) targetCoverage() []TargetCoverage {
+	if t.layout == nil {
+		return nil
+	}
+	coverage := make([]TargetCoverage, len(t.layout.targets))
+	for i, target := range t.layout.targets {
+		coverage[i] = TargetCoverage{Function: target.Function, Offset: target.Offset, Reached: t.reached[i]}
+		if t.distance[i] >= 0 {
+			distance := t.distance[i]
+			coverage[i].Distance = &distance
+		}
+	}
+	return coverage
+}
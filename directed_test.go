@@ -0,0 +1,190 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"testing"
+
+	"github.com/mrhapile/WASM-Injection-Framework/internal/wasmbin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// magicBody returns 1 only for the magic input 0x1234:
+//
+//	local.get 0  i32.const 0x1234  i32.eq
+//	if (result i32) i32.const 1 else i32.const 2 end
+var magicBody = []byte{0x20, 0x00, 0x41, 0xb4, 0x24, 0x46, 0x04, 0x7f, 0x41, 0x01, 0x05, 0x41, 0x02, 0x0b, 0x0b}
+
+// magicThenOffset is the position of the then-arm in magicBody
+const magicThenOffset = 8
+
+// moduleOffset converts an offset in the first function body to a module offset
+func moduleOffset(t *testing.T, data []byte, offset int) int {
+	module, err := parseWasmBinary(data)
+	require.NoError(t, err)
+	code := module.section(sectionCode)
+	bodies, err := parseCodeSection(code.Payload)
+	require.NoError(t, err)
+	return code.Offset + bodies[0].CodeOffset + offset
+}
+
+// directedRegion builds a coverage memory whose second page has the given
+// target flags and guard slots set
+func directedRegion(flags map[int]byte, slots map[int]byte) []byte {
+	trace := make([]byte, 2*coverageMapSize)
+	for i, v := range flags {
+		trace[coverageMapSize+i] = v
+	}
+	for i, v := range slots {
+		trace[coverageMapSize+maxCoverageTargets+i] = v
+	}
+	return trace
+}
+
+// -----------------------------------------------------------------------------
+// TEST: Directed Fuzzing Targets
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Directed fuzzing only works if targets resolve to the code the user
+// meant, and if the comparisons guarding a target report how close their
+// operands came, so the mutator can climb toward magic values instead of
+// guessing them.
+// -----------------------------------------------------------------------------
+
+func TestDirected_ResolvesOffsetTargets(t *testing.T) {
+	data := buildTestModule(magicBody, false)
+	target := CoverageTarget{Offset: moduleOffset(t, data, magicThenOffset)}
+
+	_, layout, err := instrumentEdges(data, []CoverageTarget{target}, false)
+	require.NoError(t, err)
+
+	require.NotNil(t, layout)
+	assert.Equal(t, []CoverageTarget{target}, layout.targets)
+	assert.Equal(t, [][]int{{0}}, layout.guards, "the i32.eq before the target guards it")
+}
+
+func TestDirected_ResolvesFunctionTargets(t *testing.T) {
+	targets := []CoverageTarget{{Function: "process"}, {Function: "0"}, {Function: "missing"}}
+
+	_, layout, err := instrumentEdges(buildTestModule(magicBody, false), targets, false)
+	require.NoError(t, err)
+
+	assert.Equal(t, targets[:2], layout.targets, "targets absent from the module are skipped")
+	assert.Empty(t, layout.guards, "nothing precedes a function entry in its own body")
+}
+
+func TestDirected_RejectsMisalignedOffsets(t *testing.T) {
+	data := buildTestModule(magicBody, false)
+	// One byte into the i32.const immediate
+	target := CoverageTarget{Offset: moduleOffset(t, data, 3)}
+
+	_, _, err := instrumentEdges(data, []CoverageTarget{target}, false)
+	assert.ErrorContains(t, err, "not an instruction boundary")
+}
+
+func TestDirected_AddsScratchLocals(t *testing.T) {
+	data := buildTestModule(magicBody, false)
+	instrumented, _, err := instrumentEdges(data, []CoverageTarget{{Offset: moduleOffset(t, data, magicThenOffset)}}, false)
+	require.NoError(t, err)
+
+	module, err := parseWasmBinary(instrumented)
+	require.NoError(t, err)
+	bodies, err := parseCodeSection(module.section(sectionCode).Payload)
+	require.NoError(t, err)
+	locals, err := bodies[0].localCount()
+	require.NoError(t, err)
+	assert.Equal(t, uint32(5), locals)
+
+	_, err = wasmbin.DecodeInstructions(bodies[0].Code)
+	assert.NoError(t, err)
+}
+
+func TestDirected_ProbeRestoresOperands(t *testing.T) {
+	// i32.eq; locals start at 1, after the single parameter
+	probe := comparisonProbe(0x46, coverageMapSize+maxCoverageTargets, 1, 0)
+
+	instructions, err := wasmbin.DecodeInstructions(probe)
+	require.NoError(t, err)
+	first, last := instructions[:2], instructions[len(instructions)-2:]
+	assert.Equal(t, []uint32{2, 1}, []uint32{first[0].Index, first[1].Index}, "operands are popped b then a")
+	assert.Equal(t, []uint32{1, 2}, []uint32{last[0].Index, last[1].Index}, "and pushed back a then b")
+	assert.Equal(t, byte(opLocalGet), last[0].Opcode)
+}
+
+// -----------------------------------------------------------------------------
+// TEST: Branch Distance Feedback
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// The tracker turns raw slot values into per-target distances. Inputs must
+// only count as progress when they beat the best distance so far, otherwise
+// the mutator would favor inputs that merely repeat earlier ones.
+// -----------------------------------------------------------------------------
+
+func TestDirected_TrackerReportsProgress(t *testing.T) {
+	tracker := newCoverageTracker()
+	tracker.setLayout(&coverageLayout{
+		targets: []CoverageTarget{{Function: "process"}},
+		guards:  [][]int{{0}, {0}},
+	})
+
+	assert.True(t, tracker.mergeDirected(directedRegion(nil, map[int]byte{0: 0xff - 5})[coverageMapSize:]))
+	assert.False(t, tracker.mergeDirected(directedRegion(nil, map[int]byte{0: 0xff - 6})[coverageMapSize:]), "farther away")
+	assert.True(t, tracker.mergeDirected(directedRegion(nil, map[int]byte{1: 0xff - 2})[coverageMapSize:]), "another guard got closer")
+	assert.True(t, tracker.mergeDirected(directedRegion(map[int]byte{0: 1}, nil)[coverageMapSize:]), "reached")
+	assert.False(t, tracker.mergeDirected(directedRegion(map[int]byte{0: 1}, nil)[coverageMapSize:]), "reached again")
+
+	coverage := tracker.targetCoverage()
+	require.Len(t, coverage, 1)
+	assert.True(t, coverage[0].Reached)
+	require.NotNil(t, coverage[0].Distance)
+	assert.Equal(t, 2, *coverage[0].Distance)
+}
+
+func TestDirected_UnexecutedGuardsReportNoDistance(t *testing.T) {
+	tracker := newCoverageTracker()
+	tracker.setLayout(&coverageLayout{targets: []CoverageTarget{{Offset: 42}}, guards: [][]int{{0}}})
+
+	tracker.mergeDirected(directedRegion(nil, nil)[coverageMapSize:])
+
+	coverage := tracker.targetCoverage()
+	assert.False(t, coverage[0].Reached)
+	assert.Nil(t, coverage[0].Distance)
+}
+
+func TestDirected_ArgFuzzClimbsTowardTarget(t *testing.T) {
+	// The mock module reports the bit distance of the input to a magic value
+	// in the first guard slot, like an instrumented i32.eq would
+	const magic = int32(0x5eed)
+	module := &coverageMockModule{}
+	module.ExecuteFunc = func(funcName string, args ...interface{}) ([]interface{}, error) {
+		input := args[0].(int32)
+		flags := map[int]byte{}
+		if input == magic {
+			flags[0] = 1
+		}
+		distance := 0
+		for diff := uint32(input ^ magic); diff != 0; diff &= diff - 1 {
+			distance++
+		}
+		module.traces = append(module.traces, directedRegion(flags, map[int]byte{0: byte(0xff - distance)}))
+		return []interface{}{input}, nil
+	}
+
+	tracker := newCoverageTracker()
+	tracker.setLayout(&coverageLayout{targets: []CoverageTarget{{Function: "process"}}, guards: [][]int{{0}}})
+	var wasm WasmModule = module
+	result := &ExecutionResult{}
+	plan := InvocationConfig{Entry: "process", Inputs: i32Inputs(0)}
+
+	runtime := &MockWasmRuntime{
+		LoadModuleFunc: func(filePath string) (WasmModule, error) { return module, nil },
+	}
+
+	fuzzArguments(result, &wasm, "magic.wasm", runtime, plan, [][]int32{{0}}, ArgFuzzConfig{Iterations: 2000, Seed: 1, Reload: true}, tracker)
+
+	assert.True(t, tracker.targetCoverage()[0].Reached, "bit-distance feedback should find the magic value")
+}
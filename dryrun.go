@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// CampaignPlan is what a campaign would run, written by --dry-run
+type CampaignPlan struct {
+	Environments []Environment `json:"environments"`
+	// Entry and Inputs are the export each file's module is called
+	// through, and how many inputs it is called with
+	Entry  string `json:"entry"`
+	Inputs int    `json:"inputs"`
+	// Files lists the files that would run, in order
+	Files []PlannedFile `json:"files"`
+	// Skipped lists the files that would not run, and why
+	Skipped []PlannedSkip `json:"skipped,omitempty"`
+	// Injections describe what would be injected into every file
+	Injections []string         `json:"injections,omitempty"`
+	StopAfter  FailureStage     `json:"stop_after,omitempty"`
+	Selection  *CorpusSelection `json:"selection,omitempty"`
+	Shard      *ShardInfo       `json:"shard,omitempty"`
+}
+
+// PlannedFile is a file a campaign would run, with the environments it
+// would run under
+type PlannedFile struct {
+	FilePath     string        `json:"file_path"`
+	Environments []string      `json:"environments"`
+	Chaos        *ChaosProfile `json:"chaos,omitempty"`
+	Quarantined  bool          `json:"quarantined,omitempty"`
+	// LargeModule is set for files run in a large-module worker
+	LargeModule bool `json:"large_module,omitempty"`
+	// Unchanged is set for files unchanged since the ref of an incremental
+	// run, which are only reported when their result is cached
+	Unchanged bool `json:"unchanged,omitempty"`
+}
+
+// PlannedSkip is a file a campaign would skip under an environment
+type PlannedSkip struct {
+	FilePath    string     `json:"file_path"`
+	Environment string     `json:"environment,omitempty"`
+	Reason      SkipReason `json:"reason"`
+	Details     string     `json:"details,omitempty"`
+}
+
+// planDryRun resolves a campaign the way runFuzzerWithMatrix would,
+// without creating a runtime or running anything
+func planDryRun(dirPath string, config Config, opts RunOptions) (CampaignPlan, error) {
+	environments, err := campaignEnvironments(config)
+	if err != nil {
+		return CampaignPlan{}, fmt.Errorf("invalid environment matrix: %w", err)
+	}
+	if err := opts.check(); err != nil {
+		return CampaignPlan{}, err
+	}
+	if _, err := newClassifierChain(opts.Classifiers); err != nil {
+		return CampaignPlan{}, err
+	}
+	if _, err := newCampaignBreaker(opts.MaxFailures, opts.CircuitBreaker); err != nil {
+		return CampaignPlan{}, err
+	}
+	if _, err := newCampaignBudget(opts.MaxDuration); err != nil {
+		return CampaignPlan{}, err
+	}
+	history, err := loadHistory(opts.History)
+	if err != nil {
+		return CampaignPlan{}, err
+	}
+	quarantine, err := loadQuarantine(opts.Quarantine)
+	if err != nil {
+		return CampaignPlan{}, err
+	}
+	if _, err := loadExpectations(dirPath); err != nil {
+		return CampaignPlan{}, err
+	}
+
+	envs := make([]environmentRuntime, len(environments))
+	for i, env := range environments {
+		envs[i].Environment = env
+	}
+	report, jobs, err := planCampaign(dirPath, envs, opts)
+	if err != nil {
+		return CampaignPlan{}, err
+	}
+	if opts.MaxDuration > 0 {
+		jobs = scheduleJobs(jobs, history)
+	}
+
+	invocation := opts.Invocation.withDefaults()
+	plan := CampaignPlan{
+		Environments: environments,
+		Entry:        invocation.Entry,
+		Inputs:       len(invocation.Inputs),
+		Files:        make([]PlannedFile, 0),
+		Injections:   describeInjections(opts),
+		StopAfter:    report.StopAfter,
+		Selection:    report.Selection,
+		Shard:        report.Shard,
+	}
+	for i, result := range report.Results {
+		if result.Skipped {
+			plan.Skipped = append(plan.Skipped, PlannedSkip{
+				FilePath:    result.FilePath,
+				Environment: environments[i%len(environments)].Name,
+				Reason:      result.SkipReason,
+				Details:     result.SkipDetails,
+			})
+		}
+	}
+	for _, job := range jobs {
+		if n := len(plan.Files); n > 0 && plan.Files[n-1].FilePath == job.FilePath {
+			plan.Files[n-1].Environments = append(plan.Files[n-1].Environments, environments[job.Env].Name)
+			continue
+		}
+		plan.Files = append(plan.Files, PlannedFile{
+			FilePath:     job.FilePath,
+			Environments: []string{environments[job.Env].Name},
+			Chaos:        opts.Chaos.profile(job.Index/len(envs), len(report.Results)/len(envs)),
+			Quarantined:  quarantine.holds(job.FilePath),
+			LargeModule:  opts.LargeModules.holds(job.FilePath),
+			Unchanged:    job.Unchanged,
+		})
+	}
+	return plan, nil
+}
+
+// describeInjections describes each thing injected into the files run
+func describeInjections(opts RunOptions) []string {
+	var injections []string
+	for i, segment := range opts.DataSegments {
+		if segment.Segment != nil {
+			injections = append(injections, fmt.Sprintf("data segment %d: replaces the contents of segment %d", i, *segment.Segment))
+		} else {
+			injections = append(injections, fmt.Sprintf("data segment %d: written to memory %d at offset %d", i, segment.Memory, segment.Offset))
+		}
+	}
+	for _, global := range opts.Tamper.Globals {
+		injections = append(injections, fmt.Sprintf("tamper: global %s set to %s", global.Global, global.Value))
+	}
+	for _, table := range opts.Tamper.Tables {
+		function := table.Function
+		if function == "" {
+			function = "null"
+		}
+		injections = append(injections, fmt.Sprintf("tamper: table %d[%d] set to %s", table.Table, table.Slot, function))
+	}
+	for _, proxy := range opts.Invocation.Proxies {
+		var actions []string
+		if proxy.Record {
+			actions = append(actions, "record")
+		}
+		if proxy.Return != nil {
+			actions = append(actions, "return ["+strings.Join(proxy.Return, ", ")+"]")
+		}
+		if proxy.DropEvery > 0 {
+			actions = append(actions, fmt.Sprintf("drop every %d", proxy.DropEvery))
+		}
+		if len(actions) == 0 {
+			actions = append(actions, "count")
+		}
+		injections = append(injections, fmt.Sprintf("proxy %s: %s", proxy.Import, strings.Join(actions, ", ")))
+	}
+	if fault := opts.Invocation.Log.Fault; fault != "" {
+		injections = append(injections, "log fault: "+fault)
+	}
+	if len(opts.Chaos.Phases) > 0 {
+		fault := opts.Chaos.Fault
+		if fault == "" {
+			fault = ChaosTrap
+		}
+		imports := "every import"
+		if len(opts.Chaos.Imports) > 0 {
+			imports = strings.Join(opts.Chaos.Imports, ", ")
+		}
+		injections = append(injections, fmt.Sprintf("chaos: %s faults in %s over %d phases, seed %d", fault, imports, len(opts.Chaos.Phases), opts.Chaos.Seed))
+	}
+	if pressure := opts.MemoryPressure; pressure.enabled() {
+		stages := "every stage"
+		if len(pressure.Stages) > 0 {
+			names := make([]string, len(pressure.Stages))
+			for i, stage := range pressure.Stages {
+				names[i] = string(stage)
+			}
+			stages = strings.Join(names, ", ")
+		}
+		injections = append(injections, fmt.Sprintf("memory pressure: %d bytes of headroom in %s", pressure.Headroom, stages))
+	}
+	if opts.CompareClean && len(injections) > 0 {
+		injections = append(injections, "every file also runs clean for comparison")
+	}
+	return injections
+}
+
+// runDryRun prints the plan of a campaign
+func runDryRun(command fuzzCommand) int {
+	config, ok := loadCampaignConfig(command.dirPath, command.configPath)
+	if !ok {
+		return 1
+	}
+	command.apply(&config)
+
+	plan, err := planDryRun(command.dirPath, config, config.runOptions())
+	if err != nil {
+		emitError(map[string]string{
+			"error":   "campaign plan failed",
+			"details": err.Error(),
+		})
+		return 1
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(plan); err != nil {
+		emitError(map[string]string{
+			"error":   "failed to encode JSON output",
+			"details": err.Error(),
+		})
+		return 1
+	}
+	return 0
+}
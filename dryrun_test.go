@@ -0,0 +1,63 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// -----------------------------------------------------------------------------
+// TEST: Dry Run
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Corpus filters, shards, a matrix and several injections interact, and a
+// mistake in any of them shows only after a long campaign. Resolving the
+// config the way a campaign would, without a runtime, shows which files
+// would run where and what would be done to them.
+// -----------------------------------------------------------------------------
+
+func TestDryRun_PlansWithoutRunning(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.wasm"), []byte("a"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.wasm"), []byte("a"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "slow.wasm"), []byte("c"), 0o644))
+
+	config := Config{
+		Matrix: MatrixConfig{Backends: []string{BackendInterpreter, BackendAOT}},
+		Corpus: CorpusConfig{Exclude: []string{"slow*"}, SkipDuplicates: true},
+		Tamper: TamperConfig{Globals: []GlobalTamper{{Global: "max_len", Value: "0"}}},
+		Chaos:  ChaosConfig{Seed: 3, Phases: []ChaosPhase{{Name: "baseline"}}},
+	}
+	plan, err := planDryRun(dir, config, config.runOptions())
+	require.NoError(t, err)
+
+	require.Len(t, plan.Environments, 2)
+	assert.Equal(t, "process", plan.Entry)
+	require.Len(t, plan.Files, 1)
+	assert.Equal(t, filepath.Join(dir, "a.wasm"), plan.Files[0].FilePath)
+	assert.Equal(t, []string{"backend=interpreter", "backend=aot"}, plan.Files[0].Environments)
+	assert.Equal(t, "baseline", plan.Files[0].Chaos.Phase)
+
+	require.Len(t, plan.Skipped, 4)
+	assert.Equal(t, PlannedSkip{FilePath: filepath.Join(dir, "b.wasm"), Environment: "backend=interpreter", Reason: SkipDuplicate, Details: "same content as a.wasm"}, plan.Skipped[0])
+	assert.Equal(t, SkipFiltered, plan.Skipped[2].Reason)
+
+	assert.Equal(t, []string{
+		"tamper: global max_len set to 0",
+		"chaos: trap faults in every import over 1 phases, seed 3",
+	}, plan.Injections)
+}
+
+func TestDryRun_RejectsBadConfig(t *testing.T) {
+	_, err := planDryRun(t.TempDir(), Config{Matrix: MatrixConfig{Backends: []string{"jit"}}}, RunOptions{})
+	assert.ErrorContains(t, err, "invalid environment matrix")
+	_, err = planDryRun(t.TempDir(), Config{}, RunOptions{CompareClean: true})
+	assert.EqualError(t, err, "compare_clean needs something injected to compare against")
+}
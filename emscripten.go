@@ -0,0 +1,411 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mrhapile/WASM-Injection-Framework/internal/wasmbin"
+)
+
+// emscriptenModule is the import module of Emscripten's JS library
+const emscriptenModule = "env"
+
+// emscriptenENOSYS is the negated errno syscalls return when they are not
+// implemented
+const emscriptenENOSYS = -52
+
+// emscriptenMaxString caps the C strings host functions read
+const emscriptenMaxString = 4096
+
+// emscriptenMarkers are imports and exports only Emscripten output has
+var emscriptenMarkers = []string{
+	"emscripten_", "_emscripten_", "__syscall_", "invoke_", "_embind_",
+	"__assert_fail", "_abort_js", "setTempRet0", "getTempRet0",
+}
+
+// emscriptenInitializers are the exports Emscripten's JS glue calls after
+// instantiation, in order: the stack limits, then static constructors
+var emscriptenInitializers = []string{"emscripten_stack_init", "__wasm_call_ctors"}
+
+// isEmscripten reports whether a module was built by Emscripten for its
+// JS glue, which shows in its env imports and runtime exports
+func isEmscripten(binary *wasmBinary) bool {
+	imports, err := binary.functionImports()
+	if err != nil {
+		return false
+	}
+	names := make([]string, 0, len(imports))
+	for _, imp := range imports {
+		if imp.Module == emscriptenModule {
+			names = append(names, imp.Name)
+		}
+	}
+	exports, err := binary.functionExports()
+	if err != nil {
+		return false
+	}
+	for name := range exports {
+		names = append(names, name)
+	}
+
+	for _, name := range names {
+		for _, marker := range emscriptenMarkers {
+			if strings.HasPrefix(name, marker) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// defineImportedStorage turns memory and table imports into definitions of
+// the same type, as the JS glue creates them before instantiation, and
+// exports memory 0 as "memory" when nothing else is. Imported memories and
+// tables precede defined ones, so their indices are unchanged. It reports
+// whether the module was modified.
+func defineImportedStorage(binary *wasmBinary) (bool, error) {
+	section := binary.section(sectionImport)
+	if section == nil {
+		return false, nil
+	}
+
+	r := &wasmbin.Reader{Data: section.Payload}
+	n, err := r.U32()
+	if err != nil {
+		return false, err
+	}
+	var kept []byte
+	var keptCount uint32
+	defined := map[byte][][]byte{}
+	for i := uint32(0); i < n; i++ {
+		start := r.Pos
+		if _, err := r.Name(); err != nil {
+			return false, err
+		}
+		if _, err := r.Name(); err != nil {
+			return false, err
+		}
+		kind, err := r.Byte()
+		if err != nil {
+			return false, err
+		}
+		desc := r.Pos
+		if err := r.SkipImportDesc(kind); err != nil {
+			return false, fmt.Errorf("import %d: %w", i, err)
+		}
+		// A table or memory type encodes the same as its definition
+		if kind == externMemory || kind == externTable {
+			defined[kind] = append(defined[kind], section.Payload[desc:r.Pos])
+			continue
+		}
+		kept = append(kept, section.Payload[start:r.Pos]...)
+		keptCount++
+	}
+	if len(defined) == 0 {
+		return false, nil
+	}
+	section.Payload = append(wasmbin.AppendU32(nil, keptCount), kept...)
+
+	for _, target := range []struct {
+		kind byte
+		id   byte
+	}{{externTable, sectionTable}, {externMemory, sectionMemory}} {
+		types := defined[target.kind]
+		if len(types) == 0 {
+			continue
+		}
+		s := binary.ensureSection(target.id)
+		r := &wasmbin.Reader{Data: s.Payload}
+		count, err := r.U32()
+		if err != nil {
+			return false, err
+		}
+		payload := wasmbin.AppendU32(nil, count+uint32(len(types)))
+		for _, t := range types {
+			payload = append(payload, t...)
+		}
+		s.Payload = append(payload, s.Payload[r.Pos:]...)
+	}
+
+	if len(defined[externMemory]) > 0 {
+		exported, err := binary.exportNames()
+		if err != nil {
+			return false, err
+		}
+		if !exported[defaultMemoryExport] {
+			entry := wasmbin.AppendName(nil, defaultMemoryExport)
+			entry = append(entry, externMemory)
+			entry = wasmbin.AppendU32(entry, 0)
+			if _, err := binary.ensureSection(sectionExport).appendVectorEntry(entry); err != nil {
+				return false, err
+			}
+		}
+	}
+	return true, nil
+}
+
+// exportNames returns the names of all exports
+func (m *wasmBinary) exportNames() (map[string]bool, error) {
+	names := make(map[string]bool)
+	section := m.section(sectionExport)
+	if section == nil {
+		return names, nil
+	}
+
+	r := &wasmbin.Reader{Data: section.Payload}
+	n, err := r.U32()
+	if err != nil {
+		return nil, err
+	}
+	for i := uint32(0); i < n; i++ {
+		name, err := r.Name()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := r.Byte(); err != nil {
+			return nil, err
+		}
+		if _, err := r.U32(); err != nil {
+			return nil, err
+		}
+		names[name] = true
+	}
+	return names, nil
+}
+
+// emscriptenHost implements the parts of Emscripten's JS library a module
+// can use without a browser or Node.js: memory copies, a fixed clock,
+// aborts and assertions as traps, and syscalls failing with ENOSYS.
+// Functions calling back into the module through its table, such as
+// invoke_* for C++ exceptions and setjmp, trap.
+type emscriptenHost struct {
+	memory   *hostMemory
+	wasi     *minimalWASI
+	tempRet0 uint64
+}
+
+func newEmscriptenHost() *emscriptenHost {
+	memory := &hostMemory{}
+	return &emscriptenHost{memory: memory, wasi: newMinimalWASI(memory)}
+}
+
+// readCString reads a NUL-terminated string from the module's memory
+func (h *emscriptenHost) readCString(ptr uint64) (string, error) {
+	var data []byte
+	for i := uint64(0); i < emscriptenMaxString; i++ {
+		c, err := h.memory.read(ptr+i, 1)
+		if err != nil {
+			return "", err
+		}
+		if c[0] == 0 {
+			return string(data), nil
+		}
+		data = append(data, c[0])
+	}
+	return "", fmt.Errorf("string exceeds the limit of %d bytes", emscriptenMaxString)
+}
+
+// functions returns the env functions by name
+func (h *emscriptenHost) functions() map[string]nativeFunction {
+	memcpy := func(args []uint64) ([]interface{}, error) {
+		data, err := h.memory.read(args[1], args[2])
+		if err != nil {
+			return nil, err
+		}
+		return nil, h.memory.write(args[0], data)
+	}
+	abort := func(args []uint64) ([]interface{}, error) {
+		return nil, fmt.Errorf("abort()")
+	}
+	exit := func(args []uint64) ([]interface{}, error) {
+		return nil, &wasiExit{code: uint32(args[0])}
+	}
+
+	return map[string]nativeFunction{
+		"emscripten_memcpy_big": {funcSig("i32 i32 i32", ""), memcpy},
+		"emscripten_memcpy_js":  {funcSig("i32 i32 i32", ""), memcpy},
+		"_emscripten_memcpy_js": {funcSig("i32 i32 i32", ""), memcpy},
+		"emscripten_resize_heap": {funcSig("i32", "i32"), func(args []uint64) ([]interface{}, error) {
+			// Memory cannot grow past what the module declares
+			return []interface{}{int32(0)}, nil
+		}},
+		"emscripten_notify_memory_growth": {funcSig("i32", ""), func(args []uint64) ([]interface{}, error) {
+			return nil, nil
+		}},
+		"emscripten_date_now": {funcSig("", "f64"), func(args []uint64) ([]interface{}, error) {
+			return []interface{}{float64(wasiClock / 1_000_000)}, nil
+		}},
+		"emscripten_get_now": {funcSig("", "f64"), func(args []uint64) ([]interface{}, error) {
+			return []interface{}{float64(0)}, nil
+		}},
+		"_emscripten_get_now_is_monotonic": {funcSig("", "i32"), func(args []uint64) ([]interface{}, error) {
+			return []interface{}{int32(1)}, nil
+		}},
+		"abort":     {funcSig("", ""), abort},
+		"_abort_js": {funcSig("", ""), abort},
+		"__assert_fail": {funcSig("i32 i32 i32 i32", ""), func(args []uint64) ([]interface{}, error) {
+			condition, err := h.readCString(args[0])
+			if err != nil {
+				return nil, err
+			}
+			file, err := h.readCString(args[1])
+			if err != nil {
+				return nil, err
+			}
+			function, err := h.readCString(args[3])
+			if err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("Assertion failed: %s, at: %s,%d,%s", condition, file, int32(args[2]), function)
+		}},
+		"__cxa_throw": {funcSig("i32 i32 i32", ""), func(args []uint64) ([]interface{}, error) {
+			return nil, fmt.Errorf("uncaught C++ exception")
+		}},
+		"_emscripten_throw_longjmp": {funcSig("", ""), func(args []uint64) ([]interface{}, error) {
+			return nil, fmt.Errorf("longjmp")
+		}},
+		"exit":  {funcSig("i32", ""), exit},
+		"_exit": {funcSig("i32", ""), exit},
+		"setTempRet0": {funcSig("i32", ""), func(args []uint64) ([]interface{}, error) {
+			h.tempRet0 = args[0]
+			return nil, nil
+		}},
+		"getTempRet0": {funcSig("", "i32"), func(args []uint64) ([]interface{}, error) {
+			return []interface{}{int32(h.tempRet0)}, nil
+		}},
+	}
+}
+
+// link binds the module's env and WASI imports. Syscalls fail with
+// ENOSYS, invoke_* wrappers trap and other env functions return zero
+// values; WASI functions the minimal host lacks return ENOSYS.
+func (h *emscriptenHost) link(imports []wasmFuncImport) ([]HostFunction, error) {
+	host, err := h.wasi.linkAll(imports)
+	if err != nil {
+		return nil, err
+	}
+	functions := h.functions()
+	for _, imp := range imports {
+		if imp.Module != emscriptenModule {
+			continue
+		}
+		if fn, ok := functions[imp.Name]; ok {
+			bound, err := fn.bind(imp)
+			if err != nil {
+				return nil, err
+			}
+			host = append(host, bound)
+			continue
+		}
+		switch {
+		case strings.HasPrefix(imp.Name, "invoke_"):
+			host = append(host, unsupportedFunction(imp))
+		case strings.HasPrefix(imp.Name, "__syscall_"), imp.Name == "_mmap_js", imp.Name == "_munmap_js":
+			host = append(host, enosysFunction(imp, emscriptenENOSYS))
+		default:
+			results, err := zeroResults(imp.Signature)
+			if err != nil {
+				return nil, fmt.Errorf("host function '%s': %v", imp.Name, err)
+			}
+			host = append(host, stubFunction(imp, results))
+		}
+	}
+	return host, nil
+}
+
+// enosysFunction links an import to a function returning errno when it
+// returns a single i32, or zero values otherwise
+func enosysFunction(imp wasmFuncImport, errno int32) HostFunction {
+	if len(imp.Signature.Results) == 1 && imp.Signature.Results[0] == "i32" {
+		return stubFunction(imp, []interface{}{errno})
+	}
+	results, err := zeroResults(imp.Signature)
+	if err != nil {
+		return unsupportedFunction(imp)
+	}
+	return stubFunction(imp, results)
+}
+
+// initialize runs the initializers the JS glue would call
+func (h *emscriptenHost) initialize(module WasmModule) error {
+	typed, ok := module.(SignatureModule)
+	if !ok {
+		return nil
+	}
+	for _, name := range emscriptenInitializers {
+		if _, found := typed.Signature(name); !found {
+			continue
+		}
+		if _, err := module.Execute(name); err != nil {
+			stage, message := classifyError(err, StageExecute, "execution failed")
+			return &RuntimeError{Stage: stage, Message: fmt.Sprintf("emscripten: %s: %s", name, message)}
+		}
+	}
+	return nil
+}
+
+// emscriptenRuntime loads modules built by Emscripten as its JS glue
+// would: memory and tables they import are defined in the module, env and
+// WASI imports are linked to shims and constructors run before the entry
+// point. Other modules, and all modules on runtimes that do not implement
+// HostLoader, load unchanged. Imported globals, as in dynamically linked
+// MAIN_MODULE and SIDE_MODULE builds, are not supported.
+type emscriptenRuntime struct {
+	runtime WasmRuntime
+	// output captures what the module writes to stdout and stderr
+	output *outputCapture
+}
+
+// LoadModule implements WasmRuntime.LoadModule
+func (r *emscriptenRuntime) LoadModule(filePath string) (WasmModule, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return r.runtime.LoadModule(filePath)
+	}
+	return r.load(filePath, nil, data)
+}
+
+// LoadModuleBytes implements BufferLoader.LoadModuleBytes
+func (r *emscriptenRuntime) LoadModuleBytes(name string, data []byte) (WasmModule, error) {
+	return r.load(name, data, data)
+}
+
+func (r *emscriptenRuntime) load(filePath string, source, data []byte) (WasmModule, error) {
+	loader, ok := r.runtime.(HostLoader)
+	binary, err := parseWasmBinary(data)
+	if !ok || err != nil || !isEmscripten(binary) {
+		if source != nil {
+			return (&bufferRuntime{runtime: r.runtime, data: source}).LoadModule(filePath)
+		}
+		return r.runtime.LoadModule(filePath)
+	}
+
+	h := newEmscriptenHost()
+	if r.output != nil {
+		h.wasi.output = r.output.write
+	}
+	host, err := h.link(moduleImports(data))
+	if err != nil {
+		return nil, &RuntimeError{Stage: StageInstantiate, Message: fmt.Sprintf("emscripten: %v", err)}
+	}
+	changed, err := defineImportedStorage(binary)
+	if err != nil {
+		return nil, &RuntimeError{Stage: StageLoad, Message: fmt.Sprintf("emscripten: %v", err)}
+	}
+	if changed {
+		source = binary.encode()
+	}
+	module, err := loader.LoadModuleWithHost(filePath, source, host)
+	if err != nil {
+		return nil, err
+	}
+	if memory, ok := module.(MemoryModule); ok {
+		h.memory.module = memory
+	}
+	if err := h.initialize(module); err != nil {
+		module.Close()
+		return nil, err
+	}
+	return module, nil
+}
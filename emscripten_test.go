@@ -0,0 +1,214 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mrhapile/WASM-Injection-Framework/internal/wasmbin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// emscriptenBinary is a plugin binary that also imports its memory and
+// table from env, as Emscripten's JS glue provides them
+func emscriptenBinary(t *testing.T, imports ...wasmFuncImport) []byte {
+	binary, err := parseWasmBinary(pluginBinary(imports...))
+	require.NoError(t, err)
+	section := binary.section(sectionImport)
+	memory := append(wasmbin.AppendName(wasmbin.AppendName(nil, emscriptenModule), "memory"), externMemory, 0x00, 0x02)
+	table := append(wasmbin.AppendName(wasmbin.AppendName(nil, emscriptenModule), "__indirect_function_table"), externTable, 0x70, 0x00, 0x01)
+	_, err = section.appendVectorEntry(memory)
+	require.NoError(t, err)
+	_, err = section.appendVectorEntry(table)
+	require.NoError(t, err)
+	return binary.encode()
+}
+
+// emscriptenImport is an env import with the signature of its shim
+func emscriptenImport(name string) wasmFuncImport {
+	return wasmFuncImport{Module: emscriptenModule, Name: name, Signature: newEmscriptenHost().functions()[name].signature}
+}
+
+// emscriptenMockRuntime links a contract module to the host functions it
+// is given and records the binary it was loaded from
+type emscriptenMockRuntime struct {
+	module *contractModule
+	data   []byte
+}
+
+func (r *emscriptenMockRuntime) LoadModule(filePath string) (WasmModule, error) {
+	return nil, errors.New("loaded without host functions")
+}
+
+func (r *emscriptenMockRuntime) LoadModuleWithHost(filePath string, data []byte, host []HostFunction) (WasmModule, error) {
+	r.data = data
+	for _, fn := range host {
+		r.module.host[fn.Name] = fn
+	}
+	return r.module, nil
+}
+
+// -----------------------------------------------------------------------------
+// TEST: Emscripten Shims
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Emscripten output expects its JS glue to create memory and tables, to
+// provide dozens of env functions and to run constructors before main.
+// Without a stand-in for that glue every such module fails to
+// instantiate, and none of its code is ever fuzzed.
+// -----------------------------------------------------------------------------
+
+func TestEmscripten_Detection(t *testing.T) {
+	detect := func(data []byte) bool {
+		binary, err := parseWasmBinary(data)
+		require.NoError(t, err)
+		return isEmscripten(binary)
+	}
+
+	assert.True(t, detect(pluginBinary(emscriptenImport("emscripten_resize_heap"))))
+	assert.True(t, detect(pluginBinary(wasmFuncImport{Module: emscriptenModule, Name: "__syscall_openat", Signature: funcSig("i32 i32 i32 i32", "i32")})))
+	assert.False(t, detect(pluginBinary(wasmFuncImport{Module: emscriptenModule, Name: "log", Signature: funcSig("i32", "")})))
+	assert.False(t, detect(pluginBinary(wasmFuncImport{Module: "host", Name: "emscripten_resize_heap", Signature: funcSig("i32", "i32")})), "only env imports are Emscripten's")
+}
+
+func TestEmscripten_DefinesImportedMemoryAndTable(t *testing.T) {
+	binary, err := parseWasmBinary(emscriptenBinary(t, emscriptenImport("abort")))
+	require.NoError(t, err)
+
+	changed, err := defineImportedStorage(binary)
+	require.NoError(t, err)
+	assert.True(t, changed)
+
+	rewritten, err := parseWasmBinary(binary.encode())
+	require.NoError(t, err)
+	counts, err := rewritten.importCounts()
+	require.NoError(t, err)
+	assert.Equal(t, map[byte]uint32{externFunc: 1}, counts)
+	assert.Equal(t, []byte{0x01, 0x00, 0x02}, rewritten.section(sectionMemory).Payload, "the memory keeps its limits")
+	assert.Equal(t, []byte{0x01, 0x70, 0x00, 0x01}, rewritten.section(sectionTable).Payload)
+
+	exports, err := rewritten.exportNames()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"run": true, defaultMemoryExport: true}, exports)
+	functions, err := rewritten.functionExports()
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1), functions["run"], "function indices are unchanged")
+
+	changed, err = defineImportedStorage(rewritten)
+	require.NoError(t, err)
+	assert.False(t, changed, "modules defining their storage are left alone")
+}
+
+func TestEmscripten_Shims(t *testing.T) {
+	imports := []wasmFuncImport{
+		emscriptenImport("emscripten_memcpy_big"),
+		emscriptenImport("__assert_fail"),
+		emscriptenImport("setTempRet0"),
+		emscriptenImport("getTempRet0"),
+		{Module: emscriptenModule, Name: "__syscall_openat", Signature: funcSig("i32 i32 i32 i32", "i32")},
+		{Module: emscriptenModule, Name: "invoke_vii", Signature: funcSig("i32 i32 i32", "")},
+		{Module: emscriptenModule, Name: "emscripten_console_log", Signature: funcSig("i32", "")},
+		{Module: wasiModule, Name: "fd_write", Signature: funcSig("i32 i32 i32 i32", "i32")},
+		{Module: wasiModule, Name: "fd_pread", Signature: funcSig("i32 i32 i32 i64 i32", "i32")},
+	}
+	h := newEmscriptenHost()
+	host, err := h.link(imports)
+	require.NoError(t, err)
+	require.Len(t, host, len(imports))
+
+	m := newContractModule(nil, nil)
+	for _, fn := range host {
+		m.host[fn.Name] = fn
+	}
+	h.memory.module = m
+
+	src := m.put("copied")
+	_, err = m.call("emscripten_memcpy_big", int32(16), src, int32(6))
+	require.NoError(t, err)
+	assert.Equal(t, "copied", string(m.memory[16:22]))
+
+	_, err = m.call("setTempRet0", int32(7))
+	require.NoError(t, err)
+	tempRet0, err := m.call("getTempRet0")
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), tempRet0)
+
+	errno, err := m.call("__syscall_openat", int32(0), int32(0), int32(0), int32(0))
+	require.NoError(t, err)
+	assert.Equal(t, int32(emscriptenENOSYS), int32(errno))
+	errno, err = m.call("fd_pread", int32(0), int32(0), int32(0), int64(0), int32(0))
+	require.NoError(t, err)
+	assert.Equal(t, int64(wasiENOSYS), errno)
+
+	_, err = m.call("emscripten_console_log", int32(0))
+	assert.NoError(t, err, "other env functions do nothing")
+	_, err = m.call("invoke_vii", int32(1), int32(2), int32(3))
+	assert.EqualError(t, err, "execute: execution failed: host function 'invoke_vii' failed: invoke_vii is not supported by the fuzzer")
+
+	condition, file, function := m.put("x > 0\x00"), m.put("main.c\x00"), m.put("check\x00")
+	_, err = m.call("__assert_fail", condition, file, int32(12), function)
+	assert.EqualError(t, err, "execute: execution failed: host function '__assert_fail' failed: Assertion failed: x > 0, at: main.c,12,check")
+}
+
+func TestEmscripten_RejectsMismatchedShims(t *testing.T) {
+	_, err := newEmscriptenHost().link([]wasmFuncImport{{Module: emscriptenModule, Name: "emscripten_resize_heap", Signature: funcSig("i64", "i32")}})
+	assert.EqualError(t, err, "host function 'emscripten_resize_heap' has signature (i32) -> (i32), but the module imports it as (i64) -> (i32)")
+}
+
+func TestEmscripten_PipelineRunsConstructors(t *testing.T) {
+	var calls []string
+	record := func(name string) contractExport {
+		return func(m *contractModule, args []interface{}) ([]interface{}, error) {
+			calls = append(calls, name)
+			return nil, nil
+		}
+	}
+	signatures := map[string]FuncSignature{
+		"process":               funcSig("i32", "i32"),
+		"__wasm_call_ctors":     funcSig("", ""),
+		"emscripten_stack_init": funcSig("", ""),
+	}
+	module := newContractModule(signatures, map[string]contractExport{
+		"__wasm_call_ctors":     record("__wasm_call_ctors"),
+		"emscripten_stack_init": record("emscripten_stack_init"),
+		"process": func(m *contractModule, args []interface{}) ([]interface{}, error) {
+			calls = append(calls, "process")
+			if args[0].(int32) == 0 {
+				_, err := m.call("_abort_js")
+				return nil, err
+			}
+			return []interface{}{args[0]}, nil
+		},
+	})
+	runtime := &emscriptenMockRuntime{module: module}
+
+	path := filepath.Join(t.TempDir(), "emscripten.wasm")
+	require.NoError(t, os.WriteFile(path, emscriptenBinary(t, emscriptenImport("_abort_js")), 0o644))
+	result := processWasmFileWithOptions(path, runtime, RunOptions{Invocation: InvocationConfig{Inputs: []InvocationInput{i32Input(5), i32Input(0)}}})
+
+	assert.Equal(t, []string{"emscripten_stack_init", "__wasm_call_ctors", "process", "process"}, calls)
+	require.Len(t, result.Invocations, 2)
+	assert.True(t, result.Invocations[0].Success)
+	assert.Equal(t, "execution failed: host function '_abort_js' failed: abort()", result.Invocations[1].ErrorMessage)
+
+	loaded, err := parseWasmBinary(runtime.data)
+	require.NoError(t, err)
+	counts, err := loaded.importCounts()
+	require.NoError(t, err)
+	assert.Zero(t, counts[externMemory], "the runtime is given the rewritten module")
+}
+
+func TestEmscripten_OtherModulesLoadUnchanged(t *testing.T) {
+	runtime := &emscriptenMockRuntime{module: newContractModule(nil, nil)}
+	path := filepath.Join(t.TempDir(), "plain.wasm")
+	require.NoError(t, os.WriteFile(path, pluginBinary(wasmFuncImport{Module: emscriptenModule, Name: "log", Signature: funcSig("i32", "")}), 0o644))
+
+	result := processWasmFileWithOptions(path, runtime, RunOptions{})
+	assert.Equal(t, "load failed: loaded without host functions", result.ErrorMessage)
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// EquivalenceReport compares two corpora that should behave the same, such
+// as one source built with -O0 and with -O3. Files pair up by name.
+type EquivalenceReport struct {
+	Left        string `json:"left"`
+	Right       string `json:"right"`
+	Environment string `json:"environment"`
+	// Compared counts the pairs run, and Equivalent those behaving the same
+	Compared   int `json:"compared"`
+	Equivalent int `json:"equivalent"`
+	// OnlyLeft and OnlyRight name the files without a counterpart
+	OnlyLeft    []string           `json:"only_left,omitempty"`
+	OnlyRight   []string           `json:"only_right,omitempty"`
+	Divergences []OutputDivergence `json:"divergences"`
+}
+
+// OutputDivergence lists how a pair of files behaved differently
+type OutputDivergence struct {
+	FileName    string   `json:"file_name"`
+	Differences []string `json:"differences"`
+}
+
+// equivalenceOptions returns the options both corpora run with. Coverage
+// instruments each build differently, and fuzzing draws inputs from each
+// module's own constants, so both are off and the configured inputs run.
+func equivalenceOptions(opts RunOptions) RunOptions {
+	opts.Coverage = CoverageConfig{}
+	opts.ArgFuzz, opts.Sequence, opts.Properties = ArgFuzzConfig{}, SequenceConfig{}, nil
+	return opts
+}
+
+// compareEquivalence runs every pair of files of two corpora with the same
+// inputs, reporting the pairs whose outputs diverge
+func compareEquivalence(left, right string, runtime WasmRuntime, env Environment, opts RunOptions, classifiers classifierChain) (EquivalenceReport, error) {
+	report := EquivalenceReport{Left: left, Right: right, Environment: env.describe(), Divergences: []OutputDivergence{}}
+	leftFiles, err := collectWasmFiles(left)
+	if err != nil {
+		return report, err
+	}
+	rightFiles, err := collectWasmFiles(right)
+	if err != nil {
+		return report, err
+	}
+	rightByName := make(map[string]string, len(rightFiles))
+	for _, path := range rightFiles {
+		rightByName[filepath.Base(path)] = path
+	}
+
+	run := func(path string) ExecutionResult {
+		result := processWasmFileWithOptions(path, runtime, opts)
+		result.Classification = classifiers.classify(result)
+		return result
+	}
+	for _, leftPath := range leftFiles {
+		name := filepath.Base(leftPath)
+		rightPath, ok := rightByName[name]
+		if !ok {
+			report.OnlyLeft = append(report.OnlyLeft, name)
+			continue
+		}
+		delete(rightByName, name)
+
+		report.Compared++
+		if differences := compareOutputs(run(leftPath), run(rightPath), opts.FloatComparison); len(differences) > 0 {
+			report.Divergences = append(report.Divergences, OutputDivergence{FileName: name, Differences: differences})
+		} else {
+			report.Equivalent++
+		}
+	}
+	for name := range rightByName {
+		report.OnlyRight = append(report.OnlyRight, name)
+	}
+	sort.Strings(report.OnlyRight)
+	return report, nil
+}
+
+// compareOutputs describes how the runs of two builds of a module differ:
+// in outcome, by classification signature so trap offsets do not count,
+// in the values each call returned, with floats compared by floats, and
+// in what they printed
+func compareOutputs(left, right ExecutionResult, floats FloatComparison) []string {
+	var differences []string
+	if l, r := outcomeSignature(left), outcomeSignature(right); l != r {
+		differences = append(differences, fmt.Sprintf("outcome %s, but %s", describeOutcome(left, l), describeOutcome(right, r)))
+	} else if left.Success && !floats.equal(left.TypedReturnValues, right.TypedReturnValues) {
+		differences = append(differences, fmt.Sprintf("returned %s, but %s", formatValues(left.TypedReturnValues), formatValues(right.TypedReturnValues)))
+	}
+
+	// Inputs run in order, so the calls of both runs pair up
+	for i := 0; i < len(left.Invocations) && i < len(right.Invocations); i++ {
+		l, r := left.Invocations[i], right.Invocations[i]
+		switch {
+		case l.Success != r.Success:
+			differences = append(differences, fmt.Sprintf("invocation %d: %s, but %s", i, describeInvocation(l), describeInvocation(r)))
+		case l.Success && !floats.equal(l.TypedReturnValues, r.TypedReturnValues):
+			differences = append(differences, fmt.Sprintf("invocation %d: returned %s, but %s", i, formatValues(l.TypedReturnValues), formatValues(r.TypedReturnValues)))
+		}
+	}
+
+	for _, stream := range []struct{ name, left, right string }{
+		{"stdout", left.Stdout, right.Stdout},
+		{"stderr", left.Stderr, right.Stderr},
+		{"log", left.Log, right.Log},
+	} {
+		if stream.left != stream.right {
+			differences = append(differences, fmt.Sprintf("%s differs: %q, but %q", stream.name, stream.left, stream.right))
+		}
+	}
+	return differences
+}
+
+func describeOutcome(result ExecutionResult, signature string) string {
+	if result.Success {
+		return "passed"
+	}
+	return signature
+}
+
+func describeInvocation(invocation InvocationResult) string {
+	if invocation.Success {
+		return "returned " + formatValues(invocation.TypedReturnValues)
+	}
+	return "trapped: " + invocation.ErrorMessage
+}
+
+// runEquivCommand runs the matching files of two corpora with the same
+// inputs, writing the pairs whose outputs diverge. It exits with 1 when
+// any pair diverges.
+func runEquivCommand(args []string) int {
+	flags := flag.NewFlagSet("equiv", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	configPath := flags.String("config", "", "YAML campaign config")
+
+	if err := flags.Parse(args); err != nil || flags.NArg() != 2 {
+		emitError(map[string]string{
+			"error": "usage: wasm-fuzzer equiv [--config file.yaml] <left-directory> <right-directory>",
+		})
+		return 1
+	}
+	config, err := resolveConfig(*configPath)
+	if err != nil {
+		emitError(map[string]string{
+			"error":   "config load failed",
+			"details": err.Error(),
+		})
+		return 1
+	}
+	envs, err := config.Matrix.Environments()
+	if err != nil {
+		emitError(map[string]string{
+			"error":   "invalid environment matrix",
+			"details": err.Error(),
+		})
+		return 1
+	}
+	classifiers, err := newClassifierChain(config.Classifiers)
+	if err != nil {
+		emitError(map[string]string{
+			"error":   "invalid classifiers",
+			"details": err.Error(),
+		})
+		return 1
+	}
+	if err := config.FloatComparison.check(); err != nil {
+		emitError(map[string]string{
+			"error":   "invalid float comparison",
+			"details": err.Error(),
+		})
+		return 1
+	}
+
+	// Both corpora run under the first environment of the matrix
+	runtime, err := newRuntime(envs[0])
+	if err != nil {
+		emitError(map[string]string{
+			"error":   "failed to create runtime",
+			"details": err.Error(),
+		})
+		return 1
+	}
+	defer closeRuntimes([]environmentRuntime{{Environment: envs[0], Runtime: runtime}})
+	report, err := compareEquivalence(flags.Arg(0), flags.Arg(1), runtime, envs[0], equivalenceOptions(config.runOptions()), classifiers)
+	if err != nil {
+		emitError(map[string]string{
+			"error":   "directory access failed",
+			"details": err.Error(),
+		})
+		return 1
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(report)
+	if len(report.Divergences) > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,111 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// -----------------------------------------------------------------------------
+// TEST: Output Equivalence
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Two builds of the same source must compute the same results. A pair of
+// modules that returns, traps or prints differently for the same inputs
+// points at a miscompilation in one of them.
+// -----------------------------------------------------------------------------
+
+func TestCompareEquivalence_ReportsDivergingPairs(t *testing.T) {
+	left, right := t.TempDir(), t.TempDir()
+	for _, name := range []string{"same.wasm", "returns.wasm", "traps.wasm", "left-only.wasm"} {
+		require.NoError(t, os.WriteFile(filepath.Join(left, name), []byte{0}, 0o644))
+	}
+	for _, name := range []string{"same.wasm", "returns.wasm", "traps.wasm", "right-only.wasm"} {
+		require.NoError(t, os.WriteFile(filepath.Join(right, name), []byte{0}, 0o644))
+	}
+
+	// The right build miscompiles returns.wasm and traps in traps.wasm at
+	// another offset than the left build, which is no divergence
+	runtime := &MockWasmRuntime{LoadModuleFunc: func(filePath string) (WasmModule, error) {
+		optimized := strings.HasPrefix(filePath, right)
+		return &MockWasmModule{ExecuteFunc: func(string, ...interface{}) ([]interface{}, error) {
+			switch filepath.Base(filePath) {
+			case "returns.wasm":
+				if optimized {
+					return []interface{}{int32(8)}, nil
+				}
+			case "traps.wasm":
+				if optimized {
+					return nil, errors.New("wasm trap: unreachable at offset 0x91")
+				}
+				return nil, errors.New("wasm trap: unreachable at offset 0x2a4")
+			}
+			return []interface{}{int32(7)}, nil
+		}}, nil
+	}}
+	chain, err := newClassifierChain(nil)
+	require.NoError(t, err)
+
+	report, err := compareEquivalence(left, right, runtime, Environment{}, RunOptions{}, chain)
+	require.NoError(t, err)
+	assert.Equal(t, 3, report.Compared)
+	assert.Equal(t, 2, report.Equivalent)
+	assert.Equal(t, []string{"left-only.wasm"}, report.OnlyLeft)
+	assert.Equal(t, []string{"right-only.wasm"}, report.OnlyRight)
+	assert.Equal(t, []OutputDivergence{{
+		FileName:    "returns.wasm",
+		Differences: []string{"returned [i32 7], but [i32 8]"},
+	}}, report.Divergences)
+}
+
+func TestCompareOutputs_DescribesEveryDifference(t *testing.T) {
+	left := ExecutionResult{
+		Success: true,
+		Stdout:  "ok\n",
+		Invocations: []InvocationResult{
+			{Success: true, TypedReturnValues: []WasmValue{{Type: "i32", Value: "1"}}},
+			{Success: true, TypedReturnValues: []WasmValue{{Type: "i32", Value: "2"}}},
+		},
+	}
+	right := ExecutionResult{
+		FailureStage: StageExecute,
+		ErrorMessage: "invocation 1: wasm trap: integer divide by zero",
+		Stdout:       "ok\nok\n",
+		Invocations: []InvocationResult{
+			{Success: true, TypedReturnValues: []WasmValue{{Type: "i32", Value: "3"}}},
+			{ErrorMessage: "wasm trap: integer divide by zero"},
+		},
+	}
+
+	assert.Equal(t, []string{
+		"outcome passed, but " + outcomeSignature(right),
+		"invocation 0: returned [i32 1], but [i32 3]",
+		"invocation 1: returned [i32 2], but trapped: wasm trap: integer divide by zero",
+		`stdout differs: "ok\n", but "ok\nok\n"`,
+	}, compareOutputs(left, right, FloatComparison{}))
+	assert.Empty(t, compareOutputs(left, left, FloatComparison{}))
+}
+
+func TestEquivalenceOptions_RunConfiguredInputsOnly(t *testing.T) {
+	opts := equivalenceOptions(RunOptions{
+		Coverage:   CoverageConfig{Enabled: true},
+		ArgFuzz:    ArgFuzzConfig{Iterations: 10},
+		Sequence:   SequenceConfig{Iterations: 10},
+		Properties: []PropertyConfig{{Deterministic: "process"}},
+		Invocation: InvocationConfig{Inputs: i32Inputs(1)},
+	})
+	assert.False(t, opts.Coverage.Enabled)
+	assert.Zero(t, opts.ArgFuzz.Iterations)
+	assert.Zero(t, opts.Sequence.Iterations)
+	assert.Empty(t, opts.Properties)
+	assert.Equal(t, i32Inputs(1), opts.Invocation.Inputs)
+}
@@ -0,0 +1,203 @@
+package main
+
+import "strings"
+
+// ErrorCode identifies the kind of a failure. Codes are stable across
+// releases, so automation can match on them instead of on messages.
+type ErrorCode string
+
+const (
+	ErrLoad          ErrorCode = "E_LOAD"
+	ErrLoadMagic     ErrorCode = "E_LOAD_MAGIC"
+	ErrLoadVersion   ErrorCode = "E_LOAD_VERSION"
+	ErrLoadTruncated ErrorCode = "E_LOAD_TRUNCATED"
+	ErrLoadMalformed ErrorCode = "E_LOAD_MALFORMED"
+	ErrLoadInjection ErrorCode = "E_LOAD_INJECTION"
+	ErrLoadTamper    ErrorCode = "E_LOAD_TAMPER"
+
+	ErrValidate             ErrorCode = "E_VALIDATE"
+	ErrValidateTypeMismatch ErrorCode = "E_VALIDATE_TYPE_MISMATCH"
+
+	ErrInstantiate          ErrorCode = "E_INSTANTIATE"
+	ErrInstantiateImport    ErrorCode = "E_INSTANTIATE_UNKNOWN_IMPORT"
+	ErrInstantiateLifecycle ErrorCode = "E_INSTANTIATE_LIFECYCLE"
+
+	ErrSignature         ErrorCode = "E_SIGNATURE"
+	ErrSignatureNoExport ErrorCode = "E_SIGNATURE_NO_EXPORT"
+
+	ErrExec                         ErrorCode = "E_EXEC"
+	ErrExecTrapOOB                  ErrorCode = "E_EXEC_TRAP_OOB"
+	ErrExecTrapTableOOB             ErrorCode = "E_EXEC_TRAP_TABLE_OOB"
+	ErrExecTrapIndirectCall         ErrorCode = "E_EXEC_TRAP_INDIRECT_CALL"
+	ErrExecTrapUndefinedElement     ErrorCode = "E_EXEC_TRAP_UNDEFINED_ELEMENT"
+	ErrExecTrapUninitializedElement ErrorCode = "E_EXEC_TRAP_UNINITIALIZED_ELEMENT"
+	ErrExecStackExhausted           ErrorCode = "E_EXEC_STACK_EXHAUSTED"
+	ErrExecTrapDivideByZero         ErrorCode = "E_EXEC_TRAP_DIV_ZERO"
+	ErrExecTrapIntegerOverflow      ErrorCode = "E_EXEC_TRAP_INT_OVERFLOW"
+	ErrExecTrapConversion           ErrorCode = "E_EXEC_TRAP_CONVERSION"
+	ErrExecTrapUnreachable          ErrorCode = "E_EXEC_TRAP_UNREACHABLE"
+
+	ErrTimeout     ErrorCode = "E_TIMEOUT"
+	ErrHostPanic   ErrorCode = "E_HOST_PANIC"
+	ErrWorkerDied  ErrorCode = "E_WORKER_DIED"
+	ErrCrash       ErrorCode = "E_CRASH"
+	ErrSanitizer   ErrorCode = "E_SANITIZER"
+	ErrUnknownCode ErrorCode = "E_UNKNOWN"
+
+	// The codes of errors the commands write to stderr
+	ErrUsage    ErrorCode = "E_USAGE"
+	ErrConfig   ErrorCode = "E_CONFIG"
+	ErrInput    ErrorCode = "E_INPUT"
+	ErrOutput   ErrorCode = "E_OUTPUT"
+	ErrRuntime  ErrorCode = "E_RUNTIME"
+	ErrCampaign ErrorCode = "E_CAMPAIGN"
+	ErrInternal ErrorCode = "E_INTERNAL"
+)
+
+// stageCodes are the codes of failures no more precise code fits
+var stageCodes = map[FailureStage]ErrorCode{
+	StageLoad:        ErrLoad,
+	StageValidate:    ErrValidate,
+	StageInstantiate: ErrInstantiate,
+	StageSignature:   ErrSignature,
+	StageExecute:     ErrExec,
+}
+
+// messageCodes are the codes of failures recognized by their message in
+// a stage, tried in order
+var messageCodes = []struct {
+	stage   FailureStage
+	message string
+	code    ErrorCode
+}{
+	{StageLoad, "data segment injection failed", ErrLoadInjection},
+	{StageLoad, "tampering failed", ErrLoadTamper},
+	{StageLoad, "magic header not detected", ErrLoadMagic},
+	{StageLoad, "unknown binary version", ErrLoadVersion},
+	{StageLoad, "unexpected end", ErrLoadTruncated},
+	{StageLoad, "malformed", ErrLoadMalformed},
+	{StageValidate, "type mismatch", ErrValidateTypeMismatch},
+	{StageInstantiate, "unknown import", ErrInstantiateImport},
+	{StageSignature, "not found in module exports", ErrSignatureNoExport},
+}
+
+// errorCode returns the code of a failed result, or "" for results that
+// did not fail
+func errorCode(result ExecutionResult) ErrorCode {
+	if result.Success || result.Skipped {
+		return ""
+	}
+	return failureCode(FailureInfo{
+		Stage:    result.FailureStage,
+		SubStage: result.FailureSubStage,
+		Message:  result.ErrorMessage,
+		Trap:     parseTrap(result.ErrorMessage),
+		Crash:    result.Crash,
+	})
+}
+
+// failureCode returns the code of a failure. How the host failed comes
+// before what the module did, and traps before the stage's messages.
+func failureCode(failure FailureInfo) ErrorCode {
+	for _, marker := range sanitizerMarkers {
+		if strings.Contains(failure.Message, marker) {
+			return ErrSanitizer
+		}
+	}
+	switch {
+	case failure.SubStage == SubStageSanitizer:
+		return ErrSanitizer
+	case failure.Crash != nil:
+		return ErrCrash
+	case failure.SubStage == SubStageHang:
+		return ErrTimeout
+	case strings.HasPrefix(failure.Message, "worker died"):
+		return ErrWorkerDied
+	case isHostPanic(ExecutionResult{ErrorMessage: failure.Message}):
+		return ErrHostPanic
+	case failure.SubStage == SubStageLifecycle:
+		return ErrInstantiateLifecycle
+	}
+	if failure.Trap != "" {
+		for _, known := range trapSeverities {
+			if known.trap == failure.Trap {
+				return known.code
+			}
+		}
+	}
+	lower := strings.ToLower(normalizeMessage(failure.Message))
+	for _, known := range messageCodes {
+		if known.stage == failure.Stage && strings.Contains(lower, known.message) {
+			return known.code
+		}
+	}
+	if code, ok := stageCodes[failure.Stage]; ok {
+		return code
+	}
+	return ErrUnknownCode
+}
+
+// assignErrorCodes sets the codes of a result and of its failed
+// invocations
+func assignErrorCodes(result *ExecutionResult) {
+	result.ErrorCode = errorCode(*result)
+	for i := range result.Invocations {
+		invocation := &result.Invocations[i]
+		if invocation.Success || invocation.ErrorMessage == "" {
+			continue
+		}
+		invocation.ErrorCode = failureCode(FailureInfo{Stage: StageExecute, Message: invocation.ErrorMessage, Trap: parseTrap(invocation.ErrorMessage)})
+	}
+}
+
+// commandErrorCodes are the codes of the errors commands write to stderr.
+// Usage errors are recognized by their "usage:" prefix.
+var commandErrorCodes = map[string]ErrorCode{
+	"unknown command":                    ErrUsage,
+	"invalid threshold":                  ErrUsage,
+	"invalid memory limits":              ErrUsage,
+	"invalid versions":                   ErrUsage,
+	"invalid result filter":              ErrUsage,
+	"config load failed":                 ErrConfig,
+	"invalid environment matrix":         ErrConfig,
+	"invalid classifiers":                ErrConfig,
+	"invalid redaction":                  ErrConfig,
+	"invalid float comparison":           ErrConfig,
+	"directory access failed":            ErrInput,
+	"path is not a directory":            ErrInput,
+	"module access failed":               ErrInput,
+	"report access failed":               ErrInput,
+	"report load failed":                 ErrInput,
+	"module decode failed":               ErrInput,
+	"failed to encode JSON output":       ErrOutput,
+	"failed to write report":             ErrOutput,
+	"failed to encode config":            ErrOutput,
+	"failed to write import graph":       ErrOutput,
+	"failed to write dictionary":         ErrOutput,
+	"failed to create output directory":  ErrOutput,
+	"failed to copy corpus file":         ErrOutput,
+	"failed to write test":               ErrOutput,
+	"failed to create runtime":           ErrRuntime,
+	"failed to attach AFL shared memory": ErrRuntime,
+	"failed to pin CPU":                  ErrRuntime,
+	"unstable CPU frequency":             ErrRuntime,
+	"forkserver failed":                  ErrRuntime,
+	"fuzzer execution failed":            ErrCampaign,
+	"campaign plan failed":               ErrCampaign,
+	"sweep failed":                       ErrCampaign,
+	"report merge failed":                ErrCampaign,
+	"bisection failed":                   ErrCampaign,
+	"redaction failed":                   ErrCampaign,
+	"selftest failed":                    ErrCampaign,
+}
+
+// commandErrorCode returns the code of an error a command writes
+func commandErrorCode(message string) ErrorCode {
+	if strings.HasPrefix(message, "usage:") {
+		return ErrUsage
+	}
+	if code, ok := commandErrorCodes[message]; ok {
+		return code
+	}
+	return ErrInternal
+}
@@ -0,0 +1,96 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// -----------------------------------------------------------------------------
+// TEST: Error Codes
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Automation consuming reports should not have to match on messages,
+// whose wording changes between runtime versions. Every failure must carry
+// a stable code, as precise as what is known about it, and so must the
+// errors the commands write to stderr.
+// -----------------------------------------------------------------------------
+
+func TestErrorCodes_CodeFailures(t *testing.T) {
+	for _, tc := range []struct {
+		result ExecutionResult
+		code   ErrorCode
+	}{
+		{ExecutionResult{FailureStage: StageLoad, ErrorMessage: "load failed: magic header not detected"}, ErrLoadMagic},
+		{ExecutionResult{FailureStage: StageLoad, ErrorMessage: "tampering failed: no global 3"}, ErrLoadTamper},
+		{ExecutionResult{FailureStage: StageLoad, ErrorMessage: "load failed: something new"}, ErrLoad},
+		{ExecutionResult{FailureStage: StageValidate, ErrorMessage: "validation failed: type mismatch"}, ErrValidateTypeMismatch},
+		{ExecutionResult{FailureStage: StageInstantiate, ErrorMessage: "unknown import: env.abort"}, ErrInstantiateImport},
+		{ExecutionResult{FailureStage: StageExecute, ErrorMessage: "execution failed: out of bounds memory access"}, ErrExecTrapOOB},
+		{ExecutionResult{FailureStage: StageExecute, ErrorMessage: "execution failed: unreachable"}, ErrExecTrapUnreachable},
+		{ExecutionResult{FailureStage: StageExecute, FailureSubStage: SubStageHang, ErrorMessage: "no progress for 1s in the execute stage, worker killed"}, ErrTimeout},
+		{ExecutionResult{FailureStage: StageExecute, ErrorMessage: "panic recovered: nil map"}, ErrHostPanic},
+		{ExecutionResult{FailureStage: StageExecute, ErrorMessage: "worker died in the execute stage: signal: killed"}, ErrWorkerDied},
+		{ExecutionResult{FailureStage: StageExecute, ErrorMessage: "worker died", Crash: &CrashInfo{Signal: "SIGSEGV"}}, ErrCrash},
+		{ExecutionResult{Success: true}, ""},
+		{ExecutionResult{Skipped: true}, ""},
+	} {
+		assert.Equal(t, tc.code, errorCode(tc.result), tc.result.ErrorMessage)
+	}
+}
+
+func TestErrorCodes_CampaignResultsCarryCodes(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bad.wasm"), []byte("bad"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "good.wasm"), []byte("good"), 0o644))
+
+	runtime := &MockWasmRuntime{
+		LoadModuleFunc: func(filePath string) (WasmModule, error) {
+			if filepath.Base(filePath) == "bad.wasm" {
+				return nil, &RuntimeError{Stage: StageLoad, Message: "magic header not detected"}
+			}
+			return &MockWasmModule{}, nil
+		},
+	}
+	report, err := runFuzzerWithRuntime(dir, runtime)
+	require.NoError(t, err)
+	require.Len(t, report.Results, 2)
+	assert.Equal(t, ErrLoadMagic, report.Results[0].ErrorCode)
+	assert.Empty(t, report.Results[1].ErrorCode)
+}
+
+func TestErrorCodes_CommandErrorsCarryCodes(t *testing.T) {
+	assert.Equal(t, ErrUsage, commandErrorCode("usage: wasm-fuzzer stats <directory>"))
+	assert.Equal(t, ErrConfig, commandErrorCode("config load failed"))
+	assert.Equal(t, ErrInternal, commandErrorCode("something unexpected"))
+
+	stderr := os.Stderr
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	os.Stderr = w
+	emitError(map[string]string{"error": "directory access failed", "details": "no such file"})
+	emitError(map[string]string{"warning": "campaign aborted"})
+	os.Stderr = stderr
+	require.NoError(t, w.Close())
+	out, err := io.ReadAll(r)
+	require.NoError(t, err)
+
+	lines := bytes.Split(bytes.TrimSpace(out), []byte("\n"))
+	require.Len(t, lines, 2)
+	var fields map[string]string
+	require.NoError(t, json.Unmarshal(lines[0], &fields))
+	assert.Equal(t, "E_INPUT", fields["code"])
+	var warning map[string]string
+	require.NoError(t, json.Unmarshal(lines[1], &warning))
+	assert.NotContains(t, warning, "code")
+}
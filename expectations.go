@@ -0,0 +1,190 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// expectationsFile is the optional file of a corpus declaring the outcome
+// of its files, which turns the corpus into a regression suite
+const expectationsFile = "expectations.yaml"
+
+// Outcomes a file can be expected to have, besides "<stage>-fail" for a
+// failure in a stage, such as "validate-fail"
+const (
+	OutcomePass = "pass"
+	OutcomeTrap = "trap"
+)
+
+// Expectation is the outcome expected of the corpus files it matches
+type Expectation struct {
+	// File is a file name, or a pattern matching file names. The first
+	// expectation matching a file applies to it.
+	File string `yaml:"file"`
+	// Outcome is pass, trap, or a stage followed by "-fail". Traps are
+	// execute failures, so execute-fail accepts them too.
+	Outcome string `yaml:"outcome"`
+	// Message must be part of the failure's message when set
+	Message string `yaml:"message"`
+	// Code must be the failure's error code when set
+	Code ErrorCode `yaml:"code"`
+}
+
+// describe writes the expectation the way failures report it
+func (e Expectation) describe() string {
+	description := e.Outcome
+	if e.Code != "" {
+		description += " " + string(e.Code)
+	}
+	if e.Message != "" {
+		description += fmt.Sprintf(" with message %q", e.Message)
+	}
+	return description
+}
+
+// ExpectationFailure is a result that did not have its expected outcome
+type ExpectationFailure struct {
+	FilePath    string `json:"file_path"`
+	Environment string `json:"environment,omitempty"`
+	Expected    string `json:"expected"`
+	Actual      string `json:"actual"`
+}
+
+// ExpectationSummary reports how the results of a corpus with an
+// expectations file compared to it
+type ExpectationSummary struct {
+	// Checked counts the results an expectation applied to, and Met the
+	// ones that had the expected outcome
+	Checked  int                  `json:"checked"`
+	Met      int                  `json:"met"`
+	Failures []ExpectationFailure `json:"failures,omitempty"`
+}
+
+// expectations are the expectations of a corpus, nil when it has none
+type expectations []Expectation
+
+// loadExpectations reads the expectations file of a corpus, if
+// there is one
+func loadExpectations(dirPath string) (expectations, error) {
+	dir, err := corpusDir(dirPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %w", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, expectationsFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read expectations: %w", err)
+	}
+
+	var declared expectations
+	if err := yaml.Unmarshal(data, &declared); err != nil {
+		return nil, fmt.Errorf("invalid expectations: %w", err)
+	}
+	for i, e := range declared {
+		if e.File == "" {
+			return nil, fmt.Errorf("expectation %d: no file", i+1)
+		}
+		if _, err := filepath.Match(e.File, ""); err != nil {
+			return nil, fmt.Errorf("expectation %d: invalid pattern %q: %w", i+1, e.File, err)
+		}
+		if !validOutcome(e.Outcome) {
+			return nil, fmt.Errorf("expectation %d: unknown outcome %q (expected pass, trap or <stage>-fail)", i+1, e.Outcome)
+		}
+		if e.Outcome == OutcomePass && (e.Message != "" || e.Code != "") {
+			return nil, fmt.Errorf("expectation %d: a pass has no message or code", i+1)
+		}
+	}
+	if declared == nil {
+		declared = expectations{}
+	}
+	return declared, nil
+}
+
+// validOutcome reports whether an expectation's outcome is known
+func validOutcome(outcome string) bool {
+	if outcome == OutcomePass || outcome == OutcomeTrap {
+		return true
+	}
+	stage, ok := strings.CutSuffix(outcome, "-fail")
+	if !ok {
+		return false
+	}
+	_, known := stageCodes[FailureStage(stage)]
+	return known
+}
+
+// find returns the expectation of a file
+func (e expectations) find(filePath string) (Expectation, bool) {
+	name := filepath.Base(filePath)
+	for _, expectation := range e {
+		if matched, _ := filepath.Match(expectation.File, name); matched {
+			return expectation, true
+		}
+	}
+	return Expectation{}, false
+}
+
+// resultOutcome describes the outcome of a result the way expectations
+// declare it
+func resultOutcome(result ExecutionResult) string {
+	switch {
+	case result.Success:
+		return OutcomePass
+	case result.FailureStage == StageExecute && parseTrap(result.ErrorMessage) != "":
+		return OutcomeTrap
+	default:
+		return string(result.FailureStage) + "-fail"
+	}
+}
+
+// meets reports whether a result has the expected outcome
+func (e Expectation) meets(result ExecutionResult) bool {
+	outcome := resultOutcome(result)
+	if outcome != e.Outcome && !(e.Outcome == "execute-fail" && outcome == OutcomeTrap) {
+		return false
+	}
+	if e.Code != "" && result.ErrorCode != e.Code {
+		return false
+	}
+	return strings.Contains(result.ErrorMessage, e.Message)
+}
+
+// check compares the results run to the expectations. Skipped results are
+// not checked, as they have no outcome.
+func (e expectations) check(results []ExecutionResult) *ExpectationSummary {
+	if e == nil {
+		return nil
+	}
+	summary := &ExpectationSummary{}
+	for _, result := range results {
+		expectation, ok := e.find(result.FilePath)
+		if !ok || result.Skipped {
+			continue
+		}
+		summary.Checked++
+		if expectation.meets(result) {
+			summary.Met++
+			continue
+		}
+		actual := resultOutcome(result)
+		if result.ErrorCode != "" {
+			actual += " " + string(result.ErrorCode)
+		}
+		if result.ErrorMessage != "" {
+			actual += fmt.Sprintf(" with message %q", result.ErrorMessage)
+		}
+		summary.Failures = append(summary.Failures, ExpectationFailure{
+			FilePath:    result.FilePath,
+			Environment: result.Environment,
+			Expected:    expectation.describe(),
+			Actual:      actual,
+		})
+	}
+	return summary
+}
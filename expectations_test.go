@@ -0,0 +1,115 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// expectationCorpus writes a corpus of the given files and expectations
+func expectationCorpus(t *testing.T, expectations string, files ...string) string {
+	dir := t.TempDir()
+	for _, name := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(name), 0o644))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, expectationsFile), []byte(expectations), 0o644))
+	return dir
+}
+
+// -----------------------------------------------------------------------------
+// TEST: Corpus Expectations
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// An expectations file turns a corpus into a regression suite. A file
+// whose outcome changes must be reported, and fail the campaign, even
+// when it still passes or fails overall.
+// -----------------------------------------------------------------------------
+
+func TestExpectations_ReportsMismatches(t *testing.T) {
+	dir := expectationCorpus(t, `
+- file: ok.wasm
+  outcome: pass
+- file: trap_*.wasm
+  outcome: trap
+  message: unreachable
+- file: bad.wasm
+  outcome: validate-fail
+  code: E_VALIDATE
+- file: slow.wasm
+  outcome: execute-fail
+`, "ok.wasm", "trap_1.wasm", "trap_2.wasm", "bad.wasm", "slow.wasm", "other.wasm")
+
+	runtime := &MockWasmRuntime{LoadModuleFunc: func(filePath string) (WasmModule, error) {
+		switch filepath.Base(filePath) {
+		case "trap_1.wasm":
+			return &MockWasmModule{ExecuteFunc: func(string, ...interface{}) ([]interface{}, error) {
+				return nil, errors.New("unreachable instruction executed")
+			}}, nil
+		case "trap_2.wasm":
+			return &MockWasmModule{ExecuteFunc: func(string, ...interface{}) ([]interface{}, error) {
+				return nil, errors.New("integer divide by zero")
+			}}, nil
+		case "bad.wasm":
+			return nil, &RuntimeError{Stage: StageLoad, Message: "magic header not detected"}
+		case "slow.wasm":
+			return &MockWasmModule{ExecuteFunc: func(string, ...interface{}) ([]interface{}, error) {
+				return nil, errors.New("out of bounds memory access")
+			}}, nil
+		}
+		return &MockWasmModule{}, nil
+	}}
+	report, err := runFuzzerWithRuntime(dir, runtime)
+	require.NoError(t, err)
+
+	require.NotNil(t, report.Expectations)
+	assert.Equal(t, 5, report.Expectations.Checked, "other.wasm has no expectation")
+	assert.Equal(t, 3, report.Expectations.Met, "traps are execute failures")
+	require.Len(t, report.Expectations.Failures, 2)
+	assert.Equal(t, ExpectationFailure{
+		FilePath: filepath.Join(dir, "bad.wasm"),
+		Expected: "validate-fail E_VALIDATE",
+		Actual:   `load-fail E_LOAD_MAGIC with message "magic header not detected"`,
+	}, report.Expectations.Failures[0])
+	assert.Equal(t, filepath.Join(dir, "trap_2.wasm"), report.Expectations.Failures[1].FilePath)
+	assert.Equal(t, `trap with message "unreachable"`, report.Expectations.Failures[1].Expected)
+	assert.Empty(t, validateReport(report))
+}
+
+func TestExpectations_AreOptional(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.wasm"), []byte("a"), 0o644))
+	report, err := runFuzzerWithRuntime(dir, &MockWasmRuntime{})
+	require.NoError(t, err)
+	assert.Nil(t, report.Expectations)
+
+	// Truncated pipelines cannot reach the outcomes of later stages
+	dir = expectationCorpus(t, "- {file: a.wasm, outcome: trap}\n", "a.wasm")
+	report, err = runFuzzerWithMatrix(dir, []environmentRuntime{{Runtime: &MockWasmRuntime{}}}, RunOptions{StopAfter: StageValidate})
+	require.NoError(t, err)
+	assert.Nil(t, report.Expectations)
+}
+
+func TestExpectations_RejectsInvalidFiles(t *testing.T) {
+	for name, content := range map[string]string{
+		"no file":         "- outcome: pass\n",
+		"unknown outcome": "- {file: a.wasm, outcome: crash}\n",
+		"unknown stage":   "- {file: a.wasm, outcome: link-fail}\n",
+		"pass message":    "- {file: a.wasm, outcome: pass, message: x}\n",
+		"bad pattern":     "- {file: '[', outcome: pass}\n",
+		"not a list":      "a.wasm: pass\n",
+	} {
+		dir := expectationCorpus(t, content, "a.wasm")
+		_, err := runFuzzerWithRuntime(dir, &MockWasmRuntime{})
+		assert.Error(t, err, name)
+		_, err = planDryRun(dir, Config{}, RunOptions{})
+		assert.Error(t, err, name)
+	}
+}
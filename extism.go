@@ -0,0 +1,420 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+)
+
+// ABIExtism calls entries as Extism plugin functions
+const ABIExtism = "extism"
+
+// Import modules of Extism plugins
+const (
+	// extismEnvModule provides the Extism kernel to plugins built with
+	// Extism 1.0 or later
+	extismEnvModule = "extism:host/env"
+	// extismUserModule holds the host functions an application defines
+	extismUserModule = "extism:host/user"
+	// extismLegacyModule provides the kernel to older plugins, with every
+	// function name prefixed by extismLegacyPrefix
+	extismLegacyModule = "env"
+	extismLegacyPrefix = "extism_"
+)
+
+// extismMemoryLimit caps the kernel memory a plugin can allocate per call
+const extismMemoryLimit = 64 << 20
+
+// extismLogDisabled is the log level reported when no logger is set up,
+// telling plugins to skip formatting log messages
+const extismLogDisabled = math.MaxInt32
+
+// ExtismConfig configures the host Extism plugins run against
+type ExtismConfig struct {
+	// Config is the plugin configuration, read by plugins with config_get
+	Config map[string]string `yaml:"config"`
+	// FailOnError reports calls that return a non-zero status as failures
+	// with the error the plugin set; by default only traps are failures
+	FailOnError bool `yaml:"fail_on_error"`
+}
+
+// extismHost tracks the kernel of the plugin instance currently loaded
+type extismHost struct {
+	config ExtismConfig
+	kernel *extismKernel
+}
+
+// rewind restores the plugin variables of the post-setup state, which a
+// module snapshot cannot capture since they live in the host
+func (h *extismHost) rewind() {
+	if h != nil && h.kernel != nil {
+		h.kernel.rewind()
+	}
+}
+
+// extismKernel implements the Extism kernel in Go: a block allocator over
+// its own memory, which plugins access by offset through host calls, plus
+// the input, output, error, configuration and variables of a call. Offset
+// 0 is never allocated, so it means null.
+type extismKernel struct {
+	memory []byte
+	// blocks maps the offset of every live block to its length
+	blocks map[uint64]uint64
+
+	input, inputLength   uint64
+	output, outputLength uint64
+	err                  uint64
+
+	config map[string]string
+	vars   map[string][]byte
+	// baseline holds the variables as they were before the first call
+	baseline map[string][]byte
+}
+
+func newExtismKernel(config map[string]string) *extismKernel {
+	return &extismKernel{
+		memory: make([]byte, 1),
+		blocks: make(map[uint64]uint64),
+		config: config,
+		vars:   make(map[string][]byte),
+	}
+}
+
+// begin releases the previous call's blocks and writes the input of a new
+// call. Variables persist across calls, as they do in Extism.
+func (k *extismKernel) begin(input []byte) error {
+	if k.baseline == nil {
+		k.baseline = copyVars(k.vars)
+	}
+	k.memory = k.memory[:1]
+	k.blocks = make(map[uint64]uint64)
+	k.output, k.outputLength, k.err = 0, 0, 0
+
+	k.input, k.inputLength = k.store(input), uint64(len(input))
+	if k.input == 0 && len(input) > 0 {
+		return fmt.Errorf("input of %d bytes exceeds the %d-byte kernel memory", len(input), extismMemoryLimit)
+	}
+	return nil
+}
+
+// rewind restores the variables as they were before the first call
+func (k *extismKernel) rewind() {
+	if k.baseline != nil {
+		k.vars = copyVars(k.baseline)
+	}
+}
+
+func copyVars(vars map[string][]byte) map[string][]byte {
+	copied := make(map[string][]byte, len(vars))
+	for name, value := range vars {
+		copied[name] = value
+	}
+	return copied
+}
+
+// alloc reserves a zeroed block, returning 0 for empty blocks or when the
+// memory limit is reached
+func (k *extismKernel) alloc(length uint64) uint64 {
+	if length == 0 || length > uint64(extismMemoryLimit-len(k.memory)) {
+		return 0
+	}
+	offset := uint64(len(k.memory))
+	k.memory = append(k.memory, make([]byte, length)...)
+	k.blocks[offset] = length
+	return offset
+}
+
+// store copies data into a new block
+func (k *extismKernel) store(data []byte) uint64 {
+	offset := k.alloc(uint64(len(data)))
+	if offset != 0 {
+		copy(k.memory[offset:], data)
+	}
+	return offset
+}
+
+// block returns the contents of the block at offset, which are empty for
+// offsets that are not the start of a live block
+func (k *extismKernel) block(offset uint64) []byte {
+	length, ok := k.blocks[offset]
+	if !ok {
+		return nil
+	}
+	return k.memory[offset : offset+length]
+}
+
+// bytes returns n bytes of kernel memory at offset. Like the kernel's own
+// memory, accesses are only checked against the end of memory, not
+// against block boundaries.
+func (k *extismKernel) bytes(offset, n uint64) ([]byte, error) {
+	if offset > uint64(len(k.memory)) || n > uint64(len(k.memory))-offset {
+		return nil, fmt.Errorf("%d-byte access at 0x%x is out of bounds", n, offset)
+	}
+	return k.memory[offset : offset+n], nil
+}
+
+// errorMessage returns the error the plugin set during the last call
+func (k *extismKernel) errorMessage() string {
+	if k.err == 0 {
+		return "no error set"
+	}
+	return string(k.block(k.err))
+}
+
+// functions returns the kernel's host functions by name
+func (k *extismKernel) functions() map[string]nativeFunction {
+	i32 := func(v uint64) []interface{} { return []interface{}{int32(v)} }
+	i64 := func(v uint64) []interface{} { return []interface{}{int64(v)} }
+	load := func(offset, n uint64) (uint64, error) {
+		data, err := k.bytes(offset, n)
+		if err != nil {
+			return 0, err
+		}
+		if n == 1 {
+			return uint64(data[0]), nil
+		}
+		return binary.LittleEndian.Uint64(data), nil
+	}
+	discard := func(args []uint64) ([]interface{}, error) {
+		return nil, nil
+	}
+
+	functions := map[string]nativeFunction{
+		"alloc": {funcSig("i64", "i64"), func(args []uint64) ([]interface{}, error) {
+			return i64(k.alloc(args[0])), nil
+		}},
+		"free": {funcSig("i64", ""), func(args []uint64) ([]interface{}, error) {
+			delete(k.blocks, args[0])
+			return nil, nil
+		}},
+		"length": {funcSig("i64", "i64"), func(args []uint64) ([]interface{}, error) {
+			return i64(k.blocks[args[0]]), nil
+		}},
+		"load_u8": {funcSig("i64", "i32"), func(args []uint64) ([]interface{}, error) {
+			v, err := load(args[0], 1)
+			return i32(v), err
+		}},
+		"load_u64": {funcSig("i64", "i64"), func(args []uint64) ([]interface{}, error) {
+			v, err := load(args[0], 8)
+			return i64(v), err
+		}},
+		"store_u8": {funcSig("i64 i32", ""), func(args []uint64) ([]interface{}, error) {
+			data, err := k.bytes(args[0], 1)
+			if err == nil {
+				data[0] = byte(args[1])
+			}
+			return nil, err
+		}},
+		"store_u64": {funcSig("i64 i64", ""), func(args []uint64) ([]interface{}, error) {
+			data, err := k.bytes(args[0], 8)
+			if err == nil {
+				binary.LittleEndian.PutUint64(data, args[1])
+			}
+			return nil, err
+		}},
+		"input_length": {funcSig("", "i64"), func(args []uint64) ([]interface{}, error) {
+			return i64(k.inputLength), nil
+		}},
+		"input_offset": {funcSig("", "i64"), func(args []uint64) ([]interface{}, error) {
+			return i64(k.input), nil
+		}},
+		"input_load_u8": {funcSig("i64", "i32"), func(args []uint64) ([]interface{}, error) {
+			v, err := load(k.input+args[0], 1)
+			return i32(v), err
+		}},
+		"input_load_u64": {funcSig("i64", "i64"), func(args []uint64) ([]interface{}, error) {
+			v, err := load(k.input+args[0], 8)
+			return i64(v), err
+		}},
+		"output_set": {funcSig("i64 i64", ""), func(args []uint64) ([]interface{}, error) {
+			k.output, k.outputLength = args[0], args[1]
+			return nil, nil
+		}},
+		"error_set": {funcSig("i64", ""), func(args []uint64) ([]interface{}, error) {
+			k.err = args[0]
+			return nil, nil
+		}},
+		"config_get": {funcSig("i64", "i64"), func(args []uint64) ([]interface{}, error) {
+			value, ok := k.config[string(k.block(args[0]))]
+			if !ok {
+				return i64(0), nil
+			}
+			return i64(k.store([]byte(value))), nil
+		}},
+		"var_get": {funcSig("i64", "i64"), func(args []uint64) ([]interface{}, error) {
+			return i64(k.store(k.vars[string(k.block(args[0]))])), nil
+		}},
+		"var_set": {funcSig("i64 i64", ""), func(args []uint64) ([]interface{}, error) {
+			name := string(k.block(args[0]))
+			if args[1] == 0 {
+				delete(k.vars, name)
+			} else {
+				k.vars[name] = append([]byte(nil), k.block(args[1])...)
+			}
+			return nil, nil
+		}},
+		"http_request": {funcSig("i64 i64", "i64"), func(args []uint64) ([]interface{}, error) {
+			// Extism denies requests to hosts that are not allowed
+			// explicitly, and the fuzzer allows none
+			return nil, errors.New("HTTP requests are not allowed")
+		}},
+		"http_status_code": {funcSig("", "i32"), func(args []uint64) ([]interface{}, error) {
+			return i32(0), nil
+		}},
+		"http_headers": {funcSig("", "i64"), func(args []uint64) ([]interface{}, error) {
+			return i64(0), nil
+		}},
+		"get_log_level": {funcSig("", "i32"), func(args []uint64) ([]interface{}, error) {
+			return i32(extismLogDisabled), nil
+		}},
+		"log_trace": {funcSig("i64", ""), discard},
+		"log_debug": {funcSig("i64", ""), discard},
+		"log_info":  {funcSig("i64", ""), discard},
+		"log_warn":  {funcSig("i64", ""), discard},
+		"log_error": {funcSig("i64", ""), discard},
+	}
+	functions["length_unsafe"] = functions["length"]
+	return functions
+}
+
+// link resolves a plugin's imports: kernel imports to the kernel's
+// functions, and user host functions to stubs returning zero values.
+// Other imports are left for the runtime to report.
+func (k *extismKernel) link(imports []wasmFuncImport) ([]HostFunction, error) {
+	kernel := k.functions()
+	var host []HostFunction
+	for _, imp := range imports {
+		name := imp.Name
+		switch {
+		case imp.Module == extismEnvModule:
+		case imp.Module == extismLegacyModule && strings.HasPrefix(name, extismLegacyPrefix):
+			name = strings.TrimPrefix(name, extismLegacyPrefix)
+		case imp.Module == extismUserModule:
+			results, err := zeroResults(imp.Signature)
+			if err != nil {
+				return nil, fmt.Errorf("user host function '%s': %v", imp.Name, err)
+			}
+			host = append(host, stubFunction(imp, results))
+			continue
+		default:
+			continue
+		}
+
+		fn, ok := kernel[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown kernel function '%s'", imp.Name)
+		}
+		if fn.signature.String() != imp.Signature.String() {
+			return nil, fmt.Errorf("kernel function '%s' has signature %s, but the plugin imports it as %s", imp.Name, fn.signature, imp.Signature)
+		}
+		bound, _ := fn.bind(imp)
+		host = append(host, bound)
+	}
+	return host, nil
+}
+
+// extismRuntime loads plugins with a fresh kernel linked to their imports.
+// The wrapped runtime must implement HostLoader.
+type extismRuntime struct {
+	runtime WasmRuntime
+	host    *extismHost
+}
+
+// LoadModule implements WasmRuntime.LoadModule
+func (r *extismRuntime) LoadModule(filePath string) (WasmModule, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, &RuntimeError{Stage: StageLoad, Message: fmt.Sprintf("load failed: %v", err)}
+	}
+	return r.load(filePath, nil, data)
+}
+
+// LoadModuleBytes implements BufferLoader.LoadModuleBytes
+func (r *extismRuntime) LoadModuleBytes(name string, data []byte) (WasmModule, error) {
+	return r.load(name, data, data)
+}
+
+// load links a new kernel to the imports found in data
+func (r *extismRuntime) load(filePath string, source, data []byte) (WasmModule, error) {
+	loader, ok := r.runtime.(HostLoader)
+	if !ok {
+		return nil, &RuntimeError{Stage: StageInstantiate, Message: "extism: runtime cannot provide host functions"}
+	}
+
+	kernel := newExtismKernel(r.host.config.Config)
+	host, err := kernel.link(moduleImports(data))
+	if err != nil {
+		return nil, &RuntimeError{Stage: StageInstantiate, Message: fmt.Sprintf("extism: %v", err)}
+	}
+
+	module, err := loader.LoadModuleWithHost(filePath, source, host)
+	if err == nil {
+		r.host.kernel = kernel
+	}
+	return module, err
+}
+
+// extismArguments binds every input to the input of an Extism plugin
+// call. Plugin functions take no parameters and return an i32 status.
+func (c InvocationConfig) extismArguments(signature *FuncSignature) ([][]interface{}, error) {
+	if signature != nil && (len(signature.Params) != 0 || len(signature.Results) != 1 || signature.Results[0] != "i32") {
+		return nil, &RuntimeError{
+			Stage:   StageSignature,
+			Message: fmt.Sprintf("signature mismatch: Extism function '%s' must have signature () -> (i32), not %s", c.Entry, signature),
+		}
+	}
+
+	calls := make([][]interface{}, len(c.Inputs))
+	for i, input := range c.Inputs {
+		arg, err := pluginInput(input, "Extism plugins")
+		if err != nil {
+			return nil, &RuntimeError{Stage: StageSignature, Message: fmt.Sprintf("input %d: %v", i, err)}
+		}
+		calls[i] = []interface{}{arg}
+	}
+	return calls, nil
+}
+
+// pluginInput decodes the single string, bytes or file input of a plugin
+// call. A plain scalar is passed as text, and no value as empty text.
+func pluginInput(input InvocationInput, plugins string) (bufferArg, error) {
+	value := WasmValue{Type: "string"}
+	switch {
+	case len(input) > 1:
+		return bufferArg{}, fmt.Errorf("%s take a single input, %d values given", plugins, len(input))
+	case len(input) == 1 && input[0].Type == "":
+		value.Value = input[0].Value
+	case len(input) == 1:
+		value = input[0]
+	}
+	if !isBufferType(value.Type) {
+		return bufferArg{}, fmt.Errorf("%s take string, bytes or file input, not %s", plugins, value.Type)
+	}
+	return decodeBuffer(value)
+}
+
+// callExtism runs a plugin function on one input
+func (c InvocationConfig) callExtism(module WasmModule, args []interface{}) ([]interface{}, error) {
+	kernel := c.extism.kernel
+	if err := kernel.begin(args[0].(bufferArg).data); err != nil {
+		return nil, err
+	}
+	returns, err := module.Execute(c.Entry)
+	if err != nil {
+		return nil, err
+	}
+	// The host reads the output after the call, as Extism does
+	if _, err := kernel.bytes(kernel.output, kernel.outputLength); err != nil {
+		return nil, &RuntimeError{Stage: StageExecute, Message: fmt.Sprintf("plugin output: %v", err)}
+	}
+	if c.Extism.FailOnError && len(returns) == 1 && returns[0] != int32(0) {
+		return nil, &RuntimeError{
+			Stage:   StageExecute,
+			Message: fmt.Sprintf("plugin returned %d: %s", returns[0], kernel.errorMessage()),
+		}
+	}
+	return returns, nil
+}
@@ -0,0 +1,449 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mrhapile/WASM-Injection-Framework/internal/wasmbin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// kernelImports are the kernel functions the test plugins use
+var kernelImports = []string{
+	"input_length", "input_load_u8", "alloc", "store_u8", "load_u8", "output_set",
+	"error_set", "config_get", "var_get", "var_set", "length",
+}
+
+// pluginBinary assembles a module with the given function imports
+// and a "run" export of type () -> (i32)
+func pluginBinary(imports ...wasmFuncImport) []byte {
+	valTypes := map[string]byte{}
+	for b, name := range valTypeNames {
+		valTypes[name] = b
+	}
+	appendTypes := func(b []byte, names []string) []byte {
+		b = wasmbin.AppendU32(b, uint32(len(names)))
+		for _, name := range names {
+			b = append(b, valTypes[name])
+		}
+		return b
+	}
+
+	types := wasmbin.AppendU32(nil, uint32(len(imports)+1))
+	importSection := wasmbin.AppendU32(nil, uint32(len(imports)))
+	for i, imp := range imports {
+		types = append(types, 0x60)
+		types = appendTypes(appendTypes(types, imp.Signature.Params), imp.Signature.Results)
+		importSection = wasmbin.AppendName(wasmbin.AppendName(importSection, imp.Module), imp.Name)
+		importSection = wasmbin.AppendU32(append(importSection, externFunc), uint32(i))
+	}
+	types = append(types, 0x60, 0x00, 0x01, 0x7f)
+
+	body := []byte{0x00, 0x41, 0x00, 0x0b}
+	module := &wasmBinary{Sections: []wasmSection{
+		{ID: sectionType, Payload: types},
+		{ID: sectionImport, Payload: importSection},
+		{ID: sectionFunction, Payload: wasmbin.AppendU32([]byte{0x01}, uint32(len(imports)))},
+		{ID: sectionExport, Payload: wasmbin.AppendU32(append(wasmbin.AppendName([]byte{0x01}, "run"), externFunc), uint32(len(imports)))},
+		{ID: sectionCode, Payload: append(wasmbin.AppendU32([]byte{0x01}, uint32(len(body))), body...)},
+	}}
+	return module.encode()
+}
+
+// kernelPluginBinary imports the test kernel functions from module, with
+// names prefixed by prefix, plus the given user host functions
+func kernelPluginBinary(module, prefix string, user ...wasmFuncImport) []byte {
+	functions := newExtismKernel(nil).functions()
+	var imports []wasmFuncImport
+	for _, name := range kernelImports {
+		imports = append(imports, wasmFuncImport{Module: module, Name: prefix + name, Signature: functions[name].signature})
+	}
+	return pluginBinary(append(imports, user...)...)
+}
+
+// pluginModule is a mock plugin whose run export is a Go function calling
+// the host functions it was linked to, by their names without the legacy
+// prefix
+type pluginModule struct {
+	MockWasmModule
+	host map[string]HostFunction
+}
+
+// call invokes a host function by name, returning its first result
+func (m *pluginModule) call(name string, args ...interface{}) (int64, error) {
+	fn, ok := m.host[name]
+	if !ok {
+		return 0, errors.New("unknown import " + name)
+	}
+	results, err := fn.Call(args)
+	if err != nil {
+		// Mirrors how WasmEdgeModule reports host function traps
+		return 0, &RuntimeError{Stage: StageExecute, Message: "execution failed: host function '" + name + "' failed: " + err.Error()}
+	}
+	if len(results) == 0 {
+		return 0, nil
+	}
+	if v, ok := results[0].(int32); ok {
+		return int64(v), nil
+	}
+	return results[0].(int64), nil
+}
+
+// input reads the call's input through the kernel
+func (m *pluginModule) input() ([]byte, error) {
+	n, err := m.call("input_length")
+	if err != nil {
+		return nil, err
+	}
+	input := make([]byte, n)
+	for i := range input {
+		b, err := m.call("input_load_u8", int64(i))
+		if err != nil {
+			return nil, err
+		}
+		input[i] = byte(b)
+	}
+	return input, nil
+}
+
+// store copies data into a new kernel block
+func (m *pluginModule) store(data []byte) (int64, error) {
+	offset, err := m.call("alloc", int64(len(data)))
+	for i := 0; err == nil && i < len(data); i++ {
+		_, err = m.call("store_u8", offset+int64(i), int32(data[i]))
+	}
+	return offset, err
+}
+
+// load reads a kernel block
+func (m *pluginModule) load(offset int64) ([]byte, error) {
+	n, err := m.call("length", offset)
+	data := make([]byte, n)
+	for i := range data {
+		if err != nil {
+			return nil, err
+		}
+		var b int64
+		b, err = m.call("load_u8", offset+int64(i))
+		data[i] = byte(b)
+	}
+	return data, err
+}
+
+// statefulPluginModule adds snapshot support to pluginModule; its own
+// memory holds nothing, so snapshots are empty
+type statefulPluginModule struct {
+	*pluginModule
+}
+
+func (m *statefulPluginModule) Snapshot() (*ModuleSnapshot, error) {
+	return &ModuleSnapshot{}, nil
+}
+
+func (m *statefulPluginModule) Restore(snapshot *ModuleSnapshot) error {
+	return nil
+}
+
+// hostMockRuntime links plugins to the host functions it is given. It
+// only loads modules through LoadModuleWithHost.
+type hostMockRuntime struct {
+	run      func(m *pluginModule) (int32, error)
+	stateful bool
+}
+
+func (r *hostMockRuntime) LoadModule(filePath string) (WasmModule, error) {
+	return nil, errors.New("imports cannot be satisfied")
+}
+
+func (r *hostMockRuntime) LoadModuleWithHost(filePath string, data []byte, host []HostFunction) (WasmModule, error) {
+	m := &pluginModule{host: map[string]HostFunction{}}
+	for _, fn := range host {
+		m.host[strings.TrimPrefix(fn.Name, extismLegacyPrefix)] = fn
+	}
+	m.ExecuteFunc = func(funcName string, args ...interface{}) ([]interface{}, error) {
+		rc, err := r.run(m)
+		if err != nil {
+			return nil, err
+		}
+		return []interface{}{rc}, nil
+	}
+	if r.stateful {
+		return &statefulPluginModule{m}, nil
+	}
+	return m, nil
+}
+
+// runPlugin writes a plugin binary to disk and runs it with the Extism ABI
+func runPlugin(t *testing.T, binary []byte, runtime WasmRuntime, plan InvocationConfig, config ArgFuzzConfig) ExecutionResult {
+	path := filepath.Join(t.TempDir(), "plugin.wasm")
+	require.NoError(t, os.WriteFile(path, binary, 0o644))
+	plan.ABI, plan.Entry = ABIExtism, "run"
+	return processWasmFileWithOptions(path, runtime, RunOptions{Invocation: plan, ArgFuzz: config})
+}
+
+// -----------------------------------------------------------------------------
+// TEST: Extism Plugin ABI
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Extism plugins take no arguments: they read their input, write their
+// output and report errors through host functions of the Extism kernel.
+// Without a host providing that kernel, plugins fail to instantiate, so
+// the fuzzer supplies one and passes each input the way Extism does.
+// -----------------------------------------------------------------------------
+
+func TestExtism_KernelAllocatesBlocks(t *testing.T) {
+	k := newExtismKernel(nil)
+	require.NoError(t, k.begin([]byte("abc")))
+	assert.Equal(t, "abc", string(k.block(k.input)))
+	assert.NotZero(t, k.input, "offset 0 means null")
+
+	a := k.store([]byte("xy"))
+	assert.Equal(t, "xy", string(k.block(a)))
+	assert.Nil(t, k.block(a+1), "only block starts are blocks")
+	assert.Zero(t, k.alloc(0))
+	assert.Zero(t, k.alloc(extismMemoryLimit))
+
+	_, err := k.bytes(a+1, 2)
+	assert.EqualError(t, err, "2-byte access at 0x5 is out of bounds")
+
+	k.vars["n"] = []byte{1}
+	require.NoError(t, k.begin(nil))
+	assert.Zero(t, k.input)
+	assert.Nil(t, k.block(a), "blocks are released between calls")
+	assert.Equal(t, []byte{1}, k.vars["n"], "variables persist across calls")
+
+	k.rewind()
+	assert.Empty(t, k.vars, "variables rewind to their state before the first call")
+	assert.Equal(t, "no error set", k.errorMessage())
+}
+
+func TestExtism_LinksImports(t *testing.T) {
+	k := newExtismKernel(nil)
+	i64 := FuncSignature{Params: []string{"i64"}, Results: []string{"i64"}}
+	host, err := k.link([]wasmFuncImport{
+		{Module: extismEnvModule, Name: "alloc", Signature: i64},
+		{Module: extismLegacyModule, Name: "extism_length", Signature: i64},
+		{Module: extismUserModule, Name: "lookup", Signature: FuncSignature{Params: []string{"i64"}, Results: []string{"i64", "f32"}}},
+		{Module: "wasi_snapshot_preview1", Name: "fd_write", Signature: i64},
+		{Module: extismLegacyModule, Name: "abort", Signature: FuncSignature{}},
+	})
+	require.NoError(t, err)
+	require.Len(t, host, 3, "imports outside the Extism modules are left to the runtime")
+
+	offset, err := host[0].Call([]interface{}{int64(4)})
+	require.NoError(t, err)
+	length, err := host[1].Call(offset)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{int64(4)}, length)
+
+	stub, err := host[2].Call([]interface{}{int64(1)})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{int64(0), float32(0)}, stub, "user host functions return zero values")
+
+	_, err = k.link([]wasmFuncImport{{Module: extismEnvModule, Name: "http_get", Signature: i64}})
+	assert.EqualError(t, err, "unknown kernel function 'http_get'")
+	_, err = k.link([]wasmFuncImport{{Module: extismLegacyModule, Name: "extism_alloc", Signature: FuncSignature{Params: []string{"i32"}, Results: []string{"i32"}}}})
+	assert.EqualError(t, err, "kernel function 'extism_alloc' has signature (i64) -> (i64), but the plugin imports it as (i32) -> (i32)")
+}
+
+func TestExtism_RunsPlugin(t *testing.T) {
+	// The plugin greets its input with a configured greeting
+	var outputs []string
+	runtime := &hostMockRuntime{run: func(m *pluginModule) (int32, error) {
+		input, err := m.input()
+		if err != nil {
+			return 0, err
+		}
+		key, _ := m.store([]byte("greeting"))
+		greeting, _ := m.call("config_get", key)
+		prefix, _ := m.load(greeting)
+
+		out, err := m.store(append(prefix, input...))
+		if err != nil {
+			return 0, err
+		}
+		if _, err := m.call("output_set", out, int64(len(prefix)+len(input))); err != nil {
+			return 0, err
+		}
+		output, _ := m.load(out)
+		outputs = append(outputs, string(output))
+		return 0, nil
+	}}
+	plan := InvocationConfig{
+		Inputs: []InvocationInput{{{Value: "world"}}, {{Type: "bytes", Value: "2121"}}},
+		Extism: ExtismConfig{Config: map[string]string{"greeting": "hello "}},
+	}
+
+	for _, binary := range [][]byte{kernelPluginBinary(extismEnvModule, ""), kernelPluginBinary(extismLegacyModule, extismLegacyPrefix)} {
+		outputs = nil
+		result := runPlugin(t, binary, runtime, plan, ArgFuzzConfig{})
+
+		require.True(t, result.Success, result.ErrorMessage)
+		assert.Equal(t, []string{"hello world", "hello !!"}, outputs)
+		assert.Equal(t, []interface{}{int32(0), int32(0)}, invocationReturns(result))
+		assert.Equal(t, WasmValue{Type: "string", Value: "world"}, result.Invocations[0].Args[0])
+	}
+}
+
+func TestExtism_DefaultInputIsEmpty(t *testing.T) {
+	var inputs []string
+	runtime := &hostMockRuntime{run: func(m *pluginModule) (int32, error) {
+		input, err := m.input()
+		inputs = append(inputs, string(input))
+		return 0, err
+	}}
+
+	result := runPlugin(t, kernelPluginBinary(extismEnvModule, ""), runtime, InvocationConfig{}, ArgFuzzConfig{})
+
+	require.True(t, result.Success, result.ErrorMessage)
+	assert.Equal(t, []string{""}, inputs)
+}
+
+func TestExtism_FailOnError(t *testing.T) {
+	runtime := &hostMockRuntime{run: func(m *pluginModule) (int32, error) {
+		message, err := m.store([]byte("bad input"))
+		if err != nil {
+			return 0, err
+		}
+		_, err = m.call("error_set", message)
+		return 1, err
+	}}
+	binary := kernelPluginBinary(extismEnvModule, "")
+
+	result := runPlugin(t, binary, runtime, InvocationConfig{}, ArgFuzzConfig{})
+	assert.True(t, result.Success, "a non-zero status is not a failure by default")
+	assert.Equal(t, []interface{}{int32(1)}, result.ReturnValues)
+
+	result = runPlugin(t, binary, runtime, InvocationConfig{Extism: ExtismConfig{FailOnError: true}}, ArgFuzzConfig{})
+	assert.False(t, result.Success)
+	assert.Equal(t, StageExecute, result.FailureStage)
+	assert.Equal(t, "plugin returned 1: bad input", result.ErrorMessage)
+}
+
+func TestExtism_InvalidOutputFails(t *testing.T) {
+	runtime := &hostMockRuntime{run: func(m *pluginModule) (int32, error) {
+		_, err := m.call("output_set", int64(1), int64(1<<20))
+		return 0, err
+	}}
+
+	result := runPlugin(t, kernelPluginBinary(extismEnvModule, ""), runtime, InvocationConfig{}, ArgFuzzConfig{})
+
+	assert.Equal(t, StageExecute, result.FailureStage)
+	assert.Equal(t, "plugin output: 1048576-byte access at 0x1 is out of bounds", result.ErrorMessage)
+}
+
+func TestExtism_HTTPRequestsTrap(t *testing.T) {
+	binary := pluginBinary(wasmFuncImport{
+		Module: extismEnvModule, Name: "http_request",
+		Signature: FuncSignature{Params: []string{"i64", "i64"}, Results: []string{"i64"}},
+	})
+	runtime := &hostMockRuntime{run: func(m *pluginModule) (int32, error) {
+		_, err := m.call("http_request", int64(0), int64(0))
+		return 0, err
+	}}
+
+	result := runPlugin(t, binary, runtime, InvocationConfig{}, ArgFuzzConfig{})
+
+	assert.Equal(t, StageExecute, result.FailureStage)
+	assert.Equal(t, "execution failed: host function 'http_request' failed: HTTP requests are not allowed", result.ErrorMessage)
+}
+
+func TestExtism_SnapshotRewindsVariables(t *testing.T) {
+	// The plugin counts its calls in a variable and returns the count
+	runtime := &hostMockRuntime{stateful: true, run: func(m *pluginModule) (int32, error) {
+		name, _ := m.store([]byte("calls"))
+		value, _ := m.call("var_get", name)
+		count, _ := m.load(value)
+		count = append(count, 1)
+		stored, err := m.store(count)
+		if err != nil {
+			return 0, err
+		}
+		_, err = m.call("var_set", name, stored)
+		return int32(len(count)), err
+	}}
+	binary := kernelPluginBinary(extismEnvModule, "")
+	plan := InvocationConfig{Inputs: []InvocationInput{{}, {}, {}}}
+
+	result := runPlugin(t, binary, runtime, plan, ArgFuzzConfig{})
+	assert.Equal(t, []interface{}{int32(1), int32(2), int32(3)}, invocationReturns(result), "variables persist across calls")
+
+	plan.Snapshot = true
+	result = runPlugin(t, binary, runtime, plan, ArgFuzzConfig{})
+	assert.Equal(t, []interface{}{int32(1), int32(1), int32(1)}, invocationReturns(result))
+}
+
+func TestExtism_ConfigErrors(t *testing.T) {
+	runtime := &hostMockRuntime{run: func(m *pluginModule) (int32, error) { return 0, nil }}
+	binary := kernelPluginBinary(extismEnvModule, "")
+	tests := []struct {
+		plan    InvocationConfig
+		message string
+	}{
+		{InvocationConfig{Inputs: []InvocationInput{i32Input(1, 2)}}, "input 0: Extism plugins take a single input, 2 values given"},
+		{InvocationConfig{Inputs: []InvocationInput{i32Input(1)}}, "input 0: Extism plugins take string, bytes or file input, not i32"},
+		{InvocationConfig{Inputs: []InvocationInput{{{Type: "bytes", Value: "zz"}}}}, `input 0: invalid bytes value "zz": expected hex digits`},
+	}
+	for _, tt := range tests {
+		result := runPlugin(t, binary, runtime, tt.plan, ArgFuzzConfig{})
+		assert.Equal(t, StageSignature, result.FailureStage, tt.message)
+		assert.Equal(t, tt.message, result.ErrorMessage)
+	}
+
+	plan := InvocationConfig{ABI: "wasi", Entry: "run", Inputs: []InvocationInput{{}}}
+	_, err := plan.arguments(&MockWasmModule{})
+	assert.EqualError(t, err, `signature: unknown ABI "wasi"`)
+
+	plan.ABI = ABIExtism
+	_, err = plan.extismArguments(&FuncSignature{Params: []string{"i32"}, Results: []string{"i32"}})
+	assert.EqualError(t, err, "signature: signature mismatch: Extism function 'run' must have signature () -> (i32), not (i32) -> (i32)")
+
+	mockRuntime := &MockWasmRuntime{LoadModuleFunc: func(filePath string) (WasmModule, error) { return &MockWasmModule{}, nil }}
+	result := runPlugin(t, binary, mockRuntime, InvocationConfig{}, ArgFuzzConfig{})
+	assert.Equal(t, StageInstantiate, result.FailureStage)
+	assert.Equal(t, "extism: runtime cannot provide host functions", result.ErrorMessage)
+
+	bad := pluginBinary(wasmFuncImport{Module: extismEnvModule, Name: "input_length", Signature: FuncSignature{Results: []string{"i32"}}})
+	result = runPlugin(t, bad, runtime, InvocationConfig{}, ArgFuzzConfig{})
+	assert.Equal(t, StageInstantiate, result.FailureStage)
+	assert.Equal(t, "extism: kernel function 'input_length' has signature () -> (i64), but the plugin imports it as () -> (i32)", result.ErrorMessage)
+}
+
+func TestExtism_PayloadFuzzing(t *testing.T) {
+	// The plugin rejects admin requests with an error, but only for
+	// documents it can decode
+	runtime := &hostMockRuntime{run: func(m *pluginModule) (int32, error) {
+		input, err := m.input()
+		if err != nil {
+			return 0, err
+		}
+		var request struct{ Admin bool }
+		if json.Unmarshal(input, &request) == nil && request.Admin {
+			message, _ := m.store([]byte("forbidden"))
+			_, err := m.call("error_set", message)
+			return 1, err
+		}
+		return 0, nil
+	}}
+	plan := InvocationConfig{
+		Inputs: []InvocationInput{{{Value: `{"admin": false}`}}},
+		Extism: ExtismConfig{FailOnError: true},
+	}
+
+	result := runPlugin(t, kernelPluginBinary(extismEnvModule, ""), runtime, plan, ArgFuzzConfig{Iterations: 500, Seed: 1, Payload: PayloadJSON})
+
+	require.NotNil(t, result.ArgFuzz)
+	require.Len(t, result.ArgFuzz.UniqueFailures, 1)
+	failure := result.ArgFuzz.UniqueFailures[0]
+	assert.Contains(t, failure.Args[0].Value, `"admin":true`)
+	assert.Contains(t, result.ErrorMessage, "plugin returned 1: forbidden")
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/mrhapile/WASM-Injection-Framework/internal/wasmbin"
+)
+
+// moduleFeatures records the proposals a module uses, by the proposal
+// names of matrix environments
+type moduleFeatures map[string]bool
+
+// sorted returns the feature names in order
+func (f moduleFeatures) sorted() []string {
+	names := make([]string, 0, len(f))
+	for name := range f {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// detectFeatures finds the post-MVP proposals a module relies on from its
+// types, imports, memories and instructions. Detection is conservative:
+// it only reports what the binary shows, so a proposal that leaves no
+// trace a decoder can see, such as extended constant expressions, is not
+// reported.
+func detectFeatures(data []byte) (moduleFeatures, error) {
+	binary, err := parseWasmBinary(data)
+	if err != nil {
+		return nil, err
+	}
+	features := make(moduleFeatures)
+
+	if binary.section(sectionTag) != nil {
+		features["exception-handling"] = true
+	}
+	if binary.section(sectionDataCount) != nil {
+		features["bulk-memory-operations"] = true
+	}
+	if err := binary.typeFeatures(features); err != nil {
+		return nil, fmt.Errorf("type section: %w", err)
+	}
+	if err := binary.storageFeatures(features); err != nil {
+		return nil, err
+	}
+
+	if code := binary.section(sectionCode); code != nil {
+		bodies, err := parseCodeSection(code.Payload)
+		if err != nil {
+			return nil, fmt.Errorf("code section: %w", err)
+		}
+		for i, body := range bodies {
+			instructions, err := wasmbin.DecodeInstructions(body.Code)
+			if err != nil {
+				return nil, fmt.Errorf("function body %d: %w", i, err)
+			}
+			for _, instr := range instructions {
+				if feature := instructionFeature(instr); feature != "" {
+					features[feature] = true
+				}
+			}
+		}
+	}
+	return features, nil
+}
+
+// typeFeatures detects multiple results and vector and reference types in
+// function signatures
+func (m *wasmBinary) typeFeatures(features moduleFeatures) error {
+	types, err := m.funcTypes()
+	if err != nil {
+		return err
+	}
+	for _, sig := range types {
+		if len(sig.Results) > 1 {
+			features["multi-value"] = true
+		}
+		for _, t := range append(append([]string(nil), sig.Params...), sig.Results...) {
+			switch t {
+			case "v128":
+				features["simd"] = true
+			case "funcref", "externref":
+				features["reference-types"] = true
+			}
+		}
+	}
+	return nil
+}
+
+// storageFeatures detects shared, 64-bit and multiple memories, multiple
+// tables and mutable globals crossing the module boundary
+func (m *wasmBinary) storageFeatures(features moduleFeatures) error {
+	memories, tables := 0, 0
+	var mutableGlobals []bool
+	limits := func(flags byte) {
+		if flags&0x02 != 0 {
+			features["threads"] = true
+		}
+		if flags&0x04 != 0 {
+			features["memory64"] = true
+		}
+	}
+
+	if section := m.section(sectionImport); section != nil {
+		r := &wasmbin.Reader{Data: section.Payload}
+		n, err := r.U32()
+		if err != nil {
+			return err
+		}
+		for i := uint32(0); i < n; i++ {
+			if _, err := r.Name(); err != nil {
+				return err
+			}
+			if _, err := r.Name(); err != nil {
+				return err
+			}
+			kind, err := r.Byte()
+			if err != nil {
+				return err
+			}
+			switch {
+			case kind == externMemory && !r.Done():
+				memories++
+				limits(r.Data[r.Pos])
+			case kind == externTable:
+				tables++
+			case kind == externGlobal && r.Pos+1 < len(r.Data):
+				// The mutability byte follows a single-byte value type
+				mutable := r.Data[r.Pos+1] == 0x01
+				mutableGlobals = append(mutableGlobals, mutable)
+				if mutable {
+					features["import-export-mut-globals"] = true
+				}
+			}
+			if err := r.SkipImportDesc(kind); err != nil {
+				return fmt.Errorf("import %d: %w", i, err)
+			}
+		}
+	}
+
+	if section := m.section(sectionMemory); section != nil {
+		r := &wasmbin.Reader{Data: section.Payload}
+		n, err := r.U32()
+		if err != nil {
+			return err
+		}
+		memories += int(n)
+		for i := uint32(0); i < n && !r.Done(); i++ {
+			limits(r.Data[r.Pos])
+			if err := r.SkipLimits(); err != nil {
+				return fmt.Errorf("memory %d: %w", i, err)
+			}
+		}
+	}
+	if n, err := m.vectorCount(sectionTable); err == nil {
+		tables += int(n)
+	}
+	if memories > 1 {
+		features["multi-memories"] = true
+	}
+	if tables > 1 {
+		features["reference-types"] = true
+	}
+
+	if section := m.section(sectionGlobal); section != nil {
+		r := &wasmbin.Reader{Data: section.Payload}
+		n, err := r.U32()
+		if err != nil {
+			return err
+		}
+		for i := uint32(0); i < n; i++ {
+			if err := r.SkipValType(); err != nil {
+				return fmt.Errorf("global %d: %w", i, err)
+			}
+			mutable, err := r.Byte()
+			if err != nil {
+				return err
+			}
+			if err := r.SkipConstExpr(); err != nil {
+				return fmt.Errorf("global %d: %w", i, err)
+			}
+			mutableGlobals = append(mutableGlobals, mutable == 0x01)
+		}
+	}
+	if section := m.section(sectionExport); section != nil {
+		r := &wasmbin.Reader{Data: section.Payload}
+		n, err := r.U32()
+		if err != nil {
+			return err
+		}
+		for i := uint32(0); i < n; i++ {
+			if _, err := r.Name(); err != nil {
+				return err
+			}
+			kind, err := r.Byte()
+			if err != nil {
+				return err
+			}
+			index, err := r.U32()
+			if err != nil {
+				return err
+			}
+			if kind == externGlobal && int(index) < len(mutableGlobals) && mutableGlobals[index] {
+				features["import-export-mut-globals"] = true
+			}
+		}
+	}
+	return nil
+}
+
+// instructionFeature returns the proposal an instruction belongs to, or ""
+// for MVP instructions
+func instructionFeature(instr wasmbin.Instruction) string {
+	switch op := instr.Opcode; {
+	case op == opTry || op == opCatch || op == 0x08 || op == 0x09 || op == 0x0a ||
+		op == opDelegate || op == opCatchAll || op == opTryTable:
+		return "exception-handling"
+	case op == 0x12 || op == 0x13:
+		return "tail-call"
+	case op == 0x14 || op == 0x15 || (op >= 0xd3 && op <= 0xd6):
+		return "function-references"
+	case op == 0x1c || op == 0x25 || op == 0x26 || (op >= 0xd0 && op <= 0xd2):
+		return "reference-types"
+	case op >= 0xc0 && op <= 0xc4:
+		return "sign-extension-operators"
+	case op == opPrefixMisc && instr.Sub <= 7:
+		return "non-trap-float-to-int-conversions"
+	case op == opPrefixMisc && instr.Sub <= 14:
+		return "bulk-memory-operations"
+	case op == opPrefixMisc:
+		return "reference-types"
+	case op == opPrefixSIMD:
+		return "simd"
+	case op == opPrefixAtomic:
+		return "threads"
+	}
+	return ""
+}
+
+// defaultProposals are the proposals WasmEdge enables without being
+// configured to
+var defaultProposals = map[string]bool{
+	"import-export-mut-globals":         true,
+	"non-trap-float-to-int-conversions": true,
+	"sign-extension-operators":          true,
+	"multi-value":                       true,
+	"bulk-memory-operations":            true,
+	"reference-types":                   true,
+	"simd":                              true,
+}
+
+// unsupported returns the features an environment leaves disabled
+func (f moduleFeatures) unsupported(env Environment) []string {
+	enabled := make(map[string]bool)
+	for _, proposal := range env.Proposals {
+		enabled[proposal] = true
+	}
+	var missing []string
+	for _, name := range f.sorted() {
+		if !defaultProposals[name] && !enabled[name] {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// detectFileFeatures detects the features of a module file. Files that
+// cannot be read or decoded report none, and fail when they are run.
+// Detection runs outside the pipeline's panic recovery, so it recovers
+// its own: a decoder bug must not stop the campaign.
+func detectFileFeatures(filePath string) (features moduleFeatures) {
+	defer func() {
+		if recover() != nil {
+			features = nil
+		}
+	}()
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil
+	}
+	if features, err = detectFeatures(data); err != nil {
+		return nil
+	}
+	return features
+}
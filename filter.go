@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// ResultFilter slims the results of a report as it is written. The totals
+// and counts of the report still cover every result.
+type ResultFilter struct {
+	// OnlyFailures keeps only the failed results
+	OnlyFailures bool `json:"only_failures,omitempty"`
+	// OnlyStage keeps only the results that failed in this stage
+	OnlyStage FailureStage `json:"only_stage,omitempty"`
+	// Fields keeps only these fields of each result, by their JSON names.
+	// file_path is always kept, so results can be told apart.
+	Fields []string `json:"fields,omitempty"`
+	// Dropped counts the results left out
+	Dropped int `json:"dropped"`
+}
+
+// check rejects stages and fields results do not have
+func (f *ResultFilter) check() error {
+	if f == nil {
+		return nil
+	}
+	if f.OnlyStage != "" && !isFailureStage(f.OnlyStage) {
+		return fmt.Errorf("unknown failure stage %q", f.OnlyStage)
+	}
+	fields := resultFields()
+	for _, field := range f.Fields {
+		if !fields[field] {
+			return fmt.Errorf("results have no field %q", field)
+		}
+	}
+	return nil
+}
+
+// resultFields returns the JSON names of the fields of a result
+func resultFields() map[string]bool {
+	fields := make(map[string]bool)
+	t := reflect.TypeOf(ExecutionResult{})
+	for i := 0; i < t.NumField(); i++ {
+		if name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ","); name != "" && name != "-" {
+			fields[name] = true
+		}
+	}
+	return fields
+}
+
+// keeps reports whether a result passes the filter
+func (f *ResultFilter) keeps(result ExecutionResult) bool {
+	failed := !result.Success && !result.Skipped
+	if f.OnlyFailures && !failed {
+		return false
+	}
+	return f.OnlyStage == "" || failed && result.FailureStage == f.OnlyStage
+}
+
+// apply drops the results the filter leaves out, recording it on the report
+func (f *ResultFilter) apply(report FuzzingReport) FuzzingReport {
+	if f == nil {
+		return report
+	}
+	filter := *f
+	kept := make([]ExecutionResult, 0, len(report.Results))
+	for _, result := range report.Results {
+		if filter.keeps(result) {
+			kept = append(kept, result)
+		} else {
+			filter.Dropped++
+		}
+	}
+	report.Results, report.Filter = kept, &filter
+	return report
+}
+
+// encodeReport writes a report as indented JSON, with only the fields its
+// filter keeps of each result
+func encodeReport(w io.Writer, report FuzzingReport) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if report.Filter == nil || len(report.Filter.Fields) == 0 {
+		return encoder.Encode(report)
+	}
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	// Numbers are kept as written, as float64 would round the 64-bit
+	// integers return values can be
+	var raw map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&raw); err != nil {
+		return err
+	}
+	keep := map[string]bool{"file_path": true}
+	for _, field := range report.Filter.Fields {
+		keep[field] = true
+	}
+	results, _ := raw["results"].([]interface{})
+	for _, result := range results {
+		fields, _ := result.(map[string]interface{})
+		for field := range fields {
+			if !keep[field] {
+				delete(fields, field)
+			}
+		}
+	}
+	return encoder.Encode(raw)
+}
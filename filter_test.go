@@ -0,0 +1,95 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// -----------------------------------------------------------------------------
+// TEST: Result Filtering
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Reports of large campaigns are mostly passing results nobody reads.
+// Slimming them as they are written must keep the totals and counts of
+// the whole campaign, and say what was left out, so a filtered report is
+// never mistaken for a smaller campaign.
+// -----------------------------------------------------------------------------
+
+func filterTestReport() FuzzingReport {
+	return FuzzingReport{
+		SchemaVersion: SchemaVersion,
+		TotalFiles:    3,
+		Passed:        1,
+		Failed:        2,
+		Results: []ExecutionResult{
+			{SchemaVersion: SchemaVersion, FilePath: "ok.wasm", Success: true, FailureStage: StageNone},
+			{SchemaVersion: SchemaVersion, FilePath: "bad.wasm", FailureStage: StageLoad, ErrorMessage: "magic header not detected", ErrorCode: ErrLoadMagic},
+			{SchemaVersion: SchemaVersion, FilePath: "trap.wasm", FailureStage: StageExecute, ErrorMessage: "unreachable", ErrorCode: ErrExecTrapUnreachable},
+		},
+		FailureCounts: map[FailureStage]int{StageLoad: 1, StageExecute: 1},
+		SkipCounts:    newSkipCounts(),
+	}
+}
+
+func TestFilter_KeepsSelectedResults(t *testing.T) {
+	report := (&ResultFilter{OnlyFailures: true}).apply(filterTestReport())
+	require.Len(t, report.Results, 2)
+	assert.Equal(t, 1, report.Filter.Dropped)
+	assert.Equal(t, 3, report.TotalFiles)
+	assert.Empty(t, validateReport(report))
+
+	report = (&ResultFilter{OnlyStage: StageExecute}).apply(filterTestReport())
+	require.Len(t, report.Results, 1)
+	assert.Equal(t, "trap.wasm", report.Results[0].FilePath)
+	assert.Equal(t, 2, report.Filter.Dropped)
+
+	var unfiltered *ResultFilter
+	assert.Len(t, unfiltered.apply(filterTestReport()).Results, 3)
+}
+
+func TestFilter_ProjectsFields(t *testing.T) {
+	report := (&ResultFilter{OnlyFailures: true, Fields: []string{"error_code"}}).apply(filterTestReport())
+
+	var out bytes.Buffer
+	require.NoError(t, encodeReport(&out, report))
+	var raw struct {
+		Results []map[string]interface{} `json:"results"`
+		Failed  int                      `json:"failed"`
+	}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &raw))
+	assert.Equal(t, 2, raw.Failed)
+	assert.Equal(t, []map[string]interface{}{
+		{"file_path": "bad.wasm", "error_code": "E_LOAD_MAGIC"},
+		{"file_path": "trap.wasm", "error_code": "E_EXEC_TRAP_UNREACHABLE"},
+	}, raw.Results)
+
+	decoded, _, err := decodeReport(out.Bytes())
+	require.NoError(t, err)
+	assert.Empty(t, validateReport(decoded))
+}
+
+func TestFilter_ProjectionKeepsIntegersAbove2To53(t *testing.T) {
+	report := FuzzingReport{
+		SchemaVersion: SchemaVersion,
+		Results:       []ExecutionResult{{FilePath: "a.wasm", Success: true, ReturnValues: []interface{}{int64(1<<53 + 1)}}},
+		Filter:        &ResultFilter{Fields: []string{"return_values"}},
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, encodeReport(&out, report))
+	assert.Contains(t, out.String(), "9007199254740993")
+}
+
+func TestFilter_RejectsUnknownStagesAndFields(t *testing.T) {
+	assert.EqualError(t, (&ResultFilter{OnlyStage: "run"}).check(), `unknown failure stage "run"`)
+	assert.EqualError(t, (&ResultFilter{Fields: []string{"eror_code"}}).check(), `results have no field "eror_code"`)
+	assert.NoError(t, (&ResultFilter{OnlyStage: StageExecute, Fields: []string{"error_message"}}).check())
+}
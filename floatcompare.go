@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Float comparison modes
+const (
+	// FloatBitwise takes floats as equal only when their bits are
+	FloatBitwise = "bitwise"
+	// FloatCanonicalNaN also takes any two NaNs as equal, whatever their
+	// sign and payload
+	FloatCanonicalNaN = "canonical_nan"
+	// FloatULP also takes numbers as equal when they are at most ULPs
+	// representable values apart
+	FloatULP = "ulp"
+)
+
+// FloatComparison sets when the float results of two runs are the same,
+// for the modes comparing runs: equiv, determinism and compare_clean. NaN
+// payloads and the last bits of a result may differ between builds and
+// runtimes without either being wrong.
+type FloatComparison struct {
+	// Mode is bitwise (default), canonical_nan or ulp
+	Mode string `yaml:"mode"`
+	// ULPs is the distance the ulp mode tolerates
+	ULPs uint64 `yaml:"ulps"`
+}
+
+// check rejects unknown modes, and a tolerance the mode ignores
+func (c FloatComparison) check() error {
+	switch c.Mode {
+	case "", FloatBitwise, FloatCanonicalNaN:
+		if c.ULPs != 0 {
+			return fmt.Errorf("float_comparison: ulps needs the %s mode", FloatULP)
+		}
+	case FloatULP:
+	default:
+		return fmt.Errorf("float_comparison: unknown mode %q (%s)", c.Mode, strings.Join([]string{FloatBitwise, FloatCanonicalNaN, FloatULP}, ", "))
+	}
+	return nil
+}
+
+// equal reports whether two lists of values are the same, comparing
+// floats by the mode
+func (c FloatComparison) equal(a, b []WasmValue) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] && !c.equalFloats(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// equalFloats compares two floats of different bits
+func (c FloatComparison) equalFloats(a, b WasmValue) bool {
+	if a.Type != b.Type || c.Mode == "" || c.Mode == FloatBitwise {
+		return false
+	}
+	size := 0
+	switch a.Type {
+	case "f32":
+		size = 32
+	case "f64":
+		size = 64
+	default:
+		return false
+	}
+	x, errX := parseHexBits(a.Value, size)
+	y, errY := parseHexBits(b.Value, size)
+	if errX != nil || errY != nil {
+		return false
+	}
+
+	// Floats are sign and magnitude, and magnitudes above infinity's are
+	// NaNs
+	sign := uint64(1) << (size - 1)
+	infinity := uint64(0x7f800000)
+	if size == 64 {
+		infinity = 0x7ff0000000000000
+	}
+	magX, magY := x&^sign, y&^sign
+	nanX, nanY := magX > infinity, magY > infinity
+	if nanX || nanY {
+		return nanX && nanY
+	}
+	if c.Mode != FloatULP {
+		return false
+	}
+
+	// Consecutive floats have consecutive magnitudes, so the distance is
+	// their difference, or their sum across zero
+	var distance uint64
+	switch {
+	case x&sign != y&sign:
+		distance = magX + magY
+	case magX > magY:
+		distance = magX - magY
+	default:
+		distance = magY - magX
+	}
+	return distance <= c.ULPs
+}
@@ -0,0 +1,69 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// -----------------------------------------------------------------------------
+// TEST: Float Comparison Policy
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// NaN payloads and the last bits of a float legitimately differ between
+// builds and runtimes. Compared bit by bit, they flood the report with
+// divergences that hide the real ones, so how floats compare is a setting.
+// -----------------------------------------------------------------------------
+
+func TestFloatComparison_Modes(t *testing.T) {
+	f32 := func(bits string) []WasmValue { return []WasmValue{{Type: "f32", Value: bits}} }
+	f64 := func(bits string) []WasmValue { return []WasmValue{{Type: "f64", Value: bits}} }
+	bitwise, canonical := FloatComparison{}, FloatComparison{Mode: FloatCanonicalNaN}
+	ulp := FloatComparison{Mode: FloatULP, ULPs: 2}
+
+	tests := []struct {
+		name                    string
+		a, b                    []WasmValue
+		bitwise, canonical, ulp bool
+	}{
+		{"same bits", f32("0x3f800000"), f32("0x3f800000"), true, true, true},
+		{"nan payloads", f32("0x7fc00000"), f32("0xffc00123"), false, true, true},
+		{"f64 nan payloads", f64("0x7ff8000000000000"), f64("0x7ff8000000000abc"), false, true, true},
+		{"nan and infinity", f32("0x7fc00000"), f32("0x7f800000"), false, false, false},
+		{"two ulps apart", f32("0x3f800000"), f32("0x3f800002"), false, false, true},
+		{"three ulps apart", f64("0x3ff0000000000003"), f64("0x3ff0000000000000"), false, false, false},
+		{"signed zeros", f32("0x00000000"), f32("0x80000000"), false, false, true},
+		{"across zero", f32("0x00000001"), f32("0x80000001"), false, false, true},
+		{"other types", f32("0x3f800000"), f64("0x3f800000"), false, false, false},
+		{"integers", []WasmValue{{Type: "i32", Value: "1"}}, []WasmValue{{Type: "i32", Value: "2"}}, false, false, false},
+		{"lengths", f32("0x3f800000"), nil, false, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.bitwise, bitwise.equal(tt.a, tt.b), "bitwise")
+			assert.Equal(t, tt.canonical, canonical.equal(tt.a, tt.b), "canonical_nan")
+			assert.Equal(t, tt.ulp, ulp.equal(tt.a, tt.b), "ulp")
+		})
+	}
+}
+
+func TestFloatComparison_Check(t *testing.T) {
+	assert.NoError(t, FloatComparison{}.check())
+	assert.NoError(t, FloatComparison{Mode: FloatULP, ULPs: 4}.check())
+	assert.EqualError(t, FloatComparison{Mode: FloatCanonicalNaN, ULPs: 4}.check(), "float_comparison: ulps needs the ulp mode")
+	assert.ErrorContains(t, FloatComparison{Mode: "approx"}.check(), `unknown mode "approx"`)
+}
+
+func TestFloatComparison_AppliesToComparedRuns(t *testing.T) {
+	left := ExecutionResult{Success: true, TypedReturnValues: []WasmValue{{Type: "f64", Value: "0x7ff8000000000000"}}}
+	right := ExecutionResult{Success: true, TypedReturnValues: []WasmValue{{Type: "f64", Value: "0xfff8000000000001"}}}
+
+	assert.Len(t, compareOutputs(left, right, FloatComparison{}), 1)
+	assert.Empty(t, compareOutputs(left, right, FloatComparison{Mode: FloatCanonicalNaN}))
+	assert.Len(t, compareClean(left, right, FloatComparison{}).Differences, 1)
+	assert.Empty(t, compareClean(left, right, FloatComparison{Mode: FloatCanonicalNaN}).Differences)
+}
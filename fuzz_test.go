@@ -0,0 +1,32 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// -----------------------------------------------------------------------------
+// FUZZ: Native Go Fuzzing Entry
+// -----------------------------------------------------------------------------
+//
+// Runs FuzzOneInput under `go test -fuzz=FuzzPipeline`, seeded with the
+// committed corpus. OSS-Fuzz builds native Go fuzz tests directly.
+// This file has no build tag so it also runs against real WasmEdge.
+// -----------------------------------------------------------------------------
+
+func FuzzPipeline(f *testing.F) {
+	seeds, err := filepath.Glob(filepath.Join("corpus", "*.wasm"))
+	require.NoError(f, err)
+	for _, seed := range seeds {
+		data, err := os.ReadFile(seed)
+		require.NoError(f, err)
+		f.Add(data)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		FuzzOneInput(data)
+	})
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+
+	"github.com/mrhapile/WASM-Injection-Framework/pkg/rewrite"
+)
+
+// GeneratedCorpus lists the modules written by the generate command
+type GeneratedCorpus struct {
+	// Seed draws every module, so a seed always gives the same corpus
+	Seed  int64    `json:"seed"`
+	Files []string `json:"files"`
+}
+
+// generateMaxFunctions and generateMaxDepth bound the functions of a
+// generated module and the nesting of their expressions
+const (
+	generateMaxFunctions = 8
+	generateMaxDepth     = 4
+)
+
+var generateValTypes = []rewrite.ValType{rewrite.I32, rewrite.I64, rewrite.F32, rewrite.F64}
+
+// generateBinaryOps are the binary operators of each type that cannot trap
+var generateBinaryOps = map[rewrite.ValType][]byte{
+	rewrite.I32: {0x6a, 0x6b, 0x6c, 0x71, 0x72, 0x73, 0x74, 0x77},
+	rewrite.I64: {0x7c, 0x7d, 0x7e, 0x83, 0x84, 0x85, 0x86, 0x89},
+	rewrite.F32: {0x92, 0x93, 0x94, 0x95, 0x96, 0x97},
+	rewrite.F64: {0xa0, 0xa1, 0xa2, 0xa3, 0xa4, 0xa5},
+}
+
+// generateConversions converts a value to each type from another, without
+// trapping, keyed by the type converted to
+var generateConversions = map[rewrite.ValType][]struct {
+	from rewrite.ValType
+	op   byte
+}{
+	rewrite.I32: {{rewrite.I64, 0xa7}, {rewrite.F32, 0xbc}},
+	rewrite.I64: {{rewrite.I32, 0xac}, {rewrite.F64, 0xbd}},
+	rewrite.F32: {{rewrite.I32, 0xb2}, {rewrite.F64, 0xb6}},
+	rewrite.F64: {{rewrite.I64, 0xb9}, {rewrite.F32, 0xbb}},
+}
+
+// moduleGenerator draws the functions of one module. Each function is a
+// typed expression over its parameters, calling functions drawn before
+// it, so every module validates.
+type moduleGenerator struct {
+	rng    *rand.Rand
+	module *rewrite.Module
+	types  []rewrite.FuncType
+}
+
+// generateModule draws a module exporting every function it defines
+func generateModule(rng *rand.Rand) ([]byte, error) {
+	g := &moduleGenerator{rng: rng, module: &rewrite.Module{}}
+	count := 1 + rng.Intn(generateMaxFunctions)
+	for i := 0; i < count; i++ {
+		t := rewrite.FuncType{}
+		for n := rng.Intn(4); n > 0; n-- {
+			t.Params = append(t.Params, g.valType())
+		}
+		if rng.Intn(4) > 0 {
+			t.Results = []rewrite.ValType{g.valType()}
+		}
+
+		var body []rewrite.Instruction
+		if len(t.Results) == 1 {
+			body = g.expr(t.Params, t.Results[0], generateMaxDepth)
+		} else {
+			body = append(g.expr(t.Params, g.valType(), generateMaxDepth), rewrite.Simple(rewrite.OpDrop))
+		}
+		f := g.module.AddFunction(t, nil, body)
+		g.types = append(g.types, t)
+		if err := g.module.AddExport(fmt.Sprintf("f%d", f.Index), rewrite.KindFunc, f.Index); err != nil {
+			return nil, err
+		}
+	}
+	return g.module.Encode(), nil
+}
+
+func (g *moduleGenerator) valType() rewrite.ValType {
+	return generateValTypes[g.rng.Intn(len(generateValTypes))]
+}
+
+// expr draws an expression leaving one value of type t on the stack
+func (g *moduleGenerator) expr(params []rewrite.ValType, t rewrite.ValType, depth int) []rewrite.Instruction {
+	if depth > 0 {
+		switch g.rng.Intn(4) {
+		case 0:
+			ops := generateBinaryOps[t]
+			left := g.expr(params, t, depth-1)
+			right := g.expr(params, t, depth-1)
+			return append(append(left, right...), rewrite.Simple(ops[g.rng.Intn(len(ops))]))
+		case 1:
+			conversions := generateConversions[t]
+			conversion := conversions[g.rng.Intn(len(conversions))]
+			return append(g.expr(params, conversion.from, depth-1), rewrite.Simple(conversion.op))
+		case 2:
+			if call, ok := g.call(params, t, depth-1); ok {
+				return call
+			}
+		}
+	}
+
+	var locals []uint32
+	for i, param := range params {
+		if param == t {
+			locals = append(locals, uint32(i))
+		}
+	}
+	if len(locals) > 0 && g.rng.Intn(2) == 0 {
+		return []rewrite.Instruction{rewrite.LocalGet(locals[g.rng.Intn(len(locals))])}
+	}
+	return []rewrite.Instruction{g.constant(t)}
+}
+
+// call draws a call to an earlier function returning t, if there is one
+func (g *moduleGenerator) call(params []rewrite.ValType, t rewrite.ValType, depth int) ([]rewrite.Instruction, bool) {
+	var callees []int
+	for i, callee := range g.types {
+		if len(callee.Results) == 1 && callee.Results[0] == t {
+			callees = append(callees, i)
+		}
+	}
+	if len(callees) == 0 {
+		return nil, false
+	}
+	callee := callees[g.rng.Intn(len(callees))]
+	var instructions []rewrite.Instruction
+	for _, param := range g.types[callee].Params {
+		instructions = append(instructions, g.expr(params, param, depth)...)
+	}
+	return append(instructions, rewrite.Call(uint32(callee))), true
+}
+
+// constant draws a constant of type t, favoring the edge values
+func (g *moduleGenerator) constant(t rewrite.ValType) rewrite.Instruction {
+	edge := g.rng.Intn(3) == 0
+	switch t {
+	case rewrite.I32:
+		if edge {
+			return rewrite.I32Const([]int32{0, -1, 1, -1 << 31, 1<<31 - 1}[g.rng.Intn(5)])
+		}
+		return rewrite.I32Const(int32(g.rng.Uint32()))
+	case rewrite.I64:
+		if edge {
+			return rewrite.I64Const([]int64{0, -1, -1 << 63, 1<<63 - 1}[g.rng.Intn(4)])
+		}
+		return rewrite.I64Const(int64(g.rng.Uint64()))
+	case rewrite.F32:
+		return rewrite.F32Const(float32(g.float(edge)))
+	default:
+		return rewrite.F64Const(g.float(edge))
+	}
+}
+
+// float draws a float, or an edge value such as NaN or an infinity
+func (g *moduleGenerator) float(edge bool) float64 {
+	if edge {
+		zero := 0.0
+		return []float64{0, -zero, 1 / zero, -1 / zero, zero / zero}[g.rng.Intn(5)]
+	}
+	return g.rng.NormFloat64() * 1e6
+}
+
+// runGenerateCommand writes random modules, which validate, to seed a
+// corpus
+func runGenerateCommand(args []string) int {
+	flags := flag.NewFlagSet("generate", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	count := flags.Int("count", 10, "number of modules to write")
+	seed := flags.Int64("seed", 0, "seed drawing the modules")
+	outputDir := flags.String("output", ".", "directory to write the modules to")
+
+	if err := flags.Parse(args); err != nil || flags.NArg() != 0 || *count < 1 {
+		emitError(map[string]string{
+			"error": "usage: wasm-fuzzer generate [--count n] [--seed n] [--output dir]",
+		})
+		return 1
+	}
+
+	if err := os.MkdirAll(*outputDir, 0o755); err != nil {
+		emitError(map[string]string{
+			"error":   "failed to create output directory",
+			"details": err.Error(),
+		})
+		return 1
+	}
+	rng := rand.New(rand.NewSource(*seed))
+	corpus := GeneratedCorpus{Seed: *seed}
+	for i := 0; i < *count; i++ {
+		data, err := generateModule(rng)
+		if err != nil {
+			emitError(map[string]string{
+				"error":   "module generation failed",
+				"details": err.Error(),
+			})
+			return 1
+		}
+		path := filepath.Join(*outputDir, fmt.Sprintf("generated-%d-%d.wasm", *seed, i))
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			emitError(map[string]string{
+				"error":   "failed to write module",
+				"details": err.Error(),
+			})
+			return 1
+		}
+		corpus.Files = append(corpus.Files, path)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(corpus); err != nil {
+		emitError(map[string]string{
+			"error":   "failed to encode JSON output",
+			"details": err.Error(),
+		})
+		return 1
+	}
+	return 0
+}
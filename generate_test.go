@@ -0,0 +1,83 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mrhapile/WASM-Injection-Framework/pkg/rewrite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// -----------------------------------------------------------------------------
+// TEST: Module Generation
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// A corpus seeded with generated modules exercises the runtime's
+// arithmetic, conversions and calls on inputs no compiler emits. The
+// modules are only useful if they decode, export what they define, and
+// come out the same for a seed, so a failure can be reproduced.
+// -----------------------------------------------------------------------------
+
+func TestGenerate_ModulesDecodeAndExportEveryFunction(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	for i := 0; i < 50; i++ {
+		data, err := generateModule(rng)
+		require.NoError(t, err)
+		module, err := rewrite.Parse(data)
+		require.NoError(t, err)
+		require.NotEmpty(t, module.Functions)
+		for _, f := range module.Functions {
+			index, ok := module.ExportedFunction(fmt.Sprintf("f%d", f.Index))
+			assert.True(t, ok)
+			assert.Equal(t, f.Index, index)
+			for _, instr := range f.Body {
+				if callee, ok := instr.FuncIndex(); ok {
+					assert.Less(t, callee, f.Index, "functions only call those drawn before them")
+				}
+			}
+		}
+
+		binary, err := parseWasmBinary(data)
+		require.NoError(t, err)
+		_, err = binary.functionSignatures()
+		require.NoError(t, err)
+		features, err := detectFeatures(data)
+		require.NoError(t, err)
+		assert.Empty(t, features.sorted(), "modules need no proposal")
+	}
+}
+
+func TestGenerate_SeedGivesTheSameCorpus(t *testing.T) {
+	dirs := []string{t.TempDir(), t.TempDir()}
+	var corpora []GeneratedCorpus
+	for _, dir := range dirs {
+		var code int
+		out := captureStdout(t, func() {
+			code = runGenerateCommand([]string{"--count", "3", "--seed", "42", "--output", dir})
+		})
+		require.Equal(t, 0, code)
+		var corpus GeneratedCorpus
+		require.NoError(t, json.Unmarshal(out, &corpus))
+		require.Len(t, corpus.Files, 3)
+		corpora = append(corpora, corpus)
+	}
+	for i := range corpora[0].Files {
+		first, err := os.ReadFile(corpora[0].Files[i])
+		require.NoError(t, err)
+		second, err := os.ReadFile(corpora[1].Files[i])
+		require.NoError(t, err)
+		assert.Equal(t, first, second)
+		assert.Equal(t, filepath.Base(corpora[0].Files[i]), filepath.Base(corpora[1].Files[i]))
+	}
+
+	assert.Equal(t, 1, runGenerateCommand([]string{"--count", "0"}))
+}
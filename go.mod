@@ -4,12 +4,13 @@ go 1.21
 
 require (
 	github.com/agiledragon/gomonkey/v2 v2.11.0
+	github.com/klauspost/compress v1.17.11
 	github.com/second-state/WasmEdge-go v0.13.4
 	github.com/stretchr/testify v1.8.4
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
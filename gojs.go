@@ -0,0 +1,509 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"unicode/utf16"
+)
+
+// jsNaNHead is the high half of the NaN-boxed references syscall/js
+// passes for values that are not plain numbers
+const jsNaNHead = 0x7FF80000
+
+// syscall/js type flags, stored next to the NaN head
+const (
+	jsTypeObject   = 1
+	jsTypeString   = 2
+	jsTypeFunction = 4
+)
+
+// jsMaxArray caps the length arrays can be grown to by index
+const jsMaxArray = 1 << 20
+
+// jsNullValue is JavaScript's null; nil is undefined
+type jsNullValue struct{}
+
+var jsNull = jsNullValue{}
+
+// jsFunc implements a JavaScript function
+type jsFunc func(this interface{}, args []interface{}) (interface{}, error)
+
+// jsObject is a JavaScript object. Functions, constructors, arrays and
+// Uint8Arrays are objects with the matching field set.
+type jsObject struct {
+	props map[string]interface{}
+	// class is the constructor that created the object
+	class     *jsObject
+	call      jsFunc
+	construct func(args []interface{}) (interface{}, error)
+	// elems holds an array's elements and bytes a Uint8Array's
+	elems []interface{}
+	bytes []byte
+	array bool
+	typed bool
+}
+
+func newJSObject(props map[string]interface{}) *jsObject {
+	if props == nil {
+		props = map[string]interface{}{}
+	}
+	return &jsObject{props: props}
+}
+
+// jsFunction creates a function object
+func jsFunction(call jsFunc) *jsObject {
+	o := newJSObject(nil)
+	o.call = call
+	return o
+}
+
+// jsException is a thrown JavaScript value
+type jsException struct {
+	value interface{}
+}
+
+func (e *jsException) Error() string {
+	if o, ok := e.value.(*jsObject); ok {
+		if message, ok := o.props["message"].(string); ok {
+			return message
+		}
+	}
+	return jsString(e.value)
+}
+
+// jsRealm holds the JavaScript values a Go program refers to and the
+// globals the glue of the Go and TinyGo toolchains provides: enough of
+// Node.js for the runtime and syscall packages to start, with every
+// file system call but writes to stdout and stderr failing with ENOSYS.
+type jsRealm struct {
+	values []interface{}
+	// refs counts the references the program holds to each value; the
+	// predefined values have -1 and are never released
+	refs []int
+	ids  map[interface{}]uint32
+	pool []uint32
+
+	global, goObject, uint8Array *jsObject
+	// events are calls of Go functions waiting for the program to handle
+	// them, in order
+	events []*jsObject
+
+	output func(fd int, data []byte)
+	rng    *rand.Rand
+}
+
+func newJSRealm(output func(fd int, data []byte)) *jsRealm {
+	r := &jsRealm{output: output, rng: rand.New(rand.NewSource(0))}
+	r.goObject = newJSObject(map[string]interface{}{"_pendingEvent": jsNull})
+	r.goObject.props["_makeFuncWrapper"] = jsFunction(func(this interface{}, args []interface{}) (interface{}, error) {
+		id := jsArg(args, 0)
+		return jsFunction(func(this interface{}, args []interface{}) (interface{}, error) {
+			// The program handles the call once it is resumed
+			event := newJSObject(map[string]interface{}{"id": id, "this": this, "args": r.newArray(args)})
+			r.events = append(r.events, event)
+			return nil, nil
+		}), nil
+	})
+	r.global = r.newGlobal()
+
+	r.values = []interface{}{math.NaN(), float64(0), jsNull, true, false, r.global, r.goObject}
+	r.refs = []int{-1, -1, -1, -1, -1, -1, -1}
+	r.ids = map[interface{}]uint32{float64(0): 1, jsNull: 2, true: 3, false: 4, r.global: 5, r.goObject: 6}
+	return r
+}
+
+// newGlobal creates the global object
+func (r *jsRealm) newGlobal() *jsObject {
+	constructor := func(create func(args []interface{}) (*jsObject, error)) *jsObject {
+		class := newJSObject(nil)
+		class.construct = func(args []interface{}) (interface{}, error) {
+			o, err := create(args)
+			if o != nil {
+				o.class = class
+			}
+			return o, err
+		}
+		return class
+	}
+
+	r.uint8Array = constructor(func(args []interface{}) (*jsObject, error) {
+		switch src := jsArg(args, 0).(type) {
+		case float64:
+			if src < 0 || src > math.MaxInt32 {
+				return nil, jsRangeError("Invalid typed array length: %v", src)
+			}
+			return &jsObject{props: map[string]interface{}{}, bytes: make([]byte, int(src)), typed: true}, nil
+		case *jsObject:
+			if src.typed {
+				return &jsObject{props: map[string]interface{}{}, bytes: append([]byte(nil), src.bytes...), typed: true}, nil
+			}
+		}
+		return &jsObject{props: map[string]interface{}{}, typed: true}, nil
+	})
+	date := constructor(func(args []interface{}) (*jsObject, error) {
+		return newJSObject(map[string]interface{}{
+			"getTimezoneOffset": jsFunction(func(this interface{}, args []interface{}) (interface{}, error) { return float64(0), nil }),
+			"toTimeString": jsFunction(func(this interface{}, args []interface{}) (interface{}, error) {
+				return "00:00:00 GMT+0000 (Coordinated Universal Time)", nil
+			}),
+		}), nil
+	})
+
+	return newJSObject(map[string]interface{}{
+		"Object": constructor(func(args []interface{}) (*jsObject, error) { return newJSObject(nil), nil }),
+		"Array": constructor(func(args []interface{}) (*jsObject, error) {
+			return &jsObject{props: map[string]interface{}{}, array: true}, nil
+		}),
+		"Uint8Array": r.uint8Array,
+		"Date":       date,
+		"fs":         r.newFS(),
+		"process":    r.newProcess(),
+		"crypto": newJSObject(map[string]interface{}{
+			"getRandomValues": jsFunction(func(this interface{}, args []interface{}) (interface{}, error) {
+				array, ok := jsArg(args, 0).(*jsObject)
+				if !ok || !array.typed {
+					return nil, jsTypeError("getRandomValues needs a typed array")
+				}
+				r.rng.Read(array.bytes)
+				return array, nil
+			}),
+		}),
+	})
+}
+
+// newFS creates the fs module. Writes to stdout and stderr succeed and
+// everything else fails with ENOSYS, like the fallback of wasm_exec.js.
+func (r *jsRealm) newFS() *jsObject {
+	writeSync := func(args []interface{}) (float64, error) {
+		fd, _ := jsArg(args, 0).(float64)
+		buf, ok := jsArg(args, 1).(*jsObject)
+		if !ok || !buf.typed {
+			return 0, jsTypeError("the buffer must be a Uint8Array")
+		}
+		if fd != 1 && fd != 2 {
+			return 0, &jsException{value: jsError("write", "ENOSYS")}
+		}
+		r.output(int(fd), buf.bytes)
+		return float64(len(buf.bytes)), nil
+	}
+	callback := func(args []interface{}, result ...interface{}) (interface{}, error) {
+		if len(args) == 0 {
+			return nil, jsTypeError("the callback must be a function")
+		}
+		cb, ok := args[len(args)-1].(*jsObject)
+		if !ok || cb.call == nil {
+			return nil, jsTypeError("the callback must be a function")
+		}
+		return cb.call(nil, result)
+	}
+
+	fs := newJSObject(map[string]interface{}{
+		"constants": newJSObject(map[string]interface{}{
+			"O_WRONLY": float64(-1), "O_RDWR": float64(-1), "O_CREAT": float64(-1), "O_TRUNC": float64(-1),
+			"O_APPEND": float64(-1), "O_EXCL": float64(-1), "O_DIRECTORY": float64(-1),
+		}),
+		"writeSync": jsFunction(func(this interface{}, args []interface{}) (interface{}, error) {
+			n, err := writeSync(args)
+			if err != nil {
+				return nil, err
+			}
+			return n, nil
+		}),
+		"write": jsFunction(func(this interface{}, args []interface{}) (interface{}, error) {
+			buf, _ := jsArg(args, 1).(*jsObject)
+			if jsArg(args, 2) != float64(0) || buf == nil || jsArg(args, 3) != float64(len(buf.bytes)) || jsArg(args, 4) != jsNull {
+				return callback(args, jsError("write", "ENOSYS"))
+			}
+			n, err := writeSync(args)
+			if err != nil {
+				var thrown *jsException
+				if errors.As(err, &thrown) {
+					return callback(args, thrown.value)
+				}
+				return nil, err
+			}
+			return callback(args, jsNull, n)
+		}),
+	})
+	for _, name := range []string{
+		"chmod", "chown", "close", "fchmod", "fchown", "fstat", "fsync", "ftruncate", "lchown", "link", "lstat",
+		"mkdir", "open", "read", "readdir", "readlink", "rename", "rmdir", "stat", "symlink", "truncate", "unlink", "utimes",
+	} {
+		name := name
+		fs.props[name] = jsFunction(func(this interface{}, args []interface{}) (interface{}, error) {
+			return callback(args, jsError(name, "ENOSYS"))
+		})
+	}
+	return fs
+}
+
+// newProcess creates the process object of a process without identity or
+// working directory
+func (r *jsRealm) newProcess() *jsObject {
+	process := newJSObject(map[string]interface{}{"pid": float64(-1), "ppid": float64(-1)})
+	for _, name := range []string{"getuid", "getgid", "geteuid", "getegid"} {
+		process.props[name] = jsFunction(func(this interface{}, args []interface{}) (interface{}, error) { return float64(-1), nil })
+	}
+	for _, name := range []string{"getgroups", "umask", "cwd", "chdir"} {
+		name := name
+		process.props[name] = jsFunction(func(this interface{}, args []interface{}) (interface{}, error) {
+			return nil, &jsException{value: jsError(name, "ENOSYS")}
+		})
+	}
+	return process
+}
+
+// jsError creates a Node.js system error
+func jsError(syscall, code string) *jsObject {
+	return newJSObject(map[string]interface{}{"message": syscall + " not implemented", "code": code})
+}
+
+func jsTypeError(format string, args ...interface{}) error {
+	return &jsException{value: newJSObject(map[string]interface{}{"message": "TypeError: " + fmt.Sprintf(format, args...)})}
+}
+
+func jsRangeError(format string, args ...interface{}) error {
+	return &jsException{value: newJSObject(map[string]interface{}{"message": "RangeError: " + fmt.Sprintf(format, args...)})}
+}
+
+// jsArg returns an argument, or undefined when it is missing
+func jsArg(args []interface{}, i int) interface{} {
+	if i < len(args) {
+		return args[i]
+	}
+	return nil
+}
+
+// jsString converts a value to a string like String(value)
+func jsString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "undefined"
+	case jsNullValue:
+		return "null"
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		if math.IsNaN(v) {
+			return "NaN"
+		}
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case string:
+		return v
+	case *jsObject:
+		if v.call != nil {
+			return "function () { [native code] }"
+		}
+		return "[object Object]"
+	}
+	return fmt.Sprint(v)
+}
+
+// newArray creates an array of the given elements
+func (r *jsRealm) newArray(elems []interface{}) *jsObject {
+	return &jsObject{props: map[string]interface{}{}, elems: append([]interface{}(nil), elems...), array: true}
+}
+
+// newBytes creates a Uint8Array holding a copy of data
+func (r *jsRealm) newBytes(data []byte) *jsObject {
+	return &jsObject{props: map[string]interface{}{}, class: r.uint8Array, bytes: append([]byte(nil), data...), typed: true}
+}
+
+// box returns the reference of a value, counting the reference the
+// program now holds
+func (r *jsRealm) box(v interface{}) uint64 {
+	if f, ok := v.(float64); ok && f != 0 {
+		if math.IsNaN(f) {
+			return jsNaNHead << 32
+		}
+		return math.Float64bits(f)
+	}
+	if v == nil {
+		return 0
+	}
+
+	id, ok := r.ids[v]
+	if !ok {
+		if n := len(r.pool); n > 0 {
+			id, r.pool = r.pool[n-1], r.pool[:n-1]
+			r.values[id], r.refs[id] = v, 0
+		} else {
+			id = uint32(len(r.values))
+			r.values, r.refs = append(r.values, v), append(r.refs, 0)
+		}
+		r.ids[v] = id
+	}
+	if r.refs[id] >= 0 {
+		r.refs[id]++
+	}
+
+	var flag uint64
+	switch v := v.(type) {
+	case *jsObject:
+		flag = jsTypeObject
+		if v.call != nil {
+			flag = jsTypeFunction
+		}
+	case string:
+		flag = jsTypeString
+	}
+	return (jsNaNHead|flag)<<32 | uint64(id)
+}
+
+// unbox returns the value of a reference
+func (r *jsRealm) unbox(ref uint64) interface{} {
+	f := math.Float64frombits(ref)
+	if f == 0 {
+		return nil
+	}
+	if !math.IsNaN(f) {
+		return f
+	}
+	id := uint32(ref)
+	if int(id) >= len(r.values) {
+		return nil
+	}
+	return r.values[id]
+}
+
+// finalize drops a reference the program released
+func (r *jsRealm) finalize(id uint32) {
+	if int(id) >= len(r.refs) || r.refs[id] <= 0 {
+		return
+	}
+	r.refs[id]--
+	if r.refs[id] == 0 {
+		delete(r.ids, r.values[id])
+		r.values[id] = nil
+		r.pool = append(r.pool, id)
+	}
+}
+
+// get reads a property like Reflect.get
+func (r *jsRealm) get(v interface{}, key string) (interface{}, error) {
+	switch o := v.(type) {
+	case *jsObject:
+		if key == "length" && o.array {
+			return float64(len(o.elems)), nil
+		}
+		if key == "length" && o.typed {
+			return float64(len(o.bytes)), nil
+		}
+		return o.props[key], nil
+	case string:
+		if key == "length" {
+			return float64(len(utf16.Encode([]rune(o)))), nil
+		}
+	case nil, jsNullValue:
+		return nil, jsTypeError("Cannot read properties of %s (reading '%s')", jsString(v), key)
+	}
+	return nil, nil
+}
+
+// set writes a property like Reflect.set
+func (r *jsRealm) set(v interface{}, key string, x interface{}) error {
+	switch o := v.(type) {
+	case *jsObject:
+		o.props[key] = x
+	case nil, jsNullValue:
+		return jsTypeError("Cannot set properties of %s (setting '%s')", jsString(v), key)
+	}
+	return nil
+}
+
+// remove deletes a property like Reflect.deleteProperty
+func (r *jsRealm) remove(v interface{}, key string) error {
+	switch o := v.(type) {
+	case *jsObject:
+		delete(o.props, key)
+	case nil, jsNullValue:
+		return jsTypeError("Cannot convert %s to object", jsString(v))
+	}
+	return nil
+}
+
+// index reads an element
+func (r *jsRealm) index(v interface{}, i int64) (interface{}, error) {
+	if o, ok := v.(*jsObject); ok {
+		switch {
+		case o.array && i >= 0 && i < int64(len(o.elems)):
+			return o.elems[i], nil
+		case o.typed && i >= 0 && i < int64(len(o.bytes)):
+			return float64(o.bytes[i]), nil
+		}
+	}
+	return r.get(v, strconv.FormatInt(i, 10))
+}
+
+// setIndex writes an element, growing arrays as needed
+func (r *jsRealm) setIndex(v interface{}, i int64, x interface{}) error {
+	if o, ok := v.(*jsObject); ok && i >= 0 {
+		switch {
+		case o.array:
+			if i >= jsMaxArray {
+				return jsRangeError("Invalid array length")
+			}
+			for int64(len(o.elems)) <= i {
+				o.elems = append(o.elems, nil)
+			}
+			o.elems[i] = x
+			return nil
+		case o.typed:
+			if f, ok := x.(float64); ok && i < int64(len(o.bytes)) {
+				o.bytes[i] = byte(int64(f))
+			}
+			return nil
+		}
+	}
+	return r.set(v, strconv.FormatInt(i, 10), x)
+}
+
+// length reads the length property as an integer
+func (r *jsRealm) length(v interface{}) int64 {
+	n, err := r.get(v, "length")
+	if f, ok := n.(float64); ok && err == nil && !math.IsNaN(f) {
+		return int64(f)
+	}
+	return 0
+}
+
+// call calls a method of v
+func (r *jsRealm) call(v interface{}, method string, args []interface{}) (interface{}, error) {
+	m, err := r.get(v, method)
+	if err != nil {
+		return nil, err
+	}
+	fn, ok := m.(*jsObject)
+	if !ok || fn.call == nil {
+		return nil, jsTypeError("%s.%s is not a function", jsString(v), method)
+	}
+	return fn.call(v, args)
+}
+
+// invoke calls v as a function
+func (r *jsRealm) invoke(v interface{}, args []interface{}) (interface{}, error) {
+	fn, ok := v.(*jsObject)
+	if !ok || fn.call == nil {
+		return nil, jsTypeError("%s is not a function", jsString(v))
+	}
+	return fn.call(nil, args)
+}
+
+// construct calls v as a constructor
+func (r *jsRealm) construct(v interface{}, args []interface{}) (interface{}, error) {
+	class, ok := v.(*jsObject)
+	if !ok || class.construct == nil {
+		return nil, jsTypeError("%s is not a constructor", jsString(v))
+	}
+	return class.construct(args)
+}
+
+// instanceOf reports whether v was created by the constructor t
+func (r *jsRealm) instanceOf(v, t interface{}) bool {
+	o, ok := v.(*jsObject)
+	class, isClass := t.(*jsObject)
+	return ok && isClass && o.class == class
+}
@@ -0,0 +1,750 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+)
+
+// ABIGo runs programs compiled by Go for GOOS=js or by TinyGo, whose
+// entries are functions the program registers on the global object
+const ABIGo = "go"
+
+// Import modules of the glue: gojs since Go 1.21 and in TinyGo, go before
+const (
+	goModule       = "gojs"
+	goLegacyModule = "go"
+)
+
+// goArgvOffset is where wasm_exec.js writes the program's arguments
+const goArgvOffset = 4096
+
+// goMemoryExport is the memory exported by programs compiled by Go
+const goMemoryExport = "mem"
+
+// goMaxSteps bounds the events and timers one call runs, so programs that
+// never go idle, such as tickers, cannot stall a run
+const goMaxSteps = 10000
+
+// goMaxStderr caps the standard error kept for exit messages
+const goMaxStderr = 4096
+
+// goHost tracks the kernel of the Go program currently loaded
+type goHost struct {
+	kernel *goKernel
+	// output captures what the program writes to stdout and stderr
+	output *outputCapture
+}
+
+// goTimer is a pending setTimeout of the glue
+type goTimer struct {
+	due float64
+	// export is called when the timer fires
+	export string
+}
+
+// goKernel is the JavaScript glue of one Go or TinyGo program instance,
+// on a clock that starts at wasiClock and only advances when a timer fires
+type goKernel struct {
+	realm  *jsRealm
+	memory *hostMemory
+	wasi   *minimalWASI
+	module WasmModule
+	// tinygo is set for programs compiled by TinyGo, whose imports pass
+	// arguments directly instead of on the Go stack
+	tinygo bool
+
+	timers    map[int32]goTimer
+	nextTimer int32
+	// now is the time since the program started, in milliseconds
+	now float64
+
+	exited bool
+	code   int32
+	stderr []byte
+	// capture receives everything the program writes
+	capture *outputCapture
+}
+
+func newGoKernel() *goKernel {
+	k := &goKernel{memory: &hostMemory{}, timers: map[int32]goTimer{}}
+	k.realm = newJSRealm(k.output)
+	k.wasi = newMinimalWASI(k.memory)
+	k.wasi.output = k.output
+	return k
+}
+
+// output handles the program's writes to stdout and stderr; only the
+// start of stderr is kept for exit errors
+func (k *goKernel) output(fd int, data []byte) {
+	k.capture.write(fd, data)
+	if fd == 2 && len(k.stderr) < goMaxStderr {
+		k.stderr = append(k.stderr, data[:min(len(data), goMaxStderr-len(k.stderr))]...)
+	}
+}
+
+// exit records the program's exit
+func (k *goKernel) exit(code int32) {
+	k.exited, k.code = true, code
+}
+
+// exitError reports an unsuccessful exit with the first line the program
+// wrote to stderr, which holds the panic message
+func (k *goKernel) exitError() error {
+	if !k.exited || k.code == 0 {
+		return nil
+	}
+	message := fmt.Sprintf("go: exited with code %d", k.code)
+	if line, _, _ := bytes.Cut(bytes.TrimSpace(k.stderr), []byte("\n")); len(line) > 0 {
+		message += ": " + string(line)
+	}
+	return &RuntimeError{Stage: StageExecute, Message: message}
+}
+
+// schedule starts a timer calling export after delay milliseconds
+func (k *goKernel) schedule(delay float64, export string) int32 {
+	k.nextTimer++
+	k.timers[k.nextTimer] = goTimer{due: k.now + max(delay, 0), export: export}
+	return k.nextTimer
+}
+
+// nanos is the wall-clock time in nanoseconds
+func (k *goKernel) nanos() int64 {
+	return wasiClock + int64(k.now*1e6)
+}
+
+// goFrame reads and writes the arguments of an import call at an address:
+// the Go stack for programs compiled by Go, or a result area for TinyGo.
+// The first memory error is kept and returned by done.
+type goFrame struct {
+	k    *goKernel
+	addr uint64
+	err  error
+}
+
+func (f *goFrame) read(off, n uint64) []byte {
+	if f.err == nil {
+		data, err := f.k.memory.read(f.addr+off, n)
+		if err == nil {
+			return data
+		}
+		f.err = err
+	}
+	return make([]byte, min(n, 8))
+}
+
+func (f *goFrame) write(off uint64, data []byte) {
+	if f.err == nil {
+		f.err = f.k.memory.write(f.addr+off, data)
+	}
+}
+
+func (f *goFrame) u64(off uint64) uint64 {
+	return binary.LittleEndian.Uint64(f.read(off, 8))
+}
+
+func (f *goFrame) u32(off uint64) uint32 {
+	return uint32(f.u64(off))
+}
+
+func (f *goFrame) setU64(off, v uint64) {
+	f.write(off, binary.LittleEndian.AppendUint64(nil, v))
+}
+
+func (f *goFrame) setU32(off uint64, v uint32) {
+	f.write(off, binary.LittleEndian.AppendUint32(nil, v))
+}
+
+func (f *goFrame) setByte(off uint64, v bool) {
+	if v {
+		f.write(off, []byte{1})
+	} else {
+		f.write(off, []byte{0})
+	}
+}
+
+// slice reads the pointer and length of a Go slice or string
+func (f *goFrame) slice(off uint64) (uint64, uint64) {
+	return f.u64(off), f.u64(off + 8)
+}
+
+func (f *goFrame) str(off uint64) string {
+	ptr, n := f.slice(off)
+	return string((&goFrame{k: f.k, addr: ptr, err: f.err}).read(0, n))
+}
+
+func (f *goFrame) value(off uint64) interface{} {
+	return f.k.realm.unbox(f.u64(off))
+}
+
+func (f *goFrame) setValue(off uint64, v interface{}) {
+	f.setU64(off, f.k.realm.box(v))
+}
+
+// values reads n references stored at ptr
+func (f *goFrame) values(ptr, n uint64) []interface{} {
+	if n > jsMaxArray {
+		f.err = fmt.Errorf("%d arguments exceed the limit of %d", n, jsMaxArray)
+		return nil
+	}
+	array := &goFrame{k: f.k, addr: ptr}
+	values := make([]interface{}, n)
+	for i := range values {
+		values[i] = array.value(uint64(i) * 8)
+	}
+	if f.err == nil {
+		f.err = array.err
+	}
+	return values
+}
+
+// result stores the result of a call that may throw, with the flag that
+// tells the program whether it did
+func (f *goFrame) result(off, flag uint64, v interface{}, err error) {
+	var thrown *jsException
+	switch {
+	case err == nil:
+		f.setValue(off, v)
+		f.setByte(flag, true)
+	case errors.As(err, &thrown):
+		f.setValue(off, thrown.value)
+		f.setByte(flag, false)
+	default:
+		f.err = err
+	}
+}
+
+// copyBytes copies between a slice and a Uint8Array, storing the count
+// and whether the value was a Uint8Array
+func (f *goFrame) copyBytes(count, flag uint64, array interface{}, copyFn func(a *jsObject) int) {
+	o, ok := array.(*jsObject)
+	if !ok || !o.typed {
+		f.setByte(flag, false)
+		return
+	}
+	n := copyFn(o)
+	if f.k.tinygo {
+		f.setU32(count, uint32(n))
+	} else {
+		f.setU64(count, uint64(n))
+	}
+	f.setByte(flag, true)
+}
+
+func (f *goFrame) done() ([]interface{}, error) {
+	return nil, f.err
+}
+
+// gcFunctions are the imports of programs compiled by Go, which pass the
+// address of their arguments on the Go stack
+func (k *goKernel) gcFunctions() map[string]nativeFunction {
+	fn := func(call func(f *goFrame)) nativeFunction {
+		return nativeFunction{funcSig("i32", ""), func(args []uint64) ([]interface{}, error) {
+			f := &goFrame{k: k, addr: uint64(uint32(args[0]))}
+			call(f)
+			return f.done()
+		}}
+	}
+	realm := k.realm
+
+	return map[string]nativeFunction{
+		"runtime.wasmExit": fn(func(f *goFrame) { k.exit(int32(f.u32(8))) }),
+		"runtime.wasmWrite": fn(func(f *goFrame) {
+			fd, ptr, n := f.u64(8), f.u64(16), uint64(f.u32(24))
+			data := (&goFrame{k: k, addr: ptr}).read(0, n)
+			k.output(int(fd), data)
+		}),
+		"runtime.resetMemoryDataView": fn(func(f *goFrame) {}),
+		"runtime.nanotime1":           fn(func(f *goFrame) { f.setU64(8, uint64(k.nanos())) }),
+		"runtime.walltime": fn(func(f *goFrame) {
+			ns := k.nanos()
+			f.setU64(8, uint64(ns/1e9))
+			f.setU32(16, uint32(ns%1e9))
+		}),
+		"runtime.scheduleTimeoutEvent": fn(func(f *goFrame) {
+			f.setU32(16, uint32(k.schedule(float64(int64(f.u64(8))), "resume")))
+		}),
+		"runtime.clearTimeoutEvent": fn(func(f *goFrame) { delete(k.timers, int32(f.u32(8))) }),
+		"runtime.getRandomData": fn(func(f *goFrame) {
+			ptr, n := f.slice(8)
+			if n > wasiMaxRandom {
+				f.err = fmt.Errorf("%d random bytes exceed the limit of %d", n, wasiMaxRandom)
+				return
+			}
+			buf := make([]byte, n)
+			realm.rng.Read(buf)
+			(&goFrame{k: k, addr: ptr, err: f.err}).write(0, buf)
+		}),
+		"syscall/js.finalizeRef": fn(func(f *goFrame) { realm.finalize(f.u32(8)) }),
+		"syscall/js.stringVal":   fn(func(f *goFrame) { f.setValue(24, f.str(8)) }),
+		"syscall/js.valueGet": fn(func(f *goFrame) {
+			v, err := realm.get(f.value(8), f.str(16))
+			f.err = errors.Join(f.err, err)
+			f.setValue(32, v)
+		}),
+		"syscall/js.valueSet": fn(func(f *goFrame) {
+			f.err = errors.Join(f.err, realm.set(f.value(8), f.str(16), f.value(32)))
+		}),
+		"syscall/js.valueDelete": fn(func(f *goFrame) {
+			f.err = errors.Join(f.err, realm.remove(f.value(8), f.str(16)))
+		}),
+		"syscall/js.valueIndex": fn(func(f *goFrame) {
+			v, err := realm.index(f.value(8), int64(f.u64(16)))
+			f.err = errors.Join(f.err, err)
+			f.setValue(24, v)
+		}),
+		"syscall/js.valueSetIndex": fn(func(f *goFrame) {
+			f.err = errors.Join(f.err, realm.setIndex(f.value(8), int64(f.u64(16)), f.value(24)))
+		}),
+		"syscall/js.valueCall": fn(func(f *goFrame) {
+			v, method := f.value(8), f.str(16)
+			ptr, n := f.slice(32)
+			args := f.values(ptr, n)
+			if f.err == nil {
+				result, err := realm.call(v, method, args)
+				f.result(56, 64, result, err)
+			}
+		}),
+		"syscall/js.valueInvoke": fn(func(f *goFrame) {
+			v := f.value(8)
+			ptr, n := f.slice(16)
+			args := f.values(ptr, n)
+			if f.err == nil {
+				result, err := realm.invoke(v, args)
+				f.result(40, 48, result, err)
+			}
+		}),
+		"syscall/js.valueNew": fn(func(f *goFrame) {
+			v := f.value(8)
+			ptr, n := f.slice(16)
+			args := f.values(ptr, n)
+			if f.err == nil {
+				result, err := realm.construct(v, args)
+				f.result(40, 48, result, err)
+			}
+		}),
+		"syscall/js.valueLength": fn(func(f *goFrame) { f.setU64(16, uint64(realm.length(f.value(8)))) }),
+		"syscall/js.valuePrepareString": fn(func(f *goFrame) {
+			str := []byte(jsString(f.value(8)))
+			f.setValue(16, realm.newBytes(str))
+			f.setU64(24, uint64(len(str)))
+		}),
+		"syscall/js.valueLoadString": fn(func(f *goFrame) {
+			ptr, n := f.slice(16)
+			if str, ok := f.value(8).(*jsObject); ok && str.typed {
+				(&goFrame{k: k, addr: ptr, err: f.err}).write(0, str.bytes[:min(uint64(len(str.bytes)), n)])
+			}
+		}),
+		"syscall/js.valueInstanceOf": fn(func(f *goFrame) { f.setByte(24, realm.instanceOf(f.value(8), f.value(16))) }),
+		"syscall/js.copyBytesToGo": fn(func(f *goFrame) {
+			ptr, n := f.slice(8)
+			f.copyBytes(40, 48, f.value(32), func(src *jsObject) int {
+				data := src.bytes[:min(uint64(len(src.bytes)), n)]
+				(&goFrame{k: k, addr: ptr, err: f.err}).write(0, data)
+				return len(data)
+			})
+		}),
+		"syscall/js.copyBytesToJS": fn(func(f *goFrame) {
+			ptr, n := f.slice(16)
+			f.copyBytes(40, 48, f.value(8), func(dst *jsObject) int {
+				data := (&goFrame{k: k, addr: ptr}).read(0, min(uint64(len(dst.bytes)), n))
+				return copy(dst.bytes, data)
+			})
+		}),
+		"debug": fn(func(f *goFrame) {}),
+	}
+}
+
+// tinyGoFunctions are the imports of programs compiled by TinyGo, which
+// pass references as i64 and results through an address
+func (k *goKernel) tinyGoFunctions() map[string]nativeFunction {
+	realm := k.realm
+	frame := func(addr uint64) *goFrame { return &goFrame{k: k, addr: uint64(uint32(addr))} }
+	str := func(ptr, n uint64) string { return string(frame(ptr).read(0, uint64(uint32(n)))) }
+	ref := func(v interface{}) []interface{} { return []interface{}{int64(realm.box(v))} }
+	fail := func(err error) ([]interface{}, error) { return nil, err }
+
+	return map[string]nativeFunction{
+		"runtime.ticks": {funcSig("", "f64"), func(args []uint64) ([]interface{}, error) {
+			return []interface{}{k.now}, nil
+		}},
+		"runtime.sleepTicks": {funcSig("f64", ""), func(args []uint64) ([]interface{}, error) {
+			k.schedule(math.Float64frombits(args[0]), "go_scheduler")
+			return nil, nil
+		}},
+		"syscall/js.finalizeRef": {funcSig("i64", ""), func(args []uint64) ([]interface{}, error) {
+			// TinyGo has no finalizers, so references are never released
+			return nil, nil
+		}},
+		"syscall/js.stringVal": {funcSig("i32 i32", "i64"), func(args []uint64) ([]interface{}, error) {
+			return ref(str(args[0], args[1])), nil
+		}},
+		"syscall/js.valueGet": {funcSig("i64 i32 i32", "i64"), func(args []uint64) ([]interface{}, error) {
+			v, err := realm.get(realm.unbox(args[0]), str(args[1], args[2]))
+			if err != nil {
+				return fail(err)
+			}
+			return ref(v), nil
+		}},
+		"syscall/js.valueSet": {funcSig("i64 i32 i32 i64", ""), func(args []uint64) ([]interface{}, error) {
+			return nil, realm.set(realm.unbox(args[0]), str(args[1], args[2]), realm.unbox(args[3]))
+		}},
+		"syscall/js.valueDelete": {funcSig("i64 i32 i32", ""), func(args []uint64) ([]interface{}, error) {
+			return nil, realm.remove(realm.unbox(args[0]), str(args[1], args[2]))
+		}},
+		"syscall/js.valueIndex": {funcSig("i64 i32", "i64"), func(args []uint64) ([]interface{}, error) {
+			v, err := realm.index(realm.unbox(args[0]), int64(int32(args[1])))
+			if err != nil {
+				return fail(err)
+			}
+			return ref(v), nil
+		}},
+		"syscall/js.valueSetIndex": {funcSig("i64 i32 i64", ""), func(args []uint64) ([]interface{}, error) {
+			return nil, realm.setIndex(realm.unbox(args[0]), int64(int32(args[1])), realm.unbox(args[2]))
+		}},
+		"syscall/js.valueCall": {funcSig("i32 i64 i32 i32 i32 i32 i32", ""), func(args []uint64) ([]interface{}, error) {
+			f := frame(args[0])
+			values := f.values(uint64(uint32(args[4])), uint64(uint32(args[5])))
+			if f.err == nil {
+				result, err := realm.call(realm.unbox(args[1]), str(args[2], args[3]), values)
+				f.result(0, 8, result, err)
+			}
+			return f.done()
+		}},
+		"syscall/js.valueInvoke": {funcSig("i32 i64 i32 i32 i32", ""), func(args []uint64) ([]interface{}, error) {
+			f := frame(args[0])
+			values := f.values(uint64(uint32(args[2])), uint64(uint32(args[3])))
+			if f.err == nil {
+				result, err := realm.invoke(realm.unbox(args[1]), values)
+				f.result(0, 8, result, err)
+			}
+			return f.done()
+		}},
+		"syscall/js.valueNew": {funcSig("i32 i64 i32 i32 i32", ""), func(args []uint64) ([]interface{}, error) {
+			f := frame(args[0])
+			values := f.values(uint64(uint32(args[2])), uint64(uint32(args[3])))
+			if f.err == nil {
+				result, err := realm.construct(realm.unbox(args[1]), values)
+				f.result(0, 8, result, err)
+			}
+			return f.done()
+		}},
+		"syscall/js.valueLength": {funcSig("i64", "i32"), func(args []uint64) ([]interface{}, error) {
+			return []interface{}{int32(realm.length(realm.unbox(args[0])))}, nil
+		}},
+		"syscall/js.valuePrepareString": {funcSig("i32 i64", ""), func(args []uint64) ([]interface{}, error) {
+			f := frame(args[0])
+			str := []byte(jsString(realm.unbox(args[1])))
+			f.setValue(0, realm.newBytes(str))
+			f.setU32(8, uint32(len(str)))
+			return f.done()
+		}},
+		"syscall/js.valueLoadString": {funcSig("i64 i32 i32 i32", ""), func(args []uint64) ([]interface{}, error) {
+			if str, ok := realm.unbox(args[0]).(*jsObject); ok && str.typed {
+				n := min(uint64(len(str.bytes)), uint64(uint32(args[2])))
+				return nil, k.memory.write(uint64(uint32(args[1])), str.bytes[:n])
+			}
+			return nil, nil
+		}},
+		"syscall/js.valueInstanceOf": {funcSig("i64 i64", "i32"), func(args []uint64) ([]interface{}, error) {
+			if realm.instanceOf(realm.unbox(args[0]), realm.unbox(args[1])) {
+				return []interface{}{int32(1)}, nil
+			}
+			return []interface{}{int32(0)}, nil
+		}},
+		"syscall/js.copyBytesToGo": {funcSig("i32 i32 i32 i32 i64", ""), func(args []uint64) ([]interface{}, error) {
+			f := frame(args[0])
+			f.copyBytes(0, 4, realm.unbox(args[4]), func(src *jsObject) int {
+				data := src.bytes[:min(uint64(len(src.bytes)), uint64(uint32(args[2])))]
+				f.err = errors.Join(f.err, k.memory.write(uint64(uint32(args[1])), data))
+				return len(data)
+			})
+			return f.done()
+		}},
+		"syscall/js.copyBytesToJS": {funcSig("i32 i64 i32 i32 i32", ""), func(args []uint64) ([]interface{}, error) {
+			f := frame(args[0])
+			f.copyBytes(0, 4, realm.unbox(args[1]), func(dst *jsObject) int {
+				src := frame(args[2])
+				data := src.read(0, min(uint64(len(dst.bytes)), uint64(uint32(args[3]))))
+				f.err = errors.Join(f.err, src.err)
+				return copy(dst.bytes, data)
+			})
+			return f.done()
+		}},
+	}
+}
+
+// link binds the program's imports. Programs compiled by Go import
+// runtime.wasmExit, which TinyGo's runtime lacks. TinyGo's WASI imports
+// use the minimal WASI; functions it lacks return ENOSYS, and proc_exit
+// ends the program.
+func (k *goKernel) link(imports []wasmFuncImport) ([]HostFunction, error) {
+	k.tinygo = true
+	for _, imp := range imports {
+		if (imp.Module == goModule || imp.Module == goLegacyModule) && imp.Name == "runtime.wasmExit" {
+			k.tinygo = false
+		}
+	}
+	functions := k.tinyGoFunctions()
+	if !k.tinygo {
+		functions = k.gcFunctions()
+	}
+
+	host, err := k.wasi.linkAll(imports)
+	if err != nil {
+		return nil, err
+	}
+	for i, fn := range host {
+		if fn.Name == "proc_exit" {
+			call := fn.Call
+			host[i].Call = func(args []interface{}) ([]interface{}, error) {
+				k.exit(args[0].(int32))
+				return call(args)
+			}
+		}
+	}
+	for _, imp := range imports {
+		if imp.Module != goModule && imp.Module != goLegacyModule {
+			continue
+		}
+		fn, ok := functions[imp.Name]
+		if !ok {
+			host = append(host, unsupportedFunction(imp))
+			continue
+		}
+		bound, err := fn.bind(imp)
+		if err != nil {
+			return nil, err
+		}
+		host = append(host, bound)
+	}
+	return host, nil
+}
+
+// start runs the program as wasm_exec.js does, until it exits or waits
+// for calls. Programs compiled by Go get "js" as their only argument.
+func (k *goKernel) start() error {
+	export := "run"
+	var args []interface{}
+	if k.tinygo {
+		export = "_start"
+		if typed, ok := k.module.(SignatureModule); ok {
+			if _, found := typed.Signature(export); !found {
+				export = "_initialize"
+			}
+		}
+	} else {
+		argv := &goFrame{k: k, addr: goArgvOffset}
+		argv.write(0, []byte("js\x00\x00\x00\x00\x00\x00"))
+		// argv, then an empty environment, each ending with a null pointer
+		argv.setU64(8, goArgvOffset)
+		argv.setU64(16, 0)
+		argv.setU64(24, 0)
+		if argv.err != nil {
+			return &RuntimeError{Stage: StageInstantiate, Message: fmt.Sprintf("go: writing arguments: %v", argv.err)}
+		}
+		args = []interface{}{int32(1), int32(goArgvOffset + 8)}
+	}
+
+	if err := k.run(export, args...); err != nil {
+		return err
+	}
+	if err := k.drive(); err != nil {
+		return err
+	}
+	return k.exitError()
+}
+
+// run calls an export of the program. A trap after the program exited,
+// as TinyGo's proc_exit causes, is its exit.
+func (k *goKernel) run(export string, args ...interface{}) error {
+	_, err := k.module.Execute(export, args...)
+	if err == nil || k.exited {
+		return nil
+	}
+	stage, message := classifyError(err, StageExecute, "execution failed")
+	return &RuntimeError{Stage: stage, Message: fmt.Sprintf("go: %s: %s", export, message)}
+}
+
+// drive resumes the program for each pending call and then each timer,
+// advancing the clock to the timer, until it is idle or exits
+func (k *goKernel) drive() error {
+	for step := 0; step < goMaxSteps && !k.exited; step++ {
+		export := "resume"
+		if len(k.realm.events) > 0 {
+			k.realm.goObject.props["_pendingEvent"] = k.realm.events[0]
+			k.realm.events = k.realm.events[1:]
+		} else if len(k.timers) > 0 {
+			ids := make([]int32, 0, len(k.timers))
+			for id := range k.timers {
+				ids = append(ids, id)
+			}
+			sort.Slice(ids, func(i, j int) bool {
+				a, b := k.timers[ids[i]], k.timers[ids[j]]
+				return a.due < b.due || (a.due == b.due && ids[i] < ids[j])
+			})
+			timer := k.timers[ids[0]]
+			delete(k.timers, ids[0])
+			k.now = max(k.now, timer.due)
+			export = timer.export
+		} else {
+			return nil
+		}
+		if err := k.run(export); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// call calls a function the program registered on the global object,
+// passing numbers as JavaScript numbers, strings as strings and other
+// buffers as Uint8Arrays. Numbers and booleans are returned.
+func (k *goKernel) call(name string, args []interface{}) ([]interface{}, error) {
+	if k.exited {
+		return nil, &RuntimeError{Stage: StageExecute, Message: "go: the program has exited"}
+	}
+	fn, ok := k.realm.global.props[name].(*jsObject)
+	if !ok || fn.call == nil {
+		return nil, &RuntimeError{Stage: StageExecute, Message: fmt.Sprintf("go: the program defines no function '%s'", name)}
+	}
+
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case int32:
+			values[i] = float64(v)
+		case int64:
+			values[i] = float64(v)
+		case float32:
+			values[i] = float64(v)
+		case float64:
+			values[i] = v
+		case bufferArg:
+			if v.source.Type == "string" {
+				values[i] = string(v.data)
+			} else {
+				values[i] = k.realm.newBytes(v.data)
+			}
+		}
+	}
+
+	queued := len(k.realm.events)
+	result, err := fn.call(nil, values)
+	if err != nil {
+		return nil, &RuntimeError{Stage: StageExecute, Message: fmt.Sprintf("go: %s: %v", name, err)}
+	}
+	var event *jsObject
+	if len(k.realm.events) > queued {
+		event = k.realm.events[queued]
+	}
+	if err := k.drive(); err != nil {
+		return nil, err
+	}
+	if err := k.exitError(); err != nil {
+		return nil, err
+	}
+	if event != nil {
+		result = event.props["result"]
+	}
+
+	switch v := result.(type) {
+	case float64:
+		return []interface{}{v}, nil
+	case bool:
+		if v {
+			return []interface{}{int32(1)}, nil
+		}
+		return []interface{}{int32(0)}, nil
+	}
+	return nil, nil
+}
+
+// goRuntime loads Go programs with a fresh kernel linked to their imports
+// and starts them. The wrapped runtime must implement HostLoader.
+type goRuntime struct {
+	runtime WasmRuntime
+	host    *goHost
+}
+
+// LoadModule implements WasmRuntime.LoadModule
+func (r *goRuntime) LoadModule(filePath string) (WasmModule, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, &RuntimeError{Stage: StageLoad, Message: fmt.Sprintf("load failed: %v", err)}
+	}
+	return r.load(filePath, nil, data)
+}
+
+// LoadModuleBytes implements BufferLoader.LoadModuleBytes
+func (r *goRuntime) LoadModuleBytes(name string, data []byte) (WasmModule, error) {
+	return r.load(name, data, data)
+}
+
+func (r *goRuntime) load(filePath string, source, data []byte) (WasmModule, error) {
+	loader, ok := r.runtime.(HostLoader)
+	if !ok {
+		return nil, &RuntimeError{Stage: StageInstantiate, Message: "go: runtime cannot provide host functions"}
+	}
+
+	kernel := newGoKernel()
+	kernel.capture = r.host.output
+	host, err := kernel.link(moduleImports(data))
+	if err != nil {
+		return nil, &RuntimeError{Stage: StageInstantiate, Message: fmt.Sprintf("go: %v", err)}
+	}
+	if binary, err := parseWasmBinary(data); err == nil {
+		if exports, err := binary.exportNames(); err == nil && exports[goMemoryExport] {
+			kernel.memory.name = goMemoryExport
+		}
+	}
+	module, err := loader.LoadModuleWithHost(filePath, source, host)
+	if err != nil {
+		return nil, err
+	}
+
+	memory, ok := module.(MemoryModule)
+	if !ok {
+		module.Close()
+		return nil, &RuntimeError{Stage: StageInstantiate, Message: "go: runtime does not support memory access"}
+	}
+	kernel.memory.module, kernel.module = memory, module
+	if err := kernel.start(); err != nil {
+		module.Close()
+		return nil, err
+	}
+	r.host.kernel = kernel
+	return module, nil
+}
+
+// goArguments binds inputs to the parameters of a function the program
+// registered, whose type is not known: plain numbers are passed as i32
+func (c InvocationConfig) goArguments() ([][]interface{}, error) {
+	buffers := c.Buffers.withDefaults()
+	calls := make([][]interface{}, len(c.Inputs))
+	for i, input := range c.Inputs {
+		args, err := bindArguments(input, nil, buffers)
+		if err != nil {
+			return nil, &RuntimeError{Stage: StageSignature, Message: fmt.Sprintf("signature mismatch: input %d: %v", i, err)}
+		}
+		calls[i] = args
+	}
+	return calls, nil
+}
+
+// callsGoFunction reports whether the entry is a function the program
+// registered rather than an export, as with TinyGo's //export
+func (c InvocationConfig) callsGoFunction(module WasmModule) bool {
+	if c.golang == nil || c.golang.kernel == nil {
+		return false
+	}
+	if typed, ok := module.(SignatureModule); ok {
+		_, exported := typed.Signature(c.Entry)
+		return !exported
+	}
+	return true
+}
@@ -0,0 +1,290 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// References to the values syscall/js predefines
+const (
+	jsZeroRef   = jsNaNHead<<32 | 1
+	jsNullRef   = jsNaNHead<<32 | 2
+	jsGlobalRef = (jsNaNHead|jsTypeObject)<<32 | 5
+	jsGoRef     = (jsNaNHead|jsTypeObject)<<32 | 6
+)
+
+// goStack is where mock programs compiled by Go keep their import frames
+const goStack = 32768
+
+// goProgram is a mock program compiled by Go whose exports drive the glue
+// through its imports the way the Go runtime does
+type goProgram struct {
+	*contractModule
+	t *testing.T
+}
+
+// js calls a Go import with the given words stored in its frame
+func (p *goProgram) js(name string, words ...uint64) {
+	for i, word := range words {
+		binary.LittleEndian.PutUint64(p.memory[goStack+8+8*i:], word)
+	}
+	_, err := p.call(name, int32(goStack))
+	require.NoError(p.t, err)
+}
+
+// word reads a word of the last frame
+func (p *goProgram) word(off int) uint64 {
+	return binary.LittleEndian.Uint64(p.memory[goStack+off:])
+}
+
+// str stores a string, returning the pointer and length words
+func (p *goProgram) str(s string) (uint64, uint64) {
+	return uint64(p.put(s)), uint64(len(s))
+}
+
+// slice stores references, returning the slice words
+func (p *goProgram) slice(refs ...uint64) (uint64, uint64, uint64) {
+	ptr := p.bump(int32(8*len(refs)), 8)[0].(int32)
+	for i, ref := range refs {
+		binary.LittleEndian.PutUint64(p.memory[int(ptr)+8*i:], ref)
+	}
+	return uint64(ptr), uint64(len(refs)), uint64(len(refs))
+}
+
+func (p *goProgram) get(v uint64, prop string) uint64 {
+	ptr, n := p.str(prop)
+	p.js("syscall/js.valueGet", v, ptr, n)
+	return p.word(32)
+}
+
+func (p *goProgram) set(v uint64, prop string, x uint64) {
+	ptr, n := p.str(prop)
+	p.js("syscall/js.valueSet", v, ptr, n, x)
+}
+
+func (p *goProgram) index(v uint64, i uint64) uint64 {
+	p.js("syscall/js.valueIndex", v, i)
+	return p.word(24)
+}
+
+// callMethod calls a method, returning its result and whether it did not
+// throw
+func (p *goProgram) callMethod(v uint64, method string, args ...uint64) (uint64, bool) {
+	ptr, n := p.str(method)
+	argsPtr, argsLen, argsCap := p.slice(args...)
+	p.js("syscall/js.valueCall", v, ptr, n, argsPtr, argsLen, argsCap)
+	return p.word(56), p.memory[goStack+64] == 1
+}
+
+// funcOf registers a Go function as js.FuncOf does
+func (p *goProgram) funcOf(id float64) uint64 {
+	fn, ok := p.callMethod(jsGoRef, "_makeFuncWrapper", math.Float64bits(id))
+	require.True(p.t, ok)
+	return fn
+}
+
+// pendingEvent takes the call the program was resumed for
+func (p *goProgram) pendingEvent() uint64 {
+	event := p.get(jsGoRef, "_pendingEvent")
+	p.set(jsGoRef, "_pendingEvent", jsNullRef)
+	return event
+}
+
+// exit writes a message to stderr and exits, as a panic does
+func (p *goProgram) exit(code uint64, message string) {
+	ptr, n := p.str(message)
+	p.js("runtime.wasmWrite", 2, ptr, n)
+	p.js("runtime.wasmExit", code)
+}
+
+var gcImports = []string{
+	"runtime.wasmExit", "runtime.wasmWrite", "syscall/js.valueGet", "syscall/js.valueSet",
+	"syscall/js.valueIndex", "syscall/js.valueCall", "syscall/js.valueNew", "syscall/js.copyBytesToJS",
+}
+
+// newGoProgram creates a mock program with the given exports
+func newGoProgram(t *testing.T, exports map[string]func(p *goProgram, args []interface{}) ([]interface{}, error)) func() *contractModule {
+	return func() *contractModule {
+		signatures := map[string]FuncSignature{"run": funcSig("i32 i32", ""), "resume": funcSig("", "")}
+		p := &goProgram{t: t}
+		wrapped := map[string]contractExport{}
+		for name, export := range exports {
+			export := export
+			wrapped[name] = func(m *contractModule, args []interface{}) ([]interface{}, error) { return export(p, args) }
+		}
+		p.contractModule = newContractModule(signatures, wrapped)
+		return p.contractModule
+	}
+}
+
+// doublerProgram registers a "double" function that panics on 13
+func doublerProgram(t *testing.T) func() *contractModule {
+	return newGoProgram(t, map[string]func(p *goProgram, args []interface{}) ([]interface{}, error){
+		"run": func(p *goProgram, args []interface{}) ([]interface{}, error) {
+			argv := int(args[1].(int32))
+			arg := binary.LittleEndian.Uint64(p.memory[argv:])
+			assert.Equal(t, "js", string(p.memory[arg:arg+2]), "the program is named js")
+			p.set(jsGlobalRef, "double", p.funcOf(1))
+			return nil, nil
+		},
+		"resume": func(p *goProgram, args []interface{}) ([]interface{}, error) {
+			event := p.pendingEvent()
+			x := math.Float64frombits(p.index(p.get(event, "args"), 0))
+			if x == 13 {
+				p.exit(2, "panic: unlucky\n\ngoroutine 1 [running]:\n")
+				return nil, nil
+			}
+			p.set(event, "result", math.Float64bits(2*x))
+			return nil, nil
+		},
+	})
+}
+
+// -----------------------------------------------------------------------------
+// TEST: Go and TinyGo Programs
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Go and TinyGo programs only run under their toolchain's JavaScript glue:
+// they reach the host through syscall/js references, export functions by
+// registering them on the global object, and wait for calls and timers
+// between runs of the scheduler. Without that glue they fail to
+// instantiate, and nothing past the runtime's startup is ever fuzzed.
+// -----------------------------------------------------------------------------
+
+func TestGo_References(t *testing.T) {
+	r := newJSRealm(func(int, []byte) {})
+
+	assert.Equal(t, uint64(0), r.box(nil))
+	assert.Equal(t, math.Float64bits(1.5), r.box(1.5))
+	assert.Equal(t, uint64(jsZeroRef), r.box(float64(0)), "zero is not undefined")
+	assert.True(t, math.IsNaN(r.unbox(r.box(math.NaN())).(float64)))
+
+	hello := r.box("hello")
+	assert.Equal(t, hello, r.box("hello"), "strings are interned")
+	assert.Equal(t, uint64(jsNaNHead|jsTypeString), hello>>32)
+	assert.Equal(t, "hello", r.unbox(hello))
+
+	r.finalize(uint32(hello))
+	assert.Equal(t, "hello", r.unbox(hello), "one reference is left")
+	r.finalize(uint32(hello))
+	assert.Nil(t, r.unbox(hello))
+	assert.Equal(t, uint32(hello), uint32(r.box("reused")), "released IDs are reused")
+
+	_, err := r.get(nil, "x")
+	assert.EqualError(t, err, "TypeError: Cannot read properties of undefined (reading 'x')")
+	_, err = r.call(r.global, "missing", nil)
+	assert.EqualError(t, err, "TypeError: [object Object].missing is not a function")
+}
+
+func TestGo_CallsRegisteredFunctions(t *testing.T) {
+	runtime := &contractMockRuntime{newContract: doublerProgram(t)}
+	binary := contractBinary(goModule, newGoKernel().gcFunctions(), gcImports...)
+	plan := InvocationConfig{ABI: ABIGo, Entry: "double", Inputs: i32Inputs(2, 13, 4)}
+
+	result := runContract(t, binary, runtime, plan)
+	require.Len(t, result.Invocations, 3)
+	assert.Equal(t, []interface{}{float64(4)}, result.Invocations[0].ReturnValues)
+	assert.Equal(t, "go: exited with code 2: panic: unlucky", result.Invocations[1].ErrorMessage)
+	assert.Equal(t, "go: the program has exited", result.Invocations[2].ErrorMessage)
+
+	runtime.stateful, plan.Snapshot = true, true
+	result = runContract(t, binary, runtime, plan)
+	require.Len(t, result.Invocations, 3)
+	assert.Equal(t, []interface{}{float64(8)}, result.Invocations[2].ReturnValues, "each input runs in a fresh program, even where snapshots are supported")
+
+	plan.Entry = "triple"
+	result = runContract(t, binary, runtime, plan)
+	assert.Equal(t, "invocation 0: go: the program defines no function 'triple'", result.ErrorMessage)
+}
+
+func TestGo_AsynchronousWrites(t *testing.T) {
+	var written float64
+	program := newGoProgram(t, map[string]func(p *goProgram, args []interface{}) ([]interface{}, error){
+		"run": func(p *goProgram, args []interface{}) ([]interface{}, error) {
+			argsPtr, argsLen, argsCap := p.slice(math.Float64bits(5))
+			p.js("syscall/js.valueNew", p.get(jsGlobalRef, "Uint8Array"), argsPtr, argsLen, argsCap)
+			buf := p.word(40)
+			ptr, n := p.str("oops\n")
+			p.js("syscall/js.copyBytesToJS", buf, ptr, n, n)
+			assert.Equal(t, uint64(5), p.word(40))
+
+			fs := p.get(jsGlobalRef, "fs")
+			_, ok := p.callMethod(fs, "write", math.Float64bits(2), buf, jsZeroRef, math.Float64bits(5), jsNullRef, p.funcOf(1))
+			assert.True(t, ok)
+			return nil, nil
+		},
+		"resume": func(p *goProgram, args []interface{}) ([]interface{}, error) {
+			// The write's callback gets (null, n)
+			callbackArgs := p.get(p.pendingEvent(), "args")
+			assert.Equal(t, uint64(jsNullRef), p.index(callbackArgs, 0))
+			written = math.Float64frombits(p.index(callbackArgs, 1))
+			p.js("runtime.wasmExit", 3)
+			return nil, nil
+		},
+	})
+
+	binary := contractBinary(goModule, newGoKernel().gcFunctions(), gcImports...)
+	result := runContract(t, binary, &contractMockRuntime{newContract: program}, InvocationConfig{ABI: ABIGo})
+	assert.Equal(t, float64(5), written)
+	assert.Equal(t, StageExecute, result.FailureStage)
+	assert.Equal(t, "go: exited with code 3: oops", result.ErrorMessage)
+}
+
+func TestGo_TinyGoTimersAndExports(t *testing.T) {
+	var ticks []interface{}
+	functions := newGoKernel().tinyGoFunctions()
+	imports := []wasmFuncImport{
+		{Module: goModule, Name: "runtime.ticks", Signature: functions["runtime.ticks"].signature},
+		{Module: goModule, Name: "runtime.sleepTicks", Signature: functions["runtime.sleepTicks"].signature},
+		{Module: wasiModule, Name: "proc_exit", Signature: funcSig("i32", "")},
+	}
+	newProgram := func(exitCode int32) func() *contractModule {
+		return func() *contractModule {
+			signatures := map[string]FuncSignature{"_start": funcSig("", ""), "process": funcSig("i32", "i32")}
+			return newContractModule(signatures, map[string]contractExport{
+				"_start": func(m *contractModule, args []interface{}) ([]interface{}, error) {
+					if exitCode != 0 {
+						_, err := m.call("proc_exit", exitCode)
+						return nil, err
+					}
+					_, err := m.host["runtime.sleepTicks"].Call([]interface{}{float64(250)})
+					return nil, err
+				},
+				"go_scheduler": func(m *contractModule, args []interface{}) ([]interface{}, error) {
+					now, err := m.host["runtime.ticks"].Call(nil)
+					ticks = append(ticks, now...)
+					return nil, err
+				},
+				"process": func(m *contractModule, args []interface{}) ([]interface{}, error) {
+					return []interface{}{args[0].(int32) + 1}, nil
+				},
+			})
+		}
+	}
+
+	binary := pluginBinary(imports...)
+	result := runContract(t, binary, &contractMockRuntime{newContract: newProgram(0)}, InvocationConfig{ABI: ABIGo, Inputs: i32Inputs(1)})
+	require.True(t, result.Success, result.ErrorMessage)
+	assert.Equal(t, []interface{}{int32(2)}, result.ReturnValues, "exported functions are called directly")
+	assert.Equal(t, []interface{}{float64(250)}, ticks, "the clock advances to the timer")
+
+	result = runContract(t, binary, &contractMockRuntime{newContract: newProgram(1)}, InvocationConfig{ABI: ABIGo})
+	assert.Equal(t, "go: exited with code 1", result.ErrorMessage)
+}
+
+func TestGo_RuntimeWithoutHostFunctions(t *testing.T) {
+	binary := contractBinary(goModule, newGoKernel().gcFunctions(), gcImports...)
+	mockRuntime := &MockWasmRuntime{LoadModuleFunc: func(filePath string) (WasmModule, error) { return &MockWasmModule{}, nil }}
+
+	result := runContract(t, binary, mockRuntime, InvocationConfig{ABI: ABIGo})
+	assert.Equal(t, StageInstantiate, result.FailureStage)
+	assert.Equal(t, "go: runtime cannot provide host functions", result.ErrorMessage)
+}
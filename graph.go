@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// GraphFormatDOT is the Graphviz format of --emit-graph
+const GraphFormatDOT = "dot"
+
+// graphModule is one corpus file in the import graph
+type graphModule struct {
+	name    string
+	imports []wasmFuncImport
+	// exports are the module's exported function names, sorted
+	exports []string
+	// err is set when the module could not be decoded
+	err error
+}
+
+// importGraph relates the modules of a corpus to the host functions they
+// import. It is built from the binaries alone, without running anything.
+type importGraph struct {
+	modules []graphModule
+}
+
+// buildImportGraph decodes the imports and exports of every file. Files
+// that cannot be read or decoded are kept as nodes without edges.
+func buildImportGraph(files []string) *importGraph {
+	graph := &importGraph{}
+	for _, file := range files {
+		module := graphModule{name: filepath.Base(file)}
+		data, err := os.ReadFile(file)
+		var binary *wasmBinary
+		if err == nil {
+			binary, err = parseWasmBinary(data)
+		}
+		if err == nil {
+			module.imports, err = binary.functionImports()
+		}
+		var exports map[string]uint32
+		if err == nil {
+			exports, err = binary.functionExports()
+		}
+		for name := range exports {
+			module.exports = append(module.exports, name)
+		}
+		sort.Strings(module.exports)
+		module.err = err
+		graph.modules = append(graph.modules, module)
+	}
+	return graph
+}
+
+// writeDOT writes the graph in Graphviz format. Each module points at the
+// host functions it imports, which are grouped by import module and drawn
+// heavier the more modules import them. A corpus module named like an
+// import module, such as env.wasm for "env", is linked to the imports it
+// exports.
+func (g *importGraph) writeDOT(w io.Writer) error {
+	users := make(map[string]int)
+	byModule := make(map[string][]string)
+	for _, module := range g.modules {
+		for _, imp := range uniqueImports(module.imports) {
+			key := importKey(imp)
+			if users[key] == 0 {
+				byModule[imp.Module] = append(byModule[imp.Module], imp.Name)
+			}
+			users[key]++
+		}
+	}
+	importModules := make([]string, 0, len(byModule))
+	for name := range byModule {
+		importModules = append(importModules, name)
+		sort.Strings(byModule[name])
+	}
+	sort.Strings(importModules)
+
+	var b strings.Builder
+	b.WriteString("digraph corpus {\n")
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString("  node [fontname=\"monospace\"];\n")
+
+	for i, importModule := range importModules {
+		fmt.Fprintf(&b, "  subgraph cluster_%d {\n", i)
+		fmt.Fprintf(&b, "    label=%s;\n", dotQuote(importModule))
+		for _, name := range byModule[importModule] {
+			key := importKey(wasmFuncImport{Module: importModule, Name: name})
+			count := users[key]
+			fmt.Fprintf(&b, "    %s [label=%s, penwidth=%.1f];\n",
+				dotQuote(key), dotLabel(name, pluralize(count, "module")), 1+math.Log2(float64(count)))
+		}
+		b.WriteString("  }\n")
+	}
+
+	for _, module := range g.modules {
+		id := dotQuote("module:" + module.name)
+		if module.err != nil {
+			fmt.Fprintf(&b, "  %s [shape=box, style=dashed, label=%s];\n", id, dotLabel(module.name, "unreadable"))
+			continue
+		}
+		fmt.Fprintf(&b, "  %s [shape=box, label=%s];\n", id, dotLabel(module.name, pluralize(len(module.exports), "export")))
+		for _, imp := range uniqueImports(module.imports) {
+			fmt.Fprintf(&b, "  %s -> %s;\n", id, dotQuote(importKey(imp)))
+		}
+	}
+
+	// Modules providing imports of other modules
+	for _, module := range g.modules {
+		provides := strings.TrimSuffix(module.name, filepath.Ext(module.name))
+		for _, name := range module.exports {
+			key := importKey(wasmFuncImport{Module: provides, Name: name})
+			if users[key] > 0 {
+				fmt.Fprintf(&b, "  %s -> %s [style=dashed, label=\"provides\"];\n", dotQuote(key), dotQuote("module:"+module.name))
+			}
+		}
+	}
+
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// uniqueImports drops repeated imports of the same function
+func uniqueImports(imports []wasmFuncImport) []wasmFuncImport {
+	seen := make(map[string]bool)
+	var unique []wasmFuncImport
+	for _, imp := range imports {
+		if key := importKey(imp); !seen[key] {
+			seen[key] = true
+			unique = append(unique, imp)
+		}
+	}
+	return unique
+}
+
+// importKey is the node ID of an imported function
+func importKey(imp wasmFuncImport) string {
+	return "import:" + imp.Module + "." + imp.Name
+}
+
+// pluralize formats a count of things
+func pluralize(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("1 %s", noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// dotQuote quotes a string as a DOT ID
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+// dotLabel quotes lines as a DOT label
+func dotLabel(lines ...string) string {
+	quoted := make([]string, len(lines))
+	for i, line := range lines {
+		quoted[i] = strings.TrimSuffix(strings.TrimPrefix(dotQuote(line), `"`), `"`)
+	}
+	return `"` + strings.Join(quoted, `\n`) + `"`
+}
+
+// emitGraph writes the import graph of a corpus to path
+func emitGraph(format, path string, files []string) error {
+	if format != GraphFormatDOT {
+		return fmt.Errorf("unknown graph format %q", format)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = buildImportGraph(files).writeDOT(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
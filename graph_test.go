@@ -0,0 +1,72 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// -----------------------------------------------------------------------------
+// TEST: Import Graph
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Which host functions a corpus depends on decides which ones are worth
+// implementing or injecting faults into. The graph has to count each
+// function's importers correctly and stay valid DOT for any module names.
+// -----------------------------------------------------------------------------
+
+func TestGraph_WritesDOT(t *testing.T) {
+	dir := t.TempDir()
+	log := wasmFuncImport{Module: "env", Name: "log", Signature: funcSig("i32", "")}
+	clock := wasmFuncImport{Module: wasiModule, Name: "clock_time_get", Signature: funcSig("i32 i64 i32", "i32")}
+	files := map[string][]byte{
+		"a.wasm":      pluginBinary(log, log, clock),
+		"b.wasm":      pluginBinary(log),
+		"env.wasm":    pluginBinary(),
+		"broken.wasm": []byte("not wasm"),
+	}
+	for name, data := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0o644))
+	}
+	paths, err := collectWasmFiles(dir)
+	require.NoError(t, err)
+
+	var out strings.Builder
+	require.NoError(t, buildImportGraph(paths).writeDOT(&out))
+	dot := out.String()
+
+	assert.True(t, strings.HasPrefix(dot, "digraph corpus {\n"))
+	assert.Contains(t, dot, `"import:env.log" [label="log\n2 modules", penwidth=2.0];`)
+	assert.Contains(t, dot, `"import:wasi_snapshot_preview1.clock_time_get" [label="clock_time_get\n1 module", penwidth=1.0];`)
+	assert.Contains(t, dot, `label="wasi_snapshot_preview1";`)
+	assert.Equal(t, 1, strings.Count(dot, `"module:a.wasm" -> "import:env.log";`), "repeated imports are drawn once")
+	assert.Contains(t, dot, `"module:b.wasm" -> "import:env.log";`)
+	assert.Contains(t, dot, `"module:broken.wasm" [shape=box, style=dashed, label="broken.wasm\nunreadable"];`)
+	assert.NotContains(t, dot, "provides", "env.wasm exports no function anyone imports")
+}
+
+func TestGraph_LinksProvidingModules(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "app.wasm"), pluginBinary(wasmFuncImport{Module: "lib", Name: "run", Signature: funcSig("", "i32")}), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "lib.wasm"), pluginBinary(), 0o644))
+	paths, err := collectWasmFiles(dir)
+	require.NoError(t, err)
+
+	var out strings.Builder
+	require.NoError(t, buildImportGraph(paths).writeDOT(&out))
+	assert.Contains(t, out.String(), `"import:lib.run" -> "module:lib.wasm" [style=dashed, label="provides"];`)
+}
+
+func TestGraph_QuotesIDs(t *testing.T) {
+	assert.Equal(t, `"a\"b\\c"`, dotQuote(`a"b\c`))
+	assert.Equal(t, `"x\"\ny"`, dotLabel(`x"`, "y"))
+	assert.EqualError(t, emitGraph("svg", filepath.Join(t.TempDir(), "g"), nil), `unknown graph format "svg"`)
+}
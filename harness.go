@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// wasmHeader is the WASM binary magic number followed by version 1
+var wasmHeader = []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+
+// BufferLoader is implemented by runtimes that can load a module directly
+// from memory instead of from a file
+type BufferLoader interface {
+	LoadModuleBytes(name string, data []byte) (WasmModule, error)
+}
+
+// bufferRuntime adapts in-memory module bytes to the path-based pipeline
+type bufferRuntime struct {
+	runtime WasmRuntime
+	data    []byte
+}
+
+// LoadModule implements WasmRuntime.LoadModule, ignoring the path's contents
+func (r *bufferRuntime) LoadModule(filePath string) (WasmModule, error) {
+	if loader, ok := r.runtime.(BufferLoader); ok {
+		return loader.LoadModuleBytes(filePath, r.data)
+	}
+
+	// Fall back to a temporary file for runtimes that only load from disk
+	tmp, err := os.CreateTemp("", "wasm-fuzzer-input-*.wasm")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp module: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(r.data)
+	tmp.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to write temp module: %w", err)
+	}
+	return r.runtime.LoadModule(tmp.Name())
+}
+
+// stageModule writes a copy of the file rewritten by rewrite, returning
+// its path and a function removing it
+func stageModule(filePath string, rewrite func(data []byte) ([]byte, error)) (string, func(), error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", nil, err
+	}
+	if data, err = rewrite(data); err != nil {
+		return "", nil, err
+	}
+
+	tmp, err := os.CreateTemp("", "wasm-fuzzer-staged-*.wasm")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create temp module: %w", err)
+	}
+	cleanup := func() { os.Remove(tmp.Name()) }
+	_, err = tmp.Write(data)
+	tmp.Close()
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to write temp module: %w", err)
+	}
+	return tmp.Name(), cleanup, nil
+}
+
+// wrapModuleBytes prepends the WASM header to inputs that lack it, so
+// fuzzer mutations explore section contents instead of all failing on the
+// magic number check
+func wrapModuleBytes(data []byte) []byte {
+	if bytes.HasPrefix(data, wasmHeader[:4]) {
+		return data
+	}
+	wrapped := make([]byte, 0, len(wasmHeader)+len(data))
+	wrapped = append(wrapped, wasmHeader...)
+	return append(wrapped, data...)
+}
+
+// harnessRuntime is the runtime driven by FuzzOneInput, created on first use
+var harnessRuntime WasmRuntime
+
+// FuzzOneInput is a go-fuzz/libFuzzer style entry point. It treats data as
+// a WASM module, runs it through the full pipeline, and panics only when
+// the host side panicked, so the driving fuzzer records real harness or
+// runtime crashes rather than ordinary module failures. It returns 1 for
+// inputs that reached the execute stage, which fuzzers use to prioritize
+// them, and 0 otherwise.
+func FuzzOneInput(data []byte) int {
+	if harnessRuntime == nil {
+		runtime, err := newRuntime(Environment{})
+		if err != nil {
+			panic(fmt.Sprintf("failed to create runtime: %v", err))
+		}
+		harnessRuntime = runtime
+	}
+
+	runtime := &bufferRuntime{runtime: harnessRuntime, data: wrapModuleBytes(data)}
+	result := processWasmFileWithRuntime("fuzz-input.wasm", runtime)
+
+	if strings.HasPrefix(result.ErrorMessage, "panic recovered") {
+		panic(result.ErrorMessage)
+	}
+	if result.Success || result.FailureStage == StageExecute {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,98 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// useHarnessRuntime installs the runtime FuzzOneInput drives for a test
+func useHarnessRuntime(t *testing.T, runtime WasmRuntime) {
+	harnessRuntime = runtime
+	t.Cleanup(func() { harnessRuntime = nil })
+}
+
+// -----------------------------------------------------------------------------
+// TEST: libFuzzer-Compatible Harness
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// External fuzzers treat a panic as a crash. The harness must stay silent
+// for ordinary module failures (they are the expected outcome of random
+// bytes) and only panic when the host side itself panicked.
+// -----------------------------------------------------------------------------
+
+func TestHarness_WrapsHeaderlessInput(t *testing.T) {
+	assert.Equal(t, append(append([]byte{}, wasmHeader...), 0x01, 0x02), wrapModuleBytes([]byte{0x01, 0x02}))
+
+	valid := append(append([]byte{}, wasmHeader...), 0x00)
+	assert.Equal(t, valid, wrapModuleBytes(valid), "inputs with a header are passed through")
+}
+
+func TestHarness_ModuleFailuresDoNotCrash(t *testing.T) {
+	var loaded []byte
+	useHarnessRuntime(t, &MockWasmRuntime{
+		LoadModuleFunc: func(filePath string) (WasmModule, error) {
+			loaded, _ = os.ReadFile(filePath)
+			return nil, &RuntimeError{Stage: StageLoad, Message: "malformed section"}
+		},
+	})
+
+	assert.NotPanics(t, func() {
+		assert.Equal(t, 0, FuzzOneInput([]byte{0xff}))
+	})
+	assert.Equal(t, wrapModuleBytes([]byte{0xff}), loaded, "runtime should see the wrapped bytes")
+}
+
+func TestHarness_PrioritizesExecutedInputs(t *testing.T) {
+	useHarnessRuntime(t, &MockWasmRuntime{})
+
+	assert.Equal(t, 1, FuzzOneInput(wasmHeader))
+}
+
+func TestHarness_HostPanicPropagates(t *testing.T) {
+	useHarnessRuntime(t, &MockWasmRuntime{
+		LoadModuleFunc: func(filePath string) (WasmModule, error) {
+			return &MockWasmModule{
+				ExecuteFunc: func(funcName string, args ...interface{}) ([]interface{}, error) {
+					panic("CGO boundary violation")
+				},
+			}, nil
+		},
+	})
+
+	assert.PanicsWithValue(t, "panic recovered: CGO boundary violation", func() {
+		FuzzOneInput(wasmHeader)
+	})
+}
+
+// bufferMockRuntime records in-memory loads
+type bufferMockRuntime struct {
+	MockWasmRuntime
+	data []byte
+}
+
+func (r *bufferMockRuntime) LoadModuleBytes(name string, data []byte) (WasmModule, error) {
+	r.data = data
+	return &MockWasmModule{}, nil
+}
+
+func TestHarness_PrefersBufferLoader(t *testing.T) {
+	runtime := &bufferMockRuntime{
+		MockWasmRuntime: MockWasmRuntime{
+			LoadModuleFunc: func(filePath string) (WasmModule, error) {
+				t.Fatal("file loading should not be used when a buffer loader exists")
+				return nil, nil
+			},
+		},
+	}
+	useHarnessRuntime(t, runtime)
+
+	FuzzOneInput([]byte{0x42})
+
+	assert.Equal(t, wrapModuleBytes([]byte{0x42}), runtime.data)
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// HeartbeatConfig reports the progress of a campaign to an orchestrator
+// that restarts wedged ones, such as a Kubernetes liveness probe
+type HeartbeatConfig struct {
+	// File is rewritten as the campaign makes progress, at most once a
+	// second, so its modification time is the last progress
+	File string `yaml:"file"`
+	// Addr serves the heartbeat over HTTP, such as ":8081"
+	Addr string `yaml:"addr"`
+	// Stale is how long a campaign may make no progress before Addr
+	// reports it wedged (default 5m)
+	Stale time.Duration `yaml:"stale"`
+}
+
+// check rejects a negative staleness
+func (c HeartbeatConfig) check() error {
+	if c.Stale < 0 {
+		return errors.New("heartbeat: stale must not be negative")
+	}
+	return nil
+}
+
+// Heartbeat is the progress of a campaign, as the heartbeat file and
+// endpoint report it
+type Heartbeat struct {
+	PID int `json:"pid"`
+	// State is running, or finished once the campaign is done
+	State   string    `json:"state"`
+	Started time.Time `json:"started"`
+	// Updated is the last progress: a file starting, or entering a stage
+	Updated time.Time `json:"updated"`
+	// Files counts the jobs of the campaign, and Done those behind it
+	Files int `json:"files"`
+	Done  int `json:"done"`
+	// File and Stage are where the campaign is
+	File  string       `json:"file,omitempty"`
+	Stage FailureStage `json:"stage,omitempty"`
+}
+
+// heartbeatWriteInterval is the least time between two writes of the
+// heartbeat file
+var heartbeatWriteInterval = time.Second
+
+// heartbeat beats as the campaign makes progress, nil when none is kept
+type heartbeat struct {
+	config  HeartbeatConfig
+	mu      sync.Mutex
+	state   Heartbeat
+	written time.Time
+	failed  bool
+	server  *http.Server
+	notify  func(stage FailureStage)
+}
+
+// startHeartbeat starts beating and serving the heartbeat. The pipeline's
+// stages beat for files run in process, and workers beat for theirs.
+func startHeartbeat(config HeartbeatConfig) (*heartbeat, error) {
+	if config.File == "" && config.Addr == "" {
+		return nil, nil
+	}
+	if config.Stale == 0 {
+		config.Stale = 5 * time.Minute
+	}
+	now := time.Now().UTC()
+	h := &heartbeat{config: config, state: Heartbeat{PID: os.Getpid(), State: "running", Started: now, Updated: now}}
+	if config.Addr != "" {
+		listener, err := net.Listen("tcp", config.Addr)
+		if err != nil {
+			return nil, fmt.Errorf("heartbeat: %w", err)
+		}
+		mux := http.NewServeMux()
+		mux.HandleFunc("/healthz", h.serve)
+		h.server = &http.Server{Handler: mux}
+		go h.server.Serve(listener)
+	}
+	h.notify = stageStarted
+	stageStarted = func(stage FailureStage) {
+		h.notify(stage)
+		h.stage(stage)
+	}
+	h.beat(true)
+	return h, nil
+}
+
+// watch has isolated workers beat for the stages of their files
+func (h *heartbeat) watch(pools ...[]*isolatedWorker) {
+	for _, workers := range pools {
+		for _, worker := range workers {
+			worker.heartbeat = h
+		}
+	}
+}
+
+// progress beats for a file starting, after done of the files jobs
+func (h *heartbeat) progress(files, done int, filePath string) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	h.state.Files, h.state.Done, h.state.File, h.state.Stage = files, done, filePath, ""
+	h.mu.Unlock()
+	h.beat(false)
+}
+
+// stage beats for the file entering a stage
+func (h *heartbeat) stage(stage FailureStage) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	h.state.Stage = stage
+	h.mu.Unlock()
+	h.beat(false)
+}
+
+// beat records progress, writing the heartbeat file unless it was written
+// less than heartbeatWriteInterval ago
+func (h *heartbeat) beat(force bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := time.Now().UTC()
+	h.state.Updated = now
+	if h.config.File == "" || h.failed || (!force && now.Sub(h.written) < heartbeatWriteInterval) {
+		return
+	}
+	h.written = now
+	if err := h.write(); err != nil {
+		// The orchestrator will see the file go stale; saying why once is
+		// enough
+		h.failed = true
+		emitError(map[string]string{"warning": "failed to write heartbeat", "details": err.Error()})
+	}
+}
+
+// write replaces the heartbeat file, so a probe never reads half of it
+func (h *heartbeat) write() error {
+	data, err := json.Marshal(h.state)
+	if err != nil {
+		return err
+	}
+	temp := filepath.Join(filepath.Dir(h.config.File), "."+filepath.Base(h.config.File)+".tmp")
+	if err := os.WriteFile(temp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(temp, h.config.File)
+}
+
+// serve answers 200 with the heartbeat while the campaign makes progress,
+// and 503 once it made none for the stale time
+func (h *heartbeat) serve(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	state := h.state
+	h.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	if state.State == "running" && time.Since(state.Updated) >= h.config.Stale {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(state)
+}
+
+// stop writes the heartbeat as finished and stops serving it
+func (h *heartbeat) stop() {
+	if h == nil {
+		return
+	}
+	stageStarted = h.notify
+	h.mu.Lock()
+	h.state.State, h.state.File, h.state.Stage = "finished", "", ""
+	h.state.Done = h.state.Files
+	h.mu.Unlock()
+	h.beat(true)
+	if h.server != nil {
+		h.server.Close()
+	}
+}
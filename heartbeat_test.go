@@ -0,0 +1,106 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readHeartbeat reads a heartbeat file
+func readHeartbeat(t *testing.T, path string) Heartbeat {
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var state Heartbeat
+	require.NoError(t, json.Unmarshal(data, &state))
+	return state
+}
+
+// -----------------------------------------------------------------------------
+// TEST: Heartbeat
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// A campaign wedged in native code looks alive to an orchestrator: the
+// process is still there. Only a heartbeat that stops with progress lets
+// a liveness probe tell a wedged campaign from a slow one and restart it.
+// -----------------------------------------------------------------------------
+
+func TestHeartbeat_FollowsCampaign(t *testing.T) {
+	original := heartbeatWriteInterval
+	heartbeatWriteInterval = 0
+	t.Cleanup(func() { heartbeatWriteInterval = original })
+
+	dir := t.TempDir()
+	for _, name := range []string{"a.wasm", "b.wasm"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(name), 0o644))
+	}
+	path := filepath.Join(t.TempDir(), "heartbeat.json")
+	var seen []Heartbeat
+	runtime := &MockWasmRuntime{LoadModuleFunc: func(filePath string) (WasmModule, error) {
+		err := runStage(StageInstantiate, func() error { return nil })
+		seen = append(seen, readHeartbeat(t, path))
+		return &MockWasmModule{}, err
+	}}
+
+	_, err := runFuzzerWithMatrix(dir, []environmentRuntime{{Runtime: runtime}}, RunOptions{Heartbeat: HeartbeatConfig{File: path}})
+	require.NoError(t, err)
+
+	require.Len(t, seen, 2)
+	for i, state := range seen {
+		assert.Equal(t, "running", state.State)
+		assert.Equal(t, os.Getpid(), state.PID)
+		assert.Equal(t, 2, state.Files)
+		assert.Equal(t, i, state.Done)
+		assert.Equal(t, StageInstantiate, state.Stage)
+	}
+	assert.Equal(t, filepath.Join(dir, "b.wasm"), seen[1].File)
+
+	final := readHeartbeat(t, path)
+	assert.Equal(t, "finished", final.State)
+	assert.Equal(t, 2, final.Done)
+	assert.Empty(t, final.File)
+	assert.False(t, final.Updated.Before(seen[1].Updated))
+}
+
+func TestHeartbeat_ServesStaleness(t *testing.T) {
+	h, err := startHeartbeat(HeartbeatConfig{Addr: "127.0.0.1:0", Stale: 30 * time.Millisecond})
+	require.NoError(t, err)
+	defer h.stop()
+	healthz := func() int {
+		recorder := httptest.NewRecorder()
+		h.serve(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		return recorder.Code
+	}
+
+	h.progress(10, 3, "a.wasm")
+	assert.Equal(t, http.StatusOK, healthz())
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, http.StatusServiceUnavailable, healthz(), "no progress for the stale time")
+	h.stage(StageExecute)
+	assert.Equal(t, http.StatusOK, healthz(), "a stage is progress")
+}
+
+func TestHeartbeat_RejectsBusyAddress(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	_, err = startHeartbeat(HeartbeatConfig{Addr: listener.Addr().String()})
+	assert.ErrorContains(t, err, "heartbeat: ")
+	assert.Error(t, HeartbeatConfig{Stale: -time.Second}.check())
+
+	h, err := startHeartbeat(HeartbeatConfig{})
+	require.NoError(t, err)
+	assert.Nil(t, h, "no heartbeat unless configured")
+}
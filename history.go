@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ModuleHistory is what earlier campaigns saw of a module
+type ModuleHistory struct {
+	FilePath string `json:"file_path"`
+	// Runs counts the campaigns that ran the module, and Failures those
+	// in which it failed under any environment
+	Runs     int       `json:"runs"`
+	Failures int       `json:"failures"`
+	LastRun  time.Time `json:"last_run"`
+	// LastFailed is set when the module failed in the latest campaign to
+	// run it
+	LastFailed bool `json:"last_failed"`
+	// FailureRate is the share of campaigns in which the module failed,
+	// each weighing as much as all earlier ones together
+	FailureRate float64 `json:"failure_rate"`
+	// Flips counts the campaigns whose outcome differed from the one
+	// before, as a flaky module's does
+	Flips int `json:"flips"`
+	// FailingSince is when a module that had passed before started
+	// failing, while it keeps failing
+	FailingSince *time.Time `json:"failing_since,omitempty"`
+	// Millis holds the milliseconds the module took to run in each of its
+	// latest campaigns, under all environments together, oldest first
+	Millis []float64 `json:"durations_ms,omitempty"`
+}
+
+// historyTimings is how many campaigns' timings a module keeps
+const historyTimings = 20
+
+// historyCampaigns is how many campaigns the history sums up
+const historyCampaigns = 1000
+
+// CampaignRecord sums up the results a campaign ran
+type CampaignRecord struct {
+	Started time.Time `json:"started"`
+	Results int       `json:"results"`
+	Passed  int       `json:"passed"`
+	// Failures counts the failed results by stage
+	Failures map[FailureStage]int `json:"failures,omitempty"`
+	// MeanMillis is the mean time a result took to run
+	MeanMillis float64 `json:"mean_ms"`
+}
+
+// passRate is the share of the campaign's results that passed
+func (c CampaignRecord) passRate() float64 {
+	if c.Results == 0 {
+		return 0
+	}
+	return float64(c.Passed) / float64(c.Results)
+}
+
+// conclude adds the outcome of a campaign to the history of a module
+func (m *ModuleHistory) conclude(failed bool, at time.Time) {
+	outcome := 0.0
+	if failed {
+		outcome = 1
+	}
+	if m.Runs == 0 {
+		m.FailureRate = outcome
+	} else {
+		m.FailureRate = (m.FailureRate + outcome) / 2
+		if failed != m.LastFailed {
+			m.Flips++
+		}
+		if failed && !m.LastFailed {
+			m.FailingSince = &at
+		}
+	}
+	if !failed {
+		m.FailingSince = nil
+	}
+	m.Runs++
+	if failed {
+		m.Failures++
+	}
+	m.LastRun, m.LastFailed = at, failed
+}
+
+// failureLikelihood estimates how likely the module is to fail when it
+// runs again: the larger of its failure rate and the share of campaigns
+// that flipped its outcome
+func (m ModuleHistory) failureLikelihood() float64 {
+	likelihood := m.FailureRate
+	if m.Runs > 1 {
+		if flakiness := float64(m.Flips) / float64(m.Runs-1); flakiness > likelihood {
+			likelihood = flakiness
+		}
+	}
+	return likelihood
+}
+
+// historyFile is the JSON the history is kept in: modules by hash, and
+// the campaigns that ran them, oldest first
+type historyFile struct {
+	Modules   map[string]*ModuleHistory `json:"modules"`
+	Campaigns []CampaignRecord          `json:"campaigns,omitempty"`
+}
+
+// campaignHistory is the history of a campaign, nil when none is kept
+type campaignHistory struct {
+	path    string
+	file    historyFile
+	started time.Time
+	// names holds the module each file name last had
+	names map[string]string
+	// hashes caches the hash of each file, ran holds the file of each
+	// module this campaign ran, failed the modules it saw fail and took
+	// the time each took
+	hashes map[string]string
+	ran    map[string]string
+	failed map[string]bool
+	took   map[string]time.Duration
+	// campaign sums up the results this campaign ran, which took total
+	campaign CampaignRecord
+	total    time.Duration
+}
+
+// loadHistory reads the history kept at path, which starts empty when its
+// file does not exist yet
+func loadHistory(path string) (*campaignHistory, error) {
+	if path == "" {
+		return nil, nil
+	}
+	h := &campaignHistory{
+		path:    path,
+		file:    historyFile{Modules: make(map[string]*ModuleHistory)},
+		started: time.Now().UTC(),
+		names:   make(map[string]string),
+		hashes:  make(map[string]string),
+		ran:     make(map[string]string),
+		failed:  make(map[string]bool),
+		took:    make(map[string]time.Duration),
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return h, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+	if err := json.Unmarshal(data, &h.file); err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+	if h.file.Modules == nil {
+		h.file.Modules = make(map[string]*ModuleHistory)
+	}
+	latest := make(map[string]time.Time)
+	for hash, entry := range h.file.Modules {
+		name := filepath.Base(entry.FilePath)
+		if entry.LastRun.After(latest[name]) || h.names[name] == "" {
+			h.names[name], latest[name] = hash, entry.LastRun
+		}
+	}
+	return h, nil
+}
+
+// hash returns the SHA-256 of a file, hashing each file once
+func (h *campaignHistory) hash(filePath string) string {
+	hash, ok := h.hashes[filePath]
+	if !ok {
+		hash = fileHash(filePath)
+		h.hashes[filePath] = hash
+	}
+	return hash
+}
+
+// lookup returns what earlier campaigns saw of a file's module
+func (h *campaignHistory) lookup(filePath string) (ModuleHistory, bool) {
+	if h == nil {
+		return ModuleHistory{}, false
+	}
+	entry, ok := h.file.Modules[h.hash(filePath)]
+	if !ok {
+		return ModuleHistory{}, false
+	}
+	return *entry, true
+}
+
+// changed reports whether a file holds another module than when it last
+// ran
+func (h *campaignHistory) changed(filePath string) bool {
+	if h == nil {
+		return false
+	}
+	last, ok := h.names[filepath.Base(filePath)]
+	return ok && last != h.hash(filePath)
+}
+
+// record adds a result run by this campaign, which took the given time,
+// to the history. Skipped and cached results were not run, so they are
+// left out.
+func (h *campaignHistory) record(result ExecutionResult, took time.Duration) {
+	if h == nil || result.Skipped || result.Cached {
+		return
+	}
+	hash := h.hash(result.FilePath)
+	if hash == "" {
+		return
+	}
+	h.ran[hash] = result.FilePath
+	h.took[hash] += took
+	h.campaign.Results++
+	h.total += took
+	if result.Success {
+		h.campaign.Passed++
+		return
+	}
+	h.failed[hash] = true
+	if h.campaign.Failures == nil {
+		h.campaign.Failures = make(map[FailureStage]int)
+	}
+	h.campaign.Failures[result.FailureStage]++
+}
+
+// save writes the history back with the outcome of the modules this
+// campaign ran. A module failing under any environment failed.
+func (h *campaignHistory) save() error {
+	if h == nil || len(h.ran) == 0 {
+		return nil
+	}
+	for hash, filePath := range h.ran {
+		entry := h.file.Modules[hash]
+		if entry == nil {
+			entry = &ModuleHistory{}
+			h.file.Modules[hash] = entry
+		}
+		entry.FilePath = filePath
+		entry.conclude(h.failed[hash], h.started)
+		entry.Millis = append(entry.Millis, millis(h.took[hash]))
+		if len(entry.Millis) > historyTimings {
+			entry.Millis = entry.Millis[len(entry.Millis)-historyTimings:]
+		}
+	}
+	campaign := h.campaign
+	campaign.Started = h.started
+	campaign.MeanMillis = millis(h.total) / float64(campaign.Results)
+	h.file.Campaigns = append(h.file.Campaigns, campaign)
+	if len(h.file.Campaigns) > historyCampaigns {
+		h.file.Campaigns = h.file.Campaigns[len(h.file.Campaigns)-historyCampaigns:]
+	}
+	h.ran, h.failed, h.took = make(map[string]string), make(map[string]bool), make(map[string]time.Duration)
+	h.campaign, h.total = CampaignRecord{}, 0
+	if err := replaceFile(h.path, 0o644, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(h.file)
+	}); err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	return nil
+}
+
+// millis returns a duration in milliseconds
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+// SubStageHook refines the stage in which a lifecycle hook failed a file
+const SubStageHook = "hook"
+
+// Hooks are callbacks run as a file goes through the pipeline, for logic
+// the pipeline has no setting for, such as metrics, extra checks or
+// custom injections. Any of them may be nil. A hook returning an error
+// fails the file in the stage it runs in.
+type Hooks struct {
+	// BeforeLoad runs before a file is loaded
+	BeforeLoad func(filePath string) error
+	// AfterValidate runs each time the module validated, before it is
+	// instantiated
+	AfterValidate func(filePath string) error
+	// BeforeInvoke runs before each input is passed to the entry, and
+	// AfterInvoke with the outcome of the call. An error from either
+	// fails the call.
+	BeforeInvoke func(filePath string, args []WasmValue) error
+	AfterInvoke  func(filePath string, invocation InvocationResult) error
+	// OnFailure runs once a file failed, with its result to look at or
+	// annotate
+	OnFailure func(result *ExecutionResult)
+}
+
+var (
+	hooksMu         sync.Mutex
+	registeredHooks []Hooks
+)
+
+// RegisterHooks adds hooks to every campaign the fuzzer runs. Code built
+// into the fuzzer calls it from an init function, so isolated workers,
+// which run the same binary, register the same hooks.
+func RegisterHooks(hooks Hooks) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	registeredHooks = append(registeredHooks, hooks)
+}
+
+// campaignHooks returns the registered hooks
+func campaignHooks() []Hooks {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	return append([]Hooks(nil), registeredHooks...)
+}
+
+// hookChain runs the hooks of a file in order
+type hookChain []Hooks
+
+// hookError fails stage with what a hook returned
+func hookError(stage FailureStage, err error) error {
+	return &RuntimeError{Stage: stage, SubStage: SubStageHook, Message: fmt.Sprintf("hook: %v", err), Cause: err}
+}
+
+func (c hookChain) beforeLoad(filePath string) error {
+	for _, hooks := range c {
+		if hooks.BeforeLoad != nil {
+			if err := hooks.BeforeLoad(filePath); err != nil {
+				return hookError(StageLoad, err)
+			}
+		}
+	}
+	return nil
+}
+
+// watchValidation runs the AfterValidate hooks as the runtime leaves the
+// validate stage, until the returned function is called
+func (c hookChain) watchValidation(filePath string) func() {
+	var after []func(string) error
+	for _, hooks := range c {
+		if hooks.AfterValidate != nil {
+			after = append(after, hooks.AfterValidate)
+		}
+	}
+	if len(after) == 0 {
+		return func() {}
+	}
+	finished := stageFinished
+	stageFinished = func(stage FailureStage) error {
+		if err := finished(stage); err != nil || stage != StageValidate {
+			return err
+		}
+		for _, hook := range after {
+			if err := hook(filePath); err != nil {
+				return hookError(StageValidate, err)
+			}
+		}
+		return nil
+	}
+	return func() { stageFinished = finished }
+}
+
+func (c hookChain) beforeInvoke(filePath string, args []WasmValue) error {
+	for _, hooks := range c {
+		if hooks.BeforeInvoke != nil {
+			if err := hooks.BeforeInvoke(filePath, args); err != nil {
+				return hookError(StageExecute, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (c hookChain) afterInvoke(filePath string, invocation InvocationResult) error {
+	for _, hooks := range c {
+		if hooks.AfterInvoke != nil {
+			if err := hooks.AfterInvoke(filePath, invocation); err != nil {
+				return hookError(StageExecute, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (c hookChain) onFailure(result *ExecutionResult) {
+	for _, hooks := range c {
+		if hooks.OnFailure != nil {
+			hooks.OnFailure(result)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// validatingRuntime runs the validate stage as WasmEdge does, and loads
+// modules returning their first argument doubled
+func validatingRuntime() *MockWasmRuntime {
+	return &MockWasmRuntime{LoadModuleFunc: func(string) (WasmModule, error) {
+		if err := runStage(StageValidate, func() error { return nil }); err != nil {
+			return nil, err
+		}
+		return &MockWasmModule{ExecuteFunc: func(_ string, args ...interface{}) ([]interface{}, error) {
+			return []interface{}{args[0].(int32) * 2}, nil
+		}}, nil
+	}}
+}
+
+// -----------------------------------------------------------------------------
+// TEST: Lifecycle Hooks
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Every team running the fuzzer wants one more metric or check. Hooks let
+// them attach it at the stage it belongs to, instead of patching the
+// pipeline, and a failing check must fail the file where it ran.
+// -----------------------------------------------------------------------------
+
+func TestHooks_RunAtEveryStage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "double.wasm")
+	require.NoError(t, os.WriteFile(path, []byte("double"), 0o644))
+	var events []string
+	hooks := Hooks{
+		BeforeLoad:    func(string) error { events = append(events, "load"); return nil },
+		AfterValidate: func(string) error { events = append(events, "validated"); return nil },
+		BeforeInvoke: func(_ string, args []WasmValue) error {
+			events = append(events, "invoke "+args[0].Value)
+			return nil
+		},
+		AfterInvoke: func(_ string, invocation InvocationResult) error {
+			events = append(events, "returned "+invocation.TypedReturnValues[0].Value)
+			return nil
+		},
+		OnFailure: func(*ExecutionResult) { events = append(events, "failed") },
+	}
+
+	result := processWasmFileWithOptions(path, validatingRuntime(), RunOptions{
+		Invocation: InvocationConfig{Entry: "double", Inputs: i32Inputs(1, 2)},
+		Hooks:      []Hooks{hooks},
+	})
+	require.True(t, result.Success, result.ErrorMessage)
+	assert.Equal(t, []string{"load", "validated", "invoke 1", "returned 2", "invoke 2", "returned 4"}, events)
+
+	// Validation outside the file's run is not watched
+	events = nil
+	require.NoError(t, runStage(StageValidate, func() error { return nil }))
+	assert.Empty(t, events)
+}
+
+func TestHooks_ErrorsFailTheirStage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "double.wasm")
+	require.NoError(t, os.WriteFile(path, []byte("double"), 0o644))
+	run := func(hooks Hooks) ExecutionResult {
+		var failed *ExecutionResult
+		hooks.OnFailure = func(result *ExecutionResult) {
+			failed = result
+			result.ErrorMessage += " (seen)"
+		}
+		result := processWasmFileWithOptions(path, validatingRuntime(), RunOptions{
+			Invocation: InvocationConfig{Entry: "double", Inputs: i32Inputs(1, 2)},
+			Hooks:      []Hooks{hooks},
+		})
+		require.NotNil(t, failed, "OnFailure runs for failed files")
+		return result
+	}
+	denied := errors.New("denied")
+
+	result := run(Hooks{BeforeLoad: func(string) error { return denied }})
+	assert.Equal(t, StageLoad, result.FailureStage)
+	assert.Equal(t, SubStageHook, result.FailureSubStage)
+	assert.Equal(t, "hook: denied (seen)", result.ErrorMessage)
+
+	result = run(Hooks{AfterValidate: func(string) error { return denied }})
+	assert.Equal(t, StageValidate, result.FailureStage)
+	assert.Equal(t, SubStageHook, result.FailureSubStage)
+
+	result = run(Hooks{AfterInvoke: func(_ string, invocation InvocationResult) error {
+		if got := invocation.TypedReturnValues[0].Value; got != "2" {
+			return fmt.Errorf("returned %s", got)
+		}
+		return nil
+	}})
+	assert.Equal(t, StageExecute, result.FailureStage)
+	assert.Equal(t, "invocation 1: hook: returned 4 (seen)", result.ErrorMessage)
+	require.Len(t, result.Invocations, 2)
+	assert.True(t, result.Invocations[0].Success)
+	assert.False(t, result.Invocations[1].Success)
+	assert.Equal(t, "4", result.Invocations[1].TypedReturnValues[0].Value, "what the call returned is kept")
+}
+
+func TestHooks_RegisteredHooksJoinEveryCampaign(t *testing.T) {
+	original := registeredHooks
+	t.Cleanup(func() { registeredHooks = original })
+	RegisterHooks(Hooks{BeforeLoad: func(string) error { return nil }})
+
+	hooks := Config{}.runOptions().Hooks
+	require.Len(t, hooks, len(original)+1)
+	assert.NotNil(t, hooks[len(hooks)-1].BeforeLoad)
+	_, err := cacheOptionsHash(RunOptions{Hooks: hooks})
+	assert.NoError(t, err, "hooks are left out of the cache key")
+}
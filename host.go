@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// HostFunction is a Go function a module imports
+type HostFunction struct {
+	// Module and Name are the import's module and field names
+	Module, Name string
+	Signature    FuncSignature
+	// Call runs the function; an error traps the calling module
+	Call func(args []interface{}) ([]interface{}, error)
+	// Stub describes what a function standing in for an import the host
+	// does not implement does; it is empty for real implementations
+	Stub string
+}
+
+// HostLoader is implemented by runtimes that can satisfy a module's
+// imports with Go functions
+type HostLoader interface {
+	// LoadModuleWithHost loads a module from filePath, or from data when it
+	// is non-nil, linking its imports to the given host functions
+	LoadModuleWithHost(filePath string, data []byte, host []HostFunction) (WasmModule, error)
+}
+
+// zeroResults returns the zero value of each result type
+func zeroResults(signature FuncSignature) ([]interface{}, error) {
+	results := make([]interface{}, len(signature.Results))
+	for i, valType := range signature.Results {
+		switch valType {
+		case "i32":
+			results[i] = int32(0)
+		case "i64":
+			results[i] = int64(0)
+		case "f32":
+			results[i] = float32(0)
+		case "f64":
+			results[i] = float64(0)
+		default:
+			return nil, fmt.Errorf("%s results are not supported", valType)
+		}
+	}
+	return results, nil
+}
+
+// nativeFunction is a host function implemented by the harness. Arguments
+// are passed as the raw bits of their values.
+type nativeFunction struct {
+	signature FuncSignature
+	call      func(args []uint64) ([]interface{}, error)
+}
+
+// funcSig builds a signature from space-separated type names
+func funcSig(params, results string) FuncSignature {
+	return FuncSignature{Params: strings.Fields(params), Results: strings.Fields(results)}
+}
+
+// bind links a native function to an import, which must have its signature
+func (f nativeFunction) bind(imp wasmFuncImport) (HostFunction, error) {
+	if f.signature.String() != imp.Signature.String() {
+		return HostFunction{}, fmt.Errorf("host function '%s' has signature %s, but the module imports it as %s", imp.Name, f.signature, imp.Signature)
+	}
+	call := f.call
+	return HostFunction{
+		Module:    imp.Module,
+		Name:      imp.Name,
+		Signature: f.signature,
+		Call: func(args []interface{}) ([]interface{}, error) {
+			raw := make([]uint64, len(args))
+			for i, arg := range args {
+				switch v := arg.(type) {
+				case int32:
+					raw[i] = uint64(uint32(v))
+				case int64:
+					raw[i] = uint64(v)
+				case float32:
+					raw[i] = uint64(math.Float32bits(v))
+				case float64:
+					raw[i] = math.Float64bits(v)
+				}
+			}
+			return call(raw)
+		},
+	}, nil
+}
+
+// stubFunction links an import to a function returning constant results
+func stubFunction(imp wasmFuncImport, results []interface{}) HostFunction {
+	return HostFunction{
+		Module:    imp.Module,
+		Name:      imp.Name,
+		Signature: imp.Signature,
+		Call:      func(args []interface{}) ([]interface{}, error) { return results, nil },
+		Stub:      fmt.Sprintf("returns %v", results),
+	}
+}
+
+// moduleImports returns the function imports of a module binary. Modules
+// that cannot be decoded have none, so the runtime reports their real load
+// or validation error.
+func moduleImports(data []byte) []wasmFuncImport {
+	binary, err := parseWasmBinary(data)
+	if err != nil {
+		return nil
+	}
+	imports, err := binary.functionImports()
+	if err != nil {
+		return nil
+	}
+	return imports
+}
+
+// hostMemory gives host functions access to the memory of the module
+// importing them, which is only known once the module is instantiated
+type hostMemory struct {
+	module MemoryModule
+	name   string
+}
+
+// read copies n bytes at ptr out of the module's memory
+func (m *hostMemory) read(ptr, n uint64) ([]byte, error) {
+	if m.module == nil {
+		return nil, fmt.Errorf("memory is not available before instantiation")
+	}
+	return m.module.ReadMemory(m.memoryName(), uint32(ptr), uint32(n))
+}
+
+// write copies data into the module's memory at ptr
+func (m *hostMemory) write(ptr uint64, data []byte) error {
+	if m.module == nil {
+		return fmt.Errorf("memory is not available before instantiation")
+	}
+	return m.module.WriteMemory(m.memoryName(), uint32(ptr), data)
+}
+
+// writeU32 stores a little-endian u32 at ptr
+func (m *hostMemory) writeU32(ptr uint64, v uint32) error {
+	return m.write(ptr, binary.LittleEndian.AppendUint32(nil, v))
+}
+
+// writeU64 stores a little-endian u64 at ptr
+func (m *hostMemory) writeU64(ptr uint64, v uint64) error {
+	return m.write(ptr, binary.LittleEndian.AppendUint64(nil, v))
+}
+
+func (m *hostMemory) memoryName() string {
+	if m.name == "" {
+		return defaultMemoryExport
+	}
+	return m.name
+}
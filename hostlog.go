@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// The log import plain modules can use to report diagnostics to the host:
+// env.log(ptr, len), or env.log(ptr, len) -> i32 returning zero on success
+const (
+	logModule = "env"
+	logImport = "log"
+)
+
+// Log faults injected into the host's log import
+const (
+	// LogFaultFail makes every log call fail: the returning form returns
+	// 1, and the other traps, as it has no way to report the failure
+	LogFaultFail = "fail"
+	// LogFaultBlock makes every log call wait before returning, as a log
+	// pipeline under backpressure would
+	LogFaultBlock = "block"
+)
+
+// defaultLogDelay is how long a blocked log call waits by default
+const defaultLogDelay = time.Second
+
+// errLogFailed is the trap of a failing log call without a result
+var errLogFailed = errors.New("injected log failure")
+
+// LogConfig configures the host's log import
+type LogConfig struct {
+	// Fault is "fail" or "block" to test how modules cope with a logger
+	// that fails or stalls; by default every message is accepted
+	Fault string `yaml:"fault"`
+	// Delay is how long a blocked call waits (default 1s)
+	Delay time.Duration `yaml:"delay"`
+}
+
+// hostLog implements the log import, recording messages with the output
+// of the module
+type hostLog struct {
+	config LogConfig
+	memory *hostMemory
+	output *outputCapture
+}
+
+// Signatures of the log import
+var (
+	logSignature       = funcSig("i32 i32", "")
+	logResultSignature = funcSig("i32 i32", "i32")
+)
+
+// isLogImport reports whether imp is the log import in one of its forms.
+// Modules importing a differently typed env.log bring their own.
+func isLogImport(imp wasmFuncImport) bool {
+	if imp.Module != logModule || imp.Name != logImport {
+		return false
+	}
+	sig := imp.Signature.String()
+	return sig == logSignature.String() || sig == logResultSignature.String()
+}
+
+// usesLog reports whether a module imports the log function
+func usesLog(imports []wasmFuncImport) bool {
+	for _, imp := range imports {
+		if isLogImport(imp) {
+			return true
+		}
+	}
+	return false
+}
+
+// log records one message and applies the configured fault
+func (l *hostLog) log(args []uint64, returns bool) ([]interface{}, error) {
+	if l.config.Fault == LogFaultBlock {
+		delay := l.config.Delay
+		if delay <= 0 {
+			delay = defaultLogDelay
+		}
+		time.Sleep(delay)
+	}
+	if l.config.Fault == LogFaultFail {
+		if returns {
+			return []interface{}{int32(1)}, nil
+		}
+		return nil, errLogFailed
+	}
+
+	message, err := l.memory.read(args[0], min(args[1], outputLimit))
+	if err != nil {
+		return nil, err
+	}
+	l.output.writeLog(message)
+	if returns {
+		return []interface{}{int32(0)}, nil
+	}
+	return nil, nil
+}
+
+// link binds the module's log import
+func (l *hostLog) link(imports []wasmFuncImport) ([]HostFunction, error) {
+	switch l.config.Fault {
+	case "", LogFaultFail, LogFaultBlock:
+	default:
+		return nil, fmt.Errorf("unknown log fault %q", l.config.Fault)
+	}
+
+	var host []HostFunction
+	for _, imp := range imports {
+		if !isLogImport(imp) {
+			continue
+		}
+		fn := nativeFunction{logSignature, func(args []uint64) ([]interface{}, error) { return l.log(args, false) }}
+		if len(imp.Signature.Results) > 0 {
+			fn = nativeFunction{logResultSignature, func(args []uint64) ([]interface{}, error) { return l.log(args, true) }}
+		}
+		bound, err := fn.bind(imp)
+		if err != nil {
+			return nil, err
+		}
+		host = append(host, bound)
+	}
+	return host, nil
+}
@@ -0,0 +1,97 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// logBinary is a plain module importing the log function with signature
+func logBinary(signature FuncSignature) []byte {
+	return pluginBinary(wasmFuncImport{Module: logModule, Name: logImport, Signature: signature})
+}
+
+// log passes text to the contract's log import
+func (m *contractModule) log(text string) (int64, error) {
+	return m.call(logImport, m.put(text), int32(len(text)))
+}
+
+// -----------------------------------------------------------------------------
+// TEST: Host Log Import
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// What a module logs explains its failures, so it has to be reported with
+// the file and the call. Real log pipelines also fail and stall, and a
+// module that assumes they never do will misbehave in production; making
+// the host's logger fail or block shows how a module copes.
+// -----------------------------------------------------------------------------
+
+func TestHostLog_CapturedPerInvocation(t *testing.T) {
+	calls := 0
+	result, _ := runWASI(t, logBinary(logSignature), map[string]contractExport{
+		"run": func(m *contractModule, args []interface{}) ([]interface{}, error) {
+			calls++
+			_, err := m.log("request " + string(rune('0'+calls)))
+			return []interface{}{int32(0)}, err
+		},
+	}, InvocationConfig{Entry: "run", Inputs: []InvocationInput{{}, {}}})
+
+	require.True(t, result.Success, result.ErrorMessage)
+	assert.Equal(t, "request 1\nrequest 2\n", result.Log)
+	require.Len(t, result.Invocations, 2)
+	assert.Equal(t, "request 1\n", result.Invocations[0].Log)
+	assert.Equal(t, "request 2\n", result.Invocations[1].Log)
+}
+
+func TestHostLog_FailFault(t *testing.T) {
+	var status int64
+	result, _ := runWASI(t, logBinary(logResultSignature), map[string]contractExport{
+		"run": func(m *contractModule, args []interface{}) ([]interface{}, error) {
+			var err error
+			status, err = m.log("hello")
+			return []interface{}{int32(0)}, err
+		},
+	}, InvocationConfig{Entry: "run", Inputs: []InvocationInput{{}}, Log: LogConfig{Fault: LogFaultFail}})
+	require.True(t, result.Success, result.ErrorMessage)
+	assert.Equal(t, int64(1), status, "the returning form reports the failure")
+	assert.Empty(t, result.Log)
+
+	result, _ = runWASI(t, logBinary(logSignature), map[string]contractExport{
+		"run": func(m *contractModule, args []interface{}) ([]interface{}, error) {
+			_, err := m.log("hello")
+			return []interface{}{int32(0)}, err
+		},
+	}, InvocationConfig{Entry: "run", Inputs: []InvocationInput{{}}, Log: LogConfig{Fault: LogFaultFail}})
+	assert.False(t, result.Success)
+	assert.Equal(t, StageExecute, result.FailureStage)
+	assert.Contains(t, result.ErrorMessage, "injected log failure")
+}
+
+func TestHostLog_BlockFault(t *testing.T) {
+	var elapsed time.Duration
+	result, _ := runWASI(t, logBinary(logSignature), map[string]contractExport{
+		"run": func(m *contractModule, args []interface{}) ([]interface{}, error) {
+			start := time.Now()
+			_, err := m.log("slow")
+			elapsed = time.Since(start)
+			return []interface{}{int32(0)}, err
+		},
+	}, InvocationConfig{Entry: "run", Inputs: []InvocationInput{{}}, Log: LogConfig{Fault: LogFaultBlock, Delay: 30 * time.Millisecond}})
+
+	require.True(t, result.Success, result.ErrorMessage)
+	assert.GreaterOrEqual(t, elapsed, 30*time.Millisecond)
+	assert.Equal(t, "slow\n", result.Log, "a blocked message is still delivered")
+}
+
+func TestHostLog_UnknownFault(t *testing.T) {
+	result, _ := runWASI(t, logBinary(logSignature), map[string]contractExport{},
+		InvocationConfig{Entry: "run", Inputs: []InvocationInput{{}}, Log: LogConfig{Fault: "drop"}})
+	assert.Equal(t, StageInstantiate, result.FailureStage)
+	assert.Equal(t, `log: unknown log fault "drop"`, result.ErrorMessage)
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// proxyRecordLimit caps the calls recorded for each proxied import
+const proxyRecordLimit = 100
+
+// ImportProxy sits between a module and the host function it imports,
+// recording the calls, replacing what they return or dropping some
+type ImportProxy struct {
+	// Import is the import's "module.name", or "module.*" for every
+	// function imported from a module
+	Import string `yaml:"import"`
+	// Record keeps the arguments and results of the calls
+	Record bool `yaml:"record"`
+	// Return replaces the results of every call, one number per result
+	Return []string `yaml:"return"`
+	// DropEvery keeps every Nth call from reaching the host function,
+	// which returns zeros, or Return, instead
+	DropEvery int `yaml:"drop_every"`
+}
+
+// ProxyCall is one recorded call through a proxy
+type ProxyCall struct {
+	Args    []WasmValue `json:"args"`
+	Results []WasmValue `json:"results,omitempty"`
+	// Original is what the host function returned before the proxy
+	// replaced it
+	Original []WasmValue `json:"original,omitempty"`
+	// Dropped is set when the host function was not called
+	Dropped bool `json:"dropped,omitempty"`
+	// Error is the trap the host function raised
+	Error string `json:"error,omitempty"`
+}
+
+// ProxySummary reports the calls made through the proxy of one import
+type ProxySummary struct {
+	Import   string `json:"import"`
+	Calls    int    `json:"calls"`
+	Dropped  int    `json:"dropped,omitempty"`
+	Modified int    `json:"modified,omitempty"`
+	// Recorded holds the first calls when the proxy records them
+	Recorded []ProxyCall `json:"recorded,omitempty"`
+}
+
+// importProxies tracks the proxied imports of the file being run. Counts
+// carry over when the module is reloaded between inputs.
+type importProxies struct {
+	config    []ImportProxy
+	summaries map[string]*ProxySummary
+}
+
+func newImportProxies(config []ImportProxy) *importProxies {
+	return &importProxies{config: config, summaries: make(map[string]*ProxySummary)}
+}
+
+// importMatches reports whether a "module.name" or "module.*" pattern
+// names a host function's import
+func importMatches(pattern string, fn HostFunction) bool {
+	return pattern == fn.Module+"."+fn.Name || pattern == fn.Module+".*"
+}
+
+// match returns the proxy configured for an import
+func (p *importProxies) match(fn HostFunction) (ImportProxy, bool) {
+	for _, proxy := range p.config {
+		if importMatches(proxy.Import, fn) {
+			return proxy, true
+		}
+	}
+	return ImportProxy{}, false
+}
+
+// wrap puts the configured proxies in front of host functions
+func (p *importProxies) wrap(host []HostFunction) ([]HostFunction, error) {
+	wrapped := make([]HostFunction, len(host))
+	for i, fn := range host {
+		wrapped[i] = fn
+		proxy, ok := p.match(fn)
+		if !ok {
+			continue
+		}
+		name := fn.Module + "." + fn.Name
+		if proxy.DropEvery < 0 {
+			return nil, fmt.Errorf("proxy for %s: drop_every must not be negative", name)
+		}
+		var replacement []interface{}
+		if proxy.Return != nil {
+			if len(proxy.Return) != len(fn.Signature.Results) {
+				return nil, fmt.Errorf("proxy for %s: %d return values for %d results", name, len(proxy.Return), len(fn.Signature.Results))
+			}
+			for j, value := range proxy.Return {
+				converted, err := convertArgument(WasmValue{Value: value}, fn.Signature.Results[j])
+				if err != nil {
+					return nil, fmt.Errorf("proxy for %s: %w", name, err)
+				}
+				replacement = append(replacement, converted)
+			}
+		}
+		summary := p.summaries[name]
+		if summary == nil {
+			summary = &ProxySummary{Import: name}
+			p.summaries[name] = summary
+		}
+		wrapped[i].Call = proxyCall(fn, proxy, replacement, summary)
+	}
+	return wrapped, nil
+}
+
+// proxyCall returns the call of a proxied host function
+func proxyCall(fn HostFunction, proxy ImportProxy, replacement []interface{}, summary *ProxySummary) func(args []interface{}) ([]interface{}, error) {
+	return func(args []interface{}) ([]interface{}, error) {
+		summary.Calls++
+		call := ProxyCall{Args: encodeValues(args)}
+
+		var results []interface{}
+		var err error
+		if proxy.DropEvery > 0 && summary.Calls%proxy.DropEvery == 0 {
+			summary.Dropped++
+			call.Dropped = true
+			if results, err = zeroResults(fn.Signature); err != nil {
+				return nil, err
+			}
+		} else if results, err = fn.Call(args); err != nil {
+			call.Error = err.Error()
+		}
+		if replacement != nil && err == nil {
+			summary.Modified++
+			if !call.Dropped {
+				call.Original = encodeValues(results)
+			}
+			results = replacement
+		}
+
+		if proxy.Record && len(summary.Recorded) < proxyRecordLimit {
+			if err == nil {
+				call.Results = encodeValues(results)
+			}
+			summary.Recorded = append(summary.Recorded, call)
+		}
+		return results, err
+	}
+}
+
+// report returns the summaries of the proxied imports the module linked,
+// by import name
+func (p *importProxies) report() []ProxySummary {
+	if p == nil || len(p.summaries) == 0 {
+		return nil
+	}
+	summaries := make([]ProxySummary, 0, len(p.summaries))
+	for _, summary := range p.summaries {
+		summaries = append(summaries, *summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Import < summaries[j].Import })
+	return summaries
+}
+
+// hostWrapper puts something in front of host functions as they are linked
+type hostWrapper interface {
+	wrap(host []HostFunction) ([]HostFunction, error)
+}
+
+// proxyRuntime links modules to host functions wrapped by its wrapper, such
+// as the import proxies or chaos faults
+type proxyRuntime struct {
+	WasmRuntime
+	wrapper hostWrapper
+}
+
+// LoadModuleWithHost implements HostLoader.LoadModuleWithHost
+func (r *proxyRuntime) LoadModuleWithHost(filePath string, data []byte, host []HostFunction) (WasmModule, error) {
+	loader, ok := r.WasmRuntime.(HostLoader)
+	if !ok {
+		return nil, fmt.Errorf("runtime cannot link host functions")
+	}
+	wrapped, err := r.wrapper.wrap(host)
+	if err != nil {
+		return nil, &RuntimeError{Stage: StageInstantiate, Message: err.Error()}
+	}
+	return loader.LoadModuleWithHost(filePath, data, wrapped)
+}
+
+// LoadModuleBytes implements BufferLoader.LoadModuleBytes
+func (r *proxyRuntime) LoadModuleBytes(name string, data []byte) (WasmModule, error) {
+	return (&bufferRuntime{runtime: r.WasmRuntime, data: data}).LoadModule(name)
+}
+
+// CheckModule implements StageChecker.CheckModule
+func (r *proxyRuntime) CheckModule(filePath string, stage FailureStage) error {
+	return runTruncated(filePath, r.WasmRuntime, stage)
+}
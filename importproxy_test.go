@@ -0,0 +1,85 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// -----------------------------------------------------------------------------
+// TEST: Import Proxies
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// A module trusts what its host functions return and that they run when
+// called. Standing between the module and a real host implementation, a
+// proxy can show what the module asked for, hand it results the host
+// never would, or silently skip calls, all without a fake host of its own.
+// -----------------------------------------------------------------------------
+
+func TestImportProxy_RecordsModifiesAndDrops(t *testing.T) {
+	var statuses []int64
+	result, _ := runWASI(t, logBinary(logResultSignature), map[string]contractExport{
+		"run": func(m *contractModule, args []interface{}) ([]interface{}, error) {
+			for _, text := range []string{"a", "b", "c"} {
+				status, err := m.log(text)
+				if err != nil {
+					return nil, err
+				}
+				statuses = append(statuses, status)
+			}
+			return []interface{}{int32(0)}, nil
+		},
+	}, InvocationConfig{Entry: "run", Inputs: []InvocationInput{{}}, Proxies: []ImportProxy{
+		{Import: "env.log", Record: true, Return: []string{"7"}, DropEvery: 2},
+	}})
+
+	require.True(t, result.Success, result.ErrorMessage)
+	assert.Equal(t, []int64{7, 7, 7}, statuses)
+	assert.Equal(t, "a\nc\n", result.Log, "the dropped call never reached the logger")
+	require.Len(t, result.Proxies, 1)
+	summary := result.Proxies[0]
+	assert.Equal(t, "env.log", summary.Import)
+	assert.Equal(t, 3, summary.Calls)
+	assert.Equal(t, 1, summary.Dropped)
+	assert.Equal(t, 3, summary.Modified)
+	require.Len(t, summary.Recorded, 3)
+	assert.Equal(t, []WasmValue{{Type: "i32", Value: "0"}}, summary.Recorded[0].Original)
+	assert.Equal(t, []WasmValue{{Type: "i32", Value: "7"}}, summary.Recorded[0].Results)
+	assert.True(t, summary.Recorded[1].Dropped)
+	assert.Empty(t, summary.Recorded[1].Original, "a dropped call has no original results")
+}
+
+func TestImportProxy_MatchesModuleWildcard(t *testing.T) {
+	proxies := newImportProxies([]ImportProxy{{Import: "env.*"}})
+	calls := 0
+	host, err := proxies.wrap([]HostFunction{
+		{Module: "env", Name: "log", Signature: logSignature, Call: func([]interface{}) ([]interface{}, error) {
+			calls++
+			return nil, nil
+		}},
+		{Module: "wasi_snapshot_preview1", Name: "proc_exit", Signature: funcSig("i32", "")},
+	})
+	require.NoError(t, err)
+
+	_, err = host[0].Call([]interface{}{int32(0), int32(1)})
+	require.NoError(t, err)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, []ProxySummary{{Import: "env.log", Calls: 1}}, proxies.report(), "calls are only recorded when asked")
+	assert.Nil(t, host[1].Call, "other modules' imports are linked as they are")
+}
+
+func TestImportProxy_RejectsReturnsNotFittingResults(t *testing.T) {
+	result, _ := runWASI(t, logBinary(logResultSignature), map[string]contractExport{},
+		InvocationConfig{Entry: "run", Inputs: []InvocationInput{{}}, Proxies: []ImportProxy{{Import: "env.log", Return: []string{"1", "2"}}}})
+	assert.Equal(t, StageInstantiate, result.FailureStage)
+	assert.Equal(t, "proxy for env.log: 2 return values for 1 results", result.ErrorMessage)
+
+	result, _ = runWASI(t, logBinary(logResultSignature), map[string]contractExport{},
+		InvocationConfig{Entry: "run", Inputs: []InvocationInput{{}}, Proxies: []ImportProxy{{Import: "env.log", Return: []string{"x"}}}})
+	assert.Equal(t, `proxy for env.log: invalid i32 value "x"`, result.ErrorMessage)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// changedFiles lists the files of a corpus directory kept in git that were
+// added or modified since ref, including those not committed yet and new
+// files git does not track yet. Paths are joined to dirPath, as
+// collectWasmFiles returns them. The ref is never taken for an option,
+// even when it starts with a dash.
+func changedFiles(dirPath, ref string) (map[string]bool, error) {
+	changed := make(map[string]bool)
+	for _, args := range [][]string{
+		{"diff", "--name-only", "--relative", "--diff-filter=d", "-z", "--end-of-options", ref, "--", "."},
+		{"ls-files", "--others", "--exclude-standard", "-z", "--", "."},
+	} {
+		out, err := runGit(dirPath, args...)
+		if err != nil {
+			return nil, fmt.Errorf("changed since %s: %w", ref, err)
+		}
+		for _, name := range strings.Split(out, "\x00") {
+			if name != "" {
+				changed[filepath.Join(dirPath, filepath.FromSlash(name))] = true
+			}
+		}
+	}
+	return changed, nil
+}
+
+// runGit runs a git command in a directory and returns its output
+func runGit(dir string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Dir, cmd.Stdout, cmd.Stderr = dir, &stdout, &stderr
+	err := cmd.Run()
+	if errors.Is(err, exec.ErrNotFound) {
+		return "", errors.New("incremental runs need git on PATH")
+	} else if err != nil {
+		return "", fmt.Errorf("git %s failed: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,113 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gitCorpus makes a git repository of a corpus, with the given files
+// committed, and returns the corpus directory
+func gitCorpus(t *testing.T, files ...string) string {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	repo := t.TempDir()
+	dir := filepath.Join(repo, "corpus")
+	require.NoError(t, os.Mkdir(dir, 0o755))
+	for _, name := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(name), 0o644))
+	}
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "."},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "corpus"},
+	} {
+		_, err := runGit(repo, args...)
+		require.NoError(t, err)
+	}
+	return dir
+}
+
+// -----------------------------------------------------------------------------
+// TEST: Incremental Runs
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// A pull request touching two modules should not wait on the whole corpus.
+// Only the files changed since the base ref may run, and the others must
+// still be reported, from the cache, so the report stays complete.
+// -----------------------------------------------------------------------------
+
+func TestIncremental_RunsOnlyChangedFiles(t *testing.T) {
+	dir := gitCorpus(t, "a.wasm", "b.wasm", "c.wasm")
+	loads := map[string]int{}
+	runtime := &MockWasmRuntime{LoadModuleFunc: func(filePath string) (WasmModule, error) {
+		loads[filepath.Base(filePath)]++
+		return &MockWasmModule{}, nil
+	}}
+	envs := []environmentRuntime{{Runtime: runtime}}
+	opts := RunOptions{Cache: CacheConfig{Dir: t.TempDir()}}
+
+	// A full run fills the cache for b.wasm and c.wasm
+	_, err := runFuzzerWithMatrix(dir, envs, opts)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.wasm"), []byte("a2"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "d.wasm"), []byte("d"), 0o644))
+	require.NoError(t, os.Remove(filepath.Join(dir, "c.wasm")))
+	loads = map[string]int{}
+	opts.Corpus.ChangedSince = "HEAD"
+	report, err := runFuzzerWithMatrix(dir, envs, opts)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]int{"a.wasm": 1, "d.wasm": 1}, loads, "modified and untracked files run")
+	assert.Equal(t, &CacheSummary{Hits: 1, Misses: 2}, report.Cache)
+	require.Len(t, report.Results, 3)
+	assert.True(t, report.Results[1].Cached, "b.wasm is reported from the cache")
+	assert.Equal(t, 3, report.Passed)
+}
+
+func TestIncremental_SkipsUnchangedFilesWithoutCache(t *testing.T) {
+	dir := gitCorpus(t, "a.wasm", "b.wasm")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.wasm"), []byte("b2"), 0o644))
+
+	opts := RunOptions{Corpus: CorpusConfig{ChangedSince: "HEAD"}}
+	report, err := runFuzzerWithMatrix(dir, []environmentRuntime{{Runtime: &MockWasmRuntime{}}}, opts)
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Passed)
+	assert.Equal(t, 1, report.SkipCounts[SkipUnchanged])
+	assert.Equal(t, "a.wasm", report.Results[0].FileName)
+	assert.Equal(t, "unchanged since HEAD, with no cached result", report.Results[0].SkipDetails)
+	assert.Empty(t, validateReport(report))
+
+	plan, err := planDryRun(dir, Config{Corpus: opts.Corpus}, opts)
+	require.NoError(t, err)
+	require.Len(t, plan.Files, 2)
+	assert.True(t, plan.Files[0].Unchanged)
+	assert.False(t, plan.Files[1].Unchanged)
+}
+
+func TestIncremental_RejectsUnknownRefs(t *testing.T) {
+	dir := gitCorpus(t, "a.wasm")
+	opts := RunOptions{Corpus: CorpusConfig{ChangedSince: "no-such-ref"}}
+	_, err := runFuzzerWithMatrix(dir, []environmentRuntime{{Runtime: &MockWasmRuntime{}}}, opts)
+	assert.ErrorContains(t, err, "changed since no-such-ref")
+
+	// A ref that looks like an option is still a ref
+	output := filepath.Join(t.TempDir(), "written")
+	_, err = changedFiles(dir, "--output="+output)
+	assert.ErrorContains(t, err, "bad revision")
+	assert.NoFileExists(t, output)
+
+	// Nor can a corpus outside git be run incrementally
+	_, err = changedFiles(t.TempDir(), "HEAD")
+	assert.Error(t, err)
+}
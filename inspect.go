@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+	"sort"
+)
+
+// ModuleInspection describes one module from its binary, without running
+// it: what it needs from its host, what it offers, and what it was built
+// with
+type ModuleInspection struct {
+	FilePath  string `json:"file_path"`
+	SHA256    string `json:"sha256"`
+	SizeBytes int64  `json:"size_bytes"`
+	Error     string `json:"error,omitempty"`
+	// Toolchain, Languages and SDKs come from the producers section
+	Toolchain      []SBOMComponent `json:"toolchain,omitempty"`
+	Languages      []SBOMComponent `json:"languages,omitempty"`
+	SDKs           []SBOMComponent `json:"sdks,omitempty"`
+	CustomSections []string        `json:"custom_sections,omitempty"`
+	// Imports and Exports name each function's signature
+	Imports []InspectedItem `json:"imports,omitempty"`
+	Exports []InspectedItem `json:"exports,omitempty"`
+	// Functions counts the functions the module defines
+	Functions int `json:"functions"`
+	// DataSegments and DataBytes count the data segments and their bytes
+	DataSegments int `json:"data_segments"`
+	DataBytes    int `json:"data_bytes"`
+	// Features are the post-MVP proposals the module uses
+	Features []string `json:"features,omitempty"`
+}
+
+// InspectedItem is an import or an export of a module
+type InspectedItem struct {
+	Module string `json:"module,omitempty"`
+	Name   string `json:"name"`
+	// Kind is func, table, memory, global or tag
+	Kind      string `json:"kind"`
+	Signature string `json:"signature,omitempty"`
+}
+
+// inspectModule describes a module file. Unreadable files and binaries
+// that are not modules have an error instead.
+func inspectModule(filePath string) ModuleInspection {
+	inventory := inventoryModule(filePath)
+	inspection := ModuleInspection{
+		FilePath:       inventory.FilePath,
+		SHA256:         inventory.SHA256,
+		SizeBytes:      inventory.SizeBytes,
+		Error:          inventory.Error,
+		Toolchain:      inventory.Toolchain,
+		Languages:      inventory.Languages,
+		SDKs:           inventory.SDKs,
+		CustomSections: inventory.CustomSections,
+	}
+	if inspection.Error != "" {
+		return inspection
+	}
+	fail := func(err error) ModuleInspection {
+		inspection.Error = err.Error()
+		return inspection
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return fail(err)
+	}
+	binary, err := parseWasmBinary(data)
+	if err != nil {
+		return fail(err)
+	}
+	signatures, err := binary.functionSignatures()
+	if err != nil {
+		return fail(err)
+	}
+	var funcs int
+	for _, imp := range inventory.Imports {
+		item := InspectedItem{Module: imp.Module, Name: imp.Name, Kind: imp.Kind}
+		if imp.Kind == "func" {
+			item.Signature = signatures[funcs].String()
+			funcs++
+		}
+		inspection.Imports = append(inspection.Imports, item)
+	}
+	inspection.Functions = len(signatures) - funcs
+
+	for kind, kindName := range externKindNames {
+		exports, err := binary.exportsOfKind(kind)
+		if err != nil {
+			return fail(err)
+		}
+		for name, index := range exports {
+			item := InspectedItem{Name: name, Kind: kindName}
+			if kind == externFunc && int(index) < len(signatures) {
+				item.Signature = signatures[index].String()
+			}
+			inspection.Exports = append(inspection.Exports, item)
+		}
+	}
+	sort.Slice(inspection.Exports, func(i, j int) bool {
+		return inspection.Exports[i].Name < inspection.Exports[j].Name
+	})
+
+	segments, err := binary.dataSegments()
+	if err != nil {
+		return fail(err)
+	}
+	inspection.DataSegments = len(segments)
+	for _, segment := range segments {
+		inspection.DataBytes += len(segment)
+	}
+	features, err := detectFeatures(data)
+	if err != nil {
+		return fail(err)
+	}
+	inspection.Features = features.sorted()
+	return inspection
+}
+
+// runInspectCommand describes a module
+func runInspectCommand(args []string) int {
+	flags := flag.NewFlagSet("inspect", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		emitError(map[string]string{
+			"error": "usage: wasm-fuzzer inspect <file.wasm>",
+		})
+		return 1
+	}
+
+	inspection := inspectModule(flags.Arg(0))
+	if inspection.Error != "" {
+		emitError(map[string]string{
+			"error":   "module inspection failed",
+			"path":    flags.Arg(0),
+			"details": inspection.Error,
+		})
+		return 1
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	// Signatures read "(i32) -> (i32)"
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(inspection); err != nil {
+		emitError(map[string]string{
+			"error":   "failed to encode JSON output",
+			"details": err.Error(),
+		})
+		return 1
+	}
+	return 0
+}
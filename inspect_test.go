@@ -0,0 +1,48 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// -----------------------------------------------------------------------------
+// TEST: Module Inspection
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Before fuzzing a module, or when a run fails on a missing import, the
+// first question is what the module needs from its host and what it
+// offers. Inspection must answer from the binary alone, with signatures,
+// and fail clearly on files that are not modules.
+// -----------------------------------------------------------------------------
+
+func TestInspect_DescribesImportsAndExports(t *testing.T) {
+	log := wasmFuncImport{Module: "env", Name: "log", Signature: funcSig("i32 i64", "")}
+	path := filepath.Join(t.TempDir(), "plugin.wasm")
+	require.NoError(t, os.WriteFile(path, withProducers(t, pluginBinary(log), "Rust", "rustc", "1.75.0"), 0o644))
+
+	inspection := inspectModule(path)
+	require.Empty(t, inspection.Error)
+	assert.Equal(t, []InspectedItem{{Module: "env", Name: "log", Kind: "func", Signature: "(i32, i64) -> ()"}}, inspection.Imports)
+	assert.Equal(t, []InspectedItem{{Name: "run", Kind: "func", Signature: "() -> (i32)"}}, inspection.Exports)
+	assert.Equal(t, 1, inspection.Functions, "imported functions are not counted")
+	assert.Equal(t, []SBOMComponent{{Name: "rustc", Version: "1.75.0"}}, inspection.Toolchain)
+	assert.Equal(t, fileHash(path), inspection.SHA256)
+	assert.Empty(t, inspection.Features)
+}
+
+func TestInspect_FailsOnFilesThatAreNotModules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "junk.wasm")
+	require.NoError(t, os.WriteFile(path, []byte("junk"), 0o644))
+	assert.NotEmpty(t, inspectModule(path).Error)
+
+	assert.Equal(t, 1, runInspectCommand([]string{path}))
+	assert.Equal(t, 1, runInspectCommand(nil))
+}
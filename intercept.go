@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/mrhapile/WASM-Injection-Framework/pkg/rewrite"
+)
+
+// InterceptConfig routes the calls a module makes to its own functions
+// through a host hook, which counts them and can make one of them trap.
+// Fault injection on imports never sees these calls.
+type InterceptConfig struct {
+	// Functions are the functions whose direct calls are intercepted, by
+	// export name or by index
+	Functions []string `yaml:"functions"`
+	// TrapOn makes the nth intercepted call of a file trap, counting from
+	// 1; without it, calls are only counted
+	TrapOn int `yaml:"trap_on"`
+}
+
+// The hook intercepted calls ask before reaching their target
+const (
+	interceptHookModule = "wasm_fuzzer_intercept"
+	interceptHook       = "call"
+)
+
+// InterceptReport is what call interception saw while a file ran
+type InterceptReport struct {
+	// Instrumented is false for modules the trampolines could not be
+	// added to, which run as-is, with Error saying why
+	Instrumented bool   `json:"instrumented"`
+	Error        string `json:"error,omitempty"`
+	// Calls counts the intercepted calls to each function, under the name
+	// it was chosen by
+	Calls map[string]int `json:"calls,omitempty"`
+	// Trapped is the function whose call was made to trap
+	Trapped string `json:"trapped,omitempty"`
+}
+
+// instrumentIntercept routes the calls to the chosen functions of a module
+// through trampolines asking the hook. It returns the rewritten module and
+// the name each target was chosen by, keyed by its index.
+func instrumentIntercept(data []byte, functions []string) ([]byte, map[uint32]string, error) {
+	module, err := rewrite.Parse(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	names := make(map[uint32]string, len(functions))
+	var targets []uint32
+	for _, function := range functions {
+		index, ok := module.ExportedFunction(function)
+		if !ok {
+			n, err := strconv.ParseUint(function, 10, 32)
+			if err != nil {
+				continue
+			}
+			index = uint32(n)
+		}
+		if _, ok := names[index]; !ok {
+			names[index] = function
+			targets = append(targets, index)
+		}
+	}
+	if len(targets) == 0 {
+		return nil, nil, errors.New("none of the functions to intercept is in the module")
+	}
+	if _, err := rewrite.InjectTrampolines(module, interceptHookModule, interceptHook, targets); err != nil {
+		return nil, nil, err
+	}
+	return module.Encode(), names, nil
+}
+
+// interceptTracker counts the intercepted calls of one file, across the
+// module instances loaded for it
+type interceptTracker struct {
+	trapOn int
+	names  map[uint32]string
+	calls  int
+	report InterceptReport
+}
+
+// call is the hook: it counts a call to the target and tells the
+// trampoline whether to trap
+func (t *interceptTracker) call(target uint32) bool {
+	name, ok := t.names[target]
+	if !ok {
+		name = strconv.FormatUint(uint64(target), 10)
+	}
+	if t.report.Calls == nil {
+		t.report.Calls = make(map[string]int)
+	}
+	t.report.Calls[name]++
+	t.calls++
+	if t.calls == t.trapOn {
+		t.report.Trapped = name
+		return true
+	}
+	return false
+}
+
+// hook is the host function intercepted modules import
+func (t *interceptTracker) hook() HostFunction {
+	return HostFunction{
+		Module:    interceptHookModule,
+		Name:      interceptHook,
+		Signature: funcSig("i32", "i32"),
+		Call: func(args []interface{}) ([]interface{}, error) {
+			target, _ := args[0].(int32)
+			if t.call(uint32(target)) {
+				return []interface{}{int32(1)}, nil
+			}
+			return []interface{}{int32(0)}, nil
+		},
+	}
+}
+
+// summary reports the calls intercepted
+func (t *interceptTracker) summary() *InterceptReport {
+	report := t.report
+	return &report
+}
+
+// interceptRuntime adds the trampolines to every module it loads and
+// links their hook
+type interceptRuntime struct {
+	WasmRuntime
+	functions []string
+	tracker   *interceptTracker
+}
+
+func newInterceptRuntime(runtime WasmRuntime, config InterceptConfig) *interceptRuntime {
+	return &interceptRuntime{WasmRuntime: runtime, functions: config.Functions, tracker: &interceptTracker{trapOn: config.TrapOn}}
+}
+
+// LoadModule implements WasmRuntime.LoadModule
+func (r *interceptRuntime) LoadModule(filePath string) (WasmModule, error) {
+	return r.LoadModuleWithHost(filePath, nil, nil)
+}
+
+// LoadModuleBytes implements BufferLoader.LoadModuleBytes
+func (r *interceptRuntime) LoadModuleBytes(name string, data []byte) (WasmModule, error) {
+	return r.LoadModuleWithHost(name, data, nil)
+}
+
+// LoadModuleWithHost implements HostLoader.LoadModuleWithHost
+func (r *interceptRuntime) LoadModuleWithHost(filePath string, data []byte, host []HostFunction) (WasmModule, error) {
+	loader, ok := r.WasmRuntime.(HostLoader)
+	if !ok {
+		return nil, fmt.Errorf("call interception needs a runtime that can link host functions")
+	}
+	if data == nil {
+		var err error
+		if data, err = os.ReadFile(filePath); err != nil {
+			return nil, err
+		}
+	}
+	// Modules that cannot be instrumented are loaded as-is so the runtime
+	// still reports their real load or validation error
+	instrumented, names, err := instrumentIntercept(data, r.functions)
+	if err != nil {
+		r.tracker.report.Error = "instrumentation failed: " + err.Error()
+		return loader.LoadModuleWithHost(filePath, data, host)
+	}
+	r.tracker.report.Instrumented = true
+	r.tracker.names = names
+	linked := append(append([]HostFunction(nil), host...), r.tracker.hook())
+	return loader.LoadModuleWithHost(filePath, instrumented, linked)
+}
+
+// CheckModule implements StageChecker.CheckModule
+func (r *interceptRuntime) CheckModule(filePath string, stage FailureStage) error {
+	return runTruncated(filePath, r.WasmRuntime, stage)
+}
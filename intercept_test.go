@@ -0,0 +1,146 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mrhapile/WASM-Injection-Framework/internal/wasmbin"
+	"github.com/mrhapile/WASM-Injection-Framework/pkg/rewrite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// interceptBinary exports run, which calls double, also exported
+func interceptBinary(t *testing.T) []byte {
+	module, err := rewrite.Parse(pluginBinary())
+	require.NoError(t, err)
+	i32 := []rewrite.ValType{rewrite.I32}
+	double := module.AddFunction(rewrite.FuncType{Params: i32, Results: i32}, nil, []rewrite.Instruction{
+		rewrite.LocalGet(0), rewrite.LocalGet(0), rewrite.Simple(0x6a), rewrite.Simple(rewrite.OpEnd),
+	})
+	require.NoError(t, module.AddExport("double", rewrite.KindFunc, double.Index))
+	require.NoError(t, module.ReplaceFunction(0, nil, []rewrite.Instruction{rewrite.I32Const(21), rewrite.Call(double.Index)}))
+	return module.Encode()
+}
+
+// interceptMockRuntime runs the calls run makes: a call to a trampoline
+// asks the hook it calls first, and traps when told to
+type interceptMockRuntime struct {
+	loaded []byte
+}
+
+func (r *interceptMockRuntime) LoadModule(filePath string) (WasmModule, error) {
+	return nil, errors.New("imports cannot be satisfied")
+}
+
+func (r *interceptMockRuntime) LoadModuleWithHost(filePath string, data []byte, host []HostFunction) (WasmModule, error) {
+	r.loaded = data
+	module, err := rewrite.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	hooks := map[uint32]HostFunction{}
+	for i, imp := range module.Imports {
+		for _, fn := range host {
+			if fn.Module == imp.Module && fn.Name == imp.Name {
+				hooks[uint32(i)] = fn
+			}
+		}
+	}
+	m := &MockWasmModule{}
+	m.ExecuteFunc = func(funcName string, args ...interface{}) ([]interface{}, error) {
+		run, _ := module.ExportedFunction("run")
+		f, err := module.Function(run)
+		if err != nil {
+			return nil, err
+		}
+		for _, instr := range f.Body {
+			callee, ok := instr.FuncIndex()
+			if !ok {
+				continue
+			}
+			target, err := module.Function(callee)
+			if err != nil || len(target.Body) < 2 {
+				continue
+			}
+			hookIndex, _ := target.Body[1].FuncIndex()
+			hook, ok := hooks[hookIndex]
+			if !ok {
+				continue
+			}
+			original, _ := (&wasmbin.Reader{Data: target.Body[0].Imm}).Sleb(32)
+			results, err := hook.Call([]interface{}{int32(original)})
+			if err != nil {
+				return nil, err
+			}
+			if results[0] != int32(0) {
+				return nil, errors.New("unreachable")
+			}
+		}
+		return []interface{}{int32(42)}, nil
+	}
+	return m, nil
+}
+
+// runIntercepted runs a module binary twice with its calls intercepted
+func runIntercepted(t *testing.T, data []byte, runtime WasmRuntime, config InterceptConfig) ExecutionResult {
+	path := filepath.Join(t.TempDir(), "intercept.wasm")
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+	return processWasmFileWithOptions(path, runtime, RunOptions{
+		Invocation: InvocationConfig{Entry: "run", Inputs: []InvocationInput{{}, {}}},
+		Intercept:  config,
+	})
+}
+
+// -----------------------------------------------------------------------------
+// TEST: Call Interception
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// A module calling its own functions never crosses the host boundary, so
+// faults injected on imports cannot reach those calls. Trampolines asking
+// a host hook make each of them visible, and make any of them trap.
+// -----------------------------------------------------------------------------
+
+func TestIntercept_RoutesInternalCallsThroughHook(t *testing.T) {
+	runtime := &interceptMockRuntime{}
+	result := runIntercepted(t, interceptBinary(t), runtime, InterceptConfig{Functions: []string{"double"}})
+	require.True(t, result.Success, result.ErrorMessage)
+	require.NotNil(t, result.Intercept)
+	assert.True(t, result.Intercept.Instrumented)
+	assert.Equal(t, map[string]int{"double": 2}, result.Intercept.Calls, "a call per input")
+	assert.Empty(t, result.Intercept.Trapped)
+
+	module, err := rewrite.Parse(runtime.loaded)
+	require.NoError(t, err)
+	require.Len(t, module.Imports, 1)
+	assert.Equal(t, interceptHookModule, module.Imports[0].Module)
+	assert.Equal(t, rewrite.HookType, module.Types[module.Imports[0].Type])
+}
+
+func TestIntercept_TrapsTheNthCall(t *testing.T) {
+	result := runIntercepted(t, interceptBinary(t), &interceptMockRuntime{}, InterceptConfig{Functions: []string{"1"}, TrapOn: 2})
+	require.NotNil(t, result.Intercept)
+	assert.Equal(t, map[string]int{"1": 2}, result.Intercept.Calls, "functions can be chosen by index")
+	assert.Equal(t, "1", result.Intercept.Trapped)
+	require.Len(t, result.Invocations, 2)
+	assert.True(t, result.Invocations[0].Success)
+	assert.False(t, result.Invocations[1].Success)
+	assert.Contains(t, result.Invocations[1].ErrorMessage, "unreachable")
+}
+
+func TestIntercept_UninstrumentableModulesStillRun(t *testing.T) {
+	data := interceptBinary(t)
+	runtime := &interceptMockRuntime{}
+	result := runIntercepted(t, data, runtime, InterceptConfig{Functions: []string{"missing"}})
+	require.NotNil(t, result.Intercept)
+	assert.False(t, result.Intercept.Instrumented)
+	assert.Contains(t, result.Intercept.Error, "none of the functions to intercept")
+	assert.Equal(t, data, runtime.loaded, "the module is loaded as-is")
+	assert.Empty(t, result.Intercept.Calls)
+}
@@ -0,0 +1,251 @@
+package wasmbin
+
+import (
+	"fmt"
+)
+
+// Instruction is one decoded instruction of a function body or constant
+// expression
+type Instruction struct {
+	Opcode byte
+	// Sub is the secondary opcode of 0xfc, 0xfd and 0xfe instructions
+	Sub uint32
+	// Start and End are the instruction's byte range in the code, and
+	// Immediates where its immediates start, after any secondary opcode
+	Start, Immediates, End int
+	// Index is the first index immediate (label, function, local, ...)
+	Index uint32
+	// Const is the operand of i32.const and i64.const
+	Const int64
+}
+
+// Prefixed reports whether the opcode takes a secondary opcode
+func Prefixed(op byte) bool {
+	return op == 0xfc || op == 0xfd || op == 0xfe
+}
+
+// DecodeInstructions decodes an instruction sequence
+func DecodeInstructions(code []byte) ([]Instruction, error) {
+	var instructions []Instruction
+	r := &Reader{Data: code}
+	for !r.Done() {
+		instr, err := r.Instruction()
+		if err != nil {
+			return nil, fmt.Errorf("offset %d: %w", r.Pos, err)
+		}
+		instructions = append(instructions, instr)
+	}
+	return instructions, nil
+}
+
+// SkipConstExpr skips a constant expression up to and including its end
+func (r *Reader) SkipConstExpr() error {
+	for {
+		instr, err := r.Instruction()
+		if err != nil {
+			return err
+		}
+		if instr.Opcode == 0x0b {
+			return nil
+		}
+	}
+}
+
+// Instruction decodes the instruction at the reader's position
+func (r *Reader) Instruction() (Instruction, error) {
+	instr := Instruction{Start: r.Pos}
+	op, err := r.Byte()
+	if err != nil {
+		return instr, err
+	}
+	instr.Opcode = op
+	if Prefixed(op) {
+		if instr.Sub, err = r.U32(); err != nil {
+			return instr, err
+		}
+	}
+	instr.Immediates = r.Pos
+
+	switch {
+	case op == 0x02 || op == 0x03 || op == 0x04 || op == 0x06:
+		// block, loop, if and try
+		err = r.SkipBlockType()
+	case op == 0x1f:
+		err = r.SkipTryTable()
+	case op == 0x0e:
+		err = r.SkipBrTable()
+	case op == 0x11 || op == 0x13:
+		// call_indirect and return_call_indirect: type and table
+		if instr.Index, err = r.U32(); err == nil {
+			_, err = r.U32()
+		}
+	case op == 0x07 || op == 0x08 || op == 0x09 || op == 0x0c || op == 0x0d ||
+		op == 0x10 || op == 0x12 || op == 0x14 || op == 0x15 || op == 0x18 ||
+		(op >= 0x20 && op <= 0x26) || op == 0xd2 || op == 0xd5 || op == 0xd6:
+		// Single index immediate
+		instr.Index, err = r.U32()
+	case op == 0x1c:
+		// select with explicit result types
+		var n uint32
+		if n, err = r.U32(); err == nil {
+			for i := uint32(0); i < n && err == nil; i++ {
+				err = r.SkipValType()
+			}
+		}
+	case op >= 0x28 && op <= 0x3e:
+		err = r.SkipMemArg()
+	case op == 0x3f || op == 0x40:
+		// memory.size and memory.grow: memory index
+		instr.Index, err = r.U32()
+	case op == 0x41:
+		instr.Const, err = r.Sleb(32)
+	case op == 0x42:
+		instr.Const, err = r.Sleb(64)
+	case op == 0x43:
+		_, err = r.Bytes(4)
+	case op == 0x44:
+		_, err = r.Bytes(8)
+	case op == 0xd0:
+		// ref.null heap type
+		_, err = r.Sleb(33)
+	case op == 0xfc:
+		err = r.SkipMiscImmediates(instr.Sub)
+	case op == 0xfd:
+		err = r.SkipSIMDImmediates(instr.Sub)
+	case op == 0xfe:
+		if instr.Sub == 0x03 {
+			// atomic.fence reserved byte
+			_, err = r.Byte()
+		} else {
+			err = r.SkipMemArg()
+		}
+	case op <= 0x01 || op == 0x05 || op == 0x0a || op == 0x0b || op == 0x0f ||
+		op == 0x19 || op == 0x1a || op == 0x1b || (op >= 0x45 && op <= 0xc4) ||
+		op == 0xd1 || op == 0xd3 || op == 0xd4:
+		// No immediates
+	default:
+		return instr, fmt.Errorf("unsupported opcode 0x%02x", op)
+	}
+	if err != nil {
+		return instr, err
+	}
+
+	instr.End = r.Pos
+	return instr, nil
+}
+
+// SkipBlockType skips an empty, single-value, or type-index block type
+func (r *Reader) SkipBlockType() error {
+	if r.Done() {
+		return ErrTruncated
+	}
+	switch b := r.Data[r.Pos]; b {
+	case 0x40, 0x7f, 0x7e, 0x7d, 0x7c, 0x7b, 0x70, 0x6f, 0x63, 0x64:
+		return r.SkipValType()
+	}
+	_, err := r.Sleb(33)
+	return err
+}
+
+// SkipTryTable skips a try_table's block type and catch clauses
+func (r *Reader) SkipTryTable() error {
+	if err := r.SkipBlockType(); err != nil {
+		return err
+	}
+	n, err := r.U32()
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < n; i++ {
+		kind, err := r.Byte()
+		if err != nil {
+			return err
+		}
+		// catch and catch_ref name a tag before the label
+		if kind == 0x00 || kind == 0x01 {
+			if _, err := r.U32(); err != nil {
+				return err
+			}
+		}
+		if _, err := r.U32(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SkipBrTable skips a br_table's label vector and default label
+func (r *Reader) SkipBrTable() error {
+	n, err := r.U32()
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i <= n; i++ {
+		if _, err := r.U32(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SkipMemArg skips a memory argument, including an explicit memory index
+func (r *Reader) SkipMemArg() error {
+	align, err := r.U32()
+	if err != nil {
+		return err
+	}
+	if align&0x40 != 0 {
+		if _, err := r.U32(); err != nil {
+			return err
+		}
+	}
+	_, err = r.Uleb(64)
+	return err
+}
+
+// SkipMiscImmediates skips the immediates of 0xfc-prefixed instructions
+func (r *Reader) SkipMiscImmediates(sub uint32) error {
+	var indices int
+	switch {
+	case sub <= 7:
+		// Saturating truncations
+	case sub == 8, sub == 10, sub == 12, sub == 14:
+		// memory.init, memory.copy, table.init, table.copy
+		indices = 2
+	case sub == 9, sub == 11, sub == 13, sub >= 15 && sub <= 17:
+		indices = 1
+	default:
+		return fmt.Errorf("unsupported opcode 0xfc %d", sub)
+	}
+	for i := 0; i < indices; i++ {
+		if _, err := r.U32(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SkipSIMDImmediates skips the immediates of 0xfd-prefixed instructions
+func (r *Reader) SkipSIMDImmediates(sub uint32) error {
+	switch {
+	case sub <= 0x0b, sub == 0x5c, sub == 0x5d:
+		// Loads and stores
+		return r.SkipMemArg()
+	case sub == 0x0c, sub == 0x0d:
+		// v128.const and i8x16.shuffle
+		_, err := r.Bytes(16)
+		return err
+	case sub >= 0x15 && sub <= 0x22:
+		// Lane extract and replace
+		_, err := r.Byte()
+		return err
+	case sub >= 0x54 && sub <= 0x5b:
+		// Lane loads and stores
+		if err := r.SkipMemArg(); err != nil {
+			return err
+		}
+		_, err := r.Byte()
+		return err
+	}
+	return nil
+}
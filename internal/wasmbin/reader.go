@@ -0,0 +1,208 @@
+// Package wasmbin decodes the primitive encodings and the instructions of
+// the WebAssembly binary format, for the fuzzer's passes and for the
+// rewrite package alike
+package wasmbin
+
+import (
+	"errors"
+	"fmt"
+)
+
+// External kinds of imports and exports
+const (
+	ExternFunc   byte = 0
+	ExternTable  byte = 1
+	ExternMemory byte = 2
+	ExternGlobal byte = 3
+	ExternTag    byte = 4
+)
+
+// ErrTruncated is returned when a binary ends in the middle of a value
+var ErrTruncated = errors.New("unexpected end of module")
+
+// Reader decodes the primitive encodings of the binary format from Data,
+// starting at Pos
+type Reader struct {
+	Data []byte
+	Pos  int
+}
+
+// Done reports whether the reader has reached the end of its data
+func (r *Reader) Done() bool {
+	return r.Pos >= len(r.Data)
+}
+
+// Capacity bounds the count of a vector, as the binary gives it, by the
+// bytes left, since every entry takes at least one. Vectors are
+// preallocated with it, so a binary lying about a count cannot exhaust
+// memory.
+func (r *Reader) Capacity(count uint32) int {
+	if left := len(r.Data) - r.Pos; left < 0 {
+		return 0
+	} else if uint64(count) > uint64(left) {
+		return left
+	}
+	return int(count)
+}
+
+func (r *Reader) Byte() (byte, error) {
+	if r.Done() {
+		return 0, ErrTruncated
+	}
+	b := r.Data[r.Pos]
+	r.Pos++
+	return b, nil
+}
+
+func (r *Reader) Bytes(n int) ([]byte, error) {
+	if n < 0 || r.Pos+n > len(r.Data) {
+		return nil, ErrTruncated
+	}
+	b := r.Data[r.Pos : r.Pos+n]
+	r.Pos += n
+	return b, nil
+}
+
+// Uleb reads an unsigned LEB128 value of at most the given bit width
+func (r *Reader) Uleb(bits uint) (uint64, error) {
+	var value uint64
+	for shift := uint(0); ; shift += 7 {
+		if shift >= bits {
+			return 0, errors.New("integer representation too long")
+		}
+		b, err := r.Byte()
+		if err != nil {
+			return 0, err
+		}
+		value |= uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return value, nil
+		}
+	}
+}
+
+// Sleb reads a signed LEB128 value of at most the given bit width
+func (r *Reader) Sleb(bits uint) (int64, error) {
+	var value int64
+	for shift := uint(0); ; shift += 7 {
+		if shift >= bits {
+			return 0, errors.New("integer representation too long")
+		}
+		b, err := r.Byte()
+		if err != nil {
+			return 0, err
+		}
+		value |= int64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			if shift+7 < 64 && b&0x40 != 0 {
+				value |= -1 << (shift + 7)
+			}
+			return value, nil
+		}
+	}
+}
+
+func (r *Reader) U32() (uint32, error) {
+	v, err := r.Uleb(32)
+	return uint32(v), err
+}
+
+func (r *Reader) Name() (string, error) {
+	n, err := r.U32()
+	if err != nil {
+		return "", err
+	}
+	b, err := r.Bytes(int(n))
+	return string(b), err
+}
+
+// SkipValType skips a value type, including typed references
+func (r *Reader) SkipValType() error {
+	b, err := r.Byte()
+	if err != nil {
+		return err
+	}
+	if b == 0x63 || b == 0x64 {
+		_, err = r.Sleb(33)
+	}
+	return err
+}
+
+// SkipLimits skips table or memory limits
+func (r *Reader) SkipLimits() error {
+	flags, err := r.Byte()
+	if err != nil {
+		return err
+	}
+	if _, err := r.Uleb(64); err != nil {
+		return err
+	}
+	if flags&0x01 != 0 {
+		_, err = r.Uleb(64)
+	}
+	return err
+}
+
+// SkipImportDesc skips the description following an import's kind byte
+func (r *Reader) SkipImportDesc(kind byte) error {
+	switch kind {
+	case ExternFunc:
+		_, err := r.U32()
+		return err
+	case ExternTable:
+		if err := r.SkipValType(); err != nil {
+			return err
+		}
+		return r.SkipLimits()
+	case ExternMemory:
+		return r.SkipLimits()
+	case ExternGlobal:
+		if err := r.SkipValType(); err != nil {
+			return err
+		}
+		_, err := r.Byte()
+		return err
+	case ExternTag:
+		if _, err := r.Byte(); err != nil {
+			return err
+		}
+		_, err := r.U32()
+		return err
+	}
+	return fmt.Errorf("unknown import kind 0x%02x", kind)
+}
+
+// AppendU32 appends an unsigned LEB128 value
+func AppendU32(b []byte, v uint32) []byte {
+	for {
+		c := byte(v & 0x7f)
+		v >>= 7
+		if v == 0 {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
+
+// AppendS32 appends a signed LEB128 value
+func AppendS32(b []byte, v int32) []byte {
+	return AppendS64(b, int64(v))
+}
+
+// AppendS64 appends a signed LEB128 value
+func AppendS64(b []byte, v int64) []byte {
+	for {
+		c := byte(v & 0x7f)
+		v >>= 7
+		if (v == 0 && c&0x40 == 0) || (v == -1 && c&0x40 != 0) {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
+
+// AppendName appends a length-prefixed UTF-8 name
+func AppendName(b []byte, name string) []byte {
+	b = AppendU32(b, uint32(len(name)))
+	return append(b, name...)
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FuncSignature is the type of an exported function
+type FuncSignature struct {
+	Params  []string `json:"params"`
+	Results []string `json:"results"`
+}
+
+// String formats the signature as "(i32, i64) -> (f64)"
+func (s FuncSignature) String() string {
+	return fmt.Sprintf("(%s) -> (%s)", strings.Join(s.Params, ", "), strings.Join(s.Results, ", "))
+}
+
+// SignatureModule is implemented by modules that can report the type of
+// their exports, so inputs are checked against the entry's parameters
+// instead of being passed blindly
+type SignatureModule interface {
+	WasmModule
+	// Signature returns the type of the named export, or false if the
+	// module has no exported function of that name
+	Signature(funcName string) (FuncSignature, bool)
+}
+
+// InvocationInput is the argument list of one entry call. In YAML it is a
+// single value or a list of values, one per parameter; an empty list calls
+// a function without parameters. Plain numbers are converted to the
+// parameter's type, while typed values such as {type: i64, value: "5"},
+// as reports print them, must match it exactly.
+type InvocationInput []WasmValue
+
+// UnmarshalYAML implements yaml.Unmarshaler
+func (in *InvocationInput) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.SequenceNode {
+		value, err := decodeInputValue(node)
+		if err != nil {
+			return err
+		}
+		*in = InvocationInput{value}
+		return nil
+	}
+
+	values := make(InvocationInput, 0, len(node.Content))
+	for _, item := range node.Content {
+		value, err := decodeInputValue(item)
+		if err != nil {
+			return err
+		}
+		values = append(values, value)
+	}
+	*in = values
+	return nil
+}
+
+// MarshalYAML implements yaml.Marshaler, writing inputs back the way they
+// are read: plain values as scalars and structured values as YAML
+func (in InvocationInput) MarshalYAML() (interface{}, error) {
+	values := make([]interface{}, len(in))
+	for i, value := range in {
+		switch value.Type {
+		case "":
+			values[i] = value.Value
+		case structuredValueType:
+			var structured interface{}
+			if err := json.Unmarshal([]byte(value.Value), &structured); err != nil {
+				return nil, err
+			}
+			values[i] = structured
+		default:
+			values[i] = map[string]string{"type": value.Type, "value": value.Value}
+		}
+	}
+	return values, nil
+}
+
+// decodeInputValue decodes a plain scalar or a typed value mapping. Other
+// lists and mappings are structured values for WIT-typed parameters.
+func decodeInputValue(node *yaml.Node) (WasmValue, error) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		return WasmValue{Value: node.Value}, nil
+	case yaml.MappingNode:
+		if isTypedValueNode(node) {
+			var value WasmValue
+			if err := node.Decode(&value); err != nil {
+				return value, err
+			}
+			return value, nil
+		}
+	case yaml.SequenceNode:
+	default:
+		return WasmValue{}, fmt.Errorf("line %d: input values must be scalars, lists or mappings", node.Line)
+	}
+
+	var decoded interface{}
+	if err := node.Decode(&decoded); err != nil {
+		return WasmValue{}, err
+	}
+	value, err := yamlStructuredValue(decoded)
+	if err != nil {
+		return value, fmt.Errorf("line %d: %v", node.Line, err)
+	}
+	return value, nil
+}
+
+// isTypedValueNode reports whether a mapping is a {type, value} pair
+func isTypedValueNode(node *yaml.Node) bool {
+	if len(node.Content) != 4 {
+		return false
+	}
+	keys := map[string]bool{node.Content[0].Value: true, node.Content[2].Value: true}
+	return keys["type"] && keys["value"]
+}
+
+// i32Input builds a typed input of i32 arguments
+func i32Input(args ...int32) InvocationInput {
+	input := make(InvocationInput, len(args))
+	for i, arg := range args {
+		input[i] = encodeValue(arg)
+	}
+	return input
+}
+
+// arguments converts every configured input into call arguments for the
+// entry export. When the module reports the entry's signature, inputs whose
+// arity or types do not fit it fail at StageSignature before anything runs.
+// Without a signature, plain numbers are passed as i32 as before. Buffer
+// inputs stay buffers until each call lowers them into guest memory.
+func (c InvocationConfig) arguments(module WasmModule) ([][]interface{}, error) {
+	var signature *FuncSignature
+	if typed, ok := module.(SignatureModule); ok {
+		if sig, found := typed.Signature(c.Entry); found {
+			signature = &sig
+		}
+	}
+	switch c.ABI {
+	case "":
+	case ABIExtism:
+		return c.extismArguments(signature)
+	case ABIProxyWasm:
+		return c.proxyWasmArguments()
+	case ABIGo:
+		if c.callsGoFunction(module) {
+			return c.goArguments()
+		}
+	default:
+		if platform, ok := contractPlatforms[c.ABI]; ok {
+			return c.contractArguments(platform, signature)
+		}
+		return nil, &RuntimeError{Stage: StageSignature, Message: fmt.Sprintf("unknown ABI %q", c.ABI)}
+	}
+	if c.function != nil {
+		return c.witArguments(module, signature)
+	}
+
+	buffers := c.Buffers.withDefaults()
+	if c.hasBufferInputs() {
+		err := buffers.validate()
+		if err == nil {
+			_, err = newGuestMemory(module, buffers)
+		}
+		if err != nil {
+			return nil, &RuntimeError{Stage: StageSignature, Message: fmt.Sprintf("buffer inputs: %v", err)}
+		}
+	}
+
+	calls := make([][]interface{}, len(c.Inputs))
+	for i, input := range c.Inputs {
+		args, err := bindArguments(input, signature, buffers)
+		if err != nil {
+			message := fmt.Sprintf("input %d: %v", i, err)
+			if signature != nil {
+				message = fmt.Sprintf("'%s' has signature %s; input %d: %v", c.Entry, signature, i, err)
+			}
+			return nil, &RuntimeError{Stage: StageSignature, Message: "signature mismatch: " + message}
+		}
+		calls[i] = args
+	}
+	return calls, nil
+}
+
+// witArguments binds every input to the entry's WIT parameter types. The
+// core export must have the signature the WIT type lowers to, and a
+// cabi_realloc allocator when arguments are written to memory.
+func (c InvocationConfig) witArguments(module WasmModule, signature *FuncSignature) ([][]interface{}, error) {
+	fn := c.function
+	if signature != nil {
+		if err := checkWITSignature(fn, c.Entry, *signature); err != nil {
+			return nil, &RuntimeError{Stage: StageSignature, Message: "signature mismatch: " + err.Error()}
+		}
+	}
+	if witNeedsMemory(fn) {
+		if _, err := newGuestMemory(module, c.witMemory()); err != nil {
+			return nil, &RuntimeError{Stage: StageSignature, Message: fmt.Sprintf("wit: %v", err)}
+		}
+	}
+
+	calls := make([][]interface{}, len(c.Inputs))
+	for i, input := range c.Inputs {
+		args, err := bindWITArguments(input, fn)
+		if err != nil {
+			return nil, &RuntimeError{
+				Stage:   StageSignature,
+				Message: fmt.Sprintf("signature mismatch: '%s' has WIT type %s; input %d: %v", c.Entry, fn, i, err),
+			}
+		}
+		calls[i] = args
+	}
+	return calls, nil
+}
+
+// witMemory is the memory configuration for canonical ABI lowering
+func (c InvocationConfig) witMemory() MemoryConfig {
+	return MemoryConfig{Convention: ConventionCanonicalABI, Memory: c.Buffers.Memory, Allocator: AllocatorCanonicalABI}
+}
+
+// hasBufferInputs reports whether any input is passed in memory
+func (c InvocationConfig) hasBufferInputs() bool {
+	for _, input := range c.Inputs {
+		for _, value := range input {
+			if isBufferType(value.Type) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// bindArguments converts one input to the given signature's parameter
+// types. Each buffer takes the i32 parameters its convention lowers it to.
+func bindArguments(input InvocationInput, signature *FuncSignature, buffers MemoryConfig) ([]interface{}, error) {
+	params, lowered := 0, false
+	for _, value := range input {
+		if isBufferType(value.Type) {
+			params += buffers.params()
+			lowered = true
+		} else {
+			params++
+		}
+	}
+	if signature != nil && params != len(signature.Params) {
+		if lowered {
+			return nil, fmt.Errorf("%d arguments given, lowered to %d parameters, %d expected", len(input), params, len(signature.Params))
+		}
+		return nil, fmt.Errorf("%d arguments given, %d expected", len(input), len(signature.Params))
+	}
+	if lowered && buffers.Convention == ConventionCanonicalABI && params > maxFlatParams {
+		return nil, fmt.Errorf("%d parameters after lowering exceed the canonical ABI's %d", params, maxFlatParams)
+	}
+
+	args := make([]interface{}, len(input))
+	param := 0
+	for i, value := range input {
+		if value.Type == structuredValueType {
+			return nil, fmt.Errorf("argument %d: structured values need WIT interface types", i)
+		}
+		if isBufferType(value.Type) {
+			arg, err := bindBuffer(value, signature, param, buffers)
+			if err != nil {
+				return nil, fmt.Errorf("argument %d: %w", i, err)
+			}
+			args[i] = arg
+			param += buffers.params()
+			continue
+		}
+
+		valType := value.Type
+		if signature != nil {
+			valType = signature.Params[param]
+		} else if valType == "" {
+			valType = "i32"
+		}
+		arg, err := convertArgument(value, valType)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %w", i, err)
+		}
+		args[i] = arg
+		param++
+	}
+	return args, nil
+}
+
+// bindBuffer decodes a buffer input whose lowered parameters start at param
+func bindBuffer(value WasmValue, signature *FuncSignature, param int, buffers MemoryConfig) (bufferArg, error) {
+	if signature != nil {
+		for _, valType := range signature.Params[param : param+buffers.params()] {
+			if valType != "i32" {
+				return bufferArg{}, fmt.Errorf("%s value given for %s parameter", value.Type, valType)
+			}
+		}
+	}
+	arg, err := decodeBuffer(value)
+	if err != nil {
+		return arg, err
+	}
+	return arg, buffers.checkBuffer(arg)
+}
+
+// convertArgument converts a value to a parameter type. Typed values must
+// already have that type; plain numbers are parsed as it.
+func convertArgument(value WasmValue, valType string) (interface{}, error) {
+	if value.Type != "" {
+		if value.Type != valType {
+			return nil, fmt.Errorf("%s value given for %s parameter", value.Type, valType)
+		}
+		if valType == "v128" {
+			return nil, fmt.Errorf("v128 parameters are not supported")
+		}
+		return decodeValue(value)
+	}
+
+	switch valType {
+	case "i32":
+		n, err := parseInteger(value.Value, 32)
+		if err != nil {
+			return nil, err
+		}
+		return int32(n), nil
+	case "i64":
+		return parseInteger(value.Value, 64)
+	case "f32":
+		f, err := strconv.ParseFloat(value.Value, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid f32 value %q", value.Value)
+		}
+		return float32(f), nil
+	case "f64":
+		f, err := strconv.ParseFloat(value.Value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid f64 value %q", value.Value)
+		}
+		return f, nil
+	}
+	return nil, fmt.Errorf("%s parameters are not supported", valType)
+}
+
+// parseInteger parses a decimal or 0x-prefixed integer of the given width,
+// accepting both signed and unsigned spellings of the same bits
+func parseInteger(s string, bits int) (int64, error) {
+	if n, err := strconv.ParseInt(s, 0, bits); err == nil {
+		return n, nil
+	}
+	u, err := strconv.ParseUint(s, 0, bits)
+	if err != nil {
+		return 0, fmt.Errorf("invalid i%d value %q", bits, s)
+	}
+	if bits == 32 {
+		return int64(int32(uint32(u))), nil
+	}
+	return int64(u), nil
+}
+
+// i32Arguments narrows call arguments to i32 vectors for argument fuzzing
+func i32Arguments(calls [][]interface{}) ([][]int32, error) {
+	vectors := make([][]int32, len(calls))
+	for i, args := range calls {
+		vectors[i] = make([]int32, len(args))
+		for j, arg := range args {
+			n, ok := arg.(int32)
+			if !ok {
+				return nil, &RuntimeError{
+					Stage:   StageSignature,
+					Message: fmt.Sprintf("signature mismatch: argument fuzzing supports i32 parameters only, argument %d is %s", j, encodeValue(arg).Type),
+				}
+			}
+			vectors[i][j] = n
+		}
+	}
+	return vectors, nil
+}
+
+// describeArgs formats arguments for error messages, e.g. "1, -2"
+func describeArgs(args []WasmValue) string {
+	if len(args) == 0 {
+		return "()"
+	}
+	values := make([]string, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	return strings.Join(values, ", ")
+}
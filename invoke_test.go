@@ -0,0 +1,177 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+// signatureMockModule reports fixed export signatures and records the
+// arguments of every call
+type signatureMockModule struct {
+	MockWasmModule
+	signatures map[string]FuncSignature
+	calls      [][]interface{}
+}
+
+func (m *signatureMockModule) Signature(funcName string) (FuncSignature, bool) {
+	sig, ok := m.signatures[funcName]
+	return sig, ok
+}
+
+func (m *signatureMockModule) Execute(funcName string, args ...interface{}) ([]interface{}, error) {
+	m.calls = append(m.calls, args)
+	return m.MockWasmModule.Execute(funcName, args...)
+}
+
+// runWithSignature processes a file whose "process" export has the given type
+func runWithSignature(sig FuncSignature, opts RunOptions) (ExecutionResult, *signatureMockModule) {
+	module := &signatureMockModule{signatures: map[string]FuncSignature{"process": sig}}
+	module.ExecuteFunc = func(funcName string, args ...interface{}) ([]interface{}, error) {
+		return []interface{}{int32(len(args)), int64(7)}, nil
+	}
+	mockRuntime := &MockWasmRuntime{
+		LoadModuleFunc: func(filePath string) (WasmModule, error) { return module, nil },
+	}
+	return processWasmFileWithOptions("/test/sig.wasm", mockRuntime, opts), module
+}
+
+// -----------------------------------------------------------------------------
+// TEST: Signature-Aware Invocation
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Entry functions take any number of parameters of any numeric type and may
+// return several values. Calling them with arguments that do not fit their
+// type produces runtime errors that look like bugs in the module, so such
+// inputs must be reported as a configuration problem before anything runs.
+// -----------------------------------------------------------------------------
+
+func TestInvoke_ParsesInputForms(t *testing.T) {
+	var config InvocationConfig
+	err := yaml.Unmarshal([]byte(`
+inputs:
+  - 5
+  - [1, 0x10]
+  - []
+  - [{type: i64, value: "9"}, 2.5]
+`), &config)
+	require.NoError(t, err)
+
+	require.Len(t, config.Inputs, 4)
+	assert.Equal(t, InvocationInput{{Value: "5"}}, config.Inputs[0])
+	assert.Equal(t, InvocationInput{{Value: "1"}, {Value: "0x10"}}, config.Inputs[1])
+	assert.Empty(t, config.Inputs[2])
+	assert.Equal(t, InvocationInput{{Type: "i64", Value: "9"}, {Value: "2.5"}}, config.Inputs[3])
+}
+
+func TestInvoke_NestedInputsNeedWIT(t *testing.T) {
+	var config InvocationConfig
+	err := yaml.Unmarshal([]byte(`inputs: [[[1, 2]]]`), &config)
+	require.NoError(t, err)
+	assert.Equal(t, InvocationInput{{Type: structuredValueType, Value: "[1,2]"}}, config.Inputs[0])
+
+	sig := FuncSignature{Params: []string{"i32"}, Results: []string{}}
+	result, module := runWithSignature(sig, RunOptions{Invocation: config})
+
+	assert.Equal(t, StageSignature, result.FailureStage)
+	assert.Contains(t, result.ErrorMessage, "argument 0: structured values need WIT interface types")
+	assert.Empty(t, module.calls)
+}
+
+func TestInvoke_ConvertsToParameterTypes(t *testing.T) {
+	sig := FuncSignature{Params: []string{"i32", "i64", "f32", "f64"}, Results: []string{"i32", "i64"}}
+	input := InvocationInput{{Value: "0xffffffff"}, {Value: "-3"}, {Value: "1.5"}, {Type: "f64", Value: "0x3ff0000000000000"}}
+
+	result, module := runWithSignature(sig, RunOptions{Invocation: InvocationConfig{Inputs: []InvocationInput{input}}})
+
+	require.True(t, result.Success, result.ErrorMessage)
+	assert.Equal(t, [][]interface{}{{int32(-1), int64(-3), float32(1.5), float64(1)}}, module.calls)
+	assert.Equal(t, []WasmValue{{Type: "i32", Value: "4"}, {Type: "i64", Value: "7"}}, result.TypedReturnValues, "every return value is reported")
+}
+
+func TestInvoke_CallsZeroArgFunctions(t *testing.T) {
+	sig := FuncSignature{Params: []string{}, Results: []string{}}
+
+	result, module := runWithSignature(sig, RunOptions{Invocation: InvocationConfig{Inputs: []InvocationInput{{}}}})
+
+	require.True(t, result.Success, result.ErrorMessage)
+	assert.Equal(t, [][]interface{}{{}}, module.calls)
+}
+
+func TestInvoke_ArityMismatchIsSignatureFailure(t *testing.T) {
+	sig := FuncSignature{Params: []string{}, Results: []string{"i32"}}
+
+	// The default input is a single i32
+	result, module := runWithSignature(sig, RunOptions{})
+
+	assert.False(t, result.Success)
+	assert.Equal(t, StageSignature, result.FailureStage)
+	assert.Equal(t, "signature mismatch: 'process' has signature () -> (i32); input 0: 1 arguments given, 0 expected", result.ErrorMessage)
+	assert.Empty(t, module.calls, "nothing runs when an input does not fit")
+}
+
+func TestInvoke_TypedValuesMustMatch(t *testing.T) {
+	sig := FuncSignature{Params: []string{"i64"}, Results: []string{"i32"}}
+
+	result, _ := runWithSignature(sig, RunOptions{})
+
+	assert.Equal(t, StageSignature, result.FailureStage)
+	assert.Contains(t, result.ErrorMessage, "argument 0: i32 value given for i64 parameter")
+
+	result, module := runWithSignature(sig, RunOptions{Invocation: InvocationConfig{Inputs: []InvocationInput{{{Value: "1"}}}}})
+	assert.True(t, result.Success, "plain numbers adapt to the parameter type")
+	assert.Equal(t, [][]interface{}{{int64(1)}}, module.calls)
+}
+
+func TestInvoke_UnknownEntryStillFailsAtExecute(t *testing.T) {
+	module := &signatureMockModule{}
+	module.ExecuteFunc = func(funcName string, args ...interface{}) ([]interface{}, error) {
+		return nil, &RuntimeError{Stage: StageExecute, Message: "function 'process' not found in module exports"}
+	}
+	mockRuntime := &MockWasmRuntime{
+		LoadModuleFunc: func(filePath string) (WasmModule, error) { return module, nil },
+	}
+
+	result := processWasmFileWithRuntime("/test/missing.wasm", mockRuntime)
+
+	assert.Equal(t, StageExecute, result.FailureStage)
+}
+
+func TestInvoke_ArgFuzzMutatesEveryParameter(t *testing.T) {
+	sig := FuncSignature{Params: []string{"i32", "i32"}, Results: []string{"i32"}}
+	opts := RunOptions{
+		Invocation: InvocationConfig{Inputs: []InvocationInput{{{Value: "1"}, {Value: "2"}}}},
+		ArgFuzz:    ArgFuzzConfig{Iterations: 100, Seed: 5},
+	}
+
+	result, module := runWithSignature(sig, opts)
+
+	require.True(t, result.Success, result.ErrorMessage)
+	changed := [2]bool{}
+	for _, args := range module.calls {
+		require.Len(t, args, 2)
+		changed[0] = changed[0] || args[0] != int32(1)
+		changed[1] = changed[1] || args[1] != int32(2)
+	}
+	assert.Equal(t, [2]bool{true, true}, changed)
+}
+
+func TestInvoke_ArgFuzzRequiresI32Parameters(t *testing.T) {
+	sig := FuncSignature{Params: []string{"f64"}, Results: []string{}}
+	opts := RunOptions{
+		Invocation: InvocationConfig{Inputs: []InvocationInput{{{Value: "1"}}}},
+		ArgFuzz:    ArgFuzzConfig{Iterations: 10},
+	}
+
+	result, module := runWithSignature(sig, opts)
+
+	assert.Equal(t, StageSignature, result.FailureStage)
+	assert.Contains(t, result.ErrorMessage, "argument fuzzing supports i32 parameters only")
+	assert.Empty(t, module.calls)
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SubStageHang refines the stage in which a file made no progress for the
+// hang timeout, so its worker was killed
+const SubStageHang = "hang"
+
+// stageStarted is called as the pipeline enters each stage. Campaign
+// workers report it to their parent, whose watchdog counts it as progress.
+var stageStarted = func(stage FailureStage) {}
+
+// stageFinished is called as the pipeline leaves a stage that succeeded,
+// and fails the stage with the error it returns. Lifecycle hooks set it
+// for the file being run.
+var stageFinished = func(stage FailureStage) error { return nil }
+
+// workerMessage is one line a campaign worker writes: the stage the file
+// has reached, or its result
+type workerMessage struct {
+	Stage  FailureStage     `json:"stage,omitempty"`
+	Result *ExecutionResult `json:"result,omitempty"`
+}
+
+// workerEncoder writes the messages of a campaign worker one at a time
+type workerEncoder struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+func (e *workerEncoder) send(msg workerMessage) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.encoder.Encode(msg)
+}
+
+// workerRequest is one line a campaign's parent writes: the file for the
+// worker to run, with the chaos it runs under or without any injections
+type workerRequest struct {
+	FilePath string        `json:"file"`
+	Chaos    *ChaosProfile `json:"chaos,omitempty"`
+	Clean    bool          `json:"clean,omitempty"`
+}
+
+// serveCampaignWorker runs the files it reads requests for and writes
+// each result
+func serveCampaignWorker(requests io.Reader, responses *workerEncoder, runtime WasmRuntime, opts RunOptions) error {
+	tracker := debugTracker(runtime, opts)
+	pressure := startMemoryPressure(opts.MemoryPressure)
+	decoder := json.NewDecoder(requests)
+	for {
+		var request workerRequest
+		if err := decoder.Decode(&request); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		run := opts
+		run.chaos = request.Chaos
+		if request.Clean {
+			run = run.clean()
+		}
+		pressure.use(run.MemoryPressure)
+		result := processAudited(request.FilePath, runtime, tracker, run)
+		// The result is written without pressure, so it gets out
+		pressure.relieve()
+		if err := responses.send(workerMessage{Result: &result}); err != nil {
+			return err
+		}
+	}
+}
+
+// workerProcess is a running campaign worker
+type workerProcess struct {
+	requests  io.WriteCloser
+	responses io.Reader
+	// stderr keeps what the worker wrote to its stderr, where sanitizers
+	// report
+	stderr *workerStderr
+	// pid identifies the worker's core dump
+	pid int
+	// kill stops the worker at once; wait reaps it and describes its exit
+	kill func()
+	wait func() string
+}
+
+// startWorker launches a campaign worker with the given arguments, in the
+// given environment or the fuzzer's when it is nil
+var startWorker = func(args, env []string) (*workerProcess, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(self, args...)
+	cmd.Env = env
+	stderr := &workerStderr{out: os.Stderr}
+	cmd.Stderr = stderr
+	requests, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	responses, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &workerProcess{
+		requests:  requests,
+		responses: responses,
+		stderr:    stderr,
+		pid:       cmd.Process.Pid,
+		kill:      func() { cmd.Process.Kill() },
+		wait: func() string {
+			requests.Close()
+			cmd.Wait()
+			return cmd.ProcessState.String()
+		},
+	}, nil
+}
+
+// isolatedWorker runs the files of one environment in a worker subprocess,
+// so a file that wedges or crashes the runtime only takes the worker down.
+// A watchdog kills the worker when a file makes no progress, and a dead
+// worker is replaced for the next file.
+type isolatedWorker struct {
+	args    []string
+	env     []string
+	timeout time.Duration
+	crashes *crashStore
+	restart RestartConfig
+	process *workerProcess
+	decoder *json.Decoder
+	// started is when the worker was started, which its core dump cannot
+	// predate
+	started time.Time
+	// deaths counts the workers in a row that died before running their
+	// file, and loop is set once they make a crash loop
+	deaths   int
+	restarts int
+	loop     *CrashLoop
+	// crashed holds the result of each file that crashed the worker
+	crashed map[string]ExecutionResult
+	// heartbeat beats for each stage the worker reports
+	heartbeat *heartbeat
+}
+
+// newIsolatedWorkers returns a worker per environment. Workers are started
+// on their first file.
+func newIsolatedWorkers(envs int, opts RunOptions) []*isolatedWorker {
+	env := opts.Sanitizer.environ()
+	crashes := newCrashStore(opts.Crashes)
+	if crashes != nil {
+		// Go exits on a fault in C code without dumping core unless asked
+		if env == nil {
+			env = os.Environ()
+		}
+		env = append(env, "GOTRACEBACK=crash")
+	}
+	workers := make([]*isolatedWorker, envs)
+	for i := range workers {
+		args := append([]string{"campaign-worker", strconv.Itoa(i)}, opts.WorkerArgs...)
+		workers[i] = &isolatedWorker{
+			args:    args,
+			env:     env,
+			timeout: opts.HangTimeout,
+			crashes: crashes,
+			restart: opts.Restart.withDefaults(),
+			crashed: make(map[string]ExecutionResult),
+		}
+	}
+	return workers
+}
+
+// run runs a file in the worker
+func (w *isolatedWorker) run(request workerRequest) (result ExecutionResult) {
+	filePath := request.FilePath
+	if w.loop != nil {
+		w.loop.Skipped++
+		return skippedResult(filePath, SkipCrashLoop, crashLoopDetails(w.loop))
+	}
+	// A file is not run again in the worker it crashed, so its reruns
+	// report the crash rather than cause more
+	if crash, ok := w.crashed[filePath]; ok {
+		return crash
+	}
+	// Files the worker gave no result for still ran under their chaos
+	defer func() {
+		if result.Chaos == nil && request.Chaos != nil {
+			profile := *request.Chaos
+			result.Chaos = &profile
+		}
+	}()
+	if w.process == nil {
+		if w.deaths > 0 {
+			restartPause(w.restart.backoff(w.deaths))
+		}
+		if !w.started.IsZero() {
+			w.restarts++
+		}
+		process, err := startWorker(w.args, w.env)
+		if err != nil {
+			return w.died(workerFailure(filePath, StageLoad, "", fmt.Sprintf("failed to start worker: %v", err)), false)
+		}
+		w.process, w.decoder = process, json.NewDecoder(process.responses)
+		w.started = time.Now()
+	}
+
+	// Only what the worker writes for this file can be its report
+	stderr, pid := w.process.stderr, w.process.pid
+	stderr.take()
+
+	stage, progressed := StageLoad, false
+	watch := startWatchdog(w.timeout, w.process.kill)
+	line, _ := json.Marshal(request)
+	_, err := w.process.requests.Write(append(line, '\n'))
+	for err == nil {
+		var msg workerMessage
+		if err = w.decoder.Decode(&msg); err != nil {
+			break
+		}
+		if msg.Result != nil {
+			// The watchdog may have fired just as the result came in
+			if watch.stop() {
+				w.stopProcess()
+			}
+			w.deaths = 0
+			return *msg.Result
+		}
+		stage, progressed = msg.Stage, true
+		watch.progress()
+		w.heartbeat.stage(stage)
+	}
+
+	hung := watch.stop()
+	exit := w.stopProcess()
+	if hung {
+		return w.died(workerFailure(filePath, stage, SubStageHang, fmt.Sprintf("no progress for %s in the %s stage, worker killed", w.timeout, stage)), progressed)
+	}
+	// The worker has been reaped, so its stderr and core dump are complete
+	text := stderr.take()
+	if report, summary := parseSanitizerReport(text); report != "" {
+		result = workerFailure(filePath, stage, SubStageSanitizer, summary)
+		result.SanitizerReport = report
+	} else {
+		result = workerFailure(filePath, stage, "", fmt.Sprintf("worker died in the %s stage: %s", stage, exit))
+	}
+	if crashSignal(exit) {
+		result.Crash = parseCrash(exit, text)
+		result.CrashBundle = w.crashes.keep(filePath, pid, w.started, exit)
+		locateCrash(result.Crash, result.CrashBundle)
+	}
+	return w.died(result, progressed)
+}
+
+// died records the death of a worker. A worker that died once it was
+// running its file died of the file; one that died before, or failed to
+// start, is backed off, and makes a crash loop once enough in a row did.
+func (w *isolatedWorker) died(result ExecutionResult, progressed bool) ExecutionResult {
+	if progressed {
+		w.deaths = 0
+		if crashedWorker(result) {
+			w.crashed[result.FilePath] = result
+		}
+		return result
+	}
+	w.deaths++
+	if w.deaths >= w.restart.CrashLoop {
+		w.loop = &CrashLoop{Worker: w.args[0], Deaths: w.deaths, LastError: result.ErrorMessage}
+		emitError(map[string]string{
+			"warning": "worker crash loop, skipping the environment's remaining files",
+			"worker":  strings.Join(w.args[:2], " "),
+			"details": crashLoopDetails(w.loop),
+		})
+	}
+	return result
+}
+
+// stopProcess reaps the worker, which is started again for the next file
+func (w *isolatedWorker) stopProcess() string {
+	w.process.kill()
+	exit := w.process.wait()
+	w.process, w.decoder = nil, nil
+	return exit
+}
+
+// Close stops the worker
+func (w *isolatedWorker) Close() {
+	if w.process != nil {
+		w.process.requests.Close()
+		w.process.wait()
+		w.process = nil
+	}
+}
+
+// workerFailure is the result of a file its worker could not report on
+func workerFailure(filePath string, stage FailureStage, subStage, message string) ExecutionResult {
+	return ExecutionResult{
+		SchemaVersion:   SchemaVersion,
+		FilePath:        filePath,
+		FileName:        filepath.Base(filePath),
+		FailureStage:    stage,
+		FailureSubStage: subStage,
+		ErrorMessage:    message,
+	}
+}
+
+// runCampaignWorker is the hidden subcommand isolated campaigns launch. It
+// runs files of one environment of the campaign its arguments describe.
+func runCampaignWorker(args []string) int {
+	return serveWorkerCommand(args, func(Config) {})
+}
+
+// serveWorkerCommand serves the files of the environment and campaign the
+// arguments of a worker describe, once setup has prepared the worker for
+// the campaign's config
+func serveWorkerCommand(args []string, setup func(config Config)) int {
+	if len(args) == 0 {
+		return 1
+	}
+	index, err := strconv.Atoi(args[0])
+	if err != nil {
+		return 1
+	}
+	command, ok := parseFuzzCommand(args[1:])
+	if !ok {
+		return 1
+	}
+	config, envs, ok := prepareCampaign(command.dirPath, command.configPath)
+	if !ok {
+		return 1
+	}
+	defer closeRuntimes(envs)
+	command.apply(&config)
+	if index < 0 || index >= len(envs) {
+		emitError(map[string]string{"error": fmt.Sprintf("no environment %d", index)})
+		return 1
+	}
+
+	setup(config)
+
+	responses := &workerEncoder{encoder: json.NewEncoder(os.Stdout)}
+	stageStarted = func(stage FailureStage) {
+		responses.send(workerMessage{Stage: stage})
+	}
+	if err := serveCampaignWorker(os.Stdin, responses, envs[index].Runtime, config.runOptions()); err != nil {
+		return 1
+	}
+	return 0
+}
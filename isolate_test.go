@@ -0,0 +1,168 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeWorkers replaces worker subprocesses with goroutines serving runtime
+// over pipes, and returns the number of workers started. The stage hook is
+// set once, sending to the latest worker, and restored only once every
+// worker's goroutine is done, so no worker ever sees it change.
+func fakeWorkers(t *testing.T, runtime WasmRuntime) *int {
+	started := 0
+	var (
+		mu      sync.Mutex
+		current *workerEncoder
+		serving sync.WaitGroup
+	)
+	originalStart, originalStage := startWorker, stageStarted
+	stageStarted = func(stage FailureStage) {
+		mu.Lock()
+		responses := current
+		mu.Unlock()
+		responses.send(workerMessage{Stage: stage})
+	}
+	startWorker = func(args, env []string) (*workerProcess, error) {
+		started++
+		reqRead, reqWrite, err := os.Pipe()
+		require.NoError(t, err)
+		respRead, respWrite, err := os.Pipe()
+		require.NoError(t, err)
+		responses := &workerEncoder{encoder: json.NewEncoder(respWrite)}
+		mu.Lock()
+		current = responses
+		mu.Unlock()
+		serving.Add(1)
+		go func() {
+			defer serving.Done()
+			serveCampaignWorker(reqRead, responses, runtime, RunOptions{})
+			respWrite.Close()
+		}()
+		// Killing closes the worker's ends of the pipes
+		return &workerProcess{
+			requests:  reqWrite,
+			responses: respRead,
+			kill: func() {
+				reqRead.Close()
+				respWrite.Close()
+			},
+			wait: func() string {
+				reqWrite.Close()
+				return "signal: killed"
+			},
+		}, nil
+	}
+	t.Cleanup(func() {
+		serving.Wait()
+		startWorker, stageStarted = originalStart, originalStage
+	})
+	return &started
+}
+
+// -----------------------------------------------------------------------------
+// TEST: Hang Watchdog
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// A CGO call that wedges inside the runtime never returns to Go, so one
+// bad file would block the whole campaign. An isolated worker that makes
+// no progress has to be killed, the file reported as a hang in the stage
+// it was stuck in, and the campaign continued with a fresh worker.
+// -----------------------------------------------------------------------------
+
+func TestIsolate_KillsWedgedWorker(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.wasm", "b_wedge.wasm", "c.wasm"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte{0}, 0o644))
+	}
+	release := make(chan struct{})
+	defer close(release)
+	runtime := &MockWasmRuntime{LoadModuleFunc: func(filePath string) (WasmModule, error) {
+		err := runStage(StageInstantiate, func() error {
+			if strings.Contains(filepath.Base(filePath), "wedge") {
+				<-release
+			}
+			return nil
+		})
+		return &MockWasmModule{}, err
+	}}
+	started := fakeWorkers(t, runtime)
+
+	opts := RunOptions{HangTimeout: 50 * time.Millisecond, WorkerArgs: []string{dir}}
+	report, err := runFuzzerWithMatrix(dir, []environmentRuntime{{Runtime: runtime}}, opts)
+	require.NoError(t, err)
+
+	require.Len(t, report.Results, 3)
+	assert.True(t, report.Results[0].Success)
+	hang := report.Results[1]
+	assert.False(t, hang.Success)
+	assert.Equal(t, StageInstantiate, hang.FailureStage)
+	assert.Equal(t, SubStageHang, hang.FailureSubStage)
+	assert.Equal(t, "no progress for 50ms in the instantiate stage, worker killed", hang.ErrorMessage)
+	assert.True(t, report.Results[2].Success, "the campaign goes on with a new worker")
+	assert.Equal(t, 2, *started)
+}
+
+func TestIsolate_ReportsWorkerCrash(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "crash.wasm"), []byte{0}, 0o644))
+	runtime := &MockWasmRuntime{}
+	fakeWorkers(t, runtime)
+	startFake := startWorker
+	startWorker = func(args, env []string) (*workerProcess, error) {
+		process, err := startFake(args, env)
+		// The worker dies as soon as it is asked to run anything
+		kill := process.kill
+		process.requests = writerFunc(func(p []byte) (int, error) {
+			kill()
+			return len(p), nil
+		})
+		return process, err
+	}
+
+	report, err := runFuzzerWithMatrix(dir, []environmentRuntime{{Runtime: runtime}}, RunOptions{WorkerArgs: []string{dir}})
+	require.NoError(t, err)
+	require.Len(t, report.Results, 1)
+	result := report.Results[0]
+	assert.Equal(t, StageLoad, result.FailureStage)
+	assert.Empty(t, result.FailureSubStage, "a crash is not a hang")
+	assert.Equal(t, "worker died in the load stage: signal: killed", result.ErrorMessage)
+}
+
+func TestWatchdog_FiresOnlyWithoutProgress(t *testing.T) {
+	fired := make(chan struct{}, 1)
+	watch := startWatchdog(40*time.Millisecond, func() { fired <- struct{}{} })
+	for i := 0; i < 5; i++ {
+		time.Sleep(15 * time.Millisecond)
+		watch.progress()
+	}
+	assert.False(t, watch.stop(), "progress keeps the watchdog quiet")
+
+	watch = startWatchdog(20*time.Millisecond, func() { fired <- struct{}{} })
+	select {
+	case <-fired:
+	case <-time.After(time.Second):
+		t.Fatal("watchdog never fired")
+	}
+	assert.True(t, watch.stop())
+
+	assert.False(t, startWatchdog(0, func() { t.Fatal("fired without a timeout") }).stop())
+}
+
+// writerFunc adapts a function to io.WriteCloser
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
+func (f writerFunc) Close() error                { return nil }
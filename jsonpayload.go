@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+// jsonObject is a JSON object whose member order, and any duplicate keys,
+// survive a round trip; guest parsers often disagree on both
+type jsonObject []jsonMember
+
+// jsonMember is one key-value pair of a jsonObject
+type jsonMember struct {
+	Key   string
+	Value interface{}
+}
+
+// interestingJSONNumbers are numbers that commonly overflow, lose
+// precision or are rejected by JSON parsers
+var interestingJSONNumbers = []string{
+	"0", "-0", "1", "-1", "0.5", "1e308", "-1e308", "1e-400", "1E400",
+	"2147483647", "2147483648", "-2147483649", "4294967296",
+	"9007199254740993", "9223372036854775807", "18446744073709551616",
+}
+
+// parseJSONPayload parses a JSON document into jsonObject, []interface{},
+// json.Number, string, bool and nil values
+func parseJSONPayload(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	value, err := decodeJSONValue(decoder)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after the document")
+	}
+	return value, nil
+}
+
+// decodeJSONValue reads one value from the decoder's token stream
+func decodeJSONValue(decoder *json.Decoder) (interface{}, error) {
+	token, err := decoder.Token()
+	if err == io.EOF {
+		return nil, fmt.Errorf("empty document")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch token {
+	case json.Delim('{'):
+		object := jsonObject{}
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeJSONValue(decoder)
+			if err != nil {
+				return nil, err
+			}
+			object = append(object, jsonMember{Key: key.(string), Value: value})
+		}
+		_, err = decoder.Token()
+		return object, err
+	case json.Delim('['):
+		array := []interface{}{}
+		for decoder.More() {
+			value, err := decodeJSONValue(decoder)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, value)
+		}
+		_, err = decoder.Token()
+		return array, err
+	}
+	return token, nil
+}
+
+// appendJSON serializes a parsed JSON value compactly
+func appendJSON(buf []byte, v interface{}) []byte {
+	switch v := v.(type) {
+	case jsonObject:
+		buf = append(buf, '{')
+		for i, member := range v {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			buf = appendJSONString(buf, member.Key)
+			buf = append(buf, ':')
+			buf = appendJSON(buf, member.Value)
+		}
+		return append(buf, '}')
+	case []interface{}:
+		buf = append(buf, '[')
+		for i, elem := range v {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			buf = appendJSON(buf, elem)
+		}
+		return append(buf, ']')
+	case json.Number:
+		return append(buf, v...)
+	case string:
+		return appendJSONString(buf, v)
+	case bool:
+		return strconv.AppendBool(buf, v)
+	}
+	return append(buf, "null"...)
+}
+
+// appendJSONString quotes a string without escaping HTML characters
+func appendJSONString(buf []byte, s string) []byte {
+	var quoted bytes.Buffer
+	encoder := json.NewEncoder(&quoted)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(s)
+	return append(buf, bytes.TrimSuffix(quoted.Bytes(), []byte("\n"))...)
+}
+
+// mutateJSON derives a new value from v, descending into containers to
+// mutate one member or element, or changing the container itself. Values
+// are never modified in place, since corpus entries share them.
+func (m *payloadMutator) mutateJSON(v interface{}, depth int) interface{} {
+	// Occasionally replace a value with one of another type
+	if m.rng.Intn(8) == 0 {
+		return m.generateJSON(depth)
+	}
+
+	switch v := v.(type) {
+	case jsonObject:
+		return m.mutateJSONObject(v, depth)
+	case []interface{}:
+		return m.mutateJSONArray(v, depth)
+	case json.Number:
+		return m.mutateJSONNumber(v)
+	case string:
+		return string(m.mutateRunes([]rune(v)))
+	case bool:
+		return !v
+	}
+	return m.generateJSON(depth)
+}
+
+// mutateJSONObject changes one member's value, or adds, removes or
+// duplicates a member. Duplicated keys probe last-wins handling.
+func (m *payloadMutator) mutateJSONObject(object jsonObject, depth int) jsonObject {
+	out := append(jsonObject(nil), object...)
+	op := m.rng.Intn(5)
+	if len(out) == 0 {
+		op = 1
+	}
+	switch op {
+	case 0, 4:
+		i := m.rng.Intn(len(out))
+		out[i].Value = m.mutateJSON(out[i].Value, depth+1)
+	case 1:
+		key := m.text()
+		if len(out) > 0 && m.rng.Intn(2) == 0 {
+			key = out[m.rng.Intn(len(out))].Key
+		}
+		i := m.rng.Intn(len(out) + 1)
+		member := jsonMember{Key: key, Value: m.generateJSON(depth + 1)}
+		out = append(out[:i], append(jsonObject{member}, out[i:]...)...)
+	case 2:
+		i := m.rng.Intn(len(out))
+		out = append(out[:i], out[i+1:]...)
+	default:
+		out = append(out, out[m.rng.Intn(len(out))])
+	}
+	return out
+}
+
+// mutateJSONArray changes one element, inserts, removes or duplicates one,
+// or wraps the array in another
+func (m *payloadMutator) mutateJSONArray(array []interface{}, depth int) []interface{} {
+	out := append([]interface{}(nil), array...)
+	op := m.rng.Intn(6)
+	if len(out) == 0 {
+		op = 1
+	}
+	switch op {
+	case 0, 5:
+		i := m.rng.Intn(len(out))
+		out[i] = m.mutateJSON(out[i], depth+1)
+	case 1:
+		i := m.rng.Intn(len(out) + 1)
+		out = append(out[:i], append([]interface{}{m.generateJSON(depth + 1)}, out[i:]...)...)
+	case 2:
+		i := m.rng.Intn(len(out))
+		out = append(out[:i], out[i+1:]...)
+	case 3:
+		out = append(out, out[m.rng.Intn(len(out))])
+	default:
+		if depth < maxPayloadDepth {
+			return []interface{}{out}
+		}
+		out = out[:0]
+	}
+	return out
+}
+
+// mutateJSONNumber adds a small delta to an integer, or picks a boundary
+// value or module constant
+func (m *payloadMutator) mutateJSONNumber(n json.Number) json.Number {
+	if i, err := strconv.ParseInt(string(n), 10, 64); err == nil && m.rng.Intn(2) == 0 {
+		delta := int64(m.rng.Intn(33) - 16)
+		if (delta > 0 && i > math.MaxInt64-delta) || (delta < 0 && i < math.MinInt64-delta) {
+			delta = -delta
+		}
+		return json.Number(strconv.FormatInt(i+delta, 10))
+	}
+	return m.jsonNumber()
+}
+
+// jsonNumber picks a boundary value, module constant or random number
+func (m *payloadMutator) jsonNumber() json.Number {
+	switch m.rng.Intn(4) {
+	case 0:
+		return json.Number(interestingJSONNumbers[m.rng.Intn(len(interestingJSONNumbers))])
+	case 1:
+		if len(m.numbers) > 0 {
+			return json.Number(strconv.Itoa(int(m.numbers[m.rng.Intn(len(m.numbers))])))
+		}
+	case 2:
+		return json.Number(strconv.FormatFloat(m.rng.NormFloat64()*1e3, 'g', -1, 64))
+	}
+	return json.Number(strconv.Itoa(int(int32(m.rng.Uint32()))))
+}
+
+// generateJSON creates a random value, with containers only above the
+// depth limit
+func (m *payloadMutator) generateJSON(depth int) interface{} {
+	kinds := 6
+	if depth >= maxPayloadDepth {
+		kinds = 4
+	}
+	switch m.rng.Intn(kinds) {
+	case 0:
+		return nil
+	case 1:
+		return m.rng.Intn(2) == 1
+	case 2:
+		return m.jsonNumber()
+	case 3:
+		return m.text()
+	case 4:
+		array := make([]interface{}, m.rng.Intn(4))
+		for i := range array {
+			array[i] = m.generateJSON(depth + 1)
+		}
+		return array
+	}
+	object := make(jsonObject, m.rng.Intn(4))
+	for i := range object {
+		object[i] = jsonMember{Key: m.text(), Value: m.generateJSON(depth + 1)}
+	}
+	return object
+}
@@ -0,0 +1,429 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Paths of the pods k8s-gen describes: the corpus and config are mounted
+// read-only, and the campaign runs in the artifacts volume so the relative
+// paths of its config land there
+const (
+	k8sCorpusPath    = "/corpus"
+	k8sConfigPath    = "/config"
+	k8sArtifactsPath = "/artifacts"
+	k8sConfigFile    = "campaign.yaml"
+	// k8sHeartbeatFile is a heartbeat file of the pod's own, as shards
+	// share the artifacts volume
+	k8sHeartbeatFile = "/tmp/heartbeat.json"
+)
+
+// kubernetesOptions are the settings of the manifests k8s-gen writes
+type kubernetesOptions struct {
+	Name  string
+	Image string
+	// Config is the campaign's config, and ConfigData its file, mounted
+	// verbatim from a ConfigMap; nil without a config
+	Config     Config
+	ConfigData []byte
+	Shards     int
+	// Schedule makes a CronJob of the Job, such as "0 2 * * *"
+	Schedule string
+	// CorpusClaim and ArtifactsClaim are the persistent volume claims
+	// mounted; reports and artifacts outlive the pod only on a claim
+	CorpusClaim    string
+	ArtifactsClaim string
+	CPU            string
+	Memory         string
+	// Retries is how many times a shard's pod is replaced after it was
+	// killed, as by a liveness probe
+	Retries int
+}
+
+type k8sMetadata struct {
+	Name   string            `yaml:"name"`
+	Labels map[string]string `yaml:"labels,omitempty"`
+}
+
+type k8sConfigMap struct {
+	APIVersion string            `yaml:"apiVersion"`
+	Kind       string            `yaml:"kind"`
+	Metadata   k8sMetadata       `yaml:"metadata"`
+	Data       map[string]string `yaml:"data"`
+}
+
+type k8sJob struct {
+	APIVersion string      `yaml:"apiVersion"`
+	Kind       string      `yaml:"kind"`
+	Metadata   k8sMetadata `yaml:"metadata"`
+	Spec       k8sJobSpec  `yaml:"spec"`
+}
+
+type k8sCronJob struct {
+	APIVersion string         `yaml:"apiVersion"`
+	Kind       string         `yaml:"kind"`
+	Metadata   k8sMetadata    `yaml:"metadata"`
+	Spec       k8sCronJobSpec `yaml:"spec"`
+}
+
+type k8sCronJobSpec struct {
+	Schedule          string `yaml:"schedule"`
+	ConcurrencyPolicy string `yaml:"concurrencyPolicy"`
+	JobTemplate       struct {
+		Spec k8sJobSpec `yaml:"spec"`
+	} `yaml:"jobTemplate"`
+}
+
+type k8sJobSpec struct {
+	CompletionMode       string              `yaml:"completionMode"`
+	Completions          int                 `yaml:"completions"`
+	Parallelism          int                 `yaml:"parallelism"`
+	BackoffLimitPerIndex int                 `yaml:"backoffLimitPerIndex"`
+	PodFailurePolicy     k8sPodFailurePolicy `yaml:"podFailurePolicy"`
+	Template             k8sPodTemplate      `yaml:"template"`
+}
+
+type k8sPodFailurePolicy struct {
+	Rules []k8sPodFailureRule `yaml:"rules"`
+}
+
+type k8sPodFailureRule struct {
+	Action      string `yaml:"action"`
+	OnExitCodes struct {
+		ContainerName string `yaml:"containerName"`
+		Operator      string `yaml:"operator"`
+		Values        []int  `yaml:"values"`
+	} `yaml:"onExitCodes"`
+}
+
+type k8sPodTemplate struct {
+	Metadata k8sMetadata `yaml:"metadata"`
+	Spec     k8sPodSpec  `yaml:"spec"`
+}
+
+type k8sPodSpec struct {
+	RestartPolicy string         `yaml:"restartPolicy"`
+	Containers    []k8sContainer `yaml:"containers"`
+	Volumes       []k8sVolume    `yaml:"volumes"`
+}
+
+type k8sContainer struct {
+	Name          string           `yaml:"name"`
+	Image         string           `yaml:"image"`
+	Command       []string         `yaml:"command"`
+	Args          []string         `yaml:"args"`
+	WorkingDir    string           `yaml:"workingDir"`
+	Env           []k8sEnvVar      `yaml:"env,omitempty"`
+	Resources     k8sResources     `yaml:"resources"`
+	VolumeMounts  []k8sVolumeMount `yaml:"volumeMounts"`
+	LivenessProbe *k8sProbe        `yaml:"livenessProbe,omitempty"`
+}
+
+type k8sEnvVar struct {
+	Name      string `yaml:"name"`
+	ValueFrom struct {
+		FieldRef struct {
+			FieldPath string `yaml:"fieldPath"`
+		} `yaml:"fieldRef"`
+	} `yaml:"valueFrom"`
+}
+
+type k8sResources struct {
+	Requests map[string]string `yaml:"requests"`
+	Limits   map[string]string `yaml:"limits"`
+}
+
+type k8sVolumeMount struct {
+	Name      string `yaml:"name"`
+	MountPath string `yaml:"mountPath"`
+	ReadOnly  bool   `yaml:"readOnly,omitempty"`
+}
+
+type k8sVolume struct {
+	Name                  string           `yaml:"name"`
+	PersistentVolumeClaim *k8sClaimSource  `yaml:"persistentVolumeClaim,omitempty"`
+	ConfigMap             *k8sConfigMapRef `yaml:"configMap,omitempty"`
+}
+
+type k8sClaimSource struct {
+	ClaimName string `yaml:"claimName"`
+	ReadOnly  bool   `yaml:"readOnly,omitempty"`
+}
+
+type k8sConfigMapRef struct {
+	Name string `yaml:"name"`
+}
+
+type k8sProbe struct {
+	HTTPGet          *k8sHTTPGet `yaml:"httpGet,omitempty"`
+	Exec             *k8sExec    `yaml:"exec,omitempty"`
+	PeriodSeconds    int         `yaml:"periodSeconds"`
+	FailureThreshold int         `yaml:"failureThreshold"`
+}
+
+type k8sHTTPGet struct {
+	Path string `yaml:"path"`
+	Port int    `yaml:"port"`
+}
+
+type k8sExec struct {
+	Command []string `yaml:"command"`
+}
+
+// kubernetesManifests describes a campaign as an indexed Job, or a CronJob
+// when scheduled, with a pod per shard, and the ConfigMap of its config
+func kubernetesManifests(opts kubernetesOptions) ([]interface{}, error) {
+	if opts.CorpusClaim == "" {
+		return nil, errors.New("a corpus claim is required")
+	}
+	// The reports are written to the artifacts volume, and would go with
+	// the pod on anything but a claim
+	if opts.ArtifactsClaim == "" {
+		return nil, errors.New("an artifacts claim is required")
+	}
+	if opts.Shards < 1 {
+		return nil, fmt.Errorf("shards must be at least 1, not %d", opts.Shards)
+	}
+	if opts.Retries < 0 {
+		return nil, errors.New("retries must not be negative")
+	}
+	labels := map[string]string{"app.kubernetes.io/name": "wasm-fuzzer", "app.kubernetes.io/instance": opts.Name}
+
+	container := k8sContainer{
+		Name:       "fuzzer",
+		Image:      opts.Image,
+		Command:    []string{"wasm-fuzzer"},
+		Args:       []string{"fuzz"},
+		WorkingDir: k8sArtifactsPath,
+		Resources: k8sResources{
+			Requests: map[string]string{"cpu": opts.CPU, "memory": opts.Memory},
+			Limits:   map[string]string{"cpu": opts.CPU, "memory": opts.Memory},
+		},
+		VolumeMounts: []k8sVolumeMount{
+			{Name: "corpus", MountPath: k8sCorpusPath, ReadOnly: true},
+			{Name: "artifacts", MountPath: k8sArtifactsPath},
+		},
+	}
+	volumes := []k8sVolume{
+		{Name: "corpus", PersistentVolumeClaim: &k8sClaimSource{ClaimName: opts.CorpusClaim, ReadOnly: true}},
+		{Name: "artifacts", PersistentVolumeClaim: &k8sClaimSource{ClaimName: opts.ArtifactsClaim}},
+	}
+
+	var manifests []interface{}
+	if opts.ConfigData != nil {
+		manifests = append(manifests, k8sConfigMap{
+			APIVersion: "v1",
+			Kind:       "ConfigMap",
+			Metadata:   k8sMetadata{Name: opts.Name + "-config", Labels: labels},
+			Data:       map[string]string{k8sConfigFile: string(opts.ConfigData)},
+		})
+		container.Args = append(container.Args, "--config", k8sConfigPath+"/"+k8sConfigFile)
+		container.VolumeMounts = append(container.VolumeMounts, k8sVolumeMount{Name: "config", MountPath: k8sConfigPath, ReadOnly: true})
+		volumes = append(volumes, k8sVolume{Name: "config", ConfigMap: &k8sConfigMapRef{Name: opts.Name + "-config"}})
+	}
+
+	report := opts.Name + ".json"
+	if opts.Shards > 1 {
+		// Each pod of an indexed Job is told its index, which is its shard
+		var shard k8sEnvVar
+		shard.Name = "SHARD_INDEX"
+		shard.ValueFrom.FieldRef.FieldPath = "metadata.annotations['batch.kubernetes.io/job-completion-index']"
+		container.Env = append(container.Env, shard)
+		container.Args = append(container.Args, "--shard-index", "$(SHARD_INDEX)", "--shard-count", strconv.Itoa(opts.Shards))
+		report = opts.Name + "-shard-$(SHARD_INDEX).json"
+	}
+	probe, err := k8sLivenessProbe(opts.Config.Heartbeat)
+	if err != nil {
+		return nil, err
+	}
+	if probe != nil && probe.Exec != nil {
+		container.Args = append(container.Args, "--heartbeat-file", k8sHeartbeatFile)
+	}
+	container.LivenessProbe = probe
+	container.Args = append(container.Args, "--output", report, k8sCorpusPath)
+
+	// A campaign exiting 1 was aborted or missed its expectations, which
+	// another run would not change; only a shard killed, as by its
+	// liveness probe, is run again
+	var rule k8sPodFailureRule
+	rule.Action = "FailIndex"
+	rule.OnExitCodes.ContainerName = container.Name
+	rule.OnExitCodes.Operator = "In"
+	rule.OnExitCodes.Values = []int{1}
+	spec := k8sJobSpec{
+		CompletionMode:       "Indexed",
+		Completions:          opts.Shards,
+		Parallelism:          opts.Shards,
+		BackoffLimitPerIndex: opts.Retries,
+		PodFailurePolicy:     k8sPodFailurePolicy{Rules: []k8sPodFailureRule{rule}},
+		Template: k8sPodTemplate{
+			Metadata: k8sMetadata{Name: opts.Name, Labels: labels},
+			Spec: k8sPodSpec{
+				RestartPolicy: "Never",
+				Containers:    []k8sContainer{container},
+				Volumes:       volumes,
+			},
+		},
+	}
+	metadata := k8sMetadata{Name: opts.Name, Labels: labels}
+	if opts.Schedule == "" {
+		return append(manifests, k8sJob{APIVersion: "batch/v1", Kind: "Job", Metadata: metadata, Spec: spec}), nil
+	}
+	cron := k8sCronJob{APIVersion: "batch/v1", Kind: "CronJob", Metadata: metadata}
+	cron.Spec.Schedule = opts.Schedule
+	// A campaign still running when the next is due keeps running alone
+	cron.Spec.ConcurrencyPolicy = "Forbid"
+	cron.Spec.JobTemplate.Spec = spec
+	return append(manifests, cron), nil
+}
+
+// k8sLivenessProbe probes the campaign's heartbeat: its endpoint, or else
+// its file, which the pod keeps apart from the other shards'. A campaign
+// without a heartbeat is not probed.
+func k8sLivenessProbe(config HeartbeatConfig) (*k8sProbe, error) {
+	stale := config.Stale
+	if stale == 0 {
+		stale = 5 * time.Minute
+	}
+	probe := &k8sProbe{PeriodSeconds: 30, FailureThreshold: 1}
+	switch {
+	case config.Addr != "":
+		_, port, err := net.SplitHostPort(config.Addr)
+		if err != nil {
+			return nil, fmt.Errorf("heartbeat: %w", err)
+		}
+		number, err := strconv.Atoi(port)
+		if err != nil || number == 0 {
+			return nil, fmt.Errorf("heartbeat: %q has no fixed port to probe", config.Addr)
+		}
+		probe.HTTPGet = &k8sHTTPGet{Path: "/healthz", Port: number}
+	case config.File != "":
+		probe.Exec = &k8sExec{Command: []string{"sh", "-c", fmt.Sprintf("test $(( $(date +%%s) - $(stat -c %%Y %s) )) -lt %d", k8sHeartbeatFile, int(stale.Seconds()))}}
+	default:
+		return nil, nil
+	}
+	return probe, nil
+}
+
+// k8sSharedPaths warns of the files of a config that every shard would
+// write back over the others'
+func k8sSharedPaths(config Config, shards int) {
+	if shards < 2 {
+		return
+	}
+	for key, path := range map[string]string{"quarantine.path": config.Quarantine.Path, "history": config.History} {
+		if path != "" {
+			emitError(map[string]string{
+				"warning": "shards share a file they write back",
+				"key":     key,
+				"details": path,
+			})
+		}
+	}
+}
+
+// writeManifests writes manifests as a YAML stream
+func writeManifests(w io.Writer, manifests []interface{}) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	for _, manifest := range manifests {
+		if err := encoder.Encode(manifest); err != nil {
+			return err
+		}
+	}
+	return encoder.Close()
+}
+
+// runK8sGenCommand writes the Kubernetes manifests of a campaign
+func runK8sGenCommand(args []string) int {
+	flags := flag.NewFlagSet("k8s-gen", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	configPath := flags.String("config", "", "YAML campaign config, mounted from a ConfigMap")
+	name := flags.String("name", "wasm-fuzzer", "name of the Job and its ConfigMap")
+	image := flags.String("image", "wasm-fuzzer:latest", "container image with wasm-fuzzer on its PATH")
+	shards := flags.Int("shards", 0, "pods to shard the corpus over (default: the config's corpus.shard_count, or 1)")
+	schedule := flags.String("schedule", "", "cron schedule, making a CronJob of the Job")
+	corpusClaim := flags.String("corpus-claim", "", "persistent volume claim holding the corpus")
+	artifactsClaim := flags.String("artifacts-claim", "", "persistent volume claim for reports and artifacts")
+	cpu := flags.String("cpu", "1", "CPU of each pod")
+	memory := flags.String("memory", "2Gi", "memory of each pod")
+	retries := flags.Int("retries", 2, "times a killed shard is run again")
+	outputPath := flags.String("output", "", "write the manifests to this file instead of stdout")
+	flags.StringVar(outputPath, "o", "", "shorthand for --output")
+
+	if err := flags.Parse(args); err != nil || flags.NArg() != 0 || *corpusClaim == "" || *artifactsClaim == "" {
+		emitError(map[string]string{
+			"error": "usage: wasm-fuzzer k8s-gen --corpus-claim name --artifacts-claim name [--config file.yaml] [--image image] [--name name] [--shards n] [--schedule cron] [--cpu n] [--memory size] [--retries n] [-o|--output file.yaml]",
+		})
+		return 1
+	}
+
+	opts := kubernetesOptions{
+		Name:           *name,
+		Image:          *image,
+		Shards:         *shards,
+		Schedule:       *schedule,
+		CorpusClaim:    *corpusClaim,
+		ArtifactsClaim: *artifactsClaim,
+		CPU:            *cpu,
+		Memory:         *memory,
+		Retries:        *retries,
+	}
+	if *configPath != "" {
+		config, err := loadConfig(*configPath)
+		if err == nil {
+			opts.ConfigData, err = os.ReadFile(*configPath)
+		}
+		if err != nil {
+			emitError(map[string]string{
+				"error":   "config load failed",
+				"details": err.Error(),
+			})
+			return 1
+		}
+		opts.Config = config
+	}
+	if opts.Shards == 0 {
+		opts.Shards = max(opts.Config.Corpus.ShardCount, 1)
+	}
+	manifests, err := kubernetesManifests(opts)
+	if err != nil {
+		emitError(map[string]string{
+			"error":   "invalid manifest settings",
+			"details": err.Error(),
+		})
+		return 1
+	}
+	k8sSharedPaths(opts.Config, opts.Shards)
+
+	var out bytes.Buffer
+	if err := writeManifests(&out, manifests); err != nil {
+		emitError(map[string]string{
+			"error":   "failed to encode manifests",
+			"details": err.Error(),
+		})
+		return 1
+	}
+	if *outputPath == "" {
+		_, err = os.Stdout.Write(out.Bytes())
+	} else {
+		err = os.WriteFile(*outputPath, out.Bytes(), 0o644)
+	}
+	if err != nil {
+		emitError(map[string]string{
+			"error":   "failed to write manifests",
+			"details": err.Error(),
+		})
+		return 1
+	}
+	return 0
+}
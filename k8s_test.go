@@ -0,0 +1,159 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+// decodeManifests parses a YAML stream of manifests
+func decodeManifests(t *testing.T, data []byte) []map[string]interface{} {
+	var manifests []map[string]interface{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var manifest map[string]interface{}
+		err := decoder.Decode(&manifest)
+		if errors.Is(err, io.EOF) {
+			return manifests
+		}
+		require.NoError(t, err)
+		manifests = append(manifests, manifest)
+	}
+}
+
+// dig follows a path of keys and indexes into a decoded manifest
+func dig(t *testing.T, value interface{}, path ...interface{}) interface{} {
+	for _, step := range path {
+		switch step := step.(type) {
+		case string:
+			m, ok := value.(map[string]interface{})
+			require.True(t, ok, "%v is not a mapping", step)
+			value = m[step]
+		case int:
+			s, ok := value.([]interface{})
+			require.True(t, ok, "%v is not a sequence", step)
+			require.Greater(t, len(s), step)
+			value = s[step]
+		}
+	}
+	return value
+}
+
+// -----------------------------------------------------------------------------
+// TEST: Kubernetes Manifests
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Running a fleet on a cluster takes a sharded Job, volumes for the corpus
+// and the artifacts, a probe on the heartbeat and a failure policy telling
+// a killed shard from a failed campaign. Writing that by hand is where
+// teams give up; generated from the campaign's config, it stays in step
+// with the flags the fuzzer takes.
+// -----------------------------------------------------------------------------
+
+func TestK8sGen_ShardedJob(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "campaign.yaml")
+	configData := "isolate: true\ncorpus:\n  shard_count: 4\nheartbeat:\n  addr: \":8081\"\n"
+	require.NoError(t, os.WriteFile(configPath, []byte(configData), 0o644))
+	outputPath := filepath.Join(dir, "fuzz.yaml")
+
+	code := runK8sGenCommand([]string{"--config", configPath, "--corpus-claim", "corpus", "--artifacts-claim", "artifacts", "--image", "registry/wasm-fuzzer:1.4", "--name", "nightly", "-o", outputPath})
+	require.Equal(t, 0, code)
+	data, err := os.ReadFile(outputPath)
+	require.NoError(t, err)
+	manifests := decodeManifests(t, data)
+
+	require.Len(t, manifests, 2)
+	assert.Equal(t, "ConfigMap", manifests[0]["kind"])
+	assert.Equal(t, configData, dig(t, manifests[0], "data", "campaign.yaml"), "the config is mounted verbatim")
+
+	job := manifests[1]
+	assert.Equal(t, "Job", job["kind"])
+	spec := dig(t, job, "spec")
+	assert.Equal(t, "Indexed", dig(t, spec, "completionMode"))
+	assert.Equal(t, 4, dig(t, spec, "completions"), "shards come from the config")
+	assert.Equal(t, 4, dig(t, spec, "parallelism"))
+	assert.Equal(t, "FailIndex", dig(t, spec, "podFailurePolicy", "rules", 0, "action"))
+
+	container := dig(t, spec, "template", "spec", "containers", 0)
+	assert.Equal(t, "registry/wasm-fuzzer:1.4", dig(t, container, "image"))
+	assert.Equal(t, []interface{}{
+		"fuzz", "--config", "/config/campaign.yaml",
+		"--shard-index", "$(SHARD_INDEX)", "--shard-count", "4",
+		"--output", "nightly-shard-$(SHARD_INDEX).json", "/corpus",
+	}, dig(t, container, "args"))
+	assert.Equal(t, "SHARD_INDEX", dig(t, container, "env", 0, "name"))
+	assert.Equal(t, 8081, dig(t, container, "livenessProbe", "httpGet", "port"))
+	assert.Equal(t, "/artifacts", dig(t, container, "workingDir"))
+	assert.Equal(t, "2Gi", dig(t, container, "resources", "limits", "memory"))
+
+	volumes := dig(t, spec, "template", "spec", "volumes")
+	assert.Equal(t, "corpus", dig(t, volumes, 0, "persistentVolumeClaim", "claimName"))
+	assert.Equal(t, true, dig(t, volumes, 0, "persistentVolumeClaim", "readOnly"))
+	assert.Equal(t, "artifacts", dig(t, volumes, 1, "persistentVolumeClaim", "claimName"))
+	assert.Equal(t, "nightly-config", dig(t, volumes, 2, "configMap", "name"))
+}
+
+func TestK8sGen_CronJobWithHeartbeatFile(t *testing.T) {
+	opts := kubernetesOptions{
+		Name:           "fuzz",
+		Image:          "wasm-fuzzer:latest",
+		Config:         Config{Heartbeat: HeartbeatConfig{File: "heartbeat.json"}},
+		Shards:         1,
+		Schedule:       "0 2 * * *",
+		CorpusClaim:    "corpus",
+		ArtifactsClaim: "artifacts",
+		CPU:            "2",
+		Memory:         "4Gi",
+	}
+	manifests, err := kubernetesManifests(opts)
+	require.NoError(t, err)
+	var out bytes.Buffer
+	require.NoError(t, writeManifests(&out, manifests))
+	decoded := decodeManifests(t, out.Bytes())
+
+	require.Len(t, decoded, 1, "no ConfigMap without a config")
+	cron := decoded[0]
+	assert.Equal(t, "CronJob", cron["kind"])
+	assert.Equal(t, "0 2 * * *", dig(t, cron, "spec", "schedule"))
+	assert.Equal(t, "Forbid", dig(t, cron, "spec", "concurrencyPolicy"))
+	container := dig(t, cron, "spec", "jobTemplate", "spec", "template", "spec", "containers", 0)
+	assert.Equal(t, []interface{}{"fuzz", "--heartbeat-file", "/tmp/heartbeat.json", "--output", "fuzz.json", "/corpus"}, dig(t, container, "args"),
+		"each pod keeps a heartbeat file of its own")
+	assert.Contains(t, dig(t, container, "livenessProbe", "exec", "command", 2), "stat -c %Y /tmp/heartbeat.json) )) -lt 300")
+	assert.Equal(t, "artifacts", dig(t, cron, "spec", "jobTemplate", "spec", "template", "spec", "volumes", 1, "persistentVolumeClaim", "claimName"))
+}
+
+func TestK8sGen_RejectsBadSettings(t *testing.T) {
+	_, err := kubernetesManifests(kubernetesOptions{Shards: 1})
+	assert.EqualError(t, err, "a corpus claim is required")
+	_, err = kubernetesManifests(kubernetesOptions{CorpusClaim: "corpus", Shards: 1})
+	assert.EqualError(t, err, "an artifacts claim is required", "reports on an emptyDir go with the pod")
+	_, err = kubernetesManifests(kubernetesOptions{CorpusClaim: "corpus", ArtifactsClaim: "artifacts", Shards: 1, Config: Config{Heartbeat: HeartbeatConfig{Addr: "127.0.0.1:0"}}})
+	assert.EqualError(t, err, `heartbeat: "127.0.0.1:0" has no fixed port to probe`)
+
+	stderr := captureStderr(t, func() {
+		assert.Equal(t, 1, runK8sGenCommand([]string{"--config", "campaign.yaml"}))
+	})
+	assert.Contains(t, string(stderr), "usage: wasm-fuzzer k8s-gen")
+	stderr = captureStderr(t, func() {
+		assert.Equal(t, 1, runK8sGenCommand([]string{"--corpus-claim", "corpus"}))
+	})
+	assert.Contains(t, string(stderr), "--artifacts-claim name")
+
+	stderr = captureStderr(t, func() {
+		k8sSharedPaths(Config{History: "history.json"}, 2)
+	})
+	assert.Contains(t, string(stderr), "shards share a file they write back")
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// LargeModuleConfig isolates modules above a size in worker subprocesses
+// with stricter limits, even when the campaign runs files in process.
+// Compiling a very large module can take more memory than the fuzzer has.
+type LargeModuleConfig struct {
+	// Threshold is the size above which a module is isolated; unset, every
+	// module runs where the campaign runs it
+	Threshold ByteSize `yaml:"threshold"`
+	// MemoryLimit caps the data segment of the workers running large
+	// modules, so a runaway compilation kills the worker instead of the
+	// machine. It is only enforced on Linux.
+	MemoryLimit ByteSize `yaml:"memory_limit"`
+	// HangTimeout replaces the campaign's hang timeout for large modules
+	HangTimeout time.Duration `yaml:"hang_timeout"`
+}
+
+// check rejects limits set without a threshold to apply them above
+func (c LargeModuleConfig) check() error {
+	if c.Threshold == 0 && (c.MemoryLimit > 0 || c.HangTimeout > 0) {
+		return errors.New("large_modules: limits need a threshold")
+	}
+	if c.HangTimeout < 0 {
+		return errors.New("large_modules: hang_timeout must not be negative")
+	}
+	return nil
+}
+
+// holds reports whether a file is a large module
+func (c LargeModuleConfig) holds(filePath string) bool {
+	if c.Threshold == 0 {
+		return false
+	}
+	info, err := os.Stat(filePath)
+	return err == nil && info.Size() > int64(c.Threshold)
+}
+
+// newLargeModuleWorkers returns a worker per environment for the large
+// modules of a campaign, started as large-module workers with the large
+// module hang timeout
+func newLargeModuleWorkers(envs int, opts RunOptions) []*isolatedWorker {
+	opts.WorkerArgs = opts.CampaignArgs
+	workers := newIsolatedWorkers(envs, opts)
+	for _, worker := range workers {
+		worker.args[0] = "large-module-worker"
+		if opts.LargeModules.HangTimeout > 0 {
+			worker.timeout = opts.LargeModules.HangTimeout
+		}
+	}
+	return workers
+}
+
+// runLargeModuleWorker is the hidden subcommand large modules run in. It
+// is a campaign worker that limits its own memory first.
+func runLargeModuleWorker(args []string) int {
+	return serveWorkerCommand(args, func(config Config) {
+		if limit := config.LargeModules.MemoryLimit; limit > 0 {
+			if err := limitWorkerMemory(uint64(limit)); err != nil {
+				emitError(map[string]string{
+					"warning": "large module memory limit not enforced",
+					"details": err.Error(),
+				})
+			}
+		}
+	})
+}
@@ -0,0 +1,10 @@
+package main
+
+import "syscall"
+
+// limitWorkerMemory caps the data segment of the process. Unlike the
+// address space, it leaves out the guard regions runtimes reserve around
+// linear memories.
+func limitWorkerMemory(limit uint64) error {
+	return syscall.Setrlimit(syscall.RLIMIT_DATA, &syscall.Rlimit{Cur: limit, Max: limit})
+}
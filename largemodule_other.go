@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "errors"
+
+// limitWorkerMemory is only supported on Linux
+func limitWorkerMemory(limit uint64) error {
+	return errors.New("worker memory limits are only supported on Linux")
+}
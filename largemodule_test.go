@@ -0,0 +1,94 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// -----------------------------------------------------------------------------
+// TEST: Large Module Isolation
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Compiling a very large module can take more memory than the fuzzer has,
+// taking the whole campaign down. Large modules must run in a worker with
+// stricter limits even when every other file runs in process.
+// -----------------------------------------------------------------------------
+
+func TestLargeModules_RunInWorkers(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "big.wasm"), make([]byte, 2048), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "small.wasm"), []byte("tiny"), 0o644))
+
+	var inProcess, isolated []string
+	started := fakeWorkers(t, &MockWasmRuntime{LoadModuleFunc: func(filePath string) (WasmModule, error) {
+		isolated = append(isolated, filepath.Base(filePath))
+		return &MockWasmModule{}, nil
+	}})
+	var commands []string
+	fakeStart := startWorker
+	startWorker = func(args, env []string) (*workerProcess, error) {
+		commands = append(commands, args[0])
+		return fakeStart(args, env)
+	}
+	runtime := &MockWasmRuntime{LoadModuleFunc: func(filePath string) (WasmModule, error) {
+		inProcess = append(inProcess, filepath.Base(filePath))
+		return &MockWasmModule{}, nil
+	}}
+
+	opts := RunOptions{
+		LargeModules: LargeModuleConfig{Threshold: 1024},
+		CampaignArgs: []string{dir},
+	}
+	report, err := runFuzzerWithMatrix(dir, []environmentRuntime{{Runtime: runtime}}, opts)
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Passed)
+	assert.Equal(t, []string{"big.wasm"}, isolated)
+	assert.Equal(t, []string{"small.wasm"}, inProcess)
+	assert.Equal(t, 1, *started)
+	assert.Equal(t, []string{"large-module-worker"}, commands)
+
+	// Without the campaign's arguments there is no worker to start
+	inProcess = nil
+	opts.CampaignArgs = nil
+	_, err = runFuzzerWithMatrix(dir, []environmentRuntime{{Runtime: runtime}}, opts)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"big.wasm", "small.wasm"}, inProcess)
+
+	plan, err := planDryRun(dir, Config{LargeModules: LargeModuleConfig{Threshold: 1024}}, RunOptions{LargeModules: LargeModuleConfig{Threshold: 1024}})
+	require.NoError(t, err)
+	require.Len(t, plan.Files, 2)
+	assert.True(t, plan.Files[0].LargeModule)
+	assert.False(t, plan.Files[1].LargeModule)
+}
+
+func TestLargeModules_UseStricterLimits(t *testing.T) {
+	opts := RunOptions{
+		HangTimeout:  time.Minute,
+		LargeModules: LargeModuleConfig{Threshold: 1024, HangTimeout: time.Second},
+		CampaignArgs: []string{"--isolate", "corpus"},
+	}
+	workers := newLargeModuleWorkers(2, opts)
+	require.Len(t, workers, 2)
+	assert.Equal(t, []string{"large-module-worker", "1", "--isolate", "corpus"}, workers[1].args)
+	assert.Equal(t, time.Second, workers[0].timeout)
+
+	opts.LargeModules.HangTimeout = 0
+	assert.Equal(t, time.Minute, newLargeModuleWorkers(1, opts)[0].timeout)
+}
+
+func TestLargeModules_RejectLimitsWithoutThreshold(t *testing.T) {
+	assert.NoError(t, LargeModuleConfig{}.check())
+	assert.Error(t, LargeModuleConfig{MemoryLimit: 1 << 30}.check())
+	assert.Error(t, LargeModuleConfig{Threshold: 1, HangTimeout: -time.Second}.check())
+	_, err := runFuzzerWithMatrix(t.TempDir(), []environmentRuntime{{Runtime: &MockWasmRuntime{}}}, RunOptions{LargeModules: LargeModuleConfig{HangTimeout: time.Second}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// WASI lifecycle exports. Commands export _start, which runs the program's
+// main function; reactors export _initialize, which must run before any
+// of their other exports are called.
+const (
+	wasiStartExport      = "_start"
+	wasiInitializeExport = "_initialize"
+)
+
+// SubStageLifecycle refines the instantiate stage for modules whose
+// _start or _initialize export trapped or exited unsuccessfully
+const SubStageLifecycle = "lifecycle"
+
+// wasiProgram is the host of a WASI command or reactor
+type wasiProgram struct {
+	wasi *minimalWASI
+	// exited is set once the module calls proc_exit, with its code
+	exited bool
+	code   uint32
+}
+
+func newWASIProgram() *wasiProgram {
+	return &wasiProgram{wasi: newMinimalWASI(&hostMemory{})}
+}
+
+// link binds the module's WASI imports, recording calls to proc_exit
+func (p *wasiProgram) link(imports []wasmFuncImport) ([]HostFunction, error) {
+	host, err := p.wasi.linkAll(imports)
+	if err != nil {
+		return nil, err
+	}
+	for i, fn := range host {
+		if fn.Name == "proc_exit" {
+			call := fn.Call
+			host[i].Call = func(args []interface{}) ([]interface{}, error) {
+				p.exited, p.code = true, uint32(args[0].(int32))
+				return call(args)
+			}
+		}
+	}
+	return host, nil
+}
+
+// start runs the lifecycle export a WASI host would run before the entry:
+// a reactor's _initialize, or a command's _start unless the command's
+// _start is the entry itself. A command exiting with code zero has
+// finished its main function, and its exports can still be called.
+func (p *wasiProgram) start(module WasmModule, exports map[string]uint32, entry string) error {
+	export := wasiInitializeExport
+	if _, ok := exports[export]; !ok {
+		export = wasiStartExport
+	}
+	if _, ok := exports[export]; !ok || export == entry {
+		return nil
+	}
+
+	_, err := module.Execute(export)
+	switch {
+	case p.exited && p.code == 0:
+		return nil
+	case p.exited:
+		return &RuntimeError{Stage: StageInstantiate, SubStage: SubStageLifecycle, Message: fmt.Sprintf("%s exited with code %d", export, p.code)}
+	case err != nil:
+		_, message := classifyError(err, StageExecute, "execution failed")
+		return &RuntimeError{Stage: StageInstantiate, SubStage: SubStageLifecycle, Message: fmt.Sprintf("%s failed: %s", export, message)}
+	}
+	return nil
+}
+
+// wasiRuntime loads modules that target no plugin ABI. Emscripten output
+// is handed to emscriptenRuntime. WASI commands and reactors are run as a
+// WASI host would run them: their WASI imports are linked to the minimal
+// host, when the wrapped runtime implements HostLoader, and their
+// lifecycle export runs before the entry. Other modules load unchanged.
+type wasiRuntime struct {
+	runtime WasmRuntime
+	entry   string
+	// log configures the log import of modules using it
+	log LogConfig
+	// output captures what the module writes to stdout and stderr
+	output *outputCapture
+}
+
+// LoadModule implements WasmRuntime.LoadModule
+func (r *wasiRuntime) LoadModule(filePath string) (WasmModule, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return r.runtime.LoadModule(filePath)
+	}
+	return r.load(filePath, nil, data)
+}
+
+// LoadModuleBytes implements BufferLoader.LoadModuleBytes
+func (r *wasiRuntime) LoadModuleBytes(name string, data []byte) (WasmModule, error) {
+	return r.load(name, data, data)
+}
+
+func (r *wasiRuntime) load(filePath string, source, data []byte) (WasmModule, error) {
+	binary, err := parseWasmBinary(data)
+	if err == nil && isEmscripten(binary) {
+		return (&emscriptenRuntime{runtime: r.runtime, output: r.output}).load(filePath, source, data)
+	}
+	var exports map[string]uint32
+	if err == nil {
+		exports, _ = binary.functionExports()
+	}
+	imports := moduleImports(data)
+	usesWASI := false
+	for _, imp := range imports {
+		usesWASI = usesWASI || imp.Module == wasiModule
+	}
+	logs := usesLog(imports)
+	_, command := exports[wasiStartExport]
+	_, reactor := exports[wasiInitializeExport]
+	if !usesWASI && !logs && !command && !reactor {
+		return r.loadUnchanged(filePath, source)
+	}
+
+	p := newWASIProgram()
+	if r.output != nil {
+		p.wasi.output = r.output.write
+	}
+	var module WasmModule
+	if loader, ok := r.runtime.(HostLoader); ok && (usesWASI || logs) {
+		host, err := p.link(imports)
+		if err != nil {
+			return nil, &RuntimeError{Stage: StageInstantiate, Message: fmt.Sprintf("wasi: %v", err)}
+		}
+		logHost, err := (&hostLog{config: r.log, memory: p.wasi.memory, output: r.output}).link(imports)
+		if err != nil {
+			return nil, &RuntimeError{Stage: StageInstantiate, Message: fmt.Sprintf("log: %v", err)}
+		}
+		host = append(host, logHost...)
+		module, err = loader.LoadModuleWithHost(filePath, source, host)
+		if err != nil {
+			return nil, err
+		}
+		if memory, ok := module.(MemoryModule); ok {
+			p.wasi.memory.module = memory
+		}
+	} else {
+		module, err = r.loadUnchanged(filePath, source)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := p.start(module, exports, r.entry); err != nil {
+		module.Close()
+		return nil, err
+	}
+	return module, nil
+}
+
+// loadUnchanged loads the module without host functions
+func (r *wasiRuntime) loadUnchanged(filePath string, source []byte) (WasmModule, error) {
+	if source != nil {
+		return (&bufferRuntime{runtime: r.runtime, data: source}).LoadModule(filePath)
+	}
+	return r.runtime.LoadModule(filePath)
+}
@@ -0,0 +1,125 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mrhapile/WASM-Injection-Framework/internal/wasmbin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// wasiBinary is a plugin binary importing proc_exit that also exports its
+// function under the given lifecycle names
+func wasiBinary(t *testing.T, lifecycle ...string) []byte {
+	binary, err := parseWasmBinary(pluginBinary(wasmFuncImport{Module: wasiModule, Name: "proc_exit", Signature: funcSig("i32", "")}))
+	require.NoError(t, err)
+	for _, name := range lifecycle {
+		_, err = binary.section(sectionExport).appendVectorEntry(wasmbin.AppendU32(append(wasmbin.AppendName(nil, name), externFunc), 1))
+		require.NoError(t, err)
+	}
+	return binary.encode()
+}
+
+// runWASI runs a WASI binary whose exports are the given mock functions
+func runWASI(t *testing.T, binary []byte, exports map[string]contractExport, plan InvocationConfig) (ExecutionResult, *emscriptenMockRuntime) {
+	signatures := map[string]FuncSignature{}
+	for name := range exports {
+		signatures[name] = funcSig("", "i32")
+	}
+	runtime := &emscriptenMockRuntime{module: newContractModule(signatures, exports)}
+	path := filepath.Join(t.TempDir(), "wasi.wasm")
+	require.NoError(t, os.WriteFile(path, binary, 0o644))
+	return processWasmFileWithOptions(path, runtime, RunOptions{Invocation: plan}), runtime
+}
+
+// -----------------------------------------------------------------------------
+// TEST: WASI Lifecycle
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// A reactor's exports assume _initialize has run, and a command's assume
+// its _start has. Calling them on a fresh instance exercises state no
+// real host would produce, while a failing initializer would otherwise
+// be blamed on whichever input happened to run first.
+// -----------------------------------------------------------------------------
+
+func TestLifecycle_ReactorInitializesBeforeEntry(t *testing.T) {
+	initialized := false
+	result, runtime := runWASI(t, wasiBinary(t, wasiInitializeExport), map[string]contractExport{
+		wasiInitializeExport: func(m *contractModule, args []interface{}) ([]interface{}, error) {
+			initialized = true
+			return nil, nil
+		},
+		"run": func(m *contractModule, args []interface{}) ([]interface{}, error) {
+			if !initialized {
+				return nil, errors.New("called before _initialize")
+			}
+			return []interface{}{int32(1)}, nil
+		},
+	}, InvocationConfig{Entry: "run", Inputs: []InvocationInput{{}}})
+
+	assert.True(t, result.Success, result.ErrorMessage)
+	assert.Contains(t, runtime.module.host, "proc_exit", "WASI imports are linked")
+}
+
+func TestLifecycle_CommandStarts(t *testing.T) {
+	command := func(code int32, ran *int) map[string]contractExport {
+		return map[string]contractExport{
+			wasiStartExport: func(m *contractModule, args []interface{}) ([]interface{}, error) {
+				*ran++
+				_, err := m.call("proc_exit", code)
+				return nil, err
+			},
+			"run": func(m *contractModule, args []interface{}) ([]interface{}, error) {
+				return []interface{}{int32(*ran)}, nil
+			},
+		}
+	}
+
+	var ran int
+	result, _ := runWASI(t, wasiBinary(t, wasiStartExport), command(0, &ran), InvocationConfig{Entry: "run", Inputs: []InvocationInput{{}}})
+	assert.True(t, result.Success, "exiting with code zero is not a failure: %s", result.ErrorMessage)
+	assert.Equal(t, []interface{}{int32(1)}, result.ReturnValues)
+
+	ran = 0
+	result, _ = runWASI(t, wasiBinary(t, wasiStartExport), command(3, &ran), InvocationConfig{Entry: "run", Inputs: []InvocationInput{{}}})
+	assert.False(t, result.Success)
+	assert.Equal(t, StageInstantiate, result.FailureStage)
+	assert.Equal(t, SubStageLifecycle, result.FailureSubStage)
+	assert.Equal(t, "_start exited with code 3", result.ErrorMessage)
+
+	ran = 0
+	result, _ = runWASI(t, wasiBinary(t, wasiStartExport), command(0, &ran), InvocationConfig{Entry: wasiStartExport, Inputs: []InvocationInput{{}}})
+	assert.Equal(t, 1, ran, "a command whose entry is _start is not started twice")
+	assert.Empty(t, result.FailureSubStage)
+}
+
+func TestLifecycle_TrappingInitializer(t *testing.T) {
+	calls := 0
+	result, _ := runWASI(t, wasiBinary(t, wasiInitializeExport), map[string]contractExport{
+		wasiInitializeExport: func(m *contractModule, args []interface{}) ([]interface{}, error) {
+			return nil, &RuntimeError{Stage: StageExecute, Message: "execution failed: unreachable"}
+		},
+		"run": func(m *contractModule, args []interface{}) ([]interface{}, error) {
+			calls++
+			return nil, nil
+		},
+	}, InvocationConfig{Entry: "run", Inputs: []InvocationInput{{}, {}}})
+
+	assert.Equal(t, StageInstantiate, result.FailureStage)
+	assert.Equal(t, SubStageLifecycle, result.FailureSubStage)
+	assert.Equal(t, "_initialize failed: execution failed: unreachable", result.ErrorMessage)
+	assert.Zero(t, calls, "the entry is never called")
+}
+
+func TestLifecycle_OtherModulesLoadUnchanged(t *testing.T) {
+	result, _ := runWASI(t, pluginBinary(), nil, InvocationConfig{})
+	assert.Equal(t, "load failed: loaded without host functions", result.ErrorMessage)
+	assert.Empty(t, result.FailureSubStage)
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Runtime backends selectable per environment
+const (
+	BackendInterpreter = "interpreter"
+	BackendAOT         = "aot"
+)
+
+// knownProposals lists the WASM proposal names accepted in configs
+var knownProposals = map[string]bool{
+	"import-export-mut-globals":         true,
+	"non-trap-float-to-int-conversions": true,
+	"sign-extension-operators":          true,
+	"multi-value":                       true,
+	"bulk-memory-operations":            true,
+	"reference-types":                   true,
+	"simd":                              true,
+	"tail-call":                         true,
+	"multi-memories":                    true,
+	"annotations":                       true,
+	"memory64":                          true,
+	"exception-handling":                true,
+	"extended-const":                    true,
+	"threads":                           true,
+	"function-references":               true,
+}
+
+// MatrixConfig lists the values of each environment axis. Every file is run
+// under every combination of the axes; an empty axis uses the runtime default.
+type MatrixConfig struct {
+	Proposals        [][]string `yaml:"proposals"`
+	MemoryLimitPages []uint     `yaml:"memory_limit_pages"`
+	Backends         []string   `yaml:"backends"`
+}
+
+// Environment is a single runtime configuration from the matrix.
+// The zero Environment is the runtime's default configuration.
+type Environment struct {
+	Name             string   `json:"name"`
+	Proposals        []string `json:"proposals,omitempty"`
+	MemoryLimitPages uint     `json:"memory_limit_pages,omitempty"`
+	Backend          string   `json:"backend,omitempty"`
+}
+
+// Environments expands the matrix into the cartesian product of its axes
+func (m MatrixConfig) Environments() ([]Environment, error) {
+	proposalSets := m.Proposals
+	if len(proposalSets) == 0 {
+		proposalSets = [][]string{nil}
+	}
+	memoryLimits := m.MemoryLimitPages
+	if len(memoryLimits) == 0 {
+		memoryLimits = []uint{0}
+	}
+	backends := m.Backends
+	if len(backends) == 0 {
+		backends = []string{""}
+	}
+
+	for _, set := range proposalSets {
+		for _, proposal := range set {
+			if !knownProposals[proposal] {
+				return nil, fmt.Errorf("unknown proposal %q", proposal)
+			}
+		}
+	}
+	for _, backend := range backends {
+		if backend != "" && backend != BackendInterpreter && backend != BackendAOT {
+			return nil, fmt.Errorf("unknown backend %q (expected %q or %q)", backend, BackendInterpreter, BackendAOT)
+		}
+	}
+
+	var envs []Environment
+	for _, set := range proposalSets {
+		for _, limit := range memoryLimits {
+			for _, backend := range backends {
+				env := Environment{
+					Proposals:        append([]string(nil), set...),
+					MemoryLimitPages: limit,
+					Backend:          backend,
+				}
+				sort.Strings(env.Proposals)
+				env.Name = env.describe()
+				envs = append(envs, env)
+			}
+		}
+	}
+
+	// A matrix with no axes is the single default environment
+	if len(envs) == 1 && envs[0].Name == "default" {
+		envs[0].Name = ""
+	}
+	return envs, nil
+}
+
+// describe builds a stable, human-readable environment name
+func (e Environment) describe() string {
+	var parts []string
+	if len(e.Proposals) > 0 {
+		parts = append(parts, "proposals="+strings.Join(e.Proposals, "+"))
+	}
+	if e.MemoryLimitPages > 0 {
+		parts = append(parts, fmt.Sprintf("memory=%dp", e.MemoryLimitPages))
+	}
+	if e.Backend != "" {
+		parts = append(parts, "backend="+e.Backend)
+	}
+	if len(parts) == 0 {
+		return "default"
+	}
+	return strings.Join(parts, ",")
+}
+
+// EnvironmentSummary holds per-environment totals for matrix campaigns
+type EnvironmentSummary struct {
+	Environment   Environment          `json:"environment"`
+	Passed        int                  `json:"passed"`
+	Failed        int                  `json:"failed"`
+	Skipped       int                  `json:"skipped"`
+	FailureCounts map[FailureStage]int `json:"failure_counts"`
+	SkipCounts    map[SkipReason]int   `json:"skip_counts"`
+}
+
+// EnvironmentDivergence records a file whose outcome depends on the environment
+type EnvironmentDivergence struct {
+	FilePath string                  `json:"file_path"`
+	Outcomes map[string]FailureStage `json:"outcomes"`
+}
+
+// pivotByEnvironment fills in the per-environment summaries and divergences
+// of a matrix report
+func pivotByEnvironment(report *FuzzingReport, envs []Environment) {
+	summaries := make(map[string]*EnvironmentSummary)
+	for _, env := range envs {
+		report.Environments = append(report.Environments, EnvironmentSummary{
+			Environment:   env,
+			FailureCounts: newFailureCounts(),
+			SkipCounts:    newSkipCounts(),
+		})
+	}
+	for i := range report.Environments {
+		summaries[report.Environments[i].Environment.Name] = &report.Environments[i]
+	}
+
+	outcomes := make(map[string]map[string]FailureStage)
+	var order []string
+	for _, result := range report.Results {
+		summary := summaries[result.Environment]
+		if summary == nil {
+			continue
+		}
+		// A file skipped under some environments diverges by configuration
+		// alone, so only the environments that ran it are compared
+		if result.Skipped {
+			summary.Skipped++
+			summary.SkipCounts[result.SkipReason]++
+			continue
+		}
+		if result.Success {
+			summary.Passed++
+		} else {
+			summary.Failed++
+			summary.FailureCounts[result.FailureStage]++
+		}
+
+		if outcomes[result.FilePath] == nil {
+			outcomes[result.FilePath] = make(map[string]FailureStage)
+			order = append(order, result.FilePath)
+		}
+		outcomes[result.FilePath][result.Environment] = result.FailureStage
+	}
+
+	for _, filePath := range order {
+		distinct := make(map[FailureStage]bool)
+		for _, stage := range outcomes[filePath] {
+			distinct[stage] = true
+		}
+		if len(distinct) > 1 {
+			report.EnvironmentDivergences = append(report.EnvironmentDivergences, EnvironmentDivergence{
+				FilePath: filePath,
+				Outcomes: outcomes[filePath],
+			})
+		}
+	}
+}
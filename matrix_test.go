@@ -0,0 +1,189 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// -----------------------------------------------------------------------------
+// TEST: Environment Matrix Expansion
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Configuration-dependent bugs only surface when the same file runs under
+// several runtime configurations. The matrix must expand to every
+// combination with stable names so reports can be compared across runs.
+// -----------------------------------------------------------------------------
+
+func TestMatrix_CartesianProduct(t *testing.T) {
+	matrix := MatrixConfig{
+		Proposals:        [][]string{{}, {"threads", "simd"}},
+		MemoryLimitPages: []uint{16},
+		Backends:         []string{BackendInterpreter, BackendAOT},
+	}
+
+	envs, err := matrix.Environments()
+	require.NoError(t, err)
+
+	names := make([]string, len(envs))
+	for i, env := range envs {
+		names[i] = env.Name
+	}
+	assert.Equal(t, []string{
+		"memory=16p,backend=interpreter",
+		"memory=16p,backend=aot",
+		"proposals=simd+threads,memory=16p,backend=interpreter",
+		"proposals=simd+threads,memory=16p,backend=aot",
+	}, names)
+}
+
+func TestMatrix_EmptyIsDefaultEnvironment(t *testing.T) {
+	envs, err := MatrixConfig{}.Environments()
+
+	require.NoError(t, err)
+	assert.Equal(t, []Environment{{}}, envs)
+}
+
+func TestMatrix_RejectsUnknownValues(t *testing.T) {
+	_, err := MatrixConfig{Proposals: [][]string{{"simdd"}}}.Environments()
+	assert.ErrorContains(t, err, `unknown proposal "simdd"`)
+
+	_, err = MatrixConfig{Backends: []string{"jit"}}.Environments()
+	assert.ErrorContains(t, err, `unknown backend "jit"`)
+}
+
+func TestMatrix_LoadFromConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "campaign.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+matrix:
+  proposals:
+    - []
+    - [simd]
+  memory_limit_pages: [1, 65536]
+`), 0o644))
+
+	config, err := loadConfig(path)
+	require.NoError(t, err)
+
+	envs, err := config.Matrix.Environments()
+	require.NoError(t, err)
+	assert.Len(t, envs, 4)
+}
+
+// -----------------------------------------------------------------------------
+// TEST: Matrix Report Pivot
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// A file that passes under one configuration and fails under another is
+// exactly the signal the matrix exists to find. It must be called out
+// explicitly rather than buried in per-file results.
+// -----------------------------------------------------------------------------
+
+func TestMatrix_ReportPivotsByEnvironment(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "simd.wasm"), []byte("simd"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "plain.wasm"), []byte("plain"), 0o644))
+
+	withoutSIMD := &MockWasmRuntime{
+		LoadModuleFunc: func(filePath string) (WasmModule, error) {
+			if filepath.Base(filePath) == "simd.wasm" {
+				return nil, &RuntimeError{Stage: StageValidate, Message: "SIMD disabled"}
+			}
+			return &MockWasmModule{}, nil
+		},
+	}
+	withSIMD := &MockWasmRuntime{}
+
+	envs := []environmentRuntime{
+		{Environment: Environment{Name: "default"}, Runtime: withoutSIMD},
+		{Environment: Environment{Name: "proposals=simd", Proposals: []string{"simd"}}, Runtime: withSIMD},
+	}
+
+	report, err := runFuzzerWithMatrix(dir, envs, RunOptions{})
+	require.NoError(t, err)
+
+	assert.Equal(t, 4, report.TotalFiles, "each file is counted once per environment")
+	require.Len(t, report.Environments, 2)
+	assert.Equal(t, 1, report.Environments[0].Failed)
+	assert.Equal(t, 1, report.Environments[0].FailureCounts[StageValidate])
+	assert.Equal(t, 2, report.Environments[1].Passed)
+
+	require.Len(t, report.EnvironmentDivergences, 1)
+	assert.Equal(t, filepath.Join(dir, "simd.wasm"), report.EnvironmentDivergences[0].FilePath)
+	assert.Equal(t, map[string]FailureStage{
+		"default":        StageValidate,
+		"proposals=simd": StageNone,
+	}, report.EnvironmentDivergences[0].Outcomes)
+
+	assert.Empty(t, validateReport(report), "matrix reports must remain schema-valid")
+}
+
+func TestMatrix_SkipsModulesNeedingDisabledProposals(t *testing.T) {
+	dir := t.TempDir()
+	// atomic.fence, then the MVP body
+	threads := buildTestModule([]byte{0xfe, 0x03, 0x00, 0x20, 0x00, 0x0b}, true)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "threads.wasm"), threads, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "plain.wasm"), buildTestModule([]byte{0x20, 0x00, 0x0b}, true), 0o644))
+
+	var loaded []string
+	runtime := &MockWasmRuntime{LoadModuleFunc: func(filePath string) (WasmModule, error) {
+		loaded = append(loaded, filepath.Base(filePath))
+		return &MockWasmModule{}, nil
+	}}
+	envs := []environmentRuntime{
+		{Environment: Environment{Name: "default"}, Runtime: runtime},
+		{Environment: Environment{Name: "proposals=threads", Proposals: []string{"threads"}}, Runtime: runtime},
+	}
+
+	report, err := runFuzzerWithMatrix(dir, envs, RunOptions{})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"plain.wasm", "plain.wasm", "threads.wasm"}, loaded, "skipped modules are never loaded")
+	assert.Equal(t, 4, report.TotalFiles)
+	assert.Equal(t, 3, report.Passed)
+	assert.Equal(t, 1, report.Skipped)
+	assert.Zero(t, report.Failed)
+	skipped := report.Results[2]
+	assert.True(t, skipped.Skipped)
+	assert.Equal(t, "default", skipped.Environment)
+	assert.Equal(t, SkipUnsupportedFeature, skipped.SkipReason)
+	assert.Equal(t, "requires disabled proposals: threads", skipped.SkipDetails)
+	assert.Equal(t, 1, report.SkipCounts[SkipUnsupportedFeature])
+
+	assert.Equal(t, 1, report.Environments[0].Skipped)
+	assert.Equal(t, 1, report.Environments[0].SkipCounts[SkipUnsupportedFeature])
+	assert.Empty(t, report.EnvironmentDivergences, "skipping is not a divergence")
+	assert.Empty(t, validateReport(report))
+}
+
+func TestMatrix_HostileModulesDoNotStopTheCampaign(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "hostile.wasm"), hugeTypeCountModule, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "plain.wasm"), buildTestModule([]byte{0x20, 0x00, 0x0b}, true), 0o644))
+
+	report, err := runFuzzerWithRuntime(dir, &MockWasmRuntime{})
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, report.TotalFiles)
+	assert.Zero(t, report.Skipped, "modules that cannot be decoded are run, to fail there")
+	assert.Nil(t, detectFileFeatures(filepath.Join(dir, "hostile.wasm")))
+}
+
+func TestMatrix_SingleEnvironmentHasNoPivot(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.wasm"), []byte("a"), 0o644))
+
+	report, err := runFuzzerWithRuntime(dir, &MockWasmRuntime{})
+	require.NoError(t, err)
+
+	assert.Empty(t, report.Environments)
+	assert.Empty(t, report.Results[0].Environment)
+}
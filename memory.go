@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+)
+
+// defaultMemoryExport is the memory name every common toolchain exports
+const defaultMemoryExport = "memory"
+
+// MemoryModule is implemented by modules whose exported linear memories the
+// harness can read and write, so buffers can be passed to guest functions
+type MemoryModule interface {
+	WasmModule
+	// ReadMemory copies length bytes at offset out of the named memory
+	ReadMemory(memory string, offset, length uint32) ([]byte, error)
+	// WriteMemory copies data into the named memory at offset
+	WriteMemory(memory string, offset uint32, data []byte) error
+}
+
+// Allocator conventions for placing data in guest memory
+const (
+	// AllocatorMalloc is C-style malloc(size) and free(ptr)
+	AllocatorMalloc = "malloc"
+	// AllocatorWasmBindgen is __wbindgen_malloc(size[, align]) and
+	// __wbindgen_free(ptr, size[, align])
+	AllocatorWasmBindgen = "wasm-bindgen"
+	// AllocatorCanonicalABI is the component model's
+	// cabi_realloc(old_ptr, old_size, align, new_size); memory is not freed
+	AllocatorCanonicalABI = "canonical-abi"
+)
+
+// allocatorExports are the exports of each convention, in detection order
+var allocatorExports = []struct {
+	convention  string
+	alloc, free string
+}{
+	{AllocatorCanonicalABI, "cabi_realloc", ""},
+	{AllocatorWasmBindgen, "__wbindgen_malloc", "__wbindgen_free"},
+	{AllocatorMalloc, "malloc", "free"},
+}
+
+// MemoryConfig selects the memory and allocator used to pass buffers
+type MemoryConfig struct {
+	// Convention is how buffer arguments are passed (default "ptr-len")
+	Convention string `yaml:"convention"`
+	// Memory is the exported memory to use (default "memory")
+	Memory string `yaml:"memory"`
+	// Allocator is the allocator convention; empty detects it from the
+	// module's exports
+	Allocator string `yaml:"allocator"`
+	// Free releases buffers after each call, for guests that borrow them
+	// instead of taking ownership
+	Free bool `yaml:"free"`
+}
+
+// guestMemory reads, writes and allocates buffers in a module's memory
+type guestMemory struct {
+	module     MemoryModule
+	memory     string
+	convention string
+	// allocParams and freeParams are the allocator exports' arities, which
+	// differ between wasm-bindgen versions; zero when unknown
+	allocParams, freeParams int
+}
+
+// newGuestMemory prepares buffer access for a module. Detecting the
+// allocator and adapting to its arity needs the module's signatures.
+func newGuestMemory(module WasmModule, config MemoryConfig) (*guestMemory, error) {
+	memory, ok := module.(MemoryModule)
+	if !ok {
+		return nil, fmt.Errorf("runtime does not support memory access")
+	}
+	g := &guestMemory{module: memory, memory: config.Memory, convention: config.Allocator}
+	if g.memory == "" {
+		g.memory = defaultMemoryExport
+	}
+
+	typed, _ := module.(SignatureModule)
+	for _, exports := range allocatorExports {
+		if g.convention != "" && g.convention != exports.convention {
+			continue
+		}
+		if typed == nil {
+			// Trust the configured convention without checking exports
+			if g.convention != "" {
+				return g, nil
+			}
+			break
+		}
+		alloc, found := typed.Signature(exports.alloc)
+		if !found {
+			continue
+		}
+		g.convention = exports.convention
+		g.allocParams = len(alloc.Params)
+		if free, found := typed.Signature(exports.free); found {
+			g.freeParams = len(free.Params)
+		}
+		return g, nil
+	}
+
+	if g.convention != "" {
+		for _, exports := range allocatorExports {
+			if exports.convention == g.convention {
+				return nil, fmt.Errorf("allocator export '%s' not found", exports.alloc)
+			}
+		}
+		return nil, fmt.Errorf("unknown allocator convention %q", g.convention)
+	}
+	if typed == nil {
+		return nil, fmt.Errorf("allocator convention must be configured for this runtime")
+	}
+	return nil, fmt.Errorf("no allocator export found (cabi_realloc, __wbindgen_malloc or malloc)")
+}
+
+// Read copies length bytes at ptr out of guest memory
+func (g *guestMemory) Read(ptr, length uint32) ([]byte, error) {
+	return g.module.ReadMemory(g.memory, ptr, length)
+}
+
+// Write copies data into guest memory at ptr
+func (g *guestMemory) Write(ptr uint32, data []byte) error {
+	return g.module.WriteMemory(g.memory, ptr, data)
+}
+
+// Alloc reserves size bytes with the given alignment through the guest's
+// allocator and returns their address
+func (g *guestMemory) Alloc(size, align uint32) (uint32, error) {
+	var name string
+	var args []interface{}
+	switch g.convention {
+	case AllocatorCanonicalABI:
+		name, args = "cabi_realloc", []interface{}{int32(0), int32(0), int32(align), int32(size)}
+	case AllocatorWasmBindgen:
+		name, args = "__wbindgen_malloc", []interface{}{int32(size)}
+		if g.allocParams != 1 {
+			args = append(args, int32(align))
+		}
+	default:
+		name, args = "malloc", []interface{}{int32(size)}
+	}
+
+	returns, err := g.module.Execute(name, args...)
+	if err != nil {
+		_, message := classifyError(err, StageExecute, "execution failed")
+		return 0, fmt.Errorf("allocator '%s' failed: %s", name, message)
+	}
+	if len(returns) != 1 {
+		return 0, fmt.Errorf("allocator '%s' returned %d values", name, len(returns))
+	}
+	ptr, ok := returns[0].(int32)
+	if !ok {
+		return 0, fmt.Errorf("allocator '%s' returned %T, expected i32", name, returns[0])
+	}
+	if ptr == 0 && size > 0 {
+		return 0, fmt.Errorf("allocator '%s' could not allocate %d bytes", name, size)
+	}
+	return uint32(ptr), nil
+}
+
+// Free releases a buffer from Alloc. The canonical ABI has no free, and
+// other conventions are skipped when the module does not export one.
+func (g *guestMemory) Free(ptr, size, align uint32) error {
+	var name string
+	var args []interface{}
+	switch g.convention {
+	case AllocatorCanonicalABI:
+		return nil
+	case AllocatorWasmBindgen:
+		name, args = "__wbindgen_free", []interface{}{int32(ptr), int32(size)}
+		if g.freeParams != 2 {
+			args = append(args, int32(align))
+		}
+	default:
+		name, args = "free", []interface{}{int32(ptr)}
+	}
+	if _, typed := g.module.(SignatureModule); typed && g.freeParams == 0 {
+		return nil
+	}
+
+	if _, err := g.module.Execute(name, args...); err != nil {
+		_, message := classifyError(err, StageExecute, "execution failed")
+		return fmt.Errorf("deallocator '%s' failed: %s", name, message)
+	}
+	return nil
+}
+
+// WriteBytes allocates a buffer, copies data into it and returns its
+// address. Empty data still gets a valid address.
+func (g *guestMemory) WriteBytes(data []byte, align uint32) (uint32, error) {
+	ptr, err := g.Alloc(uint32(len(data)), align)
+	if err != nil {
+		return 0, err
+	}
+	if err := g.Write(ptr, data); err != nil {
+		return 0, fmt.Errorf("writing %d bytes at 0x%x: %w", len(data), ptr, err)
+	}
+	return ptr, nil
+}
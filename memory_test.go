@@ -0,0 +1,229 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// heapMockModule has one page of memory and a bump allocator behind
+// whichever allocator exports its signatures declare
+type heapMockModule struct {
+	signatureMockModule
+	memory []byte
+	next   int32
+	names  []string
+}
+
+func newHeapMockModule(signatures map[string]FuncSignature) *heapMockModule {
+	m := &heapMockModule{memory: make([]byte, wasmPageSize), next: 1024}
+	m.signatures = signatures
+	m.ExecuteFunc = func(funcName string, args ...interface{}) ([]interface{}, error) {
+		m.names = append(m.names, funcName)
+		switch funcName {
+		case "malloc", "__wbindgen_malloc":
+			return m.bump(args[0].(int32), 1), nil
+		case "cabi_realloc":
+			return m.bump(args[3].(int32), args[2].(int32)), nil
+		}
+		return nil, nil
+	}
+	return m
+}
+
+func (m *heapMockModule) bump(size, align int32) []interface{} {
+	ptr := (m.next + align - 1) / align * align
+	m.next = ptr + size
+	return []interface{}{ptr}
+}
+
+func (m *heapMockModule) ReadMemory(memory string, offset, length uint32) ([]byte, error) {
+	if memory != defaultMemoryExport {
+		return nil, fmt.Errorf("memory '%s' not found", memory)
+	}
+	return append([]byte(nil), m.memory[offset:offset+length]...), nil
+}
+
+func (m *heapMockModule) WriteMemory(memory string, offset uint32, data []byte) error {
+	if memory != defaultMemoryExport {
+		return fmt.Errorf("memory '%s' not found", memory)
+	}
+	copy(m.memory[offset:], data)
+	return nil
+}
+
+// unsignedHeapModule hides the signatures of a heap module
+type unsignedHeapModule struct {
+	MemoryModule
+}
+
+// -----------------------------------------------------------------------------
+// TEST: Guest Memory Access
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Most real entry points take buffers, not scalars. To pass one, the harness
+// must allocate inside the guest with the allocator its toolchain exports and
+// copy the bytes into linear memory. Calling an allocator with the wrong
+// arity or convention corrupts the guest heap and produces bogus findings.
+// -----------------------------------------------------------------------------
+
+func TestMemory_DetectsAllocatorConventions(t *testing.T) {
+	tests := []struct {
+		name       string
+		exports    map[string]FuncSignature
+		convention string
+	}{
+		{"malloc", map[string]FuncSignature{
+			"malloc": {Params: []string{"i32"}, Results: []string{"i32"}},
+			"free":   {Params: []string{"i32"}, Results: []string{}},
+		}, AllocatorMalloc},
+		{"wasm-bindgen", map[string]FuncSignature{
+			"__wbindgen_malloc": {Params: []string{"i32", "i32"}, Results: []string{"i32"}},
+		}, AllocatorWasmBindgen},
+		{"canonical ABI wins", map[string]FuncSignature{
+			"cabi_realloc": {Params: []string{"i32", "i32", "i32", "i32"}, Results: []string{"i32"}},
+			"malloc":       {Params: []string{"i32"}, Results: []string{"i32"}},
+		}, AllocatorCanonicalABI},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := newGuestMemory(newHeapMockModule(tt.exports), MemoryConfig{})
+			require.NoError(t, err)
+			assert.Equal(t, tt.convention, g.convention)
+			assert.Equal(t, defaultMemoryExport, g.memory)
+		})
+	}
+}
+
+func TestMemory_WriteBytesRoundTrips(t *testing.T) {
+	module := newHeapMockModule(map[string]FuncSignature{
+		"malloc": {Params: []string{"i32"}, Results: []string{"i32"}},
+		"free":   {Params: []string{"i32"}, Results: []string{}},
+	})
+	g, err := newGuestMemory(module, MemoryConfig{})
+	require.NoError(t, err)
+
+	ptr, err := g.WriteBytes([]byte("hello"), 1)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1024), ptr)
+
+	data, err := g.Read(ptr, 5)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+
+	require.NoError(t, g.Free(ptr, 5, 1))
+	assert.Equal(t, [][]interface{}{{int32(5)}, {int32(1024)}}, module.calls)
+}
+
+func TestMemory_AdaptsToWasmBindgenArity(t *testing.T) {
+	// Older wasm-bindgen versions take no alignment
+	module := newHeapMockModule(map[string]FuncSignature{
+		"__wbindgen_malloc": {Params: []string{"i32"}, Results: []string{"i32"}},
+		"__wbindgen_free":   {Params: []string{"i32", "i32"}, Results: []string{}},
+	})
+	g, err := newGuestMemory(module, MemoryConfig{})
+	require.NoError(t, err)
+
+	ptr, err := g.Alloc(16, 8)
+	require.NoError(t, err)
+	require.NoError(t, g.Free(ptr, 16, 8))
+
+	assert.Equal(t, [][]interface{}{{int32(16)}, {int32(1024), int32(16)}}, module.calls)
+}
+
+func TestMemory_CanonicalABIReallocatesFromNull(t *testing.T) {
+	module := newHeapMockModule(map[string]FuncSignature{
+		"cabi_realloc": {Params: []string{"i32", "i32", "i32", "i32"}, Results: []string{"i32"}},
+	})
+	g, err := newGuestMemory(module, MemoryConfig{})
+	require.NoError(t, err)
+
+	ptr, err := g.Alloc(12, 4)
+	require.NoError(t, err)
+	require.NoError(t, g.Free(ptr, 12, 4))
+
+	assert.Equal(t, [][]interface{}{{int32(0), int32(0), int32(4), int32(12)}}, module.calls, "the canonical ABI has no free")
+}
+
+func TestMemory_SkipsMissingFree(t *testing.T) {
+	module := newHeapMockModule(map[string]FuncSignature{
+		"malloc": {Params: []string{"i32"}, Results: []string{"i32"}},
+	})
+	g, err := newGuestMemory(module, MemoryConfig{})
+	require.NoError(t, err)
+
+	require.NoError(t, g.Free(1024, 4, 1))
+	assert.Empty(t, module.calls)
+}
+
+func TestMemory_ConfiguredConventionWithoutSignatures(t *testing.T) {
+	module := newHeapMockModule(nil)
+
+	_, err := newGuestMemory(unsignedHeapModule{module}, MemoryConfig{})
+	assert.EqualError(t, err, "allocator convention must be configured for this runtime")
+
+	g, err := newGuestMemory(unsignedHeapModule{module}, MemoryConfig{Allocator: AllocatorWasmBindgen})
+	require.NoError(t, err)
+	ptr, err := g.Alloc(3, 1)
+	require.NoError(t, err)
+	require.NoError(t, g.Free(ptr, 3, 1))
+
+	assert.Equal(t, []string{"__wbindgen_malloc", "__wbindgen_free"}, module.names)
+	assert.Equal(t, [][]interface{}{{int32(3), int32(1)}, {int32(1024), int32(3), int32(1)}}, module.calls, "current arity is assumed")
+}
+
+func TestMemory_SetupErrors(t *testing.T) {
+	_, err := newGuestMemory(&MockWasmModule{}, MemoryConfig{})
+	assert.EqualError(t, err, "runtime does not support memory access")
+
+	_, err = newGuestMemory(newHeapMockModule(nil), MemoryConfig{})
+	assert.EqualError(t, err, "no allocator export found (cabi_realloc, __wbindgen_malloc or malloc)")
+
+	malloc := map[string]FuncSignature{"malloc": {Params: []string{"i32"}, Results: []string{"i32"}}}
+	_, err = newGuestMemory(newHeapMockModule(malloc), MemoryConfig{Allocator: AllocatorCanonicalABI})
+	assert.EqualError(t, err, "allocator export 'cabi_realloc' not found")
+
+	_, err = newGuestMemory(newHeapMockModule(malloc), MemoryConfig{Allocator: "jemalloc"})
+	assert.EqualError(t, err, `unknown allocator convention "jemalloc"`)
+}
+
+func TestMemory_AllocatorFailures(t *testing.T) {
+	malloc := map[string]FuncSignature{"malloc": {Params: []string{"i32"}, Results: []string{"i32"}}}
+
+	module := newHeapMockModule(malloc)
+	module.ExecuteFunc = func(funcName string, args ...interface{}) ([]interface{}, error) {
+		return []interface{}{int32(0)}, nil
+	}
+	g, err := newGuestMemory(module, MemoryConfig{})
+	require.NoError(t, err)
+	_, err = g.WriteBytes([]byte("x"), 1)
+	assert.EqualError(t, err, "allocator 'malloc' could not allocate 1 bytes")
+
+	module.ExecuteFunc = func(funcName string, args ...interface{}) ([]interface{}, error) {
+		return nil, &RuntimeError{Stage: StageExecute, Message: "execution failed: unreachable"}
+	}
+	_, err = g.Alloc(8, 1)
+	assert.EqualError(t, err, "allocator 'malloc' failed: execution failed: unreachable")
+
+	module.ExecuteFunc = func(funcName string, args ...interface{}) ([]interface{}, error) {
+		return []interface{}{int64(8)}, nil
+	}
+	_, err = g.Alloc(8, 1)
+	assert.EqualError(t, err, "allocator 'malloc' returned int64, expected i32")
+}
+
+func TestMemory_UsesConfiguredMemory(t *testing.T) {
+	malloc := map[string]FuncSignature{"malloc": {Params: []string{"i32"}, Results: []string{"i32"}}}
+	g, err := newGuestMemory(newHeapMockModule(malloc), MemoryConfig{Memory: "heap"})
+	require.NoError(t, err)
+
+	_, err = g.WriteBytes([]byte("x"), 1)
+	assert.EqualError(t, err, "writing 1 bytes at 0x400: memory 'heap' not found")
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// MemoryPressureConfig starves isolated workers of memory during some
+// stages, to see how the runtime and the harness cope when allocations
+// fail. Setting Headroom isolates the campaign, as a starved worker may
+// die. It is only enforced on Linux.
+type MemoryPressureConfig struct {
+	// Headroom is how much more memory a worker may take during the
+	// stages than it holds as they start. The data segment's soft limit
+	// is lowered to that, and raised back after them.
+	Headroom ByteSize `yaml:"headroom"`
+	// Stages are the stages run under pressure, every stage when unset
+	Stages []FailureStage `yaml:"stages"`
+}
+
+// enabled reports whether workers run under memory pressure
+func (c MemoryPressureConfig) enabled() bool {
+	return c.Headroom > 0
+}
+
+// check rejects stages set without a headroom, and unknown stages
+func (c MemoryPressureConfig) check() error {
+	if c.Headroom < 0 {
+		return errors.New("memory_pressure: headroom must not be negative")
+	}
+	if !c.enabled() && len(c.Stages) > 0 {
+		return errors.New("memory_pressure: stages need a headroom")
+	}
+	for _, stage := range c.Stages {
+		switch stage {
+		case StageLoad, StageValidate, StageInstantiate, StageExecute:
+		default:
+			return fmt.Errorf("memory_pressure: unknown stage %q: use load, validate, instantiate or execute", stage)
+		}
+	}
+	return nil
+}
+
+// covers reports whether a stage runs under pressure
+func (c MemoryPressureConfig) covers(stage FailureStage) bool {
+	if len(c.Stages) == 0 {
+		return true
+	}
+	for _, s := range c.Stages {
+		if s == stage {
+			return true
+		}
+	}
+	return false
+}
+
+// memoryPressure lowers a worker's data limit during the configured
+// stages, nil when there is no pressure
+type memoryPressure struct {
+	config MemoryPressureConfig
+	// soft is the soft limit to restore, which pressure never raises, and
+	// hard the hard limit, left as it is
+	soft, hard uint64
+	applied    bool
+}
+
+// startMemoryPressure puts the stages of the files a worker runs under
+// the configured pressure. The pressure returned is relieved once a file
+// has run; it is nil without pressure, or when it cannot be applied.
+func startMemoryPressure(config MemoryPressureConfig) *memoryPressure {
+	if !config.enabled() {
+		return nil
+	}
+	soft, hard, err := dataLimit()
+	if err != nil {
+		warnMemoryPressure(err)
+		return nil
+	}
+	p := &memoryPressure{config: config, soft: soft, hard: hard}
+	notify := stageStarted
+	stageStarted = func(stage FailureStage) {
+		// The parent hears of the stage before memory runs short
+		notify(stage)
+		p.enter(stage)
+	}
+	return p
+}
+
+// use sets the pressure of the next file, none for a clean run
+func (p *memoryPressure) use(config MemoryPressureConfig) {
+	if p != nil {
+		p.config = config
+	}
+}
+
+// enter puts a stage under pressure, or lifts the pressure of the stage
+// before
+func (p *memoryPressure) enter(stage FailureStage) {
+	if !p.config.enabled() || !p.config.covers(stage) {
+		p.relieve()
+		return
+	}
+	// Later stages under pressure keep the limit of the first
+	if p.applied {
+		return
+	}
+	size, err := dataSize()
+	if err == nil {
+		limit := size + uint64(p.config.Headroom)
+		if limit > p.soft {
+			limit = p.soft
+		}
+		err = setDataLimit(limit, p.hard)
+	}
+	if err != nil {
+		warnMemoryPressure(err)
+		return
+	}
+	p.applied = true
+}
+
+// relieve restores the limit the worker started with
+func (p *memoryPressure) relieve() {
+	if p == nil || !p.applied {
+		return
+	}
+	p.applied = false
+	if err := setDataLimit(p.soft, p.hard); err != nil {
+		warnMemoryPressure(err)
+	}
+}
+
+func warnMemoryPressure(err error) {
+	emitError(map[string]string{
+		"warning": "memory pressure not applied",
+		"details": err.Error(),
+	})
+}
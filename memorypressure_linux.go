@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// dataLimit returns the soft and hard limits of the data segment
+func dataLimit() (soft, hard uint64, err error) {
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_DATA, &limit); err != nil {
+		return 0, 0, err
+	}
+	return limit.Cur, limit.Max, nil
+}
+
+// setDataLimit sets the limits of the data segment. Lowering only the
+// soft limit lets it be raised back.
+func setDataLimit(soft, hard uint64) error {
+	return syscall.Setrlimit(syscall.RLIMIT_DATA, &syscall.Rlimit{Cur: soft, Max: hard})
+}
+
+// dataSize returns the size of the data segment, as RLIMIT_DATA counts it
+func dataSize() (uint64, error) {
+	statm, err := os.ReadFile("/proc/self/statm")
+	if err != nil {
+		return 0, err
+	}
+	// size resident shared text lib data dirty, in pages
+	fields := strings.Fields(string(statm))
+	if len(fields) < 6 {
+		return 0, fmt.Errorf("unexpected /proc/self/statm: %q", statm)
+	}
+	pages, err := strconv.ParseUint(fields[5], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return pages * uint64(os.Getpagesize()), nil
+}
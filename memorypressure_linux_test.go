@@ -0,0 +1,52 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryPressure_LowersTheDataLimitDuringStages(t *testing.T) {
+	soft, hard, err := dataLimit()
+	require.NoError(t, err)
+	original := stageStarted
+	t.Cleanup(func() {
+		stageStarted = original
+		setDataLimit(soft, hard)
+	})
+
+	path := filepath.Join(t.TempDir(), "alloc.wasm")
+	require.NoError(t, os.WriteFile(path, []byte("alloc"), 0o644))
+	var limits []uint64
+	runtime := &MockWasmRuntime{LoadModuleFunc: func(string) (WasmModule, error) {
+		return &MockWasmModule{ExecuteFunc: func(string, ...interface{}) ([]interface{}, error) {
+			limit, _, err := dataLimit()
+			require.NoError(t, err)
+			limits = append(limits, limit)
+			return nil, nil
+		}}, nil
+	}}
+
+	// Generous headroom, as the test process itself is under it
+	requests := strings.NewReader(`{"file":"` + path + `"}` + "\n" + `{"file":"` + path + `","clean":true}` + "\n")
+	opts := RunOptions{MemoryPressure: MemoryPressureConfig{Headroom: 1 << 30, Stages: []FailureStage{StageExecute}}}
+	require.NoError(t, serveCampaignWorker(requests, &workerEncoder{encoder: json.NewEncoder(io.Discard)}, runtime, opts))
+
+	require.Len(t, limits, 2)
+	size, err := dataSize()
+	require.NoError(t, err)
+	assert.Less(t, limits[0], size+2<<30, "the first run is starved")
+	assert.Equal(t, soft, limits[1], "the clean run is not")
+	after, _, err := dataLimit()
+	require.NoError(t, err)
+	assert.Equal(t, soft, after, "the limit is restored once the file has run")
+}
@@ -0,0 +1,23 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "errors"
+
+var errMemoryPressure = errors.New("memory pressure is only supported on Linux")
+
+// dataLimit is only supported on Linux
+func dataLimit() (soft, hard uint64, err error) {
+	return 0, 0, errMemoryPressure
+}
+
+// setDataLimit is only supported on Linux
+func setDataLimit(soft, hard uint64) error {
+	return errMemoryPressure
+}
+
+// dataSize is only supported on Linux
+func dataSize() (uint64, error) {
+	return 0, errMemoryPressure
+}
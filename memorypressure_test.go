@@ -0,0 +1,44 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// -----------------------------------------------------------------------------
+// TEST: Memory Pressure
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Allocations rarely fail on a developer's machine, so the runtime's and
+// the harness's handling of failed allocations goes untested until a
+// loaded production host runs short. Starving workers during chosen
+// stages exercises those paths on purpose.
+// -----------------------------------------------------------------------------
+
+func TestMemoryPressure_Check(t *testing.T) {
+	assert.NoError(t, MemoryPressureConfig{}.check())
+	assert.NoError(t, MemoryPressureConfig{Headroom: 1 << 20, Stages: []FailureStage{StageInstantiate, StageExecute}}.check())
+	assert.EqualError(t, MemoryPressureConfig{Stages: []FailureStage{StageExecute}}.check(), "memory_pressure: stages need a headroom")
+	assert.ErrorContains(t, MemoryPressureConfig{Headroom: 1 << 20, Stages: []FailureStage{StageSignature}}.check(), `unknown stage "signature"`)
+	assert.ErrorContains(t, RunOptions{MemoryPressure: MemoryPressureConfig{Headroom: -1}}.check(), "must not be negative")
+}
+
+func TestMemoryPressure_CoversStages(t *testing.T) {
+	all := MemoryPressureConfig{Headroom: 1 << 20}
+	execute := MemoryPressureConfig{Headroom: 1 << 20, Stages: []FailureStage{StageExecute}}
+	assert.True(t, all.covers(StageLoad))
+	assert.True(t, execute.covers(StageExecute))
+	assert.False(t, execute.covers(StageInstantiate))
+}
+
+func TestMemoryPressure_IsAnInjection(t *testing.T) {
+	opts := RunOptions{MemoryPressure: MemoryPressureConfig{Headroom: 4096, Stages: []FailureStage{StageExecute}}}
+	assert.True(t, opts.injects())
+	assert.False(t, opts.clean().injects(), "clean runs are not starved")
+	assert.Equal(t, []string{"memory pressure: 4096 bytes of headroom in execute"}, describeInjections(opts))
+}
@@ -0,0 +1,131 @@
+package main
+
+import "fmt"
+
+// ObjectCounter is implemented by runtimes that count the native objects
+// they have created and not yet released
+type ObjectCounter interface {
+	LiveObjects() int64
+}
+
+// memoryGrowthWindows is the number of windows a campaign's samples are
+// split into; memory grows steadily when every window's low is above the
+// previous one's
+const memoryGrowthWindows = 4
+
+// minRSSGrowth is the smallest RSS growth reported, as Go's own heap and
+// WasmEdge's caches move RSS by a few megabytes on their own
+const minRSSGrowth = 16 << 20
+
+// MemorySummary tracks process memory and live runtime objects over a
+// campaign, with warnings when either keeps growing
+type MemorySummary struct {
+	// RSS is unavailable, and left zero, outside Linux
+	StartRSSBytes int64 `json:"start_rss_bytes"`
+	PeakRSSBytes  int64 `json:"peak_rss_bytes"`
+	EndRSSBytes   int64 `json:"end_rss_bytes"`
+	// Live objects are counted after each file, once its module is closed
+	StartLiveObjects int64    `json:"start_live_objects"`
+	PeakLiveObjects  int64    `json:"peak_live_objects"`
+	EndLiveObjects   int64    `json:"end_live_objects"`
+	Samples          int      `json:"samples"`
+	Warnings         []string `json:"warnings,omitempty"`
+}
+
+// readRSS reads the process RSS; tests replace it
+var readRSS = processRSS
+
+// memoryMonitor samples RSS and live objects after every file. A nil
+// monitor samples nothing.
+type memoryMonitor struct {
+	counters []ObjectCounter
+	rss      []int64
+	objects  []int64
+}
+
+// newMemoryMonitor samples the state before the campaign starts
+func newMemoryMonitor(envs []environmentRuntime) *memoryMonitor {
+	m := &memoryMonitor{}
+	for _, env := range envs {
+		if counter, ok := env.Runtime.(ObjectCounter); ok {
+			m.counters = append(m.counters, counter)
+		}
+	}
+	m.sample()
+	return m
+}
+
+// sample records the current RSS and live objects
+func (m *memoryMonitor) sample() {
+	if m == nil {
+		return
+	}
+	if rss, ok := readRSS(); ok {
+		m.rss = append(m.rss, rss)
+	}
+	var objects int64
+	for _, counter := range m.counters {
+		objects += counter.LiveObjects()
+	}
+	m.objects = append(m.objects, objects)
+}
+
+// summary summarizes the samples and warns about steady growth
+func (m *memoryMonitor) summary() *MemorySummary {
+	if m == nil {
+		return nil
+	}
+	s := &MemorySummary{Samples: len(m.objects)}
+	if len(m.rss) > 0 {
+		s.StartRSSBytes, s.PeakRSSBytes, s.EndRSSBytes = m.rss[0], peak(m.rss), m.rss[len(m.rss)-1]
+		if steadyGrowth(m.rss, minRSSGrowth) {
+			s.Warnings = append(s.Warnings, fmt.Sprintf(
+				"RSS grew steadily from %d to %d bytes over %d files: memory may be leaking at the CGO boundary",
+				s.StartRSSBytes, s.EndRSSBytes, len(m.rss)-1))
+		}
+	}
+	s.StartLiveObjects, s.PeakLiveObjects, s.EndLiveObjects = m.objects[0], peak(m.objects), m.objects[len(m.objects)-1]
+	if steadyGrowth(m.objects, 1) {
+		s.Warnings = append(s.Warnings, fmt.Sprintf(
+			"live runtime objects grew steadily from %d to %d over %d files: objects are not being released",
+			s.StartLiveObjects, s.EndLiveObjects, len(m.objects)-1))
+	}
+	return s
+}
+
+// steadyGrowth reports whether values grow across the whole campaign by
+// at least minGrowth: split into windows, each window's lowest value must
+// be above the previous window's. Lows are compared rather than single
+// samples so a garbage collection or a large module in between does not
+// hide a leak, nor does a one-off spike look like one.
+func steadyGrowth(values []int64, minGrowth int64) bool {
+	if len(values) < 2*memoryGrowthWindows {
+		return false
+	}
+	size := len(values) / memoryGrowthWindows
+	var lows []int64
+	for w := 0; w < memoryGrowthWindows; w++ {
+		window := values[w*size : (w+1)*size]
+		if w == memoryGrowthWindows-1 {
+			window = values[w*size:]
+		}
+		low := window[0]
+		for _, v := range window {
+			low = min(low, v)
+		}
+		if len(lows) > 0 && low <= lows[len(lows)-1] {
+			return false
+		}
+		lows = append(lows, low)
+	}
+	return lows[len(lows)-1]-lows[0] >= minGrowth
+}
+
+// peak returns the largest value
+func peak(values []int64) int64 {
+	largest := values[0]
+	for _, v := range values {
+		largest = max(largest, v)
+	}
+	return largest
+}
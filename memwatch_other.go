@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+// processRSS is only supported on Linux; elsewhere only runtime object
+// counts are tracked
+func processRSS() (int64, bool) {
+	return 0, false
+}
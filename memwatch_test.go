@@ -0,0 +1,83 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// leakingRuntime is a mock runtime that never releases some objects
+type leakingRuntime struct {
+	MockWasmRuntime
+	live int64
+	leak int64
+}
+
+func (r *leakingRuntime) LoadModule(filePath string) (WasmModule, error) {
+	r.live += r.leak
+	return r.MockWasmRuntime.LoadModule(filePath)
+}
+
+func (r *leakingRuntime) LiveObjects() int64 {
+	return r.live
+}
+
+// -----------------------------------------------------------------------------
+// TEST: Memory Tracking
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Objects leaked at the CGO boundary are invisible to Go's garbage
+// collector and only show up as an OOM hours into a campaign. Steady
+// growth has to be flagged, while the noise of ordinary allocation must
+// not be.
+// -----------------------------------------------------------------------------
+
+func TestMemory_WarnsOnSteadyGrowth(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 16; i++ {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, fmt.Sprintf("%02d.wasm", i)), []byte{byte(i)}, 0o644))
+	}
+	var rss int64 = 100 << 20
+	original := readRSS
+	readRSS = func() (int64, bool) {
+		rss += 4 << 20
+		return rss, true
+	}
+	defer func() { readRSS = original }()
+
+	runtime := &leakingRuntime{leak: 3}
+	report, err := runFuzzerWithMatrix(dir, []environmentRuntime{{Runtime: runtime}}, RunOptions{TrackMemory: true})
+	require.NoError(t, err)
+
+	memory := report.Memory
+	require.NotNil(t, memory)
+	assert.Equal(t, 17, memory.Samples, "one sample before the campaign and one per file")
+	assert.Equal(t, int64(104<<20), memory.StartRSSBytes)
+	assert.Equal(t, int64(168<<20), memory.PeakRSSBytes)
+	assert.Equal(t, int64(48), memory.EndLiveObjects)
+	assert.Equal(t, []string{
+		"RSS grew steadily from 109051904 to 176160768 bytes over 16 files: memory may be leaking at the CGO boundary",
+		"live runtime objects grew steadily from 0 to 48 over 16 files: objects are not being released",
+	}, memory.Warnings)
+}
+
+func TestMemory_IgnoresNoise(t *testing.T) {
+	// A plateau, a one-off spike and growth below the threshold
+	assert.False(t, steadyGrowth([]int64{5, 5, 5, 5, 5, 5, 5, 5}, 1))
+	assert.False(t, steadyGrowth([]int64{5, 5, 5, 900, 5, 5, 5, 5}, 1))
+	assert.False(t, steadyGrowth([]int64{1, 2, 3, 4, 5, 6, 7, 8}, 100))
+	assert.False(t, steadyGrowth([]int64{1, 2, 3}, 1), "too few samples to tell")
+	assert.True(t, steadyGrowth([]int64{1, 9, 3, 4, 5, 6, 7, 8}, 1), "lows still rise despite a spike")
+
+	report, err := runFuzzerWithMatrix(t.TempDir(), nil, RunOptions{})
+	require.NoError(t, err)
+	assert.Nil(t, report.Memory, "memory is only tracked when asked for")
+}
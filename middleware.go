@@ -0,0 +1,64 @@
+package main
+
+// ResultMiddleware post-processes each result of a campaign before it is
+// reported, such as to enrich it with the team owning the module or the
+// CVEs tracked against it, to transform it, or to filter it out.
+type ResultMiddleware interface {
+	Name() string
+	// Process changes the result in place, and returns false to leave it
+	// out of the report. An error leaves the result as it was.
+	Process(result *ExecutionResult) (keep bool, err error)
+}
+
+// registeredMiddleware runs after the middleware of a campaign's options
+var registeredMiddleware []ResultMiddleware
+
+// RegisterResultMiddleware adds middleware to every campaign, so a build
+// can tie results to its own systems. Middleware registered first runs
+// first.
+func RegisterResultMiddleware(m ResultMiddleware) {
+	registeredMiddleware = append(registeredMiddleware, m)
+}
+
+// middlewareChain runs middleware in order
+type middlewareChain []ResultMiddleware
+
+func newMiddlewareChain(middleware []ResultMiddleware) middlewareChain {
+	chain := append(middlewareChain(nil), middleware...)
+	return append(chain, registeredMiddleware...)
+}
+
+// process runs a result through the chain, and reports whether the report
+// keeps it. Middleware failing on a result is warned about and skipped,
+// so a flaky external system does not cost the campaign its report.
+func (chain middlewareChain) process(result *ExecutionResult) bool {
+	for _, m := range chain {
+		processed := *result
+		processed.Labels = cloneLabels(result.Labels)
+		keep, err := m.Process(&processed)
+		if err != nil {
+			emitError(map[string]string{
+				"warning": "result middleware failed",
+				"file":    result.FilePath,
+				"details": m.Name() + ": " + err.Error(),
+			})
+			continue
+		}
+		if !keep {
+			return false
+		}
+		*result = processed
+	}
+	return true
+}
+
+func cloneLabels(labels map[string]string) map[string]string {
+	if labels == nil {
+		return nil
+	}
+	clone := make(map[string]string, len(labels))
+	for k, v := range labels {
+		clone[k] = v
+	}
+	return clone
+}
@@ -0,0 +1,104 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// funcMiddleware is result middleware implemented by a Go function
+type funcMiddleware struct {
+	name    string
+	process func(result *ExecutionResult) (bool, error)
+}
+
+func (m funcMiddleware) Name() string { return m.name }
+
+func (m funcMiddleware) Process(result *ExecutionResult) (bool, error) {
+	return m.process(result)
+}
+
+// -----------------------------------------------------------------------------
+// TEST: Result Middleware
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Results are triaged in systems the fuzzer knows nothing about: who owns
+// a module, which CVE it is tracked under. Middleware ties them together
+// before the report is written, and an outage of one of those systems
+// must not cost the campaign its report.
+// -----------------------------------------------------------------------------
+
+func TestMiddleware_EnrichesAndFiltersCampaignResults(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"codec.wasm", "legacy.wasm", "parser.wasm"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte{0}, 0o644))
+	}
+	runtime := &MockWasmRuntime{LoadModuleFunc: func(filePath string) (WasmModule, error) {
+		return nil, &RuntimeError{Stage: StageLoad, Message: "cannot read " + filePath}
+	}}
+
+	original := registeredMiddleware
+	t.Cleanup(func() { registeredMiddleware = original })
+	RegisterResultMiddleware(funcMiddleware{name: "cve", process: func(result *ExecutionResult) (bool, error) {
+		if result.Labels["team"] == "codecs" {
+			result.Labels["cve"] = "CVE-2026-0001"
+		}
+		return true, nil
+	}})
+
+	owners := funcMiddleware{name: "owners", process: func(result *ExecutionResult) (bool, error) {
+		switch filepath.Base(result.FilePath) {
+		case "legacy.wasm":
+			return false, nil
+		case "parser.wasm":
+			result.Labels = map[string]string{"team": "half-written"}
+			return true, errors.New("owner lookup timed out")
+		}
+		result.Labels = map[string]string{"team": "codecs"}
+		return true, nil
+	}}
+	redacted := funcMiddleware{name: "redacted", process: func(result *ExecutionResult) (bool, error) {
+		assert.True(t, strings.HasPrefix(result.ErrorMessage, "cannot read "+dir), "middleware sees the message before redaction")
+		return true, nil
+	}}
+
+	var report FuzzingReport
+	var err error
+	output := captureStderr(t, func() {
+		report, err = runFuzzerWithMatrix(dir, []environmentRuntime{{Runtime: runtime}}, RunOptions{
+			Redaction:  RedactionConfig{Paths: true},
+			Middleware: []ResultMiddleware{redacted, owners},
+		})
+	})
+	require.NoError(t, err)
+
+	require.Len(t, report.Results, 2)
+	assert.Equal(t, 2, report.TotalFiles)
+	assert.Equal(t, 2, report.Failed)
+	assert.Equal(t, 1, report.FilteredOut)
+	assert.Equal(t, map[string]string{"team": "codecs", "cve": "CVE-2026-0001"}, report.Results[0].Labels)
+	assert.Nil(t, report.Results[1].Labels, "a failing middleware leaves the result as it was")
+	assert.Contains(t, string(output), "owners: owner lookup timed out")
+}
+
+func TestMiddleware_KeepsLabelsOfEarlierMiddleware(t *testing.T) {
+	result := ExecutionResult{Labels: map[string]string{"team": "codecs"}}
+	chain := newMiddlewareChain([]ResultMiddleware{funcMiddleware{name: "broken", process: func(result *ExecutionResult) (bool, error) {
+		result.Labels["team"] = "nobody"
+		return false, errors.New("unavailable")
+	}}})
+
+	captureStderr(t, func() {
+		assert.True(t, chain.process(&result), "a failing middleware does not filter")
+	})
+	assert.Equal(t, map[string]string{"team": "codecs"}, result.Labels)
+}
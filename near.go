@@ -0,0 +1,394 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+)
+
+// ABINear calls entries as NEAR contract methods
+const ABINear = "near"
+
+// nearModule is the import module of the NEAR host functions
+const nearModule = "env"
+
+// Limits the NEAR runtime places on values passed to host functions
+const (
+	nearMaxKey     = 2048
+	nearMaxValue   = 4 << 20
+	nearMaxMessage = 16 << 10
+)
+
+// The context every call runs in
+const (
+	nearBlockHeight = 12345
+	nearEpochHeight = 1
+	// nearPrepaidGas is the gas attached to every call, 300 Tgas
+	nearPrepaidGas = 300_000_000_000_000
+)
+
+// nearBalance is the contract's balance in yoctoNEAR, 100 NEAR
+var nearBalance = new(big.Int).Exp(big.NewInt(10), big.NewInt(26), nil)
+
+// nearAccountPattern matches valid NEAR account IDs
+var nearAccountPattern = regexp.MustCompile(`^(([a-z0-9]+[-_])*[a-z0-9]+\.)*([a-z0-9]+[-_])*[a-z0-9]+$`)
+
+// nearPlatform hosts NEAR contracts
+type nearPlatform struct{}
+
+// validate implements contractPlatform.validate
+func (nearPlatform) validate(entry string, signature *FuncSignature) error {
+	if signature != nil && (len(signature.Params) != 0 || len(signature.Results) != 0) {
+		return fmt.Errorf("method '%s' must have signature () -> (), not %s", entry, signature)
+	}
+	return nil
+}
+
+// newKernel implements contractPlatform.newKernel
+func (nearPlatform) newKernel(config ContractConfig, storage *contractStorage) (contractKernel, error) {
+	k := &nearKernel{
+		config:    config,
+		storage:   storage,
+		memory:    &hostMemory{},
+		deposit:   new(big.Int),
+		registers: map[uint64][]byte{},
+	}
+	if k.config.Address == "" {
+		k.config.Address = "contract.test.near"
+	}
+	if k.config.Sender == "" {
+		k.config.Sender = "alice.test.near"
+	}
+	if k.config.Init == "" {
+		k.config.Init = defaultContractMessage
+	}
+	for _, account := range []string{k.config.Address, k.config.Sender} {
+		if len(account) < 2 || len(account) > 64 || !nearAccountPattern.MatchString(account) {
+			return nil, fmt.Errorf("account ID %q is invalid", account)
+		}
+	}
+	if config.Funds != "" {
+		deposit, ok := new(big.Int).SetString(config.Funds, 10)
+		if !ok || deposit.Sign() < 0 || deposit.BitLen() > 128 {
+			return nil, fmt.Errorf("funds: %q is not a yoctoNEAR amount", config.Funds)
+		}
+		k.deposit = deposit
+	}
+	return k, nil
+}
+
+// nearKernel implements the NEAR host functions for one contract
+// instance. Data the host returns goes to registers, which the contract
+// copies into its memory.
+type nearKernel struct {
+	config  ContractConfig
+	storage *contractStorage
+	memory  *hostMemory
+	deposit *big.Int
+
+	input     []byte
+	registers map[uint64][]byte
+}
+
+// read copies n bytes at ptr out of the contract's memory
+func (k *nearKernel) read(ptr, n uint64, limit int) ([]byte, error) {
+	if n > uint64(limit) {
+		return nil, fmt.Errorf("%d bytes exceed the limit of %d", n, limit)
+	}
+	if ptr > math.MaxUint32 || n > math.MaxUint32-ptr {
+		return nil, fmt.Errorf("%d-byte access at 0x%x is out of bounds", n, ptr)
+	}
+	return k.memory.read(ptr, n)
+}
+
+// readString reads a UTF-8 string, which is NUL-terminated when its length
+// is the maximum u64
+func (k *nearKernel) readString(n, ptr uint64) (string, error) {
+	if n != math.MaxUint64 {
+		data, err := k.read(ptr, n, nearMaxMessage)
+		return string(data), err
+	}
+	var data []byte
+	for i := uint64(0); i < nearMaxMessage; i++ {
+		c, err := k.read(ptr+i, 1, 1)
+		if err != nil {
+			return "", err
+		}
+		if c[0] == 0 {
+			return string(data), nil
+		}
+		data = append(data, c[0])
+	}
+	return "", fmt.Errorf("string exceeds the limit of %d bytes", nearMaxMessage)
+}
+
+// readAssemblyScript reads an AssemblyScript string, which is UTF-16 with
+// its byte length stored before it
+func (k *nearKernel) readAssemblyScript(ptr uint64) (string, error) {
+	if ptr < 4 {
+		return "", fmt.Errorf("string at 0x%x has no length", ptr)
+	}
+	header, err := k.read(ptr-4, 4, 4)
+	if err != nil {
+		return "", err
+	}
+	data, err := k.read(ptr, uint64(binary.LittleEndian.Uint32(header)), nearMaxMessage)
+	if err != nil {
+		return "", err
+	}
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(data[i*2:])
+	}
+	return string(utf16.Decode(units)), nil
+}
+
+// writeU128 stores a little-endian u128 at ptr
+func (k *nearKernel) writeU128(ptr uint64, v *big.Int) error {
+	buf := make([]byte, 16)
+	v.FillBytes(buf)
+	for i, j := 0, len(buf)-1; i < j; i, j = i+1, j-1 {
+		buf[i], buf[j] = buf[j], buf[i]
+	}
+	if ptr > math.MaxUint32-16 {
+		return fmt.Errorf("16-byte access at 0x%x is out of bounds", ptr)
+	}
+	return k.memory.write(ptr, buf)
+}
+
+// functions returns the NEAR host functions by name
+func (k *nearKernel) functions() map[string]nativeFunction {
+	u64 := func(v uint64) []interface{} { return []interface{}{int64(v)} }
+	flag := func(set bool) []interface{} {
+		if set {
+			return u64(1)
+		}
+		return u64(0)
+	}
+	// register copies data to a register
+	register := func(data []byte) func(args []uint64) ([]interface{}, error) {
+		return func(args []uint64) ([]interface{}, error) {
+			k.registers[args[0]] = append([]byte(nil), data...)
+			return nil, nil
+		}
+	}
+	// balance writes an amount to a pointer
+	balance := func(amount *big.Int) func(args []uint64) ([]interface{}, error) {
+		return func(args []uint64) ([]interface{}, error) {
+			return nil, k.writeU128(args[0], amount)
+		}
+	}
+	constant := func(v uint64) func(args []uint64) ([]interface{}, error) {
+		return func(args []uint64) ([]interface{}, error) { return u64(v), nil }
+	}
+	discard := func(args []uint64) ([]interface{}, error) { return nil, nil }
+	key := func(n, ptr uint64) ([]byte, error) {
+		return k.read(ptr, n, nearMaxKey)
+	}
+
+	return map[string]nativeFunction{
+		"read_register": {funcSig("i64 i64", ""), func(args []uint64) ([]interface{}, error) {
+			data, ok := k.registers[args[0]]
+			if !ok {
+				return nil, fmt.Errorf("register %d is not set", args[0])
+			}
+			if args[1] > math.MaxUint32 || uint64(len(data)) > math.MaxUint32-args[1] {
+				return nil, fmt.Errorf("%d-byte access at 0x%x is out of bounds", len(data), args[1])
+			}
+			return nil, k.memory.write(args[1], data)
+		}},
+		"register_len": {funcSig("i64", "i64"), func(args []uint64) ([]interface{}, error) {
+			data, ok := k.registers[args[0]]
+			if !ok {
+				return u64(math.MaxUint64), nil
+			}
+			return u64(uint64(len(data))), nil
+		}},
+		"write_register": {funcSig("i64 i64 i64", ""), func(args []uint64) ([]interface{}, error) {
+			data, err := k.read(args[2], args[1], nearMaxValue)
+			if err == nil {
+				k.registers[args[0]] = data
+			}
+			return nil, err
+		}},
+		"current_account_id":     {funcSig("i64", ""), register([]byte(k.config.Address))},
+		"signer_account_id":      {funcSig("i64", ""), register([]byte(k.config.Sender))},
+		"predecessor_account_id": {funcSig("i64", ""), register([]byte(k.config.Sender))},
+		// An ed25519 key of zeros
+		"signer_account_pk": {funcSig("i64", ""), register(make([]byte, 33))},
+		"input": {funcSig("i64", ""), func(args []uint64) ([]interface{}, error) {
+			k.registers[args[0]] = k.input
+			return nil, nil
+		}},
+		"block_index":            {funcSig("", "i64"), constant(nearBlockHeight)},
+		"block_timestamp":        {funcSig("", "i64"), constant(wasiClock)},
+		"epoch_height":           {funcSig("", "i64"), constant(nearEpochHeight)},
+		"prepaid_gas":            {funcSig("", "i64"), constant(nearPrepaidGas)},
+		"used_gas":               {funcSig("", "i64"), constant(0)},
+		"account_balance":        {funcSig("i64", ""), balance(nearBalance)},
+		"account_locked_balance": {funcSig("i64", ""), balance(new(big.Int))},
+		"attached_deposit":       {funcSig("i64", ""), balance(k.deposit)},
+		"storage_usage": {funcSig("", "i64"), func(args []uint64) ([]interface{}, error) {
+			return u64(k.storage.size()), nil
+		}},
+		// Randomness is fixed so runs are reproducible
+		"random_seed": {funcSig("i64", ""), register(make([]byte, 32))},
+		"sha256": {funcSig("i64 i64 i64", ""), func(args []uint64) ([]interface{}, error) {
+			data, err := k.read(args[1], args[0], nearMaxValue)
+			if err != nil {
+				return nil, err
+			}
+			sum := sha256.Sum256(data)
+			k.registers[args[2]] = sum[:]
+			return nil, nil
+		}},
+		"ed25519_verify": {funcSig("i64 i64 i64 i64 i64 i64", "i64"), func(args []uint64) ([]interface{}, error) {
+			if args[0] != ed25519.SignatureSize || args[4] != ed25519.PublicKeySize {
+				return nil, fmt.Errorf("ed25519_verify: signature must be %d bytes and public key %d", ed25519.SignatureSize, ed25519.PublicKeySize)
+			}
+			sig, err := k.read(args[1], args[0], ed25519.SignatureSize)
+			if err != nil {
+				return nil, err
+			}
+			msg, err := k.read(args[3], args[2], nearMaxValue)
+			if err != nil {
+				return nil, err
+			}
+			pubkey, err := k.read(args[5], args[4], ed25519.PublicKeySize)
+			if err != nil {
+				return nil, err
+			}
+			return flag(ed25519.Verify(pubkey, msg, sig)), nil
+		}},
+		"value_return": {funcSig("i64 i64", ""), func(args []uint64) ([]interface{}, error) {
+			_, err := k.read(args[1], args[0], nearMaxValue)
+			return nil, err
+		}},
+		"panic": {funcSig("", ""), func(args []uint64) ([]interface{}, error) {
+			return nil, fmt.Errorf("smart contract panicked: explicit guest panic")
+		}},
+		"panic_utf8": {funcSig("i64 i64", ""), func(args []uint64) ([]interface{}, error) {
+			message, err := k.readString(args[0], args[1])
+			if err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("smart contract panicked: %s", message)
+		}},
+		"abort": {funcSig("i32 i32 i32 i32", ""), func(args []uint64) ([]interface{}, error) {
+			message, err := k.readAssemblyScript(args[0])
+			if err != nil {
+				return nil, err
+			}
+			filename, err := k.readAssemblyScript(args[1])
+			if err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("smart contract panicked: %s, filename: %q line: %d col: %d", message, filename, uint32(args[2]), uint32(args[3]))
+		}},
+		"log_utf8":  {funcSig("i64 i64", ""), discard},
+		"log_utf16": {funcSig("i64 i64", ""), discard},
+		"storage_write": {funcSig("i64 i64 i64 i64 i64", "i64"), func(args []uint64) ([]interface{}, error) {
+			name, err := key(args[0], args[1])
+			if err != nil {
+				return nil, err
+			}
+			data, err := k.read(args[3], args[2], nearMaxValue)
+			if err != nil {
+				return nil, err
+			}
+			old, found := k.storage.get(name)
+			if found {
+				k.registers[args[4]] = old
+			}
+			k.storage.set(name, data)
+			return flag(found), nil
+		}},
+		"storage_read": {funcSig("i64 i64 i64", "i64"), func(args []uint64) ([]interface{}, error) {
+			name, err := key(args[0], args[1])
+			if err != nil {
+				return nil, err
+			}
+			data, found := k.storage.get(name)
+			if found {
+				k.registers[args[2]] = data
+			}
+			return flag(found), nil
+		}},
+		"storage_remove": {funcSig("i64 i64 i64", "i64"), func(args []uint64) ([]interface{}, error) {
+			name, err := key(args[0], args[1])
+			if err != nil {
+				return nil, err
+			}
+			old, found := k.storage.get(name)
+			if found {
+				k.registers[args[2]] = old
+				k.storage.remove(name)
+			}
+			return flag(found), nil
+		}},
+		"storage_has_key": {funcSig("i64 i64", "i64"), func(args []uint64) ([]interface{}, error) {
+			name, err := key(args[0], args[1])
+			if err != nil {
+				return nil, err
+			}
+			_, found := k.storage.get(name)
+			return flag(found), nil
+		}},
+	}
+}
+
+// link resolves a contract's imports to the host functions. Promise
+// functions return zero values, since calls to other contracts cannot run;
+// other host functions the fuzzer does not provide trap when called.
+func (k *nearKernel) link(imports []wasmFuncImport) ([]HostFunction, error) {
+	functions := k.functions()
+	var host []HostFunction
+	for _, imp := range imports {
+		if imp.Module != nearModule {
+			continue
+		}
+		fn, ok := functions[imp.Name]
+		switch {
+		case ok:
+			bound, err := fn.bind(imp)
+			if err != nil {
+				return nil, err
+			}
+			host = append(host, bound)
+		case strings.HasPrefix(imp.Name, "promise_"):
+			results, err := zeroResults(imp.Signature)
+			if err != nil {
+				return nil, fmt.Errorf("host function '%s': %v", imp.Name, err)
+			}
+			host = append(host, stubFunction(imp, results))
+		default:
+			host = append(host, unsupportedFunction(imp))
+		}
+	}
+	return host, nil
+}
+
+// instantiate implements contractKernel.instantiate. Contracts without an
+// init_entry start from the configured storage, as contracts whose state
+// has a default do.
+func (k *nearKernel) instantiate(module WasmModule, memory MemoryModule) error {
+	k.memory.module = memory
+	if k.config.InitEntry == "" {
+		return nil
+	}
+	return k.call(module, k.config.InitEntry, []byte(k.config.Init))
+}
+
+// call implements contractKernel.call. NEAR has no error results: a
+// contract rejects a call by panicking, which fails like a trap.
+func (k *nearKernel) call(module WasmModule, entry string, msg []byte) error {
+	k.input, k.registers = msg, map[uint64][]byte{}
+	_, err := module.Execute(entry)
+	return err
+}
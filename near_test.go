@@ -0,0 +1,263 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// nearInput reads the call's input through register 0
+func (m *contractModule) nearInput() ([]byte, error) {
+	if _, err := m.call("input", int64(0)); err != nil {
+		return nil, err
+	}
+	return m.nearRegister(0)
+}
+
+// nearRegister copies a register into memory
+func (m *contractModule) nearRegister(id int64) ([]byte, error) {
+	n, err := m.call("register_len", id)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(n) == ^uint64(0) {
+		return nil, fmt.Errorf("register %d is empty", id)
+	}
+	ptr := m.bump(int32(n), 1)[0].(int32)
+	if _, err := m.call("read_register", id, int64(ptr)); err != nil {
+		return nil, err
+	}
+	return m.memory[ptr : ptr+int32(n)], nil
+}
+
+// nearRead reads a storage value, which is empty when absent
+func (m *contractModule) nearRead(key string) ([]byte, error) {
+	found, err := m.call("storage_read", int64(len(key)), int64(m.put(key)), int64(1))
+	if err != nil || found == 0 {
+		return nil, err
+	}
+	return m.nearRegister(1)
+}
+
+// nearWrite writes a storage value
+func (m *contractModule) nearWrite(key, value string) error {
+	_, err := m.call("storage_write", int64(len(key)), int64(m.put(key)), int64(len(value)), int64(m.put(value)), int64(2))
+	return err
+}
+
+// le reads a little-endian integer of the given size from memory
+func (m *contractModule) le(ptr int32, size int) uint64 {
+	buf := make([]byte, 8)
+	copy(buf, m.memory[ptr:ptr+int32(size)])
+	return binary.LittleEndian.Uint64(buf)
+}
+
+// putAssemblyScript copies an AssemblyScript string into memory
+func (m *contractModule) putAssemblyScript(s string) int32 {
+	var data []byte
+	for _, unit := range utf16.Encode([]rune(s)) {
+		data = binary.LittleEndian.AppendUint16(data, unit)
+	}
+	header := m.put(string(binary.LittleEndian.AppendUint32(nil, uint32(len(data)))))
+	m.put(string(data))
+	return header + 4
+}
+
+// nearFunctions are the NEAR host functions, for their signatures
+var nearFunctions = (&nearKernel{}).functions()
+
+// -----------------------------------------------------------------------------
+// TEST: NEAR Contracts
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// NEAR methods take no arguments and return nothing: they read their input
+// and context into registers, and panic through the host to reject a call.
+// The host must answer those reads as a chain would for the contract to
+// reach its method logic at all.
+// -----------------------------------------------------------------------------
+
+func TestNear_RunsMethods(t *testing.T) {
+	var calls []string
+	newContract := func() *contractModule {
+		signatures := map[string]FuncSignature{"new": funcSig("", ""), "greet": funcSig("", "")}
+		return newContractModule(signatures, map[string]contractExport{
+			"new": func(m *contractModule, args []interface{}) ([]interface{}, error) {
+				input, err := m.nearInput()
+				calls = append(calls, "new "+string(input))
+				return nil, err
+			},
+			"greet": func(m *contractModule, args []interface{}) ([]interface{}, error) {
+				input, err := m.nearInput()
+				if err != nil {
+					return nil, err
+				}
+				if _, err := m.call("predecessor_account_id", int64(3)); err != nil {
+					return nil, err
+				}
+				caller, err := m.nearRegister(3)
+				if err != nil {
+					return nil, err
+				}
+				deposit := m.bump(16, 8)[0].(int32)
+				if _, err := m.call("attached_deposit", int64(deposit)); err != nil {
+					return nil, err
+				}
+				timestamp, _ := m.call("block_timestamp")
+				promise, _ := m.call("promise_create", int64(0), int64(0), int64(0), int64(0), int64(0), int64(0), int64(0))
+
+				reply := fmt.Sprintf("%s from %s with %d at %d, promise %d", input, caller, m.le(deposit, 16), timestamp, promise)
+				if _, err := m.call("sha256", int64(len(reply)), int64(m.put(reply)), int64(4)); err != nil {
+					return nil, err
+				}
+				digest, _ := m.nearRegister(4)
+				calls = append(calls, reply)
+				assert.Equal(t, sha256.Sum256([]byte(reply)), [32]byte(digest))
+				_, err = m.call("value_return", int64(len(reply)), int64(m.put(reply)))
+				return nil, err
+			},
+		})
+	}
+	binary := contractBinary(nearModule, nearFunctions,
+		"input", "register_len", "read_register", "predecessor_account_id", "attached_deposit",
+		"block_timestamp", "sha256", "value_return")
+	binary = pluginBinary(append(moduleImports(binary), wasmFuncImport{
+		Module: nearModule, Name: "promise_create", Signature: funcSig("i64 i64 i64 i64 i64 i64 i64", "i64"),
+	})...)
+	plan := InvocationConfig{
+		ABI: ABINear, Entry: "greet", Inputs: messages("hi"),
+		Contract: ContractConfig{Sender: "bob.near", Funds: "1000", InitEntry: "new", Init: `{"owner":"bob.near"}`},
+	}
+
+	result := runContract(t, binary, &contractMockRuntime{newContract: newContract}, plan)
+
+	require.True(t, result.Success, result.ErrorMessage)
+	assert.Equal(t, []string{
+		`new {"owner":"bob.near"}`,
+		"hi from bob.near with 1000 at 1700000000000000000, promise 0",
+	}, calls)
+	assert.Equal(t, []interface{}{int32(0)}, result.ReturnValues)
+}
+
+func TestNear_Panics(t *testing.T) {
+	tests := []struct {
+		name    string
+		panic   func(m *contractModule) error
+		message string
+	}{
+		{"panic", func(m *contractModule) error {
+			_, err := m.call("panic")
+			return err
+		}, "explicit guest panic"},
+		{"panic_utf8", func(m *contractModule) error {
+			// A length of u64::MAX reads up to a NUL
+			_, err := m.call("panic_utf8", int64(-1), int64(m.put("overflow\x00ignored")))
+			return err
+		}, "overflow"},
+		{"abort", func(m *contractModule) error {
+			_, err := m.call("abort", m.putAssemblyScript("index out of range"), m.putAssemblyScript("main.ts"), int32(7), int32(12))
+			return err
+		}, `index out of range, filename: "main.ts" line: 7 col: 12`},
+	}
+	for _, tt := range tests {
+		newContract := func() *contractModule {
+			return newContractModule(map[string]FuncSignature{"run": funcSig("", "")}, map[string]contractExport{
+				"run": func(m *contractModule, args []interface{}) ([]interface{}, error) { return nil, tt.panic(m) },
+			})
+		}
+		binary := contractBinary(nearModule, nearFunctions, tt.name)
+
+		result := runContract(t, binary, &contractMockRuntime{newContract: newContract}, InvocationConfig{ABI: ABINear, Entry: "run"})
+
+		assert.Equal(t, StageExecute, result.FailureStage, tt.name)
+		assert.Equal(t, fmt.Sprintf("execution failed: host function '%s' failed: smart contract panicked: %s", tt.name, tt.message), result.ErrorMessage)
+	}
+}
+
+func TestNear_HostFunctions(t *testing.T) {
+	storage := newContractStorage(map[string]string{"k": "v"})
+	kernel, err := nearPlatform{}.newKernel(ContractConfig{}, storage)
+	require.NoError(t, err)
+	k := kernel.(*nearKernel)
+	m := newContractModule(nil, nil)
+	k.memory.module = m
+
+	host, err := k.link([]wasmFuncImport{
+		{Module: nearModule, Name: "register_len", Signature: funcSig("i64", "i64")},
+		{Module: nearModule, Name: "read_register", Signature: funcSig("i64 i64", "")},
+		{Module: nearModule, Name: "storage_remove", Signature: funcSig("i64 i64 i64", "i64")},
+		{Module: nearModule, Name: "ed25519_verify", Signature: funcSig("i64 i64 i64 i64 i64 i64", "i64")},
+		{Module: nearModule, Name: "keccak256", Signature: funcSig("i64 i64 i64", "")},
+		{Module: nearModule, Name: "promise_then", Signature: funcSig("i64 i64 i64 i64 i64 i64 i64 i64", "i64")},
+		{Module: wasiModule, Name: "fd_write", Signature: funcSig("i32 i32 i32 i32", "i32")},
+	})
+	require.NoError(t, err)
+	require.Len(t, host, 6, "imports outside env are left to the runtime")
+	for _, fn := range host {
+		m.host[fn.Name] = fn
+	}
+
+	n, err := m.call("register_len", int64(0))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(math.MaxUint64), uint64(n), "unset registers have the maximum length")
+	_, err = m.call("read_register", int64(0), int64(0))
+	assert.EqualError(t, err, "execute: execution failed: host function 'read_register' failed: register 0 is not set")
+
+	found, err := m.call("storage_remove", int64(1), int64(m.put("k")), int64(0))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), found)
+	assert.Empty(t, storage.data)
+	removed, _ := m.nearRegister(0)
+	assert.Equal(t, "v", string(removed), "the removed value is returned in the register")
+
+	public, private, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	sig := ed25519.Sign(private, []byte("msg"))
+	verify := func(msg string) (int64, error) {
+		return m.call("ed25519_verify", int64(64), int64(m.put(string(sig))), int64(len(msg)), int64(m.put(msg)), int64(32), int64(m.put(string(public))))
+	}
+	valid, err := verify("msg")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), valid)
+	valid, err = verify("other")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), valid)
+
+	_, err = m.call("keccak256", int64(0), int64(0), int64(0))
+	assert.EqualError(t, err, "execute: execution failed: host function 'keccak256' failed: keccak256 is not supported by the fuzzer")
+	promise, err := m.call("promise_then", int64(0), int64(0), int64(0), int64(0), int64(0), int64(0), int64(0), int64(0))
+	require.NoError(t, err)
+	assert.Zero(t, promise, "promises cannot run, so they return zero values")
+
+	_, err = k.link([]wasmFuncImport{{Module: nearModule, Name: "input", Signature: funcSig("i32", "")}})
+	assert.EqualError(t, err, "host function 'input' has signature (i64) -> (), but the module imports it as (i32) -> ()")
+	_, err = m.call("read_register", int64(0), int64(math.MaxUint32))
+	assert.EqualError(t, err, "execute: execution failed: host function 'read_register' failed: 1-byte access at 0xffffffff is out of bounds")
+}
+
+func TestNear_ConfigErrors(t *testing.T) {
+	for funds, message := range map[string]string{
+		"-1":  `funds: "-1" is not a yoctoNEAR amount`,
+		"1.5": `funds: "1.5" is not a yoctoNEAR amount`,
+		"340282366920938463463374607431768211456": `funds: "340282366920938463463374607431768211456" is not a yoctoNEAR amount`,
+	} {
+		_, err := nearPlatform{}.newKernel(ContractConfig{Funds: funds}, newContractStorage(nil))
+		assert.EqualError(t, err, message)
+	}
+	_, err := nearPlatform{}.newKernel(ContractConfig{Address: "a..near"}, newContractStorage(nil))
+	assert.EqualError(t, err, `account ID "a..near" is invalid`)
+
+	signature := funcSig("i32", "i32")
+	assert.EqualError(t, nearPlatform{}.validate("run", &signature), "method 'run' must have signature () -> (), not (i32) -> (i32)")
+	assert.NoError(t, nearPlatform{}.validate("run", nil))
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// messageVariants map the wordings runtime versions have used for the same
+// error to one canonical wording, that of current WasmEdge releases, so
+// signatures, codes and deduplication survive runtime upgrades. Variants
+// are matched without regard to case.
+var messageVariants = []struct {
+	variant   *regexp.Regexp
+	canonical string
+}{
+	{regexp.MustCompile(`(?i)out[ -]of[ -]bounds memory access|memory (?:access )?out of bounds`), "out of bounds memory access"},
+	{regexp.MustCompile(`(?i)out[ -]of[ -]bounds table access|table (?:access |index )?out of bounds`), "out of bounds table access"},
+	{regexp.MustCompile(`(?i)(?:indirect call|call_indirect) (?:type|signature) mismatch`), "indirect call type mismatch"},
+	{regexp.MustCompile(`(?i)call stack (?:exhausted|overflow)|stack overflow`), "call stack exhausted"},
+	{regexp.MustCompile(`(?i)(?:integer )?divi(?:de|sion) by zero`), "integer divide by zero"},
+	{regexp.MustCompile(`(?i)unreachable(?: instruction)?(?: executed)?`), "unreachable"},
+	{regexp.MustCompile(`(?i)magic header not detected|(?:invalid|bad)[ _]magic(?:[ _]number)?`), "magic header not detected"},
+	{regexp.MustCompile(`(?i)unknown binary version|(?:invalid|unsupported) (?:binary )?version`), "unknown binary version"},
+	{regexp.MustCompile(`(?i)unexpected end(?: of (?:file|module|section or function))?`), "unexpected end"},
+	{regexp.MustCompile(`(?i)unknown import|(?:import not found|unresolved import)`), "unknown import"},
+}
+
+// whitespace matches runs of whitespace, which wrapped messages differ in
+var whitespace = regexp.MustCompile(`\s+`)
+
+// normalizeMessage rewrites the known variants in a message to their
+// canonical wording. The rest of the message is kept, with its whitespace
+// collapsed.
+func normalizeMessage(message string) string {
+	message = strings.TrimSpace(whitespace.ReplaceAllString(message, " "))
+	for _, known := range messageVariants {
+		message = known.variant.ReplaceAllString(message, known.canonical)
+	}
+	return message
+}
@@ -0,0 +1,54 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// -----------------------------------------------------------------------------
+// TEST: Message Normalization
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Runtime upgrades reword their errors. If the signature of a known bug
+// changed with the wording, every upgrade would flood triage with "new"
+// bugs and break the quarantine. The known variants must all map to one
+// canonical wording, and so to one signature and one code.
+// -----------------------------------------------------------------------------
+
+func TestNormalize_MapsVariantsToCanonicalWording(t *testing.T) {
+	for variant, canonical := range map[string]string{
+		"execution failed: memory out of bounds":                 "execution failed: out of bounds memory access",
+		"execution failed: Out-of-bounds memory access, code: 3": "execution failed: out of bounds memory access, code: 3",
+		"execution failed: call_indirect signature mismatch":     "execution failed: indirect call type mismatch",
+		"execution failed: stack overflow":                       "execution failed: call stack exhausted",
+		"execution failed: division by zero":                     "execution failed: integer divide by zero",
+		"execution failed: unreachable instruction executed":     "execution failed: unreachable",
+		"load failed: invalid magic number":                      "load failed: magic header not detected",
+		"load failed: unexpected end of file":                    "load failed: unexpected end",
+		"import not found: env.print":                            "unknown import: env.print",
+		"validation failed:\n  type   mismatch ":                 "validation failed: type mismatch",
+		"execution failed: out of bounds memory access":          "execution failed: out of bounds memory access",
+	} {
+		assert.Equal(t, canonical, normalizeMessage(variant), variant)
+	}
+}
+
+func TestNormalize_KeepsSignaturesAndCodesStable(t *testing.T) {
+	chain, err := newClassifierChain(nil)
+	assert.NoError(t, err)
+
+	old := ExecutionResult{FailureStage: StageLoad, ErrorMessage: "load failed: invalid magic number"}
+	current := ExecutionResult{FailureStage: StageLoad, ErrorMessage: "load failed: magic header not detected"}
+	assert.Equal(t, chain.classify(current).Signature, chain.classify(old).Signature)
+	assert.Equal(t, ErrLoadMagic, errorCode(old))
+
+	trap := ExecutionResult{FailureStage: StageExecute, ErrorMessage: "execution failed: memory out of bounds"}
+	assert.Equal(t, "out of bounds memory access", parseTrap(trap.ErrorMessage))
+	assert.Equal(t, ErrExecTrapOOB, errorCode(trap))
+	assert.Equal(t, SeverityHigh, chain.classify(trap).Severity)
+}
@@ -0,0 +1,72 @@
+package main
+
+import "fmt"
+
+// outputLimit caps the bytes kept of each stream a module writes, for the
+// whole file and for each invocation
+const outputLimit = 8 << 10
+
+// cappedOutput keeps the start of a stream, counting the bytes dropped
+// once it is full
+type cappedOutput struct {
+	data    []byte
+	dropped int
+}
+
+func (c *cappedOutput) write(data []byte) {
+	n := min(len(data), outputLimit-len(c.data))
+	c.data = append(c.data, data[:n]...)
+	c.dropped += len(data) - n
+}
+
+// String returns the stream, ending with a marker when it was truncated
+func (c *cappedOutput) String() string {
+	if c.dropped == 0 {
+		return string(c.data)
+	}
+	return fmt.Sprintf("%s[... %d bytes truncated]", c.data, c.dropped)
+}
+
+// outputCapture collects what a module writes to stdout and stderr and
+// the messages it logs, over the whole file and since the last invocation.
+// Diagnostics a module prints are often the only clue to why it failed. A
+// nil capture discards everything.
+type outputCapture struct {
+	stdout, stderr, log             cappedOutput
+	callStdout, callStderr, callLog cappedOutput
+}
+
+// write records data written to fd 1 or 2
+func (c *outputCapture) write(fd int, data []byte) {
+	if c == nil {
+		return
+	}
+	switch fd {
+	case 1:
+		c.stdout.write(data)
+		c.callStdout.write(data)
+	case 2:
+		c.stderr.write(data)
+		c.callStderr.write(data)
+	}
+}
+
+// writeLog records a message passed to the host's log import, one per line
+func (c *outputCapture) writeLog(message []byte) {
+	if c == nil {
+		return
+	}
+	line := append(append([]byte(nil), message...), '\n')
+	c.log.write(line)
+	c.callLog.write(line)
+}
+
+// takeCall returns what was written and logged since the last call to it
+func (c *outputCapture) takeCall() (stdout, stderr, log string) {
+	if c == nil {
+		return "", "", ""
+	}
+	stdout, stderr, log = c.callStdout.String(), c.callStderr.String(), c.callLog.String()
+	c.callStdout, c.callStderr, c.callLog = cappedOutput{}, cappedOutput{}, cappedOutput{}
+	return stdout, stderr, log
+}
@@ -0,0 +1,101 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/mrhapile/WASM-Injection-Framework/internal/wasmbin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// printBinary is a WASI binary importing fd_write
+func printBinary() []byte {
+	return pluginBinary(wasmFuncImport{Module: wasiModule, Name: "fd_write", Signature: funcSig("i32 i32 i32 i32", "i32")})
+}
+
+// print writes text to fd through the contract's fd_write import
+func (m *contractModule) print(fd int32, text string) error {
+	data := m.put(text)
+	iov := m.bump(8, 4)[0].(int32)
+	binary.LittleEndian.PutUint32(m.memory[iov:], uint32(data))
+	binary.LittleEndian.PutUint32(m.memory[iov+4:], uint32(len(text)))
+	_, err := m.call("fd_write", fd, iov, int32(1), m.bump(4, 4)[0])
+	return err
+}
+
+// -----------------------------------------------------------------------------
+// TEST: Output Capture
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// A module's own diagnostics, such as an assertion message or a panic
+// backtrace, are often the only clue to why it failed. They have to be
+// reported with the file and with the call that printed them, without a
+// chatty module flooding the report.
+// -----------------------------------------------------------------------------
+
+func TestOutput_CapturedPerInvocation(t *testing.T) {
+	calls := 0
+	result, _ := runWASI(t, printBinary(), map[string]contractExport{
+		"run": func(m *contractModule, args []interface{}) ([]interface{}, error) {
+			calls++
+			if err := m.print(1, "call "+string(rune('0'+calls))+"\n"); err != nil {
+				return nil, err
+			}
+			if calls == 2 {
+				return []interface{}{int32(0)}, m.print(2, "assertion failed: x > 0\n")
+			}
+			return []interface{}{int32(0)}, nil
+		},
+	}, InvocationConfig{Entry: "run", Inputs: []InvocationInput{{}, {}}})
+
+	require.True(t, result.Success, result.ErrorMessage)
+	assert.Equal(t, "call 1\ncall 2\n", result.Stdout)
+	assert.Equal(t, "assertion failed: x > 0\n", result.Stderr)
+	require.Len(t, result.Invocations, 2)
+	assert.Equal(t, "call 1\n", result.Invocations[0].Stdout)
+	assert.Empty(t, result.Invocations[0].Stderr)
+	assert.Equal(t, "call 2\n", result.Invocations[1].Stdout)
+	assert.Equal(t, "assertion failed: x > 0\n", result.Invocations[1].Stderr)
+}
+
+func TestOutput_CapturedWhenStartFails(t *testing.T) {
+	binary, err := parseWasmBinary(printBinary())
+	require.NoError(t, err)
+	_, err = binary.section(sectionExport).appendVectorEntry(wasmbin.AppendU32(append(wasmbin.AppendName(nil, wasiInitializeExport), externFunc), 1))
+	require.NoError(t, err)
+
+	result, _ := runWASI(t, binary.encode(), map[string]contractExport{
+		wasiInitializeExport: func(m *contractModule, args []interface{}) ([]interface{}, error) {
+			if err := m.print(2, "config.toml: no such file\n"); err != nil {
+				return nil, err
+			}
+			return nil, &RuntimeError{Stage: StageExecute, Message: "unreachable"}
+		},
+	}, InvocationConfig{Entry: "run"})
+
+	assert.Equal(t, StageInstantiate, result.FailureStage)
+	assert.Equal(t, "config.toml: no such file\n", result.Stderr, "output of a failed start is kept")
+}
+
+func TestOutput_Truncated(t *testing.T) {
+	var output outputCapture
+	output.write(1, []byte(strings.Repeat("a", outputLimit-2)))
+	output.write(1, []byte("bbbb"))
+	output.write(3, []byte("ignored"))
+
+	stdout, stderr, _ := output.takeCall()
+	assert.Equal(t, strings.Repeat("a", outputLimit-2)+"bb[... 2 bytes truncated]", stdout)
+	assert.Empty(t, stderr)
+	stdout, _, _ = output.takeCall()
+	assert.Empty(t, stdout, "each call starts empty")
+	assert.True(t, strings.HasSuffix(output.stdout.String(), "[... 2 bytes truncated]"))
+
+	var discarded *outputCapture
+	discarded.write(1, []byte("x"))
+}
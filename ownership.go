@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ownersFile is the optional file of a corpus naming the teams owning its
+// files, in the format of CODEOWNERS
+const ownersFile = "OWNERS"
+
+// OwnershipConfig routes the results of a campaign shared by several teams
+// to the teams owning the files
+type OwnershipConfig struct {
+	// File names the owners of files, by default the OWNERS file of the
+	// corpus
+	File string `yaml:"file"`
+	// Reports is a directory written a report per team
+	Reports string `yaml:"reports"`
+	// Notify maps teams to a webhook posted the failures of their files
+	Notify map[string]string `yaml:"notify"`
+}
+
+// check rejects notifications that could never be delivered
+func (c OwnershipConfig) check() error {
+	for team, webhook := range c.Notify {
+		if u, err := url.Parse(webhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("ownership: team %s: invalid webhook %q", team, webhook)
+		}
+	}
+	return nil
+}
+
+// TeamSummary counts the results of the files a team owns
+type TeamSummary struct {
+	Team    string `json:"team"`
+	Passed  int    `json:"passed"`
+	Failed  int    `json:"failed"`
+	Skipped int    `json:"skipped"`
+}
+
+// TeamNotification is posted to the webhook of a team whose files failed
+type TeamNotification struct {
+	TeamSummary
+	// Report is the team's report, when reports are written
+	Report   string        `json:"report,omitempty"`
+	Failures []TeamFailure `json:"failures"`
+}
+
+// TeamFailure is a failed result of a file a team owns
+type TeamFailure struct {
+	FilePath       string          `json:"file_path"`
+	Environment    string          `json:"environment,omitempty"`
+	FailureStage   FailureStage    `json:"failure_stage"`
+	ErrorCode      ErrorCode       `json:"error_code,omitempty"`
+	ErrorMessage   string          `json:"error_message,omitempty"`
+	Classification *Classification `json:"classification,omitempty"`
+}
+
+// ownerRule is a line of an OWNERS file, matching files by name or by the
+// SHA-256 of their content
+type ownerRule struct {
+	pattern string
+	sha256  string
+	owners  []string
+}
+
+// owners are the owner rules of a corpus, nil when it has none
+type owners []ownerRule
+
+// loadOwners reads the owners of a corpus. A corpus without an OWNERS file
+// has no owners, but a configured file must exist.
+func loadOwners(dirPath string, config OwnershipConfig) (owners, error) {
+	path := config.File
+	if path == "" {
+		dir, err := corpusDir(dirPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read directory: %w", err)
+		}
+		path = filepath.Join(dir, ownersFile)
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && config.File == "" {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read owners: %w", err)
+	}
+	return parseOwners(data)
+}
+
+// parseOwners parses the lines of an OWNERS file: a file name pattern, or
+// sha256: followed by a module's hash, then the teams owning the files it
+// matches. Comments start with #.
+func parseOwners(data []byte) (owners, error) {
+	rules := owners{}
+	for i, line := range strings.Split(string(data), "\n") {
+		if comment := strings.IndexByte(line, '#'); comment >= 0 {
+			line = line[:comment]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) == 1 {
+			return nil, fmt.Errorf("owners line %d: %q has no owner", i+1, fields[0])
+		}
+		rule := ownerRule{owners: fields[1:]}
+		if hash, ok := strings.CutPrefix(fields[0], "sha256:"); ok {
+			if decoded, err := hex.DecodeString(hash); err != nil || len(decoded) != 32 {
+				return nil, fmt.Errorf("owners line %d: invalid hash %q", i+1, hash)
+			}
+			rule.sha256 = strings.ToLower(hash)
+		} else {
+			if _, err := filepath.Match(fields[0], ""); err != nil {
+				return nil, fmt.Errorf("owners line %d: invalid pattern %q: %w", i+1, fields[0], err)
+			}
+			rule.pattern = fields[0]
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// find returns the owners of a file. As in CODEOWNERS, the last rule
+// matching it applies, but a rule naming its hash applies before any
+// pattern, since it follows the module whatever the file is called.
+func (o owners) find(filePath string) []string {
+	var hash string
+	for i := len(o) - 1; i >= 0; i-- {
+		if o[i].sha256 == "" {
+			continue
+		}
+		if hash == "" {
+			if hash = fileHash(filePath); hash == "" {
+				break
+			}
+		}
+		if o[i].sha256 == hash {
+			return o[i].owners
+		}
+	}
+	name := filepath.Base(filePath)
+	for i := len(o) - 1; i >= 0; i-- {
+		if o[i].sha256 != "" {
+			continue
+		}
+		if matched, _ := filepath.Match(o[i].pattern, name); matched {
+			return o[i].owners
+		}
+	}
+	return nil
+}
+
+// owns reports whether a team owns the file of a result
+func owns(result ExecutionResult, team string) bool {
+	for _, owner := range result.Owners {
+		if owner == team {
+			return true
+		}
+	}
+	return false
+}
+
+// summarizeOwners counts the results of each team, in order of team
+func summarizeOwners(results []ExecutionResult) []TeamSummary {
+	teams := make(map[string]*TeamSummary)
+	for _, result := range results {
+		for _, team := range result.Owners {
+			summary := teams[team]
+			if summary == nil {
+				summary = &TeamSummary{Team: team}
+				teams[team] = summary
+			}
+			switch {
+			case result.Skipped:
+				summary.Skipped++
+			case result.Success:
+				summary.Passed++
+			default:
+				summary.Failed++
+			}
+		}
+	}
+	return sortedTeams(teams)
+}
+
+func sortedTeams(teams map[string]*TeamSummary) []TeamSummary {
+	var summaries []TeamSummary
+	for _, summary := range teams {
+		summaries = append(summaries, *summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Team < summaries[j].Team })
+	return summaries
+}
+
+// teamReport is the report of the files a team owns, as though the
+// campaign had only run them. Expectations, the quarantine and the cache
+// are the campaign's, so they are left out.
+func teamReport(report FuzzingReport, team string) FuzzingReport {
+	sub := FuzzingReport{
+		SchemaVersion: report.SchemaVersion,
+		Results:       make([]ExecutionResult, 0),
+		FailureCounts: newFailureCounts(),
+		SkipCounts:    newSkipCounts(),
+		Selection:     report.Selection,
+		StopAfter:     report.StopAfter,
+		Shard:         report.Shard,
+		Aborted:       report.Aborted,
+		Config:        report.Config,
+		Team:          team,
+	}
+	for _, result := range report.Results {
+		if owns(result, team) {
+			sub.Results = append(sub.Results, result)
+			countResult(&sub, result)
+		}
+	}
+	sub.TotalFiles = len(sub.Results)
+	sub.CrashBuckets = bucketCrashes(sub.Results)
+	if len(report.Environments) > 0 {
+		environments := make([]Environment, len(report.Environments))
+		for i, env := range report.Environments {
+			environments[i] = env.Environment
+		}
+		pivotByEnvironment(&sub, environments)
+	}
+	return sub
+}
+
+// notifyClient posts team notifications
+var notifyClient = &http.Client{Timeout: 10 * time.Second}
+
+// routeToOwners writes the report of every team owning files, and posts
+// the failures of a team's files to its webhook. Failing to do either is
+// warned about, as the report of the campaign still holds every result.
+func routeToOwners(config OwnershipConfig, report FuzzingReport) {
+	for _, summary := range report.Owners {
+		sub := teamReport(report, summary.Team)
+		var path string
+		if config.Reports != "" {
+			path = filepath.Join(config.Reports, teamFileName(summary.Team)+".json")
+			err := os.MkdirAll(config.Reports, 0o755)
+			if err == nil {
+				err = writeReportFile(path, sub)
+			}
+			if err != nil {
+				emitError(map[string]string{
+					"warning": "failed to write team report",
+					"team":    summary.Team,
+					"details": err.Error(),
+				})
+				path = ""
+			}
+		}
+
+		webhook := config.Notify[summary.Team]
+		if webhook == "" || summary.Failed == 0 {
+			continue
+		}
+		if err := notifyTeam(webhook, teamNotification(summary, path, sub)); err != nil {
+			emitError(map[string]string{
+				"warning": "failed to notify team",
+				"team":    summary.Team,
+				"details": err.Error(),
+			})
+		}
+	}
+}
+
+// teamFileName turns a team, such as @org/codecs, into a file name
+func teamFileName(team string) string {
+	return strings.NewReplacer("/", "-", `\`, "-").Replace(strings.TrimPrefix(team, "@"))
+}
+
+func teamNotification(summary TeamSummary, path string, report FuzzingReport) TeamNotification {
+	notification := TeamNotification{TeamSummary: summary, Report: path, Failures: []TeamFailure{}}
+	for _, result := range report.Results {
+		if result.Skipped || result.Success {
+			continue
+		}
+		notification.Failures = append(notification.Failures, TeamFailure{
+			FilePath:       result.FilePath,
+			Environment:    result.Environment,
+			FailureStage:   result.FailureStage,
+			ErrorCode:      result.ErrorCode,
+			ErrorMessage:   result.ErrorMessage,
+			Classification: result.Classification,
+		})
+	}
+	return notification
+}
+
+func notifyTeam(webhook string, notification TeamNotification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	resp, err := notifyClient.Post(webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
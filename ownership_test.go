@@ -0,0 +1,141 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// -----------------------------------------------------------------------------
+// TEST: Ownership
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// A nightly campaign over a corpus shared by many teams produces one
+// report nobody reads. Each team must get the results of the files it
+// owns, and only those, or failures go unowned.
+// -----------------------------------------------------------------------------
+
+func TestOwners_LastMatchWinsAndHashesFirst(t *testing.T) {
+	dir := t.TempDir()
+	renamed := filepath.Join(dir, "renamed.wasm")
+	require.NoError(t, os.WriteFile(renamed, []byte("codec"), 0o644))
+	sum := sha256.Sum256([]byte("codec"))
+
+	rules, err := parseOwners([]byte(strings.Join([]string{
+		"# Fallback for the whole corpus",
+		"*              @org/fuzzing",
+		"codec_*.wasm   @org/codecs @alice",
+		"sha256:" + strings.ToUpper(hex.EncodeToString(sum[:])) + " @org/codecs",
+		"*.wasm         @org/platform # later rules win",
+		"codec_png.wasm @org/images",
+	}, "\n")))
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"@org/images"}, rules.find(filepath.Join(dir, "codec_png.wasm")))
+	assert.Equal(t, []string{"@org/platform"}, rules.find(filepath.Join(dir, "codec_gif.wasm")))
+	assert.Equal(t, []string{"@org/codecs"}, rules.find(renamed), "a hash follows the module")
+	assert.Equal(t, []string{"@org/fuzzing"}, rules.find(filepath.Join(dir, "notes.txt")))
+	assert.Nil(t, owners(nil).find(renamed))
+
+	_, err = parseOwners([]byte("a.wasm @x\nb.wasm\n"))
+	assert.EqualError(t, err, `owners line 2: "b.wasm" has no owner`)
+	_, err = parseOwners([]byte("sha256:abc @x"))
+	assert.EqualError(t, err, `owners line 1: invalid hash "abc"`)
+	_, err = parseOwners([]byte("[ @x"))
+	assert.Error(t, err)
+
+	_, err = loadOwners(dir, OwnershipConfig{File: filepath.Join(dir, "missing")})
+	assert.Error(t, err, "a configured owners file must exist")
+	rules, err = loadOwners(dir, OwnershipConfig{})
+	assert.NoError(t, err)
+	assert.Nil(t, rules)
+
+	assert.EqualError(t, OwnershipConfig{Notify: map[string]string{"@x": "hooks.example.com"}}.check(), `ownership: team @x: invalid webhook "hooks.example.com"`)
+	assert.NoError(t, OwnershipConfig{Notify: map[string]string{"@x": "https://hooks.example.com/x"}}.check())
+}
+
+func TestOwners_SplitCampaignByTeam(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"codec_gif.wasm", "codec_png.wasm", "parser.wasm", "orphan.wasm"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(name), 0o644))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ownersFile), []byte("codec_*.wasm @codecs\nparser.wasm @parsers @codecs\n"), 0o644))
+	runtime := &MockWasmRuntime{LoadModuleFunc: func(filePath string) (WasmModule, error) {
+		if strings.Contains(filePath, "png") {
+			return nil, &RuntimeError{Stage: StageValidate, Message: "type mismatch"}
+		}
+		return &MockWasmModule{}, nil
+	}}
+
+	var posted []TeamNotification
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var notification TeamNotification
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&notification))
+		posted = append(posted, notification)
+	}))
+	defer server.Close()
+	config := OwnershipConfig{
+		Reports: filepath.Join(t.TempDir(), "teams"),
+		Notify:  map[string]string{"@codecs": server.URL, "@parsers": server.URL},
+	}
+
+	report, err := runFuzzerWithMatrix(dir, []environmentRuntime{{Runtime: runtime}}, RunOptions{Ownership: config})
+	require.NoError(t, err)
+	assert.Equal(t, []TeamSummary{
+		{Team: "@codecs", Passed: 2, Failed: 1},
+		{Team: "@parsers", Passed: 1},
+	}, report.Owners)
+	for _, result := range report.Results {
+		if result.FileName == "orphan.wasm" {
+			assert.Nil(t, result.Owners)
+		}
+	}
+
+	routeToOwners(config, report)
+
+	data, err := os.ReadFile(filepath.Join(config.Reports, "codecs.json"))
+	require.NoError(t, err)
+	var codecs FuzzingReport
+	require.NoError(t, json.Unmarshal(data, &codecs))
+	assert.Equal(t, "@codecs", codecs.Team)
+	assert.Equal(t, 3, codecs.TotalFiles)
+	assert.Equal(t, 1, codecs.Failed)
+	assert.Equal(t, 1, codecs.FailureCounts[StageValidate])
+	assert.FileExists(t, filepath.Join(config.Reports, "parsers.json"))
+
+	require.Len(t, posted, 1, "only teams with failures are notified")
+	assert.Equal(t, "@codecs", posted[0].Team)
+	assert.Equal(t, filepath.Join(config.Reports, "codecs.json"), posted[0].Report)
+	require.Len(t, posted[0].Failures, 1)
+	assert.Equal(t, "codec_png.wasm", filepath.Base(posted[0].Failures[0].FilePath))
+	assert.Equal(t, StageValidate, posted[0].Failures[0].FailureStage)
+}
+
+func TestOwners_DeliveryFailuresAreWarnings(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	report := FuzzingReport{
+		Results: []ExecutionResult{{FilePath: "a.wasm", FailureStage: StageLoad, Owners: []string{"@a"}}},
+		Owners:  []TeamSummary{{Team: "@a", Failed: 1}},
+	}
+
+	output := captureStderr(t, func() {
+		routeToOwners(OwnershipConfig{Notify: map[string]string{"@a": server.URL}}, report)
+	})
+	assert.Contains(t, string(output), "webhook returned 503 Service Unavailable")
+}
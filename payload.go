@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"unicode/utf8"
+)
+
+// Payload formats for argument fuzzing
+const (
+	// PayloadJSON mutates buffer inputs as JSON documents
+	PayloadJSON = "json"
+	// PayloadProtobuf mutates buffer inputs as protobuf wire-format messages
+	PayloadProtobuf = "protobuf"
+)
+
+// maxPayloadDepth bounds the nesting of generated and mutated payload
+// values, so documents stay small
+const maxPayloadDepth = 4
+
+// emptyPayload is the seed used when no inputs are configured: an empty
+// JSON object or an empty protobuf message
+func emptyPayload(format string) WasmValue {
+	if format == PayloadJSON {
+		return WasmValue{Type: "string", Value: "{}"}
+	}
+	return WasmValue{Type: "bytes", Value: ""}
+}
+
+// payloadMutator mutates the buffer arguments of an entry as structured
+// payloads, passing other arguments through unchanged. Mutations keep the
+// document well-formed, except for occasional byte-level damage that
+// exercises the guest's parser.
+type payloadMutator struct {
+	*witMutator
+	format string
+}
+
+// newPayloadMutator checks that every input has a buffer argument holding
+// a well-formed payload of the configured format
+func newPayloadMutator(config ArgFuzzConfig, plan InvocationConfig, calls [][]interface{}) (*payloadMutator, error) {
+	fail := func(format string, args ...interface{}) (*payloadMutator, error) {
+		return nil, &RuntimeError{Stage: StageSignature, Message: "payload fuzzing: " + fmt.Sprintf(format, args...)}
+	}
+	switch config.Payload {
+	case PayloadJSON:
+	case PayloadProtobuf:
+		// Protobuf messages routinely contain NULs
+		if plan.Buffers.withDefaults().Convention == ConventionNulTerminated {
+			return fail("protobuf payloads need a length, which the %s convention does not pass", ConventionNulTerminated)
+		}
+	default:
+		return fail("unknown payload format %q", config.Payload)
+	}
+	if plan.function != nil {
+		return fail("'%s' has WIT interface types; its arguments are fuzzed by value", plan.Entry)
+	}
+
+	m := &payloadMutator{witMutator: newWITMutator(config.Seed, calls), format: config.Payload}
+	for i, args := range calls {
+		if !hasBuffers(args) {
+			return fail("input %d has no string, bytes or file argument", i)
+		}
+		for _, arg := range args {
+			if buffer, ok := arg.(bufferArg); ok {
+				if err := m.check(buffer.data); err != nil {
+					return fail("input %d is not a valid %s payload: %v", i, m.format, err)
+				}
+			}
+		}
+	}
+	return m, nil
+}
+
+// check parses a payload in the mutator's format
+func (m *payloadMutator) check(data []byte) error {
+	if m.format == PayloadJSON {
+		_, err := parseJSONPayload(data)
+		return err
+	}
+	_, err := parseProtoMessage(data)
+	return err
+}
+
+// next implements argumentSource.next, with one buffer argument mutated
+func (m *payloadMutator) next() []interface{} {
+	var base []interface{}
+	if m.favored != nil && m.rng.Intn(2) == 0 {
+		base = m.favored
+	} else {
+		base = m.corpus[m.rng.Intn(len(m.corpus))]
+	}
+
+	input := append([]interface{}(nil), base...)
+	var buffers []int
+	for i, arg := range input {
+		if _, ok := arg.(bufferArg); ok {
+			buffers = append(buffers, i)
+		}
+	}
+	i := buffers[m.rng.Intn(len(buffers))]
+	data := m.mutatePayload(input[i].(bufferArg).data)
+	input[i] = bufferArg{source: m.payloadValue(data), data: data}
+	return input
+}
+
+// mutatePayload derives a new payload from data. Payloads that no longer
+// parse, because earlier byte-level damage was kept in the corpus, are
+// damaged further.
+func (m *payloadMutator) mutatePayload(data []byte) []byte {
+	if m.rng.Intn(8) != 0 {
+		switch m.format {
+		case PayloadJSON:
+			if doc, err := parseJSONPayload(data); err == nil {
+				return appendJSON(nil, m.mutateJSON(doc, 0))
+			}
+		case PayloadProtobuf:
+			if fields, err := parseProtoMessage(data); err == nil {
+				return appendProtoMessage(nil, m.mutateProto(fields, 0))
+			}
+		}
+	}
+	return m.mutateBytes(data)
+}
+
+// payloadValue reports a payload as a replayable input: JSON text as a
+// string where possible, and everything else as hex bytes
+func (m *payloadMutator) payloadValue(data []byte) WasmValue {
+	if m.format == PayloadJSON && utf8.Valid(data) {
+		return WasmValue{Type: "string", Value: string(data)}
+	}
+	return WasmValue{Type: "bytes", Value: hex.EncodeToString(data)}
+}
+
+// mutateBytes flips a bit, overwrites, removes or duplicates a range,
+// truncates, or splices in a string from the module
+func (m *payloadMutator) mutateBytes(data []byte) []byte {
+	out := append([]byte(nil), data...)
+	op := m.rng.Intn(6)
+	if len(out) == 0 {
+		op = 5
+	}
+	switch op {
+	case 0:
+		out[m.rng.Intn(len(out))] ^= 1 << uint(m.rng.Intn(8))
+	case 1:
+		out[m.rng.Intn(len(out))] = byte(m.rng.Intn(256))
+	case 2:
+		out = out[:m.rng.Intn(len(out))]
+	case 3:
+		i := m.rng.Intn(len(out))
+		j := i + m.rng.Intn(len(out)-i) + 1
+		out = append(out[:i], out[j:]...)
+	case 4:
+		i := m.rng.Intn(len(out))
+		j := i + m.rng.Intn(len(out)-i) + 1
+		out = append(out[:j], append(append([]byte(nil), out[i:j]...), out[j:]...)...)
+	default:
+		i := m.rng.Intn(len(out) + 1)
+		out = append(out[:i], append([]byte(m.text()), out[i:]...)...)
+	}
+	return out
+}
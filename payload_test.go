@@ -0,0 +1,206 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// payloadModule is a heap module whose "handle" export takes a ptr-len
+// payload and traps when check rejects it
+func payloadModule(check func(payload []byte) bool) func() *heapMockModule {
+	return func() *heapMockModule {
+		signatures := map[string]FuncSignature{"handle": {Params: []string{"i32", "i32"}, Results: []string{"i32"}}}
+		for name, sig := range mallocExports {
+			signatures[name] = sig
+		}
+		module := newHeapMockModule(signatures)
+		allocate := module.ExecuteFunc
+		module.ExecuteFunc = func(funcName string, args ...interface{}) ([]interface{}, error) {
+			if funcName != "handle" {
+				return allocate(funcName, args...)
+			}
+			ptr, length := args[0].(int32), args[1].(int32)
+			if !check(module.memory[ptr : ptr+length]) {
+				return nil, errors.New("unreachable")
+			}
+			return []interface{}{int32(0)}, nil
+		}
+		return module
+	}
+}
+
+// runPayloadFuzz fuzzes a payload module, loading a fresh instance per input
+func runPayloadFuzz(newModule func() *heapMockModule, plan InvocationConfig, config ArgFuzzConfig) ExecutionResult {
+	mockRuntime := &MockWasmRuntime{
+		LoadModuleFunc: func(filePath string) (WasmModule, error) { return newModule(), nil },
+	}
+	plan.Entry = "handle"
+	return processWasmFileWithOptions("/test/payload.wasm", mockRuntime, RunOptions{Invocation: plan, ArgFuzz: config})
+}
+
+// -----------------------------------------------------------------------------
+// TEST: Payload Fuzzing
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Plugin ABIs hand their guests a serialized request rather than scalars.
+// Random bytes are rejected by the guest's decoder before reaching any
+// interesting logic, so payloads must be mutated as documents: a changed
+// field value or a duplicated key gets past the decoder and into the code
+// that handles it.
+// -----------------------------------------------------------------------------
+
+func TestPayload_JSONRoundTripsExactly(t *testing.T) {
+	doc := `{"b":1,"a":[true,null,"<x>\u0000"],"b":-2.5e3,"c":{}}`
+
+	value, err := parseJSONPayload([]byte(" " + doc + "\n"))
+	require.NoError(t, err)
+	assert.Equal(t, doc, string(appendJSON(nil, value)), "member order and duplicate keys are kept")
+
+	_, err = parseJSONPayload([]byte(`{"a": 1} {}`))
+	assert.EqualError(t, err, "unexpected data after the document")
+	_, err = parseJSONPayload(nil)
+	assert.EqualError(t, err, "empty document")
+	_, err = parseJSONPayload([]byte(`{"a": }`))
+	assert.Error(t, err)
+}
+
+func TestPayload_ProtobufRoundTripsExactly(t *testing.T) {
+	// 1: varint 150, 2: "hi", 3: fixed64, 4: fixed32, 5: nested {1: 1}
+	msg, _ := hex.DecodeString("089601" + "12026869" + "190100000000000000" + "25ffffffff" + "2a020801")
+
+	fields, err := parseProtoMessage(msg)
+	require.NoError(t, err)
+	require.Len(t, fields, 5)
+	assert.Equal(t, protoField{Number: 1, WireType: protoVarint, Value: 150}, fields[0])
+	assert.Equal(t, "hi", string(fields[1].Bytes))
+	assert.Equal(t, uint64(0xffffffff), fields[3].Value)
+	assert.Equal(t, msg, appendProtoMessage(nil, fields))
+
+	tests := []struct {
+		hex, message string
+	}{
+		{"0896", "truncated message"},
+		{"1205", "truncated message"},
+		{"0001", "invalid field number 0"},
+		{"0b", "field 1 has unsupported wire type 3"},
+	}
+	for _, tt := range tests {
+		data, _ := hex.DecodeString(tt.hex)
+		_, err := parseProtoMessage(data)
+		assert.EqualError(t, err, tt.message, tt.hex)
+	}
+}
+
+func TestPayload_MutationsAreMostlyWellFormed(t *testing.T) {
+	for _, format := range []string{PayloadJSON, PayloadProtobuf} {
+		seed := []byte(`{"user":{"name":"x","roles":["a"]},"n":3}`)
+		if format == PayloadProtobuf {
+			seed, _ = hex.DecodeString("0a050a01781001" + "1003")
+		}
+		calls := [][]interface{}{{bufferArg{data: seed}, int32(7)}}
+		m, err := newPayloadMutator(ArgFuzzConfig{Payload: format, Seed: 5}, InvocationConfig{}, calls)
+		require.NoError(t, err)
+
+		valid := 0
+		for i := 0; i < 1000; i++ {
+			input := m.next()
+			assert.Equal(t, int32(7), input[1], "non-buffer arguments pass through")
+
+			buffer := input[0].(bufferArg)
+			decoded, err := decodeBuffer(buffer.source)
+			require.NoError(t, err)
+			assert.Equal(t, string(buffer.data), string(decoded.data), "reported payloads replay exactly")
+			if m.check(buffer.data) == nil {
+				valid++
+			}
+		}
+		assert.Greater(t, valid, 800, format)
+	}
+}
+
+func TestPayload_SameSeedSameSequence(t *testing.T) {
+	calls := [][]interface{}{{bufferArg{data: []byte(`[1, {"k": "v"}]`)}}}
+	a, err := newPayloadMutator(ArgFuzzConfig{Payload: PayloadJSON, Seed: 11}, InvocationConfig{}, calls)
+	require.NoError(t, err)
+	b, _ := newPayloadMutator(ArgFuzzConfig{Payload: PayloadJSON, Seed: 11}, InvocationConfig{}, calls)
+
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, encodeValues(a.next()), encodeValues(b.next()))
+	}
+}
+
+func TestPayload_FindsJSONFailure(t *testing.T) {
+	// The guest rejects admin requests, but only for documents it can decode
+	newModule := payloadModule(func(payload []byte) bool {
+		var request struct{ Admin bool }
+		return json.Unmarshal(payload, &request) != nil || !request.Admin
+	})
+	plan := InvocationConfig{Inputs: []InvocationInput{{{Type: "string", Value: `{"admin": false, "user": "x"}`}}}}
+
+	result := runPayloadFuzz(newModule, plan, ArgFuzzConfig{Iterations: 500, Seed: 1, Reload: true, Payload: PayloadJSON})
+
+	require.NotNil(t, result.ArgFuzz)
+	assert.Equal(t, PayloadJSON, result.ArgFuzz.Payload)
+	require.Len(t, result.ArgFuzz.UniqueFailures, 1)
+	failure := result.ArgFuzz.UniqueFailures[0]
+	assert.Equal(t, "string", failure.Args[0].Type)
+	assert.Contains(t, failure.Args[0].Value, `"admin":true`)
+	assert.Nil(t, failure.Correlation)
+	assert.Equal(t, StageExecute, result.FailureStage)
+}
+
+func TestPayload_FindsProtobufFailure(t *testing.T) {
+	// The guest overflows on a quantity (field 2) above 1000
+	newModule := payloadModule(func(payload []byte) bool {
+		fields, err := parseProtoMessage(payload)
+		for _, field := range fields {
+			if err == nil && field.Number == 2 && field.WireType == protoVarint && field.Value > 1000 {
+				return false
+			}
+		}
+		return true
+	})
+
+	result := runPayloadFuzz(newModule, InvocationConfig{}, ArgFuzzConfig{Iterations: 2000, Seed: 2, Reload: true, Payload: PayloadProtobuf})
+
+	require.NotNil(t, result.ArgFuzz)
+	require.Len(t, result.ArgFuzz.UniqueFailures, 1, "an empty message seeds fuzzing without inputs")
+	failure := result.ArgFuzz.UniqueFailures[0]
+	assert.Equal(t, "bytes", failure.Args[0].Type)
+
+	replay := InvocationConfig{Inputs: []InvocationInput{{failure.Args[0]}}}
+	result = runPayloadFuzz(newModule, replay, ArgFuzzConfig{})
+	assert.Equal(t, "execution failed: unreachable", result.ErrorMessage)
+}
+
+func TestPayload_ConfigErrors(t *testing.T) {
+	newModule := payloadModule(func([]byte) bool { return true })
+	tests := []struct {
+		plan    InvocationConfig
+		payload string
+		message string
+	}{
+		{InvocationConfig{}, "xml", `payload fuzzing: unknown payload format "xml"`},
+		{InvocationConfig{Inputs: []InvocationInput{i32Input(1, 2)}}, PayloadJSON, "payload fuzzing: input 0 has no string, bytes or file argument"},
+		{InvocationConfig{Inputs: []InvocationInput{{{Type: "string", Value: "{"}}}}, PayloadJSON, "payload fuzzing: input 0 is not a valid json payload"},
+	}
+	for _, tt := range tests {
+		result := runPayloadFuzz(newModule, tt.plan, ArgFuzzConfig{Iterations: 10, Payload: tt.payload})
+		assert.Equal(t, StageSignature, result.FailureStage, tt.message)
+		assert.Contains(t, result.ErrorMessage, tt.message, "the decoder's own words vary across Go versions")
+		assert.Nil(t, result.ArgFuzz)
+	}
+
+	calls := [][]interface{}{{bufferArg{}}}
+	_, err := newPayloadMutator(ArgFuzzConfig{Payload: PayloadProtobuf}, InvocationConfig{Buffers: MemoryConfig{Convention: ConventionNulTerminated}}, calls)
+	assert.EqualError(t, err, "signature: payload fuzzing: protobuf payloads need a length, which the nul-terminated convention does not pass")
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultPermuteMemoryLimits are the memory limits, in pages, tried when
+// the base environment has none
+var defaultPermuteMemoryLimits = []uint{1, 256}
+
+// OptionVariant is the outcome of a file under the base environment with
+// one option changed
+type OptionVariant struct {
+	// Option names the change, such as "backend=aot", "+threads",
+	// "-tail-call" or "memory=256p"
+	Option      string `json:"option"`
+	Environment string `json:"environment"`
+	// Signature identifies how the file failed, empty when it passed
+	Signature string `json:"signature,omitempty"`
+	// Flips is set when the outcome differs from the base environment's
+	Flips bool `json:"flips"`
+	// Error is set when the variant could not be run
+	Error string `json:"error,omitempty"`
+}
+
+// PermuteReport lists which runtime options change how a file fails
+type PermuteReport struct {
+	FilePath    string `json:"file_path"`
+	Environment string `json:"environment"`
+	// Signature is how the file fails under the base environment, empty
+	// when it passes
+	Signature string          `json:"signature,omitempty"`
+	Variants  []OptionVariant `json:"variants"`
+	// Flips names the options that change the outcome
+	Flips []string `json:"flips"`
+}
+
+// optionVariants returns the environments that change one option of base:
+// the other backend, each non-default proposal toggled, and the memory
+// limit removed or, when there is none, set to each of limits
+func optionVariants(base Environment, limits []uint) ([]string, []Environment) {
+	var options []string
+	var envs []Environment
+	add := func(option string, env Environment) {
+		sort.Strings(env.Proposals)
+		env.Name = env.describe()
+		options, envs = append(options, option), append(envs, env)
+	}
+	with := func(change func(env *Environment)) Environment {
+		env := base
+		env.Proposals = append([]string(nil), base.Proposals...)
+		change(&env)
+		return env
+	}
+
+	backend := BackendAOT
+	if base.Backend == BackendAOT {
+		backend = BackendInterpreter
+	}
+	add("backend="+backend, with(func(env *Environment) { env.Backend = backend }))
+
+	var proposals []string
+	for proposal := range knownProposals {
+		if !defaultProposals[proposal] {
+			proposals = append(proposals, proposal)
+		}
+	}
+	sort.Strings(proposals)
+	for _, proposal := range proposals {
+		if containsString(base.Proposals, proposal) {
+			add("-"+proposal, with(func(env *Environment) {
+				env.Proposals = env.Proposals[:0]
+				for _, p := range base.Proposals {
+					if p != proposal {
+						env.Proposals = append(env.Proposals, p)
+					}
+				}
+			}))
+		} else {
+			add("+"+proposal, with(func(env *Environment) { env.Proposals = append(env.Proposals, proposal) }))
+		}
+	}
+
+	if base.MemoryLimitPages > 0 {
+		add("memory=unlimited", with(func(env *Environment) { env.MemoryLimitPages = 0 }))
+	} else {
+		for _, limit := range limits {
+			limit := limit
+			add(fmt.Sprintf("memory=%dp", limit), with(func(env *Environment) { env.MemoryLimitPages = limit }))
+		}
+	}
+	return options, envs
+}
+
+// permuteOptions runs a file under the base environment and every variant
+// of it, classifying each outcome
+func permuteOptions(filePath string, base Environment, limits []uint, opts RunOptions, classifiers classifierChain) PermuteReport {
+	outcome := func(env Environment) (string, error) {
+		runtime, err := newRuntime(env)
+		if err != nil {
+			return "", err
+		}
+		defer closeRuntimes([]environmentRuntime{{Environment: env, Runtime: runtime}})
+		result := processWasmFileWithOptions(filePath, runtime, opts)
+		result.Classification = classifiers.classify(result)
+		return outcomeSignature(result), nil
+	}
+
+	report := PermuteReport{FilePath: filePath, Environment: base.describe(), Flips: []string{}}
+	var err error
+	if report.Signature, err = outcome(base); err != nil {
+		report.Signature = "error: " + err.Error()
+	}
+	options, envs := optionVariants(base, limits)
+	for i, env := range envs {
+		variant := OptionVariant{Option: options[i], Environment: env.Name}
+		signature, err := outcome(env)
+		if err != nil {
+			variant.Error = err.Error()
+		} else {
+			variant.Signature = signature
+			variant.Flips = signature != report.Signature
+		}
+		if variant.Flips {
+			report.Flips = append(report.Flips, variant.Option)
+		}
+		report.Variants = append(report.Variants, variant)
+	}
+	return report
+}
+
+// parsePageList parses a comma-separated list of page counts
+func parsePageList(s string) ([]uint, error) {
+	var pages []uint
+	for _, field := range strings.Split(s, ",") {
+		n, err := strconv.ParseUint(strings.TrimSpace(field), 10, 32)
+		if err != nil || n == 0 {
+			return nil, fmt.Errorf("invalid page count %q", field)
+		}
+		pages = append(pages, uint(n))
+	}
+	return pages, nil
+}
+
+// runPermuteCommand reruns a file under its environment with each runtime
+// option changed in turn, writing which changes flip its outcome
+func runPermuteCommand(args []string) int {
+	flags := flag.NewFlagSet("permute", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	configPath := flags.String("config", "", "YAML campaign config")
+	memoryLimits := flags.String("memory-limits", "", "comma-separated memory limits in pages to try, such as 1,256")
+
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		emitError(map[string]string{
+			"error": "usage: wasm-fuzzer permute [--config file.yaml] [--memory-limits pages,...] <file.wasm>",
+		})
+		return 1
+	}
+	filePath := flags.Arg(0)
+	if _, err := os.Stat(filePath); err != nil {
+		emitError(map[string]string{
+			"error":   "module access failed",
+			"details": err.Error(),
+		})
+		return 1
+	}
+	limits := defaultPermuteMemoryLimits
+	if *memoryLimits != "" {
+		var err error
+		if limits, err = parsePageList(*memoryLimits); err != nil {
+			emitError(map[string]string{
+				"error":   "invalid memory limits",
+				"details": err.Error(),
+			})
+			return 1
+		}
+	}
+
+	config, err := resolveConfig(*configPath)
+	if err != nil {
+		emitError(map[string]string{
+			"error":   "config load failed",
+			"details": err.Error(),
+		})
+		return 1
+	}
+	envs, err := config.Matrix.Environments()
+	if err != nil {
+		emitError(map[string]string{
+			"error":   "invalid environment matrix",
+			"details": err.Error(),
+		})
+		return 1
+	}
+	classifiers, err := newClassifierChain(config.Classifiers)
+	if err != nil {
+		emitError(map[string]string{
+			"error":   "invalid classifiers",
+			"details": err.Error(),
+		})
+		return 1
+	}
+
+	// The options of the first environment of the matrix are permuted.
+	// Coverage would change the environment under test, so it is off.
+	opts := config.runOptions()
+	opts.Coverage = CoverageConfig{}
+	report := permuteOptions(filePath, envs[0], limits, opts, classifiers)
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(report)
+	return 0
+}
@@ -0,0 +1,98 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// -----------------------------------------------------------------------------
+// TEST: Option Permutation
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// A failure that only shows under the AOT backend, or goes away with a
+// proposal enabled, is a different bug from one that shows everywhere.
+// Changing one runtime option at a time and reporting the changes that
+// flip the outcome tells which part of the runtime to look at.
+// -----------------------------------------------------------------------------
+
+func TestOptionVariants_ChangeOneOptionEach(t *testing.T) {
+	options, envs := optionVariants(Environment{Proposals: []string{"threads"}}, []uint{16})
+
+	require.Equal(t, len(options), len(envs))
+	assert.Equal(t, "backend=aot", options[0])
+	assert.Equal(t, BackendAOT, envs[0].Backend)
+	assert.Equal(t, []string{"threads"}, envs[0].Proposals, "only the backend changes")
+
+	assert.Contains(t, options, "-threads")
+	assert.Contains(t, options, "+tail-call")
+	assert.NotContains(t, options, "+simd", "default proposals cannot be toggled")
+	for i, option := range options {
+		switch option {
+		case "-threads":
+			assert.Empty(t, envs[i].Proposals)
+		case "+tail-call":
+			assert.Equal(t, []string{"tail-call", "threads"}, envs[i].Proposals)
+			assert.Equal(t, "proposals=tail-call+threads", envs[i].Name)
+		}
+	}
+	assert.Equal(t, "memory=16p", options[len(options)-1])
+	assert.EqualValues(t, 16, envs[len(envs)-1].MemoryLimitPages)
+
+	options, _ = optionVariants(Environment{MemoryLimitPages: 8, Backend: BackendAOT}, []uint{16})
+	assert.Equal(t, "backend=interpreter", options[0])
+	assert.Equal(t, "memory=unlimited", options[len(options)-1])
+}
+
+func TestPermuteOptions_ReportsFlippingOptions(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "grow.wasm")
+	require.NoError(t, os.WriteFile(filePath, []byte{0}, 0o644))
+	original := newRuntime
+	defer func() { newRuntime = original }()
+	newRuntime = func(env Environment) (WasmRuntime, error) {
+		if containsString(env.Proposals, "memory64") {
+			return nil, errors.New(`proposal "memory64" is not supported`)
+		}
+		return &MockWasmRuntime{LoadModuleFunc: func(string) (WasmModule, error) {
+			return &MockWasmModule{ExecuteFunc: func(string, ...interface{}) ([]interface{}, error) {
+				// The bug only shows in AOT code, and a tight memory
+				// limit stops the module before it gets there
+				if env.Backend == BackendAOT && env.MemoryLimitPages != 1 {
+					return nil, errors.New("out of bounds memory access")
+				}
+				return []interface{}{int32(0)}, nil
+			}}, nil
+		}}, nil
+	}
+
+	chain, err := newClassifierChain(nil)
+	require.NoError(t, err)
+	report := permuteOptions(filePath, Environment{Backend: BackendAOT}, []uint{1, 256}, RunOptions{}, chain)
+
+	assert.Equal(t, "backend=aot", report.Environment)
+	assert.Equal(t, "execute:out of bounds memory access", report.Signature)
+	assert.Equal(t, []string{"backend=interpreter", "memory=1p"}, report.Flips)
+	for _, variant := range report.Variants {
+		if variant.Option == "+memory64" {
+			assert.Equal(t, `proposal "memory64" is not supported`, variant.Error)
+			assert.False(t, variant.Flips)
+		}
+	}
+}
+
+func TestParsePageList(t *testing.T) {
+	pages, err := parsePageList("1, 16,1024")
+	require.NoError(t, err)
+	assert.Equal(t, []uint{1, 16, 1024}, pages)
+
+	_, err = parsePageList("1,0")
+	assert.EqualError(t, err, `invalid page count "0"`)
+}
@@ -0,0 +1,968 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// RuntimeError represents an error from the WASM runtime
+type RuntimeError struct {
+	Stage FailureStage
+	// SubStage optionally narrows down where in Stage the failure happened
+	SubStage string
+	Message  string
+	Cause    error
+}
+
+func (e *RuntimeError) Error() string {
+	if e.Cause != nil {
+		return fmt.Sprintf("%s: %s: %v", e.Stage, e.Message, e.Cause)
+	}
+	return fmt.Sprintf("%s: %s", e.Stage, e.Message)
+}
+
+// WasmRuntime defines the interface for WASM runtime operations
+// This abstraction enables fault injection via mocking in tests
+type WasmRuntime interface {
+	// LoadModule loads a WASM module from the given file path
+	LoadModule(filePath string) (WasmModule, error)
+}
+
+// RuntimeCloser is implemented by runtimes keeping objects across files,
+// which Close releases once the campaign is over
+type RuntimeCloser interface {
+	Close()
+}
+
+// closeRuntimes releases what the environments' runtimes keep across files
+func closeRuntimes(envs []environmentRuntime) {
+	for _, env := range envs {
+		if closer, ok := env.Runtime.(RuntimeCloser); ok {
+			closer.Close()
+		}
+	}
+}
+
+// WasmModule represents a loaded and instantiated WASM module
+type WasmModule interface {
+	// Execute runs the named function with the given arguments
+	Execute(funcName string, args ...interface{}) ([]interface{}, error)
+	// Close releases runtime resources
+	Close()
+}
+
+// RunOptions carries campaign-wide settings through the pipeline
+type RunOptions struct {
+	Invocation InvocationConfig
+	ArgFuzz    ArgFuzzConfig
+	Coverage   CoverageConfig
+	Corpus     CorpusConfig
+	// StopAfter ends the pipeline after the load, validate or instantiate
+	// stage, without executing anything
+	StopAfter FailureStage
+	// TrackMemory samples RSS and live runtime objects after every file
+	TrackMemory bool
+	// DebugResources reports the runtime objects each file leaked or
+	// released twice, with where they were created
+	DebugResources bool
+	// HangTimeout is how long a file may make no progress before it is
+	// reported, or abandoned as a hang when isolated
+	HangTimeout time.Duration
+	// WorkerArgs isolates the campaign when set: each environment's files
+	// run in a campaign-worker subprocess given these fuzz arguments
+	WorkerArgs []string
+	// LargeModules runs modules above a size in large-module workers given
+	// CampaignArgs, the campaign's fuzz arguments, when both are set
+	LargeModules LargeModuleConfig
+	CampaignArgs []string
+	// Restart paces the restarts of isolated workers that die before
+	// running their file
+	Restart RestartConfig
+	// Sanitizer sets up the environment of isolated workers
+	Sanitizer SanitizerConfig
+	// Crashes keeps the modules and core dumps of crashed workers
+	Crashes CrashConfig
+	// MemoryPressure starves isolated workers of memory during stages
+	MemoryPressure MemoryPressureConfig
+	// Redaction caps and scrubs the error messages of results
+	Redaction RedactionConfig
+	// Classifiers bucket failures ahead of the default classifier
+	Classifiers []ClassifierRule
+	// DataSegments are planted in a copy of each module before it is run
+	DataSegments []DataSegmentConfig
+	// Tamper overrides globals and table slots in a copy of each module
+	Tamper TamperConfig
+	// Chaos schedules host call faults over the campaign
+	Chaos ChaosConfig
+	// CompareClean runs every file a second time without injections, and
+	// reports how the two runs differ
+	CompareClean bool
+	// Quarantine reruns failed files and sets apart those that are flaky
+	Quarantine QuarantineConfig
+	// Cache reuses the results of files run by earlier campaigns
+	Cache CacheConfig
+	// Taint follows host-written data to the sinks it reaches
+	Taint TaintConfig
+	// Intercept routes calls inside modules through a hook
+	Intercept InterceptConfig
+	// Sequence fuzzes sequences of export calls instead of the entry
+	Sequence SequenceConfig
+	// Properties are checked over generated arguments instead of calling
+	// the entry
+	Properties []PropertyConfig
+	// Determinism runs every file this many times and compares the runs
+	Determinism int
+	// FloatComparison sets when float results of compared runs are equal
+	FloatComparison FloatComparison
+	// MaxFailures aborts the campaign once this many results failed, and
+	// CircuitBreaker once too many of the latest results did
+	MaxFailures    int
+	CircuitBreaker CircuitBreakerConfig
+	// MaxDuration time-boxes the campaign, which runs first the files
+	// History says are most likely to fail
+	MaxDuration time.Duration
+	History     string
+	// Heartbeat reports the campaign's progress to orchestrators
+	Heartbeat HeartbeatConfig
+	// Hooks run as each file goes through the pipeline, and Middleware
+	// over each result before it is reported. They are code the cache
+	// cannot see, so changing them keeps cached results.
+	Hooks      []Hooks            `json:"-"`
+	Middleware []ResultMiddleware `json:"-"`
+	// Ownership only assigns results to teams once they are run
+	Ownership OwnershipConfig `json:"-"`
+	// chaos is the profile of the file being run, set per file
+	chaos *ChaosProfile
+}
+
+// processWasmFileWithRuntime processes a WASM file using the provided runtime
+// It never panics - all errors are captured and returned in the result
+func processWasmFileWithRuntime(filePath string, runtime WasmRuntime) ExecutionResult {
+	return processWasmFileWithOptions(filePath, runtime, RunOptions{})
+}
+
+// processWasmFileWithOptions processes a WASM file with campaign options
+func processWasmFileWithOptions(filePath string, runtime WasmRuntime, opts RunOptions) (result ExecutionResult) {
+	result.SchemaVersion = SchemaVersion
+	result.FilePath = filePath
+	result.FileName = filepath.Base(filePath)
+	result.FailureStage = StageNone
+
+	span := tracer.Start("process_file")
+	span.SetAttribute("wasm.file.path", filePath)
+
+	// Defer panic recovery to ensure we never crash
+	hooks := hookChain(opts.Hooks)
+	defer func() {
+		if r := recover(); r != nil {
+			result.Success = false
+			result.FailureStage = StageExecute
+			result.ErrorMessage = fmt.Sprintf("panic recovered: %v", r)
+		}
+		if !result.Success {
+			hooks.onFailure(&result)
+		}
+		span.SetAttribute("wasm.failure_stage", string(result.FailureStage))
+		if result.Success {
+			span.End(nil)
+		} else {
+			span.End(errors.New(result.ErrorMessage))
+		}
+	}()
+
+	// The chaos a file runs under is reported even when it fails before
+	// any host call
+	if opts.chaos != nil {
+		profile := *opts.chaos
+		result.Chaos = &profile
+	}
+
+	if err := hooks.beforeLoad(filePath); err != nil {
+		result.FailureStage, result.ErrorMessage = classifyError(err, StageLoad, "hook")
+		result.FailureSubStage = failureSubStage(err)
+		return result
+	}
+	defer hooks.watchValidation(filePath)()
+
+	// Every stage runs the copy of the module with the configured data
+	// segments planted and globals and tables tampered with
+	if len(opts.DataSegments) > 0 {
+		injected, cleanup, err := stageModule(filePath, func(data []byte) ([]byte, error) {
+			return injectDataSegments(data, opts.DataSegments)
+		})
+		if err != nil {
+			result.FailureStage, result.ErrorMessage = StageLoad, "data segment injection failed: "+err.Error()
+			result.FailureSubStage = SubStageDataSegments
+			return result
+		}
+		defer cleanup()
+		filePath = injected
+	}
+	if opts.Tamper.enabled() {
+		tampered, cleanup, err := stageModule(filePath, func(data []byte) (tampered []byte, err error) {
+			tampered, result.Tampering, err = opts.Tamper.tamper(data)
+			return tampered, err
+		})
+		if err != nil {
+			result.FailureStage, result.ErrorMessage = StageLoad, "tampering failed: "+err.Error()
+			result.FailureSubStage = SubStageTamper
+			return result
+		}
+		defer cleanup()
+		filePath = tampered
+	}
+
+	// Loading and validating need none of the harness around the runtime
+	if opts.StopAfter == StageLoad || opts.StopAfter == StageValidate {
+		if err := runTruncated(filePath, runtime, opts.StopAfter); err != nil {
+			result.FailureStage, result.ErrorMessage = classifyError(err, StageLoad, "load failed")
+			return result
+		}
+		result.Success = true
+		return result
+	}
+
+	plan := opts.Invocation.withDefaults()
+	if opts.ArgFuzz.Iterations > 0 && opts.ArgFuzz.Payload != "" && len(opts.Invocation.Inputs) == 0 {
+		plan.Inputs = []InvocationInput{{emptyPayload(opts.ArgFuzz.Payload)}}
+	}
+	if err := plan.loadInterface(filePath, len(opts.Invocation.Inputs) == 0); err != nil {
+		result.Success = false
+		result.FailureStage, result.ErrorMessage = classifyError(err, StageSignature, "wit")
+		return result
+	}
+	if opts.ArgFuzz.Iterations > 0 {
+		if err := plan.loadAnnotations(filePath); err != nil {
+			result.Success = false
+			result.FailureStage, result.ErrorMessage = classifyError(err, StageSignature, "annotations")
+			return result
+		}
+	}
+
+	// What the module prints is often the only clue to why it failed
+	output := &outputCapture{}
+	defer func() {
+		result.Stdout, result.Stderr, result.Log = output.stdout.String(), output.stderr.String(), output.log.String()
+	}()
+
+	// Taint hooks are linked right above the runtime, so nothing wrapping
+	// host functions sees them
+	if opts.Taint.Enabled {
+		taint := newTaintRuntime(runtime)
+		runtime = taint
+		defer func() { result.Taint = taint.tracker.summary() }()
+	}
+	// Trampolines are added to the module as loaded, so the functions
+	// chosen by index are those of the file
+	if len(opts.Intercept.Functions) > 0 {
+		intercept := newInterceptRuntime(runtime, opts.Intercept)
+		runtime = intercept
+		defer func() { result.Intercept = intercept.tracker.summary() }()
+	}
+	// Host functions are linked through the configured proxies
+	if len(plan.Proxies) > 0 {
+		proxies := newImportProxies(plan.Proxies)
+		runtime = &proxyRuntime{WasmRuntime: runtime, wrapper: proxies}
+		defer func() { result.Proxies = proxies.report() }()
+	}
+	// Chaos faults sit between the proxies and the host, so proxies see
+	// the calls the way the module does
+	if result.Chaos != nil {
+		runtime = &proxyRuntime{WasmRuntime: runtime, wrapper: newChaosFaults(opts.Chaos, result.Chaos)}
+	}
+	runtime = hostRuntime(runtime, &plan, output)
+
+	// A start function that traps would keep the rest of the module from
+	// running, so it can be taken out of instantiation
+	if plan.Start != "" {
+		start := &startRuntime{runtime: runtime, mode: plan.Start}
+		runtime = start
+		defer func() { result.StartFailure = start.failure }()
+	}
+
+	if opts.StopAfter == StageInstantiate {
+		if err := runTruncated(filePath, runtime, StageInstantiate); err != nil {
+			result.FailureStage, result.ErrorMessage = classifyError(err, StageLoad, "load failed")
+			result.FailureSubStage = failureSubStage(err)
+			return result
+		}
+		result.Success = true
+		return result
+	}
+
+	// Instrumented modules report the edges every execution reaches
+	var coverage *coverageTracker
+	if opts.Coverage.Enabled {
+		instrumented := newCoverageRuntime(runtime, opts.Coverage.Targets, opts.ArgFuzz.Concolic.Enabled)
+		runtime = instrumented
+		coverage = instrumented.tracker
+		defer func() { result.Coverage = instrumented.summary() }()
+	}
+
+	// Load the module (includes load, validate, instantiate) and run setup
+	module, err := prepareModule(filePath, runtime, plan)
+	defer func() {
+		// module may be replaced by a reload, so close whichever is current
+		if module != nil {
+			module.Close()
+		}
+	}()
+	if err != nil {
+		result.Success = false
+		result.FailureStage, result.ErrorMessage = classifyError(err, StageLoad, "load failed")
+		result.FailureSubStage = failureSubStage(err)
+		return result
+	}
+	coverage.collect(module)
+
+	// Sequence-fuzzing mode calls exports of its choosing instead of the entry
+	if opts.Sequence.Iterations > 0 {
+		fuzzSequences(&result, &module, filePath, runtime, plan, opts.Sequence, coverage)
+		return result
+	}
+	// Property mode checks claims about exports instead of calling the entry
+	if len(opts.Properties) > 0 {
+		checkProperties(&result, &module, filePath, runtime, plan, opts.Properties, coverage)
+		return result
+	}
+
+	// Check every input against the entry's signature before running any
+	calls, err := plan.arguments(module)
+	if err != nil {
+		result.Success = false
+		result.FailureStage, result.ErrorMessage = classifyError(err, StageSignature, "signature mismatch")
+		return result
+	}
+
+	// Argument-fuzzing mode replaces the fixed input list
+	if opts.ArgFuzz.Iterations > 0 && opts.ArgFuzz.Payload != "" {
+		source, err := newPayloadMutator(opts.ArgFuzz, plan, calls)
+		if err != nil {
+			result.Success = false
+			result.FailureStage, result.ErrorMessage = classifyError(err, StageSignature, "payload fuzzing")
+			return result
+		}
+		fuzzWithSource(&result, &module, filePath, runtime, plan, source, opts.ArgFuzz, coverage)
+		return result
+	}
+	if opts.ArgFuzz.Iterations > 0 && plan.function != nil {
+		source := newWITMutator(opts.ArgFuzz.Seed, calls)
+		fuzzWithSource(&result, &module, filePath, runtime, plan, source, opts.ArgFuzz, coverage)
+		return result
+	}
+	if opts.ArgFuzz.Iterations > 0 {
+		seeds, err := i32Arguments(calls)
+		if err != nil {
+			result.Success = false
+			result.FailureStage, result.ErrorMessage = classifyError(err, StageSignature, "signature mismatch")
+			return result
+		}
+		fuzzArguments(&result, &module, filePath, runtime, plan, seeds, opts.ArgFuzz, coverage)
+		return result
+	}
+
+	// Capture post-setup state so each invocation starts from it
+	var snapshot *ModuleSnapshot
+	stateful, canSnapshot := module.(StatefulModule)
+	if plan.Snapshot && len(plan.Inputs) > 1 && canSnapshot {
+		snapshot, err = stateful.Snapshot()
+		if err != nil {
+			result.Success = false
+			result.FailureStage = StageExecute
+			result.ErrorMessage = fmt.Sprintf("snapshot failed: %v", err)
+			return result
+		}
+	}
+
+	result.Success = true
+	for i, args := range calls {
+		if i > 0 && plan.Snapshot {
+			module, err = resetModule(module, snapshot, filePath, runtime, plan)
+			if err != nil {
+				result.Success = false
+				result.FailureStage, result.ErrorMessage = classifyError(err, StageExecute, "restore failed")
+				result.FailureSubStage = failureSubStage(err)
+				return result
+			}
+		}
+
+		// Execute the entry function with this input
+		output.takeCall()
+		var returns []interface{}
+		err = hooks.beforeInvoke(result.FilePath, encodeValues(args))
+		if err == nil {
+			err = runStage(StageExecute, func() error {
+				var execErr error
+				returns, execErr = plan.call(module, args)
+				return execErr
+			})
+			coverage.collect(module)
+		}
+
+		invocation := InvocationResult{Args: encodeValues(args)}
+		invocation.Stdout, invocation.Stderr, invocation.Log = output.takeCall()
+		if err == nil {
+			invocation.ReturnValues = returns
+			invocation.TypedReturnValues = encodeValues(returns)
+			err = hooks.afterInvoke(result.FilePath, invocation)
+		}
+		invocation.Success = err == nil
+		if err != nil {
+			stage, message := classifyError(err, StageExecute, "execution failed")
+			invocation.ErrorMessage = message
+			if result.Success {
+				result.Success = false
+				result.FailureStage = stage
+				result.FailureSubStage = failureSubStage(err)
+				result.ErrorMessage = message
+				if plan.recordsInvocations() {
+					result.ErrorMessage = fmt.Sprintf("invocation %d: %s", i, message)
+				}
+			}
+		}
+
+		// The first invocation's return values are reported at the top level
+		if i == 0 {
+			result.ReturnValues = invocation.ReturnValues
+			result.TypedReturnValues = invocation.TypedReturnValues
+		}
+		if plan.recordsInvocations() {
+			result.Invocations = append(result.Invocations, invocation)
+		}
+	}
+
+	return result
+}
+
+// hostRuntime wraps runtime in the host of the plan's ABI. Plugins import
+// their host's functions, which the harness provides, and the plan keeps
+// the host so calls can go through it.
+func hostRuntime(runtime WasmRuntime, plan *InvocationConfig, output *outputCapture) WasmRuntime {
+	switch plan.ABI {
+	case "":
+		// Emscripten output imports its JS glue's functions, and WASI
+		// commands and reactors their host's
+		return &wasiRuntime{runtime: runtime, entry: plan.Entry, log: plan.Log, output: output}
+	case ABIExtism:
+		plan.extism = &extismHost{config: plan.Extism}
+		return &extismRuntime{runtime: runtime, host: plan.extism}
+	case ABIProxyWasm:
+		plan.proxyWasm = &proxyWasmHost{config: plan.ProxyWasm}
+		return &proxyWasmRuntime{runtime: runtime, host: plan.proxyWasm}
+	case ABIGo:
+		plan.golang = &goHost{output: output}
+		return &goRuntime{runtime: runtime, host: plan.golang}
+	}
+	if platform, ok := contractPlatforms[plan.ABI]; ok {
+		plan.contract = &contractHost{platform: platform, config: plan.Contract}
+		return &contractRuntime{runtime: runtime, abi: plan.ABI, host: plan.contract}
+	}
+	return runtime
+}
+
+// prepareModule loads a module and runs the configured setup export.
+// The returned module is non-nil whenever it must be closed by the caller.
+func prepareModule(filePath string, runtime WasmRuntime, plan InvocationConfig) (WasmModule, error) {
+	module, err := runtime.LoadModule(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if plan.Setup == "" {
+		return module, nil
+	}
+
+	err = runStage(StageExecute, func() error {
+		_, setupErr := module.Execute(plan.Setup)
+		return setupErr
+	})
+	if err != nil {
+		stage, message := classifyError(err, StageExecute, "execution failed")
+		return module, &RuntimeError{Stage: stage, Message: fmt.Sprintf("setup '%s' failed: %s", plan.Setup, message)}
+	}
+	return module, nil
+}
+
+// resetModule returns the module to its post-setup state. Modules that
+// support snapshots are restored in place; others are reloaded from disk
+// and set up again, which is slower but preserves the same semantics. Go
+// programs keep JavaScript values in the host, which no snapshot captures,
+// so they are always reloaded.
+func resetModule(module WasmModule, snapshot *ModuleSnapshot, filePath string, runtime WasmRuntime, plan InvocationConfig) (WasmModule, error) {
+	if stateful, ok := module.(StatefulModule); ok && snapshot != nil && plan.golang == nil {
+		plan.extism.rewind()
+		plan.proxyWasm.rewind()
+		plan.contract.rewind()
+		return module, stateful.Restore(snapshot)
+	}
+
+	module.Close()
+	return prepareModule(filePath, runtime, plan)
+}
+
+// classifyError maps an error to its failure stage and message. Errors that
+// are not RuntimeErrors are attributed to defaultStage.
+func classifyError(err error, defaultStage FailureStage, prefix string) (FailureStage, string) {
+	var runtimeErr *RuntimeError
+	if errors.As(err, &runtimeErr) {
+		return runtimeErr.Stage, runtimeErr.Message
+	}
+	return defaultStage, fmt.Sprintf("%s: %v", prefix, err)
+}
+
+// failureSubStage returns the sub-stage recorded on err, if any
+func failureSubStage(err error) string {
+	var runtimeErr *RuntimeError
+	if errors.As(err, &runtimeErr) {
+		return runtimeErr.SubStage
+	}
+	return ""
+}
+
+// collectWasmFiles returns all .wasm files in the corpus at a location, a
+// directory or any CorpusSource, fetching it to disk when kept elsewhere
+func collectWasmFiles(dirPath string) ([]string, error) {
+	var files []string
+
+	corpus, err := fetchCorpus(dirPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %w", err)
+	}
+
+	for _, name := range corpus.names {
+		if filepath.Ext(name) == ".wasm" {
+			files = append(files, filepath.Join(corpus.dir, name))
+		}
+	}
+
+	return files, nil
+}
+
+// skippedResult is the result of a file that was not run
+func skippedResult(filePath string, reason SkipReason, details string) ExecutionResult {
+	return ExecutionResult{
+		SchemaVersion: SchemaVersion,
+		FilePath:      filePath,
+		FileName:      filepath.Base(filePath),
+		FailureStage:  StageNone,
+		Skipped:       true,
+		SkipReason:    reason,
+		SkipDetails:   details,
+	}
+}
+
+// environmentRuntime pairs a matrix environment with the runtime configured for it
+type environmentRuntime struct {
+	Environment Environment
+	Runtime     WasmRuntime
+}
+
+// newFailureCounts returns a failure count map with every stage initialized
+func newFailureCounts() map[FailureStage]int {
+	return map[FailureStage]int{
+		StageLoad:        0,
+		StageValidate:    0,
+		StageInstantiate: 0,
+		StageSignature:   0,
+		StageExecute:     0,
+	}
+}
+
+// newSkipCounts returns a skip count map with every reason initialized
+func newSkipCounts() map[SkipReason]int {
+	return map[SkipReason]int{
+		SkipFiltered:           0,
+		SkipUnsupportedFeature: 0,
+		SkipOverSizeLimit:      0,
+		SkipDuplicate:          0,
+		SkipAborted:            0,
+		SkipUnchanged:          0,
+		SkipOverBudget:         0,
+		SkipCrashLoop:          0,
+	}
+}
+
+// runFuzzerWithRuntime processes all WASM files using the provided runtime
+func runFuzzerWithRuntime(dirPath string, runtime WasmRuntime) (FuzzingReport, error) {
+	return runFuzzerWithMatrix(dirPath, []environmentRuntime{{Runtime: runtime}}, RunOptions{})
+}
+
+// check rejects options that can be found wrong before any file is run
+func (o RunOptions) check() error {
+	if err := checkStopAfter(o.StopAfter); err != nil {
+		return err
+	}
+	if err := checkDataSegments(o.DataSegments); err != nil {
+		return err
+	}
+	if err := o.Tamper.check(); err != nil {
+		return err
+	}
+	if err := o.Chaos.check(); err != nil {
+		return err
+	}
+	if err := o.LargeModules.check(); err != nil {
+		return err
+	}
+	if err := o.MemoryPressure.check(); err != nil {
+		return err
+	}
+	if err := o.Restart.check(); err != nil {
+		return err
+	}
+	if err := o.Heartbeat.check(); err != nil {
+		return err
+	}
+	if err := o.ArgFuzz.Sync.check(); err != nil {
+		return err
+	}
+	if o.CompareClean && !o.injects() {
+		return errors.New("compare_clean needs something injected to compare against")
+	}
+	if o.Determinism < 0 {
+		return errors.New("determinism must not be negative")
+	}
+	if err := o.FloatComparison.check(); err != nil {
+		return err
+	}
+	if err := o.Ownership.check(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// runFuzzerWithMatrix processes every WASM file under every environment.
+// With more than one environment, results are tagged with the environment
+// name and the report is pivoted by environment.
+func runFuzzerWithMatrix(dirPath string, envs []environmentRuntime, opts RunOptions) (FuzzingReport, error) {
+	if err := opts.check(); err != nil {
+		return FuzzingReport{}, err
+	}
+	if opts.StopAfter == StageExecute {
+		opts.StopAfter = ""
+	}
+	quarantine, err := loadQuarantine(opts.Quarantine)
+	if err != nil {
+		return FuzzingReport{}, err
+	}
+	expected, err := loadExpectations(dirPath)
+	if err != nil {
+		return FuzzingReport{}, err
+	}
+	breaker, err := newCampaignBreaker(opts.MaxFailures, opts.CircuitBreaker)
+	if err != nil {
+		return FuzzingReport{}, err
+	}
+	history, err := loadHistory(opts.History)
+	if err != nil {
+		return FuzzingReport{}, err
+	}
+	budget, err := newCampaignBudget(opts.MaxDuration)
+	if err != nil {
+		return FuzzingReport{}, err
+	}
+	cache, err := newResultCache(opts)
+	if err != nil {
+		return FuzzingReport{}, err
+	}
+	var monitor *memoryMonitor
+	if opts.TrackMemory {
+		monitor = newMemoryMonitor(envs)
+	}
+	trackers := make([]*resourceTracker, len(envs))
+	for i, env := range envs {
+		trackers[i] = debugTracker(env.Runtime, opts)
+	}
+	var workers []*isolatedWorker
+	if opts.WorkerArgs != nil {
+		workers = newIsolatedWorkers(len(envs), opts)
+		defer func() {
+			for _, worker := range workers {
+				worker.Close()
+			}
+		}()
+	}
+	var largeWorkers []*isolatedWorker
+	if opts.LargeModules.Threshold > 0 && opts.CampaignArgs != nil {
+		largeWorkers = newLargeModuleWorkers(len(envs), opts)
+		defer func() {
+			for _, worker := range largeWorkers {
+				worker.Close()
+			}
+		}()
+	}
+	heartbeat, err := startHeartbeat(opts.Heartbeat)
+	if err != nil {
+		return FuzzingReport{}, err
+	}
+	defer heartbeat.stop()
+	heartbeat.watch(workers, largeWorkers)
+	runJob := func(job campaignJob, opts RunOptions, clean bool) ExecutionResult {
+		defer monitor.sample()
+		if clean {
+			opts = opts.clean()
+		}
+		request := workerRequest{FilePath: job.FilePath, Chaos: opts.chaos, Clean: clean}
+		if largeWorkers != nil && opts.LargeModules.holds(job.FilePath) {
+			return largeWorkers[job.Env].run(request)
+		}
+		if workers != nil {
+			return workers[job.Env].run(request)
+		}
+		// In process, a wedged call cannot be interrupted; it can only be
+		// pointed out
+		watch := startWatchdog(opts.HangTimeout, func() {
+			emitError(map[string]string{
+				"warning": "file made no progress",
+				"file":    job.FilePath,
+				"details": fmt.Sprintf("no progress for %s; run with --isolate to abandon wedged files", opts.HangTimeout),
+			})
+		})
+		defer watch.stop()
+		return processAudited(job.FilePath, envs[job.Env].Runtime, trackers[job.Env], opts)
+	}
+	var aborted string
+	report, err := runCampaign(dirPath, envs, opts, func(jobs []campaignJob, results []ExecutionResult) {
+		// Process each file sequentially (no concurrency)
+		for i, job := range budget.schedule(jobs, history) {
+			heartbeat.progress(len(jobs), i, job.FilePath)
+			if aborted != "" {
+				results[job.Index] = skippedResult(job.FilePath, SkipAborted, aborted)
+				continue
+			}
+			if budget.spent(job) {
+				results[job.Index] = skippedResult(job.FilePath, SkipOverBudget, "max duration of "+opts.MaxDuration.String()+" reached")
+				continue
+			}
+			// Every environment runs a file under the same chaos
+			opts := opts
+			opts.chaos = opts.Chaos.profile(job.Index/len(envs), len(results)/len(envs))
+			if job.Unchanged {
+				result, ok := cache.reuse(job.FilePath, envs[job.Env].Environment, opts.chaos)
+				if !ok {
+					result = skippedResult(job.FilePath, SkipUnchanged, "unchanged since "+opts.Corpus.ChangedSince+", with no cached result")
+				}
+				result.Quarantined = quarantine.holds(job.FilePath)
+				results[job.Index] = result
+				continue
+			}
+			started := time.Now()
+			results[job.Index] = cache.run(job.FilePath, envs[job.Env].Environment, opts.chaos, func() ExecutionResult {
+				var result ExecutionResult
+				if opts.CompareClean {
+					clean := runJob(job, opts, true)
+					result = runJob(job, opts, false)
+					result.Injection = compareClean(clean, result, opts.FloatComparison)
+				} else {
+					result = runJob(job, opts, false)
+				}
+				checkDeterminism(&result, opts.Determinism, opts.FloatComparison, func() ExecutionResult { return runJob(job, opts, false) })
+				return result
+			})
+			// A cached result was checked for flakiness when it was run
+			if results[job.Index].Cached {
+				results[job.Index].Quarantined = quarantine.holds(job.FilePath)
+			} else {
+				quarantine.check(&results[job.Index], func() ExecutionResult { return runJob(job, opts, false) })
+			}
+			history.record(results[job.Index], time.Since(started))
+			if aborted = breaker.record(results[job.Index]); aborted != "" {
+				emitError(map[string]string{"warning": "campaign aborted", "details": aborted})
+			}
+		}
+	})
+	report.Aborted = aborted
+	report.WorkerRestarts, report.CrashLoops = summarizeWorkers(envs, workers, largeWorkers)
+	report.Budget = budget.summarize()
+	report.Memory = monitor.summary()
+	report.Cache = cache.summarize()
+	if err != nil {
+		return report, err
+	}
+	report.Quarantine = quarantine.summarize(report.Results)
+	// A truncated pipeline cannot have the outcomes of later stages
+	if opts.StopAfter == "" {
+		report.Expectations = expected.check(report.Results)
+	}
+	if err := history.save(); err != nil {
+		return report, err
+	}
+	return report, quarantine.save()
+}
+
+// campaignJob is a file to run under one environment, whose result goes
+// to Index in the report's results
+type campaignJob struct {
+	FilePath string
+	Env      int
+	Index    int
+	// Unchanged is set for files unchanged since the ref of an
+	// incremental run, which only report a cached result
+	Unchanged bool
+}
+
+// runCampaign has run fill in the results of the files planCampaign
+// selects. The report is then tallied and, for several environments,
+// pivoted by environment.
+func runCampaign(dirPath string, envs []environmentRuntime, opts RunOptions, run func(jobs []campaignJob, results []ExecutionResult)) (FuzzingReport, error) {
+	redactor, err := newRedactor(opts.Redaction)
+	if err != nil {
+		return FuzzingReport{}, err
+	}
+	classifiers, err := newClassifierChain(opts.Classifiers)
+	if err != nil {
+		return FuzzingReport{}, err
+	}
+	owners, err := loadOwners(dirPath, opts.Ownership)
+	if err != nil {
+		return FuzzingReport{}, err
+	}
+	report, jobs, err := planCampaign(dirPath, envs, opts)
+	if err != nil {
+		return report, err
+	}
+
+	campaign := tracer.Start("fuzz_campaign")
+	campaign.SetAttribute("wasm.corpus.dir", dirPath)
+	run(jobs, report.Results)
+	campaign.End(nil)
+
+	middleware := newMiddlewareChain(opts.Middleware)
+	kept := report.Results[:0]
+	for i := range report.Results {
+		result := &report.Results[i]
+		result.Environment = envs[i%len(envs)].Environment.Name
+		// Classifiers and middleware see the message before it is redacted,
+		// and middleware sees the owners of the file
+		result.Classification = classifiers.classify(*result)
+		assignErrorCodes(result)
+		result.Owners = owners.find(result.FilePath)
+		if !middleware.process(result) {
+			report.FilteredOut++
+			continue
+		}
+		if err := redactor.redact(result); err != nil {
+			return report, err
+		}
+		countResult(&report, *result)
+		kept = append(kept, *result)
+	}
+	report.Results = kept
+	report.TotalFiles = len(report.Results)
+	report.CrashBuckets = bucketCrashes(report.Results)
+
+	if len(envs) > 1 {
+		environments := make([]Environment, len(envs))
+		for i, env := range envs {
+			environments[i] = env.Environment
+		}
+		pivotByEnvironment(&report, environments)
+	}
+	report.Owners = summarizeOwners(report.Results)
+
+	return report, nil
+}
+
+// countResult adds a result to the counts of a report
+func countResult(report *FuzzingReport, result ExecutionResult) {
+	if result.Skipped {
+		report.Skipped++
+		report.SkipCounts[result.SkipReason]++
+	} else if result.Success {
+		report.Passed++
+	} else {
+		report.Failed++
+		report.FailureCounts[result.FailureStage]++
+		countSeverity(report, result.Classification)
+	}
+	if result.Injection != nil && len(result.Injection.Differences) > 0 {
+		report.InjectionDifferences = append(report.InjectionDifferences, InjectionDifference{
+			FilePath:    result.FilePath,
+			Environment: result.Environment,
+			Differences: result.Injection.Differences,
+		})
+	}
+	if len(result.Nondeterminism) > 0 {
+		report.Nondeterministic = append(report.Nondeterministic, NondeterministicModule{
+			FilePath:    result.FilePath,
+			Environment: result.Environment,
+			Differences: result.Nondeterminism,
+		})
+	}
+}
+
+// planCampaign selects the corpus files and skips those the corpus
+// settings or an environment's proposals rule out. The report holds a
+// result for every file and environment, and the jobs say which of them
+// are to be run.
+func planCampaign(dirPath string, envs []environmentRuntime, opts RunOptions) (FuzzingReport, []campaignJob, error) {
+	report := FuzzingReport{
+		SchemaVersion: SchemaVersion,
+		StopAfter:     opts.StopAfter,
+		Results:       make([]ExecutionResult, 0),
+		FailureCounts: newFailureCounts(),
+		SkipCounts:    newSkipCounts(),
+	}
+
+	// Collect all WASM files
+	files, err := collectWasmFiles(dirPath)
+	if err != nil {
+		return report, nil, err
+	}
+
+	filter, err := newCorpusFilter(opts.Corpus)
+	if err != nil {
+		return report, nil, err
+	}
+	report.Shard, err = opts.Corpus.shard()
+	if err != nil {
+		return report, nil, err
+	}
+	files, unsampled, err := arrangeCorpus(shardFiles(files, report.Shard), opts.Corpus)
+	if err != nil {
+		return report, nil, err
+	}
+	report.Selection = opts.Corpus.selection()
+	var changed map[string]bool
+	if opts.Corpus.ChangedSince != "" {
+		if changed, err = changedFiles(dirPath, opts.Corpus.ChangedSince); err != nil {
+			return report, nil, err
+		}
+	}
+
+	var jobs []campaignJob
+	for _, filePath := range files {
+		reason, details := SkipFiltered, "not in sample"
+		if !unsampled[filePath] {
+			reason, details = filter.skip(filePath)
+		}
+		if reason != "" {
+			for range envs {
+				report.Results = append(report.Results, skippedResult(filePath, reason, details))
+			}
+			continue
+		}
+
+		// Modules needing proposals an environment leaves disabled would
+		// only fail validation there, so they are skipped instead
+		features := detectFileFeatures(filePath)
+		for i, env := range envs {
+			if missing := features.unsupported(env.Environment); len(missing) > 0 {
+				report.Results = append(report.Results, skippedResult(filePath, SkipUnsupportedFeature, "requires disabled proposals: "+strings.Join(missing, ", ")))
+				continue
+			}
+			unchanged := changed != nil && !changed[filePath]
+			jobs = append(jobs, campaignJob{FilePath: filePath, Env: i, Index: len(report.Results), Unchanged: unchanged})
+			report.Results = append(report.Results, ExecutionResult{})
+		}
+	}
+	return report, jobs, nil
+}
+
+// outputJSON writes the report as formatted JSON to stdout
+func outputJSON(report FuzzingReport) error {
+	return encodeReport(os.Stdout, report)
+}
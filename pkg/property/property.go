@@ -0,0 +1,331 @@
+// Package property checks properties of a module's behavior over
+// generated arguments, such as "for all x, process(x) == process(x)" or
+// "decode(encode(x)) == x", and shrinks the arguments of a failing trial
+// to a minimal counterexample.
+//
+// A property is a function of the module under test and the generated
+// arguments, returning an error when it does not hold. The runner gives
+// each trial a module in its post-setup state, so trials do not see each
+// other's state:
+//
+//	deterministic := property.ForAll(property.Int32()).Holds("process is deterministic",
+//		func(m property.Module, args ...interface{}) error {
+//			first, err := m.Call("process", args...)
+//			if err != nil {
+//				return err
+//			}
+//			second, err := m.Call("process", args...)
+//			if err != nil {
+//				return err
+//			}
+//			return property.Equal(second, first)
+//		})
+//	result, err := property.Check(deterministic, instantiate, property.Config{Trials: 500})
+package property
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+)
+
+// Defaults of a Config
+const (
+	DefaultTrials     = 100
+	DefaultMaxShrinks = 1000
+)
+
+// Module is the module under test, as the runner exposes it
+type Module interface {
+	// Call runs an export with the given arguments
+	Call(export string, args ...interface{}) ([]interface{}, error)
+}
+
+// Gen generates the values of one argument, and smaller candidates for
+// shrinking a value that made a property fail
+type Gen struct {
+	// Type is the value type generated, such as "i32"
+	Type     string
+	generate func(rng *rand.Rand) interface{}
+	shrink   func(value interface{}) []interface{}
+}
+
+// boundaryI32 are the values every integer generator draws often
+var boundaryI32 = []int64{0, 1, -1, 2, 127, -128, 255, 256, 32767, -32768, 65535, 65536, math.MaxInt32, math.MinInt32}
+
+// Int32 generates any i32, often a boundary value
+func Int32() Gen {
+	return Int32Range(math.MinInt32, math.MaxInt32)
+}
+
+// Int32Range generates i32s from min to max, both included
+func Int32Range(min, max int32) Gen {
+	lo, hi := int64(min), int64(max)
+	return Gen{
+		Type: "i32",
+		generate: func(rng *rand.Rand) interface{} {
+			return int32(integer(rng, lo, hi))
+		},
+		shrink: func(value interface{}) []interface{} {
+			var candidates []interface{}
+			for _, v := range shrinkInteger(int64(value.(int32)), lo, hi) {
+				candidates = append(candidates, int32(v))
+			}
+			return candidates
+		},
+	}
+}
+
+// Int64 generates any i64, often a boundary value
+func Int64() Gen {
+	return Gen{
+		Type: "i64",
+		generate: func(rng *rand.Rand) interface{} {
+			return integer(rng, math.MinInt64, math.MaxInt64)
+		},
+		shrink: func(value interface{}) []interface{} {
+			var candidates []interface{}
+			for _, v := range shrinkInteger(value.(int64), math.MinInt64, math.MaxInt64) {
+				candidates = append(candidates, v)
+			}
+			return candidates
+		},
+	}
+}
+
+// OneOf generates one of the given i32s, shrinking toward the first
+func OneOf(values ...int32) Gen {
+	return Gen{
+		Type: "i32",
+		generate: func(rng *rand.Rand) interface{} {
+			return values[rng.Intn(len(values))]
+		},
+		shrink: func(value interface{}) []interface{} {
+			var candidates []interface{}
+			for _, v := range values {
+				if v == value.(int32) {
+					break
+				}
+				candidates = append(candidates, v)
+			}
+			return candidates
+		},
+	}
+}
+
+// integer draws a boundary value within bounds a quarter of the time, and
+// a uniform one otherwise
+func integer(rng *rand.Rand, lo, hi int64) int64 {
+	if rng.Intn(4) == 0 {
+		v := boundaryI32[rng.Intn(len(boundaryI32))]
+		if v >= lo && v <= hi {
+			return v
+		}
+	}
+	span := uint64(hi - lo)
+	if span == math.MaxUint64 {
+		return int64(rng.Uint64())
+	}
+	return lo + int64(rng.Uint64()%(span+1))
+}
+
+// shrinkInteger returns the values between the bound closest to zero and
+// v worth trying instead of v: the bound, then ever closer to v, so
+// greedy shrinking converges like a binary search
+func shrinkInteger(v, lo, hi int64) []int64 {
+	target := int64(0)
+	if lo > 0 {
+		target = lo
+	} else if hi < 0 {
+		target = hi
+	}
+	if v == target {
+		return nil
+	}
+	candidates := []int64{target}
+	// The distance is unsigned, as it can exceed int64
+	distance := uint64(v - target)
+	if v < target {
+		distance = uint64(target - v)
+	}
+	for d := distance / 2; d != 0; d /= 2 {
+		if v > target {
+			candidates = append(candidates, v-int64(d))
+		} else {
+			candidates = append(candidates, v+int64(d))
+		}
+	}
+	return candidates
+}
+
+// Property is a named claim about a module that must hold for all the
+// arguments its generators produce
+type Property struct {
+	Name  string
+	gens  []Gen
+	holds func(m Module, args ...interface{}) error
+}
+
+// Quantifier binds a property's arguments to generators
+type Quantifier struct {
+	gens []Gen
+}
+
+// ForAll quantifies a property over one argument per generator
+func ForAll(gens ...Gen) Quantifier {
+	return Quantifier{gens: gens}
+}
+
+// Holds names the property and gives the check that must pass for every
+// generated argument list
+func (q Quantifier) Holds(name string, check func(m Module, args ...interface{}) error) Property {
+	return Property{Name: name, gens: q.gens, holds: check}
+}
+
+// Deterministic claims that calling an export twice with the same
+// arguments gives the same results, or the same error
+func Deterministic(export string, gens ...Gen) Property {
+	return ForAll(gens...).Holds(export+" is deterministic", func(m Module, args ...interface{}) error {
+		first, firstErr := m.Call(export, args...)
+		second, secondErr := m.Call(export, args...)
+		if firstErr != nil || secondErr != nil {
+			if firstErr == nil || secondErr == nil || firstErr.Error() != secondErr.Error() {
+				return fmt.Errorf("first call: %v, second call: %v", outcome(first, firstErr), outcome(second, secondErr))
+			}
+			return nil
+		}
+		return Equal(second, first)
+	})
+}
+
+// RoundTrip claims that passing the results of encode to decode gives back
+// the arguments encode was called with
+func RoundTrip(encode, decode string, gens ...Gen) Property {
+	return ForAll(gens...).Holds(decode+"("+encode+"(x)) == x", func(m Module, args ...interface{}) error {
+		encoded, err := m.Call(encode, args...)
+		if err != nil {
+			return fmt.Errorf("%s: %w", encode, err)
+		}
+		decoded, err := m.Call(decode, encoded...)
+		if err != nil {
+			return fmt.Errorf("%s: %w", decode, err)
+		}
+		return Equal(decoded, args)
+	})
+}
+
+func outcome(results []interface{}, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return fmt.Sprint(results)
+}
+
+// Equal fails unless got and want hold the same values
+func Equal(got, want []interface{}) error {
+	if len(got) == 0 && len(want) == 0 || reflect.DeepEqual(got, want) {
+		return nil
+	}
+	return fmt.Errorf("got %v, want %v", got, want)
+}
+
+// Config sets how thoroughly a property is checked
+type Config struct {
+	// Trials is the number of generated argument lists, DefaultTrials
+	// when unset
+	Trials int
+	// Seed makes the arguments reproducible
+	Seed int64
+	// MaxShrinks caps the trials spent shrinking a counterexample,
+	// DefaultMaxShrinks when unset
+	MaxShrinks int
+}
+
+// Result is the outcome of checking a property
+type Result struct {
+	Name string
+	// Trials counts the argument lists tried before one failed, or all
+	Trials int
+	Passed bool
+	// Counterexample is the smallest argument list found failing, and
+	// Error why it does; Shrinks counts the smaller lists that still failed
+	Counterexample []interface{}
+	Error          string
+	Shrinks        int
+}
+
+// Check tries a property on generated arguments, each trial against the
+// module instantiate returns, then shrinks the first failing arguments.
+// An error is returned only when a module cannot be instantiated.
+func Check(p Property, instantiate func() (Module, error), config Config) (Result, error) {
+	if p.holds == nil {
+		return Result{}, errors.New("property has no check")
+	}
+	trials, maxShrinks := config.Trials, config.MaxShrinks
+	if trials <= 0 {
+		trials = DefaultTrials
+	}
+	if maxShrinks <= 0 {
+		maxShrinks = DefaultMaxShrinks
+	}
+
+	// try sets failure to why the property fails for args, or nil
+	var failure error
+	try := func(args []interface{}) error {
+		m, err := instantiate()
+		if err != nil {
+			return err
+		}
+		failure = p.holds(m, append([]interface{}(nil), args...)...)
+		return nil
+	}
+
+	rng := rand.New(rand.NewSource(config.Seed))
+	result := Result{Name: p.Name, Passed: true}
+	for result.Trials < trials && result.Passed {
+		args := make([]interface{}, len(p.gens))
+		for i, gen := range p.gens {
+			args[i] = gen.generate(rng)
+		}
+		result.Trials++
+		if err := try(args); err != nil {
+			return result, err
+		}
+		if failure != nil {
+			result.Passed = false
+			result.Counterexample, result.Error = args, failure.Error()
+		}
+	}
+	if result.Passed {
+		return result, nil
+	}
+
+	// Replace one argument at a time by a smaller candidate still
+	// failing, until none is left
+	runs := 0
+	for shrunk := true; shrunk && runs < maxShrinks; {
+		shrunk = false
+		for i := 0; i < len(p.gens) && !shrunk; i++ {
+			for _, candidate := range p.gens[i].shrink(result.Counterexample[i]) {
+				if runs >= maxShrinks {
+					break
+				}
+				args := append([]interface{}(nil), result.Counterexample...)
+				args[i] = candidate
+				runs++
+				if err := try(args); err != nil {
+					return result, err
+				}
+				if failure != nil {
+					result.Counterexample, result.Error = args, failure.Error()
+					result.Shrinks++
+					shrunk = true
+					break
+				}
+			}
+		}
+	}
+	return result, nil
+}
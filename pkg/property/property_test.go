@@ -0,0 +1,114 @@
+//go:build !integration
+// +build !integration
+
+package property
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// funcModule runs exports implemented by Go functions
+type funcModule map[string]func(args ...interface{}) ([]interface{}, error)
+
+func (m funcModule) Call(export string, args ...interface{}) ([]interface{}, error) {
+	return m[export](args...)
+}
+
+// instantiate returns the module for every trial, counting them
+func instantiate(m Module, count *int) func() (Module, error) {
+	return func() (Module, error) {
+		*count++
+		return m, nil
+	}
+}
+
+// -----------------------------------------------------------------------------
+// TEST: Property Checking
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// A property states what must hold for every input rather than for the
+// few inputs a test lists. When one fails, the smallest failing input is
+// what explains the bug, so counterexamples must shrink reliably.
+// -----------------------------------------------------------------------------
+
+func TestCheck_PassingPropertyRunsEveryTrial(t *testing.T) {
+	module := funcModule{"double": func(args ...interface{}) ([]interface{}, error) {
+		return []interface{}{args[0].(int32) * 2}, nil
+	}}
+	trials := 0
+	result, err := Check(Deterministic("double", Int32()), instantiate(module, &trials), Config{Trials: 50, Seed: 1})
+	require.NoError(t, err)
+
+	assert.True(t, result.Passed)
+	assert.Equal(t, "double is deterministic", result.Name)
+	assert.Equal(t, 50, result.Trials)
+	assert.Equal(t, 50, trials, "every trial gets its own module")
+	assert.Nil(t, result.Counterexample)
+}
+
+func TestCheck_ShrinksCounterexamples(t *testing.T) {
+	// Values from 1000 up do not survive the round trip
+	module := funcModule{
+		"encode": func(args ...interface{}) ([]interface{}, error) { return args, nil },
+		"decode": func(args ...interface{}) ([]interface{}, error) {
+			if x := args[0].(int32); x >= 1000 {
+				return []interface{}{x - 1, args[1]}, nil
+			}
+			return args, nil
+		},
+	}
+	trials := 0
+	result, err := Check(RoundTrip("encode", "decode", Int32Range(0, 1<<20), OneOf(3, 5, 9)), instantiate(module, &trials), Config{Seed: 4})
+	require.NoError(t, err)
+
+	assert.False(t, result.Passed)
+	assert.Equal(t, []interface{}{int32(1000), int32(3)}, result.Counterexample)
+	assert.Equal(t, "got [999 3], want [1000 3]", result.Error)
+	assert.NotZero(t, result.Shrinks)
+}
+
+func TestCheck_ErrorsAreFailures(t *testing.T) {
+	calls := 0
+	module := funcModule{"tick": func(args ...interface{}) ([]interface{}, error) {
+		calls++
+		if calls%2 == 0 {
+			return nil, errors.New("trap")
+		}
+		return []interface{}{int64(1)}, nil
+	}}
+	trials := 0
+	result, err := Check(Deterministic("tick", Int64()), instantiate(module, &trials), Config{Trials: 10, MaxShrinks: 5})
+	require.NoError(t, err)
+
+	assert.False(t, result.Passed)
+	assert.Equal(t, 1, result.Trials)
+	assert.Equal(t, []interface{}{int64(0)}, result.Counterexample)
+	assert.Equal(t, "first call: [1], second call: trap", result.Error)
+	assert.LessOrEqual(t, trials, 1+5, "shrinking stops at MaxShrinks")
+}
+
+func TestCheck_InstantiationErrorsAbort(t *testing.T) {
+	_, err := Check(Deterministic("f", Int32()), func() (Module, error) {
+		return nil, errors.New("load failed")
+	}, Config{})
+	assert.EqualError(t, err, "load failed")
+
+	_, err = Check(Property{Name: "empty"}, nil, Config{})
+	assert.Error(t, err)
+}
+
+func TestGen_ShrinksTowardZeroWithinBounds(t *testing.T) {
+	assert.Equal(t, []int64{0, 50, 75, 88, 94, 97, 99}, shrinkInteger(100, -5, 200))
+	assert.Equal(t, []int64{10, 55, 78, 89, 95, 98, 99}, shrinkInteger(100, 10, 200))
+	assert.Equal(t, []int64{-10, -55, -78, -89, -95, -98, -99}, shrinkInteger(-100, -200, -10))
+	assert.Equal(t, []int64{0}, shrinkInteger(1, 0, 1))
+	assert.Equal(t, int64(0), shrinkInteger(math.MinInt64, math.MinInt64, math.MaxInt64)[0])
+	assert.Nil(t, shrinkInteger(0, -1, 1))
+	assert.Equal(t, []interface{}{int32(3), int32(5)}, OneOf(3, 5, 9).shrink(int32(9)))
+}
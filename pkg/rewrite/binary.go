@@ -0,0 +1,51 @@
+package rewrite
+
+import (
+	"fmt"
+
+	"github.com/mrhapile/WASM-Injection-Framework/internal/wasmbin"
+)
+
+// Section IDs of the sections the rewriter decodes or edits
+const (
+	sectionCustom   = 0
+	sectionType     = 1
+	sectionImport   = 2
+	sectionFunction = 3
+	sectionGlobal   = 6
+	sectionExport   = 7
+	sectionStart    = 8
+	sectionElement  = 9
+	sectionCode     = 10
+)
+
+// sectionOrder is the position each known section must appear at. The tag
+// section sits between memory and global.
+var sectionOrder = map[byte]int{
+	1: 1, 2: 2, 3: 3, 4: 4, 5: 5, 13: 6, 6: 7, 7: 8, 8: 9, 9: 10, 12: 11, 10: 12, 11: 13,
+}
+
+// External kinds of imports and exports
+const (
+	KindFunc   byte = 0
+	KindTable  byte = 1
+	KindMemory byte = 2
+	KindGlobal byte = 3
+	KindTag    byte = 4
+)
+
+// header is the magic number and version every module starts with
+var header = []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+
+// readValType reads a value type. Typed references are not supported.
+func readValType(r *wasmbin.Reader) (ValType, error) {
+	b, err := r.Byte()
+	if err != nil {
+		return 0, err
+	}
+	switch t := ValType(b); t {
+	case I32, I64, F32, F64, V128, FuncRef, ExternRef:
+		return t, nil
+	}
+	return 0, fmt.Errorf("unsupported value type 0x%02x", b)
+}
@@ -0,0 +1,173 @@
+package rewrite
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/mrhapile/WASM-Injection-Framework/internal/wasmbin"
+)
+
+// Opcodes the rewriter inspects or emits
+const (
+	OpUnreachable  byte = 0x00
+	OpNop          byte = 0x01
+	OpBlock        byte = 0x02
+	OpLoop         byte = 0x03
+	OpIf           byte = 0x04
+	OpElse         byte = 0x05
+	OpEnd          byte = 0x0b
+	OpBr           byte = 0x0c
+	OpBrIf         byte = 0x0d
+	OpReturn       byte = 0x0f
+	OpCall         byte = 0x10
+	OpCallIndirect byte = 0x11
+	OpReturnCall   byte = 0x12
+	OpDrop         byte = 0x1a
+	OpLocalGet     byte = 0x20
+	OpLocalSet     byte = 0x21
+	OpLocalTee     byte = 0x22
+	OpGlobalGet    byte = 0x23
+	OpGlobalSet    byte = 0x24
+	OpI32Const     byte = 0x41
+	OpI64Const     byte = 0x42
+	OpF32Const     byte = 0x43
+	OpF64Const     byte = 0x44
+	OpRefFunc      byte = 0xd2
+	OpPrefixMisc   byte = 0xfc
+	OpPrefixSIMD   byte = 0xfd
+	OpPrefixAtomic byte = 0xfe
+)
+
+// Instruction is one instruction of a function body or constant
+// expression. Immediates are kept encoded, so instructions the rewriter
+// does not interpret pass through unchanged.
+type Instruction struct {
+	Op byte
+	// Sub is the secondary opcode of 0xfc, 0xfd and 0xfe instructions
+	Sub uint32
+	// Imm is the encoded immediates
+	Imm []byte
+}
+
+// encode appends the instruction's encoding
+func (i Instruction) encode(b []byte) []byte {
+	b = append(b, i.Op)
+	if wasmbin.Prefixed(i.Op) {
+		b = wasmbin.AppendU32(b, i.Sub)
+	}
+	return append(b, i.Imm...)
+}
+
+// String names the opcode, for error messages and debugging
+func (i Instruction) String() string {
+	if wasmbin.Prefixed(i.Op) {
+		return fmt.Sprintf("0x%02x %d", i.Op, i.Sub)
+	}
+	return fmt.Sprintf("0x%02x", i.Op)
+}
+
+// FuncIndex returns the function a call, return_call or ref.func refers
+// to
+func (i Instruction) FuncIndex() (uint32, bool) {
+	if i.Op != OpCall && i.Op != OpReturnCall && i.Op != OpRefFunc {
+		return 0, false
+	}
+	index, err := (&wasmbin.Reader{Data: i.Imm}).U32()
+	return index, err == nil
+}
+
+// withFuncIndex returns a call, return_call or ref.func referring to
+// another function
+func (i Instruction) withFuncIndex(index uint32) Instruction {
+	i.Imm = wasmbin.AppendU32(nil, index)
+	return i
+}
+
+// Call calls a function
+func Call(function uint32) Instruction {
+	return Instruction{Op: OpCall, Imm: wasmbin.AppendU32(nil, function)}
+}
+
+// I32Const pushes an i32
+func I32Const(v int32) Instruction {
+	return Instruction{Op: OpI32Const, Imm: wasmbin.AppendS64(nil, int64(v))}
+}
+
+// I64Const pushes an i64
+func I64Const(v int64) Instruction {
+	return Instruction{Op: OpI64Const, Imm: wasmbin.AppendS64(nil, v)}
+}
+
+// F32Const pushes an f32
+func F32Const(v float32) Instruction {
+	bits := math.Float32bits(v)
+	return Instruction{Op: OpF32Const, Imm: []byte{byte(bits), byte(bits >> 8), byte(bits >> 16), byte(bits >> 24)}}
+}
+
+// F64Const pushes an f64
+func F64Const(v float64) Instruction {
+	bits := math.Float64bits(v)
+	imm := make([]byte, 8)
+	for i := range imm {
+		imm[i] = byte(bits >> (8 * i))
+	}
+	return Instruction{Op: OpF64Const, Imm: imm}
+}
+
+// LocalGet pushes a local
+func LocalGet(local uint32) Instruction {
+	return Instruction{Op: OpLocalGet, Imm: wasmbin.AppendU32(nil, local)}
+}
+
+// LocalSet pops into a local
+func LocalSet(local uint32) Instruction {
+	return Instruction{Op: OpLocalSet, Imm: wasmbin.AppendU32(nil, local)}
+}
+
+// GlobalGet pushes a global
+func GlobalGet(global uint32) Instruction {
+	return Instruction{Op: OpGlobalGet, Imm: wasmbin.AppendU32(nil, global)}
+}
+
+// GlobalSet pops into a global
+func GlobalSet(global uint32) Instruction {
+	return Instruction{Op: OpGlobalSet, Imm: wasmbin.AppendU32(nil, global)}
+}
+
+// Simple returns an instruction without immediates, such as OpDrop,
+// OpNop, OpUnreachable, OpReturn or OpEnd
+func Simple(op byte) Instruction {
+	return Instruction{Op: op}
+}
+
+// decodeInstructions decodes an instruction sequence
+func decodeInstructions(code []byte) ([]Instruction, error) {
+	var instructions []Instruction
+	r := &wasmbin.Reader{Data: code}
+	for !r.Done() {
+		instr, err := decodeInstruction(r)
+		if err != nil {
+			return nil, fmt.Errorf("offset %d: %w", r.Pos, err)
+		}
+		instructions = append(instructions, instr)
+	}
+	return instructions, nil
+}
+
+// decodeInstruction decodes the instruction at the reader's position
+func decodeInstruction(r *wasmbin.Reader) (Instruction, error) {
+	decoded, err := r.Instruction()
+	if err != nil {
+		return Instruction{}, err
+	}
+	imm := append([]byte(nil), r.Data[decoded.Immediates:decoded.End]...)
+	return Instruction{Op: decoded.Opcode, Sub: decoded.Sub, Imm: imm}, nil
+}
+
+// encodeInstructions encodes an instruction sequence
+func encodeInstructions(b []byte, instructions []Instruction) []byte {
+	for _, instr := range instructions {
+		b = instr.encode(b)
+	}
+	return b
+}
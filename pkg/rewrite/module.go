@@ -0,0 +1,564 @@
+// Package rewrite edits WebAssembly modules programmatically: it adds
+// types, imports, functions and exports, and inserts, deletes or replaces
+// the instructions of function bodies, renumbering function references
+// when an import shifts them. It serves instrumentation, such as a probe
+// called at every function entry, as well as adversarial injection
+// studies that need modules the runtime would never see from a compiler.
+//
+// The rewriter decodes what it edits and passes everything else through
+// verbatim. It does not validate: a rewritten module is only as valid as
+// the edits made to it, and the runtime's validator is the judge.
+package rewrite
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/mrhapile/WASM-Injection-Framework/internal/wasmbin"
+)
+
+// ValType is a value type. Typed references are not supported.
+type ValType byte
+
+const (
+	I32       ValType = 0x7f
+	I64       ValType = 0x7e
+	F32       ValType = 0x7d
+	F64       ValType = 0x7c
+	V128      ValType = 0x7b
+	FuncRef   ValType = 0x70
+	ExternRef ValType = 0x6f
+)
+
+// FuncType is a function signature
+type FuncType struct {
+	Params, Results []ValType
+}
+
+func (t FuncType) equal(other FuncType) bool {
+	return bytes.Equal(valTypeBytes(t.Params), valTypeBytes(other.Params)) &&
+		bytes.Equal(valTypeBytes(t.Results), valTypeBytes(other.Results))
+}
+
+func valTypeBytes(types []ValType) []byte {
+	b := make([]byte, len(types))
+	for i, t := range types {
+		b[i] = byte(t)
+	}
+	return b
+}
+
+// Import is an entry of the import section. Type is the type index of
+// function imports; the descriptions of other imports are kept encoded.
+type Import struct {
+	Module, Name string
+	Kind         byte
+	Type         uint32
+	desc         []byte
+}
+
+// LocalGroup declares Count locals of one type
+type LocalGroup struct {
+	Count uint32
+	Type  ValType
+}
+
+// Function is a function defined in the module
+type Function struct {
+	// Index is the function's index, which counts imported functions
+	Index uint32
+	// Type is the index of the function's type
+	Type   uint32
+	Locals []LocalGroup
+	// Body is the instruction sequence, ending with the function's end
+	Body []Instruction
+
+	module *Module
+}
+
+// section is one raw section of the module
+type section struct {
+	id      byte
+	payload []byte
+}
+
+// Module is a decoded module. Types, Imports and Functions may be edited
+// directly; the methods keep function indices consistent.
+type Module struct {
+	Types     []FuncType
+	Imports   []Import
+	Functions []*Function
+	sections  []section
+}
+
+// Parse decodes a module binary
+func Parse(data []byte) (*Module, error) {
+	if !bytes.HasPrefix(data, header) {
+		return nil, errors.New("missing WASM header")
+	}
+	m := &Module{}
+	r := &wasmbin.Reader{Data: data, Pos: len(header)}
+	var functionTypes []uint32
+	var code []byte
+	for !r.Done() {
+		id, err := r.Byte()
+		if err != nil {
+			return nil, err
+		}
+		size, err := r.U32()
+		if err != nil {
+			return nil, err
+		}
+		payload, err := r.Bytes(int(size))
+		if err != nil {
+			return nil, fmt.Errorf("section %d: %w", id, err)
+		}
+		switch id {
+		case sectionType:
+			err = m.parseTypes(payload)
+		case sectionImport:
+			err = m.parseImports(payload)
+		case sectionFunction:
+			functionTypes, err = parseIndices(payload)
+		case sectionCode:
+			code = payload
+		}
+		if err != nil {
+			return nil, fmt.Errorf("section %d: %w", id, err)
+		}
+		m.sections = append(m.sections, section{id: id, payload: payload})
+	}
+
+	if err := m.parseCode(functionTypes, code); err != nil {
+		return nil, fmt.Errorf("section %d: %w", sectionCode, err)
+	}
+	return m, nil
+}
+
+func (m *Module) parseTypes(payload []byte) error {
+	r := &wasmbin.Reader{Data: payload}
+	count, err := r.U32()
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < count; i++ {
+		form, err := r.Byte()
+		if err != nil {
+			return err
+		}
+		if form != 0x60 {
+			return fmt.Errorf("type %d: unsupported type form 0x%02x", i, form)
+		}
+		var t FuncType
+		if t.Params, err = readValTypes(r); err != nil {
+			return fmt.Errorf("type %d: %w", i, err)
+		}
+		if t.Results, err = readValTypes(r); err != nil {
+			return fmt.Errorf("type %d: %w", i, err)
+		}
+		m.Types = append(m.Types, t)
+	}
+	return nil
+}
+
+func readValTypes(r *wasmbin.Reader) ([]ValType, error) {
+	n, err := r.U32()
+	if err != nil {
+		return nil, err
+	}
+	var types []ValType
+	for i := uint32(0); i < n; i++ {
+		t, err := readValType(r)
+		if err != nil {
+			return nil, err
+		}
+		types = append(types, t)
+	}
+	return types, nil
+}
+
+func (m *Module) parseImports(payload []byte) error {
+	r := &wasmbin.Reader{Data: payload}
+	count, err := r.U32()
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < count; i++ {
+		var imp Import
+		if imp.Module, err = r.Name(); err != nil {
+			return err
+		}
+		if imp.Name, err = r.Name(); err != nil {
+			return err
+		}
+		if imp.Kind, err = r.Byte(); err != nil {
+			return err
+		}
+		start := r.Pos
+		if imp.Kind == KindFunc {
+			imp.Type, err = r.U32()
+		} else {
+			err = r.SkipImportDesc(imp.Kind)
+		}
+		if err != nil {
+			return fmt.Errorf("import %d: %w", i, err)
+		}
+		imp.desc = append([]byte(nil), r.Data[start:r.Pos]...)
+		m.Imports = append(m.Imports, imp)
+	}
+	return nil
+}
+
+func parseIndices(payload []byte) ([]uint32, error) {
+	r := &wasmbin.Reader{Data: payload}
+	count, err := r.U32()
+	if err != nil {
+		return nil, err
+	}
+	indices := make([]uint32, 0, min(int(count), len(payload)))
+	for i := uint32(0); i < count; i++ {
+		index, err := r.U32()
+		if err != nil {
+			return nil, err
+		}
+		indices = append(indices, index)
+	}
+	return indices, nil
+}
+
+func (m *Module) parseCode(functionTypes []uint32, payload []byte) error {
+	var count uint32
+	r := &wasmbin.Reader{Data: payload}
+	if payload != nil {
+		var err error
+		if count, err = r.U32(); err != nil {
+			return err
+		}
+	}
+	if int(count) != len(functionTypes) {
+		return fmt.Errorf("%d bodies for %d functions", count, len(functionTypes))
+	}
+	imported := m.importedFunctions()
+	for i := uint32(0); i < count; i++ {
+		size, err := r.U32()
+		if err != nil {
+			return err
+		}
+		raw, err := r.Bytes(int(size))
+		if err != nil {
+			return fmt.Errorf("function body %d: %w", i, err)
+		}
+		body := &wasmbin.Reader{Data: raw}
+		groups, err := body.U32()
+		if err != nil {
+			return err
+		}
+		f := &Function{Index: imported + i, Type: functionTypes[i], module: m}
+		for g := uint32(0); g < groups; g++ {
+			var group LocalGroup
+			if group.Count, err = body.U32(); err != nil {
+				return err
+			}
+			if group.Type, err = readValType(body); err != nil {
+				return fmt.Errorf("function body %d: %w", i, err)
+			}
+			f.Locals = append(f.Locals, group)
+		}
+		if f.Body, err = decodeInstructions(raw[body.Pos:]); err != nil {
+			return fmt.Errorf("function body %d: %w", i, err)
+		}
+		m.Functions = append(m.Functions, f)
+	}
+	return nil
+}
+
+// importedFunctions counts the function imports, which take the first
+// function indices
+func (m *Module) importedFunctions() uint32 {
+	var n uint32
+	for _, imp := range m.Imports {
+		if imp.Kind == KindFunc {
+			n++
+		}
+	}
+	return n
+}
+
+// Encode serializes the module
+func (m *Module) Encode() []byte {
+	encoded := map[byte][]byte{
+		sectionType:     m.encodeTypes(),
+		sectionImport:   m.encodeImports(),
+		sectionFunction: m.encodeFunctions(),
+		sectionCode:     m.encodeCode(),
+	}
+	for _, id := range []byte{sectionType, sectionImport, sectionFunction, sectionCode} {
+		// Empty vectors need no section
+		if !bytes.Equal(encoded[id], []byte{0}) {
+			m.ensureSection(id)
+		}
+	}
+
+	out := append([]byte(nil), header...)
+	for _, s := range m.sections {
+		payload := s.payload
+		if replacement, ok := encoded[s.id]; ok {
+			payload = replacement
+		}
+		out = append(out, s.id)
+		out = wasmbin.AppendU32(out, uint32(len(payload)))
+		out = append(out, payload...)
+	}
+	return out
+}
+
+func (m *Module) encodeTypes() []byte {
+	b := wasmbin.AppendU32(nil, uint32(len(m.Types)))
+	for _, t := range m.Types {
+		b = append(b, 0x60)
+		b = append(wasmbin.AppendU32(b, uint32(len(t.Params))), valTypeBytes(t.Params)...)
+		b = append(wasmbin.AppendU32(b, uint32(len(t.Results))), valTypeBytes(t.Results)...)
+	}
+	return b
+}
+
+func (m *Module) encodeImports() []byte {
+	b := wasmbin.AppendU32(nil, uint32(len(m.Imports)))
+	for _, imp := range m.Imports {
+		b = wasmbin.AppendName(wasmbin.AppendName(b, imp.Module), imp.Name)
+		b = append(b, imp.Kind)
+		if imp.Kind == KindFunc {
+			b = wasmbin.AppendU32(b, imp.Type)
+		} else {
+			b = append(b, imp.desc...)
+		}
+	}
+	return b
+}
+
+func (m *Module) encodeFunctions() []byte {
+	b := wasmbin.AppendU32(nil, uint32(len(m.Functions)))
+	for _, f := range m.Functions {
+		b = wasmbin.AppendU32(b, f.Type)
+	}
+	return b
+}
+
+func (m *Module) encodeCode() []byte {
+	b := wasmbin.AppendU32(nil, uint32(len(m.Functions)))
+	for _, f := range m.Functions {
+		body := wasmbin.AppendU32(nil, uint32(len(f.Locals)))
+		for _, group := range f.Locals {
+			body = append(wasmbin.AppendU32(body, group.Count), byte(group.Type))
+		}
+		body = encodeInstructions(body, f.Body)
+		b = append(wasmbin.AppendU32(b, uint32(len(body))), body...)
+	}
+	return b
+}
+
+// ensureSection inserts an empty section at its canonical position if the
+// module lacks one
+func (m *Module) ensureSection(id byte) {
+	at := len(m.sections)
+	for i, s := range m.sections {
+		if s.id == id {
+			return
+		}
+		if order, known := sectionOrder[s.id]; known && order > sectionOrder[id] && at == len(m.sections) {
+			at = i
+		}
+	}
+	m.sections = append(m.sections, section{})
+	copy(m.sections[at+1:], m.sections[at:])
+	m.sections[at] = section{id: id, payload: []byte{0}}
+}
+
+// rawSection returns the section with the given ID
+func (m *Module) rawSection(id byte) *section {
+	for i := range m.sections {
+		if m.sections[i].id == id {
+			return &m.sections[i]
+		}
+	}
+	return nil
+}
+
+// AddType returns the index of a function type, adding it when the
+// module has none like it
+func (m *Module) AddType(t FuncType) uint32 {
+	for i, existing := range m.Types {
+		if existing.equal(t) {
+			return uint32(i)
+		}
+	}
+	m.Types = append(m.Types, t)
+	return uint32(len(m.Types) - 1)
+}
+
+// Function returns the defined function with an index
+func (m *Module) Function(index uint32) (*Function, error) {
+	imported := m.importedFunctions()
+	if index < imported {
+		return nil, fmt.Errorf("function %d is imported", index)
+	}
+	if int(index-imported) >= len(m.Functions) {
+		return nil, fmt.Errorf("no function %d", index)
+	}
+	return m.Functions[index-imported], nil
+}
+
+// FuncType returns the type of a function, imported or defined
+func (m *Module) FuncType(index uint32) (FuncType, error) {
+	typeIndex, ok := uint32(0), false
+	var n uint32
+	for _, imp := range m.Imports {
+		if imp.Kind == KindFunc {
+			if n == index {
+				typeIndex, ok = imp.Type, true
+				break
+			}
+			n++
+		}
+	}
+	if !ok {
+		f, err := m.Function(index)
+		if err != nil {
+			return FuncType{}, err
+		}
+		typeIndex = f.Type
+	}
+	if int(typeIndex) >= len(m.Types) {
+		return FuncType{}, fmt.Errorf("function %d has no type %d", index, typeIndex)
+	}
+	return m.Types[typeIndex], nil
+}
+
+// AddFunctionImport adds a function import and returns its index.
+// Function imports take the first indices, so every defined function
+// moves up by one, and every reference to one is renumbered.
+func (m *Module) AddFunctionImport(module, name string, t FuncType) (uint32, error) {
+	at := m.importedFunctions()
+	if err := m.renumberFunctions(func(index uint32) uint32 {
+		if index >= at {
+			return index + 1
+		}
+		return index
+	}); err != nil {
+		return 0, err
+	}
+	m.Imports = append(m.Imports, Import{Module: module, Name: name, Kind: KindFunc, Type: m.AddType(t)})
+	return at, nil
+}
+
+// AddFunction defines a function and returns it. A body that does not end
+// with the function's end gets one.
+func (m *Module) AddFunction(t FuncType, locals []LocalGroup, body []Instruction) *Function {
+	f := &Function{
+		Index:  m.importedFunctions() + uint32(len(m.Functions)),
+		Type:   m.AddType(t),
+		Locals: locals,
+		Body:   withEnd(body),
+		module: m,
+	}
+	m.Functions = append(m.Functions, f)
+	return f
+}
+
+// ReplaceFunction replaces the locals and body of a defined function,
+// keeping its index and type
+func (m *Module) ReplaceFunction(index uint32, locals []LocalGroup, body []Instruction) error {
+	f, err := m.Function(index)
+	if err != nil {
+		return err
+	}
+	f.Locals, f.Body = locals, withEnd(body)
+	return nil
+}
+
+// DeleteFunction empties a defined function so it traps when called.
+// Its index stays taken, so references to it still resolve.
+func (m *Module) DeleteFunction(index uint32) error {
+	return m.ReplaceFunction(index, nil, []Instruction{Simple(OpUnreachable)})
+}
+
+// withEnd appends the function's end to a body lacking one
+func withEnd(body []Instruction) []Instruction {
+	if len(body) == 0 || body[len(body)-1].Op != OpEnd {
+		body = append(append([]Instruction(nil), body...), Simple(OpEnd))
+	}
+	return body
+}
+
+// ExportedFunction returns the index of the function exported under name
+func (m *Module) ExportedFunction(name string) (uint32, bool) {
+	exports := m.rawSection(sectionExport)
+	if exports == nil {
+		return 0, false
+	}
+	found, index := false, uint32(0)
+	_, err := walkExports(exports.payload, func(exportName string, kind byte, i uint32) uint32 {
+		if !found && kind == KindFunc && exportName == name {
+			found, index = true, i
+		}
+		return i
+	})
+	return index, found && err == nil
+}
+
+// AddExport exports an item of a kind, such as KindFunc, under name
+func (m *Module) AddExport(name string, kind byte, index uint32) error {
+	m.ensureSection(sectionExport)
+	exports := m.rawSection(sectionExport)
+	r := &wasmbin.Reader{Data: exports.payload}
+	count, err := r.U32()
+	if err != nil {
+		return err
+	}
+	payload := wasmbin.AppendU32(nil, count+1)
+	payload = append(payload, exports.payload[r.Pos:]...)
+	payload = wasmbin.AppendU32(append(wasmbin.AppendName(payload, name), kind), index)
+	exports.payload = payload
+	return nil
+}
+
+// AddLocal declares a local and returns its index
+func (f *Function) AddLocal(t ValType) uint32 {
+	index := uint32(0)
+	if int(f.Type) < len(f.module.Types) {
+		index = uint32(len(f.module.Types[f.Type].Params))
+	}
+	for _, group := range f.Locals {
+		index += group.Count
+	}
+	f.Locals = append(f.Locals, LocalGroup{Count: 1, Type: t})
+	return index
+}
+
+// Insert inserts instructions before the one at position at
+func (f *Function) Insert(at int, instructions ...Instruction) error {
+	if at < 0 || at > len(f.Body) {
+		return fmt.Errorf("function %d: position %d out of range", f.Index, at)
+	}
+	body := make([]Instruction, 0, len(f.Body)+len(instructions))
+	body = append(append(append(body, f.Body[:at]...), instructions...), f.Body[at:]...)
+	f.Body = body
+	return nil
+}
+
+// Delete removes n instructions starting at position at
+func (f *Function) Delete(at, n int) error {
+	return f.Replace(at, n)
+}
+
+// Replace replaces n instructions starting at position at
+func (f *Function) Replace(at, n int, instructions ...Instruction) error {
+	if at < 0 || n < 0 || at+n > len(f.Body) {
+		return fmt.Errorf("function %d: range %d+%d out of range", f.Index, at, n)
+	}
+	body := make([]Instruction, 0, len(f.Body)-n+len(instructions))
+	body = append(append(append(body, f.Body[:at]...), instructions...), f.Body[at+n:]...)
+	f.Body = body
+	return nil
+}
@@ -0,0 +1,24 @@
+package rewrite
+
+// ProbeType is the signature of entry probes: they receive the index the
+// entered function had before the probe was imported
+var ProbeType = FuncType{Params: []ValType{I32}}
+
+// InjectEntryProbe imports a probe function from module.name and calls it
+// at the entry of every defined function. It returns the probe's index.
+func InjectEntryProbe(m *Module, module, name string) (uint32, error) {
+	original := make(map[*Function]uint32, len(m.Functions))
+	for _, f := range m.Functions {
+		original[f] = f.Index
+	}
+	probe, err := m.AddFunctionImport(module, name, ProbeType)
+	if err != nil {
+		return 0, err
+	}
+	for _, f := range m.Functions {
+		if err := f.Insert(0, I32Const(int32(original[f])), Call(probe)); err != nil {
+			return 0, err
+		}
+	}
+	return probe, nil
+}
@@ -0,0 +1,259 @@
+package rewrite
+
+import (
+	"fmt"
+
+	"github.com/mrhapile/WASM-Injection-Framework/internal/wasmbin"
+)
+
+// renumberFunctions rewrites every function index in the module through
+// remap: calls and ref.func in code and constant expressions, exports, the
+// start function, element segments and the name section
+func (m *Module) renumberFunctions(remap func(uint32) uint32) error {
+	for i := range m.sections {
+		s := &m.sections[i]
+		var payload []byte
+		var err error
+		switch s.id {
+		case sectionExport:
+			payload, err = walkExports(s.payload, func(_ string, kind byte, index uint32) uint32 {
+				if kind == KindFunc {
+					return remap(index)
+				}
+				return index
+			})
+		case sectionStart:
+			var index uint32
+			if index, err = (&wasmbin.Reader{Data: s.payload}).U32(); err == nil {
+				payload = wasmbin.AppendU32(nil, remap(index))
+			}
+		case sectionGlobal:
+			payload, err = renumberGlobals(s.payload, remap)
+		case sectionElement:
+			payload, err = renumberElements(s.payload, remap)
+		case sectionCustom:
+			payload, err = renumberNames(s.payload, remap)
+		default:
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("section %d: %w", s.id, err)
+		}
+		s.payload = payload
+	}
+
+	for _, f := range m.Functions {
+		f.Index = remap(f.Index)
+		for i, instr := range f.Body {
+			if index, ok := instr.FuncIndex(); ok {
+				f.Body[i] = instr.withFuncIndex(remap(index))
+			}
+		}
+	}
+	return nil
+}
+
+// walkExports calls visit for each export, re-encoding the section with
+// the indices it returns
+func walkExports(payload []byte, visit func(name string, kind byte, index uint32) uint32) ([]byte, error) {
+	r := &wasmbin.Reader{Data: payload}
+	count, err := r.U32()
+	if err != nil {
+		return nil, err
+	}
+	out := wasmbin.AppendU32(nil, count)
+	for i := uint32(0); i < count; i++ {
+		name, err := r.Name()
+		if err != nil {
+			return nil, err
+		}
+		kind, err := r.Byte()
+		if err != nil {
+			return nil, err
+		}
+		index, err := r.U32()
+		if err != nil {
+			return nil, err
+		}
+		out = wasmbin.AppendU32(append(wasmbin.AppendName(out, name), kind), visit(name, kind, index))
+	}
+	return out, nil
+}
+
+// renumberExpr re-encodes the constant expression at the reader's
+// position, renumbering ref.func
+func renumberExpr(r *wasmbin.Reader, out []byte, remap func(uint32) uint32) ([]byte, error) {
+	for {
+		instr, err := decodeInstruction(r)
+		if err != nil {
+			return nil, err
+		}
+		if index, ok := instr.FuncIndex(); ok {
+			instr = instr.withFuncIndex(remap(index))
+		}
+		out = instr.encode(out)
+		if instr.Op == OpEnd {
+			return out, nil
+		}
+	}
+}
+
+func renumberGlobals(payload []byte, remap func(uint32) uint32) ([]byte, error) {
+	r := &wasmbin.Reader{Data: payload}
+	count, err := r.U32()
+	if err != nil {
+		return nil, err
+	}
+	out := wasmbin.AppendU32(nil, count)
+	for i := uint32(0); i < count; i++ {
+		// Global type: value type and mutability
+		start := r.Pos
+		if err := r.SkipValType(); err != nil {
+			return nil, err
+		}
+		if _, err := r.Byte(); err != nil {
+			return nil, err
+		}
+		out = append(out, r.Data[start:r.Pos]...)
+		if out, err = renumberExpr(r, out, remap); err != nil {
+			return nil, fmt.Errorf("global %d: %w", i, err)
+		}
+	}
+	return out, nil
+}
+
+func renumberElements(payload []byte, remap func(uint32) uint32) ([]byte, error) {
+	r := &wasmbin.Reader{Data: payload}
+	count, err := r.U32()
+	if err != nil {
+		return nil, err
+	}
+	out := wasmbin.AppendU32(nil, count)
+	for i := uint32(0); i < count; i++ {
+		flags, err := r.U32()
+		if err != nil {
+			return nil, err
+		}
+		if flags > 7 {
+			return nil, fmt.Errorf("element segment %d: unknown flags %d", i, flags)
+		}
+		out = wasmbin.AppendU32(out, flags)
+		// Bit 0 marks passive or declarative segments, bit 1 an explicit
+		// table index or element kind, and bit 2 elements given as
+		// expressions instead of function indices
+		if flags&0x01 == 0 {
+			if flags&0x02 != 0 {
+				table, err := r.U32()
+				if err != nil {
+					return nil, err
+				}
+				out = wasmbin.AppendU32(out, table)
+			}
+			if out, err = renumberExpr(r, out, remap); err != nil {
+				return nil, fmt.Errorf("element segment %d: %w", i, err)
+			}
+		}
+		if flags&0x03 != 0 {
+			start := r.Pos
+			if flags&0x04 != 0 {
+				err = r.SkipValType()
+			} else {
+				_, err = r.Byte()
+			}
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, r.Data[start:r.Pos]...)
+		}
+
+		n, err := r.U32()
+		if err != nil {
+			return nil, err
+		}
+		out = wasmbin.AppendU32(out, n)
+		for j := uint32(0); j < n; j++ {
+			if flags&0x04 != 0 {
+				if out, err = renumberExpr(r, out, remap); err != nil {
+					return nil, fmt.Errorf("element segment %d: %w", i, err)
+				}
+				continue
+			}
+			index, err := r.U32()
+			if err != nil {
+				return nil, err
+			}
+			out = wasmbin.AppendU32(out, remap(index))
+		}
+	}
+	return out, nil
+}
+
+// renumberNames renumbers the function, local and label names of a
+// "name" custom section, passing other custom sections through
+func renumberNames(payload []byte, remap func(uint32) uint32) ([]byte, error) {
+	r := &wasmbin.Reader{Data: payload}
+	name, err := r.Name()
+	if err != nil || name != "name" {
+		// Custom sections need not be well formed, and only "name" is read
+		return payload, nil
+	}
+	out := append([]byte(nil), payload[:r.Pos]...)
+	for !r.Done() {
+		id, err := r.Byte()
+		if err != nil {
+			return nil, err
+		}
+		size, err := r.U32()
+		if err != nil {
+			return nil, err
+		}
+		sub, err := r.Bytes(int(size))
+		if err != nil {
+			return nil, err
+		}
+		// Function names map function indices; local and label names map
+		// them to a map of their own
+		if id >= 1 && id <= 3 {
+			if sub, err = renumberNameMap(sub, remap, id != 1); err != nil {
+				return nil, fmt.Errorf("name subsection %d: %w", id, err)
+			}
+		}
+		out = append(wasmbin.AppendU32(append(out, id), uint32(len(sub))), sub...)
+	}
+	return out, nil
+}
+
+func renumberNameMap(payload []byte, remap func(uint32) uint32, indirect bool) ([]byte, error) {
+	r := &wasmbin.Reader{Data: payload}
+	count, err := r.U32()
+	if err != nil {
+		return nil, err
+	}
+	out := wasmbin.AppendU32(nil, count)
+	for i := uint32(0); i < count; i++ {
+		index, err := r.U32()
+		if err != nil {
+			return nil, err
+		}
+		out = wasmbin.AppendU32(out, remap(index))
+		start := r.Pos
+		if indirect {
+			n, err := r.U32()
+			if err != nil {
+				return nil, err
+			}
+			for j := uint32(0); j < n; j++ {
+				if _, err := r.U32(); err != nil {
+					return nil, err
+				}
+				if _, err := r.Name(); err != nil {
+					return nil, err
+				}
+			}
+		} else if _, err := r.Name(); err != nil {
+			return nil, err
+		}
+		out = append(out, r.Data[start:r.Pos]...)
+	}
+	return out, nil
+}
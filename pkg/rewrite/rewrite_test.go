@@ -0,0 +1,162 @@
+//go:build !integration
+// +build !integration
+
+package rewrite
+
+import (
+	"testing"
+
+	"github.com/mrhapile/WASM-Injection-Framework/internal/wasmbin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// -----------------------------------------------------------------------------
+// TEST: Module Rewriting
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Instrumentation and injection studies edit modules a compiler produced.
+// An edit that leaves one function reference pointing at the old index -
+// in an element segment, a global, the name section - yields a module
+// that still validates but calls the wrong function, which reads as a
+// runtime bug where there is none.
+// -----------------------------------------------------------------------------
+
+// testModule assembles a module importing env.log and defining process
+// (function 1), which calls helper (function 2). helper is also referenced
+// from a table element, a funcref global and the name section.
+func testModule() []byte {
+	module := append([]byte(nil), header...)
+	add := func(id byte, payload ...byte) {
+		module = append(wasmbin.AppendU32(append(module, id), uint32(len(payload))), payload...)
+	}
+
+	add(sectionType, 0x02, 0x60, 0x01, 0x7f, 0x00, 0x60, 0x01, 0x7f, 0x01, 0x7f)
+	add(sectionImport, append(wasmbin.AppendName(wasmbin.AppendName([]byte{0x01}, "env"), "log"), KindFunc, 0x00)...)
+	add(sectionFunction, 0x02, 0x01, 0x01)
+	add(4, 0x01, 0x70, 0x00, 0x01)
+	add(sectionGlobal, 0x01, 0x70, 0x00, OpRefFunc, 0x02, OpEnd)
+	add(sectionExport, append(wasmbin.AppendName([]byte{0x01}, "process"), KindFunc, 0x01)...)
+	add(sectionElement, 0x01, 0x00, OpI32Const, 0x00, OpEnd, 0x01, 0x02)
+
+	process := []byte{0x00, OpLocalGet, 0x00, OpCall, 0x02, OpEnd}
+	helper := []byte{0x01, 0x01, 0x7f, OpLocalGet, 0x00, OpEnd}
+	code := wasmbin.AppendU32([]byte{0x02}, uint32(len(process)))
+	code = append(wasmbin.AppendU32(append(code, process...), uint32(len(helper))), helper...)
+	add(sectionCode, code...)
+
+	functionNames := wasmbin.AppendName([]byte{0x01, 0x02}, "helper")
+	names := wasmbin.AppendU32(append(wasmbin.AppendName(nil, "name"), 0x01), uint32(len(functionNames)))
+	add(sectionCustom, append(names, functionNames...)...)
+	return module
+}
+
+func TestParse_EncodeRoundTrips(t *testing.T) {
+	data := testModule()
+	m, err := Parse(data)
+	require.NoError(t, err)
+
+	require.Len(t, m.Imports, 1)
+	assert.Equal(t, "log", m.Imports[0].Name)
+	require.Len(t, m.Functions, 2)
+	assert.EqualValues(t, 1, m.Functions[0].Index)
+	assert.Equal(t, []LocalGroup{{Count: 1, Type: I32}}, m.Functions[1].Locals)
+	assert.Equal(t, data, m.Encode(), "an unedited module encodes to its input")
+}
+
+func TestParse_RejectsUnsupportedModules(t *testing.T) {
+	_, err := Parse([]byte("not wasm"))
+	assert.EqualError(t, err, "missing WASM header")
+
+	data := append(append([]byte(nil), header...), sectionType, 0x02, 0x01, 0x5f)
+	_, err = Parse(data)
+	assert.EqualError(t, err, "section 1: type 0: unsupported type form 0x5f")
+}
+
+func TestInjectEntryProbe_RenumbersEveryReference(t *testing.T) {
+	m, err := Parse(testModule())
+	require.NoError(t, err)
+
+	probe, err := InjectEntryProbe(m, "probe", "enter")
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, probe, "the probe follows the existing imports")
+
+	rewritten, err := Parse(m.Encode())
+	require.NoError(t, err)
+	require.Len(t, rewritten.Imports, 2)
+	assert.Equal(t, "enter", rewritten.Imports[1].Name)
+	assert.Equal(t, ProbeType, rewritten.Types[rewritten.Imports[1].Type])
+
+	process, err := rewritten.Function(2)
+	require.NoError(t, err)
+	assert.Equal(t, []Instruction{I32Const(1), Call(1), LocalGet(0), Call(3), Simple(OpEnd)}, process.Body,
+		"the probe gets the original index, and the call follows helper")
+
+	index, ok := rewritten.ExportedFunction("process")
+	require.True(t, ok)
+	assert.EqualValues(t, 2, index)
+	assert.Equal(t, []byte{0x01, 0x70, 0x00, OpRefFunc, 0x03, OpEnd}, rewritten.rawSection(sectionGlobal).payload)
+	assert.Equal(t, []byte{0x01, 0x00, OpI32Const, 0x00, OpEnd, 0x01, 0x03}, rewritten.rawSection(sectionElement).payload)
+	names := rewritten.rawSection(sectionCustom).payload
+	assert.Equal(t, byte(0x03), names[len(names)-len("helper")-2], "the name section follows helper")
+}
+
+func TestFunction_EditsBody(t *testing.T) {
+	m, err := Parse(testModule())
+	require.NoError(t, err)
+	helper, err := m.Function(2)
+	require.NoError(t, err)
+
+	assert.EqualValues(t, 2, helper.AddLocal(I64), "locals follow the parameter and declared locals")
+	require.NoError(t, helper.Insert(1, LocalGet(1), Simple(OpDrop)))
+	require.NoError(t, helper.Replace(0, 1, I32Const(7)))
+	require.NoError(t, helper.Delete(1, 2))
+	assert.Equal(t, []Instruction{I32Const(7), Simple(OpEnd)}, helper.Body)
+
+	assert.EqualError(t, helper.Insert(9, Simple(OpNop)), "function 2: position 9 out of range")
+	assert.EqualError(t, helper.Delete(1, 2), "function 2: range 1+2 out of range")
+	_, err = m.Function(0)
+	assert.EqualError(t, err, "function 0 is imported")
+}
+
+func TestModule_AddsAndDeletesFunctions(t *testing.T) {
+	m, err := Parse(testModule())
+	require.NoError(t, err)
+
+	added := m.AddFunction(FuncType{Results: []ValType{I32}}, nil, []Instruction{I32Const(42)})
+	assert.EqualValues(t, 3, added.Index)
+	assert.EqualValues(t, 2, added.Type, "a new signature gets a new type")
+	require.NoError(t, m.AddExport("answer", KindFunc, added.Index))
+	require.NoError(t, m.DeleteFunction(2))
+
+	rewritten, err := Parse(m.Encode())
+	require.NoError(t, err)
+	index, ok := rewritten.ExportedFunction("answer")
+	require.True(t, ok)
+	answer, err := rewritten.Function(index)
+	require.NoError(t, err)
+	assert.Equal(t, []Instruction{I32Const(42), Simple(OpEnd)}, answer.Body)
+	helper, err := rewritten.Function(2)
+	require.NoError(t, err)
+	assert.Equal(t, []Instruction{Simple(OpUnreachable), Simple(OpEnd)}, helper.Body)
+	assert.Empty(t, helper.Locals)
+}
+
+func TestModule_AddsMissingSections(t *testing.T) {
+	m, err := Parse(header)
+	require.NoError(t, err)
+	m.AddFunction(FuncType{}, nil, nil)
+	_, err = m.AddFunctionImport("env", "hook", FuncType{})
+	require.NoError(t, err)
+
+	rewritten, err := Parse(m.Encode())
+	require.NoError(t, err)
+	require.Len(t, rewritten.Functions, 1)
+	assert.EqualValues(t, 1, rewritten.Functions[0].Index)
+	var ids []byte
+	for _, s := range rewritten.sections {
+		ids = append(ids, s.id)
+	}
+	assert.Equal(t, []byte{sectionType, sectionImport, sectionFunction, sectionCode}, ids)
+}
@@ -0,0 +1,71 @@
+package rewrite
+
+import "fmt"
+
+// HookType is the signature of trampoline hooks: they receive the index
+// the intercepted function had before the hook was imported, and return
+// zero to let the call through or anything else to make it trap
+var HookType = FuncType{Params: []ValType{I32}, Results: []ValType{I32}}
+
+// InjectTrampolines imports a hook function from module.name and routes
+// every direct call to the targets through a trampoline defined in the
+// module. The trampoline asks the hook, then traps or forwards its
+// arguments to the target and returns its results. Exports, tables and
+// ref.func keep referring to the targets, so only calls made inside the
+// module are intercepted. It returns the trampoline of each target, keyed
+// by the target's index before the rewrite.
+func InjectTrampolines(m *Module, module, name string, targets []uint32) (map[uint32]uint32, error) {
+	functions := m.importedFunctions() + uint32(len(m.Functions))
+	for _, target := range targets {
+		if target >= functions {
+			return nil, fmt.Errorf("no function %d", target)
+		}
+	}
+	hook, err := m.AddFunctionImport(module, name, HookType)
+	if err != nil {
+		return nil, err
+	}
+	shifted := func(index uint32) uint32 {
+		if index >= hook {
+			return index + 1
+		}
+		return index
+	}
+
+	callers := m.Functions
+	trampolines := make(map[uint32]uint32, len(targets))
+	redirect := make(map[uint32]uint32, len(targets))
+	for _, target := range targets {
+		if _, ok := trampolines[target]; ok {
+			continue
+		}
+		callee := shifted(target)
+		t, err := m.FuncType(callee)
+		if err != nil {
+			return nil, err
+		}
+		body := []Instruction{
+			I32Const(int32(target)), Call(hook),
+			{Op: OpIf, Imm: []byte{0x40}}, Simple(OpUnreachable), Simple(OpEnd),
+		}
+		for i := range t.Params {
+			body = append(body, LocalGet(uint32(i)))
+		}
+		f := m.AddFunction(t, nil, append(body, Call(callee)))
+		trampolines[target], redirect[callee] = f.Index, f.Index
+	}
+
+	for _, f := range callers {
+		for i, instr := range f.Body {
+			if instr.Op != OpCall && instr.Op != OpReturnCall {
+				continue
+			}
+			if index, ok := instr.FuncIndex(); ok {
+				if trampoline, ok := redirect[index]; ok {
+					f.Body[i] = instr.withFuncIndex(trampoline)
+				}
+			}
+		}
+	}
+	return trampolines, nil
+}
@@ -0,0 +1,62 @@
+//go:build !integration
+// +build !integration
+
+package rewrite
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// -----------------------------------------------------------------------------
+// TEST: Trampoline Injection
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Calls between a module's own functions never cross the host boundary,
+// so import-level fault injection cannot see them. Routing them through
+// trampolines that ask a host hook first makes each one interceptable,
+// as long as the trampoline forwards arguments and results untouched.
+// -----------------------------------------------------------------------------
+
+func TestInjectTrampolines_RoutesCallsThroughHook(t *testing.T) {
+	m, err := Parse(testModule())
+	require.NoError(t, err)
+
+	trampolines, err := InjectTrampolines(m, "hooks", "intercept", []uint32{2, 2})
+	require.NoError(t, err)
+	assert.Equal(t, map[uint32]uint32{2: 4}, trampolines)
+
+	rewritten, err := Parse(m.Encode())
+	require.NoError(t, err)
+	assert.Equal(t, HookType, rewritten.Types[rewritten.Imports[1].Type])
+
+	process, err := rewritten.Function(2)
+	require.NoError(t, err)
+	assert.Equal(t, []Instruction{LocalGet(0), Call(4), Simple(OpEnd)}, process.Body)
+
+	trampoline, err := rewritten.Function(4)
+	require.NoError(t, err)
+	helper, err := rewritten.Function(3)
+	require.NoError(t, err)
+	assert.Equal(t, helper.Type, trampoline.Type, "the trampoline has the target's signature")
+	assert.Equal(t, []Instruction{
+		I32Const(2), Call(1),
+		{Op: OpIf, Imm: []byte{0x40}}, Simple(OpUnreachable), Simple(OpEnd),
+		LocalGet(0), Call(3), Simple(OpEnd),
+	}, trampoline.Body)
+
+	// References other than calls still reach the target itself
+	assert.Equal(t, []byte{0x01, 0x00, OpI32Const, 0x00, OpEnd, 0x01, 0x03}, rewritten.rawSection(sectionElement).payload)
+}
+
+func TestInjectTrampolines_RejectsUnknownTargets(t *testing.T) {
+	m, err := Parse(testModule())
+	require.NoError(t, err)
+
+	_, err = InjectTrampolines(m, "hooks", "intercept", []uint32{3})
+	assert.EqualError(t, err, "no function 3")
+	assert.Len(t, m.Imports, 1, "a rejected rewrite leaves the module alone")
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mrhapile/WASM-Injection-Framework/pkg/property"
+)
+
+// PropertyConfig is a property of the module's behavior, checked over
+// generated arguments with pkg/property. It sets one of Deterministic and
+// RoundTrip.
+type PropertyConfig struct {
+	// Name labels the property in results; it defaults to the property
+	// stated, such as "process is deterministic"
+	Name string `yaml:"name"`
+	// Deterministic is an export that must give the same results, or the
+	// same error, when called twice with the same arguments
+	Deterministic string `yaml:"deterministic"`
+	// RoundTrip are exports whose composition must give back its arguments
+	RoundTrip *RoundTripConfig `yaml:"round_trip"`
+	// Trials is the number of generated argument lists, 100 when unset
+	Trials int `yaml:"trials"`
+	// Seed makes the arguments reproducible
+	Seed int64 `yaml:"seed"`
+}
+
+// RoundTripConfig claims decode(encode(x)) == x
+type RoundTripConfig struct {
+	Encode string `yaml:"encode"`
+	Decode string `yaml:"decode"`
+}
+
+// PropertyResult is the outcome of checking one property against a file
+type PropertyResult struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	Trials int    `json:"trials"`
+	// Counterexample is the smallest argument list found failing, with
+	// why it fails; Shrinks counts the smaller lists that still failed
+	Counterexample []WasmValue `json:"counterexample,omitempty"`
+	ErrorMessage   string      `json:"error_message,omitempty"`
+	Shrinks        int         `json:"shrinks,omitempty"`
+}
+
+// property builds the property a config states, with one generator per
+// parameter of the export it calls first
+func (c PropertyConfig) property(signatures map[string]FuncSignature) (property.Property, error) {
+	export := c.Deterministic
+	if c.RoundTrip != nil {
+		if export != "" {
+			return property.Property{}, fmt.Errorf("set one of deterministic and round_trip")
+		}
+		export = c.RoundTrip.Encode
+	}
+	if export == "" {
+		return property.Property{}, fmt.Errorf("set one of deterministic and round_trip")
+	}
+	signature, ok := signatures[export]
+	if !ok {
+		return property.Property{}, fmt.Errorf("module does not export '%s'", export)
+	}
+	var gens []property.Gen
+	for _, param := range signature.Params {
+		switch param {
+		case "i32":
+			gens = append(gens, property.Int32())
+		case "i64":
+			gens = append(gens, property.Int64())
+		default:
+			return property.Property{}, fmt.Errorf("'%s' takes %s; properties generate integer arguments only", export, signature)
+		}
+	}
+
+	var p property.Property
+	if c.RoundTrip != nil {
+		if _, ok := signatures[c.RoundTrip.Decode]; !ok {
+			return property.Property{}, fmt.Errorf("module does not export '%s'", c.RoundTrip.Decode)
+		}
+		p = property.RoundTrip(c.RoundTrip.Encode, c.RoundTrip.Decode, gens...)
+	} else {
+		p = property.Deterministic(c.Deterministic, gens...)
+	}
+	if c.Name != "" {
+		p.Name = c.Name
+	}
+	return p, nil
+}
+
+// propertyModule exposes a loaded module to properties
+type propertyModule struct {
+	module   WasmModule
+	coverage *coverageTracker
+}
+
+func (m propertyModule) Call(export string, args ...interface{}) ([]interface{}, error) {
+	results, err := m.module.Execute(export, args...)
+	m.coverage.collect(m.module)
+	return results, err
+}
+
+// checkProperties checks the configured properties against the module,
+// every trial from the post-setup state, and records their results.
+// *module is updated whenever the module is reloaded. The file fails with
+// the first property that does not hold.
+func checkProperties(result *ExecutionResult, module *WasmModule, filePath string, runtime WasmRuntime, plan InvocationConfig, configs []PropertyConfig, coverage *coverageTracker) {
+	if plan.ABI != "" {
+		result.FailureStage, result.ErrorMessage = StageSignature, fmt.Sprintf("properties do not support the %s ABI", plan.ABI)
+		return
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		result.FailureStage, result.ErrorMessage = StageLoad, fmt.Sprintf("load failed: %v", err)
+		return
+	}
+	signatures := exportSignatures(data)
+	properties := make([]property.Property, len(configs))
+	for i, config := range configs {
+		if properties[i], err = config.property(signatures); err != nil {
+			result.FailureStage, result.ErrorMessage = StageSignature, fmt.Sprintf("property %d: %v", i, err)
+			return
+		}
+	}
+
+	var snapshot *ModuleSnapshot
+	if stateful, ok := (*module).(StatefulModule); ok {
+		if snapshot, err = stateful.Snapshot(); err != nil {
+			result.FailureStage = StageExecute
+			result.ErrorMessage = fmt.Sprintf("snapshot failed: %v", err)
+			return
+		}
+	}
+	// The first trial runs the module as prepared, and every later one
+	// a reset module
+	first := true
+	instantiate := func() (property.Module, error) {
+		if !first {
+			var err error
+			if *module, err = resetModule(*module, snapshot, filePath, runtime, plan); err != nil {
+				return nil, err
+			}
+		}
+		first = false
+		return propertyModule{module: *module, coverage: coverage}, nil
+	}
+
+	result.Success = true
+	for i, p := range properties {
+		checked, err := property.Check(p, instantiate, property.Config{Trials: configs[i].Trials, Seed: configs[i].Seed})
+		if err != nil {
+			restoreFailed(result, err)
+			return
+		}
+		report := PropertyResult{Name: checked.Name, Passed: checked.Passed, Trials: checked.Trials, ErrorMessage: checked.Error, Shrinks: checked.Shrinks}
+		if !checked.Passed {
+			report.Counterexample = encodeValues(checked.Counterexample)
+			if result.Success {
+				result.Success = false
+				result.FailureStage = StageExecute
+				result.ErrorMessage = fmt.Sprintf("property '%s' fails for (%s): %s", report.Name, strings.Trim(describeArgs(report.Counterexample), "()"), report.ErrorMessage)
+			}
+		}
+		result.Properties = append(result.Properties, report)
+	}
+}
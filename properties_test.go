@@ -0,0 +1,78 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runProperties checks properties of fileAPIBinary against modules running
+// exports with the given function, counting the modules loaded
+func runProperties(t *testing.T, properties []PropertyConfig, execute func(funcName string, args ...interface{}) ([]interface{}, error)) (ExecutionResult, int) {
+	path := filepath.Join(t.TempDir(), "files.wasm")
+	require.NoError(t, os.WriteFile(path, fileAPIBinary(), 0o644))
+	loads := 0
+	runtime := &MockWasmRuntime{
+		LoadModuleFunc: func(filePath string) (WasmModule, error) {
+			loads++
+			return &MockWasmModule{ExecuteFunc: execute}, nil
+		},
+	}
+	return processWasmFileWithOptions(path, runtime, RunOptions{Properties: properties}), loads
+}
+
+// -----------------------------------------------------------------------------
+// TEST: Module Properties
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Checking a property over generated arguments catches the inputs nobody
+// thought to list, such as the one value a codec mangles. The runner must
+// give every trial a fresh module and report the shrunk counterexample.
+// -----------------------------------------------------------------------------
+
+func TestProperties_ReportsShrunkCounterexamples(t *testing.T) {
+	// close gives back its argument, except from 500 up
+	result, loads := runProperties(t, []PropertyConfig{
+		{Deterministic: "close", Trials: 20},
+		{Name: "close is its own inverse", RoundTrip: &RoundTripConfig{Encode: "close", Decode: "close"}, Seed: 9},
+	}, func(funcName string, args ...interface{}) ([]interface{}, error) {
+		if x := args[0].(int32); x >= 500 {
+			return []interface{}{x + 1}, nil
+		}
+		return args, nil
+	})
+
+	require.Len(t, result.Properties, 2)
+	assert.Equal(t, PropertyResult{Name: "close is deterministic", Passed: true, Trials: 20}, result.Properties[0])
+	failed := result.Properties[1]
+	assert.False(t, failed.Passed)
+	assert.Equal(t, []WasmValue{{Type: "i32", Value: "500"}}, failed.Counterexample)
+	assert.Equal(t, "got [502], want [500]", failed.ErrorMessage)
+
+	assert.False(t, result.Success)
+	assert.Equal(t, StageExecute, result.FailureStage)
+	assert.Equal(t, "property 'close is its own inverse' fails for (500): got [502], want [500]", result.ErrorMessage)
+	assert.Greater(t, loads, 20, "mock modules are reloaded for every trial")
+}
+
+func TestProperties_RejectsUnsupportedExports(t *testing.T) {
+	for _, config := range []PropertyConfig{
+		{Deterministic: "scale"},
+		{Deterministic: "seek"},
+		{RoundTrip: &RoundTripConfig{Encode: "close", Decode: "seek"}},
+		{Deterministic: "close", RoundTrip: &RoundTripConfig{Encode: "close", Decode: "close"}},
+		{},
+	} {
+		result, _ := runProperties(t, []PropertyConfig{config}, nil)
+		assert.False(t, result.Success)
+		assert.Equal(t, StageSignature, result.FailureStage)
+		assert.Contains(t, result.ErrorMessage, "property 0:")
+	}
+}
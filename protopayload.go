@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"unicode/utf8"
+)
+
+// Protobuf wire types. Groups are deprecated and not supported.
+const (
+	protoVarint  = 0
+	protoFixed64 = 1
+	protoBytes   = 2
+	protoFixed32 = 5
+)
+
+// maxProtoFieldNumber is the largest field number protobuf allows
+const maxProtoFieldNumber = 1<<29 - 1
+
+// interestingVarints are values at the boundaries of protobuf's integer
+// types, including negative int32s, which are encoded in ten bytes
+var interestingVarints = []uint64{
+	0, 1, 127, 128, 255, 16383, 16384, math.MaxInt32, math.MaxInt32 + 1, math.MaxUint32, math.MaxUint32 + 1,
+	math.MaxInt64, 1 << 63, math.MaxUint64, math.MaxUint64 - 1,
+}
+
+// protoField is one field of a protobuf message decoded without a schema.
+// Length-delimited payloads are kept as bytes, since strings, bytes,
+// packed repeated fields and nested messages share a wire type.
+type protoField struct {
+	Number   uint64
+	WireType int
+	// Value holds varint and fixed-width payloads
+	Value uint64
+	// Bytes holds length-delimited payloads
+	Bytes []byte
+}
+
+var errProtoTruncated = errors.New("truncated message")
+
+// parseProtoMessage decodes the fields of a wire-format message
+func parseProtoMessage(data []byte) ([]protoField, error) {
+	fields := []protoField{}
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, errProtoTruncated
+		}
+		data = data[n:]
+
+		field := protoField{Number: key >> 3, WireType: int(key & 7)}
+		if field.Number == 0 || field.Number > maxProtoFieldNumber {
+			return nil, fmt.Errorf("invalid field number %d", field.Number)
+		}
+		switch field.WireType {
+		case protoVarint:
+			field.Value, n = binary.Uvarint(data)
+			if n <= 0 {
+				return nil, errProtoTruncated
+			}
+			data = data[n:]
+		case protoFixed64:
+			if len(data) < 8 {
+				return nil, errProtoTruncated
+			}
+			field.Value, data = binary.LittleEndian.Uint64(data), data[8:]
+		case protoFixed32:
+			if len(data) < 4 {
+				return nil, errProtoTruncated
+			}
+			field.Value, data = uint64(binary.LittleEndian.Uint32(data)), data[4:]
+		case protoBytes:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || length > uint64(len(data)-n) {
+				return nil, errProtoTruncated
+			}
+			field.Bytes, data = data[n:n+int(length)], data[n+int(length):]
+		default:
+			return nil, fmt.Errorf("field %d has unsupported wire type %d", field.Number, field.WireType)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// appendProtoMessage encodes fields in wire format
+func appendProtoMessage(buf []byte, fields []protoField) []byte {
+	for _, field := range fields {
+		buf = binary.AppendUvarint(buf, field.Number<<3|uint64(field.WireType))
+		switch field.WireType {
+		case protoVarint:
+			buf = binary.AppendUvarint(buf, field.Value)
+		case protoFixed64:
+			buf = binary.LittleEndian.AppendUint64(buf, field.Value)
+		case protoFixed32:
+			buf = binary.LittleEndian.AppendUint32(buf, uint32(field.Value))
+		case protoBytes:
+			buf = binary.AppendUvarint(buf, uint64(len(field.Bytes)))
+			buf = append(buf, field.Bytes...)
+		}
+	}
+	return buf
+}
+
+// mutateProto changes one field's value or wire type, or adds, removes,
+// duplicates or reorders fields. Fields are never modified in place, since
+// corpus entries share them.
+func (m *payloadMutator) mutateProto(fields []protoField, depth int) []protoField {
+	out := append([]protoField(nil), fields...)
+	op := m.rng.Intn(8)
+	if len(out) == 0 {
+		op = 4
+	}
+	switch op {
+	case 0, 1, 2:
+		i := m.rng.Intn(len(out))
+		out[i] = m.mutateProtoField(out[i], depth)
+	case 3:
+		// Reinterpret a field with another wire type
+		i := m.rng.Intn(len(out))
+		out[i] = m.generateProtoField(out[i].Number)
+	case 4:
+		number := uint64(1 + m.rng.Intn(16))
+		if len(out) > 0 && m.rng.Intn(2) == 0 {
+			number = out[m.rng.Intn(len(out))].Number
+		} else if m.rng.Intn(8) == 0 {
+			number = maxProtoFieldNumber
+		}
+		i := m.rng.Intn(len(out) + 1)
+		out = append(out[:i], append([]protoField{m.generateProtoField(number)}, out[i:]...)...)
+	case 5:
+		i := m.rng.Intn(len(out))
+		out = append(out[:i], out[i+1:]...)
+	case 6:
+		// Repeated scalars are last-wins, repeated messages merge
+		out = append(out, out[m.rng.Intn(len(out))])
+	default:
+		i, j := m.rng.Intn(len(out)), m.rng.Intn(len(out))
+		out[i], out[j] = out[j], out[i]
+	}
+	return out
+}
+
+// mutateProtoField derives a new value for a field, mutating
+// length-delimited payloads that parse as messages as nested messages
+func (m *payloadMutator) mutateProtoField(field protoField, depth int) protoField {
+	switch field.WireType {
+	case protoVarint:
+		field.Value = m.mutateProtoInteger(field.Value, 64)
+	case protoFixed64:
+		field.Value = m.mutateProtoInteger(field.Value, 64)
+	case protoFixed32:
+		field.Value = m.mutateProtoInteger(field.Value, 32) & math.MaxUint32
+	case protoBytes:
+		if nested, err := parseProtoMessage(field.Bytes); err == nil && len(nested) > 0 && depth < maxPayloadDepth && m.rng.Intn(2) == 0 {
+			field.Bytes = appendProtoMessage(nil, m.mutateProto(nested, depth+1))
+		} else if utf8.Valid(field.Bytes) && m.rng.Intn(2) == 0 {
+			field.Bytes = []byte(string(m.mutateRunes([]rune(string(field.Bytes)))))
+		} else {
+			field.Bytes = m.mutateBytes(field.Bytes)
+		}
+	}
+	return field
+}
+
+// mutateProtoInteger flips a bit, adds a small delta or picks a boundary
+// value or module constant
+func (m *payloadMutator) mutateProtoInteger(v uint64, bits int) uint64 {
+	switch m.rng.Intn(3) {
+	case 0:
+		return v ^ 1<<uint(m.rng.Intn(bits))
+	case 1:
+		return v + uint64(m.rng.Intn(33)-16)
+	}
+	return m.protoInteger()
+}
+
+// protoInteger picks a boundary value, module constant or random value.
+// Constants are sign-extended, as protobuf encodes negative int32s.
+func (m *payloadMutator) protoInteger() uint64 {
+	switch m.rng.Intn(3) {
+	case 0:
+		return interestingVarints[m.rng.Intn(len(interestingVarints))]
+	case 1:
+		if len(m.numbers) > 0 {
+			return uint64(int64(m.numbers[m.rng.Intn(len(m.numbers))]))
+		}
+	}
+	return m.rng.Uint64() >> uint(m.rng.Intn(64))
+}
+
+// generateProtoField creates a field with a random wire type and value
+func (m *payloadMutator) generateProtoField(number uint64) protoField {
+	field := protoField{Number: number}
+	switch m.rng.Intn(4) {
+	case 0:
+		field.WireType, field.Value = protoVarint, m.protoInteger()
+	case 1:
+		field.WireType, field.Value = protoFixed64, m.protoInteger()
+	case 2:
+		field.WireType, field.Value = protoFixed32, m.protoInteger()&math.MaxUint32
+	default:
+		field.WireType, field.Bytes = protoBytes, []byte(m.text())
+	}
+	return field
+}
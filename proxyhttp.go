@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// headerPair is one header of a header map. Names are lowercase, as
+// proxy-wasm hosts present HTTP/2-style maps.
+type headerPair struct {
+	name, value string
+}
+
+// httpMessage is a request or response as a filter sees it: headers with
+// pseudo-headers first, then the body
+type httpMessage struct {
+	headers  []headerPair
+	body     []byte
+	trailers []headerPair
+}
+
+// parseHTTPRequest parses an HTTP/1.1 request. The Host header becomes
+// the :authority pseudo-header, and the body is everything after the
+// headers; Content-Length and chunked encoding are not interpreted.
+func parseHTTPRequest(data []byte) (*httpMessage, error) {
+	start, msg, err := splitHTTPMessage(data)
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(start)
+	if len(fields) != 3 || !strings.HasPrefix(fields[2], "HTTP/") {
+		return nil, fmt.Errorf("request line %q is not METHOD TARGET HTTP/VERSION", start)
+	}
+
+	authority := ""
+	headers := make([]headerPair, 0, len(msg.headers))
+	for _, header := range msg.headers {
+		if header.name == "host" && authority == "" {
+			authority = header.value
+			continue
+		}
+		headers = append(headers, header)
+	}
+	msg.headers = append([]headerPair{
+		{":authority", authority},
+		{":path", fields[1]},
+		{":method", fields[0]},
+		{":scheme", "http"},
+	}, headers...)
+	return msg, nil
+}
+
+// parseHTTPResponse parses an HTTP/1.1 response, whose status code becomes
+// the :status pseudo-header
+func parseHTTPResponse(data []byte) (*httpMessage, error) {
+	start, msg, err := splitHTTPMessage(data)
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(start)
+	if len(fields) < 2 || !strings.HasPrefix(fields[0], "HTTP/") || len(fields[1]) != 3 {
+		return nil, fmt.Errorf("status line %q is not HTTP/VERSION STATUS [REASON]", start)
+	}
+	if _, err := strconv.Atoi(fields[1]); err != nil {
+		return nil, fmt.Errorf("status line %q is not HTTP/VERSION STATUS [REASON]", start)
+	}
+	msg.headers = append([]headerPair{{":status", fields[1]}}, msg.headers...)
+	return msg, nil
+}
+
+// splitHTTPMessage splits a message into its start line, headers and body.
+// Lines may end in CRLF or LF.
+func splitHTTPMessage(data []byte) (string, *httpMessage, error) {
+	head, body := data, []byte(nil)
+	for _, separator := range []string{"\r\n\r\n", "\n\n"} {
+		if i := bytes.Index(data, []byte(separator)); i >= 0 && i < len(head) {
+			head, body = data[:i], data[i+len(separator):]
+		}
+	}
+	if len(bytes.TrimSpace(head)) == 0 {
+		return "", nil, errors.New("empty message")
+	}
+
+	lines := strings.Split(string(head), "\n")
+	msg := &httpMessage{body: append([]byte(nil), body...)}
+	for _, line := range lines[1:] {
+		line = strings.TrimSuffix(line, "\r")
+		colon := strings.IndexByte(line, ':')
+		if colon <= 0 {
+			return "", nil, fmt.Errorf("header line %q is not NAME: VALUE", line)
+		}
+		msg.headers = append(msg.headers, headerPair{
+			name:  strings.ToLower(strings.TrimSpace(line[:colon])),
+			value: strings.TrimSpace(line[colon+1:]),
+		})
+	}
+	return strings.TrimSuffix(lines[0], "\r"), msg, nil
+}
+
+// clone copies a message, so filters modifying it leave the original as
+// configured
+func (m *httpMessage) clone() *httpMessage {
+	return &httpMessage{
+		headers:  append([]headerPair(nil), m.headers...),
+		body:     append([]byte(nil), m.body...),
+		trailers: append([]headerPair(nil), m.trailers...),
+	}
+}
+
+// status returns the :status of a response, or 0 if it is not a number
+func (m *httpMessage) status() int32 {
+	value, _ := headerValue(m.headers, ":status")
+	status, err := strconv.Atoi(value)
+	if err != nil {
+		return 0
+	}
+	return int32(status)
+}
+
+// headerValue returns a header's values joined with commas, as hosts
+// present repeated headers
+func headerValue(headers []headerPair, name string) (string, bool) {
+	var values []string
+	for _, header := range headers {
+		if header.name == name {
+			values = append(values, header.value)
+		}
+	}
+	return strings.Join(values, ","), len(values) > 0
+}
+
+// replaceHeader sets a header to a single value in the position of its
+// first occurrence, appending it if absent
+func replaceHeader(headers []headerPair, name, value string) []headerPair {
+	out := make([]headerPair, 0, len(headers)+1)
+	replaced := false
+	for _, header := range headers {
+		switch {
+		case header.name != name:
+			out = append(out, header)
+		case !replaced:
+			out = append(out, headerPair{name, value})
+			replaced = true
+		}
+	}
+	if !replaced {
+		out = append(out, headerPair{name, value})
+	}
+	return out
+}
+
+// removeHeader drops every value of a header
+func removeHeader(headers []headerPair, name string) []headerPair {
+	out := make([]headerPair, 0, len(headers))
+	for _, header := range headers {
+		if header.name != name {
+			out = append(out, header)
+		}
+	}
+	return out
+}
+
+// serializeHeaderMap encodes a header map as proxy-wasm passes it: the pair
+// count, the length of every name and value, then the names and values,
+// each followed by a NUL
+func serializeHeaderMap(headers []headerPair) []byte {
+	buf := binary.LittleEndian.AppendUint32(nil, uint32(len(headers)))
+	for _, header := range headers {
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(header.name)))
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(header.value)))
+	}
+	for _, header := range headers {
+		buf = append(append(buf, header.name...), 0)
+		buf = append(append(buf, header.value...), 0)
+	}
+	return buf
+}
+
+var errHeaderMapTruncated = errors.New("truncated header map")
+
+// proxyMaxHeaders caps the pairs of one serialized header map
+const proxyMaxHeaders = 1 << 14
+
+// parseHeaderMap decodes a serialized header map
+func parseHeaderMap(data []byte) ([]headerPair, error) {
+	if len(data) < 4 {
+		return nil, errHeaderMapTruncated
+	}
+	n := binary.LittleEndian.Uint32(data)
+	if n > proxyMaxHeaders {
+		return nil, fmt.Errorf("%d headers exceed the limit of %d", n, proxyMaxHeaders)
+	}
+	// Each pair takes two sizes and two terminators at least
+	if uint64(n)*10 > uint64(len(data)-4) {
+		return nil, errHeaderMapTruncated
+	}
+	sizes, rest := data[4:4+n*8], data[4+n*8:]
+
+	headers := make([]headerPair, n)
+	for i := range headers {
+		var fields [2]string
+		for j := range fields {
+			size := uint64(binary.LittleEndian.Uint32(sizes[i*8+j*4:]))
+			if size >= uint64(len(rest)) || rest[size] != 0 {
+				return nil, errHeaderMapTruncated
+			}
+			fields[j], rest = string(rest[:size]), rest[size+1:]
+		}
+		headers[i] = headerPair{name: strings.ToLower(fields[0]), value: fields[1]}
+	}
+	return headers, nil
+}
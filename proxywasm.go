@@ -0,0 +1,864 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ABIProxyWasm runs modules as proxy-wasm HTTP filters, the plugin ABI of
+// Envoy and Istio
+const ABIProxyWasm = "proxy-wasm"
+
+// proxyWasmModule is the import module of the proxy-wasm host functions
+const proxyWasmModule = "env"
+
+// proxyRootContext is the id of the plugin's root context; stream
+// contexts are numbered after it
+const proxyRootContext = 1
+
+// proxy-wasm status codes returned by host functions
+const (
+	proxyOK                  = 0
+	proxyNotFound            = 1
+	proxyBadArgument         = 2
+	proxyInvalidMemoryAccess = 6
+	proxyEmpty               = 7
+	proxyCASMismatch         = 8
+	proxyUnimplemented       = 12
+)
+
+// proxy-wasm buffer types
+const (
+	proxyRequestBody         = 0
+	proxyResponseBody        = 1
+	proxyVMConfiguration     = 6
+	proxyPluginConfiguration = 7
+)
+
+// proxy-wasm header map types
+const (
+	proxyRequestHeaders   = 0
+	proxyRequestTrailers  = 1
+	proxyResponseHeaders  = 2
+	proxyResponseTrailers = 3
+)
+
+// proxyLogLevel is the log level reported to filters, Envoy's default of
+// info
+const proxyLogLevel = 2
+
+// proxyABIVersions are the marker exports of the supported ABI versions
+var proxyABIVersions = []string{"proxy_abi_version_0_2_1", "proxy_abi_version_0_2_0", "proxy_abi_version_0_1_0"}
+
+// defaultProxyRequest is the request sent through filters without inputs
+const defaultProxyRequest = "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"
+
+// defaultProxyResponse is the upstream response when none is configured
+const defaultProxyResponse = "HTTP/1.1 200 OK\r\n\r\n"
+
+// ProxyWasmConfig configures the host proxy-wasm filters run against
+type ProxyWasmConfig struct {
+	// VMConfig and PluginConfig are the configurations passed to
+	// proxy_on_vm_start and proxy_on_configure
+	VMConfig     string `yaml:"vm_config"`
+	PluginConfig string `yaml:"plugin_config"`
+	// Properties are returned by proxy_get_property, keyed by the path's
+	// segments joined with dots, e.g. "node.id"
+	Properties map[string]string `yaml:"properties"`
+	// Response is the upstream's HTTP/1.1 response to every request
+	Response string `yaml:"response"`
+}
+
+// proxyWasmHost tracks the host state of the filter instance currently
+// loaded
+type proxyWasmHost struct {
+	config ProxyWasmConfig
+	kernel *proxyWasmKernel
+}
+
+// rewind restores the host state of the post-setup snapshot
+func (h *proxyWasmHost) rewind() {
+	if h != nil && h.kernel != nil {
+		h.kernel.state = h.kernel.baseline.clone()
+	}
+}
+
+// proxyWasmState is the host state that outlives a stream
+type proxyWasmState struct {
+	nextContext int32
+	properties  map[string]string
+	shared      map[string]proxySharedData
+	queues      map[string]int32
+	queued      map[int32][][]byte
+	metrics     map[string]int32
+	values      map[int32]uint64
+}
+
+// proxySharedData is a shared data entry and its compare-and-swap version
+type proxySharedData struct {
+	value []byte
+	cas   uint32
+}
+
+func newProxyWasmState() proxyWasmState {
+	return proxyWasmState{
+		nextContext: proxyRootContext + 1,
+		properties:  map[string]string{},
+		shared:      map[string]proxySharedData{},
+		queues:      map[string]int32{},
+		queued:      map[int32][][]byte{},
+		metrics:     map[string]int32{},
+		values:      map[int32]uint64{},
+	}
+}
+
+// clone copies the state. Values are never modified in place, so they
+// are shared.
+func (s proxyWasmState) clone() proxyWasmState {
+	c := newProxyWasmState()
+	c.nextContext = s.nextContext
+	for k, v := range s.properties {
+		c.properties[k] = v
+	}
+	for k, v := range s.shared {
+		c.shared[k] = v
+	}
+	for k, v := range s.queues {
+		c.queues[k] = v
+	}
+	for k, v := range s.queued {
+		c.queued[k] = append([][]byte(nil), v...)
+	}
+	for k, v := range s.metrics {
+		c.metrics[k] = v
+	}
+	for k, v := range s.values {
+		c.values[k] = v
+	}
+	return c
+}
+
+// proxyWasmKernel implements the proxy-wasm host functions for one filter
+// instance. Data is returned to the filter in memory it allocates with
+// proxy_on_memory_allocate, so host functions call back into the module.
+type proxyWasmKernel struct {
+	config   ProxyWasmConfig
+	memory   *hostMemory
+	wasi     *minimalWASI
+	module   WasmModule
+	alloc    string
+	state    proxyWasmState
+	baseline proxyWasmState
+
+	// request and response are the messages of the current stream, and
+	// local the response a filter sent in their place
+	request, response, local *httpMessage
+}
+
+func newProxyWasmKernel(config ProxyWasmConfig) *proxyWasmKernel {
+	memory := &hostMemory{}
+	return &proxyWasmKernel{
+		config: config,
+		memory: memory,
+		wasi:   newMinimalWASI(memory),
+		alloc:  "proxy_on_memory_allocate",
+		state:  newProxyWasmState(),
+	}
+}
+
+// allocate reserves memory in the filter for data returned to it
+func (k *proxyWasmKernel) allocate(size int) (uint64, error) {
+	returns, err := k.module.Execute(k.alloc, int32(size))
+	if err != nil {
+		_, message := classifyError(err, StageExecute, "execution failed")
+		return 0, fmt.Errorf("allocator '%s' failed: %s", k.alloc, message)
+	}
+	if len(returns) != 1 {
+		return 0, fmt.Errorf("allocator '%s' returned %d values", k.alloc, len(returns))
+	}
+	ptr, ok := returns[0].(int32)
+	if !ok || ptr == 0 {
+		return 0, fmt.Errorf("allocator '%s' could not allocate %d bytes", k.alloc, size)
+	}
+	return uint64(uint32(ptr)), nil
+}
+
+// returnBytes copies data into the filter and stores its address and size
+// at the given pointers. Empty data is returned as a null pointer.
+func (k *proxyWasmKernel) returnBytes(data []byte, dataPtr, sizePtr uint64) ([]interface{}, error) {
+	var ptr uint64
+	if len(data) > 0 {
+		var err error
+		ptr, err = k.allocate(len(data))
+		if err != nil {
+			return nil, err
+		}
+		if k.memory.write(ptr, data) != nil {
+			return proxyStatus(proxyInvalidMemoryAccess), nil
+		}
+	}
+	if k.memory.writeU32(dataPtr, uint32(ptr)) != nil || k.memory.writeU32(sizePtr, uint32(len(data))) != nil {
+		return proxyStatus(proxyInvalidMemoryAccess), nil
+	}
+	return proxyStatus(proxyOK), nil
+}
+
+// proxyStatus is the result of a host function returning a status code
+func proxyStatus(code int32) []interface{} {
+	return []interface{}{code}
+}
+
+// headerMap returns the header map of the given type in the current
+// stream, or nil if it has none
+func (k *proxyWasmKernel) headerMap(mapType uint64) *[]headerPair {
+	message := k.request
+	if mapType == proxyResponseHeaders || mapType == proxyResponseTrailers {
+		message = k.response
+	}
+	if message == nil {
+		return nil
+	}
+	switch mapType {
+	case proxyRequestHeaders, proxyResponseHeaders:
+		return &message.headers
+	case proxyRequestTrailers, proxyResponseTrailers:
+		return &message.trailers
+	}
+	return nil
+}
+
+// buffer returns the buffer of the given type, and whether filters can
+// modify it
+func (k *proxyWasmKernel) buffer(bufferType uint64) (*[]byte, bool) {
+	switch bufferType {
+	case proxyRequestBody:
+		if k.request != nil {
+			return &k.request.body, true
+		}
+	case proxyResponseBody:
+		if k.response != nil {
+			return &k.response.body, true
+		}
+	case proxyVMConfiguration:
+		config := []byte(k.config.VMConfig)
+		return &config, false
+	case proxyPluginConfiguration:
+		config := []byte(k.config.PluginConfig)
+		return &config, false
+	}
+	return nil, false
+}
+
+// property looks up a property set by the filter, describing the current
+// stream, or configured
+func (k *proxyWasmKernel) property(path string) (string, bool) {
+	if value, ok := k.state.properties[path]; ok {
+		return value, true
+	}
+	if k.request != nil {
+		pseudo := map[string]string{
+			"request.path":   ":path",
+			"request.host":   ":authority",
+			"request.method": ":method",
+			"request.scheme": ":scheme",
+		}
+		if name, ok := pseudo[path]; ok {
+			return headerValue(k.request.headers, name)
+		}
+		if path == "request.protocol" {
+			return "HTTP/1.1", true
+		}
+	}
+	if k.response != nil && path == "response.code" {
+		return headerValue(k.response.headers, ":status")
+	}
+	value, ok := k.config.Properties[path]
+	return value, ok
+}
+
+// functions returns the proxy-wasm host functions by name
+func (k *proxyWasmKernel) functions() map[string]nativeFunction {
+	read := func(ptr, size uint64) (string, bool) {
+		data, err := k.memory.read(ptr, size)
+		return string(data), err == nil
+	}
+	ok := func(args []uint64) ([]interface{}, error) { return proxyStatus(proxyOK), nil }
+	// headerOp applies a change to a header map named by its first argument
+	headerOp := func(change func(headers []headerPair, name, value string) []headerPair) func(args []uint64) ([]interface{}, error) {
+		return func(args []uint64) ([]interface{}, error) {
+			headers := k.headerMap(args[0])
+			if headers == nil {
+				return proxyStatus(proxyBadArgument), nil
+			}
+			name, found := read(args[1], args[2])
+			value := ""
+			if len(args) == 5 {
+				var valueFound bool
+				value, valueFound = read(args[3], args[4])
+				found = found && valueFound
+			}
+			if !found {
+				return proxyStatus(proxyInvalidMemoryAccess), nil
+			}
+			*headers = change(*headers, strings.ToLower(name), value)
+			return proxyStatus(proxyOK), nil
+		}
+	}
+
+	return map[string]nativeFunction{
+		"proxy_log": {funcSig("i32 i32 i32", "i32"), func(args []uint64) ([]interface{}, error) {
+			// Messages are discarded, but must be readable
+			if _, found := read(args[1], args[2]); !found {
+				return proxyStatus(proxyInvalidMemoryAccess), nil
+			}
+			return proxyStatus(proxyOK), nil
+		}},
+		"proxy_get_log_level": {funcSig("i32", "i32"), func(args []uint64) ([]interface{}, error) {
+			if k.memory.writeU32(args[0], proxyLogLevel) != nil {
+				return proxyStatus(proxyInvalidMemoryAccess), nil
+			}
+			return proxyStatus(proxyOK), nil
+		}},
+		"proxy_get_current_time_nanoseconds": {funcSig("i32", "i32"), func(args []uint64) ([]interface{}, error) {
+			if k.memory.writeU64(args[0], wasiClock) != nil {
+				return proxyStatus(proxyInvalidMemoryAccess), nil
+			}
+			return proxyStatus(proxyOK), nil
+		}},
+		"proxy_set_tick_period_milliseconds": {funcSig("i32", "i32"), ok},
+		"proxy_get_property": {funcSig("i32 i32 i32 i32", "i32"), func(args []uint64) ([]interface{}, error) {
+			path, found := read(args[0], args[1])
+			if !found {
+				return proxyStatus(proxyInvalidMemoryAccess), nil
+			}
+			value, found := k.property(strings.Join(strings.FieldsFunc(path, func(r rune) bool { return r == 0 }), "."))
+			if !found {
+				return proxyStatus(proxyNotFound), nil
+			}
+			return k.returnBytes([]byte(value), args[2], args[3])
+		}},
+		"proxy_set_property": {funcSig("i32 i32 i32 i32", "i32"), func(args []uint64) ([]interface{}, error) {
+			path, pathFound := read(args[0], args[1])
+			value, valueFound := read(args[2], args[3])
+			if !pathFound || !valueFound {
+				return proxyStatus(proxyInvalidMemoryAccess), nil
+			}
+			k.state.properties[strings.Join(strings.FieldsFunc(path, func(r rune) bool { return r == 0 }), ".")] = value
+			return proxyStatus(proxyOK), nil
+		}},
+		"proxy_get_buffer_bytes": {funcSig("i32 i32 i32 i32 i32", "i32"), func(args []uint64) ([]interface{}, error) {
+			buffer, _ := k.buffer(args[0])
+			if buffer == nil {
+				return proxyStatus(proxyNotFound), nil
+			}
+			start, end := args[1], args[1]+args[2]
+			if start > uint64(len(*buffer)) {
+				return proxyStatus(proxyBadArgument), nil
+			}
+			if end > uint64(len(*buffer)) {
+				end = uint64(len(*buffer))
+			}
+			return k.returnBytes((*buffer)[start:end], args[3], args[4])
+		}},
+		"proxy_set_buffer_bytes": {funcSig("i32 i32 i32 i32 i32", "i32"), func(args []uint64) ([]interface{}, error) {
+			buffer, writable := k.buffer(args[0])
+			if buffer == nil || !writable {
+				return proxyStatus(proxyBadArgument), nil
+			}
+			data, err := k.memory.read(args[3], args[4])
+			if err != nil {
+				return proxyStatus(proxyInvalidMemoryAccess), nil
+			}
+			start, end := args[1], args[1]+args[2]
+			if start > uint64(len(*buffer)) {
+				return proxyStatus(proxyBadArgument), nil
+			}
+			if end > uint64(len(*buffer)) {
+				end = uint64(len(*buffer))
+			}
+			*buffer = append(append(append([]byte(nil), (*buffer)[:start]...), data...), (*buffer)[end:]...)
+			return proxyStatus(proxyOK), nil
+		}},
+		"proxy_get_header_map_pairs": {funcSig("i32 i32 i32", "i32"), func(args []uint64) ([]interface{}, error) {
+			headers := k.headerMap(args[0])
+			if headers == nil {
+				return proxyStatus(proxyBadArgument), nil
+			}
+			return k.returnBytes(serializeHeaderMap(*headers), args[1], args[2])
+		}},
+		"proxy_set_header_map_pairs": {funcSig("i32 i32 i32", "i32"), func(args []uint64) ([]interface{}, error) {
+			headers := k.headerMap(args[0])
+			if headers == nil {
+				return proxyStatus(proxyBadArgument), nil
+			}
+			data, err := k.memory.read(args[1], args[2])
+			if err != nil {
+				return proxyStatus(proxyInvalidMemoryAccess), nil
+			}
+			pairs, err := parseHeaderMap(data)
+			if err != nil {
+				return proxyStatus(proxyBadArgument), nil
+			}
+			*headers = pairs
+			return proxyStatus(proxyOK), nil
+		}},
+		"proxy_get_header_map_size": {funcSig("i32 i32", "i32"), func(args []uint64) ([]interface{}, error) {
+			headers := k.headerMap(args[0])
+			if headers == nil {
+				return proxyStatus(proxyBadArgument), nil
+			}
+			if k.memory.writeU32(args[1], uint32(len(serializeHeaderMap(*headers)))) != nil {
+				return proxyStatus(proxyInvalidMemoryAccess), nil
+			}
+			return proxyStatus(proxyOK), nil
+		}},
+		"proxy_get_header_map_value": {funcSig("i32 i32 i32 i32 i32", "i32"), func(args []uint64) ([]interface{}, error) {
+			headers := k.headerMap(args[0])
+			if headers == nil {
+				return proxyStatus(proxyBadArgument), nil
+			}
+			name, found := read(args[1], args[2])
+			if !found {
+				return proxyStatus(proxyInvalidMemoryAccess), nil
+			}
+			value, found := headerValue(*headers, strings.ToLower(name))
+			if !found {
+				return proxyStatus(proxyNotFound), nil
+			}
+			return k.returnBytes([]byte(value), args[3], args[4])
+		}},
+		"proxy_add_header_map_value": {funcSig("i32 i32 i32 i32 i32", "i32"), headerOp(func(headers []headerPair, name, value string) []headerPair {
+			return append(headers, headerPair{name, value})
+		})},
+		"proxy_replace_header_map_value": {funcSig("i32 i32 i32 i32 i32", "i32"), headerOp(replaceHeader)},
+		"proxy_remove_header_map_value": {funcSig("i32 i32 i32", "i32"), headerOp(func(headers []headerPair, name, _ string) []headerPair {
+			return removeHeader(headers, name)
+		})},
+		"proxy_continue_stream":       {funcSig("i32", "i32"), ok},
+		"proxy_close_stream":          {funcSig("i32", "i32"), ok},
+		"proxy_continue_request":      {funcSig("", "i32"), ok},
+		"proxy_continue_response":     {funcSig("", "i32"), ok},
+		"proxy_clear_route_cache":     {funcSig("", "i32"), ok},
+		"proxy_done":                  {funcSig("", "i32"), ok},
+		"proxy_set_effective_context": {funcSig("i32", "i32"), ok},
+		"proxy_send_local_response": {funcSig("i32 i32 i32 i32 i32 i32 i32 i32", "i32"), func(args []uint64) ([]interface{}, error) {
+			if k.request == nil {
+				return proxyStatus(proxyBadArgument), nil
+			}
+			body, err := k.memory.read(args[3], args[4])
+			if err != nil {
+				return proxyStatus(proxyInvalidMemoryAccess), nil
+			}
+			headers := []headerPair{}
+			if args[6] > 0 {
+				data, err := k.memory.read(args[5], args[6])
+				if err != nil {
+					return proxyStatus(proxyInvalidMemoryAccess), nil
+				}
+				if headers, err = parseHeaderMap(data); err != nil {
+					return proxyStatus(proxyBadArgument), nil
+				}
+			}
+			status := headerPair{":status", fmt.Sprint(uint32(args[0]))}
+			k.local = &httpMessage{headers: append([]headerPair{status}, headers...), body: body}
+			return proxyStatus(proxyOK), nil
+		}},
+		"proxy_http_call": {funcSig("i32 i32 i32 i32 i32 i32 i32 i32 i32 i32", "i32"), func(args []uint64) ([]interface{}, error) {
+			// No upstream clusters are configured, and Envoy rejects calls
+			// to unknown clusters
+			return proxyStatus(proxyBadArgument), nil
+		}},
+		"proxy_get_shared_data": {funcSig("i32 i32 i32 i32 i32", "i32"), func(args []uint64) ([]interface{}, error) {
+			key, found := read(args[0], args[1])
+			if !found {
+				return proxyStatus(proxyInvalidMemoryAccess), nil
+			}
+			entry, found := k.state.shared[key]
+			if !found {
+				return proxyStatus(proxyNotFound), nil
+			}
+			if k.memory.writeU32(args[4], entry.cas) != nil {
+				return proxyStatus(proxyInvalidMemoryAccess), nil
+			}
+			return k.returnBytes(entry.value, args[2], args[3])
+		}},
+		"proxy_set_shared_data": {funcSig("i32 i32 i32 i32 i32", "i32"), func(args []uint64) ([]interface{}, error) {
+			key, keyFound := read(args[0], args[1])
+			value, valueFound := read(args[2], args[3])
+			if !keyFound || !valueFound {
+				return proxyStatus(proxyInvalidMemoryAccess), nil
+			}
+			entry := k.state.shared[key]
+			if args[4] != 0 && uint32(args[4]) != entry.cas {
+				return proxyStatus(proxyCASMismatch), nil
+			}
+			k.state.shared[key] = proxySharedData{value: []byte(value), cas: entry.cas + 1}
+			return proxyStatus(proxyOK), nil
+		}},
+		"proxy_register_shared_queue": {funcSig("i32 i32 i32", "i32"), func(args []uint64) ([]interface{}, error) {
+			name, found := read(args[0], args[1])
+			if !found {
+				return proxyStatus(proxyInvalidMemoryAccess), nil
+			}
+			id, exists := k.state.queues[name]
+			if !exists {
+				id = int32(len(k.state.queues) + 1)
+				k.state.queues[name] = id
+			}
+			if k.memory.writeU32(args[2], uint32(id)) != nil {
+				return proxyStatus(proxyInvalidMemoryAccess), nil
+			}
+			return proxyStatus(proxyOK), nil
+		}},
+		"proxy_resolve_shared_queue": {funcSig("i32 i32 i32 i32 i32", "i32"), func(args []uint64) ([]interface{}, error) {
+			name, found := read(args[2], args[3])
+			if !found {
+				return proxyStatus(proxyInvalidMemoryAccess), nil
+			}
+			id, exists := k.state.queues[name]
+			if !exists {
+				return proxyStatus(proxyNotFound), nil
+			}
+			if k.memory.writeU32(args[4], uint32(id)) != nil {
+				return proxyStatus(proxyInvalidMemoryAccess), nil
+			}
+			return proxyStatus(proxyOK), nil
+		}},
+		"proxy_enqueue_shared_queue": {funcSig("i32 i32 i32", "i32"), func(args []uint64) ([]interface{}, error) {
+			if args[0] == 0 || args[0] > uint64(len(k.state.queues)) {
+				return proxyStatus(proxyNotFound), nil
+			}
+			data, err := k.memory.read(args[1], args[2])
+			if err != nil {
+				return proxyStatus(proxyInvalidMemoryAccess), nil
+			}
+			id := int32(args[0])
+			k.state.queued[id] = append(k.state.queued[id], data)
+			return proxyStatus(proxyOK), nil
+		}},
+		"proxy_dequeue_shared_queue": {funcSig("i32 i32 i32", "i32"), func(args []uint64) ([]interface{}, error) {
+			if args[0] == 0 || args[0] > uint64(len(k.state.queues)) {
+				return proxyStatus(proxyNotFound), nil
+			}
+			id := int32(args[0])
+			queued := k.state.queued[id]
+			if len(queued) == 0 {
+				return proxyStatus(proxyEmpty), nil
+			}
+			k.state.queued[id] = queued[1:]
+			return k.returnBytes(queued[0], args[1], args[2])
+		}},
+		"proxy_define_metric": {funcSig("i32 i32 i32 i32", "i32"), func(args []uint64) ([]interface{}, error) {
+			name, found := read(args[1], args[2])
+			if !found {
+				return proxyStatus(proxyInvalidMemoryAccess), nil
+			}
+			id, exists := k.state.metrics[name]
+			if !exists {
+				id = int32(len(k.state.metrics) + 1)
+				k.state.metrics[name] = id
+			}
+			if k.memory.writeU32(args[3], uint32(id)) != nil {
+				return proxyStatus(proxyInvalidMemoryAccess), nil
+			}
+			return proxyStatus(proxyOK), nil
+		}},
+		"proxy_increment_metric": {funcSig("i32 i64", "i32"), func(args []uint64) ([]interface{}, error) {
+			if args[0] == 0 || args[0] > uint64(len(k.state.metrics)) {
+				return proxyStatus(proxyNotFound), nil
+			}
+			k.state.values[int32(args[0])] += args[1]
+			return proxyStatus(proxyOK), nil
+		}},
+		"proxy_record_metric": {funcSig("i32 i64", "i32"), func(args []uint64) ([]interface{}, error) {
+			if args[0] == 0 || args[0] > uint64(len(k.state.metrics)) {
+				return proxyStatus(proxyNotFound), nil
+			}
+			k.state.values[int32(args[0])] = args[1]
+			return proxyStatus(proxyOK), nil
+		}},
+		"proxy_get_metric": {funcSig("i32 i32", "i32"), func(args []uint64) ([]interface{}, error) {
+			if args[0] == 0 || args[0] > uint64(len(k.state.metrics)) {
+				return proxyStatus(proxyNotFound), nil
+			}
+			if k.memory.writeU64(args[1], k.state.values[int32(args[0])]) != nil {
+				return proxyStatus(proxyInvalidMemoryAccess), nil
+			}
+			return proxyStatus(proxyOK), nil
+		}},
+	}
+}
+
+// link resolves a filter's imports: proxy-wasm host functions to the
+// kernel and the minimal WASI subset. Other proxy_ functions, such as
+// gRPC calls, are stubs returning Unimplemented, since SDKs import them
+// whether or not a filter uses them.
+func (k *proxyWasmKernel) link(imports []wasmFuncImport) ([]HostFunction, error) {
+	host, err := k.wasi.link(imports)
+	if err != nil {
+		return nil, err
+	}
+
+	functions := k.functions()
+	for _, imp := range imports {
+		if imp.Module != proxyWasmModule || !strings.HasPrefix(imp.Name, "proxy_") {
+			continue
+		}
+		fn, ok := functions[imp.Name]
+		if !ok {
+			results := proxyStatus(proxyUnimplemented)
+			if strings.Join(imp.Signature.Results, " ") != "i32" {
+				if results, err = zeroResults(imp.Signature); err != nil {
+					return nil, fmt.Errorf("host function '%s': %v", imp.Name, err)
+				}
+			}
+			host = append(host, stubFunction(imp, results))
+			continue
+		}
+		bound, err := fn.bind(imp)
+		if err != nil {
+			return nil, err
+		}
+		host = append(host, bound)
+	}
+	return host, nil
+}
+
+// callback calls a filter callback with the given context arguments.
+// Callbacks the filter does not export are skipped, and arguments beyond
+// the export's parameters are dropped, since older ABI versions pass fewer.
+// Failures are attributed to the callback, so crashes are classified by
+// the event that caused them.
+func proxyCallback(module WasmModule, name string, args ...int32) (int32, error) {
+	if typed, ok := module.(SignatureModule); ok {
+		signature, found := typed.Signature(name)
+		if !found {
+			return 0, nil
+		}
+		if len(signature.Params) < len(args) {
+			args = args[:len(signature.Params)]
+		}
+	}
+
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = arg
+	}
+	returns, err := module.Execute(name, values...)
+	if err != nil {
+		stage, message := classifyError(err, StageExecute, "execution failed")
+		return 0, &RuntimeError{Stage: stage, Message: fmt.Sprintf("%s: %s", name, message)}
+	}
+	if len(returns) == 1 {
+		if v, ok := returns[0].(int32); ok {
+			return v, nil
+		}
+	}
+	return 0, nil
+}
+
+// start initializes a filter instance: the WASI reactor or command
+// initializer, then the root context, which receives the VM and plugin
+// configurations. Filters reject a configuration by returning false.
+func (k *proxyWasmKernel) start(module WasmModule) error {
+	if typed, ok := module.(SignatureModule); ok {
+		marked := false
+		for _, version := range proxyABIVersions {
+			if _, found := typed.Signature(version); found {
+				marked = true
+			}
+		}
+		if !marked {
+			return &RuntimeError{Stage: StageSignature, Message: "proxy-wasm: module exports no proxy_abi_version_* marker"}
+		}
+		if _, found := typed.Signature(k.alloc); !found {
+			k.alloc = "malloc"
+		}
+		for _, initializer := range []string{"_initialize", "_start"} {
+			if _, found := typed.Signature(initializer); found {
+				if _, err := proxyCallback(module, initializer); err != nil {
+					return err
+				}
+				break
+			}
+		}
+	}
+
+	if _, err := proxyCallback(module, "proxy_on_context_create", proxyRootContext, 0); err != nil {
+		return err
+	}
+	starts := []struct {
+		callback, config string
+	}{
+		{"proxy_on_vm_start", k.config.VMConfig},
+		{"proxy_on_configure", k.config.PluginConfig},
+	}
+	for _, start := range starts {
+		accepted, err := proxyCallback(module, start.callback, proxyRootContext, int32(len(start.config)))
+		if err != nil {
+			return err
+		}
+		if accepted == 0 {
+			return &RuntimeError{Stage: StageExecute, Message: fmt.Sprintf("%s: the filter rejected its configuration", start.callback)}
+		}
+	}
+	k.baseline = k.state.clone()
+	return nil
+}
+
+// stream sends one request through the filter and the configured
+// response back, returning the status the client receives. Actions that
+// pause the stream are ignored, as if the filter resumed it immediately.
+// A local response sent during the request replaces the upstream's.
+func (k *proxyWasmKernel) stream(module WasmModule, request, response *httpMessage) (int32, error) {
+	id := k.state.nextContext
+	k.state.nextContext++
+	k.request, k.response, k.local = request, nil, nil
+	defer func() { k.request, k.response, k.local = nil, nil, nil }()
+
+	endOfStream := func(body []byte) int32 {
+		if len(body) == 0 {
+			return 1
+		}
+		return 0
+	}
+	events := []func() (int32, error){
+		func() (int32, error) { return proxyCallback(module, "proxy_on_context_create", id, proxyRootContext) },
+		func() (int32, error) {
+			return proxyCallback(module, "proxy_on_request_headers", id, int32(len(request.headers)), endOfStream(request.body))
+		},
+		func() (int32, error) {
+			if len(request.body) == 0 || k.local != nil {
+				return 0, nil
+			}
+			return proxyCallback(module, "proxy_on_request_body", id, int32(len(request.body)), 1)
+		},
+		func() (int32, error) {
+			k.response = response
+			if k.local != nil {
+				k.response = k.local
+			}
+			return proxyCallback(module, "proxy_on_response_headers", id, int32(len(k.response.headers)), endOfStream(k.response.body))
+		},
+		func() (int32, error) {
+			if len(k.response.body) == 0 {
+				return 0, nil
+			}
+			return proxyCallback(module, "proxy_on_response_body", id, int32(len(k.response.body)), 1)
+		},
+		func() (int32, error) { return proxyCallback(module, "proxy_on_log", id) },
+		func() (int32, error) { return proxyCallback(module, "proxy_on_done", id) },
+		func() (int32, error) { return proxyCallback(module, "proxy_on_delete", id) },
+	}
+	for _, event := range events {
+		if _, err := event(); err != nil {
+			return 0, err
+		}
+	}
+	return k.response.status(), nil
+}
+
+// proxyWasmRuntime loads filters with a fresh kernel linked to their
+// imports and starts their root context. The wrapped runtime must
+// implement HostLoader.
+type proxyWasmRuntime struct {
+	runtime WasmRuntime
+	host    *proxyWasmHost
+}
+
+// LoadModule implements WasmRuntime.LoadModule
+func (r *proxyWasmRuntime) LoadModule(filePath string) (WasmModule, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, &RuntimeError{Stage: StageLoad, Message: fmt.Sprintf("load failed: %v", err)}
+	}
+	return r.load(filePath, nil, data)
+}
+
+// LoadModuleBytes implements BufferLoader.LoadModuleBytes
+func (r *proxyWasmRuntime) LoadModuleBytes(name string, data []byte) (WasmModule, error) {
+	return r.load(name, data, data)
+}
+
+// load links a new kernel to the imports found in data and starts the
+// filter
+func (r *proxyWasmRuntime) load(filePath string, source, data []byte) (WasmModule, error) {
+	loader, ok := r.runtime.(HostLoader)
+	if !ok {
+		return nil, &RuntimeError{Stage: StageInstantiate, Message: "proxy-wasm: runtime cannot provide host functions"}
+	}
+
+	kernel := newProxyWasmKernel(r.host.config)
+	host, err := kernel.link(moduleImports(data))
+	if err != nil {
+		return nil, &RuntimeError{Stage: StageInstantiate, Message: fmt.Sprintf("proxy-wasm: %v", err)}
+	}
+	module, err := loader.LoadModuleWithHost(filePath, source, host)
+	if err != nil {
+		return nil, err
+	}
+
+	memory, ok := module.(MemoryModule)
+	if !ok {
+		module.Close()
+		return nil, &RuntimeError{Stage: StageInstantiate, Message: "proxy-wasm: runtime does not support memory access"}
+	}
+	kernel.memory.module, kernel.module = memory, module
+	if err := kernel.start(module); err != nil {
+		module.Close()
+		return nil, err
+	}
+	r.host.kernel = kernel
+	return module, nil
+}
+
+// proxyWasmArguments parses every input as the HTTP/1.1 request of one
+// stream
+func (c InvocationConfig) proxyWasmArguments() ([][]interface{}, error) {
+	if _, err := c.proxyWasmResponse(); err != nil {
+		return nil, err
+	}
+	calls := make([][]interface{}, len(c.Inputs))
+	for i, input := range c.Inputs {
+		arg, err := pluginInput(input, "proxy-wasm filters")
+		if err == nil {
+			_, err = parseHTTPRequest(arg.data)
+		}
+		if err != nil {
+			return nil, &RuntimeError{Stage: StageSignature, Message: fmt.Sprintf("input %d: %v", i, err)}
+		}
+		calls[i] = []interface{}{arg}
+	}
+	return calls, nil
+}
+
+// proxyWasmResponse parses the configured upstream response
+func (c InvocationConfig) proxyWasmResponse() (*httpMessage, error) {
+	response := c.ProxyWasm.Response
+	if response == "" {
+		response = defaultProxyResponse
+	}
+	msg, err := parseHTTPResponse([]byte(response))
+	if err != nil {
+		return nil, &RuntimeError{Stage: StageSignature, Message: fmt.Sprintf("proxy-wasm: response: %v", err)}
+	}
+	return msg, nil
+}
+
+// callProxyWasm sends one request through a filter
+func (c InvocationConfig) callProxyWasm(module WasmModule, args []interface{}) ([]interface{}, error) {
+	request, err := parseHTTPRequest(args[0].(bufferArg).data)
+	if err != nil {
+		return nil, &RuntimeError{Stage: StageSignature, Message: fmt.Sprintf("request: %v", err)}
+	}
+	response, err := c.proxyWasmResponse()
+	if err != nil {
+		return nil, err
+	}
+	status, err := c.proxyWasm.kernel.stream(module, request, response)
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{status}, nil
+}
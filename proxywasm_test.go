@@ -0,0 +1,524 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// filterImports are the host functions the test filters use
+var filterImports = []string{
+	"proxy_log", "proxy_get_header_map_value", "proxy_replace_header_map_value",
+	"proxy_get_buffer_bytes", "proxy_send_local_response", "proxy_get_shared_data", "proxy_set_shared_data",
+}
+
+// filterBinary imports the test host functions plus the given imports
+func filterBinary(extra ...wasmFuncImport) []byte {
+	functions := newProxyWasmKernel(ProxyWasmConfig{}).functions()
+	var imports []wasmFuncImport
+	for _, name := range filterImports {
+		imports = append(imports, wasmFuncImport{Module: proxyWasmModule, Name: name, Signature: functions[name].signature})
+	}
+	return pluginBinary(append(imports, extra...)...)
+}
+
+// filterExports are the exports of a proxy-wasm filter
+var filterExports = map[string]FuncSignature{
+	"proxy_abi_version_0_2_1":   funcSig("", ""),
+	"_initialize":               funcSig("", ""),
+	"proxy_on_memory_allocate":  funcSig("i32", "i32"),
+	"proxy_on_context_create":   funcSig("i32 i32", ""),
+	"proxy_on_vm_start":         funcSig("i32 i32", "i32"),
+	"proxy_on_configure":        funcSig("i32 i32", "i32"),
+	"proxy_on_request_headers":  funcSig("i32 i32 i32", "i32"),
+	"proxy_on_request_body":     funcSig("i32 i32 i32", "i32"),
+	"proxy_on_response_headers": funcSig("i32 i32 i32", "i32"),
+	"proxy_on_response_body":    funcSig("i32 i32 i32", "i32"),
+	"proxy_on_log":              funcSig("i32", ""),
+	"proxy_on_done":             funcSig("i32", "i32"),
+	"proxy_on_delete":           funcSig("i32", ""),
+}
+
+// filterModule is a mock filter whose callbacks are Go functions calling
+// the host functions it was linked to
+type filterModule struct {
+	*heapMockModule
+	host      map[string]HostFunction
+	on        map[string]func(args []interface{}) (int32, error)
+	callbacks []string
+}
+
+func newFilterModule(on map[string]func(args []interface{}) (int32, error)) *filterModule {
+	signatures := map[string]FuncSignature{}
+	for name, sig := range filterExports {
+		signatures[name] = sig
+	}
+	m := &filterModule{heapMockModule: newHeapMockModule(signatures), host: map[string]HostFunction{}, on: on}
+	m.ExecuteFunc = func(funcName string, args ...interface{}) ([]interface{}, error) {
+		if funcName == "proxy_on_memory_allocate" {
+			return m.bump(args[0].(int32), 8), nil
+		}
+		m.callbacks = append(m.callbacks, fmt.Sprintf("%s%v", funcName, args))
+		result := int32(0)
+		if funcName == "proxy_on_vm_start" || funcName == "proxy_on_configure" {
+			result = 1
+		}
+		if handler, ok := m.on[funcName]; ok {
+			var err error
+			if result, err = handler(args); err != nil {
+				return nil, err
+			}
+		}
+		if len(m.signatures[funcName].Results) == 0 {
+			return nil, nil
+		}
+		return []interface{}{result}, nil
+	}
+	return m
+}
+
+// call invokes a host function, returning its status
+func (m *filterModule) call(name string, args ...int32) (int32, error) {
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = arg
+	}
+	results, err := m.host[name].Call(values)
+	if err != nil {
+		return 0, &RuntimeError{Stage: StageExecute, Message: "execution failed: host function '" + name + "' failed: " + err.Error()}
+	}
+	return results[0].(int32), nil
+}
+
+// put copies data into the filter's memory
+func (m *filterModule) put(data string) (int32, int32) {
+	ptr := m.bump(int32(len(data)), 1)[0].(int32)
+	copy(m.memory[ptr:], data)
+	return ptr, int32(len(data))
+}
+
+// returned reads data a host function returned through the data and size
+// pointers at ret
+func (m *filterModule) returned(ret int32) string {
+	ptr := binary.LittleEndian.Uint32(m.memory[ret:])
+	size := binary.LittleEndian.Uint32(m.memory[ret+4:])
+	return string(m.memory[ptr : ptr+size])
+}
+
+// header reads a header value
+func (m *filterModule) header(mapType int32, name string) (string, error) {
+	key, size := m.put(name)
+	ret := m.bump(8, 4)[0].(int32)
+	status, err := m.call("proxy_get_header_map_value", mapType, key, size, ret, ret+4)
+	if err != nil || status != proxyOK {
+		return "", err
+	}
+	return m.returned(ret), nil
+}
+
+// statefulFilterModule snapshots a filter's memory
+type statefulFilterModule struct {
+	*filterModule
+}
+
+func (m *statefulFilterModule) Snapshot() (*ModuleSnapshot, error) {
+	return &ModuleSnapshot{Memories: map[string][]byte{defaultMemoryExport: append([]byte(nil), m.memory...)}}, nil
+}
+
+func (m *statefulFilterModule) Restore(snapshot *ModuleSnapshot) error {
+	copy(m.memory, snapshot.Memories[defaultMemoryExport])
+	return nil
+}
+
+// filterRuntime links a new filter to the host functions it is given
+type filterRuntime struct {
+	newFilter func() *filterModule
+	stateful  bool
+	loaded    *filterModule
+}
+
+func (r *filterRuntime) LoadModule(filePath string) (WasmModule, error) {
+	return nil, errors.New("imports cannot be satisfied")
+}
+
+func (r *filterRuntime) LoadModuleWithHost(filePath string, data []byte, host []HostFunction) (WasmModule, error) {
+	m := r.newFilter()
+	for _, fn := range host {
+		m.host[fn.Name] = fn
+	}
+	r.loaded = m
+	if r.stateful {
+		return &statefulFilterModule{m}, nil
+	}
+	return m, nil
+}
+
+// runFilter writes a filter binary to disk and runs it with the
+// proxy-wasm ABI
+func runFilter(t *testing.T, binary []byte, runtime WasmRuntime, plan InvocationConfig) ExecutionResult {
+	path := filepath.Join(t.TempDir(), "filter.wasm")
+	require.NoError(t, os.WriteFile(path, binary, 0o644))
+	plan.ABI = ABIProxyWasm
+	return processWasmFileWithOptions(path, runtime, RunOptions{Invocation: plan})
+}
+
+// requests builds one string input per HTTP request
+func requests(messages ...string) []InvocationInput {
+	inputs := make([]InvocationInput, len(messages))
+	for i, message := range messages {
+		inputs[i] = InvocationInput{{Type: "string", Value: message}}
+	}
+	return inputs
+}
+
+// -----------------------------------------------------------------------------
+// TEST: proxy-wasm Filters
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Envoy and Istio filters never export a plain entry function. They are
+// driven by the host through callbacks for each event of an HTTP stream,
+// and read and modify the stream through host functions. Fuzzing them
+// means replaying those event sequences, and a crash is only actionable
+// once it is known which event triggered it.
+// -----------------------------------------------------------------------------
+
+func TestProxyWasm_ParsesHTTPMessages(t *testing.T) {
+	request, err := parseHTTPRequest([]byte("POST /v1?q=1 HTTP/1.1\nHost: api\nX-Id: 7\nx-id: 8\n\n{\"a\":1}"))
+	require.NoError(t, err)
+	assert.Equal(t, []headerPair{
+		{":authority", "api"}, {":path", "/v1?q=1"}, {":method", "POST"}, {":scheme", "http"},
+		{"x-id", "7"}, {"x-id", "8"},
+	}, request.headers)
+	assert.Equal(t, `{"a":1}`, string(request.body))
+	value, _ := headerValue(request.headers, "x-id")
+	assert.Equal(t, "7,8", value)
+
+	response, err := parseHTTPResponse([]byte("HTTP/1.1 404 Not Found\r\nContent-Type: text/plain\r\n\r\nnope"))
+	require.NoError(t, err)
+	assert.Equal(t, int32(404), response.status())
+	assert.Equal(t, "nope", string(response.body))
+
+	encoded := serializeHeaderMap(request.headers)
+	decoded, err := parseHeaderMap(encoded)
+	require.NoError(t, err)
+	assert.Equal(t, request.headers, decoded)
+	_, err = parseHeaderMap(encoded[:len(encoded)-1])
+	assert.Equal(t, errHeaderMapTruncated, err)
+	_, err = parseHeaderMap([]byte{0xff, 0x00, 0x00, 0x00})
+	assert.Equal(t, errHeaderMapTruncated, err)
+	_, err = parseHeaderMap(append([]byte{0xff, 0xff, 0xff, 0xff}, make([]byte, 1<<20)...))
+	assert.EqualError(t, err, "4294967295 headers exceed the limit of 16384")
+
+	tests := []struct {
+		message, err string
+	}{
+		{"GET /\r\n\r\n", `request line "GET /" is not METHOD TARGET HTTP/VERSION`},
+		{"GET / HTTP/1.1\r\nbroken\r\n\r\n", `header line "broken" is not NAME: VALUE`},
+		{"\r\n\r\nbody", "empty message"},
+	}
+	for _, tt := range tests {
+		_, err := parseHTTPRequest([]byte(tt.message))
+		assert.EqualError(t, err, tt.err)
+	}
+	_, err = parseHTTPResponse([]byte("HTTP/1.1 OK\r\n\r\n"))
+	assert.EqualError(t, err, `status line "HTTP/1.1 OK" is not HTTP/VERSION STATUS [REASON]`)
+}
+
+func TestProxyWasm_DrivesStreamCallbacks(t *testing.T) {
+	var seen []string
+	runtime := &filterRuntime{}
+	runtime.newFilter = func() *filterModule {
+		var m *filterModule
+		m = newFilterModule(map[string]func(args []interface{}) (int32, error){
+			"proxy_on_configure": func(args []interface{}) (int32, error) {
+				ret := m.bump(8, 4)[0].(int32)
+				if _, err := m.call("proxy_get_buffer_bytes", proxyPluginConfiguration, 0, args[1].(int32), ret, ret+4); err != nil {
+					return 0, err
+				}
+				seen = append(seen, "config "+m.returned(ret))
+				return 1, nil
+			},
+			"proxy_on_request_headers": func(args []interface{}) (int32, error) {
+				path, err := m.header(proxyRequestHeaders, ":path")
+				seen = append(seen, "path "+path)
+				return 0, err
+			},
+			"proxy_on_request_body": func(args []interface{}) (int32, error) {
+				ret := m.bump(8, 4)[0].(int32)
+				if _, err := m.call("proxy_get_buffer_bytes", proxyRequestBody, 0, args[1].(int32), ret, ret+4); err != nil {
+					return 0, err
+				}
+				seen = append(seen, "body "+m.returned(ret))
+				return 0, nil
+			},
+			"proxy_on_response_headers": func(args []interface{}) (int32, error) {
+				name, size := m.put("x-filtered")
+				value, valueSize := m.put("yes")
+				_, err := m.call("proxy_replace_header_map_value", proxyResponseHeaders, name, size, value, valueSize)
+				return 0, err
+			},
+		})
+		return m
+	}
+	plan := InvocationConfig{
+		Inputs:    requests("POST /items HTTP/1.1\r\nHost: shop\r\n\r\n{}"),
+		ProxyWasm: ProxyWasmConfig{PluginConfig: "mode=strict", Response: "HTTP/1.1 201 Created\r\n\r\n"},
+	}
+
+	result := runFilter(t, filterBinary(), runtime, plan)
+
+	require.True(t, result.Success, result.ErrorMessage)
+	assert.Equal(t, []interface{}{int32(201)}, result.ReturnValues, "the status the client receives is returned")
+	assert.Equal(t, []string{"config mode=strict", "path /items", "body {}"}, seen)
+	assert.Equal(t, []string{
+		"_initialize[]",
+		"proxy_on_context_create[1 0]",
+		"proxy_on_vm_start[1 0]",
+		"proxy_on_configure[1 11]",
+		"proxy_on_context_create[2 1]",
+		"proxy_on_request_headers[2 4 0]",
+		"proxy_on_request_body[2 2 1]",
+		"proxy_on_response_headers[2 1 1]",
+		"proxy_on_log[2]",
+		"proxy_on_done[2]",
+		"proxy_on_delete[2]",
+	}, runtime.loaded.callbacks)
+}
+
+func TestProxyWasm_LocalResponseReplacesUpstream(t *testing.T) {
+	runtime := &filterRuntime{}
+	runtime.newFilter = func() *filterModule {
+		var m *filterModule
+		m = newFilterModule(map[string]func(args []interface{}) (int32, error){
+			"proxy_on_request_headers": func(args []interface{}) (int32, error) {
+				if token, err := m.header(proxyRequestHeaders, "authorization"); err != nil || token != "" {
+					return 0, err
+				}
+				body, size := m.put("denied")
+				headers, headersSize := m.put(string(serializeHeaderMap([]headerPair{{"www-authenticate", "Bearer"}})))
+				_, err := m.call("proxy_send_local_response", 401, 0, 0, body, size, headers, headersSize, -1)
+				return 1, err
+			},
+		})
+		return m
+	}
+	plan := InvocationConfig{Inputs: requests(
+		"POST / HTTP/1.1\r\nHost: a\r\n\r\nsecret",
+		"POST / HTTP/1.1\r\nHost: a\r\nAuthorization: Bearer x\r\n\r\nsecret",
+	)}
+
+	result := runFilter(t, filterBinary(), runtime, plan)
+
+	require.True(t, result.Success, result.ErrorMessage)
+	assert.Equal(t, []interface{}{int32(401), int32(200)}, invocationReturns(result))
+	assert.Contains(t, runtime.loaded.callbacks, "proxy_on_response_headers[2 2 0]", "the local response is sent back through the filter")
+	assert.NotContains(t, runtime.loaded.callbacks, "proxy_on_request_body[2 6 1]", "the request body is not forwarded")
+	assert.Contains(t, runtime.loaded.callbacks, "proxy_on_request_body[3 6 1]")
+}
+
+func TestProxyWasm_ClassifiesCrashesByCallback(t *testing.T) {
+	runtime := &filterRuntime{newFilter: func() *filterModule {
+		return newFilterModule(map[string]func(args []interface{}) (int32, error){
+			"proxy_on_request_body": func(args []interface{}) (int32, error) {
+				return 0, errors.New("unreachable")
+			},
+			"proxy_on_response_headers": func(args []interface{}) (int32, error) {
+				return 0, errors.New("out of bounds memory access")
+			},
+		})
+	}}
+	plan := InvocationConfig{Inputs: requests("PUT / HTTP/1.1\r\n\r\nbody", "GET / HTTP/1.1\r\n\r\n")}
+
+	result := runFilter(t, filterBinary(), runtime, plan)
+
+	assert.False(t, result.Success)
+	assert.Equal(t, StageExecute, result.FailureStage)
+	require.Len(t, result.Invocations, 2)
+	assert.Equal(t, "proxy_on_request_body: execution failed: unreachable", result.Invocations[0].ErrorMessage)
+	assert.Equal(t, "proxy_on_response_headers: execution failed: out of bounds memory access", result.Invocations[1].ErrorMessage)
+}
+
+func TestProxyWasm_RootContextFailures(t *testing.T) {
+	tests := []struct {
+		name    string
+		on      map[string]func(args []interface{}) (int32, error)
+		stage   FailureStage
+		message string
+	}{
+		{
+			"rejected configuration",
+			map[string]func(args []interface{}) (int32, error){
+				"proxy_on_configure": func(args []interface{}) (int32, error) { return 0, nil },
+			},
+			StageExecute, "proxy_on_configure: the filter rejected its configuration",
+		},
+		{
+			"crashing VM start",
+			map[string]func(args []interface{}) (int32, error){
+				"proxy_on_vm_start": func(args []interface{}) (int32, error) { return 0, errors.New("unreachable") },
+			},
+			StageExecute, "proxy_on_vm_start: execution failed: unreachable",
+		},
+	}
+	for _, tt := range tests {
+		runtime := &filterRuntime{newFilter: func() *filterModule { return newFilterModule(tt.on) }}
+		result := runFilter(t, filterBinary(), runtime, InvocationConfig{})
+		assert.Equal(t, tt.stage, result.FailureStage, tt.name)
+		assert.Equal(t, tt.message, result.ErrorMessage, tt.name)
+	}
+
+	unmarked := &filterRuntime{newFilter: func() *filterModule {
+		m := newFilterModule(nil)
+		delete(m.signatures, "proxy_abi_version_0_2_1")
+		return m
+	}}
+	result := runFilter(t, filterBinary(), unmarked, InvocationConfig{})
+	assert.Equal(t, StageSignature, result.FailureStage)
+	assert.Equal(t, "proxy-wasm: module exports no proxy_abi_version_* marker", result.ErrorMessage)
+}
+
+func TestProxyWasm_ConfigErrors(t *testing.T) {
+	runtime := &filterRuntime{newFilter: func() *filterModule { return newFilterModule(nil) }}
+	tests := []struct {
+		plan    InvocationConfig
+		message string
+	}{
+		{InvocationConfig{Inputs: requests("GET /\r\n\r\n")}, `input 0: request line "GET /" is not METHOD TARGET HTTP/VERSION`},
+		{InvocationConfig{Inputs: []InvocationInput{i32Input(1)}}, "input 0: proxy-wasm filters take string, bytes or file input, not i32"},
+		{InvocationConfig{ProxyWasm: ProxyWasmConfig{Response: "200 OK"}}, `proxy-wasm: response: status line "200 OK" is not HTTP/VERSION STATUS [REASON]`},
+	}
+	for _, tt := range tests {
+		result := runFilter(t, filterBinary(), runtime, tt.plan)
+		assert.Equal(t, StageSignature, result.FailureStage, tt.message)
+		assert.Equal(t, tt.message, result.ErrorMessage)
+	}
+
+	mockRuntime := &MockWasmRuntime{LoadModuleFunc: func(filePath string) (WasmModule, error) { return &MockWasmModule{}, nil }}
+	result := runFilter(t, filterBinary(), mockRuntime, InvocationConfig{})
+	assert.Equal(t, StageInstantiate, result.FailureStage)
+	assert.Equal(t, "proxy-wasm: runtime cannot provide host functions", result.ErrorMessage)
+
+	bad := filterBinary(wasmFuncImport{Module: proxyWasmModule, Name: "proxy_done", Signature: funcSig("i32", "i32")})
+	result = runFilter(t, bad, runtime, InvocationConfig{})
+	assert.Equal(t, StageInstantiate, result.FailureStage)
+	assert.Equal(t, "proxy-wasm: host function 'proxy_done' has signature () -> (i32), but the module imports it as (i32) -> (i32)", result.ErrorMessage)
+}
+
+func TestProxyWasm_LinksSDKImports(t *testing.T) {
+	k := newProxyWasmKernel(ProxyWasmConfig{})
+	host, err := k.link([]wasmFuncImport{
+		{Module: proxyWasmModule, Name: "proxy_grpc_call", Signature: funcSig("i32 i32 i32 i32 i32 i32 i32 i32 i32 i32 i32 i32", "i32")},
+		{Module: proxyWasmModule, Name: "proxy_on_future", Signature: funcSig("i32", "i64")},
+		{Module: proxyWasmModule, Name: "abort", Signature: funcSig("", "")},
+		{Module: wasiModule, Name: "fd_write", Signature: funcSig("i32 i32 i32 i32", "i32")},
+		{Module: wasiModule, Name: "path_open", Signature: funcSig("i32 i32 i32 i32 i32 i64 i64 i32 i32", "i32")},
+	})
+	require.NoError(t, err)
+	require.Len(t, host, 3, "non-proxy env imports and unsupported WASI functions are left to the runtime")
+
+	names := []string{}
+	for _, fn := range host {
+		names = append(names, fn.Name)
+	}
+	assert.ElementsMatch(t, []string{"fd_write", "proxy_grpc_call", "proxy_on_future"}, names)
+	for _, fn := range host {
+		args := make([]interface{}, len(fn.Signature.Params))
+		for i := range args {
+			args[i] = int32(1)
+		}
+		results, err := fn.Call(args)
+		switch fn.Name {
+		case "proxy_grpc_call":
+			assert.Equal(t, proxyStatus(proxyUnimplemented), results)
+		case "proxy_on_future":
+			assert.Equal(t, []interface{}{int64(0)}, results)
+		default:
+			// Memory is only available once the module is instantiated
+			assert.EqualError(t, err, "memory is not available before instantiation")
+		}
+	}
+}
+
+func TestProxyWasm_MinimalWASI(t *testing.T) {
+	module := newHeapMockModule(nil)
+	w := newMinimalWASI(&hostMemory{module: module})
+	host, err := w.link([]wasmFuncImport{
+		{Module: wasiModule, Name: "fd_write", Signature: funcSig("i32 i32 i32 i32", "i32")},
+		{Module: wasiModule, Name: "proc_exit", Signature: funcSig("i32", "")},
+		{Module: wasiModule, Name: "clock_time_get", Signature: funcSig("i32 i64 i32", "i32")},
+	})
+	require.NoError(t, err)
+
+	// Two iovecs of 5 and 3 bytes at 100, written count at 200
+	binary.LittleEndian.PutUint32(module.memory[104:], 5)
+	binary.LittleEndian.PutUint32(module.memory[112:], 3)
+	results, err := host[0].Call([]interface{}{int32(1), int32(100), int32(2), int32(200)})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{int32(wasiSuccess)}, results)
+	assert.Equal(t, uint32(8), binary.LittleEndian.Uint32(module.memory[200:]))
+	results, _ = host[0].Call([]interface{}{int32(5), int32(100), int32(2), int32(200)})
+	assert.Equal(t, []interface{}{int32(wasiEBADF)}, results)
+
+	_, err = host[1].Call([]interface{}{int32(3)})
+	assert.EqualError(t, err, "proc_exit(3)")
+
+	_, err = host[2].Call([]interface{}{int32(0), int64(0), int32(300)})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(wasiClock), binary.LittleEndian.Uint64(module.memory[300:]), "the clock is fixed")
+
+	_, err = w.link([]wasmFuncImport{{Module: wasiModule, Name: "proc_exit", Signature: funcSig("i64", "")}})
+	assert.EqualError(t, err, "host function 'proc_exit' has signature (i32) -> (), but the module imports it as (i64) -> ()")
+}
+
+func TestProxyWasm_SnapshotRewindsHostState(t *testing.T) {
+	// The filter counts streams in shared data and reports the count as
+	// the response status
+	runtime := &filterRuntime{stateful: true}
+	runtime.newFilter = func() *filterModule {
+		var m *filterModule
+		m = newFilterModule(map[string]func(args []interface{}) (int32, error){
+			"proxy_on_response_headers": func(args []interface{}) (int32, error) {
+				key, keySize := m.put("streams")
+				ret := m.bump(12, 4)[0].(int32)
+				count := 0
+				status, err := m.call("proxy_get_shared_data", key, keySize, ret, ret+4, ret+8)
+				if err != nil {
+					return 0, err
+				}
+				if status == proxyOK {
+					count = len(m.returned(ret))
+				}
+				value, valueSize := m.put(strings.Repeat("x", count+1))
+				if _, err := m.call("proxy_set_shared_data", key, keySize, value, valueSize, 0); err != nil {
+					return 0, err
+				}
+				name, nameSize := m.put(":status")
+				code, codeSize := m.put(fmt.Sprint(200 + count + 1))
+				_, err = m.call("proxy_replace_header_map_value", proxyResponseHeaders, name, nameSize, code, codeSize)
+				return 0, err
+			},
+		})
+		return m
+	}
+	plan := InvocationConfig{Inputs: requests(defaultProxyRequest, defaultProxyRequest, defaultProxyRequest)}
+
+	result := runFilter(t, filterBinary(), runtime, plan)
+	require.True(t, result.Success, result.ErrorMessage)
+	assert.Equal(t, []interface{}{int32(201), int32(202), int32(203)}, invocationReturns(result), "shared data persists across streams")
+
+	plan.Snapshot = true
+	result = runFilter(t, filterBinary(), runtime, plan)
+	require.True(t, result.Success, result.ErrorMessage)
+	assert.Equal(t, []interface{}{int32(201), int32(201), int32(201)}, invocationReturns(result))
+}
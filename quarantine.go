@@ -0,0 +1,188 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// QuarantineConfig keeps a quarantine of modules whose outcome changes
+// from one run to the next. Quarantined files still run, but are reported
+// apart from the others so they cannot fail a CI gate.
+type QuarantineConfig struct {
+	// Path is the JSON file keeping the quarantine across campaigns. It is
+	// created when missing, and updated with every module found flaky.
+	Path string `yaml:"path"`
+	// Reruns is how many more times a failed file runs to check that it
+	// fails the same way (default 2)
+	Reruns int `yaml:"reruns"`
+}
+
+// QuarantineEntry is a module found to be flaky
+type QuarantineEntry struct {
+	// SHA256 identifies the module whatever its file is called
+	SHA256   string `json:"sha256"`
+	FilePath string `json:"file_path"`
+	// Outcomes are the different outcomes seen, as classification
+	// signatures, with "" for a pass
+	Outcomes []string `json:"outcomes"`
+	// Reason is set for modules quarantined for another reason than
+	// flakiness, such as crashing their worker
+	Reason string    `json:"reason,omitempty"`
+	Added  time.Time `json:"added"`
+}
+
+// QuarantineSummary reports the results of quarantined modules apart from
+// the others
+type QuarantineSummary struct {
+	Passed int `json:"passed"`
+	Failed int `json:"failed"`
+	// GatedFailures counts the failed results outside the quarantine, the
+	// ones a CI gate should fail on
+	GatedFailures int `json:"gated_failures"`
+	// Added lists the modules quarantined by this campaign
+	Added []QuarantineEntry `json:"added,omitempty"`
+}
+
+// quarantineFile is the JSON the quarantine is kept in
+type quarantineFile struct {
+	Modules []QuarantineEntry `json:"modules"`
+}
+
+// quarantine is the quarantine of a campaign, nil when none is kept
+type quarantine struct {
+	config  QuarantineConfig
+	modules map[string]bool
+	file    quarantineFile
+	added   []QuarantineEntry
+}
+
+// loadQuarantine reads the quarantine, which starts empty when its file
+// does not exist yet
+func loadQuarantine(config QuarantineConfig) (*quarantine, error) {
+	if config.Path == "" {
+		return nil, nil
+	}
+	if config.Reruns < 0 {
+		return nil, errors.New("quarantine: reruns must not be negative")
+	}
+	if config.Reruns == 0 {
+		config.Reruns = 2
+	}
+	q := &quarantine{config: config, modules: make(map[string]bool)}
+	data, err := os.ReadFile(config.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return q, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read quarantine: %w", err)
+	}
+	if err := json.Unmarshal(data, &q.file); err != nil {
+		return nil, fmt.Errorf("failed to read quarantine: %w", err)
+	}
+	for _, entry := range q.file.Modules {
+		q.modules[entry.SHA256] = true
+	}
+	return q, nil
+}
+
+// check marks the result of a quarantined module. A failure of any other
+// module is reproduced with rerun, and the module quarantined when it does
+// not fail the same way every time. A module that crashed its worker is
+// quarantined without a rerun, which would only crash another.
+func (q *quarantine) check(result *ExecutionResult, rerun func() ExecutionResult) {
+	if q == nil || result.Skipped {
+		return
+	}
+	hash := fileHash(result.FilePath)
+	if hash == "" {
+		return
+	}
+	if q.modules[hash] {
+		result.Quarantined = true
+		return
+	}
+	if result.Success {
+		return
+	}
+	if crashedWorker(*result) {
+		result.Quarantined = true
+		q.modules[hash] = true
+		q.added = append(q.added, QuarantineEntry{SHA256: hash, FilePath: result.FilePath, Outcomes: []string{outcomeSignature(*result)}, Reason: "crashed its worker", Added: time.Now().UTC()})
+		return
+	}
+
+	outcomes := []string{outcomeSignature(*result)}
+	seen := map[string]bool{outcomes[0]: true}
+	for i := 0; i < q.config.Reruns; i++ {
+		if outcome := outcomeSignature(rerun()); !seen[outcome] {
+			seen[outcome] = true
+			outcomes = append(outcomes, outcome)
+		}
+	}
+	if len(outcomes) == 1 {
+		return
+	}
+	result.Quarantined, result.FlakyOutcomes = true, outcomes
+	q.modules[hash] = true
+	q.added = append(q.added, QuarantineEntry{SHA256: hash, FilePath: result.FilePath, Outcomes: outcomes, Added: time.Now().UTC()})
+}
+
+// holds reports whether a file's module is in the quarantine
+func (q *quarantine) holds(filePath string) bool {
+	if q == nil {
+		return false
+	}
+	hash := fileHash(filePath)
+	return hash != "" && q.modules[hash]
+}
+
+// fileHash returns the SHA-256 of a file, or "" when it cannot be read
+func fileHash(filePath string) string {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// summarize counts the quarantined results apart from the others
+func (q *quarantine) summarize(results []ExecutionResult) *QuarantineSummary {
+	if q == nil {
+		return nil
+	}
+	summary := &QuarantineSummary{Added: q.added}
+	for _, result := range results {
+		switch {
+		case result.Skipped:
+		case result.Quarantined && result.Success:
+			summary.Passed++
+		case result.Quarantined:
+			summary.Failed++
+		case !result.Success:
+			summary.GatedFailures++
+		}
+	}
+	return summary
+}
+
+// save writes the quarantine back with the modules added to it
+func (q *quarantine) save() error {
+	if q == nil || len(q.added) == 0 {
+		return nil
+	}
+	q.file.Modules = append(q.file.Modules, q.added...)
+	if err := replaceFile(q.config.Path, 0o644, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(q.file)
+	}); err != nil {
+		return fmt.Errorf("failed to write quarantine: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// -----------------------------------------------------------------------------
+// TEST: Flaky-Module Quarantine
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// A module that fails only some of the time turns a CI gate red and green
+// at random, and once nobody trusts the gate, real regressions slip
+// through. Flaky modules have to be found, remembered across campaigns
+// and counted apart, while they keep running so a fix shows up.
+// -----------------------------------------------------------------------------
+
+func TestQuarantine_SetsApartFlakyModules(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "broken.wasm"), []byte("broken"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "flaky.wasm"), []byte("flaky"), 0o644))
+	loads := 0
+	runtime := &MockWasmRuntime{LoadModuleFunc: func(filePath string) (WasmModule, error) {
+		switch {
+		case strings.Contains(filePath, "broken"):
+			return nil, errors.New("invalid magic")
+		case strings.Contains(filePath, "flaky"):
+			loads++
+			if loads%2 == 1 {
+				return nil, errors.New("resource temporarily unavailable")
+			}
+		}
+		return &MockWasmModule{}, nil
+	}}
+	path := filepath.Join(t.TempDir(), "quarantine.json")
+	opts := RunOptions{Quarantine: QuarantineConfig{Path: path}}
+
+	report, err := runFuzzerWithMatrix(dir, []environmentRuntime{{Runtime: runtime}}, opts)
+	require.NoError(t, err)
+	require.Len(t, report.Results, 2)
+	assert.False(t, report.Results[0].Quarantined, "a module failing the same way every time is not flaky")
+	flaky := report.Results[1]
+	assert.True(t, flaky.Quarantined)
+	assert.Equal(t, []string{"load:load failed: resource temporarily unavailable", ""}, flaky.FlakyOutcomes)
+	require.NotNil(t, report.Quarantine)
+	assert.Equal(t, 1, report.Quarantine.Failed)
+	assert.Equal(t, 1, report.Quarantine.GatedFailures)
+	require.Len(t, report.Quarantine.Added, 1)
+	assert.Equal(t, flaky.FilePath, report.Quarantine.Added[0].FilePath)
+
+	// The next campaign still runs the module, but keeps it apart even
+	// when it passes
+	loads = 1
+	report, err = runFuzzerWithMatrix(dir, []environmentRuntime{{Runtime: runtime}}, opts)
+	require.NoError(t, err)
+	assert.True(t, report.Results[1].Success)
+	assert.True(t, report.Results[1].Quarantined)
+	assert.Empty(t, report.Results[1].FlakyOutcomes)
+	assert.Equal(t, &QuarantineSummary{Passed: 1, GatedFailures: 1}, report.Quarantine)
+
+	kept, err := loadQuarantine(opts.Quarantine)
+	require.NoError(t, err)
+	assert.Len(t, kept.file.Modules, 1, "modules are only added once")
+}
+
+func TestQuarantine_FullDiskKeepsThePreviousQuarantine(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "quarantine.json")
+	q, err := loadQuarantine(QuarantineConfig{Path: path})
+	require.NoError(t, err)
+	q.added = []QuarantineEntry{{SHA256: "a", FilePath: "a.wasm", Outcomes: []string{"execute:unreachable", ""}}}
+	require.NoError(t, q.save())
+	previous, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	q, err = loadQuarantine(QuarantineConfig{Path: path})
+	require.NoError(t, err)
+	q.added = []QuarantineEntry{{SHA256: "b", FilePath: "b.wasm", Outcomes: []string{"load:busy", ""}}}
+	injectDiskFaults(t, 16, 0)
+	err = q.save()
+	assert.True(t, errors.Is(err, syscall.ENOSPC))
+
+	kept, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, previous, kept, "a quarantine half written never replaces the previous one")
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "the partial quarantine is removed")
+}
+
+func TestQuarantine_RejectsBadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quarantine.json")
+	require.NoError(t, os.WriteFile(path, []byte("{"), 0o644))
+	_, err := runFuzzerWithMatrix(t.TempDir(), nil, RunOptions{Quarantine: QuarantineConfig{Path: path}})
+	assert.ErrorContains(t, err, "failed to read quarantine")
+}
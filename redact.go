@@ -0,0 +1,145 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// minSecretLength is the shortest environment value redacted. Shorter
+// values, such as a flag set to 1, would match all over a message.
+const minSecretLength = 4
+
+// hostPathPattern matches absolute Unix and Windows paths of at least two
+// components, after the start of a message or a delimiter
+var hostPathPattern = regexp.MustCompile(`(^|[\s'"(\[=:,])((?:/|[A-Za-z]:\\)(?:[^\s'"()\[\]:,;/\\]+[/\\])+)([^\s'"()\[\]:,;/\\]*)`)
+
+// RedactionConfig limits and scrubs what results report of errors before
+// they are written. Runtime errors can embed megabytes of module data, and
+// host paths or secrets that should not leave the machine.
+type RedactionConfig struct {
+	// MaxErrorLength caps each error message, such as 4KiB; by default
+	// messages are kept whole
+	MaxErrorLength ByteSize `yaml:"max_error_length"`
+	// Paths replaces the directories of absolute host paths
+	Paths bool `yaml:"paths"`
+	// Env names environment variables whose values are replaced
+	Env []string `yaml:"env"`
+	// Originals is a directory, private to the user, keeping each result
+	// as it was before redaction
+	Originals string `yaml:"originals"`
+}
+
+// redactor applies a redaction config to results. A nil redactor leaves
+// results unchanged.
+type redactor struct {
+	config  RedactionConfig
+	secrets []envSecret
+}
+
+// envSecret is the value of a redacted environment variable
+type envSecret struct {
+	name, value string
+}
+
+// newRedactor prepares a redaction config, creating its originals store.
+// It returns nil when the config redacts nothing.
+func newRedactor(config RedactionConfig) (*redactor, error) {
+	if config.MaxErrorLength < 0 {
+		return nil, fmt.Errorf("max_error_length must not be negative")
+	}
+	r := &redactor{config: config}
+	for _, name := range config.Env {
+		if value := os.Getenv(name); len(value) >= minSecretLength {
+			r.secrets = append(r.secrets, envSecret{name: name, value: value})
+		}
+	}
+	// Longer values first, so one that contains another is replaced whole
+	sort.SliceStable(r.secrets, func(i, j int) bool { return len(r.secrets[i].value) > len(r.secrets[j].value) })
+
+	if config.MaxErrorLength == 0 && !config.Paths && len(config.Env) == 0 {
+		return nil, nil
+	}
+	if config.Originals != "" {
+		if err := os.MkdirAll(config.Originals, 0o700); err != nil {
+			return nil, fmt.Errorf("failed to create originals store: %w", err)
+		}
+	}
+	return r, nil
+}
+
+// scrub applies the rules to one string, capping it when limit is set
+func (r *redactor) scrub(s string, limit bool) string {
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret.value, "$"+secret.name)
+	}
+	if r.config.Paths {
+		s = hostPathPattern.ReplaceAllString(s, "$1<path>/$3")
+	}
+	if max := int(r.config.MaxErrorLength); limit && max > 0 && len(s) > max {
+		cut := max
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		s = fmt.Sprintf("%s[... %d bytes truncated]", s[:cut], len(s)-cut)
+	}
+	return s
+}
+
+// redact scrubs the error messages and output of a result. Error messages
+// are capped too; output already is. When anything changed and an
+// originals store is configured, the result as it was is kept there.
+func (r *redactor) redact(result *ExecutionResult) error {
+	if r == nil {
+		return nil
+	}
+	original := *result
+	result.Invocations = append([]InvocationResult(nil), result.Invocations...)
+
+	changed := false
+	scrub := func(s *string, limit bool) {
+		if scrubbed := r.scrub(*s, limit); scrubbed != *s {
+			*s, changed = scrubbed, true
+		}
+	}
+	scrub(&result.ErrorMessage, true)
+	scrub(&result.StartFailure, true)
+	if result.Classification != nil {
+		classification := *result.Classification
+		scrub(&classification.Signature, false)
+		result.Classification = &classification
+	}
+	scrub(&result.Stdout, false)
+	scrub(&result.Stderr, false)
+	scrub(&result.Log, false)
+	scrub(&result.SanitizerReport, false)
+	for i := range result.Invocations {
+		invocation := &result.Invocations[i]
+		scrub(&invocation.ErrorMessage, true)
+		scrub(&invocation.Stdout, false)
+		scrub(&invocation.Stderr, false)
+		scrub(&invocation.Log, false)
+	}
+	if !changed || r.config.Originals == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(original)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	name := hex.EncodeToString(sum[:]) + ".json"
+	if err := writeArtifact(filepath.Join(r.config.Originals, name), data, 0o600); err != nil {
+		return fmt.Errorf("failed to keep original result: %w", err)
+	}
+	result.RedactedOriginal = name
+	return nil
+}
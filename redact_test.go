@@ -0,0 +1,104 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// -----------------------------------------------------------------------------
+// TEST: Error Redaction
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Reports are shared far beyond the machine that produced them. A runtime
+// error that embeds megabytes of module data bloats every consumer, and
+// one that embeds a home directory or a token leaks it. The original has
+// to stay available to whoever may read it, and nobody else.
+// -----------------------------------------------------------------------------
+
+func TestRedact_PathsAndEnv(t *testing.T) {
+	t.Setenv("FUZZ_TOKEN", "s3cr3t-token")
+	t.Setenv("FUZZ_FLAG", "1")
+	r, err := newRedactor(RedactionConfig{Paths: true, Env: []string{"FUZZ_TOKEN", "FUZZ_FLAG"}})
+	require.NoError(t, err)
+
+	result := ExecutionResult{
+		FilePath:     "/home/ci/corpus/a.wasm",
+		ErrorMessage: "open '/home/ci/.cache/s3cr3t-token/db': denied, 1 retry",
+		Invocations:  []InvocationResult{{ErrorMessage: `failed at C:\Users\ci\x.wasm`}, {Stderr: "see /tmp/run/log.txt\n"}},
+	}
+	invocations := result.Invocations
+	require.NoError(t, r.redact(&result))
+
+	assert.Equal(t, "open '<path>/db': denied, 1 retry", result.ErrorMessage)
+	assert.Equal(t, "failed at <path>/x.wasm", result.Invocations[0].ErrorMessage)
+	assert.Equal(t, "see <path>/log.txt\n", result.Invocations[1].Stderr)
+	assert.Equal(t, "/home/ci/corpus/a.wasm", result.FilePath, "the file is still identified")
+	assert.Equal(t, `failed at C:\Users\ci\x.wasm`, invocations[0].ErrorMessage, "the caller's invocations are not modified")
+
+	assert.Equal(t, "token $FUZZ_TOKEN in i32/i64", r.scrub("token s3cr3t-token in i32/i64", true))
+}
+
+func TestRedact_TruncatesErrors(t *testing.T) {
+	r, err := newRedactor(RedactionConfig{MaxErrorLength: 8})
+	require.NoError(t, err)
+
+	result := ExecutionResult{ErrorMessage: "trap: ééééé", Stdout: strings.Repeat("x", 20)}
+	require.NoError(t, r.redact(&result))
+	assert.Equal(t, "trap: é[... 8 bytes truncated]", result.ErrorMessage, "messages are cut between characters")
+	assert.Equal(t, strings.Repeat("x", 20), result.Stdout, "output has its own limit")
+
+	none, err := newRedactor(RedactionConfig{})
+	require.NoError(t, err)
+	assert.Nil(t, none)
+	assert.NoError(t, none.redact(&result))
+}
+
+func TestRedact_KeepsOriginals(t *testing.T) {
+	store := filepath.Join(t.TempDir(), "originals")
+	r, err := newRedactor(RedactionConfig{Paths: true, Originals: store})
+	require.NoError(t, err)
+	info, err := os.Stat(store)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o700), info.Mode().Perm())
+
+	result := ExecutionResult{ErrorMessage: "load failed: /srv/corpus/b.wasm"}
+	require.NoError(t, r.redact(&result))
+	require.NotEmpty(t, result.RedactedOriginal)
+
+	path := filepath.Join(store, result.RedactedOriginal)
+	info, err = os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var original ExecutionResult
+	require.NoError(t, json.Unmarshal(data, &original))
+	assert.Equal(t, "load failed: /srv/corpus/b.wasm", original.ErrorMessage)
+
+	clean := ExecutionResult{ErrorMessage: "unreachable"}
+	require.NoError(t, r.redact(&clean))
+	assert.Empty(t, clean.RedactedOriginal, "unchanged results keep no original")
+}
+
+func TestRedact_AppliedToCampaign(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.wasm"), []byte{0}, 0o644))
+	runtime := &MockWasmRuntime{LoadModuleFunc: func(filePath string) (WasmModule, error) {
+		return nil, &RuntimeError{Stage: StageLoad, Message: "cannot read " + filePath}
+	}}
+
+	report, err := runFuzzerWithMatrix(dir, []environmentRuntime{{Runtime: runtime}}, RunOptions{Redaction: RedactionConfig{Paths: true}})
+	require.NoError(t, err)
+	require.Len(t, report.Results, 1)
+	assert.Equal(t, "cannot read <path>/a.wasm", report.Results[0].ErrorMessage)
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// replHelp lists the commands of the REPL
+const replHelp = `commands:
+  exports                        list the exported functions
+  call <export> [args...]        call an export; args are input values, such as 5 or {type: string, value: hi}
+  memory <offset> [length]       dump guest memory (default 64 bytes)
+  inject                         show the active injections
+  inject log fail|block [delay]  make the host's log import fail or block
+  inject log off
+  inject start skip|isolate|off  take the start function out of instantiation
+  reload                         instantiate the module again
+  quit`
+
+// replDumpLength is how many bytes memory dumps without a length
+const replDumpLength = 64
+
+// replSession is an interactive session with one module. Calls go through
+// the same hosts as a campaign's, so a failure reproduces as it was found.
+type replSession struct {
+	filePath string
+	runtime  WasmRuntime
+	plan     InvocationConfig
+	module   WasmModule
+	output   *outputCapture
+	exports  []string
+	out      io.Writer
+}
+
+// newREPLSession loads a module for interactive use
+func newREPLSession(filePath string, runtime WasmRuntime, plan InvocationConfig, out io.Writer) (*replSession, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	s := &replSession{filePath: filePath, runtime: runtime, plan: plan.withDefaults(), out: out}
+	if binary, err := parseWasmBinary(data); err == nil {
+		exports, _ := binary.functionExports()
+		for name := range exports {
+			s.exports = append(s.exports, name)
+		}
+		sort.Strings(s.exports)
+	}
+	return s, s.reload()
+}
+
+// reload instantiates the module again with the current injections
+func (s *replSession) reload() error {
+	s.Close()
+	s.output = &outputCapture{}
+	plan := s.plan
+	runtime := hostRuntime(s.runtime, &plan, s.output)
+	var start *startRuntime
+	if plan.Start != "" {
+		start = &startRuntime{runtime: runtime, mode: plan.Start}
+		runtime = start
+	}
+	module, err := prepareModule(s.filePath, runtime, plan)
+	if start != nil && start.failure != "" {
+		fmt.Fprintf(s.out, "start function failed: %s\n", start.failure)
+	}
+	if err != nil {
+		if module != nil {
+			module.Close()
+		}
+		return err
+	}
+	s.plan, s.module = plan, module
+	return nil
+}
+
+// Close releases the module
+func (s *replSession) Close() {
+	if s.module != nil {
+		s.module.Close()
+		s.module = nil
+	}
+}
+
+// run reads commands until quit or the end of input
+func (s *replSession) run(in io.Reader) {
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(s.out, "> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(s.out)
+			return
+		}
+		if !s.execute(strings.TrimSpace(scanner.Text())) {
+			return
+		}
+	}
+}
+
+// execute runs one command line, returning false to end the session
+func (s *replSession) execute(line string) bool {
+	command, rest := line, ""
+	if i := strings.IndexFunc(line, unicode.IsSpace); i >= 0 {
+		command, rest = line[:i], strings.TrimSpace(line[i:])
+	}
+	fields := strings.Fields(rest)
+
+	var err error
+	switch command {
+	case "":
+	case "help":
+		fmt.Fprintln(s.out, replHelp)
+	case "quit", "exit":
+		return false
+	case "exports":
+		s.listExports()
+	case "call":
+		err = s.call(rest)
+	case "memory", "mem":
+		err = s.dumpMemory(fields)
+	case "inject":
+		err = s.inject(fields)
+	case "reload":
+		err = s.reload()
+	default:
+		err = fmt.Errorf("unknown command %q, try help", command)
+	}
+	s.report(err)
+	return true
+}
+
+// report prints an error, with the stage a runtime error failed in
+func (s *replSession) report(err error) {
+	var runtimeErr *RuntimeError
+	if errors.As(err, &runtimeErr) {
+		fmt.Fprintf(s.out, "error (%s): %s\n", runtimeErr.Stage, runtimeErr.Message)
+	} else if err != nil {
+		fmt.Fprintf(s.out, "error: %v\n", err)
+	}
+}
+
+// listExports prints each exported function with its signature, when the
+// module reports one
+func (s *replSession) listExports() {
+	typed, _ := s.module.(SignatureModule)
+	for _, name := range s.exports {
+		if typed != nil {
+			if sig, ok := typed.Signature(name); ok {
+				fmt.Fprintf(s.out, "%s %s\n", name, sig)
+				continue
+			}
+		}
+		fmt.Fprintln(s.out, name)
+	}
+}
+
+// call calls an export with the input values in args, which use the YAML
+// syntax of the config's inputs
+func (s *replSession) call(args string) error {
+	if s.module == nil {
+		return fmt.Errorf("no module loaded, try reload")
+	}
+	entry, values, _ := strings.Cut(args, " ")
+	if entry == "" {
+		return fmt.Errorf("usage: call <export> [args...]")
+	}
+	var input InvocationInput
+	if err := yaml.Unmarshal([]byte("["+values+"]"), &input); err != nil {
+		return fmt.Errorf("invalid arguments: %v", err)
+	}
+
+	plan := s.plan
+	plan.Entry, plan.Inputs, plan.function = entry, []InvocationInput{input}, nil
+	if err := plan.loadInterface(s.filePath, false); err != nil {
+		return err
+	}
+	calls, err := plan.arguments(s.module)
+	if err != nil {
+		return err
+	}
+
+	s.output.takeCall()
+	var returns []interface{}
+	err = runStage(StageExecute, func() error {
+		var execErr error
+		returns, execErr = plan.call(s.module, calls[0])
+		return execErr
+	})
+	stdout, stderr, log := s.output.takeCall()
+	for _, stream := range []struct{ name, text string }{{"stdout", stdout}, {"stderr", stderr}, {"log", log}} {
+		if stream.text != "" {
+			fmt.Fprintf(s.out, "%s: %s\n", stream.name, strings.TrimSuffix(stream.text, "\n"))
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	typed := encodeValues(returns)
+	formatted := make([]string, len(returns))
+	for i, value := range returns {
+		formatted[i] = fmt.Sprintf("%s %v", typed[i].Type, value)
+	}
+	fmt.Fprintf(s.out, "=> [%s]\n", strings.Join(formatted, ", "))
+	return nil
+}
+
+// dumpMemory prints guest memory in hex
+func (s *replSession) dumpMemory(args []string) error {
+	memory, ok := s.module.(MemoryModule)
+	if !ok {
+		return fmt.Errorf("the runtime cannot read this module's memory")
+	}
+	if len(args) == 0 || len(args) > 2 {
+		return fmt.Errorf("usage: memory <offset> [length]")
+	}
+	offset, err := parseInteger(args[0], 32)
+	if err != nil {
+		return err
+	}
+	length := int64(replDumpLength)
+	if len(args) == 2 {
+		if length, err = parseInteger(args[1], 32); err != nil {
+			return err
+		}
+	}
+	name := s.plan.Buffers.Memory
+	if name == "" {
+		name = defaultMemoryExport
+	}
+	data, err := memory.ReadMemory(name, uint32(offset), uint32(length))
+	if err != nil {
+		return err
+	}
+
+	for line := 0; line < len(data); line += 16 {
+		row := data[line:min(line+16, len(data))]
+		ascii := []byte(string(row))
+		for i, b := range ascii {
+			if b < 0x20 || b > 0x7e {
+				ascii[i] = '.'
+			}
+		}
+		fmt.Fprintf(s.out, "%08x  %-47s  |%s|\n", uint32(offset)+uint32(line), fmt.Sprintf("% x", row), ascii)
+	}
+	return nil
+}
+
+// inject shows or changes the injections, reloading the module when they
+// change
+func (s *replSession) inject(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintf(s.out, "log: %s\nstart: %s\n", describeInjection(s.plan.Log.Fault), describeInjection(s.plan.Start))
+		return nil
+	}
+
+	plan := s.plan
+	switch {
+	case args[0] == "log" && len(args) >= 2 && len(args) <= 3:
+		plan.Log = LogConfig{Fault: args[1]}
+		if args[1] == "off" {
+			plan.Log.Fault = ""
+		}
+		if len(args) == 3 {
+			delay, err := time.ParseDuration(args[2])
+			if err != nil {
+				return err
+			}
+			plan.Log.Delay = delay
+		}
+	case args[0] == "start" && len(args) == 2:
+		plan.Start = args[1]
+		if args[1] == "off" {
+			plan.Start = ""
+		}
+	default:
+		return fmt.Errorf("usage: inject [log fail|block [delay]|off | start skip|isolate|off]")
+	}
+
+	previous := s.plan
+	s.plan = plan
+	if err := s.reload(); err != nil {
+		s.plan = previous
+		return err
+	}
+	fmt.Fprintln(s.out, "reloaded")
+	return nil
+}
+
+// describeInjection names an injection mode
+func describeInjection(mode string) string {
+	if mode == "" {
+		return "off"
+	}
+	return mode
+}
+
+// runREPLCommand instantiates a module and reads commands from stdin
+func runREPLCommand(args []string) int {
+	flags := flag.NewFlagSet("repl", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	configPath := flags.String("config", "", "YAML campaign config")
+
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		emitError(map[string]string{
+			"error": "usage: wasm-fuzzer repl [--config file.yaml] <file.wasm>",
+		})
+		return 1
+	}
+
+	config, err := resolveConfig(*configPath)
+	if err != nil {
+		emitError(map[string]string{
+			"error":   "config load failed",
+			"details": err.Error(),
+		})
+		return 1
+	}
+	envs, err := buildEnvironmentRuntimes(config)
+	if err != nil {
+		emitError(map[string]string{
+			"error":   "invalid environment matrix",
+			"details": err.Error(),
+		})
+		return 1
+	}
+	defer closeRuntimes(envs)
+
+	// The session runs in the first environment of the matrix
+	session, err := newREPLSession(flags.Arg(0), envs[0].Runtime, config.runOptions().Invocation, os.Stdout)
+	if session == nil {
+		emitError(map[string]string{
+			"error":   "module access failed",
+			"details": err.Error(),
+		})
+		return 1
+	}
+	defer session.Close()
+	// A module that fails to load can still be reloaded with injections
+	session.report(err)
+	session.run(os.Stdin)
+	return 0
+}
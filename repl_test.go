@@ -0,0 +1,93 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// replModule is a module whose run export logs its argument and returns
+// it incremented
+func replModule(t *testing.T) (string, *emscriptenMockRuntime) {
+	module := newContractModule(map[string]FuncSignature{"run": funcSig("i32", "i32")}, map[string]contractExport{
+		"run": func(m *contractModule, args []interface{}) ([]interface{}, error) {
+			n := args[0].(int32)
+			if _, err := m.log(fmt.Sprintf("got %d", n)); err != nil {
+				return nil, err
+			}
+			return []interface{}{n + 1}, nil
+		},
+	})
+	path := filepath.Join(t.TempDir(), "repl.wasm")
+	require.NoError(t, os.WriteFile(path, logBinary(logSignature), 0o644))
+	return path, &emscriptenMockRuntime{module: module}
+}
+
+// -----------------------------------------------------------------------------
+// TEST: REPL
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Triaging a failure means calling the module by hand: trying arguments,
+// looking at what it left in memory and turning injections on and off.
+// The session has to call exports through the same hosts as a campaign,
+// or what it shows would not be what the campaign saw.
+// -----------------------------------------------------------------------------
+
+func TestREPL_Session(t *testing.T) {
+	path, runtime := replModule(t)
+	var out bytes.Buffer
+	session, err := newREPLSession(path, runtime, InvocationConfig{}, &out)
+	require.NoError(t, err)
+	defer session.Close()
+
+	session.run(strings.NewReader(strings.Join([]string{
+		"exports",
+		"call run 41",
+		"memory 1024 8",
+		"inject log fail",
+		"inject",
+		"call run 1",
+		"call run {type: i64, value: 1}",
+		"frobnicate",
+		"quit",
+		"call run 2",
+	}, "\n")))
+
+	assert.Equal(t, strings.Join([]string{
+		"> run (i32) -> (i32)",
+		"> log: got 41",
+		"=> [i32 42]",
+		"> 00000400  67 6f 74 20 34 31 00 00                          |got 41..|",
+		"> reloaded",
+		"> log: fail",
+		"start: off",
+		"> error (execute): execution failed: host function 'log' failed: injected log failure",
+		"> error (signature): signature mismatch: 'run' has signature (i32) -> (i32); input 0: argument 0: i64 value given for i32 parameter",
+		`> error: unknown command "frobnicate", try help`,
+		"> ",
+	}, "\n"), out.String())
+}
+
+func TestREPL_FailedInjectionKeepsModule(t *testing.T) {
+	path, runtime := replModule(t)
+	var out bytes.Buffer
+	session, err := newREPLSession(path, runtime, InvocationConfig{}, &out)
+	require.NoError(t, err)
+	defer session.Close()
+
+	session.execute("inject log drop")
+	assert.Equal(t, "error (instantiate): log: unknown log fault \"drop\"\n", out.String())
+	out.Reset()
+	session.execute("inject")
+	assert.Equal(t, "log: off\nstart: off\n", out.String(), "the previous injections stay")
+}
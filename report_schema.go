@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// reportMigration upgrades a raw report from one schema version to the next
+type reportMigration func(raw map[string]interface{}) error
+
+// reportMigrations maps a schema version to the migration that upgrades it
+// to version+1. Add an entry here whenever SchemaVersion is bumped.
+var reportMigrations = map[int]reportMigration{
+	1: migrateReportV1ToV2,
+	2: migrateReportV2ToV3,
+	3: migrateReportV3ToV4,
+	4: migrateReportV4ToV5,
+}
+
+// migrateReportV1ToV2 stamps the schema version onto every result.
+// typed_return_values cannot be recovered from v1's lossy numbers, so it
+// is left absent rather than fabricated.
+func migrateReportV1ToV2(raw map[string]interface{}) error {
+	results, _ := raw["results"].([]interface{})
+	for i, r := range results {
+		entry, ok := r.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("results[%d] is not an object", i)
+		}
+		entry["schema_version"] = 2
+	}
+	return nil
+}
+
+// migrateReportV2ToV3 stamps the new schema version onto every result and
+// adds the signature stage, which no v2 result can have failed at, to the
+// failure counts
+func migrateReportV2ToV3(raw map[string]interface{}) error {
+	results, _ := raw["results"].([]interface{})
+	for i, r := range results {
+		entry, ok := r.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("results[%d] is not an object", i)
+		}
+		entry["schema_version"] = 3
+	}
+	if counts, ok := raw["failure_counts"].(map[string]interface{}); ok {
+		counts[string(StageSignature)] = 0
+	}
+	return nil
+}
+
+// migrateReportV3ToV4 stamps the new schema version onto every result.
+// No v3 result was skipped, so the skipped count and every skip count is
+// zero.
+func migrateReportV3ToV4(raw map[string]interface{}) error {
+	results, _ := raw["results"].([]interface{})
+	for i, r := range results {
+		entry, ok := r.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("results[%d] is not an object", i)
+		}
+		entry["schema_version"] = 4
+	}
+	raw["skipped"] = 0
+	skipCounts := make(map[string]interface{})
+	for reason := range newSkipCounts() {
+		skipCounts[string(reason)] = 0
+	}
+	raw["skip_counts"] = skipCounts
+	if environments, ok := raw["environments"].([]interface{}); ok {
+		for _, e := range environments {
+			if env, ok := e.(map[string]interface{}); ok {
+				env["skipped"] = 0
+				env["skip_counts"] = skipCounts
+			}
+		}
+	}
+	return nil
+}
+
+// migrateReportV4ToV5 stamps the new schema version onto every result.
+// Version 5 only added optional fields, such as the sweep, memory, cache,
+// quarantine and budget summaries of a report and the taint, intercept
+// and classification of a result, which a v4 report simply lacks.
+func migrateReportV4ToV5(raw map[string]interface{}) error {
+	results, _ := raw["results"].([]interface{})
+	for i, r := range results {
+		entry, ok := r.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("results[%d] is not an object", i)
+		}
+		entry["schema_version"] = 5
+	}
+	return nil
+}
+
+// rawSchemaVersion reads schema_version from a raw report.
+// Reports written before versioning was introduced are version 1.
+func rawSchemaVersion(raw map[string]interface{}) (int, error) {
+	v, ok := raw["schema_version"]
+	if !ok {
+		return 1, nil
+	}
+	n, ok := v.(json.Number)
+	version, err := n.Int64()
+	if !ok || err != nil || version < 1 {
+		return 0, fmt.Errorf("invalid schema_version: %v", v)
+	}
+	return int(version), nil
+}
+
+// migrateReportJSON upgrades raw report JSON to the current SchemaVersion
+func migrateReportJSON(data []byte) ([]byte, int, error) {
+	// Numbers are kept as written, as float64 would round the 64-bit
+	// integers return values can be
+	var raw map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, 0, fmt.Errorf("invalid report JSON: %w", err)
+	}
+	if decoder.More() {
+		return nil, 0, errors.New("invalid report JSON: data after the report")
+	}
+
+	original, err := rawSchemaVersion(raw)
+	if err != nil {
+		return nil, 0, err
+	}
+	if original > SchemaVersion {
+		return nil, original, fmt.Errorf("report schema_version %d is newer than supported version %d", original, SchemaVersion)
+	}
+
+	for version := original; version < SchemaVersion; version++ {
+		migrate, ok := reportMigrations[version]
+		if !ok {
+			return nil, original, fmt.Errorf("no migration from schema_version %d", version)
+		}
+		if err := migrate(raw); err != nil {
+			return nil, original, fmt.Errorf("migrating schema_version %d: %w", version, err)
+		}
+		raw["schema_version"] = version + 1
+	}
+
+	migrated, err := json.Marshal(raw)
+	if err != nil {
+		return nil, original, err
+	}
+	return migrated, original, nil
+}
+
+// decodeReport migrates and strictly decodes report JSON
+func decodeReport(data []byte) (FuzzingReport, int, error) {
+	var report FuzzingReport
+
+	migrated, original, err := migrateReportJSON(data)
+	if err != nil {
+		return report, original, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(migrated))
+	decoder.DisallowUnknownFields()
+	decoder.UseNumber()
+	if err := decoder.Decode(&report); err != nil {
+		return report, original, fmt.Errorf("report does not match schema: %w", err)
+	}
+	return report, original, nil
+}
+
+// loadReport reads a report file written by any supported schema version,
+// compressed or not
+func loadReport(path string) (FuzzingReport, error) {
+	data, err := readReportFile(path)
+	if err != nil {
+		return FuzzingReport{}, fmt.Errorf("failed to read report: %w", err)
+	}
+	report, _, err := decodeReport(data)
+	return report, err
+}
+
+// validateReport checks the internal consistency of a decoded report
+func validateReport(report FuzzingReport) []string {
+	var problems []string
+
+	if report.SchemaVersion != SchemaVersion {
+		problems = append(problems, fmt.Sprintf("schema_version is %d, expected %d", report.SchemaVersion, SchemaVersion))
+	}
+	if report.Passed+report.Failed+report.Skipped != report.TotalFiles {
+		problems = append(problems, fmt.Sprintf("passed (%d) + failed (%d) + skipped (%d) does not equal total_files (%d)", report.Passed, report.Failed, report.Skipped, report.TotalFiles))
+	}
+	// The counts of a filtered report cover results it left out, which
+	// cannot be checked
+	if filter := report.Filter; filter != nil {
+		if report.TotalFiles != len(report.Results)+filter.Dropped {
+			problems = append(problems, fmt.Sprintf("total_files is %d but %d results are present and %d dropped", report.TotalFiles, len(report.Results), filter.Dropped))
+		}
+		return problems
+	}
+	if report.TotalFiles != len(report.Results) {
+		problems = append(problems, fmt.Sprintf("total_files is %d but %d results are present", report.TotalFiles, len(report.Results)))
+	}
+
+	passed, skipped := 0, 0
+	failures := make(map[FailureStage]int)
+	skips := make(map[SkipReason]int)
+	severities := make(map[Severity]int)
+	crashes := make(map[string]int)
+	for i, result := range report.Results {
+		if result.Crash != nil {
+			crashes[result.Crash.signature()]++
+		}
+		if result.SchemaVersion != report.SchemaVersion {
+			problems = append(problems, fmt.Sprintf("results[%d]: schema_version %d does not match report", i, result.SchemaVersion))
+		}
+		if result.Skipped {
+			skipped++
+			skips[result.SkipReason]++
+			if result.Success || result.FailureStage != StageNone {
+				problems = append(problems, fmt.Sprintf("results[%d]: skipped result has an outcome", i))
+			}
+			if _, ok := newSkipCounts()[result.SkipReason]; !ok {
+				problems = append(problems, fmt.Sprintf("results[%d]: skipped result has unknown skip_reason %q", i, result.SkipReason))
+			}
+		} else if result.Success {
+			passed++
+			if result.FailureStage != StageNone {
+				problems = append(problems, fmt.Sprintf("results[%d]: successful result has failure_stage %q", i, result.FailureStage))
+			}
+		} else {
+			failures[result.FailureStage]++
+			if !isFailureStage(result.FailureStage) {
+				problems = append(problems, fmt.Sprintf("results[%d]: failed result has unknown failure_stage %q", i, result.FailureStage))
+			}
+			if result.Classification != nil {
+				severities[result.Classification.Severity]++
+			}
+		}
+		for j, v := range result.TypedReturnValues {
+			if _, err := decodeValue(v); err != nil {
+				problems = append(problems, fmt.Sprintf("results[%d].typed_return_values[%d]: %v", i, j, err))
+			}
+		}
+	}
+
+	if passed != report.Passed {
+		problems = append(problems, fmt.Sprintf("passed is %d but %d results succeeded", report.Passed, passed))
+	}
+	if skipped != report.Skipped {
+		problems = append(problems, fmt.Sprintf("skipped is %d but %d results were skipped", report.Skipped, skipped))
+	}
+	for reason := range newSkipCounts() {
+		if count := skips[reason]; report.SkipCounts[reason] != count {
+			problems = append(problems, fmt.Sprintf("skip_counts[%s] is %d but %d results were skipped for that reason", reason, report.SkipCounts[reason], count))
+		}
+	}
+	for _, stage := range []FailureStage{StageLoad, StageValidate, StageInstantiate, StageSignature, StageExecute} {
+		if count := failures[stage]; report.FailureCounts[stage] != count {
+			problems = append(problems, fmt.Sprintf("failure_counts[%s] is %d but %d results failed at that stage", stage, report.FailureCounts[stage], count))
+		}
+	}
+	for _, severity := range []Severity{SeverityInfo, SeverityLow, SeverityMedium, SeverityHigh, SeverityCritical, SeveritySecurity} {
+		if count := severities[severity]; report.SeverityCounts[severity] != count {
+			problems = append(problems, fmt.Sprintf("severity_counts[%s] is %d but %d failed results have that severity", severity, report.SeverityCounts[severity], count))
+		}
+	}
+	buckets := make(map[string]bool)
+	for _, bucket := range report.CrashBuckets {
+		buckets[bucket.Signature] = true
+		if count := crashes[bucket.Signature]; bucket.Count != count {
+			problems = append(problems, fmt.Sprintf("crash bucket %s counts %d but %d results crashed that way", bucket.Signature, bucket.Count, count))
+		}
+	}
+	for _, result := range report.Results {
+		if result.Crash == nil {
+			continue
+		}
+		if signature := result.Crash.signature(); !buckets[signature] {
+			buckets[signature] = true
+			problems = append(problems, fmt.Sprintf("crash bucket %s is missing but %d results crashed that way", signature, crashes[signature]))
+		}
+	}
+
+	return problems
+}
+
+// isFailureStage reports whether stage is a valid stage for a failed result
+func isFailureStage(stage FailureStage) bool {
+	switch stage {
+	case StageLoad, StageValidate, StageInstantiate, StageSignature, StageExecute:
+		return true
+	}
+	return false
+}
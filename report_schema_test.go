@@ -0,0 +1,241 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// -----------------------------------------------------------------------------
+// TEST: Report Schema Migration
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Reports are archived and compared across releases. Tooling must keep
+// reading reports written before fields were added, and must refuse
+// reports from a newer schema instead of silently misreading them.
+// -----------------------------------------------------------------------------
+
+const v1Report = `{
+  "total_files": 2,
+  "passed": 1,
+  "failed": 1,
+  "results": [
+    {"file_path": "a.wasm", "file_name": "a.wasm", "success": true, "failure_stage": "none", "return_values": [2]},
+    {"file_path": "b.wasm", "file_name": "b.wasm", "success": false, "failure_stage": "load", "error_message": "load failed"}
+  ],
+  "failure_counts": {"load": 1, "validate": 0, "instantiate": 0, "execute": 0}
+}`
+
+func TestReportSchema_MigratesV1(t *testing.T) {
+	report, original, err := decodeReport([]byte(v1Report))
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, original, "unversioned reports are schema version 1")
+	assert.Equal(t, SchemaVersion, report.SchemaVersion)
+	for _, result := range report.Results {
+		assert.Equal(t, SchemaVersion, result.SchemaVersion)
+		assert.Empty(t, result.TypedReturnValues, "lossy v1 values must not be fabricated")
+	}
+	assert.Empty(t, validateReport(report))
+}
+
+func TestReportSchema_MigratesV2SignatureStage(t *testing.T) {
+	v2Report := `{
+  "schema_version": 2,
+  "total_files": 1,
+  "passed": 0,
+  "failed": 1,
+  "results": [
+    {"schema_version": 2, "file_path": "a.wasm", "file_name": "a.wasm", "success": false, "failure_stage": "execute"}
+  ],
+  "failure_counts": {"load": 0, "validate": 0, "instantiate": 0, "execute": 1}
+}`
+
+	report, original, err := decodeReport([]byte(v2Report))
+
+	require.NoError(t, err)
+	assert.Equal(t, 2, original)
+	assert.Equal(t, 0, report.FailureCounts[StageSignature])
+	assert.Contains(t, report.FailureCounts, StageSignature)
+	assert.Empty(t, validateReport(report))
+}
+
+func TestReportSchema_MigratesV3SkippedCount(t *testing.T) {
+	v3Report := `{
+  "schema_version": 3,
+  "total_files": 1,
+  "passed": 1,
+  "failed": 0,
+  "results": [
+    {"schema_version": 3, "file_path": "a.wasm", "file_name": "a.wasm", "success": true, "failure_stage": "none"}
+  ],
+  "failure_counts": {"load": 0, "validate": 0, "instantiate": 0, "signature": 0, "execute": 0}
+}`
+
+	report, original, err := decodeReport([]byte(v3Report))
+
+	require.NoError(t, err)
+	assert.Equal(t, 3, original)
+	assert.Zero(t, report.Skipped)
+	assert.Equal(t, newSkipCounts(), report.SkipCounts)
+	assert.Empty(t, validateReport(report))
+}
+
+func TestReportSchema_MigratesV4(t *testing.T) {
+	v4Report := `{
+  "schema_version": 4,
+  "total_files": 1,
+  "passed": 1,
+  "failed": 0,
+  "skipped": 0,
+  "results": [
+    {"schema_version": 4, "file_path": "a.wasm", "file_name": "a.wasm", "success": true, "failure_stage": "none"}
+  ],
+  "failure_counts": {"load": 0, "validate": 0, "instantiate": 0, "signature": 0, "execute": 0},
+  "skip_counts": {}
+}`
+
+	report, original, err := decodeReport([]byte(v4Report))
+
+	require.NoError(t, err)
+	assert.Equal(t, 4, original)
+	assert.Equal(t, SchemaVersion, report.Results[0].SchemaVersion)
+	assert.Nil(t, report.Sweep, "v4 reports have none of the fields added since")
+	assert.Nil(t, report.Results[0].Intercept)
+}
+
+func TestReportSchema_KeepsIntegersAbove2To53(t *testing.T) {
+	// 2^53+1 is the first integer float64 cannot hold
+	report := FuzzingReport{
+		SchemaVersion: SchemaVersion,
+		TotalFiles:    1,
+		Passed:        1,
+		Results: []ExecutionResult{{
+			SchemaVersion: SchemaVersion,
+			FilePath:      "a.wasm",
+			FileName:      "a.wasm",
+			Success:       true,
+			FailureStage:  StageNone,
+			ReturnValues:  []interface{}{int64(1<<53 + 1)},
+		}},
+	}
+	data, err := json.Marshal(report)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "report.json")
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+
+	loaded, err := loadReport(path)
+	require.NoError(t, err)
+	again, err := json.Marshal(loaded)
+	require.NoError(t, err)
+	assert.Contains(t, string(again), `"return_values":[9007199254740993]`)
+
+	// Migrated reports keep them too
+	v4 := `{"schema_version": 4, "results": [{"schema_version": 4, "return_values": [9007199254740993]}]}`
+	migrated, _, err := migrateReportJSON([]byte(v4))
+	require.NoError(t, err)
+	assert.Contains(t, string(migrated), `"return_values":[9007199254740993]`)
+}
+
+func TestReportSchema_ChecksSkippedResults(t *testing.T) {
+	report := FuzzingReport{
+		SchemaVersion: SchemaVersion,
+		TotalFiles:    2,
+		Passed:        1,
+		Skipped:       1,
+		Results: []ExecutionResult{
+			{SchemaVersion: SchemaVersion, Success: true, FailureStage: StageNone},
+			skippedResult("b.wasm", SkipUnsupportedFeature, "requires disabled proposals: threads"),
+		},
+		FailureCounts: newFailureCounts(),
+		SkipCounts:    map[SkipReason]int{SkipUnsupportedFeature: 1},
+	}
+	assert.Empty(t, validateReport(report))
+
+	report.SkipCounts = newSkipCounts()
+	assert.Contains(t, validateReport(report), "skip_counts[unsupported_feature] is 0 but 1 results were skipped for that reason")
+	report.SkipCounts[SkipUnsupportedFeature] = 1
+	report.Results[1].SkipReason = "tired"
+	assert.Contains(t, validateReport(report), `results[1]: skipped result has unknown skip_reason "tired"`)
+	report.Results[1].SkipReason = SkipUnsupportedFeature
+
+	report.Skipped, report.Failed = 0, 1
+	assert.Contains(t, validateReport(report), "skipped is 0 but 1 results were skipped")
+	report.Results[1].FailureStage = StageValidate
+	assert.Contains(t, validateReport(report), "results[1]: skipped result has an outcome")
+}
+
+func TestReportSchema_RejectsNewerVersion(t *testing.T) {
+	_, original, err := decodeReport([]byte(`{"schema_version": 99, "results": []}`))
+
+	assert.Equal(t, 99, original)
+	assert.ErrorContains(t, err, "newer than supported")
+}
+
+func TestReportSchema_RejectsUnknownFields(t *testing.T) {
+	_, _, err := decodeReport([]byte(`{"schema_version": 2, "results": [], "totl_files": 3}`))
+
+	assert.ErrorContains(t, err, "totl_files")
+}
+
+// -----------------------------------------------------------------------------
+// TEST: Report Consistency Validation
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Hand-edited or partially written reports can have totals that disagree
+// with their results. CI gates built on these numbers must not trust them.
+// -----------------------------------------------------------------------------
+
+func TestReportSchema_DetectsInconsistentTotals(t *testing.T) {
+	report := FuzzingReport{
+		SchemaVersion: SchemaVersion,
+		TotalFiles:    2,
+		Passed:        2,
+		Failed:        0,
+		Results: []ExecutionResult{
+			{SchemaVersion: SchemaVersion, Success: true, FailureStage: StageNone},
+			{SchemaVersion: SchemaVersion, Success: false, FailureStage: "bogus"},
+		},
+		FailureCounts: map[FailureStage]int{},
+	}
+
+	problems := validateReport(report)
+
+	assert.Contains(t, problems, "passed is 2 but 1 results succeeded")
+	assert.Contains(t, problems, `results[1]: failed result has unknown failure_stage "bogus"`)
+}
+
+func TestReportSchema_GeneratedReportIsValid(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ok.wasm"), []byte("ok"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bad.wasm"), []byte("bad"), 0o644))
+
+	mockRuntime := &MockWasmRuntime{
+		LoadModuleFunc: func(filePath string) (WasmModule, error) {
+			if filepath.Base(filePath) == "bad.wasm" {
+				return nil, &RuntimeError{Stage: StageValidate, Message: "invalid"}
+			}
+			return &MockWasmModule{}, nil
+		},
+	}
+
+	report, err := runFuzzerWithRuntime(dir, mockRuntime)
+	require.NoError(t, err)
+
+	data, err := json.Marshal(report)
+	require.NoError(t, err)
+
+	decoded, original, err := decodeReport(data)
+	require.NoError(t, err)
+	assert.Equal(t, SchemaVersion, original)
+	assert.Empty(t, validateReport(decoded))
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	goruntime "runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// releaser is a native runtime object freed by Release
+type releaser interface {
+	Release()
+}
+
+// ResourceProblem is a runtime object that was not released properly while
+// a file ran: one still alive once its module was closed, or one released
+// when it was not alive
+type ResourceProblem struct {
+	Kind    string `json:"kind"`
+	Problem string `json:"problem"`
+	// Site is where a leaked object was created, or where an object was
+	// released twice, outside the runtime itself, so the harness or
+	// injection code responsible is named
+	Site string `json:"site,omitempty"`
+}
+
+const (
+	problemLeaked   = "leaked"
+	problemReleased = "released twice"
+)
+
+// trackedResource is a live object
+type trackedResource struct {
+	kind string
+	site string
+	seq  uint64
+	// pooled objects are kept alive on purpose, for reuse
+	pooled bool
+}
+
+// resourceTracker records the creation and release of every native object
+// a runtime owns. Counting is always on; creation sites are recorded in
+// debug mode only, as walking the stack is slow.
+type resourceTracker struct {
+	mu       sync.Mutex
+	seq      uint64
+	live     map[releaser]*trackedResource
+	sites    bool
+	problems []ResourceProblem
+}
+
+// newResourceTracker returns an empty tracker
+func newResourceTracker() *resourceTracker {
+	return &resourceTracker{live: make(map[releaser]*trackedResource)}
+}
+
+// recordSites makes the tracker record where objects are created
+func (t *resourceTracker) recordSites() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sites = true
+}
+
+// track records a newly created object
+func (t *resourceTracker) track(obj releaser) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.seq++
+	resource := &trackedResource{kind: resourceKind(obj), seq: t.seq}
+	if t.sites {
+		resource.site = creationSite()
+	}
+	t.live[obj] = resource
+}
+
+// release releases an object and stops tracking it. Releasing an object
+// that is not alive is recorded as a problem, and not passed on.
+func (t *resourceTracker) release(obj releaser) {
+	t.mu.Lock()
+	_, ok := t.live[obj]
+	delete(t.live, obj)
+	if !ok {
+		problem := ResourceProblem{Kind: resourceKind(obj), Problem: problemReleased}
+		if t.sites {
+			problem.Site = creationSite()
+		}
+		t.problems = append(t.problems, problem)
+	}
+	t.mu.Unlock()
+	if ok {
+		obj.Release()
+	}
+}
+
+// pool marks objects kept alive for reuse, or no longer kept, so they are
+// not reported as leaks
+func (t *resourceTracker) pool(pooled bool, objs ...releaser) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, obj := range objs {
+		if resource, ok := t.live[obj]; ok {
+			resource.pooled = pooled
+		}
+	}
+}
+
+// count returns the number of live objects
+func (t *resourceTracker) count() int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return int64(len(t.live))
+}
+
+// mark returns a mark for the objects created from now on, and forgets
+// earlier problems. A nil tracker does nothing.
+func (t *resourceTracker) mark() uint64 {
+	if t == nil {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.problems = nil
+	return t.seq
+}
+
+// audit returns the problems since mark: objects created since then that
+// are alive and not pooled, in order of creation, then bad releases.
+// A nil tracker has none.
+func (t *resourceTracker) audit(mark uint64) []ResourceProblem {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var leaked []*trackedResource
+	for _, resource := range t.live {
+		if resource.seq > mark && !resource.pooled {
+			leaked = append(leaked, resource)
+		}
+	}
+	sort.Slice(leaked, func(i, j int) bool { return leaked[i].seq < leaked[j].seq })
+
+	var problems []ResourceProblem
+	for _, resource := range leaked {
+		problems = append(problems, ResourceProblem{Kind: resource.kind, Problem: problemLeaked, Site: resource.site})
+	}
+	return append(problems, t.problems...)
+}
+
+// resourceKind names an object's type without its package path
+func resourceKind(obj releaser) string {
+	return strings.TrimPrefix(fmt.Sprintf("%T", obj), "*")
+}
+
+// creationSite returns the first caller outside the tracker and the
+// runtime, as file:line. Double releases use it for the release site.
+func creationSite() string {
+	pcs := make([]uintptr, 32)
+	frames := goruntime.CallersFrames(pcs[:goruntime.Callers(3, pcs)])
+	for {
+		frame, more := frames.Next()
+		switch file := filepath.Base(frame.File); file {
+		case "resources.go", "runtime_wasmedge.go":
+		default:
+			return fmt.Sprintf("%s:%d", file, frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+// resourceAuditor is implemented by runtimes tracking their native objects
+type resourceAuditor interface {
+	resources() *resourceTracker
+}
+
+// debugTracker returns the tracker of a runtime whose objects are audited
+// per file, or nil
+func debugTracker(runtime WasmRuntime, opts RunOptions) *resourceTracker {
+	auditor, ok := runtime.(resourceAuditor)
+	if !opts.DebugResources || !ok {
+		return nil
+	}
+	tracker := auditor.resources()
+	tracker.recordSites()
+	return tracker
+}
+
+// processAudited processes a file, listing the runtime objects it leaked
+// or released twice when tracker is set
+func processAudited(filePath string, runtime WasmRuntime, tracker *resourceTracker, opts RunOptions) ExecutionResult {
+	mark := tracker.mark()
+	result := processWasmFileWithOptions(filePath, runtime, opts)
+	result.ResourceProblems = tracker.audit(mark)
+	return result
+}
@@ -0,0 +1,127 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeObject is a native object counting its releases
+type fakeObject struct {
+	released int
+}
+
+func (o *fakeObject) Release() {
+	o.released++
+}
+
+// auditedRuntime is a mock runtime whose modules create tracked objects,
+// leaking one for files named leak*
+type auditedRuntime struct {
+	MockWasmRuntime
+	tracker *resourceTracker
+}
+
+func (r *auditedRuntime) resources() *resourceTracker {
+	return r.tracker
+}
+
+func (r *auditedRuntime) LoadModule(filePath string) (WasmModule, error) {
+	store := &fakeObject{}
+	r.tracker.track(store)
+	if strings.HasPrefix(filepath.Base(filePath), "leak") {
+		r.tracker.track(&fakeObject{})
+	}
+	return &auditedModule{runtime: r, store: store}, nil
+}
+
+// auditedModule releases its store when closed
+type auditedModule struct {
+	MockWasmModule
+	runtime *auditedRuntime
+	store   *fakeObject
+}
+
+func (m *auditedModule) Close() {
+	m.runtime.tracker.release(m.store)
+}
+
+// -----------------------------------------------------------------------------
+// TEST: Resource Auditing
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// A handle leaked or released twice at the CGO boundary is a cleanup bug
+// in the harness or injection code that Go cannot see. Auditing each file
+// has to name the object and where it was created, without flagging the
+// objects the runtime keeps alive on purpose.
+// -----------------------------------------------------------------------------
+
+func TestResources_ReportsLeaksSinceMark(t *testing.T) {
+	tracker := newResourceTracker()
+	before := &fakeObject{}
+	tracker.track(before)
+
+	mark := tracker.mark()
+	kept, leaked, pooled := &fakeObject{}, &fakeObject{}, &fakeObject{}
+	tracker.track(kept)
+	tracker.track(leaked)
+	tracker.track(pooled)
+	tracker.pool(true, pooled)
+	tracker.release(kept)
+
+	assert.Equal(t, 1, kept.released)
+	assert.Equal(t, int64(3), tracker.count())
+	assert.Equal(t, []ResourceProblem{
+		{Kind: "main.fakeObject", Problem: problemLeaked},
+	}, tracker.audit(mark), "objects from before the mark and pooled objects are not leaks")
+}
+
+func TestResources_DetectsDoubleRelease(t *testing.T) {
+	tracker := newResourceTracker()
+	tracker.recordSites()
+	mark := tracker.mark()
+
+	obj := &fakeObject{}
+	tracker.track(obj)
+	tracker.release(obj)
+	tracker.release(obj)
+
+	assert.Equal(t, 1, obj.released, "the second release must not reach the object")
+	problems := tracker.audit(mark)
+	require.Len(t, problems, 1)
+	assert.Equal(t, problemReleased, problems[0].Problem)
+	assert.True(t, strings.HasPrefix(problems[0].Site, "resources_test.go:"), problems[0].Site)
+
+	assert.Empty(t, tracker.audit(tracker.mark()), "a new mark forgets earlier problems")
+}
+
+func TestResources_AuditsEachFile(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"clean.wasm", "leak.wasm"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte{0}, 0o644))
+	}
+	runtime := &auditedRuntime{tracker: newResourceTracker()}
+	envs := []environmentRuntime{{Runtime: runtime}}
+
+	report, err := runFuzzerWithMatrix(dir, envs, RunOptions{DebugResources: true})
+	require.NoError(t, err)
+	require.Len(t, report.Results, 2)
+	assert.Empty(t, report.Results[0].ResourceProblems)
+	problems := report.Results[1].ResourceProblems
+	require.Len(t, problems, 1)
+	assert.Equal(t, "main.fakeObject", problems[0].Kind)
+	assert.Equal(t, problemLeaked, problems[0].Problem)
+	assert.True(t, strings.HasPrefix(problems[0].Site, "resources_test.go:"), problems[0].Site)
+
+	report, err = runFuzzerWithMatrix(dir, envs, RunOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, report.Results[1].ResourceProblems, "only audited in debug mode")
+}
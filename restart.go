@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RestartConfig paces the restarts of isolated workers that die before
+// running their file, as when the runtime library is broken rather than
+// a module
+type RestartConfig struct {
+	// Backoff is the pause before starting a worker after such a death,
+	// doubled for each one in a row up to MaxBackoff (default 100ms and
+	// 10s)
+	Backoff    time.Duration `yaml:"backoff"`
+	MaxBackoff time.Duration `yaml:"max_backoff"`
+	// CrashLoop is how many such deaths in a row make a crash loop, which
+	// gives up on the environment's worker (default 5)
+	CrashLoop int `yaml:"crash_loop"`
+}
+
+// check rejects negative pauses and limits
+func (c RestartConfig) check() error {
+	if c.Backoff < 0 || c.MaxBackoff < 0 {
+		return errors.New("restart: backoff must not be negative")
+	}
+	if c.CrashLoop < 0 {
+		return errors.New("restart: crash_loop must not be negative")
+	}
+	return nil
+}
+
+// withDefaults fills in the unset settings
+func (c RestartConfig) withDefaults() RestartConfig {
+	if c.Backoff == 0 {
+		c.Backoff = 100 * time.Millisecond
+	}
+	if c.MaxBackoff == 0 {
+		c.MaxBackoff = 10 * time.Second
+	}
+	if c.CrashLoop == 0 {
+		c.CrashLoop = 5
+	}
+	return c
+}
+
+// backoff is the pause after the given number of deaths in a row
+func (c RestartConfig) backoff(deaths int) time.Duration {
+	pause := c.Backoff
+	for i := 1; i < deaths && pause < c.MaxBackoff; i++ {
+		pause *= 2
+	}
+	if pause > c.MaxBackoff {
+		pause = c.MaxBackoff
+	}
+	return pause
+}
+
+// restartPause waits before a worker is started again
+var restartPause = time.Sleep
+
+// CrashLoop is a worker that kept dying before running its file, so the
+// files of its environment left were skipped as crash_loop
+type CrashLoop struct {
+	Environment string `json:"environment,omitempty"`
+	// Worker is the kind of worker, campaign-worker or large-module-worker
+	Worker string `json:"worker"`
+	// Deaths counts the deaths in a row, and LastError is the last one's
+	Deaths    int    `json:"deaths"`
+	LastError string `json:"last_error"`
+	Skipped   int    `json:"skipped"`
+}
+
+// crashedWorker reports whether a file's worker crashed on it, rather
+// than hung or failed to start
+func crashedWorker(result ExecutionResult) bool {
+	return strings.HasPrefix(result.ErrorMessage, "worker died") || result.FailureSubStage == SubStageSanitizer
+}
+
+// summarizeWorkers counts the restarts of a campaign's workers, and
+// names the environment of each crash loop
+func summarizeWorkers(envs []environmentRuntime, pools ...[]*isolatedWorker) (restarts int, loops []CrashLoop) {
+	for _, workers := range pools {
+		for i, worker := range workers {
+			restarts += worker.restarts
+			if loop := worker.loop; loop != nil {
+				loop.Environment = envs[i].Environment.Name
+				loops = append(loops, *loop)
+			}
+		}
+	}
+	return restarts, loops
+}
+
+// crashLoopDetails explains why a file was skipped as crash_loop
+func crashLoopDetails(loop *CrashLoop) string {
+	return fmt.Sprintf("%d workers in a row died before running a file, last: %s", loop.Deaths, loop.LastError)
+}
@@ -0,0 +1,159 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scriptedWorkers replaces worker subprocesses with fakes that pass every
+// file but those crash names, on which they segfault in the execute
+// stage, and returns the number of workers started
+func scriptedWorkers(t *testing.T, crash func(filePath string) bool) *int {
+	started := 0
+	original := startWorker
+	startWorker = func(args, env []string) (*workerProcess, error) {
+		started++
+		respRead, respWrite, err := os.Pipe()
+		require.NoError(t, err)
+		responses := json.NewEncoder(respWrite)
+		return &workerProcess{
+			requests: writerFunc(func(p []byte) (int, error) {
+				var request workerRequest
+				require.NoError(t, json.Unmarshal(p, &request))
+				if crash(request.FilePath) {
+					responses.Encode(workerMessage{Stage: StageExecute})
+					respWrite.Close()
+					return len(p), nil
+				}
+				result := processWasmFileWithRuntime(request.FilePath, &MockWasmRuntime{})
+				return len(p), responses.Encode(workerMessage{Result: &result})
+			}),
+			responses: respRead,
+			kill:      func() { respWrite.Close() },
+			wait:      func() string { return "signal: segmentation fault" },
+		}, nil
+	}
+	t.Cleanup(func() { startWorker = original })
+	return &started
+}
+
+// recordPauses records the backoff before each restart instead of waiting
+func recordPauses(t *testing.T) *[]time.Duration {
+	var pauses []time.Duration
+	original := restartPause
+	restartPause = func(d time.Duration) { pauses = append(pauses, d) }
+	t.Cleanup(func() { restartPause = original })
+	return &pauses
+}
+
+// -----------------------------------------------------------------------------
+// TEST: Worker Restarts
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// A module that segfaults the runtime should cost one worker, not a worker
+// per rerun, and should not be retried forever. A worker that dies before
+// it runs anything is broken itself, as when the runtime library is
+// missing; restarting it in a tight loop would fail every file of its
+// shard with the same error, so restarts back off, and a crash loop is
+// reported and the shard's remaining files skipped instead.
+// -----------------------------------------------------------------------------
+
+func TestRestart_QuarantinesFileThatCrashedItsWorker(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.wasm", "b_crash.wasm", "c.wasm"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(name), 0o644))
+	}
+	started := scriptedWorkers(t, func(filePath string) bool { return strings.Contains(filePath, "crash") })
+	pauses := recordPauses(t)
+
+	opts := RunOptions{
+		WorkerArgs:  []string{dir},
+		Quarantine:  QuarantineConfig{Path: filepath.Join(t.TempDir(), "quarantine.json")},
+		Determinism: 3,
+	}
+	report, err := runFuzzerWithMatrix(dir, []environmentRuntime{{Runtime: &MockWasmRuntime{}}}, opts)
+	require.NoError(t, err)
+
+	require.Len(t, report.Results, 3)
+	crash := report.Results[1]
+	assert.Equal(t, "worker died in the execute stage: signal: segmentation fault", crash.ErrorMessage)
+	assert.Empty(t, crash.Nondeterminism, "reruns report the crash without running the file")
+	assert.True(t, crash.Quarantined)
+	assert.True(t, report.Results[2].Success)
+	assert.Equal(t, 2, *started, "one worker is lost to the crash")
+	assert.Equal(t, 1, report.WorkerRestarts)
+	assert.Empty(t, *pauses, "a worker that died of its file restarts at once")
+	assert.Empty(t, report.CrashLoops)
+
+	require.NotNil(t, report.Quarantine)
+	require.Len(t, report.Quarantine.Added, 1)
+	assert.Equal(t, "crashed its worker", report.Quarantine.Added[0].Reason)
+	assert.Equal(t, crash.FilePath, report.Quarantine.Added[0].FilePath)
+}
+
+func TestRestart_ReportsCrashLoop(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.wasm", "b.wasm", "c.wasm", "d.wasm"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(name), 0o644))
+	}
+	fakeWorkers(t, &MockWasmRuntime{})
+	startFake := startWorker
+	startWorker = func(args, env []string) (*workerProcess, error) {
+		process, err := startFake(args, env)
+		// The worker dies before it reports any progress
+		kill := process.kill
+		process.requests = writerFunc(func(p []byte) (int, error) {
+			kill()
+			return len(p), nil
+		})
+		return process, err
+	}
+	pauses := recordPauses(t)
+
+	opts := RunOptions{WorkerArgs: []string{dir}, Restart: RestartConfig{Backoff: time.Second, CrashLoop: 3}}
+	var report FuzzingReport
+	stderr := captureStderr(t, func() {
+		var err error
+		report, err = runFuzzerWithMatrix(dir, []environmentRuntime{{Runtime: &MockWasmRuntime{}, Environment: Environment{Name: "asan"}}}, opts)
+		require.NoError(t, err)
+	})
+
+	require.Len(t, report.Results, 4)
+	for _, result := range report.Results[:3] {
+		assert.Equal(t, "worker died in the load stage: signal: killed", result.ErrorMessage)
+	}
+	skipped := report.Results[3]
+	assert.True(t, skipped.Skipped)
+	assert.Equal(t, SkipCrashLoop, skipped.SkipReason)
+	assert.Equal(t, "3 workers in a row died before running a file, last: worker died in the load stage: signal: killed", skipped.SkipDetails)
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second}, *pauses)
+
+	require.Len(t, report.CrashLoops, 1)
+	assert.Equal(t, CrashLoop{Environment: "asan", Worker: "campaign-worker", Deaths: 3, LastError: "worker died in the load stage: signal: killed", Skipped: 1}, report.CrashLoops[0])
+	assert.Equal(t, 2, report.WorkerRestarts)
+	assert.Contains(t, string(stderr), "worker crash loop")
+	assert.Empty(t, validateReport(report))
+}
+
+func TestRestartConfig_Backoff(t *testing.T) {
+	config := RestartConfig{}.withDefaults()
+	assert.Equal(t, 100*time.Millisecond, config.backoff(1))
+	assert.Equal(t, 400*time.Millisecond, config.backoff(3))
+	assert.Equal(t, 10*time.Second, config.backoff(30), "capped")
+	assert.Equal(t, 5, config.CrashLoop)
+
+	assert.Error(t, RestartConfig{Backoff: -time.Second}.check())
+	assert.Error(t, RestartConfig{CrashLoop: -1}.check())
+	assert.NoError(t, RestartConfig{}.check())
+}
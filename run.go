@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// linkRecorder records the host functions a module is linked to, so the
+// verbose run can show how each import was resolved
+type linkRecorder struct {
+	WasmRuntime
+	linked map[string]HostFunction
+}
+
+// LoadModuleWithHost implements HostLoader.LoadModuleWithHost
+func (r *linkRecorder) LoadModuleWithHost(filePath string, data []byte, host []HostFunction) (WasmModule, error) {
+	loader, ok := r.WasmRuntime.(HostLoader)
+	if !ok {
+		return nil, fmt.Errorf("runtime cannot link host functions")
+	}
+	r.linked = make(map[string]HostFunction, len(host))
+	for _, fn := range host {
+		r.linked[fn.Module+"."+fn.Name] = fn
+	}
+	return loader.LoadModuleWithHost(filePath, data, host)
+}
+
+// LoadModuleBytes implements BufferLoader.LoadModuleBytes
+func (r *linkRecorder) LoadModuleBytes(name string, data []byte) (WasmModule, error) {
+	return (&bufferRuntime{runtime: r.WasmRuntime, data: data}).LoadModule(name)
+}
+
+// CheckModule implements StageChecker.CheckModule
+func (r *linkRecorder) CheckModule(filePath string, stage FailureStage) error {
+	return runTruncated(filePath, r.WasmRuntime, stage)
+}
+
+// spanRecorder keeps the spans of a verbose run instead of exporting them
+type spanRecorder struct {
+	spans []SpanData
+}
+
+// ExportSpans implements SpanExporter.ExportSpans
+func (r *spanRecorder) ExportSpans(serviceName string, spans []SpanData) error {
+	r.spans = append(r.spans, spans...)
+	return nil
+}
+
+// runFile runs one file, writing what the runtime was asked to do to
+// verbose when it is non-nil
+func runFile(filePath string, env environmentRuntime, opts RunOptions, verbose io.Writer) ExecutionResult {
+	if verbose == nil {
+		return processWasmFileWithOptions(filePath, env.Runtime, opts)
+	}
+
+	recorder := &linkRecorder{WasmRuntime: env.Runtime}
+	spans := &spanRecorder{}
+	previous := tracer
+	tracer = NewTracer(spans, "wasm-fuzzer", "")
+	result := processWasmFileWithOptions(filePath, recorder, opts)
+	tracer.Shutdown()
+	tracer = previous
+
+	writeVerboseRun(verbose, filePath, env.Environment, recorder.linked, spans.spans, result)
+	return result
+}
+
+// writeVerboseRun describes a run: the environment's proposals against
+// the module's, how each import was resolved, the time spent in each
+// stage and the complete error
+func writeVerboseRun(w io.Writer, filePath string, env Environment, linked map[string]HostFunction, spans []SpanData, result ExecutionResult) {
+	fmt.Fprintf(w, "file: %s\n", filePath)
+	name := env.Name
+	if name == "" {
+		name = "default"
+	}
+	fmt.Fprintf(w, "environment: %s\n", name)
+
+	enabled := append([]string(nil), env.Proposals...)
+	for proposal := range defaultProposals {
+		enabled = append(enabled, proposal)
+	}
+	sort.Strings(enabled)
+	fmt.Fprintf(w, "proposals enabled: %s\n", strings.Join(enabled, ", "))
+	used := detectFileFeatures(filePath).sorted()
+	for i, proposal := range used {
+		if !defaultProposals[proposal] && !containsString(env.Proposals, proposal) {
+			used[i] += " (disabled)"
+		}
+	}
+	fmt.Fprintf(w, "proposals used: %s\n", describeList(used))
+
+	data, _ := os.ReadFile(filePath)
+	imports := moduleImports(data)
+	fmt.Fprintf(w, "imports: %d\n", len(imports))
+	for _, imp := range imports {
+		resolution := "left to the runtime"
+		if fn, ok := linked[imp.Module+"."+imp.Name]; ok && fn.Stub != "" {
+			resolution = "stub, " + fn.Stub
+		} else if ok {
+			resolution = "host"
+		}
+		fmt.Fprintf(w, "  %s.%s %s: %s\n", imp.Module, imp.Name, imp.Signature, resolution)
+	}
+
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].Start.Before(spans[j].Start) })
+	fmt.Fprintln(w, "stages:")
+	for _, span := range spans {
+		line := fmt.Sprintf("  %-12s %s", span.Name, span.End.Sub(span.Start).Round(time.Microsecond))
+		if span.Err != nil {
+			line += "  failed"
+		}
+		fmt.Fprintln(w, line)
+	}
+
+	if result.Success {
+		fmt.Fprintln(w, "result: success")
+		return
+	}
+	stage := string(result.FailureStage)
+	if result.FailureSubStage != "" {
+		stage += "/" + result.FailureSubStage
+	}
+	fmt.Fprintf(w, "result: failed in %s\n", stage)
+	fmt.Fprintf(w, "error:\n  %s\n", strings.ReplaceAll(result.ErrorMessage, "\n", "\n  "))
+	if result.Stderr != "" {
+		fmt.Fprintf(w, "stderr:\n  %s\n", strings.ReplaceAll(strings.TrimSuffix(result.Stderr, "\n"), "\n", "\n  "))
+	}
+}
+
+// describeList joins names, or says there are none
+func describeList(names []string) string {
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ", ")
+}
+
+// containsString reports whether list holds s
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// runFileCommand runs exactly one file outside a campaign, writing its
+// result as JSON. It fails when the file does.
+func runFileCommand(args []string) int {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	configPath := flags.String("config", "", "YAML campaign config")
+	verbose := flags.Bool("verbose", false, "describe the run on stderr")
+
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		emitError(map[string]string{
+			"error": "usage: wasm-fuzzer run [--config file.yaml] [--verbose] <file.wasm>",
+		})
+		return 1
+	}
+	filePath := flags.Arg(0)
+	if _, err := os.Stat(filePath); err != nil {
+		emitError(map[string]string{
+			"error":   "module access failed",
+			"details": err.Error(),
+		})
+		return 1
+	}
+
+	config, err := resolveConfig(*configPath)
+	if err != nil {
+		emitError(map[string]string{
+			"error":   "config load failed",
+			"details": err.Error(),
+		})
+		return 1
+	}
+	envs, err := buildEnvironmentRuntimes(config)
+	if err != nil {
+		emitError(map[string]string{
+			"error":   "invalid environment matrix",
+			"details": err.Error(),
+		})
+		return 1
+	}
+	defer closeRuntimes(envs)
+	redactor, err := newRedactor(config.Redaction)
+	if err != nil {
+		emitError(map[string]string{
+			"error":   "invalid redaction",
+			"details": err.Error(),
+		})
+		return 1
+	}
+	classifiers, err := newClassifierChain(config.Classifiers)
+	if err != nil {
+		emitError(map[string]string{
+			"error":   "invalid classifiers",
+			"details": err.Error(),
+		})
+		return 1
+	}
+
+	// The file runs in the first environment of the matrix
+	var diagnostics io.Writer
+	if *verbose {
+		diagnostics = os.Stderr
+	}
+	result := runFile(filePath, envs[0], config.runOptions(), diagnostics)
+	result.Classification = classifiers.classify(result)
+	assignErrorCodes(&result)
+	if err := redactor.redact(&result); err != nil {
+		emitError(map[string]string{
+			"error":   "redaction failed",
+			"details": err.Error(),
+		})
+		return 1
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(result)
+	if !result.Success {
+		return 1
+	}
+	return 0
+}
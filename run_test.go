@@ -0,0 +1,70 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// -----------------------------------------------------------------------------
+// TEST: Verbose Single-File Runs
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// When one file misbehaves, the question is what the harness did to it:
+// which proposals it ran with, which imports got real host functions and
+// which got stand-ins, where the time went and what exactly failed. A
+// campaign report answers none of that.
+// -----------------------------------------------------------------------------
+
+func TestRun_VerboseDescribesRun(t *testing.T) {
+	binary := pluginBinary(
+		wasmFuncImport{Module: wasiModule, Name: "fd_write", Signature: funcSig("i32 i32 i32 i32", "i32")},
+		wasmFuncImport{Module: wasiModule, Name: "sock_accept", Signature: funcSig("i32 i32 i32", "i32")},
+		wasmFuncImport{Module: "env", Name: "abort", Signature: funcSig("", "")},
+	)
+	path := filepath.Join(t.TempDir(), "verbose.wasm")
+	require.NoError(t, os.WriteFile(path, binary, 0o644))
+	module := newContractModule(map[string]FuncSignature{"run": funcSig("", "i32")}, map[string]contractExport{
+		"run": func(m *contractModule, args []interface{}) ([]interface{}, error) {
+			if err := m.print(2, "thread 'main' panicked\nstack backtrace:\n  0: run\n"); err != nil {
+				return nil, err
+			}
+			return nil, &RuntimeError{Stage: StageExecute, Message: "execution failed: unreachable"}
+		},
+	})
+
+	var verbose bytes.Buffer
+	env := environmentRuntime{Environment: Environment{Proposals: []string{"threads"}}, Runtime: &emscriptenMockRuntime{module: module}}
+	opts := RunOptions{Invocation: InvocationConfig{Entry: "run", Inputs: []InvocationInput{{}}}}
+	result := runFile(path, env, opts, &verbose)
+
+	assert.False(t, result.Success)
+	out := verbose.String()
+	assert.Contains(t, out, "file: "+path+"\n")
+	assert.Contains(t, out, "environment: default\n")
+	assert.Contains(t, out, "proposals enabled: bulk-memory-operations, import-export-mut-globals, ")
+	assert.Contains(t, out, ", threads\nproposals used: none\n")
+	assert.Contains(t, out, "imports: 3\n"+
+		"  wasi_snapshot_preview1.fd_write (i32, i32, i32, i32) -> (i32): host\n"+
+		"  wasi_snapshot_preview1.sock_accept (i32, i32, i32) -> (i32): stub, returns [52]\n"+
+		"  env.abort () -> (): left to the runtime\n")
+	assert.Regexp(t, `stages:\n  process_file +\S+  failed\n  execute +\S+  failed\n`, out)
+	assert.Contains(t, out, "result: failed in execute\nerror:\n  execution failed: unreachable\n")
+	assert.Contains(t, out, "stderr:\n  thread 'main' panicked\n  stack backtrace:\n    0: run\n")
+	assert.Nil(t, tracer, "the campaign's tracer is restored")
+}
+
+func TestRun_QuietWithoutVerbose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quiet.wasm")
+	require.NoError(t, os.WriteFile(path, pluginBinary(), 0o644))
+	result := runFile(path, environmentRuntime{Runtime: &MockWasmRuntime{}}, RunOptions{}, nil)
+	assert.True(t, result.Success)
+}
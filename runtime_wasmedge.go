@@ -0,0 +1,646 @@
+//go:build integration
+// +build integration
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/second-state/WasmEdge-go/wasmedge"
+)
+
+// wasmedgeProposals maps config proposal names to WasmEdge proposals
+var wasmedgeProposals = map[string]wasmedge.Proposal{
+	"import-export-mut-globals":         wasmedge.IMPORT_EXPORT_MUT_GLOBALS,
+	"non-trap-float-to-int-conversions": wasmedge.NON_TRAP_FLOAT_TO_INT_CONVERSIONS,
+	"sign-extension-operators":          wasmedge.SIGN_EXTENSION_OPERATORS,
+	"multi-value":                       wasmedge.MULTI_VALUE,
+	"bulk-memory-operations":            wasmedge.BULK_MEMORY_OPERATIONS,
+	"reference-types":                   wasmedge.REFERENCE_TYPES,
+	"simd":                              wasmedge.SIMD,
+	"tail-call":                         wasmedge.TAIL_CALL,
+	"multi-memories":                    wasmedge.MULTI_MEMORIES,
+	"annotations":                       wasmedge.ANNOTATIONS,
+	"memory64":                          wasmedge.MEMORY64,
+	"exception-handling":                wasmedge.EXCEPTION_HANDLING,
+	"extended-const":                    wasmedge.EXTENDED_CONST,
+	"threads":                           wasmedge.THREADS,
+	"function-references":               wasmedge.FUNCTION_REFERENCES,
+}
+
+// wasmedgeValTypes maps signature type names to WasmEdge value types
+var wasmedgeValTypes = map[string]wasmedge.ValType{
+	"i32": wasmedge.ValType_I32,
+	"i64": wasmedge.ValType_I64,
+	"f32": wasmedge.ValType_F32,
+	"f64": wasmedge.ValType_F64,
+}
+
+// WasmEdgeRuntime implements WasmRuntime using the WasmEdge SDK
+type WasmEdgeRuntime struct {
+	env Environment
+
+	// idle holds the contexts of closed modules for the next ones
+	mu     sync.Mutex
+	idle   []*runtimeContext
+	closed bool
+	// tracker tracks every WasmEdge object the runtime creates
+	tracker *resourceTracker
+}
+
+// runtimeContext holds the WasmEdge objects that do not depend on the
+// module, so creating them is paid once per concurrently open module
+// rather than once per file. Store and module instances are never
+// reused: host modules are registered in the store by name.
+type runtimeContext struct {
+	conf      *wasmedge.Configure
+	loader    *wasmedge.Loader
+	validator *wasmedge.Validator
+	executor  *wasmedge.Executor
+}
+
+// acquire takes an idle context, or creates one
+func (r *WasmEdgeRuntime) acquire() *runtimeContext {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if n := len(r.idle); n > 0 {
+		ctx := r.idle[n-1]
+		r.idle = r.idle[:n-1]
+		r.tracker.pool(false, ctx.objects()...)
+		return ctx
+	}
+	conf := r.newConfigure()
+	ctx := &runtimeContext{
+		conf:      conf,
+		loader:    wasmedge.NewLoaderWithConfig(conf),
+		validator: wasmedge.NewValidatorWithConfig(conf),
+		executor:  wasmedge.NewExecutorWithConfig(conf),
+	}
+	for _, obj := range ctx.objects() {
+		r.tracker.track(obj)
+	}
+	return ctx
+}
+
+// recycle gives a context back once nothing uses it anymore
+func (r *WasmEdgeRuntime) recycle(ctx *runtimeContext) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		r.release(ctx)
+		return
+	}
+	r.tracker.pool(true, ctx.objects()...)
+	r.idle = append(r.idle, ctx)
+}
+
+// Close releases the idle contexts. Modules still open release theirs
+// when they are closed.
+func (r *WasmEdgeRuntime) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, ctx := range r.idle {
+		r.release(ctx)
+	}
+	r.idle = nil
+	r.closed = true
+}
+
+// LiveObjects implements ObjectCounter.LiveObjects
+func (r *WasmEdgeRuntime) LiveObjects() int64 {
+	return r.tracker.count()
+}
+
+// resources implements resourceAuditor
+func (r *WasmEdgeRuntime) resources() *resourceTracker {
+	return r.tracker
+}
+
+// objects returns the context's objects in reverse order of creation
+func (c *runtimeContext) objects() []releaser {
+	return []releaser{c.executor, c.validator, c.loader, c.conf}
+}
+
+// release frees a context's objects
+func (r *WasmEdgeRuntime) release(ctx *runtimeContext) {
+	for _, obj := range ctx.objects() {
+		r.tracker.release(obj)
+	}
+}
+
+// WasmEdgeModule owns the WasmEdge objects backing an instantiated module,
+// and borrows the runtime context it was loaded with until it is closed
+type WasmEdgeModule struct {
+	*runtimeContext
+	runtime *WasmEdgeRuntime
+
+	ast    *wasmedge.AST
+	store  *wasmedge.Store
+	module *wasmedge.Module
+	// aotPath is the compiled shared object for the AOT backend
+	aotPath string
+	aotAST  *wasmedge.AST
+	// hostModules hold the host functions linked to the module's imports
+	hostModules []*wasmedge.Module
+	// hostErr is the error of the host function that trapped the last call
+	hostErr error
+}
+
+// NewWasmEdgeRuntime creates a new WasmEdge runtime instance
+func NewWasmEdgeRuntime() *WasmEdgeRuntime {
+	return &WasmEdgeRuntime{tracker: newResourceTracker()}
+}
+
+// newRuntime creates a WasmEdge runtime configured for a matrix environment
+var newRuntime = func(env Environment) (WasmRuntime, error) {
+	for _, proposal := range env.Proposals {
+		if _, ok := wasmedgeProposals[proposal]; !ok {
+			return nil, fmt.Errorf("proposal %q is not supported by WasmEdge", proposal)
+		}
+	}
+	return &WasmEdgeRuntime{env: env, tracker: newResourceTracker()}, nil
+}
+
+// runtimeVersion is the version of the WasmEdge library results come from
+var runtimeVersion = func() string {
+	return wasmedge.GetVersion()
+}
+
+// newConfigure builds the WasmEdge configuration for the runtime's environment
+func (r *WasmEdgeRuntime) newConfigure() *wasmedge.Configure {
+	conf := wasmedge.NewConfigure()
+	for _, proposal := range r.env.Proposals {
+		conf.AddConfig(wasmedgeProposals[proposal])
+	}
+	if r.env.MemoryLimitPages > 0 {
+		conf.SetMaxMemoryPage(r.env.MemoryLimitPages)
+	}
+	if r.env.Backend == BackendInterpreter {
+		conf.SetForceInterpreter(true)
+	}
+	return conf
+}
+
+// LoadModule implements WasmRuntime.LoadModule
+func (r *WasmEdgeRuntime) LoadModule(filePath string) (WasmModule, error) {
+	return r.loadModule(filePath, nil, func(loader *wasmedge.Loader) (*wasmedge.AST, error) {
+		return loader.LoadFile(filePath)
+	})
+}
+
+// LoadModuleBytes implements BufferLoader.LoadModuleBytes
+// The AOT backend compiles from a file, so it still goes through disk
+func (r *WasmEdgeRuntime) LoadModuleBytes(name string, data []byte) (WasmModule, error) {
+	if r.env.Backend == BackendAOT {
+		// Wrapping hides LoadModuleBytes, forcing the temp-file fallback
+		fileOnly := struct{ WasmRuntime }{r}
+		return (&bufferRuntime{runtime: fileOnly, data: data}).LoadModule(name)
+	}
+	return r.loadModule(name, nil, func(loader *wasmedge.Loader) (*wasmedge.AST, error) {
+		return loader.LoadBuffer(data)
+	})
+}
+
+// LoadModuleWithHost implements HostLoader.LoadModuleWithHost
+func (r *WasmEdgeRuntime) LoadModuleWithHost(filePath string, data []byte, host []HostFunction) (WasmModule, error) {
+	if data == nil {
+		return r.loadModule(filePath, host, func(loader *wasmedge.Loader) (*wasmedge.AST, error) {
+			return loader.LoadFile(filePath)
+		})
+	}
+	if r.env.Backend != BackendAOT {
+		return r.loadModule(filePath, host, func(loader *wasmedge.Loader) (*wasmedge.AST, error) {
+			return loader.LoadBuffer(data)
+		})
+	}
+
+	// The AOT backend compiles from a file
+	tmp, err := os.CreateTemp("", "wasm-fuzzer-input-*.wasm")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp module: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	tmp.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to write temp module: %w", err)
+	}
+	return r.LoadModuleWithHost(tmp.Name(), nil, host)
+}
+
+// CheckModule implements StageChecker.CheckModule
+func (r *WasmEdgeRuntime) CheckModule(filePath string, stage FailureStage) error {
+	m := &WasmEdgeModule{runtimeContext: r.acquire(), runtime: r}
+	defer m.Close()
+
+	err := m.load(func(loader *wasmedge.Loader) (*wasmedge.AST, error) {
+		return loader.LoadFile(filePath)
+	})
+	if err != nil || stage == StageLoad {
+		return err
+	}
+	return m.validate()
+}
+
+// wasmedgeValidationSession holds one runtime context for all the files
+// it validates; only each file's AST is released in between
+type wasmedgeValidationSession struct {
+	*runtimeContext
+	runtime *WasmEdgeRuntime
+}
+
+// NewValidationSession implements BatchValidator.NewValidationSession
+func (r *WasmEdgeRuntime) NewValidationSession() ValidationSession {
+	return &wasmedgeValidationSession{runtimeContext: r.acquire(), runtime: r}
+}
+
+// Validate implements ValidationSession.Validate
+func (s *wasmedgeValidationSession) Validate(filePath string) error {
+	ast, err := s.loader.LoadFile(filePath)
+	if err != nil {
+		return &RuntimeError{Stage: StageLoad, Message: fmt.Sprintf("load failed: %v", err)}
+	}
+	s.runtime.tracker.track(ast)
+	defer s.runtime.tracker.release(ast)
+	if err := s.validator.Validate(ast); err != nil {
+		return &RuntimeError{Stage: StageValidate, Message: fmt.Sprintf("validation failed: %v", err)}
+	}
+	return nil
+}
+
+// Close implements ValidationSession.Close
+func (s *wasmedgeValidationSession) Close() {
+	s.runtime.recycle(s.runtimeContext)
+}
+
+// load runs the load stage
+func (m *WasmEdgeModule) load(load func(*wasmedge.Loader) (*wasmedge.AST, error)) error {
+	return runStage(StageLoad, func() error {
+		ast, err := load(m.loader)
+		if err != nil {
+			return &RuntimeError{Stage: StageLoad, Message: fmt.Sprintf("load failed: %v", err)}
+		}
+		m.ast = ast
+		m.runtime.tracker.track(ast)
+		return nil
+	})
+}
+
+// validate runs the validate stage on the loaded module
+func (m *WasmEdgeModule) validate() error {
+	return runStage(StageValidate, func() error {
+		if err := m.validator.Validate(m.ast); err != nil {
+			return &RuntimeError{Stage: StageValidate, Message: fmt.Sprintf("validation failed: %v", err)}
+		}
+		return nil
+	})
+}
+
+// loadModule runs the load, validate and instantiate stages, releasing
+// everything allocated so far if any stage fails. Host functions are
+// registered as import modules before instantiation.
+func (r *WasmEdgeRuntime) loadModule(filePath string, host []HostFunction, load func(*wasmedge.Loader) (*wasmedge.AST, error)) (WasmModule, error) {
+	// Reuse the configuration, loader, validator and executor of a
+	// module closed earlier
+	m := &WasmEdgeModule{runtimeContext: r.acquire(), runtime: r}
+
+	// Stage 1: Load WASM file
+	if err := m.load(load); err != nil {
+		m.Close()
+		return nil, err
+	}
+
+	// Stage 2: Validate WASM module
+	if err := m.validate(); err != nil {
+		m.Close()
+		return nil, err
+	}
+
+	// Stage 3: Instantiate WASM module
+	err := runStage(StageInstantiate, func() error {
+		m.store = wasmedge.NewStore()
+		r.tracker.track(m.store)
+		if err := m.registerHost(host); err != nil {
+			return &RuntimeError{Stage: StageInstantiate, Message: fmt.Sprintf("host functions: %v", err)}
+		}
+
+		ast := m.ast
+		if r.env.Backend == BackendAOT {
+			compiled, err := m.compileAOT(filePath)
+			if err != nil {
+				return err
+			}
+			ast = compiled
+		}
+
+		module, err := m.executor.Instantiate(m.store, ast)
+		if err != nil {
+			return &RuntimeError{Stage: StageInstantiate, Message: fmt.Sprintf("instantiation failed: %v", err)}
+		}
+		m.module = module
+		r.tracker.track(module)
+		return nil
+	})
+	if err != nil {
+		m.Close()
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// registerHost creates an import module per module name holding its host
+// functions and registers it with the executor
+func (m *WasmEdgeModule) registerHost(host []HostFunction) error {
+	modules := map[string]*wasmedge.Module{}
+	for _, fn := range host {
+		module, ok := modules[fn.Module]
+		if !ok {
+			module = wasmedge.NewModule(fn.Module)
+			modules[fn.Module] = module
+			m.hostModules = append(m.hostModules, module)
+			m.runtime.tracker.track(module)
+		}
+
+		params, err := wasmedgeTypes(fn.Signature.Params)
+		if err != nil {
+			return fmt.Errorf("%s.%s: %v", fn.Module, fn.Name, err)
+		}
+		results, err := wasmedgeTypes(fn.Signature.Results)
+		if err != nil {
+			return fmt.Errorf("%s.%s: %v", fn.Module, fn.Name, err)
+		}
+		ftype := wasmedge.NewFunctionType(params, results)
+		m.runtime.tracker.track(ftype)
+		module.AddFunction(fn.Name, wasmedge.NewFunction(ftype, m.hostCallback(fn), nil, 0))
+		m.runtime.tracker.release(ftype)
+	}
+
+	for _, module := range m.hostModules {
+		if err := m.executor.RegisterImport(m.store, module); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hostCallback adapts a host function to WasmEdge, recording its error so
+// Execute can report why the call trapped
+func (m *WasmEdgeModule) hostCallback(fn HostFunction) func(interface{}, *wasmedge.CallingFrame, []interface{}) ([]interface{}, wasmedge.Result) {
+	return func(_ interface{}, _ *wasmedge.CallingFrame, params []interface{}) ([]interface{}, wasmedge.Result) {
+		results, err := fn.Call(params)
+		if err != nil {
+			m.hostErr = fmt.Errorf("host function '%s' failed: %w", fn.Name, err)
+			return nil, wasmedge.Result_Fail
+		}
+		return results, wasmedge.Result_Success
+	}
+}
+
+// wasmedgeTypes converts signature type names to WasmEdge value types
+func wasmedgeTypes(names []string) ([]wasmedge.ValType, error) {
+	types := make([]wasmedge.ValType, len(names))
+	for i, name := range names {
+		valType, ok := wasmedgeValTypes[name]
+		if !ok {
+			return nil, fmt.Errorf("%s values are not supported", name)
+		}
+		types[i] = valType
+	}
+	return types, nil
+}
+
+// compileAOT compiles the module to a temporary shared object and loads
+// it. The compiled module is validated like any loaded one, as WasmEdge
+// only instantiates validated modules.
+func (m *WasmEdgeModule) compileAOT(filePath string) (*wasmedge.AST, error) {
+	compileErr := func(err error) error {
+		return &RuntimeError{Stage: StageInstantiate, Message: fmt.Sprintf("aot compilation failed: %v", err)}
+	}
+	out, err := os.CreateTemp("", "wasm-fuzzer-aot-*.so")
+	if err != nil {
+		return nil, compileErr(err)
+	}
+	out.Close()
+	m.aotPath = out.Name()
+
+	compiler := wasmedge.NewCompilerWithConfig(m.conf)
+	m.runtime.tracker.track(compiler)
+	defer m.runtime.tracker.release(compiler)
+	if err := compiler.Compile(filePath, m.aotPath); err != nil {
+		return nil, compileErr(err)
+	}
+
+	ast, err := m.loader.LoadFile(m.aotPath)
+	if err != nil {
+		return nil, compileErr(err)
+	}
+	m.aotAST = ast
+	m.runtime.tracker.track(ast)
+	if err := m.validator.Validate(ast); err != nil {
+		return nil, &RuntimeError{Stage: StageValidate, Message: fmt.Sprintf("validation failed: %v", err)}
+	}
+	return ast, nil
+}
+
+// Execute implements WasmModule.Execute
+func (m *WasmEdgeModule) Execute(funcName string, args ...interface{}) ([]interface{}, error) {
+	funcInstance := m.module.FindFunction(funcName)
+	if funcInstance == nil {
+		return nil, &RuntimeError{
+			Stage:   StageExecute,
+			Message: fmt.Sprintf("function '%s' not found in module exports", funcName),
+		}
+	}
+
+	m.hostErr = nil
+	returns, err := m.executor.Invoke(funcInstance, args...)
+	if err != nil {
+		if m.hostErr != nil {
+			err = m.hostErr
+		}
+		return nil, &RuntimeError{Stage: StageExecute, Message: fmt.Sprintf("execution failed: %v", err)}
+	}
+
+	return returns, nil
+}
+
+// Signature implements SignatureModule.Signature
+func (m *WasmEdgeModule) Signature(funcName string) (FuncSignature, bool) {
+	funcInstance := m.module.FindFunction(funcName)
+	if funcInstance == nil {
+		return FuncSignature{}, false
+	}
+
+	funcType := funcInstance.GetFunctionType()
+	signature := FuncSignature{Params: []string{}, Results: []string{}}
+	for _, valType := range funcType.GetParameters() {
+		signature.Params = append(signature.Params, valType.String())
+	}
+	for _, valType := range funcType.GetReturns() {
+		signature.Results = append(signature.Results, valType.String())
+	}
+	return signature, true
+}
+
+// Snapshot implements StatefulModule.Snapshot
+func (m *WasmEdgeModule) Snapshot() (*ModuleSnapshot, error) {
+	snapshot := &ModuleSnapshot{
+		Memories: make(map[string][]byte),
+		Globals:  make(map[string]interface{}),
+	}
+
+	for _, name := range m.module.ListMemory() {
+		memory := m.module.FindMemory(name)
+		size := memory.GetPageSize() * wasmPageSize
+		if size == 0 {
+			snapshot.Memories[name] = nil
+			continue
+		}
+		// GetData returns a view into linear memory, so it must be copied
+		data, err := memory.GetData(0, size)
+		if err != nil {
+			return nil, fmt.Errorf("memory '%s': %w", name, err)
+		}
+		snapshot.Memories[name] = append([]byte(nil), data...)
+	}
+
+	for _, name := range m.module.ListGlobal() {
+		global := m.module.FindGlobal(name)
+		if global.GetGlobalType().GetMutability() != wasmedge.ValMut_Var {
+			continue
+		}
+		snapshot.Globals[name] = global.GetValue()
+	}
+
+	return snapshot, nil
+}
+
+// Restore implements StatefulModule.Restore
+// Linear memory cannot shrink, so pages grown since the snapshot are zeroed
+func (m *WasmEdgeModule) Restore(snapshot *ModuleSnapshot) error {
+	for name, saved := range snapshot.Memories {
+		memory := m.module.FindMemory(name)
+		if memory == nil {
+			return fmt.Errorf("memory '%s' not found", name)
+		}
+		if len(saved) > 0 {
+			if err := memory.SetData(saved, 0, uint(len(saved))); err != nil {
+				return fmt.Errorf("memory '%s': %w", name, err)
+			}
+		}
+		size := memory.GetPageSize() * wasmPageSize
+		if grown := size - uint(len(saved)); grown > 0 {
+			if err := memory.SetData(make([]byte, grown), uint(len(saved)), grown); err != nil {
+				return fmt.Errorf("memory '%s': %w", name, err)
+			}
+		}
+	}
+
+	for name, value := range snapshot.Globals {
+		global := m.module.FindGlobal(name)
+		if global == nil {
+			return fmt.Errorf("global '%s' not found", name)
+		}
+		global.SetValue(value)
+	}
+
+	return nil
+}
+
+// TakeCoverage implements CoverageModule.TakeCoverage
+func (m *WasmEdgeModule) TakeCoverage() ([]byte, error) {
+	memory := m.module.FindMemory(coverageMemoryExport)
+	prev := m.module.FindGlobal(coveragePrevExport)
+	if memory == nil || prev == nil {
+		return nil, nil
+	}
+
+	// The edge map may be followed by a page of directed feedback
+	size := memory.GetPageSize() * wasmPageSize
+
+	// GetData returns a view into linear memory, so it must be copied
+	data, err := memory.GetData(0, size)
+	if err != nil {
+		return nil, err
+	}
+	trace := append([]byte(nil), data...)
+	if err := memory.SetData(make([]byte, size), 0, size); err != nil {
+		return nil, err
+	}
+	prev.SetValue(int32(0))
+	return trace, nil
+}
+
+// ReadMemory implements MemoryModule.ReadMemory
+func (m *WasmEdgeModule) ReadMemory(name string, offset, length uint32) ([]byte, error) {
+	memory, err := m.boundedMemory(name, offset, length)
+	if err != nil || length == 0 {
+		return []byte{}, err
+	}
+	// GetData returns a view into linear memory, so it must be copied
+	data, err := memory.GetData(uint(offset), uint(length))
+	if err != nil {
+		return nil, fmt.Errorf("memory '%s': %w", name, err)
+	}
+	return append([]byte(nil), data...), nil
+}
+
+// WriteMemory implements MemoryModule.WriteMemory
+func (m *WasmEdgeModule) WriteMemory(name string, offset uint32, data []byte) error {
+	memory, err := m.boundedMemory(name, offset, uint32(len(data)))
+	if err != nil || len(data) == 0 {
+		return err
+	}
+	if err := memory.SetData(data, uint(offset), uint(len(data))); err != nil {
+		return fmt.Errorf("memory '%s': %w", name, err)
+	}
+	return nil
+}
+
+// boundedMemory finds an exported memory and checks that a range lies
+// within its current size
+func (m *WasmEdgeModule) boundedMemory(name string, offset, length uint32) (*wasmedge.Memory, error) {
+	memory := m.module.FindMemory(name)
+	if memory == nil {
+		return nil, fmt.Errorf("memory '%s' not found", name)
+	}
+	size := uint64(memory.GetPageSize()) * wasmPageSize
+	if uint64(offset)+uint64(length) > size {
+		return nil, fmt.Errorf("memory '%s': range 0x%x+%d exceeds size %d", name, offset, length, size)
+	}
+	return memory, nil
+}
+
+// Close implements WasmModule.Close
+// Objects are released in reverse order of creation; nil objects were
+// never created because an earlier stage failed. The runtime context
+// goes back to the runtime for the next module.
+func (m *WasmEdgeModule) Close() {
+	tracker := m.runtime.tracker
+	if m.module != nil {
+		tracker.release(m.module)
+	}
+	for _, module := range m.hostModules {
+		tracker.release(module)
+	}
+	if m.store != nil {
+		tracker.release(m.store)
+	}
+	if m.aotAST != nil {
+		tracker.release(m.aotAST)
+	}
+	if m.aotPath != "" {
+		os.Remove(m.aotPath)
+	}
+	if m.ast != nil {
+		tracker.release(m.ast)
+	}
+	if m.runtimeContext != nil {
+		m.runtime.recycle(m.runtimeContext)
+		m.runtimeContext = nil
+	}
+}
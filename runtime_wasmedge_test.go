@@ -0,0 +1,131 @@
+//go:build integration
+// +build integration
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mrhapile/WASM-Injection-Framework/pkg/rewrite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// emptyModule is the smallest valid module: the magic number and version
+var emptyModule = []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+
+// -----------------------------------------------------------------------------
+// TEST: Runtime Context Reuse
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Large campaigns load millions of small modules, where creating the
+// configuration, loader, validator and executor for each one dominates.
+// Compare the two benchmarks to measure what reusing them saves:
+//
+//	go test -tags=integration -run '^$' -bench WasmEdge_
+// -----------------------------------------------------------------------------
+
+func benchmarkLoad(b *testing.B, runtime *WasmEdgeRuntime) {
+	path := filepath.Join(b.TempDir(), "empty.wasm")
+	if err := os.WriteFile(path, emptyModule, 0o644); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		module, err := runtime.LoadModule(path)
+		if err != nil {
+			b.Fatal(err)
+		}
+		module.Close()
+	}
+}
+
+func BenchmarkWasmEdge_PooledContexts(b *testing.B) {
+	runtime := NewWasmEdgeRuntime()
+	defer runtime.Close()
+	benchmarkLoad(b, runtime)
+}
+
+func BenchmarkWasmEdge_FreshContexts(b *testing.B) {
+	// A closed runtime releases every context when its module closes
+	runtime := NewWasmEdgeRuntime()
+	runtime.Close()
+	benchmarkLoad(b, runtime)
+}
+
+func TestWasmEdge_ReusesContexts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "empty.wasm")
+	require.NoError(t, os.WriteFile(path, emptyModule, 0o644))
+	runtime := NewWasmEdgeRuntime()
+	defer runtime.Close()
+
+	first, err := runtime.LoadModule(path)
+	require.NoError(t, err)
+	second, err := runtime.LoadModule(path)
+	require.NoError(t, err)
+	ctx := first.(*WasmEdgeModule).runtimeContext
+	assert.NotSame(t, ctx, second.(*WasmEdgeModule).runtimeContext, "open modules never share a context")
+
+	first.Close()
+	first.Close()
+	assert.Len(t, runtime.idle, 1, "closing twice recycles the context once")
+
+	third, err := runtime.LoadModule(path)
+	require.NoError(t, err)
+	defer third.Close()
+	second.Close()
+	assert.Same(t, ctx, third.(*WasmEdgeModule).runtimeContext, "a closed module's context is reused")
+}
+
+// answerModule exports f, returning the i32 42
+var answerModule = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00,
+	0x01, 0x05, 0x01, 0x60, 0x00, 0x01, 0x7f,
+	0x03, 0x02, 0x01, 0x00,
+	0x07, 0x05, 0x01, 0x01, 0x66, 0x00, 0x00,
+	0x0a, 0x06, 0x01, 0x04, 0x00, 0x41, 0x2a, 0x0b,
+}
+
+func TestWasmEdge_RunsValidatedAOTModules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "answer.wasm")
+	require.NoError(t, os.WriteFile(path, answerModule, 0o644))
+	runtime, err := newRuntime(Environment{Backend: BackendAOT})
+	require.NoError(t, err)
+	defer runtime.(*WasmEdgeRuntime).Close()
+
+	module, err := runtime.LoadModule(path)
+	require.NoError(t, err, "the compiled module is validated before it is instantiated")
+	defer module.Close()
+	assert.NotNil(t, module.(*WasmEdgeModule).aotAST)
+	returns, err := module.Execute("f")
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{int32(42)}, returns)
+}
+
+func TestWasmEdge_LinksInterceptHook(t *testing.T) {
+	module, err := rewrite.Parse(answerModule)
+	require.NoError(t, err)
+	i32 := []rewrite.ValType{rewrite.I32}
+	double := module.AddFunction(rewrite.FuncType{Params: i32, Results: i32}, nil, []rewrite.Instruction{
+		rewrite.LocalGet(0), rewrite.LocalGet(0), rewrite.Simple(0x6a), rewrite.Simple(rewrite.OpEnd),
+	})
+	require.NoError(t, module.ReplaceFunction(0, nil, []rewrite.Instruction{rewrite.I32Const(21), rewrite.Call(double.Index)}))
+	path := filepath.Join(t.TempDir(), "double.wasm")
+	require.NoError(t, os.WriteFile(path, module.Encode(), 0o644))
+	wasmedge := NewWasmEdgeRuntime()
+	defer wasmedge.Close()
+
+	runtime := newInterceptRuntime(wasmedge, InterceptConfig{Functions: []string{"1"}, TrapOn: 2})
+	loaded, err := runtime.LoadModule(path)
+	require.NoError(t, err, "the hook is linked to the trampolines' import")
+	defer loaded.Close()
+	returns, err := loaded.Execute("f")
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{int32(42)}, returns, "the trampoline forwards the call")
+	_, err = loaded.Execute("f")
+	assert.Error(t, err, "the second call traps")
+	assert.Equal(t, map[string]int{"1": 2}, runtime.tracker.report.Calls)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// SubStageSanitizer refines the stage in which a sanitizer built into the
+// runtime reported an error, taking its worker down
+const SubStageSanitizer = "sanitizer"
+
+// sanitizerStderrLimit caps the worker stderr kept per file. Symbolized
+// sanitizer reports run to a few KiB.
+const sanitizerStderrLimit = 64 << 10
+
+// Default options of sanitized workers: every report stops the worker, so
+// it is fully written before the worker is reaped, and leaks of the
+// long-running worker are not reported
+const (
+	defaultASanOptions  = "abort_on_error=1:detect_leaks=0:symbolize=1"
+	defaultUBSanOptions = "halt_on_error=1:print_stacktrace=1"
+)
+
+// SanitizerConfig runs isolated workers against a WasmEdge library built
+// with sanitizers, such as ASan or UBSan. Setting Library isolates the
+// campaign, as only a worker's stderr carries the reports.
+type SanitizerConfig struct {
+	// Library is the directory holding the sanitized libwasmedge
+	Library string `yaml:"library"`
+	// Preload lists sanitizer runtimes to load first, such as libasan.so,
+	// needed when the fuzzer itself was not built with them
+	Preload []string `yaml:"preload"`
+	// ASanOptions and UBSanOptions replace the default ASAN_OPTIONS and
+	// UBSAN_OPTIONS
+	ASanOptions  string `yaml:"asan_options"`
+	UBSanOptions string `yaml:"ubsan_options"`
+}
+
+// enabled reports whether workers run against a sanitized library
+func (c SanitizerConfig) enabled() bool {
+	return c.Library != ""
+}
+
+// environ returns the environment of sanitized workers, or nil to inherit
+// the fuzzer's
+func (c SanitizerConfig) environ() []string {
+	if !c.enabled() {
+		return nil
+	}
+	asan, ubsan := c.ASanOptions, c.UBSanOptions
+	if asan == "" {
+		asan = defaultASanOptions
+	}
+	if ubsan == "" {
+		ubsan = defaultUBSanOptions
+	}
+	env := append(os.Environ(), libraryPathEnv(c.Library), "ASAN_OPTIONS="+asan, "UBSAN_OPTIONS="+ubsan)
+	if len(c.Preload) > 0 {
+		env = append(env, "LD_PRELOAD="+strings.Join(c.Preload, " "))
+	}
+	return env
+}
+
+// libraryPathEnv returns the LD_LIBRARY_PATH setting that makes a child
+// load libwasmedge from dir ahead of where the fuzzer's came from
+func libraryPathEnv(dir string) string {
+	libraryPath := dir
+	if existing := os.Getenv("LD_LIBRARY_PATH"); existing != "" {
+		libraryPath += string(filepath.ListSeparator) + existing
+	}
+	return "LD_LIBRARY_PATH=" + libraryPath
+}
+
+// workerStderr passes a worker's stderr through and keeps what it wrote
+// since the last take, where sanitizers write their reports. A nil
+// workerStderr keeps nothing.
+type workerStderr struct {
+	mu      sync.Mutex
+	out     io.Writer
+	data    []byte
+	dropped int
+}
+
+func (s *workerStderr) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.out != nil {
+		s.out.Write(p)
+	}
+	n := min(len(p), sanitizerStderrLimit-len(s.data))
+	s.data = append(s.data, p[:n]...)
+	s.dropped += len(p) - n
+	return len(p), nil
+}
+
+// take returns what was written since the last call
+func (s *workerStderr) take() string {
+	if s == nil {
+		return ""
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	text := string(s.data)
+	if s.dropped > 0 {
+		text += fmt.Sprintf("[... %d bytes truncated]", s.dropped)
+	}
+	s.data, s.dropped = nil, 0
+	return text
+}
+
+// sanitizerReportStart matches the first line of a sanitizer report:
+// "==123==ERROR: AddressSanitizer: ..." and its kin, or UBSan's
+// "file.c:1:2: runtime error: ..."
+var sanitizerReportStart = regexp.MustCompile(`(?m)^.*(?:==\d+==(?:ERROR|WARNING): (\w+Sanitizer): |(runtime error): )(.*)$`)
+
+// sanitizerReportEnd matches the last line of a report that stops the
+// process
+var sanitizerReportEnd = regexp.MustCompile(`(?m)^==\d+==ABORTING$`)
+
+// parseSanitizerReport finds the first sanitizer report in a worker's
+// stderr. It returns the report verbatim and a one-line summary, or empty
+// strings when there is none.
+func parseSanitizerReport(stderr string) (report, summary string) {
+	match := sanitizerReportStart.FindStringSubmatchIndex(stderr)
+	if match == nil {
+		return "", ""
+	}
+	report = stderr[match[0]:]
+	if end := sanitizerReportEnd.FindStringIndex(report); end != nil {
+		report = report[:end[1]]
+	}
+	report = strings.TrimRight(report, "\n")
+
+	sanitizer := "UndefinedBehaviorSanitizer"
+	if match[2] >= 0 {
+		sanitizer = stderr[match[2]:match[3]]
+	}
+	return report, sanitizer + ": " + stderr[match[6]:match[7]]
+}
@@ -0,0 +1,125 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// asanReport is a worker's stderr as a runtime built with ASan leaves it
+const asanReport = `loading module
+=================================================================
+==4242==ERROR: AddressSanitizer: heap-buffer-overflow on address 0x602000000018 at pc 0x7f00 bp 0x7ffc sp 0x7ff0
+READ of size 4 at 0x602000000018 thread T0
+    #0 0x7f00 in WasmEdge::Executor::runLoadOp lib/executor/engine/memory.cpp:88
+    #1 0x7f01 in WasmEdge_VMExecute lib/api/wasmedge.cpp:2010
+SUMMARY: AddressSanitizer: heap-buffer-overflow lib/executor/engine/memory.cpp:88 in runLoadOp
+==4242==ABORTING
+`
+
+// -----------------------------------------------------------------------------
+// TEST: Sanitizer Reports
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// A runtime built with sanitizers reports the bug at the bad access,
+// where a plain build corrupts memory silently or crashes much later. The
+// report reaches nothing but the worker's stderr, so the parent has to
+// find it there and keep it whole; the stack is what makes it actionable.
+// -----------------------------------------------------------------------------
+
+func TestParseSanitizerReport_ASan(t *testing.T) {
+	report, summary := parseSanitizerReport(asanReport + "noise after the worker died\n")
+
+	assert.Equal(t, "AddressSanitizer: heap-buffer-overflow on address 0x602000000018 at pc 0x7f00 bp 0x7ffc sp 0x7ff0", summary)
+	assert.True(t, strings.HasPrefix(report, "==4242==ERROR: AddressSanitizer"), report)
+	assert.True(t, strings.HasSuffix(report, "==4242==ABORTING"), "the report ends where the sanitizer stopped the worker")
+	assert.Contains(t, report, "#0 0x7f00 in WasmEdge::Executor::runLoadOp")
+}
+
+func TestParseSanitizerReport_UBSan(t *testing.T) {
+	stderr := "lib/executor/helper.cpp:31:12: runtime error: shift exponent 40 is too large for 32-bit type 'uint32_t'\n" +
+		"    #0 0x7f00 in WasmEdge::Executor::runShlOp\n"
+	report, summary := parseSanitizerReport(stderr)
+
+	assert.Equal(t, "UndefinedBehaviorSanitizer: shift exponent 40 is too large for 32-bit type 'uint32_t'", summary)
+	assert.Equal(t, strings.TrimSuffix(stderr, "\n"), report)
+}
+
+func TestParseSanitizerReport_NoReport(t *testing.T) {
+	report, summary := parseSanitizerReport("[error] execution failed: unreachable\n")
+	assert.Empty(t, report)
+	assert.Empty(t, summary)
+}
+
+func TestWorkerStderr_KeepsOnlyTheLimit(t *testing.T) {
+	var passed strings.Builder
+	stderr := &workerStderr{out: &passed}
+	stderr.Write([]byte(strings.Repeat("a", sanitizerStderrLimit)))
+	stderr.Write([]byte("bcd"))
+
+	assert.Equal(t, sanitizerStderrLimit+3, passed.Len(), "stderr is passed through whole")
+	assert.True(t, strings.HasSuffix(stderr.take(), "a[... 3 bytes truncated]"))
+	assert.Empty(t, stderr.take(), "take starts over")
+	assert.Empty(t, (*workerStderr)(nil).take())
+}
+
+func TestIsolate_AttachesSanitizerReport(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "overflow.wasm"), []byte{0}, 0o644))
+	runtime := &MockWasmRuntime{}
+	fakeWorkers(t, runtime)
+	startFake := startWorker
+	var workerEnv []string
+	startWorker = func(args, env []string) (*workerProcess, error) {
+		workerEnv = env
+		process, err := startFake(args, env)
+		// The sanitizer reports and aborts the worker as soon as it runs
+		// anything
+		process.stderr = &workerStderr{}
+		kill := process.kill
+		process.requests = writerFunc(func(p []byte) (int, error) {
+			process.stderr.Write([]byte(asanReport))
+			kill()
+			return len(p), nil
+		})
+		return process, err
+	}
+
+	opts := RunOptions{WorkerArgs: []string{dir}, Sanitizer: SanitizerConfig{Library: "/opt/wasmedge-asan/lib"}}
+	report, err := runFuzzerWithMatrix(dir, []environmentRuntime{{Runtime: runtime}}, opts)
+	require.NoError(t, err)
+
+	require.Len(t, report.Results, 1)
+	result := report.Results[0]
+	assert.Equal(t, StageLoad, result.FailureStage)
+	assert.Equal(t, SubStageSanitizer, result.FailureSubStage)
+	assert.True(t, strings.HasPrefix(result.ErrorMessage, "AddressSanitizer: heap-buffer-overflow"), result.ErrorMessage)
+	assert.Contains(t, result.SanitizerReport, "SUMMARY: AddressSanitizer")
+	require.NotNil(t, result.Classification)
+	assert.Equal(t, SeveritySecurity, result.Classification.Severity)
+
+	assert.Contains(t, workerEnv, "ASAN_OPTIONS="+defaultASanOptions)
+	assert.Contains(t, workerEnv, "UBSAN_OPTIONS="+defaultUBSanOptions)
+}
+
+func TestSanitizerConfig_Environ(t *testing.T) {
+	t.Setenv("LD_LIBRARY_PATH", "/usr/local/lib")
+	assert.Nil(t, SanitizerConfig{}.environ(), "workers inherit the fuzzer's environment")
+
+	env := SanitizerConfig{
+		Library:     "/opt/wasmedge-asan/lib",
+		Preload:     []string{"libasan.so.8", "libubsan.so.1"},
+		ASanOptions: "abort_on_error=1",
+	}.environ()
+	assert.Contains(t, env, "LD_LIBRARY_PATH=/opt/wasmedge-asan/lib:/usr/local/lib")
+	assert.Contains(t, env, "LD_PRELOAD=libasan.so.8 libubsan.so.1")
+	assert.Contains(t, env, "ASAN_OPTIONS=abort_on_error=1")
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/mrhapile/WASM-Injection-Framework/internal/wasmbin"
+)
+
+// SBOM inventories what the modules of a corpus were built with and what
+// they need from their host, for security teams tracking their
+// dependencies. It is read from the binaries, without running them.
+type SBOM struct {
+	TotalFiles int          `json:"total_files"`
+	Modules    []SBOMModule `json:"modules"`
+	// Toolchains, Languages and SDKs count the modules built with each
+	// component, and HostAPIs the modules importing from each namespace,
+	// most widely used first
+	Toolchains []SBOMComponent `json:"toolchains"`
+	Languages  []SBOMComponent `json:"languages"`
+	SDKs       []SBOMComponent `json:"sdks"`
+	HostAPIs   []SBOMHostAPI   `json:"host_apis"`
+}
+
+// SBOMComponent is a tool, language or SDK named in producers sections
+type SBOMComponent struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+	// Modules counts the modules built with it, in the corpus totals
+	Modules int `json:"modules,omitempty"`
+}
+
+// SBOMModule is the inventory of one file
+type SBOMModule struct {
+	FilePath  string `json:"file_path"`
+	SHA256    string `json:"sha256"`
+	SizeBytes int64  `json:"size_bytes"`
+	// Error is set for files that cannot be read or are not module
+	// binaries, which have nothing else to inventory
+	Error string `json:"error,omitempty"`
+	// Toolchain, Languages and SDKs come from the producers section, and
+	// are empty for modules without one
+	Toolchain []SBOMComponent `json:"toolchain,omitempty"`
+	Languages []SBOMComponent `json:"languages,omitempty"`
+	SDKs      []SBOMComponent `json:"sdks,omitempty"`
+	// Imports is everything the module needs its host to provide
+	Imports []SBOMImport `json:"imports,omitempty"`
+	// CustomSections names the custom sections, such as debug info, in
+	// the order they appear
+	CustomSections []string `json:"custom_sections,omitempty"`
+}
+
+// SBOMImport is one import of a module
+type SBOMImport struct {
+	Module string `json:"module"`
+	Name   string `json:"name"`
+	// Kind is func, table, memory, global or tag
+	Kind string `json:"kind"`
+}
+
+// SBOMHostAPI is an import namespace, such as wasi_snapshot_preview1, and
+// what the corpus imports from it
+type SBOMHostAPI struct {
+	Namespace string   `json:"namespace"`
+	Functions []string `json:"functions,omitempty"`
+	Modules   int      `json:"modules"`
+}
+
+// externKindNames names the external kinds of imports
+var externKindNames = map[byte]string{
+	externFunc:   "func",
+	externTable:  "table",
+	externMemory: "memory",
+	externGlobal: "global",
+	externTag:    "tag",
+}
+
+// imports returns every import of the module, of any kind
+func (m *wasmBinary) imports() ([]SBOMImport, error) {
+	section := m.section(sectionImport)
+	if section == nil {
+		return nil, nil
+	}
+	r := &wasmbin.Reader{Data: section.Payload}
+	n, err := r.U32()
+	if err != nil {
+		return nil, err
+	}
+	var imports []SBOMImport
+	for i := uint32(0); i < n; i++ {
+		module, err := r.Name()
+		if err != nil {
+			return nil, err
+		}
+		name, err := r.Name()
+		if err != nil {
+			return nil, err
+		}
+		kind, err := r.Byte()
+		if err != nil {
+			return nil, err
+		}
+		if err := r.SkipImportDesc(kind); err != nil {
+			return nil, fmt.Errorf("import %d: %w", i, err)
+		}
+		imports = append(imports, SBOMImport{Module: module, Name: name, Kind: externKindNames[kind]})
+	}
+	return imports, nil
+}
+
+// customSectionNames returns the names of the module's custom sections
+func (m *wasmBinary) customSectionNames() []string {
+	var names []string
+	for _, section := range m.Sections {
+		if section.ID != sectionCustom {
+			continue
+		}
+		r := &wasmbin.Reader{Data: section.Payload}
+		if name, err := r.Name(); err == nil {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// inventoryModule reads the inventory of one file
+func inventoryModule(filePath string) SBOMModule {
+	module := SBOMModule{FilePath: filePath}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		module.Error = err.Error()
+		return module
+	}
+	sum := sha256.Sum256(data)
+	module.SHA256 = hex.EncodeToString(sum[:])
+	module.SizeBytes = int64(len(data))
+
+	binary, err := parseWasmBinary(data)
+	if err != nil {
+		module.Error = err.Error()
+		return module
+	}
+	for _, entry := range binary.producerEntries() {
+		component := SBOMComponent{Name: entry.Name, Version: entry.Version}
+		switch entry.Field {
+		case "processed-by":
+			module.Toolchain = append(module.Toolchain, component)
+		case "language":
+			module.Languages = append(module.Languages, component)
+		case "sdk":
+			module.SDKs = append(module.SDKs, component)
+		}
+	}
+	if module.Imports, err = binary.imports(); err != nil {
+		module.Error = "invalid import section: " + err.Error()
+	}
+	module.CustomSections = binary.customSectionNames()
+	return module
+}
+
+// collectSBOM inventories every file and totals the corpus's dependencies
+func collectSBOM(files []string) SBOM {
+	sbom := SBOM{
+		TotalFiles: len(files),
+		Modules:    make([]SBOMModule, 0, len(files)),
+	}
+	toolchains := make(map[SBOMComponent]int)
+	languages := make(map[SBOMComponent]int)
+	sdks := make(map[SBOMComponent]int)
+	apis := make(map[string]map[string]bool)
+	apiModules := make(map[string]int)
+
+	for _, filePath := range files {
+		module := inventoryModule(filePath)
+		sbom.Modules = append(sbom.Modules, module)
+		countComponents(toolchains, module.Toolchain)
+		countComponents(languages, module.Languages)
+		countComponents(sdks, module.SDKs)
+
+		seen := make(map[string]bool)
+		for _, imp := range module.Imports {
+			if apis[imp.Module] == nil {
+				apis[imp.Module] = make(map[string]bool)
+			}
+			if imp.Kind == "func" {
+				apis[imp.Module][imp.Name] = true
+			}
+			if !seen[imp.Module] {
+				seen[imp.Module] = true
+				apiModules[imp.Module]++
+			}
+		}
+	}
+
+	sbom.Toolchains = sortedComponents(toolchains)
+	sbom.Languages = sortedComponents(languages)
+	sbom.SDKs = sortedComponents(sdks)
+	sbom.HostAPIs = make([]SBOMHostAPI, 0, len(apis))
+	for namespace, functions := range apis {
+		api := SBOMHostAPI{Namespace: namespace, Modules: apiModules[namespace]}
+		for name := range functions {
+			api.Functions = append(api.Functions, name)
+		}
+		sort.Strings(api.Functions)
+		sbom.HostAPIs = append(sbom.HostAPIs, api)
+	}
+	sort.Slice(sbom.HostAPIs, func(i, j int) bool {
+		a, b := sbom.HostAPIs[i], sbom.HostAPIs[j]
+		if a.Modules != b.Modules {
+			return a.Modules > b.Modules
+		}
+		return a.Namespace < b.Namespace
+	})
+	return sbom
+}
+
+// countComponents counts a module's components once each
+func countComponents(counts map[SBOMComponent]int, components []SBOMComponent) {
+	seen := make(map[SBOMComponent]bool)
+	for _, component := range components {
+		if !seen[component] {
+			seen[component] = true
+			counts[component]++
+		}
+	}
+}
+
+// sortedComponents lists counted components, most widely used first
+func sortedComponents(counts map[SBOMComponent]int) []SBOMComponent {
+	components := make([]SBOMComponent, 0, len(counts))
+	for component, n := range counts {
+		component.Modules = n
+		components = append(components, component)
+	}
+	sort.Slice(components, func(i, j int) bool {
+		a, b := components[i], components[j]
+		if a.Modules != b.Modules {
+			return a.Modules > b.Modules
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Version < b.Version
+	})
+	return components
+}
+
+// runSBOMCommand prints the dependency inventory of a corpus
+func runSBOMCommand(args []string) int {
+	flags := flag.NewFlagSet("sbom", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		emitError(map[string]string{
+			"error": "usage: wasm-fuzzer sbom <directory>",
+		})
+		return 1
+	}
+
+	files, err := collectWasmFiles(flags.Arg(0))
+	if err != nil {
+		emitError(map[string]string{
+			"error":   "directory access failed",
+			"details": err.Error(),
+		})
+		return 1
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(collectSBOM(files)); err != nil {
+		emitError(map[string]string{
+			"error":   "failed to encode JSON output",
+			"details": err.Error(),
+		})
+		return 1
+	}
+	return 0
+}
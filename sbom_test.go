@@ -0,0 +1,85 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mrhapile/WASM-Injection-Framework/internal/wasmbin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// -----------------------------------------------------------------------------
+// TEST: Dependency Inventory
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// When a toolchain or a host API turns out to be vulnerable, security
+// teams must find every module built with it or importing it. The
+// inventory has to name both, per module and for the whole corpus, and
+// still list files it cannot decode.
+// -----------------------------------------------------------------------------
+
+func TestSBOM_InventoriesCorpus(t *testing.T) {
+	dir := t.TempDir()
+	log := wasmFuncImport{Module: "env", Name: "log", Signature: funcSig("i32", "")}
+	exit := wasmFuncImport{Module: wasiModule, Name: "proc_exit", Signature: funcSig("i32", "")}
+	write := wasmFuncImport{Module: wasiModule, Name: "fd_write", Signature: funcSig("i32 i32 i32 i32", "i32")}
+	files := map[string][]byte{
+		"a.wasm":    withProducers(t, pluginBinary(log, exit), "Rust", "rustc", "1.75.0"),
+		"b.wasm":    withProducers(t, pluginBinary(write), "Rust", "rustc", "1.75.0"),
+		"c.wasm":    pluginBinary(log),
+		"junk.wasm": []byte("junk"),
+	}
+	for name, data := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0o644))
+	}
+	paths, err := collectWasmFiles(dir)
+	require.NoError(t, err)
+
+	sbom := collectSBOM(paths)
+	assert.Equal(t, 4, sbom.TotalFiles)
+	require.Len(t, sbom.Modules, 4)
+
+	a := sbom.Modules[0]
+	assert.Equal(t, []SBOMComponent{{Name: "rustc", Version: "1.75.0"}}, a.Toolchain)
+	assert.Equal(t, []SBOMComponent{{Name: "Rust"}}, a.Languages)
+	assert.Equal(t, []SBOMImport{
+		{Module: "env", Name: "log", Kind: "func"},
+		{Module: wasiModule, Name: "proc_exit", Kind: "func"},
+	}, a.Imports)
+	assert.Equal(t, []string{"producers"}, a.CustomSections)
+	assert.Equal(t, fileHash(a.FilePath), a.SHA256)
+
+	assert.Empty(t, sbom.Modules[2].Toolchain, "c.wasm has no producers section")
+	junk := sbom.Modules[3]
+	assert.NotEmpty(t, junk.Error)
+	assert.Equal(t, int64(4), junk.SizeBytes)
+
+	assert.Equal(t, []SBOMComponent{{Name: "rustc", Version: "1.75.0", Modules: 2}}, sbom.Toolchains)
+	assert.Equal(t, []SBOMComponent{{Name: "Rust", Modules: 2}}, sbom.Languages)
+	assert.Empty(t, sbom.SDKs)
+	assert.Equal(t, []SBOMHostAPI{
+		{Namespace: "env", Functions: []string{"log"}, Modules: 2},
+		{Namespace: wasiModule, Functions: []string{"fd_write", "proc_exit"}, Modules: 2},
+	}, sbom.HostAPIs)
+}
+
+func TestSBOM_ReadsEveryImportKind(t *testing.T) {
+	module, err := parseWasmBinary(pluginBinary())
+	require.NoError(t, err)
+	// A memory import with a minimum of one page
+	module.section(sectionImport).Payload = append(wasmbin.AppendName(wasmbin.AppendName([]byte{0x01}, "env"), "memory"), externMemory, 0x00, 0x01)
+	imports, err := module.imports()
+	require.NoError(t, err)
+	assert.Equal(t, []SBOMImport{{Module: "env", Name: "memory", Kind: "memory"}}, imports)
+}
+
+func TestSBOM_RejectsBadArguments(t *testing.T) {
+	assert.Equal(t, 1, runSBOMCommand(nil))
+	assert.Equal(t, 1, runSBOMCommand([]string{filepath.Join(t.TempDir(), "missing")}))
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// scaffoldExport is an exported function a scaffolded test calls
+type scaffoldExport struct {
+	name      string
+	signature FuncSignature
+}
+
+// scaffoldExports returns the module's exported functions sorted by name,
+// with their types
+func scaffoldExports(data []byte) ([]scaffoldExport, error) {
+	binary, err := parseWasmBinary(data)
+	if err != nil {
+		return nil, err
+	}
+	exports, err := binary.functionExports()
+	if err != nil {
+		return nil, err
+	}
+	signatures, err := binary.functionSignatures()
+	if err != nil {
+		return nil, err
+	}
+
+	var scaffolded []scaffoldExport
+	for name, index := range exports {
+		if int(index) >= len(signatures) {
+			return nil, fmt.Errorf("export %q: function %d out of range", name, index)
+		}
+		scaffolded = append(scaffolded, scaffoldExport{name: name, signature: signatures[index]})
+	}
+	sort.Slice(scaffolded, func(i, j int) bool { return scaffolded[i].name < scaffolded[j].name })
+	return scaffolded, nil
+}
+
+// scaffoldTestName turns an export name into a unique test function name,
+// such as "TestHandleRequest" for "handle_request"
+func scaffoldTestName(export string, taken map[string]bool) string {
+	var name strings.Builder
+	name.WriteString("Test")
+	upper := true
+	for _, r := range export {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) || r > unicode.MaxASCII {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		name.WriteRune(r)
+	}
+
+	base := name.String()
+	if base == "Test" {
+		base = "TestExport"
+	}
+	unique := base
+	for i := 2; taken[unique]; i++ {
+		unique = fmt.Sprintf("%s%d", base, i)
+	}
+	taken[unique] = true
+	return unique
+}
+
+// scaffoldPreamble is the part of a scaffolded test file shared by all of
+// its tests. The framework is a command, so the tests drive it through
+// "wasm-fuzzer run", with the entry and inputs set by its environment
+// variables.
+const scaffoldPreamble = `import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// wasmModule is the module under test, relative to this package
+const wasmModule = %q
+
+// wasmResult holds the fields of a wasm-fuzzer result the tests check
+type wasmResult struct {
+	Success      bool   ` + "`json:\"success\"`" + `
+	FailureStage string ` + "`json:\"failure_stage\"`" + `
+	ErrorCode    string ` + "`json:\"error_code\"`" + `
+	ErrorMessage string ` + "`json:\"error_message\"`" + `
+}
+
+// runWasmExport calls an export of the module with inputs, written as
+// wasm-fuzzer's invocation.inputs. The test is skipped when wasm-fuzzer,
+// or the command named by $WASM_FUZZER, is not installed.
+func runWasmExport(t *testing.T, entry, inputs string) wasmResult {
+	t.Helper()
+	fuzzer := os.Getenv("WASM_FUZZER")
+	if fuzzer == "" {
+		fuzzer = "wasm-fuzzer"
+	}
+	if _, err := exec.LookPath(fuzzer); err != nil {
+		t.Skipf("%%s not found: %%v", fuzzer, err)
+	}
+
+	cmd := exec.Command(fuzzer, "run", wasmModule)
+	cmd.Env = append(os.Environ(),
+		"WASM_FUZZER_INVOCATION__ENTRY="+entry,
+		"WASM_FUZZER_INVOCATION__INPUTS="+inputs,
+	)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	// wasm-fuzzer exits non-zero when the module fails, which the result
+	// describes
+	out, _ := cmd.Output()
+
+	var result wasmResult
+	if err := json.Unmarshal(out, &result); err != nil {
+		t.Fatalf("wasm-fuzzer run %%s: %%v\n%%s", entry, err, stderr.String())
+	}
+	return result
+}
+`
+
+// writeScaffold writes a Go test file calling each export of a module with
+// the zero value of its parameters. Exports taking v128 or reference
+// values are listed but not called, as no zero input is written for them.
+func writeScaffold(w io.Writer, pkg, source, modulePath string, exports []scaffoldExport) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by wasm-fuzzer scaffold from %s. Edit the inputs and\n", filepath.Base(source))
+	fmt.Fprintf(&buf, "// expectations of each test to match the module.\n\n")
+	fmt.Fprintf(&buf, "package %s\n\n", pkg)
+	fmt.Fprintf(&buf, scaffoldPreamble, modulePath)
+
+	// TestMain would be run in place of the package's tests
+	taken := map[string]bool{"TestMain": true}
+	for _, export := range exports {
+		fmt.Fprintln(&buf)
+		zeros, err := zeroResults(FuncSignature{Results: export.signature.Params})
+		if err != nil {
+			fmt.Fprintf(&buf, "// %s %s is not called: no zero input for its parameters\n", export.name, export.signature)
+			continue
+		}
+		// An export without parameters is still called with one input
+		input := append(InvocationInput{}, encodeValues(zeros)...)
+		inputs, err := json.Marshal([]InvocationInput{input})
+		if err != nil {
+			return err
+		}
+
+		name := scaffoldTestName(export.name, taken)
+		fmt.Fprintf(&buf, "// %s calls %s %s with zero arguments\n", name, export.name, export.signature)
+		fmt.Fprintf(&buf, "func %s(t *testing.T) {\n", name)
+		fmt.Fprintf(&buf, "\tresult := runWasmExport(t, %q, `%s`)\n", export.name, inputs)
+		fmt.Fprintf(&buf, "\tif !result.Success {\n")
+		failed := strings.ReplaceAll(export.name, "%", "%%") + " failed in %s (%s): %s"
+		fmt.Fprintf(&buf, "\t\tt.Errorf(%q, result.FailureStage, result.ErrorCode, result.ErrorMessage)\n", failed)
+		fmt.Fprintf(&buf, "\t}\n}\n")
+	}
+
+	formatted, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("generated invalid Go: %w", err)
+	}
+	_, err = w.Write(formatted)
+	return err
+}
+
+// runScaffoldCommand generates a Go test file exercising a module's exports
+// through wasm-fuzzer, for module authors to adopt in their own CI
+func runScaffoldCommand(args []string) int {
+	flags := flag.NewFlagSet("scaffold", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	outputPath := flags.String("output", "", "file to write the test to (default stdout)")
+	pkg := flags.String("package", "main", "package of the generated test")
+
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		emitError(map[string]string{
+			"error": "usage: wasm-fuzzer scaffold [--output file_test.go] [--package name] <file.wasm>",
+		})
+		return 1
+	}
+	filePath := flags.Arg(0)
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		emitError(map[string]string{
+			"error":   "module access failed",
+			"details": err.Error(),
+		})
+		return 1
+	}
+	exports, err := scaffoldExports(data)
+	if err != nil {
+		emitError(map[string]string{
+			"error":   "module decode failed",
+			"details": err.Error(),
+		})
+		return 1
+	}
+
+	// Tests run in their package's directory, so the module's path is made
+	// relative to the test file
+	modulePath := filePath
+	if *outputPath != "" {
+		if rel, err := relativeTo(filepath.Dir(*outputPath), filePath); err == nil {
+			modulePath = rel
+		}
+	}
+
+	var out bytes.Buffer
+	if err := writeScaffold(&out, *pkg, filePath, filepath.ToSlash(modulePath), exports); err != nil {
+		emitError(map[string]string{
+			"error":   "failed to write test",
+			"details": err.Error(),
+		})
+		return 1
+	}
+	if *outputPath == "" {
+		_, err = os.Stdout.Write(out.Bytes())
+	} else {
+		err = os.WriteFile(*outputPath, out.Bytes(), 0o644)
+	}
+	if err != nil {
+		emitError(map[string]string{
+			"error":   "failed to write test",
+			"details": err.Error(),
+		})
+		return 1
+	}
+	return 0
+}
+
+// relativeTo returns path relative to dir
+func relativeTo(dir, path string) (string, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Rel(absDir, absPath)
+}
@@ -0,0 +1,106 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scaffoldInputs matches the inputs a scaffolded test passes
+var scaffoldInputs = regexp.MustCompile("runWasmExport\\(t, \"([^\"]+)\", `([^`]*)`\\)")
+
+// -----------------------------------------------------------------------------
+// TEST: Test Scaffolding
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// A scaffolded test is the first thing a module author runs in their own
+// CI. It must compile as generated, call every export it can under its
+// real signature, and pass inputs wasm-fuzzer reads back as written.
+// -----------------------------------------------------------------------------
+
+func TestScaffold_FindsExportSignatures(t *testing.T) {
+	binary := pluginBinary(wasmFuncImport{Module: "env", Name: "log", Signature: funcSig("i64 f32", "")})
+	exports, err := scaffoldExports(binary)
+	require.NoError(t, err)
+	assert.Equal(t, []scaffoldExport{{name: "run", signature: funcSig("", "i32")}}, exports)
+
+	// Imported functions come before the defined ones in the index space
+	data, err := selftestCorpus.ReadFile("selftest/wasi_imports.wasm")
+	require.NoError(t, err)
+	exports, err = scaffoldExports(data)
+	require.NoError(t, err)
+	assert.Equal(t, []scaffoldExport{{name: "process", signature: funcSig("i32", "i32")}}, exports)
+
+	_, err = scaffoldExports([]byte("not wasm"))
+	assert.Error(t, err)
+}
+
+func TestScaffold_WritesTestPerExport(t *testing.T) {
+	exports := []scaffoldExport{
+		{name: "handle-request", signature: funcSig("i64 f64", "i32")},
+		{name: "handle_request", signature: funcSig("", "")},
+		{name: "main", signature: funcSig("i32 i32", "i32")},
+		{name: "shuffle", signature: funcSig("v128", "v128")},
+	}
+	var out bytes.Buffer
+	require.NoError(t, writeScaffold(&out, "mymodule", "dir/mod.wasm", "testdata/mod.wasm", exports))
+
+	file, err := parser.ParseFile(token.NewFileSet(), "mod_test.go", out.Bytes(), parser.ParseComments)
+	require.NoError(t, err, out.String())
+	assert.Equal(t, "mymodule", file.Name.Name)
+	var tests []string
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok {
+			tests = append(tests, fn.Name.Name)
+		}
+	}
+	assert.Equal(t, []string{"runWasmExport", "TestHandleRequest", "TestHandleRequest2", "TestMain2"}, tests)
+	assert.Contains(t, out.String(), `const wasmModule = "testdata/mod.wasm"`)
+	assert.Contains(t, out.String(), "// shuffle (v128) -> (v128) is not called")
+
+	// The inputs are read back through the config's environment variables
+	calls := scaffoldInputs.FindAllStringSubmatch(out.String(), -1)
+	require.Len(t, calls, 3)
+	var config Config
+	require.NoError(t, applyEnvConfig(&config, []string{
+		"WASM_FUZZER_INVOCATION__ENTRY=" + calls[0][1],
+		"WASM_FUZZER_INVOCATION__INPUTS=" + calls[0][2],
+	}))
+	assert.Equal(t, "handle-request", config.Invocation.Entry)
+	assert.Equal(t, []InvocationInput{{
+		{Type: "i64", Value: "0"},
+		{Type: "f64", Value: "0x0000000000000000"},
+	}}, config.Invocation.Inputs)
+	assert.Equal(t, "[[]]", calls[1][2])
+}
+
+func TestScaffold_CommandPathsModuleFromTest(t *testing.T) {
+	dir := t.TempDir()
+	modulePath := filepath.Join(dir, "build", "mod.wasm")
+	require.NoError(t, os.MkdirAll(filepath.Dir(modulePath), 0o755))
+	require.NoError(t, os.WriteFile(modulePath, pluginBinary(), 0o644))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "pkg"), 0o755))
+	outputPath := filepath.Join(dir, "pkg", "mod_test.go")
+
+	require.Equal(t, 0, runScaffoldCommand([]string{"--output", outputPath, "--package", "pkg", modulePath}))
+	generated, err := os.ReadFile(outputPath)
+	require.NoError(t, err)
+	assert.Contains(t, string(generated), "package pkg\n")
+	assert.Contains(t, string(generated), `const wasmModule = "../build/mod.wasm"`)
+	assert.Contains(t, string(generated), "func TestRun(t *testing.T)")
+
+	assert.Equal(t, 1, runScaffoldCommand([]string{filepath.Join(dir, "missing.wasm")}))
+	assert.Equal(t, 1, runScaffoldCommand(nil))
+}
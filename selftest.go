@@ -0,0 +1,127 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// selftestCorpus holds the modules the selftest command runs. Each one is
+// built from the .wat file next to it, except the malformed ones.
+//
+//go:embed selftest/*.wasm
+var selftestCorpus embed.FS
+
+// selftestCase is a module of the self-test corpus and the outcome a
+// working installation gives it
+type selftestCase struct {
+	file string
+	// kind is valid, imports, trapping or malformed
+	kind  string
+	stage FailureStage
+	// code is only checked when set, as other codes depend on how the
+	// runtime words its errors
+	code ErrorCode
+}
+
+// selftestCases lists the self-test corpus in the order it runs
+var selftestCases = []selftestCase{
+	{file: "valid.wasm", kind: "valid", stage: StageNone},
+	{file: "wasi_imports.wasm", kind: "imports", stage: StageNone},
+	{file: "trap_unreachable.wasm", kind: "trapping", stage: StageExecute, code: ErrExecTrapUnreachable},
+	{file: "trap_memory_oob.wasm", kind: "trapping", stage: StageExecute, code: ErrExecTrapOOB},
+	{file: "malformed_magic.wasm", kind: "malformed", stage: StageLoad, code: ErrLoadMagic},
+	{file: "malformed_truncated.wasm", kind: "malformed", stage: StageLoad},
+}
+
+// selftestResult is how one module of the self-test corpus ran
+type selftestResult struct {
+	File          string       `json:"file"`
+	Kind          string       `json:"kind"`
+	ExpectedStage FailureStage `json:"expected_stage"`
+	ExpectedCode  ErrorCode    `json:"expected_code,omitempty"`
+	FailureStage  FailureStage `json:"failure_stage"`
+	ErrorCode     ErrorCode    `json:"error_code,omitempty"`
+	ErrorMessage  string       `json:"error_message,omitempty"`
+	Passed        bool         `json:"passed"`
+}
+
+// selftestOutput is the JSON written by the selftest subcommand
+type selftestOutput struct {
+	Passed  bool             `json:"passed"`
+	Results []selftestResult `json:"results"`
+}
+
+// runSelftest runs the self-test corpus through the pipeline with the
+// default options, checking each module's stage and code
+func runSelftest(runtime WasmRuntime) (selftestOutput, error) {
+	dir, err := os.MkdirTemp("", "wasm-fuzzer-selftest-*")
+	if err != nil {
+		return selftestOutput{}, err
+	}
+	defer os.RemoveAll(dir)
+
+	output := selftestOutput{Passed: true}
+	opts := Config{}.runOptions()
+	for _, c := range selftestCases {
+		data, err := selftestCorpus.ReadFile("selftest/" + c.file)
+		if err != nil {
+			return selftestOutput{}, err
+		}
+		filePath := filepath.Join(dir, c.file)
+		if err := os.WriteFile(filePath, data, 0o644); err != nil {
+			return selftestOutput{}, fmt.Errorf("failed to write %s: %w", c.file, err)
+		}
+
+		result := processWasmFileWithOptions(filePath, runtime, opts)
+		assignErrorCodes(&result)
+		checked := selftestResult{
+			File:          c.file,
+			Kind:          c.kind,
+			ExpectedStage: c.stage,
+			ExpectedCode:  c.code,
+			FailureStage:  result.FailureStage,
+			ErrorCode:     result.ErrorCode,
+			ErrorMessage:  result.ErrorMessage,
+		}
+		checked.Passed = result.FailureStage == c.stage && (c.code == "" || result.ErrorCode == c.code)
+		if c.stage == StageNone {
+			checked.Passed = checked.Passed && result.Success
+		}
+		output.Passed = output.Passed && checked.Passed
+		output.Results = append(output.Results, checked)
+	}
+	return output, nil
+}
+
+// runSelftestCommand runs the embedded corpus to confirm the installation
+// classifies modules as expected. It fails when any module is not.
+func runSelftestCommand(args []string) int {
+	if len(args) != 0 {
+		emitError(map[string]string{"error": "usage: wasm-fuzzer selftest"})
+		return 1
+	}
+
+	runtime, err := newRuntime(Environment{})
+	if err != nil {
+		emitError(map[string]string{"error": "failed to create runtime", "details": err.Error()})
+		return 1
+	}
+	defer closeRuntimes([]environmentRuntime{{Runtime: runtime}})
+
+	output, err := runSelftest(runtime)
+	if err != nil {
+		emitError(map[string]string{"error": "selftest failed", "details": err.Error()})
+		return 1
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(output)
+	if !output.Passed {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,11 @@
+;; trap_unreachable.wat
+;; Valid module that traps at runtime with "unreachable" instruction
+;; Expected stage: EXECUTE (runtime trap)
+;; Tests: Runtime trap handling
+
+(module
+  (func $process (export "process") (param $input i32) (result i32)
+    ;; Immediately trap - simulates assertion failure
+    unreachable
+  )
+)
@@ -0,0 +1,35 @@
+;; wasi_imports.wat
+;; Valid module importing many WASI functions, calling some of them
+;; Expected stage: NONE (success)
+;; Tests: Host functions are linked to every import and callable
+
+(module
+  (import "wasi_snapshot_preview1" "args_sizes_get" (func $args_sizes_get (param i32 i32) (result i32)))
+  (import "wasi_snapshot_preview1" "environ_sizes_get" (func $environ_sizes_get (param i32 i32) (result i32)))
+  (import "wasi_snapshot_preview1" "clock_res_get" (func $clock_res_get (param i32 i32) (result i32)))
+  (import "wasi_snapshot_preview1" "clock_time_get" (func $clock_time_get (param i32 i64 i32) (result i32)))
+  (import "wasi_snapshot_preview1" "random_get" (func $random_get (param i32 i32) (result i32)))
+  (import "wasi_snapshot_preview1" "fd_write" (func $fd_write (param i32 i32 i32 i32) (result i32)))
+  (import "wasi_snapshot_preview1" "fd_close" (func $fd_close (param i32) (result i32)))
+  (import "wasi_snapshot_preview1" "sched_yield" (func $sched_yield (result i32)))
+
+  (memory (export "memory") 1)
+
+  (func $process (export "process") (param $input i32) (result i32)
+    ;; Fill 8 bytes at 16 with random data
+    i32.const 16
+    i32.const 8
+    call $random_get
+    drop
+    ;; Read the realtime clock into 32
+    i32.const 0
+    i64.const 0
+    i32.const 32
+    call $clock_time_get
+    drop
+    ;; Return input + 1
+    local.get $input
+    i32.const 1
+    i32.add
+  )
+)
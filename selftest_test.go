@@ -0,0 +1,95 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// selftestRuntime fails the self-test corpus the way WasmEdge does
+func selftestRuntime() *MockWasmRuntime {
+	return &MockWasmRuntime{LoadModuleFunc: func(filePath string) (WasmModule, error) {
+		switch filepath.Base(filePath) {
+		case "malformed_magic.wasm":
+			return nil, &RuntimeError{Stage: StageLoad, Message: "magic header not detected"}
+		case "malformed_truncated.wasm":
+			return nil, &RuntimeError{Stage: StageLoad, Message: "unexpected end"}
+		case "trap_unreachable.wasm":
+			return &MockWasmModule{ExecuteFunc: func(string, ...interface{}) ([]interface{}, error) {
+				return nil, errors.New("unreachable instruction executed")
+			}}, nil
+		case "trap_memory_oob.wasm":
+			return &MockWasmModule{ExecuteFunc: func(string, ...interface{}) ([]interface{}, error) {
+				return nil, errors.New("out of bounds memory access")
+			}}, nil
+		}
+		return &MockWasmModule{}, nil
+	}}
+}
+
+// -----------------------------------------------------------------------------
+// TEST: Self-Test
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// The self-test is how users confirm an installation before trusting it
+// with a real corpus. It must pass on a runtime that classifies modules
+// correctly, and point at every module a broken one gets wrong.
+// -----------------------------------------------------------------------------
+
+func TestSelftest_CorpusIsEmbedded(t *testing.T) {
+	for _, c := range selftestCases {
+		data, err := selftestCorpus.ReadFile("selftest/" + c.file)
+		require.NoError(t, err, c.file)
+		if c.kind == "malformed" {
+			continue
+		}
+		_, err = parseWasmBinary(data)
+		assert.NoError(t, err, c.file)
+	}
+
+	data, err := selftestCorpus.ReadFile("selftest/wasi_imports.wasm")
+	require.NoError(t, err)
+	assert.Len(t, moduleImports(data), 8)
+}
+
+func TestSelftest_PassesOnWorkingRuntime(t *testing.T) {
+	output, err := runSelftest(selftestRuntime())
+	require.NoError(t, err)
+
+	assert.True(t, output.Passed)
+	require.Len(t, output.Results, len(selftestCases))
+	for _, result := range output.Results {
+		assert.True(t, result.Passed, result.File)
+	}
+	assert.Equal(t, ErrExecTrapUnreachable, output.Results[2].ErrorCode)
+	assert.Equal(t, ErrLoadMagic, output.Results[4].ErrorCode)
+}
+
+func TestSelftest_ReportsMisclassifiedModules(t *testing.T) {
+	// A runtime loading everything, as the placeholder one does
+	output, err := runSelftest(&MockWasmRuntime{})
+	require.NoError(t, err)
+
+	assert.False(t, output.Passed)
+	var failed []string
+	for _, result := range output.Results {
+		if !result.Passed {
+			failed = append(failed, strings.TrimSuffix(result.File, ".wasm"))
+		}
+	}
+	assert.Equal(t, []string{"trap_unreachable", "trap_memory_oob", "malformed_magic", "malformed_truncated"}, failed)
+	assert.Equal(t, StageNone, output.Results[2].FailureStage)
+	assert.Equal(t, StageExecute, output.Results[2].ExpectedStage)
+}
+
+func TestSelftest_RejectsArguments(t *testing.T) {
+	assert.Equal(t, 1, runSelftestCommand([]string{"extra"}))
+}
@@ -0,0 +1,460 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+)
+
+// defaultSequenceLength is the number of calls in a sequence when unset
+const defaultSequenceLength = 8
+
+// SequenceConfig enables sequence fuzzing, where every input is a sequence
+// of calls to the module's exports, such as open, write and close in some
+// order, instead of one call to the entry
+type SequenceConfig struct {
+	// Iterations is the number of sequences per file; 0 disables it
+	Iterations int `yaml:"iterations"`
+	// Seed makes the sequences reproducible
+	Seed int64 `yaml:"seed"`
+	// MaxLength caps the calls in a sequence, 8 when unset
+	MaxLength int `yaml:"max_length"`
+	// Exports are the functions random sequences call; by default every
+	// export with integer parameters except the setup and start functions
+	Exports []string `yaml:"exports"`
+	// Transitions make sequences walks of a state machine starting in
+	// Start, the state the first transition leaves when unset. Exports is
+	// ignored then.
+	Start       string               `yaml:"start"`
+	Transitions []SequenceTransition `yaml:"transitions"`
+}
+
+// SequenceTransition allows calling an export in a state, moving to
+// another one, or staying when To is unset
+type SequenceTransition struct {
+	From string `yaml:"from"`
+	Call string `yaml:"call"`
+	To   string `yaml:"to"`
+}
+
+// SequenceSummary records the outcome of sequence fuzzing for one file
+type SequenceSummary struct {
+	Iterations     int               `json:"iterations"`
+	Seed           int64             `json:"seed"`
+	Calls          int               `json:"calls"`
+	Failures       int               `json:"failures"`
+	UniqueFailures []SequenceFailure `json:"unique_failures,omitempty"`
+}
+
+// SequenceFailure is a distinct failure found by sequence fuzzing, with the
+// minimal sequence of calls still triggering it
+type SequenceFailure struct {
+	Calls        []SequenceCall `json:"calls"`
+	ErrorMessage string         `json:"error_message"`
+	Count        int            `json:"count"`
+	// Length is the number of calls of the first sequence that triggered
+	// it, and Executions the runs taken to minimize it
+	Length     int `json:"length"`
+	Executions int `json:"executions"`
+}
+
+// SequenceCall is one call of a sequence
+type SequenceCall struct {
+	Export string      `json:"export"`
+	Args   []WasmValue `json:"args"`
+}
+
+// describeSequence formats calls as "open(1) write(3, 0)"
+func describeSequence(calls []SequenceCall) string {
+	described := make([]string, len(calls))
+	for i, call := range calls {
+		described[i] = fmt.Sprintf("%s(%s)", call.Export, strings.Trim(describeArgs(call.Args), "()"))
+	}
+	return strings.Join(described, " ")
+}
+
+// sequenceCall is a call of a generated sequence
+type sequenceCall struct {
+	export string
+	args   []interface{}
+}
+
+// sequenceGenerator generates sequences of calls, walking the state machine
+// when one is configured, from a seeded PRNG
+type sequenceGenerator struct {
+	rng        *rand.Rand
+	maxLength  int
+	signatures map[string]FuncSignature
+	// exports are those random sequences call
+	exports []string
+	// start and transitions are the state machine's, by source state
+	start       string
+	transitions map[string][]SequenceTransition
+	// corpus holds the sequences that reached new edges
+	corpus     [][]sequenceCall
+	dictionary []int32
+}
+
+// newSequenceGenerator checks the configured exports and transitions
+// against the module's signatures
+func newSequenceGenerator(config SequenceConfig, signatures map[string]FuncSignature, exclude []string) (*sequenceGenerator, error) {
+	g := &sequenceGenerator{
+		rng:        rand.New(rand.NewSource(config.Seed)),
+		maxLength:  config.MaxLength,
+		signatures: signatures,
+	}
+	if g.maxLength <= 0 {
+		g.maxLength = defaultSequenceLength
+	}
+
+	check := func(export string) error {
+		signature, ok := signatures[export]
+		if !ok {
+			return fmt.Errorf("module does not export '%s'", export)
+		}
+		if !sequenceSupports(signature) {
+			return fmt.Errorf("'%s' takes %s; sequences pass integer arguments only", export, signature)
+		}
+		return nil
+	}
+	if len(config.Transitions) > 0 {
+		g.start = config.Start
+		if g.start == "" {
+			g.start = config.Transitions[0].From
+		}
+		g.transitions = make(map[string][]SequenceTransition)
+		for _, transition := range config.Transitions {
+			if err := check(transition.Call); err != nil {
+				return nil, err
+			}
+			g.transitions[transition.From] = append(g.transitions[transition.From], transition)
+		}
+		return g, nil
+	}
+
+	g.exports = config.Exports
+	for _, export := range g.exports {
+		if err := check(export); err != nil {
+			return nil, err
+		}
+	}
+	if len(g.exports) == 0 {
+		for name, signature := range signatures {
+			if sequenceSupports(signature) && !strings.HasPrefix(name, "__") && !containsString(exclude, name) {
+				g.exports = append(g.exports, name)
+			}
+		}
+		sort.Strings(g.exports)
+	}
+	if len(g.exports) == 0 {
+		return nil, fmt.Errorf("no export takes integer arguments only")
+	}
+	return g, nil
+}
+
+// sequenceSupports reports whether every parameter is an integer
+func sequenceSupports(signature FuncSignature) bool {
+	for _, param := range signature.Params {
+		if param != "i32" && param != "i64" {
+			return false
+		}
+	}
+	return true
+}
+
+// choices returns the exports callable in a state and the states each
+// leads to
+func (g *sequenceGenerator) choices(state string) ([]string, []string) {
+	if g.transitions == nil {
+		return g.exports, nil
+	}
+	var exports, states []string
+	for _, transition := range g.transitions[state] {
+		to := transition.To
+		if to == "" {
+			to = state
+		}
+		exports, states = append(exports, transition.Call), append(states, to)
+	}
+	return exports, states
+}
+
+// valid reports whether a sequence walks the state machine from its start
+func (g *sequenceGenerator) valid(calls []sequenceCall) bool {
+	state := g.start
+	for _, call := range calls {
+		exports, states := g.choices(state)
+		i := indexOf(exports, call.export)
+		if i < 0 {
+			return false
+		}
+		if states != nil {
+			state = states[i]
+		}
+	}
+	return true
+}
+
+func indexOf(values []string, value string) int {
+	for i, v := range values {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
+
+// prefix returns the calls a new sequence starts with: half of the time
+// the start of a sequence that reached new edges, and the state it ends in
+func (g *sequenceGenerator) prefix() ([]sequenceCall, string) {
+	if len(g.corpus) == 0 || g.rng.Intn(2) == 0 {
+		return nil, g.start
+	}
+	kept := g.corpus[g.rng.Intn(len(g.corpus))]
+	calls := append([]sequenceCall(nil), kept[:g.rng.Intn(len(kept))]...)
+	state := g.start
+	for _, call := range calls {
+		exports, states := g.choices(state)
+		if states != nil {
+			state = states[indexOf(exports, call.export)]
+		}
+	}
+	return calls, state
+}
+
+// nextCall picks the next call in a state, with the state it leads to, or
+// returns false when the state allows no call. returns are the i32 values
+// returned so far, which arguments reuse as handles.
+func (g *sequenceGenerator) nextCall(state string, returns []int32) (sequenceCall, string, bool) {
+	exports, states := g.choices(state)
+	if len(exports) == 0 {
+		return sequenceCall{}, state, false
+	}
+	i := g.rng.Intn(len(exports))
+	if states != nil {
+		state = states[i]
+	}
+	call := sequenceCall{export: exports[i]}
+	for _, param := range g.signatures[call.export].Params {
+		value := g.value(returns)
+		if param == "i64" {
+			call.args = append(call.args, int64(value))
+		} else {
+			call.args = append(call.args, value)
+		}
+	}
+	return call, state, true
+}
+
+// value draws an argument: a value an earlier call returned, a magic value
+// from the module, a boundary value or a random one
+func (g *sequenceGenerator) value(returns []int32) int32 {
+	switch g.rng.Intn(4) {
+	case 0:
+		if len(returns) > 0 {
+			return returns[g.rng.Intn(len(returns))]
+		}
+		return interestingI32[g.rng.Intn(len(interestingI32))]
+	case 1:
+		if len(g.dictionary) > 0 {
+			return g.dictionary[g.rng.Intn(len(g.dictionary))]
+		}
+		return interestingI32[g.rng.Intn(len(interestingI32))]
+	case 2:
+		return interestingI32[g.rng.Intn(len(interestingI32))]
+	default:
+		return int32(g.rng.Uint32())
+	}
+}
+
+// keep adds a sequence that reached new edges to the corpus
+func (g *sequenceGenerator) keep(calls []sequenceCall) {
+	if len(calls) > 0 && len(g.corpus) < maxArgCorpus {
+		g.corpus = append(g.corpus, calls)
+	}
+}
+
+// fuzzSequences runs sequences of export calls against the module,
+// starting each from the post-setup state, and records a summary on the
+// result. *module is updated whenever the module is reloaded. A sequence
+// ends at its first failing call. Each distinct failure is minimized by
+// dropping the calls it does not need.
+func fuzzSequences(result *ExecutionResult, module *WasmModule, filePath string, runtime WasmRuntime, plan InvocationConfig, config SequenceConfig, coverage *coverageTracker) {
+	summary := &SequenceSummary{Iterations: config.Iterations, Seed: config.Seed}
+	result.Sequence = summary
+	if plan.ABI != "" {
+		result.FailureStage, result.ErrorMessage = StageSignature, fmt.Sprintf("sequence fuzzing does not support the %s ABI", plan.ABI)
+		return
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		result.FailureStage, result.ErrorMessage = StageLoad, fmt.Sprintf("load failed: %v", err)
+		return
+	}
+	generator, err := newSequenceGenerator(config, exportSignatures(data), []string{plan.Setup, "_start", "_initialize"})
+	if err != nil {
+		result.FailureStage, result.ErrorMessage = StageSignature, "sequence: "+err.Error()
+		return
+	}
+	if dict, err := extractDictionary(data); err == nil {
+		generator.dictionary = dict.argumentValues()
+	}
+
+	var snapshot *ModuleSnapshot
+	if stateful, ok := (*module).(StatefulModule); ok {
+		if snapshot, err = stateful.Snapshot(); err != nil {
+			result.FailureStage = StageExecute
+			result.ErrorMessage = fmt.Sprintf("snapshot failed: %v", err)
+			return
+		}
+	}
+
+	// Every sequence but the first starts from a reset module
+	first := true
+	reset := func() error {
+		if first {
+			first = false
+			return nil
+		}
+		var err error
+		*module, err = resetModule(*module, snapshot, filePath, runtime, plan)
+		return err
+	}
+	// run replays a sequence, returning the failure ending it and how
+	// many calls ran
+	run := func(calls []sequenceCall) (string, int, error) {
+		if err := reset(); err != nil {
+			return "", 0, err
+		}
+		for i, call := range calls {
+			_, err := (*module).Execute(call.export, call.args...)
+			coverage.collect(*module)
+			if err != nil {
+				_, message := classifyError(err, StageExecute, "execution failed")
+				return message, i + 1, nil
+			}
+		}
+		return "", len(calls), nil
+	}
+
+	result.Success = true
+	failures := make(map[string]*SequenceFailure)
+	sequences := make(map[string][]sequenceCall)
+	var order []string
+	for i := 0; i < config.Iterations; i++ {
+		if err := reset(); err != nil {
+			restoreFailed(result, err)
+			return
+		}
+
+		// Calls run as they are generated, so arguments can reuse what
+		// earlier calls returned
+		calls, state := generator.prefix()
+		var returns []int32
+		newEdges, message := false, ""
+		for step := 0; step < generator.maxLength && message == ""; step++ {
+			if step == len(calls) {
+				call, next, ok := generator.nextCall(state, returns)
+				if !ok {
+					break
+				}
+				calls, state = append(calls, call), next
+			}
+			call := calls[step]
+			values, err := (*module).Execute(call.export, call.args...)
+			summary.Calls++
+			reached, _ := coverage.collect(*module)
+			newEdges = newEdges || reached
+			if err != nil {
+				_, message = classifyError(err, StageExecute, "execution failed")
+				calls = calls[:step+1]
+			}
+			for _, value := range values {
+				if n, ok := value.(int32); ok {
+					returns = append(returns, n)
+				}
+			}
+		}
+		if newEdges {
+			generator.keep(calls)
+		}
+		if message == "" {
+			continue
+		}
+
+		summary.Failures++
+		if failure, seen := failures[message]; seen {
+			failure.Count++
+			continue
+		}
+		if len(order) < maxUniqueFailures {
+			failures[message] = &SequenceFailure{ErrorMessage: message, Count: 1, Length: len(calls)}
+			sequences[message] = calls
+			order = append(order, message)
+		}
+	}
+
+	for _, message := range order {
+		failure := failures[message]
+		minimal, executions, err := minimizeSequence(sequences[message], message, generator, run)
+		if err != nil {
+			restoreFailed(result, err)
+			return
+		}
+		failure.Calls, failure.Executions = encodeSequence(minimal), executions
+		summary.UniqueFailures = append(summary.UniqueFailures, *failure)
+	}
+	if len(summary.UniqueFailures) > 0 {
+		found := summary.UniqueFailures[0]
+		result.Success = false
+		result.FailureStage = StageExecute
+		result.ErrorMessage = fmt.Sprintf("sequence %s: %s", describeSequence(found.Calls), found.ErrorMessage)
+	}
+}
+
+// restoreFailed fails a result whose module could not be returned to its
+// post-setup state
+func restoreFailed(result *ExecutionResult, err error) {
+	result.Success = false
+	result.FailureStage, result.ErrorMessage = classifyError(err, StageExecute, "restore failed")
+	result.FailureSubStage = failureSubStage(err)
+}
+
+// minimizeSequence drops the calls a failure does not need, in halves,
+// then quarters, down to single calls, keeping the sequence a walk of the
+// state machine and failing with the same message. It returns the minimal
+// sequence and the runs taken.
+func minimizeSequence(calls []sequenceCall, message string, generator *sequenceGenerator, run func([]sequenceCall) (string, int, error)) ([]sequenceCall, int, error) {
+	executions := 0
+	for size := max(len(calls)/2, 1); size >= 1; size /= 2 {
+		for i := 0; i+size <= len(calls); {
+			candidate := append(append([]sequenceCall(nil), calls[:i]...), calls[i+size:]...)
+			if len(candidate) == 0 || !generator.valid(candidate) {
+				i++
+				continue
+			}
+			got, ran, err := run(candidate)
+			executions++
+			if err != nil {
+				return nil, executions, err
+			}
+			if got == message {
+				calls = candidate[:ran]
+				continue
+			}
+			i++
+		}
+	}
+	return calls, executions, nil
+}
+
+// encodeSequence converts calls for the report
+func encodeSequence(calls []sequenceCall) []SequenceCall {
+	encoded := make([]SequenceCall, len(calls))
+	for i, call := range calls {
+		encoded[i] = SequenceCall{Export: call.export, Args: encodeValues(call.args)}
+	}
+	return encoded
+}
@@ -0,0 +1,178 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mrhapile/WASM-Injection-Framework/internal/wasmbin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fileAPIBinary exports open() -> i32, write(i32, i32) -> i32,
+// close(i32) -> i32 and scale(f32) -> f32
+func fileAPIBinary() []byte {
+	module := &wasmBinary{}
+	add := func(id byte, payload ...byte) {
+		module.Sections = append(module.Sections, wasmSection{ID: id, Payload: payload})
+	}
+
+	add(sectionType, 0x04,
+		0x60, 0x00, 0x01, 0x7f,
+		0x60, 0x02, 0x7f, 0x7f, 0x01, 0x7f,
+		0x60, 0x01, 0x7f, 0x01, 0x7f,
+		0x60, 0x01, 0x7d, 0x01, 0x7d)
+	add(sectionFunction, 0x04, 0x00, 0x01, 0x02, 0x03)
+	exports := []byte{0x04}
+	for i, name := range []string{"open", "write", "close", "scale"} {
+		exports = append(wasmbin.AppendName(exports, name), externFunc, byte(i))
+	}
+	add(sectionExport, exports...)
+	add(sectionCode, 0x04,
+		0x04, 0x00, opI32Const, 0x00, opEnd,
+		0x04, 0x00, opI32Const, 0x00, opEnd,
+		0x04, 0x00, opI32Const, 0x00, opEnd,
+		0x04, 0x00, opLocalGet, 0x00, opEnd)
+	return module.encode()
+}
+
+// fileAPIModule hands out handle 7 and traps on writes to a closed handle
+type fileAPIModule struct {
+	MockWasmModule
+	open, closed bool
+	calls        []string
+}
+
+func (m *fileAPIModule) Execute(funcName string, args ...interface{}) ([]interface{}, error) {
+	m.calls = append(m.calls, funcName)
+	switch funcName {
+	case "open":
+		m.open, m.closed = true, false
+		return []interface{}{int32(7)}, nil
+	case "close":
+		if m.open && args[0] == int32(7) {
+			m.open, m.closed = false, true
+		}
+	case "write":
+		if m.closed && args[0] == int32(7) {
+			return nil, errors.New("wasm trap: use after close")
+		}
+	}
+	return []interface{}{int32(0)}, nil
+}
+
+// runSequences runs sequence fuzzing against fresh fileAPIModules
+func runSequences(t *testing.T, config SequenceConfig) (ExecutionResult, []*fileAPIModule) {
+	path := filepath.Join(t.TempDir(), "files.wasm")
+	require.NoError(t, os.WriteFile(path, fileAPIBinary(), 0o644))
+	var modules []*fileAPIModule
+	runtime := &MockWasmRuntime{
+		LoadModuleFunc: func(filePath string) (WasmModule, error) {
+			module := &fileAPIModule{}
+			modules = append(modules, module)
+			return module, nil
+		},
+	}
+	result := processWasmFileWithOptions(path, runtime, RunOptions{Sequence: config})
+	return result, modules
+}
+
+// -----------------------------------------------------------------------------
+// TEST: Sequence Fuzzing
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Many bugs only show in a particular order of calls, such as writing to
+// a handle after closing it. Fuzzing sequences of export calls finds
+// them, and minimizing the sequence shows the few calls that matter.
+// -----------------------------------------------------------------------------
+
+func TestSequence_FindsAndMinimizesOrderingBugs(t *testing.T) {
+	result, _ := runSequences(t, SequenceConfig{Iterations: 300, Seed: 1, MaxLength: 8})
+
+	require.NotNil(t, result.Sequence)
+	assert.False(t, result.Success)
+	assert.Equal(t, StageExecute, result.FailureStage)
+	require.Len(t, result.Sequence.UniqueFailures, 1)
+
+	failure := result.Sequence.UniqueFailures[0]
+	assert.Equal(t, "execution failed: wasm trap: use after close", failure.ErrorMessage)
+	var exports []string
+	for _, call := range failure.Calls {
+		exports = append(exports, call.Export)
+	}
+	assert.Equal(t, []string{"open", "close", "write"}, exports)
+	assert.Equal(t, "7", failure.Calls[1].Args[0].Value, "the handle open returned is passed on")
+	assert.GreaterOrEqual(t, failure.Length, 3)
+	assert.Equal(t, "sequence open() close(7) write(7, "+failure.Calls[2].Args[1].Value+"): execution failed: wasm trap: use after close", result.ErrorMessage)
+}
+
+func TestSequence_WalksTheStateMachine(t *testing.T) {
+	result, modules := runSequences(t, SequenceConfig{
+		Iterations: 50,
+		Seed:       2,
+		Transitions: []SequenceTransition{
+			{From: "closed", Call: "open", To: "opened"},
+			{From: "opened", Call: "write"},
+			{From: "opened", Call: "close", To: "closed"},
+		},
+	})
+
+	assert.True(t, result.Success, "writes never follow a close")
+	assert.Empty(t, result.Sequence.UniqueFailures)
+	assert.NotZero(t, result.Sequence.Calls)
+	for _, module := range modules {
+		for i, call := range module.calls {
+			if i == 0 {
+				assert.Equal(t, "open", call)
+			} else if module.calls[i-1] == "close" {
+				assert.Equal(t, "open", call)
+			}
+		}
+	}
+}
+
+func TestSequence_DefaultExportsTakeIntegersOnly(t *testing.T) {
+	signatures := exportSignatures(fileAPIBinary())
+	generator, err := newSequenceGenerator(SequenceConfig{}, signatures, []string{"open"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"close", "write"}, generator.exports)
+
+	_, err = newSequenceGenerator(SequenceConfig{Exports: []string{"scale"}}, signatures, nil)
+	assert.ErrorContains(t, err, "integer arguments only")
+	_, err = newSequenceGenerator(SequenceConfig{Transitions: []SequenceTransition{{Call: "seek"}}}, signatures, nil)
+	assert.ErrorContains(t, err, "does not export 'seek'")
+}
+
+func TestSequence_MinimizationKeepsValidWalks(t *testing.T) {
+	generator, err := newSequenceGenerator(SequenceConfig{Transitions: []SequenceTransition{
+		{From: "a", Call: "open", To: "b"},
+		{From: "b", Call: "close", To: "a"},
+	}}, exportSignatures(fileAPIBinary()), nil)
+	require.NoError(t, err)
+
+	calls := []sequenceCall{{export: "open"}, {export: "close"}, {export: "open"}, {export: "close"}}
+	runs := 0
+	minimal, executions, err := minimizeSequence(calls, "boom", generator, func(calls []sequenceCall) (string, int, error) {
+		runs++
+		if calls[len(calls)-1].export == "close" {
+			return "boom", len(calls), nil
+		}
+		return "", len(calls), nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []sequenceCall{{export: "open"}, {export: "close"}}, minimal)
+	assert.Equal(t, runs, executions)
+}
+
+func TestSequence_UnsupportedSetups(t *testing.T) {
+	result, _ := runSequences(t, SequenceConfig{Iterations: 5, Exports: []string{"scale"}})
+	assert.False(t, result.Success)
+	assert.Equal(t, StageSignature, result.FailureStage)
+	assert.Contains(t, result.ErrorMessage, "sequence:")
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// moduleServer runs the modules posted to it through the pipeline, one at
+// a time, in the first environment of the config's matrix
+type moduleServer struct {
+	env         environmentRuntime
+	opts        RunOptions
+	classifiers classifierChain
+	redactor    *redactor
+	maxSize     int64
+	mu          sync.Mutex
+}
+
+// handler serves POST /run, taking the module as the request body and
+// answering with its result, and GET /healthz
+func (s *moduleServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/run", s.run)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	return mux
+}
+
+// run runs the posted module. The result of a module that fails is still
+// a 200; errors are for requests that could not be run.
+func (s *moduleServer) run(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeServeError(w, http.StatusMethodNotAllowed, "POST the module to run", "")
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.maxSize))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeServeError(w, http.StatusRequestEntityTooLarge, "module too large", err.Error())
+		return
+	} else if err != nil {
+		writeServeError(w, http.StatusBadRequest, "failed to read module", err.Error())
+		return
+	}
+
+	// The pipeline runs files, so the module is written to one for the
+	// length of its run
+	file, err := os.CreateTemp("", "wasm-fuzzer-serve-*.wasm")
+	if err != nil {
+		writeServeError(w, http.StatusInternalServerError, "failed to store module", err.Error())
+		return
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		writeServeError(w, http.StatusInternalServerError, "failed to store module", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := processWasmFileWithOptions(file.Name(), s.env.Runtime, s.opts)
+	result.Classification = s.classifiers.classify(result)
+	assignErrorCodes(&result)
+	if err := s.redactor.redact(&result); err != nil {
+		writeServeError(w, http.StatusInternalServerError, "redaction failed", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(result)
+}
+
+// writeServeError answers a request with an error in the shape emitError
+// writes
+func writeServeError(w http.ResponseWriter, status int, message, details string) {
+	body := map[string]string{"error": message}
+	if details != "" {
+		body["details"] = details
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// runServeCommand serves the pipeline over HTTP until the server fails
+func runServeCommand(args []string) int {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	configPath := flags.String("config", "", "YAML campaign config")
+	addr := flags.String("addr", "localhost:8080", "address to listen on")
+	maxSize := ByteSize(64 << 20)
+	flags.Var(&maxSize, "max-size", "reject modules larger than this size, such as 10MiB")
+
+	if err := flags.Parse(args); err != nil || flags.NArg() != 0 {
+		emitError(map[string]string{
+			"error": "usage: wasm-fuzzer serve [--config file.yaml] [--addr localhost:8080] [--max-size bytes]",
+		})
+		return 1
+	}
+
+	config, err := resolveConfig(*configPath)
+	if err != nil {
+		emitError(map[string]string{
+			"error":   "config load failed",
+			"details": err.Error(),
+		})
+		return 1
+	}
+	envs, err := buildEnvironmentRuntimes(config)
+	if err != nil {
+		emitError(map[string]string{
+			"error":   "invalid environment matrix",
+			"details": err.Error(),
+		})
+		return 1
+	}
+	defer closeRuntimes(envs)
+	redactor, err := newRedactor(config.Redaction)
+	if err != nil {
+		emitError(map[string]string{
+			"error":   "invalid redaction",
+			"details": err.Error(),
+		})
+		return 1
+	}
+	classifiers, err := newClassifierChain(config.Classifiers)
+	if err != nil {
+		emitError(map[string]string{
+			"error":   "invalid classifiers",
+			"details": err.Error(),
+		})
+		return 1
+	}
+
+	server := &moduleServer{
+		env:         envs[0],
+		opts:        config.runOptions(),
+		classifiers: classifiers,
+		redactor:    redactor,
+		maxSize:     int64(maxSize),
+	}
+	if err := http.ListenAndServe(*addr, server.handler()); err != nil {
+		emitError(map[string]string{
+			"error":   "server failed",
+			"details": err.Error(),
+		})
+	}
+	return 1
+}
@@ -0,0 +1,103 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// -----------------------------------------------------------------------------
+// TEST: Module Server
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Services that receive modules from users want each one checked before
+// accepting it, without shelling out per module. The server must run
+// what it is posted through the same pipeline as a campaign, report a
+// failing module as a result rather than an error, and refuse modules
+// too large to take.
+// -----------------------------------------------------------------------------
+
+func newTestServer(t *testing.T, runtime WasmRuntime) *httptest.Server {
+	server := &moduleServer{env: environmentRuntime{Runtime: runtime}, maxSize: 1 << 10}
+	ts := httptest.NewServer(server.handler())
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestServe_RunsPostedModules(t *testing.T) {
+	var loaded []byte
+	runtime := &MockWasmRuntime{LoadModuleFunc: func(filePath string) (WasmModule, error) {
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			return nil, err
+		}
+		loaded = data
+		return &MockWasmModule{}, nil
+	}}
+	ts := newTestServer(t, runtime)
+
+	resp, err := http.Post(ts.URL+"/run", "application/wasm", bytes.NewReader(pluginBinary()))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var result ExecutionResult
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	assert.True(t, result.Success, result.ErrorMessage)
+	assert.Equal(t, pluginBinary(), loaded, "the runtime runs the posted module")
+	_, err = os.Stat(result.FilePath)
+	assert.True(t, os.IsNotExist(err), "the module is removed after its run")
+}
+
+func TestServe_ReportsFailingModulesAsResults(t *testing.T) {
+	ts := newTestServer(t, &MockWasmRuntime{LoadModuleFunc: func(string) (WasmModule, error) {
+		return nil, errors.New("magic header not detected")
+	}})
+	resp, err := http.Post(ts.URL+"/run", "application/wasm", bytes.NewReader([]byte("junk")))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var result ExecutionResult
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	assert.False(t, result.Success)
+	assert.Equal(t, StageLoad, result.FailureStage)
+	assert.NotEmpty(t, result.ErrorCode)
+}
+
+func TestServe_RejectsBadRequests(t *testing.T) {
+	ts := newTestServer(t, &MockWasmRuntime{})
+
+	resp, err := http.Post(ts.URL+"/run", "application/wasm", bytes.NewReader(make([]byte, 2<<10)))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+
+	// A body that cannot be read is the client's fault, not its size
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/run", iotest.ErrReader(errors.New("connection reset")))
+	(&moduleServer{maxSize: 1 << 10}).handler().ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	resp, err = http.Get(ts.URL + "/run")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+
+	resp, err = http.Get(ts.URL + "/healthz")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	assert.Equal(t, 1, runServeCommand([]string{"extra"}))
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// ShardInfo identifies the part of a corpus a sharded campaign ran
+type ShardInfo struct {
+	Index int `json:"index"`
+	Count int `json:"count"`
+}
+
+// shard returns the shard the config selects, or nil when the corpus is
+// not sharded
+func (c CorpusConfig) shard() (*ShardInfo, error) {
+	if c.ShardCount == 0 && c.ShardIndex == 0 {
+		return nil, nil
+	}
+	if c.ShardCount < 1 || c.ShardIndex < 0 || c.ShardIndex >= c.ShardCount {
+		return nil, fmt.Errorf("shard index %d is not in [0, %d)", c.ShardIndex, c.ShardCount)
+	}
+	return &ShardInfo{Index: c.ShardIndex, Count: c.ShardCount}, nil
+}
+
+// shardOf assigns a file to a shard by a hash of its name. Adding files to
+// the corpus never moves the others to another shard.
+func shardOf(filePath string, count int) int {
+	h := fnv.New32a()
+	h.Write([]byte(filepath.Base(filePath)))
+	return int(h.Sum32() % uint32(count))
+}
+
+// shardFiles keeps the files of one shard. Files of other shards are left
+// out of the report entirely, as another job reports them.
+func shardFiles(files []string, shard *ShardInfo) []string {
+	if shard == nil {
+		return files
+	}
+	var kept []string
+	for _, file := range files {
+		if shardOf(file, shard.Count) == shard.Index {
+			kept = append(kept, file)
+		}
+	}
+	return kept
+}
+
+// mergeReports combines the reports of every shard of a campaign into the
+// report of the whole campaign. The shards must all be present, each once.
+func mergeReports(reports []FuzzingReport) (FuzzingReport, error) {
+	merged := FuzzingReport{
+		SchemaVersion: SchemaVersion,
+		Results:       make([]ExecutionResult, 0),
+		FailureCounts: newFailureCounts(),
+		SkipCounts:    newSkipCounts(),
+	}
+	if len(reports) == 0 {
+		return merged, fmt.Errorf("no reports to merge")
+	}
+
+	seen := make(map[int]bool)
+	count := 0
+	for i, report := range reports {
+		if report.Shard == nil {
+			return merged, fmt.Errorf("report %d is not the report of a shard", i)
+		}
+		if i == 0 {
+			count = report.Shard.Count
+		}
+		if report.Shard.Count != count {
+			return merged, fmt.Errorf("report %d is a shard of %d, not of %d", i, report.Shard.Count, count)
+		}
+		if seen[report.Shard.Index] {
+			return merged, fmt.Errorf("shard %d is given twice", report.Shard.Index)
+		}
+		seen[report.Shard.Index] = true
+	}
+	for index := 0; index < count; index++ {
+		if !seen[index] {
+			return merged, fmt.Errorf("shard %d of %d is missing", index, count)
+		}
+	}
+
+	sorted := append([]FuzzingReport(nil), reports...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Shard.Index < sorted[j].Shard.Index })
+	merged.Selection = sorted[0].Selection
+	// Shards run with the same config but for the shard they select
+	merged.Config = sorted[0].Config
+
+	environments := make(map[string]int)
+	teams := make(map[string]*TeamSummary)
+	for _, report := range sorted {
+		merged.TotalFiles += report.TotalFiles
+		merged.Passed += report.Passed
+		merged.Failed += report.Failed
+		merged.Skipped += report.Skipped
+		merged.FilteredOut += report.FilteredOut
+		merged.WorkerRestarts += report.WorkerRestarts
+		merged.CrashLoops = append(merged.CrashLoops, report.CrashLoops...)
+		merged.Results = append(merged.Results, report.Results...)
+		for stage, n := range report.FailureCounts {
+			merged.FailureCounts[stage] += n
+		}
+		for reason, n := range report.SkipCounts {
+			merged.SkipCounts[reason] += n
+		}
+		for severity, n := range report.SeverityCounts {
+			if merged.SeverityCounts == nil {
+				merged.SeverityCounts = make(map[Severity]int)
+			}
+			merged.SeverityCounts[severity] += n
+		}
+
+		// Each file is in one shard, so divergences and differences never
+		// overlap
+		merged.EnvironmentDivergences = append(merged.EnvironmentDivergences, report.EnvironmentDivergences...)
+		merged.InjectionDifferences = append(merged.InjectionDifferences, report.InjectionDifferences...)
+		merged.Nondeterministic = append(merged.Nondeterministic, report.Nondeterministic...)
+		if report.Filter != nil {
+			if merged.Filter == nil {
+				filter := *report.Filter
+				filter.Dropped = 0
+				merged.Filter = &filter
+			}
+			merged.Filter.Dropped += report.Filter.Dropped
+		}
+		if budget := report.Budget; budget != nil {
+			if merged.Budget == nil {
+				merged.Budget = &BudgetSummary{MaxDuration: budget.MaxDuration, Elapsed: budget.Elapsed}
+			}
+			// Shards run side by side, so the campaign took as long as
+			// its slowest shard
+			if longer, err := time.ParseDuration(budget.Elapsed); err == nil {
+				if elapsed, err := time.ParseDuration(merged.Budget.Elapsed); err != nil || longer > elapsed {
+					merged.Budget.Elapsed = budget.Elapsed
+				}
+			}
+			merged.Budget.Files += budget.Files
+			merged.Budget.Ran += budget.Ran
+		}
+		if report.Aborted != "" && merged.Aborted == "" {
+			merged.Aborted = fmt.Sprintf("shard %d: %s", report.Shard.Index, report.Aborted)
+		}
+		if quarantine := report.Quarantine; quarantine != nil {
+			if merged.Quarantine == nil {
+				merged.Quarantine = &QuarantineSummary{}
+			}
+			merged.Quarantine.Passed += quarantine.Passed
+			merged.Quarantine.Failed += quarantine.Failed
+			merged.Quarantine.GatedFailures += quarantine.GatedFailures
+			merged.Quarantine.Added = append(merged.Quarantine.Added, quarantine.Added...)
+		}
+		if cache := report.Cache; cache != nil {
+			if merged.Cache == nil {
+				merged.Cache = &CacheSummary{}
+			}
+			merged.Cache.Hits += cache.Hits
+			merged.Cache.Misses += cache.Misses
+		}
+		if expected := report.Expectations; expected != nil {
+			if merged.Expectations == nil {
+				merged.Expectations = &ExpectationSummary{}
+			}
+			merged.Expectations.Checked += expected.Checked
+			merged.Expectations.Met += expected.Met
+			merged.Expectations.Failures = append(merged.Expectations.Failures, expected.Failures...)
+		}
+		for _, owner := range report.Owners {
+			summary := teams[owner.Team]
+			if summary == nil {
+				summary = &TeamSummary{Team: owner.Team}
+				teams[owner.Team] = summary
+			}
+			summary.Passed += owner.Passed
+			summary.Failed += owner.Failed
+			summary.Skipped += owner.Skipped
+		}
+		for _, env := range report.Environments {
+			i, ok := environments[env.Environment.Name]
+			if !ok {
+				i = len(merged.Environments)
+				environments[env.Environment.Name] = i
+				merged.Environments = append(merged.Environments, EnvironmentSummary{
+					Environment:   env.Environment,
+					FailureCounts: newFailureCounts(),
+					SkipCounts:    newSkipCounts(),
+				})
+			}
+			summary := &merged.Environments[i]
+			summary.Passed += env.Passed
+			summary.Failed += env.Failed
+			summary.Skipped += env.Skipped
+			for stage, n := range env.FailureCounts {
+				summary.FailureCounts[stage] += n
+			}
+			for reason, n := range env.SkipCounts {
+				summary.SkipCounts[reason] += n
+			}
+		}
+	}
+	merged.Owners = sortedTeams(teams)
+	if merged.Budget != nil {
+		merged.Budget.measure()
+	}
+	if merged.Filter != nil {
+		// Filtered shards may have left out crashed results
+		merged.CrashBuckets = mergeCrashBuckets(sorted)
+	} else {
+		merged.CrashBuckets = bucketCrashes(merged.Results)
+	}
+	return merged, nil
+}
+
+// mergeCrashBuckets adds up the crash buckets of the shards
+func mergeCrashBuckets(reports []FuzzingReport) []CrashBucket {
+	index := make(map[string]int)
+	var buckets []CrashBucket
+	for _, report := range reports {
+		for _, bucket := range report.CrashBuckets {
+			i, ok := index[bucket.Signature]
+			if !ok {
+				index[bucket.Signature] = len(buckets)
+				bucket.Files = append([]string(nil), bucket.Files...)
+				buckets = append(buckets, bucket)
+				continue
+			}
+			buckets[i].Count += bucket.Count
+			for _, file := range bucket.Files {
+				if len(buckets[i].Files) < crashBucketExamples {
+					buckets[i].Files = append(buckets[i].Files, file)
+				}
+			}
+		}
+	}
+	sort.SliceStable(buckets, func(i, j int) bool { return buckets[i].Count > buckets[j].Count })
+	return buckets
+}
+
+// runMergeCommand merges the reports of a sharded campaign into one
+func runMergeCommand(args []string) int {
+	flags := flag.NewFlagSet("merge-reports", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	outputPath := flags.String("output", "", "write the merged report to this file, compressed when it ends in .gz or .zst")
+	flags.StringVar(outputPath, "o", "", "shorthand for --output")
+
+	if err := flags.Parse(args); err != nil || flags.NArg() == 0 {
+		emitError(map[string]string{
+			"error": "usage: wasm-fuzzer merge-reports [-o|--output report.json[.gz|.zst]] <shard-report.json>...",
+		})
+		return 1
+	}
+
+	reports := make([]FuzzingReport, 0, flags.NArg())
+	for _, path := range flags.Args() {
+		report, err := loadReport(path)
+		if err != nil {
+			emitError(map[string]string{
+				"error":   "report load failed",
+				"path":    path,
+				"details": err.Error(),
+			})
+			return 1
+		}
+		reports = append(reports, report)
+	}
+
+	merged, err := mergeReports(reports)
+	if err != nil {
+		emitError(map[string]string{
+			"error":   "report merge failed",
+			"details": err.Error(),
+		})
+		return 1
+	}
+	if err := writeReport(*outputPath, merged); err != nil {
+		emitError(map[string]string{
+			"error":   "failed to write report",
+			"details": err.Error(),
+		})
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,99 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// -----------------------------------------------------------------------------
+// TEST: Sharding
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// A campaign split across CI jobs must run every file exactly once, and
+// merging the shard reports must give the report a single job would have
+// written, or the split silently loses or double-counts results.
+// -----------------------------------------------------------------------------
+
+func TestShard_PartitionsAndMerges(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 12; i++ {
+		data := []byte{byte(i)}
+		if i%3 == 0 {
+			data = []byte("fail")
+		}
+		require.NoError(t, os.WriteFile(filepath.Join(dir, fmt.Sprintf("%02d.wasm", i)), data, 0o644))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, expectationsFile), []byte("- {file: '*', outcome: validate-fail}\n"), 0o644))
+	runtime := &MockWasmRuntime{LoadModuleFunc: func(filePath string) (WasmModule, error) {
+		if data, _ := os.ReadFile(filePath); string(data) == "fail" {
+			return nil, &RuntimeError{Stage: StageValidate, Message: "bad module"}
+		}
+		return &MockWasmModule{}, nil
+	}}
+	envs := []environmentRuntime{
+		{Environment: Environment{Name: "a"}, Runtime: runtime},
+		{Environment: Environment{Name: "b"}, Runtime: runtime},
+	}
+
+	whole, err := runFuzzerWithMatrix(dir, envs, RunOptions{})
+	require.NoError(t, err)
+
+	var shards []FuzzingReport
+	var ran []string
+	for index := 2; index >= 0; index-- {
+		opts := RunOptions{Corpus: CorpusConfig{ShardIndex: index, ShardCount: 3}}
+		shard, err := runFuzzerWithMatrix(dir, envs, opts)
+		require.NoError(t, err)
+		assert.Equal(t, &ShardInfo{Index: index, Count: 3}, shard.Shard)
+		assert.Empty(t, validateReport(shard))
+		for _, result := range shard.Results {
+			ran = append(ran, result.FileName+"/"+result.Environment)
+		}
+		shards = append(shards, shard)
+	}
+	var all []string
+	for _, result := range whole.Results {
+		all = append(all, result.FileName+"/"+result.Environment)
+	}
+	sort.Strings(ran)
+	assert.Equal(t, all, ran, "every file runs in exactly one shard")
+
+	merged, err := mergeReports(shards)
+	require.NoError(t, err)
+	assert.Empty(t, validateReport(merged))
+	assert.Equal(t, whole.TotalFiles, merged.TotalFiles)
+	assert.Equal(t, whole.Passed, merged.Passed)
+	assert.Equal(t, whole.FailureCounts, merged.FailureCounts)
+	assert.Equal(t, whole.Environments, merged.Environments)
+	assert.Equal(t, whole.Expectations.Met, merged.Expectations.Met)
+	assert.Len(t, merged.Expectations.Failures, len(whole.Expectations.Failures))
+	assert.Nil(t, merged.Shard)
+}
+
+func TestShard_RejectsIncompleteSets(t *testing.T) {
+	shard := func(index, count int) FuzzingReport {
+		return FuzzingReport{Shard: &ShardInfo{Index: index, Count: count}}
+	}
+
+	_, err := mergeReports([]FuzzingReport{shard(0, 2)})
+	assert.EqualError(t, err, "shard 1 of 2 is missing")
+	_, err = mergeReports([]FuzzingReport{shard(0, 2), shard(0, 2)})
+	assert.EqualError(t, err, "shard 0 is given twice")
+	_, err = mergeReports([]FuzzingReport{shard(0, 2), shard(1, 3)})
+	assert.EqualError(t, err, "report 1 is a shard of 3, not of 2")
+	_, err = mergeReports([]FuzzingReport{shard(0, 1), {}})
+	assert.EqualError(t, err, "report 1 is not the report of a shard")
+
+	_, err = CorpusConfig{ShardIndex: 3, ShardCount: 3}.shard()
+	assert.EqualError(t, err, "shard index 3 is not in [0, 3)")
+}
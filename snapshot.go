@@ -0,0 +1,100 @@
+package main
+
+// wasmPageSize is the size of a WASM linear memory page in bytes
+const wasmPageSize = 65536
+
+// ModuleSnapshot captures the mutable state of an instantiated module.
+// Only exported memories and exported mutable globals are reachable through
+// the runtime API, so internal state is not captured.
+type ModuleSnapshot struct {
+	Memories map[string][]byte
+	Globals  map[string]interface{}
+}
+
+// StatefulModule is implemented by modules whose state can be captured after
+// a setup call and restored before each invocation
+type StatefulModule interface {
+	WasmModule
+	// Snapshot captures exported memories and mutable globals
+	Snapshot() (*ModuleSnapshot, error)
+	// Restore resets exported memories and mutable globals to a snapshot
+	Restore(snapshot *ModuleSnapshot) error
+}
+
+// InvocationConfig describes which exports are called for each file
+type InvocationConfig struct {
+	// Setup is an optional export called once after instantiation
+	Setup string `yaml:"setup"`
+	// Entry is the export under test (default "process")
+	Entry string `yaml:"entry"`
+	// Inputs are the argument lists the entry is invoked with, one call each
+	Inputs []InvocationInput `yaml:"inputs"`
+	// Buffers configures how string, bytes and file inputs are passed
+	Buffers MemoryConfig `yaml:"buffers"`
+	// WIT is a WIT file declaring the entry's interface types; a .wit file
+	// next to the module is used when unset
+	WIT string `yaml:"wit"`
+	// Annotations is a file declaring the domains of the arguments of
+	// fuzzed functions; a .args.yaml file next to the module is used when
+	// unset
+	Annotations string `yaml:"annotations"`
+	// ABI selects how the entry receives its input: empty for plain
+	// arguments, "extism" for Extism plugin functions, "proxy-wasm" for
+	// HTTP filters, which are driven through their callbacks instead,
+	// "cosmwasm" and "near" for smart contracts, or "go" for Go and TinyGo
+	// programs
+	ABI string `yaml:"abi"`
+	// Extism configures the host of Extism plugins
+	Extism ExtismConfig `yaml:"extism"`
+	// ProxyWasm configures the host of proxy-wasm filters
+	ProxyWasm ProxyWasmConfig `yaml:"proxy_wasm"`
+	// Contract configures the chain smart contracts run against
+	Contract ContractConfig `yaml:"contract"`
+	// Log configures the host's log import, and the faults injected into it
+	Log LogConfig `yaml:"log"`
+	// Proxies record, alter or drop the calls to host functions
+	Proxies []ImportProxy `yaml:"proxies"`
+	// Start is "skip" or "isolate" to keep the module's start function
+	// from failing its instantiation; by default it runs as usual
+	Start string `yaml:"start"`
+	// Snapshot restores the post-setup state before every invocation;
+	// without it, state accumulates across invocations
+	Snapshot bool `yaml:"snapshot"`
+
+	// function is the entry's WIT declaration, when one was found
+	function *witFunction
+	// domains constrain the entry's fuzzed arguments, when annotated
+	domains []argDomain
+	// extism tracks the kernel of a loaded Extism plugin
+	extism *extismHost
+	// proxyWasm tracks the kernel of a loaded proxy-wasm filter
+	proxyWasm *proxyWasmHost
+	// contract tracks the kernel and storage of a loaded smart contract
+	contract *contractHost
+	// golang tracks the kernel of a loaded Go program
+	golang *goHost
+}
+
+// withDefaults fills in the entry function and input used by a plain run
+func (c InvocationConfig) withDefaults() InvocationConfig {
+	if c.Entry == "" && c.ABI == ABICosmWasm {
+		c.Entry = "execute"
+	} else if c.Entry == "" {
+		c.Entry = "process"
+	}
+	if len(c.Inputs) == 0 && c.ABI == ABIExtism {
+		c.Inputs = []InvocationInput{{{Type: "string", Value: ""}}}
+	} else if len(c.Inputs) == 0 && c.ABI == ABIProxyWasm {
+		c.Inputs = []InvocationInput{{{Type: "string", Value: defaultProxyRequest}}}
+	} else if _, ok := contractPlatforms[c.ABI]; ok && len(c.Inputs) == 0 {
+		c.Inputs = []InvocationInput{{{Type: "string", Value: defaultContractMessage}}}
+	} else if len(c.Inputs) == 0 {
+		c.Inputs = []InvocationInput{i32Input(1)}
+	}
+	return c
+}
+
+// recordsInvocations reports whether results should list each invocation
+func (c InvocationConfig) recordsInvocations() bool {
+	return c.Setup != "" || len(c.Inputs) > 1
+}
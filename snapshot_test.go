@@ -0,0 +1,180 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// -----------------------------------------------------------------------------
+// Stateful Mock Module
+// -----------------------------------------------------------------------------
+
+// counterModule accumulates its inputs in a single piece of state:
+// init sets the counter to 10, process adds its argument and returns it
+type counterModule struct {
+	MockWasmModule
+	counter int32
+}
+
+func newCounterModule() *counterModule {
+	m := &counterModule{}
+	m.ExecuteFunc = func(funcName string, args ...interface{}) ([]interface{}, error) {
+		switch funcName {
+		case "init":
+			m.counter = 10
+			return nil, nil
+		case "process":
+			input := args[0].(int32)
+			if input < 0 {
+				return nil, errors.New("unreachable executed")
+			}
+			m.counter += input
+			return []interface{}{m.counter}, nil
+		}
+		return nil, &RuntimeError{Stage: StageExecute, Message: "function '" + funcName + "' not found in module exports"}
+	}
+	return m
+}
+
+// statefulCounterModule adds snapshot support to counterModule
+type statefulCounterModule struct {
+	*counterModule
+	restores int
+}
+
+func (m *statefulCounterModule) Snapshot() (*ModuleSnapshot, error) {
+	return &ModuleSnapshot{Globals: map[string]interface{}{"counter": m.counter}}, nil
+}
+
+func (m *statefulCounterModule) Restore(snapshot *ModuleSnapshot) error {
+	m.restores++
+	m.counter = snapshot.Globals["counter"].(int32)
+	return nil
+}
+
+// i32Inputs builds one single-argument input per value
+func i32Inputs(values ...int32) []InvocationInput {
+	inputs := make([]InvocationInput, len(values))
+	for i, v := range values {
+		inputs[i] = i32Input(v)
+	}
+	return inputs
+}
+
+func invocationReturns(result ExecutionResult) []interface{} {
+	var returns []interface{}
+	for _, invocation := range result.Invocations {
+		returns = append(returns, invocation.ReturnValues...)
+	}
+	return returns
+}
+
+// -----------------------------------------------------------------------------
+// TEST: Snapshot and Restore Between Invocations
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Modules with expensive initialization are only practical to fuzz if the
+// post-setup state can be reused. Every invocation must observe exactly
+// that state, otherwise results depend on invocation order.
+// -----------------------------------------------------------------------------
+
+func TestSnapshot_RestoresBeforeEachInvocation(t *testing.T) {
+	module := &statefulCounterModule{counterModule: newCounterModule()}
+	loads := 0
+	mockRuntime := &MockWasmRuntime{
+		LoadModuleFunc: func(filePath string) (WasmModule, error) {
+			loads++
+			return module, nil
+		},
+	}
+
+	opts := RunOptions{Invocation: InvocationConfig{Setup: "init", Inputs: i32Inputs(1, 2, 3), Snapshot: true}}
+	result := processWasmFileWithOptions("/test/stateful.wasm", mockRuntime, opts)
+
+	require.True(t, result.Success, result.ErrorMessage)
+	assert.Equal(t, []interface{}{int32(11), int32(12), int32(13)}, invocationReturns(result))
+	assert.Equal(t, 1, loads, "snapshot-capable modules should be loaded once")
+	assert.Equal(t, 2, module.restores)
+	assert.Equal(t, []interface{}{int32(11)}, result.ReturnValues, "top level mirrors the first invocation")
+}
+
+func TestSnapshot_StateAccumulatesWithoutSnapshot(t *testing.T) {
+	module := newCounterModule()
+	mockRuntime := &MockWasmRuntime{
+		LoadModuleFunc: func(filePath string) (WasmModule, error) {
+			return module, nil
+		},
+	}
+
+	opts := RunOptions{Invocation: InvocationConfig{Setup: "init", Inputs: i32Inputs(1, 2, 3)}}
+	result := processWasmFileWithOptions("/test/stateful.wasm", mockRuntime, opts)
+
+	require.True(t, result.Success, result.ErrorMessage)
+	assert.Equal(t, []interface{}{int32(11), int32(13), int32(16)}, invocationReturns(result))
+}
+
+func TestSnapshot_ReloadsModulesWithoutSnapshotSupport(t *testing.T) {
+	var modules []*counterModule
+	mockRuntime := &MockWasmRuntime{
+		LoadModuleFunc: func(filePath string) (WasmModule, error) {
+			module := newCounterModule()
+			modules = append(modules, module)
+			return module, nil
+		},
+	}
+
+	opts := RunOptions{Invocation: InvocationConfig{Setup: "init", Inputs: i32Inputs(1, 2, 3), Snapshot: true}}
+	result := processWasmFileWithOptions("/test/stateless.wasm", mockRuntime, opts)
+
+	require.True(t, result.Success, result.ErrorMessage)
+	assert.Equal(t, []interface{}{int32(11), int32(12), int32(13)}, invocationReturns(result))
+	require.Len(t, modules, 3, "each invocation should start from a fresh module")
+	for _, module := range modules {
+		assert.True(t, module.CloseCalled, "replaced modules must be closed")
+	}
+}
+
+func TestSnapshot_SetupFailure(t *testing.T) {
+	module := newCounterModule()
+	mockRuntime := &MockWasmRuntime{
+		LoadModuleFunc: func(filePath string) (WasmModule, error) {
+			return module, nil
+		},
+	}
+
+	opts := RunOptions{Invocation: InvocationConfig{Setup: "initialize", Inputs: i32Inputs(1, 2), Snapshot: true}}
+	result := processWasmFileWithOptions("/test/no_setup.wasm", mockRuntime, opts)
+
+	assert.False(t, result.Success)
+	assert.Equal(t, StageExecute, result.FailureStage)
+	assert.Contains(t, result.ErrorMessage, "setup 'initialize' failed")
+	assert.True(t, module.CloseCalled, "module must be closed after setup failure")
+}
+
+func TestSnapshot_TrapDoesNotStopLaterInvocations(t *testing.T) {
+	module := &statefulCounterModule{counterModule: newCounterModule()}
+	mockRuntime := &MockWasmRuntime{
+		LoadModuleFunc: func(filePath string) (WasmModule, error) {
+			return module, nil
+		},
+	}
+
+	opts := RunOptions{Invocation: InvocationConfig{Setup: "init", Inputs: i32Inputs(1, -1, 3), Snapshot: true}}
+	result := processWasmFileWithOptions("/test/trap.wasm", mockRuntime, opts)
+
+	assert.False(t, result.Success)
+	assert.Equal(t, StageExecute, result.FailureStage)
+	assert.Equal(t, "invocation 1: execution failed: unreachable executed", result.ErrorMessage)
+	require.Len(t, result.Invocations, 3)
+	assert.True(t, result.Invocations[0].Success)
+	assert.False(t, result.Invocations[1].Success)
+	assert.Equal(t, []interface{}{int32(13)}, result.Invocations[2].ReturnValues)
+	assert.Equal(t, []WasmValue{{Type: "i32", Value: "-1"}}, result.Invocations[1].Args)
+}
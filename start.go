@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/mrhapile/WASM-Injection-Framework/internal/wasmbin"
+)
+
+// Start function modes. By default a module's start function runs during
+// instantiation, as the specification requires, and a trap fails the file
+// at the instantiate stage.
+const (
+	// StartSkip removes the start function, which then never runs
+	StartSkip = "skip"
+	// StartIsolate runs the start function as an ordinary call after
+	// instantiation, so its trap is recorded but does not fail the file
+	StartIsolate = "isolate"
+)
+
+// startExport is the name the start function is exported under once the
+// start section has been removed
+const startExport = "__wasm_fuzzer_start"
+
+// isolateStart removes the module's start section and exports the start
+// function instead. It reports false for modules without a start function.
+func isolateStart(data []byte) ([]byte, bool, error) {
+	binary, err := parseWasmBinary(data)
+	if err != nil {
+		return nil, false, err
+	}
+	start := binary.section(sectionStart)
+	if start == nil {
+		return data, false, nil
+	}
+	function, err := (&wasmbin.Reader{Data: start.Payload}).U32()
+	if err != nil {
+		return nil, false, fmt.Errorf("start section: %w", err)
+	}
+
+	sections := binary.Sections[:0]
+	for _, section := range binary.Sections {
+		if section.ID != sectionStart {
+			sections = append(sections, section)
+		}
+	}
+	binary.Sections = sections
+	export := wasmbin.AppendU32(append(wasmbin.AppendName(nil, startExport), externFunc), function)
+	if _, err := binary.ensureSection(sectionExport).appendVectorEntry(export); err != nil {
+		return nil, false, err
+	}
+	return binary.encode(), true, nil
+}
+
+// startRuntime keeps a module's start function from failing its
+// instantiation. The first failure of the start function is recorded:
+// in isolate mode it is the failure of the call made after each load, in
+// skip mode that of a probe instance the start function is called on once.
+type startRuntime struct {
+	runtime WasmRuntime
+	mode    string
+	probed  bool
+	// failure is the error message of the start function, if it failed
+	failure string
+}
+
+// LoadModule implements WasmRuntime.LoadModule
+func (r *startRuntime) LoadModule(filePath string) (WasmModule, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return r.runtime.LoadModule(filePath)
+	}
+	return r.load(filePath, nil, data)
+}
+
+// LoadModuleBytes implements BufferLoader.LoadModuleBytes
+func (r *startRuntime) LoadModuleBytes(name string, data []byte) (WasmModule, error) {
+	return r.load(name, data, data)
+}
+
+func (r *startRuntime) load(filePath string, source, data []byte) (WasmModule, error) {
+	if r.mode != StartSkip && r.mode != StartIsolate {
+		return nil, &RuntimeError{Stage: StageLoad, Message: fmt.Sprintf("unknown start mode %q", r.mode)}
+	}
+	rewritten, isolated, err := isolateStart(data)
+	if err != nil || !isolated {
+		// Unparseable modules are left for the runtime to reject
+		if source != nil {
+			return (&bufferRuntime{runtime: r.runtime, data: source}).LoadModule(filePath)
+		}
+		return r.runtime.LoadModule(filePath)
+	}
+	load := func() (WasmModule, error) {
+		return (&bufferRuntime{runtime: r.runtime, data: rewritten}).LoadModule(filePath)
+	}
+
+	if r.mode == StartSkip {
+		if !r.probed {
+			r.probed = true
+			if probe, err := load(); err == nil {
+				r.start(probe)
+				probe.Close()
+			}
+		}
+		return load()
+	}
+
+	module, err := load()
+	if err != nil {
+		return nil, err
+	}
+	r.start(module)
+	return module, nil
+}
+
+// start calls the start function, recording its first failure
+func (r *startRuntime) start(module WasmModule) {
+	_, err := module.Execute(startExport)
+	if err != nil && r.failure == "" {
+		_, r.failure = classifyError(err, StageExecute, "execution failed")
+	}
+}
@@ -0,0 +1,110 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mrhapile/WASM-Injection-Framework/internal/wasmbin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startBinary is a plugin binary whose "run" function is also its start
+// function
+func startBinary(t *testing.T) []byte {
+	binary, err := parseWasmBinary(pluginBinary())
+	require.NoError(t, err)
+	binary.ensureSection(sectionStart).Payload = wasmbin.AppendU32(nil, 0)
+	return binary.encode()
+}
+
+// startMockRuntime fails to instantiate modules that still have a start
+// section, as a runtime does when the start function traps, and counts
+// the calls made to the exported start function
+type startMockRuntime struct {
+	starts int
+}
+
+func (r *startMockRuntime) LoadModule(filePath string) (WasmModule, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	binary, err := parseWasmBinary(data)
+	if err != nil {
+		return nil, err
+	}
+	if binary.section(sectionStart) != nil {
+		return nil, &RuntimeError{Stage: StageInstantiate, Message: "instantiation failed: unreachable"}
+	}
+	return &MockWasmModule{ExecuteFunc: func(funcName string, args ...interface{}) ([]interface{}, error) {
+		if funcName == startExport {
+			r.starts++
+			return nil, errors.New("unreachable")
+		}
+		return []interface{}{int32(r.starts)}, nil
+	}}, nil
+}
+
+// -----------------------------------------------------------------------------
+// TEST: Start Function Isolation
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// A start function that traps fails instantiation, hiding every other
+// function of the module from the fuzzer. Taking it out of instantiation
+// lets the rest of the module run, while its trap is still reported.
+// -----------------------------------------------------------------------------
+
+func TestStart_IsolateRewritesStartSection(t *testing.T) {
+	rewritten, isolated, err := isolateStart(startBinary(t))
+	require.NoError(t, err)
+	assert.True(t, isolated)
+
+	binary, err := parseWasmBinary(rewritten)
+	require.NoError(t, err)
+	assert.Nil(t, binary.section(sectionStart))
+	exports, err := binary.functionExports()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]uint32{"run": 0, startExport: 0}, exports)
+
+	plain := pluginBinary()
+	unchanged, isolated, err := isolateStart(plain)
+	require.NoError(t, err)
+	assert.False(t, isolated)
+	assert.Equal(t, plain, unchanged)
+}
+
+func TestStart_Modes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "start.wasm")
+	require.NoError(t, os.WriteFile(path, startBinary(t), 0o644))
+	run := func(mode string) (ExecutionResult, *startMockRuntime) {
+		runtime := &startMockRuntime{}
+		plan := InvocationConfig{Entry: "run", Start: mode, Inputs: []InvocationInput{{}, {}}, Snapshot: true}
+		return processWasmFileWithOptions(path, runtime, RunOptions{Invocation: plan}), runtime
+	}
+
+	result, _ := run("")
+	assert.Equal(t, StageInstantiate, result.FailureStage, "by default the start function fails instantiation")
+	assert.Empty(t, result.StartFailure)
+
+	result, runtime := run(StartIsolate)
+	assert.True(t, result.Success, result.ErrorMessage)
+	assert.Equal(t, "execution failed: unreachable", result.StartFailure)
+	assert.Equal(t, 2, runtime.starts, "the start function runs on every fresh instance")
+	assert.Equal(t, []interface{}{int32(1)}, result.Invocations[0].ReturnValues)
+
+	result, runtime = run(StartSkip)
+	assert.True(t, result.Success, result.ErrorMessage)
+	assert.Equal(t, "execution failed: unreachable", result.StartFailure, "the start function is probed once")
+	assert.Equal(t, 1, runtime.starts)
+
+	result, _ = run("never")
+	assert.Equal(t, StageLoad, result.FailureStage)
+	assert.Equal(t, `unknown start mode "never"`, result.ErrorMessage)
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/mrhapile/WASM-Injection-Framework/internal/wasmbin"
+)
+
+// statsSizeBuckets are the upper bounds of the size histogram, in bytes
+var statsSizeBuckets = []int64{1 << 10, 1 << 12, 1 << 14, 1 << 16, 1 << 18, 1 << 20, 1 << 22, 1 << 24}
+
+// CorpusStats summarizes a corpus from its binaries, without running them
+type CorpusStats struct {
+	TotalFiles int `json:"total_files"`
+	// Undecodable counts files that are not module binaries
+	Undecodable int       `json:"undecodable"`
+	Sizes       SizeStats `json:"sizes"`
+	// Features counts the modules using each proposal. Modules whose
+	// code cannot be decoded are counted in FeaturesUndetected instead.
+	Features           map[string]int `json:"features"`
+	FeaturesUndetected int            `json:"features_undetected"`
+	// Imports lists the imported functions, most widely imported first
+	Imports []ImportStat `json:"imports"`
+	// Producers counts the tools named in producers sections, "unknown"
+	// standing for modules without one; Languages the source languages
+	Producers map[string]int `json:"producers"`
+	Languages map[string]int `json:"languages"`
+}
+
+// SizeStats is the distribution of file sizes
+type SizeStats struct {
+	TotalBytes  int64        `json:"total_bytes"`
+	MinBytes    int64        `json:"min_bytes"`
+	MaxBytes    int64        `json:"max_bytes"`
+	MedianBytes int64        `json:"median_bytes"`
+	Histogram   []SizeBucket `json:"histogram"`
+}
+
+// SizeBucket counts the files in one size range
+type SizeBucket struct {
+	Range string `json:"range"`
+	Files int    `json:"files"`
+}
+
+// ImportStat counts the modules importing a function
+type ImportStat struct {
+	Module  string `json:"module"`
+	Name    string `json:"name"`
+	Modules int    `json:"modules"`
+}
+
+// collectCorpusStats reads every file and summarizes the corpus
+func collectCorpusStats(files []string) CorpusStats {
+	stats := CorpusStats{
+		Features:  make(map[string]int),
+		Producers: make(map[string]int),
+		Languages: make(map[string]int),
+	}
+	var sizes []int64
+	imports := make(map[ImportStat]int)
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		stats.TotalFiles++
+		sizes = append(sizes, int64(len(data)))
+
+		binary, err := parseWasmBinary(data)
+		if err != nil {
+			stats.Undecodable++
+			continue
+		}
+		if features, err := detectFeatures(data); err == nil {
+			for name := range features {
+				stats.Features[name]++
+			}
+		} else {
+			stats.FeaturesUndetected++
+		}
+		functions, _ := binary.functionImports()
+		for _, imp := range uniqueImports(functions) {
+			imports[ImportStat{Module: imp.Module, Name: imp.Name}]++
+		}
+
+		tools, languages := binary.producers()
+		if len(tools) == 0 {
+			stats.Producers["unknown"]++
+		}
+		for _, tool := range tools {
+			stats.Producers[tool]++
+		}
+		for _, language := range languages {
+			stats.Languages[language]++
+		}
+	}
+
+	stats.Sizes = summarizeSizes(sizes)
+	stats.Imports = make([]ImportStat, 0, len(imports))
+	for imp, n := range imports {
+		stats.Imports = append(stats.Imports, ImportStat{Module: imp.Module, Name: imp.Name, Modules: n})
+	}
+	sort.Slice(stats.Imports, func(i, j int) bool {
+		a, b := stats.Imports[i], stats.Imports[j]
+		if a.Modules != b.Modules {
+			return a.Modules > b.Modules
+		}
+		if a.Module != b.Module {
+			return a.Module < b.Module
+		}
+		return a.Name < b.Name
+	})
+	return stats
+}
+
+// summarizeSizes computes the size distribution of the given file sizes
+func summarizeSizes(sizes []int64) SizeStats {
+	var summary SizeStats
+	counts := make([]int, len(statsSizeBuckets)+1)
+	sort.Slice(sizes, func(i, j int) bool { return sizes[i] < sizes[j] })
+	for _, size := range sizes {
+		summary.TotalBytes += size
+		bucket := sort.Search(len(statsSizeBuckets), func(i int) bool { return size <= statsSizeBuckets[i] })
+		counts[bucket]++
+	}
+	if len(sizes) > 0 {
+		summary.MinBytes = sizes[0]
+		summary.MaxBytes = sizes[len(sizes)-1]
+		summary.MedianBytes = sizes[len(sizes)/2]
+	}
+
+	for i, n := range counts {
+		if i < len(statsSizeBuckets) {
+			summary.Histogram = append(summary.Histogram, SizeBucket{Range: "<=" + formatBytes(statsSizeBuckets[i]), Files: n})
+		} else {
+			summary.Histogram = append(summary.Histogram, SizeBucket{Range: ">" + formatBytes(statsSizeBuckets[i-1]), Files: n})
+		}
+	}
+	return summary
+}
+
+// formatBytes formats a power-of-two size with a binary unit
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<20 && n%(1<<20) == 0:
+		return fmt.Sprintf("%dMiB", n>>20)
+	case n >= 1<<10 && n%(1<<10) == 0:
+		return fmt.Sprintf("%dKiB", n>>10)
+	}
+	return fmt.Sprintf("%dB", n)
+}
+
+// producers reads the tool-conventions producers section: the tools that
+// processed the module, as "name version", and its source languages
+func (m *wasmBinary) producers() (tools, languages []string) {
+	for _, entry := range m.producerEntries() {
+		switch entry.Field {
+		case "processed-by":
+			tools = append(tools, strings.TrimSpace(entry.Name+" "+entry.Version))
+		case "language":
+			languages = append(languages, entry.Name)
+		}
+	}
+	return tools, languages
+}
+
+// producerEntry is one value of a producers section field, such as the
+// language or a tool that processed the module
+type producerEntry struct {
+	Field   string
+	Name    string
+	Version string
+}
+
+// producerEntries reads the tool-conventions producers section, keeping
+// the entries read before any malformed one
+func (m *wasmBinary) producerEntries() []producerEntry {
+	for _, section := range m.Sections {
+		if section.ID != sectionCustom {
+			continue
+		}
+		r := &wasmbin.Reader{Data: section.Payload}
+		if name, err := r.Name(); err != nil || name != "producers" {
+			continue
+		}
+		fields, err := r.U32()
+		if err != nil {
+			return nil
+		}
+		var entries []producerEntry
+		for i := uint32(0); i < fields; i++ {
+			field, err := r.Name()
+			if err != nil {
+				return entries
+			}
+			values, err := r.U32()
+			if err != nil {
+				return entries
+			}
+			for j := uint32(0); j < values; j++ {
+				name, err := r.Name()
+				if err != nil {
+					return entries
+				}
+				version, err := r.Name()
+				if err != nil {
+					return entries
+				}
+				entries = append(entries, producerEntry{Field: field, Name: name, Version: version})
+			}
+		}
+		return entries
+	}
+	return nil
+}
+
+// runStatsCommand prints statistics about a corpus without executing any
+// of it, for planning campaigns
+func runStatsCommand(args []string) int {
+	flags := flag.NewFlagSet("stats", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		emitError(map[string]string{
+			"error": "usage: wasm-fuzzer stats <directory>",
+		})
+		return 1
+	}
+
+	files, err := collectWasmFiles(flags.Arg(0))
+	if err != nil {
+		emitError(map[string]string{
+			"error":   "directory access failed",
+			"details": err.Error(),
+		})
+		return 1
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(collectCorpusStats(files)); err != nil {
+		emitError(map[string]string{
+			"error":   "failed to encode JSON output",
+			"details": err.Error(),
+		})
+		return 1
+	}
+	return 0
+}
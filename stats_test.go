@@ -0,0 +1,101 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mrhapile/WASM-Injection-Framework/internal/wasmbin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withProducers appends a producers section naming the given language and
+// tool to a test module
+func withProducers(t *testing.T, data []byte, language, tool, version string) []byte {
+	module, err := parseWasmBinary(data)
+	require.NoError(t, err)
+	payload := wasmbin.AppendName(nil, "producers")
+	payload = wasmbin.AppendName(append(payload, 0x02), "language")
+	payload = wasmbin.AppendName(wasmbin.AppendName(append(payload, 0x01), language), "")
+	payload = wasmbin.AppendName(payload, "processed-by")
+	payload = wasmbin.AppendName(wasmbin.AppendName(append(payload, 0x01), tool), version)
+	module.Sections = append(module.Sections, wasmSection{ID: sectionCustom, Payload: payload})
+	return module.encode()
+}
+
+// -----------------------------------------------------------------------------
+// TEST: Corpus Statistics
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Planning a campaign needs to know what a corpus is made of: which
+// proposals the runtime must enable, which host functions must be
+// provided and which toolchains produced it. Reading this from the
+// binaries must never require running them.
+// -----------------------------------------------------------------------------
+
+func TestFeatures_Detection(t *testing.T) {
+	detect := func(data []byte) []string {
+		features, err := detectFeatures(data)
+		require.NoError(t, err)
+		return features.sorted()
+	}
+
+	assert.Empty(t, detect(buildTestModule([]byte{0x20, 0x00, 0x0b}, true)), "MVP modules use no proposal")
+	assert.Equal(t, []string{"sign-extension-operators"}, detect(buildTestModule([]byte{0x20, 0x00, 0xc0, 0x0b}, false)))
+	// i32x4.splat, then i32x4.extract_lane 0
+	assert.Equal(t, []string{"simd"}, detect(buildTestModule([]byte{0x20, 0x00, 0xfd, 0x11, 0xfd, 0x1b, 0x00, 0x0b}, false)))
+	// memory.fill of zero bytes, and a saturating truncation
+	fill := []byte{0x41, 0x00, 0x41, 0x00, 0x41, 0x00, 0xfc, 0x0b, 0x00, 0x43, 0, 0, 0, 0, 0xfc, 0x00, 0x0b}
+	assert.Equal(t, []string{"bulk-memory-operations", "non-trap-float-to-int-conversions"}, detect(buildTestModule(fill, true)))
+
+	shared, err := parseWasmBinary(buildTestModule([]byte{0x20, 0x00, 0x0b}, true))
+	require.NoError(t, err)
+	shared.section(sectionMemory).Payload = []byte{0x01, 0x03, 0x01, 0x01}
+	shared.Sections = append(shared.Sections, wasmSection{ID: sectionGlobal, Payload: []byte{0x01, 0x7f, 0x01, opI32Const, 0x00, opEnd}})
+	exports := shared.section(sectionExport)
+	_, err = exports.appendVectorEntry(append(wasmbin.AppendName(nil, "counter"), externGlobal, 0x00))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"import-export-mut-globals", "threads"}, detect(shared.encode()))
+
+	multi := pluginBinary(wasmFuncImport{Module: "env", Name: "pair", Signature: funcSig("", "i32 i32")})
+	assert.Equal(t, []string{"multi-value"}, detect(multi))
+}
+
+func TestStats_SummarizesCorpus(t *testing.T) {
+	dir := t.TempDir()
+	log := wasmFuncImport{Module: "env", Name: "log", Signature: funcSig("i32", "")}
+	exit := wasmFuncImport{Module: wasiModule, Name: "proc_exit", Signature: funcSig("i32", "")}
+	files := map[string][]byte{
+		"rust.wasm":  withProducers(t, pluginBinary(log, exit), "Rust", "rustc", "1.75.0"),
+		"plain.wasm": pluginBinary(log),
+		"big.wasm":   append(withProducers(t, pluginBinary(), "C", "clang", "17.0.0"), make([]byte, 5000)...),
+		"junk.wasm":  []byte("junk"),
+	}
+	for name, data := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0o644))
+	}
+	paths, err := collectWasmFiles(dir)
+	require.NoError(t, err)
+
+	stats := collectCorpusStats(paths)
+	assert.Equal(t, 4, stats.TotalFiles)
+	assert.Equal(t, 1, stats.Undecodable)
+	assert.Equal(t, int64(4), stats.Sizes.MinBytes)
+	assert.Equal(t, int64(len(files["big.wasm"])), stats.Sizes.MaxBytes)
+	assert.Equal(t, SizeBucket{Range: "<=1KiB", Files: 3}, stats.Sizes.Histogram[0])
+	assert.Equal(t, SizeBucket{Range: "<=16KiB", Files: 1}, stats.Sizes.Histogram[2])
+	assert.Equal(t, SizeBucket{Range: ">16MiB", Files: 0}, stats.Sizes.Histogram[len(stats.Sizes.Histogram)-1])
+
+	assert.Equal(t, []ImportStat{
+		{Module: "env", Name: "log", Modules: 2},
+		{Module: wasiModule, Name: "proc_exit", Modules: 1},
+	}, stats.Imports)
+	assert.Equal(t, map[string]int{"rustc 1.75.0": 1, "clang 17.0.0": 1, "unknown": 1}, stats.Producers)
+	assert.Equal(t, map[string]int{"Rust": 1, "C": 1}, stats.Languages)
+	assert.Empty(t, stats.Features)
+}
@@ -0,0 +1,41 @@
+package main
+
+import "fmt"
+
+// StageChecker is implemented by runtimes that can run the stages of
+// loading a module without instantiating it
+type StageChecker interface {
+	// CheckModule runs the load stage, then the validate stage when stage
+	// is StageValidate, and releases everything it allocated
+	CheckModule(filePath string, stage FailureStage) error
+}
+
+// checkStopAfter rejects stages a campaign cannot stop after. Stopping
+// after execute, or not at all, runs the whole pipeline.
+func checkStopAfter(stage FailureStage) error {
+	switch stage {
+	case "", StageLoad, StageValidate, StageInstantiate, StageExecute:
+		return nil
+	}
+	return fmt.Errorf("cannot stop after stage %q: use load, validate or instantiate", stage)
+}
+
+// runTruncated runs the stages of a file up to and including stage, which
+// is load, validate or instantiate. Instantiation links the module's host
+// functions and runs any start function or WASI lifecycle export, as a
+// full run does, but nothing is called after it.
+func runTruncated(filePath string, runtime WasmRuntime, stage FailureStage) error {
+	if stage == StageInstantiate {
+		module, err := runtime.LoadModule(filePath)
+		if err != nil {
+			return err
+		}
+		module.Close()
+		return nil
+	}
+	checker, ok := runtime.(StageChecker)
+	if !ok {
+		return &RuntimeError{Stage: StageLoad, Message: fmt.Sprintf("runtime cannot stop after %s", stage)}
+	}
+	return checker.CheckModule(filePath, stage)
+}
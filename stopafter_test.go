@@ -0,0 +1,89 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// checkingRuntime is a mock runtime that can stop after validation
+type checkingRuntime struct {
+	MockWasmRuntime
+	checked []FailureStage
+	err     error
+}
+
+func (r *checkingRuntime) CheckModule(filePath string, stage FailureStage) error {
+	r.checked = append(r.checked, stage)
+	return r.err
+}
+
+// -----------------------------------------------------------------------------
+// TEST: Stop After
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Sweeping millions of files for structural validity must never execute
+// them, and the report has to say the pipeline was cut short so a pass
+// is not mistaken for a module that ran cleanly.
+// -----------------------------------------------------------------------------
+
+func TestStopAfter_ValidateNeverInstantiates(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.wasm"), buildTestModule([]byte{0x20, 0x00, 0x0b}, true), 0o644))
+
+	runtime := &checkingRuntime{}
+	runtime.LoadModuleFunc = func(filePath string) (WasmModule, error) {
+		t.Fatal("validation must not instantiate")
+		return nil, nil
+	}
+	opts := RunOptions{StopAfter: StageValidate}
+	report, err := runFuzzerWithMatrix(dir, []environmentRuntime{{Runtime: runtime}}, opts)
+	require.NoError(t, err)
+	assert.Equal(t, []FailureStage{StageValidate}, runtime.checked)
+	assert.Equal(t, StageValidate, report.StopAfter)
+	assert.Equal(t, 1, report.Passed)
+	assert.Empty(t, report.Results[0].ReturnValues)
+
+	runtime.err = &RuntimeError{Stage: StageValidate, Message: "validation failed: type mismatch"}
+	report, err = runFuzzerWithMatrix(dir, []environmentRuntime{{Runtime: runtime}}, opts)
+	require.NoError(t, err)
+	assert.Equal(t, StageValidate, report.Results[0].FailureStage)
+	assert.Equal(t, 1, report.FailureCounts[StageValidate])
+}
+
+func TestStopAfter_InstantiateNeverExecutes(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.wasm"), buildTestModule([]byte{0x20, 0x00, 0x0b}, true), 0o644))
+
+	module := &MockWasmModule{ExecuteFunc: func(funcName string, args ...interface{}) ([]interface{}, error) {
+		t.Fatalf("%s must not be called", funcName)
+		return nil, nil
+	}}
+	runtime := &MockWasmRuntime{LoadModuleFunc: func(filePath string) (WasmModule, error) { return module, nil }}
+	opts := RunOptions{StopAfter: StageInstantiate, Invocation: InvocationConfig{Setup: "init"}}
+	report, err := runFuzzerWithMatrix(dir, []environmentRuntime{{Runtime: runtime}}, opts)
+	require.NoError(t, err)
+	assert.True(t, report.Results[0].Success)
+	assert.True(t, module.CloseCalled)
+	assert.Equal(t, StageInstantiate, report.StopAfter)
+}
+
+func TestStopAfter_RejectsOtherStages(t *testing.T) {
+	_, err := runFuzzerWithMatrix(t.TempDir(), nil, RunOptions{StopAfter: StageSignature})
+	assert.EqualError(t, err, `cannot stop after stage "signature": use load, validate or instantiate`)
+
+	result := processWasmFileWithOptions("a.wasm", &MockWasmRuntime{}, RunOptions{StopAfter: StageLoad})
+	assert.Equal(t, StageLoad, result.FailureStage)
+	assert.Equal(t, "runtime cannot stop after load", result.ErrorMessage)
+
+	report, err := runFuzzerWithMatrix(t.TempDir(), nil, RunOptions{StopAfter: StageExecute})
+	require.NoError(t, err)
+	assert.Empty(t, report.StopAfter, "stopping after execute runs the whole pipeline")
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+	goruntime "runtime"
+	"sync"
+	"time"
+)
+
+// ValidationSession loads and validates modules one after another, keeping
+// its runtime objects between them. A session is used by one goroutine.
+type ValidationSession interface {
+	// Validate runs the load and validate stages on a file
+	Validate(filePath string) error
+	Close()
+}
+
+// BatchValidator is implemented by runtimes that can keep their loader and
+// validator across files instead of creating them for each one
+type BatchValidator interface {
+	NewValidationSession() ValidationSession
+}
+
+// checkerSession validates each file through a runtime's StageChecker, for
+// runtimes without batch validation
+type checkerSession struct {
+	runtime WasmRuntime
+}
+
+func (s checkerSession) Validate(filePath string) error {
+	return runTruncated(filePath, s.runtime, StageValidate)
+}
+
+func (s checkerSession) Close() {}
+
+// newValidationSession returns a session validating with runtime
+func newValidationSession(runtime WasmRuntime) ValidationSession {
+	if batch, ok := runtime.(BatchValidator); ok {
+		return batch.NewValidationSession()
+	}
+	return checkerSession{runtime: runtime}
+}
+
+// SweepSummary records the throughput of a validation sweep
+type SweepSummary struct {
+	Workers       int     `json:"workers"`
+	ModulesPerSec float64 `json:"modules_per_sec"`
+}
+
+// runSweep checks the structural validity of every file under every
+// environment. Nothing is instantiated: each worker keeps one validation
+// session per environment for all the files it validates, and the files
+// are spread across workers.
+func runSweep(dirPath string, envs []environmentRuntime, opts RunOptions, workers int) (FuzzingReport, error) {
+	if workers < 1 {
+		return FuzzingReport{}, fmt.Errorf("workers must be at least 1, not %d", workers)
+	}
+	opts.StopAfter = StageValidate
+
+	var elapsed time.Duration
+	report, err := runCampaign(dirPath, envs, opts, func(jobs []campaignJob, results []ExecutionResult) {
+		started := time.Now()
+		queue := make(chan campaignJob)
+		var wg sync.WaitGroup
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				sessions := make([]ValidationSession, len(envs))
+				defer func() {
+					for _, session := range sessions {
+						if session != nil {
+							session.Close()
+						}
+					}
+				}()
+				for job := range queue {
+					if sessions[job.Env] == nil {
+						sessions[job.Env] = newValidationSession(envs[job.Env].Runtime)
+					}
+					results[job.Index] = sweepResult(job.FilePath, sessions[job.Env])
+				}
+			}()
+		}
+		for _, job := range jobs {
+			queue <- job
+		}
+		close(queue)
+		wg.Wait()
+		elapsed = time.Since(started)
+	})
+	if err != nil {
+		return report, err
+	}
+
+	report.Sweep = &SweepSummary{Workers: workers}
+	if validated := report.Passed + report.Failed; validated > 0 && elapsed > 0 {
+		report.Sweep.ModulesPerSec = float64(validated) / elapsed.Seconds()
+	}
+	return report, nil
+}
+
+// sweepResult validates one file. Sessions never panic on a module, but a
+// recovered panic is still reported rather than ending the sweep.
+func sweepResult(filePath string, session ValidationSession) (result ExecutionResult) {
+	result = ExecutionResult{
+		SchemaVersion: SchemaVersion,
+		FilePath:      filePath,
+		FileName:      filepath.Base(filePath),
+		FailureStage:  StageNone,
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			result.Success = false
+			result.FailureStage = StageValidate
+			result.ErrorMessage = fmt.Sprintf("panic recovered: %v", r)
+		}
+	}()
+
+	if err := session.Validate(filePath); err != nil {
+		result.FailureStage, result.ErrorMessage = classifyError(err, StageLoad, "load failed")
+		return result
+	}
+	result.Success = true
+	return result
+}
+
+// runSweepCommand runs a validation-only sweep over a corpus directory
+func runSweepCommand(args []string) int {
+	flags := flag.NewFlagSet("sweep", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	configPath := flags.String("config", "", "YAML campaign config")
+	workers := flags.Int("workers", goruntime.NumCPU(), "number of files validated in parallel")
+	applyCorpusFlags := addCorpusFlags(flags)
+
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		emitError(map[string]string{
+			"error": "usage: wasm-fuzzer sweep [--config file.yaml] [--workers n] [corpus flags] <directory>",
+		})
+		return 1
+	}
+	dirPath := flags.Arg(0)
+
+	config, envs, ok := prepareCampaign(dirPath, *configPath)
+	if !ok {
+		return 1
+	}
+	defer closeRuntimes(envs)
+	applyCorpusFlags(&config)
+
+	report, err := runSweep(dirPath, envs, config.runOptions(), *workers)
+	if err != nil {
+		emitError(map[string]string{
+			"error":   "sweep failed",
+			"details": err.Error(),
+		})
+		return 1
+	}
+	if err := outputJSON(report); err != nil {
+		emitError(map[string]string{
+			"error":   "failed to encode JSON output",
+			"details": err.Error(),
+		})
+		return 1
+	}
+	return 0
+}
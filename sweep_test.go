@@ -0,0 +1,109 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pooledRuntime is a mock batch validator counting the sessions it opens
+type pooledRuntime struct {
+	MockWasmRuntime
+	mu       sync.Mutex
+	sessions int
+	closed   int
+}
+
+func (r *pooledRuntime) NewValidationSession() ValidationSession {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sessions++
+	return &pooledSession{runtime: r}
+}
+
+type pooledSession struct {
+	runtime   *pooledRuntime
+	validated int
+}
+
+func (s *pooledSession) Validate(filePath string) error {
+	s.validated++
+	if strings.HasPrefix(filepath.Base(filePath), "bad") {
+		return &RuntimeError{Stage: StageValidate, Message: "validation failed: type mismatch"}
+	}
+	return nil
+}
+
+func (s *pooledSession) Close() {
+	s.runtime.mu.Lock()
+	defer s.runtime.mu.Unlock()
+	s.runtime.closed++
+}
+
+// -----------------------------------------------------------------------------
+// TEST: Validation Sweep
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// A sweep only pays off if runtime objects are reused across files instead
+// of being created per module, and parallel workers must still produce the
+// report a sequential run would, in corpus order.
+// -----------------------------------------------------------------------------
+
+func TestSweep_ReusesSessionsAcrossFiles(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 50; i++ {
+		name := fmt.Sprintf("ok_%02d.wasm", i)
+		if i%10 == 0 {
+			name = fmt.Sprintf("bad_%02d.wasm", i)
+		}
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte{byte(i)}, 0o644))
+	}
+	runtime := &pooledRuntime{}
+	runtime.LoadModuleFunc = func(filePath string) (WasmModule, error) {
+		t.Fatal("a sweep must not instantiate")
+		return nil, nil
+	}
+
+	report, err := runSweep(dir, []environmentRuntime{{Runtime: runtime}}, RunOptions{}, 4)
+	require.NoError(t, err)
+
+	assert.LessOrEqual(t, runtime.sessions, 4, "each worker keeps its session")
+	assert.Equal(t, runtime.sessions, runtime.closed)
+	assert.Equal(t, 50, report.TotalFiles)
+	assert.Equal(t, 45, report.Passed)
+	assert.Equal(t, 5, report.FailureCounts[StageValidate])
+	assert.Equal(t, StageValidate, report.StopAfter)
+	assert.Equal(t, 4, report.Sweep.Workers)
+	assert.Positive(t, report.Sweep.ModulesPerSec)
+	assert.Empty(t, validateReport(report))
+
+	files, err := collectWasmFiles(dir)
+	require.NoError(t, err)
+	for i, result := range report.Results {
+		assert.Equal(t, files[i], result.FilePath, "results keep corpus order")
+	}
+}
+
+func TestSweep_FallsBackToStageChecker(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.wasm"), []byte("a"), 0o644))
+
+	runtime := &checkingRuntime{}
+	report, err := runSweep(dir, []environmentRuntime{{Runtime: runtime}}, RunOptions{}, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []FailureStage{StageValidate}, runtime.checked)
+	assert.Equal(t, 1, report.Passed)
+
+	_, err = runSweep(dir, nil, RunOptions{}, 0)
+	assert.EqualError(t, err, "workers must be at least 1, not 0")
+}
@@ -0,0 +1,618 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/mrhapile/WASM-Injection-Framework/internal/wasmbin"
+	"github.com/mrhapile/WASM-Injection-Framework/pkg/rewrite"
+)
+
+// TaintConfig enables the experimental taint tracking mode, which follows
+// the bytes host functions write into a module's memory to the sinks they
+// reach. It shows which injected host data the module acts on.
+type TaintConfig struct {
+	Enabled bool `yaml:"enabled"`
+}
+
+// The hooks instrumented modules import to report loads and sinks
+const (
+	taintHookModule = "wasm_fuzzer_taint"
+	taintLoadHook   = "load"
+	taintSinkHook   = "sink"
+	// taintHarness is the source of data written outside host calls, such
+	// as the inputs the fuzzer places in memory
+	taintHarness = "harness"
+	// taintMaxValues caps the values remembered as loaded from tainted
+	// memory, and taintMaxFlows the flows reported for a file
+	taintMaxValues = 4096
+	taintMaxFlows  = 100
+)
+
+// Sinks taint tracking follows host data to
+const (
+	// TaintSinkHostCall is an argument of a call to an imported function
+	TaintSinkHostCall = "host_call"
+	// TaintSinkMemoryGrow is the page count passed to memory.grow
+	TaintSinkMemoryGrow = "memory_grow"
+	// TaintSinkCallIndirect is the table slot called indirectly
+	TaintSinkCallIndirect = "call_indirect"
+)
+
+// How a sink's operand was found to carry host data
+const (
+	// TaintMatchValue is an operand equal to a value the module loaded
+	// from tainted memory
+	TaintMatchValue = "value"
+	// TaintMatchPointer is a host call argument pointing into tainted
+	// memory
+	TaintMatchPointer = "pointer"
+)
+
+// TaintReport is what taint tracking found while a file ran
+type TaintReport struct {
+	// Instrumented is false for modules the hooks could not be added to,
+	// which run as-is, with Error saying why
+	Instrumented bool   `json:"instrumented"`
+	Error        string `json:"error,omitempty"`
+	// TaintedBytes counts the bytes written into memory by host functions
+	// and the harness, and TaintedLoads the loads that read any of them
+	TaintedBytes int         `json:"tainted_bytes"`
+	TaintedLoads int         `json:"tainted_loads"`
+	Flows        []TaintFlow `json:"flows,omitempty"`
+}
+
+// TaintFlow is host data reaching a sink. Flows are direct: a value
+// computed from host data, rather than copied, is not followed.
+type TaintFlow struct {
+	Sink string `json:"sink"`
+	// Function and Instruction locate the sink in the module as it was
+	// loaded: the function's index and the instruction's position in its
+	// body
+	Function    uint32 `json:"function"`
+	Instruction int    `json:"instruction"`
+	// Callee is the imported function of host call sinks, and Argument the
+	// operand, from 0, carrying the data
+	Callee   string `json:"callee,omitempty"`
+	Argument int    `json:"argument"`
+	Match    string `json:"match"`
+	// Value is the operand the first time the flow was seen
+	Value string `json:"value"`
+	// Source is the host function that wrote the data, as module.name, or
+	// "harness", and Address where in memory it was read
+	Source  string `json:"source"`
+	Address uint32 `json:"address"`
+	Hits    int    `json:"hits"`
+}
+
+// taintSite is an instruction of an instrumented module that reports to a
+// hook. Sites are numbered in the order they are added.
+type taintSite struct {
+	// sink is the kind of a sink site, and is empty for load sites
+	sink        string
+	function    uint32
+	instruction int
+	callee      string
+	argument    int
+	// op and offset are the opcode and static offset of a load
+	op     byte
+	offset uint64
+}
+
+// taintLoadSizes are the integer loads instrumented, with their widths
+var taintLoadSizes = map[byte]uint64{
+	0x28: 4, 0x29: 8,
+	0x2c: 1, 0x2d: 1, 0x2e: 2, 0x2f: 2,
+	0x30: 1, 0x31: 1, 0x32: 2, 0x33: 2, 0x34: 4, 0x35: 4,
+}
+
+// taintLoadValue decodes the value a load pushes from the bytes it reads.
+// i32 values are kept zero-extended, as sinks receive them.
+func taintLoadValue(op byte, data []byte) uint64 {
+	switch op {
+	case 0x28, 0x35:
+		return uint64(binary.LittleEndian.Uint32(data))
+	case 0x29:
+		return binary.LittleEndian.Uint64(data)
+	case 0x2c:
+		return uint64(uint32(int8(data[0])))
+	case 0x2d, 0x31:
+		return uint64(data[0])
+	case 0x2e:
+		return uint64(uint32(int16(binary.LittleEndian.Uint16(data))))
+	case 0x2f, 0x33:
+		return uint64(binary.LittleEndian.Uint16(data))
+	case 0x30:
+		return uint64(int64(int8(data[0])))
+	case 0x32:
+		return uint64(int64(int16(binary.LittleEndian.Uint16(data))))
+	case 0x34:
+		return uint64(int64(int32(binary.LittleEndian.Uint32(data))))
+	}
+	return 0
+}
+
+// instrumentTaint adds the taint hooks to a module. Every integer load of
+// memory 0 reports its address to the load hook, and every sink its
+// operands to the sink hook, each with the number of its site.
+func instrumentTaint(data []byte) ([]byte, []taintSite, error) {
+	decoded, err := parseWasmBinary(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	memories, err := decoded.memory64()
+	if err != nil {
+		return nil, nil, err
+	}
+	module, err := rewrite.Parse(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var imported []string
+	for _, imp := range module.Imports {
+		if imp.Kind == rewrite.KindFunc {
+			imported = append(imported, imp.Module+"."+imp.Name)
+		}
+	}
+	// Sites name functions by their index before the hooks are added
+	original := make(map[*rewrite.Function]uint32, len(module.Functions))
+	for _, f := range module.Functions {
+		original[f] = f.Index
+	}
+	hookType := rewrite.FuncType{Params: []rewrite.ValType{rewrite.I32, rewrite.I64}}
+	loadHook, err := module.AddFunctionImport(taintHookModule, taintLoadHook, hookType)
+	if err != nil {
+		return nil, nil, err
+	}
+	sinkHook, err := module.AddFunctionImport(taintHookModule, taintSinkHook, hookType)
+	if err != nil {
+		return nil, nil, err
+	}
+	indexType := func(memory uint32) rewrite.ValType {
+		if int(memory) < len(memories) && memories[memory] {
+			return rewrite.I64
+		}
+		return rewrite.I32
+	}
+
+	var sites []taintSite
+	for _, f := range module.Functions {
+		locals := &taintLocals{function: f}
+		body := make([]rewrite.Instruction, 0, len(f.Body))
+		// report spills the operand on top of the stack to a local, passes
+		// it to a hook with a new site, and pushes it back
+		report := func(hook uint32, site taintSite, t rewrite.ValType, local uint32) []rewrite.Instruction {
+			sites = append(sites, site)
+			code := []rewrite.Instruction{rewrite.I32Const(int32(len(sites) - 1)), rewrite.LocalGet(local)}
+			if t == rewrite.I32 {
+				code = append(code, rewrite.Simple(0xad)) // i64.extend_i32_u
+			}
+			return append(code, rewrite.Call(hook))
+		}
+
+		for at, instr := range f.Body {
+			locals.reset()
+			site := taintSite{function: original[f], instruction: at}
+			switch {
+			case taintLoadSizes[instr.Op] > 0:
+				memory, offset, err := taintMemArg(instr.Imm)
+				if err != nil {
+					return nil, nil, fmt.Errorf("function %d: %w", site.function, err)
+				}
+				if memory != 0 {
+					break
+				}
+				site.op, site.offset = instr.Op, offset
+				t := indexType(0)
+				local := locals.take(t)
+				body = append(body, rewrite.LocalSet(local))
+				body = append(body, report(loadHook, site, t, local)...)
+				body = append(body, rewrite.LocalGet(local))
+
+			case instr.Op == 0x40, instr.Op == rewrite.OpCallIndirect, instr.Op == 0x13:
+				t := rewrite.I32
+				site.sink = TaintSinkCallIndirect
+				if instr.Op == 0x40 {
+					memory, err := (&wasmbin.Reader{Data: instr.Imm}).U32()
+					if err != nil {
+						return nil, nil, fmt.Errorf("function %d: %w", site.function, err)
+					}
+					site.sink, t = TaintSinkMemoryGrow, indexType(memory)
+				}
+				local := locals.take(t)
+				body = append(body, rewrite.LocalSet(local))
+				body = append(body, report(sinkHook, site, t, local)...)
+				body = append(body, rewrite.LocalGet(local))
+
+			case instr.Op == rewrite.OpCall || instr.Op == rewrite.OpReturnCall:
+				callee, _ := instr.FuncIndex()
+				if int(callee) >= len(imported) {
+					break
+				}
+				signature, err := module.FuncType(callee)
+				if err != nil {
+					return nil, nil, fmt.Errorf("function %d: %w", site.function, err)
+				}
+				site.sink, site.callee = TaintSinkHostCall, imported[callee]
+				spilled := make([]uint32, len(signature.Params))
+				for i := len(signature.Params) - 1; i >= 0; i-- {
+					spilled[i] = locals.take(signature.Params[i])
+					body = append(body, rewrite.LocalSet(spilled[i]))
+				}
+				for i, t := range signature.Params {
+					if t == rewrite.I32 || t == rewrite.I64 {
+						site.argument = i
+						body = append(body, report(sinkHook, site, t, spilled[i])...)
+					}
+				}
+				for _, local := range spilled {
+					body = append(body, rewrite.LocalGet(local))
+				}
+			}
+			body = append(body, instr)
+		}
+		f.Body = body
+	}
+	return module.Encode(), sites, nil
+}
+
+// taintMemArg decodes the memory and static offset of a load's memarg
+func taintMemArg(imm []byte) (uint32, uint64, error) {
+	r := &wasmbin.Reader{Data: imm}
+	flags, err := r.U32()
+	if err != nil {
+		return 0, 0, err
+	}
+	var memory uint32
+	if flags&0x40 != 0 {
+		if memory, err = r.U32(); err != nil {
+			return 0, 0, err
+		}
+	}
+	offset, err := r.Uleb(64)
+	return memory, offset, err
+}
+
+// taintLocals hands out the scratch locals a function's instrumentation
+// spills operands to. Each instrumented instruction is done with its
+// locals before the next, so they are reused from one to the next.
+type taintLocals struct {
+	function *rewrite.Function
+	free     map[rewrite.ValType][]uint32
+	used     map[rewrite.ValType]int
+}
+
+// reset makes every local available again, for the next instruction
+func (l *taintLocals) reset() {
+	l.used = nil
+}
+
+// take returns a local of a type not taken since the last reset
+func (l *taintLocals) take(t rewrite.ValType) uint32 {
+	if l.free == nil {
+		l.free = make(map[rewrite.ValType][]uint32)
+	}
+	if l.used == nil {
+		l.used = make(map[rewrite.ValType]int)
+	}
+	n := l.used[t]
+	if n == len(l.free[t]) {
+		l.free[t] = append(l.free[t], l.function.AddLocal(t))
+	}
+	l.used[t]++
+	return l.free[t][n]
+}
+
+// taintRegion is a range of memory written by one source
+type taintRegion struct {
+	start, end uint64
+	source     string
+}
+
+// taintOrigin is where a tainted value was loaded from
+type taintOrigin struct {
+	source  string
+	address uint32
+}
+
+// taintTracker follows the host data of one file. Regions and values are
+// those of the module instance loaded last; flows accumulate across
+// reloads.
+type taintTracker struct {
+	sites  []taintSite
+	memory *hostMemory
+	// regions are the tainted ranges of memory, newest last, and values
+	// the values loaded from them
+	regions []taintRegion
+	values  map[uint64]taintOrigin
+	// current is the host function running, empty outside host calls
+	current string
+	report  TaintReport
+	flows   map[taintFlowKey]int
+}
+
+// taintFlowKey identifies a flow, so repeated flows only count hits
+type taintFlowKey struct {
+	site   int
+	match  string
+	source string
+}
+
+func newTaintTracker() *taintTracker {
+	return &taintTracker{memory: &hostMemory{}, flows: make(map[taintFlowKey]int)}
+}
+
+// reset forgets the data tainted in the previous instance
+func (t *taintTracker) reset(sites []taintSite) {
+	t.sites, t.regions, t.values, t.current = sites, nil, make(map[uint64]taintOrigin), ""
+	t.memory.module = nil
+}
+
+// source taints n bytes written at offset, by the host function running
+// or by the harness
+func (t *taintTracker) source(offset uint32, n int) {
+	if n == 0 {
+		return
+	}
+	source := t.current
+	if source == "" {
+		source = taintHarness
+	}
+	t.regions = append(t.regions, taintRegion{start: uint64(offset), end: uint64(offset) + uint64(n), source: source})
+	t.report.TaintedBytes += n
+}
+
+// find returns the origin of the data last written over any of the n
+// bytes at address
+func (t *taintTracker) find(address, n uint64) (taintOrigin, bool) {
+	for i := len(t.regions) - 1; i >= 0; i-- {
+		region := t.regions[i]
+		if address < region.end && address+n > region.start {
+			return taintOrigin{source: region.source, address: uint32(max(address, region.start))}, true
+		}
+	}
+	return taintOrigin{}, false
+}
+
+// load remembers the value a load site reads, when it reads tainted data.
+// Zero is everywhere, so it is never remembered.
+func (t *taintTracker) load(site int, address uint64) {
+	if site < 0 || site >= len(t.sites) {
+		return
+	}
+	s := t.sites[site]
+	size := taintLoadSizes[s.op]
+	address += s.offset
+	if address+size > math.MaxUint32+1 {
+		return
+	}
+	origin, ok := t.find(address, size)
+	if !ok {
+		return
+	}
+	t.report.TaintedLoads++
+	data, err := t.memory.read(address, size)
+	if err != nil || uint64(len(data)) < size {
+		return
+	}
+	value := taintLoadValue(s.op, data)
+	if _, seen := t.values[value]; !seen && value != 0 && len(t.values) < taintMaxValues {
+		t.values[value] = origin
+	}
+}
+
+// sink records a flow when a sink site's operand carries host data
+func (t *taintTracker) sink(site int, value uint64) {
+	if site < 0 || site >= len(t.sites) {
+		return
+	}
+	s := t.sites[site]
+	if origin, ok := t.values[value]; ok {
+		t.flow(site, TaintMatchValue, value, origin)
+	} else if s.sink == TaintSinkHostCall && value != 0 && value <= math.MaxUint32 {
+		if origin, ok := t.find(value, 1); ok {
+			t.flow(site, TaintMatchPointer, value, origin)
+		}
+	}
+}
+
+func (t *taintTracker) flow(site int, match string, value uint64, origin taintOrigin) {
+	key := taintFlowKey{site: site, match: match, source: origin.source}
+	if i, ok := t.flows[key]; ok {
+		t.report.Flows[i].Hits++
+		return
+	}
+	if len(t.report.Flows) >= taintMaxFlows {
+		return
+	}
+	s := t.sites[site]
+	t.flows[key] = len(t.report.Flows)
+	t.report.Flows = append(t.report.Flows, TaintFlow{
+		Sink:        s.sink,
+		Function:    s.function,
+		Instruction: s.instruction,
+		Callee:      s.callee,
+		Argument:    s.argument,
+		Match:       match,
+		Value:       fmt.Sprintf("0x%x", value),
+		Source:      origin.source,
+		Address:     origin.address,
+		Hits:        1,
+	})
+}
+
+// hooks are the host functions instrumented modules import
+func (t *taintTracker) hooks() []HostFunction {
+	hook := func(name string, report func(site int, value uint64)) HostFunction {
+		return HostFunction{
+			Module:    taintHookModule,
+			Name:      name,
+			Signature: funcSig("i32 i64", ""),
+			Call: func(args []interface{}) ([]interface{}, error) {
+				site, _ := args[0].(int32)
+				value, _ := args[1].(int64)
+				report(int(site), uint64(value))
+				return nil, nil
+			},
+		}
+	}
+	return []HostFunction{hook(taintLoadHook, t.load), hook(taintSinkHook, t.sink)}
+}
+
+// attribute wraps host functions so the data they write is tainted with
+// their name
+func (t *taintTracker) attribute(host []HostFunction) []HostFunction {
+	wrapped := make([]HostFunction, len(host))
+	for i, fn := range host {
+		call, name := fn.Call, fn.Module+"."+fn.Name
+		fn.Call = func(args []interface{}) ([]interface{}, error) {
+			previous := t.current
+			t.current = name
+			defer func() { t.current = previous }()
+			return call(args)
+		}
+		wrapped[i] = fn
+	}
+	return wrapped
+}
+
+// summary reports what was tracked, with flows in module order
+func (t *taintTracker) summary() *TaintReport {
+	report := t.report
+	report.Flows = append([]TaintFlow(nil), report.Flows...)
+	sort.SliceStable(report.Flows, func(i, j int) bool {
+		a, b := report.Flows[i], report.Flows[j]
+		if a.Function != b.Function {
+			return a.Function < b.Function
+		}
+		if a.Instruction != b.Instruction {
+			return a.Instruction < b.Instruction
+		}
+		return a.Argument < b.Argument
+	})
+	return &report
+}
+
+// taintRuntime instruments every module it loads with the taint hooks.
+// It sits right above the runtime, below the host, so the host's writes
+// reach memory through it and nothing wrapping host functions sees the
+// hooks.
+type taintRuntime struct {
+	WasmRuntime
+	tracker *taintTracker
+}
+
+func newTaintRuntime(runtime WasmRuntime) *taintRuntime {
+	return &taintRuntime{WasmRuntime: runtime, tracker: newTaintTracker()}
+}
+
+// LoadModule implements WasmRuntime.LoadModule
+func (r *taintRuntime) LoadModule(filePath string) (WasmModule, error) {
+	return r.LoadModuleWithHost(filePath, nil, nil)
+}
+
+// LoadModuleBytes implements BufferLoader.LoadModuleBytes
+func (r *taintRuntime) LoadModuleBytes(name string, data []byte) (WasmModule, error) {
+	return r.LoadModuleWithHost(name, data, nil)
+}
+
+// LoadModuleWithHost implements HostLoader.LoadModuleWithHost
+func (r *taintRuntime) LoadModuleWithHost(filePath string, data []byte, host []HostFunction) (WasmModule, error) {
+	loader, ok := r.WasmRuntime.(HostLoader)
+	if !ok {
+		return nil, fmt.Errorf("taint tracking needs a runtime that can link host functions")
+	}
+	if data == nil {
+		var err error
+		if data, err = os.ReadFile(filePath); err != nil {
+			return nil, err
+		}
+	}
+	// Modules that cannot be instrumented are loaded as-is so the runtime
+	// still reports their real load or validation error
+	instrumented, sites, err := instrumentTaint(data)
+	if err != nil {
+		r.tracker.report.Error = "instrumentation failed: " + err.Error()
+		return loader.LoadModuleWithHost(filePath, data, host)
+	}
+	r.tracker.report.Instrumented = true
+	r.tracker.reset(sites)
+	module, err := loader.LoadModuleWithHost(filePath, instrumented, append(r.tracker.attribute(host), r.tracker.hooks()...))
+	if err != nil {
+		return nil, err
+	}
+	memory, ok := module.(MemoryModule)
+	if !ok {
+		return module, nil
+	}
+	r.tracker.memory.module = memory
+	return &taintModule{MemoryModule: memory, tracker: r.tracker, signatures: exportSignatures(data)}, nil
+}
+
+// CheckModule implements StageChecker.CheckModule
+func (r *taintRuntime) CheckModule(filePath string, stage FailureStage) error {
+	return runTruncated(filePath, r.WasmRuntime, stage)
+}
+
+// exportSignatures returns the signatures of a module's exported functions
+func exportSignatures(data []byte) map[string]FuncSignature {
+	decoded, err := parseWasmBinary(data)
+	if err != nil {
+		return nil
+	}
+	exports, err := decoded.functionExports()
+	if err != nil {
+		return nil
+	}
+	functions, err := decoded.functionSignatures()
+	if err != nil {
+		return nil
+	}
+	signatures := make(map[string]FuncSignature, len(exports))
+	for name, index := range exports {
+		if int(index) < len(functions) {
+			signatures[name] = functions[index]
+		}
+	}
+	return signatures
+}
+
+// taintModule taints what is written into the module's memory. It is not
+// a StatefulModule, so the module is reloaded between inputs and each
+// input starts from untainted memory.
+type taintModule struct {
+	MemoryModule
+	tracker *taintTracker
+	// signatures are those of the module's exports before it was
+	// instrumented
+	signatures map[string]FuncSignature
+}
+
+// WriteMemory implements MemoryModule.WriteMemory
+func (m *taintModule) WriteMemory(memory string, offset uint32, data []byte) error {
+	if memory == defaultMemoryExport {
+		m.tracker.source(offset, len(data))
+	}
+	return m.MemoryModule.WriteMemory(memory, offset, data)
+}
+
+// Signature implements SignatureModule.Signature
+func (m *taintModule) Signature(name string) (FuncSignature, bool) {
+	if typed, ok := m.MemoryModule.(SignatureModule); ok {
+		return typed.Signature(name)
+	}
+	signature, ok := m.signatures[name]
+	return signature, ok
+}
+
+// TakeCoverage implements CoverageModule.TakeCoverage
+func (m *taintModule) TakeCoverage() ([]byte, error) {
+	if typed, ok := m.MemoryModule.(CoverageModule); ok {
+		return typed.TakeCoverage()
+	}
+	return nil, nil
+}
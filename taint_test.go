@@ -0,0 +1,210 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mrhapile/WASM-Injection-Framework/pkg/rewrite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// taintBinary imports random_get and exports run, which fills 8 bytes at
+// 16 with it, loads the word at 20 and grows memory by it
+func taintBinary(t *testing.T) []byte {
+	module, err := rewrite.Parse(pluginBinary(wasmFuncImport{Module: wasiModule, Name: "random_get", Signature: funcSig("i32 i32", "i32")}))
+	require.NoError(t, err)
+	require.NoError(t, module.ReplaceFunction(1, nil, []rewrite.Instruction{
+		rewrite.I32Const(16), rewrite.I32Const(8), rewrite.Call(0), rewrite.Simple(rewrite.OpDrop),
+		rewrite.I32Const(16), {Op: 0x28, Imm: []byte{0x02, 0x04}},
+		{Op: 0x40, Imm: []byte{0x00}},
+		rewrite.Simple(rewrite.OpDrop), rewrite.I32Const(0),
+	}))
+	return module.Encode()
+}
+
+// taintMockModule is a module with a memory, running its instrumented
+// code as a script calling host functions and hooks
+type taintMockModule struct {
+	MockWasmModule
+	memory []byte
+	host   map[string]HostFunction
+}
+
+func (m *taintMockModule) ReadMemory(memory string, offset, length uint32) ([]byte, error) {
+	if int(offset)+int(length) > len(m.memory) {
+		return nil, errors.New("out of bounds")
+	}
+	return append([]byte(nil), m.memory[offset:offset+length]...), nil
+}
+
+func (m *taintMockModule) WriteMemory(memory string, offset uint32, data []byte) error {
+	if int(offset)+len(data) > len(m.memory) {
+		return errors.New("out of bounds")
+	}
+	copy(m.memory[offset:], data)
+	return nil
+}
+
+// call calls a host function or hook by name
+func (m *taintMockModule) call(name string, args ...interface{}) {
+	_, _ = m.host[name].Call(args)
+}
+
+type taintMockRuntime struct {
+	run    func(m *taintMockModule)
+	loaded []byte
+}
+
+func (r *taintMockRuntime) LoadModule(filePath string) (WasmModule, error) {
+	return nil, errors.New("imports cannot be satisfied")
+}
+
+func (r *taintMockRuntime) LoadModuleWithHost(filePath string, data []byte, host []HostFunction) (WasmModule, error) {
+	r.loaded = data
+	m := &taintMockModule{memory: make([]byte, 64), host: map[string]HostFunction{}}
+	for _, fn := range host {
+		m.host[fn.Name] = fn
+	}
+	m.ExecuteFunc = func(funcName string, args ...interface{}) ([]interface{}, error) {
+		if r.run != nil {
+			r.run(m)
+		}
+		return []interface{}{int32(0)}, nil
+	}
+	return m, nil
+}
+
+// runTainted runs a module binary with taint tracking
+func runTainted(t *testing.T, data []byte, runtime WasmRuntime) ExecutionResult {
+	path := filepath.Join(t.TempDir(), "taint.wasm")
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+	return processWasmFileWithOptions(path, runtime, RunOptions{
+		Invocation: InvocationConfig{Entry: "run", Inputs: []InvocationInput{{}}},
+		Taint:      TaintConfig{Enabled: true},
+	})
+}
+
+// -----------------------------------------------------------------------------
+// TEST: Taint Tracking
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Injected host data only matters if the module acts on it. Following
+// the bytes host functions write to the host calls, memory growth and
+// indirect calls they reach shows which injections can steer a module,
+// and where.
+// -----------------------------------------------------------------------------
+
+func TestTaint_InstrumentsLoadsAndSinks(t *testing.T) {
+	instrumented, sites, err := instrumentTaint(taintBinary(t))
+	require.NoError(t, err)
+
+	assert.Equal(t, []taintSite{
+		{sink: TaintSinkHostCall, function: 1, instruction: 2, callee: "wasi_snapshot_preview1.random_get", argument: 0},
+		{sink: TaintSinkHostCall, function: 1, instruction: 2, callee: "wasi_snapshot_preview1.random_get", argument: 1},
+		{function: 1, instruction: 5, op: 0x28, offset: 4},
+		{sink: TaintSinkMemoryGrow, function: 1, instruction: 6},
+	}, sites)
+
+	module, err := rewrite.Parse(instrumented)
+	require.NoError(t, err)
+	require.Len(t, module.Imports, 3)
+	assert.Equal(t, taintLoadHook, module.Imports[1].Name)
+	assert.Equal(t, taintSinkHook, module.Imports[2].Name)
+	run, ok := module.ExportedFunction("run")
+	require.True(t, ok)
+	assert.Equal(t, uint32(3), run, "defined functions move past the hooks")
+
+	f, err := module.Function(run)
+	require.NoError(t, err)
+	calls := map[uint32]int{}
+	for _, instr := range f.Body {
+		if index, ok := instr.FuncIndex(); ok {
+			calls[index]++
+		}
+	}
+	assert.Equal(t, map[uint32]int{0: 1, 1: 1, 2: 3}, calls)
+}
+
+func TestTaint_ReportsHostDataReachingSinks(t *testing.T) {
+	runtime := &taintMockRuntime{run: func(m *taintMockModule) {
+		m.call(taintSinkHook, int32(0), int64(16))
+		m.call(taintSinkHook, int32(1), int64(8))
+		m.call("random_get", int32(16), int32(8))
+		m.call(taintLoadHook, int32(2), int64(16))
+		m.call(taintSinkHook, int32(3), int64(binary.LittleEndian.Uint32(m.memory[20:])))
+		// The buffer random_get filled is passed back to it
+		m.call(taintSinkHook, int32(0), int64(16))
+	}}
+	result := runTainted(t, taintBinary(t), runtime)
+	require.True(t, result.Success, result.ErrorMessage)
+	require.NotNil(t, result.Taint)
+
+	report := result.Taint
+	assert.True(t, report.Instrumented)
+	assert.Equal(t, 8, report.TaintedBytes)
+	assert.Equal(t, 1, report.TaintedLoads)
+	require.Len(t, report.Flows, 2)
+	assert.Equal(t, TaintFlow{
+		Sink: TaintSinkHostCall, Function: 1, Instruction: 2,
+		Callee: "wasi_snapshot_preview1.random_get", Argument: 0,
+		Match: TaintMatchPointer, Value: "0x10",
+		Source: "wasi_snapshot_preview1.random_get", Address: 16, Hits: 1,
+	}, report.Flows[0])
+	grow := report.Flows[1]
+	assert.Equal(t, TaintSinkMemoryGrow, grow.Sink)
+	assert.Equal(t, 6, grow.Instruction)
+	assert.Equal(t, TaintMatchValue, grow.Match)
+	assert.Equal(t, "wasi_snapshot_preview1.random_get", grow.Source)
+	assert.Equal(t, uint32(20), grow.Address)
+}
+
+func TestTaint_CleanOperandsAreNotFlows(t *testing.T) {
+	runtime := &taintMockRuntime{run: func(m *taintMockModule) {
+		m.call("random_get", int32(16), int32(8))
+		// Untainted memory, and a value never loaded from tainted memory
+		m.call(taintLoadHook, int32(2), int64(32))
+		m.call(taintSinkHook, int32(3), int64(7))
+		m.call(taintSinkHook, int32(0), int64(40))
+	}}
+	result := runTainted(t, taintBinary(t), runtime)
+	require.NotNil(t, result.Taint)
+	assert.Zero(t, result.Taint.TaintedLoads)
+	assert.Empty(t, result.Taint.Flows)
+}
+
+func TestTaint_HarnessWritesAreSources(t *testing.T) {
+	tracker := newTaintTracker()
+	tracker.reset([]taintSite{{op: 0x2d}, {sink: TaintSinkCallIndirect}})
+	tracker.memory.module = &taintMockModule{memory: []byte{0, 3, 0, 0}}
+	tracker.source(1, 1)
+
+	tracker.load(0, 0)
+	tracker.sink(1, 0)
+	assert.Empty(t, tracker.report.Flows, "zero is never matched")
+
+	tracker.load(0, 1)
+	tracker.sink(1, 3)
+	tracker.sink(1, 3)
+	report := tracker.summary()
+	require.Len(t, report.Flows, 1)
+	assert.Equal(t, taintHarness, report.Flows[0].Source)
+	assert.Equal(t, 2, report.Flows[0].Hits)
+}
+
+func TestTaint_UninstrumentableModulesStillRun(t *testing.T) {
+	data := []byte("\x00asm\x01\x00\x00\x00\x0a\x05")
+	runtime := &taintMockRuntime{}
+	result := runTainted(t, data, runtime)
+	require.NotNil(t, result.Taint)
+	assert.False(t, result.Taint.Instrumented)
+	assert.Contains(t, result.Taint.Error, "instrumentation failed")
+	assert.Equal(t, data, runtime.loaded, "the module is loaded as-is")
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/mrhapile/WASM-Injection-Framework/internal/wasmbin"
+)
+
+// SubStageTamper refines the load stage for modules the configured
+// tampering could not be applied to
+const SubStageTamper = "tamper"
+
+// TamperConfig overrides the initial state of globals and tables
+type TamperConfig struct {
+	Globals []GlobalTamper `yaml:"globals"`
+	Tables  []TableTamper  `yaml:"tables"`
+}
+
+// GlobalTamper replaces the initial value of a mutable global
+type GlobalTamper struct {
+	// Global is an export name or a global index
+	Global string `yaml:"global"`
+	// Value is a number of the global's type
+	Value string `yaml:"value"`
+}
+
+// TableTamper stores a function in a table slot, such as the slot an
+// indirect call dispatches through
+type TableTamper struct {
+	Table uint32 `yaml:"table"`
+	Slot  uint32 `yaml:"slot"`
+	// Function is an export name or a function index; empty stores null
+	Function string `yaml:"function"`
+}
+
+// TamperAction records one override applied to a module
+type TamperAction struct {
+	// Target is a global, such as "global 2", or a table slot, such as
+	// "table 0[5]"
+	Target string `json:"target"`
+	// Original is the global's initial value, when it was a constant
+	Original *WasmValue `json:"original,omitempty"`
+	// Value is the new initial value. Table slots hold a funcref: the
+	// function's index, or "null".
+	Value WasmValue `json:"value"`
+}
+
+// enabled reports whether anything is tampered with
+func (c TamperConfig) enabled() bool {
+	return len(c.Globals) > 0 || len(c.Tables) > 0
+}
+
+// check rejects overrides that can be found wrong without a module
+func (c TamperConfig) check() error {
+	for i, global := range c.Globals {
+		if global.Global == "" || global.Value == "" {
+			return fmt.Errorf("global tamper %d: global and value are required", i)
+		}
+	}
+	return nil
+}
+
+// tamper applies the overrides to a module, returning the rewritten module
+// and what was changed
+func (c TamperConfig) tamper(data []byte) ([]byte, []TamperAction, error) {
+	module, err := parseWasmBinary(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	var actions []TamperAction
+	for i, global := range c.Globals {
+		action, err := module.tamperGlobal(global)
+		if err != nil {
+			return nil, nil, fmt.Errorf("global tamper %d: %w", i, err)
+		}
+		actions = append(actions, action)
+	}
+	for i, table := range c.Tables {
+		action, err := module.tamperTable(table)
+		if err != nil {
+			return nil, nil, fmt.Errorf("table tamper %d: %w", i, err)
+		}
+		actions = append(actions, action)
+	}
+	return module.encode(), actions, nil
+}
+
+// resolveIndex looks a name up in exports, or parses it as an index
+func resolveIndex(name string, exports map[string]uint32) (uint32, error) {
+	if index, ok := exports[name]; ok {
+		return index, nil
+	}
+	index, err := strconv.ParseUint(name, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("no export or index %q", name)
+	}
+	return uint32(index), nil
+}
+
+// tamperGlobal replaces the initializer of a mutable global defined by the
+// module with a constant
+func (m *wasmBinary) tamperGlobal(tamper GlobalTamper) (TamperAction, error) {
+	exports, err := m.exportsOfKind(externGlobal)
+	if err != nil {
+		return TamperAction{}, err
+	}
+	index, err := resolveIndex(tamper.Global, exports)
+	if err != nil {
+		return TamperAction{}, err
+	}
+	imports, err := m.importCounts()
+	if err != nil {
+		return TamperAction{}, err
+	}
+	if index < imports[externGlobal] {
+		return TamperAction{}, fmt.Errorf("global %d is imported", index)
+	}
+	section := m.section(sectionGlobal)
+	if section == nil {
+		return TamperAction{}, fmt.Errorf("no global %d", index)
+	}
+
+	r := &wasmbin.Reader{Data: section.Payload}
+	n, err := r.U32()
+	if err != nil {
+		return TamperAction{}, err
+	}
+	defined := index - imports[externGlobal]
+	if defined >= n {
+		return TamperAction{}, fmt.Errorf("no global %d", index)
+	}
+	for i := uint32(0); ; i++ {
+		typeStart := r.Pos
+		if err := r.SkipValType(); err != nil {
+			return TamperAction{}, err
+		}
+		valType := r.Data[typeStart]
+		mutable, err := r.Byte()
+		if err != nil {
+			return TamperAction{}, err
+		}
+		start := r.Pos
+		if err := r.SkipConstExpr(); err != nil {
+			return TamperAction{}, fmt.Errorf("global %d: %w", index, err)
+		}
+		if i < defined {
+			continue
+		}
+
+		typeName, ok := valTypeNames[valType]
+		if !ok || typeName == "v128" {
+			return TamperAction{}, fmt.Errorf("global %d has unsupported type 0x%02x", index, valType)
+		}
+		if mutable != 0x01 {
+			return TamperAction{}, fmt.Errorf("global %d is immutable", index)
+		}
+		value, err := convertArgument(WasmValue{Value: tamper.Value}, typeName)
+		if err != nil {
+			return TamperAction{}, fmt.Errorf("global %d: %w", index, err)
+		}
+
+		action := TamperAction{Target: fmt.Sprintf("global %d", index), Value: encodeValue(value)}
+		if original, ok := constValue(r.Data[start:r.Pos]); ok {
+			action.Original = &original
+		}
+		payload := append([]byte(nil), section.Payload[:start]...)
+		payload = append(appendConst(payload, value), opEnd)
+		section.Payload = append(payload, section.Payload[r.Pos:]...)
+		return action, nil
+	}
+}
+
+// constValue decodes a constant expression made of a single number
+// constant
+func constValue(expr []byte) (WasmValue, bool) {
+	if len(expr) < 2 || expr[len(expr)-1] != opEnd {
+		return WasmValue{}, false
+	}
+	r := &wasmbin.Reader{Data: expr}
+	instr, err := r.Instruction()
+	if err != nil || r.Pos != len(expr)-1 {
+		return WasmValue{}, false
+	}
+	imm := expr[1:r.Pos]
+	switch instr.Opcode {
+	case opI32Const:
+		return encodeValue(int32(instr.Const)), true
+	case opI64Const:
+		return encodeValue(instr.Const), true
+	case opF32Const:
+		return encodeValue(math.Float32frombits(binary.LittleEndian.Uint32(imm))), true
+	case opF64Const:
+		return encodeValue(math.Float64frombits(binary.LittleEndian.Uint64(imm))), true
+	}
+	return WasmValue{}, false
+}
+
+// appendConst appends the constant instruction pushing a number
+func appendConst(b []byte, value interface{}) []byte {
+	switch v := value.(type) {
+	case int32:
+		return wasmbin.AppendS32(append(b, opI32Const), v)
+	case int64:
+		return wasmbin.AppendS64(append(b, opI64Const), v)
+	case float32:
+		return binary.LittleEndian.AppendUint32(append(b, opF32Const), math.Float32bits(v))
+	case float64:
+		return binary.LittleEndian.AppendUint64(append(b, opF64Const), math.Float64bits(v))
+	}
+	panic(fmt.Sprintf("unsupported constant %T", value))
+}
+
+// tamperTable appends an active element segment storing a function, or
+// null, in a table slot. Element segments initialize tables in order, so
+// it overrides whatever the module's own segments store there.
+func (m *wasmBinary) tamperTable(tamper TableTamper) (TamperAction, error) {
+	action := TamperAction{
+		Target: fmt.Sprintf("table %d[%d]", tamper.Table, tamper.Slot),
+		Value:  WasmValue{Type: "funcref", Value: "null"},
+	}
+
+	imports, err := m.importCounts()
+	if err != nil {
+		return action, err
+	}
+	tables, err := m.vectorCount(sectionTable)
+	if err != nil {
+		return action, err
+	}
+	if tamper.Table >= imports[externTable]+tables {
+		return action, fmt.Errorf("no table %d", tamper.Table)
+	}
+
+	var entry []byte
+	offset := wasmbin.AppendS32([]byte{opI32Const}, int32(tamper.Slot))
+	if tamper.Function == "" {
+		// Elements given as expressions, with the table's reference type
+		// explicit for tables other than the first
+		entry = []byte{0x04}
+		if tamper.Table != 0 {
+			entry = append(wasmbin.AppendU32([]byte{0x06}, tamper.Table), offset...)
+			entry = append(append(entry, opEnd), 0x70)
+		} else {
+			entry = append(append(entry, offset...), opEnd)
+		}
+		entry = append(entry, 0x01, 0xd0, 0x70, opEnd)
+	} else {
+		exports, err := m.functionExports()
+		if err != nil {
+			return action, err
+		}
+		function, err := resolveIndex(tamper.Function, exports)
+		if err != nil {
+			return action, err
+		}
+		defined, err := m.vectorCount(sectionFunction)
+		if err != nil {
+			return action, err
+		}
+		if function >= imports[externFunc]+defined {
+			return action, fmt.Errorf("no function %d", function)
+		}
+		// Function indices, with the element kind explicit for tables
+		// other than the first
+		entry = []byte{0x00}
+		if tamper.Table != 0 {
+			entry = wasmbin.AppendU32([]byte{0x02}, tamper.Table)
+		}
+		entry = append(append(entry, offset...), opEnd)
+		if tamper.Table != 0 {
+			entry = append(entry, 0x00)
+		}
+		entry = wasmbin.AppendU32(append(entry, 0x01), function)
+		action.Value.Value = strconv.FormatUint(uint64(function), 10)
+	}
+
+	if _, err := m.ensureSection(sectionElement).appendVectorEntry(entry); err != nil {
+		return action, err
+	}
+	return action, nil
+}
@@ -0,0 +1,125 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mrhapile/WASM-Injection-Framework/internal/wasmbin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// -----------------------------------------------------------------------------
+// TEST: Global and Table Tampering
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Bounds, flags and dispatch tables live in globals and tables a module
+// sets up itself. Starting it with a limit raised or an indirect-call slot
+// pointing elsewhere shows whether the code relying on them checks what it
+// reads, and the recorded actions say exactly what was changed.
+// -----------------------------------------------------------------------------
+
+// tamperModule is the test module with two funcref tables of four slots, a
+// mutable i32 global exported as "limit" and an immutable f64 global
+func tamperModule(t *testing.T) *wasmBinary {
+	module, err := parseWasmBinary(buildTestModule(loopIfBody, false))
+	require.NoError(t, err)
+	module.ensureSection(sectionTable).Payload = []byte{0x02, 0x70, 0x00, 0x04, 0x70, 0x00, 0x04}
+	module.ensureSection(sectionGlobal).Payload = []byte{
+		0x02,
+		0x7f, 0x01, opI32Const, 0x05, opEnd,
+		0x7c, 0x00, opF64Const, 0, 0, 0, 0, 0, 0, 0xf0, 0x3f, opEnd,
+	}
+	_, err = module.section(sectionExport).appendVectorEntry(append(wasmbin.AppendName(nil, "limit"), externGlobal, 0x00))
+	require.NoError(t, err)
+	return module
+}
+
+func TestTamperConfig_OverridesGlobal(t *testing.T) {
+	module := tamperModule(t)
+	config := TamperConfig{Globals: []GlobalTamper{{Global: "limit", Value: "0xffffffff"}}}
+
+	data, actions, err := config.tamper(module.encode())
+	require.NoError(t, err)
+	assert.Equal(t, []TamperAction{{
+		Target:   "global 0",
+		Original: &WasmValue{Type: "i32", Value: "5"},
+		Value:    WasmValue{Type: "i32", Value: "-1"},
+	}}, actions)
+
+	tampered, err := parseWasmBinary(data)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x7f, 0x01, opI32Const, 0x7f, opEnd}, tampered.section(sectionGlobal).Payload[1:6])
+	assert.Equal(t, module.section(sectionGlobal).Payload[6:], tampered.section(sectionGlobal).Payload[6:],
+		"the other globals are kept")
+}
+
+func TestTamperConfig_RejectsGlobalsItCannotOverride(t *testing.T) {
+	module := tamperModule(t).encode()
+	for global, message := range map[string]string{
+		"1":       "global tamper 0: global 1 is immutable",
+		"2":       "global tamper 0: no global 2",
+		"missing": `global tamper 0: no export or index "missing"`,
+	} {
+		_, _, err := TamperConfig{Globals: []GlobalTamper{{Global: global, Value: "1"}}}.tamper(module)
+		assert.EqualError(t, err, message)
+	}
+	_, _, err := TamperConfig{Globals: []GlobalTamper{{Global: "limit", Value: "1.5"}}}.tamper(module)
+	assert.EqualError(t, err, `global tamper 0: global 0: invalid i32 value "1.5"`)
+}
+
+func TestTamperConfig_RedirectsTableSlots(t *testing.T) {
+	config := TamperConfig{Tables: []TableTamper{
+		{Slot: 2, Function: "process"},
+		{Table: 1, Slot: 3, Function: "0"},
+		{Slot: 1},
+		{Table: 1, Slot: 0},
+	}}
+
+	data, actions, err := config.tamper(tamperModule(t).encode())
+	require.NoError(t, err)
+	assert.Equal(t, []TamperAction{
+		{Target: "table 0[2]", Value: WasmValue{Type: "funcref", Value: "0"}},
+		{Target: "table 1[3]", Value: WasmValue{Type: "funcref", Value: "0"}},
+		{Target: "table 0[1]", Value: WasmValue{Type: "funcref", Value: "null"}},
+		{Target: "table 1[0]", Value: WasmValue{Type: "funcref", Value: "null"}},
+	}, actions)
+
+	tampered, err := parseWasmBinary(data)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{
+		0x04,
+		0x00, opI32Const, 0x02, opEnd, 0x01, 0x00,
+		0x02, 0x01, opI32Const, 0x03, opEnd, 0x00, 0x01, 0x00,
+		0x04, opI32Const, 0x01, opEnd, 0x01, 0xd0, 0x70, opEnd,
+		0x06, 0x01, opI32Const, 0x00, opEnd, 0x70, 0x01, 0xd0, 0x70, opEnd,
+	}, tampered.section(sectionElement).Payload)
+
+	_, _, err = TamperConfig{Tables: []TableTamper{{Table: 2}}}.tamper(tamperModule(t).encode())
+	assert.EqualError(t, err, "table tamper 0: no table 2")
+	_, _, err = TamperConfig{Tables: []TableTamper{{Function: "1"}}}.tamper(tamperModule(t).encode())
+	assert.EqualError(t, err, "table tamper 0: no function 1")
+}
+
+func TestProcessWasmFile_RecordsTampering(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "limits.wasm")
+	require.NoError(t, os.WriteFile(filePath, tamperModule(t).encode(), 0o644))
+	runtime := &MockWasmRuntime{LoadModuleFunc: func(string) (WasmModule, error) { return &MockWasmModule{}, nil }}
+
+	opts := RunOptions{Tamper: TamperConfig{Tables: []TableTamper{{Slot: 0}}}}
+	result := processWasmFileWithOptions(filePath, runtime, opts)
+	assert.True(t, result.Success, result.ErrorMessage)
+	assert.Equal(t, []TamperAction{{Target: "table 0[0]", Value: WasmValue{Type: "funcref", Value: "null"}}}, result.Tampering)
+
+	opts.Tamper.Tables[0].Table = 5
+	result = processWasmFileWithOptions(filePath, runtime, opts)
+	assert.Equal(t, StageLoad, result.FailureStage)
+	assert.Equal(t, SubStageTamper, result.FailureSubStage)
+	assert.Equal(t, "tampering failed: table tamper 0: no table 5", result.ErrorMessage)
+	assert.Empty(t, result.Tampering)
+}
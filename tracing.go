@@ -0,0 +1,372 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tracer is the active tracer for the campaign. A nil tracer records nothing.
+var tracer *Tracer
+
+// spanBatchSize is the number of finished spans buffered before an export
+const spanBatchSize = 512
+
+// SpanData is a finished span ready for export
+type SpanData struct {
+	Name       string
+	TraceID    [16]byte
+	SpanID     [8]byte
+	ParentID   [8]byte
+	Start      time.Time
+	End        time.Time
+	Attributes [][2]string
+	Err        error
+}
+
+// SpanExporter sends finished spans to a tracing backend
+type SpanExporter interface {
+	ExportSpans(serviceName string, spans []SpanData) error
+}
+
+// Tracer records a span per file and per pipeline stage. The fuzzer runs
+// sequentially, so the tracer tracks open spans as a stack and parents each
+// new span to the innermost open one.
+type Tracer struct {
+	exporter    SpanExporter
+	serviceName string
+	traceID     [16]byte
+	remoteID    [8]byte
+	open        []*Span
+	finished    []SpanData
+	exportErr   error
+}
+
+// Span is an in-progress span. A nil span ignores all calls.
+type Span struct {
+	tracer *Tracer
+	data   SpanData
+}
+
+// NewTracer creates a tracer exporting to the given exporter. If traceparent
+// is a valid W3C traceparent header, spans join that trace so campaigns can
+// be correlated with the orchestrator that launched them.
+func NewTracer(exporter SpanExporter, serviceName, traceparent string) *Tracer {
+	t := &Tracer{exporter: exporter, serviceName: serviceName}
+	if traceID, parentID, ok := parseTraceparent(traceparent); ok {
+		t.traceID = traceID
+		t.remoteID = parentID
+	} else {
+		rand.Read(t.traceID[:])
+	}
+	return t
+}
+
+// newTracerFromEnv builds a tracer from the standard OpenTelemetry
+// environment variables. It returns nil when no endpoint is configured.
+func newTracerFromEnv() *Tracer {
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+		if base == "" {
+			return nil
+		}
+		endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+	}
+
+	serviceName := os.Getenv("OTEL_SERVICE_NAME")
+	if serviceName == "" {
+		serviceName = "wasm-fuzzer"
+	}
+
+	exporter := &OTLPHTTPExporter{
+		Endpoint: endpoint,
+		Headers:  parseOTLPHeaders(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS")),
+		Client:   &http.Client{Timeout: 10 * time.Second},
+	}
+	return NewTracer(exporter, serviceName, os.Getenv("TRACEPARENT"))
+}
+
+// Start opens a new span as a child of the innermost open span
+func (t *Tracer) Start(name string) *Span {
+	if t == nil {
+		return nil
+	}
+
+	span := &Span{tracer: t}
+	span.data.Name = name
+	span.data.TraceID = t.traceID
+	span.data.Start = time.Now()
+	rand.Read(span.data.SpanID[:])
+
+	if len(t.open) > 0 {
+		span.data.ParentID = t.open[len(t.open)-1].data.SpanID
+	} else {
+		span.data.ParentID = t.remoteID
+	}
+
+	t.open = append(t.open, span)
+	return span
+}
+
+// SetAttribute records a string attribute on the span
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+	s.data.Attributes = append(s.data.Attributes, [2]string{key, value})
+}
+
+// End finishes the span, marking it failed if err is non-nil. Any spans
+// opened after it that were never ended (e.g. due to a panic) are closed too.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	t := s.tracer
+
+	idx := -1
+	for i, open := range t.open {
+		if open == s {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		return
+	}
+
+	now := time.Now()
+	for i := len(t.open) - 1; i >= idx; i-- {
+		open := t.open[i]
+		open.data.End = now
+		if open == s {
+			open.data.Err = err
+		} else {
+			open.data.Err = fmt.Errorf("span not ended")
+		}
+		t.finished = append(t.finished, open.data)
+	}
+	t.open = t.open[:idx]
+
+	if len(t.finished) >= spanBatchSize {
+		t.flush()
+	}
+}
+
+// Shutdown ends any open spans and exports everything still buffered
+func (t *Tracer) Shutdown() {
+	if t == nil {
+		return
+	}
+	if len(t.open) > 0 {
+		t.open[0].End(nil)
+	}
+	t.flush()
+}
+
+// flush exports buffered spans. Export failures never fail the campaign;
+// the first one is reported on stderr.
+func (t *Tracer) flush() {
+	if len(t.finished) == 0 {
+		return
+	}
+	spans := t.finished
+	t.finished = nil
+
+	if err := t.exporter.ExportSpans(t.serviceName, spans); err != nil && t.exportErr == nil {
+		t.exportErr = err
+		errorResult := map[string]string{
+			"warning": "trace export failed",
+			"details": err.Error(),
+		}
+		json.NewEncoder(os.Stderr).Encode(errorResult)
+	}
+}
+
+// runStage runs one pipeline stage inside its own span
+func runStage(stage FailureStage, fn func() error) error {
+	stageStarted(stage)
+	span := tracer.Start(string(stage))
+	span.SetAttribute("wasm.stage", string(stage))
+	err := fn()
+	if err == nil {
+		err = stageFinished(stage)
+	}
+	span.End(err)
+	return err
+}
+
+// parseTraceparent parses a W3C traceparent header
+// (version-traceid-parentid-flags)
+func parseTraceparent(header string) ([16]byte, [8]byte, bool) {
+	var traceID [16]byte
+	var parentID [8]byte
+
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return traceID, parentID, false
+	}
+	if _, err := hex.Decode(traceID[:], []byte(parts[1])); err != nil {
+		return traceID, parentID, false
+	}
+	if _, err := hex.Decode(parentID[:], []byte(parts[2])); err != nil {
+		return traceID, parentID, false
+	}
+	if traceID == [16]byte{} {
+		return traceID, parentID, false
+	}
+	return traceID, parentID, true
+}
+
+// parseOTLPHeaders parses the comma-separated key=value header list used by
+// OTEL_EXPORTER_OTLP_HEADERS
+func parseOTLPHeaders(value string) map[string]string {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		key, val, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		headers[strings.TrimSpace(key)] = strings.TrimSpace(val)
+	}
+	return headers
+}
+
+// -----------------------------------------------------------------------------
+// OTLP/HTTP exporter
+// -----------------------------------------------------------------------------
+
+// OTLPHTTPExporter sends spans to an OTLP/HTTP endpoint using the JSON
+// protobuf encoding, which every OpenTelemetry collector accepts
+type OTLPHTTPExporter struct {
+	Endpoint string
+	Headers  map[string]string
+	Client   *http.Client
+}
+
+type otlpKeyValue struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpTraceRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+// OTLP span kind and status codes
+const (
+	otlpSpanKindInternal = 1
+	otlpStatusOK         = 1
+	otlpStatusError      = 2
+)
+
+func newOTLPKeyValue(key, value string) otlpKeyValue {
+	kv := otlpKeyValue{Key: key}
+	kv.Value.StringValue = value
+	return kv
+}
+
+// buildOTLPRequest converts spans into an OTLP ExportTraceServiceRequest
+func buildOTLPRequest(serviceName string, spans []SpanData) otlpTraceRequest {
+	scope := otlpScopeSpans{}
+	scope.Scope.Name = "wasm-fuzzer"
+
+	for _, s := range spans {
+		span := otlpSpan{
+			TraceID:           hex.EncodeToString(s.TraceID[:]),
+			SpanID:            hex.EncodeToString(s.SpanID[:]),
+			Name:              s.Name,
+			Kind:              otlpSpanKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+			Status:            otlpStatus{Code: otlpStatusOK},
+		}
+		if s.ParentID != [8]byte{} {
+			span.ParentSpanID = hex.EncodeToString(s.ParentID[:])
+		}
+		for _, attr := range s.Attributes {
+			span.Attributes = append(span.Attributes, newOTLPKeyValue(attr[0], attr[1]))
+		}
+		if s.Err != nil {
+			span.Status = otlpStatus{Code: otlpStatusError, Message: s.Err.Error()}
+		}
+		scope.Spans = append(scope.Spans, span)
+	}
+
+	resource := otlpResourceSpans{ScopeSpans: []otlpScopeSpans{scope}}
+	resource.Resource.Attributes = []otlpKeyValue{newOTLPKeyValue("service.name", serviceName)}
+	return otlpTraceRequest{ResourceSpans: []otlpResourceSpans{resource}}
+}
+
+// ExportSpans implements SpanExporter
+func (e *OTLPHTTPExporter) ExportSpans(serviceName string, spans []SpanData) error {
+	body, err := json.Marshal(buildOTLPRequest(serviceName, spans))
+	if err != nil {
+		return fmt.Errorf("failed to encode spans: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, e.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid OTLP endpoint: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range e.Headers {
+		req.Header.Set(key, value)
+	}
+
+	client := e.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("OTLP export failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("OTLP export failed: endpoint returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// -----------------------------------------------------------------------------
+// Capturing Exporter
+// -----------------------------------------------------------------------------
+
+// capturingExporter records exported spans in memory
+type capturingExporter struct {
+	spans []SpanData
+}
+
+func (e *capturingExporter) ExportSpans(serviceName string, spans []SpanData) error {
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func (e *capturingExporter) byName(name string) []SpanData {
+	var matched []SpanData
+	for _, s := range e.spans {
+		if s.Name == name {
+			matched = append(matched, s)
+		}
+	}
+	return matched
+}
+
+// useTracer installs a tracer for the duration of a test
+func useTracer(t *testing.T, traceparent string) *capturingExporter {
+	exporter := &capturingExporter{}
+	tracer = NewTracer(exporter, "test", traceparent)
+	t.Cleanup(func() { tracer = nil })
+	return exporter
+}
+
+// -----------------------------------------------------------------------------
+// TEST: Stage Span Hierarchy
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Spans are only useful for debugging distributed campaigns if each stage
+// is parented to the file that produced it, and failures carry the error.
+// -----------------------------------------------------------------------------
+
+func TestTracing_SpanHierarchy(t *testing.T) {
+	exporter := useTracer(t, "")
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "trap.wasm"), []byte("trap"), 0o644))
+
+	mockRuntime := &MockWasmRuntime{
+		LoadModuleFunc: func(filePath string) (WasmModule, error) {
+			// Emulate a staged runtime reporting its own stages
+			_ = runStage(StageLoad, func() error { return nil })
+			return &MockWasmModule{
+				ExecuteFunc: func(funcName string, args ...interface{}) ([]interface{}, error) {
+					return nil, errors.New("unreachable executed")
+				},
+			}, nil
+		},
+	}
+
+	_, err := runFuzzerWithRuntime(dir, mockRuntime)
+	require.NoError(t, err)
+	tracer.Shutdown()
+
+	campaign := exporter.byName("fuzz_campaign")
+	file := exporter.byName("process_file")
+	load := exporter.byName(string(StageLoad))
+	execute := exporter.byName(string(StageExecute))
+	require.Len(t, campaign, 1)
+	require.Len(t, file, 1)
+	require.Len(t, load, 1)
+	require.Len(t, execute, 1)
+
+	assert.Equal(t, campaign[0].SpanID, file[0].ParentID, "file span should be a child of the campaign")
+	assert.Equal(t, file[0].SpanID, load[0].ParentID, "stage spans should be children of the file")
+	assert.Equal(t, file[0].SpanID, execute[0].ParentID, "stage spans should be children of the file")
+	assert.EqualError(t, execute[0].Err, "unreachable executed")
+	assert.NoError(t, load[0].Err)
+}
+
+func TestTracing_PanicClosesStageSpans(t *testing.T) {
+	exporter := useTracer(t, "")
+
+	mockRuntime := &MockWasmRuntime{
+		LoadModuleFunc: func(filePath string) (WasmModule, error) {
+			return &MockWasmModule{
+				ExecuteFunc: func(funcName string, args ...interface{}) ([]interface{}, error) {
+					panic("runtime internal error")
+				},
+			}, nil
+		},
+	}
+
+	_ = processWasmFileWithRuntime("/test/panic.wasm", mockRuntime)
+	tracer.Shutdown()
+
+	require.Len(t, exporter.byName(string(StageExecute)), 1, "stage span must be closed by its parent")
+	file := exporter.byName("process_file")
+	require.Len(t, file, 1)
+	assert.ErrorContains(t, file[0].Err, "panic recovered")
+	assert.Empty(t, tracer.open, "no spans should remain open")
+}
+
+func TestTracing_JoinsRemoteTrace(t *testing.T) {
+	exporter := useTracer(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	span := tracer.Start("fuzz_campaign")
+	span.End(nil)
+	tracer.Shutdown()
+
+	require.Len(t, exporter.spans, 1)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", hex.EncodeToString(exporter.spans[0].TraceID[:]))
+	assert.Equal(t, "00f067aa0ba902b7", hex.EncodeToString(exporter.spans[0].ParentID[:]))
+}
+
+func TestTracing_NilTracerIsNoop(t *testing.T) {
+	tracer = nil
+
+	result := processWasmFileWithRuntime("/test/valid.wasm", &MockWasmRuntime{})
+
+	assert.True(t, result.Success, "pipeline must work without a tracer")
+}
+
+// -----------------------------------------------------------------------------
+// TEST: OTLP/HTTP Export
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Spans must arrive in a format an unmodified OpenTelemetry collector
+// accepts, otherwise the integration silently produces nothing.
+// -----------------------------------------------------------------------------
+
+func TestTracing_OTLPExport(t *testing.T) {
+	var received otlpTraceRequest
+	var contentType, authHeader string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		authHeader = r.Header.Get("Authorization")
+		body, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &received)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", server.URL)
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "Authorization=Bearer token")
+	t.Setenv("OTEL_SERVICE_NAME", "nightly-fuzz")
+	tracer = newTracerFromEnv()
+	t.Cleanup(func() { tracer = nil })
+
+	span := tracer.Start(string(StageValidate))
+	span.SetAttribute("wasm.file.path", "/corpus/a.wasm")
+	span.End(errors.New("validation failed"))
+	tracer.Shutdown()
+
+	assert.Equal(t, "application/json", contentType)
+	assert.Equal(t, "Bearer token", authHeader)
+	require.Len(t, received.ResourceSpans, 1)
+	assert.Equal(t, "nightly-fuzz", received.ResourceSpans[0].Resource.Attributes[0].Value.StringValue)
+
+	spans := received.ResourceSpans[0].ScopeSpans[0].Spans
+	require.Len(t, spans, 1)
+	assert.Equal(t, "validate", spans[0].Name)
+	assert.Len(t, spans[0].TraceID, 32)
+	assert.Len(t, spans[0].SpanID, 16)
+	assert.Equal(t, otlpStatusError, spans[0].Status.Code)
+	assert.Equal(t, "validation failed", spans[0].Status.Message)
+	assert.Equal(t, "wasm.file.path", spans[0].Attributes[0].Key)
+}
+
+func TestTracing_DisabledWithoutEndpoint(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+
+	assert.Nil(t, newTracerFromEnv())
+}
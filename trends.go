@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"time"
+)
+
+// TrendsReport follows a corpus across the campaigns of its history
+type TrendsReport struct {
+	// Campaigns are the campaigns looked at, oldest first
+	Campaigns []CampaignRecord `json:"campaigns"`
+	// Charts draws each series of the campaigns as a sparkline, oldest
+	// first: pass_rate, failures and mean_ms
+	Charts map[string]string `json:"charts"`
+	// PassRateChange and MeanChange compare the later half of the
+	// campaigns with the earlier one, showing drifts too slow for one
+	// report to show
+	PassRateChange float64 `json:"pass_rate_change"`
+	MeanChange     float64 `json:"mean_ms_change"`
+	// Slowdowns lists the modules that took longest in their latest
+	// campaign compared to the ones before, slowest first
+	Slowdowns []ModuleSlowdown `json:"slowdowns,omitempty"`
+	// Regressions lists the modules failing since a campaign after
+	// passing before, latest first
+	Regressions []ModuleRegression `json:"regressions,omitempty"`
+}
+
+// ModuleRegression is a module that started failing after passing
+type ModuleRegression struct {
+	Module       string    `json:"module"`
+	FilePath     string    `json:"file_path"`
+	FailingSince time.Time `json:"failing_since"`
+}
+
+// ModuleSlowdown is a module that took longer in its latest campaign than
+// it used to
+type ModuleSlowdown struct {
+	Module   string `json:"module"`
+	FilePath string `json:"file_path"`
+	// BaselineMillis is the median of the module's earlier campaigns
+	BaselineMillis float64 `json:"baseline_ms"`
+	LatestMillis   float64 `json:"latest_ms"`
+	Factor         float64 `json:"factor"`
+}
+
+// minSlowdownTimings is how many earlier timings a module needs before it
+// can be found slower
+const minSlowdownTimings = 3
+
+// minSlowdownMillis is the least baseline a module's latest timing is
+// compared to, so modules running in next to no time are not found slower
+// by noise
+const minSlowdownMillis = 1.0
+
+// sparkBars are the bars of a sparkline, lowest first
+var sparkBars = []rune("▁▂▃▄▅▆▇█")
+
+// analyzeTrends follows the latest campaigns of a history, at most last
+// when positive, and finds the modules whose latest campaign took at least
+// slowdown times their median
+func analyzeTrends(history historyFile, last int, slowdown float64) TrendsReport {
+	campaigns := history.Campaigns
+	if last > 0 && len(campaigns) > last {
+		campaigns = campaigns[len(campaigns)-last:]
+	}
+	report := TrendsReport{Campaigns: campaigns, Charts: make(map[string]string)}
+	passRates := make([]float64, len(campaigns))
+	failures := make([]float64, len(campaigns))
+	means := make([]float64, len(campaigns))
+	for i, campaign := range campaigns {
+		passRates[i] = campaign.passRate()
+		failures[i] = float64(campaign.Results - campaign.Passed)
+		means[i] = campaign.MeanMillis
+	}
+	report.Charts["pass_rate"] = sparkline(passRates)
+	report.Charts["failures"] = sparkline(failures)
+	report.Charts["mean_ms"] = sparkline(means)
+	report.PassRateChange = halvesChange(passRates)
+	report.MeanChange = halvesChange(means)
+
+	for hash, module := range history.Modules {
+		if module.FailingSince != nil {
+			report.Regressions = append(report.Regressions, ModuleRegression{Module: hash, FilePath: module.FilePath, FailingSince: *module.FailingSince})
+		}
+		if len(module.Millis) <= minSlowdownTimings {
+			continue
+		}
+		latest := module.Millis[len(module.Millis)-1]
+		baseline := median(module.Millis[:len(module.Millis)-1])
+		// Below a millisecond, timings are noise
+		floor := math.Max(baseline, minSlowdownMillis)
+		if latest < floor*slowdown {
+			continue
+		}
+		report.Slowdowns = append(report.Slowdowns, ModuleSlowdown{
+			Module:         hash,
+			FilePath:       module.FilePath,
+			BaselineMillis: baseline,
+			LatestMillis:   latest,
+			Factor:         latest / floor,
+		})
+	}
+	sort.Slice(report.Regressions, func(i, j int) bool {
+		a, b := report.Regressions[i], report.Regressions[j]
+		if !a.FailingSince.Equal(b.FailingSince) {
+			return a.FailingSince.After(b.FailingSince)
+		}
+		return a.FilePath < b.FilePath
+	})
+	sort.Slice(report.Slowdowns, func(i, j int) bool {
+		if report.Slowdowns[i].Factor != report.Slowdowns[j].Factor {
+			return report.Slowdowns[i].Factor > report.Slowdowns[j].Factor
+		}
+		return report.Slowdowns[i].FilePath < report.Slowdowns[j].FilePath
+	})
+	return report
+}
+
+// sparkline draws values as bars scaled between their least and greatest
+func sparkline(values []float64) string {
+	if len(values) == 0 {
+		return ""
+	}
+	low, high := values[0], values[0]
+	for _, v := range values {
+		low, high = math.Min(low, v), math.Max(high, v)
+	}
+	bars := make([]rune, len(values))
+	for i, v := range values {
+		level := len(sparkBars) / 2
+		if high > low {
+			level = int(math.Round((v - low) / (high - low) * float64(len(sparkBars)-1)))
+		}
+		bars[i] = sparkBars[level]
+	}
+	return string(bars)
+}
+
+// halvesChange is the mean of the later half of values less the mean of
+// the earlier half; an odd middle value counts for neither
+func halvesChange(values []float64) float64 {
+	half := len(values) / 2
+	if half == 0 {
+		return 0
+	}
+	return mean(values[len(values)-half:]) - mean(values[:half])
+}
+
+func mean(values []float64) float64 {
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
+
+// runTrendsCommand follows the campaigns of a history over time
+func runTrendsCommand(args []string) int {
+	flags := flag.NewFlagSet("trends", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	configPath := flags.String("config", "", "path to a YAML config file naming the history")
+	historyPath := flags.String("history", "", "path to the history, instead of the config's")
+	last := flags.Int("last", 0, "follow only the latest n campaigns")
+	slowdown := flags.Float64("slowdown", 1.5, "how many times its median a module's latest timing must be to be slower")
+
+	if err := flags.Parse(args); err != nil || flags.NArg() != 0 {
+		emitError(map[string]string{
+			"error": "usage: wasm-fuzzer trends [--config file.yaml] [--history file.json] [--last n] [--slowdown 1.5]",
+		})
+		return 1
+	}
+	if *last < 0 || *slowdown <= 1 {
+		emitError(map[string]string{
+			"error":   "invalid trends settings",
+			"details": fmt.Sprintf("--last must not be negative and --slowdown must be over 1, got %d and %g", *last, *slowdown),
+		})
+		return 1
+	}
+	path := *historyPath
+	if path == "" {
+		config, err := resolveConfig(*configPath)
+		if err != nil {
+			emitError(map[string]string{
+				"error":   "config load failed",
+				"details": err.Error(),
+			})
+			return 1
+		}
+		path = config.History
+	}
+	if path == "" {
+		emitError(map[string]string{
+			"error":   "no history",
+			"details": "pass --history, or a config whose history names one",
+		})
+		return 1
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		emitError(map[string]string{
+			"error":   "history load failed",
+			"path":    path,
+			"details": err.Error(),
+		})
+		return 1
+	}
+	var history historyFile
+	if err := json.Unmarshal(data, &history); err != nil {
+		emitError(map[string]string{
+			"error":   "history load failed",
+			"path":    path,
+			"details": err.Error(),
+		})
+		return 1
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(analyzeTrends(history, *last, *slowdown)); err != nil {
+		emitError(map[string]string{
+			"error":   "failed to encode JSON output",
+			"details": err.Error(),
+		})
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,105 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// -----------------------------------------------------------------------------
+// TEST: Campaign Trends
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// A module taking a little longer each night, or a pass rate slipping by
+// a file a week, never stands out in a single report. Only the history of
+// campaigns side by side shows the drift, and the modules behind it.
+// -----------------------------------------------------------------------------
+
+func TestTrends_FollowsCampaigns(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.wasm", "b.wasm", "c.wasm"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(name), 0o644))
+	}
+	historyPath := filepath.Join(t.TempDir(), "history.json")
+
+	campaign := 0
+	runtime := &MockWasmRuntime{LoadModuleFunc: func(filePath string) (WasmModule, error) {
+		switch name := filepath.Base(filePath); {
+		case name == "a.wasm" && campaign == 3:
+			time.Sleep(30 * time.Millisecond)
+		case name == "b.wasm" && campaign == 3:
+			return nil, errors.New("invalid magic")
+		case name == "c.wasm":
+			return nil, errors.New("invalid magic")
+		}
+		return &MockWasmModule{}, nil
+	}}
+	for campaign = 0; campaign < 4; campaign++ {
+		_, err := runFuzzerWithMatrix(dir, []environmentRuntime{{Runtime: runtime}}, RunOptions{History: historyPath})
+		require.NoError(t, err)
+	}
+
+	stdout := captureStdout(t, func() {
+		assert.Equal(t, 0, runTrendsCommand([]string{"--history", historyPath}))
+	})
+	var trends TrendsReport
+	require.NoError(t, json.Unmarshal(stdout, &trends))
+
+	require.Len(t, trends.Campaigns, 4)
+	latest := trends.Campaigns[3]
+	assert.Equal(t, 3, latest.Results)
+	assert.Equal(t, 1, latest.Passed)
+	assert.Equal(t, map[FailureStage]int{StageLoad: 2}, latest.Failures)
+	assert.Equal(t, "███▁", trends.Charts["pass_rate"], "a bar per campaign")
+	assert.Equal(t, "▁▁▁█", trends.Charts["failures"])
+	assert.InDelta(t, -1.0/6, trends.PassRateChange, 1e-9, "the later campaigns pass less")
+	assert.Greater(t, trends.MeanChange, 0.0)
+
+	require.Len(t, trends.Slowdowns, 1)
+	assert.Equal(t, filepath.Join(dir, "a.wasm"), trends.Slowdowns[0].FilePath)
+	assert.GreaterOrEqual(t, trends.Slowdowns[0].LatestMillis, 30.0)
+	require.Len(t, trends.Regressions, 1, "a module failing from the start is no regression")
+	assert.Equal(t, filepath.Join(dir, "b.wasm"), trends.Regressions[0].FilePath)
+	assert.True(t, trends.Regressions[0].FailingSince.Equal(latest.Started))
+
+	stdout = captureStdout(t, func() {
+		assert.Equal(t, 0, runTrendsCommand([]string{"--history", historyPath, "--last", "2"}))
+	})
+	require.NoError(t, json.Unmarshal(stdout, &trends))
+	assert.Len(t, trends.Campaigns, 2)
+}
+
+func TestTrends_Charts(t *testing.T) {
+	assert.Equal(t, "▁▂█", sparkline([]float64{0, 0.2, 1}))
+	assert.Equal(t, "▅▅", sparkline([]float64{3, 3}), "a flat series sits in the middle")
+	assert.Empty(t, sparkline(nil))
+	assert.Equal(t, 2.0, halvesChange([]float64{1, 100, 3}), "the middle counts for neither half")
+	assert.Zero(t, halvesChange([]float64{1}))
+}
+
+func TestTrends_RejectsBadSettings(t *testing.T) {
+	stderr := captureStderr(t, func() {
+		assert.Equal(t, 1, runTrendsCommand(nil))
+	})
+	assert.Contains(t, string(stderr), "no history")
+
+	stderr = captureStderr(t, func() {
+		assert.Equal(t, 1, runTrendsCommand([]string{"--history", "h.json", "--slowdown", "1"}))
+	})
+	assert.Contains(t, string(stderr), "--slowdown must be over 1")
+
+	stderr = captureStderr(t, func() {
+		assert.Equal(t, 1, runTrendsCommand([]string{"--history", filepath.Join(t.TempDir(), "missing.json")}))
+	})
+	assert.Contains(t, string(stderr), "history load failed")
+}
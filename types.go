@@ -8,24 +8,207 @@ const (
 	StageLoad        FailureStage = "load"
 	StageValidate    FailureStage = "validate"
 	StageInstantiate FailureStage = "instantiate"
+	StageSignature   FailureStage = "signature"
 	StageExecute     FailureStage = "execute"
 )
 
+// SkipReason says why a file was not run
+type SkipReason string
+
+const (
+	// SkipFiltered is a file excluded by the corpus filters
+	SkipFiltered SkipReason = "filtered"
+	// SkipUnsupportedFeature is a module needing a proposal the
+	// environment leaves disabled
+	SkipUnsupportedFeature SkipReason = "unsupported_feature"
+	// SkipOverSizeLimit is a file larger than the configured limit
+	SkipOverSizeLimit SkipReason = "over_size_limit"
+	// SkipDuplicate is a file with the same content as an earlier one
+	SkipDuplicate SkipReason = "duplicate"
+	// SkipAborted is a file left unrun when the campaign was aborted
+	SkipAborted SkipReason = "aborted"
+	// SkipUnchanged is a file unchanged since the ref of an incremental
+	// run, with no cached result to report
+	SkipUnchanged SkipReason = "unchanged"
+	// SkipOverBudget is a file left unrun when a time-boxed campaign ran
+	// out of time
+	SkipOverBudget SkipReason = "over_budget"
+	// SkipCrashLoop is a file left unrun when its environment's worker
+	// kept dying before running anything
+	SkipCrashLoop SkipReason = "crash_loop"
+)
+
 // ExecutionResult holds the structured result for a single WASM file
 type ExecutionResult struct {
-	FilePath     string        `json:"file_path"`
-	FileName     string        `json:"file_name"`
-	Success      bool          `json:"success"`
-	FailureStage FailureStage  `json:"failure_stage"`
-	ErrorMessage string        `json:"error_message,omitempty"`
+	SchemaVersion int    `json:"schema_version"`
+	FilePath      string `json:"file_path"`
+	FileName      string `json:"file_name"`
+	Success       bool   `json:"success"`
+	// Skipped is set for files that were not run, with the reason why.
+	// SkipDetails explains the reason, such as the proposals missing.
+	Skipped      bool         `json:"skipped,omitempty"`
+	SkipReason   SkipReason   `json:"skip_reason,omitempty"`
+	SkipDetails  string       `json:"skip_details,omitempty"`
+	FailureStage FailureStage `json:"failure_stage"`
+	// FailureSubStage narrows down the failure stage, such as "lifecycle"
+	// for a WASI module's _start or _initialize
+	FailureSubStage string `json:"failure_sub_stage,omitempty"`
+	ErrorMessage    string `json:"error_message,omitempty"`
+	// ErrorCode is the stable code of the failure, such as E_LOAD_MAGIC
+	ErrorCode    ErrorCode     `json:"error_code,omitempty"`
 	ReturnValues []interface{} `json:"return_values,omitempty"`
+	// TypedReturnValues is the lossless encoding of ReturnValues
+	TypedReturnValues []WasmValue `json:"typed_return_values,omitempty"`
+	// StartFailure is the error of a start function that was skipped or
+	// isolated from instantiation
+	StartFailure string `json:"start_failure,omitempty"`
+	// Environment names the matrix environment the file ran under
+	Environment string `json:"environment,omitempty"`
+	// Invocations lists each entry call when a setup export or several
+	// inputs are configured
+	Invocations []InvocationResult `json:"invocations,omitempty"`
+	// ArgFuzz summarizes argument-fuzzing mode
+	ArgFuzz *ArgFuzzSummary `json:"arg_fuzz,omitempty"`
+	// Sequence summarizes sequence-fuzzing mode
+	Sequence *SequenceSummary `json:"sequence,omitempty"`
+	// Properties reports the properties checked, when configured
+	Properties []PropertyResult `json:"properties,omitempty"`
+	// Coverage reports edge coverage when instrumentation is enabled
+	Coverage *CoverageSummary `json:"coverage,omitempty"`
+	// Stdout and Stderr hold what the module wrote to them while the file
+	// ran, cut after outputLimit bytes each
+	Stdout string `json:"stdout,omitempty"`
+	Stderr string `json:"stderr,omitempty"`
+	// Log holds the messages the module passed to the host's log import,
+	// one per line, cut like Stdout
+	Log string `json:"log,omitempty"`
+	// Proxies reports the calls made through proxied host functions
+	Proxies []ProxySummary `json:"proxies,omitempty"`
+	// ResourceProblems lists the runtime objects the file leaked or
+	// released twice, when resources are debugged
+	ResourceProblems []ResourceProblem `json:"resource_problems,omitempty"`
+	// SanitizerReport is the report, verbatim, of the sanitizer that took
+	// the file's worker down when the runtime is built with one
+	SanitizerReport string `json:"sanitizer_report,omitempty"`
+	// Crash describes how the worker that ran the file crashed
+	Crash *CrashInfo `json:"crash,omitempty"`
+	// CrashBundle is the directory keeping the module and core dump of a
+	// worker that crashed on the file, when crashes are kept
+	CrashBundle string `json:"crash_bundle,omitempty"`
+	// Tampering lists the globals and table slots overridden before the
+	// module was loaded
+	Tampering []TamperAction `json:"tampering,omitempty"`
+	// Chaos is the chaos profile the file ran under
+	Chaos *ChaosProfile `json:"chaos,omitempty"`
+	// Injection compares the file's run to its clean run, when compared
+	Injection *InjectionEffect `json:"injection_effect,omitempty"`
+	// Quarantined is set for modules in the quarantine, whose outcome is
+	// not reproducible. FlakyOutcomes are the outcomes that got a module
+	// quarantined by this campaign.
+	Quarantined   bool     `json:"quarantined,omitempty"`
+	FlakyOutcomes []string `json:"flaky_outcomes,omitempty"`
+	// Nondeterminism describes how the reruns of a file run several times
+	// differed from its first run
+	Nondeterminism []string `json:"nondeterminism,omitempty"`
+	// Taint reports the host data that reached sinks, when tracked
+	Taint *TaintReport `json:"taint,omitempty"`
+	// Intercept reports the calls inside the module routed through the
+	// hook, when intercepted
+	Intercept *InterceptReport `json:"intercept,omitempty"`
+	// Cached is set for results reused from the cache instead of run
+	Cached bool `json:"cached,omitempty"`
+	// Classification buckets a failure for triage
+	Classification *Classification `json:"classification,omitempty"`
+	// Owners are the teams owning the file, as the corpus's OWNERS file
+	// says
+	Owners []string `json:"owners,omitempty"`
+	// Labels are set by result middleware, such as the team owning the
+	// module
+	Labels map[string]string `json:"labels,omitempty"`
+	// RedactedOriginal names the file in the originals store holding the
+	// result as it was before redaction
+	RedactedOriginal string `json:"redacted_original,omitempty"`
+}
+
+// InvocationResult holds the outcome of a single call to the entry function
+type InvocationResult struct {
+	Args              []WasmValue   `json:"args"`
+	Success           bool          `json:"success"`
+	ErrorMessage      string        `json:"error_message,omitempty"`
+	ErrorCode         ErrorCode     `json:"error_code,omitempty"`
+	ReturnValues      []interface{} `json:"return_values,omitempty"`
+	TypedReturnValues []WasmValue   `json:"typed_return_values,omitempty"`
+	// Stdout, Stderr and Log hold what the module wrote and logged during
+	// this call
+	Stdout string `json:"stdout,omitempty"`
+	Stderr string `json:"stderr,omitempty"`
+	Log    string `json:"log,omitempty"`
 }
 
 // FuzzingReport holds the complete report for all processed files
 type FuzzingReport struct {
+	SchemaVersion int                  `json:"schema_version"`
 	TotalFiles    int                  `json:"total_files"`
 	Passed        int                  `json:"passed"`
 	Failed        int                  `json:"failed"`
+	Skipped       int                  `json:"skipped"`
 	Results       []ExecutionResult    `json:"results"`
 	FailureCounts map[FailureStage]int `json:"failure_counts"`
+	SkipCounts    map[SkipReason]int   `json:"skip_counts"`
+	// SeverityCounts counts the failed results of each severity
+	SeverityCounts map[Severity]int `json:"severity_counts,omitempty"`
+	// CrashBuckets groups the crashes of isolated workers by signal,
+	// frame and faulting address
+	CrashBuckets []CrashBucket `json:"crash_buckets,omitempty"`
+	// Selection records the shuffling and sampling of the corpus, if any
+	Selection *CorpusSelection `json:"selection,omitempty"`
+	// StopAfter is the last stage run when the pipeline was truncated
+	StopAfter FailureStage `json:"stop_after,omitempty"`
+	// Memory tracks process memory over the campaign when enabled
+	Memory *MemorySummary `json:"memory,omitempty"`
+	// Sweep records the throughput of a validation sweep
+	Sweep *SweepSummary `json:"sweep,omitempty"`
+	// Shard is set on the report of one shard of a sharded campaign
+	Shard *ShardInfo `json:"shard,omitempty"`
+	// Environments and EnvironmentDivergences are set for matrix campaigns
+	Environments           []EnvironmentSummary    `json:"environments,omitempty"`
+	EnvironmentDivergences []EnvironmentDivergence `json:"environment_divergences,omitempty"`
+	// InjectionDifferences lists the files the injections changed the
+	// behavior of, when runs are compared to clean ones
+	InjectionDifferences []InjectionDifference `json:"injection_differences,omitempty"`
+	// Nondeterministic lists the files whose runs differed, when every
+	// file runs several times
+	Nondeterministic []NondeterministicModule `json:"nondeterministic,omitempty"`
+	// Quarantine counts the results of quarantined modules apart, when a
+	// quarantine is kept
+	Quarantine *QuarantineSummary `json:"quarantine,omitempty"`
+	// Expectations compares the results to the corpus's expectations
+	// file, when it has one
+	Expectations *ExpectationSummary `json:"expectations,omitempty"`
+	// Cache counts the results reused from the cache, when one is kept
+	Cache *CacheSummary `json:"cache,omitempty"`
+	// Aborted says why the campaign stopped early. The files it left
+	// unrun are skipped as aborted.
+	Aborted string `json:"aborted,omitempty"`
+	// Budget reports how much of the corpus a time-boxed campaign ran.
+	// The files it left unrun are skipped as over_budget.
+	Budget *BudgetSummary `json:"budget,omitempty"`
+	// WorkerRestarts counts the isolated workers started again after one
+	// died, and CrashLoops the workers given up on
+	WorkerRestarts int         `json:"worker_restarts,omitempty"`
+	CrashLoops     []CrashLoop `json:"crash_loops,omitempty"`
+	// Config is the config the campaign ran with, resolved from its file,
+	// the environment and the flags
+	Config map[string]interface{} `json:"config,omitempty"`
+	// Team is the team a team's report is for, which only has the results
+	// of the files it owns
+	Team string `json:"team,omitempty"`
+	// Owners counts the results of each team owning files
+	Owners []TeamSummary `json:"owners,omitempty"`
+	// FilteredOut counts the results result middleware left out. The
+	// totals and counts do not cover them.
+	FilteredOut int `json:"filtered_out,omitempty"`
+	// Filter records how the results were slimmed, when they were. Its
+	// totals and counts still cover every result.
+	Filter *ResultFilter `json:"filter,omitempty"`
 }
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// SchemaVersion is the version of the JSON layout emitted for results and
+// reports. Version 1 is the original, unversioned layout; version 3 adds
+// the signature failure stage, version 4 skipped results and version 5
+// the optional summaries of later features. Bump it, with a migration in
+// reportMigrations, whenever a field is added to either.
+const SchemaVersion = 5
+
+// WasmValue is the canonical, lossless JSON encoding of a single WASM value.
+// Integers are encoded as decimal strings so i64 values above 2^53 survive a
+// JSON round-trip, and floats are encoded as their raw IEEE-754 bits in hex
+// so NaN payloads and signed zeros are preserved exactly.
+type WasmValue struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// v128Value matches the WasmEdge V128 type without importing the SDK
+type v128Value interface {
+	GetVal() (uint64, uint64)
+}
+
+// encodeValue converts a runtime value into its canonical encoding
+func encodeValue(v interface{}) WasmValue {
+	switch val := v.(type) {
+	case int32:
+		return WasmValue{Type: "i32", Value: strconv.FormatInt(int64(val), 10)}
+	case uint32:
+		return WasmValue{Type: "i32", Value: strconv.FormatInt(int64(int32(val)), 10)}
+	case int64:
+		return WasmValue{Type: "i64", Value: strconv.FormatInt(val, 10)}
+	case uint64:
+		return WasmValue{Type: "i64", Value: strconv.FormatInt(int64(val), 10)}
+	case float32:
+		return WasmValue{Type: "f32", Value: fmt.Sprintf("0x%08x", math.Float32bits(val))}
+	case float64:
+		return WasmValue{Type: "f64", Value: fmt.Sprintf("0x%016x", math.Float64bits(val))}
+	case bufferArg:
+		return val.source
+	case witArg:
+		return val.encode()
+	case v128Value:
+		high, low := val.GetVal()
+		return WasmValue{Type: "v128", Value: fmt.Sprintf("0x%016x%016x", high, low)}
+	default:
+		return WasmValue{Type: "unknown", Value: fmt.Sprintf("%T(%v)", v, v)}
+	}
+}
+
+// encodeValues converts a slice of runtime values into canonical encodings
+func encodeValues(values []interface{}) []WasmValue {
+	if len(values) == 0 {
+		return nil
+	}
+	encoded := make([]WasmValue, len(values))
+	for i, v := range values {
+		encoded[i] = encodeValue(v)
+	}
+	return encoded
+}
+
+// plainValues replaces the floats JSON has no number for, NaN and the
+// infinities, with "NaN", "+Inf" and "-Inf", so one such return value
+// cannot fail the encoding of a whole report
+func plainValues(values []interface{}) []interface{} {
+	var plain []interface{}
+	for i, v := range values {
+		var f float64
+		switch val := v.(type) {
+		case float32:
+			f = float64(val)
+		case float64:
+			f = val
+		default:
+			continue
+		}
+		if !math.IsNaN(f) && !math.IsInf(f, 0) {
+			continue
+		}
+		if plain == nil {
+			plain = append([]interface{}(nil), values...)
+		}
+		plain[i] = strconv.FormatFloat(f, 'g', -1, 64)
+		if math.IsInf(f, 1) {
+			plain[i] = "+Inf"
+		}
+	}
+	if plain == nil {
+		return values
+	}
+	return plain
+}
+
+// MarshalJSON encodes a result with its return values made plain
+func (r ExecutionResult) MarshalJSON() ([]byte, error) {
+	type result ExecutionResult
+	plain := result(r)
+	plain.ReturnValues = plainValues(r.ReturnValues)
+	return json.Marshal(plain)
+}
+
+// MarshalJSON encodes an invocation with its return values made plain
+func (r InvocationResult) MarshalJSON() ([]byte, error) {
+	type invocation InvocationResult
+	plain := invocation(r)
+	plain.ReturnValues = plainValues(r.ReturnValues)
+	return json.Marshal(plain)
+}
+
+// decodeValue converts a canonical encoding back into a Go scalar.
+// v128 values are returned as a [2]uint64{high, low} pair.
+func decodeValue(v WasmValue) (interface{}, error) {
+	switch v.Type {
+	case "i32":
+		n, err := strconv.ParseInt(v.Value, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid i32 value %q: %w", v.Value, err)
+		}
+		return int32(n), nil
+	case "i64":
+		n, err := strconv.ParseInt(v.Value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid i64 value %q: %w", v.Value, err)
+		}
+		return n, nil
+	case "f32":
+		bits, err := parseHexBits(v.Value, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid f32 bits %q: %w", v.Value, err)
+		}
+		return math.Float32frombits(uint32(bits)), nil
+	case "f64":
+		bits, err := parseHexBits(v.Value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid f64 bits %q: %w", v.Value, err)
+		}
+		return math.Float64frombits(bits), nil
+	case "v128":
+		digits := strings.TrimPrefix(v.Value, "0x")
+		if len(digits) != 32 {
+			return nil, fmt.Errorf("invalid v128 value %q: expected 32 hex digits", v.Value)
+		}
+		high, err := strconv.ParseUint(digits[:16], 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid v128 value %q: %w", v.Value, err)
+		}
+		low, err := strconv.ParseUint(digits[16:], 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid v128 value %q: %w", v.Value, err)
+		}
+		return [2]uint64{high, low}, nil
+	default:
+		return nil, fmt.Errorf("unsupported value type %q", v.Type)
+	}
+}
+
+// parseHexBits parses a 0x-prefixed hex bit pattern of the given width
+func parseHexBits(s string, bitSize int) (uint64, error) {
+	if !strings.HasPrefix(s, "0x") {
+		return 0, fmt.Errorf("missing 0x prefix")
+	}
+	return strconv.ParseUint(s[2:], 16, bitSize)
+}
@@ -0,0 +1,156 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// -----------------------------------------------------------------------------
+// TEST: Canonical Value Encoding
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// JSON numbers are decoded as float64 by most consumers, which silently
+// corrupts i64 values above 2^53 and cannot represent NaN payloads or -0.
+// The canonical encoding must round-trip every value bit-for-bit.
+// -----------------------------------------------------------------------------
+
+func TestValueEncoding_RoundTrip(t *testing.T) {
+	testCases := []struct {
+		name     string
+		value    interface{}
+		expected WasmValue
+	}{
+		{
+			name:     "i32_negative",
+			value:    int32(-7),
+			expected: WasmValue{Type: "i32", Value: "-7"},
+		},
+		{
+			name:     "i64_above_2_pow_53",
+			value:    int64(math.MaxInt64),
+			expected: WasmValue{Type: "i64", Value: "9223372036854775807"},
+		},
+		{
+			name:     "f32_nan_payload",
+			value:    math.Float32frombits(0x7fc00123),
+			expected: WasmValue{Type: "f32", Value: "0x7fc00123"},
+		},
+		{
+			name:     "f64_negative_zero",
+			value:    math.Copysign(0, -1),
+			expected: WasmValue{Type: "f64", Value: "0x8000000000000000"},
+		},
+		{
+			name:     "f64_nan_payload",
+			value:    math.Float64frombits(0x7ff8000000000abc),
+			expected: WasmValue{Type: "f64", Value: "0x7ff8000000000abc"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			encoded := encodeValue(tc.value)
+			assert.Equal(t, tc.expected, encoded)
+
+			// Survive a JSON round-trip without loss
+			data, err := json.Marshal(encoded)
+			require.NoError(t, err)
+			var parsed WasmValue
+			require.NoError(t, json.Unmarshal(data, &parsed))
+
+			decoded, err := decodeValue(parsed)
+			require.NoError(t, err)
+			assert.Equal(t, encodeValue(decoded), encoded, "decoded value should re-encode identically")
+		})
+	}
+}
+
+func TestValueEncoding_V128(t *testing.T) {
+	encoded := encodeValue(fakeV128{high: 0x0102030405060708, low: 0xa0b0c0d0e0f00010})
+	assert.Equal(t, WasmValue{Type: "v128", Value: "0x0102030405060708a0b0c0d0e0f00010"}, encoded)
+
+	decoded, err := decodeValue(encoded)
+	require.NoError(t, err)
+	assert.Equal(t, [2]uint64{0x0102030405060708, 0xa0b0c0d0e0f00010}, decoded)
+}
+
+func TestValueEncoding_InvalidInput(t *testing.T) {
+	invalid := []WasmValue{
+		{Type: "i32", Value: "4294967296"},
+		{Type: "i64", Value: "not-a-number"},
+		{Type: "f32", Value: "7fc00000"},
+		{Type: "f64", Value: "0xzz"},
+		{Type: "v128", Value: "0x00"},
+		{Type: "externref", Value: "1"},
+	}
+
+	for _, v := range invalid {
+		_, err := decodeValue(v)
+		assert.Error(t, err, "should reject %s %q", v.Type, v.Value)
+	}
+}
+
+func TestValueEncoding_PopulatedInResult(t *testing.T) {
+	mockModule := &MockWasmModule{
+		ExecuteFunc: func(funcName string, args ...interface{}) ([]interface{}, error) {
+			return []interface{}{int64(1) << 60, float32(1.5)}, nil
+		},
+	}
+
+	mockRuntime := &MockWasmRuntime{
+		LoadModuleFunc: func(filePath string) (WasmModule, error) {
+			return mockModule, nil
+		},
+	}
+
+	result := processWasmFileWithRuntime("/test/typed.wasm", mockRuntime)
+
+	require.True(t, result.Success)
+	assert.Equal(t, SchemaVersion, result.SchemaVersion)
+	assert.Equal(t, []WasmValue{
+		{Type: "i64", Value: "1152921504606846976"},
+		{Type: "f32", Value: "0x3fc00000"},
+	}, result.TypedReturnValues)
+}
+
+// fakeV128 mimics the WasmEdge V128 accessor
+type fakeV128 struct {
+	high, low uint64
+}
+
+func (v fakeV128) GetVal() (uint64, uint64) {
+	return v.high, v.low
+}
+
+func TestValueEncoding_NonFiniteFloatsInReport(t *testing.T) {
+	returns := []interface{}{float32(math.NaN()), math.Inf(1), math.Inf(-1), int32(7)}
+	result := ExecutionResult{
+		SchemaVersion:     SchemaVersion,
+		FilePath:          "nan.wasm",
+		Success:           true,
+		ReturnValues:      returns,
+		TypedReturnValues: encodeValues(returns),
+		Invocations:       []InvocationResult{{Success: true, ReturnValues: returns}},
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, encodeReport(&out, FuzzingReport{SchemaVersion: SchemaVersion, Results: []ExecutionResult{result}}),
+		"one NaN must not cost the campaign its report")
+	decoded, _, err := decodeReport(out.Bytes())
+	require.NoError(t, err)
+	// Numbers come back as written, so 64-bit integers are not rounded
+	want := []interface{}{"NaN", "+Inf", "-Inf", json.Number("7")}
+	assert.Equal(t, want, decoded.Results[0].ReturnValues)
+	assert.Equal(t, want, decoded.Results[0].Invocations[0].ReturnValues)
+	assert.Equal(t, "0x7fc00000", decoded.Results[0].TypedReturnValues[0].Value, "the typed values keep the bits")
+	assert.True(t, math.IsNaN(float64(returns[0].(float32))), "the result itself is left alone")
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+)
+
+// wasiModule is the import module of WASI preview 1
+const wasiModule = "wasi_snapshot_preview1"
+
+// WASI errno values returned by the minimal host
+const (
+	wasiSuccess = 0
+	wasiEBADF   = 8
+	wasiEINVAL  = 28
+	wasiENOSYS  = 52
+	wasiENOTSUP = 58
+)
+
+// wasiMaxRandom caps the bytes one random_get call can request
+const wasiMaxRandom = 1 << 20
+
+// wasiClock is the time the clocks report, in nanoseconds since the epoch.
+// It is fixed so runs are reproducible.
+const wasiClock = 1_700_000_000_000_000_000
+
+// wasiFiletypeCharacterDevice is the file type of stdin, stdout and stderr
+const wasiFiletypeCharacterDevice = 2
+
+// wasiExit is the error of a module calling proc_exit, which ends
+// execution like a trap
+type wasiExit struct {
+	code uint32
+}
+
+func (e *wasiExit) Error() string {
+	return fmt.Sprintf("proc_exit(%d)", e.code)
+}
+
+// minimalWASI implements the subset of WASI preview 1 that plugin hosts
+// such as Envoy provide: no arguments, environment or preopened files,
+// output to stdout and stderr passed to output or discarded, a fixed clock
+// and seeded randomness. Other WASI imports are left for the runtime to
+// report.
+type minimalWASI struct {
+	memory *hostMemory
+	rng    *rand.Rand
+	// output receives writes to stdout and stderr when set, up to
+	// outputLimit bytes per buffer
+	output func(fd int, data []byte)
+}
+
+func newMinimalWASI(memory *hostMemory) *minimalWASI {
+	return &minimalWASI{memory: memory, rng: rand.New(rand.NewSource(0))}
+}
+
+// functions returns the WASI functions by name
+func (w *minimalWASI) functions() map[string]nativeFunction {
+	success := func(err error) ([]interface{}, error) {
+		return []interface{}{int32(wasiSuccess)}, err
+	}
+	fail := func(code int32) []interface{} { return []interface{}{code} }
+	empty := func(args []uint64) ([]interface{}, error) {
+		err := w.memory.writeU32(args[0], 0)
+		if err == nil {
+			err = w.memory.writeU32(args[1], 0)
+		}
+		return success(err)
+	}
+	none := func(args []uint64) ([]interface{}, error) { return success(nil) }
+	badf := func(args []uint64) ([]interface{}, error) { return fail(wasiEBADF), nil }
+
+	return map[string]nativeFunction{
+		"args_sizes_get":    {funcSig("i32 i32", "i32"), empty},
+		"args_get":          {funcSig("i32 i32", "i32"), none},
+		"environ_sizes_get": {funcSig("i32 i32", "i32"), empty},
+		"environ_get":       {funcSig("i32 i32", "i32"), none},
+		"clock_time_get": {funcSig("i32 i64 i32", "i32"), func(args []uint64) ([]interface{}, error) {
+			return success(w.memory.writeU64(args[2], wasiClock))
+		}},
+		"clock_res_get": {funcSig("i32 i32", "i32"), func(args []uint64) ([]interface{}, error) {
+			return success(w.memory.writeU64(args[1], 1))
+		}},
+		"random_get": {funcSig("i32 i32", "i32"), func(args []uint64) ([]interface{}, error) {
+			if args[1] > wasiMaxRandom {
+				return fail(wasiEINVAL), nil
+			}
+			buf := make([]byte, args[1])
+			w.rng.Read(buf)
+			return success(w.memory.write(args[0], buf))
+		}},
+		"fd_write": {funcSig("i32 i32 i32 i32", "i32"), func(args []uint64) ([]interface{}, error) {
+			if args[0] != 1 && args[0] != 2 {
+				return fail(wasiEBADF), nil
+			}
+			iovs, err := w.memory.read(args[1], args[2]*8)
+			if err != nil {
+				return nil, err
+			}
+			var written uint32
+			for i := 0; i < len(iovs); i += 8 {
+				n := binary.LittleEndian.Uint32(iovs[i+4:])
+				written += n
+				if w.output == nil || n == 0 {
+					continue
+				}
+				data, err := w.memory.read(uint64(binary.LittleEndian.Uint32(iovs[i:])), uint64(min(n, outputLimit)))
+				if err != nil {
+					return nil, err
+				}
+				w.output(int(args[0]), data)
+			}
+			return success(w.memory.writeU32(args[3], written))
+		}},
+		"fd_read": {funcSig("i32 i32 i32 i32", "i32"), func(args []uint64) ([]interface{}, error) {
+			if args[0] != 0 {
+				return fail(wasiEBADF), nil
+			}
+			// stdin is empty
+			return success(w.memory.writeU32(args[3], 0))
+		}},
+		"fd_fdstat_get": {funcSig("i32 i32", "i32"), func(args []uint64) ([]interface{}, error) {
+			if args[0] > 2 {
+				return fail(wasiEBADF), nil
+			}
+			stat := make([]byte, 24)
+			stat[0] = wasiFiletypeCharacterDevice
+			return success(w.memory.write(args[1], stat))
+		}},
+		"fd_close":            {funcSig("i32", "i32"), badf},
+		"fd_seek":             {funcSig("i32 i64 i32 i32", "i32"), badf},
+		"fd_prestat_get":      {funcSig("i32 i32", "i32"), badf},
+		"fd_prestat_dir_name": {funcSig("i32 i32 i32", "i32"), badf},
+		"proc_exit": {funcSig("i32", ""), func(args []uint64) ([]interface{}, error) {
+			return nil, &wasiExit{code: uint32(args[0])}
+		}},
+		"sched_yield": {funcSig("", "i32"), none},
+		"poll_oneoff": {funcSig("i32 i32 i32 i32", "i32"), func(args []uint64) ([]interface{}, error) {
+			return fail(wasiENOTSUP), nil
+		}},
+	}
+}
+
+// link binds the module's WASI imports that the minimal host implements
+func (w *minimalWASI) link(imports []wasmFuncImport) ([]HostFunction, error) {
+	functions := w.functions()
+	var host []HostFunction
+	for _, imp := range imports {
+		fn, ok := functions[imp.Name]
+		if imp.Module != wasiModule || !ok {
+			continue
+		}
+		bound, err := fn.bind(imp)
+		if err != nil {
+			return nil, err
+		}
+		host = append(host, bound)
+	}
+	return host, nil
+}
+
+// linkAll binds every WASI import of the module. Those the minimal host
+// does not implement return ENOSYS.
+func (w *minimalWASI) linkAll(imports []wasmFuncImport) ([]HostFunction, error) {
+	host, err := w.link(imports)
+	if err != nil {
+		return nil, err
+	}
+	functions := w.functions()
+	for _, imp := range imports {
+		if _, ok := functions[imp.Name]; imp.Module == wasiModule && !ok {
+			host = append(host, enosysFunction(imp, wasiENOSYS))
+		}
+	}
+	return host, nil
+}
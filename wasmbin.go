@@ -0,0 +1,491 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/mrhapile/WASM-Injection-Framework/internal/wasmbin"
+)
+
+// WASM section IDs
+const (
+	sectionCustom    = 0
+	sectionType      = 1
+	sectionImport    = 2
+	sectionFunction  = 3
+	sectionTable     = 4
+	sectionMemory    = 5
+	sectionGlobal    = 6
+	sectionExport    = 7
+	sectionStart     = 8
+	sectionElement   = 9
+	sectionCode      = 10
+	sectionData      = 11
+	sectionDataCount = 12
+	sectionTag       = 13
+)
+
+// External kinds used by imports and exports
+const (
+	externFunc   = 0
+	externTable  = 1
+	externMemory = 2
+	externGlobal = 3
+	externTag    = 4
+)
+
+// sectionOrder is the position each known section must appear at.
+// The tag section sits between memory and global.
+var sectionOrder = map[byte]int{
+	sectionType:      1,
+	sectionImport:    2,
+	sectionFunction:  3,
+	sectionTable:     4,
+	sectionMemory:    5,
+	sectionTag:       6,
+	sectionGlobal:    7,
+	sectionExport:    8,
+	sectionStart:     9,
+	sectionElement:   10,
+	sectionDataCount: 11,
+	sectionCode:      12,
+	sectionData:      13,
+}
+
+// wasmSection is one raw section of a module binary
+type wasmSection struct {
+	ID      byte
+	Payload []byte
+	// Offset is where the payload started in the parsed binary
+	Offset int
+}
+
+// wasmBinary is a module split into sections. It is only decoded as far as
+// the rewriting passes need; section payloads are kept as raw bytes.
+type wasmBinary struct {
+	Sections []wasmSection
+}
+
+// parseWasmBinary splits a module into its sections
+func parseWasmBinary(data []byte) (*wasmBinary, error) {
+	if !bytes.HasPrefix(data, wasmHeader) {
+		return nil, errors.New("missing WASM header")
+	}
+
+	module := &wasmBinary{}
+	r := &wasmbin.Reader{Data: data, Pos: len(wasmHeader)}
+	for !r.Done() {
+		id, err := r.Byte()
+		if err != nil {
+			return nil, err
+		}
+		size, err := r.U32()
+		if err != nil {
+			return nil, err
+		}
+		payload, err := r.Bytes(int(size))
+		if err != nil {
+			return nil, fmt.Errorf("section %d: %w", id, err)
+		}
+		module.Sections = append(module.Sections, wasmSection{ID: id, Payload: payload, Offset: r.Pos - len(payload)})
+	}
+	return module, nil
+}
+
+// encode serializes the module
+func (m *wasmBinary) encode() []byte {
+	out := append([]byte(nil), wasmHeader...)
+	for _, section := range m.Sections {
+		out = append(out, section.ID)
+		out = wasmbin.AppendU32(out, uint32(len(section.Payload)))
+		out = append(out, section.Payload...)
+	}
+	return out
+}
+
+// section returns the known section with the given ID, or nil
+func (m *wasmBinary) section(id byte) *wasmSection {
+	for i := range m.Sections {
+		if m.Sections[i].ID == id {
+			return &m.Sections[i]
+		}
+	}
+	return nil
+}
+
+// ensureSection returns the section with the given ID, inserting an empty
+// vector section at its canonical position if the module lacks one
+func (m *wasmBinary) ensureSection(id byte) *wasmSection {
+	if section := m.section(id); section != nil {
+		return section
+	}
+
+	at := len(m.Sections)
+	for i, section := range m.Sections {
+		if order, known := sectionOrder[section.ID]; known && order > sectionOrder[id] {
+			at = i
+			break
+		}
+	}
+	m.Sections = append(m.Sections, wasmSection{})
+	copy(m.Sections[at+1:], m.Sections[at:])
+	m.Sections[at] = wasmSection{ID: id, Payload: []byte{0}}
+	return &m.Sections[at]
+}
+
+// appendVectorEntry appends an encoded entry to a vector section,
+// rewriting its count, and returns the new entry's index in the section
+func (s *wasmSection) appendVectorEntry(entry []byte) (uint32, error) {
+	r := &wasmbin.Reader{Data: s.Payload}
+	count, err := r.U32()
+	if err != nil {
+		return 0, err
+	}
+	payload := wasmbin.AppendU32(nil, count+1)
+	payload = append(payload, s.Payload[r.Pos:]...)
+	s.Payload = append(payload, entry...)
+	return count, nil
+}
+
+// vectorCount returns the number of entries in a vector section, or 0 when
+// the section is absent
+func (m *wasmBinary) vectorCount(id byte) (uint32, error) {
+	section := m.section(id)
+	if section == nil {
+		return 0, nil
+	}
+	return (&wasmbin.Reader{Data: section.Payload}).U32()
+}
+
+// importCounts returns the number of imports of each external kind
+func (m *wasmBinary) importCounts() (map[byte]uint32, error) {
+	counts := make(map[byte]uint32)
+	section := m.section(sectionImport)
+	if section == nil {
+		return counts, nil
+	}
+
+	r := &wasmbin.Reader{Data: section.Payload}
+	n, err := r.U32()
+	if err != nil {
+		return nil, err
+	}
+	for i := uint32(0); i < n; i++ {
+		if _, err := r.Name(); err != nil {
+			return nil, err
+		}
+		if _, err := r.Name(); err != nil {
+			return nil, err
+		}
+		kind, err := r.Byte()
+		if err != nil {
+			return nil, err
+		}
+		if err := r.SkipImportDesc(kind); err != nil {
+			return nil, fmt.Errorf("import %d: %w", i, err)
+		}
+		counts[kind]++
+	}
+	return counts, nil
+}
+
+// functionExports maps exported function names to function indices
+func (m *wasmBinary) functionExports() (map[string]uint32, error) {
+	return m.exportsOfKind(externFunc)
+}
+
+// exportsOfKind maps the names of exports of one external kind to indices
+func (m *wasmBinary) exportsOfKind(want byte) (map[string]uint32, error) {
+	exports := make(map[string]uint32)
+	section := m.section(sectionExport)
+	if section == nil {
+		return exports, nil
+	}
+
+	r := &wasmbin.Reader{Data: section.Payload}
+	n, err := r.U32()
+	if err != nil {
+		return nil, err
+	}
+	for i := uint32(0); i < n; i++ {
+		name, err := r.Name()
+		if err != nil {
+			return nil, err
+		}
+		kind, err := r.Byte()
+		if err != nil {
+			return nil, err
+		}
+		index, err := r.U32()
+		if err != nil {
+			return nil, err
+		}
+		if kind == want {
+			exports[name] = index
+		}
+	}
+	return exports, nil
+}
+
+// paramCounts returns the number of parameters of each defined function
+func (m *wasmBinary) paramCounts() ([]uint32, error) {
+	var types []uint32
+	if section := m.section(sectionType); section != nil {
+		r := &wasmbin.Reader{Data: section.Payload}
+		n, err := r.U32()
+		if err != nil {
+			return nil, err
+		}
+		for i := uint32(0); i < n; i++ {
+			form, err := r.Byte()
+			if err != nil {
+				return nil, err
+			}
+			if form != 0x60 {
+				return nil, fmt.Errorf("unsupported type form 0x%02x", form)
+			}
+			params, err := skipValTypes(r)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := skipValTypes(r); err != nil {
+				return nil, err
+			}
+			types = append(types, params)
+		}
+	}
+
+	var counts []uint32
+	if section := m.section(sectionFunction); section != nil {
+		r := &wasmbin.Reader{Data: section.Payload}
+		n, err := r.U32()
+		if err != nil {
+			return nil, err
+		}
+		for i := uint32(0); i < n; i++ {
+			typeIndex, err := r.U32()
+			if err != nil {
+				return nil, err
+			}
+			if int(typeIndex) >= len(types) {
+				return nil, fmt.Errorf("function %d: type %d out of range", i, typeIndex)
+			}
+			counts = append(counts, types[typeIndex])
+		}
+	}
+	return counts, nil
+}
+
+// skipValTypes skips a vector of value types and returns its length
+func skipValTypes(r *wasmbin.Reader) (uint32, error) {
+	n, err := r.U32()
+	if err != nil {
+		return 0, err
+	}
+	for i := uint32(0); i < n; i++ {
+		if err := r.SkipValType(); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+// dataSegments returns the initialization bytes of every data segment
+func (m *wasmBinary) dataSegments() ([][]byte, error) {
+	section := m.section(sectionData)
+	if section == nil {
+		return nil, nil
+	}
+
+	r := &wasmbin.Reader{Data: section.Payload}
+	n, err := r.U32()
+	if err != nil {
+		return nil, err
+	}
+	segments := make([][]byte, 0, r.Capacity(n))
+	for i := uint32(0); i < n; i++ {
+		flags, err := r.U32()
+		if err != nil {
+			return nil, err
+		}
+		// Active segments name a memory (flag 2) and an offset expression
+		if flags == 2 {
+			if _, err := r.U32(); err != nil {
+				return nil, err
+			}
+		}
+		if flags == 0 || flags == 2 {
+			if err := r.SkipConstExpr(); err != nil {
+				return nil, fmt.Errorf("data segment %d: %w", i, err)
+			}
+		} else if flags != 1 {
+			return nil, fmt.Errorf("data segment %d: unknown flags %d", i, flags)
+		}
+
+		size, err := r.U32()
+		if err != nil {
+			return nil, err
+		}
+		init, err := r.Bytes(int(size))
+		if err != nil {
+			return nil, fmt.Errorf("data segment %d: %w", i, err)
+		}
+		segments = append(segments, init)
+	}
+	return segments, nil
+}
+
+// valTypeNames maps number and vector value type encodings to their names
+var valTypeNames = map[byte]string{0x7f: "i32", 0x7e: "i64", 0x7d: "f32", 0x7c: "f64", 0x7b: "v128"}
+
+// wasmFuncImport is an imported function and its type
+type wasmFuncImport struct {
+	Module, Name string
+	Signature    FuncSignature
+}
+
+// funcTypes decodes the type section. Reference types are named funcref
+// or externref; typed references are not supported.
+func (m *wasmBinary) funcTypes() ([]FuncSignature, error) {
+	section := m.section(sectionType)
+	if section == nil {
+		return nil, nil
+	}
+
+	r := &wasmbin.Reader{Data: section.Payload}
+	n, err := r.U32()
+	if err != nil {
+		return nil, err
+	}
+	types := make([]FuncSignature, 0, r.Capacity(n))
+	for i := uint32(0); i < n; i++ {
+		form, err := r.Byte()
+		if err != nil {
+			return nil, err
+		}
+		if form != 0x60 {
+			return nil, fmt.Errorf("unsupported type form 0x%02x", form)
+		}
+		params, err := readValTypes(r)
+		if err != nil {
+			return nil, fmt.Errorf("type %d: %w", i, err)
+		}
+		results, err := readValTypes(r)
+		if err != nil {
+			return nil, fmt.Errorf("type %d: %w", i, err)
+		}
+		types = append(types, FuncSignature{Params: params, Results: results})
+	}
+	return types, nil
+}
+
+// readValTypes reads a vector of value types as names
+func readValTypes(r *wasmbin.Reader) ([]string, error) {
+	n, err := r.U32()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, r.Capacity(n))
+	for i := uint32(0); i < n; i++ {
+		b, err := r.Byte()
+		if err != nil {
+			return nil, err
+		}
+		switch name, ok := valTypeNames[b]; {
+		case ok:
+			names = append(names, name)
+		case b == 0x70:
+			names = append(names, "funcref")
+		case b == 0x6f:
+			names = append(names, "externref")
+		default:
+			return nil, fmt.Errorf("unsupported value type 0x%02x", b)
+		}
+	}
+	return names, nil
+}
+
+// functionImports returns the module's function imports with their types
+func (m *wasmBinary) functionImports() ([]wasmFuncImport, error) {
+	section := m.section(sectionImport)
+	if section == nil {
+		return nil, nil
+	}
+	types, err := m.funcTypes()
+	if err != nil {
+		return nil, err
+	}
+
+	r := &wasmbin.Reader{Data: section.Payload}
+	n, err := r.U32()
+	if err != nil {
+		return nil, err
+	}
+	var imports []wasmFuncImport
+	for i := uint32(0); i < n; i++ {
+		module, err := r.Name()
+		if err != nil {
+			return nil, err
+		}
+		name, err := r.Name()
+		if err != nil {
+			return nil, err
+		}
+		kind, err := r.Byte()
+		if err != nil {
+			return nil, err
+		}
+		if kind != externFunc {
+			if err := r.SkipImportDesc(kind); err != nil {
+				return nil, fmt.Errorf("import %d: %w", i, err)
+			}
+			continue
+		}
+		typeIndex, err := r.U32()
+		if err != nil {
+			return nil, err
+		}
+		if int(typeIndex) >= len(types) {
+			return nil, fmt.Errorf("import %d: type %d out of range", i, typeIndex)
+		}
+		imports = append(imports, wasmFuncImport{Module: module, Name: name, Signature: types[typeIndex]})
+	}
+	return imports, nil
+}
+
+// functionSignatures returns the type of every function by function index:
+// the imported functions first, then the defined ones
+func (m *wasmBinary) functionSignatures() ([]FuncSignature, error) {
+	imports, err := m.functionImports()
+	if err != nil {
+		return nil, err
+	}
+	types, err := m.funcTypes()
+	if err != nil {
+		return nil, err
+	}
+
+	signatures := make([]FuncSignature, 0, len(imports))
+	for _, imp := range imports {
+		signatures = append(signatures, imp.Signature)
+	}
+	if section := m.section(sectionFunction); section != nil {
+		r := &wasmbin.Reader{Data: section.Payload}
+		n, err := r.U32()
+		if err != nil {
+			return nil, err
+		}
+		for i := uint32(0); i < n; i++ {
+			typeIndex, err := r.U32()
+			if err != nil {
+				return nil, err
+			}
+			if int(typeIndex) >= len(types) {
+				return nil, fmt.Errorf("function %d: type %d out of range", i, typeIndex)
+			}
+			signatures = append(signatures, types[typeIndex])
+		}
+	}
+	return signatures, nil
+}
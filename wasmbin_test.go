@@ -0,0 +1,46 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"testing"
+
+	"github.com/mrhapile/WASM-Injection-Framework/internal/wasmbin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// hugeTypeCountModule declares a type section of 0x2fad28387d2 types in 7
+// bytes. Preallocating that many takes hundreds of gigabytes, and running
+// out of memory is fatal, not a panic that can be recovered.
+var hugeTypeCountModule = []byte("\x00asm\x01\x00\x00\x00\x01\x07\xd2\x87\x85\xad\x7e\xb2\x02")
+
+// -----------------------------------------------------------------------------
+// TEST: Binary Decoding
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Every file of a corpus is decoded before it runs, and corpora are full
+// of hostile binaries. A count the binary lies about must fail the file
+// it is in, never take the fuzzer down with it.
+// -----------------------------------------------------------------------------
+
+func TestWasmBinary_OversizedCountsFailTheModule(t *testing.T) {
+	module, err := parseWasmBinary(hugeTypeCountModule)
+	require.NoError(t, err)
+	_, err = module.funcTypes()
+	assert.Error(t, err)
+
+	// A vector of value types claiming 2^32-1 entries
+	_, err = readValTypes(&wasmbin.Reader{Data: []byte{0xff, 0xff, 0xff, 0xff, 0x0f, 0x7f}})
+	assert.ErrorIs(t, err, wasmbin.ErrTruncated)
+}
+
+func TestWasmBinary_CapacityIsBoundedByTheBytesLeft(t *testing.T) {
+	r := &wasmbin.Reader{Data: make([]byte, 10), Pos: 4}
+	assert.Equal(t, 6, r.Capacity(1<<32-1))
+	assert.Equal(t, 3, r.Capacity(3))
+	r.Pos = 12
+	assert.Equal(t, 0, r.Capacity(1))
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/mrhapile/WASM-Injection-Framework/internal/wasmbin"
+)
+
+// Opcodes the rewriting passes inspect or emit
+const (
+	opBlock        = 0x02
+	opLoop         = 0x03
+	opIf           = 0x04
+	opElse         = 0x05
+	opTry          = 0x06
+	opCatch        = 0x07
+	opEnd          = 0x0b
+	opBr           = 0x0c
+	opBrIf         = 0x0d
+	opBrTable      = 0x0e
+	opReturn       = 0x0f
+	opCall         = 0x10
+	opDelegate     = 0x18
+	opCatchAll     = 0x19
+	opSelect       = 0x1b
+	opTryTable     = 0x1f
+	opLocalGet     = 0x20
+	opLocalSet     = 0x21
+	opGlobalGet    = 0x23
+	opGlobalSet    = 0x24
+	opI32Load8U    = 0x2d
+	opI32Store     = 0x36
+	opI64Store     = 0x37
+	opI32Store8    = 0x3a
+	opI32Const     = 0x41
+	opI64Const     = 0x42
+	opF32Const     = 0x43
+	opF64Const     = 0x44
+	opI32Eqz       = 0x45
+	opI32GtU       = 0x4b
+	opI32GeU       = 0x4f
+	opI64Eqz       = 0x50
+	opI64GeU       = 0x5a
+	opI32Popcnt    = 0x69
+	opI32Add       = 0x6a
+	opI32Sub       = 0x6b
+	opI32Xor       = 0x73
+	opI64Popcnt    = 0x7b
+	opI64Xor       = 0x85
+	opI32WrapI64   = 0xa7
+	opI64ExtendS   = 0xac
+	opBrOnNull     = 0xd5
+	opBrOnNonNull  = 0xd6
+	opPrefixMisc   = 0xfc
+	opPrefixSIMD   = 0xfd
+	opPrefixAtomic = 0xfe
+)
+
+// wasmFunctionBody is a decoded entry of the code section
+type wasmFunctionBody struct {
+	// Locals is the encoded local declarations, kept verbatim
+	Locals []byte
+	// Code is the instruction sequence, including the final end
+	Code []byte
+	// CodeOffset is where Code started in the code section payload
+	CodeOffset int
+}
+
+// parseCodeSection splits the code section into function bodies
+func parseCodeSection(payload []byte) ([]wasmFunctionBody, error) {
+	r := &wasmbin.Reader{Data: payload}
+	count, err := r.U32()
+	if err != nil {
+		return nil, err
+	}
+
+	bodies := make([]wasmFunctionBody, 0, r.Capacity(count))
+	for i := uint32(0); i < count; i++ {
+		size, err := r.U32()
+		if err != nil {
+			return nil, err
+		}
+		raw, err := r.Bytes(int(size))
+		if err != nil {
+			return nil, fmt.Errorf("function body %d: %w", i, err)
+		}
+
+		body := &wasmbin.Reader{Data: raw}
+		groups, err := body.U32()
+		if err != nil {
+			return nil, err
+		}
+		for g := uint32(0); g < groups; g++ {
+			if _, err := body.U32(); err != nil {
+				return nil, err
+			}
+			if err := body.SkipValType(); err != nil {
+				return nil, err
+			}
+		}
+		bodies = append(bodies, wasmFunctionBody{Locals: raw[:body.Pos], Code: raw[body.Pos:], CodeOffset: r.Pos - len(raw) + body.Pos})
+	}
+	return bodies, nil
+}
+
+// encodeCodeSection serializes function bodies into a code section payload
+func encodeCodeSection(bodies []wasmFunctionBody) []byte {
+	payload := wasmbin.AppendU32(nil, uint32(len(bodies)))
+	for _, body := range bodies {
+		payload = wasmbin.AppendU32(payload, uint32(len(body.Locals)+len(body.Code)))
+		payload = append(payload, body.Locals...)
+		payload = append(payload, body.Code...)
+	}
+	return payload
+}
+
+// localCount returns the number of locals a body declares
+func (b wasmFunctionBody) localCount() (uint32, error) {
+	r := &wasmbin.Reader{Data: b.Locals}
+	groups, err := r.U32()
+	if err != nil {
+		return 0, err
+	}
+	var total uint32
+	for g := uint32(0); g < groups; g++ {
+		n, err := r.U32()
+		if err != nil {
+			return 0, err
+		}
+		if err := r.SkipValType(); err != nil {
+			return 0, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// addLocals declares count more locals of a value type after the existing ones
+func (b *wasmFunctionBody) addLocals(valType byte, count uint32) error {
+	r := &wasmbin.Reader{Data: b.Locals}
+	groups, err := r.U32()
+	if err != nil {
+		return err
+	}
+	locals := wasmbin.AppendU32(nil, groups+1)
+	locals = append(locals, b.Locals[r.Pos:]...)
+	b.Locals = append(wasmbin.AppendU32(locals, count), valType)
+	return nil
+}
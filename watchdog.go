@@ -0,0 +1,69 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// watchdog watches a call from a goroutine of its own, and calls onHang
+// once when the call makes no progress for the timeout. A native call that
+// wedges inside the runtime never returns to Go, so only another goroutine
+// can notice it. A nil watchdog never fires.
+type watchdog struct {
+	mu    sync.Mutex
+	last  time.Time
+	fired bool
+	done  chan struct{}
+}
+
+// startWatchdog starts watching, or returns nil without a timeout
+func startWatchdog(timeout time.Duration, onHang func()) *watchdog {
+	if timeout <= 0 {
+		return nil
+	}
+	w := &watchdog{last: time.Now(), done: make(chan struct{})}
+	go w.watch(timeout, onHang)
+	return w
+}
+
+// watch checks for progress a few times per timeout until stopped or fired
+func (w *watchdog) watch(timeout time.Duration, onHang func()) {
+	ticker := time.NewTicker(max(timeout/4, time.Millisecond))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case now := <-ticker.C:
+			w.mu.Lock()
+			stalled := now.Sub(w.last) >= timeout
+			w.fired = w.fired || stalled
+			w.mu.Unlock()
+			if stalled {
+				onHang()
+				return
+			}
+		}
+	}
+}
+
+// progress records that the call moved on
+func (w *watchdog) progress() {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.last = time.Now()
+}
+
+// stop stops watching and reports whether the watchdog fired
+func (w *watchdog) stop() bool {
+	if w == nil {
+		return false
+	}
+	close(w.done)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.fired
+}
@@ -0,0 +1,885 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// witKind identifies a WIT type
+type witKind int
+
+const (
+	witBool witKind = iota
+	witS8
+	witU8
+	witS16
+	witU16
+	witS32
+	witU32
+	witS64
+	witU64
+	witF32
+	witF64
+	witChar
+	witString
+	witList
+	witRecord
+	witTuple
+	witVariant
+	witEnum
+	witOption
+	witResult
+	witFlags
+	// witResource types are parsed so documents load, but cannot be passed
+	witResource
+	// witRef is a named type awaiting resolution
+	witRef
+)
+
+// witPrimitives maps primitive type names to their kinds
+var witPrimitives = map[string]witKind{
+	"bool": witBool, "s8": witS8, "u8": witU8, "s16": witS16, "u16": witU16,
+	"s32": witS32, "u32": witU32, "s64": witS64, "u64": witU64,
+	"f32": witF32, "f64": witF64, "float32": witF32, "float64": witF64,
+	"char": witChar, "string": witString,
+}
+
+// witType is a WIT interface type. Enums, options and results are kept as
+// variants with fixed cases, which is how the canonical ABI treats them.
+type witType struct {
+	Kind witKind
+	// Name is the declared name of records, variants, enums, flags,
+	// resources and unresolved references
+	Name string
+	// Elem is the element type of lists
+	Elem *witType
+	// Fields are the fields of records and tuples
+	Fields []witField
+	// Cases are the cases of variants, enums, options and results
+	Cases []witField
+	// Flags are the names of a flags type's flags
+	Flags []string
+}
+
+// witField is a named, possibly untyped, member of a type or function.
+// Variant cases without a payload have a nil Type.
+type witField struct {
+	Name string
+	Type *witType
+}
+
+// String formats the type as WIT source
+func (t *witType) String() string {
+	switch t.Kind {
+	case witList:
+		return fmt.Sprintf("list<%s>", t.Elem)
+	case witTuple:
+		types := make([]string, len(t.Fields))
+		for i, field := range t.Fields {
+			types[i] = field.Type.String()
+		}
+		return fmt.Sprintf("tuple<%s>", strings.Join(types, ", "))
+	case witOption:
+		return fmt.Sprintf("option<%s>", t.Cases[1].Type)
+	case witResult:
+		ok, err := t.Cases[0].Type, t.Cases[1].Type
+		switch {
+		case ok == nil && err == nil:
+			return "result"
+		case err == nil:
+			return fmt.Sprintf("result<%s>", ok)
+		case ok == nil:
+			return fmt.Sprintf("result<_, %s>", err)
+		}
+		return fmt.Sprintf("result<%s, %s>", ok, err)
+	case witRecord, witVariant, witEnum, witFlags, witResource, witRef:
+		return t.Name
+	}
+	for name, kind := range witPrimitives {
+		if kind == t.Kind && !strings.HasPrefix(name, "float") {
+			return name
+		}
+	}
+	return "unknown"
+}
+
+// witFunction is a function declared in a WIT document
+type witFunction struct {
+	Name string
+	// Interface is the interface declaring the function, empty for
+	// functions exported by a world directly
+	Interface string
+	Params    []witField
+	Results   []*witType
+}
+
+// String formats the function type as WIT source
+func (f *witFunction) String() string {
+	params := make([]string, len(f.Params))
+	for i, param := range f.Params {
+		params[i] = fmt.Sprintf("%s: %s", param.Name, param.Type)
+	}
+	results := make([]string, len(f.Results))
+	for i, result := range f.Results {
+		results[i] = result.String()
+	}
+	signature := fmt.Sprintf("func(%s)", strings.Join(params, ", "))
+	switch len(results) {
+	case 0:
+		return signature
+	case 1:
+		return signature + " -> " + results[0]
+	}
+	return fmt.Sprintf("%s -> (%s)", signature, strings.Join(results, ", "))
+}
+
+// witDocument holds the functions of a parsed WIT file
+type witDocument struct {
+	// Exports are the functions exported by worlds directly
+	Exports []*witFunction
+	// Functions are the functions of every interface
+	Functions []*witFunction
+}
+
+// loadWIT reads and parses a WIT file
+func loadWIT(path string) (*witDocument, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := parseWIT(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s:%w", path, err)
+	}
+	return doc, nil
+}
+
+// function finds the WIT declaration of a core export. Exports of world
+// functions carry the function's name; exports of interface functions are
+// named "<interface>#<function>", where the interface may be qualified
+// with its package and version.
+func (d *witDocument) function(entry string) (*witFunction, error) {
+	name, iface := entry, ""
+	if i := strings.LastIndex(entry, "#"); i >= 0 {
+		name, iface = entry[i+1:], entry[:i]
+		if j := strings.LastIndex(iface, "/"); j >= 0 {
+			iface = iface[j+1:]
+		}
+		if j := strings.Index(iface, "@"); j >= 0 {
+			iface = iface[:j]
+		}
+	}
+
+	if iface == "" {
+		for _, fn := range d.Exports {
+			if fn.Name == name {
+				return fn, nil
+			}
+		}
+	}
+	var found *witFunction
+	for _, fn := range d.Functions {
+		if fn.Name != name || (iface != "" && fn.Interface != iface) {
+			continue
+		}
+		if found != nil {
+			return nil, fmt.Errorf("function '%s' is declared by interfaces '%s' and '%s'; export it as '<interface>#%s'", name, found.Interface, fn.Interface, name)
+		}
+		found = fn
+	}
+	if found == nil {
+		return nil, fmt.Errorf("function '%s' not found in WIT", entry)
+	}
+	return found, nil
+}
+
+// witToken is a lexical token of WIT source
+type witToken struct {
+	text string
+	line int
+	// ident is set for identifiers, keywords and numbers
+	ident bool
+}
+
+// lexWIT splits WIT source into tokens, dropping comments
+func lexWIT(src string) ([]witToken, error) {
+	var tokens []witToken
+	line := 1
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case strings.HasPrefix(src[i:], "//"):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("%d: unterminated comment", line)
+			}
+			line += strings.Count(src[i:i+2+end], "\n")
+			i += end + 4
+		case strings.HasPrefix(src[i:], "->"):
+			tokens = append(tokens, witToken{text: "->", line: line})
+			i += 2
+		case isWITIdentByte(c) || c == '%':
+			start := i
+			if c == '%' {
+				start++
+				i++
+			}
+			for i < len(src) && (isWITIdentByte(src[i]) || src[i] == '-') {
+				i++
+			}
+			tokens = append(tokens, witToken{text: src[start:i], line: line, ident: true})
+		default:
+			tokens = append(tokens, witToken{text: string(c), line: line})
+			i++
+		}
+	}
+	return tokens, nil
+}
+
+func isWITIdentByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_'
+}
+
+// witScope holds the named types visible in an interface or world
+type witScope struct {
+	types map[string]*witType
+	// uses maps local names to "<interface>.<type>" in the same document
+	uses map[string][2]string
+}
+
+// witParser is a recursive descent parser for the subset of WIT needed to
+// type exported functions: interfaces, worlds, type definitions and
+// functions. Package references across files are not resolved.
+type witParser struct {
+	tokens []witToken
+	pos    int
+	doc    *witDocument
+	scopes map[string]*witScope
+	// pending are functions whose types are resolved after parsing
+	pending []pendingWITFunction
+}
+
+type pendingWITFunction struct {
+	fn    *witFunction
+	scope *witScope
+}
+
+// parseWIT parses WIT source and resolves every function's types
+func parseWIT(src string) (*witDocument, error) {
+	tokens, err := lexWIT(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &witParser{tokens: tokens, doc: &witDocument{}, scopes: make(map[string]*witScope)}
+	if err := p.parseDocument(); err != nil {
+		return nil, err
+	}
+	for _, pending := range p.pending {
+		for i := range pending.fn.Params {
+			if pending.fn.Params[i].Type, err = p.resolve(pending.fn.Params[i].Type, pending.scope, nil); err != nil {
+				return nil, err
+			}
+		}
+		for i := range pending.fn.Results {
+			if pending.fn.Results[i], err = p.resolve(pending.fn.Results[i], pending.scope, nil); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return p.doc, nil
+}
+
+func (p *witParser) peek() witToken {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	line := 1
+	if len(p.tokens) > 0 {
+		line = p.tokens[len(p.tokens)-1].line
+	}
+	return witToken{line: line}
+}
+
+func (p *witParser) next() witToken {
+	tok := p.peek()
+	if p.pos < len(p.tokens) {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *witParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%d: %s", p.peek().line, fmt.Sprintf(format, args...))
+}
+
+// accept consumes the next token if it has the given text
+func (p *witParser) accept(text string) bool {
+	if p.pos < len(p.tokens) && p.tokens[p.pos].text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *witParser) expect(text string) error {
+	if !p.accept(text) {
+		return p.errorf("expected '%s', found %s", text, p.describe())
+	}
+	return nil
+}
+
+func (p *witParser) ident() (string, error) {
+	tok := p.peek()
+	if !tok.ident {
+		return "", p.errorf("expected identifier, found %s", p.describe())
+	}
+	p.pos++
+	return tok.text, nil
+}
+
+func (p *witParser) describe() string {
+	if p.pos >= len(p.tokens) {
+		return "end of file"
+	}
+	return fmt.Sprintf("'%s'", p.tokens[p.pos].text)
+}
+
+// skipStatement skips to the end of a statement ending in ';'
+func (p *witParser) skipStatement() error {
+	for p.pos < len(p.tokens) {
+		if p.next().text == ";" {
+			return nil
+		}
+	}
+	return p.errorf("expected ';', found end of file")
+}
+
+// skipBlock skips a balanced {...} block starting at the current token
+func (p *witParser) skipBlock() error {
+	depth := 0
+	for p.pos < len(p.tokens) {
+		switch p.next().text {
+		case "{":
+			depth++
+		case "}":
+			depth--
+			if depth == 0 {
+				return nil
+			}
+		}
+	}
+	return p.errorf("expected '}', found end of file")
+}
+
+// skipAttributes skips feature gates such as @since(version = 1.0.0)
+func (p *witParser) skipAttributes() error {
+	for p.accept("@") {
+		if _, err := p.ident(); err != nil {
+			return err
+		}
+		if p.peek().text != "(" {
+			continue
+		}
+		for p.pos < len(p.tokens) && p.next().text != ")" {
+		}
+	}
+	return nil
+}
+
+func (p *witParser) parseDocument() error {
+	for p.pos < len(p.tokens) {
+		if err := p.skipAttributes(); err != nil {
+			return err
+		}
+		keyword, err := p.ident()
+		if err != nil {
+			return err
+		}
+		switch keyword {
+		case "package", "use":
+			err = p.skipStatement()
+		case "interface":
+			err = p.parseInterface()
+		case "world":
+			err = p.parseWorld()
+		default:
+			return fmt.Errorf("%d: unexpected '%s'", p.tokens[p.pos-1].line, keyword)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newScope creates the type scope of an interface or world
+func (p *witParser) newScope(name string) *witScope {
+	scope := &witScope{types: make(map[string]*witType), uses: make(map[string][2]string)}
+	p.scopes[name] = scope
+	return scope
+}
+
+func (p *witParser) parseInterface() error {
+	name, err := p.ident()
+	if err != nil {
+		return err
+	}
+	return p.parseInterfaceBody(name)
+}
+
+// parseInterfaceBody parses "{ items }" of a named or inline interface
+func (p *witParser) parseInterfaceBody(name string) error {
+	scope := p.newScope(name)
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+	for !p.accept("}") {
+		if err := p.skipAttributes(); err != nil {
+			return err
+		}
+		handled, err := p.parseTypeItem(scope)
+		if err != nil {
+			return err
+		}
+		if handled {
+			continue
+		}
+		fn, err := p.parseNamedFunction(scope)
+		if err != nil {
+			return err
+		}
+		fn.Interface = name
+		p.doc.Functions = append(p.doc.Functions, fn)
+	}
+	return nil
+}
+
+func (p *witParser) parseWorld() error {
+	name, err := p.ident()
+	if err != nil {
+		return err
+	}
+	scope := p.newScope(name)
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+	for !p.accept("}") {
+		if err := p.skipAttributes(); err != nil {
+			return err
+		}
+		handled, err := p.parseTypeItem(scope)
+		if err != nil {
+			return err
+		}
+		if handled {
+			continue
+		}
+
+		direction, err := p.ident()
+		if err != nil {
+			return err
+		}
+		switch direction {
+		case "include":
+			err = p.skipStatement()
+		case "import", "export":
+			err = p.parseWorldItem(scope, direction == "export")
+		default:
+			err = fmt.Errorf("%d: unexpected '%s'", p.tokens[p.pos-1].line, direction)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseWorldItem parses what follows "import" or "export" in a world
+func (p *witParser) parseWorldItem(scope *witScope, export bool) error {
+	// A path such as "iface;" or "ns:pkg/iface@1.0.0;" names an interface
+	// declared elsewhere, whose functions are already known
+	if p.pos+1 < len(p.tokens) && p.tokens[p.pos+1].text != ":" {
+		return p.skipStatement()
+	}
+	name, err := p.ident()
+	if err != nil {
+		return err
+	}
+	if err := p.expect(":"); err != nil {
+		return err
+	}
+	if p.accept("interface") {
+		return p.parseInterfaceBody(name)
+	}
+	// A package path "ns:pkg/iface" also reads as name ':' ...
+	if p.peek().text != "func" && p.peek().text != "async" {
+		return p.skipStatement()
+	}
+	fn, err := p.parseFunction(name, scope)
+	if err != nil {
+		return err
+	}
+	if export {
+		p.doc.Exports = append(p.doc.Exports, fn)
+	}
+	return nil
+}
+
+// parseTypeItem parses a use or type definition, reporting false when the
+// next item is something else
+func (p *witParser) parseTypeItem(scope *witScope) (bool, error) {
+	keyword := p.peek()
+	if !keyword.ident || (p.pos+1 < len(p.tokens) && p.tokens[p.pos+1].text == ":") {
+		return false, nil
+	}
+	switch keyword.text {
+	case "use":
+		p.pos++
+		return true, p.parseUse(scope)
+	case "type":
+		p.pos++
+		name, err := p.ident()
+		if err != nil {
+			return true, err
+		}
+		if err := p.expect("="); err != nil {
+			return true, err
+		}
+		t, err := p.parseType()
+		if err != nil {
+			return true, err
+		}
+		scope.types[name] = t
+		return true, p.expect(";")
+	case "record", "variant", "enum", "flags":
+		p.pos++
+		return true, p.parseTypeDefinition(keyword.text, scope)
+	case "resource":
+		p.pos++
+		name, err := p.ident()
+		if err != nil {
+			return true, err
+		}
+		scope.types[name] = &witType{Kind: witResource, Name: name}
+		if p.accept(";") {
+			return true, nil
+		}
+		return true, p.skipBlock()
+	}
+	return false, nil
+}
+
+// parseUse parses "use iface.{a, b as c};". Only interfaces of the same
+// document can be resolved; package-qualified paths are skipped.
+func (p *witParser) parseUse(scope *witScope) error {
+	iface, err := p.ident()
+	if err != nil {
+		return err
+	}
+	if !p.accept(".") {
+		return p.skipStatement()
+	}
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+	for !p.accept("}") {
+		name, err := p.ident()
+		if err != nil {
+			return err
+		}
+		local := name
+		if p.accept("as") {
+			if local, err = p.ident(); err != nil {
+				return err
+			}
+		}
+		scope.uses[local] = [2]string{iface, name}
+		if !p.accept(",") {
+			if err := p.expect("}"); err != nil {
+				return err
+			}
+			break
+		}
+	}
+	return p.expect(";")
+}
+
+// parseTypeDefinition parses the body of a record, variant, enum or flags
+func (p *witParser) parseTypeDefinition(keyword string, scope *witScope) error {
+	name, err := p.ident()
+	if err != nil {
+		return err
+	}
+	t := &witType{Name: name}
+	switch keyword {
+	case "record":
+		t.Kind = witRecord
+	case "variant":
+		t.Kind = witVariant
+	case "enum":
+		t.Kind = witEnum
+	case "flags":
+		t.Kind = witFlags
+	}
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+	for !p.accept("}") {
+		if err := p.skipAttributes(); err != nil {
+			return err
+		}
+		member, err := p.ident()
+		if err != nil {
+			return err
+		}
+		switch keyword {
+		case "record":
+			if err := p.expect(":"); err != nil {
+				return err
+			}
+			field, err := p.parseType()
+			if err != nil {
+				return err
+			}
+			t.Fields = append(t.Fields, witField{Name: member, Type: field})
+		case "variant":
+			var payload *witType
+			if p.accept("(") {
+				if payload, err = p.parseType(); err != nil {
+					return err
+				}
+				if err := p.expect(")"); err != nil {
+					return err
+				}
+			}
+			t.Cases = append(t.Cases, witField{Name: member, Type: payload})
+		case "enum":
+			t.Cases = append(t.Cases, witField{Name: member})
+		case "flags":
+			t.Flags = append(t.Flags, member)
+		}
+		if !p.accept(",") {
+			if err := p.expect("}"); err != nil {
+				return err
+			}
+			break
+		}
+	}
+	if (keyword == "variant" || keyword == "enum") && len(t.Cases) == 0 {
+		return p.errorf("%s '%s' has no cases", keyword, name)
+	}
+	scope.types[name] = t
+	return nil
+}
+
+// parseNamedFunction parses "name: func(...) -> ...;"
+func (p *witParser) parseNamedFunction(scope *witScope) (*witFunction, error) {
+	name, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	return p.parseFunction(name, scope)
+}
+
+// parseFunction parses a function type and its terminating ';'
+func (p *witParser) parseFunction(name string, scope *witScope) (*witFunction, error) {
+	p.accept("async")
+	if err := p.expect("func"); err != nil {
+		return nil, err
+	}
+	fn := &witFunction{Name: name}
+	params, err := p.parseParams()
+	if err != nil {
+		return nil, err
+	}
+	fn.Params = params
+
+	if p.accept("->") {
+		if p.peek().text == "(" {
+			// Named results, as older WIT allowed
+			results, err := p.parseParams()
+			if err != nil {
+				return nil, err
+			}
+			for _, result := range results {
+				fn.Results = append(fn.Results, result.Type)
+			}
+		} else {
+			result, err := p.parseType()
+			if err != nil {
+				return nil, err
+			}
+			fn.Results = []*witType{result}
+		}
+	}
+	p.pending = append(p.pending, pendingWITFunction{fn: fn, scope: scope})
+	return fn, p.expect(";")
+}
+
+// parseParams parses "(name: type, ...)"
+func (p *witParser) parseParams() ([]witField, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	params := []witField{}
+	for !p.accept(")") {
+		name, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		t, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+		params = append(params, witField{Name: name, Type: t})
+		if !p.accept(",") {
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	return params, nil
+}
+
+// parseType parses a type expression; named types stay references until
+// the document has been read
+func (p *witParser) parseType() (*witType, error) {
+	name, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	if kind, ok := witPrimitives[name]; ok {
+		return &witType{Kind: kind}, nil
+	}
+
+	switch name {
+	case "list", "option", "own", "borrow":
+		if err := p.expect("<"); err != nil {
+			return nil, err
+		}
+		elem, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+		if p.accept(",") {
+			return nil, p.errorf("fixed-length lists are not supported")
+		}
+		if err := p.expect(">"); err != nil {
+			return nil, err
+		}
+		switch name {
+		case "list":
+			return &witType{Kind: witList, Elem: elem}, nil
+		case "option":
+			return &witType{Kind: witOption, Cases: []witField{{Name: "none"}, {Name: "some", Type: elem}}}, nil
+		}
+		return &witType{Kind: witResource, Name: fmt.Sprintf("%s<%s>", name, elem.Name)}, nil
+	case "result":
+		t := &witType{Kind: witResult, Cases: []witField{{Name: "ok"}, {Name: "err"}}}
+		if !p.accept("<") {
+			return t, nil
+		}
+		if !p.accept("_") {
+			if t.Cases[0].Type, err = p.parseType(); err != nil {
+				return nil, err
+			}
+		}
+		if p.accept(",") {
+			if t.Cases[1].Type, err = p.parseType(); err != nil {
+				return nil, err
+			}
+		}
+		return t, p.expect(">")
+	case "tuple":
+		if err := p.expect("<"); err != nil {
+			return nil, err
+		}
+		t := &witType{Kind: witTuple}
+		for !p.accept(">") {
+			elem, err := p.parseType()
+			if err != nil {
+				return nil, err
+			}
+			t.Fields = append(t.Fields, witField{Name: fmt.Sprint(len(t.Fields)), Type: elem})
+			if !p.accept(",") {
+				if err := p.expect(">"); err != nil {
+					return nil, err
+				}
+				break
+			}
+		}
+		return t, nil
+	}
+	return &witType{Kind: witRef, Name: name}, nil
+}
+
+// resolve replaces named references in a type with their definitions.
+// WIT forbids recursive types, so visiting only guards malformed input.
+func (p *witParser) resolve(t *witType, scope *witScope, visiting map[string]bool) (*witType, error) {
+	if t == nil {
+		return nil, nil
+	}
+	if t.Kind == witRef {
+		def, defScope, err := p.lookup(t.Name, scope)
+		if err != nil {
+			return nil, err
+		}
+		if visiting[t.Name] {
+			return nil, fmt.Errorf("type '%s' refers to itself", t.Name)
+		}
+		nested := map[string]bool{t.Name: true}
+		for name := range visiting {
+			nested[name] = true
+		}
+		return p.resolve(def, defScope, nested)
+	}
+
+	var err error
+	if t.Elem, err = p.resolve(t.Elem, scope, visiting); err != nil {
+		return nil, err
+	}
+	for i := range t.Fields {
+		if t.Fields[i].Type, err = p.resolve(t.Fields[i].Type, scope, visiting); err != nil {
+			return nil, err
+		}
+	}
+	for i := range t.Cases {
+		if t.Cases[i].Type, err = p.resolve(t.Cases[i].Type, scope, visiting); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// lookup finds a named type in a scope or the interface it was used from
+func (p *witParser) lookup(name string, scope *witScope) (*witType, *witScope, error) {
+	if t, ok := scope.types[name]; ok {
+		return t, scope, nil
+	}
+	if used, ok := scope.uses[name]; ok {
+		if from, ok := p.scopes[used[0]]; ok {
+			if t, ok := from.types[used[1]]; ok {
+				return t, from, nil
+			}
+		}
+		return nil, nil, fmt.Errorf("type '%s' used from '%s' is not declared in this file", used[1], used[0])
+	}
+	return nil, nil, fmt.Errorf("unknown type '%s'", name)
+}
@@ -0,0 +1,258 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+const httpWIT = `
+package example:http@0.1.0;
+
+/// Request handling
+interface handler {
+    enum method { get, post, %delete }
+
+    record request {
+        method: method,
+        path: string,
+        headers: list<tuple<string, string>>,
+        body: option<list<u8>>,
+    }
+
+    type status = u16;
+
+    @since(version = 0.1.0)
+    handle: func(req: request) -> result<status, string>;
+}
+
+world service {
+    use handler.{request as req};
+    /* exported directly */
+    export check: func(r: req, strict: bool) -> u32;
+    export handler;
+    import log: func(msg: string);
+}
+`
+
+// witMemoryModule is a heap module with a cabi_realloc allocator and the
+// given core export signatures
+func witMemoryModule(signatures map[string]FuncSignature) *heapMockModule {
+	all := map[string]FuncSignature{}
+	for name, sig := range cabiExports {
+		all[name] = sig
+	}
+	for name, sig := range signatures {
+		all[name] = sig
+	}
+	return newHeapMockModule(all)
+}
+
+// -----------------------------------------------------------------------------
+// TEST: WIT Interface Types
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Modules built with wit-bindgen take records, lists and strings whose core
+// signature is just a row of i32s. Reading the WIT declaration lets the
+// harness build well-formed structured values and fuzz them, where random
+// i32s would only ever produce wild pointers.
+// -----------------------------------------------------------------------------
+
+func TestWIT_ParsesInterfacesAndWorlds(t *testing.T) {
+	doc, err := parseWIT(httpWIT)
+	require.NoError(t, err)
+
+	handle, err := doc.function("example:http/handler@0.1.0#handle")
+	require.NoError(t, err)
+	assert.Equal(t, "handler", handle.Interface)
+	assert.Equal(t, "func(req: request) -> result<u16, string>", handle.String())
+
+	request := handle.Params[0].Type
+	assert.Equal(t, witRecord, request.Kind)
+	assert.Equal(t, "list<tuple<string, string>>", request.Fields[2].Type.String())
+	assert.Equal(t, "option<list<u8>>", request.Fields[3].Type.String())
+	assert.Equal(t, "delete", request.Fields[0].Type.Cases[2].Name, "% escapes keywords")
+
+	check, err := doc.function("check")
+	require.NoError(t, err)
+	assert.Equal(t, "", check.Interface)
+	assert.Same(t, request, check.Params[0].Type, "types used from an interface resolve to its definitions")
+
+	bare, err := doc.function("handle")
+	require.NoError(t, err)
+	assert.Same(t, handle, bare)
+
+	_, err = doc.function("log")
+	assert.EqualError(t, err, "function 'log' not found in WIT", "imports are not entries")
+}
+
+func TestWIT_ReportsErrors(t *testing.T) {
+	tests := []struct {
+		src     string
+		message string
+	}{
+		{"interface a { f: func(x: widget); }", "unknown type 'widget'"},
+		{"interface a {\n f: func(x: u32) }", "2: expected ';', found '}'"},
+		{"interface a { record r { next: r } f: func(x: r); }", "type 'r' refers to itself"},
+		{"interface a { f: func(x: list<u8, 4>); }", "1: fixed-length lists are not supported"},
+		{"widget a {}", "1: unexpected 'widget'"},
+	}
+	for _, tt := range tests {
+		_, err := parseWIT(tt.src)
+		assert.EqualError(t, err, tt.message, tt.src)
+	}
+
+	doc, err := parseWIT("interface a { f: func(); } interface b { f: func(); }")
+	require.NoError(t, err)
+	_, err = doc.function("f")
+	assert.ErrorContains(t, err, "declared by interfaces 'a' and 'b'")
+	_, err = doc.function("pkg:x/b#f")
+	assert.NoError(t, err)
+}
+
+func TestWIT_ValuesRoundTripThroughJSON(t *testing.T) {
+	doc, err := parseWIT(httpWIT)
+	require.NoError(t, err)
+	handle, _ := doc.function("handle")
+	request := handle.Params[0].Type
+
+	value, err := decodeWITJSON(request, `{"method": "post", "path": "/a", "headers": [["k", "v"]], "body": [1, 255]}`)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{
+		witCaseValue{Case: 1},
+		"/a",
+		[]interface{}{[]interface{}{"k", "v"}},
+		witCaseValue{Case: 1, Payload: []interface{}{uint64(1), uint64(255)}},
+	}, value)
+
+	encoded := witArg{Type: request, Value: value}.encode()
+	assert.Equal(t, WasmValue{Type: "request", Value: `{"body":[1,255],"headers":[["k","v"]],"method":"post","path":"/a"}`}, encoded)
+
+	_, err = decodeWITJSON(request, `{"method": "put", "path": "", "headers": [], "body": null}`)
+	assert.EqualError(t, err, "method has no case 'put'")
+	_, err = decodeWITJSON(request, `{"method": "get", "path": "", "headers": []}`)
+	assert.EqualError(t, err, "request value is missing field 'body'")
+	_, err = decodeWITJSON(request, `{"method": "get", "path": "", "headers": [], "body": [256]}`)
+	assert.EqualError(t, err, `invalid u8 value "256"`)
+}
+
+func TestWIT_NumbersAreLossless(t *testing.T) {
+	u64 := &witType{Kind: witU64}
+	f32 := &witType{Kind: witF32}
+
+	assert.Equal(t, `"18446744073709551615"`, witArg{Type: u64, Value: uint64(math.MaxUint64)}.encode().Value)
+	assert.Equal(t, `"0x7fc00000"`, witArg{Type: f32, Value: float32(math.NaN())}.encode().Value)
+	assert.Equal(t, `1.5`, witArg{Type: f32, Value: float32(1.5)}.encode().Value)
+
+	v, err := decodeWITJSON(f32, `"0x80000000"`)
+	require.NoError(t, err)
+	assert.True(t, math.Signbit(float64(v.(float32))))
+}
+
+func TestWIT_BindsPlainAndStructuredInputs(t *testing.T) {
+	doc, err := parseWIT(httpWIT)
+	require.NoError(t, err)
+	check, _ := doc.function("check")
+
+	var config InvocationConfig
+	require.NoError(t, yaml.Unmarshal([]byte(`
+inputs:
+  - [{method: get, path: /, headers: [], body: ~}, true]
+`), &config))
+
+	args, err := bindWITArguments(config.Inputs[0], check)
+	require.NoError(t, err)
+	assert.Equal(t, witArg{Type: check.Params[1].Type, Value: true}, args[1])
+
+	_, err = bindWITArguments(InvocationInput{{Value: "x"}, {Value: "true"}}, check)
+	assert.EqualError(t, err, "argument 0 (r): request parameters need a structured value")
+	_, err = bindWITArguments(InvocationInput{check.defaultInput()[0], {Type: "u32", Value: "1"}}, check)
+	assert.EqualError(t, err, "argument 1 (strict): u32 value given for bool parameter")
+}
+
+func TestWIT_LoadsSiblingFile(t *testing.T) {
+	dir := t.TempDir()
+	modulePath := filepath.Join(dir, "service.wasm")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "service.wit"), []byte(httpWIT), 0644))
+
+	plan := InvocationConfig{Entry: "check", Inputs: []InvocationInput{i32Input(1)}}
+	require.NoError(t, plan.loadInterface(modulePath, true))
+
+	require.NotNil(t, plan.function)
+	assert.Equal(t, []InvocationInput{{
+		{Type: "request", Value: `{"body":null,"headers":[],"method":"get","path":""}`},
+		{Type: "bool", Value: "false"},
+	}}, plan.Inputs, "a defaulted input becomes the zero value of each parameter")
+
+	plan = InvocationConfig{Entry: "missing"}
+	err := plan.loadInterface(modulePath, true)
+	stage, message := classifyError(err, StageExecute, "")
+	assert.Equal(t, StageSignature, stage)
+	assert.Equal(t, "wit: "+filepath.Join(dir, "service.wit")+": function 'missing' not found in WIT", message)
+
+	plan = InvocationConfig{Entry: "process", WIT: filepath.Join(dir, "none.wit")}
+	assert.ErrorContains(t, plan.loadInterface(modulePath, true), "no such file")
+
+	plan = InvocationConfig{Entry: "process"}
+	assert.NoError(t, plan.loadInterface(filepath.Join(dir, "plain.wasm"), true), "modules without WIT are untouched")
+	assert.Nil(t, plan.function)
+}
+
+func TestWIT_InvokesWithCanonicalLowering(t *testing.T) {
+	dir := t.TempDir()
+	witPath := filepath.Join(dir, "api.wit")
+	require.NoError(t, os.WriteFile(witPath, []byte(`
+world api {
+    record point { x: s32, y: s32 }
+    export area: func(name: string, corners: list<point>) -> u32;
+}`), 0644))
+
+	module := witMemoryModule(map[string]FuncSignature{
+		"area": {Params: []string{"i32", "i32", "i32", "i32"}, Results: []string{"i32"}},
+	})
+	var config InvocationConfig
+	require.NoError(t, yaml.Unmarshal([]byte(`
+entry: area
+wit: `+witPath+`
+inputs:
+  - [box, [{x: 1, y: 2}, {x: 3, y: -1}]]
+  - ["", []]
+`), &config))
+
+	result := runBuffers(module, config)
+
+	require.True(t, result.Success, result.ErrorMessage)
+	assert.Equal(t, []string{"cabi_realloc", "cabi_realloc", "area", "cabi_realloc", "cabi_realloc", "area"}, module.names)
+	assert.Equal(t, []interface{}{int32(1024), int32(3), int32(1028), int32(2)}, module.calls[2])
+	assert.Equal(t, "box", string(module.memory[1024:1027]))
+	assert.Equal(t, []byte{1, 0, 0, 0, 2, 0, 0, 0, 3, 0, 0, 0, 0xff, 0xff, 0xff, 0xff}, module.memory[1028:1044])
+	assert.Equal(t, []WasmValue{
+		{Type: "string", Value: `"box"`},
+		{Type: "list<point>", Value: `[{"x":1,"y":2},{"x":3,"y":-1}]`},
+	}, result.Invocations[0].Args)
+	assert.Equal(t, []interface{}{int32(1044), int32(0), int32(1044), int32(0)}, module.calls[5], "empty buffers are still allocated")
+}
+
+func TestWIT_CoreSignatureMustMatch(t *testing.T) {
+	dir := t.TempDir()
+	witPath := filepath.Join(dir, "api.wit")
+	require.NoError(t, os.WriteFile(witPath, []byte(`world api { export area: func(name: string) -> u32; }`), 0644))
+
+	module := witMemoryModule(map[string]FuncSignature{
+		"area": {Params: []string{"i32"}, Results: []string{"i32"}},
+	})
+	result := runBuffers(module, InvocationConfig{Entry: "area", WIT: witPath})
+
+	assert.Equal(t, StageSignature, result.FailureStage)
+	assert.Equal(t, "signature mismatch: WIT type func(name: string) -> u32 lowers to (i32, i32) -> (i32), but 'area' has signature (i32) -> (i32)", result.ErrorMessage)
+	assert.Empty(t, module.names)
+}
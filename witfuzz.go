@@ -0,0 +1,302 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"unicode/utf8"
+)
+
+// maxWITDepth bounds the nesting of generated lists, so recursive
+// structures stay small
+const maxWITDepth = 4
+
+// interestingFloats are boundary values for f32 and f64 parameters
+var interestingFloats = []float64{0, math.Copysign(0, -1), 1, -1, 0.5, math.NaN(), math.Inf(1), math.Inf(-1), math.MaxFloat32, math.SmallestNonzeroFloat32, math.MaxFloat64}
+
+// interestingRunes are characters that commonly trip up text handling
+var interestingRunes = []rune{0, '\n', '"', '\\', '%', '/', 0x7f, 0xe9, 0x200b, 0xfeff, 0xfffd, 0x1f600, utf8.MaxRune}
+
+// witMutator generates and mutates structured values for a WIT function's
+// parameters, so argument fuzzing explores records, lists and strings
+// rather than raw pointers
+type witMutator struct {
+	rng    *rand.Rand
+	corpus [][]interface{}
+	// favored is the input closest to a directed fuzzing target
+	favored []interface{}
+	// numbers and strings are constants extracted from the module
+	numbers []int32
+	strings []string
+}
+
+func newWITMutator(seed int64, seeds [][]interface{}) *witMutator {
+	return &witMutator{
+		rng:    rand.New(rand.NewSource(seed)),
+		corpus: append([][]interface{}(nil), seeds...),
+	}
+}
+
+// useDictionary implements argumentSource.useDictionary
+func (m *witMutator) useDictionary(dict *moduleDictionary) int {
+	m.numbers = dict.argumentValues()
+	m.strings = dict.Strings
+	return len(m.numbers) + len(m.strings)
+}
+
+// next implements argumentSource.next, with one argument mutated
+func (m *witMutator) next() []interface{} {
+	var base []interface{}
+	if m.favored != nil && m.rng.Intn(2) == 0 {
+		base = m.favored
+	} else {
+		base = m.corpus[m.rng.Intn(len(m.corpus))]
+	}
+
+	input := append([]interface{}(nil), base...)
+	if len(input) == 0 {
+		return input
+	}
+	i := m.rng.Intn(len(input))
+	arg := input[i].(witArg)
+	input[i] = witArg{Type: arg.Type, Value: m.mutate(arg.Type, arg.Value, 0)}
+	return input
+}
+
+// keep implements argumentSource.keep
+func (m *witMutator) keep(input []interface{}) {
+	if len(m.corpus) < maxArgCorpus {
+		m.corpus = append(m.corpus, input)
+	}
+}
+
+// favor implements argumentSource.favor
+func (m *witMutator) favor(input []interface{}) {
+	m.favored = input
+	m.keep(input)
+}
+
+// mutate derives a new value of type t from v. Values are never modified
+// in place, since corpus entries share them.
+func (m *witMutator) mutate(t *witType, v interface{}, depth int) interface{} {
+	if m.rng.Intn(8) == 0 {
+		return m.generate(t, depth)
+	}
+
+	switch t.Kind {
+	case witBool:
+		return !v.(bool)
+	case witS8, witS16, witS32, witS64, witU8, witU16, witU32, witU64:
+		return m.mutateInteger(t.Kind, v)
+	case witF32:
+		if m.rng.Intn(2) == 0 {
+			return math.Float32frombits(math.Float32bits(v.(float32)) ^ 1<<uint(m.rng.Intn(32)))
+		}
+		return float32(interestingFloats[m.rng.Intn(len(interestingFloats))])
+	case witF64:
+		if m.rng.Intn(2) == 0 {
+			return math.Float64frombits(math.Float64bits(v.(float64)) ^ 1<<uint(m.rng.Intn(64)))
+		}
+		return interestingFloats[m.rng.Intn(len(interestingFloats))]
+	case witString:
+		return string(m.mutateRunes([]rune(v.(string))))
+	case witList:
+		return m.mutateList(t, v.([]interface{}), depth)
+	case witRecord, witTuple:
+		fields := append([]interface{}(nil), v.([]interface{})...)
+		if len(fields) > 0 {
+			i := m.rng.Intn(len(fields))
+			fields[i] = m.mutate(t.Fields[i].Type, fields[i], depth+1)
+		}
+		return fields
+	case witFlags:
+		flags := append([]bool(nil), v.([]bool)...)
+		if len(flags) > 0 {
+			i := m.rng.Intn(len(flags))
+			flags[i] = !flags[i]
+		}
+		return flags
+	case witEnum, witOption, witResult, witVariant:
+		value := v.(witCaseValue)
+		c := t.Cases[value.Case]
+		if c.Type == nil || m.rng.Intn(3) == 0 {
+			return m.generate(t, depth)
+		}
+		return witCaseValue{Case: value.Case, Payload: m.mutate(c.Type, value.Payload, depth+1)}
+	}
+	return m.generate(t, depth)
+}
+
+// mutateInteger flips a bit, adds a small delta or picks a boundary value
+// or module constant, wrapped to the integer's width
+func (m *witMutator) mutateInteger(kind witKind, v interface{}) interface{} {
+	bits, _ := witIntegerBits(kind)
+	var raw uint64
+	switch n := v.(type) {
+	case int64:
+		raw = uint64(n)
+	case uint64:
+		raw = n
+	}
+	switch m.rng.Intn(3) {
+	case 0:
+		raw ^= 1 << uint(m.rng.Intn(bits))
+	case 1:
+		raw += uint64(m.rng.Intn(33) - 16)
+	default:
+		return m.integer(kind)
+	}
+	return truncateWITInteger(kind, raw)
+}
+
+// truncateWITInteger wraps raw bits to an integer kind's range
+func truncateWITInteger(kind witKind, raw uint64) interface{} {
+	bits, signed := witIntegerBits(kind)
+	shift := uint(64 - bits)
+	if signed {
+		return int64(raw<<shift) >> shift
+	}
+	return raw << shift >> shift
+}
+
+// mutateRunes inserts, deletes, replaces or duplicates characters, or
+// splices in a string from the module
+func (m *witMutator) mutateRunes(runes []rune) []rune {
+	out := append([]rune(nil), runes...)
+	op := m.rng.Intn(5)
+	if len(out) == 0 {
+		op = 0
+	}
+	switch op {
+	case 0:
+		i := m.rng.Intn(len(out) + 1)
+		out = append(out[:i], append([]rune{m.char()}, out[i:]...)...)
+	case 1:
+		i := m.rng.Intn(len(out))
+		out = append(out[:i], out[i+1:]...)
+	case 2:
+		out[m.rng.Intn(len(out))] = m.char()
+	case 3:
+		i := m.rng.Intn(len(out))
+		j := i + m.rng.Intn(len(out)-i) + 1
+		out = append(out[:j], append(append([]rune(nil), out[i:j]...), out[j:]...)...)
+	default:
+		i := m.rng.Intn(len(out) + 1)
+		out = append(out[:i], append([]rune(m.text()), out[i:]...)...)
+	}
+	return out
+}
+
+// mutateList changes one element, or inserts, removes or duplicates one
+func (m *witMutator) mutateList(t *witType, elems []interface{}, depth int) []interface{} {
+	out := append([]interface{}(nil), elems...)
+	op := m.rng.Intn(4)
+	if len(out) == 0 {
+		op = 1
+	}
+	switch op {
+	case 0:
+		i := m.rng.Intn(len(out))
+		out[i] = m.mutate(t.Elem, out[i], depth+1)
+	case 1:
+		i := m.rng.Intn(len(out) + 1)
+		out = append(out[:i], append([]interface{}{m.generate(t.Elem, depth+1)}, out[i:]...)...)
+	case 2:
+		i := m.rng.Intn(len(out))
+		out = append(out[:i], out[i+1:]...)
+	default:
+		i := m.rng.Intn(len(out))
+		out = append(out, out[i])
+	}
+	return out
+}
+
+// generate creates a random value of type t
+func (m *witMutator) generate(t *witType, depth int) interface{} {
+	switch t.Kind {
+	case witBool:
+		return m.rng.Intn(2) == 1
+	case witS8, witS16, witS32, witS64, witU8, witU16, witU32, witU64:
+		return m.integer(t.Kind)
+	case witF32:
+		return float32(interestingFloats[m.rng.Intn(len(interestingFloats))])
+	case witF64:
+		return interestingFloats[m.rng.Intn(len(interestingFloats))]
+	case witChar:
+		return m.char()
+	case witString:
+		return m.text()
+	case witList:
+		limit := 5
+		if t.Elem.Kind == witU8 || t.Elem.Kind == witS8 {
+			limit = 33
+		}
+		if depth >= maxWITDepth {
+			limit = 1
+		}
+		elems := make([]interface{}, m.rng.Intn(limit))
+		for i := range elems {
+			elems[i] = m.generate(t.Elem, depth+1)
+		}
+		return elems
+	case witRecord, witTuple:
+		fields := make([]interface{}, len(t.Fields))
+		for i, field := range t.Fields {
+			fields[i] = m.generate(field.Type, depth+1)
+		}
+		return fields
+	case witFlags:
+		flags := make([]bool, len(t.Flags))
+		for i := range flags {
+			flags[i] = m.rng.Intn(2) == 1
+		}
+		return flags
+	case witEnum, witOption, witResult, witVariant:
+		value := witCaseValue{Case: m.rng.Intn(len(t.Cases))}
+		if payload := t.Cases[value.Case].Type; payload != nil {
+			value.Payload = m.generate(payload, depth+1)
+		}
+		return value
+	}
+	return zeroWITValue(t)
+}
+
+// integer picks a boundary value, module constant or random value
+func (m *witMutator) integer(kind witKind) interface{} {
+	switch m.rng.Intn(3) {
+	case 0:
+		return truncateWITInteger(kind, uint64(int64(interestingI32[m.rng.Intn(len(interestingI32))])))
+	case 1:
+		if len(m.numbers) > 0 {
+			return truncateWITInteger(kind, uint64(int64(m.numbers[m.rng.Intn(len(m.numbers))])))
+		}
+	}
+	return truncateWITInteger(kind, m.rng.Uint64())
+}
+
+// char picks an ASCII, boundary or random Unicode scalar value
+func (m *witMutator) char() rune {
+	switch m.rng.Intn(3) {
+	case 0:
+		return rune(0x20 + m.rng.Intn(0x5f))
+	case 1:
+		return interestingRunes[m.rng.Intn(len(interestingRunes))]
+	}
+	for {
+		r := rune(m.rng.Intn(utf8.MaxRune + 1))
+		if utf8.ValidRune(r) {
+			return r
+		}
+	}
+}
+
+// text picks a module string or builds a short random one
+func (m *witMutator) text() string {
+	if len(m.strings) > 0 && m.rng.Intn(2) == 0 {
+		return m.strings[m.rng.Intn(len(m.strings))]
+	}
+	runes := make([]rune, m.rng.Intn(17))
+	for i := range runes {
+		runes[i] = m.char()
+	}
+	return string(runes)
+}
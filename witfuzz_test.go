@@ -0,0 +1,157 @@
+//go:build !integration
+// +build !integration
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const routerWIT = `
+world router {
+    enum method { get, post, put }
+    record route { method: method, path: string, weight: u8 }
+    export dispatch: func(routes: list<route>) -> u32;
+}`
+
+// routerModule fails when a put route has a path of more than two
+// characters, reading the lowered routes from memory like real bindings
+func routerModule() *heapMockModule {
+	module := witMemoryModule(map[string]FuncSignature{
+		"dispatch": {Params: []string{"i32", "i32"}, Results: []string{"i32"}},
+	})
+	allocate := module.ExecuteFunc
+	module.ExecuteFunc = func(funcName string, args ...interface{}) ([]interface{}, error) {
+		if funcName != "dispatch" {
+			return allocate(funcName, args...)
+		}
+		ptr, count := uint32(args[0].(int32)), uint32(args[1].(int32))
+		for i := uint32(0); i < count; i++ {
+			// route: method u8 at 0, path at 4, weight u8 at 12; size 16
+			route := module.memory[ptr+16*i:]
+			length := binary.LittleEndian.Uint32(route[8:])
+			if route[0] == 2 && length > 2 {
+				return nil, &RuntimeError{Stage: StageExecute, Message: "execution failed: unreachable"}
+			}
+		}
+		return []interface{}{int32(count)}, nil
+	}
+	return module
+}
+
+// -----------------------------------------------------------------------------
+// TEST: Structured Value Fuzzing
+// -----------------------------------------------------------------------------
+//
+// WHY THIS MATTERS:
+// Mutating the flattened i32s of a list<route> yields pointers into nowhere.
+// Mutating the routes themselves keeps every input well-formed, so the
+// failures found are reachable through the module's real interface.
+// -----------------------------------------------------------------------------
+
+func TestWITFuzz_MutationsStayWellTyped(t *testing.T) {
+	doc, err := parseWIT(routerWIT + `
+interface extra {
+    variant shape { circle(f32), rect(tuple<s16, s16>), none }
+    flags perms { read, write }
+    f: func(a: shape, b: perms, c: char, d: option<list<s64>>, e: string);
+}`)
+	require.NoError(t, err)
+	fn, err := doc.function("f")
+	require.NoError(t, err)
+
+	seed, err := bindWITArguments(fn.defaultInput(), fn)
+	require.NoError(t, err)
+	mutator := newWITMutator(9, [][]interface{}{seed})
+
+	changed := make([]bool, len(fn.Params))
+	for i := 0; i < 500; i++ {
+		input := mutator.next()
+		require.Len(t, input, len(fn.Params))
+		for j, arg := range input {
+			value := arg.(witArg)
+			// Every value must survive the JSON round trip a report takes
+			encoded := value.encode()
+			decoded, err := decodeWITJSON(value.Type, encoded.Value)
+			require.NoError(t, err, encoded.Value)
+			assert.Equal(t, encoded, witArg{Type: value.Type, Value: decoded}.encode())
+			if s, ok := value.Value.(string); ok {
+				assert.True(t, utf8.ValidString(s))
+			}
+			changed[j] = changed[j] || encoded != seed[j].(witArg).encode()
+		}
+		mutator.keep(input)
+	}
+	assert.Equal(t, []bool{true, true, true, true, true}, changed)
+}
+
+func TestWITFuzz_SameSeedSameSequence(t *testing.T) {
+	doc, err := parseWIT(routerWIT)
+	require.NoError(t, err)
+	fn, _ := doc.function("dispatch")
+	seed, err := bindWITArguments(fn.defaultInput(), fn)
+	require.NoError(t, err)
+
+	a, b := newWITMutator(4, [][]interface{}{seed}), newWITMutator(4, [][]interface{}{seed})
+	for i := 0; i < 50; i++ {
+		assert.Equal(t, encodeValues(a.next()), encodeValues(b.next()))
+	}
+}
+
+func TestWITFuzz_ArgFuzzFindsStructuredFailure(t *testing.T) {
+	dir := t.TempDir()
+	modulePath := filepath.Join(dir, "router.wasm")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "router.wit"), []byte(routerWIT), 0644))
+
+	mockRuntime := &MockWasmRuntime{
+		LoadModuleFunc: func(filePath string) (WasmModule, error) { return routerModule(), nil },
+	}
+	opts := RunOptions{
+		Invocation: InvocationConfig{Entry: "dispatch"},
+		ArgFuzz:    ArgFuzzConfig{Iterations: 2000, Seed: 3},
+	}
+
+	result := processWasmFileWithOptions(modulePath, mockRuntime, opts)
+
+	require.NotNil(t, result.ArgFuzz)
+	require.Len(t, result.ArgFuzz.UniqueFailures, 1, result.ErrorMessage)
+	failure := result.ArgFuzz.UniqueFailures[0]
+	assert.Equal(t, "list<route>", failure.Args[0].Type)
+	assert.Contains(t, failure.Args[0].Value, `"method":"put"`)
+	assert.Nil(t, failure.Correlation, "bit correlation applies to i32 inputs only")
+	assert.Equal(t, StageExecute, result.FailureStage)
+	assert.True(t, strings.HasPrefix(result.ErrorMessage, "input [{"), result.ErrorMessage)
+
+	// The reported input replays as a configured input
+	replay := RunOptions{Invocation: InvocationConfig{Entry: "dispatch", Inputs: []InvocationInput{{failure.Args[0]}}}}
+	result = processWasmFileWithOptions(modulePath, mockRuntime, replay)
+	assert.Equal(t, "execution failed: unreachable", result.ErrorMessage)
+}
+
+func TestWITFuzz_LoweringFailureIsReported(t *testing.T) {
+	dir := t.TempDir()
+	modulePath := filepath.Join(dir, "router.wasm")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "router.wit"), []byte(routerWIT), 0644))
+
+	module := routerModule()
+	module.ExecuteFunc = func(funcName string, args ...interface{}) ([]interface{}, error) {
+		return nil, errors.New("out of memory")
+	}
+	mockRuntime := &MockWasmRuntime{
+		LoadModuleFunc: func(filePath string) (WasmModule, error) { return module, nil },
+	}
+
+	result := processWasmFileWithOptions(modulePath, mockRuntime, RunOptions{Invocation: InvocationConfig{Entry: "dispatch"}})
+
+	assert.Equal(t, StageExecute, result.FailureStage)
+	assert.Equal(t, "execution failed: argument 0 (routes): allocator 'cabi_realloc' failed: execution failed: out of memory", result.ErrorMessage)
+}
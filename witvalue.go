@@ -0,0 +1,515 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// structuredValueType marks input values written as YAML lists or
+// mappings, which only WIT-typed parameters accept
+const structuredValueType = "structured"
+
+// WIT values are held as Go values by kind: bool; int64 for signed and
+// uint64 for unsigned integers; float32 and float64; rune for char;
+// string; []interface{} for lists, records and tuples (fields in
+// declaration order); witCaseValue for variants, enums, options and
+// results; and []bool for flags.
+
+// witCaseValue is a value of a variant-like type
+type witCaseValue struct {
+	Case    int
+	Payload interface{}
+}
+
+// witArg is a WIT-typed argument awaiting canonical ABI lowering
+type witArg struct {
+	Type  *witType
+	Value interface{}
+}
+
+// encode renders the argument for reports as its WIT type and JSON value,
+// which inputs accept back as {type, value}
+func (a witArg) encode() WasmValue {
+	data, err := json.Marshal(encodeWITValue(a.Type, a.Value))
+	if err != nil {
+		return WasmValue{Type: a.Type.String(), Value: fmt.Sprint(a.Value)}
+	}
+	return WasmValue{Type: a.Type.String(), Value: string(data)}
+}
+
+// encodeWITValue converts a value to its JSON form: 64-bit integers as
+// decimal strings so they survive JSON, non-finite floats and negative zero
+// as hex bits, enums as case names, options as null or their payload,
+// results as {"ok": ...} or {"err": ...}, other variants as a single-key
+// object and flags as the list of set flags
+func encodeWITValue(t *witType, v interface{}) interface{} {
+	switch t.Kind {
+	case witS64:
+		return strconv.FormatInt(v.(int64), 10)
+	case witU64:
+		return strconv.FormatUint(v.(uint64), 10)
+	case witF32:
+		f := v.(float32)
+		if math.IsNaN(float64(f)) || math.IsInf(float64(f), 0) || math.Signbit(float64(f)) && f == 0 {
+			return fmt.Sprintf("0x%08x", math.Float32bits(f))
+		}
+		return f
+	case witF64:
+		f := v.(float64)
+		if math.IsNaN(f) || math.IsInf(f, 0) || math.Signbit(f) && f == 0 {
+			return fmt.Sprintf("0x%016x", math.Float64bits(f))
+		}
+		return f
+	case witChar:
+		return string(v.(rune))
+	case witList, witTuple:
+		elems := v.([]interface{})
+		encoded := make([]interface{}, len(elems))
+		for i, elem := range elems {
+			elemType := t.Elem
+			if t.Kind == witTuple {
+				elemType = t.Fields[i].Type
+			}
+			encoded[i] = encodeWITValue(elemType, elem)
+		}
+		return encoded
+	case witRecord:
+		fields := v.([]interface{})
+		encoded := make(map[string]interface{}, len(fields))
+		for i, field := range t.Fields {
+			encoded[field.Name] = encodeWITValue(field.Type, fields[i])
+		}
+		return encoded
+	case witEnum:
+		return t.Cases[v.(witCaseValue).Case].Name
+	case witOption, witResult, witVariant:
+		value := v.(witCaseValue)
+		c := t.Cases[value.Case]
+		var payload interface{}
+		if c.Type != nil {
+			payload = encodeWITValue(c.Type, value.Payload)
+		}
+		if t.Kind == witOption {
+			return payload
+		}
+		return map[string]interface{}{c.Name: payload}
+	case witFlags:
+		set := []string{}
+		for i, on := range v.([]bool) {
+			if on {
+				set = append(set, t.Flags[i])
+			}
+		}
+		return set
+	}
+	return v
+}
+
+// decodeWITJSON parses the JSON form of a value
+func decodeWITJSON(t *witType, text string) (interface{}, error) {
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.UseNumber()
+	var j interface{}
+	if err := decoder.Decode(&j); err != nil {
+		return nil, fmt.Errorf("invalid %s value %q: %v", t, text, err)
+	}
+	return decodeWITValue(t, j)
+}
+
+// decodeWITValue converts a decoded JSON value to a WIT value, checking it
+// against the type
+func decodeWITValue(t *witType, j interface{}) (interface{}, error) {
+	mismatch := func() error {
+		data, _ := json.Marshal(j)
+		return fmt.Errorf("invalid %s value %s", t, data)
+	}
+
+	switch t.Kind {
+	case witBool:
+		b, ok := j.(bool)
+		if !ok {
+			return nil, mismatch()
+		}
+		return b, nil
+	case witS8, witS16, witS32, witS64, witU8, witU16, witU32, witU64:
+		var text string
+		switch n := j.(type) {
+		case json.Number:
+			text = n.String()
+		case string:
+			text = n
+		default:
+			return nil, mismatch()
+		}
+		v, err := parseWITInteger(t.Kind, text)
+		if err != nil {
+			return nil, err
+		}
+		return v, nil
+	case witF32, witF64:
+		var text string
+		switch n := j.(type) {
+		case json.Number:
+			text = n.String()
+		case string:
+			text = n
+		default:
+			return nil, mismatch()
+		}
+		return parseWITFloat(t.Kind, text)
+	case witChar:
+		s, ok := j.(string)
+		if !ok || utf8.RuneCountInString(s) != 1 || !utf8.ValidString(s) {
+			return nil, mismatch()
+		}
+		r, _ := utf8.DecodeRuneInString(s)
+		return r, nil
+	case witString:
+		s, ok := j.(string)
+		if !ok {
+			return nil, mismatch()
+		}
+		return s, nil
+	case witList, witTuple:
+		elems, ok := j.([]interface{})
+		if !ok || t.Kind == witTuple && len(elems) != len(t.Fields) {
+			return nil, mismatch()
+		}
+		values := make([]interface{}, len(elems))
+		for i, elem := range elems {
+			elemType := t.Elem
+			if t.Kind == witTuple {
+				elemType = t.Fields[i].Type
+			}
+			v, err := decodeWITValue(elemType, elem)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = v
+		}
+		return values, nil
+	case witRecord:
+		fields, ok := j.(map[string]interface{})
+		if !ok {
+			return nil, mismatch()
+		}
+		values := make([]interface{}, len(t.Fields))
+		for i, field := range t.Fields {
+			raw, present := fields[field.Name]
+			if !present {
+				return nil, fmt.Errorf("%s value is missing field '%s'", t, field.Name)
+			}
+			v, err := decodeWITValue(field.Type, raw)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = v
+		}
+		if len(fields) != len(t.Fields) {
+			return nil, fmt.Errorf("%s value has unknown fields", t)
+		}
+		return values, nil
+	case witEnum:
+		name, ok := j.(string)
+		if !ok {
+			return nil, mismatch()
+		}
+		for i, c := range t.Cases {
+			if c.Name == name {
+				return witCaseValue{Case: i}, nil
+			}
+		}
+		return nil, fmt.Errorf("%s has no case '%s'", t, name)
+	case witOption:
+		if j == nil {
+			return witCaseValue{Case: 0}, nil
+		}
+		v, err := decodeWITValue(t.Cases[1].Type, j)
+		if err != nil {
+			return nil, err
+		}
+		return witCaseValue{Case: 1, Payload: v}, nil
+	case witResult, witVariant:
+		object, ok := j.(map[string]interface{})
+		if !ok || len(object) != 1 {
+			return nil, mismatch()
+		}
+		for name, raw := range object {
+			for i, c := range t.Cases {
+				if c.Name != name {
+					continue
+				}
+				if c.Type == nil {
+					if raw != nil {
+						return nil, fmt.Errorf("case '%s' of %s has no payload", name, t)
+					}
+					return witCaseValue{Case: i}, nil
+				}
+				v, err := decodeWITValue(c.Type, raw)
+				if err != nil {
+					return nil, err
+				}
+				return witCaseValue{Case: i, Payload: v}, nil
+			}
+			return nil, fmt.Errorf("%s has no case '%s'", t, name)
+		}
+	case witFlags:
+		names, ok := j.([]interface{})
+		if !ok {
+			return nil, mismatch()
+		}
+		flags := make([]bool, len(t.Flags))
+		for _, raw := range names {
+			name, _ := raw.(string)
+			found := false
+			for i, flag := range t.Flags {
+				if flag == name {
+					flags[i], found = true, true
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("%s has no flag %v", t, raw)
+			}
+		}
+		return flags, nil
+	}
+	return nil, fmt.Errorf("%s values are not supported", t)
+}
+
+// witIntegerBits returns the width and signedness of an integer kind
+func witIntegerBits(kind witKind) (int, bool) {
+	switch kind {
+	case witS8:
+		return 8, true
+	case witU8:
+		return 8, false
+	case witS16:
+		return 16, true
+	case witU16:
+		return 16, false
+	case witS32:
+		return 32, true
+	case witU32:
+		return 32, false
+	case witS64:
+		return 64, true
+	}
+	return 64, false
+}
+
+// parseWITInteger parses a decimal or 0x-prefixed integer in range of kind
+func parseWITInteger(kind witKind, text string) (interface{}, error) {
+	bits, signed := witIntegerBits(kind)
+	t := &witType{Kind: kind}
+	if signed {
+		n, err := strconv.ParseInt(text, 0, bits)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s value %q", t, text)
+		}
+		return n, nil
+	}
+	n, err := strconv.ParseUint(text, 0, bits)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s value %q", t, text)
+	}
+	return n, nil
+}
+
+// parseWITFloat parses a decimal float or 0x-prefixed IEEE-754 bits
+func parseWITFloat(kind witKind, text string) (interface{}, error) {
+	bits := 64
+	if kind == witF32 {
+		bits = 32
+	}
+	if strings.HasPrefix(text, "0x") {
+		raw, err := parseHexBits(text, bits)
+		if err != nil {
+			return nil, fmt.Errorf("invalid f%d bits %q", bits, text)
+		}
+		if kind == witF32 {
+			return math.Float32frombits(uint32(raw)), nil
+		}
+		return math.Float64frombits(raw), nil
+	}
+	f, err := strconv.ParseFloat(text, bits)
+	if err != nil {
+		return nil, fmt.Errorf("invalid f%d value %q", bits, text)
+	}
+	if kind == witF32 {
+		return float32(f), nil
+	}
+	return f, nil
+}
+
+// zeroWITValue is the smallest value of a type: zero numbers, empty
+// strings and lists, and the first case of variants
+func zeroWITValue(t *witType) interface{} {
+	switch t.Kind {
+	case witBool:
+		return false
+	case witS8, witS16, witS32, witS64:
+		return int64(0)
+	case witU8, witU16, witU32, witU64:
+		return uint64(0)
+	case witF32:
+		return float32(0)
+	case witF64:
+		return float64(0)
+	case witChar:
+		return 'a'
+	case witString:
+		return ""
+	case witList:
+		return []interface{}{}
+	case witRecord, witTuple:
+		fields := make([]interface{}, len(t.Fields))
+		for i, field := range t.Fields {
+			fields[i] = zeroWITValue(field.Type)
+		}
+		return fields
+	case witEnum, witOption, witResult, witVariant:
+		value := witCaseValue{}
+		if payload := t.Cases[0].Type; payload != nil {
+			value.Payload = zeroWITValue(payload)
+		}
+		return value
+	case witFlags:
+		return make([]bool, len(t.Flags))
+	}
+	return nil
+}
+
+// defaultInput is the input a WIT function is called with when none is
+// configured: the zero value of every parameter
+func (f *witFunction) defaultInput() InvocationInput {
+	input := make(InvocationInput, len(f.Params))
+	for i, param := range f.Params {
+		input[i] = witArg{Type: param.Type, Value: zeroWITValue(param.Type)}.encode()
+	}
+	return input
+}
+
+// bindWITArguments converts one input to a WIT function's parameter types.
+// Plain scalars are read as the parameter's type, so strings and enum cases
+// need no quoting; lists and mappings are structured values; typed values
+// must name the parameter's WIT type.
+func bindWITArguments(input InvocationInput, fn *witFunction) ([]interface{}, error) {
+	if len(input) != len(fn.Params) {
+		return nil, fmt.Errorf("%d arguments given, %d expected", len(input), len(fn.Params))
+	}
+	args := make([]interface{}, len(input))
+	for i, value := range input {
+		t := fn.Params[i].Type
+		v, err := bindWITValue(value, t)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d (%s): %w", i, fn.Params[i].Name, err)
+		}
+		args[i] = witArg{Type: t, Value: v}
+	}
+	return args, nil
+}
+
+// bindWITValue converts one input value to a WIT type
+func bindWITValue(value WasmValue, t *witType) (interface{}, error) {
+	if t.Kind == witResource {
+		return nil, fmt.Errorf("resource parameters are not supported")
+	}
+	switch value.Type {
+	case structuredValueType:
+		return decodeWITJSON(t, value.Value)
+	case "":
+	default:
+		if value.Type != t.String() {
+			return nil, fmt.Errorf("%s value given for %s parameter", value.Type, t)
+		}
+		return decodeWITJSON(t, value.Value)
+	}
+
+	switch t.Kind {
+	case witBool:
+		b, err := strconv.ParseBool(value.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bool value %q", value.Value)
+		}
+		return b, nil
+	case witS8, witS16, witS32, witS64, witU8, witU16, witU32, witU64:
+		return parseWITInteger(t.Kind, value.Value)
+	case witF32, witF64:
+		return parseWITFloat(t.Kind, value.Value)
+	case witChar, witString, witEnum:
+		return decodeWITValue(t, value.Value)
+	}
+	return nil, fmt.Errorf("%s parameters need a structured value", t)
+}
+
+// yamlStructuredValue encodes a YAML list or mapping as the JSON text of a
+// structured input value
+func yamlStructuredValue(decoded interface{}) (WasmValue, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(jsonCompatible(decoded)); err != nil {
+		return WasmValue{}, err
+	}
+	return WasmValue{Type: structuredValueType, Value: strings.TrimSpace(buf.String())}, nil
+}
+
+// jsonCompatible converts the map[interface{}]interface{} keys YAML may
+// produce into strings
+func jsonCompatible(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for key, elem := range val {
+			val[key] = jsonCompatible(elem)
+		}
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(val))
+		for key, elem := range val {
+			converted[fmt.Sprint(key)] = jsonCompatible(elem)
+		}
+		return converted
+	case []interface{}:
+		for i, elem := range val {
+			val[i] = jsonCompatible(elem)
+		}
+	}
+	return v
+}
+
+// loadInterface reads the WIT declaration of the entry, from the
+// configured file or a .wit file next to the module, and replaces a
+// defaulted input with the zero value of each parameter. Entries called
+// through another ABI take no WIT-typed arguments.
+func (c *InvocationConfig) loadInterface(filePath string, defaulted bool) error {
+	if c.ABI != "" {
+		return nil
+	}
+	path := c.WIT
+	if path == "" {
+		path = strings.TrimSuffix(filePath, filepath.Ext(filePath)) + ".wit"
+		if _, err := os.Stat(path); err != nil {
+			return nil
+		}
+	}
+
+	doc, err := loadWIT(path)
+	if err != nil {
+		return &RuntimeError{Stage: StageSignature, Message: fmt.Sprintf("wit: %v", err)}
+	}
+	fn, err := doc.function(c.Entry)
+	if err != nil {
+		return &RuntimeError{Stage: StageSignature, Message: fmt.Sprintf("wit: %s: %v", path, err)}
+	}
+	c.function = fn
+	if defaulted {
+		c.Inputs = []InvocationInput{fn.defaultInput()}
+	}
+	return nil
+}